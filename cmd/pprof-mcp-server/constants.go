@@ -1,6 +0,0 @@
-package main
-
-const (
-	defaultTracesLines = 200
-	maxTracesLines     = 500
-)
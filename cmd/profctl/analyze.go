@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/arreyder/pprof-mcp/internal/datadog"
+	"github.com/arreyder/pprof-mcp/internal/pprof"
+)
+
+// runAnalyze chains service search, pick, download, meta, hotspot summary,
+// storylines, and report generation into one command.
+func runAnalyze(args []string, out io.Writer) error {
+	fs := newFlagSet("analyze")
+	service := fs.String("service", "", "Datadog service name (or use --query)")
+	query := fs.String("query", "", "fuzzy service name to search for when --service is not known")
+	env := fs.String("env", "", "Datadog environment")
+	outDir := fs.String("out", cliConfig.Workspace, "output directory for profiles and the report")
+	ddSite := fs.String("dd_site", "", "Datadog site, defaults to DD_SITE or us3.datadoghq.com")
+	hours := fs.Int("hours", 72, "time window in hours")
+	host := fs.String("host", "", "host filter (supports wildcards)")
+	strategy := fs.String("strategy", "latest", "pick strategy: latest|oldest|most_samples")
+	n := fs.Int("n", 4, "number of storylines (2-6)")
+	repoRoot := fs.String("repo_root", ".", "repo root for source path")
+	trimPath := fs.String("trim_path", cliConfig.TrimPathOr(""), "trim path for sources (default: inferred from the profile's paths and repo_root)")
+	revision := fs.String("revision", "", "profiled commit that storyline permalinks point at (default: repo_root's HEAD)")
+	format := fs.String("format", "markdown", "report format: markdown|json")
+	reportPath := fs.String("report", "", "report output path (default: <out>/report.md or report.json)")
+	groupBy := fs.String("group_by", "", "group the Markdown report into a section per owning team: team")
+	var repoPrefixes multiFlag
+	fs.Var(&repoPrefixes, "repo_prefix", "repo prefix to identify app-owned frames")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	applyPreset(fs)
+	if len(repoPrefixes) == 0 {
+		repoPrefixes = cliConfig.RepoPrefixes
+	}
+
+	if (*service == "" && *query == "") || *env == "" || *outDir == "" {
+		return errors.New("analyze requires --service (or --query), --env, and --out")
+	}
+	if *format != "markdown" && *format != "json" {
+		return fmt.Errorf("unknown --format %q (want markdown or json)", *format)
+	}
+
+	ctx := context.Background()
+	steps := []string{}
+	logStep := func(format string, args ...any) {
+		line := fmt.Sprintf(format, args...)
+		steps = append(steps, line)
+		fmt.Fprintln(os.Stderr, "==> "+line)
+	}
+
+	if *service == "" {
+		result, err := datadog.ListServicesWithProfiling(ctx, datadog.ListServicesParams{Env: *env, Site: *ddSite, Minutes: 15})
+		if err != nil {
+			return fmt.Errorf("search services: %w", err)
+		}
+		matches := datadog.FuzzySearchServices(*query, result.Services)
+		if len(matches) == 0 {
+			return fmt.Errorf("no services match %q in %s", *query, *env)
+		}
+		*service = matches[0].Service
+		logStep("services search %q: picked %s (score %.2f)", *query, *service, matches[0].Score)
+	}
+
+	picked, err := datadog.PickProfile(ctx, datadog.PickProfilesParams{
+		Service:  *service,
+		Env:      *env,
+		Hours:    *hours,
+		Site:     *ddSite,
+		Host:     *host,
+		Strategy: datadog.PickStrategy(*strategy),
+		Index:    -1,
+	})
+	if err != nil {
+		return fmt.Errorf("pick profile: %w", err)
+	}
+	logStep("pick %s: profile %s at %s", *strategy, picked.Candidate.ProfileID, picked.Candidate.Timestamp)
+
+	bundle, err := datadog.DownloadLatestBundle(ctx, datadog.DownloadParams{
+		Service:   *service,
+		Env:       *env,
+		OutDir:    *outDir,
+		Site:      *ddSite,
+		Hours:     *hours,
+		ProfileID: picked.Candidate.ProfileID,
+		EventID:   picked.Candidate.EventID,
+	})
+	if err != nil {
+		return fmt.Errorf("download: %w", err)
+	}
+	logStep("download: %d files into %s", len(bundle.Files), *outDir)
+
+	profiles := map[string]string{}
+	metas := map[string]any{}
+	for _, file := range bundle.Files {
+		if _, seen := profiles[file.Type]; seen || !strings.HasSuffix(file.Path, ".pprof") {
+			continue
+		}
+		profiles[file.Type] = file.Path
+		meta, err := pprof.RunMeta(file.Path)
+		if err != nil {
+			logStep("meta %s: %v", file.Type, err)
+			continue
+		}
+		metas[file.Type] = meta
+	}
+	logStep("meta: %d profiles", len(metas))
+
+	hotspots, err := pprof.RunHotspotSummary(ctx, pprof.HotspotSummaryParams{Profiles: profiles, RepoRoot: *repoRoot})
+	if err != nil {
+		return fmt.Errorf("hotspot summary: %w", err)
+	}
+	logStep("hotspot summary: %d cpu, %d heap, %d mutex hotspots", len(hotspots.CPUTop5), len(hotspots.HeapTop5), len(hotspots.MutexTop5))
+
+	var storylines *pprof.StorylinesResult
+	if cpuPath := profiles["cpu"]; cpuPath != "" {
+		result, err := pprof.RunStorylines(ctx, pprof.StorylinesParams{
+			Profile:      cpuPath,
+			N:            *n,
+			RepoPrefixes: repoPrefixes,
+			RepoRoot:     *repoRoot,
+			TrimPath:     *trimPath,
+			Revision:     *revision,
+		})
+		if err != nil {
+			logStep("storylines: %v", err)
+		} else {
+			storylines = &result
+			logStep("storylines: %d", len(result.Storylines))
+		}
+	}
+
+	payload := jsonOutput{
+		"service":         *service,
+		"env":             *env,
+		"pick":            picked,
+		"download":        bundle,
+		"meta":            metas,
+		"hotspot_summary": hotspots,
+		"storylines":      storylines,
+		"steps":           steps,
+	}
+
+	hotspotTable := func() tableView {
+		t := tableView{columns: []string{"kind", "function", "pct"}}
+		for _, h := range hotspots.CPUTop5 {
+			t.rows = append(t.rows, []string{"cpu", h.Function, fmt.Sprintf("%.2f", h.FlatPct)})
+		}
+		for _, h := range hotspots.HeapTop5 {
+			t.rows = append(t.rows, []string{"heap", h.Function, fmt.Sprintf("%.2f", h.AllocPct)})
+		}
+		for _, h := range hotspots.MutexTop5 {
+			t.rows = append(t.rows, []string{"mutex", h.Function, fmt.Sprintf("%.2f", h.DelayPct)})
+		}
+		return t
+	}
+
+	path := *reportPath
+	if *format == "json" {
+		if path == "" {
+			path = filepath.Join(*outDir, "report.json")
+		}
+		if err := writeJSONFile(path, payload); err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "==> report: "+path)
+		return render(out, view{payload: payload, table: hotspotTable, jsonFlag: true})
+	}
+
+	inputs := []pprof.ReportInput{
+		{Kind: "hotspot_summary", Data: toReportData(hotspots)},
+	}
+	if storylines != nil {
+		inputs = append(inputs, pprof.ReportInput{Kind: "storylines", Data: toReportData(storylines)})
+	}
+	report, err := pprof.GenerateReport(pprof.ReportParams{
+		Title:    fmt.Sprintf("Profile analysis: %s (%s) at %s", *service, *env, bundle.Timestamp),
+		Inputs:   inputs,
+		GroupBy:  *groupBy,
+		RepoRoot: *repoRoot,
+		Teams:    cliConfig.Teams,
+	})
+	if err != nil {
+		return fmt.Errorf("report: %w", err)
+	}
+	if path == "" {
+		path = filepath.Join(*outDir, "report.md")
+	}
+	if err := os.WriteFile(path, []byte(report.Markdown+"\n"), 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "==> report: "+path)
+	return render(out, view{
+		payload: payload,
+		table:   hotspotTable,
+		text: func(w io.Writer) error {
+			_, err := fmt.Fprintln(w, report.Markdown)
+			return err
+		},
+	})
+}
+
+// toReportData converts a typed result into the map form GenerateReport takes.
+func toReportData(value any) map[string]any {
+	data := map[string]any{}
+	_ = decodeInto(value, &data)
+	return data
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/baseline"
+	"github.com/arreyder/pprof-mcp/internal/datadog"
+	"github.com/arreyder/pprof-mcp/internal/pprof"
+	"github.com/arreyder/pprof-mcp/internal/pprofparse"
+)
+
+// baselineFlags are shared by baseline record and check. Profiles come from
+// --profile or, without it, from Datadog for --service/--env.
+type baselineFlags struct {
+	service      *string
+	env          *string
+	site         *string
+	host         *string
+	hours        *int
+	outDir       *string
+	baselinePath *string
+	key          *string
+	sampleIndex  *string
+	types        *string
+	profiles     multiFlag
+}
+
+func addBaselineFlags(fs *flag.FlagSet, hours int) *baselineFlags {
+	f := &baselineFlags{
+		service:      fs.String("service", "", "Datadog service name (part of the baseline key)"),
+		env:          fs.String("env", "", "Datadog environment (part of the baseline key)"),
+		site:         fs.String("site", "", "Datadog site (defaults to us3.datadoghq.com)"),
+		host:         fs.String("host", "", "host filter (supports wildcards)"),
+		hours:        fs.Int("hours", hours, "Datadog time window in hours"),
+		outDir:       fs.String("out", cliConfig.Workspace, "directory for downloads and the default baseline store"),
+		baselinePath: fs.String("baseline_path", "", "baseline store (default: <out>/"+baseline.DefaultFile+")"),
+		key:          fs.String("key", "", "baseline key (default: <service>:<env>)"),
+		sampleIndex:  fs.String("sample_index", "", "pprof sample index (default: the profile's default)"),
+		types:        fs.String("types", "cpu,heap", "comma-separated profile types to use from Datadog bundles"),
+	}
+	fs.Var(&f.profiles, "profile", "local .pprof profile (repeatable; skips Datadog)")
+	return f
+}
+
+func (f *baselineFlags) storePath() string {
+	if *f.baselinePath != "" {
+		return *f.baselinePath
+	}
+	return filepath.Join(*f.outDir, baseline.DefaultFile)
+}
+
+func (f *baselineFlags) sampleKey() string {
+	if *f.sampleIndex == "" {
+		return "default"
+	}
+	return *f.sampleIndex
+}
+
+func (f *baselineFlags) validate() error {
+	if len(f.profiles) == 0 && (*f.service == "" || *f.env == "" || *f.outDir == "") {
+		return errors.New("requires --profile, or --service, --env, and --out to fetch from Datadog")
+	}
+	return nil
+}
+
+// baselineProfile is one profile file to record or check.
+type baselineProfile struct {
+	Path      string `json:"path"`
+	ProfileID string `json:"profile_id,omitempty"`
+	Timestamp string `json:"timestamp,omitempty"`
+}
+
+type baselineRecorded struct {
+	Key         string `json:"key"`
+	ProfileKind string `json:"profile_kind"`
+	Profile     string `json:"profile"`
+	ProfileID   string `json:"profile_id,omitempty"`
+	Samples     int    `json:"samples"`
+	Functions   int    `json:"functions"`
+}
+
+type baselineCheck struct {
+	Profile    string              `json:"profile"`
+	ProfileID  string              `json:"profile_id,omitempty"`
+	Comparison baseline.Comparison `json:"comparison"`
+}
+
+// runBaseline exposes the baseline store shared with pprof.top and watch.
+func runBaseline(args []string, out io.Writer) error {
+	if len(args) < 1 {
+		return errors.New("usage: profctl baseline <record|check|list|prune>")
+	}
+	switch args[0] {
+	case "record":
+		return runBaselineRecord(args[1:], out)
+	case "check":
+		if err := runBaselineCheck(args[1:], out); err != nil {
+			var exit *exitError
+			if errors.As(err, &exit) {
+				return err
+			}
+			return &exitError{code: exitCheckError, err: err}
+		}
+		return nil
+	case "list":
+		return runBaselineList(args[1:], out)
+	case "prune":
+		return runBaselinePrune(args[1:], out)
+	default:
+		return fmt.Errorf("unknown baseline command: %s", args[0])
+	}
+}
+
+func runBaselineRecord(args []string, out io.Writer) error {
+	fs := newFlagSet("baseline record")
+	f := addBaselineFlags(fs, 24)
+	count := fs.Int("count", 5, "number of recent Datadog profiles to record")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	applyPreset(fs)
+	if err := f.validate(); err != nil {
+		return fmt.Errorf("baseline record %w", err)
+	}
+
+	ctx := context.Background()
+	profiles := localBaselineProfiles(f.profiles)
+	if len(profiles) == 0 {
+		listed, err := datadog.ListProfiles(ctx, datadog.ListProfilesParams{
+			Service: *f.service,
+			Env:     *f.env,
+			Hours:   *f.hours,
+			Limit:   *count,
+			Site:    *f.site,
+			Host:    *f.host,
+		})
+		if err != nil {
+			return fmt.Errorf("list profiles: %w", err)
+		}
+		if len(listed.Candidates) == 0 {
+			return fmt.Errorf("no profiles for %s/%s in the last %d hours", *f.service, *f.env, *f.hours)
+		}
+		candidates := listed.Candidates
+		if len(candidates) > *count {
+			candidates = candidates[:*count]
+		}
+		for _, candidate := range candidates {
+			fetched, err := fetchBaselineProfiles(ctx, f, candidate)
+			if err != nil {
+				return err
+			}
+			profiles = append(profiles, fetched...)
+		}
+	}
+
+	recorded := []baselineRecorded{}
+	for _, profile := range profiles {
+		kind, rows, err := baselineTop(ctx, profile.Path, *f.sampleIndex)
+		if err != nil {
+			return err
+		}
+		key := baseline.Key(*f.service, *f.env, *f.key, kind, f.sampleKey())
+		entry, err := baseline.Record(f.storePath(), key, kind, f.sampleKey(), rows)
+		if err != nil {
+			return fmt.Errorf("record %s: %w", profile.Path, err)
+		}
+		recorded = append(recorded, baselineRecorded{
+			Key:         key,
+			ProfileKind: kind,
+			Profile:     profile.Path,
+			ProfileID:   profile.ProfileID,
+			Samples:     entry.Samples,
+			Functions:   len(entry.Functions),
+		})
+	}
+
+	return render(out, view{
+		payload: jsonOutput{"baseline_path": f.storePath(), "recorded": recorded},
+		table: func() tableView {
+			return objectsTable(recorded, "key", "profile", "samples", "functions")
+		},
+		text: func(w io.Writer) error {
+			for _, r := range recorded {
+				fmt.Fprintf(w, "recorded %s into %s (%d samples)\n", r.Profile, r.Key, r.Samples)
+			}
+			return nil
+		},
+	})
+}
+
+func runBaselineCheck(args []string, out io.Writer) error {
+	fs := newFlagSet("baseline check")
+	f := addBaselineFlags(fs, 2)
+	minSeverity := fs.String("min_severity", "medium", "lowest deviation severity that fails the check: low|medium|high")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	applyPreset(fs)
+	if err := f.validate(); err != nil {
+		return fmt.Errorf("baseline check %w", err)
+	}
+	if baseline.SeverityRank(*minSeverity) == 0 {
+		return fmt.Errorf("unknown --min_severity %q (want low, medium, or high)", *minSeverity)
+	}
+
+	ctx := context.Background()
+	profiles := localBaselineProfiles(f.profiles)
+	if len(profiles) == 0 {
+		picked, err := datadog.PickProfile(ctx, datadog.PickProfilesParams{
+			Service:  *f.service,
+			Env:      *f.env,
+			Hours:    *f.hours,
+			Site:     *f.site,
+			Host:     *f.host,
+			Strategy: datadog.PickLatest,
+			Index:    -1,
+		})
+		if err != nil {
+			return fmt.Errorf("pick profile: %w", err)
+		}
+		profiles, err = fetchBaselineProfiles(ctx, f, picked.Candidate)
+		if err != nil {
+			return err
+		}
+	}
+
+	checks := []baselineCheck{}
+	alerts := []baseline.Deviation{}
+	for _, profile := range profiles {
+		kind, rows, err := baselineTop(ctx, profile.Path, *f.sampleIndex)
+		if err != nil {
+			return err
+		}
+		key := baseline.Key(*f.service, *f.env, *f.key, kind, f.sampleKey())
+		comparison, err := baseline.Compare(f.storePath(), key, kind, f.sampleKey(), rows)
+		if err != nil {
+			return fmt.Errorf("check %s: %w", profile.Path, err)
+		}
+		sort.SliceStable(comparison.Deviations, func(i, j int) bool {
+			return absDelta(comparison.Deviations[i].Delta) > absDelta(comparison.Deviations[j].Delta)
+		})
+		checks = append(checks, baselineCheck{Profile: profile.Path, ProfileID: profile.ProfileID, Comparison: comparison})
+		for _, deviation := range comparison.Deviations {
+			if baseline.SeverityRank(deviation.Severity) >= baseline.SeverityRank(*minSeverity) {
+				alerts = append(alerts, deviation)
+			}
+		}
+	}
+
+	if err := render(out, view{
+		payload: jsonOutput{"baseline_path": f.storePath(), "checks": checks, "alerts": alerts},
+		table: func() tableView {
+			return objectsTable(alerts, "severity", "function", "metric", "baseline", "current", "delta")
+		},
+		text: func(w io.Writer) error {
+			for _, check := range checks {
+				c := check.Comparison
+				fmt.Fprintf(w, "%s vs %s (%d samples): %d deviations\n", check.Profile, c.Key, c.BaselineSamples, len(c.Deviations))
+				for _, warning := range c.Warnings {
+					fmt.Fprintf(w, "  warning: %s\n", warning)
+				}
+				for _, d := range c.Deviations {
+					fmt.Fprintf(w, "  [%s] %s %s %.1f%% -> %.1f%% (%+.1f)\n", d.Severity, d.Function, d.Metric, d.Baseline, d.Current, d.Delta)
+				}
+			}
+			return nil
+		},
+	}); err != nil {
+		return err
+	}
+	if len(alerts) > 0 {
+		return &exitError{code: exitRegressed, err: fmt.Errorf("baseline check failed: %d deviations at or above %s", len(alerts), *minSeverity)}
+	}
+	return nil
+}
+
+func runBaselineList(args []string, out io.Writer) error {
+	fs := newFlagSet("baseline list")
+	outDir := fs.String("out", cliConfig.Workspace, "directory holding the default baseline store")
+	baselinePath := fs.String("baseline_path", "", "baseline store (default: <out>/"+baseline.DefaultFile+")")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	path := firstNonEmptyString(*baselinePath, filepath.Join(*outDir, baseline.DefaultFile))
+
+	store, err := baseline.LoadStore(path)
+	if err != nil {
+		return err
+	}
+	type listedEntry struct {
+		Key         string `json:"key"`
+		ProfileKind string `json:"profile_kind"`
+		SampleIndex string `json:"sample_index,omitempty"`
+		Samples     int    `json:"samples"`
+		Functions   int    `json:"functions"`
+		UpdatedAt   string `json:"updated_at"`
+	}
+	entries := []listedEntry{}
+	for _, entry := range store.Entries {
+		entries = append(entries, listedEntry{
+			Key:         entry.Key,
+			ProfileKind: entry.ProfileKind,
+			SampleIndex: entry.SampleIndex,
+			Samples:     entry.Samples,
+			Functions:   len(entry.Functions),
+			UpdatedAt:   entry.UpdatedAt,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+
+	return render(out, view{
+		payload: jsonOutput{"baseline_path": path, "entries": entries},
+		table: func() tableView {
+			return objectsTable(entries, "key", "samples", "functions", "updated_at")
+		},
+		text: func(w io.Writer) error {
+			if len(entries) == 0 {
+				_, err := fmt.Fprintf(w, "# %s: no baselines\n", path)
+				return err
+			}
+			for _, entry := range entries {
+				fmt.Fprintf(w, "%s\t%d samples\t%d functions\tupdated %s\n", entry.Key, entry.Samples, entry.Functions, entry.UpdatedAt)
+			}
+			return nil
+		},
+	})
+}
+
+func runBaselinePrune(args []string, out io.Writer) error {
+	fs := newFlagSet("baseline prune")
+	outDir := fs.String("out", cliConfig.Workspace, "directory holding the default baseline store")
+	baselinePath := fs.String("baseline_path", "", "baseline store (default: <out>/"+baseline.DefaultFile+")")
+	olderThan := fs.Duration("older_than", 0, "remove entries not updated within this duration (e.g. 720h)")
+	keyPrefix := fs.String("key", "", "remove only entries whose key starts with this prefix")
+	dryRun := fs.Bool("dry_run", false, "list what would be removed without changing the store")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *olderThan <= 0 && *keyPrefix == "" {
+		return errors.New("baseline prune requires --older_than or --key")
+	}
+	path := firstNonEmptyString(*baselinePath, filepath.Join(*outDir, baseline.DefaultFile))
+
+	opts := baseline.PruneOptions{KeyPrefix: *keyPrefix, DryRun: *dryRun}
+	if *olderThan > 0 {
+		opts.Before = time.Now().Add(-*olderThan)
+	}
+	removed, err := baseline.Prune(path, opts)
+	if err != nil {
+		return err
+	}
+
+	return render(out, view{
+		payload: jsonOutput{"baseline_path": path, "removed": removed, "dry_run": *dryRun},
+		table: func() tableView {
+			t := tableView{columns: []string{"key"}}
+			for _, key := range removed {
+				t.rows = append(t.rows, []string{key})
+			}
+			return t
+		},
+		text: func(w io.Writer) error {
+			verb := "removed"
+			if *dryRun {
+				verb = "would remove"
+			}
+			for _, key := range removed {
+				fmt.Fprintf(w, "%s %s\n", verb, key)
+			}
+			_, err := fmt.Fprintf(w, "%s %d entries from %s\n", verb, len(removed), path)
+			return err
+		},
+	})
+}
+
+func localBaselineProfiles(paths []string) []baselineProfile {
+	profiles := make([]baselineProfile, 0, len(paths))
+	for _, path := range paths {
+		profiles = append(profiles, baselineProfile{Path: path})
+	}
+	return profiles
+}
+
+// fetchBaselineProfiles downloads a candidate's bundle and returns the
+// profiles matching --types.
+func fetchBaselineProfiles(ctx context.Context, f *baselineFlags, candidate datadog.ProfileCandidate) ([]baselineProfile, error) {
+	bundle, err := datadog.DownloadLatestBundle(ctx, datadog.DownloadParams{
+		Service:   *f.service,
+		Env:       *f.env,
+		OutDir:    filepath.Join(*f.outDir, candidate.ProfileID),
+		Site:      *f.site,
+		Hours:     *f.hours,
+		ProfileID: candidate.ProfileID,
+		EventID:   candidate.EventID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("download %s: %w", candidate.ProfileID, err)
+	}
+	profiles := []baselineProfile{}
+	for _, profileType := range splitList(*f.types) {
+		if path := bundleProfilePath(bundle, profileType); path != "" {
+			profiles = append(profiles, baselineProfile{Path: path, ProfileID: candidate.ProfileID, Timestamp: candidate.Timestamp})
+		}
+	}
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("profile %s has none of the types %s", candidate.ProfileID, *f.types)
+	}
+	return profiles, nil
+}
+
+// bundleProfilePath returns the .pprof file of the given type in a bundle,
+// or "" when the bundle has none.
+func bundleProfilePath(bundle datadog.DownloadResult, profileType string) string {
+	for _, file := range bundle.Files {
+		if file.Type == profileType && strings.HasSuffix(file.Path, ".pprof") {
+			return file.Path
+		}
+	}
+	return ""
+}
+
+// baselineTop returns the profile kind and the top 50 rows the store
+// averages.
+func baselineTop(ctx context.Context, path, sampleIndex string) (string, []pprofparse.TopRow, error) {
+	meta, err := pprof.RunMeta(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("meta %s: %w", path, err)
+	}
+	top, err := pprof.RunTop(ctx, pprof.TopParams{Profile: path, NodeCount: 50, SampleIndex: sampleIndex})
+	if err != nil {
+		return "", nil, fmt.Errorf("top %s: %w", path, err)
+	}
+	return meta.DetectedKind, top.Rows, nil
+}
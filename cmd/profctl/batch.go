@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/arreyder/pprof-mcp/internal/batch"
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+)
+
+// runBatch runs YAML pipelines of profctl commands.
+func runBatch(args []string, out io.Writer) error {
+	if len(args) < 1 || args[0] != "run" {
+		return errors.New("usage: profctl batch run <pipeline.yaml> [--var key=value] [--report path] [--dry_run]")
+	}
+	return runBatchRun(args[1:], out)
+}
+
+func runBatchRun(args []string, out io.Writer) error {
+	fs := newFlagSet("batch run")
+	var vars multiFlag
+	fs.Var(&vars, "var", "pipeline variable as key=value (repeatable; overrides the file's vars)")
+	reportPath := fs.String("report", "", "write a Markdown run summary here (overrides the file's report)")
+	dryRun := fs.Bool("dry_run", false, "print each step's command without running it")
+	// The pipeline path may come before or after the flags.
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(positional) != 1 {
+		return errors.New("batch run requires exactly one pipeline file")
+	}
+	path := positional[0]
+
+	pipeline, err := batch.Load(path)
+	if err != nil {
+		return err
+	}
+	overrides := map[string]string{}
+	for _, value := range vars {
+		key, val, ok := strings.Cut(value, "=")
+		if !ok || key == "" {
+			return fmt.Errorf("--var %q must be key=value", value)
+		}
+		overrides[key] = val
+	}
+	if *reportPath != "" {
+		pipeline.Report = *reportPath
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	format := cliOutput
+	result, runErr := batch.Run(ctx, pipeline, batchExecutor, batch.RunOptions{Vars: overrides, DryRun: *dryRun})
+	// Steps run through run(), which resets the output format.
+	cliOutput = format
+
+	var warnings []string
+	if result.Report != "" && !*dryRun {
+		if err := os.MkdirAll(filepath.Dir(result.Report), 0o755); err == nil {
+			err = os.WriteFile(result.Report, []byte(batch.FormatReport(path, result)), 0o644)
+		}
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("writing report: %v", err))
+		}
+	}
+
+	payload := jsonOutput{"pipeline": path, "dry_run": *dryRun, "result": result}
+	if result.Report != "" && !*dryRun {
+		payload["report_path"] = result.Report
+	}
+	if len(warnings) > 0 {
+		payload["warnings"] = warnings
+	}
+	if err := render(out, view{
+		payload: payload,
+		table:   func() tableView { return objectsTable(result.Steps, "name", "item", "status", "duration_ms", "error") },
+		text: func(w io.Writer) error {
+			for _, step := range result.Steps {
+				name := step.Name
+				if step.Item != "" {
+					name += " [" + step.Item + "]"
+				}
+				line := fmt.Sprintf("%-8s %s", step.Status, name)
+				if len(step.Args) > 0 {
+					line += ": profctl " + cmdrun.Join(step.Args...)
+				} else if step.Template != "" {
+					line += ": profctl " + step.Template
+				}
+				if step.Error != "" {
+					line += " (" + step.Error + ")"
+				}
+				fmt.Fprintln(w, line)
+			}
+			for _, warning := range warnings {
+				fmt.Fprintf(w, "warning: %s\n", warning)
+			}
+			if result.Report != "" && !*dryRun {
+				fmt.Fprintf(w, "report: %s\n", result.Report)
+			}
+			return nil
+		},
+	}); err != nil {
+		return err
+	}
+	return runErr
+}
+
+// batchExecutor runs one step as a profctl command with JSON output. Output
+// that is not JSON is kept as a string.
+func batchExecutor(ctx context.Context, args []string) (any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	argv := append([]string{"profctl"}, args...)
+	err := run(append(argv, "--output", outputJSON), &buf)
+	if buf.Len() == 0 {
+		return nil, err
+	}
+	var output any
+	if jsonErr := json.Unmarshal(buf.Bytes(), &output); jsonErr != nil {
+		return strings.TrimSpace(buf.String()), err
+	}
+	return output, err
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+
+	"github.com/arreyder/pprof-mcp/internal/binaries"
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+	"github.com/arreyder/pprof-mcp/internal/d2"
+)
+
+// runPprofResolveBinary finds the binary a profile was recorded from.
+func runPprofResolveBinary(args []string, out io.Writer) error {
+	fs := newFlagSet("pprof resolve_binary")
+	profilePath := fs.String("profile", "", "path to .pprof profile")
+	repoRoot := fs.String("repo_root", ".", "repository root for the repo and build strategies")
+	revision := fs.String("revision", "", "VCS revision the profiled binary was built at")
+	service := fs.String("service", "", "service name, for templates and matching repo services")
+	binaryName := fs.String("binary_name", "", "binary name (default: the profile's main mapping)")
+	buildID := fs.String("build_id", "", "build ID to match (default: the main mapping's)")
+	strategies := fs.String("strategies", "", "comma-separated strategies: cache, repo, artifact, image, build (default: config, else cache,repo,artifact,image)")
+	artifactURL := fs.String("artifact_url", cliConfig.Binaries.ArtifactURL, "artifact URL template over {service}, {binary}, {revision}, {build_id}")
+	image := fs.String("image", cliConfig.Binaries.Image, "container image template")
+	dryRun := fs.Bool("dry_run", false, "print the commands without running them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *profilePath == "" {
+		return fmt.Errorf("--profile is required")
+	}
+
+	target, err := binaries.ProfileTarget(*profilePath)
+	if err != nil {
+		return err
+	}
+	if *binaryName != "" {
+		target.Binary = *binaryName
+	}
+	if *buildID != "" {
+		target.BuildID = *buildID
+	}
+	target.Revision = *revision
+	target.Service = *service
+	params := binaries.Params{
+		Target:      target,
+		RepoRoot:    *repoRoot,
+		Strategies:  cliConfig.Binaries.Strategies,
+		CacheDir:    cliConfig.Binaries.CacheDir,
+		ArtifactURL: *artifactURL,
+		Image:       *image,
+	}
+	if list := splitList(*strategies); len(list) > 0 {
+		params.Strategies = list
+	}
+	command := cmdrun.Join("profctl", "pprof", "resolve_binary", "--profile", *profilePath)
+
+	if *dryRun {
+		commands, notes, err := binaries.Plan(params)
+		if err != nil {
+			return err
+		}
+		return renderD2DryRun(out, d2.DryRunResult{Service: target.Service, Command: command, Commands: commands, Notes: notes})
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	result, err := binaries.Resolve(ctx, params)
+	if err != nil {
+		return err
+	}
+	for _, warning := range result.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+	}
+	return render(out, view{
+		payload: jsonOutput{"command": command, "result": result},
+		table: func() tableView {
+			return objectsTable(result.Attempts, "strategy", "status", "source", "detail")
+		},
+		text: func(w io.Writer) error {
+			for _, attempt := range result.Attempts {
+				fmt.Fprintf(w, "%-8s %-8s %s %s\n", attempt.Strategy, attempt.Status, attempt.Source, attempt.Detail)
+			}
+			if result.Binary == "" {
+				_, err := fmt.Fprintf(w, "no binary found for %s\n", result.Target.Binary)
+				return err
+			}
+			fmt.Fprintf(w, "binary: %s (%s, verified: %t)\n", result.Binary, result.Strategy, result.Verified)
+			return nil
+		},
+	})
+}
+
+// runPprofBuildInfo reads the Go build info of a binary or of the binary a
+// profile was recorded from, and checks the repo's HEAD against it.
+func runPprofBuildInfo(args []string, out io.Writer) error {
+	fs := newFlagSet("pprof buildinfo")
+	binaryPath := fs.String("binary", "", "binary to read (default: the profile's binary)")
+	profilePath := fs.String("profile", "", "path to .pprof profile whose binary to read")
+	repoRoot := fs.String("repo_root", "", "repository whose HEAD is checked against the build's revision")
+	revision := fs.String("revision", "", "revision the binary was built at, when it records none")
+	service := fs.String("service", "", "service name, for resolving the profile's binary")
+	strategies := fs.String("strategies", "", "comma-separated strategies for resolving the profile's binary (default: config, else cache,repo,artifact,image)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *binaryPath == "" && *profilePath == "" {
+		return fmt.Errorf("--binary or --profile is required")
+	}
+
+	params := binaries.BuildInfoParams{
+		Params: binaries.Params{
+			Target:      binaries.Target{Revision: *revision, Service: *service},
+			RepoRoot:    *repoRoot,
+			Strategies:  cliConfig.Binaries.Strategies,
+			CacheDir:    cliConfig.Binaries.CacheDir,
+			ArtifactURL: cliConfig.Binaries.ArtifactURL,
+			Image:       cliConfig.Binaries.Image,
+		},
+		Binary:  *binaryPath,
+		Profile: *profilePath,
+	}
+	if list := splitList(*strategies); len(list) > 0 {
+		params.Strategies = list
+	}
+	command := []string{"profctl", "pprof", "buildinfo"}
+	if *binaryPath != "" {
+		command = append(command, "--binary", *binaryPath)
+	}
+	if *profilePath != "" {
+		command = append(command, "--profile", *profilePath)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	result, err := binaries.InspectBuild(ctx, params)
+	if err != nil {
+		return err
+	}
+	for _, warning := range result.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+	}
+	info := result.BuildInfo
+	return render(out, view{
+		payload: jsonOutput{"command": cmdrun.Join(command...), "result": result},
+		table: func() tableView {
+			return objectsTable(info.Deps, "path", "version")
+		},
+		text: func(w io.Writer) error {
+			fmt.Fprintf(w, "binary:   %s (%s)\n", result.Source.Binary, result.Source.From)
+			fmt.Fprintf(w, "go:       %s\n", info.GoVersion)
+			fmt.Fprintf(w, "path:     %s\n", info.Path)
+			fmt.Fprintf(w, "main:     %s %s\n", info.Main.Path, info.Main.Version)
+			if info.Revision != "" {
+				fmt.Fprintf(w, "revision: %s %s (modified: %t)\n", info.Revision, info.RevisionTime, info.Modified)
+			}
+			keys := make([]string, 0, len(info.Settings))
+			for key := range info.Settings {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				fmt.Fprintf(w, "setting:  %s=%s\n", key, info.Settings[key])
+			}
+			fmt.Fprintf(w, "deps:     %d modules\n", len(info.Deps))
+			if head := result.Head; head != nil {
+				fmt.Fprintf(w, "head:     %s (match: %t, dirty: %t, ahead %d, behind %d, %d Go files changed)\n", head.Head, head.Match, head.Dirty, head.Ahead, head.Behind, len(head.ChangedFiles))
+				for _, file := range head.ProfiledFiles {
+					fmt.Fprintf(w, "  profiled and changed: %s\n", file)
+				}
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/arreyder/pprof-mcp/internal/pprof"
+)
+
+// ciRules is the --rules file. checks cap a function's share of the after
+// profile; deltas cap its growth from before to after.
+type ciRules struct {
+	SampleIndex string                      `yaml:"sample_index"`
+	Checks      []pprof.RegressionCheckSpec `yaml:"checks"`
+	Deltas      []pprof.RegressionDeltaSpec `yaml:"deltas"`
+}
+
+type ciResult struct {
+	Passed bool                          `json:"passed"`
+	Before string                        `json:"before,omitempty"`
+	After  string                        `json:"after"`
+	Checks *pprof.RegressionCheckSummary `json:"checks,omitempty"`
+	Deltas *pprof.RegressionDeltaSummary `json:"deltas,omitempty"`
+}
+
+func runCI(args []string, out io.Writer) error {
+	if len(args) < 1 || args[0] != "check" {
+		return &exitError{code: exitCheckError, err: errors.New("usage: profctl ci check --after <profile> [--before <profile>] --rules <rules.yaml>")}
+	}
+	if err := runCICheck(args[1:], out); err != nil {
+		var exit *exitError
+		if errors.As(err, &exit) {
+			return err
+		}
+		return &exitError{code: exitCheckError, err: err}
+	}
+	return nil
+}
+
+func runCICheck(args []string, out io.Writer) error {
+	fs := newFlagSet("ci check")
+	before := fs.String("before", "", "path to the baseline .pprof profile (required for deltas)")
+	after := fs.String("after", "", "path to the candidate .pprof profile")
+	rulesPath := fs.String("rules", "", "path to the rules YAML")
+	sampleIndex := fs.String("sample_index", "", "pprof sample index (overrides the rules file)")
+	annotations := fs.String("annotations", "", "annotation style: github|text (default: github under GitHub Actions)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *after == "" || *rulesPath == "" {
+		return errors.New("ci check requires --after and --rules")
+	}
+	style := *annotations
+	if style == "" {
+		style = "text"
+		if os.Getenv("GITHUB_ACTIONS") == "true" {
+			style = "github"
+		}
+	}
+	if style != "github" && style != "text" {
+		return fmt.Errorf("unknown --annotations %q (want github or text)", style)
+	}
+
+	rules, err := loadCIRules(*rulesPath)
+	if err != nil {
+		return err
+	}
+	if *sampleIndex != "" {
+		rules.SampleIndex = *sampleIndex
+	}
+	if len(rules.Deltas) > 0 && *before == "" {
+		return fmt.Errorf("%s has deltas, which need --before", *rulesPath)
+	}
+
+	ctx := context.Background()
+	result := ciResult{Passed: true, Before: *before, After: *after}
+	if len(rules.Checks) > 0 {
+		summary, err := pprof.RunRegressionCheck(ctx, pprof.RegressionCheckParams{
+			Profile:     *after,
+			SampleIndex: rules.SampleIndex,
+			Checks:      rules.Checks,
+		})
+		if err != nil {
+			return err
+		}
+		result.Checks = &summary
+		result.Passed = result.Passed && summary.Passed
+	}
+	if len(rules.Deltas) > 0 {
+		summary, err := pprof.RunRegressionDelta(ctx, pprof.RegressionDeltaParams{
+			Before:      *before,
+			After:       *after,
+			SampleIndex: rules.SampleIndex,
+			Checks:      rules.Deltas,
+		})
+		if err != nil {
+			return err
+		}
+		result.Deltas = &summary
+		result.Passed = result.Passed && summary.Passed
+	}
+
+	if err := render(out, view{
+		payload: result,
+		table:   func() tableView { return ciTable(result) },
+		text:    func(w io.Writer) error { return writeCIAnnotations(w, result, style) },
+	}); err != nil {
+		return err
+	}
+	if summaryPath := os.Getenv("GITHUB_STEP_SUMMARY"); summaryPath != "" && style == "github" {
+		if err := appendCIStepSummary(summaryPath, result); err != nil {
+			fmt.Fprintf(os.Stderr, "ci: write step summary: %v\n", err)
+		}
+	}
+	if !result.Passed {
+		return &exitError{code: exitRegressed, err: fmt.Errorf("ci check failed: %d of %d checks regressed", ciFailures(result), ciTotal(result))}
+	}
+	return nil
+}
+
+func loadCIRules(path string) (ciRules, error) {
+	var rules ciRules
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return rules, err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&rules); err != nil && !errors.Is(err, io.EOF) {
+		return rules, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(rules.Checks) == 0 && len(rules.Deltas) == 0 {
+		return rules, fmt.Errorf("%s: no checks or deltas defined", path)
+	}
+	return rules, nil
+}
+
+// writeCIAnnotations prints one line per check. In github style failures are
+// ::error workflow commands, which Actions turns into annotations on the run.
+func writeCIAnnotations(w io.Writer, result ciResult, style string) error {
+	line := func(passed bool, title, message string) {
+		switch {
+		case style == "github" && !passed:
+			fmt.Fprintf(w, "::error title=%s::%s\n", githubEscape(title, true), githubEscape(message, false))
+		case style == "github":
+			fmt.Fprintf(w, "::notice title=%s::%s\n", githubEscape(title, true), githubEscape(message, false))
+		case passed:
+			fmt.Fprintf(w, "PASS %s: %s\n", title, message)
+		default:
+			fmt.Fprintf(w, "FAIL %s: %s\n", title, message)
+		}
+	}
+	if result.Checks != nil {
+		for _, check := range result.Checks.Checks {
+			message := check.Message
+			if message == "" {
+				message = fmt.Sprintf("%s %s %.2f%% within %.2f%%", check.Function, check.Metric, check.Actual, check.Threshold)
+			}
+			line(check.Passed, "profile threshold "+check.Function, message)
+		}
+	}
+	if result.Deltas != nil {
+		for _, check := range result.Deltas.Checks {
+			message := check.Message
+			if message == "" {
+				message = fmt.Sprintf("%s %s %.2f%% -> %.2f%% (%+.2f) within +%.2f", check.Function, check.Metric, check.Before, check.After, check.Delta, check.Threshold)
+			}
+			line(check.Passed, "profile regression "+check.Function, message)
+		}
+	}
+	status := "passed"
+	if !result.Passed {
+		status = "FAILED"
+	}
+	_, err := fmt.Fprintf(w, "ci check %s: %d of %d checks regressed\n", status, ciFailures(result), ciTotal(result))
+	return err
+}
+
+// githubEscape encodes the characters that would end a workflow command.
+func githubEscape(value string, property bool) string {
+	value = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(value)
+	if property {
+		value = strings.NewReplacer(":", "%3A", ",", "%2C").Replace(value)
+	}
+	return value
+}
+
+func appendCIStepSummary(path string, result ciResult) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	status := "passed"
+	if !result.Passed {
+		status = "failed"
+	}
+	fmt.Fprintf(file, "### Profile check %s\n\n| status | kind | function | metric | before | after | limit |\n|---|---|---|---|---|---|---|\n", status)
+	for _, row := range ciTable(result).rows {
+		fmt.Fprintf(file, "| %s |\n", strings.Join(row, " | "))
+	}
+	_, err = fmt.Fprintln(file)
+	return err
+}
+
+func ciTable(result ciResult) tableView {
+	t := tableView{columns: []string{"status", "kind", "function", "metric", "before", "after", "limit"}}
+	status := func(passed bool) string {
+		if passed {
+			return "pass"
+		}
+		return "FAIL"
+	}
+	if result.Checks != nil {
+		for _, check := range result.Checks.Checks {
+			t.rows = append(t.rows, []string{status(check.Passed), "threshold", check.Function, check.Metric, "", fmt.Sprintf("%.2f", check.Actual), fmt.Sprintf("%.2f", check.Threshold)})
+		}
+	}
+	if result.Deltas != nil {
+		for _, check := range result.Deltas.Checks {
+			t.rows = append(t.rows, []string{status(check.Passed), "delta", check.Function, check.Metric, fmt.Sprintf("%.2f", check.Before), fmt.Sprintf("%.2f", check.After), fmt.Sprintf("+%.2f", check.Threshold)})
+		}
+	}
+	return t
+}
+
+func ciFailures(result ciResult) int {
+	failures := 0
+	if result.Checks != nil {
+		for _, check := range result.Checks.Checks {
+			if !check.Passed {
+				failures++
+			}
+		}
+	}
+	if result.Deltas != nil {
+		for _, check := range result.Deltas.Checks {
+			if !check.Passed {
+				failures++
+			}
+		}
+	}
+	return failures
+}
+
+func ciTotal(result ciResult) int {
+	total := 0
+	if result.Checks != nil {
+		total += len(result.Checks.Checks)
+	}
+	if result.Deltas != nil {
+		total += len(result.Deltas.Checks)
+	}
+	return total
+}
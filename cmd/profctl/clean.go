@@ -0,0 +1,273 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/history"
+	"github.com/arreyder/pprof-mcp/internal/profiles"
+	"github.com/arreyder/pprof-mcp/internal/tempfiles"
+)
+
+// cleanKeepCommands write state that outlives an investigation (baseline
+// stores, watch state), so their outputs are never pruned.
+var cleanKeepCommands = map[string]bool{
+	"baseline": true,
+	"ci":       true,
+	"config":   true,
+	"watch":    true,
+}
+
+// cleanArtifactSuffixes limits pruning to profiles and rendered views.
+var cleanArtifactSuffixes = []string{".pprof", ".pb.gz", ".prof", ".svg", ".png", ".dot", "_metrics.json"}
+
+type cleanCandidate struct {
+	Path    string    `json:"path"`
+	Kind    string    `json:"kind"`
+	Source  string    `json:"source"`
+	ModTime time.Time `json:"mod_time"`
+	Bytes   int64     `json:"bytes"`
+}
+
+// ageValue is a duration flag that also accepts days, e.g. 7d or 1d12h.
+type ageValue time.Duration
+
+func (a *ageValue) String() string { return time.Duration(*a).String() }
+
+func (a *ageValue) Set(value string) error {
+	days := 0
+	if i := strings.Index(value, "d"); i > 0 {
+		n, err := strconv.Atoi(value[:i])
+		if err != nil {
+			return fmt.Errorf("invalid age %q", value)
+		}
+		days, value = n, value[i+1:]
+	}
+	var rest time.Duration
+	if value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid age %q", value)
+		}
+		rest = parsed
+	}
+	*a = ageValue(time.Duration(days)*24*time.Hour + rest)
+	return nil
+}
+
+// runClean removes profiles and renders tracked by the handle store and the
+// invocation history, plus leftover temp dirs. Untracked files in the
+// workspace are never touched.
+func runClean(args []string, out io.Writer) error {
+	fs := newFlagSet("clean")
+	var olderThan ageValue
+	fs.Var(&olderThan, "older_than", "remove artifacts not modified within this age (e.g. 7d, 36h)")
+	fs.Var(&olderThan, "older-than", "alias for --older_than")
+	all := fs.Bool("all", false, "remove every tracked artifact regardless of age")
+	dryRun := fs.Bool("dry_run", false, "list what would be removed without deleting anything")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if olderThan <= 0 && !*all {
+		return errors.New("clean requires --older_than or --all")
+	}
+	cutoff := time.Now()
+	if !*all {
+		cutoff = cutoff.Add(-time.Duration(olderThan))
+	}
+
+	candidates, registry, stale, err := cleanCandidates()
+	if err != nil {
+		return err
+	}
+	var removed []cleanCandidate
+	var warnings []string
+	var freed int64
+	removedPaths := map[string]bool{}
+	for _, candidate := range candidates {
+		if candidate.ModTime.After(cutoff) {
+			continue
+		}
+		if !*dryRun {
+			if err := os.RemoveAll(candidate.Path); err != nil {
+				warnings = append(warnings, err.Error())
+				continue
+			}
+			removeEmptyParent(candidate.Path)
+		}
+		removed = append(removed, candidate)
+		removedPaths[candidate.Path] = true
+		freed += candidate.Bytes
+	}
+
+	// Drop handles whose files are gone, whether removed now or earlier.
+	if registry != nil {
+		for _, meta := range registry.All() {
+			if path, err := filepath.Abs(meta.Path); err == nil && removedPaths[path] {
+				stale = append(stale, meta.ID)
+			}
+		}
+		if !*dryRun && len(stale) > 0 {
+			if err := registry.Remove(stale...); err != nil {
+				warnings = append(warnings, fmt.Sprintf("updating handle store: %v", err))
+			}
+		}
+	}
+
+	payload := jsonOutput{
+		"removed":         removed,
+		"bytes_freed":     freed,
+		"handles_dropped": len(stale),
+		"dry_run":         *dryRun,
+	}
+	if len(warnings) > 0 {
+		payload["warnings"] = warnings
+	}
+	return render(out, view{
+		payload: payload,
+		table:   func() tableView { return objectsTable(removed, "kind", "source", "bytes", "path") },
+		text: func(w io.Writer) error {
+			verb := "removed"
+			if *dryRun {
+				verb = "would remove"
+			}
+			for _, candidate := range removed {
+				fmt.Fprintf(w, "%s %-8s %s\n", verb, candidate.Kind, candidate.Path)
+			}
+			for _, warning := range warnings {
+				fmt.Fprintf(w, "warning: %s\n", warning)
+			}
+			_, err := fmt.Fprintf(w, "%s %d artifacts (%s), %d stale handles\n", verb, len(removed), formatBytes(freed), len(stale))
+			return err
+		},
+	})
+}
+
+// cleanCandidates gathers tracked artifacts, oldest first. It also returns
+// the handle registry and the IDs of handles whose files no longer exist.
+func cleanCandidates() ([]cleanCandidate, *profiles.Registry, []string, error) {
+	var candidates []cleanCandidate
+	seen := map[string]bool{}
+	add := func(path, kind, source string) {
+		abs, err := filepath.Abs(path)
+		if err != nil || seen[abs] {
+			return
+		}
+		info, err := os.Stat(abs)
+		if err != nil {
+			return
+		}
+		seen[abs] = true
+		size := info.Size()
+		if info.IsDir() {
+			size = dirSize(abs)
+		}
+		candidates = append(candidates, cleanCandidate{Path: abs, Kind: kind, Source: source, ModTime: info.ModTime(), Bytes: size})
+	}
+
+	var registry *profiles.Registry
+	var stale []string
+	if storePath := profiles.StorePath(); storePath != "" {
+		var err error
+		registry, err = profiles.OpenRegistry(storePath)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("reading handle store: %w", err)
+		}
+		for _, meta := range registry.All() {
+			if _, err := os.Stat(meta.Path); err != nil {
+				stale = append(stale, meta.ID)
+				continue
+			}
+			add(meta.Path, "profile", profiles.HandlePrefix+meta.ID)
+		}
+	}
+
+	if historyPath := history.Path(); historyPath != "" {
+		entries, err := history.List(historyPath)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("reading history: %w", err)
+		}
+		for _, entry := range entries {
+			if len(entry.Args) == 0 || cleanKeepCommands[entry.Args[0]] {
+				continue
+			}
+			for _, output := range entry.Outputs {
+				if isCleanArtifact(output) {
+					add(output, artifactKind(output), "history "+entry.ID)
+				}
+			}
+		}
+	}
+
+	// Temp files and dirs of calls still running are left alone; the rest,
+	// registered or from before the registry, a crash or Ctrl-C left behind.
+	registered, _ := tempfiles.List()
+	for _, entry := range registered {
+		if entry.Leaked() {
+			add(entry.Path, "temp", fmt.Sprintf("leaked temp (pid %d)", entry.PID))
+		}
+	}
+	for _, path := range tempfiles.Unregistered(registered) {
+		add(path, "temp", "temp dir")
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].ModTime.Before(candidates[j].ModTime) })
+	return candidates, registry, stale, nil
+}
+
+func isCleanArtifact(path string) bool {
+	for _, suffix := range cleanArtifactSuffixes {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func artifactKind(path string) string {
+	switch {
+	case strings.HasSuffix(path, ".svg"), strings.HasSuffix(path, ".png"), strings.HasSuffix(path, ".dot"):
+		return "render"
+	case strings.HasSuffix(path, ".json"):
+		return "metrics"
+	default:
+		return "profile"
+	}
+}
+
+// removeEmptyParent removes a bundle directory once its last file is gone,
+// but never the workspace root or the working directory.
+func removeEmptyParent(path string) {
+	dir := filepath.Dir(path)
+	if cwd, err := os.Getwd(); err == nil && dir == cwd {
+		return
+	}
+	if workspace, err := filepath.Abs(cliConfig.Workspace); err == nil && cliConfig.Workspace != "" && dir == workspace {
+		return
+	}
+	if dir == filepath.Clean(os.TempDir()) {
+		return
+	}
+	// Fails, harmlessly, while the directory still has other files.
+	os.Remove(dir)
+}
+
+func dirSize(dir string) int64 {
+	var total int64
+	filepath.WalkDir(dir, func(_ string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	return total
+}
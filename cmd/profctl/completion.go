@@ -0,0 +1,301 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/arreyder/pprof-mcp/internal/completion"
+	"github.com/arreyder/pprof-mcp/internal/k8s"
+	"github.com/arreyder/pprof-mcp/internal/profiles"
+)
+
+// completeCommand is the hidden command the generated shell scripts call with
+// the words typed so far; it prints one candidate per line. No output tells
+// the shell to fall back to file completion.
+const completeCommand = "__complete"
+
+// completionTree lists subcommands by parent command path.
+var completionTree = map[string][]string{
+	"":                 {"analyze", "baseline", "batch", "ci", "clean", "completion", "config", "d2", "datadog", "download", "export", "history", "k8s", "open", "pprof", "repo", "run", "serve", "tui", "watch"},
+	"baseline":         {"check", "list", "prune", "record"},
+	"batch":            {"run"},
+	"ci":               {"check"},
+	"completion":       {"bash", "fish", "zsh"},
+	"config":           {"get", "list", "path", "set", "unset"},
+	"d2":               {"branch-impact", "capture", "schedule"},
+	"d2 branch-impact": {"abort", "list", "plan", "run", "show"},
+	"d2 schedule":      {"list", "run", "show", "stop"},
+	"datadog":          {"profiles"},
+	"history":          {"show"},
+	"k8s":              {"capture", "capture-job", "compare-canary", "compare-clusters", "debug-capture"},
+	"datadog profiles": {"list", "pick"},
+	"pprof":            {"buildinfo", "callgraph", "coverage", "diff_top", "flame", "list", "merge", "meta", "peek", "resolve_binary", "storylines", "symbolization", "tags", "top", "traces_head", "validate"},
+	"repo":             {"services"},
+	"repo services":    {"discover"},
+}
+
+func runCompletion(args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("usage: profctl completion <bash|zsh|fish>")
+	}
+	var script string
+	switch args[0] {
+	case "bash":
+		script = bashCompletion
+	case "zsh":
+		script = zshCompletion
+	case "fish":
+		script = fishCompletion
+	default:
+		return fmt.Errorf("unknown shell %q (want bash, zsh, or fish)", args[0])
+	}
+	_, err := io.WriteString(out, script)
+	return err
+}
+
+// runComplete prints candidates for the last word in words.
+func runComplete(words []string, out io.Writer) error {
+	for _, value := range completeWords(words) {
+		if _, err := fmt.Fprintln(out, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func completeWords(words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	current := words[len(words)-1]
+	previous := words[:len(words)-1]
+
+	path := []string{}
+	for _, word := range previous {
+		if !containsString(completionTree[strings.Join(path, " ")], word) {
+			break
+		}
+		path = append(path, word)
+	}
+	key := strings.Join(path, " ")
+
+	// "--flag=value" completes the value in place.
+	if strings.HasPrefix(current, "-") && strings.Contains(current, "=") {
+		name, value, _ := strings.Cut(current, "=")
+		matches := completion.Filter(flagValues(strings.TrimLeft(name, "-"), words), value)
+		for i := range matches {
+			matches[i] = name + "=" + matches[i]
+		}
+		return matches
+	}
+
+	// bash splits "--flag=value" into "--flag", "=", "value".
+	if len(previous) >= 2 && previous[len(previous)-1] == "=" {
+		return completion.Filter(flagValues(strings.TrimLeft(previous[len(previous)-2], "-"), words), current)
+	}
+
+	fs := commandFlagSet(path)
+	if len(previous) > len(path) {
+		last := previous[len(previous)-1]
+		if last == "--output" || last == "-o" {
+			return completion.Filter(flagValues("output", words), current)
+		}
+		name := strings.TrimLeft(last, "-")
+		if fs != nil && name != last && !strings.Contains(name, "=") && fs.Lookup(name) != nil && !isBoolFlag(fs, name) {
+			return completion.Filter(flagValues(name, words), current)
+		}
+	}
+
+	if strings.HasPrefix(current, "-") {
+		if fs == nil {
+			return nil
+		}
+		names := []string{}
+		fs.VisitAll(func(f *flag.Flag) {
+			names = append(names, "--"+f.Name)
+		})
+		names = append(names, "--output")
+		return completion.Filter(names, current)
+	}
+	switch key {
+	case "config get", "config set", "config unset":
+		if len(previous) == len(path) {
+			return completion.Filter(configKeyCandidates(), current)
+		}
+		if key == "config set" && len(previous) == len(path)+1 && previous[len(path)] == "credential_profile" {
+			names := []string{}
+			for name := range cliConfig.Credentials {
+				names = append(names, name)
+			}
+			return completion.Filter(names, current)
+		}
+		return nil
+	case "open":
+		// Offer registered handles once a handle is being typed; otherwise
+		// fall back to file completion.
+		if len(previous) == len(path) && current != "" && (strings.HasPrefix(current, profiles.HandlePrefix) || strings.HasPrefix(profiles.HandlePrefix, current)) {
+			return completion.Filter(handleCandidates(), current)
+		}
+		return nil
+	}
+	if children := completionTree[key]; len(children) > 0 && len(previous) == len(path) {
+		return completion.Filter(children, current)
+	}
+	return nil
+}
+
+func handleCandidates() []string {
+	storePath := profiles.StorePath()
+	if storePath == "" {
+		return nil
+	}
+	registry, err := profiles.OpenRegistry(storePath)
+	if err != nil {
+		return nil
+	}
+	handles := []string{}
+	for _, meta := range registry.All() {
+		handles = append(handles, profiles.HandlePrefix+meta.ID)
+	}
+	sort.Strings(handles)
+	return handles
+}
+
+// commandFlagSet returns the flags a command defines by running it with -h,
+// which every command handles by returning flag.ErrHelp before doing work.
+func commandFlagSet(path []string) *flag.FlagSet {
+	if len(path) == 0 || path[0] == "completion" || path[0] == "config" || len(completionTree[strings.Join(path, " ")]) > 0 {
+		return nil
+	}
+	lastFlagSet = nil
+	args := append([]string{"profctl"}, path...)
+	if err := run(append(args, "-h"), io.Discard); !errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	return lastFlagSet
+}
+
+func isBoolFlag(fs *flag.FlagSet, name string) bool {
+	f := fs.Lookup(name)
+	if f == nil {
+		return false
+	}
+	boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && boolFlag.IsBoolFlag()
+}
+
+// flagValues returns value candidates for a flag, using the same sources as
+// the MCP server's completion/complete.
+func flagValues(name string, words []string) []string {
+	switch name {
+	case "service":
+		values := completion.Services(wordFlagValue(words, "env"), wordFlagValue(words, "repo_root"))
+		for _, preset := range cliConfig.Environments {
+			values = append(values, preset.Service)
+		}
+		return values
+	case "env":
+		values := completion.Envs()
+		for presetName := range cliConfig.Environments {
+			values = append(values, presetName)
+		}
+		sort.Strings(values)
+		return values
+	case "strategy":
+		if containsString(words, "k8s") {
+			return k8s.Strategies()
+		}
+		return completion.PickStrategies()
+	case "usage_source":
+		return []string{"datadog", "metrics-server"}
+	case "format":
+		if containsString(words, "callgraph") {
+			return []string{"dot", "png", "svg"}
+		}
+		return []string{"json", "markdown"}
+	case "output":
+		return []string{outputCSV, outputJSON, outputTable, outputYAML}
+	case "transport":
+		return []string{"http", "stdio"}
+	case "viewer":
+		return []string{"auto", "browser", "pager", "pprof"}
+	case "framing":
+		return []string{"auto", "content-length", "newline"}
+	case "tool-name-mode":
+		return []string{"codex", "default"}
+	case "progress":
+		return []string{"auto", "off", "on"}
+	case "annotations":
+		return []string{"github", "text"}
+	case "min_severity":
+		return []string{"high", "low", "medium"}
+	}
+	return nil
+}
+
+// wordFlagValue finds "--name value" or "--name=value" among words.
+func wordFlagValue(words []string, name string) string {
+	for i, word := range words {
+		trimmed := strings.TrimLeft(word, "-")
+		if trimmed == word {
+			continue
+		}
+		if flagName, value, ok := strings.Cut(trimmed, "="); ok && flagName == name {
+			return value
+		}
+		if trimmed == name && i+1 < len(words) {
+			return words[i+1]
+		}
+	}
+	return ""
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
+
+const bashCompletion = `# bash completion for profctl
+# Install: source <(profctl completion bash)
+_profctl() {
+    local IFS=$'\n'
+    COMPREPLY=($(profctl __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -F _profctl profctl
+`
+
+const zshCompletion = `#compdef profctl
+# zsh completion for profctl
+# Install: source <(profctl completion zsh), or save as _profctl on $fpath
+_profctl() {
+    local -a values
+    values=("${(@f)$(profctl __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+    if [[ ${#values[@]} -eq 0 || -z "${values[1]}" ]]; then
+        _files
+    else
+        compadd -- "${values[@]}"
+    fi
+}
+if [[ "${funcstack[1]}" == "_profctl" ]]; then
+    _profctl "$@"
+else
+    compdef _profctl profctl
+fi
+`
+
+const fishCompletion = `# fish completion for profctl
+# Install: profctl completion fish > ~/.config/fish/completions/profctl.fish
+function __profctl_complete
+    set -l words (commandline -opc) (commandline -ct)
+    profctl __complete $words[2..-1] 2>/dev/null
+end
+complete -c profctl -a '(__profctl_complete)'
+`
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/arreyder/pprof-mcp/internal/config"
+)
+
+// runConfig manages the shared config file read by profctl and the server.
+func runConfig(args []string, out io.Writer) error {
+	usage := errors.New("usage: profctl config <list|get KEY|set KEY VALUE|unset KEY|path>")
+	if len(args) < 1 {
+		return usage
+	}
+	file := firstNonEmptyString(cliConfig.File(), config.Path())
+
+	switch args[0] {
+	case "path":
+		_, err := fmt.Fprintln(out, file)
+		return err
+	case "list":
+		values := cliConfig.Values()
+		keys := config.SortedKeys(values)
+		return render(out, view{
+			payload: jsonOutput{"file": file, "values": values},
+			table: func() tableView {
+				t := tableView{columns: []string{"key", "value"}}
+				for _, key := range keys {
+					t.rows = append(t.rows, []string{key, values[key]})
+				}
+				return t
+			},
+			text: func(w io.Writer) error {
+				if len(keys) == 0 {
+					_, err := fmt.Fprintf(w, "# %s: no values set\n", file)
+					return err
+				}
+				for _, key := range keys {
+					fmt.Fprintf(w, "%s = %s\n", key, values[key])
+				}
+				return nil
+			},
+		})
+	case "get":
+		if len(args) != 2 {
+			return usage
+		}
+		value, ok, err := cliConfig.Get(args[1])
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%s is not set in %s", args[1], file)
+		}
+		return render(out, view{
+			payload: jsonOutput{"key": args[1], "value": value},
+			text: func(w io.Writer) error {
+				_, err := fmt.Fprintln(w, value)
+				return err
+			},
+		})
+	case "set":
+		if len(args) != 3 {
+			return usage
+		}
+		if err := config.Set(file, args[1], args[2]); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "set %s in %s\n", args[1], file)
+		return nil
+	case "unset":
+		if len(args) != 2 {
+			return usage
+		}
+		if err := config.Unset(file, args[1]); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "unset %s in %s\n", args[1], file)
+		return nil
+	default:
+		return fmt.Errorf("unknown config command: %s", args[0])
+	}
+}
+
+// configKeyCandidates expands the key patterns with the presets and
+// credential profiles already in the config.
+func configKeyCandidates() []string {
+	keys := []string{}
+	for _, key := range config.Keys {
+		switch {
+		case strings.HasPrefix(key, "environments.<name>."):
+			for name := range cliConfig.Environments {
+				keys = append(keys, strings.Replace(key, "<name>", name, 1))
+			}
+		case strings.HasPrefix(key, "credentials.<name>."):
+			for name := range cliConfig.Credentials {
+				keys = append(keys, strings.Replace(key, "<name>", name, 1))
+			}
+		case strings.HasPrefix(key, "services.<name>."):
+			for name := range cliConfig.Services {
+				keys = append(keys, strings.Replace(key, "<name>", name, 1))
+			}
+		case strings.Contains(key, "<"):
+		default:
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func firstNonEmptyString(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
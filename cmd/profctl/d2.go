@@ -0,0 +1,861 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/d2"
+	"github.com/arreyder/pprof-mcp/internal/k8s"
+	"github.com/arreyder/pprof-mcp/internal/pprof"
+)
+
+// runD2 exposes the local d2 cluster flows: pod capture, branch impact, and
+// scheduled captures.
+func runD2(args []string, out io.Writer) error {
+	usage := errors.New("usage: profctl d2 <capture|branch-impact <plan|run|list|show|abort>|schedule <run|list|show|stop>>")
+	if len(args) < 1 {
+		return usage
+	}
+	switch args[0] {
+	case "capture":
+		return runD2Capture(args[1:], out)
+	case "branch-impact":
+		if len(args) < 2 {
+			return usage
+		}
+		switch args[1] {
+		case "plan":
+			return runD2BranchImpactPlan(args[2:], out)
+		case "run":
+			return runD2BranchImpactRun(args[2:], out)
+		case "list":
+			return runD2BranchImpactList(args[2:], out)
+		case "show":
+			return runD2BranchImpactShow(args[2:], out)
+		case "abort":
+			return runD2BranchImpactAbort(args[2:], out)
+		default:
+			return fmt.Errorf("unknown d2 branch-impact command: %s", args[1])
+		}
+	case "schedule":
+		if len(args) < 2 {
+			return usage
+		}
+		switch args[1] {
+		case "run":
+			return runD2ScheduleRun(args[2:], out)
+		case "list":
+			return runD2ScheduleList(args[2:], out)
+		case "show":
+			return runD2ScheduleShow(args[2:], out)
+		case "stop":
+			return runD2ScheduleStop(args[2:], out)
+		default:
+			return fmt.Errorf("unknown d2 schedule command: %s", args[1])
+		}
+	default:
+		return fmt.Errorf("unknown d2 command: %s", args[0])
+	}
+}
+
+func runD2Capture(args []string, out io.Writer) error {
+	fs := newFlagSet("d2 capture")
+	service := fs.String("service", "", "d2 service name")
+	target := fs.String("target", "", "capture with plain kubectl instead of Tilt: deployment/<name>, statefulset/<name>, or a label selector")
+	namespace := fs.String("namespace", "", "pod namespace (default: default)")
+	kubeContext := fs.String("kube_context", "", "kubectl context (default: the current context)")
+	port := fs.Int("port", 0, "pprof port for --target (default: discovered from the pod, else 6060)")
+	outDir := fs.String("out", cliConfig.Workspace, "output directory for profiles")
+	seconds := fs.Int("seconds", 30, "CPU profile duration in seconds")
+	types := fs.String("types", "", "comma-separated profile types: cpu, heap, allocs, goroutines, mutex, block, threadcreate (default: all)")
+	mutexRate := fs.Int("mutex_rate", 0, "mutex profile fraction to set for the capture through the rate endpoint (default: leave as is)")
+	blockRate := fs.Int("block_rate", 0, "block profile rate in nanoseconds to set for the capture (default: leave as is)")
+	ratePath := fs.String("rate_path", "", "rate endpoint on the pprof port (default: "+k8s.DefaultRatePath+")")
+	dryRun := fs.Bool("dry_run", false, "print the kubectl/curl commands without running them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if (*service == "" && *target == "") || *outDir == "" {
+		return errors.New("d2 capture requires --service (or --target) and --out")
+	}
+	params := d2.DownloadParams{
+		Service:     *service,
+		Namespace:   *namespace,
+		KubeContext: *kubeContext,
+		OutDir:      *outDir,
+		Seconds:     *seconds,
+		Target:      *target,
+		Port:        *port,
+		Types:       splitList(*types),
+		Rates:       k8s.Rates{Mutex: *mutexRate, Block: *blockRate, Path: *ratePath},
+	}
+
+	if *dryRun {
+		plan, err := d2.DownloadCommands(params)
+		if err != nil {
+			return err
+		}
+		return renderD2DryRun(out, plan)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	result, err := d2.DownloadProfiles(ctx, params)
+	if err != nil {
+		return err
+	}
+	remotePort := 4421
+	if *target != "" {
+		remotePort = result.Port
+	}
+	payload := jsonOutput{
+		"command": d2.PortForwardCommand(*kubeContext, result.Namespace, result.PodName, remotePort),
+		"result":  result,
+	}
+	return render(out, view{
+		payload: payload,
+		table:   func() tableView { return objectsTable(result.Files, "type", "path", "bytes") },
+	})
+}
+
+type d2BranchImpactFlags struct {
+	service        *string
+	services       *string
+	namespace      *string
+	kubeContext    *string
+	devEnv         *string
+	deployCommand  *string
+	gitOpsApp      *string
+	analyze        *bool
+	pprofPort      *int
+	outDir         *string
+	beforeRef      *string
+	afterRef       *string
+	seconds        *int
+	runs           *int
+	rebuildTimeout *int
+	warmupDelay    *int
+	loadCommand    *string
+	k6Script       *string
+	vegetaTargets  *string
+	loadRate       *int
+}
+
+func addD2BranchImpactFlags(fs *flag.FlagSet) *d2BranchImpactFlags {
+	return &d2BranchImpactFlags{
+		service:        fs.String("service", "", "d2 service name"),
+		services:       fs.String("services", "", "comma-separated dependent services profiled alongside --service on each ref"),
+		namespace:      fs.String("namespace", "", "pod namespace (default: default)"),
+		kubeContext:    fs.String("kube_context", "", "kubectl context (default: the current context)"),
+		devEnv:         fs.String("dev_env", "", "dev environment that rebuilds services: tilt, compose, skaffold, or rollout (default: tilt, or PPROF_MCP_DEV_ENV)"),
+		deployCommand:  fs.String("deploy_command", "", "shell command run after each checkout to ship the ref ({ref} substituted)"),
+		gitOpsApp:      fs.String("gitops_app", "", "with --dev_env rollout, Argo CD app (argocd/[ns/]name) or Flux Kustomization (flux/[ns/]name) to wait on"),
+		pprofPort:      fs.Int("pprof_port", 0, "pprof port for compose (default 6060) and skaffold (default: discovered)"),
+		outDir:         fs.String("out", cliConfig.Workspace, "output directory for profiles"),
+		beforeRef:      fs.String("before_ref", "main", "git ref profiled first"),
+		afterRef:       fs.String("after_ref", "", "git ref profiled second (default: current branch)"),
+		seconds:        fs.Int("seconds", 30, "CPU profile duration in seconds"),
+		runs:           fs.Int("runs", 1, "CPU captures per ref; 2 or more adds per-function confidence intervals"),
+		rebuildTimeout: fs.Int("rebuild_timeout", 300, "seconds to wait for Tilt to rebuild after each checkout"),
+		warmupDelay:    fs.Int("warmup_delay", 15, "seconds to let the service warm up before profiling"),
+		loadCommand:    fs.String("load_command", "", "shell command generating traffic during each capture ({seconds}, {ref}, {side} substituted)"),
+		k6Script:       fs.String("k6_script", "", "k6 script run during each capture"),
+		vegetaTargets:  fs.String("vegeta_targets", "", "vegeta targets file attacked during each capture"),
+		loadRate:       fs.Int("load_rate", 0, "vegeta requests per second (default: 50)"),
+		analyze:        fs.Bool("analyze", true, "diff the profiles, summarize hotspots, and write <out>/report.md after the captures"),
+	}
+}
+
+func (f *d2BranchImpactFlags) params() (d2.BranchImpactParams, error) {
+	if *f.service == "" || *f.outDir == "" {
+		return d2.BranchImpactParams{}, errors.New("requires --service and --out")
+	}
+	return d2.BranchImpactParams{
+		Service:        *f.service,
+		Services:       splitList(*f.services),
+		Namespace:      *f.namespace,
+		KubeContext:    *f.kubeContext,
+		DevEnv:         *f.devEnv,
+		DeployCommand:  *f.deployCommand,
+		GitOpsApp:      *f.gitOpsApp,
+		PprofPort:      *f.pprofPort,
+		BeforeRef:      *f.beforeRef,
+		AfterRef:       *f.afterRef,
+		OutDir:         *f.outDir,
+		Seconds:        *f.seconds,
+		Runs:           *f.runs,
+		RebuildTimeout: time.Duration(*f.rebuildTimeout) * time.Second,
+		WarmupDelay:    time.Duration(*f.warmupDelay) * time.Second,
+		SkipAnalysis:   !*f.analyze,
+		Load: d2.LoadParams{
+			Command:       *f.loadCommand,
+			K6Script:      *f.k6Script,
+			VegetaTargets: *f.vegetaTargets,
+			Rate:          *f.loadRate,
+		},
+	}, nil
+}
+
+// runD2BranchImpactPlan shows what run would do: the steps, a time estimate,
+// and the exact commands. Nothing is changed.
+func runD2BranchImpactPlan(args []string, out io.Writer) error {
+	fs := newFlagSet("d2 branch-impact plan")
+	f := addD2BranchImpactFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	params, err := f.params()
+	if err != nil {
+		return fmt.Errorf("d2 branch-impact plan %w", err)
+	}
+
+	ctx := context.Background()
+	plan, err := d2.CreateExecutionPlan(ctx, params)
+	if err != nil {
+		return err
+	}
+	commands, err := d2.BranchImpactCommands(ctx, params)
+	if err != nil {
+		return err
+	}
+	afterRef := plan.Params.AfterRef
+	if afterRef == "" {
+		afterRef = plan.CurrentBranch
+	}
+
+	payload := jsonOutput{
+		"steps":           plan.Steps,
+		"estimated_time":  plan.EstimatedTime,
+		"current_branch":  plan.CurrentBranch,
+		"has_uncommitted": plan.HasUncommitted,
+		"service":         plan.Params.Service,
+		"before_ref":      plan.Params.BeforeRef,
+		"after_ref":       afterRef,
+		"commands":        commands.Commands,
+		"id":              plan.ID,
+		"expires_at":      plan.ExpiresAt,
+	}
+	if len(plan.Params.Services) > 0 {
+		payload["services"] = plan.Params.Services
+	}
+	return render(out, view{
+		payload: payload,
+		table:   func() tableView { return linesTable(strings.Join(plan.Steps, "\n")) },
+		text: func(w io.Writer) error {
+			fmt.Fprintf(w, "branch impact for %s: %s -> %s (%s)\n", plan.Params.Service, plan.Params.BeforeRef, afterRef, plan.EstimatedTime)
+			for i, step := range plan.Steps {
+				fmt.Fprintf(w, "%2d. %s\n", i+1, step)
+			}
+			fmt.Fprintln(w, "\ncommands:")
+			for _, command := range commands.Commands {
+				fmt.Fprintf(w, "  %s\n", command)
+			}
+			_, err := fmt.Fprintf(w, "\nrun with: profctl d2 branch-impact run --plan %s (before %s)\n", plan.ID, plan.ExpiresAt.Local().Format("2006-01-02 15:04"))
+			return err
+		},
+	})
+}
+
+// runD2BranchImpactRun stashes, checks out both refs, and profiles each.
+// Because it rewrites the working tree it asks for confirmation unless --yes.
+// The run is recorded as a plan, so it shows up in branch-impact list.
+func runD2BranchImpactRun(args []string, out io.Writer) error {
+	fs := newFlagSet("d2 branch-impact run")
+	f := addD2BranchImpactFlags(fs)
+	planID := fs.String("plan", "", "run a plan created by branch-impact plan instead of one built from flags")
+	yes := fs.Bool("yes", false, "skip the confirmation prompt")
+	dryRun := fs.Bool("dry_run", false, "print the commands without running them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var plan *d2.ExecutionPlan
+	var params d2.BranchImpactParams
+	var err error
+	if *planID != "" {
+		if plan, err = d2.GetPlan(*planID); err != nil {
+			return err
+		}
+		params = plan.Params
+	} else if params, err = f.params(); err != nil {
+		return fmt.Errorf("d2 branch-impact run %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *dryRun {
+		plan, err := d2.BranchImpactCommands(ctx, params)
+		if err != nil {
+			return err
+		}
+		return renderD2DryRun(out, plan)
+	}
+
+	if plan == nil {
+		if plan, err = d2.CreateExecutionPlan(ctx, params); err != nil {
+			return err
+		}
+	}
+	if !*yes {
+		if !isTerminal(os.Stdin) {
+			return errors.New("d2 branch-impact run stashes changes and checks out git refs; pass --yes to run without a terminal")
+		}
+		fmt.Fprintf(os.Stderr, "This will run (%s):\n", plan.EstimatedTime)
+		for i, step := range plan.Steps {
+			fmt.Fprintf(os.Stderr, "%2d. %s\n", i+1, step)
+		}
+		fmt.Fprint(os.Stderr, "Proceed? [y/N] ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+			return errors.New("aborted")
+		}
+	}
+
+	result, err := d2.ExecutePlan(ctx, plan.ID)
+	if err != nil {
+		return err
+	}
+
+	payload := jsonOutput{"plan_id": plan.ID, "result": result}
+	var deltas []map[string]any
+	var combined []d2.ServiceCPU
+	if result.Combined != nil {
+		combined = result.Combined.Services
+	}
+	before, after := d2ProfilePath(result.BeforeProfiles, "cpu"), d2ProfilePath(result.AfterProfiles, "cpu")
+	if before != "" && after != "" {
+		diff, err := pprof.RunDiffTop(ctx, pprof.DiffTopParams{Before: before, After: after, NodeCount: 20})
+		if err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("cpu diff failed: %v", err))
+			payload["result"] = result
+		} else {
+			deltas = diff.Deltas
+			payload["cpu_diff"] = jsonOutput{"commands": diff.Commands, "deltas": diff.Deltas}
+		}
+	}
+
+	return render(out, view{
+		payload: payload,
+		table: func() tableView {
+			if len(result.Stats) > 0 {
+				return objectsTable(d2StatsRows(result.Stats), "service", "function", "before_mean", "after_mean", "delta", "ci_low", "ci_high", "significant")
+			}
+			if len(combined) > 0 {
+				return objectsTable(combined, "service", "before_seconds", "after_seconds", "delta_seconds", "before_share_pct", "after_share_pct", "share_shift_points")
+			}
+			return objectsTable(deltas)
+		},
+		text: func(w io.Writer) error {
+			impacts := d2ServiceImpacts(result)
+			for _, impact := range impacts {
+				fmt.Fprintf(w, "%s: %s -> %s (%s)\n", impact.Service, result.BeforeRef, result.AfterRef, impact.UpdateMethod)
+				for _, file := range impact.BeforeProfiles.Files {
+					fmt.Fprintf(w, "  before %-10s %s\n", file.Type, file.Path)
+				}
+				for _, file := range impact.AfterProfiles.Files {
+					fmt.Fprintf(w, "  after  %-10s %s\n", file.Type, file.Path)
+				}
+			}
+			for _, load := range []struct {
+				ref     string
+				summary *d2.LoadSummary
+			}{{result.BeforeRef, result.BeforeLoad}, {result.AfterRef, result.AfterLoad}} {
+				if load.summary != nil {
+					fmt.Fprintf(w, "  load on %s: %s\n", load.ref, d2LoadLine(load.summary))
+				}
+			}
+			for _, warning := range result.Warnings {
+				fmt.Fprintf(w, "  warning: %s\n", warning)
+			}
+			if result.Combined != nil {
+				fmt.Fprintf(w, "\ncombined cpu: %.2fs -> %.2fs (%+.1f%%)\n", result.Combined.BeforeSeconds, result.Combined.AfterSeconds, result.Combined.DeltaPct)
+				for _, service := range combined {
+					fmt.Fprintf(w, "  %-20s %8.2fs -> %8.2fs  share %5.1f%% -> %5.1f%% (%+.1f pts)\n",
+						service.Service, service.BeforeSeconds, service.AfterSeconds, service.BeforeSharePct, service.AfterSharePct, service.ShareShiftPoints)
+				}
+			}
+			for _, stats := range result.Stats {
+				total := stats.Total
+				fmt.Fprintf(w, "\n%s cpu over %d runs: %.2fs ±%.2f -> %.2fs ±%.2f (%+.2fs, 95%% CI %+.2f..%+.2f)\n",
+					stats.Service, stats.Runs, total.BeforeMean, total.BeforeStddev, total.AfterMean, total.AfterStddev, total.Delta, total.CILow, total.CIHigh)
+				for _, fn := range stats.Functions {
+					if fn.Significant {
+						fmt.Fprintf(w, "  %+8.3fs  [%+.3f..%+.3f]  %s\n", fn.Delta, fn.CILow, fn.CIHigh, fn.Function)
+					}
+				}
+				if stats.Significant == 0 {
+					fmt.Fprintln(w, "  no function changed beyond run-to-run noise")
+				}
+			}
+			for _, analysis := range result.Analysis {
+				for _, diff := range analysis.Diffs {
+					if diff.Type != "cpu" || len(diff.Deltas) == 0 {
+						continue
+					}
+					fmt.Fprintf(w, "\n%s cpu changes:\n", analysis.Service)
+					for _, delta := range diff.Deltas {
+						fmt.Fprintf(w, "  %+8.3fs  %s\n", delta["delta_seconds"], delta["name"])
+					}
+				}
+			}
+			fmt.Fprintln(w)
+			if result.ReportPath != "" {
+				fmt.Fprintf(w, "report: %s\n", result.ReportPath)
+				return nil
+			}
+			for _, impact := range impacts {
+				before, after := d2ProfilePath(impact.BeforeProfiles, "cpu"), d2ProfilePath(impact.AfterProfiles, "cpu")
+				if before != "" && after != "" {
+					fmt.Fprintf(w, "compare: profctl pprof diff_top --before %s --after %s\n", before, after)
+				}
+			}
+			return nil
+		},
+	})
+}
+
+// runD2BranchImpactList lists stored plans and runs, newest first.
+func runD2BranchImpactList(args []string, out io.Writer) error {
+	fs := newFlagSet("d2 branch-impact list")
+	status := fs.String("status", "", "only plans with this status: pending, running, succeeded, failed, or expired")
+	limit := fs.Int("limit", 20, "maximum plans to show (0 for all)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	plans, err := d2.ListPlans()
+	if err != nil {
+		return err
+	}
+	var selected []d2.ExecutionPlan
+	rows := []map[string]any{}
+	for _, plan := range plans {
+		plan.Status = plan.CurrentStatus()
+		if *status != "" && plan.Status != *status {
+			continue
+		}
+		selected = append(selected, plan)
+		rows = append(rows, map[string]any{
+			"id":       plan.ID,
+			"status":   plan.Status,
+			"created":  plan.CreatedAt.Local().Format("2006-01-02 15:04"),
+			"services": strings.Join(append([]string{plan.Params.Service}, plan.Params.Services...), ","),
+			"refs":     plan.Params.BeforeRef + " -> " + firstNonEmptyString(plan.Params.AfterRef, plan.CurrentBranch),
+		})
+		if *limit > 0 && len(selected) == *limit {
+			break
+		}
+	}
+	dir := d2.PlanDir()
+	return render(out, view{
+		payload: jsonOutput{"plan_dir": dir, "plans": selected},
+		table:   func() tableView { return objectsTable(rows, "id", "status", "created", "services", "refs") },
+		text: func(w io.Writer) error {
+			if len(rows) == 0 {
+				_, err := fmt.Fprintf(w, "no branch-impact plans in %s\n", firstNonEmptyString(dir, "memory"))
+				return err
+			}
+			for _, row := range rows {
+				fmt.Fprintf(w, "%s  %s  %-9s %s  %s\n", row["id"], row["created"], row["status"], row["services"], row["refs"])
+			}
+			return nil
+		},
+	})
+}
+
+// runD2BranchImpactShow prints one stored plan and its run.
+func runD2BranchImpactShow(args []string, out io.Writer) error {
+	fs := newFlagSet("d2 branch-impact show")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: profctl d2 branch-impact show <plan-id>")
+	}
+	plan, err := d2.GetPlan(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	shown := *plan
+	shown.Status = plan.CurrentStatus()
+	return render(out, view{
+		payload: jsonOutput{"plan": shown},
+		table:   func() tableView { return linesTable(strings.Join(shown.Steps, "\n")) },
+		text: func(w io.Writer) error {
+			fmt.Fprintf(w, "plan %s: %s\n", shown.ID, shown.Status)
+			fmt.Fprintf(w, "  services: %s\n", strings.Join(append([]string{shown.Params.Service}, shown.Params.Services...), ", "))
+			fmt.Fprintf(w, "  refs:     %s -> %s\n", shown.Params.BeforeRef, firstNonEmptyString(shown.Params.AfterRef, shown.CurrentBranch))
+			fmt.Fprintf(w, "  created:  %s\n", shown.CreatedAt.Local().Format(time.RFC3339))
+			if shown.StartedAt != nil {
+				fmt.Fprintf(w, "  started:  %s\n", shown.StartedAt.Local().Format(time.RFC3339))
+			}
+			if shown.FinishedAt != nil {
+				fmt.Fprintf(w, "  finished: %s\n", shown.FinishedAt.Local().Format(time.RFC3339))
+			}
+			if shown.Error != "" {
+				fmt.Fprintf(w, "  error:    %s\n", shown.Error)
+			}
+			if shown.Result == nil {
+				return nil
+			}
+			for _, impact := range d2ServiceImpacts(*shown.Result) {
+				fmt.Fprintf(w, "\n%s (%s)\n", impact.Service, impact.UpdateMethod)
+				for _, file := range impact.BeforeProfiles.Files {
+					fmt.Fprintf(w, "  before %-10s %s\n", file.Type, file.Path)
+				}
+				for _, file := range impact.AfterProfiles.Files {
+					fmt.Fprintf(w, "  after  %-10s %s\n", file.Type, file.Path)
+				}
+			}
+			return nil
+		},
+	})
+}
+
+// runD2BranchImpactAbort restores the git state of a run whose process
+// exited mid-comparison. A run still in progress is stopped with Ctrl-C in
+// its own terminal, which restores the branch the same way.
+func runD2BranchImpactAbort(args []string, out io.Writer) error {
+	fs := newFlagSet("d2 branch-impact abort")
+	planID := fs.String("plan", "", "plan to recover (default: the only plan still marked running)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *planID == "" {
+		plans, err := d2.ListPlans()
+		if err != nil {
+			return err
+		}
+		var running []string
+		for _, plan := range plans {
+			if plan.CurrentStatus() == d2.PlanRunning {
+				running = append(running, plan.ID)
+			}
+		}
+		switch len(running) {
+		case 0:
+			return errors.New("no branch-impact plan is marked running")
+		case 1:
+			*planID = running[0]
+		default:
+			return fmt.Errorf("several plans are marked running (%s); pass --plan", strings.Join(running, ", "))
+		}
+	}
+
+	result, err := d2.AbortRun(context.Background(), *planID)
+	if err != nil {
+		return err
+	}
+	return render(out, view{
+		payload: jsonOutput{"abort": result},
+		text: func(w io.Writer) error {
+			fmt.Fprintf(w, "aborted plan %s (%s) while %s\n", result.PlanID, result.Service, result.Phase)
+			if restore := result.Restore; restore != nil {
+				fmt.Fprintf(w, "  branch %s restored: %t\n", restore.Branch, restore.BranchRestored)
+				fmt.Fprintf(w, "  stash popped: %t\n", restore.StashPopped)
+				for _, message := range restore.Errors {
+					fmt.Fprintf(w, "  error: %s\n", message)
+				}
+			}
+			return nil
+		},
+	})
+}
+
+func renderD2DryRun(out io.Writer, plan d2.DryRunResult) error {
+	return render(out, view{
+		payload: jsonOutput{"dry_run": true, "command": plan.Command, "commands": plan.Commands, "notes": plan.Notes},
+		table:   func() tableView { return linesTable(strings.Join(plan.Commands, "\n")) },
+		text: func(w io.Writer) error {
+			for _, command := range plan.Commands {
+				fmt.Fprintln(w, command)
+			}
+			for _, note := range plan.Notes {
+				fmt.Fprintf(w, "# %s\n", note)
+			}
+			return nil
+		},
+	})
+}
+
+// d2ServiceImpacts returns every compared service, including the only one
+// of a single-service comparison.
+func d2ServiceImpacts(result d2.BranchImpactResult) []d2.ServiceImpact {
+	if len(result.Services) > 0 {
+		return result.Services
+	}
+	return []d2.ServiceImpact{{Service: result.Service, BeforeProfiles: result.BeforeProfiles, AfterProfiles: result.AfterProfiles, UpdateMethod: result.UpdateMethod}}
+}
+
+func d2ProfilePath(result d2.DownloadResult, profileType string) string {
+	for _, file := range result.Files {
+		if file.Type == profileType {
+			return file.Path
+		}
+	}
+	return ""
+}
+
+// d2LoadLine summarizes the load generated during one capture
+func d2LoadLine(load *d2.LoadSummary) string {
+	if load.Error != "" {
+		return fmt.Sprintf("%s failed: %s", load.Tool, load.Error)
+	}
+	if load.Requests == 0 {
+		return fmt.Sprintf("%s ran for %ds", load.Tool, load.Seconds)
+	}
+	return fmt.Sprintf("%s %.0f requests (%.1f/s, %.1f%% ok), p50 %.1fms p95 %.1fms p99 %.1fms",
+		load.Tool, load.Requests, load.Rate, load.Success*100, load.P50MS, load.P95MS, load.P99MS)
+}
+
+// d2StatsRows flattens per-service statistics into one row per function
+func d2StatsRows(stats []d2.RepeatedStats) []map[string]any {
+	var rows []map[string]any
+	for _, service := range stats {
+		for _, fn := range append([]d2.FunctionDelta{service.Total}, service.Functions...) {
+			rows = append(rows, map[string]any{
+				"service":     service.Service,
+				"function":    fn.Function,
+				"before_mean": fn.BeforeMean,
+				"after_mean":  fn.AfterMean,
+				"delta":       fn.Delta,
+				"ci_low":      fn.CILow,
+				"ci_high":     fn.CIHigh,
+				"significant": fn.Significant,
+			})
+		}
+	}
+	return rows
+}
+
+// runD2ScheduleRun captures from local services on an interval in the
+// foreground until the schedule's count or duration runs out or Ctrl-C.
+func runD2ScheduleRun(args []string, out io.Writer) error {
+	fs := newFlagSet("d2 schedule run")
+	services := fs.String("services", "", "comma-separated services to capture")
+	interval := fs.Duration("interval", 5*time.Minute, "time between captures (at least 30s and --seconds + 10s)")
+	seconds := fs.Int("seconds", 30, "CPU profile duration in seconds")
+	count := fs.Int("count", 0, "stop after this many rounds (default: until --duration)")
+	duration := fs.Duration("duration", 0, "stop after this long (default: 24h when --count is unset; at most 168h)")
+	namespace := fs.String("namespace", "", "pod namespace (default: default)")
+	kubeContext := fs.String("kube_context", "", "kubectl context (default: the current context)")
+	devEnv := fs.String("dev_env", "", "dev environment the services run in: tilt, compose, skaffold, or rollout (default: tilt, or PPROF_MCP_DEV_ENV)")
+	pprofPort := fs.Int("pprof_port", 0, "pprof port for compose (container port, default 6060) and skaffold (default: discovered)")
+	outDir := fs.String("out", "", "directory captures are written under (default: <workspace>/schedules/<id>)")
+	dryRun := fs.Bool("dry_run", false, "print the commands of one round without running them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	params := d2.ScheduleParams{
+		Services:    splitList(*services),
+		Namespace:   *namespace,
+		KubeContext: *kubeContext,
+		DevEnv:      *devEnv,
+		PprofPort:   *pprofPort,
+		Interval:    *interval,
+		Seconds:     *seconds,
+		Count:       *count,
+		Duration:    *duration,
+		OutDir:      *outDir,
+	}
+	if len(params.Services) == 0 {
+		return errors.New("d2 schedule run requires --services")
+	}
+
+	if *dryRun {
+		plan, err := d2.ScheduleCommands(params)
+		if err != nil {
+			return err
+		}
+		return renderD2DryRun(out, plan)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	schedule, err := d2.RunSchedule(ctx, params, func(capture d2.ScheduleCapture) {
+		if capture.Error != "" {
+			fmt.Fprintf(os.Stderr, "round %d %s: %s\n", capture.Round, capture.Service, capture.Error)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "round %d %s: heap %s, %.0f goroutines, %.2fs CPU -> %s\n",
+			capture.Round, capture.Service, formatBytes(int64(capture.HeapInuse)), capture.Goroutines, capture.CPUSeconds, capture.Dir)
+	})
+	if schedule == nil {
+		return err
+	}
+	if renderErr := renderD2Schedule(out, *schedule, 0); renderErr != nil {
+		return renderErr
+	}
+	return err
+}
+
+func runD2ScheduleList(args []string, out io.Writer) error {
+	fs := newFlagSet("d2 schedule list")
+	status := fs.String("status", "", "only schedules with this status: running, finished, stopped, failed, or interrupted")
+	limit := fs.Int("limit", 20, "maximum schedules to show (0 for all)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	schedules, err := d2.ListSchedules()
+	if err != nil {
+		return err
+	}
+	var selected []d2.Schedule
+	rows := []map[string]any{}
+	for _, schedule := range schedules {
+		schedule.Status = schedule.CurrentStatus()
+		if *status != "" && schedule.Status != *status {
+			continue
+		}
+		selected = append(selected, schedule)
+		rows = append(rows, map[string]any{
+			"id":       schedule.ID,
+			"status":   schedule.Status,
+			"started":  schedule.StartedAt.Local().Format("2006-01-02 15:04"),
+			"services": strings.Join(schedule.Params.Services, ","),
+			"rounds":   schedule.Rounds,
+			"growing":  strings.Join(d2ScheduleGrowing(schedule), ", "),
+		})
+		if *limit > 0 && len(selected) == *limit {
+			break
+		}
+	}
+	dir := d2.ScheduleDir()
+	return render(out, view{
+		payload: jsonOutput{"schedule_dir": dir, "schedules": selected},
+		table: func() tableView {
+			return objectsTable(rows, "id", "status", "started", "services", "rounds", "growing")
+		},
+		text: func(w io.Writer) error {
+			if len(rows) == 0 {
+				_, err := fmt.Fprintf(w, "no schedules in %s\n", dir)
+				return err
+			}
+			for _, row := range rows {
+				fmt.Fprintf(w, "%s  %s  %-11s %s  %d rounds", row["id"], row["started"], row["status"], row["services"], row["rounds"])
+				if growing := row["growing"].(string); growing != "" {
+					fmt.Fprintf(w, "  growing: %s", growing)
+				}
+				fmt.Fprintln(w)
+			}
+			return nil
+		},
+	})
+}
+
+func runD2ScheduleShow(args []string, out io.Writer) error {
+	fs := newFlagSet("d2 schedule show")
+	captures := fs.Int("captures", 20, "latest captures to list (0 for all)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: profctl d2 schedule show [--captures N] <schedule-id>")
+	}
+	schedule, err := d2.GetSchedule(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return renderD2Schedule(out, *schedule, *captures)
+}
+
+// runD2ScheduleStop marks a schedule whose process exited as stopped. A
+// schedule running in another terminal is stopped there with Ctrl-C.
+func runD2ScheduleStop(args []string, out io.Writer) error {
+	fs := newFlagSet("d2 schedule stop")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: profctl d2 schedule stop <schedule-id>")
+	}
+	schedule, err := d2.StopSchedule(context.Background(), fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return renderD2Schedule(out, *schedule, 0)
+}
+
+// renderD2Schedule prints a schedule's trends and its latest captures
+func renderD2Schedule(out io.Writer, schedule d2.Schedule, captures int) error {
+	schedule.Status = schedule.CurrentStatus()
+	trends := schedule.Trends()
+	latest := schedule.Captures
+	if captures > 0 && len(latest) > captures {
+		latest = latest[len(latest)-captures:]
+	}
+	var rows []map[string]any
+	for _, trend := range trends {
+		for _, metric := range trend.Metrics {
+			rows = append(rows, map[string]any{
+				"service":    trend.Service,
+				"metric":     metric.Metric,
+				"first":      metric.First,
+				"last":       metric.Last,
+				"change_pct": metric.ChangePct,
+				"per_hour":   metric.PerHour,
+				"rising":     metric.Rising,
+				"growing":    metric.Growing,
+			})
+		}
+	}
+	return render(out, view{
+		payload: jsonOutput{"schedule": schedule, "trends": trends},
+		table: func() tableView {
+			return objectsTable(rows, "service", "metric", "first", "last", "change_pct", "per_hour", "rising", "growing")
+		},
+		text: func(w io.Writer) error {
+			fmt.Fprintf(w, "schedule %s: %s\n", schedule.ID, schedule.Status)
+			fmt.Fprintf(w, "  services: %s (%s)\n", strings.Join(schedule.Params.Services, ", "), schedule.Params.DevEnv)
+			fmt.Fprintf(w, "  every:    %v, %d rounds so far\n", schedule.Params.Interval, schedule.Rounds)
+			fmt.Fprintf(w, "  out:      %s\n", schedule.Params.OutDir)
+			fmt.Fprintf(w, "  started:  %s\n", schedule.StartedAt.Local().Format(time.RFC3339))
+			if schedule.FinishedAt != nil {
+				fmt.Fprintf(w, "  finished: %s\n", schedule.FinishedAt.Local().Format(time.RFC3339))
+			}
+			if schedule.Error != "" {
+				fmt.Fprintf(w, "  error:    %s\n", schedule.Error)
+			}
+			for _, trend := range trends {
+				fmt.Fprintf(w, "\n%s (%d captures)\n", trend.Service, trend.Captures)
+				for _, metric := range trend.Metrics {
+					flag := ""
+					if metric.Growing {
+						flag = "  GROWING"
+					}
+					fmt.Fprintf(w, "  %-17s %12.0f -> %12.0f  %+7.1f%%  %+.1f/h%s\n", metric.Metric, metric.First, metric.Last, metric.ChangePct, metric.PerHour, flag)
+				}
+			}
+			if len(latest) > 0 {
+				fmt.Fprintln(w)
+			}
+			for _, capture := range latest {
+				status := capture.Dir
+				if capture.Error != "" {
+					status = "failed: " + capture.Error
+				}
+				fmt.Fprintf(w, "  %s  round %-4d %s  %s\n", capture.At.Local().Format("15:04:05"), capture.Round, capture.Service, status)
+			}
+			return nil
+		},
+	})
+}
+
+// d2ScheduleGrowing lists the service metrics a schedule flags as growing
+func d2ScheduleGrowing(schedule d2.Schedule) []string {
+	var growing []string
+	for _, trend := range schedule.Trends() {
+		for _, metric := range trend.Growing {
+			growing = append(growing, trend.Service+": "+metric)
+		}
+	}
+	return growing
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/arreyder/pprof-mcp/internal/history"
+	"github.com/arreyder/pprof-mcp/internal/profiles"
+)
+
+// runExport packages a history session's profiles, reports, renders, and
+// commands into one zip, e.g.
+// `profctl export --session 20260112-093015-4f2a -o investigation.zip`.
+func runExport(args []string, out io.Writer) error {
+	fs := newFlagSet("export")
+	sessionID := fs.String("session", "", "session name, or the id of any history entry in it (default: the latest session)")
+	outputPath := fs.String("output_path", "", "archive to write (default: investigation-<session>.zip)")
+	fs.StringVar(outputPath, "o", "", "shorthand for --output_path")
+	dryRun := fs.Bool("dry_run", false, "list what would be archived without writing it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return errors.New("usage: profctl export [--session <id>] [-o investigation.zip] [--dry_run]")
+	}
+	historyPath := history.Path()
+	if historyPath == "" {
+		return errors.New("history is disabled (PPROF_MCP_HISTORY=off), so there is nothing to export")
+	}
+	session, entries, err := history.Session(historyPath, *sessionID)
+	if err != nil {
+		return err
+	}
+	// Earlier exports belong to the session but are not part of the evidence.
+	recorded := entries[:0:0]
+	for _, entry := range entries {
+		if len(entry.Args) > 0 && entry.Args[0] == "export" {
+			continue
+		}
+		recorded = append(recorded, entry)
+	}
+	if len(recorded) == 0 {
+		return fmt.Errorf("session %s has no commands to export", session)
+	}
+	manifest := history.PlanExport(session, recorded, resolveHandleInput())
+
+	archivePath := firstNonEmptyString(*outputPath, "investigation-"+session+".zip")
+	if !*dryRun {
+		if err := writeExportArchive(archivePath, manifest); err != nil {
+			return err
+		}
+	}
+
+	payload := jsonOutput{
+		"session":  session,
+		"commands": len(manifest.Entries),
+		"files":    manifest.Files,
+		"bytes":    manifest.Bytes,
+		"dry_run":  *dryRun,
+	}
+	if len(manifest.Missing) > 0 {
+		payload["missing"] = manifest.Missing
+	}
+	if !*dryRun {
+		payload["output_path"] = archivePath
+	}
+	return render(out, view{
+		payload: payload,
+		table:   func() tableView { return objectsTable(manifest.Files, "role", "bytes", "path") },
+		text: func(w io.Writer) error {
+			for _, file := range manifest.Files {
+				fmt.Fprintf(w, "%-6s %8s  %s\n", file.Role, formatBytes(file.Bytes), file.Path)
+			}
+			for _, missing := range manifest.Missing {
+				fmt.Fprintf(w, "missing %s\n", missing)
+			}
+			if *dryRun {
+				_, err := fmt.Fprintf(w, "would write %s: %d commands, %d files (%s)\n", archivePath, len(manifest.Entries), len(manifest.Files), formatBytes(manifest.Bytes))
+				return err
+			}
+			_, err := fmt.Fprintf(w, "wrote %s: %d commands, %d files (%s)\n", archivePath, len(manifest.Entries), len(manifest.Files), formatBytes(manifest.Bytes))
+			return err
+		},
+	})
+}
+
+// writeExportArchive writes through a temp file so a failed export does not
+// leave a truncated archive behind.
+func writeExportArchive(path string, manifest history.Manifest) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".export-*.zip")
+	if err != nil {
+		return err
+	}
+	if err := history.WriteExport(tmp, manifest); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// resolveHandleInput maps profile handles in the history to their files.
+func resolveHandleInput() func(string) (string, bool) {
+	storePath := profiles.StorePath()
+	if storePath == "" {
+		return nil
+	}
+	registry, err := profiles.OpenRegistry(storePath)
+	if err != nil {
+		return nil
+	}
+	return func(input string) (string, bool) {
+		if !profiles.IsHandle(input) {
+			return "", false
+		}
+		meta, ok := registry.Resolve(input)
+		return meta.Path, ok
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/arreyder/pprof-mcp/internal/pprof"
+)
+
+func runPprofFlame(args []string, out io.Writer) error {
+	fs := newFlagSet("pprof flame")
+	profile := fs.String("profile", "", "path to .pprof profile")
+	outputPath := fs.String("output_path", "", "path to write the SVG (default: <profile>.flame.svg)")
+	binary := fs.String("binary", "", "path to binary (optional)")
+	focus := fs.String("focus", "", "focus regex")
+	ignore := fs.String("ignore", "", "ignore regex")
+	tagFocus := fs.String("tag_focus", "", "regex to focus on samples with matching tag values")
+	tagIgnore := fs.String("tag_ignore", "", "regex to ignore samples with matching tag values")
+	sampleIndex := fs.String("sample_index", "", "pprof sample index")
+	open := fs.Bool("open", false, "open the result in the default browser")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *profile == "" {
+		return errors.New("pprof flame requires --profile")
+	}
+	if *outputPath == "" {
+		*outputPath = derivedOutputPath(*profile, "flame", "svg")
+	}
+
+	result, err := pprof.RunFlamegraph(context.Background(), pprof.FlamegraphParams{
+		Profile:     *profile,
+		Binary:      *binary,
+		OutputPath:  *outputPath,
+		Focus:       *focus,
+		Ignore:      *ignore,
+		TagFocus:    *tagFocus,
+		TagIgnore:   *tagIgnore,
+		SampleIndex: *sampleIndex,
+	})
+	if err != nil {
+		return err
+	}
+
+	payload := jsonOutput{
+		"command":     result.Command,
+		"output_path": result.OutputPath,
+		"format":      result.Format,
+		"message":     result.Message,
+	}
+	if len(result.Warnings) > 0 {
+		payload["warnings"] = result.Warnings
+	}
+	if *open {
+		if err := openInBrowser(result.OutputPath); err != nil {
+			return err
+		}
+		payload["opened"] = true
+	}
+	return render(out, view{payload: payload})
+}
+
+func runPprofCallgraph(args []string, out io.Writer) error {
+	fs := newFlagSet("pprof callgraph")
+	profile := fs.String("profile", "", "path to .pprof profile")
+	outputPath := fs.String("output_path", "", "path to write the graph (default: <profile>.callgraph.<format>)")
+	binary := fs.String("binary", "", "path to binary (optional)")
+	format := fs.String("format", "", "output format: dot|svg|png (default: dot, or svg with --open)")
+	focus := fs.String("focus", "", "focus regex")
+	ignore := fs.String("ignore", "", "ignore regex")
+	nodecount := fs.Int("nodecount", 0, "maximum number of nodes to show")
+	edgeFrac := fs.Float64("edge_frac", 0, "hide edges below this fraction (0.0-1.0)")
+	nodeFrac := fs.Float64("node_frac", 0, "hide nodes below this fraction (0.0-1.0)")
+	sampleIndex := fs.String("sample_index", "", "pprof sample index")
+	open := fs.Bool("open", false, "open the result in the default browser")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *profile == "" {
+		return errors.New("pprof callgraph requires --profile")
+	}
+	if *format == "" {
+		// A browser cannot show DOT, so --open renders SVG unless told otherwise.
+		*format = "dot"
+		if *open {
+			*format = "svg"
+		}
+	}
+	if *outputPath == "" {
+		*outputPath = derivedOutputPath(*profile, "callgraph", *format)
+	}
+
+	result, err := pprof.RunCallgraph(context.Background(), pprof.CallgraphParams{
+		Profile:     *profile,
+		Binary:      *binary,
+		OutputPath:  *outputPath,
+		Format:      *format,
+		Focus:       *focus,
+		Ignore:      *ignore,
+		NodeCount:   *nodecount,
+		EdgeFrac:    *edgeFrac,
+		NodeFrac:    *nodeFrac,
+		SampleIndex: *sampleIndex,
+	})
+	if err != nil {
+		return err
+	}
+
+	payload := jsonOutput{
+		"command":     result.Command,
+		"output_path": result.OutputPath,
+		"format":      result.Format,
+		"message":     result.Message,
+	}
+	if len(result.Warnings) > 0 {
+		payload["warnings"] = result.Warnings
+	}
+	if *open && result.Format != "dot" {
+		if err := openInBrowser(result.OutputPath); err != nil {
+			return err
+		}
+		payload["opened"] = true
+	}
+	return render(out, view{payload: payload})
+}
+
+// derivedOutputPath places a rendering next to its profile, e.g.
+// cpu.pprof -> cpu.flame.svg.
+func derivedOutputPath(profile, kind, ext string) string {
+	base := strings.TrimSuffix(profile, filepath.Ext(profile))
+	return base + "." + kind + "." + ext
+}
+
+// openInBrowser hands path to the platform's default opener without waiting
+// for the viewer to exit.
+func openInBrowser(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", abs)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", abs)
+	default:
+		cmd = exec.Command("xdg-open", abs)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("open %s: %w", abs, err)
+	}
+	return cmd.Process.Release()
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+	"github.com/arreyder/pprof-mcp/internal/history"
+	"github.com/arreyder/pprof-mcp/internal/profiles"
+)
+
+// historyOutputs collects artifact paths from every payload rendered during
+// this invocation so the history entry can list what was written.
+var historyOutputs []string
+
+// unrecordedCommands are not worth retracing later.
+var unrecordedCommands = map[string]bool{
+	"history":       true,
+	"clean":         true,
+	"completion":    true,
+	completeCommand: true,
+}
+
+// historyOutputFlags name files a command writes rather than reads.
+var historyOutputFlags = map[string]bool{"o": true, "out": true, "output": true, "output_path": true}
+
+// startHistory notes the files and handles an invocation reads. It runs
+// before the command so files the command creates are not mistaken for
+// inputs; values of output flags are skipped for the same reason.
+func startHistory(args []string) history.Entry {
+	entry := history.Entry{Time: time.Now().UTC(), Args: args}
+	if len(args) == 0 || unrecordedCommands[args[0]] || history.Path() == "" {
+		return entry
+	}
+	var inputs []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if strings.HasPrefix(arg, "-") {
+			name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+			if historyOutputFlags[name] {
+				if !hasValue {
+					i++
+				}
+				continue
+			}
+			if !hasValue {
+				continue
+			}
+			arg = value
+		}
+		if strings.HasPrefix(arg, profiles.HandlePrefix) {
+			inputs = append(inputs, arg)
+		} else if path, ok := existingFile(arg); ok {
+			inputs = append(inputs, path)
+		}
+	}
+	entry.Inputs = uniqueStrings(inputs)
+	return entry
+}
+
+// recordHistory appends the invocation begun by startHistory. Failures are
+// reported on stderr but never change the command's exit status.
+func recordHistory(entry history.Entry, runErr error) {
+	if len(entry.Args) == 0 || unrecordedCommands[entry.Args[0]] || errors.Is(runErr, flag.ErrHelp) {
+		return
+	}
+	path := history.Path()
+	if path == "" {
+		return
+	}
+	entry.DurationMS = time.Since(entry.Time).Milliseconds()
+	if dir, err := os.Getwd(); err == nil {
+		entry.Dir = dir
+	}
+	inputs := map[string]bool{}
+	for _, input := range entry.Inputs {
+		inputs[input] = true
+	}
+	for _, output := range uniqueStrings(historyOutputs) {
+		if !inputs[output] {
+			entry.Outputs = append(entry.Outputs, output)
+		}
+	}
+	if runErr != nil {
+		entry.Error = runErr.Error()
+	}
+	if _, err := history.Append(path, entry); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: recording history: %v\n", err)
+	}
+}
+
+// collectHistoryOutputs records files named by path-like keys in payload.
+func collectHistoryOutputs(payload any) {
+	if history.Path() == "" {
+		return
+	}
+	value, err := normalizeValue(payload)
+	if err != nil {
+		return
+	}
+	var walk func(key string, value any)
+	walk = func(key string, value any) {
+		switch typed := value.(type) {
+		case map[string]any:
+			for k, v := range typed {
+				walk(k, v)
+			}
+		case []any:
+			for _, v := range typed {
+				walk(key, v)
+			}
+		case string:
+			if key != "path" && !strings.HasSuffix(key, "_path") {
+				return
+			}
+			if path, ok := existingFile(typed); ok {
+				historyOutputs = append(historyOutputs, path)
+			}
+		}
+	}
+	walk("", value)
+}
+
+func existingFile(value string) (string, bool) {
+	if value == "" || strings.ContainsAny(value, "\n*?") {
+		return "", false
+	}
+	info, err := os.Stat(value)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", false
+	}
+	if abs, err := filepath.Abs(value); err == nil {
+		value = abs
+	}
+	return value, true
+}
+
+func uniqueStrings(values []string) []string {
+	seen := map[string]bool{}
+	var unique []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// runHistory lists recorded invocations, newest first.
+func runHistory(args []string, out io.Writer) error {
+	if len(args) > 0 && args[0] == "show" {
+		return runHistoryShow(args[1:], out)
+	}
+	fs := newFlagSet("history")
+	limit := fs.Int("limit", 20, "maximum entries to show (0 for all)")
+	touching := fs.String("path", "", "only entries whose inputs or outputs contain this substring")
+	since := fs.Duration("since", 0, "only entries newer than this, e.g. 168h")
+	session := fs.String("session", "", "only entries in this session")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return errors.New("usage: profctl history [--limit N] [--path SUBSTR] [--since DURATION] [--session ID] | history show <id>")
+	}
+	path := history.Path()
+	if path == "" {
+		return errors.New("history is disabled (PPROF_MCP_HISTORY=off)")
+	}
+	entries, err := history.List(path)
+	if err != nil {
+		return err
+	}
+	var selected []history.Entry
+	for _, entry := range entries {
+		if *since > 0 && time.Since(entry.Time) > *since {
+			continue
+		}
+		if *touching != "" && !entry.Touches(*touching) {
+			continue
+		}
+		if *session != "" && entry.Session != *session {
+			continue
+		}
+		selected = append(selected, entry)
+		if *limit > 0 && len(selected) == *limit {
+			break
+		}
+	}
+
+	rows := make([]map[string]any, 0, len(selected))
+	for _, entry := range selected {
+		rows = append(rows, map[string]any{
+			"id":      entry.ID,
+			"session": entry.Session,
+			"time":    entry.Time.Local().Format("2006-01-02 15:04:05"),
+			"command": historyCommand(entry),
+			"outputs": len(entry.Outputs),
+			"status":  historyStatus(entry),
+		})
+	}
+	return render(out, view{
+		payload: jsonOutput{"path": path, "entries": selected},
+		table:   func() tableView { return objectsTable(rows, "id", "session", "time", "status", "outputs", "command") },
+		text: func(w io.Writer) error {
+			if len(selected) == 0 {
+				_, err := fmt.Fprintf(w, "no history in %s\n", path)
+				return err
+			}
+			for _, row := range rows {
+				fmt.Fprintf(w, "%s  %s  %-6s %s\n", row["id"], row["time"], row["status"], row["command"])
+			}
+			return nil
+		},
+	})
+}
+
+// runHistoryShow prints one entry with its inputs and outputs.
+func runHistoryShow(args []string, out io.Writer) error {
+	fs := newFlagSet("history show")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: profctl history show <id>")
+	}
+	path := history.Path()
+	if path == "" {
+		return errors.New("history is disabled (PPROF_MCP_HISTORY=off)")
+	}
+	entry, err := history.Find(path, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return render(out, view{
+		payload: entry,
+		table: func() tableView {
+			rows := []map[string]any{}
+			for _, input := range entry.Inputs {
+				rows = append(rows, map[string]any{"role": "input", "path": input})
+			}
+			for _, output := range entry.Outputs {
+				rows = append(rows, map[string]any{"role": "output", "path": output})
+			}
+			return objectsTable(rows, "role", "path")
+		},
+		text: func(w io.Writer) error {
+			fmt.Fprintf(w, "id:       %s\n", entry.ID)
+			fmt.Fprintf(w, "time:     %s (%s)\n", entry.Time.Local().Format(time.RFC3339), time.Duration(entry.DurationMS)*time.Millisecond)
+			fmt.Fprintf(w, "command:  %s\n", historyCommand(entry))
+			if entry.Session != "" {
+				fmt.Fprintf(w, "session:  %s\n", entry.Session)
+			}
+			if entry.Dir != "" {
+				fmt.Fprintf(w, "dir:      %s\n", entry.Dir)
+			}
+			if entry.Error != "" {
+				fmt.Fprintf(w, "error:    %s\n", entry.Error)
+			}
+			for _, section := range []struct {
+				name  string
+				paths []string
+			}{{"inputs", entry.Inputs}, {"outputs", entry.Outputs}} {
+				if len(section.paths) == 0 {
+					continue
+				}
+				sorted := append([]string{}, section.paths...)
+				sort.Strings(sorted)
+				fmt.Fprintf(w, "%s:\n", section.name)
+				for _, path := range sorted {
+					fmt.Fprintf(w, "  %s\n", path)
+				}
+			}
+			return nil
+		},
+	})
+}
+
+func historyCommand(entry history.Entry) string {
+	return "profctl " + cmdrun.Join(entry.Args...)
+}
+
+func historyStatus(entry history.Entry) string {
+	if entry.Error != "" {
+		return "failed"
+	}
+	return "ok"
+}
@@ -0,0 +1,567 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/datadog"
+	"github.com/arreyder/pprof-mcp/internal/k8s"
+	"github.com/arreyder/pprof-mcp/internal/profiles"
+	"github.com/arreyder/pprof-mcp/internal/services"
+)
+
+// runK8s captures profiles from pods in any cluster kubectl can reach,
+// without the d2/Tilt assumptions of profctl d2.
+func runK8s(args []string, out io.Writer) error {
+	if len(args) > 0 && args[0] == "debug-capture" {
+		return runK8sDebugCapture(args[1:], out)
+	}
+	if len(args) > 0 && args[0] == "capture-job" {
+		return runK8sCaptureJob(args[1:], out)
+	}
+	if len(args) > 0 && args[0] == "compare-clusters" {
+		return runK8sCompareClusters(args[1:], out)
+	}
+	if len(args) > 0 && args[0] == "compare-canary" {
+		return runK8sCompareCanary(args[1:], out)
+	}
+	if len(args) < 1 || args[0] != "capture" {
+		return errors.New("usage: profctl k8s capture --selector <labels>|--workload <kind/name> [--namespace ns] [--port N] | k8s capture-job --workload job/<name>|cronjob/<name> [--at 0.5] | k8s compare-clusters --kube_contexts a,b --workload <kind/name> | k8s compare-canary --selector <labels> [--canary track=canary] | k8s debug-capture --pod <name>|--selector|--workload --image <agent>")
+	}
+	return runK8sCapture(args[1:], out)
+}
+
+func runK8sCapture(args []string, out io.Writer) error {
+	fs := newFlagSet("k8s capture")
+	namespace := fs.String("namespace", "default", "pod namespace")
+	kubeContext := fs.String("kube_context", "", "kubectl context (default: the current context)")
+	selector := fs.String("selector", "", "label selector, e.g. app=foo")
+	workload := fs.String("workload", "", "workload whose pods to capture, e.g. deployment/foo (instead of --selector)")
+	port := fs.Int("port", 0, "net/http/pprof port inside the pod (default: discovered per pod, else declared in --repo_root, else 6060)")
+	repoRoot := fs.String("repo_root", "", "service repository whose k8s manifests, Helm values, and Dockerfiles declare its pprof port")
+	outDir := fs.String("out", cliConfig.Workspace, "output directory; each pod's bundle goes to <out>/<pod>")
+	service := fs.String("service", "", "bundle file prefix (default: the selector's app label)")
+	seconds := fs.Int("seconds", 30, "CPU profile duration in seconds")
+	types := fs.String("types", strings.Join(k8s.DefaultTypes(), ","), "comma-separated profile types")
+	maxPods := fs.Int("max_pods", 5, "capture at most this many matching pods")
+	all := fs.Bool("all", false, "capture every matching pod (ignores --max_pods)")
+	strategy := fs.String("strategy", k8s.StrategyFirst, "which pods to capture first: "+strings.Join(k8s.Strategies(), ", "))
+	node := fs.String("node", "", "only capture pods on this node")
+	usageSource := fs.String("usage_source", "metrics-server", "where cpu/memory strategies read usage: metrics-server or datadog")
+	env := fs.String("env", "", "Datadog environment (with --usage_source datadog)")
+	ddSite := fs.String("dd_site", "", "Datadog site, defaults to DD_SITE or us3.datadoghq.com")
+	merge := fs.Bool("merge", false, "merge each profile type across pods into <out>/fleet and register fleet handles")
+	parallel := fs.Int("parallel", 4, "pods captured at once")
+	podTimeout := fs.Duration("pod_timeout", 0, "give up on a pod after this long (default: --seconds plus 1m)")
+	cgroup := fs.Bool("cgroup", true, "read each pod's cgroup CPU throttling and memory stats with kubectl exec")
+	dryRun := fs.Bool("dry_run", false, "print the kubectl/curl commands without running them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if (*selector == "") == (*workload == "") || *outDir == "" {
+		return errors.New("k8s capture requires --out and one of --selector or --workload")
+	}
+	if *workload != "" {
+		parsed, _, err := k8s.ParseTarget(*workload)
+		if err != nil {
+			return err
+		}
+		if parsed == "" {
+			return fmt.Errorf("--workload %q must be kind/name; use --selector for labels", *workload)
+		}
+		*workload = parsed
+	}
+	params := k8s.CaptureParams{
+		KubeContext: *kubeContext,
+		Namespace:   *namespace,
+		Selector:    *selector,
+		Workload:    *workload,
+		Port:        *port,
+		OutDir:      *outDir,
+		Service:     *service,
+		Seconds:     *seconds,
+		Types:       splitList(*types),
+		MaxPods:     *maxPods,
+		All:         *all,
+		Parallel:    *parallel,
+		Merge:       *merge,
+		PodTimeout:  *podTimeout,
+		Strategy:    *strategy,
+		Node:        *node,
+		SkipCgroup:  !*cgroup,
+	}
+	services.ApplyDeclaredPort(&params, *repoRoot)
+	switch *usageSource {
+	case "metrics-server":
+	case "datadog":
+		params.Usage = k8s.DatadogUsage(*env, *ddSite)
+	default:
+		return fmt.Errorf("--usage_source must be metrics-server or datadog, got %q", *usageSource)
+	}
+
+	if *dryRun {
+		commands, err := k8s.CaptureCommands(params)
+		if err != nil {
+			return err
+		}
+		return render(out, view{
+			payload: jsonOutput{"dry_run": true, "commands": commands},
+			table:   func() tableView { return linesTable(strings.Join(commands, "\n")) },
+			text: func(w io.Writer) error {
+				_, err := fmt.Fprintln(w, strings.Join(commands, "\n"))
+				return err
+			},
+		})
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	result, captureErr := k8s.Capture(ctx, params)
+	if captureErr != nil && len(result.Pods) == 0 {
+		return captureErr
+	}
+
+	payload := jsonOutput{
+		"command": "kubectl " + strings.Join(append(k8s.ContextArgs(result.KubeContext), "get", "pods", "-n", result.Namespace, "-l", result.Selector), " "),
+		"result":  result,
+	}
+	if len(result.Fleet) > 0 {
+		payload["fleet_handles"] = registerFleet(result)
+	}
+	// When every pod failed, the per-pod list still explains why.
+	if err := render(out, view{
+		payload: payload,
+		table: func() tableView {
+			if len(result.Fleet) == 0 {
+				return objectsTable(result.Pods, "pod", "status", "port", "port_source", "profiles", "duration_ms", "error")
+			}
+			var rows []map[string]any
+			for _, fleet := range result.Fleet {
+				for _, c := range fleet.Contributions {
+					rows = append(rows, map[string]any{"type": fleet.Type, "pod": c.Pod, "samples": c.Samples, "pct": c.Pct, "fleet": fleet.Path})
+				}
+			}
+			return objectsTable(rows, "type", "pod", "samples", "pct", "fleet")
+		},
+	}); err != nil {
+		return err
+	}
+	return captureErr
+}
+
+// runK8sCaptureJob waits for a Job or CronJob pod to run and captures it
+// once, keeping whatever was fetched if the pod finishes first.
+func runK8sCaptureJob(args []string, out io.Writer) error {
+	fs := newFlagSet("k8s capture-job")
+	namespace := fs.String("namespace", "default", "pod namespace")
+	kubeContext := fs.String("kube_context", "", "kubectl context (default: the current context)")
+	workload := fs.String("workload", "", "job/<name> or cronjob/<name>")
+	port := fs.Int("port", 0, "net/http/pprof port inside the pod (default: discovered, else declared in --repo_root, else 6060)")
+	repoRoot := fs.String("repo_root", "", "service repository whose k8s manifests, Helm values, and Dockerfiles declare its pprof port")
+	outDir := fs.String("out", cliConfig.Workspace, "output directory; the bundle goes to <out>/<pod>")
+	service := fs.String("service", "", "bundle file prefix (default: the job or cronjob name)")
+	seconds := fs.Int("seconds", 30, "CPU profile duration in seconds (cut short to end before --expected_runtime)")
+	types := fs.String("types", strings.Join(k8s.DefaultTypes(), ","), "comma-separated profile types")
+	wait := fs.Duration("wait", 10*time.Minute, "how long to wait for a pod to reach Running")
+	at := fs.Float64("at", 0, "start the capture at this fraction (0-1) of the expected runtime after the pod started (default: as soon as it runs)")
+	expected := fs.Duration("expected_runtime", 0, "how long one run takes (default for a cronjob: its last successful job's duration)")
+	cgroup := fs.Bool("cgroup", true, "read the pod's cgroup CPU throttling and memory stats with kubectl exec")
+	dryRun := fs.Bool("dry_run", false, "print the kubectl/curl commands without running them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *workload == "" || *outDir == "" {
+		return errors.New("k8s capture-job requires --workload and --out")
+	}
+	parsed, _, err := k8s.ParseTarget(*workload)
+	if err != nil {
+		return err
+	}
+	params := k8s.JobParams{
+		CaptureParams: k8s.CaptureParams{
+			KubeContext: *kubeContext,
+			Namespace:   *namespace,
+			Workload:    parsed,
+			Port:        *port,
+			OutDir:      *outDir,
+			Service:     *service,
+			Seconds:     *seconds,
+			Types:       splitList(*types),
+			SkipCgroup:  !*cgroup,
+		},
+		Wait:            *wait,
+		At:              *at,
+		ExpectedRuntime: *expected,
+	}
+	services.ApplyDeclaredPort(&params.CaptureParams, *repoRoot)
+
+	if *dryRun {
+		commands, err := k8s.JobCaptureCommands(params)
+		if err != nil {
+			return err
+		}
+		return render(out, view{
+			payload: jsonOutput{"dry_run": true, "commands": commands},
+			table:   func() tableView { return linesTable(strings.Join(commands, "\n")) },
+			text: func(w io.Writer) error {
+				_, err := fmt.Fprintln(w, strings.Join(commands, "\n"))
+				return err
+			},
+		})
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	fmt.Fprintf(os.Stderr, "waiting up to %s for a running pod of %s\n", *wait, parsed)
+	result, captureErr := k8s.CaptureJob(ctx, params)
+	if result.Pod.Pod == "" {
+		return captureErr
+	}
+	files := []datadog.ProfileFile{}
+	if result.Bundle != nil {
+		files = result.Bundle.Files
+	}
+	if err := render(out, view{
+		payload: jsonOutput{
+			"command": "kubectl " + strings.Join(append(k8s.ContextArgs(result.KubeContext), "get", "pods", "-n", result.Namespace, "-l", result.Selector), " "),
+			"result":  result,
+		},
+		table: func() tableView { return objectsTable(files, "type", "path", "bytes") },
+	}); err != nil {
+		return err
+	}
+	for _, warning := range append(append([]string{}, result.Pod.Warnings...), result.Warnings...) {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+	}
+	return captureErr
+}
+
+// runK8sCompareClusters captures one workload from two kube contexts (or two
+// namespaces) at once and diffs the merged profiles, listing the pod
+// settings that differ.
+func runK8sCompareClusters(args []string, out io.Writer) error {
+	fs := newFlagSet("k8s compare-clusters")
+	kubeContexts := fs.String("kube_contexts", "", "the two kubectl contexts to compare, baseline first (an empty entry is the current context)")
+	namespace := fs.String("namespace", "default", "pod namespace on both sides")
+	namespaces := fs.String("namespaces", "", "per-side namespaces, comma-separated, when they differ")
+	selector := fs.String("selector", "", "label selector for the pods, e.g. app=foo")
+	workload := fs.String("workload", "", "workload whose pods to capture, e.g. deployment/foo (instead of --selector)")
+	port := fs.Int("port", 0, "net/http/pprof port inside the pods (default: discovered per pod, else 6060)")
+	outDir := fs.String("out", cliConfig.Workspace, "output directory; each side goes to <out>/<context or namespace>")
+	service := fs.String("service", "", "bundle file prefix (default: the selector's app label)")
+	seconds := fs.Int("seconds", 30, "CPU profile duration in seconds")
+	types := fs.String("types", strings.Join(k8s.DefaultTypes(), ","), "comma-separated profile types")
+	maxPods := fs.Int("max_pods", 5, "pods captured per side")
+	strategy := fs.String("strategy", k8s.StrategyFirst, "which pods to capture first: "+strings.Join(k8s.Strategies(), ", "))
+	cgroup := fs.Bool("cgroup", true, "read each pod's cgroup CPU throttling and memory stats with kubectl exec")
+	dryRun := fs.Bool("dry_run", false, "print the kubectl/curl/pprof commands without running them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if (*selector == "") == (*workload == "") || *outDir == "" {
+		return errors.New("k8s compare-clusters requires --out and one of --selector or --workload")
+	}
+	params := k8s.CompareParams{
+		CaptureParams: k8s.CaptureParams{
+			Namespace:  *namespace,
+			Selector:   *selector,
+			Workload:   *workload,
+			Port:       *port,
+			OutDir:     *outDir,
+			Service:    *service,
+			Seconds:    *seconds,
+			Types:      splitList(*types),
+			MaxPods:    *maxPods,
+			Strategy:   *strategy,
+			SkipCgroup: !*cgroup,
+		},
+	}
+	for flag, value := range map[string]string{"--kube_contexts": *kubeContexts, "--namespaces": *namespaces} {
+		if value == "" {
+			continue
+		}
+		// Split without dropping empty entries: ",eu" compares the
+		// current context with eu.
+		parts := strings.Split(value, ",")
+		if len(parts) != 2 {
+			return fmt.Errorf("%s takes exactly two comma-separated values", flag)
+		}
+		for i := range params.Clusters {
+			if flag == "--kube_contexts" {
+				params.Clusters[i].KubeContext = strings.TrimSpace(parts[i])
+			} else {
+				params.Clusters[i].Namespace = strings.TrimSpace(parts[i])
+			}
+		}
+	}
+
+	if *dryRun {
+		commands, err := k8s.CompareCommands(params)
+		if err != nil {
+			return err
+		}
+		return render(out, view{
+			payload: jsonOutput{"dry_run": true, "commands": commands},
+			table:   func() tableView { return linesTable(strings.Join(commands, "\n")) },
+			text: func(w io.Writer) error {
+				_, err := fmt.Fprintln(w, strings.Join(commands, "\n"))
+				return err
+			},
+		})
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	result, err := k8s.CompareClusters(ctx, params)
+	if err != nil {
+		return err
+	}
+	payload := jsonOutput{"result": result}
+	fleetHandles := map[string]map[string]string{}
+	for _, side := range result.Clusters {
+		fleetHandles[side.Label] = registerFleet(side.Capture)
+	}
+	payload["fleet_handles"] = fleetHandles
+	if err := render(out, view{
+		payload: payload,
+		table: func() tableView {
+			first, second := result.Clusters[0].Label, result.Clusters[1].Label
+			var rows []map[string]any
+			for _, difference := range result.ConfigDifferences {
+				rows = append(rows, map[string]any{"setting": difference.Setting, first: difference.Values[0], second: difference.Values[1], "effect": difference.Effect})
+			}
+			return objectsTable(rows, "setting", first, second, "effect")
+		},
+	}); err != nil {
+		return err
+	}
+	for _, warning := range result.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+	}
+	return nil
+}
+
+// runK8sCompareCanary captures a service's canary and stable pods at once,
+// diffs canary against stable, and reports CPU per pod.
+func runK8sCompareCanary(args []string, out io.Writer) error {
+	fs := newFlagSet("k8s compare-canary")
+	kubeContext := fs.String("kube_context", "", "kubectl context (default: the current context)")
+	namespace := fs.String("namespace", "default", "pod namespace")
+	selector := fs.String("selector", "", "label selector of the service's canary and stable pods, e.g. app=foo")
+	canary := fs.String("canary", k8s.DefaultCanarySelector, "labels narrowing --selector to canary pods")
+	stable := fs.String("stable", k8s.DefaultStableSelector, "labels narrowing --selector to stable pods")
+	port := fs.Int("port", 0, "net/http/pprof port inside the pods (default: discovered per pod, else 6060)")
+	outDir := fs.String("out", cliConfig.Workspace, "output directory; the groups go to <out>/stable and <out>/canary")
+	service := fs.String("service", "", "bundle file prefix (default: the selector's app label)")
+	seconds := fs.Int("seconds", 30, "CPU profile duration in seconds")
+	types := fs.String("types", strings.Join(k8s.DefaultTypes(), ","), "comma-separated profile types")
+	maxPods := fs.Int("max_pods", 5, "pods captured per group")
+	strategy := fs.String("strategy", k8s.StrategyFirst, "which pods to capture first: "+strings.Join(k8s.Strategies(), ", "))
+	cgroup := fs.Bool("cgroup", true, "read each pod's cgroup CPU throttling and memory stats with kubectl exec")
+	dryRun := fs.Bool("dry_run", false, "print the kubectl/curl/pprof commands without running them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *selector == "" || *outDir == "" {
+		return errors.New("k8s compare-canary requires --selector and --out")
+	}
+	params := k8s.CanaryParams{
+		CaptureParams: k8s.CaptureParams{
+			KubeContext: *kubeContext,
+			Namespace:   *namespace,
+			Selector:    *selector,
+			Port:        *port,
+			OutDir:      *outDir,
+			Service:     *service,
+			Seconds:     *seconds,
+			Types:       splitList(*types),
+			MaxPods:     *maxPods,
+			Strategy:    *strategy,
+			SkipCgroup:  !*cgroup,
+		},
+		Canary: *canary,
+		Stable: *stable,
+	}
+
+	if *dryRun {
+		commands, err := k8s.CanaryCommands(params)
+		if err != nil {
+			return err
+		}
+		return render(out, view{
+			payload: jsonOutput{"dry_run": true, "commands": commands},
+			table:   func() tableView { return linesTable(strings.Join(commands, "\n")) },
+			text: func(w io.Writer) error {
+				_, err := fmt.Fprintln(w, strings.Join(commands, "\n"))
+				return err
+			},
+		})
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	result, err := k8s.CompareCanary(ctx, params)
+	if err != nil {
+		return err
+	}
+	fleetHandles := map[string]map[string]string{}
+	for _, side := range result.Clusters {
+		fleetHandles[side.Label] = registerFleet(side.Capture)
+	}
+	if err := render(out, view{
+		payload: jsonOutput{"result": result, "fleet_handles": fleetHandles},
+		table: func() tableView {
+			var rows []map[string]any
+			for _, diff := range result.Diffs {
+				for _, delta := range diff.Deltas {
+					rows = append(rows, map[string]any{"type": diff.Type, "function": delta["name"], "delta_seconds": delta["delta_seconds"]})
+				}
+			}
+			return objectsTable(rows, "type", "function", "delta_seconds")
+		},
+	}); err != nil {
+		return err
+	}
+	if result.Verdict != nil {
+		fmt.Fprintln(os.Stderr, result.Verdict.Summary)
+	}
+	for _, warning := range result.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+	}
+	return nil
+}
+
+// runK8sDebugCapture CPU-profiles a pod that does not serve net/http/pprof
+// by injecting an ephemeral agent container. The container is privileged
+// and permanent, so the command asks for confirmation unless --yes.
+func runK8sDebugCapture(args []string, out io.Writer) error {
+	fs := newFlagSet("k8s debug-capture")
+	namespace := fs.String("namespace", "default", "pod namespace")
+	kubeContext := fs.String("kube_context", "", "kubectl context (default: the current context)")
+	pod := fs.String("pod", "", "pod to profile")
+	selector := fs.String("selector", "", "profile the first running pod matching this label selector (instead of --pod)")
+	workload := fs.String("workload", "", "profile the first running pod of this workload, e.g. deployment/foo (instead of --pod)")
+	container := fs.String("container", "", "container to profile (default: the pod's first)")
+	image := fs.String("image", "", "agent image (default: PPROF_MCP_DEBUG_IMAGE)")
+	command := fs.String("agent_command", "", "agent command with {pid}, {seconds}, {output} (default: perf record + perf_to_profile)")
+	pid := fs.String("pid", "1", "process to sample, as seen from the target container")
+	outDir := fs.String("out", cliConfig.Workspace, "output directory; the profile goes to <out>/<pod>")
+	service := fs.String("service", "", "file prefix (default: workload name, app label, or pod)")
+	seconds := fs.Int("seconds", 30, "sampling duration in seconds")
+	yes := fs.Bool("yes", false, "skip the confirmation prompt")
+	dryRun := fs.Bool("dry_run", false, "print the kubectl commands without running them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	targets := 0
+	for _, value := range []string{*pod, *selector, *workload} {
+		if value != "" {
+			targets++
+		}
+	}
+	if targets != 1 || *outDir == "" {
+		return errors.New("k8s debug-capture requires --out and one of --pod, --selector, or --workload")
+	}
+	if *workload != "" {
+		parsed, _, err := k8s.ParseTarget(*workload)
+		if err != nil {
+			return err
+		}
+		if parsed == "" {
+			return fmt.Errorf("--workload %q must be kind/name; use --selector for labels", *workload)
+		}
+		*workload = parsed
+	}
+	params := k8s.DebugParams{
+		KubeContext: *kubeContext,
+		Namespace:   *namespace,
+		Pod:         *pod,
+		Selector:    *selector,
+		Workload:    *workload,
+		Container:   *container,
+		Image:       *image,
+		Command:     *command,
+		PID:         *pid,
+		Seconds:     *seconds,
+		OutDir:      *outDir,
+		Service:     *service,
+	}
+
+	commands, err := k8s.DebugCommands(params)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		return render(out, view{
+			payload: jsonOutput{"dry_run": true, "privileged": true, "privileges": k8s.DebugPrivileges(), "commands": commands},
+			table:   func() tableView { return linesTable(strings.Join(commands, "\n")) },
+			text: func(w io.Writer) error {
+				_, err := fmt.Fprintln(w, strings.Join(commands, "\n"))
+				return err
+			},
+		})
+	}
+	if !*yes {
+		if !isTerminal(os.Stdin) {
+			return errors.New("k8s debug-capture injects a privileged ephemeral container; pass --yes to run without a terminal")
+		}
+		fmt.Fprintln(os.Stderr, "PRIVILEGED: this capture")
+		for _, privilege := range k8s.DebugPrivileges() {
+			fmt.Fprintf(os.Stderr, "  - %s\n", privilege)
+		}
+		fmt.Fprintln(os.Stderr, "It will run:")
+		for i, command := range commands {
+			fmt.Fprintf(os.Stderr, "%2d. %s\n", i+1, command)
+		}
+		fmt.Fprint(os.Stderr, "Proceed? [y/N] ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+			return errors.New("aborted")
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	result, err := k8s.CaptureWithDebugContainer(ctx, params)
+	if err != nil {
+		return err
+	}
+	return render(out, view{
+		payload: jsonOutput{"privileged": true, "result": result},
+		table:   func() tableView { return objectsTable([]datadog.ProfileFile{result.File}, "type", "path", "bytes") },
+	})
+}
+
+// registerFleet registers each merged fleet profile as a handle, keyed by
+// profile type. Registration failures are left out; the paths remain in
+// the result.
+func registerFleet(result k8s.CaptureResult) map[string]string {
+	handles := map[string]string{}
+	storePath := profiles.StorePath()
+	if storePath == "" {
+		return handles
+	}
+	registry, err := profiles.OpenRegistry(storePath)
+	if err != nil {
+		return handles
+	}
+	service := ""
+	if len(result.Bundles) > 0 {
+		service = result.Bundles[0].Service
+	}
+	for _, fleet := range result.Fleet {
+		handle, err := registry.Register(profiles.Metadata{Service: service, Env: result.Namespace, Type: fleet.Type, Path: fleet.Path})
+		if err == nil {
+			handles[fleet.Type] = handle
+		}
+	}
+	return handles
+}
@@ -8,8 +8,15 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+	"github.com/arreyder/pprof-mcp/internal/completion"
+	"github.com/arreyder/pprof-mcp/internal/config"
+	"github.com/arreyder/pprof-mcp/internal/d2"
 	"github.com/arreyder/pprof-mcp/internal/datadog"
 	"github.com/arreyder/pprof-mcp/internal/pprof"
 	"github.com/arreyder/pprof-mcp/internal/services"
@@ -17,19 +24,66 @@ import (
 
 type jsonOutput map[string]any
 
+// Exit codes for gate commands (ci check, baseline check): a regression is
+// distinguishable from a broken invocation so pipelines can tell "regressed"
+// from "could not check".
+const (
+	exitRegressed  = 1
+	exitCheckError = 2
+)
+
+// exitError carries a specific process exit code out of run.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+
+func (e *exitError) Unwrap() error { return e.err }
+
+// cliConfig holds defaults from ~/.config/pprof-mcp/config.yaml.
+var cliConfig = &config.Config{}
+
 func main() {
-	if err := run(os.Args, os.Stdout); err != nil {
+	entry := startHistory(os.Args[1:])
+	err := run(os.Args, os.Stdout)
+	recordHistory(entry, err)
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
+		var exit *exitError
+		if errors.As(err, &exit) {
+			os.Exit(exit.code)
+		}
 		os.Exit(1)
 	}
 }
 
 func run(args []string, out io.Writer) error {
+	if len(args) >= 2 && args[1] != completeCommand {
+		rest, format, err := extractOutputFlag(args[1:])
+		if err != nil {
+			return err
+		}
+		args = append(args[:1:1], rest...)
+		cliOutput = format
+	}
 	if len(args) < 2 {
-		return errors.New("usage: profctl <download|pprof|repo|datadog>")
+		return errors.New("usage: profctl <analyze|download|pprof|repo|datadog|tui|watch|config|serve|baseline|ci|d2|k8s|open|run|batch|history|export|clean|completion>")
 	}
 
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	cfg.ApplyEnv()
+	cliConfig = cfg
+	d2.SetPlanWorkspace(cfg.Workspace)
+	cmdrun.SetTimeouts(cfg.Timeouts.Commands)
+
 	switch args[1] {
+	case "analyze":
+		return runAnalyze(args[2:], out)
 	case "download":
 		return runDownload(args[2:], out)
 	case "pprof":
@@ -38,40 +92,71 @@ func run(args []string, out io.Writer) error {
 		return runRepo(args[2:], out)
 	case "datadog":
 		return runDatadog(args[2:], out)
+	case "tui":
+		return runTUI(args[2:], out)
+	case "watch":
+		return runWatch(args[2:], out)
+	case "config":
+		return runConfig(args[2:], out)
+	case "serve":
+		return runServe(args[2:], out)
+	case "d2":
+		return runD2(args[2:], out)
+	case "k8s":
+		return runK8s(args[2:], out)
+	case "baseline":
+		return runBaseline(args[2:], out)
+	case "ci":
+		return runCI(args[2:], out)
+	case "open":
+		return runOpen(args[2:], out)
+	case "run":
+		return runLocal(args[2:], out)
+	case "batch":
+		return runBatch(args[2:], out)
+	case "history":
+		return runHistory(args[2:], out)
+	case "export":
+		return runExport(args[2:], out)
+	case "clean":
+		return runClean(args[2:], out)
+	case "completion":
+		return runCompletion(args[2:], out)
+	case completeCommand:
+		return runComplete(args[2:], out)
 	default:
 		return fmt.Errorf("unknown command: %s", args[1])
 	}
 }
 
 func runDownload(args []string, out io.Writer) error {
-	fs := flag.NewFlagSet("download", flag.ContinueOnError)
-	fs.SetOutput(io.Discard)
+	fs := newFlagSet("download")
 	service := fs.String("service", "", "Datadog service name")
 	env := fs.String("env", "", "Datadog environment")
-	outDir := fs.String("out", "", "output directory for profiles")
+	outDir := fs.String("out", cliConfig.Workspace, "output directory for profiles")
 	ddSite := fs.String("dd_site", "", "Datadog site, defaults to DD_SITE or us3.datadoghq.com")
 	hours := fs.Int("hours", 72, "time window in hours")
 	profileID := fs.String("profile_id", "", "Datadog profile id (optional)")
 	eventID := fs.String("event_id", "", "Datadog event id (optional)")
+	count := fs.Int("count", 1, "download the last N bundles, each into <out>/<profile_id>")
+	parallel := fs.Int("parallel", 4, "concurrent downloads with --count")
+	progressMode := fs.String("progress", "auto", "progress on stderr: auto (live on a terminal)|on|off")
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
+	applyPreset(fs)
 
 	if *service == "" || *env == "" || *outDir == "" {
 		return errors.New("download requires --service, --env, and --out")
 	}
-
-	result, err := datadog.DownloadLatestBundle(context.Background(), datadog.DownloadParams{
-		Service:   *service,
-		Env:       *env,
-		OutDir:    *outDir,
-		Site:      *ddSite,
-		Hours:     *hours,
-		ProfileID: *profileID,
-		EventID:   *eventID,
-	})
-	if err != nil {
-		return err
+	if *count < 1 {
+		return errors.New("--count must be at least 1")
+	}
+	if *count > 1 && (*profileID != "" || *eventID != "") {
+		return errors.New("--count cannot be combined with --profile_id/--event_id")
+	}
+	if *progressMode != "auto" && *progressMode != "on" && *progressMode != "off" {
+		return fmt.Errorf("unknown --progress %q (want auto, on, or off)", *progressMode)
 	}
 
 	cmdParts := []string{
@@ -90,16 +175,88 @@ func runDownload(args []string, out io.Writer) error {
 	if *ddSite != "" {
 		cmdParts = append(cmdParts, "--dd_site", *ddSite)
 	}
+	if *count > 1 {
+		cmdParts = append(cmdParts, "--count", strconv.Itoa(*count), "--parallel", strconv.Itoa(*parallel))
+	}
+
+	var progress *downloadProgress
+	report := func(datadog.BatchProgress) {}
+	if *progressMode != "off" {
+		progress = newDownloadProgress(os.Stderr, *progressMode)
+		report = progress.update
+	}
+
+	if *count > 1 {
+		result, err := datadog.DownloadBundles(context.Background(), datadog.BatchDownloadParams{
+			Service:  *service,
+			Env:      *env,
+			OutDir:   *outDir,
+			Site:     *ddSite,
+			Hours:    *hours,
+			Count:    *count,
+			Parallel: *parallel,
+			Progress: report,
+		})
+		if progress != nil {
+			progress.finish()
+		}
+		if err != nil {
+			return err
+		}
+		payload := jsonOutput{
+			"command": cmdrun.Join(cmdParts...),
+			"result":  result,
+		}
+		return render(out, view{
+			payload: payload,
+			table:   func() tableView { return objectsTable(result.Bundles, "profile_id", "timestamp", "version") },
+		})
+	}
+
+	state := datadog.BatchProgress{ProfileID: *profileID, State: "downloading", Total: -1}
+	ctx := datadog.WithDownloadProgress(context.Background(), func(p datadog.DownloadProgress) {
+		state.Bytes, state.Total, state.Retries = p.Bytes, p.Total, p.Retries
+		state.State = "downloading"
+		if p.RetryStatus != 0 {
+			state.State = "retrying"
+		}
+		report(state)
+	})
+	result, err := datadog.DownloadLatestBundle(ctx, datadog.DownloadParams{
+		Service:   *service,
+		Env:       *env,
+		OutDir:    *outDir,
+		Site:      *ddSite,
+		Hours:     *hours,
+		ProfileID: *profileID,
+		EventID:   *eventID,
+	})
+	if err != nil {
+		state.State, state.Err = "failed", err
+	} else {
+		state.ProfileID, state.State, state.Files = result.ProfileID, "done", len(result.Files)
+	}
+	report(state)
+	if progress != nil {
+		progress.finish()
+	}
+	if err != nil {
+		return err
+	}
+
 	payload := jsonOutput{
-		"command": shellJoin(cmdParts),
+		"command": cmdrun.Join(cmdParts...),
 		"result":  result,
 	}
-	return writeJSON(out, payload)
+	return render(out, view{
+		payload: payload,
+		table:   func() tableView { return objectsTable(result.Files, "type", "path", "bytes") },
+	})
 }
 
 func runPprof(args []string, out io.Writer) error {
 	if len(args) < 1 {
-		return errors.New("usage: profctl pprof <top|peek|list|traces_head|diff_top|meta|storylines>")
+		return errors.New("usage: profctl pprof <top|peek|list|traces_head|diff_top|meta|validate|symbolization|storylines|tags|merge|flame|callgraph|resolve_binary|buildinfo|coverage>")
 	}
 
 	switch args[0] {
@@ -115,16 +272,33 @@ func runPprof(args []string, out io.Writer) error {
 		return runPprofDiffTop(args[1:], out)
 	case "meta":
 		return runPprofMeta(args[1:], out)
+	case "validate":
+		return runPprofValidate(args[1:], out)
+	case "symbolization":
+		return runPprofSymbolization(args[1:], out)
 	case "storylines":
 		return runPprofStorylines(args[1:], out)
+	case "merge":
+		return runPprofMerge(args[1:], out)
+	case "tags":
+		return runPprofTags(args[1:], out)
+	case "flame":
+		return runPprofFlame(args[1:], out)
+	case "callgraph":
+		return runPprofCallgraph(args[1:], out)
+	case "resolve_binary":
+		return runPprofResolveBinary(args[1:], out)
+	case "buildinfo":
+		return runPprofBuildInfo(args[1:], out)
+	case "coverage":
+		return runPprofCoverage(args[1:], out)
 	default:
 		return fmt.Errorf("unknown pprof command: %s", args[0])
 	}
 }
 
 func runPprofTop(args []string, out io.Writer) error {
-	fs := flag.NewFlagSet("pprof top", flag.ContinueOnError)
-	fs.SetOutput(io.Discard)
+	fs := newFlagSet("pprof top")
 	profile := fs.String("profile", "", "path to .pprof profile")
 	binary := fs.String("binary", "", "path to binary (optional)")
 	cum := fs.Bool("cum", false, "use cumulative time")
@@ -155,12 +329,16 @@ func runPprofTop(args []string, out io.Writer) error {
 		"rows":    result.Rows,
 		"summary": result.Summary,
 	}
-	return writeJSON(out, payload)
+	return render(out, view{
+		payload: payload,
+		table: func() tableView {
+			return objectsTable(result.Rows, "flat", "flat_pct", "sum_pct", "cum", "cum_pct", "name")
+		},
+	})
 }
 
 func runPprofPeek(args []string, out io.Writer) error {
-	fs := flag.NewFlagSet("pprof peek", flag.ContinueOnError)
-	fs.SetOutput(io.Discard)
+	fs := newFlagSet("pprof peek")
 	profile := fs.String("profile", "", "path to .pprof profile")
 	binary := fs.String("binary", "", "path to binary (optional)")
 	regex := fs.String("regex", "", "regex or function to peek")
@@ -181,53 +359,72 @@ func runPprofPeek(args []string, out io.Writer) error {
 		"command": result.Command,
 		"raw":     result.Raw,
 	}
-	return writeJSON(out, payload)
+	return render(out, view{payload: payload, table: func() tableView { return linesTable(result.Raw) }})
 }
 
 func runPprofList(args []string, out io.Writer) error {
-	fs := flag.NewFlagSet("pprof list", flag.ContinueOnError)
-	fs.SetOutput(io.Discard)
+	fs := newFlagSet("pprof list")
 	profile := fs.String("profile", "", "path to .pprof profile")
 	binary := fs.String("binary", "", "path to binary (optional)")
 	function := fs.String("function", "", "function or regex to list")
 	repoRoot := fs.String("repo_root", ".", "repo root for source path")
-	trimPath := fs.String("trim_path", "/xsrc", "trim path for sources")
+	trimPath := fs.String("trim_path", cliConfig.TrimPathOr(""), "trim path for sources (default: inferred from the profile's paths and repo_root)")
+	downloadModules := fs.Bool("download_modules", false, "go mod download module versions missing from the module cache")
+	snippetFormat := fs.String("snippet_format", "text", "text, or html to print the listing as a highlighted HTML fragment")
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
 
 	result, err := pprof.RunList(context.Background(), pprof.ListParams{
-		Profile:  *profile,
-		Binary:   *binary,
-		Function: *function,
-		RepoRoot: *repoRoot,
-		TrimPath: *trimPath,
+		Profile:         *profile,
+		Binary:          *binary,
+		Function:        *function,
+		RepoRoot:        *repoRoot,
+		TrimPath:        *trimPath,
+		DownloadModules: *downloadModules,
+		SnippetFormat:   *snippetFormat,
 	})
 	if err != nil {
 		return err
 	}
+	for _, warning := range result.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+	}
 
 	payload := jsonOutput{
-		"command": result.Command,
-		"raw":     result.Raw,
+		"command":        result.Command,
+		"raw":            result.Raw,
+		"module_sources": result.ModuleSources,
+	}
+	if result.TrimPathInference != nil {
+		payload["trim_path_inference"] = result.TrimPathInference
+	}
+	v := view{payload: payload, table: func() tableView { return linesTable(result.Raw) }}
+	if result.HTML != "" {
+		payload["html"] = result.HTML
+		v.text = func(w io.Writer) error {
+			_, err := io.WriteString(w, result.HTML)
+			return err
+		}
 	}
-	return writeJSON(out, payload)
+	return render(out, v)
 }
 
 func runPprofTracesHead(args []string, out io.Writer) error {
-	fs := flag.NewFlagSet("pprof traces_head", flag.ContinueOnError)
-	fs.SetOutput(io.Discard)
+	fs := newFlagSet("pprof traces_head")
 	profile := fs.String("profile", "", "path to .pprof profile")
 	binary := fs.String("binary", "", "path to binary (optional)")
 	lines := fs.Int("lines", 200, "number of trace lines to keep")
+	strategy := fs.String("truncate_strategy", "head", "which lines to keep: head, tail, head_tail")
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
 
 	result, err := pprof.RunTracesHead(context.Background(), pprof.TracesParams{
-		Profile: *profile,
-		Binary:  *binary,
-		Lines:   *lines,
+		Profile:  *profile,
+		Binary:   *binary,
+		Lines:    *lines,
+		Strategy: *strategy,
 	})
 	if err != nil {
 		return err
@@ -239,12 +436,11 @@ func runPprofTracesHead(args []string, out io.Writer) error {
 		"total_lines": result.TotalLines,
 		"truncated":   result.Truncated,
 	}
-	return writeJSON(out, payload)
+	return render(out, view{payload: payload, table: func() tableView { return linesTable(result.Raw) }})
 }
 
 func runPprofDiffTop(args []string, out io.Writer) error {
-	fs := flag.NewFlagSet("pprof diff_top", flag.ContinueOnError)
-	fs.SetOutput(io.Discard)
+	fs := newFlagSet("pprof diff_top")
 	before := fs.String("before", "", "path to before .pprof profile")
 	after := fs.String("after", "", "path to after .pprof profile")
 	binary := fs.String("binary", "", "path to binary (optional)")
@@ -277,12 +473,11 @@ func runPprofDiffTop(args []string, out io.Writer) error {
 		"after":    result.After,
 		"deltas":   result.Deltas,
 	}
-	return writeJSON(out, payload)
+	return render(out, view{payload: payload, table: func() tableView { return objectsTable(result.Deltas) }})
 }
 
 func runPprofMeta(args []string, out io.Writer) error {
-	fs := flag.NewFlagSet("pprof meta", flag.ContinueOnError)
-	fs.SetOutput(io.Discard)
+	fs := newFlagSet("pprof meta")
 	profilePath := fs.String("profile", "", "path to .pprof profile")
 	jsonOut := fs.Bool("json", false, "output JSON")
 	if err := fs.Parse(args); err != nil {
@@ -294,27 +489,84 @@ func runPprofMeta(args []string, out io.Writer) error {
 		return err
 	}
 
-	if !*jsonOut {
-		_, err := fmt.Fprintf(out, "profile: %s\nkind: %s\n", meta.ProfilePath, meta.DetectedKind)
+	payload := jsonOutput{
+		"command": pprof.FormatMetaCommand(*profilePath),
+		"result":  meta,
+	}
+	return render(out, view{
+		payload:  payload,
+		table:    func() tableView { return tableFromValue(meta) },
+		jsonFlag: *jsonOut,
+		text: func(w io.Writer) error {
+			_, err := fmt.Fprintf(w, "profile: %s\nkind: %s\n", meta.ProfilePath, meta.DetectedKind)
+			return err
+		},
+	})
+}
+
+func runPprofValidate(args []string, out io.Writer) error {
+	fs := newFlagSet("pprof validate")
+	profilePath := fs.String("profile", "", "path to .pprof profile")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	result, err := pprof.RunValidate(*profilePath)
+	if err != nil {
 		return err
 	}
 
 	payload := jsonOutput{
-		"command": pprof.FormatMetaCommand(*profilePath),
-		"result":  meta,
+		"command": pprof.FormatValidateCommand(*profilePath),
+		"result":  result,
+	}
+	if err := render(out, view{
+		payload: payload,
+		table:   func() tableView { return objectsTable(result.Problems, "severity", "code", "message") },
+	}); err != nil {
+		return err
 	}
-	return writeJSON(out, payload)
+	if !result.Valid {
+		return fmt.Errorf("%s is not a usable profile", *profilePath)
+	}
+	return nil
+}
+
+func runPprofSymbolization(args []string, out io.Writer) error {
+	fs := newFlagSet("pprof symbolization")
+	profilePath := fs.String("profile", "", "path to .pprof profile")
+	sampleIndex := fs.String("sample_index", "", "sample type to weight frames by")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	result, err := pprof.RunSymbolization(*profilePath, *sampleIndex)
+	if err != nil {
+		return err
+	}
+
+	payload := jsonOutput{
+		"command": pprof.FormatSymbolizationCommand(*profilePath, *sampleIndex),
+		"result":  result,
+	}
+	return render(out, view{
+		payload: payload,
+		table: func() tableView {
+			return objectsTable(result.Mappings, "file", "sample_value", "raw_value", "named_fraction", "top_raw_addresses")
+		},
+	})
 }
 
 func runPprofStorylines(args []string, out io.Writer) error {
-	fs := flag.NewFlagSet("pprof storylines", flag.ContinueOnError)
-	fs.SetOutput(io.Discard)
+	fs := newFlagSet("pprof storylines")
 	profilePath := fs.String("profile", "", "path to cpu .pprof profile")
 	n := fs.Int("n", 4, "number of storylines (2-6)")
 	focus := fs.String("focus", "", "focus regex")
 	ignore := fs.String("ignore", "", "ignore regex")
 	repoRoot := fs.String("repo_root", ".", "repo root for source path")
-	trimPath := fs.String("trim_path", "/xsrc", "trim path for sources")
+	trimPath := fs.String("trim_path", cliConfig.TrimPathOr(""), "trim path for sources (default: inferred from the profile's paths and repo_root)")
+	format := fs.String("format", "", "json, or markdown for call chains and source snippets")
+	revision := fs.String("revision", "", "profiled commit that call chain permalinks point at (default: repo_root's HEAD)")
 	jsonOut := fs.Bool("json", false, "output JSON")
 	var repoPrefixes multiFlag
 	fs.Var(&repoPrefixes, "repo_prefix", "repo prefix to identify app-owned frames")
@@ -322,6 +574,17 @@ func runPprofStorylines(args []string, out io.Writer) error {
 		return err
 	}
 
+	if len(repoPrefixes) == 0 {
+		repoPrefixes = cliConfig.RepoPrefixes
+	}
+	switch *format {
+	case "", "markdown":
+	case "json":
+		*jsonOut = true
+	default:
+		return fmt.Errorf("unknown --format %q (want json or markdown)", *format)
+	}
+
 	result, err := pprof.RunStorylines(context.Background(), pprof.StorylinesParams{
 		Profile:      *profilePath,
 		N:            *n,
@@ -330,32 +593,103 @@ func runPprofStorylines(args []string, out io.Writer) error {
 		RepoPrefixes: repoPrefixes,
 		RepoRoot:     *repoRoot,
 		TrimPath:     *trimPath,
+		Format:       *format,
+		Revision:     *revision,
 	})
 	if err != nil {
 		return err
 	}
 
-	if !*jsonOut {
-		for _, storyline := range result.Storylines {
-			fmt.Fprintf(out, "- %s (cum=%s)\n", storyline.LeafHotspot, storyline.Cum)
-		}
-		return nil
+	payload := jsonOutput{
+		"command": result.Command,
+		"result":  result,
+	}
+	return render(out, view{
+		payload: payload,
+		table: func() tableView {
+			return objectsTable(result.Storylines, "cum", "cum_pct", "leaf_hotspot", "first_app_frame")
+		},
+		jsonFlag: *jsonOut,
+		text: func(w io.Writer) error {
+			if result.Markdown != "" {
+				_, err := io.WriteString(w, result.Markdown)
+				return err
+			}
+			for _, storyline := range result.Storylines {
+				fmt.Fprintf(w, "- %s (cum=%s)\n", storyline.LeafHotspot, storyline.Cum)
+			}
+			return nil
+		},
+	})
+}
+
+func runPprofCoverage(args []string, out io.Writer) error {
+	fs := newFlagSet("pprof coverage")
+	profilePath := fs.String("profile", "", "path to .pprof profile")
+	repoRoot := fs.String("repo_root", ".", "repo root whose tests cover the profiled code")
+	coverage := fs.String("coverage", "", "coverprofile to read (default: run go test -coverprofile in repo_root)")
+	packages := fs.String("packages", "", "comma-separated packages go test covers (default: ./...)")
+	trimPath := fs.String("trim_path", cliConfig.TrimPathOr(""), "trim path for sources (default: inferred from the profile's paths and repo_root)")
+	sampleIndex := fs.String("sample_index", "", "pprof sample index")
+	limit := fs.Int("limit", 20, "hot functions to report")
+	minPct := fs.Float64("min_pct", 1, "minimum cum% for a function to count as hot")
+	lowCoverage := fs.Float64("low_coverage", 50, "statement coverage % below which a function is low coverage")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *profilePath == "" {
+		return fmt.Errorf("--profile is required")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	result, err := pprof.RunCoverage(ctx, pprof.CoverageParams{
+		Profile:     *profilePath,
+		RepoRoot:    *repoRoot,
+		Coverage:    *coverage,
+		Packages:    splitList(*packages),
+		TrimPath:    *trimPath,
+		SampleIndex: *sampleIndex,
+		Limit:       *limit,
+		MinPct:      *minPct,
+		LowCoverage: *lowCoverage,
+	})
+	if err != nil {
+		return err
+	}
+	for _, warning := range result.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
 	}
 
 	payload := jsonOutput{
-		"command": result.Command,
+		"command": cmdrun.Join("profctl", "pprof", "coverage", "--profile", *profilePath, "--repo_root", *repoRoot),
 		"result":  result,
 	}
-	return writeJSON(out, payload)
+	return render(out, view{
+		payload: payload,
+		table: func() tableView {
+			return objectsTable(result.Hotspots, "function", "cum_pct", "coverage_pct", "status", "risk")
+		},
+		text: func(w io.Writer) error {
+			fmt.Fprintf(w, "untested: %.1f%% flat, low coverage: %.1f%% flat\n", result.UntestedFlatPct, result.LowFlatPct)
+			for _, hotspot := range result.Hotspots {
+				fmt.Fprintf(w, "- %s %s:%d cum=%.1f%% coverage=%.1f%% (%s) risk=%.1f\n",
+					hotspot.Function, hotspot.File, hotspot.StartLine, hotspot.CumPct, hotspot.CoveragePct, hotspot.Status, hotspot.Risk)
+			}
+			return nil
+		},
+	})
 }
 
 func runRepo(args []string, out io.Writer) error {
 	if len(args) < 2 || args[0] != "services" || args[1] != "discover" {
 		return errors.New("usage: profctl repo services discover --repo_root <path>")
 	}
-	fs := flag.NewFlagSet("repo services discover", flag.ContinueOnError)
-	fs.SetOutput(io.Discard)
-	repoRoot := fs.String("repo_root", ".", "path to repo root containing cmd/")
+	fs := newFlagSet("repo services discover")
+	repoRoot := fs.String("repo_root", ".", "repository root to scan")
+	env := fs.String("env", "", "only map to Datadog services seen in envs with this prefix")
+	refresh := fs.Bool("refresh_datadog", false, "fetch the Datadog services with profiling instead of using the cache")
+	ddSite := fs.String("dd_site", "", "Datadog site, defaults to DD_SITE or us3.datadoghq.com")
 	if err := fs.Parse(args[2:]); err != nil {
 		return err
 	}
@@ -364,12 +698,66 @@ func runRepo(args []string, out io.Writer) error {
 	if err != nil {
 		return err
 	}
+	known := completion.DatadogServices(*env)
+	if *refresh {
+		listed, err := datadog.ListServicesWithProfiling(context.Background(), datadog.ListServicesParams{Env: *env, Site: *ddSite, Minutes: 15})
+		if err != nil {
+			return err
+		}
+		known = listed.Services
+		if err := datadog.WriteServicesCacheFile(datadog.ServicesCacheFilePath(), known); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: services cache: %v\n", err)
+		}
+	}
+	if len(known) == 0 {
+		fmt.Fprintln(os.Stderr, "warning: no Datadog services cached; only config mappings were applied (--refresh_datadog fetches them)")
+	}
+	services.MapDatadog(results, cliConfig, known)
 
 	payload := jsonOutput{
-		"command":  shellJoin([]string{"profctl", "repo", "services", "discover", "--repo_root", *repoRoot}),
+		"command":  cmdrun.Join("profctl", "repo", "services", "discover", "--repo_root", *repoRoot),
 		"services": results,
 	}
-	return writeJSON(out, payload)
+	return render(out, view{
+		payload: payload,
+		table: func() tableView {
+			rows := make([]map[string]any, 0, len(results))
+			for _, service := range results {
+				row := map[string]any{"service": service.Service, "binary": service.Binary, "path": service.Path, "sources": strings.Join(service.Sources, ",")}
+				if service.Datadog != nil {
+					row["datadog"] = service.Datadog.Service
+					row["envs"] = strings.Join(service.Datadog.Envs, ",")
+				} else if len(service.DatadogCandidates) > 0 {
+					row["datadog"] = "? " + service.DatadogCandidates[0].Service
+				}
+				if service.Pprof != nil {
+					row["pprof"] = pprofSummary(service.Pprof)
+				}
+				if len(service.PprofPorts) > 0 {
+					port := service.PprofPorts[0]
+					row["declared_port"] = fmt.Sprintf("%d (%s %s)", port.Port, port.Source, port.File)
+				}
+				rows = append(rows, row)
+			}
+			return objectsTable(rows, "service", "binary", "path", "sources", "datadog", "envs", "pprof", "declared_port")
+		},
+	})
+}
+
+// pprofSummary condenses a discovered pprof endpoint: none, or its mux and
+// ports, with +rates when captures can set mutex and block rates
+func pprofSummary(info *services.PprofInfo) string {
+	if !info.Enabled {
+		return "none"
+	}
+	parts := []string{info.Mux}
+	for _, port := range info.Ports {
+		parts = append(parts, ":"+strconv.Itoa(port))
+	}
+	if info.RateEndpoint {
+		parts = append(parts, "+rates")
+	}
+	return strings.Join(parts, " ")
 }
 
 func runDatadog(args []string, out io.Writer) error {
@@ -387,8 +775,7 @@ func runDatadog(args []string, out io.Writer) error {
 }
 
 func runDatadogProfilesList(args []string, out io.Writer) error {
-	fs := flag.NewFlagSet("datadog profiles list", flag.ContinueOnError)
-	fs.SetOutput(io.Discard)
+	fs := newFlagSet("datadog profiles list")
 	service := fs.String("service", "", "Datadog service name")
 	env := fs.String("env", "", "Datadog environment")
 	from := fs.String("from", "", "ISO timestamp start")
@@ -400,6 +787,7 @@ func runDatadogProfilesList(args []string, out io.Writer) error {
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
+	applyPreset(fs)
 
 	result, err := datadog.ListProfiles(context.Background(), datadog.ListProfilesParams{
 		Service: *service,
@@ -431,22 +819,26 @@ func runDatadogProfilesList(args []string, out io.Writer) error {
 		cmdParts = append(cmdParts, "--site", *site)
 	}
 
-	if !*jsonOut {
-		_, err := fmt.Fprintln(out, datadog.FormatCandidatesTable(result.Candidates))
-		return err
-	}
-
 	payload := jsonOutput{
-		"command":    shellJoin(cmdParts),
+		"command":    cmdrun.Join(cmdParts...),
 		"result":     result,
 		"candidates": result.Candidates,
 	}
-	return writeJSON(out, payload)
+	return render(out, view{
+		payload: payload,
+		table: func() tableView {
+			return objectsTable(result.Candidates, "timestamp", "profile_id", "event_id", "version")
+		},
+		jsonFlag: *jsonOut,
+		text: func(w io.Writer) error {
+			_, err := fmt.Fprintln(w, datadog.FormatCandidatesTable(result.Candidates))
+			return err
+		},
+	})
 }
 
 func runDatadogProfilesPick(args []string, out io.Writer) error {
-	fs := flag.NewFlagSet("datadog profiles pick", flag.ContinueOnError)
-	fs.SetOutput(io.Discard)
+	fs := newFlagSet("datadog profiles pick")
 	service := fs.String("service", "", "Datadog service name")
 	env := fs.String("env", "", "Datadog environment")
 	from := fs.String("from", "", "ISO timestamp start")
@@ -461,6 +853,7 @@ func runDatadogProfilesPick(args []string, out io.Writer) error {
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
+	applyPreset(fs)
 
 	result, err := datadog.PickProfile(context.Background(), datadog.PickProfilesParams{
 		Service:  *service,
@@ -502,18 +895,71 @@ func runDatadogProfilesPick(args []string, out io.Writer) error {
 		cmdParts = append(cmdParts, "--index", fmt.Sprintf("%d", *index))
 	}
 
-	if !*jsonOut {
-		_, err := fmt.Fprintf(out, "profile_id=%s event_id=%s timestamp=%s reason=%s\n", result.Candidate.ProfileID, result.Candidate.EventID, result.Candidate.Timestamp, result.Reason)
-		return err
-	}
-
 	payload := jsonOutput{
-		"command":  shellJoin(cmdParts),
+		"command":  cmdrun.Join(cmdParts...),
 		"result":   result,
 		"profile":  result.Candidate,
 		"warnings": result.Warnings,
 	}
-	return writeJSON(out, payload)
+	return render(out, view{
+		payload: payload,
+		table: func() tableView {
+			return tableView{
+				columns: []string{"profile_id", "event_id", "timestamp", "reason"},
+				rows:    [][]string{{result.Candidate.ProfileID, result.Candidate.EventID, result.Candidate.Timestamp, result.Reason}},
+			}
+		},
+		jsonFlag: *jsonOut,
+		text: func(w io.Writer) error {
+			_, err := fmt.Fprintf(w, "profile_id=%s event_id=%s timestamp=%s reason=%s\n", result.Candidate.ProfileID, result.Candidate.EventID, result.Candidate.Timestamp, result.Reason)
+			return err
+		},
+	})
+}
+
+// applyPreset expands --env when it names an environment preset from the
+// config file. Flags given on the command line are never overridden.
+func applyPreset(fs *flag.FlagSet) {
+	envFlag := fs.Lookup("env")
+	if envFlag == nil {
+		return
+	}
+	preset, ok := cliConfig.Preset(envFlag.Value.String())
+	if !ok {
+		return
+	}
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	setDefault := func(name, value string) {
+		if value == "" || explicit[name] || fs.Lookup(name) == nil {
+			return
+		}
+		_ = fs.Set(name, value)
+	}
+	if preset.Env != "" {
+		_ = fs.Set("env", preset.Env)
+	}
+	setDefault("service", preset.Service)
+	setDefault("dd_site", preset.DDSite)
+	setDefault("site", preset.DDSite)
+	if preset.Hours > 0 {
+		setDefault("hours", strconv.Itoa(preset.Hours))
+	}
+	setDefault("host", preset.Host)
+}
+
+// lastFlagSet is the most recently created command flag set; shell completion
+// reads it to list a command's flags.
+var lastFlagSet *flag.FlagSet
+
+// newFlagSet creates a command's flag set. Errors are returned, not printed.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	lastFlagSet = fs
+	return fs
 }
 
 type multiFlag []string
@@ -527,26 +973,29 @@ func (m *multiFlag) Set(value string) error {
 	return nil
 }
 
-func shellJoin(parts []string) string {
-	quoted := make([]string, 0, len(parts))
-	for _, part := range parts {
-		quoted = append(quoted, shellQuote(part))
-	}
-	return strings.Join(quoted, " ")
+func writeJSON(out io.Writer, payload any) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(payload)
 }
 
-func shellQuote(s string) string {
-	if s == "" {
-		return "''"
+func writeJSONFile(path string, payload any) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
 	}
-	if strings.ContainsAny(s, " \t\n\"'\\$&;|<>[]{}()") {
-		return "'" + strings.ReplaceAll(s, "'", "'\\''") + "'"
+	if err := writeJSON(file, payload); err != nil {
+		file.Close()
+		return err
 	}
-	return s
+	return file.Close()
 }
 
-func writeJSON(out io.Writer, payload any) error {
-	encoder := json.NewEncoder(out)
-	encoder.SetIndent("", "  ")
-	return encoder.Encode(payload)
+// decodeInto round-trips value through JSON into target.
+func decodeInto(value any, target any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
 }
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+
+	"github.com/arreyder/pprof-mcp/internal/pprof"
+)
+
+// runPprofMerge merges profiles given as paths or globs, e.g.
+// `profctl pprof merge 'out/*_cpu.pprof' -o merged.pprof`. Globs are expanded
+// here so quoted patterns work without shell help.
+func runPprofMerge(args []string, out io.Writer) error {
+	fs := newFlagSet("pprof merge")
+	outputPath := fs.String("output_path", "", "path to write the merged profile")
+	fs.StringVar(outputPath, "o", "", "shorthand for --output_path")
+	binary := fs.String("binary", "", "path to binary (optional)")
+	sampleIndex := fs.String("sample_index", "", "sample type used for contributions (default: the profile's default, else the last)")
+	var patterns []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		patterns = append(patterns, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(patterns) == 0 || *outputPath == "" {
+		return errors.New("usage: profctl pprof merge <profile|glob>... -o <merged.pprof>")
+	}
+
+	inputs, err := expandProfileGlobs(patterns)
+	if err != nil {
+		return err
+	}
+	result, err := pprof.RunMerge(context.Background(), pprof.MergeParams{
+		Profiles:   inputs,
+		Binary:     *binary,
+		OutputPath: *outputPath,
+	})
+	if err != nil {
+		return err
+	}
+	contributions, warnings := pprof.MergeContributions(inputs, *sampleIndex)
+
+	payload := jsonOutput{
+		"command":       result.Command,
+		"output_path":   result.OutputPath,
+		"input_count":   result.InputCount,
+		"message":       result.Message,
+		"contributions": contributions,
+	}
+	if len(warnings) > 0 {
+		payload["warnings"] = warnings
+	}
+	return render(out, view{
+		payload: payload,
+		table: func() tableView {
+			return objectsTable(contributions, "profile", "samples", "type", "total", "pct")
+		},
+		text: func(w io.Writer) error {
+			fmt.Fprintln(w, result.Message)
+			for _, c := range contributions {
+				fmt.Fprintf(w, "  %6.2f%%  %8d samples  %s\n", c.Pct, c.Samples, c.Profile)
+			}
+			for _, warning := range warnings {
+				fmt.Fprintf(w, "  warning: %s\n", warning)
+			}
+			return nil
+		},
+	})
+}
+
+// expandProfileGlobs expands each pattern, keeping literal paths as given,
+// and drops duplicates.
+func expandProfileGlobs(patterns []string) ([]string, error) {
+	var inputs []string
+	seen := map[string]struct{}{}
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("bad glob %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no profiles match %q", pattern)
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			if _, ok := seen[match]; ok {
+				continue
+			}
+			seen[match] = struct{}{}
+			inputs = append(inputs, match)
+		}
+	}
+	return inputs, nil
+}
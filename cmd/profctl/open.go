@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+	"github.com/arreyder/pprof-mcp/internal/pprof"
+	"github.com/arreyder/pprof-mcp/internal/profiles"
+)
+
+// runOpen shows an artifact in the viewer that suits it: rendered graphs and
+// HTML in the browser, profiles in `go tool pprof -http`, text reports in
+// the pager. Handles come from the registry shared with the MCP server.
+func runOpen(args []string, out io.Writer) error {
+	fs := newFlagSet("open")
+	httpAddr := fs.String("http", "localhost:0", "address for go tool pprof -http")
+	binary := fs.String("binary", "", "path to binary for symbolization (profiles only)")
+	viewer := fs.String("viewer", "auto", "viewer: auto|browser|pprof|pager")
+	dryRun := fs.Bool("dry_run", false, "print the viewer command without running it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: profctl open [flags] <handle|path>")
+	}
+
+	path, err := resolveArtifact(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	kind := *viewer
+	if kind == "auto" {
+		kind = artifactViewer(path)
+	}
+
+	var command []string
+	switch kind {
+	case "browser":
+		if *dryRun {
+			return render(out, view{payload: jsonOutput{"dry_run": true, "viewer": kind, "path": path}})
+		}
+		return openInBrowser(path)
+	case "pprof":
+		pprofArgs := []string{"-http", *httpAddr}
+		if *binary != "" {
+			pprofArgs = append(pprofArgs, *binary)
+		}
+		command = pprof.ToolCommand(append(pprofArgs, path)...)
+	case "pager":
+		command = append(pagerCommand(), path)
+	default:
+		return fmt.Errorf("unknown --viewer %q (want auto, browser, pprof, or pager)", kind)
+	}
+
+	if *dryRun {
+		return render(out, view{
+			payload: jsonOutput{"dry_run": true, "viewer": kind, "path": path, "command": cmdrun.Join(command...)},
+			text: func(w io.Writer) error {
+				_, err := fmt.Fprintln(w, cmdrun.Join(command...))
+				return err
+			},
+		})
+	}
+	if kind == "pager" && !isTerminal(out) {
+		// Piped output gets the file itself rather than an interactive pager.
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(out, file)
+		return err
+	}
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, out, os.Stderr
+	return cmd.Run()
+}
+
+// resolveArtifact turns a handle into its path and checks the file exists.
+func resolveArtifact(value string) (string, error) {
+	path := value
+	if profiles.IsHandle(value) {
+		storePath := profiles.StorePath()
+		if storePath == "" {
+			return "", errors.New("handles are not shared (PPROF_MCP_HANDLES=off)")
+		}
+		registry, err := profiles.OpenRegistry(storePath)
+		if err != nil {
+			return "", err
+		}
+		meta, ok := registry.Resolve(value)
+		if !ok {
+			return "", fmt.Errorf("unknown profile handle %q", value)
+		}
+		path = meta.Path
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// artifactViewer picks a viewer from the extension, falling back to
+// sniffing for a profile so extensionless downloads still open in pprof.
+func artifactViewer(path string) string {
+	name := strings.ToLower(filepath.Base(path))
+	switch {
+	case strings.HasSuffix(name, ".svg"), strings.HasSuffix(name, ".html"), strings.HasSuffix(name, ".htm"),
+		strings.HasSuffix(name, ".png"), strings.HasSuffix(name, ".pdf"):
+		return "browser"
+	case strings.HasSuffix(name, ".pprof"), strings.HasSuffix(name, ".pb.gz"), strings.HasSuffix(name, ".prof"):
+		return "pprof"
+	case strings.HasSuffix(name, ".md"), strings.HasSuffix(name, ".txt"), strings.HasSuffix(name, ".json"),
+		strings.HasSuffix(name, ".yaml"), strings.HasSuffix(name, ".dot"), strings.HasSuffix(name, ".log"):
+		return "pager"
+	}
+	if file, err := os.Open(path); err == nil {
+		defer file.Close()
+		if _, err := profile.Parse(file); err == nil {
+			return "pprof"
+		}
+	}
+	return "pager"
+}
+
+func pagerCommand() []string {
+	if pager := strings.Fields(os.Getenv("PAGER")); len(pager) > 0 {
+		return pager
+	}
+	return []string{"less", "-R"}
+}
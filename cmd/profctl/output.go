@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats for the global --output flag. Without it each command keeps
+// its default: JSON, or text for commands that have a text view.
+const (
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+	outputTable = "table"
+	outputCSV   = "csv"
+)
+
+// maxCellWidth truncates long table cells such as raw pprof output.
+const maxCellWidth = 120
+
+// cliOutput is the --output format; empty means the command's default.
+var cliOutput string
+
+func parseOutputFormat(value string) (string, error) {
+	switch format := strings.ToLower(strings.TrimSpace(value)); format {
+	case outputJSON, outputYAML, outputTable, outputCSV:
+		return format, nil
+	case "yml":
+		return outputYAML, nil
+	default:
+		return "", fmt.Errorf("unknown --output %q (want json, yaml, table, or csv)", value)
+	}
+}
+
+// shortOutputPathCommands take -o as an output file, like go tool pprof; the
+// long --output still selects the format there.
+var shortOutputPathCommands = map[string]bool{"pprof merge": true, "export": true}
+
+// extractOutputFlag removes --output/-o from args wherever it appears, so
+// every subcommand accepts it without declaring it.
+func extractOutputFlag(args []string) ([]string, string, error) {
+	rest := make([]string, 0, len(args))
+	format := ""
+	shortIsPath := len(args) >= 1 && shortOutputPathCommands[args[0]] ||
+		len(args) >= 2 && shortOutputPathCommands[args[0]+" "+args[1]]
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name, value, hasValue := strings.Cut(arg, "=")
+		if name != "--output" && name != "-output" && (name != "-o" || shortIsPath) {
+			rest = append(rest, arg)
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return nil, "", fmt.Errorf("%s requires a value", name)
+			}
+			i++
+			value = args[i]
+		}
+		parsed, err := parseOutputFormat(value)
+		if err != nil {
+			return nil, "", err
+		}
+		format = parsed
+	}
+	return rest, format, nil
+}
+
+// view is a command's result. payload feeds json and yaml; table feeds table
+// and csv (derived from payload when nil); text is the default human output.
+type view struct {
+	payload any
+	table   func() tableView
+	text    func(io.Writer) error
+	// jsonFlag is a command's own --json flag, equivalent to --output json.
+	jsonFlag bool
+}
+
+type tableView struct {
+	columns []string
+	rows    [][]string
+}
+
+// render writes v in the --output format.
+func render(out io.Writer, v view) error {
+	collectHistoryOutputs(v.payload)
+	format := cliOutput
+	if format == "" {
+		if v.text != nil && !v.jsonFlag {
+			return v.text(out)
+		}
+		format = outputJSON
+	}
+	switch format {
+	case outputYAML:
+		return writeYAML(out, v.payload)
+	case outputTable, outputCSV:
+		var t tableView
+		if v.table != nil {
+			t = v.table()
+		} else {
+			t = tableFromValue(v.payload)
+		}
+		if format == outputCSV {
+			return writeCSV(out, t)
+		}
+		return writeTable(out, t)
+	default:
+		return writeJSON(out, v.payload)
+	}
+}
+
+func writeYAML(out io.Writer, payload any) error {
+	value, err := normalizeValue(payload)
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+func writeTable(out io.Writer, t tableView) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	header := make([]string, len(t.columns))
+	for i, column := range t.columns {
+		header[i] = strings.ToUpper(column)
+	}
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range t.rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = tableCell(cell)
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	return w.Flush()
+}
+
+func writeCSV(out io.Writer, t tableView) error {
+	w := csv.NewWriter(out)
+	if err := w.Write(t.columns); err != nil {
+		return err
+	}
+	if err := w.WriteAll(t.rows); err != nil {
+		return err
+	}
+	return w.Error()
+}
+
+func tableCell(value string) string {
+	value = strings.ReplaceAll(strings.ReplaceAll(value, "\t", " "), "\n", `\n`)
+	if len(value) > maxCellWidth {
+		return value[:maxCellWidth-3] + "..."
+	}
+	return value
+}
+
+// objectsTable renders items (a slice of structs or maps) with the given
+// json-named columns, or the sorted union of scalar fields when none given.
+func objectsTable(items any, columns ...string) tableView {
+	value, _ := normalizeValue(items)
+	var objects []map[string]any
+	if list, ok := value.([]any); ok {
+		for _, item := range list {
+			if object, ok := item.(map[string]any); ok {
+				objects = append(objects, object)
+			}
+		}
+	}
+	if len(columns) == 0 {
+		seen := map[string]bool{}
+		for _, object := range objects {
+			for key, value := range object {
+				if !seen[key] && isScalar(value) {
+					seen[key] = true
+					columns = append(columns, key)
+				}
+			}
+		}
+		sort.Strings(columns)
+	}
+	t := tableView{columns: columns}
+	for _, object := range objects {
+		row := make([]string, len(columns))
+		for i, column := range columns {
+			row[i] = formatCell(object[column])
+		}
+		t.rows = append(t.rows, row)
+	}
+	return t
+}
+
+// normalizeValue round-trips payload through JSON so keys follow the json
+// tags, keeping integers as int64 rather than float64.
+func normalizeValue(payload any) (any, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return convertNumbers(value), nil
+}
+
+func convertNumbers(value any) any {
+	switch typed := value.(type) {
+	case map[string]any:
+		for key, child := range typed {
+			typed[key] = convertNumbers(child)
+		}
+	case []any:
+		for i, child := range typed {
+			typed[i] = convertNumbers(child)
+		}
+	case json.Number:
+		if n, err := typed.Int64(); err == nil {
+			return n
+		}
+		f, _ := typed.Float64()
+		return f
+	}
+	return value
+}
+
+// linesTable renders raw text output one line per row.
+func linesTable(raw string) tableView {
+	t := tableView{columns: []string{"line"}}
+	for _, line := range strings.Split(strings.TrimRight(raw, "\n"), "\n") {
+		t.rows = append(t.rows, []string{line})
+	}
+	return t
+}
+
+// tableFromValue is the fallback table: a list of objects becomes rows, and
+// anything else is flattened into key/value pairs.
+func tableFromValue(payload any) tableView {
+	value, _ := normalizeValue(payload)
+	if list, ok := value.([]any); ok && len(list) > 0 {
+		if _, isObject := list[0].(map[string]any); isObject {
+			return objectsTable(list)
+		}
+	}
+	pairs := map[string]string{}
+	flattenValue("", value, pairs)
+	keys := make([]string, 0, len(pairs))
+	for key := range pairs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	t := tableView{columns: []string{"key", "value"}}
+	for _, key := range keys {
+		t.rows = append(t.rows, []string{key, pairs[key]})
+	}
+	return t
+}
+
+func flattenValue(prefix string, value any, pairs map[string]string) {
+	switch typed := value.(type) {
+	case map[string]any:
+		for key, child := range typed {
+			flattenValue(joinKey(prefix, key), child, pairs)
+		}
+	case []any:
+		if allScalar(typed) {
+			parts := make([]string, len(typed))
+			for i, item := range typed {
+				parts[i] = formatCell(item)
+			}
+			pairs[prefix] = strings.Join(parts, ",")
+			return
+		}
+		for i, child := range typed {
+			flattenValue(fmt.Sprintf("%s[%d]", prefix, i), child, pairs)
+		}
+	default:
+		pairs[prefix] = formatCell(typed)
+	}
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+func isScalar(value any) bool {
+	switch value.(type) {
+	case map[string]any, []any:
+		return false
+	}
+	return true
+}
+
+func allScalar(values []any) bool {
+	for _, value := range values {
+		if !isScalar(value) {
+			return false
+		}
+	}
+	return true
+}
+
+func formatCell(value any) string {
+	switch typed := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return typed
+	case []any, map[string]any:
+		data, _ := json.Marshal(typed)
+		return string(data)
+	default:
+		return fmt.Sprint(typed)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/datadog"
+)
+
+const progressBarWidth = 24
+
+// downloadProgress draws one line per profile on stderr. On a terminal the
+// lines are redrawn in place; otherwise only state changes are printed, so
+// logs stay readable.
+type downloadProgress struct {
+	mu       sync.Mutex
+	out      io.Writer
+	live     bool
+	states   []datadog.BatchProgress
+	drawn    int
+	lastDraw time.Time
+	// dirty is set when a throttled update has not been drawn yet.
+	dirty bool
+}
+
+func newDownloadProgress(out io.Writer, mode string) *downloadProgress {
+	live := false
+	switch mode {
+	case "on":
+		live = true
+	case "auto":
+		live = isTerminal(out)
+	}
+	return &downloadProgress{out: out, live: live}
+}
+
+// isTerminal reports whether w is a character device such as a TTY.
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// update records p and redraws. Byte updates are throttled; state changes
+// are always shown.
+func (d *downloadProgress) update(p datadog.BatchProgress) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for len(d.states) <= p.Index {
+		d.states = append(d.states, datadog.BatchProgress{Index: len(d.states), Total: -1})
+	}
+	previous := d.states[p.Index]
+	d.states[p.Index] = p
+
+	if !d.live {
+		if p.State != previous.State || p.Retries != previous.Retries {
+			fmt.Fprintln(d.out, progressLine(p))
+		}
+		return
+	}
+	if p.State == previous.State && time.Since(d.lastDraw) < 100*time.Millisecond {
+		d.dirty = true
+		return
+	}
+	d.draw()
+}
+
+// finish draws any update the throttle skipped.
+func (d *downloadProgress) finish() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.live && d.dirty {
+		d.draw()
+	}
+}
+
+func (d *downloadProgress) draw() {
+	var b strings.Builder
+	if d.drawn > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", d.drawn)
+	}
+	for _, state := range d.states {
+		b.WriteString("\x1b[2K")
+		b.WriteString(progressLine(state))
+		b.WriteByte('\n')
+	}
+	done, bytes := 0, int64(0)
+	for _, state := range d.states {
+		if state.State == "done" || state.State == "failed" {
+			done++
+		}
+		bytes += state.Bytes
+	}
+	fmt.Fprintf(&b, "\x1b[2K%d/%d profiles, %s received\n", done, len(d.states), formatBytes(bytes))
+	d.drawn = len(d.states) + 1
+	d.lastDraw = time.Now()
+	d.dirty = false
+	io.WriteString(d.out, b.String())
+}
+
+func progressLine(p datadog.BatchProgress) string {
+	id := p.ProfileID
+	if len(id) > 16 {
+		id = id[:16]
+	}
+	line := fmt.Sprintf("%-16s %-11s %s", id, p.State, progressBar(p.Bytes, p.Total))
+	switch {
+	case p.State == "done":
+		line += fmt.Sprintf(" %d files", p.Files)
+	case p.State == "failed" && p.Err != nil:
+		line += " " + p.Err.Error()
+	}
+	if p.Retries > 0 {
+		line += fmt.Sprintf(" (%d retries)", p.Retries)
+	}
+	return line
+}
+
+func progressBar(bytes, total int64) string {
+	if total <= 0 {
+		return fmt.Sprintf("[%s] %s", strings.Repeat(" ", progressBarWidth), formatBytes(bytes))
+	}
+	filled := int(float64(progressBarWidth) * float64(min(bytes, total)) / float64(total))
+	return fmt.Sprintf("[%s%s] %s/%s", strings.Repeat("#", filled), strings.Repeat(".", progressBarWidth-filled), formatBytes(bytes), formatBytes(total))
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1fGB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fKB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%dB", n)
+	}
+}
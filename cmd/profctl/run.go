@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+	"github.com/arreyder/pprof-mcp/internal/profiles"
+)
+
+// capturedProfile is one profile written by profctl run.
+type capturedProfile struct {
+	Type   string `json:"type"`
+	Path   string `json:"path"`
+	Bytes  int64  `json:"bytes"`
+	Handle string `json:"handle,omitempty"`
+	When   string `json:"when"`
+}
+
+// runLocal profiles a local command end to end. `go test` and compiled test
+// binaries get profiling flags injected; anything else must serve
+// net/http/pprof on --pprof_addr and is captured over HTTP while it runs.
+func runLocal(args []string, out io.Writer) error {
+	fs := newFlagSet("run")
+	outDir := fs.String("out", firstNonEmptyString(cliConfig.Workspace, "."), "output directory for profiles")
+	pprofAddr := fs.String("pprof_addr", "localhost:6060", "net/http/pprof address of the target (HTTP mode)")
+	seconds := fs.Int("seconds", 30, "CPU profile duration in seconds (HTTP mode)")
+	duration := fs.Duration("duration", 0, "stop the target after this long (HTTP mode; 0 runs until it exits or Ctrl-C)")
+	wait := fs.Duration("wait", 30*time.Second, "how long to wait for the pprof endpoint to come up")
+	register := fs.Bool("register", true, "register captured profiles as handles for profctl open and the MCP server")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	command := fs.Args()
+	if len(command) == 0 {
+		return errors.New("usage: profctl run [flags] -- <command> [args...]")
+	}
+	if err := os.MkdirAll(*outDir, 0o755); err != nil {
+		return err
+	}
+
+	name := strings.TrimSuffix(filepath.Base(command[0]), ".test")
+	if name == "go" {
+		// `go test` is named after the package directory it runs in.
+		if wd, err := os.Getwd(); err == nil {
+			name = filepath.Base(wd)
+		}
+	}
+	prefix := filepath.Join(*outDir, name)
+
+	var (
+		captured []capturedProfile
+		warnings []string
+		runErr   error
+	)
+	if injected, files, ok := injectProfileFlags(command, prefix); ok {
+		runErr = runForeground(injected)
+		for _, profileType := range []string{"cpu", "heap"} {
+			path := files[profileType]
+			info, err := os.Stat(path)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("%s profile not written", profileType))
+				continue
+			}
+			captured = append(captured, capturedProfile{Type: profileType, Path: path, Bytes: info.Size(), When: "exit"})
+		}
+	} else {
+		session := &httpCapture{addr: *pprofAddr, prefix: prefix, seconds: *seconds}
+		runErr = session.run(command, *duration, *wait)
+		captured, warnings = session.captured, session.warnings
+	}
+
+	if *register && len(captured) > 0 {
+		if storePath := profiles.StorePath(); storePath != "" {
+			registry, err := profiles.OpenRegistry(storePath)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("handles not registered: %v", err))
+			} else {
+				for i, c := range captured {
+					handle, err := registry.Register(profiles.Metadata{Service: name, Type: c.Type, Path: c.Path, Bytes: c.Bytes})
+					if err != nil {
+						warnings = append(warnings, fmt.Sprintf("register %s: %v", c.Path, err))
+						continue
+					}
+					captured[i].Handle = handle
+				}
+			}
+		}
+	}
+
+	payload := jsonOutput{"command": cmdrun.Join(command...), "profiles": captured}
+	if len(warnings) > 0 {
+		payload["warnings"] = warnings
+	}
+	if runErr != nil {
+		payload["exit"] = runErr.Error()
+	}
+	if err := render(out, view{
+		payload: payload,
+		table:   func() tableView { return objectsTable(captured, "type", "when", "bytes", "path", "handle") },
+		text: func(w io.Writer) error {
+			for _, c := range captured {
+				fmt.Fprintf(w, "%-10s %-9s %s %s\n", c.Type, c.When, c.Path, c.Handle)
+			}
+			for _, warning := range warnings {
+				fmt.Fprintf(w, "warning: %s\n", warning)
+			}
+			if len(captured) > 0 {
+				fmt.Fprintf(w, "\nnext: profctl pprof top --profile %s\n", captured[0].Path)
+			}
+			return nil
+		},
+	}); err != nil {
+		return err
+	}
+	if len(captured) == 0 {
+		return errors.New("no profiles captured")
+	}
+	return nil
+}
+
+// injectProfileFlags adds -cpuprofile/-memprofile to `go test` or the
+// -test.* equivalents to a compiled test binary.
+func injectProfileFlags(command []string, prefix string) ([]string, map[string]string, bool) {
+	stamp := time.Now().UTC().Format("20060102_150405")
+	files := map[string]string{
+		"cpu":  fmt.Sprintf("%s_%s_cpu.pprof", prefix, stamp),
+		"heap": fmt.Sprintf("%s_%s_heap.pprof", prefix, stamp),
+	}
+	switch {
+	case filepath.Base(command[0]) == "go" && len(command) > 1 && command[1] == "test":
+		injected := append([]string{"go", "test", "-cpuprofile", files["cpu"], "-memprofile", files["heap"]}, command[2:]...)
+		return injected, files, true
+	case strings.HasSuffix(command[0], ".test"):
+		injected := append([]string{command[0], "-test.cpuprofile", files["cpu"], "-test.memprofile", files["heap"]}, command[1:]...)
+		return injected, files, true
+	}
+	return nil, nil, false
+}
+
+func runForeground(command []string) error {
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stderr, os.Stderr
+	return cmd.Run()
+}
+
+// httpCapture drives a target that serves net/http/pprof: a CPU profile as
+// soon as the endpoint is up, heap and goroutine snapshots on demand (see
+// snapshotSignals) and again just before the target is stopped.
+type httpCapture struct {
+	addr    string
+	prefix  string
+	seconds int
+
+	mu       sync.Mutex
+	captured []capturedProfile
+	warnings []string
+}
+
+func (h *httpCapture) run(command []string, duration, wait time.Duration) error {
+	cmd := exec.Command(command[0], command[1:]...)
+	// The target's output goes to stderr so stdout stays the profctl result.
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stderr, os.Stderr
+	detachProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopSignals := make(chan os.Signal, 1)
+	signal.Notify(stopSignals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stopSignals)
+	snapshots := make(chan os.Signal, 1)
+	if len(snapshotSignals) > 0 {
+		signal.Notify(snapshots, snapshotSignals...)
+		defer signal.Stop(snapshots)
+	}
+
+	ready := make(chan error, 1)
+	go func() { ready <- h.waitForEndpoint(ctx, wait) }()
+	select {
+	case err := <-ready:
+		if err != nil {
+			h.warn(fmt.Sprintf("%v; does the program import net/http/pprof and listen on %s?", err, h.addr))
+			h.stop(cmd, exited)
+			return err
+		}
+	case err := <-exited:
+		h.warn("target exited before its pprof endpoint came up")
+		return err
+	case <-stopSignals:
+		h.stop(cmd, exited)
+		return errors.New("interrupted")
+	}
+	fmt.Fprintf(os.Stderr, "profctl: capturing from %s (%ds cpu); %s\n", h.addr, h.seconds, snapshotHint)
+
+	cpuDone := make(chan struct{})
+	go func() {
+		defer close(cpuDone)
+		h.fetch(ctx, "cpu", fmt.Sprintf("/debug/pprof/profile?seconds=%d", h.seconds), "start")
+	}()
+
+	var timeout <-chan time.Time
+	if duration > 0 {
+		timer := time.NewTimer(duration)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	for {
+		select {
+		case <-snapshots:
+			h.snapshot(ctx, "signal")
+		case err := <-exited:
+			// Nothing left to fetch from; report what was captured.
+			cancel()
+			<-cpuDone
+			return err
+		case <-timeout:
+			return h.finish(ctx, cancel, cpuDone, cmd, exited)
+		case <-stopSignals:
+			return h.finish(ctx, cancel, cpuDone, cmd, exited)
+		}
+	}
+}
+
+// finish lets an in-flight CPU profile complete, takes the final snapshot,
+// and stops the target.
+func (h *httpCapture) finish(ctx context.Context, cancel context.CancelFunc, cpuDone chan struct{}, cmd *exec.Cmd, exited chan error) error {
+	select {
+	case <-cpuDone:
+	default:
+		fmt.Fprintln(os.Stderr, "profctl: waiting for the CPU profile to finish (Ctrl-C again to abandon it)")
+		again := make(chan os.Signal, 1)
+		signal.Notify(again, os.Interrupt)
+		select {
+		case <-cpuDone:
+		case <-again:
+			cancel()
+			<-cpuDone
+		}
+		signal.Stop(again)
+	}
+	if ctx.Err() == nil {
+		h.snapshot(ctx, "exit")
+	}
+	cancel()
+	return h.stop(cmd, exited)
+}
+
+func (h *httpCapture) snapshot(ctx context.Context, when string) {
+	h.fetch(ctx, "heap", "/debug/pprof/heap", when)
+	h.fetch(ctx, "goroutines", "/debug/pprof/goroutine", when)
+}
+
+// stop interrupts the target and kills it if it has not exited in 10s.
+func (h *httpCapture) stop(cmd *exec.Cmd, exited chan error) error {
+	interruptProcess(cmd)
+	select {
+	case err := <-exited:
+		return err
+	case <-time.After(10 * time.Second):
+		cmd.Process.Kill()
+		return <-exited
+	}
+}
+
+func (h *httpCapture) waitForEndpoint(ctx context.Context, wait time.Duration) error {
+	deadline := time.Now().Add(wait)
+	url := "http://" + h.addr + "/debug/pprof/"
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("no pprof endpoint at %s after %s", url, wait)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+}
+
+func (h *httpCapture) fetch(ctx context.Context, profileType, path, when string) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+h.addr+path, nil)
+	if err != nil {
+		h.warn(fmt.Sprintf("%s: %v", profileType, err))
+		return
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		h.warn(fmt.Sprintf("%s profile: %v", profileType, err))
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		h.warn(fmt.Sprintf("%s profile: status %d: %s", profileType, resp.StatusCode, strings.TrimSpace(string(body))))
+		return
+	}
+
+	outPath := fmt.Sprintf("%s_%s_%s.pprof", h.prefix, time.Now().UTC().Format("20060102_150405"), profileType)
+	// Snapshots can land in the same second; never overwrite an earlier one.
+	for i := 2; ; i++ {
+		if _, err := os.Stat(outPath); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		outPath = fmt.Sprintf("%s_%s_%s_%d.pprof", h.prefix, time.Now().UTC().Format("20060102_150405"), profileType, i)
+	}
+	file, err := os.Create(outPath)
+	if err != nil {
+		h.warn(err.Error())
+		return
+	}
+	written, err := io.Copy(file, resp.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(outPath)
+		h.warn(fmt.Sprintf("%s profile: %v", profileType, err))
+		return
+	}
+	h.mu.Lock()
+	h.captured = append(h.captured, capturedProfile{Type: profileType, Path: outPath, Bytes: written, When: when})
+	h.mu.Unlock()
+	fmt.Fprintf(os.Stderr, "profctl: wrote %s\n", outPath)
+}
+
+func (h *httpCapture) warn(message string) {
+	h.mu.Lock()
+	h.warnings = append(h.warnings, message)
+	h.mu.Unlock()
+}
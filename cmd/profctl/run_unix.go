@@ -0,0 +1,24 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// snapshotSignals ask profctl run for an extra heap/goroutine snapshot.
+var snapshotSignals = []os.Signal{syscall.SIGUSR1}
+
+const snapshotHint = "kill -USR1 the profctl process for a heap/goroutine snapshot, Ctrl-C to stop"
+
+// detachProcessGroup keeps terminal Ctrl-C away from the target so profctl
+// can take the final snapshot before stopping it.
+func detachProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func interruptProcess(cmd *exec.Cmd) {
+	cmd.Process.Signal(os.Interrupt)
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// Windows has no spare signal, so snapshots happen only at exit.
+var snapshotSignals []os.Signal
+
+const snapshotHint = "Ctrl-C to stop"
+
+func detachProcessGroup(cmd *exec.Cmd) {}
+
+// interruptProcess kills the target: Windows cannot deliver os.Interrupt to
+// another process.
+func interruptProcess(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
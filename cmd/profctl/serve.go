@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/arreyder/pprof-mcp/internal/mcpserver"
+)
+
+// runServe runs the same MCP server as pprof-mcp-server, reading the same
+// config file, so a local profctl setup can be exposed to an agent.
+func runServe(args []string, out io.Writer) error {
+	fs := newFlagSet("serve")
+	transport := fs.String("transport", "stdio", "transport: stdio|http")
+	addr := fs.String("addr", ":8080", "listen address for --transport http")
+	framing := fs.String("framing", "", "stdio framing: auto|newline|content-length (default: PPROF_MCP_STDIO_FRAMING or auto)")
+	nameMode := fs.String("tool-name-mode", "", "tool name mode: default|codex")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	opts := mcpserver.Options{NameMode: *nameMode, Framing: *framing}
+	switch *transport {
+	case "stdio":
+	case "http":
+		opts.HTTPAddr = *addr
+	default:
+		return fmt.Errorf("unknown --transport %q (want stdio or http)", *transport)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return mcpserver.Run(ctx, opts)
+}
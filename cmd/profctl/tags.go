@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/arreyder/pprof-mcp/internal/pprof"
+	"github.com/arreyder/pprof-mcp/internal/pprofparse"
+)
+
+// runPprofTags shows the weight of each profile label value, e.g. CPU time
+// per tenant_id. With --tag_focus/--tag_ignore and no --tag_show it prints
+// the filtered top table instead.
+func runPprofTags(args []string, out io.Writer) error {
+	fs := newFlagSet("pprof tags")
+	profile := fs.String("profile", "", "path to .pprof profile")
+	binary := fs.String("binary", "", "path to binary (optional)")
+	tagShow := fs.String("tag_show", "", "only show values for this tag key (e.g. tenant_id)")
+	tagFocus := fs.String("tag_focus", "", "regex to focus on samples with matching tag values (e.g. tenant_id=abc)")
+	tagIgnore := fs.String("tag_ignore", "", "regex to ignore samples with matching tag values")
+	cum := fs.Bool("cum", false, "sort top output by cumulative value")
+	nodecount := fs.Int("nodecount", 0, "node count for top output")
+	sampleIndex := fs.String("sample_index", "", "pprof sample index")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *profile == "" {
+		return errors.New("pprof tags requires --profile")
+	}
+
+	showValues := *tagShow != "" || (*tagFocus == "" && *tagIgnore == "")
+	result, err := pprof.RunTags(context.Background(), pprof.TagsParams{
+		Profile:     *profile,
+		Binary:      *binary,
+		TagFocus:    *tagFocus,
+		TagIgnore:   *tagIgnore,
+		TagShow:     *tagShow,
+		AllTags:     showValues,
+		Cum:         *cum,
+		NodeCount:   *nodecount,
+		SampleIndex: *sampleIndex,
+	})
+	if err != nil {
+		return err
+	}
+
+	payload := jsonOutput{"command": result.Command, "raw": result.Raw}
+	if !showValues {
+		report := pprofparse.ParseTop(result.Raw)
+		payload["rows"] = report.Rows
+		payload["summary"] = report.Summary
+		return render(out, view{
+			payload: payload,
+			table: func() tableView {
+				return objectsTable(report.Rows, "flat", "flat_pct", "sum_pct", "cum", "cum_pct", "name")
+			},
+		})
+	}
+
+	values := pprofparse.ParseTags(result.Raw)
+	if *tagShow != "" {
+		values, err = filterTagValues(values, *tagShow)
+		if err != nil {
+			return err
+		}
+	}
+	payload["values"] = values
+	return render(out, view{
+		payload: payload,
+		table:   func() tableView { return objectsTable(values, "tag", "value", "weight", "pct") },
+	})
+}
+
+func filterTagValues(values []pprofparse.TagValue, tag string) ([]pprofparse.TagValue, error) {
+	filtered := []pprofparse.TagValue{}
+	keys := map[string]struct{}{}
+	for _, value := range values {
+		keys[value.Tag] = struct{}{}
+		if value.Tag == tag {
+			filtered = append(filtered, value)
+		}
+	}
+	if len(filtered) == 0 {
+		if len(keys) == 0 {
+			return nil, errors.New("profile has no tags")
+		}
+		available := make([]string, 0, len(keys))
+		for key := range keys {
+			available = append(available, key)
+		}
+		sort.Strings(available)
+		return nil, fmt.Errorf("no tag %q in profile; available: %s", tag, strings.Join(available, ", "))
+	}
+	return filtered, nil
+}
@@ -0,0 +1,635 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/arreyder/pprof-mcp/internal/datadog"
+	"github.com/arreyder/pprof-mcp/internal/pprof"
+	"github.com/arreyder/pprof-mcp/internal/pprofparse"
+)
+
+type tuiPane int
+
+const (
+	paneCandidates tuiPane = iota
+	paneTop
+	paneStorylines
+	paneDetail
+)
+
+var tuiPaneNames = map[tuiPane]string{
+	paneCandidates: "candidates",
+	paneTop:        "top",
+	paneStorylines: "storylines",
+	paneDetail:     "detail",
+}
+
+const tuiHelp = "j/k move  enter select  c candidates  t top  s storylines  p peek  l list  n next type  r refresh  b back  q quit"
+
+// tuiState is everything the interactive view renders from. All data comes
+// from the same internal packages the other subcommands use.
+type tuiState struct {
+	ctx          context.Context
+	service      string
+	env          string
+	site         string
+	host         string
+	hours        int
+	outDir       string
+	repoRoot     string
+	trimPath     string
+	repoPrefixes []string
+
+	pane    tuiPane
+	back    tuiPane
+	cursors map[tuiPane]int
+	status  string
+	height  int
+
+	candidates []datadog.ProfileCandidate
+	downloaded map[string]map[string]string // profile id -> type -> path
+	label      string
+
+	profiles    map[string]string
+	profileType string
+	top         map[string][]pprofparse.TopRow
+	storylines  map[string][]pprof.Storyline
+
+	detailTitle string
+	detail      []string
+}
+
+// runTUI starts an interactive, keyboard-driven browser over candidate
+// profiles, top tables, and storylines, with drill-down into peek and list.
+func runTUI(args []string, out io.Writer) error {
+	fs := newFlagSet("tui")
+	service := fs.String("service", "", "Datadog service name")
+	env := fs.String("env", "", "Datadog environment")
+	site := fs.String("site", "", "Datadog site (defaults to us3.datadoghq.com)")
+	hours := fs.Int("hours", 72, "time window in hours")
+	host := fs.String("host", "", "host filter (supports wildcards)")
+	outDir := fs.String("out", cliConfig.Workspace, "output directory for downloaded profiles")
+	profilePath := fs.String("profile", "", "browse a local .pprof file instead of Datadog candidates")
+	repoRoot := fs.String("repo_root", ".", "repo root for source path")
+	trimPath := fs.String("trim_path", cliConfig.TrimPathOr(""), "trim path for sources (default: inferred from the profile's paths and repo_root)")
+	var repoPrefixes multiFlag
+	fs.Var(&repoPrefixes, "repo_prefix", "repo prefix to identify app-owned frames")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	applyPreset(fs)
+	if len(repoPrefixes) == 0 {
+		repoPrefixes = cliConfig.RepoPrefixes
+	}
+
+	if *profilePath == "" && (*service == "" || *env == "" || *outDir == "") {
+		return errors.New("tui requires --profile, or --service, --env, and --out")
+	}
+
+	state := &tuiState{
+		ctx:          context.Background(),
+		service:      *service,
+		env:          *env,
+		site:         *site,
+		host:         *host,
+		hours:        *hours,
+		outDir:       *outDir,
+		repoRoot:     *repoRoot,
+		trimPath:     *trimPath,
+		repoPrefixes: repoPrefixes,
+		cursors:      map[tuiPane]int{},
+		downloaded:   map[string]map[string]string{},
+		height:       terminalHeight(),
+	}
+
+	restore := enableRawInput()
+	if restore != nil {
+		defer restore()
+	}
+	keys := newKeyReader(os.Stdin, restore == nil)
+
+	if *profilePath != "" {
+		state.label = filepath.Base(*profilePath)
+		state.setProfiles(map[string]string{profileTypeFromPath(*profilePath): *profilePath})
+		state.pane = paneTop
+		state.loadTop(out)
+	} else {
+		state.pane = paneCandidates
+		state.loadCandidates(out)
+	}
+
+	for {
+		state.render(out)
+		key, err := keys.next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if key == "q" {
+			fmt.Fprint(out, "\x1b[H\x1b[2J")
+			return nil
+		}
+		state.handle(key, out)
+	}
+}
+
+func (s *tuiState) handle(key string, out io.Writer) {
+	s.status = ""
+	switch key {
+	case "j", "down":
+		s.move(1)
+	case "k", "up":
+		s.move(-1)
+	case "pgdn", " ":
+		s.move(s.pageSize())
+	case "pgup":
+		s.move(-s.pageSize())
+	case "enter":
+		s.selectCurrent(out)
+	case "c":
+		if s.service == "" {
+			s.status = "no Datadog service; started with --profile"
+			return
+		}
+		s.pane = paneCandidates
+	case "t":
+		if s.requireProfile() {
+			s.pane = paneTop
+			s.loadTop(out)
+		}
+	case "s":
+		if s.requireProfile() {
+			s.pane = paneStorylines
+			s.loadStorylines(out)
+		}
+	case "p":
+		s.drillDown("peek", out)
+	case "l":
+		s.drillDown("list", out)
+	case "n":
+		s.nextProfileType(out)
+	case "r":
+		if s.service != "" {
+			s.pane = paneCandidates
+			s.loadCandidates(out)
+		}
+	case "b", "esc":
+		if s.pane == paneDetail {
+			s.pane = s.back
+		}
+	case "?":
+		s.status = tuiHelp
+	default:
+		s.status = fmt.Sprintf("unknown key %q (? for help)", key)
+	}
+}
+
+func (s *tuiState) rowCount() int {
+	switch s.pane {
+	case paneCandidates:
+		return len(s.candidates)
+	case paneTop:
+		return len(s.top[s.profileType])
+	case paneStorylines:
+		return len(s.storylines[s.profileType])
+	case paneDetail:
+		return len(s.detail)
+	}
+	return 0
+}
+
+func (s *tuiState) move(delta int) {
+	count := s.rowCount()
+	if count == 0 {
+		return
+	}
+	cursor := s.cursors[s.pane] + delta
+	cursor = max(0, min(cursor, count-1))
+	s.cursors[s.pane] = cursor
+}
+
+// pageSize is the number of body rows that fit between the header and footer.
+func (s *tuiState) pageSize() int {
+	return max(5, s.height-6)
+}
+
+func (s *tuiState) requireProfile() bool {
+	if len(s.profiles) == 0 {
+		s.status = "select a candidate with enter first"
+		return false
+	}
+	return true
+}
+
+func (s *tuiState) selectCurrent(out io.Writer) {
+	switch s.pane {
+	case paneCandidates:
+		if len(s.candidates) == 0 {
+			return
+		}
+		s.downloadCandidate(s.candidates[s.cursors[paneCandidates]], out)
+	case paneTop, paneStorylines:
+		s.drillDown("peek", out)
+	}
+}
+
+// selectedFunction returns the function under the cursor. Storylines peek
+// the leaf hotspot and list the first app-owned frame.
+func (s *tuiState) selectedFunction(action string) string {
+	cursor := s.cursors[s.pane]
+	switch s.pane {
+	case paneTop:
+		rows := s.top[s.profileType]
+		if cursor < len(rows) {
+			return rows[cursor].Name
+		}
+	case paneStorylines:
+		lines := s.storylines[s.profileType]
+		if cursor < len(lines) {
+			if action == "list" && lines[cursor].FirstApp != "" {
+				return lines[cursor].FirstApp
+			}
+			return lines[cursor].LeafHotspot
+		}
+	}
+	return ""
+}
+
+func (s *tuiState) drillDown(action string, out io.Writer) {
+	function := s.selectedFunction(action)
+	if function == "" {
+		s.status = action + " needs a row in the top or storylines pane"
+		return
+	}
+	regex := "^" + regexp.QuoteMeta(function) + "$"
+	profile := s.profiles[s.profileType]
+	s.loading(out, fmt.Sprintf("%s %s", action, function))
+
+	var raw string
+	var err error
+	if action == "peek" {
+		var result pprof.PeekResult
+		result, err = pprof.RunPeek(s.ctx, pprof.PeekParams{Profile: profile, Regex: regex})
+		raw = result.Raw
+	} else {
+		var result pprof.ListResult
+		result, err = pprof.RunList(s.ctx, pprof.ListParams{Profile: profile, Function: regex, RepoRoot: s.repoRoot, TrimPath: s.trimPath})
+		raw = result.Raw
+	}
+	if err != nil {
+		s.status = fmt.Sprintf("%s failed: %v", action, err)
+		return
+	}
+	s.back = s.pane
+	s.pane = paneDetail
+	s.cursors[paneDetail] = 0
+	s.detailTitle = fmt.Sprintf("%s %s", action, function)
+	s.detail = strings.Split(strings.TrimRight(raw, "\n"), "\n")
+	s.status = ""
+}
+
+func (s *tuiState) loadCandidates(out io.Writer) {
+	s.loading(out, "listing candidate profiles")
+	result, err := datadog.ListProfiles(s.ctx, datadog.ListProfilesParams{
+		Service: s.service,
+		Env:     s.env,
+		Hours:   s.hours,
+		Site:    s.site,
+		Host:    s.host,
+	})
+	if err != nil {
+		s.status = fmt.Sprintf("list profiles failed: %v", err)
+		return
+	}
+	s.candidates = result.Candidates
+	s.cursors[paneCandidates] = 0
+	s.status = fmt.Sprintf("%d candidates in the last %dh", len(result.Candidates), s.hours)
+}
+
+func (s *tuiState) downloadCandidate(candidate datadog.ProfileCandidate, out io.Writer) {
+	s.label = candidate.ProfileID + " @ " + candidate.Timestamp
+	if files, ok := s.downloaded[candidate.ProfileID]; ok {
+		s.setProfiles(files)
+		s.pane = paneTop
+		s.loadTop(out)
+		return
+	}
+	s.loading(out, "downloading "+candidate.ProfileID)
+	bundle, err := datadog.DownloadLatestBundle(s.ctx, datadog.DownloadParams{
+		Service:   s.service,
+		Env:       s.env,
+		OutDir:    filepath.Join(s.outDir, candidate.ProfileID),
+		Site:      s.site,
+		Hours:     s.hours,
+		ProfileID: candidate.ProfileID,
+		EventID:   candidate.EventID,
+	})
+	if err != nil {
+		s.status = fmt.Sprintf("download failed: %v", err)
+		return
+	}
+	files := map[string]string{}
+	for _, file := range bundle.Files {
+		if _, seen := files[file.Type]; !seen && strings.HasSuffix(file.Path, ".pprof") {
+			files[file.Type] = file.Path
+		}
+	}
+	if len(files) == 0 {
+		s.status = "download contained no .pprof files"
+		return
+	}
+	s.downloaded[candidate.ProfileID] = files
+	s.setProfiles(files)
+	s.pane = paneTop
+	s.loadTop(out)
+}
+
+// setProfiles switches to a new set of profiles, preferring cpu.
+func (s *tuiState) setProfiles(files map[string]string) {
+	s.profiles = files
+	s.top = map[string][]pprofparse.TopRow{}
+	s.storylines = map[string][]pprof.Storyline{}
+	s.cursors[paneTop] = 0
+	s.cursors[paneStorylines] = 0
+	s.profileType = ""
+	if _, ok := files["cpu"]; ok {
+		s.profileType = "cpu"
+		return
+	}
+	if types := s.profileTypes(); len(types) > 0 {
+		s.profileType = types[0]
+	}
+}
+
+func (s *tuiState) profileTypes() []string {
+	types := make([]string, 0, len(s.profiles))
+	for profileType := range s.profiles {
+		types = append(types, profileType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+func (s *tuiState) nextProfileType(out io.Writer) {
+	types := s.profileTypes()
+	if len(types) < 2 {
+		s.status = "only one profile type loaded"
+		return
+	}
+	idx := sort.SearchStrings(types, s.profileType)
+	s.profileType = types[(idx+1)%len(types)]
+	s.cursors[paneTop] = 0
+	s.cursors[paneStorylines] = 0
+	if s.pane == paneStorylines {
+		s.loadStorylines(out)
+		return
+	}
+	s.pane = paneTop
+	s.loadTop(out)
+}
+
+func (s *tuiState) loadTop(out io.Writer) {
+	if _, ok := s.top[s.profileType]; ok {
+		return
+	}
+	s.loading(out, "pprof top "+s.profileType)
+	result, err := pprof.RunTop(s.ctx, pprof.TopParams{Profile: s.profiles[s.profileType], NodeCount: 100})
+	if err != nil {
+		s.status = fmt.Sprintf("top failed: %v", err)
+		return
+	}
+	s.top[s.profileType] = result.Rows
+	s.status = ""
+}
+
+func (s *tuiState) loadStorylines(out io.Writer) {
+	if _, ok := s.storylines[s.profileType]; ok {
+		return
+	}
+	s.loading(out, "storylines "+s.profileType)
+	result, err := pprof.RunStorylines(s.ctx, pprof.StorylinesParams{
+		Profile:      s.profiles[s.profileType],
+		N:            6,
+		RepoPrefixes: s.repoPrefixes,
+		RepoRoot:     s.repoRoot,
+		TrimPath:     s.trimPath,
+	})
+	if err != nil {
+		s.status = fmt.Sprintf("storylines failed: %v", err)
+		return
+	}
+	s.storylines[s.profileType] = result.Storylines
+	s.status = ""
+}
+
+// loading shows a status line while a slow call runs.
+func (s *tuiState) loading(out io.Writer, what string) {
+	s.status = what + "..."
+	s.render(out)
+}
+
+func (s *tuiState) render(out io.Writer) {
+	var buf bytes.Buffer
+	buf.WriteString("\x1b[H\x1b[2J")
+
+	header := "profctl tui"
+	if s.service != "" {
+		header += fmt.Sprintf("  %s (%s)", s.service, s.env)
+	}
+	if s.label != "" {
+		header += "  " + s.label
+	}
+	if s.profileType != "" {
+		header += fmt.Sprintf("  [%s: %s]", strings.Join(s.profileTypes(), " "), s.profileType)
+	}
+	fmt.Fprintln(&buf, header)
+
+	title := tuiPaneNames[s.pane]
+	if s.pane == paneDetail {
+		title = s.detailTitle
+	}
+	fmt.Fprintf(&buf, "-- %s --\n", title)
+
+	lines, selectable := s.bodyLines()
+	cursor := s.cursors[s.pane]
+	start := 0
+	if page := s.pageSize(); cursor >= page {
+		start = cursor - page + 1
+	}
+	for i := start; i < len(lines) && i < start+s.pageSize(); i++ {
+		marker := "  "
+		if selectable && i == cursor {
+			marker = "> "
+		}
+		fmt.Fprintln(&buf, marker+lines[i])
+	}
+	if len(lines) == 0 {
+		fmt.Fprintln(&buf, "  (empty)")
+	}
+
+	fmt.Fprintln(&buf)
+	if s.status != "" {
+		fmt.Fprintln(&buf, s.status)
+	} else {
+		fmt.Fprintln(&buf, tuiHelp)
+	}
+	out.Write(buf.Bytes())
+}
+
+// bodyLines returns the rows for the current pane and whether the cursor
+// selects a row (detail output scrolls instead).
+func (s *tuiState) bodyLines() ([]string, bool) {
+	switch s.pane {
+	case paneCandidates:
+		table := strings.Split(datadog.FormatCandidatesTable(s.candidates), "\n")
+		// Drop the header so row indexes match the cursor.
+		return table[1:], true
+	case paneTop:
+		rows := s.top[s.profileType]
+		lines := make([]string, 0, len(rows))
+		for _, row := range rows {
+			lines = append(lines, fmt.Sprintf("%10s %7s %10s %7s  %s", row.Flat, row.FlatPct, row.Cum, row.CumPct, row.Name))
+		}
+		return lines, true
+	case paneStorylines:
+		storylines := s.storylines[s.profileType]
+		lines := make([]string, 0, len(storylines))
+		for _, storyline := range storylines {
+			line := fmt.Sprintf("%10s %7s  %s", storyline.Cum, storyline.CumPct, storyline.LeafHotspot)
+			if storyline.FirstApp != "" && storyline.FirstApp != storyline.LeafHotspot {
+				line += "  <- " + storyline.FirstApp
+			}
+			lines = append(lines, line)
+		}
+		return lines, true
+	case paneDetail:
+		cursor := s.cursors[paneDetail]
+		if cursor < len(s.detail) {
+			return s.detail[cursor:], false
+		}
+	}
+	return nil, false
+}
+
+// profileTypeFromPath guesses a profile type from names like "cpu.pprof".
+func profileTypeFromPath(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if name == "" {
+		return "profile"
+	}
+	return name
+}
+
+// enableRawInput switches the terminal to unbuffered, no-echo input using
+// stty so single keypresses arrive immediately. It returns nil when stdin is
+// not a terminal (or stty is unavailable); keys are then read line by line.
+func enableRawInput() func() {
+	info, err := os.Stdin.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return nil
+	}
+	saved, err := stty("-g")
+	if err != nil {
+		return nil
+	}
+	if _, err := stty("-icanon", "-echo", "min", "1"); err != nil {
+		return nil
+	}
+	return func() {
+		_, _ = stty(strings.TrimSpace(saved))
+	}
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	output, err := cmd.Output()
+	return string(output), err
+}
+
+// terminalHeight reports the terminal's rows, defaulting to 24.
+func terminalHeight() int {
+	if output, err := stty("size"); err == nil {
+		if fields := strings.Fields(output); len(fields) == 2 {
+			if rows, err := strconv.Atoi(fields[0]); err == nil && rows > 0 {
+				return rows
+			}
+		}
+	}
+	if rows, err := strconv.Atoi(os.Getenv("LINES")); err == nil && rows > 0 {
+		return rows
+	}
+	return 24
+}
+
+// keyReader decodes keypresses. In line mode each line is one key and an
+// empty line is enter.
+type keyReader struct {
+	reader   *bufio.Reader
+	lineMode bool
+}
+
+func newKeyReader(r io.Reader, lineMode bool) *keyReader {
+	return &keyReader{reader: bufio.NewReader(r), lineMode: lineMode}
+}
+
+func (k *keyReader) next() (string, error) {
+	if k.lineMode {
+		line, err := k.reader.ReadString('\n')
+		if err != nil && (line == "" || !errors.Is(err, io.EOF)) {
+			return "", err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			return "enter", nil
+		}
+		return line, nil
+	}
+
+	b, err := k.reader.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	switch b {
+	case '\r', '\n':
+		return "enter", nil
+	case 0x1b:
+		if k.reader.Buffered() == 0 {
+			return "esc", nil
+		}
+		seq := make([]byte, 0, 3)
+		for k.reader.Buffered() > 0 && len(seq) < 3 {
+			c, _ := k.reader.ReadByte()
+			seq = append(seq, c)
+			if c >= 'A' && c <= 'Z' || c == '~' {
+				break
+			}
+		}
+		switch string(seq) {
+		case "[A":
+			return "up", nil
+		case "[B":
+			return "down", nil
+		case "[5~":
+			return "pgup", nil
+		case "[6~":
+			return "pgdn", nil
+		}
+		return "esc", nil
+	}
+	return string(b), nil
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/baseline"
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+	"github.com/arreyder/pprof-mcp/internal/datadog"
+)
+
+// watchState persists between runs so a restarted watch does not re-check
+// a profile it has already folded into the baseline.
+type watchState struct {
+	Service       string `json:"service"`
+	Env           string `json:"env"`
+	LastProfileID string `json:"last_profile_id,omitempty"`
+	LastTimestamp string `json:"last_timestamp,omitempty"`
+	LastDir       string `json:"last_dir,omitempty"`
+	LastChecked   string `json:"last_checked,omitempty"`
+	Checks        int    `json:"checks"`
+	Alerts        int    `json:"alerts"`
+}
+
+// watchReport is one iteration's outcome, printed and passed to --alert_cmd.
+type watchReport struct {
+	Service     string                `json:"service"`
+	Env         string                `json:"env"`
+	CheckedAt   string                `json:"checked_at"`
+	ProfileID   string                `json:"profile_id,omitempty"`
+	Timestamp   string                `json:"timestamp,omitempty"`
+	Skipped     string                `json:"skipped,omitempty"`
+	Comparisons []baseline.Comparison `json:"comparisons,omitempty"`
+	Alerts      []baseline.Deviation  `json:"alerts"`
+}
+
+type watchOptions struct {
+	service      string
+	env          string
+	site         string
+	host         string
+	hours        int
+	outDir       string
+	types        []string
+	baselinePath string
+	statePath    string
+	minSeverity  string
+	alertCmd     string
+	jsonOut      bool
+}
+
+// runWatch periodically picks the latest profile, compares it against the
+// stored baseline, and reports deviations at or above --min_severity.
+func runWatch(args []string, out io.Writer) error {
+	fs := newFlagSet("watch")
+	service := fs.String("service", "", "Datadog service name")
+	env := fs.String("env", "", "Datadog environment")
+	site := fs.String("site", "", "Datadog site (defaults to us3.datadoghq.com)")
+	host := fs.String("host", "", "host filter (supports wildcards)")
+	hours := fs.Int("hours", 2, "time window in hours to pick the latest profile from")
+	interval := fs.Duration("interval", time.Hour, "time between checks")
+	once := fs.Bool("once", false, "run a single check and exit (for cron)")
+	outDir := fs.String("out", cliConfig.Workspace, "directory for downloads, baselines, and watch state")
+	types := fs.String("types", "cpu,heap", "comma-separated profile types to compare")
+	baselinePath := fs.String("baseline_path", "", "baseline store (default: <out>/"+baseline.DefaultFile+")")
+	statePath := fs.String("state", "", "watch state file (default: <out>/watch-<service>-<env>.json)")
+	minSeverity := fs.String("min_severity", "medium", "lowest deviation severity to alert on: low|medium|high")
+	alertCmd := fs.String("alert_cmd", "", "shell command run on alerts with the report JSON on stdin")
+	jsonOut := fs.Bool("json", false, "output one JSON report per check")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	applyPreset(fs)
+
+	if *service == "" || *env == "" || *outDir == "" {
+		return errors.New("watch requires --service, --env, and --out")
+	}
+	if baseline.SeverityRank(*minSeverity) == 0 {
+		return fmt.Errorf("unknown --min_severity %q (want low, medium, or high)", *minSeverity)
+	}
+	if !*once && *interval <= 0 {
+		return errors.New("--interval must be positive")
+	}
+
+	opts := watchOptions{
+		service:      *service,
+		env:          *env,
+		site:         *site,
+		host:         *host,
+		hours:        *hours,
+		outDir:       *outDir,
+		types:        splitList(*types),
+		baselinePath: *baselinePath,
+		statePath:    *statePath,
+		minSeverity:  *minSeverity,
+		alertCmd:     *alertCmd,
+		jsonOut:      *jsonOut,
+	}
+	if opts.baselinePath == "" {
+		opts.baselinePath = filepath.Join(opts.outDir, baseline.DefaultFile)
+	}
+	if opts.statePath == "" {
+		opts.statePath = filepath.Join(opts.outDir, fmt.Sprintf("watch-%s-%s.json", opts.service, opts.env))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *once {
+		return watchOnce(ctx, opts, out)
+	}
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		if err := watchOnce(ctx, opts, out); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			fmt.Fprintf(os.Stderr, "watch: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func watchOnce(ctx context.Context, opts watchOptions, out io.Writer) error {
+	state, err := loadWatchState(opts.statePath)
+	if err != nil {
+		return err
+	}
+	state.Service = opts.service
+	state.Env = opts.env
+
+	report := watchReport{
+		Service:   opts.service,
+		Env:       opts.env,
+		CheckedAt: time.Now().UTC().Format(time.RFC3339),
+		Alerts:    []baseline.Deviation{},
+	}
+
+	picked, err := datadog.PickProfile(ctx, datadog.PickProfilesParams{
+		Service:  opts.service,
+		Env:      opts.env,
+		Hours:    opts.hours,
+		Site:     opts.site,
+		Host:     opts.host,
+		Strategy: datadog.PickStrategy("latest"),
+		Index:    -1,
+	})
+	if err != nil {
+		return fmt.Errorf("pick profile: %w", err)
+	}
+	report.ProfileID = picked.Candidate.ProfileID
+	report.Timestamp = picked.Candidate.Timestamp
+
+	if picked.Candidate.ProfileID == state.LastProfileID {
+		report.Skipped = "no new profile since the last check"
+	} else {
+		dir := filepath.Join(opts.outDir, "watch", picked.Candidate.ProfileID)
+		bundle, err := datadog.DownloadLatestBundle(ctx, datadog.DownloadParams{
+			Service:   opts.service,
+			Env:       opts.env,
+			OutDir:    dir,
+			Site:      opts.site,
+			Hours:     opts.hours,
+			ProfileID: picked.Candidate.ProfileID,
+			EventID:   picked.Candidate.EventID,
+		})
+		if err != nil {
+			return fmt.Errorf("download: %w", err)
+		}
+		if err := compareBundle(ctx, opts, bundle, &report); err != nil {
+			return err
+		}
+		// Only the previous watch download is removed; it is ours.
+		if state.LastDir != "" && state.LastDir != dir {
+			_ = os.RemoveAll(state.LastDir)
+		}
+		state.LastProfileID = picked.Candidate.ProfileID
+		state.LastTimestamp = picked.Candidate.Timestamp
+		state.LastDir = dir
+		state.Checks++
+	}
+
+	state.LastChecked = report.CheckedAt
+	if len(report.Alerts) > 0 {
+		state.Alerts++
+	}
+	if err := os.MkdirAll(filepath.Dir(opts.statePath), 0o755); err != nil {
+		return err
+	}
+	if err := writeJSONFile(opts.statePath, state); err != nil {
+		return fmt.Errorf("save watch state: %w", err)
+	}
+
+	if err := printWatchReport(out, report, opts.jsonOut); err != nil {
+		return err
+	}
+	if len(report.Alerts) > 0 && opts.alertCmd != "" {
+		return runAlertCommand(ctx, opts.alertCmd, report)
+	}
+	return nil
+}
+
+// compareBundle folds each requested profile type into the baseline and
+// collects deviations at or above the minimum severity.
+func compareBundle(ctx context.Context, opts watchOptions, bundle datadog.DownloadResult, report *watchReport) error {
+	for _, profileType := range opts.types {
+		path := bundleProfilePath(bundle, profileType)
+		if path == "" {
+			continue
+		}
+		kind, rows, err := baselineTop(ctx, path, "")
+		if err != nil {
+			return err
+		}
+		key := baseline.Key(opts.service, opts.env, "", kind, "default")
+		comparison, err := baseline.CompareAndUpdate(opts.baselinePath, key, kind, "default", rows)
+		if err != nil {
+			return fmt.Errorf("baseline %s: %w", profileType, err)
+		}
+		report.Comparisons = append(report.Comparisons, comparison)
+		for _, deviation := range comparison.Deviations {
+			if baseline.SeverityRank(deviation.Severity) >= baseline.SeverityRank(opts.minSeverity) {
+				report.Alerts = append(report.Alerts, deviation)
+			}
+		}
+	}
+	sort.SliceStable(report.Alerts, func(i, j int) bool {
+		return absDelta(report.Alerts[i].Delta) > absDelta(report.Alerts[j].Delta)
+	})
+	return nil
+}
+
+func printWatchReport(out io.Writer, report watchReport, jsonOut bool) error {
+	if cliOutput != "" && cliOutput != outputJSON {
+		if cliOutput == outputYAML {
+			fmt.Fprintln(out, "---")
+		}
+		return render(out, view{
+			payload: report,
+			table: func() tableView {
+				return objectsTable(report.Alerts, "severity", "function", "metric", "baseline", "current", "delta")
+			},
+		})
+	}
+	if jsonOut || cliOutput == outputJSON {
+		data, err := json.Marshal(report)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, string(data))
+		return err
+	}
+	prefix := fmt.Sprintf("%s %s/%s", report.CheckedAt, report.Service, report.Env)
+	if report.Skipped != "" {
+		_, err := fmt.Fprintf(out, "%s: %s (profile %s)\n", prefix, report.Skipped, report.ProfileID)
+		return err
+	}
+	if len(report.Alerts) == 0 {
+		samples := 0
+		for _, comparison := range report.Comparisons {
+			samples = max(samples, comparison.BaselineSamples)
+		}
+		_, err := fmt.Fprintf(out, "%s: profile %s within baseline (%d samples)\n", prefix, report.ProfileID, samples)
+		return err
+	}
+	fmt.Fprintf(out, "%s: ALERT profile %s has %d deviations\n", prefix, report.ProfileID, len(report.Alerts))
+	for _, alert := range report.Alerts {
+		if _, err := fmt.Fprintf(out, "  [%s] %s %s %.1f%% -> %.1f%% (%+.1f)\n", alert.Severity, alert.Function, alert.Metric, alert.Baseline, alert.Current, alert.Delta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runAlertCommand(ctx context.Context, command string, report watchReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	cmd, done := cmdrun.ShellCommand(ctx, command)
+	cmd.Stdin = strings.NewReader(string(data))
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := done(cmd.Run()); err != nil {
+		return fmt.Errorf("alert command: %w", err)
+	}
+	return nil
+}
+
+func loadWatchState(path string) (watchState, error) {
+	var state watchState
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("watch state at %q: %w", path, err)
+	}
+	return state, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func absDelta(value float64) float64 {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
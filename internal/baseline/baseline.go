@@ -0,0 +1,418 @@
+// Package baseline keeps rolling per-function averages of top tables and
+// reports how a new profile deviates from them.
+package baseline
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/pprof"
+	"github.com/arreyder/pprof-mcp/internal/pprofparse"
+)
+
+// DefaultFile is the baseline store's file name when no path is given.
+const DefaultFile = ".pprof-mcp-baselines.json"
+
+var storeMu sync.Mutex
+
+type Store struct {
+	UpdatedAt string            `json:"updated_at"`
+	Entries   map[string]*Entry `json:"entries"`
+}
+
+type Entry struct {
+	Key         string               `json:"key"`
+	ProfileKind string               `json:"profile_kind"`
+	SampleIndex string               `json:"sample_index,omitempty"`
+	UpdatedAt   string               `json:"updated_at"`
+	Samples     int                  `json:"samples"`
+	Functions   map[string]*Function `json:"functions"`
+}
+
+type Function struct {
+	AvgFlatPct float64 `json:"avg_flat_pct"`
+	AvgCumPct  float64 `json:"avg_cum_pct"`
+	Count      int     `json:"count"`
+}
+
+type Deviation struct {
+	Function string  `json:"function"`
+	Metric   string  `json:"metric"`
+	Current  float64 `json:"current"`
+	Baseline float64 `json:"baseline"`
+	Delta    float64 `json:"delta"`
+	Severity string  `json:"severity"`
+}
+
+type Comparison struct {
+	Key             string      `json:"key"`
+	ProfileKind     string      `json:"profile_kind"`
+	SampleIndex     string      `json:"sample_index,omitempty"`
+	BaselineSamples int         `json:"baseline_samples"`
+	Deviations      []Deviation `json:"deviations"`
+	Warnings        []string    `json:"warnings,omitempty"`
+}
+
+func LoadStore(path string) (Store, error) {
+	store := Store{
+		Entries: map[string]*Entry{},
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return store, nil
+		}
+		return store, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return store, nil
+	}
+	if err := json.Unmarshal(data, &store); err != nil {
+		return store, fmt.Errorf("baseline store at %q contains invalid JSON (partial write?): %w", path, err)
+	}
+	if store.Entries == nil {
+		store.Entries = map[string]*Entry{}
+	}
+	return store, nil
+}
+
+// SaveStore writes the store atomically via a temp file and rename.
+func SaveStore(path string, store Store) error {
+	if store.Entries == nil {
+		store.Entries = map[string]*Entry{}
+	}
+	store.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	data, err := json.MarshalIndent(store, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	if dir != "." && dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	tempFile, err := os.CreateTemp(dir, ".pprof-mcp-baselines-")
+	if err != nil {
+		return err
+	}
+	tempName := tempFile.Name()
+	cleanup := func() {
+		_ = os.Remove(tempName)
+	}
+	if _, err := tempFile.Write(data); err != nil {
+		tempFile.Close()
+		cleanup()
+		return err
+	}
+	if err := tempFile.Sync(); err != nil {
+		tempFile.Close()
+		cleanup()
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		cleanup()
+		return err
+	}
+	if err := os.Chmod(tempName, 0o644); err != nil {
+		cleanup()
+		return err
+	}
+	if err := os.Rename(tempName, path); err != nil {
+		cleanup()
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// Key builds the store key: baselineKey (or "service:env") plus the profile
+// kind and sample index.
+func Key(service, env, baselineKey, profileKind, sampleIndex string) string {
+	key := strings.TrimSpace(baselineKey)
+	if key == "" {
+		service = strings.TrimSpace(service)
+		env = strings.TrimSpace(env)
+		if service != "" || env != "" {
+			key = fmt.Sprintf("%s:%s", service, env)
+		} else {
+			key = "default"
+		}
+	}
+	if profileKind != "" {
+		key += "|" + profileKind
+	}
+	if sampleIndex != "" {
+		key += "|" + sampleIndex
+	}
+	return key
+}
+
+// CompareAndUpdate reports how rows deviate from the stored baseline for key,
+// then folds rows into the baseline's rolling averages.
+func CompareAndUpdate(path, key, profileKind, sampleIndex string, rows []pprofparse.TopRow) (Comparison, error) {
+	comparison := Comparison{
+		Key:         key,
+		ProfileKind: profileKind,
+		SampleIndex: sampleIndex,
+		Deviations:  []Deviation{},
+		Warnings:    []string{},
+	}
+	storeMu.Lock()
+	defer storeMu.Unlock()
+
+	store, err := LoadStore(path)
+	if err != nil {
+		return comparison, err
+	}
+
+	entry, exists := store.Entries[key]
+	if !exists {
+		entry = &Entry{
+			Key:         key,
+			ProfileKind: profileKind,
+			SampleIndex: sampleIndex,
+			UpdatedAt:   time.Now().UTC().Format(time.RFC3339),
+			Samples:     0,
+			Functions:   map[string]*Function{},
+		}
+		store.Entries[key] = entry
+		comparison.Warnings = append(comparison.Warnings, "baseline initialized from current profile")
+	}
+
+	current := currentFunctions(rows)
+	if exists {
+		comparison.Deviations = deviations(entry, current)
+	}
+	fold(entry, current)
+	comparison.BaselineSamples = entry.Samples
+
+	if err := SaveStore(path, store); err != nil {
+		return comparison, err
+	}
+
+	return comparison, nil
+}
+
+// Compare reports how rows deviate from the stored baseline for key without
+// changing the store.
+func Compare(path, key, profileKind, sampleIndex string, rows []pprofparse.TopRow) (Comparison, error) {
+	comparison := Comparison{
+		Key:         key,
+		ProfileKind: profileKind,
+		SampleIndex: sampleIndex,
+		Deviations:  []Deviation{},
+		Warnings:    []string{},
+	}
+	storeMu.Lock()
+	defer storeMu.Unlock()
+
+	store, err := LoadStore(path)
+	if err != nil {
+		return comparison, err
+	}
+	entry, exists := store.Entries[key]
+	if !exists {
+		comparison.Warnings = append(comparison.Warnings, fmt.Sprintf("no baseline recorded for %q", key))
+		return comparison, nil
+	}
+	comparison.BaselineSamples = entry.Samples
+	comparison.Deviations = deviations(entry, currentFunctions(rows))
+	return comparison, nil
+}
+
+// Record folds rows into the baseline for key without comparing them and
+// returns the updated entry.
+func Record(path, key, profileKind, sampleIndex string, rows []pprofparse.TopRow) (Entry, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+
+	store, err := LoadStore(path)
+	if err != nil {
+		return Entry{}, err
+	}
+	entry, exists := store.Entries[key]
+	if !exists {
+		entry = &Entry{
+			Key:         key,
+			ProfileKind: profileKind,
+			SampleIndex: sampleIndex,
+			Functions:   map[string]*Function{},
+		}
+		store.Entries[key] = entry
+	}
+	fold(entry, currentFunctions(rows))
+	if err := SaveStore(path, store); err != nil {
+		return Entry{}, err
+	}
+	return *entry, nil
+}
+
+// PruneOptions selects entries to remove. An entry must match every set
+// field: updated before Before, and a key starting with KeyPrefix.
+type PruneOptions struct {
+	Before    time.Time
+	KeyPrefix string
+	DryRun    bool
+}
+
+// Prune removes the matching entries and returns their keys, sorted. With
+// DryRun the store is left unchanged.
+func Prune(path string, opts PruneOptions) ([]string, error) {
+	if opts.Before.IsZero() && opts.KeyPrefix == "" {
+		return nil, errors.New("prune requires a cutoff time or key prefix")
+	}
+	storeMu.Lock()
+	defer storeMu.Unlock()
+
+	store, err := LoadStore(path)
+	if err != nil {
+		return nil, err
+	}
+	removed := []string{}
+	for key, entry := range store.Entries {
+		if opts.KeyPrefix != "" && !strings.HasPrefix(key, opts.KeyPrefix) {
+			continue
+		}
+		if !opts.Before.IsZero() {
+			updated, err := time.Parse(time.RFC3339, entry.UpdatedAt)
+			if err == nil && !updated.Before(opts.Before) {
+				continue
+			}
+		}
+		removed = append(removed, key)
+	}
+	sort.Strings(removed)
+	if opts.DryRun || len(removed) == 0 {
+		return removed, nil
+	}
+	for _, key := range removed {
+		delete(store.Entries, key)
+	}
+	return removed, SaveStore(path, store)
+}
+
+// SeverityRank orders severities low < medium < high; unknown values rank 0.
+func SeverityRank(severity string) int {
+	switch severity {
+	case "low":
+		return 1
+	case "medium":
+		return 2
+	case "high":
+		return 3
+	}
+	return 0
+}
+
+func currentFunctions(rows []pprofparse.TopRow) map[string]Function {
+	current := map[string]Function{}
+	for _, row := range rows {
+		current[row.Name] = Function{
+			AvgFlatPct: pprof.ParsePercent(row.FlatPct),
+			AvgCumPct:  pprof.ParsePercent(row.CumPct),
+			Count:      1,
+		}
+	}
+	return current
+}
+
+func deviations(entry *Entry, current map[string]Function) []Deviation {
+	result := []Deviation{}
+	for name, curr := range current {
+		base := entry.Functions[name]
+		if base == nil || base.Count == 0 {
+			continue
+		}
+		result = append(result, diffMetrics(name, "flat_pct", curr.AvgFlatPct, base.AvgFlatPct)...)
+		result = append(result, diffMetrics(name, "cum_pct", curr.AvgCumPct, base.AvgCumPct)...)
+	}
+	// Stable, so each function keeps flat_pct before cum_pct.
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Function < result[j].Function })
+	return result
+}
+
+// fold adds one profile's functions to the entry's rolling averages.
+func fold(entry *Entry, current map[string]Function) {
+	for name, curr := range current {
+		base := entry.Functions[name]
+		if base == nil {
+			entry.Functions[name] = &Function{
+				AvgFlatPct: curr.AvgFlatPct,
+				AvgCumPct:  curr.AvgCumPct,
+				Count:      1,
+			}
+			continue
+		}
+		base.Count++
+		base.AvgFlatPct = rollingAverage(base.AvgFlatPct, curr.AvgFlatPct, base.Count)
+		base.AvgCumPct = rollingAverage(base.AvgCumPct, curr.AvgCumPct, base.Count)
+	}
+	entry.Samples++
+	entry.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+}
+
+func diffMetrics(name, metric string, current, baseline float64) []Deviation {
+	delta := current - baseline
+	absDelta := absFloat(delta)
+	if baseline == 0 && current < 2 {
+		return nil
+	}
+	if absDelta < 2 && (baseline == 0 || absDelta/baseline < 0.3) {
+		return nil
+	}
+	severity := "low"
+	if absDelta >= 10 {
+		severity = "high"
+	} else if absDelta >= 5 {
+		severity = "medium"
+	}
+	return []Deviation{{
+		Function: name,
+		Metric:   metric,
+		Current:  current,
+		Baseline: baseline,
+		Delta:    delta,
+		Severity: severity,
+	}}
+}
+
+func rollingAverage(currentAvg, newValue float64, count int) float64 {
+	if count <= 1 {
+		return newValue
+	}
+	return (currentAvg*float64(count-1) + newValue) / float64(count)
+}
+
+func absFloat(value float64) float64 {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
+
+func syncDir(path string) error {
+	if path == "" || path == "." {
+		return nil
+	}
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	if err := dir.Sync(); err != nil {
+		if errors.Is(err, syscall.EINVAL) || errors.Is(err, syscall.ENOTSUP) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
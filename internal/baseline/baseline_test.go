@@ -0,0 +1,129 @@
+package baseline
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/pprofparse"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveStoreAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "baselines.json")
+
+	store := Store{
+		Entries: map[string]*Entry{
+			"service:env|cpu|default": {
+				Key:         "service:env|cpu|default",
+				ProfileKind: "cpu",
+				SampleIndex: "default",
+				UpdatedAt:   "2024-01-01T00:00:00Z",
+				Samples:     1,
+				Functions: map[string]*Function{
+					"main.main": {AvgFlatPct: 10.0, AvgCumPct: 12.0, Count: 1},
+				},
+			},
+		},
+	}
+	require.NoError(t, SaveStore(path, store))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var decoded Store
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Contains(t, decoded.Entries, "service:env|cpu|default")
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		require.False(t, strings.HasPrefix(entry.Name(), ".pprof-mcp-baselines-"), "temp file left behind: %s", entry.Name())
+	}
+}
+
+func TestCompareAndUpdate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultFile)
+	key := Key("svc", "prod", "", "cpu", "default")
+	require.Equal(t, "svc:prod|cpu|default", key)
+
+	first, err := CompareAndUpdate(path, key, "cpu", "default", []pprofparse.TopRow{
+		{Name: "main.work", FlatPct: "10%", CumPct: "20%"},
+	})
+	require.NoError(t, err)
+	require.Empty(t, first.Deviations)
+	require.Contains(t, first.Warnings, "baseline initialized from current profile")
+
+	second, err := CompareAndUpdate(path, key, "cpu", "default", []pprofparse.TopRow{
+		{Name: "main.work", FlatPct: "25%", CumPct: "21%"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, second.BaselineSamples)
+	require.Len(t, second.Deviations, 1)
+	require.Equal(t, "flat_pct", second.Deviations[0].Metric)
+	require.Equal(t, "high", second.Deviations[0].Severity)
+	require.Greater(t, SeverityRank("high"), SeverityRank("medium"))
+}
+
+func TestRecordAndCompare(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultFile)
+	key := Key("svc", "prod", "", "cpu", "default")
+
+	missing, err := Compare(path, key, "cpu", "default", []pprofparse.TopRow{{Name: "main.work", FlatPct: "10%", CumPct: "20%"}})
+	require.NoError(t, err)
+	require.Empty(t, missing.Deviations)
+	require.NotEmpty(t, missing.Warnings)
+
+	for _, pct := range []string{"10%", "12%"} {
+		_, err := Record(path, key, "cpu", "default", []pprofparse.TopRow{{Name: "main.work", FlatPct: pct, CumPct: "20%"}})
+		require.NoError(t, err)
+	}
+	entry, err := Record(path, key, "cpu", "default", []pprofparse.TopRow{{Name: "main.work", FlatPct: "11%", CumPct: "20%"}})
+	require.NoError(t, err)
+	require.Equal(t, 3, entry.Samples)
+	require.InDelta(t, 11.0, entry.Functions["main.work"].AvgFlatPct, 0.001)
+
+	comparison, err := Compare(path, key, "cpu", "default", []pprofparse.TopRow{{Name: "main.work", FlatPct: "30%", CumPct: "20%"}})
+	require.NoError(t, err)
+	require.Equal(t, 3, comparison.BaselineSamples)
+	require.Len(t, comparison.Deviations, 1)
+	require.Equal(t, "high", comparison.Deviations[0].Severity)
+
+	// Compare must not fold the checked profile into the baseline.
+	store, err := LoadStore(path)
+	require.NoError(t, err)
+	require.Equal(t, 3, store.Entries[key].Samples)
+}
+
+func TestPrune(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultFile)
+	store := Store{Entries: map[string]*Entry{
+		"a:prod|cpu|default":  {Key: "a:prod|cpu|default", UpdatedAt: "2024-01-01T00:00:00Z"},
+		"a:prod|heap|default": {Key: "a:prod|heap|default", UpdatedAt: "2030-01-01T00:00:00Z"},
+		"b:prod|cpu|default":  {Key: "b:prod|cpu|default", UpdatedAt: "2024-01-01T00:00:00Z"},
+	}}
+	require.NoError(t, SaveStore(path, store))
+
+	_, err := Prune(path, PruneOptions{})
+	require.Error(t, err)
+
+	cutoff, err := time.Parse(time.RFC3339, "2025-01-01T00:00:00Z")
+	require.NoError(t, err)
+	removed, err := Prune(path, PruneOptions{Before: cutoff, DryRun: true})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a:prod|cpu|default", "b:prod|cpu|default"}, removed)
+	loaded, err := LoadStore(path)
+	require.NoError(t, err)
+	require.Len(t, loaded.Entries, 3)
+
+	removed, err = Prune(path, PruneOptions{Before: cutoff, KeyPrefix: "a:"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a:prod|cpu|default"}, removed)
+	loaded, err = LoadStore(path)
+	require.NoError(t, err)
+	require.Len(t, loaded.Entries, 2)
+	require.NotContains(t, loaded.Entries, "a:prod|cpu|default")
+}
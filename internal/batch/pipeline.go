@@ -0,0 +1,336 @@
+// Package batch runs YAML-defined pipelines of profctl commands, exposing
+// each step's JSON output to the steps after it.
+package batch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Pipeline is a pipeline file.
+//
+//	vars:
+//	  env: prod
+//	steps:
+//	  - name: download
+//	    for_each: [api, worker]
+//	    run: download --service {{ .item }} --env {{ .vars.env }} --out ./incident/{{ .item }}
+//	  - name: merged
+//	    run: pprof merge {{ profiles .steps.download "cpu" }} -o ./incident/merged_cpu.pprof
+//	  - name: top
+//	    run: pprof top --profile {{ .steps.merged.output_path }}
+//	report: ./incident/report.md
+type Pipeline struct {
+	Vars   map[string]string `yaml:"vars"`
+	Steps  []Step            `yaml:"steps"`
+	Report string            `yaml:"report"`
+}
+
+// Step is one profctl command line, rendered as a Go template.
+type Step struct {
+	Name string `yaml:"name"`
+	Run  string `yaml:"run"`
+	// ForEach runs the step once per item, exposed as {{ .item }}. Items are
+	// templates too; a rendered item containing commas yields several items.
+	ForEach []string `yaml:"for_each"`
+	// ContinueOnError records a failure and moves on instead of stopping.
+	ContinueOnError bool `yaml:"continue_on_error"`
+}
+
+// Executor runs one profctl command and returns its decoded JSON output.
+type Executor func(ctx context.Context, args []string) (any, error)
+
+type RunOptions struct {
+	Vars   map[string]string // override the pipeline's vars
+	DryRun bool              // render commands without executing them
+}
+
+type StepResult struct {
+	Name string   `json:"name"`
+	Item string   `json:"item,omitempty"`
+	Args []string `json:"args,omitempty"`
+	// Template is the unrendered run line, set on a dry run when it depends
+	// on outputs of steps that did not run.
+	Template   string `json:"template,omitempty"`
+	Status     string `json:"status"` // ok, failed, skipped, or planned
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+	Output     any    `json:"output,omitempty"`
+}
+
+type Result struct {
+	Vars   map[string]string `json:"vars,omitempty"`
+	Steps  []StepResult      `json:"steps"`
+	Failed int               `json:"failed"`
+	Report string            `json:"report,omitempty"`
+}
+
+var stepName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Load reads and validates a pipeline file.
+func Load(path string) (Pipeline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Pipeline{}, err
+	}
+	var pipeline Pipeline
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&pipeline); err != nil {
+		return Pipeline{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := pipeline.Validate(); err != nil {
+		return Pipeline{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return pipeline, nil
+}
+
+// Validate checks step names and that every template parses.
+func (p Pipeline) Validate() error {
+	if len(p.Steps) == 0 {
+		return errors.New("pipeline has no steps")
+	}
+	seen := map[string]bool{}
+	for i, step := range p.Steps {
+		if !stepName.MatchString(step.Name) {
+			return fmt.Errorf("step %d: name %q must be a letter or underscore followed by letters, digits, or underscores", i+1, step.Name)
+		}
+		if seen[step.Name] {
+			return fmt.Errorf("step %q is defined twice", step.Name)
+		}
+		seen[step.Name] = true
+		if strings.TrimSpace(step.Run) == "" {
+			return fmt.Errorf("step %q has no run command", step.Name)
+		}
+		for _, text := range append([]string{step.Run}, step.ForEach...) {
+			if _, err := parseTemplate(step.Name, text); err != nil {
+				return fmt.Errorf("step %q: %w", step.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Run executes the steps in order. A failing step stops the pipeline unless
+// it sets continue_on_error; the first such failure is returned with the
+// result, which always lists every step.
+func Run(ctx context.Context, p Pipeline, exec Executor, opts RunOptions) (Result, error) {
+	vars := map[string]string{}
+	for k, v := range p.Vars {
+		vars[k] = v
+	}
+	for k, v := range opts.Vars {
+		vars[k] = v
+	}
+	result := Result{Vars: vars}
+	outputs := map[string]any{}
+
+	var runErr error
+	for _, step := range p.Steps {
+		if runErr != nil {
+			result.Steps = append(result.Steps, StepResult{Name: step.Name, Status: "skipped"})
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			runErr = err
+			result.Steps = append(result.Steps, StepResult{Name: step.Name, Status: "skipped"})
+			continue
+		}
+
+		data := map[string]any{"vars": vars, "steps": outputs}
+		items, err := expandItems(step, data)
+		if err != nil {
+			result.Steps = append(result.Steps, StepResult{Name: step.Name, Status: "failed", Error: err.Error()})
+			result.Failed++
+			if !step.ContinueOnError {
+				runErr = fmt.Errorf("step %s: %w", step.Name, err)
+			}
+			continue
+		}
+
+		var stepOutputs []any
+		for _, item := range items {
+			sr, err := runStep(ctx, step, item, data, exec, opts.DryRun)
+			result.Steps = append(result.Steps, sr)
+			stepOutputs = append(stepOutputs, sr.Output)
+			if err != nil {
+				result.Failed++
+				if !step.ContinueOnError {
+					label := step.Name
+					if item != nil {
+						label += " [" + *item + "]"
+					}
+					runErr = fmt.Errorf("step %s: %w", label, err)
+					break
+				}
+			}
+		}
+		if step.ForEach != nil {
+			outputs[step.Name] = stepOutputs
+		} else if len(stepOutputs) == 1 {
+			outputs[step.Name] = stepOutputs[0]
+		}
+	}
+
+	if p.Report != "" {
+		report, err := render("report", p.Report, map[string]any{"vars": vars, "steps": outputs})
+		if err != nil && runErr == nil {
+			runErr = fmt.Errorf("report path: %w", err)
+		}
+		result.Report = report
+	}
+	return result, runErr
+}
+
+func expandItems(step Step, data map[string]any) ([]*string, error) {
+	if step.ForEach == nil {
+		return []*string{nil}, nil
+	}
+	var items []*string
+	for _, raw := range step.ForEach {
+		rendered, err := render(step.Name, raw, data)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range strings.Split(rendered, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, &item)
+			}
+		}
+	}
+	if len(items) == 0 {
+		return nil, errors.New("for_each has no items")
+	}
+	return items, nil
+}
+
+func runStep(ctx context.Context, step Step, item *string, data map[string]any, exec Executor, dryRun bool) (StepResult, error) {
+	sr := StepResult{Name: step.Name}
+	stepData := data
+	if item != nil {
+		sr.Item = *item
+		stepData = map[string]any{"vars": data["vars"], "steps": data["steps"], "item": *item}
+	}
+	fail := func(err error) (StepResult, error) {
+		sr.Status = "failed"
+		sr.Error = err.Error()
+		return sr, err
+	}
+
+	line, err := render(step.Name, step.Run, stepData)
+	if err != nil && dryRun {
+		// Earlier steps did not run, so references to their outputs cannot
+		// resolve yet; show the template instead.
+		sr.Template = strings.TrimSpace(step.Run)
+		sr.Status = "planned"
+		return sr, nil
+	}
+	if err != nil {
+		return fail(err)
+	}
+	args, err := SplitArgs(line)
+	if err != nil {
+		return fail(err)
+	}
+	if len(args) == 0 {
+		return fail(errors.New("run renders to an empty command"))
+	}
+	if args[0] == "batch" {
+		return fail(errors.New("batch steps cannot run batch"))
+	}
+	sr.Args = args
+	if dryRun {
+		sr.Status = "planned"
+		return sr, nil
+	}
+
+	start := time.Now()
+	output, err := exec(ctx, args)
+	sr.DurationMS = time.Since(start).Milliseconds()
+	sr.Output = output
+	if err != nil {
+		return fail(err)
+	}
+	sr.Status = "ok"
+	return sr, nil
+}
+
+func render(name, text string, data map[string]any) (string, error) {
+	tmpl, err := parseTemplate(name, text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func parseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=error").Funcs(templateFuncs).Parse(text)
+}
+
+var templateFuncs = template.FuncMap{
+	// profiles returns the shell-quoted paths of every {type, path} entry of
+	// the given type (all types when empty) found anywhere in an output.
+	"profiles": func(output any, profileType string) string {
+		return quoteAll(ProfilePaths(output, profileType))
+	},
+	// profile returns the first such path.
+	"profile": func(output any, profileType string) (string, error) {
+		paths := ProfilePaths(output, profileType)
+		if len(paths) == 0 {
+			return "", fmt.Errorf("no %s profile in output", profileType)
+		}
+		return Quote(paths[0]), nil
+	},
+	"quote": func(value any) string { return Quote(fmt.Sprint(value)) },
+	"json": func(value any) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+}
+
+// ProfilePaths walks a decoded JSON output for objects with a "path" and a
+// matching "type", in document order. Map keys are visited sorted so the
+// order is stable.
+func ProfilePaths(output any, profileType string) []string {
+	var paths []string
+	var walk func(value any)
+	walk = func(value any) {
+		switch typed := value.(type) {
+		case map[string]any:
+			if path, ok := typed["path"].(string); ok && path != "" {
+				if kind, _ := typed["type"].(string); profileType == "" || kind == profileType {
+					paths = append(paths, path)
+				}
+			}
+			keys := make([]string, 0, len(typed))
+			for key := range typed {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				walk(typed[key])
+			}
+		case []any:
+			for _, v := range typed {
+				walk(v)
+			}
+		}
+	}
+	walk(output)
+	return paths
+}
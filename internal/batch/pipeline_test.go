@@ -0,0 +1,126 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func fakeExecutor(calls *[][]string) Executor {
+	return func(_ context.Context, args []string) (any, error) {
+		*calls = append(*calls, args)
+		switch args[0] {
+		case "download":
+			service := args[2]
+			return map[string]any{"result": map[string]any{"files": []any{
+				map[string]any{"type": "cpu", "path": "/w/" + service + " dir/cpu.pprof"},
+				map[string]any{"type": "heap", "path": "/w/" + service + " dir/heap.pprof"},
+			}}}, nil
+		case "merge":
+			return map[string]any{"output_path": "/w/merged.pprof"}, nil
+		case "fail":
+			return map[string]any{"passed": false}, errors.New("regressed")
+		}
+		return map[string]any{}, nil
+	}
+}
+
+func TestRunPassesOutputsToLaterSteps(t *testing.T) {
+	pipeline := Pipeline{
+		Vars: map[string]string{"services": "api,worker"},
+		Steps: []Step{
+			{Name: "dl", ForEach: []string{"{{ .vars.services }}"}, Run: "download --service {{ .item }}"},
+			{Name: "merged", Run: `merge {{ profiles .steps.dl "cpu" }}`},
+			{Name: "top", Run: "top --profile {{ .steps.merged.output_path }}"},
+		},
+		Report: "{{ .vars.out }}/report.md",
+	}
+	var calls [][]string
+	result, err := Run(context.Background(), pipeline, fakeExecutor(&calls), RunOptions{Vars: map[string]string{"out": "/w"}})
+	require.NoError(t, err)
+	require.Equal(t, 0, result.Failed)
+	require.Equal(t, "/w/report.md", result.Report)
+	require.Equal(t, [][]string{
+		{"download", "--service", "api"},
+		{"download", "--service", "worker"},
+		{"merge", "/w/api dir/cpu.pprof", "/w/worker dir/cpu.pprof"},
+		{"top", "--profile", "/w/merged.pprof"},
+	}, calls)
+
+	report := FormatReport("incident.yaml", result)
+	require.Contains(t, report, "| dl [worker] | ok |")
+	require.Contains(t, report, "- `/w/merged.pprof`")
+}
+
+func TestRunStopsOnFailure(t *testing.T) {
+	pipeline := Pipeline{Steps: []Step{
+		{Name: "soft", Run: "fail", ContinueOnError: true},
+		{Name: "gate", Run: "fail"},
+		{Name: "after", Run: "top"},
+	}}
+	var calls [][]string
+	result, err := Run(context.Background(), pipeline, fakeExecutor(&calls), RunOptions{})
+	require.ErrorContains(t, err, "step gate: regressed")
+	require.Equal(t, 2, result.Failed)
+	require.Equal(t, "skipped", result.Steps[2].Status)
+	require.Len(t, calls, 2)
+	require.Equal(t, map[string]any{"passed": false}, result.Steps[1].Output)
+}
+
+func TestRunDryRun(t *testing.T) {
+	pipeline := Pipeline{Steps: []Step{
+		{Name: "dl", Run: "download --service api"},
+		{Name: "top", Run: "top --profile {{ profile .steps.dl \"cpu\" }}"},
+	}}
+	var calls [][]string
+	result, err := Run(context.Background(), pipeline, fakeExecutor(&calls), RunOptions{DryRun: true})
+	require.NoError(t, err)
+	require.Empty(t, calls)
+	require.Equal(t, []string{"download", "--service", "api"}, result.Steps[0].Args)
+	require.Equal(t, "planned", result.Steps[1].Status)
+	require.Contains(t, result.Steps[1].Template, "{{ profile")
+}
+
+func TestRunUnknownVar(t *testing.T) {
+	pipeline := Pipeline{Steps: []Step{{Name: "top", Run: "top --profile {{ .vars.missing }}"}}}
+	var calls [][]string
+	_, err := Run(context.Background(), pipeline, fakeExecutor(&calls), RunOptions{})
+	require.ErrorContains(t, err, "missing")
+	require.Empty(t, calls)
+}
+
+func TestLoadValidates(t *testing.T) {
+	dir := t.TempDir()
+	write := func(body string) string {
+		path := filepath.Join(dir, "p.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(body), 0o644))
+		return path
+	}
+
+	_, err := Load(write("steps:\n  - name: top\n    run: pprof top --profile a.pprof\n"))
+	require.NoError(t, err)
+
+	_, err = Load(write("steps:\n  - name: bad-name\n    run: pprof top\n"))
+	require.ErrorContains(t, err, "bad-name")
+
+	_, err = Load(write("steps:\n  - name: a\n    run: top {{ .vars.x\n"))
+	require.Error(t, err)
+
+	_, err = Load(write("steps:\n  - name: a\n    command: top\n"))
+	require.ErrorContains(t, err, "command")
+}
+
+func TestSplitArgs(t *testing.T) {
+	args, err := SplitArgs(`pprof top --focus 'a b' "c \"d\"" e\ f ` + Quote("it's"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"pprof", "top", "--focus", "a b", `c "d"`, "e f", "it's"}, args)
+
+	_, err = SplitArgs("top 'open")
+	require.Error(t, err)
+	require.True(t, strings.Contains(Quote("a b"), "'"))
+}
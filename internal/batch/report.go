@@ -0,0 +1,100 @@
+package batch
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FormatReport renders a Markdown summary of a run: one row per step, then
+// the artifacts each step wrote.
+func FormatReport(pipelinePath string, result Result) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Pipeline %s\n\n", pipelinePath)
+	if len(result.Vars) > 0 {
+		keys := make([]string, 0, len(result.Vars))
+		for key := range result.Vars {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(&b, "- `%s` = `%s`\n", key, result.Vars[key])
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("| Step | Status | Duration | Command |\n|---|---|---|---|\n")
+	for _, step := range result.Steps {
+		name := step.Name
+		if step.Item != "" {
+			name += " [" + step.Item + "]"
+		}
+		status := step.Status
+		if step.Error != "" {
+			status += ": " + step.Error
+		}
+		command := ""
+		if len(step.Args) > 0 {
+			command = "`profctl " + quoteAll(step.Args) + "`"
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", name, escapeCell(status), time.Duration(step.DurationMS)*time.Millisecond, escapeCell(command))
+	}
+
+	var artifacts strings.Builder
+	for _, step := range result.Steps {
+		paths := ArtifactPaths(step.Output)
+		if len(paths) == 0 {
+			continue
+		}
+		fmt.Fprintf(&artifacts, "\n**%s**", step.Name)
+		if step.Item != "" {
+			fmt.Fprintf(&artifacts, " [%s]", step.Item)
+		}
+		artifacts.WriteString("\n\n")
+		for _, path := range paths {
+			fmt.Fprintf(&artifacts, "- `%s`\n", path)
+		}
+	}
+	if artifacts.Len() > 0 {
+		b.WriteString("\n## Artifacts\n")
+		b.WriteString(artifacts.String())
+	}
+	return b.String()
+}
+
+// ArtifactPaths returns the distinct values of "path" and "*_path" keys in
+// a decoded JSON output.
+func ArtifactPaths(output any) []string {
+	seen := map[string]bool{}
+	var paths []string
+	var walk func(key string, value any)
+	walk = func(key string, value any) {
+		switch typed := value.(type) {
+		case map[string]any:
+			keys := make([]string, 0, len(typed))
+			for k := range typed {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				walk(k, typed[k])
+			}
+		case []any:
+			for _, v := range typed {
+				walk(key, v)
+			}
+		case string:
+			if (key == "path" || strings.HasSuffix(key, "_path")) && typed != "" && !seen[typed] {
+				seen[typed] = true
+				paths = append(paths, typed)
+			}
+		}
+	}
+	walk("", output)
+	return paths
+}
+
+func escapeCell(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "|", `\|`), "\n", " ")
+}
@@ -0,0 +1,327 @@
+package binaries
+
+import (
+	"context"
+	"debug/buildinfo"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+)
+
+// maxChangedFiles bounds the changed files a HeadCheck lists.
+const maxChangedFiles = 50
+
+// BuildInfo is what the Go toolchain embedded in a binary.
+type BuildInfo struct {
+	Binary       string `json:"binary"`
+	GoVersion    string `json:"go_version"`
+	Path         string `json:"path"` // main package import path
+	Main         Module `json:"main"`
+	Revision     string `json:"revision,omitempty"`
+	RevisionTime string `json:"revision_time,omitempty"`
+	Modified     bool   `json:"modified,omitempty"`
+	VCS          string `json:"vcs,omitempty"`
+	// Settings are the build flags and environment: -tags, -ldflags,
+	// -trimpath, CGO_ENABLED, GOOS, GOARCH, GOAMD64, and the like.
+	Settings map[string]string `json:"settings"`
+	Deps     []Module          `json:"deps"`
+	IDs      IDs               `json:"ids"`
+}
+
+// Module is a module the binary was built from.
+type Module struct {
+	Path    string  `json:"path"`
+	Version string  `json:"version,omitempty"`
+	Sum     string  `json:"sum,omitempty"`
+	Replace *Module `json:"replace,omitempty"`
+}
+
+// ReadBuildInfo reads the Go build info and build IDs of the binary at path.
+func ReadBuildInfo(ctx context.Context, path string) (BuildInfo, error) {
+	info, err := buildinfo.ReadFile(path)
+	if err != nil {
+		return BuildInfo{}, fmt.Errorf("read build info of %s: %w", path, err)
+	}
+	result := BuildInfo{
+		Binary:    path,
+		GoVersion: info.GoVersion,
+		Path:      info.Path,
+		Main:      newModule(&info.Main),
+		Settings:  map[string]string{},
+		Deps:      []Module{},
+		IDs:       ReadIDs(ctx, path),
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs":
+			result.VCS = setting.Value
+		case "vcs.revision":
+			result.Revision = setting.Value
+		case "vcs.time":
+			result.RevisionTime = setting.Value
+		case "vcs.modified":
+			result.Modified = setting.Value == "true"
+		default:
+			result.Settings[setting.Key] = setting.Value
+		}
+	}
+	for _, dep := range info.Deps {
+		result.Deps = append(result.Deps, newModule(dep))
+	}
+	return result, nil
+}
+
+func newModule(m *debug.Module) Module {
+	module := Module{Path: m.Path, Version: m.Version, Sum: m.Sum}
+	if m.Replace != nil {
+		replace := newModule(m.Replace)
+		module.Replace = &replace
+	}
+	return module
+}
+
+// HeadCheck compares a repo's checkout with the revision a binary was built
+// at, since list, peek, and trace_source read source from the checkout.
+type HeadCheck struct {
+	RepoRoot string `json:"repo_root"`
+	Head     string `json:"head,omitempty"`
+	Revision string `json:"revision"`
+	// Match is set when HEAD is the profiled revision and the tree is clean.
+	Match bool `json:"match"`
+	Dirty bool `json:"dirty,omitempty"` // uncommitted changes in the checkout
+	// Known is false when the revision is not in the local clone.
+	Known bool `json:"known"`
+	// Ahead and Behind count commits on HEAD not in the revision, and in
+	// the revision not on HEAD.
+	Ahead  int `json:"ahead,omitempty"`
+	Behind int `json:"behind,omitempty"`
+	// ChangedFiles are the Go files that differ between the revision and
+	// the checkout; ProfiledFiles the ones among them the profile samples.
+	ChangedFiles  []string `json:"changed_files,omitempty"`
+	ProfiledFiles []string `json:"profiled_files,omitempty"`
+	Warning       string   `json:"warning,omitempty"`
+}
+
+// CheckHead compares repoRoot's HEAD and working tree with revision. With a
+// profile, the changed files it has samples in are singled out: those are
+// the files whose line numbers no longer match.
+func CheckHead(ctx context.Context, repoRoot, revision string, prof *profile.Profile) (HeadCheck, error) {
+	check := HeadCheck{RepoRoot: repoRoot, Revision: revision}
+	head, err := run(ctx, cmdrun.Git, repoRoot, "git", "rev-parse", "HEAD")
+	if err != nil {
+		return check, err
+	}
+	check.Head = strings.TrimSpace(head)
+	status, err := run(ctx, cmdrun.Git, repoRoot, "git", "status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		return check, err
+	}
+	check.Dirty = strings.TrimSpace(status) != ""
+
+	if _, err := run(ctx, cmdrun.Git, repoRoot, "git", "cat-file", "-e", revision+"^{commit}"); err != nil {
+		check.Warning = fmt.Sprintf("revision %s is not in the local clone: fetch it, or source lines may be matched against the wrong commit", revision)
+		return check, nil
+	}
+	check.Known = true
+	full, err := run(ctx, cmdrun.Git, repoRoot, "git", "rev-parse", revision+"^{commit}")
+	if err != nil {
+		return check, err
+	}
+	check.Revision = strings.TrimSpace(full)
+
+	if counts, err := run(ctx, cmdrun.Git, repoRoot, "git", "rev-list", "--left-right", "--count", check.Revision+"...HEAD"); err == nil {
+		if fields := strings.Fields(counts); len(fields) == 2 {
+			check.Behind, _ = strconv.Atoi(fields[0])
+			check.Ahead, _ = strconv.Atoi(fields[1])
+		}
+	}
+	// Diffing against the working tree also catches uncommitted edits.
+	diff, err := run(ctx, cmdrun.Git, repoRoot, "git", "diff", "--name-only", "--relative", check.Revision, "--", "*.go")
+	if err != nil {
+		return check, err
+	}
+	for _, file := range strings.Split(strings.TrimSpace(diff), "\n") {
+		if file != "" {
+			check.ChangedFiles = append(check.ChangedFiles, file)
+		}
+	}
+	if prof != nil {
+		check.ProfiledFiles = profiledFiles(prof, check.ChangedFiles)
+	}
+	if len(check.ChangedFiles) > maxChangedFiles {
+		check.ChangedFiles = check.ChangedFiles[:maxChangedFiles]
+	}
+
+	check.Match = check.Head == check.Revision && !check.Dirty
+	switch {
+	case len(check.ProfiledFiles) > 0:
+		check.Warning = fmt.Sprintf("the checkout differs from the profiled revision %s in %d sampled files (%s): source lines may be matched against the wrong commit; check out the revision first",
+			shortRevision(check.Revision), len(check.ProfiledFiles), strings.Join(check.ProfiledFiles[:min(3, len(check.ProfiledFiles))], ", "))
+	case !check.Match && len(check.ChangedFiles) > 0 && prof == nil:
+		check.Warning = fmt.Sprintf("the checkout differs from revision %s, which the binary was built at, in %d Go files: source lines may be matched against the wrong commit", shortRevision(check.Revision), len(check.ChangedFiles))
+	}
+	return check, nil
+}
+
+// profiledFiles returns the changed repo-relative files that prof has
+// functions in, matching build paths by suffix.
+func profiledFiles(prof *profile.Profile, changed []string) []string {
+	var files []string
+	seen := map[string]bool{}
+	for _, fn := range prof.Function {
+		if fn == nil || fn.Filename == "" {
+			continue
+		}
+		name := filepath.ToSlash(fn.Filename)
+		for _, rel := range changed {
+			if !seen[rel] && (name == rel || strings.HasSuffix(name, "/"+rel)) {
+				seen[rel] = true
+				files = append(files, rel)
+			}
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+func shortRevision(revision string) string {
+	if len(revision) > 12 {
+		return revision[:12]
+	}
+	return revision
+}
+
+// BuildInfoSource says which binary build info was read from.
+type BuildInfoSource struct {
+	Binary string `json:"binary"`
+	// From is "binary" for a binary given directly, "mapping" for the
+	// profile's main mapping found at its recorded path, or the
+	// resolve_binary strategy that found it.
+	From       string  `json:"from"`
+	Resolution *Result `json:"resolution,omitempty"`
+}
+
+// ProfileBinary finds the binary behind prof's main mapping: the mapping's
+// own path when it exists locally and matches, else whatever Resolve finds.
+func ProfileBinary(ctx context.Context, params Params) (BuildInfoSource, error) {
+	target := params.Target
+	if target.File == "" {
+		return BuildInfoSource{}, fmt.Errorf("the profile has no main mapping to read build info from: pass binary")
+	}
+	if _, err := os.Stat(target.File); err == nil {
+		if ok, _, _ := target.matches(ReadIDs(ctx, target.File)); ok {
+			return BuildInfoSource{Binary: target.File, From: "mapping"}, nil
+		}
+	}
+	result, err := Resolve(ctx, params)
+	if err != nil {
+		return BuildInfoSource{}, err
+	}
+	if result.Binary == "" {
+		return BuildInfoSource{Resolution: &result}, fmt.Errorf("no binary found for %s after %d attempts: pass binary", target.Binary, len(result.Attempts))
+	}
+	return BuildInfoSource{Binary: result.Binary, From: result.Strategy, Resolution: &result}, nil
+}
+
+// BuildInfoParams says which binary to read and what to check it against.
+type BuildInfoParams struct {
+	// Params resolves the profile's binary when Binary is not given.
+	Params
+	Binary  string
+	Profile string
+}
+
+// BuildInfoResult is a binary's build info and how the checkout compares.
+type BuildInfoResult struct {
+	Source    BuildInfoSource `json:"source"`
+	BuildInfo BuildInfo       `json:"build_info"`
+	Head      *HeadCheck      `json:"head,omitempty"`
+	Warnings  []string        `json:"warnings,omitempty"`
+}
+
+// InspectBuild reads the build info of Binary, or of the binary behind
+// Profile's main mapping, and with a RepoRoot checks its HEAD against the
+// revision the binary was built at.
+func InspectBuild(ctx context.Context, params BuildInfoParams) (BuildInfoResult, error) {
+	var result BuildInfoResult
+	var prof *profile.Profile
+	if params.Profile != "" {
+		file, err := os.Open(params.Profile)
+		if err != nil {
+			return result, err
+		}
+		prof, err = profile.Parse(file)
+		file.Close()
+		if err != nil {
+			return result, err
+		}
+		target := TargetFromProfile(prof)
+		target.Revision, target.Service = params.Revision, params.Service
+		if params.Target.Binary != "" {
+			target.Binary = params.Target.Binary
+		}
+		params.Target = target
+	}
+
+	switch {
+	case params.Binary != "":
+		result.Source = BuildInfoSource{Binary: params.Binary, From: "binary"}
+	case prof != nil:
+		source, err := ProfileBinary(ctx, params.Params)
+		if err != nil {
+			return result, err
+		}
+		result.Source = source
+		if source.Resolution != nil {
+			result.Warnings = append(result.Warnings, source.Resolution.Warnings...)
+		}
+	default:
+		return result, fmt.Errorf("binary or profile is required")
+	}
+
+	info, err := ReadBuildInfo(ctx, result.Source.Binary)
+	if err != nil {
+		return result, err
+	}
+	result.BuildInfo = info
+	if prof != nil && params.Binary != "" {
+		if ok, _, detail := params.Target.matches(info.IDs); !ok {
+			result.Warnings = append(result.Warnings, "the binary is not the profiled one: "+detail)
+		}
+	}
+
+	revision := info.Revision
+	switch {
+	case revision == "":
+		revision = params.Revision
+		if revision == "" {
+			result.Warnings = append(result.Warnings, "the binary records no VCS revision (built outside a repo or with -buildvcs=false): pass revision to check the checkout")
+		}
+	case params.Revision != "" && !strings.HasPrefix(revision, params.Revision) && !strings.HasPrefix(params.Revision, revision):
+		result.Warnings = append(result.Warnings, fmt.Sprintf("the binary was built at %s, not the given revision %s", shortRevision(revision), params.Revision))
+	}
+	if info.Modified {
+		result.Warnings = append(result.Warnings, "the binary was built from a modified tree: no commit has its exact source")
+	}
+	if params.RepoRoot == "" || revision == "" {
+		return result, nil
+	}
+	check, err := CheckHead(ctx, params.RepoRoot, revision, prof)
+	if err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("HEAD check: %v", err))
+		return result, nil
+	}
+	result.Head = &check
+	if check.Warning != "" {
+		result.Warnings = append(result.Warnings, check.Warning)
+	}
+	return result, nil
+}
@@ -0,0 +1,78 @@
+package binaries
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/require"
+
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+)
+
+func TestInspectBuild(t *testing.T) {
+	ctx := context.Background()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	repoRoot := t.TempDir()
+	git := func(args ...string) string {
+		out, err := run(ctx, cmdrun.Git, repoRoot, "git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		require.NoError(t, err)
+		return strings.TrimSpace(out)
+	}
+	write := func(file, content string) {
+		path := filepath.Join(repoRoot, filepath.FromSlash(file))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	git("init", "-q")
+	write("main.go", "package main\n")
+	write("pkg/api/handler.go", "package api\n")
+	git("add", ".")
+	git("commit", "-qm", "profiled")
+	revision := git("rev-parse", "HEAD")
+
+	binary, ids := testBinary(t, t.TempDir(), "be-ledger")
+	params := BuildInfoParams{Params: Params{Target: Target{Revision: revision[:7]}, RepoRoot: repoRoot}, Binary: binary}
+	result, err := InspectBuild(ctx, params)
+	require.NoError(t, err)
+	require.Equal(t, BuildInfoSource{Binary: binary, From: "binary"}, result.Source)
+	require.True(t, strings.HasPrefix(result.BuildInfo.GoVersion, "go"))
+	require.Equal(t, ids, result.BuildInfo.IDs)
+	require.NotEmpty(t, result.BuildInfo.Settings["GOARCH"])
+	require.Equal(t, &HeadCheck{RepoRoot: repoRoot, Head: revision, Revision: revision, Match: true, Known: true}, result.Head)
+
+	// A later commit touching a sampled file is flagged; other changes are not.
+	write("pkg/api/handler.go", "package api\n\nfunc Handle() {}\n")
+	write("tools/gen.go", "package tools\n")
+	git("add", ".")
+	git("commit", "-qm", "later")
+	profilePath := filepath.Join(t.TempDir(), "cpu.pprof")
+	file, err := os.Create(profilePath)
+	require.NoError(t, err)
+	require.NoError(t, (&profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		Function:   []*profile.Function{{ID: 1, Name: "example.com/app/pkg/api.Handle", Filename: "/build/src/pkg/api/handler.go"}},
+	}).Write(file))
+	require.NoError(t, file.Close())
+	params.Profile = profilePath
+	result, err = InspectBuild(ctx, params)
+	require.NoError(t, err)
+	require.False(t, result.Head.Match)
+	require.Equal(t, 1, result.Head.Ahead)
+	require.Equal(t, []string{"pkg/api/handler.go", "tools/gen.go"}, result.Head.ChangedFiles)
+	require.Equal(t, []string{"pkg/api/handler.go"}, result.Head.ProfiledFiles)
+	require.Contains(t, result.Warnings, result.Head.Warning)
+
+	// A revision the clone lacks cannot be compared.
+	params.Revision = "0123456789abcdef0123456789abcdef01234567"
+	result, err = InspectBuild(ctx, params)
+	require.NoError(t, err)
+	require.False(t, result.Head.Known)
+	require.Contains(t, result.Head.Warning, "not in the local clone")
+}
@@ -0,0 +1,177 @@
+package binaries
+
+import (
+	"bytes"
+	"context"
+	"debug/buildinfo"
+	"debug/elf"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+)
+
+// Target is what a profile records about the binary it was taken from,
+// plus what the caller knows about its build.
+type Target struct {
+	// BuildID is the main mapping's build ID: a GNU build ID in hex, or a
+	// Go build ID. Empty for most Go binaries, which carry no GNU note.
+	BuildID  string `json:"build_id,omitempty"`
+	File     string `json:"file,omitempty"`   // main mapping path, as in the container
+	Binary   string `json:"binary,omitempty"` // base name of File, or the service's binary
+	Revision string `json:"revision,omitempty"`
+	Service  string `json:"service,omitempty"`
+	// Symbolized is set when every location in the main mapping (or in no
+	// mapping) already has function and line info, so the binary would add
+	// nothing.
+	Symbolized bool `json:"symbolized"`
+}
+
+// ProfileTarget reads the main mapping of the profile at path.
+func ProfileTarget(path string) (Target, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Target{}, err
+	}
+	defer file.Close()
+	prof, err := profile.Parse(file)
+	if err != nil {
+		return Target{}, err
+	}
+	return TargetFromProfile(prof), nil
+}
+
+// TargetFromProfile reads the main mapping of prof: the first one backed by
+// a file, which pprof places first.
+func TargetFromProfile(prof *profile.Profile) Target {
+	target := Target{Symbolized: true}
+	var main *profile.Mapping
+	for _, mapping := range prof.Mapping {
+		if mapping == nil || mapping.File == "" || strings.HasPrefix(mapping.File, "[") {
+			continue
+		}
+		main = mapping
+		target.File = mapping.File
+		target.Binary = filepath.Base(mapping.File)
+		target.BuildID = mapping.BuildID
+		break
+	}
+	// Only raw addresses the main binary could name count: a binary does
+	// nothing for [vdso] or shared library frames.
+	for _, loc := range prof.Location {
+		if loc.Address != 0 && len(loc.Line) == 0 && (loc.Mapping == nil || loc.Mapping == main) {
+			target.Symbolized = false
+			break
+		}
+	}
+	return target
+}
+
+// IDs identify a binary on disk.
+type IDs struct {
+	GoBuildID  string `json:"go_build_id,omitempty"`
+	GNUBuildID string `json:"gnu_build_id,omitempty"`
+	Revision   string `json:"revision,omitempty"` // vcs.revision from the Go build info
+	Modified   bool   `json:"modified,omitempty"` // built from a dirty tree
+}
+
+// ReadIDs reads the build IDs and VCS revision of the binary at path. ELF
+// notes are read directly; other formats fall back to go tool buildid.
+func ReadIDs(ctx context.Context, path string) IDs {
+	var ids IDs
+	if file, err := elf.Open(path); err == nil {
+		ids.GoBuildID = elfNote(file, ".note.go.buildid", "Go\x00\x00", 4, func(desc []byte) string { return string(desc) })
+		ids.GNUBuildID = elfNote(file, ".note.gnu.build-id", "GNU\x00", 3, hex.EncodeToString)
+		file.Close()
+	} else if output, err := cmdrun.Output(ctx, cmdrun.Go, "go", "tool", "buildid", path); err == nil {
+		ids.GoBuildID = strings.TrimSpace(string(output))
+	}
+	if info, err := buildinfo.ReadFile(path); err == nil {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				ids.Revision = setting.Value
+			case "vcs.modified":
+				ids.Modified = setting.Value == "true"
+			}
+		}
+	}
+	return ids
+}
+
+// elfNote decodes the descriptor of the note named name with type noteType
+// in section, or returns "" when there is none.
+func elfNote(file *elf.File, section, name string, noteType uint32, decode func([]byte) string) string {
+	sec := file.Section(section)
+	if sec == nil {
+		return ""
+	}
+	data, err := sec.Data()
+	if err != nil {
+		return ""
+	}
+	order := file.ByteOrder
+	for len(data) >= 12 {
+		nameSize, descSize, kind := order.Uint32(data), order.Uint32(data[4:]), order.Uint32(data[8:])
+		nameEnd := 12 + uint64(align4(nameSize))
+		descEnd := nameEnd + uint64(align4(descSize))
+		if uint64(len(data)) < nameEnd+uint64(descSize) {
+			return ""
+		}
+		noteName := strings.TrimRight(string(data[12:12+nameSize]), "\x00")
+		if kind == noteType && noteName == strings.TrimRight(name, "\x00") {
+			return decode(bytes.TrimRight(data[nameEnd:nameEnd+uint64(descSize)], "\x00"))
+		}
+		if uint64(len(data)) <= descEnd {
+			return ""
+		}
+		data = data[descEnd:]
+	}
+	return ""
+}
+
+func align4(n uint32) uint32 {
+	return (n + 3) &^ 3
+}
+
+// matches checks a binary against the target. Build IDs decide when the
+// profile has one; else the VCS revision does (a short revision matches
+// its full form). ok is false on a mismatch; verified is set when an ID
+// or revision actually matched.
+func (t Target) matches(ids IDs) (ok, verified bool, detail string) {
+	if t.BuildID != "" {
+		if t.BuildID == ids.GNUBuildID || t.BuildID == ids.GoBuildID {
+			return true, true, "build ID matches"
+		}
+		if ids.GNUBuildID == "" && ids.GoBuildID == "" {
+			return true, false, "binary has no build ID to compare"
+		}
+		return false, false, "build ID " + firstNonEmpty(ids.GNUBuildID, ids.GoBuildID) + " does not match the profile's " + t.BuildID
+	}
+	if t.Revision != "" && ids.Revision != "" {
+		if strings.HasPrefix(ids.Revision, t.Revision) || strings.HasPrefix(t.Revision, ids.Revision) {
+			if ids.Modified {
+				return true, false, "revision matches but the binary was built from a modified tree"
+			}
+			return true, true, "revision matches"
+		}
+		return false, false, "built at revision " + ids.Revision + ", not " + t.Revision
+	}
+	if t.Revision != "" {
+		return true, false, "binary records no VCS revision to compare"
+	}
+	return true, false, "nothing to verify: the profile has no build ID and no revision was given"
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,571 @@
+// Package binaries finds the binary a profile was recorded from, so pprof
+// can symbolize its addresses and list/peek can show source and assembly.
+package binaries
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+	"github.com/arreyder/pprof-mcp/internal/services"
+	"github.com/arreyder/pprof-mcp/internal/tempfiles"
+)
+
+// Strategies, in the order Resolve tries them by default.
+const (
+	StrategyCache    = "cache"    // the local binary cache, by build ID or revision
+	StrategyRepo     = "repo"     // binaries already built in the repo, where repo.services.discover expects them
+	StrategyArtifact = "artifact" // download from an artifact store URL template
+	StrategyImage    = "image"    // copy out of the service's container image
+	StrategyBuild    = "build"    // go build at the profiled revision in a temporary git worktree
+)
+
+// DefaultStrategies are tried when none are given. Building is opt-in: it
+// is slow and only reproduces the deployed binary when the toolchain and
+// flags match.
+var DefaultStrategies = []string{StrategyCache, StrategyRepo, StrategyArtifact, StrategyImage}
+
+// AllStrategies lists every strategy.
+var AllStrategies = []string{StrategyCache, StrategyRepo, StrategyArtifact, StrategyImage, StrategyBuild}
+
+// Attempt statuses.
+const (
+	StatusFound    = "found"
+	StatusMismatch = "mismatch" // a binary was found but is not the profiled one
+	StatusMissing  = "missing"
+	StatusSkipped  = "skipped" // the strategy lacks what it needs (repo root, revision, template)
+	StatusFailed   = "failed"
+)
+
+// Params says where to look. ArtifactURL and Image are templates that may
+// use {service}, {binary}, {revision}, and {build_id}.
+type Params struct {
+	Target
+	RepoRoot    string
+	Strategies  []string
+	CacheDir    string // default: pprof-mcp/binaries under the user cache directory
+	ArtifactURL string // e.g. https://artifacts.example.com/{service}/{revision}/{binary}
+	Image       string // e.g. registry.example.com/{service}:{revision}
+}
+
+// Result is the resolved binary, or why none was found.
+type Result struct {
+	Target   Target    `json:"target"`
+	Binary   string    `json:"binary,omitempty"`
+	Strategy string    `json:"strategy,omitempty"`
+	Verified bool      `json:"verified"` // a build ID or revision matched
+	IDs      *IDs      `json:"ids,omitempty"`
+	Attempts []Attempt `json:"attempts"`
+	Warnings []string  `json:"warnings,omitempty"`
+}
+
+// Attempt is what one strategy found.
+type Attempt struct {
+	Strategy string `json:"strategy"`
+	Status   string `json:"status"`
+	Source   string `json:"source,omitempty"` // path, URL, image, or package tried
+	Detail   string `json:"detail,omitempty"`
+}
+
+// DefaultCacheDir is where resolved binaries are kept.
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "pprof-mcp", "binaries")
+}
+
+// Resolve tries each strategy in turn and returns the first binary that
+// matches the target; binaries fetched or built are kept in the cache. Not
+// finding one is not an error: the attempts say why.
+func Resolve(ctx context.Context, params Params) (Result, error) {
+	r, err := newResolver(params)
+	if err != nil {
+		return Result{}, err
+	}
+	result := Result{Target: r.target, Attempts: []Attempt{}}
+	for _, strategy := range r.strategies {
+		var attempts []Attempt
+		var path string
+		var ids IDs
+		var verified bool
+		switch strategy {
+		case StrategyCache:
+			path, ids, verified, attempts = r.fromCache(ctx)
+		case StrategyRepo:
+			path, ids, verified, attempts = r.fromRepo(ctx)
+		case StrategyArtifact:
+			path, ids, verified, attempts = r.fetched(ctx, strategy, r.fromArtifact)
+		case StrategyImage:
+			path, ids, verified, attempts = r.fetched(ctx, strategy, r.fromImage)
+		case StrategyBuild:
+			path, ids, verified, attempts = r.fetched(ctx, strategy, r.fromBuild)
+		}
+		result.Attempts = append(result.Attempts, attempts...)
+		if path == "" {
+			continue
+		}
+		result.Binary, result.Strategy, result.Verified, result.IDs = path, strategy, verified, &ids
+		if !verified {
+			result.Warnings = append(result.Warnings, "the binary could not be verified against the profile: pass revision (or use a profile with a build ID) so a stale binary is not used")
+		}
+		return result, nil
+	}
+	return result, nil
+}
+
+// Plan lists the commands Resolve would run, without running them.
+func Plan(params Params) ([]string, []string, error) {
+	r, err := newResolver(params)
+	if err != nil {
+		return nil, nil, err
+	}
+	var commands, notes []string
+	for _, strategy := range r.strategies {
+		switch strategy {
+		case StrategyCache:
+			notes = append(notes, "cache: look in "+strings.Join(r.cacheDirs(), ", "))
+		case StrategyRepo:
+			if r.repoRoot == "" {
+				notes = append(notes, "repo: skipped without repo_root")
+				continue
+			}
+			notes = append(notes, "repo: check built binaries of "+r.target.Binary+" under "+r.repoRoot)
+		case StrategyArtifact:
+			if r.artifactURL == "" {
+				notes = append(notes, "artifact: skipped without an artifact_url template")
+				continue
+			}
+			source, err := r.expand(r.artifactURL)
+			if err != nil {
+				notes = append(notes, "artifact: "+errString(err))
+				continue
+			}
+			commands = append(commands, cmdrun.Join("curl", "-fsSL", "-o", "<cache>/"+r.target.Binary, source))
+		case StrategyImage:
+			if r.image == "" {
+				notes = append(notes, "image: skipped without an image template")
+				continue
+			}
+			image, err := r.expand(r.image)
+			if err != nil || r.target.File == "" {
+				notes = append(notes, "image: "+firstNonEmpty(errString(err), "the profile names no binary path"))
+				continue
+			}
+			commands = append(commands,
+				cmdrun.Join("docker", "create", image),
+				cmdrun.Join("docker", "cp", "<container>:"+r.target.File, "<cache>/"+r.target.Binary),
+				cmdrun.Join("docker", "rm", "-f", "<container>"))
+		case StrategyBuild:
+			pkg, err := r.buildPackage()
+			if err != nil {
+				notes = append(notes, "build: "+errString(err))
+				continue
+			}
+			commands = append(commands,
+				cmdrun.Join("git", "-C", r.repoRoot, "worktree", "add", "--detach", "<worktree>", r.target.Revision),
+				"cd "+filepath.Join("<worktree>", pkg.moduleDir)+" && "+cmdrun.Join("go", "build", "-o", "<cache>/"+r.target.Binary, pkg.pattern),
+				cmdrun.Join("git", "-C", r.repoRoot, "worktree", "remove", "--force", "<worktree>"))
+		}
+	}
+	return commands, notes, nil
+}
+
+type resolver struct {
+	target      Target
+	repoRoot    string
+	strategies  []string
+	cacheDir    string
+	artifactURL string
+	image       string
+}
+
+func newResolver(params Params) (*resolver, error) {
+	r := &resolver{
+		target:      params.Target,
+		repoRoot:    params.RepoRoot,
+		cacheDir:    firstNonEmpty(params.CacheDir, DefaultCacheDir()),
+		artifactURL: params.ArtifactURL,
+		image:       params.Image,
+	}
+	if r.target.Binary == "" && r.target.File != "" {
+		r.target.Binary = filepath.Base(r.target.File)
+	}
+	if r.target.Binary == "" {
+		return nil, errors.New("the profile names no binary; pass binary_name")
+	}
+	strategies := params.Strategies
+	if len(strategies) == 0 {
+		strategies = DefaultStrategies
+	}
+	for _, strategy := range strategies {
+		if !isStrategy(strategy) {
+			return nil, fmt.Errorf("unknown strategy %q (want one of %s)", strategy, strings.Join(AllStrategies, ", "))
+		}
+	}
+	r.strategies = strategies
+	return r, nil
+}
+
+func isStrategy(name string) bool {
+	for _, strategy := range AllStrategies {
+		if name == strategy {
+			return true
+		}
+	}
+	return false
+}
+
+// check verifies a candidate binary against the target
+func (r *resolver) check(ctx context.Context, strategy, source, path string) (IDs, bool, Attempt) {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return IDs{}, false, Attempt{Strategy: strategy, Status: StatusMissing, Source: source}
+	}
+	ids := ReadIDs(ctx, path)
+	ok, verified, detail := r.target.matches(ids)
+	if !ok {
+		return ids, false, Attempt{Strategy: strategy, Status: StatusMismatch, Source: source, Detail: detail}
+	}
+	return ids, verified, Attempt{Strategy: strategy, Status: StatusFound, Source: source, Detail: detail}
+}
+
+// cacheDirs are the cache entries the target may be stored under
+func (r *resolver) cacheDirs() []string {
+	var dirs []string
+	if r.target.BuildID != "" {
+		dirs = append(dirs, filepath.Join(r.cacheDir, cacheKey(r.target.BuildID)))
+	}
+	if r.target.Revision != "" {
+		dirs = append(dirs, filepath.Join(r.cacheDir, "rev-"+cacheKey(r.target.Revision)))
+	}
+	return dirs
+}
+
+func (r *resolver) fromCache(ctx context.Context) (string, IDs, bool, []Attempt) {
+	dirs := r.cacheDirs()
+	if len(dirs) == 0 {
+		return "", IDs{}, false, []Attempt{{Strategy: StrategyCache, Status: StatusSkipped, Detail: "no build ID or revision to look up"}}
+	}
+	var attempts []Attempt
+	for _, dir := range dirs {
+		path := filepath.Join(dir, r.target.Binary)
+		// Revisions are cached under their full form; a short one matches
+		// by prefix.
+		if strings.HasPrefix(filepath.Base(dir), "rev-") {
+			if matches, _ := filepath.Glob(dir + "*"); len(matches) > 0 {
+				path = filepath.Join(matches[0], r.target.Binary)
+			}
+		}
+		ids, verified, attempt := r.check(ctx, StrategyCache, path, path)
+		attempts = append(attempts, attempt)
+		if attempt.Status == StatusFound {
+			return path, ids, verified, attempts
+		}
+	}
+	return "", IDs{}, false, attempts
+}
+
+func (r *resolver) fromRepo(ctx context.Context) (string, IDs, bool, []Attempt) {
+	if r.repoRoot == "" {
+		return "", IDs{}, false, []Attempt{{Strategy: StrategyRepo, Status: StatusSkipped, Detail: "no repo_root"}}
+	}
+	found, err := services.Discover(r.repoRoot)
+	if err != nil {
+		return "", IDs{}, false, []Attempt{{Strategy: StrategyRepo, Status: StatusFailed, Detail: err.Error()}}
+	}
+	var attempts []Attempt
+	for _, service := range found {
+		if service.Binary != r.target.Binary && (r.target.Service == "" || service.Service != r.target.Service) {
+			continue
+		}
+		for _, rel := range service.Binaries {
+			path := filepath.Join(r.repoRoot, rel)
+			ids, verified, attempt := r.check(ctx, StrategyRepo, rel, path)
+			if attempt.Status == StatusMissing {
+				continue
+			}
+			attempts = append(attempts, attempt)
+			if attempt.Status == StatusFound && verified {
+				return r.store(path, ids), ids, verified, attempts
+			}
+			if attempt.Status == StatusFound {
+				// An unverified local build may be from any commit; it is
+				// used, but not cached under the profile's IDs.
+				return path, ids, verified, attempts
+			}
+		}
+	}
+	if len(attempts) == 0 {
+		attempts = append(attempts, Attempt{Strategy: StrategyRepo, Status: StatusMissing, Detail: "no built " + r.target.Binary + " binary in the repo"})
+	}
+	return "", IDs{}, false, attempts
+}
+
+// fetched runs a strategy that produces a new file, checks it, and caches
+// it on success
+func (r *resolver) fetched(ctx context.Context, strategy string, fetch func(ctx context.Context, dest string) (string, error)) (string, IDs, bool, []Attempt) {
+	if r.cacheDir == "" {
+		return "", IDs{}, false, []Attempt{{Strategy: strategy, Status: StatusFailed, Detail: "no cache directory"}}
+	}
+	if err := os.MkdirAll(r.cacheDir, 0o755); err != nil {
+		return "", IDs{}, false, []Attempt{{Strategy: strategy, Status: StatusFailed, Detail: err.Error()}}
+	}
+	tmp, err := tempfiles.MkdirTemp(r.cacheDir, "fetch-")
+	if err != nil {
+		return "", IDs{}, false, []Attempt{{Strategy: strategy, Status: StatusFailed, Detail: err.Error()}}
+	}
+	defer tmp.Remove()
+	dest := filepath.Join(tmp.Path, r.target.Binary)
+	source, err := fetch(ctx, dest)
+	if errors.Is(err, errSkipped) {
+		return "", IDs{}, false, []Attempt{{Strategy: strategy, Status: StatusSkipped, Source: source, Detail: errString(err)}}
+	}
+	if err != nil {
+		return "", IDs{}, false, []Attempt{{Strategy: strategy, Status: StatusFailed, Source: source, Detail: err.Error()}}
+	}
+	ids, verified, attempt := r.check(ctx, strategy, source, dest)
+	if attempt.Status != StatusFound {
+		return "", IDs{}, false, []Attempt{attempt}
+	}
+	return r.store(dest, ids), ids, verified, []Attempt{attempt}
+}
+
+// errSkipped marks a strategy that lacks what it needs.
+var errSkipped = errors.New("skipped")
+
+func skipped(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", errSkipped, fmt.Sprintf(format, args...))
+}
+
+func (r *resolver) fromArtifact(ctx context.Context, dest string) (string, error) {
+	if r.artifactURL == "" {
+		return "", skipped("no artifact_url template")
+	}
+	source, err := r.expand(r.artifactURL)
+	if err != nil {
+		return "", skipped("%v", err)
+	}
+	parsed, err := url.Parse(source)
+	if err != nil {
+		return source, err
+	}
+	var body io.ReadCloser
+	switch parsed.Scheme {
+	case "file":
+		file, err := os.Open(parsed.Path)
+		if err != nil {
+			return source, err
+		}
+		body = file
+	case "http", "https":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+		if err != nil {
+			return source, err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return source, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return source, fmt.Errorf("GET %s: %s", source, resp.Status)
+		}
+		body = resp.Body
+	default:
+		return source, fmt.Errorf("unsupported artifact URL scheme %q (want http, https, or file)", parsed.Scheme)
+	}
+	defer body.Close()
+	return source, writeExecutable(dest, body)
+}
+
+func (r *resolver) fromImage(ctx context.Context, dest string) (string, error) {
+	if r.image == "" {
+		return "", skipped("no image template")
+	}
+	image, err := r.expand(r.image)
+	if err != nil {
+		return "", skipped("%v", err)
+	}
+	if r.target.File == "" {
+		return image, skipped("the profile names no binary path to copy out of the image")
+	}
+	output, err := run(ctx, cmdrun.Docker, "", "docker", "create", image)
+	if err != nil {
+		return image, err
+	}
+	container := strings.TrimSpace(output)
+	defer run(context.WithoutCancel(ctx), cmdrun.Docker, "", "docker", "rm", "-f", container)
+	if _, err := run(ctx, cmdrun.Docker, "", "docker", "cp", container+":"+r.target.File, dest); err != nil {
+		return image, err
+	}
+	return image + ":" + r.target.File, nil
+}
+
+// buildTarget is the main package to build
+type buildTarget struct {
+	moduleDir string // relative to the repo root
+	pattern   string // ./path relative to moduleDir
+}
+
+func (r *resolver) buildPackage() (buildTarget, error) {
+	if r.repoRoot == "" {
+		return buildTarget{}, skipped("no repo_root")
+	}
+	if r.target.Revision == "" {
+		return buildTarget{}, skipped("no revision to build")
+	}
+	found, err := services.Discover(r.repoRoot)
+	if err != nil {
+		return buildTarget{}, err
+	}
+	for _, service := range found {
+		if service.Path == "" || service.Binary != r.target.Binary && (r.target.Service == "" || service.Service != r.target.Service) {
+			continue
+		}
+		moduleDir := service.Path
+		for moduleDir != "." {
+			if _, err := os.Stat(filepath.Join(r.repoRoot, moduleDir, "go.mod")); err == nil {
+				break
+			}
+			moduleDir = filepath.Dir(moduleDir)
+		}
+		rel, _ := filepath.Rel(moduleDir, service.Path)
+		return buildTarget{moduleDir: moduleDir, pattern: "./" + filepath.ToSlash(rel)}, nil
+	}
+	return buildTarget{}, skipped("no main package for %s in the repo", r.target.Binary)
+}
+
+func (r *resolver) fromBuild(ctx context.Context, dest string) (string, error) {
+	pkg, err := r.buildPackage()
+	if err != nil {
+		return "", err
+	}
+	source := pkg.pattern + "@" + r.target.Revision
+	worktree := filepath.Join(filepath.Dir(dest), "worktree")
+	if _, err := run(ctx, cmdrun.Git, "", "git", "-C", r.repoRoot, "worktree", "add", "--detach", worktree, r.target.Revision); err != nil {
+		return source, err
+	}
+	defer run(context.WithoutCancel(ctx), cmdrun.Git, "", "git", "-C", r.repoRoot, "worktree", "remove", "--force", worktree)
+	if _, err := run(ctx, cmdrun.Go, filepath.Join(worktree, pkg.moduleDir), "go", "build", "-o", dest, pkg.pattern); err != nil {
+		return source, err
+	}
+	return source, nil
+}
+
+// store copies a verified or fetched binary into the cache under each key
+// it can be looked up by, and returns the cached path
+func (r *resolver) store(path string, ids IDs) string {
+	var keys []string
+	for _, id := range []string{r.target.BuildID, ids.GNUBuildID, ids.GoBuildID} {
+		if id != "" {
+			keys = append(keys, cacheKey(id))
+		}
+	}
+	if revision := firstNonEmpty(ids.Revision, r.target.Revision); revision != "" && !ids.Modified {
+		keys = append(keys, "rev-"+cacheKey(revision))
+	}
+	stored := ""
+	seen := map[string]bool{}
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		dest := filepath.Join(r.cacheDir, key, r.target.Binary)
+		if dest == path {
+			return path
+		}
+		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+			continue
+		}
+		source := firstNonEmpty(stored, path)
+		if err := os.Link(source, dest); err != nil && !errors.Is(err, os.ErrExist) {
+			if err := copyFile(source, dest); err != nil {
+				continue
+			}
+		}
+		if stored == "" {
+			stored = dest
+		}
+	}
+	return firstNonEmpty(stored, path)
+}
+
+// expand fills a template's placeholders, failing on one without a value.
+func (r *resolver) expand(template string) (string, error) {
+	values := [][2]string{
+		{"{service}", firstNonEmpty(r.target.Service, r.target.Binary)},
+		{"{binary}", r.target.Binary},
+		{"{revision}", r.target.Revision},
+		{"{build_id}", r.target.BuildID},
+	}
+	expanded := template
+	for _, pair := range values {
+		placeholder, value := pair[0], pair[1]
+		if !strings.Contains(template, placeholder) {
+			continue
+		}
+		if value == "" {
+			return "", fmt.Errorf("template %q needs %s", template, placeholder)
+		}
+		expanded = strings.ReplaceAll(expanded, placeholder, value)
+	}
+	return expanded, nil
+}
+
+// cacheKey makes an ID safe as a directory name; Go build IDs contain
+// slashes
+func cacheKey(id string) string {
+	return strings.NewReplacer("/", "_", "\\", "_", ":", "_").Replace(id)
+}
+
+// run returns the command's stdout. Stderr, where docker reports pull
+// progress and git its warnings, only goes into the error.
+func run(ctx context.Context, kind, dir, name string, args ...string) (string, error) {
+	cmd, done := cmdrun.Command(ctx, kind, name, args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := done(cmd.Run()); err != nil {
+		return stdout.String(), fmt.Errorf("%s: %w: %s", cmdrun.Join(append([]string{name}, args...)...), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+func writeExecutable(dest string, body io.Reader) error {
+	file, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, body); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func copyFile(source, dest string) error {
+	file, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return writeExecutable(dest, file)
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return strings.TrimPrefix(err.Error(), errSkipped.Error()+": ")
+}
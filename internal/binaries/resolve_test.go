@@ -0,0 +1,151 @@
+package binaries
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/require"
+
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+)
+
+// testBinary copies the running test binary, a real Go executable with a
+// build ID, to dir/name.
+func testBinary(t *testing.T, dir, name string) (string, IDs) {
+	t.Helper()
+	self, err := os.Executable()
+	require.NoError(t, err)
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	require.NoError(t, copyFile(self, path))
+	ids := ReadIDs(context.Background(), path)
+	require.NotEmpty(t, ids.GoBuildID)
+	return path, ids
+}
+
+func TestTargetFromProfile(t *testing.T) {
+	mapping := &profile.Mapping{ID: 1, File: "/app/be-ledger", BuildID: "abc123"}
+	prof := &profile.Profile{
+		Mapping: []*profile.Mapping{{ID: 2, File: "[vdso]"}, mapping},
+		Location: []*profile.Location{
+			{ID: 1, Mapping: mapping, Address: 0x1000, Line: []profile.Line{{Function: &profile.Function{Name: "main.main"}}}},
+			{ID: 2, Mapping: mapping, Address: 0x2000},
+		},
+	}
+	require.Equal(t, Target{BuildID: "abc123", File: "/app/be-ledger", Binary: "be-ledger"}, TargetFromProfile(prof))
+
+	// Raw addresses only in [vdso] need no binary.
+	prof.Location[1].Mapping = prof.Mapping[0]
+	require.True(t, TargetFromProfile(prof).Symbolized)
+}
+
+func TestResolve(t *testing.T) {
+	ctx := context.Background()
+	repoRoot := t.TempDir()
+	cacheDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(repoRoot, "cmd", "be-ledger"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(repoRoot, "go.mod"), []byte("module example.com/mono\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(repoRoot, "cmd", "be-ledger", "main.go"), []byte("package main\n\nfunc main() {}\n"), 0o644))
+	local, ids := testBinary(t, filepath.Join(repoRoot, "bin"), "be-ledger")
+
+	// A local build with another build ID is not the profiled binary.
+	result, err := Resolve(ctx, Params{Target: Target{Binary: "be-ledger", BuildID: "deadbeef"}, RepoRoot: repoRoot, CacheDir: cacheDir, Strategies: []string{StrategyRepo}})
+	require.NoError(t, err)
+	require.Empty(t, result.Binary)
+	require.Equal(t, StatusMismatch, result.Attempts[0].Status)
+
+	// Without IDs to compare, it is used but flagged.
+	result, err = Resolve(ctx, Params{Target: Target{File: "/app/be-ledger"}, RepoRoot: repoRoot, CacheDir: cacheDir})
+	require.NoError(t, err)
+	require.Equal(t, local, result.Binary)
+	require.False(t, result.Verified)
+	require.NotEmpty(t, result.Warnings)
+
+	// A matching build ID verifies it, and it is cached for next time.
+	target := Target{Binary: "be-ledger", BuildID: ids.GoBuildID}
+	result, err = Resolve(ctx, Params{Target: target, RepoRoot: repoRoot, CacheDir: cacheDir})
+	require.NoError(t, err)
+	require.True(t, result.Verified)
+	require.Equal(t, StrategyRepo, result.Strategy)
+	require.Equal(t, filepath.Join(cacheDir, cacheKey(ids.GoBuildID), "be-ledger"), result.Binary)
+
+	result, err = Resolve(ctx, Params{Target: target, CacheDir: cacheDir})
+	require.NoError(t, err)
+	require.Equal(t, StrategyCache, result.Strategy)
+	require.True(t, result.Verified)
+}
+
+func TestResolveArtifact(t *testing.T) {
+	store := t.TempDir()
+	_, ids := testBinary(t, filepath.Join(store, "be-search"), "be-search")
+	cacheDir := t.TempDir()
+
+	params := Params{
+		Target:      Target{Binary: "be-search", BuildID: ids.GoBuildID},
+		CacheDir:    cacheDir,
+		ArtifactURL: "file://" + store + "/{service}/{binary}",
+	}
+	result, err := Resolve(context.Background(), params)
+	require.NoError(t, err)
+	require.Equal(t, StrategyArtifact, result.Strategy)
+	require.True(t, result.Verified)
+	require.FileExists(t, result.Binary)
+	require.Equal(t, []Attempt{
+		{Strategy: StrategyCache, Status: StatusMissing, Source: filepath.Join(cacheDir, cacheKey(ids.GoBuildID), "be-search")},
+		{Strategy: StrategyRepo, Status: StatusSkipped, Detail: "no repo_root"},
+		{Strategy: StrategyArtifact, Status: StatusFound, Source: "file://" + store + "/be-search/be-search", Detail: "build ID matches"},
+	}, result.Attempts)
+
+	// The image template needs a revision the target lacks.
+	params.ArtifactURL = ""
+	params.Image = "registry.example.com/{service}:{revision}"
+	params.CacheDir = t.TempDir()
+	result, err = Resolve(context.Background(), params)
+	require.NoError(t, err)
+	require.Empty(t, result.Binary)
+	require.Equal(t, Attempt{Strategy: StrategyImage, Status: StatusSkipped, Detail: `template "registry.example.com/{service}:{revision}" needs {revision}`}, result.Attempts[len(result.Attempts)-1])
+}
+
+func TestRunReturnsStdoutOnly(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	ctx := context.Background()
+	out, err := run(ctx, cmdrun.Docker, "", "sh", "-c", "echo pulling >&2; echo container-id")
+	require.NoError(t, err)
+	require.Equal(t, "container-id\n", out)
+
+	_, err = run(ctx, cmdrun.Docker, "", "sh", "-c", "echo no such image >&2; exit 1")
+	require.ErrorContains(t, err, "no such image")
+}
+
+func TestPlan(t *testing.T) {
+	repoRoot := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(repoRoot, "workers", "cmd", "indexer"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(repoRoot, "workers", "go.mod"), []byte("module example.com/workers\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(repoRoot, "workers", "cmd", "indexer", "main.go"), []byte("package main\n"), 0o644))
+
+	commands, notes, err := Plan(Params{
+		Target:     Target{File: "/indexer", Revision: "0a1b2c3"},
+		RepoRoot:   repoRoot,
+		Strategies: []string{StrategyImage, StrategyBuild},
+		Image:      "registry.example.com/{binary}:{revision}",
+	})
+	require.NoError(t, err)
+	require.Empty(t, notes)
+	require.Equal(t, []string{
+		"docker create registry.example.com/indexer:0a1b2c3",
+		"docker cp <container>:/indexer <cache>/indexer",
+		"docker rm -f <container>",
+		"git -C " + repoRoot + " worktree add --detach <worktree> 0a1b2c3",
+		"cd " + filepath.Join("<worktree>", "workers") + " && go build -o <cache>/indexer ./cmd/indexer",
+		"git -C " + repoRoot + " worktree remove --force <worktree>",
+	}, commands)
+
+	_, _, err = Plan(Params{Strategies: []string{"nfs"}, Target: Target{Binary: "x"}})
+	require.ErrorContains(t, err, `unknown strategy "nfs"`)
+}
@@ -0,0 +1,251 @@
+// Package cmdrun runs the external commands behind the analyses (go tool
+// pprof, go, kubectl, git, tilt, docker) under a per-operation deadline and
+// records how long each one took.
+package cmdrun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Operation kinds. Each has its own timeout.
+const (
+	Pprof   = "pprof"   // go tool pprof
+	Go      = "go"      // go build, test, vet, mod download, tool buildid
+	Kubectl = "kubectl" // one kubectl request; port-forwards are not bounded, exec fetches get ?seconds= on top
+	Git     = "git"
+	Tilt    = "tilt"
+	Docker  = "docker"
+	Shell   = "shell" // user-supplied deploy and load commands
+)
+
+// defaultTimeouts apply when neither PPROF_MCP_COMMAND_TIMEOUTS nor the
+// config file sets a kind. Zero leaves only the caller's deadline.
+var defaultTimeouts = map[string]time.Duration{
+	Pprof:   3 * time.Minute,
+	Go:      10 * time.Minute,
+	Kubectl: 2 * time.Minute,
+	Git:     time.Minute,
+	Tilt:    30 * time.Second,
+	Docker:  5 * time.Minute,
+	Shell:   0,
+}
+
+// waitDelay is how long a killed command's inherited pipes may stay open.
+const waitDelay = time.Second
+
+var (
+	envOnce     sync.Once
+	envTimeouts map[string]time.Duration
+	configured  atomic.Pointer[map[string]time.Duration]
+)
+
+// SetTimeouts installs the config file's per-kind timeouts in seconds
+// (timeouts.commands); 0 leaves only the caller's deadline.
+func SetTimeouts(seconds map[string]int) {
+	timeouts := make(map[string]time.Duration, len(seconds))
+	for kind, s := range seconds {
+		if s >= 0 {
+			timeouts[kind] = time.Duration(s) * time.Second
+		}
+	}
+	configured.Store(&timeouts)
+}
+
+// Timeout is the deadline for one operation of kind: PPROF_MCP_COMMAND_TIMEOUTS
+// ("kubectl=60,pprof=600", seconds) wins over the config file, which wins
+// over the defaults. Zero means no deadline of its own.
+func Timeout(kind string) time.Duration {
+	envOnce.Do(func() {
+		envTimeouts = parseTimeouts(os.Getenv("PPROF_MCP_COMMAND_TIMEOUTS"))
+	})
+	if timeout, ok := envTimeouts[kind]; ok {
+		return timeout
+	}
+	if cfg := configured.Load(); cfg != nil {
+		if timeout, ok := (*cfg)[kind]; ok {
+			return timeout
+		}
+	}
+	return defaultTimeouts[kind]
+}
+
+func parseTimeouts(raw string) map[string]time.Duration {
+	timeouts := map[string]time.Duration{}
+	for _, entry := range strings.Split(raw, ",") {
+		kind, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+		seconds, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || seconds < 0 {
+			continue
+		}
+		timeouts[strings.TrimSpace(kind)] = time.Duration(seconds) * time.Second
+	}
+	return timeouts
+}
+
+// TimeoutError reports a command killed by its kind's deadline rather than
+// by the caller's context. It unwraps to the command's own error.
+type TimeoutError struct {
+	Kind    string
+	Command string
+	Timeout time.Duration
+	Elapsed time.Duration
+	Err     error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s (%s limit %s; raise it with PPROF_MCP_COMMAND_TIMEOUTS=%s=<seconds>)",
+		e.Command, e.Elapsed.Round(time.Millisecond), e.Kind, e.Timeout, e.Kind)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+type expectKey struct{}
+
+// ExpectDuration marks the commands run under ctx as taking d by design, such
+// as a kubectl exec that fetches a CPU profile recorded for d. Their kind's
+// timeout counts from after d.
+func ExpectDuration(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, expectKey{}, d)
+}
+
+// Command is exec.CommandContext bounded by the timeout for kind. Call done
+// with the command's error once it has finished: it records the elapsed
+// time, releases the deadline, and turns a kill by that deadline into a
+// *TimeoutError.
+func Command(ctx context.Context, kind, name string, args ...string) (cmd *exec.Cmd, done func(error) error) {
+	timeout := Timeout(kind)
+	if expected, ok := ctx.Value(expectKey{}).(time.Duration); ok && timeout > 0 && expected > 0 {
+		timeout += expected
+	}
+	opCtx, cancel := ctx, context.CancelFunc(func() {})
+	if timeout > 0 {
+		opCtx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	cmd = exec.CommandContext(opCtx, name, args...)
+	// Children such as sh's or go tool pprof's inherit the output pipes; bound
+	// how long Wait blocks on them once the command itself is killed.
+	cmd.WaitDelay = waitDelay
+	start := time.Now()
+	return cmd, func(err error) error {
+		elapsed := time.Since(start)
+		timedOut := err != nil && errors.Is(opCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil
+		cancel()
+		label := commandLabel(name, args)
+		if log, ok := ctx.Value(logKey{}).(*Log); ok {
+			log.add(kind, label, elapsed, timedOut)
+		}
+		if timedOut {
+			return &TimeoutError{Kind: kind, Command: label, Timeout: timeout, Elapsed: elapsed, Err: err}
+		}
+		return err
+	}
+}
+
+// Run runs the command like exec.Cmd.Run under the timeout for kind.
+func Run(ctx context.Context, kind, name string, args ...string) error {
+	cmd, done := Command(ctx, kind, name, args...)
+	return done(cmd.Run())
+}
+
+// Output runs the command like exec.Cmd.Output under the timeout for kind.
+func Output(ctx context.Context, kind, name string, args ...string) ([]byte, error) {
+	cmd, done := Command(ctx, kind, name, args...)
+	output, err := cmd.Output()
+	return output, done(err)
+}
+
+var wordPattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// commandLabel names a command by its program and first two subcommand
+// words ("go tool pprof", "kubectl get pods"), leaving out paths, flags, and
+// flag values, which may be long or sensitive.
+func commandLabel(name string, args []string) string {
+	parts := []string{name}
+	for i := 0; i < len(args) && len(parts) < 3; i++ {
+		arg := args[i]
+		if strings.HasPrefix(arg, "-") {
+			if !strings.Contains(arg, "=") {
+				i++ // skip the flag's value
+			}
+			continue
+		}
+		if !wordPattern.MatchString(arg) {
+			break
+		}
+		parts = append(parts, arg)
+	}
+	return strings.Join(parts, " ")
+}
+
+type logKey struct{}
+
+// Log collects the commands run under a context, grouped by command.
+type Log struct {
+	mu      sync.Mutex
+	records map[string]*Record
+}
+
+// Record is the time spent running one command, summed over its runs.
+type Record struct {
+	Command   string `json:"command"`
+	Kind      string `json:"kind"`
+	Runs      int    `json:"runs"`
+	ElapsedMS int64  `json:"elapsed_ms"`
+	MaxMS     int64  `json:"max_ms"`
+	TimedOut  int    `json:"timed_out,omitempty"`
+}
+
+// WithLog returns a context whose commands are recorded in the returned Log.
+func WithLog(ctx context.Context) (context.Context, *Log) {
+	log := &Log{records: map[string]*Record{}}
+	return context.WithValue(ctx, logKey{}, log), log
+}
+
+func (l *Log) add(kind, label string, elapsed time.Duration, timedOut bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	record, ok := l.records[label]
+	if !ok {
+		record = &Record{Command: label, Kind: kind}
+		l.records[label] = record
+	}
+	record.Runs++
+	record.ElapsedMS += elapsed.Milliseconds()
+	record.MaxMS = max(record.MaxMS, elapsed.Milliseconds())
+	if timedOut {
+		record.TimedOut++
+	}
+}
+
+// Records returns the commands run so far, slowest in total first.
+func (l *Log) Records() []Record {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	records := make([]Record, 0, len(l.records))
+	for _, record := range l.records {
+		records = append(records, *record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].ElapsedMS != records[j].ElapsedMS {
+			return records[i].ElapsedMS > records[j].ElapsedMS
+		}
+		return records[i].Command < records[j].Command
+	})
+	return records
+}
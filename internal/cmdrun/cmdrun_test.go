@@ -0,0 +1,85 @@
+package cmdrun
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func setTestTimeouts(t *testing.T, timeouts map[string]time.Duration) {
+	t.Helper()
+	previous := configured.Load()
+	configured.Store(&timeouts)
+	t.Cleanup(func() { configured.Store(previous) })
+}
+
+func TestCommandTimeout(t *testing.T) {
+	setTestTimeouts(t, map[string]time.Duration{Shell: 100 * time.Millisecond})
+	ctx, log := WithLog(context.Background())
+
+	start := time.Now()
+	_, err := Output(ctx, Shell, "sh", "-c", "sleep 5")
+	require.Less(t, time.Since(start), 4*time.Second)
+	var timeout *TimeoutError
+	require.ErrorAs(t, err, &timeout)
+	require.Equal(t, Shell, timeout.Kind)
+	require.Equal(t, "sh", timeout.Command)
+	require.GreaterOrEqual(t, timeout.Elapsed, 100*time.Millisecond)
+	require.Contains(t, err.Error(), "PPROF_MCP_COMMAND_TIMEOUTS=shell=<seconds>")
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	require.False(t, errors.Is(err, context.DeadlineExceeded))
+
+	// A deadline of the caller's own is not reported as the kind's.
+	callerCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = Output(callerCtx, Shell, "sh", "-c", "sleep 5")
+	require.Error(t, err)
+	require.False(t, errors.As(err, &timeout))
+
+	require.NoError(t, Run(ctx, Shell, "true"))
+	records := log.Records()
+	require.Len(t, records, 2)
+	require.Equal(t, "sh", records[0].Command)
+	require.Equal(t, 2, records[0].Runs)
+	require.Equal(t, 1, records[0].TimedOut)
+	require.Equal(t, "true", records[1].Command)
+}
+
+func TestExpectDurationExtendsTimeout(t *testing.T) {
+	setTestTimeouts(t, map[string]time.Duration{Shell: 100 * time.Millisecond})
+
+	ctx := ExpectDuration(context.Background(), 400*time.Millisecond)
+	require.NoError(t, Run(ctx, Shell, "sh", "-c", "sleep 0.3"))
+
+	_, err := Output(ctx, Shell, "sh", "-c", "sleep 5")
+	var timeout *TimeoutError
+	require.ErrorAs(t, err, &timeout)
+	require.Equal(t, 500*time.Millisecond, timeout.Timeout)
+}
+
+func TestTimeoutPrecedence(t *testing.T) {
+	setTestTimeouts(t, map[string]time.Duration{Git: 5 * time.Second, Shell: 0})
+	require.Equal(t, 5*time.Second, Timeout(Git))
+	require.Equal(t, time.Duration(0), Timeout(Shell))
+	require.Equal(t, defaultTimeouts[Kubectl], Timeout(Kubectl))
+
+	require.Equal(t, map[string]time.Duration{"kubectl": time.Minute, "shell": 0},
+		parseTimeouts(" kubectl=60, shell=0,git=-1,bad,pprof=x"))
+}
+
+func TestCommandLabel(t *testing.T) {
+	for args, want := range map[string][]string{
+		"go tool pprof":    {"go", "tool", "pprof", "-top", "-nodecount=20", "/tmp/cpu.pprof"},
+		"kubectl get pods": {"kubectl", "--context", "prod", "get", "pods", "-n", "default"},
+		"git stash list":   {"git", "-C", "/repo", "stash", "list"},
+		"go test":          {"go", "-C", "/repo", "test", "-covermode=set", "./..."},
+		"sh":               {"sh", "-c", "make deploy REF=main"},
+	} {
+		require.Equal(t, args, commandLabel(want[0], want[1:]))
+	}
+}
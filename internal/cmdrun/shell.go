@@ -0,0 +1,115 @@
+package cmdrun
+
+import (
+	"context"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// windows selects cmd.exe quoting and shell; tests set it to check both.
+var windows = runtime.GOOS == "windows"
+
+// Quote quotes s as one argument for the platform's shell, leaving it as is
+// when nothing in it needs quoting. POSIX shells get single quotes; on
+// Windows s is double-quoted with backslashes escaped the way
+// CommandLineToArgvW reads them, so paths such as C:\Users\me\cpu.pprof stay
+// unquoted.
+//
+// < and > are left bare so placeholders such as <pod> in dry-run commands
+// read as placeholders; real arguments rarely contain them.
+func Quote(s string) string {
+	if windows {
+		return quoteWindows(s)
+	}
+	if s == "" {
+		return "''"
+	}
+	if strings.ContainsAny(s, " \t\n\"'\\$&;|[]{}()*?`") {
+		return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+	}
+	return s
+}
+
+func quoteWindows(s string) string {
+	if s == "" {
+		return `""`
+	}
+	if !strings.ContainsAny(s, " \t\n\"&|^()") {
+		return s
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	slashes := 0
+	for _, r := range s {
+		switch r {
+		case '\\':
+			slashes++
+		case '"':
+			// Backslashes before a quote are escapes; double them so they
+			// stay literal, then escape the quote itself.
+			b.WriteString(strings.Repeat(`\`, slashes+1))
+			slashes = 0
+		default:
+			slashes = 0
+		}
+		b.WriteRune(r)
+	}
+	// The same holds for backslashes before the closing quote.
+	b.WriteString(strings.Repeat(`\`, slashes))
+	b.WriteByte('"')
+	return b.String()
+}
+
+// Join quotes each part and joins them with spaces, giving a command line to
+// paste into the platform's shell.
+func Join(parts ...string) string {
+	quoted := make([]string, len(parts))
+	for i, part := range parts {
+		quoted[i] = Quote(part)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// ShellArgs returns the program and arguments that run a command line in the
+// platform's shell: sh -c, or cmd /S /C on Windows.
+func ShellArgs(command string) (string, []string) {
+	if windows {
+		return "cmd", []string{"/S", "/C", command}
+	}
+	return "sh", []string{"-c", command}
+}
+
+// ShellLine is the command line ShellArgs runs, for display.
+func ShellLine(command string) string {
+	if windows {
+		return windowsShellLine(command)
+	}
+	return Join("sh", "-c", command)
+}
+
+// windowsShellLine passes command to cmd.exe verbatim: cmd.exe does not split
+// its command line the way CommandLineToArgvW does, so escaping the command
+// as an argument would corrupt its quotes. With /S, cmd.exe strips the outer
+// quotes and runs the rest unchanged.
+func windowsShellLine(command string) string {
+	return `cmd /S /C "` + command + `"`
+}
+
+// ShellCmd returns a command that runs a user-supplied command line through
+// the platform's shell, for callers that manage the process themselves.
+func ShellCmd(ctx context.Context, command string) *exec.Cmd {
+	name, args := ShellArgs(command)
+	cmd := exec.CommandContext(ctx, name, args...)
+	setShellCmdLine(cmd, command)
+	return cmd
+}
+
+// ShellCommand is Command for a command line run through the platform's
+// shell under the Shell timeout.
+func ShellCommand(ctx context.Context, command string) (*exec.Cmd, func(error) error) {
+	name, args := ShellArgs(command)
+	cmd, done := Command(ctx, Shell, name, args...)
+	setShellCmdLine(cmd, command)
+	return cmd, done
+}
@@ -0,0 +1,62 @@
+package cmdrun
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func setWindows(t *testing.T, value bool) {
+	t.Helper()
+	previous := windows
+	windows = value
+	t.Cleanup(func() { windows = previous })
+}
+
+func TestQuotePOSIX(t *testing.T) {
+	setWindows(t, false)
+	require.Equal(t, "''", Quote(""))
+	require.Equal(t, "/tmp/cpu.pprof", Quote("/tmp/cpu.pprof"))
+	require.Equal(t, "'my profiles/cpu.pprof'", Quote("my profiles/cpu.pprof"))
+	require.Equal(t, `'it'\''s'`, Quote("it's"))
+	require.Equal(t, "'-focus=.*Handler'", Quote("-focus=.*Handler"))
+	require.Equal(t, "go tool pprof -top 'a b'", Join("go", "tool", "pprof", "-top", "a b"))
+}
+
+func TestQuoteWindows(t *testing.T) {
+	setWindows(t, true)
+	require.Equal(t, `""`, Quote(""))
+	require.Equal(t, `C:\Users\me\cpu.pprof`, Quote(`C:\Users\me\cpu.pprof`))
+	require.Equal(t, `"C:\Program Files\Go\bin\go.exe"`, Quote(`C:\Program Files\Go\bin\go.exe`))
+	require.Equal(t, `"C:\my dir\\"`, Quote(`C:\my dir\`))
+	require.Equal(t, `"say \"hi\""`, Quote(`say "hi"`))
+	require.Equal(t, `"a\\\"b c"`, Quote(`a\"b c`))
+	require.Equal(t, `it's`, Quote("it's"))
+	require.Equal(t, `"a&b"`, Quote("a&b"))
+	require.Equal(t, `go tool pprof -top "a b"`, Join("go", "tool", "pprof", "-top", "a b"))
+}
+
+func TestShellArgs(t *testing.T) {
+	setWindows(t, false)
+	name, args := ShellArgs("make deploy REF=main")
+	require.Equal(t, "sh", name)
+	require.Equal(t, []string{"-c", "make deploy REF=main"}, args)
+	require.Equal(t, "sh -c 'make deploy REF=main'", ShellLine("make deploy REF=main"))
+
+	setWindows(t, true)
+	name, args = ShellArgs(`deploy.cmd "main"`)
+	require.Equal(t, "cmd", name)
+	require.Equal(t, []string{"/S", "/C", `deploy.cmd "main"`}, args)
+	require.Equal(t, `cmd /S /C "deploy.cmd "main""`, ShellLine(`deploy.cmd "main"`))
+}
+
+func TestShellCommand(t *testing.T) {
+	if windows {
+		t.Skip("runs sh")
+	}
+	cmd, done := ShellCommand(context.Background(), "echo $((1 + 2)) | tr 3 x")
+	output, err := cmd.Output()
+	require.NoError(t, done(err))
+	require.Equal(t, "x\n", string(output))
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package cmdrun
+
+import "os/exec"
+
+// setShellCmdLine leaves sh -c to the arguments exec passes.
+func setShellCmdLine(cmd *exec.Cmd, command string) {}
@@ -0,0 +1,15 @@
+package cmdrun
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setShellCmdLine hands cmd.exe the command line verbatim instead of letting
+// exec escape it as an argument.
+func setShellCmdLine(cmd *exec.Cmd, command string) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CmdLine = windowsShellLine(command)
+}
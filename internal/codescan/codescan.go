@@ -0,0 +1,175 @@
+// Package codescan walks a source tree the way git sees it and scans the
+// text files in it in parallel, for the features that search a repo's code.
+package codescan
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// DefaultMaxFileSize is the largest file scanned when Options leaves it
+// unset; generated and data files beyond it are rarely worth searching.
+const DefaultMaxFileSize = 2 << 20
+
+// binarySniffBytes is how much of a file is checked for a NUL byte, as git
+// and grep do, to tell binary files from text.
+const binarySniffBytes = 8000
+
+// Options select the files a scan reads.
+type Options struct {
+	// Include are base-name globs (path.Match syntax) such as "*.go"; empty
+	// includes every file.
+	Include []string
+	// MaxFileSize skips larger files; 0 means DefaultMaxFileSize.
+	MaxFileSize int64
+	// Workers is how many files are read at once; 0 means GOMAXPROCS.
+	Workers int
+}
+
+// File is a text file found by Scan.
+type File struct {
+	// Rel is the slash-separated path relative to the scan root.
+	Rel     string
+	Path    string
+	Content []byte
+}
+
+// Match is a line matching a pattern.
+type Match struct {
+	File string // slash-separated, relative to the scan root
+	Line int
+	Text string // the line without surrounding space
+}
+
+// Scan calls visit for every text file under root that opts include,
+// skipping .git, files and directories ignored by .gitignore files and
+// .git/info/exclude, binary files, and files over the size limit. visit is
+// called from several goroutines at once and in no particular order.
+func Scan(ctx context.Context, root string, opts Options, visit func(File)) error {
+	if _, err := os.Stat(root); err != nil {
+		return err
+	}
+	maxSize := opts.MaxFileSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxFileSize
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	files := make(chan File)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range files {
+				if ctx.Err() != nil {
+					continue
+				}
+				content, err := os.ReadFile(file.Path)
+				if err != nil || isBinary(content) {
+					continue
+				}
+				file.Content = content
+				visit(file)
+			}
+		}()
+	}
+
+	// stacks holds, per directory, the ignore files that apply in it.
+	var rootStack []*ignoreFile
+	for _, file := range []string{filepath.Join(root, ".git", "info", "exclude"), filepath.Join(root, ".gitignore")} {
+		if ignore := loadIgnoreFile(file, ""); ignore != nil {
+			rootStack = append(rootStack, ignore)
+		}
+	}
+	stacks := map[string][]*ignoreFile{"": rootStack}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			if p == root {
+				return err
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		parent := path.Dir(rel)
+		if parent == "." {
+			parent = ""
+		}
+		stack := stacks[parent]
+		if d.IsDir() {
+			if d.Name() == ".git" || ignored(stack, rel, true) {
+				return filepath.SkipDir
+			}
+			if ignore := loadIgnoreFile(filepath.Join(p, ".gitignore"), rel); ignore != nil {
+				stack = append(append([]*ignoreFile{}, stack...), ignore)
+			}
+			stacks[rel] = stack
+			return nil
+		}
+		if !d.Type().IsRegular() || !Included(opts.Include, d.Name()) || ignored(stack, rel, false) {
+			return nil
+		}
+		if info, err := d.Info(); err != nil || info.Size() > maxSize {
+			return nil
+		}
+		select {
+		case files <- File{Rel: rel, Path: p}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	close(files)
+	wg.Wait()
+	return err
+}
+
+// Grep returns the file's lines that re matches.
+func (f File) Grep(re *regexp.Regexp) []Match {
+	var matches []Match
+	for i, line := range strings.Split(string(f.Content), "\n") {
+		if re.MatchString(line) {
+			matches = append(matches, Match{File: f.Rel, Line: i + 1, Text: strings.TrimSpace(line)})
+		}
+	}
+	return matches
+}
+
+// Included reports whether a file's base name matches one of the globs, or
+// there are none.
+func Included(globs []string, name string) bool {
+	if len(globs) == 0 {
+		return true
+	}
+	for _, glob := range globs {
+		if ok, _ := path.Match(glob, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func isBinary(content []byte) bool {
+	if len(content) > binarySniffBytes {
+		content = content[:binarySniffBytes]
+	}
+	return bytes.IndexByte(content, 0) >= 0
+}
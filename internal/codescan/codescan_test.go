@@ -0,0 +1,109 @@
+package codescan
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScan(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		".gitignore":               "# build output\n/bin/\n*.gen.go\n!keep.gen.go\nlogs/\n",
+		".git/info/exclude":        "scratch.go\n",
+		".git/config":              "[core]\n",
+		"main.go":                  "package main\n",
+		"scratch.go":               "package main\n",
+		"bin/tool.go":              "package bin\n",
+		"api/api.gen.go":           "package api\n",
+		"api/keep.gen.go":          "package api\n",
+		"api/logs/debug.go":        "package logs\n",
+		"api/.gitignore":           "local_*.go\n!local_ok.go\n",
+		"api/local_test_data.go":   "package api\n",
+		"api/local_ok.go":          "package api\n",
+		"api/README.md":            "docs\n",
+		"vendor/x/codec/codec.go":  "package codec\n",
+		"assets/blob.go":           "package assets\x00binary",
+		"assets/huge.go":           "package assets\n" + strings.Repeat("// padding\n", 200),
+		"docs/nested/deep/doc.go":  "package deep\n",
+		"docs/nested/.gitignore":   "deep/\n",
+		"cmd/tool/tool.go":         "package main\n",
+		"cmd/tool/testdata/bin.go": "package testdata\n",
+	}
+	for file, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(file))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o644))
+	}
+
+	var mu sync.Mutex
+	var seen []string
+	err := Scan(context.Background(), root, Options{Include: []string{"*.go"}, MaxFileSize: 1000, Workers: 3}, func(f File) {
+		require.Equal(t, files[f.Rel], string(f.Content))
+		mu.Lock()
+		seen = append(seen, f.Rel)
+		mu.Unlock()
+	})
+	require.NoError(t, err)
+	sort.Strings(seen)
+	require.Equal(t, []string{
+		"api/keep.gen.go",
+		"api/local_ok.go",
+		"cmd/tool/testdata/bin.go",
+		"cmd/tool/tool.go",
+		"main.go",
+		"vendor/x/codec/codec.go",
+	}, seen)
+
+	require.Error(t, Scan(context.Background(), filepath.Join(root, "missing"), Options{}, func(File) {}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, Scan(ctx, root, Options{}, func(File) {}), context.Canceled)
+}
+
+func TestFileGrep(t *testing.T) {
+	f := File{Rel: "db/db.go", Content: []byte("package db\n\n\tdsn := \"file:x?_pragma=temp_store(MEMORY)\"\n")}
+	require.Equal(t, []Match{{File: "db/db.go", Line: 3, Text: `dsn := "file:x?_pragma=temp_store(MEMORY)"`}}, f.Grep(regexp.MustCompile(`temp_store`)))
+	require.Empty(t, f.Grep(regexp.MustCompile(`zstd`)))
+}
+
+func TestParseIgnoreLine(t *testing.T) {
+	for _, tc := range []struct {
+		line  string
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{line: "*.log", path: "a/b/c.log", want: true},
+		{line: "/build", path: "build", isDir: true, want: true},
+		{line: "/build", path: "src/build", isDir: true, want: false},
+		{line: "docs/*.md", path: "docs/a.md", want: true},
+		{line: "docs/*.md", path: "docs/x/a.md", want: false},
+		{line: "**/gen", path: "a/b/gen", isDir: true, want: true},
+		{line: "a/**/z.go", path: "a/z.go", want: true},
+		{line: "a/**/z.go", path: "a/b/c/z.go", want: true},
+		{line: "out/", path: "out", want: false},
+		{line: "out/", path: "out", isDir: true, want: true},
+		{line: "file[0-9].txt", path: "file7.txt", want: true},
+		{line: "file[!0-9].txt", path: "file7.txt", want: false},
+		{line: `\#hash`, path: "#hash", want: true},
+		{line: "trailing   ", path: "trailing", want: true},
+	} {
+		rule, ok := parseIgnoreLine(tc.line)
+		require.True(t, ok, tc.line)
+		got := !(rule.dirOnly && !tc.isDir) && rule.pattern.MatchString(tc.path)
+		require.Equal(t, tc.want, got, "%q vs %q", tc.line, tc.path)
+	}
+	for _, line := range []string{"", "   ", "# comment", "!"} {
+		_, ok := parseIgnoreLine(line)
+		require.False(t, ok, line)
+	}
+}
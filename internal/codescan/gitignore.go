@@ -0,0 +1,144 @@
+package codescan
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// ignoreRule is one .gitignore line, matched against paths relative to the
+// directory of the file it came from.
+type ignoreRule struct {
+	pattern *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreFile is the rules of one .gitignore (or .git/info/exclude), and the
+// slash-separated directory, relative to the scan root, they apply under.
+type ignoreFile struct {
+	dir   string
+	rules []ignoreRule
+}
+
+// loadIgnoreFile reads gitignore rules from file. A missing or unreadable
+// file has no rules.
+func loadIgnoreFile(file, dir string) *ignoreFile {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	ignore := &ignoreFile{dir: dir}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreLine(scanner.Text()); ok {
+			ignore.rules = append(ignore.rules, rule)
+		}
+	}
+	if len(ignore.rules) == 0 {
+		return nil
+	}
+	return ignore
+}
+
+// parseIgnoreLine compiles one gitignore line: blank lines and comments are
+// skipped, "!" negates, a trailing "/" matches only directories, and a
+// pattern with a slash before its end is anchored to the file's directory.
+func parseIgnoreLine(line string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, "\r")
+	// Trailing spaces are ignored unless escaped.
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+	var rule ignoreRule
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	var b strings.Builder
+	if anchored {
+		b.WriteString("^")
+	} else {
+		b.WriteString("^(?:.*/)?")
+	}
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case strings.HasPrefix(line[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(line[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '\\' && i+1 < len(line):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(line[i])))
+		case c == '[':
+			end := strings.IndexByte(line[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := line[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	pattern, err := regexp.Compile(b.String())
+	if err != nil {
+		return ignoreRule{}, false
+	}
+	rule.pattern = pattern
+	return rule, true
+}
+
+// ignored reports whether rel, a slash-separated path relative to the scan
+// root, is ignored by the stack of ignore files from the root down. Later
+// rules win, so a deeper .gitignore overrides its parents.
+func ignored(stack []*ignoreFile, rel string, isDir bool) bool {
+	result := false
+	for _, ignore := range stack {
+		local := rel
+		if ignore.dir != "" {
+			var ok bool
+			if local, ok = strings.CutPrefix(rel, ignore.dir+"/"); !ok {
+				continue
+			}
+		}
+		for _, rule := range ignore.rules {
+			if rule.dirOnly && !isDir {
+				continue
+			}
+			if rule.pattern.MatchString(local) {
+				result = !rule.negate
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,85 @@
+// Package completion supplies argument values shared by the MCP server's
+// completion/complete handler and profctl shell completion.
+package completion
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/datadog"
+	"github.com/arreyder/pprof-mcp/internal/services"
+)
+
+// FileCacheMaxAge bounds how stale the on-disk services cache may be before
+// completion ignores it.
+const FileCacheMaxAge = 24 * time.Hour
+
+// DatadogServices returns the Datadog services with profiling from the
+// in-process cache, falling back to the on-disk cache written by earlier
+// lookups.
+func DatadogServices(env string) []datadog.ServiceInfo {
+	return datadog.CachedServices(env, FileCacheMaxAge)
+}
+
+// Services returns service names from the Datadog services cache (filtered
+// by env prefix when set) and from cmd/ directories under repoRoot.
+func Services(env, repoRoot string) []string {
+	values := []string{}
+	for _, svc := range DatadogServices(env) {
+		values = append(values, svc.Name)
+	}
+	if repoRoot == "" {
+		repoRoot = "."
+	}
+	if discovered, err := services.DiscoverCmd(repoRoot); err == nil {
+		for _, svc := range discovered {
+			values = append(values, svc.Service)
+		}
+	}
+	return values
+}
+
+// Envs returns environments seen in the Datadog services cache.
+func Envs() []string {
+	values := []string{}
+	for _, svc := range DatadogServices("") {
+		values = append(values, svc.Environments...)
+	}
+	return values
+}
+
+// PickStrategies lists the datadog.profiles.pick strategies.
+func PickStrategies() []string {
+	return []string{
+		string(datadog.PickLatest),
+		string(datadog.PickOldest),
+		string(datadog.PickClosestToTS),
+		string(datadog.PickMostSamples),
+		string(datadog.PickManualIndex),
+		string(datadog.PickAnomalous),
+	}
+}
+
+// Filter drops empty values and duplicates, keeps values starting with prefix
+// (case-insensitively), and sorts the result.
+func Filter(candidates []string, prefix string) []string {
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	seen := map[string]struct{}{}
+	matches := []string{}
+	for _, value := range candidates {
+		if value == "" {
+			continue
+		}
+		if _, ok := seen[value]; ok {
+			continue
+		}
+		seen[value] = struct{}{}
+		if prefix != "" && !strings.HasPrefix(strings.ToLower(value), prefix) {
+			continue
+		}
+		matches = append(matches, value)
+	}
+	sort.Strings(matches)
+	return matches
+}
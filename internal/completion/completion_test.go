@@ -0,0 +1,31 @@
+package completion
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/arreyder/pprof-mcp/internal/datadog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter(t *testing.T) {
+	got := Filter([]string{"payments", "", "Payroll", "payments", "search"}, "PAY")
+	require.Equal(t, []string{"Payroll", "payments"}, got)
+}
+
+func TestServicesFromFileCacheAndRepo(t *testing.T) {
+	datadog.ClearServicesCache()
+	t.Setenv("PPROF_MCP_SERVICES_CACHE", filepath.Join(t.TempDir(), "services.json"))
+	require.NoError(t, datadog.WriteServicesCacheFile(datadog.ServicesCacheFilePath(), []datadog.ServiceInfo{
+		{Name: "checkout", Environments: []string{"prod", "staging"}},
+		{Name: "ledger", Environments: []string{"staging"}},
+	}))
+
+	repo := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(repo, "cmd", "be-indexer"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "cmd", "be-indexer", "main.go"), []byte("package main\n"), 0o644))
+
+	require.ElementsMatch(t, []string{"checkout", "indexer"}, Services("prod", repo))
+	require.ElementsMatch(t, []string{"prod", "staging"}, Filter(Envs(), ""))
+}
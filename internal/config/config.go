@@ -0,0 +1,376 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds defaults shared by the MCP server and profctl so the same
+// flags don't have to be repeated on every call. It is read from
+// ~/.config/pprof-mcp/config.yaml, or the file named by PPROF_MCP_CONFIG:
+//
+//	dd_site: datadoghq.eu
+//	repo_prefixes: [github.com/myorg/myrepo]
+//	trim_path: /src
+//	workspace: ~/profiles
+//	timeouts:
+//	  default: 300
+//	  tools:
+//	    pprof.discover: 900
+//	  commands:
+//	    kubectl: 60
+//	environments:
+//	  prod-eu:
+//	    env: prod
+//	    dd_site: datadoghq.eu
+//	    hours: 24
+//	credential_profile: eu
+//	credentials:
+//	  eu:
+//	    api_key_env: DD_API_KEY_EU
+//	    app_key_env: DD_APP_KEY_EU
+//	    dd_site: datadoghq.eu
+//	services:
+//	  be-ledger:
+//	    datadog: ledger-api
+//	    envs: [prod, staging]
+//	binaries:
+//	  strategies: [cache, repo, artifact, image]
+//	  artifact_url: https://artifacts.example.com/{service}/{revision}/{binary}
+//	  image: registry.example.com/{service}:{revision}
+//	teams:
+//	  payments: [github.com/myorg/myrepo/internal/payments]
+//	  platform: [github.com/myorg/myrepo/pkg, github.com/myorg/myrepo/cmd]
+//	patterns:
+//	  code:
+//	    - regex: 'bigcache\.New\('
+//	      category: Cache
+//	      severity: medium
+//	      explanation: bigcache preallocates every shard at startup
+//	      remediation: size shards from the cache's real working set
+//	  vendor:
+//	    - package: github.com/myorg/rpc
+//	      regex: '\(\*Client\)\.Dial'
+//	      severity: high
+//	      explanation: Dial opens a connection per call
+//	      remediation: keep one Client per process
+//
+// Explicit arguments and environment variables always win over the file.
+type Config struct {
+	DDSite       string                 `yaml:"dd_site"`
+	RepoPrefixes []string               `yaml:"repo_prefixes"`
+	TrimPath     string                 `yaml:"trim_path"`
+	Workspace    string                 `yaml:"workspace"`
+	Timeouts     Timeouts               `yaml:"timeouts"`
+	Environments map[string]Environment `yaml:"environments"`
+
+	CredentialProfile string                       `yaml:"credential_profile"`
+	Credentials       map[string]CredentialProfile `yaml:"credentials"`
+
+	// Services maps repo services (binary or service name, as
+	// repo.services.discover reports them) to their Datadog names.
+	Services map[string]ServiceMapping `yaml:"services"`
+
+	// Binaries configures how the binary behind a profile is found for
+	// symbolization.
+	Binaries Binaries `yaml:"binaries"`
+
+	// Teams maps team names to the import paths they own, each covering the
+	// packages below it. Reports grouped by team use it ahead of CODEOWNERS.
+	Teams map[string][]string `yaml:"teams"`
+
+	// Patterns add the org's own known foot-guns to the built-in ones
+	// memory_sanity and vendor_analyze look for.
+	Patterns PatternLibrary `yaml:"patterns"`
+
+	path string
+}
+
+// Timeouts are tool execution timeouts in seconds. Commands bounds each
+// external command by kind (pprof, go, kubectl, git, tilt, docker, shell);
+// 0 leaves only the tool's deadline.
+type Timeouts struct {
+	Default  int            `yaml:"default"`
+	Tools    map[string]int `yaml:"tools"`
+	Commands map[string]int `yaml:"commands"`
+}
+
+// Environment is a named preset. Passing its name as the env argument (or
+// --env flag) expands to the fields below.
+type Environment struct {
+	Env     string `yaml:"env"`
+	Service string `yaml:"service"`
+	DDSite  string `yaml:"dd_site"`
+	Hours   int    `yaml:"hours"`
+	Host    string `yaml:"host"`
+}
+
+// CredentialProfile names the environment variables holding a set of
+// Datadog keys, so keys never have to be written to the config file.
+type CredentialProfile struct {
+	APIKeyEnv string `yaml:"api_key_env"`
+	AppKeyEnv string `yaml:"app_key_env"`
+	DDSite    string `yaml:"dd_site"`
+}
+
+// ServiceMapping is the Datadog service a repo service reports as, and the
+// environments it runs in (default: every env Datadog has seen it in).
+type ServiceMapping struct {
+	Datadog string   `yaml:"datadog"`
+	Envs    []string `yaml:"envs"`
+}
+
+// Binaries are the binary resolution settings. ArtifactURL and Image are
+// templates over {service}, {binary}, {revision}, and {build_id}; the
+// strategies (cache, repo, artifact, image, build) are tried in order.
+type Binaries struct {
+	Strategies  []string `yaml:"strategies"`
+	CacheDir    string   `yaml:"cache_dir"`
+	ArtifactURL string   `yaml:"artifact_url"`
+	Image       string   `yaml:"image"`
+}
+
+// PatternLibrary holds the configured patterns: Code ones are searched for
+// in the repo by memory_sanity, Vendor ones match hot dependency functions
+// in vendor_analyze.
+type PatternLibrary struct {
+	Code   []Pattern `yaml:"code"`
+	Vendor []Pattern `yaml:"vendor"`
+}
+
+// Pattern is a known problem and what to do about it. Regexes use Go's
+// syntax. Code regexes match lines of Files (a glob, default *.go); vendor
+// regexes match function names in Package, or in any dependency when
+// Package is empty.
+type Pattern struct {
+	Regex       string `yaml:"regex"`
+	Category    string `yaml:"category"`
+	Severity    string `yaml:"severity"`
+	Explanation string `yaml:"explanation"`
+	Remediation string `yaml:"remediation"`
+	Package     string `yaml:"package"`
+	Files       string `yaml:"files"`
+}
+
+// Path returns the config file location: PPROF_MCP_CONFIG when set, else
+// pprof-mcp/config.yaml under the user config directory.
+func Path() string {
+	if file := strings.TrimSpace(os.Getenv("PPROF_MCP_CONFIG")); file != "" {
+		return ExpandHome(file)
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "pprof-mcp", "config.yaml")
+}
+
+// Load reads the config file. A missing file yields an empty config; a file
+// that exists but cannot be parsed is an error.
+func Load() (*Config, error) {
+	file := Path()
+	if file == "" {
+		return &Config{}, nil
+	}
+	cfg, err := LoadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Config{}, nil
+	}
+	return cfg, err
+}
+
+// LoadFile reads and parses the config at file.
+func LoadFile(file string) (*Config, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	cfg.path = file
+	return cfg, nil
+}
+
+// Parse decodes and validates a config document.
+func Parse(data []byte) (*Config, error) {
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse config: %w", err)
+	}
+	if cfg.Timeouts.Default < 0 {
+		return nil, fmt.Errorf("timeouts.default must be >= 0")
+	}
+	for tool, seconds := range cfg.Timeouts.Tools {
+		if seconds <= 0 {
+			return nil, fmt.Errorf("timeouts.tools.%s must be > 0", tool)
+		}
+	}
+	for kind, seconds := range cfg.Timeouts.Commands {
+		if seconds < 0 {
+			return nil, fmt.Errorf("timeouts.commands.%s must be >= 0", kind)
+		}
+	}
+	for name, preset := range cfg.Environments {
+		if preset.Hours < 0 {
+			return nil, fmt.Errorf("environments.%s.hours must be >= 0", name)
+		}
+	}
+	for name, mapping := range cfg.Services {
+		if strings.TrimSpace(mapping.Datadog) == "" {
+			return nil, fmt.Errorf("services.%s.datadog is required", name)
+		}
+	}
+	for team, packages := range cfg.Teams {
+		if len(packages) == 0 {
+			return nil, fmt.Errorf("teams.%s lists no packages", team)
+		}
+	}
+	for kind, patterns := range map[string][]Pattern{"code": cfg.Patterns.Code, "vendor": cfg.Patterns.Vendor} {
+		for i, pattern := range patterns {
+			if err := pattern.validate(); err != nil {
+				return nil, fmt.Errorf("patterns.%s[%d]: %w", kind, i, err)
+			}
+		}
+	}
+	if cfg.CredentialProfile != "" {
+		if _, ok := cfg.Credentials[cfg.CredentialProfile]; !ok {
+			return nil, fmt.Errorf("credential_profile %q is not defined under credentials", cfg.CredentialProfile)
+		}
+	}
+	cfg.Workspace = ExpandHome(strings.TrimSpace(cfg.Workspace))
+	cfg.Binaries.CacheDir = ExpandHome(strings.TrimSpace(cfg.Binaries.CacheDir))
+	return &cfg, nil
+}
+
+func (p Pattern) validate() error {
+	if strings.TrimSpace(p.Regex) == "" {
+		return fmt.Errorf("regex is required")
+	}
+	if _, err := regexp.Compile(p.Regex); err != nil {
+		return fmt.Errorf("regex: %w", err)
+	}
+	switch p.Severity {
+	case "", "low", "medium", "high":
+	default:
+		return fmt.Errorf("severity %q must be low, medium, or high", p.Severity)
+	}
+	if strings.TrimSpace(p.Explanation) == "" {
+		return fmt.Errorf("explanation is required")
+	}
+	return nil
+}
+
+// File returns the path the config was loaded from, or "" when no file was
+// found.
+func (c *Config) File() string {
+	if c == nil {
+		return ""
+	}
+	return c.path
+}
+
+// Preset returns the named environment preset.
+func (c *Config) Preset(name string) (Environment, bool) {
+	if c == nil || name == "" {
+		return Environment{}, false
+	}
+	preset, ok := c.Environments[name]
+	return preset, ok
+}
+
+// ActiveCredentials returns the selected credential profile.
+func (c *Config) ActiveCredentials() (CredentialProfile, bool) {
+	if c == nil || c.CredentialProfile == "" {
+		return CredentialProfile{}, false
+	}
+	profile, ok := c.Credentials[c.CredentialProfile]
+	return profile, ok
+}
+
+// exported records the values set by the last ApplyEnv, so a reloaded config
+// can replace them without overriding values set by the user.
+var exported = map[string]string{}
+
+// ApplyEnv exports config values that the Datadog client reads from the
+// environment (DD_SITE, and DD_API_KEY/DD_APP_KEY from the credential
+// profile), without overriding variables that are already set.
+func (c *Config) ApplyEnv() {
+	site, apiKey, appKey := "", "", ""
+	if c != nil {
+		site = c.DDSite
+	}
+	if profile, ok := c.ActiveCredentials(); ok {
+		if profile.DDSite != "" {
+			site = profile.DDSite
+		}
+		if profile.APIKeyEnv != "" {
+			apiKey = os.Getenv(profile.APIKeyEnv)
+		}
+		if profile.AppKeyEnv != "" {
+			appKey = os.Getenv(profile.AppKeyEnv)
+		}
+	}
+	exportEnv("DD_SITE", site)
+	exportEnv("DD_API_KEY", apiKey)
+	exportEnv("DD_APP_KEY", appKey)
+}
+
+func exportEnv(name, value string) {
+	current := strings.TrimSpace(os.Getenv(name))
+	if current != "" && current != exported[name] {
+		return
+	}
+	if value == "" {
+		if current != "" {
+			_ = os.Unsetenv(name)
+		}
+		delete(exported, name)
+		return
+	}
+	_ = os.Setenv(name, value)
+	exported[name] = value
+}
+
+// ServiceMapping returns the Datadog mapping of a repo service, looked up by
+// each of names in turn.
+func (c *Config) ServiceMapping(names ...string) (ServiceMapping, bool) {
+	if c == nil {
+		return ServiceMapping{}, false
+	}
+	for _, name := range names {
+		if mapping, ok := c.Services[name]; ok && name != "" {
+			return mapping, true
+		}
+	}
+	return ServiceMapping{}, false
+}
+
+// TrimPathOr returns the configured trim_path, or fallback when unset.
+func (c *Config) TrimPathOr(fallback string) string {
+	if c == nil || strings.TrimSpace(c.TrimPath) == "" {
+		return fallback
+	}
+	return c.TrimPath
+}
+
+// ExpandHome replaces a leading ~/ with the user's home directory. On Windows
+// ~\ works too.
+func ExpandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") && !strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
+}
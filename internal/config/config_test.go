@@ -0,0 +1,154 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	cfg, err := Parse([]byte(`
+dd_site: datadoghq.eu
+repo_prefixes: [github.com/acme/app]
+trim_path: /src
+timeouts:
+  default: 120
+  tools:
+    pprof.discover: 900
+environments:
+  prod-eu:
+    env: prod
+    dd_site: datadoghq.eu
+    hours: 24
+services:
+  be-ledger:
+    datadog: ledger-api
+    envs: [prod]
+teams:
+  ledger: [github.com/acme/app/ledger]
+patterns:
+  code:
+    - regex: 'bigcache\.New\('
+      category: Cache
+      severity: medium
+      explanation: preallocates every shard
+  vendor:
+    - package: github.com/acme/rpc
+      regex: Dial
+      explanation: dials per call
+      remediation: reuse the client
+`))
+	require.NoError(t, err)
+	require.Equal(t, "datadoghq.eu", cfg.DDSite)
+	require.Equal(t, []string{"github.com/acme/app"}, cfg.RepoPrefixes)
+	require.Equal(t, "/src", cfg.TrimPathOr("/xsrc"))
+	require.Equal(t, 900, cfg.Timeouts.Tools["pprof.discover"])
+
+	preset, ok := cfg.Preset("prod-eu")
+	require.True(t, ok)
+	require.Equal(t, "prod", preset.Env)
+	require.Equal(t, 24, preset.Hours)
+
+	_, ok = cfg.Preset("staging")
+	require.False(t, ok)
+
+	mapping, ok := cfg.ServiceMapping("ledger", "be-ledger")
+	require.True(t, ok)
+	require.Equal(t, ServiceMapping{Datadog: "ledger-api", Envs: []string{"prod"}}, mapping)
+	_, err = Parse([]byte("services:\n  be-ledger:\n    envs: [prod]\n"))
+	require.ErrorContains(t, err, "services.be-ledger.datadog is required")
+
+	require.Equal(t, map[string][]string{"ledger": {"github.com/acme/app/ledger"}}, cfg.Teams)
+	require.Equal(t, "Cache", cfg.Patterns.Code[0].Category)
+	require.Equal(t, Pattern{Package: "github.com/acme/rpc", Regex: "Dial", Explanation: "dials per call", Remediation: "reuse the client"}, cfg.Patterns.Vendor[0])
+	_, err = Parse([]byte("patterns:\n  code:\n    - regex: 'a('\n      explanation: x\n"))
+	require.ErrorContains(t, err, "patterns.code[0]: regex")
+	_, err = Parse([]byte("patterns:\n  vendor:\n    - regex: a\n      explanation: x\n      severity: urgent\n"))
+	require.ErrorContains(t, err, `patterns.vendor[0]: severity "urgent"`)
+
+	_, err = Parse([]byte("teams:\n  ledger: []\n"))
+	require.ErrorContains(t, err, "teams.ledger lists no packages")
+
+	_, err = Parse([]byte("timeouts:\n  tools:\n    pprof.top: 0\n"))
+	require.Error(t, err)
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	t.Setenv("PPROF_MCP_CONFIG", filepath.Join(t.TempDir(), "missing.yaml"))
+	cfg, err := Load()
+	require.NoError(t, err)
+	require.Equal(t, "", cfg.File())
+	require.Equal(t, "/xsrc", cfg.TrimPathOr("/xsrc"))
+}
+
+func TestLoadInvalidFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(file, []byte("dd_site: [unterminated"), 0o644))
+	t.Setenv("PPROF_MCP_CONFIG", file)
+	_, err := Load()
+	require.Error(t, err)
+}
+
+func TestSetAndUnset(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "pprof-mcp", "config.yaml")
+	require.NoError(t, Set(file, "dd_site", "datadoghq.eu"))
+	require.NoError(t, os.WriteFile(file, append([]byte("# team defaults\n"), mustRead(t, file)...), 0o644))
+
+	require.NoError(t, Set(file, "repo_prefixes", "github.com/acme/app, github.com/acme/lib"))
+	require.NoError(t, Set(file, "environments.prod-eu.hours", "24"))
+	require.NoError(t, Set(file, "dd_site", "datadoghq.com"))
+	require.Error(t, Set(file, "environments.prod-eu.hours", "soon"))
+	require.Error(t, Set(file, "dd_sight", "typo"))
+	require.Error(t, Set(file, "credential_profile", "missing"))
+
+	cfg, err := LoadFile(file)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"dd_site":                    "datadoghq.com",
+		"repo_prefixes":              "github.com/acme/app,github.com/acme/lib",
+		"environments.prod-eu.hours": "24",
+	}, cfg.Values())
+	require.Contains(t, string(mustRead(t, file)), "# team defaults")
+
+	require.NoError(t, Unset(file, "environments.prod-eu.hours"))
+	cfg, err = LoadFile(file)
+	require.NoError(t, err)
+	_, ok, err := cfg.Get("environments.prod-eu.hours")
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Empty(t, cfg.Environments)
+}
+
+func TestCredentialProfileApplyEnv(t *testing.T) {
+	t.Setenv("DD_API_KEY", "")
+	t.Setenv("DD_APP_KEY", "")
+	t.Setenv("DD_SITE", "")
+	t.Setenv("DD_API_KEY_EU", "api-eu")
+	t.Setenv("DD_APP_KEY_EU", "app-eu")
+	cfg, err := Parse([]byte(`
+credential_profile: eu
+credentials:
+  eu:
+    api_key_env: DD_API_KEY_EU
+    app_key_env: DD_APP_KEY_EU
+    dd_site: datadoghq.eu
+`))
+	require.NoError(t, err)
+	cfg.ApplyEnv()
+	require.Equal(t, "api-eu", os.Getenv("DD_API_KEY"))
+	require.Equal(t, "app-eu", os.Getenv("DD_APP_KEY"))
+	require.Equal(t, "datadoghq.eu", os.Getenv("DD_SITE"))
+
+	(&Config{}).ApplyEnv()
+	require.Equal(t, "", os.Getenv("DD_API_KEY"))
+	require.Equal(t, "", os.Getenv("DD_SITE"))
+}
+
+func mustRead(t *testing.T, file string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	return data
+}
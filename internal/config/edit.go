@@ -0,0 +1,281 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Keys lists the settable keys. "<name>" and "<tool>" segments stand for any
+// preset, credential profile, repo service, or tool name.
+var Keys = []string{
+	"dd_site",
+	"workspace",
+	"trim_path",
+	"repo_prefixes",
+	"credential_profile",
+	"timeouts.default",
+	"timeouts.tools.<tool>",
+	"environments.<name>.env",
+	"environments.<name>.service",
+	"environments.<name>.dd_site",
+	"environments.<name>.hours",
+	"environments.<name>.host",
+	"credentials.<name>.api_key_env",
+	"credentials.<name>.app_key_env",
+	"credentials.<name>.dd_site",
+	"services.<name>.datadog",
+	"services.<name>.envs",
+	"binaries.strategies",
+	"binaries.cache_dir",
+	"binaries.artifact_url",
+	"binaries.image",
+	"teams.<name>",
+}
+
+// keyKind reports how a key's value is encoded: "string", "int", or "list".
+func keyKind(key string) (string, error) {
+	parts := strings.Split(key, ".")
+	for _, pattern := range Keys {
+		patternParts := strings.Split(pattern, ".")
+		if len(patternParts) != len(parts) {
+			continue
+		}
+		match := true
+		for i, part := range patternParts {
+			if part != parts[i] && !(strings.HasPrefix(part, "<") && parts[i] != "") {
+				match = false
+				break
+			}
+		}
+		if !match {
+			continue
+		}
+		switch {
+		case key == "repo_prefixes", key == "binaries.strategies", strings.HasPrefix(key, "services.") && strings.HasSuffix(key, ".envs"), strings.HasPrefix(key, "teams."):
+			return "list", nil
+		case strings.HasPrefix(key, "timeouts."), strings.HasSuffix(key, ".hours"):
+			return "int", nil
+		default:
+			return "string", nil
+		}
+	}
+	return "", fmt.Errorf("unknown config key %q (known keys: %s)", key, strings.Join(Keys, ", "))
+}
+
+// Values flattens the config into dotted keys and display values. Unset keys
+// are omitted; lists are comma-separated.
+func (c *Config) Values() map[string]string {
+	values := map[string]string{}
+	if c == nil {
+		return values
+	}
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return values
+	}
+	var tree map[string]any
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return values
+	}
+	flatten("", tree, values)
+	return values
+}
+
+func flatten(prefix string, value any, values map[string]string) {
+	switch typed := value.(type) {
+	case map[string]any:
+		for key, child := range typed {
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			flatten(key, child, values)
+		}
+	case []any:
+		if len(typed) == 0 {
+			return
+		}
+		items := make([]string, len(typed))
+		for i, item := range typed {
+			items[i] = fmt.Sprint(item)
+		}
+		values[prefix] = strings.Join(items, ",")
+	case nil:
+	case string:
+		if typed != "" {
+			values[prefix] = typed
+		}
+	case int:
+		if typed != 0 {
+			values[prefix] = strconv.Itoa(typed)
+		}
+	default:
+		values[prefix] = fmt.Sprint(typed)
+	}
+}
+
+// Get returns the display value of key, and false when it is unset.
+func (c *Config) Get(key string) (string, bool, error) {
+	if _, err := keyKind(key); err != nil {
+		return "", false, err
+	}
+	value, ok := c.Values()[key]
+	return value, ok, nil
+}
+
+// SortedKeys returns the keys of values in order.
+func SortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Set writes key=value into the config file, creating it if needed. Lists
+// take comma-separated values. Comments and other keys are preserved, and
+// the result must parse before it is written.
+func Set(file, key, value string) error {
+	kind, err := keyKind(key)
+	if err != nil {
+		return err
+	}
+	node, err := valueNode(kind, value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return editFile(file, func(root *yaml.Node) {
+		setPath(root, strings.Split(key, "."), node)
+	})
+}
+
+// Unset removes key from the config file.
+func Unset(file, key string) error {
+	if _, err := keyKind(key); err != nil {
+		return err
+	}
+	return editFile(file, func(root *yaml.Node) {
+		unsetPath(root, strings.Split(key, "."))
+	})
+}
+
+func valueNode(kind, value string) (*yaml.Node, error) {
+	switch kind {
+	case "int":
+		if _, err := strconv.Atoi(strings.TrimSpace(value)); err != nil {
+			return nil, fmt.Errorf("want an integer, got %q", value)
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strings.TrimSpace(value)}, nil
+	case "list":
+		seq := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				seq.Content = append(seq.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: item})
+			}
+		}
+		return seq, nil
+	default:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}, nil
+	}
+}
+
+func editFile(file string, edit func(root *yaml.Node)) error {
+	if file == "" {
+		return errors.New("no config file location (set PPROF_MCP_CONFIG)")
+	}
+	data, err := os.ReadFile(file)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("%s: parse config: %w", file, err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: config must be a mapping", file)
+	}
+	edit(root)
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+	if _, err := Parse(buf.Bytes()); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+func setPath(mapping *yaml.Node, path []string, value *yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			mapping.Content[i+1] = value
+			return
+		}
+		child := mapping.Content[i+1]
+		if child.Kind != yaml.MappingNode {
+			child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			mapping.Content[i+1] = child
+		}
+		setPath(child, path[1:], value)
+		return
+	}
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: path[0]}
+	if len(path) == 1 {
+		mapping.Content = append(mapping.Content, key, value)
+		return
+	}
+	child := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	mapping.Content = append(mapping.Content, key, child)
+	setPath(child, path[1:], value)
+}
+
+func unsetPath(mapping *yaml.Node, path []string) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			return
+		}
+		child := mapping.Content[i+1]
+		if child.Kind != yaml.MappingNode {
+			return
+		}
+		unsetPath(child, path[1:])
+		// Drop mappings left empty so the file doesn't accumulate "name: {}".
+		if len(child.Content) == 0 {
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+		}
+		return
+	}
+}
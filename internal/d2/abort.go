@@ -0,0 +1,197 @@
+package d2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+)
+
+// ErrAborted is the cause of a branch comparison stopped by AbortRun
+var ErrAborted = errors.New("branch impact run aborted")
+
+// restoreTimeout bounds the git commands that put the working tree back
+const restoreTimeout = time.Minute
+
+// RestoreReport describes the git state put back after a branch comparison
+type RestoreReport struct {
+	Branch         string   `json:"branch"` // branch checked out before the run
+	BranchRestored bool     `json:"branch_restored"`
+	StashPopped    bool     `json:"stash_popped"` // uncommitted changes were restored
+	Errors         []string `json:"errors,omitempty"`
+}
+
+// AbortResult reports what an abort stopped and restored
+type AbortResult struct {
+	PlanID    string         `json:"plan_id,omitempty"`
+	Service   string         `json:"service"`
+	Phase     string         `json:"phase"`     // what the run was doing when aborted
+	Recovered bool           `json:"recovered"` // the run belonged to a process that had exited
+	Restore   *RestoreReport `json:"restore,omitempty"`
+}
+
+// activeRun is the comparison currently checking out refs in this process
+type activeRun struct {
+	planID  string
+	service string
+	cancel  context.CancelCauseFunc
+	done    chan struct{}
+
+	mu     sync.Mutex
+	phase  string
+	result BranchImpactResult
+}
+
+var (
+	activeRunMu sync.Mutex
+	currentRun  *activeRun
+)
+
+// startRun registers a comparison, refusing to start a second one, and
+// returns a context AbortRun can cancel
+func startRun(ctx context.Context, planID, service string) (*activeRun, context.Context, error) {
+	activeRunMu.Lock()
+	defer activeRunMu.Unlock()
+	if currentRun != nil {
+		return nil, ctx, fmt.Errorf("a branch impact run for %s is already in progress; wait for it or abort it with d2.branch_impact.abort", currentRun.service)
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	currentRun = &activeRun{planID: planID, service: service, cancel: cancel, done: make(chan struct{}), phase: "starting"}
+	return currentRun, ctx, nil
+}
+
+func (r *activeRun) setPhase(phase string) {
+	r.mu.Lock()
+	r.phase = phase
+	r.mu.Unlock()
+}
+
+func (r *activeRun) currentPhase() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.phase
+}
+
+// finish records the outcome and unregisters the run
+func (r *activeRun) finish(result BranchImpactResult, err error) {
+	r.mu.Lock()
+	r.result = result
+	r.mu.Unlock()
+	activeRunMu.Lock()
+	if currentRun == r {
+		currentRun = nil
+	}
+	activeRunMu.Unlock()
+	r.cancel(err)
+	close(r.done)
+}
+
+// restoreGitState checks out branch again and pops the auto-stash. It runs
+// with its own deadline so a cancelled ctx cannot leave the repo stranded on
+// the wrong branch. When the checkout fails the stash is left alone, since
+// popping it would apply the changes to the branch under comparison.
+func restoreGitState(ctx context.Context, branch string, stashed bool) *RestoreReport {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), restoreTimeout)
+	defer cancel()
+
+	report := &RestoreReport{Branch: branch}
+	// Switch back to original branch
+	if err := gitCheckout(ctx, branch); err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("failed to restore branch %s: %v", branch, err))
+		if stashed {
+			report.Errors = append(report.Errors, fmt.Sprintf("uncommitted changes are still stashed; run `git checkout %s && git stash pop` to restore them", branch))
+		}
+		return report
+	}
+	report.BranchRestored = true
+	// Restore stashed changes
+	if stashed {
+		if err := gitStashPop(ctx); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("failed to restore stashed changes: %v", err))
+		} else {
+			report.StashPopped = true
+		}
+	}
+	return report
+}
+
+// AbortRun cancels the comparison in progress, waits for it to restore the
+// original branch and stashed changes, and reports what was restored. With
+// a planID it only aborts that plan; a plan still marked running by a
+// process that has exited (a crashed server) is recovered by restoring the
+// git state recorded in the plan.
+func AbortRun(ctx context.Context, planID string) (AbortResult, error) {
+	activeRunMu.Lock()
+	run := currentRun
+	activeRunMu.Unlock()
+
+	if run != nil && (planID == "" || (run.planID != "" && strings.HasPrefix(run.planID, planID))) {
+		phase := run.currentPhase()
+		run.cancel(ErrAborted)
+		select {
+		case <-run.done:
+		case <-ctx.Done():
+			return AbortResult{}, fmt.Errorf("run did not stop before the deadline: %w", ctx.Err())
+		}
+		run.mu.Lock()
+		restore := run.result.Restore
+		run.mu.Unlock()
+		return AbortResult{PlanID: run.planID, Service: run.service, Phase: phase, Restore: restore}, nil
+	}
+	if planID == "" {
+		return AbortResult{}, errors.New("no branch impact run is in progress")
+	}
+
+	plan, err := loadPlan(planID)
+	if err != nil {
+		return AbortResult{}, err
+	}
+	if status := plan.CurrentStatus(); status != PlanRunning {
+		return AbortResult{}, fmt.Errorf("plan %s is %s, not running", plan.ID, status)
+	}
+	if plan.PID != 0 && plan.PID != os.Getpid() && processAlive(plan.PID) {
+		return AbortResult{}, fmt.Errorf("plan %s is running in process %d; abort it from that process or stop it", plan.ID, plan.PID)
+	}
+
+	report := recoverGitState(ctx, *plan)
+	recovered := *plan
+	finishedAt := time.Now().UTC()
+	recovered.Status = PlanAborted
+	recovered.FinishedAt = &finishedAt
+	recovered.Error = "aborted after the process running it exited"
+	if err := savePlan(&recovered); err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("failed to record the abort: %v", err))
+	}
+	return AbortResult{PlanID: plan.ID, Service: plan.Params.Service, Phase: "interrupted", Recovered: true, Restore: report}, nil
+}
+
+// recoverGitState restores the branch a plan started from. The stash is
+// popped only when the newest stash entry is the run's auto-stash, so a
+// stash made since is never applied by mistake.
+func recoverGitState(ctx context.Context, plan ExecutionPlan) *RestoreReport {
+	stashed := false
+	var stashErr string
+	if plan.HasUncommitted {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), restoreTimeout)
+		top, err := cmdrun.Output(ctx, cmdrun.Git, "git", "stash", "list", "-n", "1", "--format=%s")
+		cancel()
+		switch {
+		case err != nil:
+			stashErr = fmt.Sprintf("failed to read the stash list: %v", err)
+		case strings.Contains(string(top), "pprof_branch_impact auto-stash"):
+			stashed = true
+		default:
+			stashErr = "the newest stash is not a pprof_branch_impact auto-stash; check git stash list"
+		}
+	}
+	report := restoreGitState(ctx, plan.CurrentBranch, stashed)
+	if stashErr != "" {
+		report.Errors = append(report.Errors, stashErr)
+	}
+	return report
+}
@@ -0,0 +1,124 @@
+package d2
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// initRepo creates a repo on main with a feature branch, an edit stashed as
+// the auto-stash, and feature checked out, as a comparison leaves it.
+func initRepo(t *testing.T) func(args ...string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	t.Chdir(t.TempDir())
+	git := func(args ...string) string {
+		t.Helper()
+		out, err := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-q", "-b", "main")
+	if err := os.WriteFile("main.go", []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	git("add", "main.go")
+	git("commit", "-q", "-m", "init")
+	git("branch", "feature")
+	if err := os.WriteFile("main.go", []byte("package main // edited\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	git("stash", "push", "-q", "-m", "pprof_branch_impact auto-stash 20260101-000000")
+	git("checkout", "-q", "feature")
+	return git
+}
+
+func TestRestoreGitStateRestoresBranchAndStash(t *testing.T) {
+	git := initRepo(t)
+
+	report := restoreGitState(context.Background(), "main", true)
+	if !report.BranchRestored || !report.StashPopped || len(report.Errors) != 0 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if branch := git("branch", "--show-current"); branch != "main" {
+		t.Fatalf("expected main checked out, got %s", branch)
+	}
+	if data, _ := os.ReadFile("main.go"); !strings.Contains(string(data), "edited") {
+		t.Fatalf("stashed edit not restored: %q", data)
+	}
+}
+
+func TestRestoreGitStateKeepsStashWhenCheckoutFails(t *testing.T) {
+	git := initRepo(t)
+
+	report := restoreGitState(context.Background(), "missing", true)
+	if report.BranchRestored || report.StashPopped {
+		t.Fatalf("nothing should be restored: %+v", report)
+	}
+	if len(report.Errors) != 2 || !strings.Contains(report.Errors[1], "git checkout missing && git stash pop") {
+		t.Fatalf("expected manual restore instructions, got %v", report.Errors)
+	}
+	if branch := git("branch", "--show-current"); branch != "feature" {
+		t.Fatalf("expected feature still checked out, got %s", branch)
+	}
+	if data, _ := os.ReadFile("main.go"); strings.Contains(string(data), "edited") {
+		t.Fatalf("stash was applied to the wrong branch: %q", data)
+	}
+	if stash := git("stash", "list"); !strings.Contains(stash, "pprof_branch_impact auto-stash") {
+		t.Fatalf("auto-stash should be left in place, got %q", stash)
+	}
+}
+
+func TestAbortRunStopsActiveRun(t *testing.T) {
+	t.Setenv("PPROF_MCP_PLAN_DIR", t.TempDir())
+	if _, err := AbortRun(context.Background(), ""); err == nil || !strings.Contains(err.Error(), "no branch impact run") {
+		t.Fatalf("expected no run in progress, got %v", err)
+	}
+
+	run, ctx, err := startRun(context.Background(), "abcd000000000001", "api")
+	if err != nil {
+		t.Fatalf("start run: %v", err)
+	}
+	if _, _, err := startRun(context.Background(), "", "other"); err == nil {
+		t.Fatal("a second run should be refused")
+	}
+	run.setPhase("capturing after")
+	go func() {
+		<-ctx.Done()
+		run.finish(BranchImpactResult{Restore: &RestoreReport{Branch: "main", BranchRestored: true}}, context.Cause(ctx))
+	}()
+
+	if _, err := AbortRun(context.Background(), "ffff"); err == nil {
+		t.Fatal("aborting another plan should not stop this run")
+	}
+	result, err := AbortRun(context.Background(), "abcd")
+	if err != nil {
+		t.Fatalf("abort: %v", err)
+	}
+	if result.Service != "api" || result.Phase != "capturing after" || result.Restore == nil || !result.Restore.BranchRestored {
+		t.Fatalf("unexpected abort result: %+v", result)
+	}
+	if !errors.Is(context.Cause(ctx), ErrAborted) {
+		t.Fatalf("expected the run cancelled with ErrAborted, got %v", context.Cause(ctx))
+	}
+}
+
+func TestProcessAlive(t *testing.T) {
+	if !processAlive(os.Getpid()) {
+		t.Fatal("this process should be alive")
+	}
+	exited := exec.Command(os.Args[0], "-test.run=^$")
+	if err := exited.Run(); err != nil {
+		t.Skipf("cannot start a process: %v", err)
+	}
+	if processAlive(exited.Process.Pid) {
+		t.Fatalf("process %d has exited", exited.Process.Pid)
+	}
+}
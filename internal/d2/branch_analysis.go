@@ -0,0 +1,158 @@
+package d2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/arreyder/pprof-mcp/internal/pprof"
+)
+
+// analysisDiffTypes are the profile types diffed function by function. Their
+// top values are times, which diff_top ranks by; heap and goroutines are
+// compared through the hotspot summaries instead.
+var analysisDiffTypes = []string{"cpu", "mutex", "block"}
+
+// analysisDeltas is how many of the largest increases and decreases each
+// diff keeps
+const analysisDeltas = 10
+
+// BranchAnalysis is the follow-up analysis of one service's before and
+// after profiles, so a comparison reads without further tool calls
+type BranchAnalysis struct {
+	Service        string                      `json:"service"`
+	Diffs          []ProfileDiff               `json:"diffs,omitempty"`
+	BeforeHotspots *pprof.HotspotSummaryResult `json:"before_hotspots,omitempty"`
+	AfterHotspots  *pprof.HotspotSummaryResult `json:"after_hotspots,omitempty"`
+}
+
+// ProfileDiff is diff_top of one profile type, cut to the functions that
+// grew and shrank the most
+type ProfileDiff struct {
+	Type   string           `json:"type"`
+	Deltas []map[string]any `json:"deltas"` // largest increase first
+}
+
+// analyzeBranches runs diff_top per profile type and hotspot_summary on both
+// sides of every compared service, then renders the comparison report into
+// OutDir/report.md. Analysis failures become warnings: the profiles are
+// still there to analyze by hand.
+func analyzeBranches(ctx context.Context, params BranchImpactParams, result *BranchImpactResult) {
+	impacts := result.Services
+	if len(impacts) == 0 {
+		impacts = []ServiceImpact{{Service: result.Service, BeforeProfiles: result.BeforeProfiles, AfterProfiles: result.AfterProfiles}}
+	}
+	var inputs []pprof.ReportInput
+	for _, impact := range impacts {
+		analysis, warnings := analyzeService(ctx, impact)
+		result.Analysis = append(result.Analysis, analysis)
+		for _, warning := range warnings {
+			result.Warnings = append(result.Warnings, "analysis: "+warning)
+		}
+		inputs = append(inputs, analysisReportInputs(analysis, result.BeforeRef, result.AfterRef)...)
+	}
+	if len(inputs) == 0 {
+		return
+	}
+	report, err := pprof.GenerateReport(pprof.ReportParams{
+		Title:  fmt.Sprintf("Branch impact: %s (%s → %s)", result.Service, result.BeforeRef, result.AfterRef),
+		Inputs: inputs,
+	})
+	if err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("analysis: report: %v", err))
+		return
+	}
+	result.Report = report.Markdown
+	path := filepath.Join(params.OutDir, "report.md")
+	if err := os.WriteFile(path, []byte(report.Markdown+"\n"), 0o644); err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("analysis: failed to write report: %v", err))
+		return
+	}
+	result.ReportPath = path
+}
+
+// analyzeService diffs and summarizes one service's profiles
+func analyzeService(ctx context.Context, impact ServiceImpact) (BranchAnalysis, []string) {
+	analysis := BranchAnalysis{Service: impact.Service}
+	var warnings []string
+	for _, profileType := range analysisDiffTypes {
+		before, after := profilePath(impact.BeforeProfiles, profileType), profilePath(impact.AfterProfiles, profileType)
+		if before == "" || after == "" {
+			continue
+		}
+		diff, err := pprof.RunDiffTop(ctx, pprof.DiffTopParams{Before: before, After: after, NodeCount: 30})
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s %s diff: %v", impact.Service, profileType, err))
+			continue
+		}
+		analysis.Diffs = append(analysis.Diffs, ProfileDiff{Type: profileType, Deltas: pprof.LargestDeltas(diff.Deltas, analysisDeltas)})
+	}
+	for _, side := range []struct {
+		name     string
+		download DownloadResult
+		hotspots **pprof.HotspotSummaryResult
+	}{{"before", impact.BeforeProfiles, &analysis.BeforeHotspots}, {"after", impact.AfterProfiles, &analysis.AfterHotspots}} {
+		profiles := hotspotProfiles(side.download)
+		if len(profiles) == 0 {
+			continue
+		}
+		hotspots, err := pprof.RunHotspotSummary(ctx, pprof.HotspotSummaryParams{Profiles: profiles})
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s %s hotspots: %v", impact.Service, side.name, err))
+			continue
+		}
+		*side.hotspots = &hotspots
+	}
+	return analysis, warnings
+}
+
+// hotspotProfiles maps a download to the profile keys hotspot_summary reads
+func hotspotProfiles(download DownloadResult) map[string]string {
+	profiles := map[string]string{}
+	for _, file := range download.Files {
+		key := file.Type
+		if key == "goroutine" {
+			key = "goroutines"
+		}
+		if _, seen := profiles[key]; !seen {
+			profiles[key] = file.Path
+		}
+	}
+	return profiles
+}
+
+// analysisReportInputs turns a service's analysis into report sections
+func analysisReportInputs(analysis BranchAnalysis, beforeRef, afterRef string) []pprof.ReportInput {
+	var inputs []pprof.ReportInput
+	for _, diff := range analysis.Diffs {
+		inputs = append(inputs, pprof.ReportInput{
+			Kind:  "diff_top",
+			Title: fmt.Sprintf("%s %s changes", analysis.Service, diff.Type),
+			Data:  reportData(pprof.DiffTopResult{Deltas: diff.Deltas}),
+		})
+	}
+	for _, side := range []struct {
+		ref      string
+		hotspots *pprof.HotspotSummaryResult
+	}{{beforeRef, analysis.BeforeHotspots}, {afterRef, analysis.AfterHotspots}} {
+		if side.hotspots != nil {
+			inputs = append(inputs, pprof.ReportInput{
+				Kind:  "hotspot_summary",
+				Title: fmt.Sprintf("%s hotspots on %s", analysis.Service, side.ref),
+				Data:  reportData(side.hotspots),
+			})
+		}
+	}
+	return inputs
+}
+
+// reportData converts a typed result into the map form GenerateReport takes
+func reportData(value any) map[string]any {
+	data := map[string]any{}
+	if blob, err := json.Marshal(value); err == nil {
+		_ = json.Unmarshal(blob, &data)
+	}
+	return data
+}
@@ -4,26 +4,38 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"os/exec"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
 )
 
-// ExecutionPlan represents a planned branch impact comparison
+// ExecutionPlan represents a planned branch impact comparison and, once
+// executed, its run
 type ExecutionPlan struct {
-	ID             string                `json:"id"`
-	Params         BranchImpactParams    `json:"params"`
-	Steps          []string              `json:"steps"`
-	EstimatedTime  string                `json:"estimated_time"`
-	CurrentBranch  string                `json:"current_branch"`
-	HasUncommitted bool                  `json:"has_uncommitted"`
-	CreatedAt      time.Time             `json:"created_at"`
+	ID             string              `json:"id"`
+	Params         BranchImpactParams  `json:"params"`
+	Steps          []string            `json:"steps"`
+	EstimatedTime  string              `json:"estimated_time"`
+	CurrentBranch  string              `json:"current_branch"`
+	HasUncommitted bool                `json:"has_uncommitted"`
+	CreatedAt      time.Time           `json:"created_at"`
+	ExpiresAt      time.Time           `json:"expires_at"` // a pending plan can no longer be executed after this
+	Status         string              `json:"status"`     // pending, running, succeeded, failed, or aborted
+	StartedAt      *time.Time          `json:"started_at,omitempty"`
+	FinishedAt     *time.Time          `json:"finished_at,omitempty"`
+	Result         *BranchImpactResult `json:"result,omitempty"`
+	Error          string              `json:"error,omitempty"`
+	PID            int                 `json:"pid,omitempty"` // process that ran the plan
 }
 
-// planStore stores execution plans in memory
+// planStore caches execution plans in memory; see plan_store.go for the
+// copies persisted under PlanDir
 var (
 	planStore   = make(map[string]*ExecutionPlan)
 	planStoreMu sync.RWMutex
@@ -31,37 +43,69 @@ var (
 
 // BranchImpactParams contains parameters for comparing profiles between branches
 type BranchImpactParams struct {
-	Service       string
-	BeforeRef     string // default: "main"
-	AfterRef      string // default: current branch
-	OutDir        string
-	Seconds       int           // CPU profile duration (default: 30)
-	RebuildTimeout time.Duration // default: 5 minutes
-	WarmupDelay   time.Duration // default: 15 seconds
+	Service        string        `json:"service"`
+	Services       []string      `json:"services,omitempty"`       // dependent services profiled alongside Service on each ref
+	Namespace      string        `json:"namespace,omitempty"`      // defaults to "default"
+	KubeContext    string        `json:"kube_context,omitempty"`   // kubectl context; defaults to the current one
+	DevEnv         string        `json:"dev_env,omitempty"`        // tilt (default), compose, skaffold, or rollout
+	DeployCommand  string        `json:"deploy_command,omitempty"` // run after each checkout to ship the ref; {ref} is replaced with it
+	GitOpsApp      string        `json:"gitops_app,omitempty"`     // argocd/[ns/]app or flux/[ns/]kustomization the rollout driver also waits on
+	PprofPort      int           `json:"pprof_port,omitempty"`     // pprof port for compose and skaffold (default: 6060 / discovered)
+	BeforeRef      string        `json:"before_ref"`               // default: "main"
+	AfterRef       string        `json:"after_ref,omitempty"`      // default: current branch
+	OutDir         string        `json:"out_dir"`
+	Seconds        int           `json:"seconds"`                 // CPU profile duration (default: 30)
+	Runs           int           `json:"runs,omitempty"`          // CPU captures per ref (default: 1, max: 10)
+	RebuildTimeout time.Duration `json:"rebuild_timeout"`         // default: 5 minutes
+	WarmupDelay    time.Duration `json:"warmup_delay"`            // default: 15 seconds
+	Load           LoadParams    `json:"load,omitzero"`           // traffic to generate during each capture
+	SkipAnalysis   bool          `json:"skip_analysis,omitempty"` // skip the diff, hotspot, and report pass after the captures
 }
 
 // BranchImpactResult contains the results of a branch comparison
 type BranchImpactResult struct {
-	Service       string                `json:"service"`
-	BeforeRef     string                `json:"before_ref"`
-	AfterRef      string                `json:"after_ref"`
-	BeforeProfiles DownloadResult       `json:"before_profiles"`
-	AfterProfiles  DownloadResult       `json:"after_profiles"`
-	UpdateMethod  string                `json:"update_method"` // "live_update", "pod_restart", or "pod_recreate"
-	GitStashed    bool                  `json:"git_stashed"`
-	Warnings      []string              `json:"warnings,omitempty"`
+	Service        string         `json:"service"`
+	BeforeRef      string         `json:"before_ref"`
+	AfterRef       string         `json:"after_ref"`
+	BeforeProfiles DownloadResult `json:"before_profiles"`
+	AfterProfiles  DownloadResult `json:"after_profiles"`
+	UpdateMethod   string         `json:"update_method"` // "live_update", "pod_restart", "pod_recreate", "container_restart", "container_recreate", or "rollout"
+	GitStashed     bool           `json:"git_stashed"`
+	Restore        *RestoreReport `json:"restore,omitempty"`     // git state put back after the run
+	BeforeLoad     *LoadSummary   `json:"before_load,omitempty"` // set when params.Load is configured
+	AfterLoad      *LoadSummary   `json:"after_load,omitempty"`
+	// Services and Combined are set when more than one service is profiled;
+	// BeforeProfiles, AfterProfiles, and UpdateMethod then describe the first.
+	Services []ServiceImpact `json:"services,omitempty"`
+	Combined *CombinedReport `json:"combined,omitempty"`
+	// Stats compares each service's repeated captures when params.Runs > 1;
+	// the profiles above then hold the CPU profiles merged across runs.
+	Stats []RepeatedStats `json:"stats,omitempty"`
+	// Analysis, Report, and ReportPath hold diff_top per profile type,
+	// hotspot summaries of both refs, and the markdown report built from
+	// them, unless params.SkipAnalysis is set.
+	Analysis   []BranchAnalysis `json:"analysis,omitempty"`
+	Report     string           `json:"report,omitempty"`
+	ReportPath string           `json:"report_path,omitempty"`
+	Warnings   []string         `json:"warnings,omitempty"`
 }
 
-// TiltState captures the current state of a Tilt resource
-type TiltState struct {
-	PodName           string
-	StartedAt         time.Time
-	LastFileTimeSynced *time.Time
-	ContainerID       string
+// ServiceImpact holds one service's profiles from both refs
+type ServiceImpact struct {
+	Service        string         `json:"service"`
+	BeforeProfiles DownloadResult `json:"before_profiles"`
+	AfterProfiles  DownloadResult `json:"after_profiles"`
+	UpdateMethod   string         `json:"update_method"`
 }
 
-// CompareBranches profiles a service on two different git branches
+// CompareBranches profiles a service on two different git branches. Only
+// one comparison runs at a time, since each checks out refs in the same
+// working tree; AbortRun cancels it.
 func CompareBranches(ctx context.Context, params BranchImpactParams) (BranchImpactResult, error) {
+	return compareBranches(ctx, params, "")
+}
+
+func compareBranches(ctx context.Context, params BranchImpactParams, planID string) (result BranchImpactResult, err error) {
 	// Set defaults
 	if params.BeforeRef == "" {
 		params.BeforeRef = "main"
@@ -75,14 +119,28 @@ func CompareBranches(ctx context.Context, params BranchImpactParams) (BranchImpa
 	if params.WarmupDelay == 0 {
 		params.WarmupDelay = 15 * time.Second
 	}
+	if err := params.validate(); err != nil {
+		return BranchImpactResult{Service: params.Service, BeforeRef: params.BeforeRef}, err
+	}
 
-	result := BranchImpactResult{
+	result = BranchImpactResult{
 		Service:    params.Service,
 		BeforeRef:  params.BeforeRef,
 		GitStashed: false,
 		Warnings:   []string{},
 	}
 
+	run, ctx, err := startRun(ctx, planID, params.Service)
+	if err != nil {
+		return result, err
+	}
+	defer func() {
+		if err != nil && errors.Is(context.Cause(ctx), ErrAborted) {
+			err = fmt.Errorf("%w while %s", ErrAborted, run.currentPhase())
+		}
+		run.finish(result, err)
+	}()
+
 	// Get current branch
 	currentBranch, err := getCurrentBranch(ctx)
 	if err != nil {
@@ -109,255 +167,330 @@ func CompareBranches(ctx context.Context, params BranchImpactParams) (BranchImpa
 		result.GitStashed = true
 	}
 
-	// Ensure we restore state on exit
+	// Ensure we restore state on exit, even when ctx was cancelled
 	defer func() {
-		// Switch back to original branch
-		if err := gitCheckout(ctx, currentBranch); err != nil {
-			result.Warnings = append(result.Warnings, fmt.Sprintf("failed to restore branch %s: %v", currentBranch, err))
-		}
-
-		// Restore stashed changes
-		if result.GitStashed {
-			if err := gitStashPop(ctx); err != nil {
-				result.Warnings = append(result.Warnings, fmt.Sprintf("failed to restore stashed changes: %v", err))
-			}
+		run.setPhase("restoring " + currentBranch)
+		result.Restore = restoreGitState(ctx, currentBranch, result.GitStashed)
+		result.Warnings = append(result.Warnings, result.Restore.Errors...)
+		// Analyzed after the restore, so the working tree is not held for it
+		if err == nil && !params.SkipAnalysis {
+			run.setPhase("analyzing")
+			analyzeBranches(ctx, params, &result)
 		}
 	}()
 
 	// Step 1: Capture baseline profile from before_ref
+	run.setPhase("checking out " + params.BeforeRef)
 	if err := gitCheckout(ctx, params.BeforeRef); err != nil {
 		return result, fmt.Errorf("failed to checkout %s: %w", params.BeforeRef, err)
 	}
 
+	services := params.services()
+	env, _ := params.devEnv() // checked by validate
+
 	// Wait for rebuild after switching to before_ref
-	updateMethod, err := waitForRebuild(ctx, params.Service, params.RebuildTimeout, params.WarmupDelay)
-	if err != nil {
+	run.setPhase("waiting for the " + params.BeforeRef + " rebuild")
+	if _, err := waitForRebuilds(ctx, env, params, services, params.BeforeRef); err != nil {
+		if errors.Is(err, errDeploy) {
+			return result, err
+		}
 		result.Warnings = append(result.Warnings, fmt.Sprintf("rebuild detection warning: %v", err))
 		// Continue anyway - maybe service was already on this branch
 	}
 
-	beforeProfiles, err := DownloadProfiles(ctx, DownloadParams{
-		Service: params.Service,
-		OutDir:  params.OutDir + "/before",
-		Seconds: params.Seconds,
-	})
+	run.setPhase("profiling " + params.BeforeRef)
+	beforeRuns, beforeLoad, err := profileRef(ctx, env, params, services, params.BeforeRef, "before")
+	result.BeforeLoad = beforeLoad
 	if err != nil {
 		return result, fmt.Errorf("failed to download before profiles: %w", err)
 	}
-	result.BeforeProfiles = beforeProfiles
+	beforeProfiles, err := mergeAll(params, services, "before", beforeRuns)
+	if err != nil {
+		return result, err
+	}
+	result.BeforeProfiles = beforeProfiles[0]
 
 	// Step 2: Switch to after_ref
+	run.setPhase("checking out " + params.AfterRef)
 	if err := gitCheckout(ctx, params.AfterRef); err != nil {
 		return result, fmt.Errorf("failed to checkout %s: %w", params.AfterRef, err)
 	}
 
 	// Wait for rebuild
-	updateMethod, err = waitForRebuild(ctx, params.Service, params.RebuildTimeout, params.WarmupDelay)
+	run.setPhase("waiting for the " + params.AfterRef + " rebuild")
+	updateMethods, err := waitForRebuilds(ctx, env, params, services, params.AfterRef)
 	if err != nil {
 		return result, fmt.Errorf("failed waiting for rebuild: %w", err)
 	}
-	result.UpdateMethod = updateMethod
+	result.UpdateMethod = updateMethods[0]
 
 	// Step 3: Capture after profile
-	afterProfiles, err := DownloadProfiles(ctx, DownloadParams{
-		Service: params.Service,
-		OutDir:  params.OutDir + "/after",
-		Seconds: params.Seconds,
-	})
+	run.setPhase("profiling " + params.AfterRef)
+	afterRuns, afterLoad, err := profileRef(ctx, env, params, services, params.AfterRef, "after")
+	result.AfterLoad = afterLoad
 	if err != nil {
 		return result, fmt.Errorf("failed to download after profiles: %w", err)
 	}
-	result.AfterProfiles = afterProfiles
-
-	return result, nil
-}
-
-// waitForRebuild waits for Tilt to rebuild the service after a git change
-func waitForRebuild(ctx context.Context, service string, timeout, warmupDelay time.Duration) (string, error) {
-	// Capture initial state
-	initialState, err := getTiltState(ctx, service)
+	afterProfiles, err := mergeAll(params, services, "after", afterRuns)
 	if err != nil {
-		return "", fmt.Errorf("failed to get initial tilt state: %w", err)
-	}
-
-	// Initial delay to let Tilt detect the change
-	time.Sleep(5 * time.Second)
-
-	// Poll for changes
-	deadline := time.Now().Add(timeout)
-	ticker := time.NewTicker(3 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return "", ctx.Err()
-		case <-time.After(time.Until(deadline)):
-			return "", fmt.Errorf("timeout waiting for rebuild after %v", timeout)
-		case <-ticker.C:
-			currentState, err := getTiltState(ctx, service)
-			if err != nil {
-				// Tilt state unavailable, continue polling
-				continue
-			}
+		return result, err
+	}
+	result.AfterProfiles = afterProfiles[0]
+	if warning := loadDrift(beforeLoad, afterLoad); warning != "" {
+		result.Warnings = append(result.Warnings, warning)
+	}
 
-			// Detect what changed
-			if currentState.PodName != initialState.PodName {
-				// Pod was recreated (full rebuild)
-				time.Sleep(warmupDelay)
-				return "pod_recreate", nil
+	if len(services) > 1 {
+		for i, service := range services {
+			result.Services = append(result.Services, ServiceImpact{
+				Service:        service,
+				BeforeProfiles: beforeProfiles[i],
+				AfterProfiles:  afterProfiles[i],
+				UpdateMethod:   updateMethods[i],
+			})
+		}
+		report, warnings := combinedReport(result.Services)
+		result.Combined = report
+		result.Warnings = append(result.Warnings, warnings...)
+	}
+	if params.runs() > 1 {
+		for i, service := range services {
+			stats, warnings := repeatedStats(service, serviceRuns(beforeRuns, i), serviceRuns(afterRuns, i))
+			if stats != nil {
+				result.Stats = append(result.Stats, *stats)
 			}
+			result.Warnings = append(result.Warnings, warnings...)
+		}
+	}
 
-			if !currentState.StartedAt.Equal(initialState.StartedAt) {
-				// Container restarted
-				time.Sleep(warmupDelay)
-				return "pod_restart", nil
-			}
+	return result, nil
+}
 
-			if currentState.LastFileTimeSynced != nil && initialState.LastFileTimeSynced != nil {
-				if currentState.LastFileTimeSynced.After(*initialState.LastFileTimeSynced) {
-					// Live update happened
-					time.Sleep(warmupDelay)
-					return "live_update", nil
-				}
-			} else if currentState.LastFileTimeSynced != nil && initialState.LastFileTimeSynced == nil {
-				// First live update
-				time.Sleep(warmupDelay)
-				return "live_update", nil
-			}
+// services lists Service followed by the dependent Services, without
+// duplicates
+func (p BranchImpactParams) services() []string {
+	services := []string{p.Service}
+	seen := map[string]bool{p.Service: true}
+	for _, service := range p.Services {
+		service = strings.TrimSpace(service)
+		if service == "" || seen[service] {
+			continue
 		}
+		seen[service] = true
+		services = append(services, service)
 	}
+	return services
 }
 
-// findTiltResource finds the exact Tilt resource name for a service (with fuzzy matching)
-func findTiltResource(ctx context.Context, service string) (string, error) {
-	// Try exact match first
-	cmd := exec.CommandContext(ctx, "tilt", "get", "kubernetesdiscovery", service, "-o", "json")
-	if err := cmd.Run(); err == nil {
-		return service, nil
+// validate checks the parameters the defaults do not cover
+func (p BranchImpactParams) validate() error {
+	if p.Runs > maxRuns {
+		return fmt.Errorf("runs must be at most %d", maxRuns)
 	}
-
-	// Fuzzy match - list all resources and find one containing the service name
-	cmd = exec.CommandContext(ctx, "tilt", "get", "kubernetesdiscovery", "-o", "json")
-	output, err := cmd.Output()
+	env, err := p.devEnv()
 	if err != nil {
-		return "", fmt.Errorf("failed to list kubernetesdiscovery resources: %w", err)
+		return err
 	}
-
-	var result struct {
-		Items []struct {
-			Metadata struct {
-				Name string `json:"name"`
-			} `json:"metadata"`
-		} `json:"items"`
+	if p.GitOpsApp != "" {
+		if _, ok := env.(rolloutEnv); !ok {
+			return errors.New("gitops_app needs dev_env rollout")
+		}
+		if _, _, _, err := parseGitOpsApp(p.GitOpsApp); err != nil {
+			return err
+		}
 	}
+	return p.Load.validate()
+}
 
-	if err := json.Unmarshal(output, &result); err != nil {
-		return "", fmt.Errorf("failed to parse kubernetesdiscovery list: %w", err)
+// runDir is where one capture of a side is written: OutDir/<side>, or
+// OutDir/<side>/run-<n> when each ref is captured more than once
+func (p BranchImpactParams) runDir(side string, run int) string {
+	if p.runs() > 1 {
+		return filepath.Join(p.OutDir, side, fmt.Sprintf("run-%d", run))
 	}
+	return filepath.Join(p.OutDir, side)
+}
 
-	serviceLower := strings.ToLower(service)
-	for _, item := range result.Items {
-		nameLower := strings.ToLower(item.Metadata.Name)
-		if strings.Contains(nameLower, serviceLower) || strings.Contains(serviceLower, nameLower) {
-			return item.Metadata.Name, nil
-		}
+// downloadParams captures one service for one run into its runDir, under
+// <service> when several services are profiled
+func (p BranchImpactParams) downloadParams(side, service string, run int) DownloadParams {
+	outDir := p.runDir(side, run)
+	if len(p.services()) > 1 {
+		outDir = filepath.Join(outDir, service)
+	}
+	return DownloadParams{
+		Service:     service,
+		Namespace:   p.Namespace,
+		KubeContext: p.KubeContext,
+		OutDir:      outDir,
+		Seconds:     p.Seconds,
+		Port:        p.PprofPort,
 	}
-
-	return "", fmt.Errorf("no tilt resource found matching %q", service)
 }
 
-// getTiltState queries Tilt API for current service state
-func getTiltState(ctx context.Context, service string) (*TiltState, error) {
-	state := &TiltState{}
-
-	// Find the exact Tilt resource name (might be be-ratelimit when service is ratelimit)
-	tiltResourceName, err := findTiltResource(ctx, service)
-	if err != nil {
-		return nil, fmt.Errorf("failed to find tilt resource: %w", err)
+// errDeploy marks a failed deploy_command, which fails the run even on the
+// before ref, where a missed rebuild is only a warning
+var errDeploy = errors.New("deploy command failed")
+
+// waitForRebuilds waits for every service to rebuild after a checkout of
+// ref. Each service's initial state is taken right after the checkout and
+// before the deploy command, if any; the services are then watched
+// concurrently. It returns each service's update method.
+func waitForRebuilds(ctx context.Context, env devEnv, params BranchImpactParams, services []string, ref string) ([]string, error) {
+	methods := make([]string, len(services))
+	initial := make([]devState, len(services))
+	errs := make([]error, len(services))
+	var wg sync.WaitGroup
+	for i, service := range services {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if initial[i], errs[i] = env.state(ctx, service, params); errs[i] != nil {
+				errs[i] = fmt.Errorf("failed to get initial %s state: %w", env.name(), errs[i])
+			}
+		}()
+	}
+	wg.Wait()
+	if err := joinServiceErrors(services, errs); err != nil {
+		return methods, err
 	}
+	if err := runDeployCommand(ctx, params.DeployCommand, ref); err != nil {
+		return methods, err
+	}
+	for i, service := range services {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			methods[i], errs[i] = waitForRebuild(ctx, env, service, params, initial[i])
+		}()
+	}
+	wg.Wait()
+	return methods, joinServiceErrors(services, errs)
+}
 
-	// Get KubernetesDiscovery state (pod name, startedAt)
-	kdCmd := exec.CommandContext(ctx, "tilt", "get", "kubernetesdiscovery", tiltResourceName, "-o", "json")
-	kdOutput, err := kdCmd.Output()
+// runDeployCommand runs the deploy command for ref through the shell (sh, or
+// cmd.exe on Windows), with {ref} replaced
+func runDeployCommand(ctx context.Context, command, ref string) error {
+	if command == "" {
+		return nil
+	}
+	cmd, done := cmdrun.ShellCommand(ctx, deployCommand(command, ref))
+	output, err := cmd.CombinedOutput()
+	err = done(err)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get kubernetesdiscovery: %w", err)
+		if tail := strings.TrimSpace(string(output)); tail != "" {
+			if len(tail) > 2000 {
+				tail = "..." + tail[len(tail)-2000:]
+			}
+			return fmt.Errorf("%w for %s: %v: %s", errDeploy, ref, err, tail)
+		}
+		return fmt.Errorf("%w for %s: %v", errDeploy, ref, err)
 	}
+	return nil
+}
 
-	var kdResult struct {
-		Status struct {
-			Pods []struct {
-				Name       string `json:"name"`
-				Containers []struct {
-					State struct {
-						Running *struct {
-							StartedAt time.Time `json:"startedAt"`
-						} `json:"running"`
-					} `json:"state"`
-				} `json:"containers"`
-			} `json:"pods"`
-		} `json:"status"`
-	}
+// deployCommand substitutes ref into the deploy command
+func deployCommand(command, ref string) string {
+	return strings.ReplaceAll(command, "{ref}", ref)
+}
 
-	if err := json.Unmarshal(kdOutput, &kdResult); err != nil {
-		return nil, fmt.Errorf("failed to parse kubernetesdiscovery output: %w", err)
+// profileRef captures one side of the comparison params.Runs times, running
+// the configured load around each capture window. It returns the downloads
+// indexed by run, then service.
+func profileRef(ctx context.Context, env devEnv, params BranchImpactParams, services []string, ref, side string) ([][]DownloadResult, *LoadSummary, error) {
+	var runs [][]DownloadResult
+	var loads []*LoadSummary
+	for run := 1; run <= params.runs(); run++ {
+		load, err := startLoad(ctx, params.Load, params.Seconds, ref, side, params.runDir(side, run))
+		if err != nil {
+			return nil, combineLoads(loads), err
+		}
+		results, err := downloadAll(ctx, env, params, services, side, run)
+		loads = append(loads, load.stop())
+		if err != nil {
+			return nil, combineLoads(loads), err
+		}
+		runs = append(runs, results)
+	}
+	if len(loads) == 1 {
+		return runs, loads[0], nil
 	}
+	return runs, combineLoads(loads), nil
+}
 
-	if len(kdResult.Status.Pods) > 0 {
-		state.PodName = kdResult.Status.Pods[0].Name
-		if len(kdResult.Status.Pods[0].Containers) > 0 {
-			if running := kdResult.Status.Pods[0].Containers[0].State.Running; running != nil {
-				state.StartedAt = running.StartedAt
-			}
+// mergeAll reduces each service's runs to one result; see mergeRuns
+func mergeAll(params BranchImpactParams, services []string, side string, runs [][]DownloadResult) ([]DownloadResult, error) {
+	if len(runs) == 1 {
+		return runs[0], nil
+	}
+	merged := make([]DownloadResult, len(services))
+	for i, service := range services {
+		var err error
+		if merged[i], err = mergeRuns(service, filepath.Join(params.OutDir, side), serviceRuns(runs, i)); err != nil {
+			return nil, err
 		}
 	}
+	return merged, nil
+}
 
-	// Get LiveUpdate state (lastFileTimeSynced)
-	luCmd := exec.CommandContext(ctx, "tilt", "get", "liveupdate", "-o", "json")
-	luOutput, err := luCmd.Output()
-	if err != nil {
-		// LiveUpdate might not exist, that's ok
-		return state, nil
-	}
-
-	var luResult struct {
-		Items []struct {
-			Metadata struct {
-				Name string `json:"name"`
-			} `json:"metadata"`
-			Status struct {
-				Containers []struct {
-					PodName            string     `json:"podName"`
-					LastFileTimeSynced *time.Time `json:"lastFileTimeSynced"`
-					ContainerID        string     `json:"containerID"`
-				} `json:"containers"`
-			} `json:"status"`
-		} `json:"items"`
-	}
-
-	if err := json.Unmarshal(luOutput, &luResult); err != nil {
-		return state, nil // Ignore LiveUpdate parse errors
-	}
-
-	// Find matching LiveUpdate resource (use tiltResourceName for matching)
-	for _, item := range luResult.Items {
-		if strings.Contains(item.Metadata.Name, tiltResourceName) {
-			if len(item.Status.Containers) > 0 {
-				state.LastFileTimeSynced = item.Status.Containers[0].LastFileTimeSynced
-				state.ContainerID = item.Status.Containers[0].ContainerID
-			}
-			break
+// serviceRuns picks one service's download from every run
+func serviceRuns(runs [][]DownloadResult, service int) []DownloadResult {
+	results := make([]DownloadResult, len(runs))
+	for i, run := range runs {
+		results[i] = run[service]
+	}
+	return results
+}
+
+// downloadAll profiles every service at once, so their CPU profiles cover
+// the same window and cost moving from one to another shows up in both.
+func downloadAll(ctx context.Context, env devEnv, params BranchImpactParams, services []string, side string, run int) ([]DownloadResult, error) {
+	results := make([]DownloadResult, len(services))
+	errs := make([]error, len(services))
+	var wg sync.WaitGroup
+	for i, service := range services {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = env.download(ctx, params.downloadParams(side, service, run))
+		}()
+	}
+	wg.Wait()
+	return results, joinServiceErrors(services, errs)
+}
+
+// joinServiceErrors combines per-service errors, naming the service when
+// there is more than one
+func joinServiceErrors(services []string, errs []error) error {
+	if len(services) == 1 {
+		return errs[0]
+	}
+	var joined []error
+	for i, err := range errs {
+		if err != nil {
+			joined = append(joined, fmt.Errorf("%s: %w", services[i], err))
 		}
 	}
+	return errors.Join(joined...)
+}
 
-	return state, nil
+// sleepContext waits for d, returning early with ctx's error when it is
+// cancelled
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
 }
 
 // Git helper functions
 
 func getCurrentBranch(ctx context.Context) (string, error) {
-	cmd := exec.CommandContext(ctx, "git", "branch", "--show-current")
-	output, err := cmd.Output()
+	output, err := cmdrun.Output(ctx, cmdrun.Git, "git", "branch", "--show-current")
 	if err != nil {
 		return "", err
 	}
@@ -365,29 +498,28 @@ func getCurrentBranch(ctx context.Context) (string, error) {
 }
 
 func hasUncommittedChanges(ctx context.Context) (bool, error) {
-	cmd := exec.CommandContext(ctx, "git", "status", "--porcelain")
-	output, err := cmd.Output()
+	output, err := cmdrun.Output(ctx, cmdrun.Git, "git", "status", "--porcelain")
 	if err != nil {
 		return false, err
 	}
 	return len(strings.TrimSpace(string(output))) > 0, nil
 }
 
+func gitStashArgs(now time.Time) []string {
+	message := fmt.Sprintf("pprof_branch_impact auto-stash %s", now.Format("20060102-150405"))
+	return []string{"stash", "push", "-m", message}
+}
+
 func gitStash(ctx context.Context) error {
-	timestamp := time.Now().Format("20060102-150405")
-	message := fmt.Sprintf("pprof_branch_impact auto-stash %s", timestamp)
-	cmd := exec.CommandContext(ctx, "git", "stash", "push", "-m", message)
-	return cmd.Run()
+	return cmdrun.Run(ctx, cmdrun.Git, "git", gitStashArgs(time.Now())...)
 }
 
 func gitStashPop(ctx context.Context) error {
-	cmd := exec.CommandContext(ctx, "git", "stash", "pop")
-	return cmd.Run()
+	return cmdrun.Run(ctx, cmdrun.Git, "git", "stash", "pop")
 }
 
 func gitCheckout(ctx context.Context, ref string) error {
-	cmd := exec.CommandContext(ctx, "git", "checkout", ref)
-	return cmd.Run()
+	return cmdrun.Run(ctx, cmdrun.Git, "git", "checkout", ref)
 }
 
 // Plan generation and execution functions
@@ -414,6 +546,11 @@ func CreateExecutionPlan(ctx context.Context, params BranchImpactParams) (*Execu
 	if params.WarmupDelay == 0 {
 		params.WarmupDelay = 15 * time.Second
 	}
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+
+	env, _ := params.devEnv() // checked by validate
 
 	// Get current state
 	currentBranch, err := getCurrentBranch(ctx)
@@ -432,6 +569,31 @@ func CreateExecutionPlan(ctx context.Context, params BranchImpactParams) (*Execu
 		afterRef = currentBranch
 	}
 
+	services := strings.Join(params.services(), ", ")
+	profileStep := fmt.Sprintf("Profile %s service for %d seconds", services, params.Seconds)
+	if len(params.services()) > 1 {
+		profileStep = fmt.Sprintf("Profile %s services concurrently for %d seconds", services, params.Seconds)
+	}
+	if params.runs() > 1 {
+		profileStep += fmt.Sprintf(", %d times", params.runs())
+	}
+
+	if params.Load.enabled() {
+		profileStep += fmt.Sprintf(" under %s load (%ds, starting %v before the profile)", params.Load.tool(), loadSeconds(params.Seconds), loadLead)
+	}
+
+	compareStep := "Compare profiles"
+	if len(params.services()) > 1 {
+		compareStep = "Compare profiles and total CPU across services"
+	}
+	if params.runs() > 1 {
+		compareStep += ", with per-function 95% confidence intervals across runs"
+	}
+	analyzeStep := ""
+	if !params.SkipAnalysis {
+		analyzeStep = fmt.Sprintf("Analyze: diff cpu, mutex, and block profiles, summarize hotspots on both refs, and write %s", filepath.Join(params.OutDir, "report.md"))
+	}
+
 	// Build step list
 	steps := []string{}
 
@@ -439,25 +601,35 @@ func CreateExecutionPlan(ctx context.Context, params BranchImpactParams) (*Execu
 		steps = append(steps, "Stash uncommitted changes")
 	}
 
+	for _, ref := range []string{params.BeforeRef, afterRef} {
+		steps = append(steps, fmt.Sprintf("Switch to %s branch", ref))
+		if params.DeployCommand != "" {
+			steps = append(steps, fmt.Sprintf("Run deploy command for %s", ref))
+		}
+		steps = append(steps,
+			fmt.Sprintf("Wait for %s rebuild (timeout: %v)", env.name(), params.RebuildTimeout),
+			fmt.Sprintf("Wait %v for service warmup", params.WarmupDelay),
+			profileStep,
+		)
+	}
 	steps = append(steps,
-		fmt.Sprintf("Switch to %s branch", params.BeforeRef),
-		fmt.Sprintf("Wait for Tilt rebuild (timeout: %v)", params.RebuildTimeout),
-		fmt.Sprintf("Wait %v for service warmup", params.WarmupDelay),
-		fmt.Sprintf("Profile %s service for %d seconds", params.Service, params.Seconds),
-		fmt.Sprintf("Switch to %s branch", afterRef),
-		fmt.Sprintf("Wait for Tilt rebuild (timeout: %v)", params.RebuildTimeout),
-		fmt.Sprintf("Wait %v for service warmup", params.WarmupDelay),
-		fmt.Sprintf("Profile %s service for %d seconds", params.Service, params.Seconds),
-		"Compare profiles",
+		compareStep,
 		fmt.Sprintf("Switch back to %s branch", currentBranch),
 	)
 
 	if hasUncommitted {
 		steps = append(steps, "Restore stashed changes")
 	}
+	if analyzeStep != "" {
+		steps = append(steps, analyzeStep)
+	}
 
 	// Estimate time (rough calculation)
-	estimatedSeconds := params.Seconds*2 + // two profiles
+	profileSeconds := params.Seconds
+	if params.Load.enabled() {
+		profileSeconds = loadSeconds(params.Seconds)
+	}
+	estimatedSeconds := profileSeconds*params.runs()*2 + // captures on both refs
 		int(params.WarmupDelay.Seconds())*2 + // two warmups
 		int(params.RebuildTimeout.Seconds())*2 + // assume rebuilds take full timeout
 		30 // git operations
@@ -468,6 +640,7 @@ func CreateExecutionPlan(ctx context.Context, params BranchImpactParams) (*Execu
 		estimatedTime = fmt.Sprintf("~%d hours %d minutes", estimatedMinutes/60, estimatedMinutes%60)
 	}
 
+	createdAt := time.Now().UTC()
 	plan := &ExecutionPlan{
 		ID:             generatePlanID(),
 		Params:         params,
@@ -475,48 +648,76 @@ func CreateExecutionPlan(ctx context.Context, params BranchImpactParams) (*Execu
 		EstimatedTime:  estimatedTime,
 		CurrentBranch:  currentBranch,
 		HasUncommitted: hasUncommitted,
-		CreatedAt:      time.Now(),
+		CreatedAt:      createdAt,
+		ExpiresAt:      createdAt.Add(PlanTTL),
+		Status:         PlanPending,
 	}
 
 	// Store plan
-	planStoreMu.Lock()
-	planStore[plan.ID] = plan
-	planStoreMu.Unlock()
+	if err := savePlan(plan); err != nil {
+		return nil, err
+	}
 
 	return plan, nil
 }
 
-// ExecutePlan executes a previously created plan
-func ExecutePlan(ctx context.Context, planID string) (BranchImpactResult, error) {
-	// Retrieve plan
-	planStoreMu.RLock()
-	plan, exists := planStore[planID]
-	planStoreMu.RUnlock()
+// planExecMu makes checking a plan is pending and marking it running atomic
+var planExecMu sync.Mutex
 
-	if !exists {
-		return BranchImpactResult{}, fmt.Errorf("plan %s not found or expired", planID)
+// ExecutePlan executes a previously created plan. A plan runs once; its
+// status, result, and error are recorded on the stored plan.
+func ExecutePlan(ctx context.Context, planID string) (BranchImpactResult, error) {
+	// Retrieve plan and mark it running
+	planExecMu.Lock()
+	stored, err := loadPlan(planID)
+	if err != nil {
+		planExecMu.Unlock()
+		return BranchImpactResult{}, err
+	}
+	switch status := stored.CurrentStatus(); status {
+	case PlanPending:
+	case PlanExpired:
+		planExecMu.Unlock()
+		return BranchImpactResult{}, fmt.Errorf("plan %s expired at %s; create a new one", stored.ID, stored.ExpiresAt.Format(time.RFC3339))
+	default:
+		planExecMu.Unlock()
+		return BranchImpactResult{}, fmt.Errorf("plan %s is %s; create a new one to run it again", stored.ID, status)
+	}
+	plan := *stored
+	startedAt := time.Now().UTC()
+	plan.Status = PlanRunning
+	plan.StartedAt = &startedAt
+	plan.PID = os.Getpid()
+	err = savePlan(&plan)
+	planExecMu.Unlock()
+	if err != nil {
+		return BranchImpactResult{}, err
 	}
 
 	// Execute the comparison with the plan's parameters
-	result, err := CompareBranches(ctx, plan.Params)
+	result, err := compareBranches(ctx, plan.Params, plan.ID)
 
-	// Clean up plan after execution (whether success or failure)
-	planStoreMu.Lock()
-	delete(planStore, planID)
-	planStoreMu.Unlock()
+	// Record the outcome (whether success or failure)
+	finishedAt := time.Now().UTC()
+	plan.FinishedAt = &finishedAt
+	plan.Result = &result
+	plan.Status = PlanSucceeded
+	if err != nil {
+		plan.Status = PlanFailed
+		if errors.Is(err, ErrAborted) {
+			plan.Status = PlanAborted
+		}
+		plan.Error = err.Error()
+	}
+	if saveErr := savePlan(&plan); saveErr != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("failed to record the run: %v", saveErr))
+	}
 
 	return result, err
 }
 
-// GetPlan retrieves a plan by ID
+// GetPlan retrieves a plan by ID or unique ID prefix, including plans
+// created before a restart
 func GetPlan(planID string) (*ExecutionPlan, error) {
-	planStoreMu.RLock()
-	defer planStoreMu.RUnlock()
-
-	plan, exists := planStore[planID]
-	if !exists {
-		return nil, fmt.Errorf("plan %s not found", planID)
-	}
-
-	return plan, nil
+	return loadPlan(planID)
 }
@@ -0,0 +1,142 @@
+package d2
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/google/pprof/profile"
+)
+
+// CombinedReport totals CPU across the services of a multi-service branch
+// comparison, so cost that moves from one service to another is visible
+// even when the combined total barely changes.
+type CombinedReport struct {
+	Services      []ServiceCPU `json:"services"`
+	BeforeSeconds float64      `json:"before_seconds"`
+	AfterSeconds  float64      `json:"after_seconds"`
+	DeltaSeconds  float64      `json:"delta_seconds"`
+	DeltaPct      float64      `json:"delta_pct"`
+}
+
+// ServiceCPU is one service's CPU time on each ref and its share of the
+// combined total
+type ServiceCPU struct {
+	Service          string  `json:"service"`
+	BeforeSeconds    float64 `json:"before_seconds"`
+	AfterSeconds     float64 `json:"after_seconds"`
+	DeltaSeconds     float64 `json:"delta_seconds"`
+	DeltaPct         float64 `json:"delta_pct"`
+	BeforeSharePct   float64 `json:"before_share_pct"`
+	AfterSharePct    float64 `json:"after_share_pct"`
+	ShareShiftPoints float64 `json:"share_shift_points"`
+}
+
+// combinedReport reads each service's before and after CPU profile. A
+// service whose CPU profile is missing or unreadable is left out with a
+// warning rather than failing the comparison.
+func combinedReport(services []ServiceImpact) (*CombinedReport, []string) {
+	report := &CombinedReport{}
+	var warnings []string
+	for _, service := range services {
+		before, err := cpuSeconds(service.BeforeProfiles)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("combined report skips %s: before %v", service.Service, err))
+			continue
+		}
+		after, err := cpuSeconds(service.AfterProfiles)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("combined report skips %s: after %v", service.Service, err))
+			continue
+		}
+		report.Services = append(report.Services, ServiceCPU{
+			Service:       service.Service,
+			BeforeSeconds: before,
+			AfterSeconds:  after,
+			DeltaSeconds:  after - before,
+			DeltaPct:      percentChange(before, after),
+		})
+		report.BeforeSeconds += before
+		report.AfterSeconds += after
+	}
+	if len(report.Services) == 0 {
+		return nil, warnings
+	}
+	for i := range report.Services {
+		service := &report.Services[i]
+		service.BeforeSharePct = share(service.BeforeSeconds, report.BeforeSeconds)
+		service.AfterSharePct = share(service.AfterSeconds, report.AfterSeconds)
+		service.ShareShiftPoints = service.AfterSharePct - service.BeforeSharePct
+	}
+	report.DeltaSeconds = report.AfterSeconds - report.BeforeSeconds
+	report.DeltaPct = percentChange(report.BeforeSeconds, report.AfterSeconds)
+	return report, warnings
+}
+
+// cpuSeconds sums the cpu sample values of a downloaded CPU profile
+func cpuSeconds(result DownloadResult) (float64, error) {
+	prof, index, err := readCPUProfile(result)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, sample := range prof.Sample {
+		total += sample.Value[index]
+	}
+	return toSeconds(prof, index, total), nil
+}
+
+// readCPUProfile parses the CPU profile of a download and returns the index
+// of its cpu sample type
+func readCPUProfile(result DownloadResult) (*profile.Profile, int, error) {
+	path := profilePath(result, "cpu")
+	if path == "" {
+		return nil, 0, fmt.Errorf("cpu profile missing")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	prof, err := profile.Parse(f)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for i, st := range prof.SampleType {
+		if st.Type == "cpu" {
+			return prof, i, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("%s has no cpu samples", path)
+}
+
+// toSeconds converts a cpu sample value to seconds
+func toSeconds(prof *profile.Profile, index int, value int64) float64 {
+	if prof.SampleType[index].Unit == "nanoseconds" {
+		return float64(value) / 1e9
+	}
+	return float64(value)
+}
+
+// profilePath returns the path of the downloaded profile of one type
+func profilePath(result DownloadResult, profileType string) string {
+	for _, file := range result.Files {
+		if file.Type == profileType {
+			return file.Path
+		}
+	}
+	return ""
+}
+
+func percentChange(before, after float64) float64 {
+	if before == 0 {
+		return 0
+	}
+	return (after - before) / before * 100
+}
+
+func share(part, total float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return part / total * 100
+}
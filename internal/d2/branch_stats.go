@@ -0,0 +1,317 @@
+package d2
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+const (
+	// maxRuns bounds the CPU captures per ref
+	maxRuns = 10
+	// statsTopFunctions is how many functions a RepeatedStats lists
+	statsTopFunctions = 20
+)
+
+// RepeatedStats compares one service's CPU across repeated captures of each
+// ref, so a change is judged against run-to-run noise rather than a single
+// pair of profiles.
+type RepeatedStats struct {
+	Service     string          `json:"service"`
+	Runs        int             `json:"runs"` // captures per ref
+	Total       FunctionDelta   `json:"total"`
+	Functions   []FunctionDelta `json:"functions"`   // largest mean changes first
+	Significant int             `json:"significant"` // functions whose 95% interval excludes zero
+}
+
+// FunctionDelta is a function's flat CPU seconds per capture on each ref.
+// CILow and CIHigh bound the change in the mean with 95% confidence (Welch's
+// t-interval).
+type FunctionDelta struct {
+	Function     string  `json:"function"`
+	BeforeMean   float64 `json:"before_mean"`
+	BeforeStddev float64 `json:"before_stddev"`
+	AfterMean    float64 `json:"after_mean"`
+	AfterStddev  float64 `json:"after_stddev"`
+	Delta        float64 `json:"delta"`
+	DeltaPct     float64 `json:"delta_pct"`
+	CILow        float64 `json:"ci_low"`
+	CIHigh       float64 `json:"ci_high"`
+	Significant  bool    `json:"significant"`
+}
+
+// runs is the number of CPU captures per ref
+func (p BranchImpactParams) runs() int {
+	if p.Runs <= 0 {
+		return 1
+	}
+	return p.Runs
+}
+
+// repeatedStats reads the CPU profile of every run on both refs and compares
+// per-function flat CPU. Runs whose profile cannot be read are dropped with
+// a warning; at least two per ref are needed.
+func repeatedStats(service string, before, after []DownloadResult) (*RepeatedStats, []string) {
+	var warnings []string
+	read := func(side string, results []DownloadResult) []map[string]float64 {
+		var runs []map[string]float64
+		for i, result := range results {
+			flat, err := flatCPU(result)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("statistics skip %s %s run %d: %v", service, side, i+1, err))
+				continue
+			}
+			runs = append(runs, flat)
+		}
+		return runs
+	}
+	beforeRuns, afterRuns := read("before", before), read("after", after)
+	if len(beforeRuns) < 2 || len(afterRuns) < 2 {
+		return nil, append(warnings, fmt.Sprintf("statistics for %s need two readable CPU profiles per ref", service))
+	}
+
+	functions := map[string]bool{}
+	for _, run := range append(append([]map[string]float64{}, beforeRuns...), afterRuns...) {
+		for name := range run {
+			functions[name] = true
+		}
+	}
+	stats := &RepeatedStats{
+		Service: service,
+		Runs:    min(len(beforeRuns), len(afterRuns)),
+		Total:   compareRuns("total", beforeRuns, afterRuns, totalCPU),
+	}
+	for name := range functions {
+		delta := compareRuns(name, beforeRuns, afterRuns, func(run map[string]float64) float64 { return run[name] })
+		if delta.Significant {
+			stats.Significant++
+		}
+		stats.Functions = append(stats.Functions, delta)
+	}
+	sort.Slice(stats.Functions, func(i, j int) bool {
+		a, b := stats.Functions[i], stats.Functions[j]
+		if a.Significant != b.Significant {
+			return a.Significant
+		}
+		if math.Abs(a.Delta) != math.Abs(b.Delta) {
+			return math.Abs(a.Delta) > math.Abs(b.Delta)
+		}
+		return a.Function < b.Function
+	})
+	if len(stats.Functions) > statsTopFunctions {
+		stats.Functions = stats.Functions[:statsTopFunctions]
+	}
+	return stats, warnings
+}
+
+func totalCPU(run map[string]float64) float64 {
+	var total float64
+	for _, seconds := range run {
+		total += seconds
+	}
+	return total
+}
+
+// compareRuns compares one value across the before and after runs
+func compareRuns(name string, before, after []map[string]float64, value func(map[string]float64) float64) FunctionDelta {
+	b := make([]float64, len(before))
+	for i, run := range before {
+		b[i] = value(run)
+	}
+	a := make([]float64, len(after))
+	for i, run := range after {
+		a[i] = value(run)
+	}
+	bMean, bVar := meanVariance(b)
+	aMean, aVar := meanVariance(a)
+	delta := FunctionDelta{
+		Function:     name,
+		BeforeMean:   bMean,
+		BeforeStddev: math.Sqrt(bVar),
+		AfterMean:    aMean,
+		AfterStddev:  math.Sqrt(aVar),
+		Delta:        aMean - bMean,
+		DeltaPct:     percentChange(bMean, aMean),
+	}
+	low, high := welchInterval(delta.Delta, bVar, len(b), aVar, len(a))
+	delta.CILow, delta.CIHigh = low, high
+	delta.Significant = delta.Delta != 0 && (low > 0 || high < 0)
+	return delta
+}
+
+// meanVariance returns the mean and sample variance
+func meanVariance(values []float64) (float64, float64) {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	if len(values) < 2 {
+		return mean, 0
+	}
+	var squares float64
+	for _, v := range values {
+		squares += (v - mean) * (v - mean)
+	}
+	return mean, squares / float64(len(values)-1)
+}
+
+// welchInterval is the 95% confidence interval for a difference in means
+// with unequal variances
+func welchInterval(delta, varA float64, nA int, varB float64, nB int) (float64, float64) {
+	a, b := varA/float64(nA), varB/float64(nB)
+	se := math.Sqrt(a + b)
+	if se == 0 {
+		return delta, delta
+	}
+	df := (a + b) * (a + b) / (a*a/float64(nA-1) + b*b/float64(nB-1))
+	margin := tCritical95(df) * se
+	return delta - margin, delta + margin
+}
+
+// tCritical95 is the two-sided 95% critical value of Student's t
+// distribution, rounding df down
+func tCritical95(df float64) float64 {
+	table := []float64{12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+		2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+		2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042}
+	n := int(df)
+	switch {
+	case n < 1:
+		return table[0]
+	case n <= len(table):
+		return table[n-1]
+	default:
+		return 1.96
+	}
+}
+
+// flatCPU attributes each sample's CPU seconds to its leaf function
+func flatCPU(result DownloadResult) (map[string]float64, error) {
+	prof, index, err := readCPUProfile(result)
+	if err != nil {
+		return nil, err
+	}
+	flat := map[string]float64{}
+	for _, sample := range prof.Sample {
+		if len(sample.Location) == 0 {
+			continue
+		}
+		flat[leafFunction(sample.Location[0])] += toSeconds(prof, index, sample.Value[index])
+	}
+	return flat, nil
+}
+
+func leafFunction(location *profile.Location) string {
+	if len(location.Line) > 0 && location.Line[0].Function != nil {
+		return location.Line[0].Function.Name
+	}
+	return fmt.Sprintf("0x%x", location.Address)
+}
+
+// mergeRuns combines a service's repeated captures of one ref into a single
+// result: the CPU profiles are merged and scaled to the mean per capture, so
+// handles and diffs read like one run, and the other profile types come from
+// the last run.
+func mergeRuns(service, outDir string, runs []DownloadResult) (DownloadResult, error) {
+	merged := runs[len(runs)-1]
+	merged.Files = append([]ProfileFile(nil), merged.Files...)
+	merged.Warnings = nil
+	var profiles []*profile.Profile
+	for i, run := range runs {
+		merged.Warnings = append(merged.Warnings, run.Warnings...)
+		prof, _, err := readCPUProfile(run)
+		if err != nil {
+			merged.Warnings = append(merged.Warnings, fmt.Sprintf("run %d left out of the merged CPU profile: %v", i+1, err))
+			continue
+		}
+		profiles = append(profiles, prof)
+	}
+	if len(profiles) == 0 {
+		return merged, nil
+	}
+	prof, err := profile.Merge(profiles)
+	if err != nil {
+		return merged, fmt.Errorf("failed to merge %s CPU profiles: %w", service, err)
+	}
+	prof.Scale(1 / float64(len(profiles)))
+
+	path := filepath.Join(outDir, fmt.Sprintf("%s_cpu_merged.pprof", service))
+	f, err := os.Create(path)
+	if err != nil {
+		return merged, fmt.Errorf("failed to write merged CPU profile: %w", err)
+	}
+	if err := prof.Write(f); err != nil {
+		f.Close()
+		return merged, fmt.Errorf("failed to write merged CPU profile: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return merged, fmt.Errorf("failed to write merged CPU profile: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return merged, err
+	}
+	file := ProfileFile{Type: "cpu", Path: path, Bytes: info.Size()}
+	replaced := false
+	for i := range merged.Files {
+		if merged.Files[i].Type == "cpu" {
+			merged.Files[i], replaced = file, true
+		}
+	}
+	if !replaced {
+		merged.Files = append([]ProfileFile{file}, merged.Files...)
+	}
+	return merged, nil
+}
+
+// combineLoads totals the load summaries of repeated captures: requests add
+// up, rates and latencies are averaged over the runs that reported them
+func combineLoads(loads []*LoadSummary) *LoadSummary {
+	var combined *LoadSummary
+	var errs []string
+	reported := 0
+	for i, load := range loads {
+		if load == nil {
+			continue
+		}
+		if combined == nil {
+			combined = &LoadSummary{Tool: load.Tool, Command: load.Command}
+		}
+		combined.Seconds += load.Seconds
+		combined.Output = load.Output
+		if load.Error != "" {
+			errs = append(errs, fmt.Sprintf("run %d: %s", i+1, load.Error))
+		}
+		if load.Requests == 0 {
+			continue
+		}
+		reported++
+		combined.Requests += load.Requests
+		combined.Rate += load.Rate
+		combined.Success += load.Success * load.Requests
+		combined.MeanMS += load.MeanMS
+		combined.P50MS += load.P50MS
+		combined.P95MS += load.P95MS
+		combined.P99MS += load.P99MS
+	}
+	if combined == nil {
+		return nil
+	}
+	if reported > 0 {
+		n := float64(reported)
+		combined.Success /= combined.Requests
+		combined.Rate /= n
+		combined.MeanMS /= n
+		combined.P50MS /= n
+		combined.P95MS /= n
+		combined.P99MS /= n
+	}
+	combined.Error = strings.Join(errs, "; ")
+	return combined
+}
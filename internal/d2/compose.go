@@ -0,0 +1,201 @@
+package d2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+)
+
+// defaultComposePprofPort is the container port pprof is served on when
+// pprof_port is unset
+const defaultComposePprofPort = 6060
+
+// composeEnv watches docker compose services run from the working tree, for
+// example under `docker compose watch` with a rebuild action. A rebuild
+// recreates the container; profiles are fetched over plain HTTP from the
+// host port published for the pprof port. COMPOSE_FILE and
+// COMPOSE_PROJECT_NAME select the project as they do for docker compose.
+type composeEnv struct{}
+
+func (composeEnv) name() string { return "docker compose" }
+
+func (composeEnv) methods() (recreate, restart string) {
+	return "container_recreate", "container_restart"
+}
+
+func (composeEnv) state(ctx context.Context, service string, params BranchImpactParams) (devState, error) {
+	service, err := composeService(ctx, service)
+	if err != nil {
+		return devState{}, err
+	}
+	id, err := composeContainer(ctx, service)
+	if err != nil {
+		return devState{}, err
+	}
+	output, err := cmdrun.Output(ctx, cmdrun.Docker, "docker", "inspect", id)
+	if err != nil {
+		return devState{}, fmt.Errorf("docker inspect %s failed: %w", id, commandError(err))
+	}
+	var containers []struct {
+		ID    string `json:"Id"`
+		State struct {
+			Running   bool      `json:"Running"`
+			StartedAt time.Time `json:"StartedAt"`
+		} `json:"State"`
+	}
+	if err := json.Unmarshal(output, &containers); err != nil {
+		return devState{}, fmt.Errorf("failed to parse docker inspect output: %w", err)
+	}
+	if len(containers) == 0 || !containers[0].State.Running {
+		return devState{}, fmt.Errorf("container for compose service %s is not running", service)
+	}
+	return devState{Instance: containers[0].ID, StartedAt: containers[0].State.StartedAt}, nil
+}
+
+func (composeEnv) download(ctx context.Context, params DownloadParams) (DownloadResult, error) {
+	result := DownloadResult{Service: params.Service, Files: []ProfileFile{}, Warnings: []string{}}
+	service, err := composeService(ctx, params.Service)
+	if err != nil {
+		return result, err
+	}
+	id, err := composeContainer(ctx, service)
+	if err != nil {
+		return result, err
+	}
+	result.PodName = service
+	result.Port = composePort(params.Port)
+
+	address, err := composeAddress(ctx, service, result.Port)
+	if err != nil {
+		return result, err
+	}
+	if err := os.MkdirAll(params.OutDir, 0o755); err != nil {
+		return result, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	if err := fetchProfiles(ctx, params, "http://"+address, "", &result); err != nil {
+		return result, err
+	}
+	if len(result.Files) == 0 {
+		return result, fmt.Errorf("failed to download any profiles from container %.12s", id)
+	}
+	return result, nil
+}
+
+func (composeEnv) downloadCommands(params DownloadParams) (DryRunResult, error) {
+	endpoints, err := params.endpoints()
+	if err != nil {
+		return DryRunResult{}, err
+	}
+	port := strconv.Itoa(composePort(params.Port))
+	portCommand := formatCommand("docker", "compose", "port", params.Service, port)
+	commands := []string{
+		formatCommand("docker", "compose", "ps", "-q", params.Service),
+		portCommand,
+		formatCommand("mkdir", "-p", params.OutDir),
+	}
+	base := "http://" + hostPortPlaceholder
+	if params.Rates.Enabled() {
+		commands = append(commands, formatCommand("curl", "-s", "-X", "PUT", base+params.Rates.SetURL()))
+	}
+	for _, ep := range endpoints {
+		outPath := filepath.Join(params.OutDir, fmt.Sprintf("%s_%s_%s", params.Service, timestampPlaceholder, ep.filename))
+		commands = append(commands, formatCommand("curl", "-s", "-o", outPath, base+ep.pathQuery()))
+	}
+	if params.Rates.Enabled() {
+		commands = append(commands, formatCommand("curl", "-s", "-X", "PUT", base+params.Rates.RestoreURL()))
+	}
+	return DryRunResult{
+		Service:  params.Service,
+		Command:  portCommand,
+		Commands: commands,
+		Notes: []string{
+			fmt.Sprintf("pprof is fetched over plain HTTP from the host port docker compose publishes for container port %s; publish it in the compose file.", port),
+			"HTTP requests are made in-process; curl equivalents are shown for reference.",
+		},
+	}, nil
+}
+
+func (composeEnv) pollCommands(service string, params BranchImpactParams) []string {
+	return []string{
+		formatCommand("docker", "compose", "ps", "-q", service),
+		formatCommand("docker", "inspect", containerPlaceholder),
+	}
+}
+
+func composePort(port int) int {
+	if port > 0 {
+		return port
+	}
+	return defaultComposePprofPort
+}
+
+// composeService resolves service to a compose service name, matching by
+// substring when there is no exact match
+func composeService(ctx context.Context, service string) (string, error) {
+	output, err := cmdrun.Output(ctx, cmdrun.Docker, "docker", "compose", "config", "--services")
+	if err != nil {
+		return "", fmt.Errorf("failed to list compose services: %w", commandError(err))
+	}
+	services := strings.Fields(string(output))
+	for _, name := range services {
+		if name == service {
+			return name, nil
+		}
+	}
+	serviceLower := strings.ToLower(service)
+	for _, name := range services {
+		nameLower := strings.ToLower(name)
+		if strings.Contains(nameLower, serviceLower) || strings.Contains(serviceLower, nameLower) {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("no compose service found matching %q", service)
+}
+
+// composeContainer returns the ID of the service's running container
+func composeContainer(ctx context.Context, service string) (string, error) {
+	output, err := cmdrun.Output(ctx, cmdrun.Docker, "docker", "compose", "ps", "-q", service)
+	if err != nil {
+		return "", fmt.Errorf("docker compose ps failed: %w", commandError(err))
+	}
+	ids := strings.Fields(string(output))
+	if len(ids) == 0 {
+		return "", fmt.Errorf("no running container for compose service %s", service)
+	}
+	return ids[0], nil
+}
+
+// composeAddress returns the host address published for a container port
+func composeAddress(ctx context.Context, service string, port int) (string, error) {
+	output, err := cmdrun.Output(ctx, cmdrun.Docker, "docker", "compose", "port", service, strconv.Itoa(port))
+	if err != nil {
+		return "", fmt.Errorf("container port %d of %s is not published: %w", port, service, commandError(err))
+	}
+	host, hostPort, err := net.SplitHostPort(strings.TrimSpace(strings.SplitN(string(output), "\n", 2)[0]))
+	if err != nil {
+		return "", fmt.Errorf("unexpected docker compose port output %q", strings.TrimSpace(string(output)))
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, hostPort), nil
+}
+
+// commandError includes a failed command's stderr in its error
+func commandError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return err
+}
@@ -0,0 +1,123 @@
+package d2
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Dev environment drivers for branch impact
+const (
+	DevEnvTilt     = "tilt"
+	DevEnvCompose  = "compose"
+	DevEnvSkaffold = "skaffold"
+	DevEnvRollout  = "rollout"
+)
+
+// devEnv is a local dev environment that rebuilds services after a checkout.
+// It reports each service's running instance so waitForRebuild can tell a
+// rebuild happened, and knows how to pull profiles from that instance.
+type devEnv interface {
+	name() string
+	state(ctx context.Context, service string, params BranchImpactParams) (devState, error)
+	// methods names the update methods reported when the instance is
+	// replaced or restarted
+	methods() (recreate, restart string)
+	download(ctx context.Context, params DownloadParams) (DownloadResult, error)
+	downloadCommands(params DownloadParams) (DryRunResult, error)
+	// pollCommands lists the queries state runs, for dry runs
+	pollCommands(service string, params BranchImpactParams) []string
+}
+
+// devState is a service's running instance: a pod or container
+type devState struct {
+	Instance   string // pod name or container ID; changes when recreated
+	StartedAt  time.Time
+	LastSynced *time.Time // last in-place file sync (Tilt live update)
+	// Pending is set while a rollout is in progress; Instance is then the
+	// revision being rolled out, not yet serving on every replica
+	Pending bool
+}
+
+// devEnv picks the driver from params.DevEnv, then PPROF_MCP_DEV_ENV, and
+// defaults to Tilt
+func (p BranchImpactParams) devEnv() (devEnv, error) {
+	return resolveDevEnv(p.DevEnv)
+}
+
+// resolveDevEnv returns the named driver, falling back to PPROF_MCP_DEV_ENV
+// and then Tilt when name is empty
+func resolveDevEnv(name string) (devEnv, error) {
+	name = strings.ToLower(strings.TrimSpace(firstNonEmpty(name, os.Getenv("PPROF_MCP_DEV_ENV"))))
+	switch name {
+	case "", DevEnvTilt:
+		return tiltEnv{}, nil
+	case DevEnvCompose, "docker-compose":
+		return composeEnv{}, nil
+	case DevEnvSkaffold:
+		return skaffoldEnv{}, nil
+	case DevEnvRollout, "kubernetes", "k8s":
+		return rolloutEnv{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported dev_env %q (want tilt, compose, skaffold, or rollout)", name)
+	}
+}
+
+// waitForRebuild waits for the dev environment to rebuild the service after
+// a git change, starting from the state recorded right after the checkout
+func waitForRebuild(ctx context.Context, env devEnv, service string, params BranchImpactParams, initialState devState) (string, error) {
+	// Initial delay to let the dev environment detect the change
+	if err := sleepContext(ctx, 5*time.Second); err != nil {
+		return "", err
+	}
+
+	// Poll for changes
+	deadline := time.Now().Add(params.RebuildTimeout)
+	ticker := time.NewTicker(3 * time.Second)
+	defer ticker.Stop()
+	recreate, restart := env.methods()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(time.Until(deadline)):
+			return "", fmt.Errorf("timeout waiting for rebuild after %v", params.RebuildTimeout)
+		case <-ticker.C:
+			currentState, err := env.state(ctx, service, params)
+			if err != nil {
+				// State unavailable (e.g. mid-recreate), continue polling
+				continue
+			}
+
+			if currentState.Pending {
+				// Mid-rollout: wait until every replica runs the new code
+				continue
+			}
+
+			// Detect what changed. A rollout already in progress after
+			// the checkout is taken to be the one shipping it.
+			if currentState.Instance != initialState.Instance || initialState.Pending {
+				// Pod or container was recreated (full rebuild)
+				return recreate, sleepContext(ctx, params.WarmupDelay)
+			}
+
+			if !currentState.StartedAt.Equal(initialState.StartedAt) {
+				// Container restarted
+				return restart, sleepContext(ctx, params.WarmupDelay)
+			}
+
+			if currentState.LastSynced != nil && initialState.LastSynced != nil {
+				if currentState.LastSynced.After(*initialState.LastSynced) {
+					// Live update happened
+					return "live_update", sleepContext(ctx, params.WarmupDelay)
+				}
+			} else if currentState.LastSynced != nil && initialState.LastSynced == nil {
+				// First live update
+				return "live_update", sleepContext(ctx, params.WarmupDelay)
+			}
+		}
+	}
+}
@@ -8,8 +8,12 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/k8s"
 )
 
 const (
@@ -18,10 +22,21 @@ const (
 
 // DownloadParams contains parameters for downloading profiles from d2
 type DownloadParams struct {
-	Service   string
-	Namespace string // defaults to "default"
-	OutDir    string
-	Seconds   int // duration for CPU profile (default 30)
+	Service     string
+	Namespace   string // defaults to "default"
+	KubeContext string // kubectl context; defaults to the current one
+	OutDir      string
+	Seconds     int // duration for CPU profile (default 30)
+	// Target skips Tilt pod discovery and the debug token: a workload
+	// (deployment/api, statefulset/db) or label selector (app=api) whose
+	// first running pod serves net/http/pprof over plain HTTP on Port.
+	Target string
+	Port   int // pprof port for Target (default: discovered from the pod)
+	// Types limits the profiles fetched (default: all of profileEndpoints)
+	Types []string
+	// Rates turns on mutex and block profiling for the capture and puts the
+	// previous rates back afterwards
+	Rates k8s.Rates
 }
 
 // DownloadResult contains the results of a profile download
@@ -30,8 +45,12 @@ type DownloadResult struct {
 	Namespace string        `json:"namespace"`
 	PodName   string        `json:"pod_name"`
 	PodIP     string        `json:"pod_ip"`
+	Port      int           `json:"port,omitempty"` // pprof port used for a Target
 	Files     []ProfileFile `json:"files"`
-	Warnings  []string      `json:"warnings,omitempty"`
+	// PodHealth is the pod's restarts and recent events, read after the
+	// profiles so a recycled pod is not mistaken for a steady one
+	PodHealth *k8s.PodHealth `json:"pod_health,omitempty"`
+	Warnings  []string       `json:"warnings,omitempty"`
 }
 
 // ProfileFile represents a downloaded profile file
@@ -49,11 +68,78 @@ type profileEndpoint struct {
 	seconds  int // for CPU profile
 }
 
+var maxDownloadBytes atomic.Int64
+
+// SetMaxDownloadBytes caps the size of each downloaded profile (0 = no cap)
+func SetMaxDownloadBytes(limit int64) {
+	maxDownloadBytes.Store(limit)
+}
+
+// profileEndpoints lists the pprof endpoints downloaded from each pod
+func profileEndpoints(seconds int) []profileEndpoint {
+	return []profileEndpoint{
+		{name: "cpu", path: "/debug/pprof/profile", filename: "cpu.pprof", seconds: seconds},
+		{name: "heap", path: "/debug/pprof/heap", filename: "heap.pprof"},
+		{name: "goroutine", path: "/debug/pprof/goroutine", filename: "goroutines.pprof"},
+		{name: "mutex", path: "/debug/pprof/mutex", filename: "mutex.pprof"},
+		{name: "block", path: "/debug/pprof/block", filename: "block.pprof"},
+		{name: "allocs", path: "/debug/pprof/allocs", filename: "allocs.pprof"},
+		{name: "threadcreate", path: "/debug/pprof/threadcreate", filename: "threadcreate.pprof"},
+	}
+}
+
+// endpoints returns the endpoints of the requested profile types, in
+// profileEndpoints order so the CPU profile is the window mutex and block
+// samples are collected in
+func (p DownloadParams) endpoints() ([]profileEndpoint, error) {
+	seconds := p.Seconds
+	if seconds <= 0 {
+		seconds = 30
+	}
+	all := profileEndpoints(seconds)
+	if len(p.Types) == 0 {
+		return all, nil
+	}
+	wanted := map[string]bool{}
+	for _, name := range p.Types {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "goroutines" {
+			name = "goroutine"
+		}
+		found := false
+		for _, ep := range all {
+			found = found || ep.name == name
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown profile type %q (want cpu, heap, allocs, goroutines, mutex, block, or threadcreate)", name)
+		}
+		wanted[name] = true
+	}
+	var selected []profileEndpoint
+	for _, ep := range all {
+		if wanted[ep.name] {
+			selected = append(selected, ep)
+		}
+	}
+	return selected, nil
+}
+
 // DownloadProfiles downloads pprof profiles from a d2 service
 func DownloadProfiles(ctx context.Context, params DownloadParams) (DownloadResult, error) {
+	if params.Target != "" {
+		if params.OutDir == "" {
+			return DownloadResult{}, fmt.Errorf("out_dir is required")
+		}
+		return downloadFromTarget(ctx, params)
+	}
 	if params.Service == "" {
 		return DownloadResult{}, fmt.Errorf("service is required")
 	}
+	if k8s.Mode() == k8s.ModeInCluster {
+		// The Tilt path shells out to kubectl and tilt; only targets are
+		// captured through the API server.
+		return DownloadResult{}, fmt.Errorf("in-cluster mode can only capture a target (deployment/<name> or a label selector), not a Tilt service")
+	}
 
 	if params.OutDir == "" {
 		return DownloadResult{}, fmt.Errorf("out_dir is required")
@@ -63,9 +149,8 @@ func DownloadProfiles(ctx context.Context, params DownloadParams) (DownloadResul
 		params.Namespace = "default"
 	}
 
-	seconds := params.Seconds
-	if seconds <= 0 {
-		seconds = 30
+	if _, err := params.endpoints(); err != nil {
+		return DownloadResult{}, err
 	}
 
 	result := DownloadResult{
@@ -76,7 +161,7 @@ func DownloadProfiles(ctx context.Context, params DownloadParams) (DownloadResul
 	}
 
 	// Step 1: Find the pod
-	pod, err := FindPod(ctx, params.Service)
+	pod, err := FindPod(ctx, params.KubeContext, params.Namespace, params.Service)
 	if err != nil {
 		return result, fmt.Errorf("failed to find pod: %w", err)
 	}
@@ -104,51 +189,113 @@ func DownloadProfiles(ctx context.Context, params DownloadParams) (DownloadResul
 		return result, fmt.Errorf("failed to create output directory: %w", err)
 	}
 
-	// Step 5: Download all profile types
-	endpoints := []profileEndpoint{
-		{name: "cpu", path: "/debug/pprof/profile", filename: "cpu.pprof", seconds: seconds},
-		{name: "heap", path: "/debug/pprof/heap", filename: "heap.pprof"},
-		{name: "goroutine", path: "/debug/pprof/goroutine", filename: "goroutines.pprof"},
-		{name: "mutex", path: "/debug/pprof/mutex", filename: "mutex.pprof"},
-		{name: "block", path: "/debug/pprof/block", filename: "block.pprof"},
-		{name: "allocs", path: "/debug/pprof/allocs", filename: "allocs.pprof"},
-	}
-
-	for _, ep := range endpoints {
-		file, err := downloadProfile(ctx, localPort, token, ep, params.OutDir, params.Service)
-		if err != nil {
-			result.Warnings = append(result.Warnings,
-				fmt.Sprintf("Failed to download %s profile: %v", ep.name, err))
-			continue
-		}
-		result.Files = append(result.Files, file)
+	// Step 5: Download the profiles
+	if err := fetchProfiles(ctx, params, "https://127.0.0.1:"+strconv.Itoa(localPort), token, &result); err != nil {
+		return result, err
 	}
 
 	if len(result.Files) == 0 {
 		return result, fmt.Errorf("failed to download any profiles")
 	}
+	attachPodHealth(ctx, pod, &result)
 
 	return result, nil
 }
 
-// downloadProfile downloads a single profile from the specified endpoint
-func downloadProfile(ctx context.Context, localPort int, token string, ep profileEndpoint, outDir, service string) (ProfileFile, error) {
-	url := fmt.Sprintf("https://127.0.0.1:%d%s", localPort, ep.path)
+// attachPodHealth records the pod's restarts and events with the result. A
+// failed read only warns: the profiles are still good.
+func attachPodHealth(ctx context.Context, pod *PodInfo, result *DownloadResult) {
+	health, err := k8s.ReadPodHealth(ctx, pod)
+	if err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("pod restarts and events not recorded: %v", err))
+		return
+	}
+	result.PodHealth = health
+	result.Warnings = append(result.Warnings, health.Warnings()...)
+}
+
+// url returns the endpoint URL on the forwarded local port
+func (ep profileEndpoint) url(localPort string) string {
+	return "https://127.0.0.1:" + localPort + ep.pathQuery()
+}
 
-	// Add seconds parameter for CPU profile
+// pathQuery is the endpoint path, with the seconds parameter for the CPU
+// profile
+func (ep profileEndpoint) pathQuery() string {
 	if ep.seconds > 0 {
-		url = fmt.Sprintf("%s?seconds=%d", url, ep.seconds)
+		return fmt.Sprintf("%s?seconds=%d", ep.path, ep.seconds)
+	}
+	return ep.path
+}
+
+// fetchProfiles downloads the requested profiles from the pprof server at
+// baseURL into result. With rates set, mutex and block profiling is turned
+// on first and restored after the last download; a server without the rate
+// endpoint is profiled at its own rates, with a warning.
+func fetchProfiles(ctx context.Context, params DownloadParams, baseURL, token string, result *DownloadResult) error {
+	endpoints, err := params.endpoints()
+	if err != nil {
+		return err
+	}
+	if params.Rates.Enabled() {
+		header := http.Header{}
+		if token != "" {
+			header.Set("Ductone-Token", token)
+		}
+		restore, err := k8s.ApplyRates(ctx, debugClient(time.Minute), baseURL, header, params.Rates)
+		if err != nil {
+			result.Warnings = append(result.Warnings, err.Error())
+		} else {
+			defer func() {
+				if err := restore(); err != nil {
+					result.Warnings = append(result.Warnings, err.Error())
+				}
+			}()
+			// Without a CPU profile to sample alongside, give the rates
+			// the capture window on their own.
+			if endpoints[0].name != "cpu" {
+				window := params.Seconds
+				if window <= 0 {
+					window = 30
+				}
+				if err := sleepContext(ctx, time.Duration(window)*time.Second); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, ep := range endpoints {
+		file, err := downloadProfile(ctx, baseURL, token, ep, params.OutDir, params.Service)
+		if err != nil {
+			result.Warnings = append(result.Warnings,
+				fmt.Sprintf("Failed to download %s profile: %v", ep.name, err))
+			continue
+		}
+		result.Files = append(result.Files, file)
 	}
+	return nil
+}
 
-	// Create HTTP client
-	client := &http.Client{
-		Timeout: time.Duration(ep.seconds+60) * time.Second, // Extra time for CPU profile
+// debugClient talks to pprof servers, which serve d2's debug port with a
+// self-signed certificate
+func debugClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
 		Transport: &http.Transport{
 			TLSClientConfig: &tls.Config{
 				InsecureSkipVerify: true,
 			},
 		},
 	}
+}
+
+// downloadProfile downloads a single profile from the endpoint under
+// baseURL, sending the d2 debug token when one is given
+func downloadProfile(ctx context.Context, baseURL, token string, ep profileEndpoint, outDir, service string) (ProfileFile, error) {
+	url := baseURL + ep.pathQuery()
+
+	// Extra time for the CPU profile
+	client := debugClient(time.Duration(ep.seconds+60) * time.Second)
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
@@ -156,7 +303,9 @@ func downloadProfile(ctx context.Context, localPort int, token string, ep profil
 	}
 
 	// Add auth token header
-	req.Header.Set("Ductone-Token", token)
+	if token != "" {
+		req.Header.Set("Ductone-Token", token)
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -181,10 +330,20 @@ func downloadProfile(ctx context.Context, localPort int, token string, ep profil
 	}
 	defer outFile.Close()
 
-	written, err := io.Copy(outFile, resp.Body)
+	body := io.Reader(resp.Body)
+	limit := maxDownloadBytes.Load()
+	if limit > 0 {
+		body = io.LimitReader(resp.Body, limit+1)
+	}
+	written, err := io.Copy(outFile, body)
 	if err != nil {
 		return ProfileFile{}, fmt.Errorf("failed to write profile: %w", err)
 	}
+	if limit > 0 && written > limit {
+		outFile.Close()
+		os.Remove(outPath)
+		return ProfileFile{}, fmt.Errorf("profile exceeds the %d byte download limit", limit)
+	}
 
 	// Convert type name to match Datadog convention
 	typeName := ep.name
@@ -200,8 +359,8 @@ func downloadProfile(ctx context.Context, localPort int, token string, ep profil
 }
 
 // ListAvailableServices returns a list of available services that can be profiled
-func ListAvailableServices(ctx context.Context) ([]string, error) {
-	return ListServices(ctx)
+func ListAvailableServices(ctx context.Context, kubeContext, namespace string) ([]string, error) {
+	return ListServices(ctx, kubeContext, namespace)
 }
 
 // NormalizeServiceName ensures the service name follows the expected format
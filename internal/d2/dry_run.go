@@ -0,0 +1,238 @@
+package d2
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+	"github.com/arreyder/pprof-mcp/internal/k8s"
+)
+
+// Placeholders for values only known once the commands actually run
+const (
+	podPlaceholder       = "<pod>"
+	localPortPlaceholder = "<local-port>"
+	tokenPlaceholder     = "<token>"
+	timestampPlaceholder = "<timestamp>"
+	hostPortPlaceholder  = "<host-port>"
+	containerPlaceholder = "<container>"
+)
+
+// DryRunResult lists the commands a capture or branch comparison would execute
+type DryRunResult struct {
+	Service        string   `json:"service"`
+	Command        string   `json:"command"` // the command normal runs report
+	BeforeRef      string   `json:"before_ref,omitempty"`
+	AfterRef       string   `json:"after_ref,omitempty"`
+	CurrentBranch  string   `json:"current_branch,omitempty"`
+	HasUncommitted bool     `json:"has_uncommitted,omitempty"`
+	Commands       []string `json:"commands"`
+	Notes          []string `json:"notes,omitempty"`
+}
+
+// DownloadCommands returns the commands DownloadProfiles would run, without
+// contacting the cluster. Values resolved at runtime (pod name, local port,
+// debug token) appear as placeholders.
+func DownloadCommands(params DownloadParams) (DryRunResult, error) {
+	if params.Target != "" {
+		if params.OutDir == "" {
+			return DryRunResult{}, fmt.Errorf("out_dir is required")
+		}
+		return targetCommands(params)
+	}
+	if params.Service == "" {
+		return DryRunResult{}, fmt.Errorf("service is required")
+	}
+	if params.OutDir == "" {
+		return DryRunResult{}, fmt.Errorf("out_dir is required")
+	}
+	if params.Namespace == "" {
+		params.Namespace = "default"
+	}
+	endpoints, err := params.endpoints()
+	if err != nil {
+		return DryRunResult{}, err
+	}
+
+	contextArgs := k8s.ContextArgs(params.KubeContext)
+	portForward := formatCommand("kubectl", append(contextArgs, "port-forward", "-n", params.Namespace, podPlaceholder, fmt.Sprintf("%s:%d", localPortPlaceholder, debugPort))...)
+	commands := []string{
+		formatCommand("kubectl", append(contextArgs, "get", "pods", "-n", params.Namespace, "-l", "app="+params.Service, "-o", "json")...),
+		portForward,
+		formatCommand("curl", "-sk", "-X", "PUT", "-H", "Ductone-Profile: true", fmt.Sprintf("https://127.0.0.1:%s/debug/token", localPortPlaceholder)),
+		formatCommand("mkdir", "-p", params.OutDir),
+	}
+	base := "https://127.0.0.1:" + localPortPlaceholder
+	if params.Rates.Enabled() {
+		commands = append(commands, formatCommand("curl", "-sk", "-X", "PUT", "-H", "Ductone-Token: "+tokenPlaceholder, base+params.Rates.SetURL()))
+	}
+	for _, ep := range endpoints {
+		outPath := filepath.Join(params.OutDir, fmt.Sprintf("%s_%s_%s", params.Service, timestampPlaceholder, ep.filename))
+		commands = append(commands, formatCommand("curl", "-sk", "-H", "Ductone-Token: "+tokenPlaceholder, "-o", outPath, ep.url(localPortPlaceholder)))
+	}
+	if params.Rates.Enabled() {
+		commands = append(commands, formatCommand("curl", "-sk", "-X", "PUT", "-H", "Ductone-Token: "+tokenPlaceholder, base+params.Rates.RestoreURL()))
+	}
+	commands = append(commands, k8s.PodHealthCommands(params.KubeContext, params.Namespace, podPlaceholder)...)
+
+	return DryRunResult{
+		Service:  params.Service,
+		Command:  portForward,
+		Commands: commands,
+		Notes: []string{
+			fmt.Sprintf("If no pod has app=%s, pods are listed with `%s` and matched by name.", params.Service, formatCommand("kubectl", append(contextArgs, "get", "pods", "-n", params.Namespace, "-o", "json")...)),
+			"HTTP requests are made in-process; curl equivalents are shown for reference.",
+		},
+	}, nil
+}
+
+// BranchImpactCommands returns the commands CompareBranches would run. It reads
+// the current branch and working tree status (read-only git queries) to decide
+// whether a stash is needed, but does not stash, check out, or capture anything.
+func BranchImpactCommands(ctx context.Context, params BranchImpactParams) (DryRunResult, error) {
+	if params.BeforeRef == "" {
+		params.BeforeRef = "main"
+	}
+	if params.Seconds <= 0 {
+		params.Seconds = 30
+	}
+	if err := params.validate(); err != nil {
+		return DryRunResult{}, err
+	}
+
+	currentBranch, err := getCurrentBranch(ctx)
+	if err != nil {
+		return DryRunResult{}, fmt.Errorf("failed to get current branch: %w", err)
+	}
+	if params.AfterRef == "" {
+		params.AfterRef = currentBranch
+	}
+	hasUncommitted, err := hasUncommittedChanges(ctx)
+	if err != nil {
+		return DryRunResult{}, fmt.Errorf("failed to check git status: %w", err)
+	}
+
+	services := params.services()
+	env, _ := params.devEnv() // checked by validate
+	var rebuild []string
+	for _, service := range services {
+		rebuild = append(rebuild, env.pollCommands(service, params)...)
+	}
+	before, downloadNotes, err := captureCommands(env, params, services, params.BeforeRef, "before")
+	if err != nil {
+		return DryRunResult{}, err
+	}
+	after, _, err := captureCommands(env, params, services, params.AfterRef, "after")
+	if err != nil {
+		return DryRunResult{}, err
+	}
+
+	commands := []string{}
+	if hasUncommitted {
+		commands = append(commands, formatCommand("git", gitStashArgs(time.Now())...))
+	}
+	for _, side := range []struct {
+		ref      string
+		captures []string
+	}{{params.BeforeRef, before}, {params.AfterRef, after}} {
+		commands = append(commands, formatCommand("git", "checkout", side.ref))
+		if params.DeployCommand != "" {
+			commands = append(commands, cmdrun.ShellLine(deployCommand(params.DeployCommand, side.ref)))
+		}
+		commands = append(commands, rebuild...)
+		commands = append(commands, side.captures...)
+	}
+	commands = append(commands, formatCommand("git", "checkout", currentBranch))
+	if hasUncommitted {
+		commands = append(commands, formatCommand("git", "stash", "pop"))
+	}
+
+	notes := []string{
+		fmt.Sprintf("%s state is polled every 3s until a rebuild is detected (timeout %v), then the service warms up for %v.", env.name(), withDefault(params.RebuildTimeout, 5*time.Minute), withDefault(params.WarmupDelay, 15*time.Second)),
+	}
+	if _, tilt := env.(tiltEnv); tilt && params.KubeContext != "" {
+		notes = append(notes, "Tilt is queried through its own API server, which watches the cluster Tilt was started against; kube_context only applies to kubectl.")
+	}
+	if params.DeployCommand != "" {
+		notes = append(notes, "Each service's state is read before the deploy command runs, so the rollout it starts counts as the rebuild; a failing deploy command stops the run.")
+	}
+	if len(services) > 1 {
+		notes = append(notes, fmt.Sprintf("%s are watched and profiled concurrently on each ref; their CPU profiles are totaled into a combined report.", strings.Join(services, ", ")))
+	}
+	if params.runs() > 1 {
+		notes = append(notes, fmt.Sprintf("Each ref is captured %d times; the CPU profiles are merged into <service>_cpu_merged.pprof (mean per run) and compared per function with 95%% confidence intervals.", params.runs()))
+	}
+	if params.Load.enabled() {
+		notes = append(notes, fmt.Sprintf("Load runs in the background for %ds, starting %v before profiling, and is interrupted if it outlasts the capture.", loadSeconds(params.Seconds), loadLead))
+	}
+	if !params.SkipAnalysis {
+		notes = append(notes, fmt.Sprintf("After the original branch is restored, the cpu, mutex, and block profiles are diffed, hotspots are summarized on both refs, and the report is written to %s.", filepath.Join(params.OutDir, "report.md")))
+	}
+	notes = append(notes, downloadNotes...)
+
+	return DryRunResult{
+		Service:        params.Service,
+		Command:        formatCommand("git", "checkout", params.BeforeRef),
+		BeforeRef:      params.BeforeRef,
+		AfterRef:       params.AfterRef,
+		CurrentBranch:  currentBranch,
+		HasUncommitted: hasUncommitted,
+		Commands:       commands,
+		Notes:          notes,
+	}, nil
+}
+
+// PlanCommands returns the commands a stored plan would run without executing
+// or consuming it.
+func PlanCommands(ctx context.Context, planID string) (DryRunResult, error) {
+	plan, err := GetPlan(planID)
+	if err != nil {
+		return DryRunResult{}, err
+	}
+	return BranchImpactCommands(ctx, plan.Params)
+}
+
+// captureCommands lists every capture of one side: per run, the background
+// load and then each service's downloads. It also returns the download notes.
+func captureCommands(env devEnv, params BranchImpactParams, services []string, ref, side string) ([]string, []string, error) {
+	var commands, notes []string
+	for run := 1; run <= params.runs(); run++ {
+		commands = append(commands, loadCommands(params, ref, side, run)...)
+		for _, service := range services {
+			download, err := env.downloadCommands(params.downloadParams(side, service, run))
+			if err != nil {
+				return nil, nil, err
+			}
+			commands = append(commands, download.Commands...)
+			if notes == nil {
+				notes = download.Notes
+			}
+		}
+	}
+	return commands, notes, nil
+}
+
+// loadCommands lists the background load started before one capture
+func loadCommands(params BranchImpactParams, ref, side string, run int) []string {
+	if !params.Load.enabled() {
+		return nil
+	}
+	outDir := params.runDir(side, run)
+	command := params.Load.shellCommand(loadSeconds(params.Seconds), ref, side, filepath.Join(outDir, "load_summary.json"))
+	return []string{formatCommand("mkdir", "-p", outDir), cmdrun.ShellLine(command) + " &"}
+}
+
+func withDefault(value, fallback time.Duration) time.Duration {
+	if value == 0 {
+		return fallback
+	}
+	return value
+}
+
+// formatCommand renders a command line, quoting arguments that need it
+func formatCommand(name string, args ...string) string {
+	return cmdrun.Join(append([]string{name}, args...)...)
+}
@@ -0,0 +1,97 @@
+package d2
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/arreyder/pprof-mcp/internal/k8s"
+)
+
+// captureParams maps a plain-kubectl download onto a single-pod k8s capture
+func captureParams(params DownloadParams) (k8s.CaptureParams, error) {
+	workload, selector, err := k8s.ParseTarget(params.Target)
+	if err != nil {
+		return k8s.CaptureParams{}, err
+	}
+	return k8s.CaptureParams{
+		KubeContext: params.KubeContext,
+		Namespace:   params.Namespace,
+		Selector:    selector,
+		Workload:    workload,
+		Port:        params.Port,
+		OutDir:      params.OutDir,
+		Service:     params.Service,
+		Seconds:     params.Seconds,
+		Types:       params.Types,
+		Rates:       params.Rates,
+		MaxPods:     1,
+		Parallel:    1,
+	}, nil
+}
+
+// downloadFromTarget pulls the full profile set from one running pod of a
+// workload or label selector over plain HTTP. Unlike the Tilt path it needs no
+// debug token, so it works against any cluster kubectl can reach.
+func downloadFromTarget(ctx context.Context, params DownloadParams) (DownloadResult, error) {
+	capture, err := captureParams(params)
+	if err != nil {
+		return DownloadResult{}, err
+	}
+	captured, err := k8s.Capture(ctx, capture)
+	result := DownloadResult{
+		Service:   params.Service,
+		Namespace: captured.Namespace,
+		Files:     []ProfileFile{},
+		Warnings:  append([]string{}, captured.Warnings...),
+	}
+	if err != nil {
+		return result, err
+	}
+	bundle := captured.Bundles[0]
+	result.Service = bundle.Service
+	result.PodName = bundle.Pod
+	result.Port = bundle.Port
+	result.Warnings = append(result.Warnings, bundle.Warnings...)
+	for _, file := range bundle.Files {
+		result.Files = append(result.Files, ProfileFile{Type: file.Type, Path: file.Path, Bytes: file.Bytes})
+	}
+	attachPodHealth(ctx, &PodInfo{Name: bundle.Pod, Namespace: captured.Namespace, Context: captured.KubeContext}, &result)
+	return result, nil
+}
+
+// targetCommands is DownloadCommands for a plain-kubectl target
+func targetCommands(params DownloadParams) (DryRunResult, error) {
+	capture, err := captureParams(params)
+	if err != nil {
+		return DryRunResult{}, err
+	}
+	commands, err := k8s.CaptureCommands(capture)
+	if err != nil {
+		return DryRunResult{}, err
+	}
+	commands = append(commands, k8s.PodHealthCommands(params.KubeContext, firstNonEmpty(params.Namespace, "default"), podPlaceholder)...)
+	remotePort := "<port>"
+	if capture.Port > 0 {
+		remotePort = fmt.Sprint(capture.Port)
+	}
+	portForward := formatCommand("kubectl", append(k8s.ContextArgs(params.KubeContext), "port-forward", "-n", firstNonEmpty(params.Namespace, "default"), podPlaceholder, localPortPlaceholder+":"+remotePort)...)
+	return DryRunResult{
+		Service:  firstNonEmpty(params.Service, params.Target),
+		Command:  portForward,
+		Commands: commands,
+		Notes: []string{
+			"The first running pod matching the target is captured over plain HTTP (no Tilt debug token).",
+			"HTTP requests are made in-process; curl equivalents are shown for reference.",
+			"Without a port, each pod's pprof port is read from its pprof.port annotation, named container ports, or pprof/debug/admin args and env, falling back to 6060.",
+		},
+	}, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -5,58 +5,63 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"net"
 	"os/exec"
+	"sort"
 	"strings"
-	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+	"github.com/arreyder/pprof-mcp/internal/k8s"
 )
 
 // PodInfo contains information about a discovered pod
-type PodInfo struct {
-	Name      string
-	Namespace string
-	IP        string
-	Status    string
-}
+type PodInfo = k8s.PodInfo
 
 // PortForward manages a kubectl port-forward session
-type PortForward struct {
-	cmd        *exec.Cmd
-	localPort  int
-	remotePort int
-	cancel     context.CancelFunc
-}
+type PortForward = k8s.PortForward
 
-// FindPod discovers a pod for the given service in the default namespace
+// FindPod discovers a pod for the given service in namespace (default:
+// "default") using kubeContext (default: the current context).
 // Supports fuzzy matching - will try exact match first, then pattern matching
-func FindPod(ctx context.Context, service string) (*PodInfo, error) {
+func FindPod(ctx context.Context, kubeContext, namespace, service string) (*PodInfo, error) {
+	if namespace == "" {
+		namespace = "default"
+	}
 	// Try exact match first
-	pod, err := findPodByLabel(ctx, service)
+	pod, err := findPodByLabel(ctx, kubeContext, namespace, service)
 	if err == nil {
 		return pod, nil
 	}
 
 	// If exact match fails, try fuzzy matching
-	return findPodFuzzy(ctx, service)
+	return findPodFuzzy(ctx, kubeContext, namespace, service)
 }
 
-// findPodByLabel finds a pod using an exact app label match
-func findPodByLabel(ctx context.Context, service string) (*PodInfo, error) {
-	label := fmt.Sprintf("app=%s", service)
-
-	cmd := exec.CommandContext(ctx, "kubectl", "get", "pods",
-		"-n", "default",
-		"-l", label,
-		"-o", "json")
-
-	output, err := cmd.Output()
+// getPods lists pods in namespace as JSON, optionally filtered by label
+func getPods(ctx context.Context, kubeContext, namespace, label string) ([]byte, error) {
+	args := append(k8s.ContextArgs(kubeContext), "get", "pods", "-n", namespace)
+	if label != "" {
+		args = append(args, "-l", label)
+	}
+	output, err := cmdrun.Output(ctx, cmdrun.Kubectl, "kubectl", append(args, "-o", "json")...)
 	if err != nil {
+		var timeout *cmdrun.TimeoutError
 		var exitErr *exec.ExitError
-		if errors.As(err, &exitErr) {
+		if !errors.As(err, &timeout) && errors.As(err, &exitErr) {
 			return nil, fmt.Errorf("kubectl get pods failed: %s", string(exitErr.Stderr))
 		}
 		return nil, fmt.Errorf("kubectl get pods failed: %w", err)
 	}
+	return output, nil
+}
+
+// findPodByLabel finds a pod using an exact app label match
+func findPodByLabel(ctx context.Context, kubeContext, namespace, service string) (*PodInfo, error) {
+	label := fmt.Sprintf("app=%s", service)
+
+	output, err := getPods(ctx, kubeContext, namespace, label)
+	if err != nil {
+		return nil, err
+	}
 
 	var result struct {
 		Items []struct {
@@ -87,6 +92,7 @@ func findPodByLabel(ctx context.Context, service string) (*PodInfo, error) {
 				Namespace: item.Metadata.Namespace,
 				IP:        item.Status.PodIP,
 				Status:    item.Status.Phase,
+				Context:   kubeContext,
 			}, nil
 		}
 	}
@@ -95,19 +101,11 @@ func findPodByLabel(ctx context.Context, service string) (*PodInfo, error) {
 }
 
 // findPodFuzzy searches for pods where the app label contains the service name
-func findPodFuzzy(ctx context.Context, service string) (*PodInfo, error) {
+func findPodFuzzy(ctx context.Context, kubeContext, namespace, service string) (*PodInfo, error) {
 	// Get all running pods
-	cmd := exec.CommandContext(ctx, "kubectl", "get", "pods",
-		"-n", "default",
-		"-o", "json")
-
-	output, err := cmd.Output()
+	output, err := getPods(ctx, kubeContext, namespace, "")
 	if err != nil {
-		var exitErr *exec.ExitError
-		if errors.As(err, &exitErr) {
-			return nil, fmt.Errorf("kubectl get pods failed: %s", string(exitErr.Stderr))
-		}
-		return nil, fmt.Errorf("kubectl get pods failed: %w", err)
+		return nil, err
 	}
 
 	var result struct {
@@ -153,6 +151,7 @@ func findPodFuzzy(ctx context.Context, service string) (*PodInfo, error) {
 				Namespace: item.Metadata.Namespace,
 				IP:        item.Status.PodIP,
 				Status:    item.Status.Phase,
+				Context:   kubeContext,
 			})
 		}
 	}
@@ -176,109 +175,23 @@ func findPodFuzzy(ctx context.Context, service string) (*PodInfo, error) {
 
 // StartPortForward starts a kubectl port-forward to the pod's debug port
 func StartPortForward(ctx context.Context, pod *PodInfo, remotePort int) (*PortForward, error) {
-	// Find an available local port
-	localPort, err := findAvailablePort()
-	if err != nil {
-		return nil, fmt.Errorf("failed to find available port: %w", err)
-	}
-
-	// Create a cancellable context for the port-forward command
-	fwdCtx, cancel := context.WithCancel(ctx)
-
-	cmd := exec.CommandContext(fwdCtx, "kubectl", "port-forward",
-		"-n", pod.Namespace,
-		pod.Name,
-		fmt.Sprintf("%d:%d", localPort, remotePort))
-
-	// Start the port-forward in the background
-	if err := cmd.Start(); err != nil {
-		cancel()
-		return nil, fmt.Errorf("failed to start port-forward: %w", err)
-	}
-
-	pf := &PortForward{
-		cmd:        cmd,
-		localPort:  localPort,
-		remotePort: remotePort,
-		cancel:     cancel,
-	}
-
-	// Wait for port-forward to be ready
-	if err := pf.waitForReady(ctx); err != nil {
-		pf.Stop()
-		return nil, err
-	}
-
-	return pf, nil
+	return k8s.StartPortForward(ctx, pod, remotePort)
 }
 
-// LocalPort returns the local port being forwarded
-func (pf *PortForward) LocalPort() int {
-	return pf.localPort
+// PortForwardCommand renders the port-forward reported for a download
+func PortForwardCommand(kubeContext, namespace, pod string, port int) string {
+	return formatCommand("kubectl", append(k8s.ContextArgs(kubeContext), "port-forward", "-n", namespace, pod, fmt.Sprintf("%d:%d", port, port))...)
 }
 
-// Stop terminates the port-forward
-func (pf *PortForward) Stop() {
-	if pf.cancel != nil {
-		pf.cancel()
-	}
-	if pf.cmd != nil && pf.cmd.Process != nil {
-		_ = pf.cmd.Process.Kill()
-		_ = pf.cmd.Wait()
-	}
-}
-
-// waitForReady waits for the port-forward to be ready by attempting to connect
-func (pf *PortForward) waitForReady(ctx context.Context) error {
-	timeout := time.After(10 * time.Second)
-	ticker := time.NewTicker(100 * time.Millisecond)
-	defer ticker.Stop()
-
-	addr := fmt.Sprintf("127.0.0.1:%d", pf.localPort)
-
-	for {
-		select {
-		case <-timeout:
-			return fmt.Errorf("timeout waiting for port-forward to be ready")
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-ticker.C:
-			conn, err := net.DialTimeout("tcp", addr, 100*time.Millisecond)
-			if err == nil {
-				_ = conn.Close()
-				// Give it a bit more time to stabilize
-				time.Sleep(200 * time.Millisecond)
-				return nil
-			}
-		}
+// ListServices returns a list of available services in namespace (default:
+// "default") using kubeContext (default: the current context)
+func ListServices(ctx context.Context, kubeContext, namespace string) ([]string, error) {
+	if namespace == "" {
+		namespace = "default"
 	}
-}
-
-// findAvailablePort finds an available local port
-func findAvailablePort() (int, error) {
-	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	output, err := getPods(ctx, kubeContext, namespace, "")
 	if err != nil {
-		return 0, err
-	}
-	defer listener.Close()
-
-	addr := listener.Addr().(*net.TCPAddr)
-	return addr.Port, nil
-}
-
-// ListServices returns a list of available services in the default namespace
-func ListServices(ctx context.Context) ([]string, error) {
-	cmd := exec.CommandContext(ctx, "kubectl", "get", "pods",
-		"-n", "default",
-		"-o", "json")
-
-	output, err := cmd.Output()
-	if err != nil {
-		var exitErr *exec.ExitError
-		if errors.As(err, &exitErr) {
-			return nil, fmt.Errorf("kubectl get pods failed: %s", string(exitErr.Stderr))
-		}
-		return nil, fmt.Errorf("kubectl get pods failed: %w", err)
+		return nil, err
 	}
 
 	var result struct {
@@ -313,6 +226,7 @@ func ListServices(ctx context.Context) ([]string, error) {
 	for service := range serviceSet {
 		services = append(services, service)
 	}
+	sort.Strings(services)
 
 	return services, nil
 }
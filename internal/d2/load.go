@@ -0,0 +1,294 @@
+package d2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+)
+
+const (
+	// loadLead starts traffic before the CPU profile so the service is
+	// already under load when sampling begins
+	loadLead = 3 * time.Second
+	// loadOutputLimit caps the command output kept in a LoadSummary
+	loadOutputLimit = 4096
+	// loadDriftWarning is the request count difference between refs above
+	// which the comparison is flagged as not comparable
+	loadDriftWarning  = 0.10
+	defaultVegetaRate = 50
+)
+
+// LoadParams drives traffic while each ref is profiled, so before and after
+// profiles reflect comparable load. Set one of Command, K6Script, or
+// VegetaTargets.
+type LoadParams struct {
+	// Command is run with sh -c (cmd /C on Windows). {seconds}, {ref}, and {side} are replaced
+	// with the load duration, the git ref, and before/after.
+	Command       string `json:"command,omitempty"`
+	K6Script      string `json:"k6_script,omitempty"`      // k6 script; its options apply except duration
+	VegetaTargets string `json:"vegeta_targets,omitempty"` // vegeta targets file
+	Rate          int    `json:"rate,omitempty"`           // vegeta requests per second (default 50)
+}
+
+// LoadSummary is what the load tool reported for one capture window
+type LoadSummary struct {
+	Tool     string  `json:"tool"` // command, k6, or vegeta
+	Command  string  `json:"command"`
+	Seconds  int     `json:"seconds"`
+	Requests float64 `json:"requests,omitempty"`
+	Rate     float64 `json:"rate_per_sec,omitempty"`
+	Success  float64 `json:"success_ratio,omitempty"`
+	MeanMS   float64 `json:"latency_mean_ms,omitempty"`
+	P50MS    float64 `json:"latency_p50_ms,omitempty"`
+	P95MS    float64 `json:"latency_p95_ms,omitempty"`
+	P99MS    float64 `json:"latency_p99_ms,omitempty"`
+	Output   string  `json:"output,omitempty"` // tail of the tool's output
+	Error    string  `json:"error,omitempty"`
+}
+
+// enabled reports whether any load is configured
+func (l LoadParams) enabled() bool {
+	return l.Command != "" || l.K6Script != "" || l.VegetaTargets != ""
+}
+
+// validate checks at most one load source is set and its tool is installed
+func (l LoadParams) validate() error {
+	set := 0
+	for _, value := range []string{l.Command, l.K6Script, l.VegetaTargets} {
+		if strings.TrimSpace(value) != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return errors.New("set only one of load_command, k6_script, and vegeta_targets")
+	}
+	if tool := l.tool(); set == 1 && tool != "command" {
+		if _, err := exec.LookPath(tool); err != nil {
+			return fmt.Errorf("%s is required to generate load: %w", tool, err)
+		}
+	}
+	return nil
+}
+
+// tool names the load generator
+func (l LoadParams) tool() string {
+	switch {
+	case l.K6Script != "":
+		return "k6"
+	case l.VegetaTargets != "":
+		return "vegeta"
+	default:
+		return "command"
+	}
+}
+
+// shellCommand renders the command run for one capture window. Summaries
+// from k6 and vegeta are written to summaryPath.
+func (l LoadParams) shellCommand(seconds int, ref, side, summaryPath string) string {
+	duration := strconv.Itoa(seconds)
+	switch l.tool() {
+	case "k6":
+		return formatCommand("k6", "run", "--quiet", "--duration", duration+"s", "--summary-export", summaryPath, l.K6Script)
+	case "vegeta":
+		rate := l.Rate
+		if rate <= 0 {
+			rate = defaultVegetaRate
+		}
+		return formatCommand("vegeta", "attack", "-targets", l.VegetaTargets, "-rate", strconv.Itoa(rate), "-duration", duration+"s") +
+			" | " + formatCommand("vegeta", "report", "-type", "json", "-output", summaryPath)
+	default:
+		return strings.NewReplacer("{seconds}", duration, "{ref}", ref, "{side}", side).Replace(l.Command)
+	}
+}
+
+// loadSeconds covers the CPU profile plus the lead-in
+func loadSeconds(profileSeconds int) int {
+	return profileSeconds + int(loadLead/time.Second)
+}
+
+// loadRun is load running in the background during a capture
+type loadRun struct {
+	summary LoadSummary
+	path    string
+	cmd     *exec.Cmd
+	output  *tailBuffer
+	done    chan error
+}
+
+// startLoad starts the configured load for one side and waits out the
+// lead-in. It returns nil when no load is configured.
+func startLoad(ctx context.Context, load LoadParams, profileSeconds int, ref, side, outDir string) (*loadRun, error) {
+	if !load.enabled() {
+		return nil, nil
+	}
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	seconds := loadSeconds(profileSeconds)
+	run := &loadRun{
+		path:   filepath.Join(outDir, "load_summary.json"),
+		output: &tailBuffer{limit: loadOutputLimit},
+		done:   make(chan error, 1),
+	}
+	run.summary = LoadSummary{Tool: load.tool(), Seconds: seconds, Command: load.shellCommand(seconds, ref, side, run.path)}
+
+	run.cmd = cmdrun.ShellCmd(ctx, run.summary.Command)
+	run.cmd.Env = append(os.Environ(),
+		"PPROF_MCP_LOAD_SECONDS="+strconv.Itoa(seconds),
+		"PPROF_MCP_LOAD_REF="+ref,
+		"PPROF_MCP_LOAD_SIDE="+side,
+	)
+	run.cmd.Stdout = run.output
+	run.cmd.Stderr = run.output
+	// Interrupt rather than kill so k6 and vegeta still write a summary.
+	loadProcessGroup(run.cmd)
+	run.cmd.Cancel = func() error { return interruptLoad(run.cmd) }
+	run.cmd.WaitDelay = 10 * time.Second
+	if err := run.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start load (%s): %w", run.summary.Command, err)
+	}
+	go func() { run.done <- run.cmd.Wait() }()
+
+	select {
+	case err := <-run.done:
+		run.done <- err
+		if output := strings.TrimSpace(run.output.String()); output != "" {
+			return nil, fmt.Errorf("load exited before profiling started: %v: %s", err, output)
+		}
+		return nil, fmt.Errorf("load exited before profiling started: %v", err)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(loadLead):
+	}
+	return run, nil
+}
+
+// stop waits for the load to finish its duration, interrupting it if it
+// runs past the capture, and returns its summary
+func (r *loadRun) stop() *LoadSummary {
+	if r == nil {
+		return nil
+	}
+	var err error
+	select {
+	case err = <-r.done:
+	case <-time.After(loadLead):
+		interruptLoad(r.cmd)
+		err = <-r.done
+	}
+	r.summary.Output = strings.TrimSpace(r.output.String())
+	var errs []string
+	if err != nil && !interrupted(r.cmd.ProcessState) {
+		errs = append(errs, err.Error())
+	}
+	var readErr error
+	switch r.summary.Tool {
+	case "k6":
+		readErr = r.summary.readK6(r.path)
+	case "vegeta":
+		readErr = r.summary.readVegeta(r.path)
+	}
+	if readErr != nil {
+		errs = append(errs, readErr.Error())
+	}
+	r.summary.Error = strings.Join(errs, "; ")
+	return &r.summary
+}
+
+// readK6 reads a k6 --summary-export file
+func (s *LoadSummary) readK6(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("k6 summary: %w", err)
+	}
+	var summary struct {
+		Metrics map[string]map[string]float64 `json:"metrics"`
+	}
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return fmt.Errorf("failed to parse k6 summary: %w", err)
+	}
+	reqs, duration := summary.Metrics["http_reqs"], summary.Metrics["http_req_duration"]
+	s.Requests = reqs["count"]
+	s.Rate = reqs["rate"]
+	if failed, ok := summary.Metrics["http_req_failed"]; ok {
+		s.Success = 1 - failed["value"]
+	}
+	s.MeanMS = duration["avg"]
+	s.P50MS = duration["med"]
+	s.P95MS = duration["p(95)"]
+	s.P99MS = duration["p(99)"]
+	return nil
+}
+
+// readVegeta reads a vegeta report -type json file
+func (s *LoadSummary) readVegeta(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("vegeta report: %w", err)
+	}
+	var report struct {
+		Requests  float64            `json:"requests"`
+		Rate      float64            `json:"rate"`
+		Success   float64            `json:"success"`
+		Latencies map[string]float64 `json:"latencies"` // nanoseconds
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return fmt.Errorf("failed to parse vegeta report: %w", err)
+	}
+	s.Requests = report.Requests
+	s.Rate = report.Rate
+	s.Success = report.Success
+	s.MeanMS = report.Latencies["mean"] / 1e6
+	s.P50MS = report.Latencies["50th"] / 1e6
+	s.P95MS = report.Latencies["95th"] / 1e6
+	s.P99MS = report.Latencies["99th"] / 1e6
+	return nil
+}
+
+// loadDrift warns when the two refs saw noticeably different traffic, which
+// makes their profiles hard to compare
+func loadDrift(before, after *LoadSummary) string {
+	if before == nil || after == nil || before.Requests == 0 || after.Requests == 0 {
+		return ""
+	}
+	drift := (after.Requests - before.Requests) / before.Requests
+	if math.Abs(drift) <= loadDriftWarning {
+		return ""
+	}
+	return fmt.Sprintf("load differed between refs: %.0f requests before, %.0f after (%+.0f%%); normalize profiles by request count before comparing", before.Requests, after.Requests, drift*100)
+}
+
+// tailBuffer keeps the last limit bytes written to it
+type tailBuffer struct {
+	mu    sync.Mutex
+	limit int
+	buf   bytes.Buffer
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf.Write(p)
+	if over := t.buf.Len() - t.limit; over > 0 {
+		t.buf.Next(over)
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.buf.String()
+}
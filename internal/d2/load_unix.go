@@ -0,0 +1,29 @@
+//go:build !windows
+
+package d2
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// loadProcessGroup puts the load command in its own process group so an
+// interrupt reaches every process in a pipeline, not just the shell.
+func loadProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func interruptLoad(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGINT)
+}
+
+// interrupted reports whether the load exited because interruptLoad stopped
+// it, which is expected rather than a failure
+func interrupted(state *os.ProcessState) bool {
+	if state == nil {
+		return false
+	}
+	status, ok := state.Sys().(syscall.WaitStatus)
+	return ok && (status.Signaled() && status.Signal() == syscall.SIGINT || status.ExitStatus() == 130)
+}
@@ -0,0 +1,18 @@
+package d2
+
+import (
+	"os"
+	"os/exec"
+)
+
+func loadProcessGroup(cmd *exec.Cmd) {}
+
+// interruptLoad kills the load; Windows cannot deliver an interrupt to
+// another process, so k6 and vegeta summaries may be missing.
+func interruptLoad(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+func interrupted(state *os.ProcessState) bool {
+	return false
+}
@@ -0,0 +1,205 @@
+package d2
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Plan statuses. A pending plan past its ExpiresAt reads as expired.
+const (
+	PlanPending   = "pending"
+	PlanRunning   = "running"
+	PlanSucceeded = "succeeded"
+	PlanFailed    = "failed"
+	PlanAborted   = "aborted"
+	PlanExpired   = "expired"
+)
+
+const (
+	// PlanTTL is how long a plan can wait to be executed
+	PlanTTL = 24 * time.Hour
+	// PlanRetention is how long plan records, executed or not, stay on disk
+	PlanRetention = 30 * 24 * time.Hour
+)
+
+var planWorkspace atomic.Value // string
+
+// SetPlanWorkspace sets the workspace plans are persisted under when
+// PPROF_MCP_PLAN_DIR is unset
+func SetPlanWorkspace(dir string) {
+	planWorkspace.Store(strings.TrimSpace(dir))
+}
+
+// PlanDir returns where plans are persisted: PPROF_MCP_PLAN_DIR, else
+// branch-impact-plans under the workspace, else pprof-mcp/branch-impact-plans
+// under the user cache directory. PPROF_MCP_PLAN_DIR=off keeps plans in
+// memory only, so they are lost on restart.
+func PlanDir() string {
+	if dir := strings.TrimSpace(os.Getenv("PPROF_MCP_PLAN_DIR")); dir != "" {
+		if dir == "off" {
+			return ""
+		}
+		return dir
+	}
+	if workspace, _ := planWorkspace.Load().(string); workspace != "" {
+		return filepath.Join(workspace, "branch-impact-plans")
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "pprof-mcp", "branch-impact-plans")
+}
+
+// savePlan records plan in memory and, when persistence is on, writes it to
+// <PlanDir>/<id>.json
+func savePlan(plan *ExecutionPlan) error {
+	planStoreMu.Lock()
+	planStore[plan.ID] = plan
+	planStoreMu.Unlock()
+
+	dir := PlanDir()
+	if dir == "" {
+		return nil
+	}
+	if err := writeRecord(dir, plan.ID, plan); err != nil {
+		return fmt.Errorf("failed to persist plan: %w", err)
+	}
+	return nil
+}
+
+// writeRecord writes v as <dir>/<id>.json, replacing the file atomically so
+// a reader never sees a partial record
+func writeRecord(dir, id string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, id+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// loadPlan finds a plan by ID or unique ID prefix, in memory first and then
+// on disk
+func loadPlan(id string) (*ExecutionPlan, error) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return nil, errors.New("plan_id is required")
+	}
+	planStoreMu.RLock()
+	plan, ok := planStore[id]
+	planStoreMu.RUnlock()
+	if ok {
+		return plan, nil
+	}
+	if dir := PlanDir(); dir != "" && !strings.ContainsAny(id, `/\`) {
+		plan, err := readPlan(filepath.Join(dir, id+".json"))
+		if err == nil {
+			return plan, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	plans, err := ListPlans()
+	if err != nil {
+		return nil, err
+	}
+	var matches []*ExecutionPlan
+	for i := range plans {
+		if strings.HasPrefix(plans[i].ID, id) {
+			matches = append(matches, &plans[i])
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("plan %s not found", id)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("plan prefix %q matches %d plans", id, len(matches))
+	}
+}
+
+func readPlan(path string) (*ExecutionPlan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var plan ExecutionPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("failed to parse plan %s: %w", path, err)
+	}
+	if plan.ID == "" {
+		return nil, fmt.Errorf("plan %s has no id", path)
+	}
+	return &plan, nil
+}
+
+// ListPlans returns stored plans and their runs, newest first. Records older
+// than PlanRetention are deleted along the way; files that do not parse are
+// skipped.
+func ListPlans() ([]ExecutionPlan, error) {
+	byID := map[string]ExecutionPlan{}
+	if dir := PlanDir(); dir != "" {
+		entries, err := os.ReadDir(dir)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			plan, err := readPlan(path)
+			if err != nil {
+				continue
+			}
+			if time.Since(plan.CreatedAt) > PlanRetention && plan.Status != PlanRunning {
+				os.Remove(path)
+				continue
+			}
+			byID[plan.ID] = *plan
+		}
+	}
+	planStoreMu.RLock()
+	for id, plan := range planStore {
+		byID[id] = *plan
+	}
+	planStoreMu.RUnlock()
+
+	plans := make([]ExecutionPlan, 0, len(byID))
+	for _, plan := range byID {
+		plans = append(plans, plan)
+	}
+	sort.Slice(plans, func(i, j int) bool { return plans[i].CreatedAt.After(plans[j].CreatedAt) })
+	return plans, nil
+}
+
+// CurrentStatus is the plan's status, reporting a pending plan past its
+// expiry as expired
+func (p ExecutionPlan) CurrentStatus() string {
+	if p.Status == "" || p.Status == PlanPending {
+		if !p.ExpiresAt.IsZero() && time.Now().After(p.ExpiresAt) {
+			return PlanExpired
+		}
+		return PlanPending
+	}
+	return p.Status
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package d2
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// processAlive reports whether pid is a running process
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,279 @@
+package d2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+	"github.com/arreyder/pprof-mcp/internal/k8s"
+)
+
+// Annotation and label Kubernetes uses to tie a Deployment revision to its
+// ReplicaSet
+const (
+	deploymentRevisionAnnotation = "deployment.kubernetes.io/revision"
+	podTemplateHashLabel         = "pod-template-hash"
+)
+
+// rolloutEnv watches a Deployment in a real cluster, where CI, the
+// deploy_command, or a GitOps controller ships each ref rather than a dev
+// loop. The new code is live once a new ReplicaSet (pod-template-hash) has
+// fully rolled out and, with gitops_app, the Argo CD Application or Flux
+// Kustomization has synced and is healthy. Profiles are captured over plain
+// HTTP from a pod of the current ReplicaSet, never from one still draining.
+type rolloutEnv struct{}
+
+func (rolloutEnv) name() string { return "Kubernetes rollout" }
+
+func (rolloutEnv) methods() (recreate, restart string) { return "rollout", "rollout" }
+
+func (rolloutEnv) state(ctx context.Context, service string, params BranchImpactParams) (devState, error) {
+	rollout, err := deploymentRollout(ctx, params.KubeContext, params.Namespace, service)
+	if err != nil {
+		return devState{}, err
+	}
+	state := devState{Instance: rollout.hash, StartedAt: rollout.created, Pending: !rollout.complete}
+	if params.GitOpsApp != "" {
+		app, err := gitOpsStatus(ctx, params.KubeContext, params.GitOpsApp)
+		if err != nil {
+			return devState{}, err
+		}
+		state.Instance += "@" + app.revision
+		state.Pending = state.Pending || !app.ready
+	}
+	return state, nil
+}
+
+func (rolloutEnv) download(ctx context.Context, params DownloadParams) (DownloadResult, error) {
+	rollout, err := deploymentRollout(ctx, params.KubeContext, params.Namespace, params.Service)
+	if err != nil {
+		return DownloadResult{Service: params.Service, Namespace: params.Namespace}, err
+	}
+	params.Target = rollout.selector
+	return DownloadProfiles(ctx, params)
+}
+
+func (rolloutEnv) downloadCommands(params DownloadParams) (DryRunResult, error) {
+	params.Target = "<selector>," + podTemplateHashLabel + "=<hash>"
+	result, err := DownloadCommands(params)
+	if err != nil {
+		return result, err
+	}
+	result.Commands = append(rolloutCommands(params.KubeContext, params.Namespace, params.Service), result.Commands...)
+	result.Notes = append(result.Notes, fmt.Sprintf("The pod is picked from the current ReplicaSet of deployment/%s: its matchLabels selector plus the %s of the ReplicaSet at the Deployment's revision.", deploymentName(params.Service), podTemplateHashLabel))
+	return result, nil
+}
+
+func (rolloutEnv) pollCommands(service string, params BranchImpactParams) []string {
+	commands := rolloutCommands(params.KubeContext, params.Namespace, service)
+	if resource, namespace, name, err := parseGitOpsApp(params.GitOpsApp); err == nil && params.GitOpsApp != "" {
+		commands = append(commands, formatCommand("kubectl", append(k8s.ContextArgs(params.KubeContext), "get", resource, name, "-n", namespace, "-o", "json")...))
+	}
+	return commands
+}
+
+// rolloutCommands reads a Deployment and its ReplicaSets
+func rolloutCommands(kubeContext, namespace, service string) []string {
+	namespace = firstNonEmpty(namespace, "default")
+	return []string{
+		formatCommand("kubectl", append(k8s.ContextArgs(kubeContext), "get", "deployment/"+deploymentName(service), "-n", namespace, "-o", "json")...),
+		formatCommand("kubectl", append(k8s.ContextArgs(kubeContext), "get", "replicasets", "-n", namespace, "-l", "<selector>", "-o", "json")...),
+	}
+}
+
+// deploymentName accepts a service given as deployment/<name>
+func deploymentName(service string) string {
+	return strings.TrimPrefix(service, "deployment/")
+}
+
+// rolloutInfo is where a Deployment's rollout stands
+type rolloutInfo struct {
+	hash     string    // pod-template-hash of the ReplicaSet at the current revision
+	created  time.Time // when that ReplicaSet was created
+	complete bool      // every replica is updated and available
+	selector string    // picks the pods of that ReplicaSet
+}
+
+// deploymentRollout reads the Deployment named after service and the
+// ReplicaSet at its current revision. The rollout is complete by the rules
+// of kubectl rollout status: the controller saw the latest spec and every
+// replica is updated and available, with no old ones left.
+func deploymentRollout(ctx context.Context, kubeContext, namespace, service string) (*rolloutInfo, error) {
+	namespace = firstNonEmpty(namespace, "default")
+	name := deploymentName(service)
+	var deployment struct {
+		Metadata struct {
+			Generation  int64             `json:"generation"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+		Spec struct {
+			Replicas *int32 `json:"replicas"`
+			Selector struct {
+				MatchLabels map[string]string `json:"matchLabels"`
+			} `json:"selector"`
+		} `json:"spec"`
+		Status struct {
+			ObservedGeneration int64 `json:"observedGeneration"`
+			Replicas           int32 `json:"replicas"`
+			UpdatedReplicas    int32 `json:"updatedReplicas"`
+			AvailableReplicas  int32 `json:"availableReplicas"`
+		} `json:"status"`
+	}
+	if err := kubectlJSON(ctx, &deployment, append(k8s.ContextArgs(kubeContext), "get", "deployment/"+name, "-n", namespace, "-o", "json")...); err != nil {
+		return nil, err
+	}
+	selector := labelSelector(deployment.Spec.Selector.MatchLabels)
+	if selector == "" {
+		return nil, fmt.Errorf("deployment/%s has no matchLabels selector", name)
+	}
+	revision := deployment.Metadata.Annotations[deploymentRevisionAnnotation]
+
+	var replicaSets struct {
+		Items []struct {
+			Metadata struct {
+				Labels            map[string]string `json:"labels"`
+				Annotations       map[string]string `json:"annotations"`
+				CreationTimestamp time.Time         `json:"creationTimestamp"`
+				OwnerReferences   []struct {
+					Kind string `json:"kind"`
+					Name string `json:"name"`
+				} `json:"ownerReferences"`
+			} `json:"metadata"`
+		} `json:"items"`
+	}
+	if err := kubectlJSON(ctx, &replicaSets, append(k8s.ContextArgs(kubeContext), "get", "replicasets", "-n", namespace, "-l", selector, "-o", "json")...); err != nil {
+		return nil, err
+	}
+	for _, rs := range replicaSets.Items {
+		owned := false
+		for _, owner := range rs.Metadata.OwnerReferences {
+			owned = owned || owner.Kind == "Deployment" && owner.Name == name
+		}
+		hash := rs.Metadata.Labels[podTemplateHashLabel]
+		if !owned || hash == "" || rs.Metadata.Annotations[deploymentRevisionAnnotation] != revision {
+			continue
+		}
+		replicas := int32(1)
+		if deployment.Spec.Replicas != nil {
+			replicas = *deployment.Spec.Replicas
+		}
+		status := deployment.Status
+		return &rolloutInfo{
+			hash:     hash,
+			created:  rs.Metadata.CreationTimestamp,
+			complete: status.ObservedGeneration >= deployment.Metadata.Generation && status.UpdatedReplicas == replicas && status.Replicas == replicas && status.AvailableReplicas == replicas,
+			selector: selector + "," + podTemplateHashLabel + "=" + hash,
+		}, nil
+	}
+	return nil, fmt.Errorf("no ReplicaSet of deployment/%s at revision %s yet", name, revision)
+}
+
+// gitOpsApp is the sync state of an Argo CD Application or Flux Kustomization
+type gitOpsApp struct {
+	revision string // git revision last applied
+	ready    bool   // synced to that revision and healthy, with no sync running
+}
+
+// parseGitOpsApp splits argocd/[namespace/]name or flux/[namespace/]name
+// into its kubectl resource, namespace (default argocd or flux-system), and
+// name
+func parseGitOpsApp(app string) (resource, namespace, name string, err error) {
+	kind, rest, _ := strings.Cut(strings.TrimSpace(app), "/")
+	switch strings.ToLower(kind) {
+	case "argocd", "argo":
+		resource, namespace = "applications.argoproj.io", "argocd"
+	case "flux":
+		resource, namespace = "kustomizations.kustomize.toolkit.fluxcd.io", "flux-system"
+	default:
+		return "", "", "", fmt.Errorf("unsupported gitops_app %q (want argocd/<app> or flux/<kustomization>, optionally with a namespace: argocd/<namespace>/<app>)", app)
+	}
+	name = rest
+	if ns, n, ok := strings.Cut(rest, "/"); ok {
+		namespace, name = ns, n
+	}
+	if name == "" {
+		return "", "", "", fmt.Errorf("gitops_app %q has no name", app)
+	}
+	return resource, namespace, name, nil
+}
+
+// gitOpsStatus reads an Argo CD Application (sync and health status, and
+// no sync operation running) or a Flux Kustomization (Ready, with the last
+// attempted revision applied)
+func gitOpsStatus(ctx context.Context, kubeContext, app string) (gitOpsApp, error) {
+	resource, namespace, name, err := parseGitOpsApp(app)
+	if err != nil {
+		return gitOpsApp{}, err
+	}
+	var object struct {
+		Status struct {
+			// Argo CD
+			Sync struct {
+				Status   string `json:"status"`
+				Revision string `json:"revision"`
+			} `json:"sync"`
+			Health struct {
+				Status string `json:"status"`
+			} `json:"health"`
+			OperationState struct {
+				Phase string `json:"phase"`
+			} `json:"operationState"`
+			// Flux
+			LastAppliedRevision   string `json:"lastAppliedRevision"`
+			LastAttemptedRevision string `json:"lastAttemptedRevision"`
+			Conditions            []struct {
+				Type   string `json:"type"`
+				Status string `json:"status"`
+			} `json:"conditions"`
+		} `json:"status"`
+	}
+	if err := kubectlJSON(ctx, &object, append(k8s.ContextArgs(kubeContext), "get", resource, name, "-n", namespace, "-o", "json")...); err != nil {
+		return gitOpsApp{}, err
+	}
+	status := object.Status
+	if strings.HasPrefix(resource, "applications.") {
+		return gitOpsApp{
+			revision: status.Sync.Revision,
+			ready:    status.Sync.Status == "Synced" && status.Health.Status == "Healthy" && status.OperationState.Phase != "Running",
+		}, nil
+	}
+	ready := false
+	for _, condition := range status.Conditions {
+		if condition.Type == "Ready" {
+			ready = condition.Status == "True"
+		}
+	}
+	return gitOpsApp{
+		revision: status.LastAppliedRevision,
+		ready:    ready && status.LastAttemptedRevision == status.LastAppliedRevision,
+	}, nil
+}
+
+func kubectlJSON(ctx context.Context, v any, args ...string) error {
+	output, err := cmdrun.Output(ctx, cmdrun.Kubectl, "kubectl", args...)
+	if err != nil {
+		verb := args[0]
+		if verb == "--context" && len(args) > 2 {
+			verb = args[2]
+		}
+		return fmt.Errorf("kubectl %s failed: %w", verb, commandError(err))
+	}
+	if err := json.Unmarshal(output, v); err != nil {
+		return fmt.Errorf("failed to parse kubectl output: %w", err)
+	}
+	return nil
+}
+
+// labelSelector renders matchLabels as a selector, in a stable order
+func labelSelector(labels map[string]string) string {
+	terms := make([]string, 0, len(labels))
+	for key, value := range labels {
+		terms = append(terms, key+"="+value)
+	}
+	sort.Strings(terms)
+	return strings.Join(terms, ",")
+}
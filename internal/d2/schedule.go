@@ -0,0 +1,717 @@
+package d2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// Schedule statuses. A running schedule whose process has exited reads as
+// interrupted.
+const (
+	ScheduleRunning     = "running"
+	ScheduleFinished    = "finished"
+	ScheduleStopped     = "stopped"
+	ScheduleFailed      = "failed"
+	ScheduleInterrupted = "interrupted"
+)
+
+const (
+	defaultScheduleInterval = 5 * time.Minute
+	minScheduleInterval     = 30 * time.Second
+	// defaultScheduleDuration bounds a schedule given neither a count nor a
+	// duration, so a forgotten one does not capture forever
+	defaultScheduleDuration = 24 * time.Hour
+	maxScheduleDuration     = 7 * 24 * time.Hour
+	maxScheduleServices     = 20
+	// scheduleFailureLimit stops a schedule after this many rounds in a row
+	// in which every capture failed
+	scheduleFailureLimit = 5
+	// trendMinCaptures is how many captures a service needs before its
+	// metrics are judged for growth
+	trendMinCaptures = 4
+	// trendRisingRatio and trendGrowthPct are the share of intervals that
+	// must grow, and the overall growth, for a metric to read as leaking
+	trendRisingRatio = 0.7
+	trendGrowthPct   = 10
+)
+
+// ScheduleParams configures periodic captures from local services, for
+// watching a long-running soak test without Datadog
+type ScheduleParams struct {
+	Services    []string      `json:"services"`
+	Namespace   string        `json:"namespace,omitempty"`
+	KubeContext string        `json:"kube_context,omitempty"`
+	DevEnv      string        `json:"dev_env,omitempty"`    // tilt, compose, skaffold, or rollout
+	PprofPort   int           `json:"pprof_port,omitempty"` // container pprof port for compose
+	Interval    time.Duration `json:"interval"`
+	Seconds     int           `json:"seconds"`            // CPU profile duration per capture
+	Count       int           `json:"count,omitempty"`    // rounds to capture (0 = until Duration)
+	Duration    time.Duration `json:"duration,omitempty"` // stop after this long (0 = until Count)
+	OutDir      string        `json:"out_dir"`
+}
+
+// Schedule is a periodic capture and every capture it has made so far
+type Schedule struct {
+	ID         string            `json:"id"`
+	Params     ScheduleParams    `json:"params"`
+	Status     string            `json:"status"`
+	PID        int               `json:"pid,omitempty"` // process running the schedule
+	StartedAt  time.Time         `json:"started_at"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty"`
+	NextAt     *time.Time        `json:"next_at,omitempty"`
+	Rounds     int               `json:"rounds"`
+	Captures   []ScheduleCapture `json:"captures"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// ScheduleCapture is one service's profiles from one round, with the
+// totals trends are computed from
+type ScheduleCapture struct {
+	Service    string        `json:"service"`
+	Round      int           `json:"round"`
+	At         time.Time     `json:"at"`
+	Dir        string        `json:"dir"`
+	Files      []ProfileFile `json:"files,omitempty"`
+	HeapInuse  float64       `json:"heap_inuse_bytes,omitempty"`
+	Goroutines float64       `json:"goroutines,omitempty"`
+	CPUSeconds float64       `json:"cpu_seconds,omitempty"`
+	Warnings   []string      `json:"warnings,omitempty"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// ScheduleTrend summarizes how a service's totals moved across a schedule
+type ScheduleTrend struct {
+	Service  string        `json:"service"`
+	Captures int           `json:"captures"` // successful captures
+	From     time.Time     `json:"from"`
+	To       time.Time     `json:"to"`
+	Metrics  []MetricTrend `json:"metrics"`
+	Growing  []string      `json:"growing,omitempty"` // metrics that look like a leak
+}
+
+// MetricTrend is one total (heap in use, goroutines, CPU seconds) across
+// the captures of a service
+type MetricTrend struct {
+	Metric    string  `json:"metric"`
+	First     float64 `json:"first"`
+	Last      float64 `json:"last"`
+	Min       float64 `json:"min"`
+	Max       float64 `json:"max"`
+	ChangePct float64 `json:"change_pct"`
+	PerHour   float64 `json:"per_hour"`     // least-squares slope
+	Rising    float64 `json:"rising_ratio"` // share of intervals that grew
+	Growing   bool    `json:"growing"`
+}
+
+// ScheduleDir returns where schedule records are kept: PPROF_MCP_SCHEDULE_DIR,
+// else schedules under the workspace, else pprof-mcp/schedules under the
+// user cache directory. Captures go to <ScheduleDir>/<id> unless the
+// schedule sets out_dir.
+func ScheduleDir() string {
+	if dir := strings.TrimSpace(os.Getenv("PPROF_MCP_SCHEDULE_DIR")); dir != "" {
+		return dir
+	}
+	if workspace, _ := planWorkspace.Load().(string); workspace != "" {
+		return filepath.Join(workspace, "schedules")
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "pprof-mcp", "schedules")
+	}
+	return filepath.Join(dir, "pprof-mcp", "schedules")
+}
+
+// withDefaults fills unset fields and checks the rest
+func (p ScheduleParams) withDefaults() (ScheduleParams, error) {
+	var services []string
+	for _, service := range p.Services {
+		if service = strings.TrimSpace(service); service != "" {
+			services = append(services, service)
+		}
+	}
+	p.Services = services
+	if len(p.Services) == 0 {
+		return p, errors.New("services is required")
+	}
+	if len(p.Services) > maxScheduleServices {
+		return p, fmt.Errorf("at most %d services can be scheduled at once", maxScheduleServices)
+	}
+	if p.Seconds <= 0 {
+		p.Seconds = 30
+	}
+	if p.Interval <= 0 {
+		p.Interval = defaultScheduleInterval
+	}
+	if p.Interval < minScheduleInterval {
+		return p, fmt.Errorf("interval must be at least %v", minScheduleInterval)
+	}
+	if p.Interval < time.Duration(p.Seconds)*time.Second+10*time.Second {
+		return p, fmt.Errorf("interval %v leaves no room for a %ds CPU profile; use at least %v", p.Interval, p.Seconds, time.Duration(p.Seconds+10)*time.Second)
+	}
+	if p.Count < 0 || p.Duration < 0 {
+		return p, errors.New("count and duration cannot be negative")
+	}
+	if p.Count == 0 && p.Duration == 0 {
+		p.Duration = defaultScheduleDuration
+	}
+	if p.Duration > maxScheduleDuration {
+		return p, fmt.Errorf("duration cannot exceed %v", maxScheduleDuration)
+	}
+	env, err := resolveDevEnv(p.DevEnv)
+	if err != nil {
+		return p, err
+	}
+	// Record the driver so the schedule reads the same after
+	// PPROF_MCP_DEV_ENV changes
+	switch env.(type) {
+	case composeEnv:
+		p.DevEnv = DevEnvCompose
+	case skaffoldEnv:
+		p.DevEnv = DevEnvSkaffold
+	case rolloutEnv:
+		p.DevEnv = DevEnvRollout
+	default:
+		p.DevEnv = DevEnvTilt
+	}
+	return p, nil
+}
+
+// rounds is the most rounds the schedule can capture before its count or
+// duration runs out
+func (p ScheduleParams) rounds() int {
+	byDuration := 0
+	if p.Duration > 0 {
+		byDuration = int(p.Duration/p.Interval) + 1
+	}
+	switch {
+	case p.Count > 0 && byDuration > 0:
+		return min(p.Count, byDuration)
+	case p.Count > 0:
+		return p.Count
+	default:
+		return byDuration
+	}
+}
+
+// scheduleRun is a schedule capturing in this process
+type scheduleRun struct {
+	mu       sync.Mutex
+	schedule Schedule
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+var (
+	activeSchedulesMu sync.Mutex
+	activeSchedules   = map[string]*scheduleRun{}
+)
+
+// StartSchedule starts capturing in the background and returns the new
+// schedule. It keeps running until its count or duration is reached or
+// StopSchedule is called.
+func StartSchedule(params ScheduleParams) (*Schedule, error) {
+	run, ctx, err := newScheduleRun(context.Background(), params)
+	if err != nil {
+		return nil, err
+	}
+	go run.loop(ctx, nil)
+	return run.snapshot(), nil
+}
+
+// RunSchedule captures in the foreground until the schedule finishes or ctx
+// is cancelled, which stops it. onCapture, when set, is called after each
+// capture.
+func RunSchedule(ctx context.Context, params ScheduleParams, onCapture func(ScheduleCapture)) (*Schedule, error) {
+	run, ctx, err := newScheduleRun(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	run.loop(ctx, onCapture)
+	schedule := run.snapshot()
+	if schedule.Status == ScheduleFailed {
+		return schedule, errors.New(schedule.Error)
+	}
+	return schedule, nil
+}
+
+// newScheduleRun persists a new schedule and registers it so StopSchedule
+// can cancel the returned context
+func newScheduleRun(ctx context.Context, params ScheduleParams) (*scheduleRun, context.Context, error) {
+	params, err := params.withDefaults()
+	if err != nil {
+		return nil, ctx, err
+	}
+	id := generatePlanID()
+	if params.OutDir == "" {
+		params.OutDir = filepath.Join(ScheduleDir(), id)
+	}
+	if err := os.MkdirAll(params.OutDir, 0o755); err != nil {
+		return nil, ctx, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	run := &scheduleRun{
+		schedule: Schedule{
+			ID:        id,
+			Params:    params,
+			Status:    ScheduleRunning,
+			PID:       os.Getpid(),
+			StartedAt: time.Now().UTC(),
+			Captures:  []ScheduleCapture{},
+		},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	if err := writeRecord(ScheduleDir(), id, run.schedule); err != nil {
+		cancel()
+		return nil, ctx, fmt.Errorf("failed to persist schedule: %w", err)
+	}
+	activeSchedulesMu.Lock()
+	activeSchedules[id] = run
+	activeSchedulesMu.Unlock()
+	return run, ctx, nil
+}
+
+// loop captures a round every interval until the schedule ends
+func (r *scheduleRun) loop(ctx context.Context, onCapture func(ScheduleCapture)) {
+	defer close(r.done)
+	defer r.cancel()
+	defer func() {
+		activeSchedulesMu.Lock()
+		delete(activeSchedules, r.schedule.ID)
+		activeSchedulesMu.Unlock()
+	}()
+	params := r.schedule.Params
+	env, _ := resolveDevEnv(params.DevEnv)
+	var deadline time.Time
+	if params.Duration > 0 {
+		deadline = r.schedule.StartedAt.Add(params.Duration)
+	}
+
+	failedRounds := 0
+	var lastErr string
+	for round := 1; ; round++ {
+		at := time.Now().UTC()
+		captures := captureRound(ctx, env, params, round, at)
+		if ctx.Err() != nil {
+			r.end(ScheduleStopped, "")
+			return
+		}
+		failed := 0
+		for _, capture := range captures {
+			if capture.Error != "" {
+				failed++
+				lastErr = fmt.Sprintf("%s: %s", capture.Service, capture.Error)
+			}
+			if onCapture != nil {
+				onCapture(capture)
+			}
+		}
+		if failed == len(captures) {
+			failedRounds++
+		} else {
+			failedRounds = 0
+		}
+
+		next := at.Add(params.Interval)
+		r.mu.Lock()
+		r.schedule.Rounds = round
+		r.schedule.Captures = append(r.schedule.Captures, captures...)
+		r.schedule.NextAt = &next
+		r.mu.Unlock()
+
+		switch {
+		case failedRounds >= scheduleFailureLimit:
+			r.end(ScheduleFailed, fmt.Sprintf("every capture failed for %d rounds in a row; last error: %s", failedRounds, lastErr))
+			return
+		case params.Count > 0 && round >= params.Count,
+			!deadline.IsZero() && next.After(deadline):
+			r.end(ScheduleFinished, "")
+			return
+		}
+		r.save()
+		if err := sleepContext(ctx, time.Until(next)); err != nil {
+			r.end(ScheduleStopped, "")
+			return
+		}
+	}
+}
+
+// captureRound captures every service at once into
+// <out_dir>/<service>/<timestamp>
+func captureRound(ctx context.Context, env devEnv, params ScheduleParams, round int, at time.Time) []ScheduleCapture {
+	captures := make([]ScheduleCapture, len(params.Services))
+	var wg sync.WaitGroup
+	for i, service := range params.Services {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			capture := ScheduleCapture{
+				Service: service,
+				Round:   round,
+				At:      at,
+				Dir:     filepath.Join(params.OutDir, service, at.Format("20060102T150405Z")),
+			}
+			result, err := env.download(ctx, DownloadParams{
+				Service:     service,
+				Namespace:   params.Namespace,
+				KubeContext: params.KubeContext,
+				OutDir:      capture.Dir,
+				Seconds:     params.Seconds,
+				Port:        params.PprofPort,
+			})
+			capture.Files = result.Files
+			capture.Warnings = result.Warnings
+			if err != nil {
+				capture.Error = err.Error()
+			} else {
+				capture.measure(result)
+			}
+			captures[i] = capture
+		}()
+	}
+	wg.Wait()
+	return captures
+}
+
+// measure records the totals trends are computed from. A profile that
+// cannot be read leaves its total unset with a warning.
+func (c *ScheduleCapture) measure(result DownloadResult) {
+	if seconds, err := cpuSeconds(result); err == nil {
+		c.CPUSeconds = seconds
+	} else {
+		c.Warnings = append(c.Warnings, fmt.Sprintf("cpu total: %v", err))
+	}
+	if bytes, err := sampleTotal(profilePath(result, "heap"), "inuse_space"); err == nil {
+		c.HeapInuse = bytes
+	} else {
+		c.Warnings = append(c.Warnings, fmt.Sprintf("heap total: %v", err))
+	}
+	if count, err := sampleTotal(profilePath(result, "goroutines"), "goroutine"); err == nil {
+		c.Goroutines = count
+	} else {
+		c.Warnings = append(c.Warnings, fmt.Sprintf("goroutine total: %v", err))
+	}
+}
+
+// sampleTotal sums one sample type over a profile
+func sampleTotal(path, sampleType string) (float64, error) {
+	if path == "" {
+		return 0, errors.New("profile missing")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	prof, err := profile.Parse(f)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	index := -1
+	for i, st := range prof.SampleType {
+		if st.Type == sampleType {
+			index = i
+		}
+	}
+	if index < 0 {
+		return 0, fmt.Errorf("%s has no %s samples", path, sampleType)
+	}
+	var total int64
+	for _, sample := range prof.Sample {
+		total += sample.Value[index]
+	}
+	return float64(total), nil
+}
+
+func (r *scheduleRun) snapshot() *Schedule {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	schedule := r.schedule
+	schedule.Captures = append([]ScheduleCapture(nil), r.schedule.Captures...)
+	return &schedule
+}
+
+// save persists the schedule; a failed write is retried on the next round
+func (r *scheduleRun) save() {
+	writeRecord(ScheduleDir(), r.schedule.ID, r.snapshot())
+}
+
+func (r *scheduleRun) end(status, message string) {
+	finishedAt := time.Now().UTC()
+	r.mu.Lock()
+	r.schedule.Status = status
+	r.schedule.Error = message
+	r.schedule.FinishedAt = &finishedAt
+	r.schedule.NextAt = nil
+	r.mu.Unlock()
+	r.save()
+}
+
+// StopSchedule stops a schedule running in this process and returns it as
+// stopped. A schedule left running by a process that has exited is marked
+// stopped; one running in another live process must be stopped there.
+func StopSchedule(ctx context.Context, id string) (*Schedule, error) {
+	schedule, err := GetSchedule(id)
+	if err != nil {
+		return nil, err
+	}
+	activeSchedulesMu.Lock()
+	run := activeSchedules[schedule.ID]
+	activeSchedulesMu.Unlock()
+	if run != nil {
+		run.cancel()
+		select {
+		case <-run.done:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("schedule did not stop before the deadline: %w", ctx.Err())
+		}
+		return run.snapshot(), nil
+	}
+
+	switch status := schedule.CurrentStatus(); status {
+	case ScheduleRunning:
+		return nil, fmt.Errorf("schedule %s is running in process %d; stop it from that process", schedule.ID, schedule.PID)
+	case ScheduleInterrupted:
+		finishedAt := time.Now().UTC()
+		schedule.Status = ScheduleStopped
+		schedule.FinishedAt = &finishedAt
+		schedule.NextAt = nil
+		schedule.Error = "stopped after the process running it exited"
+		if err := writeRecord(ScheduleDir(), schedule.ID, schedule); err != nil {
+			return nil, fmt.Errorf("failed to persist schedule: %w", err)
+		}
+		return schedule, nil
+	default:
+		return nil, fmt.Errorf("schedule %s is %s, not running", schedule.ID, status)
+	}
+}
+
+// GetSchedule finds a schedule by ID or unique ID prefix
+func GetSchedule(id string) (*Schedule, error) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return nil, errors.New("schedule_id is required")
+	}
+	schedules, err := ListSchedules()
+	if err != nil {
+		return nil, err
+	}
+	var matches []*Schedule
+	for i := range schedules {
+		if schedules[i].ID == id {
+			return &schedules[i], nil
+		}
+		if strings.HasPrefix(schedules[i].ID, id) {
+			matches = append(matches, &schedules[i])
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("schedule %s not found", id)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("schedule prefix %q matches %d schedules", id, len(matches))
+	}
+}
+
+// ListSchedules returns stored schedules, newest first. Schedules running in
+// this process reflect their latest captures; files that do not parse are
+// skipped.
+func ListSchedules() ([]Schedule, error) {
+	byID := map[string]Schedule{}
+	dir := ScheduleDir()
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		schedule, err := readSchedule(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		byID[schedule.ID] = *schedule
+	}
+	activeSchedulesMu.Lock()
+	for id, run := range activeSchedules {
+		byID[id] = *run.snapshot()
+	}
+	activeSchedulesMu.Unlock()
+
+	schedules := make([]Schedule, 0, len(byID))
+	for _, schedule := range byID {
+		schedules = append(schedules, schedule)
+	}
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].StartedAt.After(schedules[j].StartedAt) })
+	return schedules, nil
+}
+
+func readSchedule(path string) (*Schedule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var schedule Schedule
+	if err := json.Unmarshal(data, &schedule); err != nil {
+		return nil, fmt.Errorf("failed to parse schedule %s: %w", path, err)
+	}
+	if schedule.ID == "" {
+		return nil, fmt.Errorf("schedule %s has no id", path)
+	}
+	return &schedule, nil
+}
+
+// CurrentStatus is the schedule's status, reporting one still marked running
+// by a process that has exited as interrupted
+func (s Schedule) CurrentStatus() string {
+	if s.Status != ScheduleRunning {
+		return s.Status
+	}
+	activeSchedulesMu.Lock()
+	_, active := activeSchedules[s.ID]
+	activeSchedulesMu.Unlock()
+	if active || (s.PID != 0 && s.PID != os.Getpid() && processAlive(s.PID)) {
+		return ScheduleRunning
+	}
+	return ScheduleInterrupted
+}
+
+// Trends summarizes each service's heap in use, goroutines, and CPU across
+// its successful captures. A heap or goroutine total that grows in most
+// intervals and overall is flagged as growing, the usual shape of a leak.
+func (s Schedule) Trends() []ScheduleTrend {
+	byService := map[string][]ScheduleCapture{}
+	for _, capture := range s.Captures {
+		if capture.Error == "" {
+			byService[capture.Service] = append(byService[capture.Service], capture)
+		}
+	}
+	trends := []ScheduleTrend{}
+	for _, service := range s.Params.Services {
+		captures := byService[service]
+		if len(captures) == 0 {
+			continue
+		}
+		sort.Slice(captures, func(i, j int) bool { return captures[i].At.Before(captures[j].At) })
+		trend := ScheduleTrend{
+			Service:  service,
+			Captures: len(captures),
+			From:     captures[0].At,
+			To:       captures[len(captures)-1].At,
+		}
+		for _, metric := range []struct {
+			name  string
+			leaks bool
+			value func(ScheduleCapture) float64
+		}{
+			{"heap_inuse_bytes", true, func(c ScheduleCapture) float64 { return c.HeapInuse }},
+			{"goroutines", true, func(c ScheduleCapture) float64 { return c.Goroutines }},
+			{"cpu_seconds", false, func(c ScheduleCapture) float64 { return c.CPUSeconds }},
+		} {
+			m := metricTrend(metric.name, captures, metric.value)
+			m.Growing = metric.leaks && len(captures) >= trendMinCaptures &&
+				m.Rising >= trendRisingRatio && m.ChangePct >= trendGrowthPct && m.PerHour > 0
+			if m.Growing {
+				trend.Growing = append(trend.Growing, m.Metric)
+			}
+			trend.Metrics = append(trend.Metrics, m)
+		}
+		trends = append(trends, trend)
+	}
+	return trends
+}
+
+func metricTrend(name string, captures []ScheduleCapture, value func(ScheduleCapture) float64) MetricTrend {
+	values := make([]float64, len(captures))
+	hours := make([]float64, len(captures))
+	for i, capture := range captures {
+		values[i] = value(capture)
+		hours[i] = capture.At.Sub(captures[0].At).Hours()
+	}
+	m := MetricTrend{Metric: name, First: values[0], Last: values[len(values)-1], Min: values[0], Max: values[0]}
+	rising := 0
+	for i, v := range values {
+		m.Min, m.Max = min(m.Min, v), max(m.Max, v)
+		if i > 0 && v > values[i-1] {
+			rising++
+		}
+	}
+	if len(values) > 1 {
+		m.Rising = float64(rising) / float64(len(values)-1)
+	}
+	m.ChangePct = percentChange(m.First, m.Last)
+	m.PerHour = slope(hours, values)
+	return m
+}
+
+// slope is the least-squares slope of y over x
+func slope(x, y []float64) float64 {
+	xMean, _ := meanVariance(x)
+	yMean, _ := meanVariance(y)
+	var num, den float64
+	for i := range x {
+		num += (x[i] - xMean) * (y[i] - yMean)
+		den += (x[i] - xMean) * (x[i] - xMean)
+	}
+	if den == 0 {
+		return 0
+	}
+	return num / den
+}
+
+// ScheduleCommands returns the commands one round of a schedule would run,
+// without contacting the dev environment
+func ScheduleCommands(params ScheduleParams) (DryRunResult, error) {
+	params, err := params.withDefaults()
+	if err != nil {
+		return DryRunResult{}, err
+	}
+	env, _ := resolveDevEnv(params.DevEnv)
+	if params.OutDir == "" {
+		params.OutDir = filepath.Join(ScheduleDir(), "<id>")
+	}
+	result := DryRunResult{Service: strings.Join(params.Services, ",")}
+	for _, service := range params.Services {
+		plan, err := env.downloadCommands(DownloadParams{
+			Service:     service,
+			Namespace:   params.Namespace,
+			KubeContext: params.KubeContext,
+			OutDir:      filepath.Join(params.OutDir, service, timestampPlaceholder),
+			Seconds:     params.Seconds,
+			Port:        params.PprofPort,
+		})
+		if err != nil {
+			return DryRunResult{}, err
+		}
+		if result.Command == "" {
+			result.Command = plan.Command
+		}
+		result.Commands = append(result.Commands, plan.Commands...)
+		for _, note := range plan.Notes {
+			if !slices.Contains(result.Notes, note) {
+				result.Notes = append(result.Notes, note)
+			}
+		}
+	}
+	every := fmt.Sprintf("These commands repeat every %v", params.Interval)
+	if rounds := params.rounds(); rounds > 0 {
+		every += fmt.Sprintf(", %d times", rounds)
+	}
+	result.Notes = append([]string{every + fmt.Sprintf(" (%s), with services captured in parallel.", env.name())}, result.Notes...)
+	return result, nil
+}
@@ -0,0 +1,133 @@
+package d2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+	"github.com/arreyder/pprof-mcp/internal/k8s"
+)
+
+// skaffoldManagedSelector matches the pods skaffold dev deploys
+const skaffoldManagedSelector = "app.kubernetes.io/managed-by=skaffold"
+
+// skaffoldEnv watches pods deployed by `skaffold dev`, which rebuilds and
+// redeploys on file changes. Skaffold has no state API worth polling, so the
+// pods are read with kubectl; profiles are captured from the pod over plain
+// HTTP, like a k8s target.
+type skaffoldEnv struct{}
+
+func (skaffoldEnv) name() string { return "Skaffold" }
+
+func (skaffoldEnv) methods() (recreate, restart string) { return "pod_recreate", "pod_restart" }
+
+func (skaffoldEnv) state(ctx context.Context, service string, params BranchImpactParams) (devState, error) {
+	pod, err := skaffoldPod(ctx, params.KubeContext, params.Namespace, service)
+	if err != nil {
+		return devState{}, err
+	}
+	return devState{Instance: pod.name, StartedAt: pod.startedAt}, nil
+}
+
+func (skaffoldEnv) download(ctx context.Context, params DownloadParams) (DownloadResult, error) {
+	pod, err := skaffoldPod(ctx, params.KubeContext, params.Namespace, params.Service)
+	if err != nil {
+		return DownloadResult{Service: params.Service, Namespace: params.Namespace}, err
+	}
+	params.Target = pod.selector
+	return DownloadProfiles(ctx, params)
+}
+
+func (skaffoldEnv) downloadCommands(params DownloadParams) (DryRunResult, error) {
+	params.Target = "app=" + params.Service
+	result, err := DownloadCommands(params)
+	if err != nil {
+		return result, err
+	}
+	result.Notes = append(result.Notes, fmt.Sprintf("The selector comes from the app (or app.kubernetes.io/name) label of the %s pod matching %s.", skaffoldManagedSelector, params.Service))
+	return result, nil
+}
+
+func (skaffoldEnv) pollCommands(service string, params BranchImpactParams) []string {
+	namespace := firstNonEmpty(params.Namespace, "default")
+	return []string{
+		formatCommand("kubectl", append(k8s.ContextArgs(params.KubeContext), "get", "pods", "-n", namespace, "-l", skaffoldManagedSelector, "-o", "json")...),
+	}
+}
+
+// skaffoldPodInfo is the running skaffold pod of a service
+type skaffoldPodInfo struct {
+	name      string
+	startedAt time.Time
+	selector  string // label selector that picks the service's pods
+}
+
+// skaffoldPod finds the service's running pod among the pods skaffold
+// manages, by app label and then by substring of the label or pod name.
+// Terminating pods are ignored, so a rollout reads as a new pod.
+func skaffoldPod(ctx context.Context, kubeContext, namespace, service string) (*skaffoldPodInfo, error) {
+	namespace = firstNonEmpty(namespace, "default")
+	args := append(k8s.ContextArgs(kubeContext), "get", "pods", "-n", namespace, "-l", skaffoldManagedSelector, "-o", "json")
+	output, err := cmdrun.Output(ctx, cmdrun.Kubectl, "kubectl", args...)
+	if err != nil {
+		return nil, fmt.Errorf("kubectl get pods failed: %w", commandError(err))
+	}
+	var result struct {
+		Items []struct {
+			Metadata struct {
+				Name              string            `json:"name"`
+				Labels            map[string]string `json:"labels"`
+				DeletionTimestamp *time.Time        `json:"deletionTimestamp"`
+			} `json:"metadata"`
+			Status struct {
+				Phase             string `json:"phase"`
+				ContainerStatuses []struct {
+					State struct {
+						Running *struct {
+							StartedAt time.Time `json:"startedAt"`
+						} `json:"running"`
+					} `json:"state"`
+				} `json:"containerStatuses"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse kubectl output: %w", err)
+	}
+
+	serviceLower := strings.ToLower(service)
+	var fuzzy *skaffoldPodInfo
+	for _, item := range result.Items {
+		if item.Status.Phase != "Running" || item.Metadata.DeletionTimestamp != nil {
+			continue
+		}
+		labelKey, app := "app", item.Metadata.Labels["app"]
+		if app == "" {
+			labelKey, app = "app.kubernetes.io/name", item.Metadata.Labels["app.kubernetes.io/name"]
+		}
+		pod := &skaffoldPodInfo{name: item.Metadata.Name}
+		if app != "" {
+			pod.selector = labelKey + "=" + app
+		}
+		if statuses := item.Status.ContainerStatuses; len(statuses) > 0 && statuses[0].State.Running != nil {
+			pod.startedAt = statuses[0].State.Running.StartedAt
+		}
+		if app != "" && app == service {
+			return pod, nil
+		}
+		name := strings.ToLower(firstNonEmpty(app, item.Metadata.Name))
+		if fuzzy == nil && (strings.Contains(name, serviceLower) || strings.Contains(serviceLower, name)) {
+			fuzzy = pod
+		}
+	}
+	if fuzzy == nil {
+		return nil, fmt.Errorf("no running skaffold pod found matching %q in namespace %s", service, namespace)
+	}
+	if fuzzy.selector == "" {
+		return nil, fmt.Errorf("skaffold pod %s has no app or app.kubernetes.io/name label to select it by", fuzzy.name)
+	}
+	return fuzzy, nil
+}
@@ -0,0 +1,179 @@
+package d2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+)
+
+// tiltEnv watches Tilt, which rebuilds on file changes and live-updates or
+// restarts the service's pod. Profiles are pulled through the d2 debug
+// endpoint.
+type tiltEnv struct{}
+
+func (tiltEnv) name() string { return "Tilt" }
+
+func (tiltEnv) state(ctx context.Context, service string, params BranchImpactParams) (devState, error) {
+	state, err := getTiltState(ctx, service, params.Namespace)
+	if err != nil {
+		return devState{}, err
+	}
+	return devState{Instance: state.PodName, StartedAt: state.StartedAt, LastSynced: state.LastFileTimeSynced}, nil
+}
+
+func (tiltEnv) methods() (recreate, restart string) { return "pod_recreate", "pod_restart" }
+
+func (tiltEnv) download(ctx context.Context, params DownloadParams) (DownloadResult, error) {
+	return DownloadProfiles(ctx, params)
+}
+
+func (tiltEnv) downloadCommands(params DownloadParams) (DryRunResult, error) {
+	return DownloadCommands(params)
+}
+
+// pollCommands lists the Tilt queries waitForRebuild issues on each poll
+func (tiltEnv) pollCommands(service string, params BranchImpactParams) []string {
+	return []string{
+		formatCommand("tilt", "get", "kubernetesdiscovery", service, "-o", "json"),
+		formatCommand("tilt", "get", "liveupdate", "-o", "json"),
+	}
+}
+
+// TiltState captures the current state of a Tilt resource
+type TiltState struct {
+	PodName            string
+	StartedAt          time.Time
+	LastFileTimeSynced *time.Time
+	ContainerID        string
+}
+
+// findTiltResource finds the exact Tilt resource name for a service (with fuzzy matching)
+func findTiltResource(ctx context.Context, service string) (string, error) {
+	// Try exact match first
+	if err := cmdrun.Run(ctx, cmdrun.Tilt, "tilt", "get", "kubernetesdiscovery", service, "-o", "json"); err == nil {
+		return service, nil
+	}
+
+	// Fuzzy match - list all resources and find one containing the service name
+	output, err := cmdrun.Output(ctx, cmdrun.Tilt, "tilt", "get", "kubernetesdiscovery", "-o", "json")
+	if err != nil {
+		return "", fmt.Errorf("failed to list kubernetesdiscovery resources: %w", err)
+	}
+
+	var result struct {
+		Items []struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+		} `json:"items"`
+	}
+
+	if err := json.Unmarshal(output, &result); err != nil {
+		return "", fmt.Errorf("failed to parse kubernetesdiscovery list: %w", err)
+	}
+
+	serviceLower := strings.ToLower(service)
+	for _, item := range result.Items {
+		nameLower := strings.ToLower(item.Metadata.Name)
+		if strings.Contains(nameLower, serviceLower) || strings.Contains(serviceLower, nameLower) {
+			return item.Metadata.Name, nil
+		}
+	}
+
+	return "", fmt.Errorf("no tilt resource found matching %q", service)
+}
+
+// getTiltState queries Tilt API for current service state. Tilt has no kube
+// context of its own to select, but its discovered pods carry a namespace, so
+// a non-empty namespace picks the pod in that namespace.
+func getTiltState(ctx context.Context, service, namespace string) (*TiltState, error) {
+	state := &TiltState{}
+
+	// Find the exact Tilt resource name (might be be-ratelimit when service is ratelimit)
+	tiltResourceName, err := findTiltResource(ctx, service)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find tilt resource: %w", err)
+	}
+
+	// Get KubernetesDiscovery state (pod name, startedAt)
+	kdOutput, err := cmdrun.Output(ctx, cmdrun.Tilt, "tilt", "get", "kubernetesdiscovery", tiltResourceName, "-o", "json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get kubernetesdiscovery: %w", err)
+	}
+
+	var kdResult struct {
+		Status struct {
+			Pods []struct {
+				Name       string `json:"name"`
+				Namespace  string `json:"namespace"`
+				Containers []struct {
+					State struct {
+						Running *struct {
+							StartedAt time.Time `json:"startedAt"`
+						} `json:"running"`
+					} `json:"state"`
+				} `json:"containers"`
+			} `json:"pods"`
+		} `json:"status"`
+	}
+
+	if err := json.Unmarshal(kdOutput, &kdResult); err != nil {
+		return nil, fmt.Errorf("failed to parse kubernetesdiscovery output: %w", err)
+	}
+
+	for _, pod := range kdResult.Status.Pods {
+		if namespace != "" && pod.Namespace != "" && pod.Namespace != namespace {
+			continue
+		}
+		state.PodName = pod.Name
+		if len(pod.Containers) > 0 {
+			if running := pod.Containers[0].State.Running; running != nil {
+				state.StartedAt = running.StartedAt
+			}
+		}
+		break
+	}
+
+	// Get LiveUpdate state (lastFileTimeSynced)
+	luOutput, err := cmdrun.Output(ctx, cmdrun.Tilt, "tilt", "get", "liveupdate", "-o", "json")
+	if err != nil {
+		// LiveUpdate might not exist, that's ok
+		return state, nil
+	}
+
+	var luResult struct {
+		Items []struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+			Status struct {
+				Containers []struct {
+					PodName            string     `json:"podName"`
+					LastFileTimeSynced *time.Time `json:"lastFileTimeSynced"`
+					ContainerID        string     `json:"containerID"`
+				} `json:"containers"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+
+	if err := json.Unmarshal(luOutput, &luResult); err != nil {
+		return state, nil // Ignore LiveUpdate parse errors
+	}
+
+	// Find matching LiveUpdate resource (use tiltResourceName for matching)
+	for _, item := range luResult.Items {
+		if strings.Contains(item.Metadata.Name, tiltResourceName) {
+			if len(item.Status.Containers) > 0 {
+				state.LastFileTimeSynced = item.Status.Containers[0].LastFileTimeSynced
+				state.ContainerID = item.Status.Containers[0].ContainerID
+			}
+			break
+		}
+	}
+
+	return state, nil
+}
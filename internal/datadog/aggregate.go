@@ -3,11 +3,17 @@ package datadog
 import (
 	"context"
 	"fmt"
-	"os"
 	"path/filepath"
 	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/parallel"
+	"github.com/arreyder/pprof-mcp/internal/tempfiles"
 )
 
+// aggregateDownloadConcurrency bounds the bundles one aggregation downloads
+// at once.
+const aggregateDownloadConcurrency = 3
+
 type AggregateProfilesParams struct {
 	Service     string
 	Env         string
@@ -80,20 +86,29 @@ func AggregateProfiles(ctx context.Context, params AggregateProfilesParams) (Agg
 		return AggregateProfilesResult{}, fmt.Errorf("no profiles found in the requested window")
 	}
 
+	keep := func() {}
 	outDir := params.OutDir
 	if outDir == "" {
-		outDir, err = os.MkdirTemp("", "pprof-aggregate-*")
+		tmp, err := tempfiles.MkdirTemp("", "pprof-aggregate-*")
 		if err != nil {
 			return AggregateProfilesResult{}, fmt.Errorf("failed to create temp dir: %w", err)
 		}
+		// Removed unless the profiles in it are returned.
+		defer tmp.Remove()
+		keep = tmp.Keep
+		outDir = tmp.Path
 	}
 
-	paths := []string{}
-	warnings := append([]string{}, listResult.Warnings...)
-	for idx, candidate := range listResult.Candidates {
-		if idx >= limit {
-			break
-		}
+	candidates := listResult.Candidates
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	type fetched struct {
+		path    string
+		warning string
+	}
+	downloads, err := parallel.Map(ctx, len(candidates), aggregateDownloadConcurrency, func(ctx context.Context, idx int) (fetched, error) {
+		candidate := candidates[idx]
 		downloadDir := filepath.Join(outDir, fmt.Sprintf("profile-%d", idx+1))
 		download, err := DownloadLatestBundle(ctx, DownloadParams{
 			Service:   params.Service,
@@ -104,21 +119,33 @@ func AggregateProfiles(ctx context.Context, params AggregateProfilesParams) (Agg
 			EventID:   candidate.EventID,
 		})
 		if err != nil {
-			warnings = append(warnings, fmt.Sprintf("download failed for profile %s: %v", candidate.ProfileID, err))
-			continue
+			return fetched{warning: fmt.Sprintf("download failed for profile %s: %v", candidate.ProfileID, err)}, nil
 		}
 		path := findProfileByType(download.Files, profileType)
 		if path == "" {
-			warnings = append(warnings, fmt.Sprintf("profile type %q not found for %s", profileType, candidate.ProfileID))
+			return fetched{warning: fmt.Sprintf("profile type %q not found for %s", profileType, candidate.ProfileID)}, nil
+		}
+		return fetched{path: path}, nil
+	})
+	if err != nil {
+		return AggregateProfilesResult{}, err
+	}
+
+	paths := []string{}
+	warnings := append([]string{}, listResult.Warnings...)
+	for _, download := range downloads {
+		if download.warning != "" {
+			warnings = append(warnings, download.warning)
 			continue
 		}
-		paths = append(paths, path)
+		paths = append(paths, download.path)
 	}
 
 	if len(paths) == 0 {
 		return AggregateProfilesResult{}, fmt.Errorf("no profiles available to merge")
 	}
 
+	keep()
 	return AggregateProfilesResult{
 		Service:        params.Service,
 		Env:            params.Env,
@@ -0,0 +1,42 @@
+package datadog
+
+import (
+	"sync"
+)
+
+var apiCallStats = struct {
+	mu     sync.Mutex
+	counts map[string]uint64
+}{counts: map[string]uint64{}}
+
+// recordAPICall counts one HTTP request to the Datadog API by outcome:
+// "2xx", "3xx", "4xx", "5xx", or "error" for transport failures.
+func recordAPICall(status int, err error) {
+	outcome := "error"
+	if err == nil {
+		switch {
+		case status >= 500:
+			outcome = "5xx"
+		case status >= 400:
+			outcome = "4xx"
+		case status >= 300:
+			outcome = "3xx"
+		case status >= 200:
+			outcome = "2xx"
+		}
+	}
+	apiCallStats.mu.Lock()
+	apiCallStats.counts[outcome]++
+	apiCallStats.mu.Unlock()
+}
+
+// APICallCounts returns a snapshot of Datadog API request counts by outcome.
+func APICallCounts() map[string]uint64 {
+	apiCallStats.mu.Lock()
+	defer apiCallStats.mu.Unlock()
+	snapshot := make(map[string]uint64, len(apiCallStats.counts))
+	for outcome, count := range apiCallStats.counts {
+		snapshot[outcome] = count
+	}
+	return snapshot
+}
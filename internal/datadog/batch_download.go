@@ -0,0 +1,175 @@
+package datadog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+)
+
+const defaultBatchParallel = 4
+
+type BatchDownloadParams struct {
+	Service  string
+	Env      string
+	OutDir   string // Each bundle goes to OutDir/<profile_id>
+	Site     string
+	Hours    int
+	Host     string
+	Count    int // Number of most recent profiles to download
+	Parallel int // Concurrent downloads (default: 4)
+	// Progress, when set, receives per-profile updates. It is called
+	// concurrently from the download goroutines.
+	Progress func(BatchProgress)
+}
+
+// BatchProgress is one profile's state within a batch download.
+type BatchProgress struct {
+	Index     int
+	ProfileID string
+	Timestamp string
+	State     string // queued, downloading, retrying, done, failed
+	Bytes     int64
+	Total     int64
+	Retries   int
+	Files     int
+	Err       error
+}
+
+type BatchDownloadFailure struct {
+	ProfileID string `json:"profile_id"`
+	EventID   string `json:"event_id"`
+	Error     string `json:"error"`
+}
+
+type BatchDownloadResult struct {
+	Service  string                 `json:"service"`
+	Env      string                 `json:"env"`
+	FromTS   string                 `json:"from_ts"`
+	ToTS     string                 `json:"to_ts"`
+	Bundles  []DownloadResult       `json:"bundles"`
+	Failed   []BatchDownloadFailure `json:"failed,omitempty"`
+	Warnings []string               `json:"warnings,omitempty"`
+}
+
+// DownloadBundles downloads the Count most recent profile bundles with up
+// to Parallel downloads at once. Individual failures are reported in Failed;
+// an error is returned only when listing fails or nothing downloads.
+func DownloadBundles(ctx context.Context, params BatchDownloadParams) (BatchDownloadResult, error) {
+	if params.Service == "" || params.Env == "" || params.OutDir == "" {
+		return BatchDownloadResult{}, errors.New("service, env, and out_dir are required")
+	}
+	if params.Count <= 0 {
+		return BatchDownloadResult{}, errors.New("count must be positive")
+	}
+	parallel := params.Parallel
+	if parallel <= 0 {
+		parallel = defaultBatchParallel
+	}
+	report := params.Progress
+	if report == nil {
+		report = func(BatchProgress) {}
+	}
+
+	listResult, err := ListProfiles(ctx, ListProfilesParams{
+		Service: params.Service,
+		Env:     params.Env,
+		Hours:   params.Hours,
+		Limit:   params.Count,
+		Site:    params.Site,
+		Host:    params.Host,
+	})
+	if err != nil {
+		return BatchDownloadResult{}, err
+	}
+	candidates := listResult.Candidates
+	if len(candidates) > params.Count {
+		candidates = candidates[:params.Count]
+	}
+	if len(candidates) == 0 {
+		return BatchDownloadResult{}, fmt.Errorf("no profiles found for %s/%s", params.Service, params.Env)
+	}
+
+	result := BatchDownloadResult{
+		Service:  params.Service,
+		Env:      params.Env,
+		FromTS:   listResult.FromTS,
+		ToTS:     listResult.ToTS,
+		Warnings: append([]string{}, listResult.Warnings...),
+	}
+	if len(candidates) < params.Count {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("only %d of %d requested profiles found", len(candidates), params.Count))
+	}
+	for i, c := range candidates {
+		report(BatchProgress{Index: i, ProfileID: c.ProfileID, Timestamp: c.Timestamp, State: "queued", Total: -1})
+	}
+
+	bundles := make([]*DownloadResult, len(candidates))
+	failures := make([]*BatchDownloadFailure, len(candidates))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+
+	for i, candidate := range candidates {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return BatchDownloadResult{}, ctx.Err()
+		}
+
+		wg.Add(1)
+		go func(idx int, c ProfileCandidate) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			state := BatchProgress{Index: idx, ProfileID: c.ProfileID, Timestamp: c.Timestamp, State: "downloading", Total: -1}
+			report(state)
+			downloadCtx := WithDownloadProgress(ctx, func(p DownloadProgress) {
+				state.Bytes, state.Total, state.Retries = p.Bytes, p.Total, p.Retries
+				state.State = "downloading"
+				if p.RetryStatus != 0 {
+					state.State = "retrying"
+				}
+				report(state)
+			})
+
+			bundle, err := DownloadLatestBundle(downloadCtx, DownloadParams{
+				Service:   params.Service,
+				Env:       params.Env,
+				OutDir:    filepath.Join(params.OutDir, sanitizeFilename(c.ProfileID)),
+				Site:      params.Site,
+				Hours:     params.Hours,
+				ProfileID: c.ProfileID,
+				EventID:   c.EventID,
+			})
+			if err != nil {
+				failures[idx] = &BatchDownloadFailure{ProfileID: c.ProfileID, EventID: c.EventID, Error: err.Error()}
+				state.State, state.Err = "failed", err
+				report(state)
+				return
+			}
+			// The explicit profile_id path has no timestamp; keep the list's.
+			if bundle.Timestamp == "" {
+				bundle.Timestamp = c.Timestamp
+			}
+			bundles[idx] = &bundle
+			state.State, state.Files = "done", len(bundle.Files)
+			report(state)
+		}(i, candidate)
+	}
+	wg.Wait()
+
+	for i := range candidates {
+		if bundles[i] != nil {
+			result.Bundles = append(result.Bundles, *bundles[i])
+		}
+		if failures[i] != nil {
+			result.Failed = append(result.Failed, *failures[i])
+		}
+	}
+	if len(result.Bundles) == 0 {
+		return result, fmt.Errorf("all %d downloads failed; first error: %s", len(result.Failed), result.Failed[0].Error)
+	}
+	return result, nil
+}
@@ -0,0 +1,175 @@
+package datadog
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+// hostBreaker is a circuit breaker per Datadog host shared by every tool:
+// after threshold consecutive failed requests (transport errors, 429s, and
+// 5xx) the host is open and requests fail fast with a *DegradedError until
+// the cooldown passes. Then one probe request goes through; its success
+// closes the breaker and its failure opens it for another cooldown.
+type hostBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	hosts     map[string]*breakerState
+}
+
+type breakerState struct {
+	failures  int
+	lastError string
+	openUntil time.Time
+	probing   bool
+}
+
+// breakerOutcome is how a request that the breaker let through ended.
+type breakerOutcome int
+
+const (
+	breakerSuccess breakerOutcome = iota
+	breakerFailure
+	// breakerAbandoned is a request that never got an answer for reasons of
+	// its own (the caller's context ended); it says nothing about the host.
+	breakerAbandoned
+)
+
+func newHostBreaker(threshold int, cooldown time.Duration) *hostBreaker {
+	return &hostBreaker{threshold: threshold, cooldown: cooldown, hosts: map[string]*breakerState{}}
+}
+
+// allow returns a *DegradedError when host is open. Every nil return must be
+// followed by one record call for the same host.
+func (b *hostBreaker) allow(host string, now time.Time) error {
+	if b == nil || b.threshold <= 0 || host == "" {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state := b.hosts[host]
+	if state == nil || state.failures < b.threshold {
+		return nil
+	}
+	if now.Before(state.openUntil) {
+		return b.degraded(host, state, state.openUntil.Sub(now))
+	}
+	if state.probing {
+		return b.degraded(host, state, b.cooldown)
+	}
+	state.probing = true
+	return nil
+}
+
+func (b *hostBreaker) record(host string, outcome breakerOutcome, reason string, now time.Time) {
+	if b == nil || b.threshold <= 0 || host == "" {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state := b.hosts[host]
+	if state == nil {
+		state = &breakerState{}
+		b.hosts[host] = state
+	}
+	state.probing = false
+	switch outcome {
+	case breakerSuccess:
+		state.failures = 0
+		state.lastError = ""
+		state.openUntil = time.Time{}
+	case breakerFailure:
+		state.failures++
+		state.lastError = reason
+		if state.failures >= b.threshold {
+			state.openUntil = now.Add(b.cooldown)
+		}
+	}
+}
+
+func (b *hostBreaker) degraded(host string, state *breakerState, retryAfter time.Duration) *DegradedError {
+	return &DegradedError{
+		Host:       host,
+		Failures:   state.failures,
+		LastError:  state.lastError,
+		RetryAfter: retryAfter,
+	}
+}
+
+// DegradedError is returned without contacting Datadog while the circuit
+// breaker for its host is open.
+type DegradedError struct {
+	Host       string
+	Failures   int
+	LastError  string
+	RetryAfter time.Duration
+}
+
+func (e *DegradedError) Error() string {
+	return fmt.Sprintf("Datadog degraded, retry after %s (%s: %d consecutive failed requests, last: %s)",
+		e.RetryAfter.Round(time.Second), e.Host, e.Failures, e.LastError)
+}
+
+var (
+	breakerOnce sync.Once
+	breaker     *hostBreaker
+)
+
+func getBreaker() *hostBreaker {
+	breakerOnce.Do(func() {
+		breaker = newHostBreaker(breakerThreshold(), breakerCooldown())
+	})
+	return breaker
+}
+
+// breakerThreshold reads PPROF_MCP_DD_BREAKER_THRESHOLD; 0 disables the
+// breaker.
+func breakerThreshold() int {
+	raw := strings.TrimSpace(os.Getenv("PPROF_MCP_DD_BREAKER_THRESHOLD"))
+	if raw == "" {
+		return defaultBreakerThreshold
+	}
+	val, err := strconv.Atoi(raw)
+	if err != nil || val < 0 {
+		return defaultBreakerThreshold
+	}
+	return val
+}
+
+// breakerCooldown reads PPROF_MCP_DD_BREAKER_COOLDOWN in seconds.
+func breakerCooldown() time.Duration {
+	raw := strings.TrimSpace(os.Getenv("PPROF_MCP_DD_BREAKER_COOLDOWN"))
+	if raw == "" {
+		return defaultBreakerCooldown
+	}
+	val, err := strconv.Atoi(raw)
+	if err != nil || val < 1 {
+		return defaultBreakerCooldown
+	}
+	return time.Duration(val) * time.Second
+}
+
+// BreakerStates reports, for each Datadog host requested so far, whether its
+// circuit breaker is open (failing requests fast).
+func BreakerStates() map[string]bool {
+	return getBreaker().states(time.Now())
+}
+
+func (b *hostBreaker) states(now time.Time) map[string]bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	states := make(map[string]bool, len(b.hosts))
+	for host, state := range b.hosts {
+		states[host] = b.threshold > 0 && state.failures >= b.threshold && now.Before(state.openUntil)
+	}
+	return states
+}
@@ -0,0 +1,75 @@
+package datadog
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHostBreakerOpensAndProbes(t *testing.T) {
+	b := newHostBreaker(3, 30*time.Second)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	host := "api.datadoghq.com"
+
+	for i := 0; i < 3; i++ {
+		if err := b.allow(host, now); err != nil {
+			t.Fatalf("expected request %d through, got %v", i, err)
+		}
+		b.record(host, breakerFailure, "status 503", now)
+	}
+	// A canceled caller neither opens nor closes the breaker.
+	b.record("other.example", breakerAbandoned, "", now)
+	if err := b.allow("other.example", now); err != nil {
+		t.Fatalf("expected other host closed, got %v", err)
+	}
+
+	err := b.allow(host, now.Add(10*time.Second))
+	var degraded *DegradedError
+	if !errors.As(err, &degraded) {
+		t.Fatalf("expected DegradedError, got %v", err)
+	}
+	if degraded.RetryAfter != 20*time.Second || degraded.Failures != 3 || degraded.LastError != "status 503" {
+		t.Fatalf("unexpected error fields: %+v", degraded)
+	}
+	if !strings.HasPrefix(err.Error(), "Datadog degraded, retry after 20s") {
+		t.Fatalf("unexpected message: %v", err)
+	}
+	if !b.states(now)[host] {
+		t.Fatalf("expected %s reported open", host)
+	}
+
+	// After the cooldown one probe goes through; others wait for it.
+	later := now.Add(31 * time.Second)
+	if err := b.allow(host, later); err != nil {
+		t.Fatalf("expected probe through, got %v", err)
+	}
+	if err := b.allow(host, later); err == nil {
+		t.Fatal("expected second request to wait for the probe")
+	}
+	b.record(host, breakerFailure, "status 502", later)
+	if err := b.allow(host, later.Add(time.Second)); err == nil {
+		t.Fatal("expected failed probe to reopen the breaker")
+	}
+
+	// A successful probe closes it.
+	latest := later.Add(31 * time.Second)
+	if err := b.allow(host, latest); err != nil {
+		t.Fatalf("expected probe through, got %v", err)
+	}
+	b.record(host, breakerSuccess, "", latest)
+	if err := b.allow(host, latest); err != nil {
+		t.Fatalf("expected closed breaker, got %v", err)
+	}
+	if b.states(latest)[host] {
+		t.Fatalf("expected %s reported closed", host)
+	}
+
+	disabled := newHostBreaker(0, time.Second)
+	for i := 0; i < 10; i++ {
+		disabled.record(host, breakerFailure, "status 500", now)
+	}
+	if err := disabled.allow(host, now); err != nil {
+		t.Fatalf("expected disabled breaker to allow, got %v", err)
+	}
+}
@@ -2,11 +2,15 @@ package datadog
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+
+	"github.com/arreyder/pprof-mcp/internal/pprof"
+	"github.com/arreyder/pprof-mcp/internal/pprofparse"
+	"github.com/arreyder/pprof-mcp/internal/tempfiles"
+	"github.com/arreyder/pprof-mcp/internal/textutil"
 )
 
 type CompareRangeParams struct {
@@ -37,6 +41,9 @@ type CompareRangeResult struct {
 	Diff          string         `json:"diff"`
 	TopChanges    []FunctionDiff `json:"top_changes"`
 	Warnings      []string       `json:"warnings,omitempty"`
+	// DiffStderr is what pprof printed while diffing, apart from Diff.
+	DiffStderr     string                `json:"-"`
+	DiffStderrMeta textutil.TruncateMeta `json:"-"`
 }
 
 type ProfileSummary struct {
@@ -69,13 +76,17 @@ func CompareRange(ctx context.Context, params CompareRangeParams) (CompareRangeR
 		TopChanges: []FunctionDiff{},
 	}
 
+	keep := func() {}
 	outDir := params.OutDir
 	if outDir == "" {
-		var err error
-		outDir, err = os.MkdirTemp("", "pprof-compare-*")
+		tmp, err := tempfiles.MkdirTemp("", "pprof-compare-*")
 		if err != nil {
 			return result, fmt.Errorf("failed to create temp dir: %w", err)
 		}
+		// Removed unless the profiles in it are returned.
+		defer tmp.Remove()
+		keep = tmp.Keep
+		outDir = tmp.Path
 	}
 
 	profileType := params.ProfileType
@@ -159,13 +170,15 @@ func CompareRange(ctx context.Context, params CompareRangeParams) (CompareRangeR
 
 	// Run pprof diff
 	diffOutput, err := runPprofDiff(ctx, beforeFile, afterFile)
+	result.DiffStderr, result.DiffStderrMeta = diffOutput.Stderr, diffOutput.StderrMeta
 	if err != nil {
 		result.Warnings = append(result.Warnings, fmt.Sprintf("diff failed: %v", err))
 	} else {
-		result.Diff = diffOutput
-		result.TopChanges = parseDiffChanges(diffOutput)
+		result.Diff = diffOutput.Stdout
+		result.TopChanges = parseDiffChanges(diffOutput.Stdout)
 	}
 
+	keep()
 	return result, nil
 }
 
@@ -185,16 +198,16 @@ func findProfileByType(files []ProfileFile, profileType string) string {
 	return ""
 }
 
-func runPprofDiff(ctx context.Context, before, after string) (string, error) {
+func runPprofDiff(ctx context.Context, before, after string) (pprof.CommandOutput, error) {
 	// pprof -top -base=before after shows diff
-	args := []string{"tool", "pprof", "-top", "-nodecount=20", fmt.Sprintf("-base=%s", before), after}
-
-	cmd := exec.CommandContext(ctx, "go", args...)
-	out, err := cmd.CombinedOutput()
+	output, err := pprof.RunTool(ctx, "diff", "-top", "-nodecount=20", fmt.Sprintf("-base=%s", before), after)
 	if err != nil {
-		return "", fmt.Errorf("pprof diff failed: %w: %s", err, string(out))
+		return output, err
+	}
+	if pprofparse.ParseTop(output.Stdout).Summary.TableHeader == "" {
+		return output, &pprof.ParseError{Op: "diff", Command: output.Command, Err: errors.New("no flat/cum table in the output")}
 	}
-	return string(out), nil
+	return output, nil
 }
 
 func parseDiffChanges(diffOutput string) []FunctionDiff {
@@ -17,7 +17,10 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/tempfiles"
 )
 
 const defaultSite = "us3.datadoghq.com"
@@ -204,6 +207,12 @@ func doRequest(ctx context.Context, method, url, apiKey, appKey string, payload
 }
 
 func doRequestWithRetry(ctx context.Context, method, urlStr, apiKey, appKey string, body []byte, contentType string, timeout time.Duration) ([]byte, int, error) {
+	return doRequestWithProgress(ctx, method, urlStr, apiKey, appKey, body, contentType, timeout, nil)
+}
+
+// doRequestWithProgress is doRequestWithRetry that also reports received
+// response bytes and retries to progress when it is non-nil.
+func doRequestWithProgress(ctx context.Context, method, urlStr, apiKey, appKey string, body []byte, contentType string, timeout time.Duration, progress ProgressFunc) ([]byte, int, error) {
 	if len(body) > maxRequestBodyBytes {
 		return nil, 0, fmt.Errorf("datadog request body too large (%d bytes)", len(body))
 	}
@@ -214,6 +223,7 @@ func doRequestWithRetry(ctx context.Context, method, urlStr, apiKey, appKey stri
 	client := &http.Client{Timeout: timeout}
 	host := hostFromURL(urlStr)
 	limiter := getRateLimiter()
+	breaker := getBreaker()
 
 	for attempt := 1; attempt <= attempts; attempt++ {
 		if err := limiter.Wait(ctx, host); err != nil {
@@ -223,22 +233,40 @@ func doRequestWithRetry(ctx context.Context, method, urlStr, apiKey, appKey stri
 		if err != nil {
 			return nil, 0, err
 		}
+		// Checked on every attempt, so a retry loop stops as soon as other
+		// calls have found the host failing.
+		if err := breaker.allow(host, time.Now()); err != nil {
+			return nil, 0, err
+		}
 		resp, err := client.Do(req)
 		if err != nil {
+			recordAPICall(0, err)
+			breaker.record(host, transportOutcome(ctx), err.Error(), time.Now())
 			return nil, 0, err
 		}
-		respBody, readErr := io.ReadAll(resp.Body)
+		recordAPICall(resp.StatusCode, nil)
+		var reader io.Reader = resp.Body
+		if progress != nil {
+			reader = &progressReader{reader: resp.Body, total: resp.ContentLength, retries: attempt - 1, report: progress}
+		}
+		respBody, readErr := io.ReadAll(reader)
 		resp.Body.Close()
 		if readErr != nil {
+			breaker.record(host, transportOutcome(ctx), readErr.Error(), time.Now())
 			return nil, resp.StatusCode, readErr
 		}
 		if !shouldRetry(resp.StatusCode) {
+			breaker.record(host, breakerSuccess, "", time.Now())
 			return respBody, resp.StatusCode, nil
 		}
+		breaker.record(host, breakerFailure, fmt.Sprintf("status %d", resp.StatusCode), time.Now())
 		if attempt == attempts {
 			return respBody, resp.StatusCode, fmt.Errorf("datadog request failed: status %d: %s", resp.StatusCode, string(respBody))
 		}
 		wait := retryDelay(resp, attempt)
+		if progress != nil {
+			progress(DownloadProgress{Total: -1, Retries: attempt, RetryStatus: resp.StatusCode})
+		}
 		if err := sleepWithContext(ctx, wait); err != nil {
 			return nil, resp.StatusCode, err
 		}
@@ -246,6 +274,15 @@ func doRequestWithRetry(ctx context.Context, method, urlStr, apiKey, appKey stri
 	return nil, 0, errors.New("datadog request failed")
 }
 
+// transportOutcome classifies a request that got no complete response: the
+// host's fault unless the caller's context ended first.
+func transportOutcome(ctx context.Context) breakerOutcome {
+	if ctx.Err() != nil {
+		return breakerAbandoned
+	}
+	return breakerFailure
+}
+
 func newRequest(ctx context.Context, method, urlStr, apiKey, appKey string, body []byte, contentType string) (*http.Request, error) {
 	var reader io.Reader
 	if len(body) > 0 {
@@ -516,16 +553,37 @@ func extractProfileMetadata(listResp map[string]any) (string, string, string, st
 }
 
 func downloadZip(ctx context.Context, url, apiKey, appKey string) ([]byte, error) {
-	respBody, status, err := doRequestWithRetry(ctx, http.MethodGet, url, apiKey, appKey, nil, "", 120*time.Second)
+	respBody, status, err := doRequestWithProgress(ctx, http.MethodGet, url, apiKey, appKey, nil, "", 120*time.Second, downloadProgressFrom(ctx))
 	if err != nil {
 		return nil, err
 	}
 	if status != http.StatusOK {
 		return nil, fmt.Errorf("profile download failed: status %d: %s", status, string(respBody))
 	}
+	if limit := maxDownloadBytes.Load(); limit > 0 && int64(len(respBody)) > limit {
+		return nil, &DownloadTooLargeError{Bytes: int64(len(respBody)), Limit: limit}
+	}
 	return respBody, nil
 }
 
+var maxDownloadBytes atomic.Int64
+
+// SetMaxDownloadBytes caps the size of a downloaded profile bundle. Zero
+// removes the cap.
+func SetMaxDownloadBytes(limit int64) {
+	maxDownloadBytes.Store(limit)
+}
+
+// DownloadTooLargeError is returned when a bundle exceeds the download cap.
+type DownloadTooLargeError struct {
+	Bytes int64
+	Limit int64
+}
+
+func (e *DownloadTooLargeError) Error() string {
+	return fmt.Sprintf("profile bundle is %d bytes, exceeding the %d byte download limit", e.Bytes, e.Limit)
+}
+
 func extractProfiles(zipBytes []byte, service, env, outDir string) ([]ProfileFile, string, error) {
 	if err := os.MkdirAll(outDir, 0o755); err != nil {
 		return nil, "", err
@@ -536,12 +594,19 @@ func extractProfiles(zipBytes []byte, service, env, outDir string) ([]ProfileFil
 		return nil, "", err
 	}
 
-	workDir, err := os.MkdirTemp("", "gofast-profiles-*")
+	limits := currentExtractLimits()
+	if err := limits.checkEntries(reader.File); err != nil {
+		return nil, "", err
+	}
+
+	work, err := tempfiles.MkdirTemp("", "gofast-profiles-*")
 	if err != nil {
 		return nil, "", err
 	}
-	defer os.RemoveAll(workDir)
+	defer work.Remove()
+	workDir := work.Path
 
+	var extracted int64
 	for _, file := range reader.File {
 		// Sanitize the file name to prevent path traversal attacks
 		cleanName := filepath.Clean(file.Name)
@@ -565,22 +630,17 @@ func extractProfiles(zipBytes []byte, service, env, outDir string) ([]ProfileFil
 		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 			return nil, "", err
 		}
-		in, err := file.Open()
-		if err != nil {
-			return nil, "", err
-		}
 		out, err := os.Create(path)
 		if err != nil {
-			in.Close()
 			return nil, "", err
 		}
-		if _, err := io.Copy(out, in); err != nil {
-			in.Close()
+		if err := limits.copyEntry(out, file, &extracted); err != nil {
 			out.Close()
 			return nil, "", err
 		}
-		in.Close()
-		out.Close()
+		if err := out.Close(); err != nil {
+			return nil, "", err
+		}
 	}
 
 	pprofFiles := []string{}
@@ -0,0 +1,35 @@
+package datadog
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDownloadZipEnforcesMaxBytes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("x", 2048)))
+	}))
+	defer server.Close()
+
+	SetMaxDownloadBytes(1024)
+	defer SetMaxDownloadBytes(0)
+
+	_, err := downloadZip(context.Background(), server.URL, "api", "app")
+	var tooLarge *DownloadTooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("expected DownloadTooLargeError, got %v", err)
+	}
+	if tooLarge.Bytes != 2048 || tooLarge.Limit != 1024 {
+		t.Fatalf("unexpected error fields: %+v", tooLarge)
+	}
+
+	SetMaxDownloadBytes(0)
+	body, err := downloadZip(context.Background(), server.URL, "api", "app")
+	if err != nil || len(body) != 2048 {
+		t.Fatalf("expected uncapped download, got %d bytes, err %v", len(body), err)
+	}
+}
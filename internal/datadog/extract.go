@@ -0,0 +1,119 @@
+package datadog
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Bundle extraction limits. A bundle holds a handful of profiles and a
+// metrics.json, so anything far past these is a malformed or hostile archive.
+const (
+	defaultMaxExtractFileBytes = 1 << 30 // 1 GiB per entry
+	defaultMaxExtractBytes     = 4 << 30 // 4 GiB per bundle
+	defaultMaxExtractEntries   = 256
+	defaultMaxExtractDepth     = 8
+)
+
+// extractLimits bounds what one bundle may decompress to.
+type extractLimits struct {
+	fileBytes  int64
+	totalBytes int64
+	entries    int
+	depth      int
+}
+
+// currentExtractLimits reads the limits from PPROF_MCP_DD_MAX_EXTRACT_FILE_BYTES,
+// PPROF_MCP_DD_MAX_EXTRACT_BYTES, PPROF_MCP_DD_MAX_EXTRACT_ENTRIES, and
+// PPROF_MCP_DD_MAX_EXTRACT_DEPTH, falling back to the defaults.
+func currentExtractLimits() extractLimits {
+	return extractLimits{
+		fileBytes:  positiveEnvInt("PPROF_MCP_DD_MAX_EXTRACT_FILE_BYTES", defaultMaxExtractFileBytes),
+		totalBytes: positiveEnvInt("PPROF_MCP_DD_MAX_EXTRACT_BYTES", defaultMaxExtractBytes),
+		entries:    int(positiveEnvInt("PPROF_MCP_DD_MAX_EXTRACT_ENTRIES", defaultMaxExtractEntries)),
+		depth:      int(positiveEnvInt("PPROF_MCP_DD_MAX_EXTRACT_DEPTH", defaultMaxExtractDepth)),
+	}
+}
+
+func positiveEnvInt(key string, fallback int64) int64 {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return fallback
+	}
+	val, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || val < 1 {
+		return fallback
+	}
+	return val
+}
+
+// ExtractLimitError is returned when a bundle would decompress past one of
+// the extraction limits. Nothing from the bundle is kept.
+type ExtractLimitError struct {
+	Limit string // "file_bytes", "total_bytes", "entries", or "depth"
+	Entry string // the zip entry that crossed it, if any
+	Max   int64
+	Env   string // variable that raises the limit
+}
+
+func (e *ExtractLimitError) Error() string {
+	var what string
+	switch e.Limit {
+	case "file_bytes":
+		what = fmt.Sprintf("entry %s decompresses to more than %d bytes", e.Entry, e.Max)
+	case "total_bytes":
+		what = fmt.Sprintf("decompresses to more than %d bytes in total (at entry %s)", e.Max, e.Entry)
+	case "entries":
+		what = fmt.Sprintf("has more than %d entries", e.Max)
+	case "depth":
+		what = fmt.Sprintf("entry %s is nested more than %d directories deep", e.Entry, e.Max)
+	}
+	return fmt.Sprintf("profile bundle %s; refusing to extract it (raise the limit with %s)", what, e.Env)
+}
+
+// checkEntries rejects an archive with too many or too deeply nested entries
+// before anything is written.
+func (l extractLimits) checkEntries(files []*zip.File) error {
+	if len(files) > l.entries {
+		return &ExtractLimitError{Limit: "entries", Max: int64(l.entries), Env: "PPROF_MCP_DD_MAX_EXTRACT_ENTRIES"}
+	}
+	for _, file := range files {
+		name := strings.Trim(filepath.ToSlash(filepath.Clean(file.Name)), "/")
+		if depth := strings.Count(name, "/"); depth > l.depth {
+			return &ExtractLimitError{Limit: "depth", Entry: file.Name, Max: int64(l.depth), Env: "PPROF_MCP_DD_MAX_EXTRACT_DEPTH"}
+		}
+	}
+	return nil
+}
+
+// copyEntry writes file's contents to out, counting the bytes actually
+// decompressed (the sizes in the zip headers can lie) against the per-file
+// limit and, through extracted, against the per-bundle one.
+func (l extractLimits) copyEntry(out io.Writer, file *zip.File, extracted *int64) error {
+	if file.UncompressedSize64 > uint64(l.fileBytes) {
+		return &ExtractLimitError{Limit: "file_bytes", Entry: file.Name, Max: l.fileBytes, Env: "PPROF_MCP_DD_MAX_EXTRACT_FILE_BYTES"}
+	}
+	in, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	limit := min(l.fileBytes, l.totalBytes-*extracted)
+	n, err := io.Copy(out, io.LimitReader(in, limit+1))
+	*extracted += n
+	if err != nil {
+		return err
+	}
+	if n > l.fileBytes {
+		return &ExtractLimitError{Limit: "file_bytes", Entry: file.Name, Max: l.fileBytes, Env: "PPROF_MCP_DD_MAX_EXTRACT_FILE_BYTES"}
+	}
+	if *extracted > l.totalBytes {
+		return &ExtractLimitError{Limit: "total_bytes", Entry: file.Name, Max: l.totalBytes, Env: "PPROF_MCP_DD_MAX_EXTRACT_BYTES"}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package datadog
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func buildZip(t *testing.T, entries map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range entries {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractProfilesEnforcesLimits(t *testing.T) {
+	bundle := buildZip(t, map[string]string{
+		"cpu.pprof":       strings.Repeat("c", 600),
+		"heap.pprof":      strings.Repeat("h", 600),
+		"a/b/c/d/x.pprof": "x",
+	})
+	cases := []struct {
+		env, value, limit string
+	}{
+		{"PPROF_MCP_DD_MAX_EXTRACT_FILE_BYTES", "500", "file_bytes"},
+		{"PPROF_MCP_DD_MAX_EXTRACT_BYTES", "1000", "total_bytes"},
+		{"PPROF_MCP_DD_MAX_EXTRACT_ENTRIES", "2", "entries"},
+		{"PPROF_MCP_DD_MAX_EXTRACT_DEPTH", "3", "depth"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.limit, func(t *testing.T) {
+			t.Setenv(tc.env, tc.value)
+			_, _, err := extractProfiles(bundle, "api", "prod", t.TempDir())
+			var limitErr *ExtractLimitError
+			if !errors.As(err, &limitErr) {
+				t.Fatalf("expected ExtractLimitError, got %v", err)
+			}
+			if limitErr.Limit != tc.limit || limitErr.Env != tc.env {
+				t.Fatalf("unexpected error fields: %+v", limitErr)
+			}
+			if !strings.Contains(err.Error(), tc.env) {
+				t.Fatalf("error does not name %s: %v", tc.env, err)
+			}
+		})
+	}
+
+	files, _, err := extractProfiles(bundle, "api", "prod", t.TempDir())
+	if err != nil || len(files) != 3 {
+		t.Fatalf("expected 3 profiles under the default limits, got %d, err %v", len(files), err)
+	}
+}
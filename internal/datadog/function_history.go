@@ -1,15 +1,18 @@
 package datadog
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"os"
-	"os/exec"
 	"path/filepath"
 	"sort"
 	"strings"
-	"sync"
+
+	"github.com/arreyder/pprof-mcp/internal/parallel"
+	"github.com/arreyder/pprof-mcp/internal/pprof"
+	"github.com/arreyder/pprof-mcp/internal/pprofparse"
+	"github.com/arreyder/pprof-mcp/internal/tempfiles"
+	"github.com/arreyder/pprof-mcp/internal/textutil"
 )
 
 // FunctionHistoryParams configures the function history search.
@@ -34,6 +37,9 @@ type FunctionHistoryEntry struct {
 	FlatValue   string  `json:"flat_value"`
 	CumValue    string  `json:"cum_value"`
 	Found       bool    `json:"found"`
+	// Stderr is what pprof printed while searching this profile.
+	Stderr     string                 `json:"stderr,omitempty"`
+	StderrMeta *textutil.TruncateMeta `json:"stderr_meta,omitempty"`
 }
 
 // FunctionHistoryResult contains the search results across profiles.
@@ -92,86 +98,66 @@ func SearchFunctionHistory(ctx context.Context, params FunctionHistoryParams) (F
 	}
 
 	// Create temp directory for downloads
-	tmpDir, err := os.MkdirTemp("", "pprof-function-history-*")
+	tmp, err := tempfiles.MkdirTemp("", "pprof-function-history-*")
 	if err != nil {
 		return FunctionHistoryResult{}, fmt.Errorf("failed to create temp dir: %w", err)
 	}
-	defer os.RemoveAll(tmpDir)
+	defer tmp.Remove()
+	tmpDir := tmp.Path
 
-	entries := make([]FunctionHistoryEntry, len(listResult.Candidates))
 	warningsByIndex := make([][]string, len(listResult.Candidates))
 
-	sem := make(chan struct{}, functionHistoryConcurrency)
-	var wg sync.WaitGroup
-
-	// Process each profile with a small concurrency limit.
-	for i, candidate := range listResult.Candidates {
-		if err := ctx.Err(); err != nil {
-			return FunctionHistoryResult{}, err
-		}
-		select {
-		case sem <- struct{}{}:
-		case <-ctx.Done():
-			return FunctionHistoryResult{}, ctx.Err()
+	// Process profiles concurrently, with a small limit of our own so one
+	// search does not flood Datadog with downloads.
+	entries, err := parallel.Map(ctx, len(listResult.Candidates), functionHistoryConcurrency, func(ctx context.Context, idx int) (FunctionHistoryEntry, error) {
+		c := listResult.Candidates[idx]
+		entry := FunctionHistoryEntry{
+			Timestamp: c.Timestamp,
+			ProfileID: c.ProfileID,
+			EventID:   c.EventID,
+			Found:     false,
 		}
 
-		wg.Add(1)
-		go func(idx int, c ProfileCandidate) {
-			defer wg.Done()
-			defer func() { <-sem }()
-
-			entry := FunctionHistoryEntry{
-				Timestamp: c.Timestamp,
-				ProfileID: c.ProfileID,
-				EventID:   c.EventID,
-				Found:     false,
-			}
-
-			if err := ctx.Err(); err != nil {
-				entries[idx] = entry
-				return
-			}
-
-			profileDir := filepath.Join(tmpDir, sanitizeFilename(c.ProfileID))
-			result, err := DownloadLatestBundle(ctx, DownloadParams{
-				Service:   params.Service,
-				Env:       params.Env,
-				OutDir:    profileDir,
-				Site:      params.Site,
-				Hours:     params.Hours,
-				ProfileID: c.ProfileID,
-				EventID:   c.EventID,
-			})
-			if err != nil {
-				warningsByIndex[idx] = append(warningsByIndex[idx], fmt.Sprintf("failed to download profile %s: %v", c.ProfileID, err))
-				entries[idx] = entry
-				return
-			}
+		profileDir := filepath.Join(tmpDir, sanitizeFilename(c.ProfileID))
+		result, err := DownloadLatestBundle(ctx, DownloadParams{
+			Service:   params.Service,
+			Env:       params.Env,
+			OutDir:    profileDir,
+			Site:      params.Site,
+			Hours:     params.Hours,
+			ProfileID: c.ProfileID,
+			EventID:   c.EventID,
+		})
+		if err != nil {
+			warningsByIndex[idx] = append(warningsByIndex[idx], fmt.Sprintf("failed to download profile %s: %v", c.ProfileID, err))
+			return entry, nil
+		}
 
-			cpuProfile := findCPUProfile(result.Files)
-			if cpuProfile == "" {
-				warningsByIndex[idx] = append(warningsByIndex[idx], fmt.Sprintf("no CPU profile found for %s", c.ProfileID))
-				entries[idx] = entry
-				return
-			}
+		cpuProfile := findCPUProfile(result.Files)
+		if cpuProfile == "" {
+			warningsByIndex[idx] = append(warningsByIndex[idx], fmt.Sprintf("no CPU profile found for %s", c.ProfileID))
+			return entry, nil
+		}
 
-			funcResult, err := searchFunctionInProfile(ctx, cpuProfile, params.Function)
-			if err != nil {
-				warningsByIndex[idx] = append(warningsByIndex[idx], fmt.Sprintf("failed to search profile %s: %v", c.ProfileID, err))
-				entries[idx] = entry
-				return
-			}
+		funcResult, output, err := searchFunctionInProfile(ctx, cpuProfile, params.Function)
+		if strings.TrimSpace(output.Stderr) != "" {
+			entry.Stderr, entry.StderrMeta = output.Stderr, &output.StderrMeta
+		}
+		if err != nil {
+			warningsByIndex[idx] = append(warningsByIndex[idx], fmt.Sprintf("failed to search profile %s: %v", c.ProfileID, err))
+			return entry, nil
+		}
 
-			entry.Found = funcResult.Found
-			entry.FlatPercent = funcResult.FlatPercent
-			entry.CumPercent = funcResult.CumPercent
-			entry.FlatValue = funcResult.FlatValue
-			entry.CumValue = funcResult.CumValue
-			entries[idx] = entry
-		}(i, candidate)
+		entry.Found = funcResult.Found
+		entry.FlatPercent = funcResult.FlatPercent
+		entry.CumPercent = funcResult.CumPercent
+		entry.FlatValue = funcResult.FlatValue
+		entry.CumValue = funcResult.CumValue
+		return entry, nil
+	})
+	if err != nil {
+		return FunctionHistoryResult{}, err
 	}
-
-	wg.Wait()
 	if err := ctx.Err(); err != nil {
 		return FunctionHistoryResult{}, err
 	}
@@ -211,26 +197,17 @@ type functionSearchResult struct {
 	CumValue    string
 }
 
-func searchFunctionInProfile(ctx context.Context, profilePath, functionPattern string) (functionSearchResult, error) {
+func searchFunctionInProfile(ctx context.Context, profilePath, functionPattern string) (functionSearchResult, pprof.CommandOutput, error) {
 	// Use go tool pprof -top with focus to find the function
-	output, err := runPprofTop(ctx, profilePath, functionPattern)
+	output, err := pprof.RunTool(ctx, "top", "-top", "-focus", functionPattern, "-nodecount", "50", profilePath)
 	if err != nil {
-		return functionSearchResult{}, err
+		return functionSearchResult{}, output, err
 	}
-
-	return parseFunctionFromTop(output, functionPattern), nil
-}
-
-func runPprofTop(ctx context.Context, profilePath, focus string) (string, error) {
-	args := []string{"tool", "pprof", "-top", "-focus", focus, "-nodecount", "50", profilePath}
-	cmd := exec.CommandContext(ctx, "go", args...)
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-	stdout, err := cmd.Output()
-	if err != nil {
-		return "", fmt.Errorf("pprof top failed: %w\n%s", err, stderr.String())
+	if pprofparse.ParseTop(output.Stdout).Summary.TableHeader == "" {
+		return functionSearchResult{}, output, &pprof.ParseError{Op: "top", Command: output.Command, Err: errors.New("no flat/cum table in the output")}
 	}
-	return string(stdout), nil
+
+	return parseFunctionFromTop(output.Stdout, functionPattern), output, nil
 }
 
 func parseFunctionFromTop(output, pattern string) functionSearchResult {
@@ -268,9 +245,7 @@ func parseFunctionFromTop(output, pattern string) functionSearchResult {
 }
 
 func parsePercent(s string) float64 {
-	s = strings.TrimSuffix(s, "%")
-	var val float64
-	fmt.Sscanf(s, "%f", &val)
+	val, _ := pprofparse.ParsePercent(s)
 	return val
 }
 
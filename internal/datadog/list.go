@@ -4,7 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"os"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -404,11 +406,12 @@ func formatSampleInfo(fields map[string]float64) string {
 	}
 
 	if len(parts) == 0 {
-		// Fall back to showing the first numeric field
-		for key, val := range fields {
-			return formatMetricValue(key, val)
+		// Fall back to showing the first numeric field by name
+		keys := slices.Sorted(maps.Keys(fields))
+		if len(keys) == 0 {
+			return "-"
 		}
-		return "-"
+		return formatMetricValue(keys[0], fields[keys[0]])
 	}
 
 	return strings.Join(parts, " ")
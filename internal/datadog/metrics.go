@@ -9,6 +9,7 @@ import (
 	"os"
 	"sort"
 	"strings"
+	"time"
 )
 
 type MetricsDiscoverParams struct {
@@ -138,22 +139,12 @@ func searchMetrics(ctx context.Context, site, apiKey, appKey, query string) ([]M
 	// Use the v1 metrics search endpoint
 	searchURL := fmt.Sprintf("https://api.%s/api/v1/search?q=metrics:%s", site, url.QueryEscape(query))
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, searchURL, nil)
+	respBody, status, err := doRequestWithRetry(ctx, http.MethodGet, searchURL, apiKey, appKey, nil, "", 30*time.Second)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("DD-API-KEY", apiKey)
-	req.Header.Set("DD-APPLICATION-KEY", appKey)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("metrics search failed: status %d", resp.StatusCode)
+	if status >= 300 {
+		return nil, fmt.Errorf("metrics search failed: status %d", status)
 	}
 
 	var result struct {
@@ -162,7 +153,7 @@ func searchMetrics(ctx context.Context, site, apiKey, appKey, query string) ([]M
 		} `json:"results"`
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	if err := json.Unmarshal(respBody, &result); err != nil {
 		return nil, err
 	}
 
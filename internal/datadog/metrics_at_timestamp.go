@@ -226,22 +226,12 @@ func queryMetricSeries(ctx context.Context, site, apiKey, appKey, metricName, ta
 	params.Set("to", fmt.Sprintf("%d", to.Unix()))
 	params.Set("query", query)
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, queryURL+"?"+params.Encode(), nil)
+	respBody, status, err := doRequestWithRetry(ctx, http.MethodGet, queryURL+"?"+params.Encode(), apiKey, appKey, nil, "", 30*time.Second)
 	if err != nil {
 		return series, err
 	}
-	req.Header.Set("DD-API-KEY", apiKey)
-	req.Header.Set("DD-APPLICATION-KEY", appKey)
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return series, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 300 {
-		return series, fmt.Errorf("query failed: status %d", resp.StatusCode)
+	if status >= 300 {
+		return series, fmt.Errorf("query failed: status %d", status)
 	}
 
 	var result struct {
@@ -255,7 +245,7 @@ func queryMetricSeries(ctx context.Context, site, apiKey, appKey, metricName, ta
 		} `json:"series"`
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	if err := json.Unmarshal(respBody, &result); err != nil {
 		return series, err
 	}
 
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"sort"
 	"time"
 )
 
@@ -152,9 +153,15 @@ func pickAnomalous(candidates []ProfileCandidate) (ProfileCandidate, float64, st
 	var bestZScore float64
 	var bestField string
 
-	// Check priority fields first, then all others
-	fieldsToCheck := append([]string{}, priorityFields...)
+	// Check priority fields first, then the others by name, so equal z-scores
+	// pick the same field every run
+	others := make([]string, 0, len(fieldSet))
 	for field := range fieldSet {
+		others = append(others, field)
+	}
+	sort.Strings(others)
+	fieldsToCheck := append([]string{}, priorityFields...)
+	for _, field := range others {
 		found := false
 		for _, p := range priorityFields {
 			if field == p {
@@ -0,0 +1,101 @@
+package datadog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// PodUsageParams selects a per-pod resource metric from Datadog.
+type PodUsageParams struct {
+	Namespace string // kube_namespace tag
+	Env       string // optional env tag
+	Site      string
+	Metric    string        // e.g. kubernetes.cpu.usage.total
+	Window    time.Duration // averaging window ending now (default 10m)
+}
+
+// QueryPodUsage returns the metric's average over the window for every pod
+// in the namespace, keyed by pod_name.
+func QueryPodUsage(ctx context.Context, params PodUsageParams) (map[string]float64, error) {
+	if params.Namespace == "" || params.Metric == "" {
+		return nil, fmt.Errorf("namespace and metric are required")
+	}
+	site := params.Site
+	if site == "" {
+		site = os.Getenv("DD_SITE")
+	}
+	if site == "" {
+		site = defaultSite
+	}
+	window := params.Window
+	if window <= 0 {
+		window = 10 * time.Minute
+	}
+	apiKey, appKey, err := loadKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []string{"kube_namespace:" + params.Namespace}
+	if params.Env != "" {
+		tags = append(tags, "env:"+params.Env)
+	}
+	to := time.Now()
+	query := url.Values{}
+	query.Set("from", fmt.Sprintf("%d", to.Add(-window).Unix()))
+	query.Set("to", fmt.Sprintf("%d", to.Unix()))
+	query.Set("query", fmt.Sprintf("avg:%s{%s} by {pod_name}", params.Metric, strings.Join(tags, ",")))
+
+	respBody, status, err := doRequestWithRetry(ctx, http.MethodGet, fmt.Sprintf("https://api.%s/api/v1/query?%s", site, query.Encode()), apiKey, appKey, nil, "", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if status >= 300 {
+		return nil, fmt.Errorf("query failed: status %d", status)
+	}
+
+	var result struct {
+		Series []usageSeries `json:"series"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, err
+	}
+	return podUsageFromSeries(result.Series), nil
+}
+
+// usageSeries is one pod's series from a "by {pod_name}" query.
+type usageSeries struct {
+	PointList [][]*float64 `json:"pointlist"`
+	TagSet    []string     `json:"tag_set"`
+}
+
+func podUsageFromSeries(series []usageSeries) map[string]float64 {
+	usage := map[string]float64{}
+	for _, s := range series {
+		pod := ""
+		for _, tag := range s.TagSet {
+			if name, ok := strings.CutPrefix(tag, "pod_name:"); ok {
+				pod = name
+			}
+		}
+		var sum float64
+		var n int
+		for _, point := range s.PointList {
+			// Gaps in the series come back as null values.
+			if len(point) >= 2 && point[1] != nil {
+				sum += *point[1]
+				n++
+			}
+		}
+		if pod != "" && n > 0 {
+			usage[pod] = sum / float64(n)
+		}
+	}
+	return usage
+}
@@ -0,0 +1,40 @@
+package datadog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPodUsageFromSeries(t *testing.T) {
+	raw := `[
+		{"tag_set": ["pod_name:api-1"], "pointlist": [[1700000000000, 100], [1700000060000, null], [1700000120000, 300]]},
+		{"tag_set": ["pod_name:api-2"], "pointlist": [[1700000000000, null]]},
+		{"tag_set": [], "pointlist": [[1700000000000, 50]]}
+	]`
+	var series []usageSeries
+	if err := json.Unmarshal([]byte(raw), &series); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	usage := podUsageFromSeries(series)
+	if len(usage) != 1 || usage["api-1"] != 200 {
+		t.Fatalf("unexpected usage: %v", usage)
+	}
+}
+
+func TestQueryPodUsageFailsFastWhenBreakerOpen(t *testing.T) {
+	t.Setenv("DD_API_KEY", "api")
+	t.Setenv("DD_APP_KEY", "app")
+	host := "api.breaker-open.invalid"
+	for i := 0; i < defaultBreakerThreshold; i++ {
+		getBreaker().record(host, breakerFailure, "status 503", time.Now())
+	}
+
+	_, err := QueryPodUsage(context.Background(), PodUsageParams{Namespace: "api", Metric: "kubernetes.cpu.usage.total", Site: "breaker-open.invalid"})
+	var degraded *DegradedError
+	if !errors.As(err, &degraded) {
+		t.Fatalf("expected DegradedError without a request, got %v", err)
+	}
+}
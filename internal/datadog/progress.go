@@ -0,0 +1,50 @@
+package datadog
+
+import (
+	"context"
+	"io"
+)
+
+// DownloadProgress describes a bundle download in flight. Bytes counts the
+// current attempt; Total is the response Content-Length, or -1 when unknown
+// (including while waiting to retry).
+type DownloadProgress struct {
+	Bytes       int64
+	Total       int64
+	Retries     int
+	RetryStatus int
+}
+
+// ProgressFunc receives download progress. It is called from the goroutine
+// doing the download, so concurrent downloads call it concurrently.
+type ProgressFunc func(DownloadProgress)
+
+type progressKey struct{}
+
+// WithDownloadProgress returns a context under which profile bundle
+// downloads report their progress to fn.
+func WithDownloadProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+func downloadProgressFrom(ctx context.Context) ProgressFunc {
+	fn, _ := ctx.Value(progressKey{}).(ProgressFunc)
+	return fn
+}
+
+type progressReader struct {
+	reader  io.Reader
+	read    int64
+	total   int64
+	retries int
+	report  ProgressFunc
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.read += int64(n)
+		r.report(DownloadProgress{Bytes: r.read, Total: r.total, Retries: r.retries})
+	}
+	return n, err
+}
@@ -0,0 +1,63 @@
+package datadog
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDownloadZipReportsProgress(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Length", "4096")
+		_, _ = w.Write([]byte(strings.Repeat("x", 4096)))
+	}))
+	defer server.Close()
+
+	var events []DownloadProgress
+	ctx := WithDownloadProgress(context.Background(), func(p DownloadProgress) {
+		events = append(events, p)
+	})
+	body, err := downloadZip(ctx, server.URL, "api", "app")
+	if err != nil || len(body) != 4096 {
+		t.Fatalf("expected 4096 bytes, got %d, err %v", len(body), err)
+	}
+	if len(events) < 2 {
+		t.Fatalf("expected retry and byte events, got %+v", events)
+	}
+	if events[0].Retries != 1 || events[0].RetryStatus != http.StatusServiceUnavailable {
+		t.Fatalf("expected first event to be the retry, got %+v", events[0])
+	}
+	last := events[len(events)-1]
+	if last.Bytes != 4096 || last.Total != 4096 || last.Retries != 1 {
+		t.Fatalf("unexpected final progress: %+v", last)
+	}
+}
+
+func TestDownloadZipWithoutProgress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("zip"))
+	}))
+	defer server.Close()
+
+	body, err := downloadZip(context.Background(), server.URL, "api", "app")
+	if err != nil || string(body) != "zip" {
+		t.Fatalf("expected body, got %q, err %v", body, err)
+	}
+}
+
+func TestDownloadBundlesValidates(t *testing.T) {
+	if _, err := DownloadBundles(context.Background(), BatchDownloadParams{Service: "svc", Env: "prod", OutDir: t.TempDir()}); err == nil {
+		t.Fatalf("expected error for zero count")
+	}
+	if _, err := DownloadBundles(context.Background(), BatchDownloadParams{Service: "svc", Count: 2}); err == nil {
+		t.Fatalf("expected error for missing env/out_dir")
+	}
+}
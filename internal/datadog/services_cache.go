@@ -1,6 +1,9 @@
 package datadog
 
 import (
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -124,6 +127,27 @@ func GetCachedServices(envPrefix string) ([]ServiceInfo, bool) {
 	return services, true
 }
 
+// CachedServices returns services from the in-process cache, falling back to
+// the on-disk cache written by earlier lookups when it is at most maxAge
+// old. It never calls Datadog.
+func CachedServices(envPrefix string, maxAge time.Duration) []ServiceInfo {
+	if cached, ok := GetCachedServices(envPrefix); ok {
+		return cached
+	}
+	path := ServicesCacheFilePath()
+	if path == "" {
+		return nil
+	}
+	cached, fetchedAt, err := ReadServicesCacheFile(path)
+	if err != nil || time.Since(fetchedAt) > maxAge {
+		return nil
+	}
+	if envPrefix != "" {
+		return FilterServicesByEnvPrefix(cached, envPrefix)
+	}
+	return cached
+}
+
 // CacheServices stores services in the global cache.
 func CacheServices(services []ServiceInfo) {
 	servicesCache.Set(services)
@@ -143,3 +167,56 @@ func IsServicesCacheExpired() bool {
 func GetServicesCacheFetchedAt() time.Time {
 	return servicesCache.FetchedAt()
 }
+
+// servicesCacheFile is the on-disk form of the services cache, so short-lived
+// processes such as shell completion can reuse earlier lookups.
+type servicesCacheFile struct {
+	FetchedAt time.Time     `json:"fetched_at"`
+	Services  []ServiceInfo `json:"services"`
+}
+
+// ServicesCacheFilePath returns where discovered services are persisted:
+// PPROF_MCP_SERVICES_CACHE, else the user cache dir. Empty if neither is known.
+func ServicesCacheFilePath() string {
+	if path := strings.TrimSpace(os.Getenv("PPROF_MCP_SERVICES_CACHE")); path != "" {
+		return path
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "pprof-mcp", "services.json")
+}
+
+// WriteServicesCacheFile persists services to path. An empty path is a no-op.
+func WriteServicesCacheFile(path string, services []ServiceInfo) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(servicesCacheFile{FetchedAt: time.Now().UTC(), Services: services}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ReadServicesCacheFile loads services written by WriteServicesCacheFile and
+// when they were fetched.
+func ReadServicesCacheFile(path string) ([]ServiceInfo, time.Time, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var file servicesCacheFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, time.Time{}, err
+	}
+	return file.Services, file.FetchedAt, nil
+}
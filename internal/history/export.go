@@ -0,0 +1,176 @@
+package history
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ExportFile is one file copied into an export archive.
+type ExportFile struct {
+	Path    string `json:"path"`
+	Archive string `json:"archive"`
+	Role    string `json:"role"` // input or output
+	Bytes   int64  `json:"bytes"`
+}
+
+// Manifest describes an export archive; it is stored as manifest.json.
+type Manifest struct {
+	Session   string       `json:"session"`
+	CreatedAt time.Time    `json:"created_at"`
+	Entries   []Entry      `json:"entries"`
+	Files     []ExportFile `json:"files"`
+	Missing   []string     `json:"missing,omitempty"`
+	Bytes     int64        `json:"bytes"`
+}
+
+// PlanExport lists the files a session read and wrote. resolve maps inputs
+// that are not plain paths (profile handles) to files; it may be nil.
+// Files that no longer exist are reported in Missing.
+func PlanExport(session string, entries []Entry, resolve func(string) (string, bool)) Manifest {
+	manifest := Manifest{Session: session, CreatedAt: time.Now().UTC(), Entries: entries}
+	seen := map[string]bool{}
+	add := func(file, role string) {
+		if resolve != nil {
+			if resolved, ok := resolve(file); ok {
+				file = resolved
+			}
+		}
+		if seen[file] {
+			return
+		}
+		seen[file] = true
+		info, err := os.Stat(file)
+		if err != nil || !info.Mode().IsRegular() {
+			manifest.Missing = append(manifest.Missing, file)
+			return
+		}
+		manifest.Files = append(manifest.Files, ExportFile{Path: file, Archive: archiveName(file), Role: role, Bytes: info.Size()})
+		manifest.Bytes += info.Size()
+	}
+	for _, entry := range entries {
+		for _, input := range entry.Inputs {
+			add(input, "input")
+		}
+		for _, output := range entry.Outputs {
+			add(output, "output")
+		}
+	}
+	return manifest
+}
+
+// archiveName keeps a file's absolute path under files/, so files with the
+// same base name from different bundles do not collide.
+func archiveName(file string) string {
+	file = filepath.ToSlash(strings.TrimPrefix(file, filepath.VolumeName(file)))
+	return path.Join("files", strings.TrimLeft(file, "/"))
+}
+
+// WriteExport writes the archive: manifest.json, README.md, commands.sh, and
+// the manifest's files.
+func WriteExport(w io.Writer, manifest Manifest) error {
+	archive := zip.NewWriter(w)
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	for _, doc := range []struct {
+		name string
+		body []byte
+	}{
+		{"manifest.json", append(data, '\n')},
+		{"README.md", []byte(exportReadme(manifest))},
+		{"commands.sh", []byte(exportCommands(manifest))},
+	} {
+		out, err := archive.CreateHeader(&zip.FileHeader{Name: doc.name, Method: zip.Deflate, Modified: manifest.CreatedAt})
+		if err != nil {
+			return err
+		}
+		if _, err := out.Write(doc.body); err != nil {
+			return err
+		}
+	}
+	for _, file := range manifest.Files {
+		if err := copyIntoArchive(archive, file); err != nil {
+			return fmt.Errorf("%s: %w", file.Path, err)
+		}
+	}
+	return archive.Close()
+}
+
+func copyIntoArchive(archive *zip.Writer, file ExportFile) error {
+	in, err := os.Open(file.Path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	header := &zip.FileHeader{Name: file.Archive, Method: zip.Deflate}
+	if info, err := in.Stat(); err == nil {
+		header.Modified = info.ModTime()
+	}
+	out, err := archive.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	return err
+}
+
+func exportReadme(manifest Manifest) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Investigation %s\n\n", manifest.Session)
+	if len(manifest.Entries) > 0 {
+		first, last := manifest.Entries[0].Time, manifest.Entries[len(manifest.Entries)-1].Time
+		fmt.Fprintf(&b, "%d commands, %s to %s.\n\n", len(manifest.Entries), first.Format(time.RFC3339), last.Format(time.RFC3339))
+	}
+	b.WriteString("## Commands\n\n")
+	for _, entry := range manifest.Entries {
+		status := ""
+		if entry.Error != "" {
+			status = " (failed: " + entry.Error + ")"
+		}
+		fmt.Fprintf(&b, "- `%s` `profctl %s`%s\n", entry.ID, strings.Join(entry.Args, " "), status)
+	}
+	b.WriteString("\n## Files\n\n")
+	for _, file := range manifest.Files {
+		fmt.Fprintf(&b, "- %s `%s` (from `%s`)\n", file.Role, file.Archive, file.Path)
+	}
+	for _, missing := range manifest.Missing {
+		fmt.Fprintf(&b, "- missing `%s`\n", missing)
+	}
+	return b.String()
+}
+
+func exportCommands(manifest Manifest) string {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n# Commands recorded in this session, in order. Paths refer to the\n# original machine; the files themselves are under files/.\n")
+	dir := ""
+	for _, entry := range manifest.Entries {
+		if entry.Dir != "" && entry.Dir != dir {
+			dir = entry.Dir
+			fmt.Fprintf(&b, "\ncd %s\n", shellQuote(dir))
+		}
+		quoted := make([]string, 0, len(entry.Args))
+		for _, arg := range entry.Args {
+			quoted = append(quoted, shellQuote(arg))
+		}
+		fmt.Fprintf(&b, "profctl %s\n", strings.Join(quoted, " "))
+	}
+	return b.String()
+}
+
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if strings.ContainsAny(s, " \t\n\"'\\$&;|<>[]{}()*?`") {
+		return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+	}
+	return s
+}
@@ -0,0 +1,211 @@
+// Package history keeps a local log of profctl invocations so an engineer
+// can retrace what was downloaded and compared during an incident.
+package history
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Entry is one recorded invocation.
+type Entry struct {
+	ID         string    `json:"id"`
+	Session    string    `json:"session,omitempty"`
+	Time       time.Time `json:"time"`
+	Args       []string  `json:"args"`
+	Dir        string    `json:"dir,omitempty"`
+	Inputs     []string  `json:"inputs,omitempty"`
+	Outputs    []string  `json:"outputs,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// SessionGap is the idle time after which invocations in the same directory
+// start a new session.
+const SessionGap = time.Hour
+
+// Path returns the history file: PPROF_MCP_HISTORY when set, else
+// pprof-mcp/history.jsonl under the user cache directory. "off" disables
+// recording.
+func Path() string {
+	if file := strings.TrimSpace(os.Getenv("PPROF_MCP_HISTORY")); file != "" {
+		if file == "off" {
+			return ""
+		}
+		return file
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "pprof-mcp", "history.jsonl")
+}
+
+// Append adds entry to the history file, assigning an ID and time when unset.
+// Without a session (PPROF_MCP_SESSION, or set by the caller) the entry joins
+// the previous entry's session when that ran in the same directory less than
+// SessionGap ago, and otherwise starts one named after its own ID.
+func Append(path string, entry Entry) (Entry, error) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	if entry.ID == "" {
+		id, err := newID(entry.Time)
+		if err != nil {
+			return Entry{}, err
+		}
+		entry.ID = id
+	}
+	if entry.Session == "" {
+		entry.Session = strings.TrimSpace(os.Getenv("PPROF_MCP_SESSION"))
+	}
+	if entry.Session == "" {
+		entry.Session = entry.ID
+		if entries, err := List(path); err == nil && len(entries) > 0 {
+			last := entries[0]
+			if last.Session != "" && last.Dir == entry.Dir && entry.Time.Sub(last.Time) < SessionGap {
+				entry.Session = last.Session
+			}
+		}
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return Entry{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return Entry{}, err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return Entry{}, err
+	}
+	// One write per entry keeps concurrent appends from interleaving.
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return Entry{}, err
+	}
+	return entry, file.Close()
+}
+
+// List returns entries newest first. A missing file is an empty history;
+// lines that do not parse are skipped.
+func List(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.ID == "" {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+// Find returns the entry whose ID starts with id.
+func Find(path, id string) (Entry, error) {
+	entries, err := List(path)
+	if err != nil {
+		return Entry{}, err
+	}
+	var matches []Entry
+	for _, entry := range entries {
+		if entry.ID == id {
+			return entry, nil
+		}
+		if strings.HasPrefix(entry.ID, id) {
+			matches = append(matches, entry)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return Entry{}, fmt.Errorf("no history entry %q", id)
+	case 1:
+		return matches[0], nil
+	default:
+		return Entry{}, fmt.Errorf("history id %q is ambiguous (%d matches)", id, len(matches))
+	}
+}
+
+// Session returns a session's entries, oldest first. id is a session name or
+// the ID (or unique prefix) of any entry in it; empty selects the most
+// recent session.
+func Session(path, id string) (string, []Entry, error) {
+	entries, err := List(path)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(entries) == 0 {
+		return "", nil, errors.New("history is empty")
+	}
+	session := ""
+	switch {
+	case id == "":
+		session = entries[0].Session
+	default:
+		for _, entry := range entries {
+			if entry.Session == id {
+				session = id
+				break
+			}
+		}
+		if session == "" {
+			entry, err := Find(path, id)
+			if err != nil {
+				return "", nil, fmt.Errorf("no session or history entry %q", id)
+			}
+			session = entry.Session
+		}
+	}
+
+	var selected []Entry
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Session == session {
+			selected = append(selected, entries[i])
+		}
+	}
+	return session, selected, nil
+}
+
+// Touches reports whether the entry read or wrote a path containing substr.
+func (e Entry) Touches(substr string) bool {
+	for _, path := range append(append([]string{}, e.Inputs...), e.Outputs...) {
+		if strings.Contains(path, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func newID(t time.Time) (string, error) {
+	buf := make([]byte, 2)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return t.UTC().Format("20060102-150405") + "-" + hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,127 @@
+package history
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppendListFind(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+
+	first, err := Append(path, Entry{
+		Time:    time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Args:    []string{"download", "--service", "api"},
+		Outputs: []string{"/tmp/profiles/api_prod_cpu.pprof"},
+	})
+	require.NoError(t, err)
+	require.Contains(t, first.ID, "20260102-030405-")
+
+	second, err := Append(path, Entry{Args: []string{"pprof", "diff_top"}, Inputs: []string{"/tmp/a.pprof", "/tmp/b.pprof"}})
+	require.NoError(t, err)
+
+	entries, err := List(path)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, second.ID, entries[0].ID)
+
+	found, err := Find(path, first.ID[:18])
+	require.NoError(t, err)
+	require.Equal(t, first.Args, found.Args)
+
+	_, err = Find(path, "1999")
+	require.Error(t, err)
+
+	require.True(t, entries[0].Touches("b.pprof"))
+	require.False(t, entries[0].Touches("api_prod"))
+}
+
+func TestListSkipsBadLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("not json\n{\"id\":\"x\",\"args\":[\"top\"]}\n"), 0o644))
+
+	entries, err := List(path)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	missing, err := List(filepath.Join(t.TempDir(), "missing.jsonl"))
+	require.NoError(t, err)
+	require.Empty(t, missing)
+}
+
+func TestSessions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	t.Setenv("PPROF_MCP_SESSION", "")
+	start := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	first, err := Append(path, Entry{Time: start, Dir: "/incident", Args: []string{"download"}})
+	require.NoError(t, err)
+	require.Equal(t, first.ID, first.Session)
+	second, err := Append(path, Entry{Time: start.Add(10 * time.Minute), Dir: "/incident", Args: []string{"pprof", "top"}})
+	require.NoError(t, err)
+	require.Equal(t, first.Session, second.Session)
+	other, err := Append(path, Entry{Time: start.Add(20 * time.Minute), Dir: "/elsewhere", Args: []string{"pprof", "top"}})
+	require.NoError(t, err)
+	require.NotEqual(t, first.Session, other.Session)
+
+	t.Setenv("PPROF_MCP_SESSION", "inc-42")
+	named, err := Append(path, Entry{Time: start.Add(30 * time.Minute), Dir: "/incident", Args: []string{"pprof", "diff_top"}})
+	require.NoError(t, err)
+	require.Equal(t, "inc-42", named.Session)
+
+	session, entries, err := Session(path, second.ID)
+	require.NoError(t, err)
+	require.Equal(t, first.Session, session)
+	require.Len(t, entries, 2)
+	require.Equal(t, first.ID, entries[0].ID)
+
+	session, entries, err = Session(path, "")
+	require.NoError(t, err)
+	require.Equal(t, "inc-42", session)
+	require.Len(t, entries, 1)
+
+	_, _, err = Session(path, "nope")
+	require.Error(t, err)
+}
+
+func TestExport(t *testing.T) {
+	dir := t.TempDir()
+	profile := filepath.Join(dir, "cpu.pprof")
+	svg := filepath.Join(dir, "cpu.flame.svg")
+	require.NoError(t, os.WriteFile(profile, []byte("profile"), 0o644))
+	require.NoError(t, os.WriteFile(svg, []byte("<svg/>"), 0o644))
+
+	entries := []Entry{
+		{ID: "a", Dir: dir, Args: []string{"pprof", "top", "--profile", "handle:abc"}, Inputs: []string{"handle:abc"}},
+		{ID: "b", Dir: dir, Args: []string{"pprof", "flame", "--profile", profile}, Inputs: []string{profile}, Outputs: []string{svg, filepath.Join(dir, "gone.svg")}},
+	}
+	resolve := func(input string) (string, bool) {
+		if input == "handle:abc" {
+			return profile, true
+		}
+		return "", false
+	}
+	manifest := PlanExport("s1", entries, resolve)
+	require.Len(t, manifest.Files, 2)
+	require.Equal(t, "input", manifest.Files[0].Role)
+	require.Equal(t, []string{filepath.Join(dir, "gone.svg")}, manifest.Missing)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteExport(&buf, manifest))
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	names := map[string]bool{}
+	for _, file := range reader.File {
+		names[file.Name] = true
+	}
+	require.True(t, names["manifest.json"])
+	require.True(t, names["commands.sh"])
+	require.True(t, names[manifest.Files[1].Archive])
+	require.True(t, strings.HasPrefix(manifest.Files[1].Archive, "files/"))
+}
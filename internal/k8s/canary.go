@@ -0,0 +1,161 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/google/pprof/profile"
+)
+
+// Default pod labels telling canary pods from stable ones; the stable
+// selector matches pods without a track label too.
+const (
+	DefaultCanarySelector = "track=canary"
+	DefaultStableSelector = "track!=canary"
+)
+
+// canaryWorsePct is the CPU-per-pod increase at which a canary is called
+// worse than stable
+const canaryWorsePct = 10.0
+
+// CanaryParams captures a service's canary and stable pods at once.
+// CaptureParams.Selector selects the service's pods, e.g. app=api, and
+// Canary and Stable narrow it to each group; MaxPods applies per group.
+type CanaryParams struct {
+	CaptureParams
+	Canary string // default: DefaultCanarySelector
+	Stable string // default: DefaultStableSelector
+}
+
+// CanaryResult is a comparison of canary pods against stable ones, stable
+// first, with a CPU-per-pod verdict
+type CanaryResult struct {
+	CompareResult
+	Verdict *CanaryVerdict `json:"verdict,omitempty"`
+}
+
+// CanaryVerdict compares CPU seconds per captured pod over the same
+// window, which holds up when the groups have different pod counts
+type CanaryVerdict struct {
+	StableCPUSecondsPerPod float64 `json:"stable_cpu_seconds_per_pod"`
+	CanaryCPUSecondsPerPod float64 `json:"canary_cpu_seconds_per_pod"`
+	ChangePct              float64 `json:"change_pct"`
+	Worse                  bool    `json:"worse"`
+	Summary                string  `json:"summary"`
+}
+
+// CompareCanary captures params' canary and stable pods concurrently,
+// merges each group, and diffs canary against stable as CompareClusters
+// does. The verdict compares their CPU per pod, so a canary serving less
+// traffic is judged on its per-request cost only as far as load is even.
+func CompareCanary(ctx context.Context, params CanaryParams) (CanaryResult, error) {
+	compare, err := canaryCompare(params)
+	if err != nil {
+		return CanaryResult{}, err
+	}
+	result, err := CompareClusters(ctx, compare)
+	canary := CanaryResult{CompareResult: result}
+	if err != nil {
+		return canary, err
+	}
+	verdict, err := canaryVerdict(result.Clusters[0].Capture, result.Clusters[1].Capture)
+	if err != nil {
+		canary.Warnings = append(canary.Warnings, fmt.Sprintf("no verdict: %v", err))
+		return canary, nil
+	}
+	canary.Verdict = verdict
+	return canary, nil
+}
+
+// CanaryCommands returns the commands CompareCanary runs, stable first
+func CanaryCommands(params CanaryParams) ([]string, error) {
+	compare, err := canaryCompare(params)
+	if err != nil {
+		return nil, err
+	}
+	return CompareCommands(compare)
+}
+
+// canaryCompare turns params into a comparison of stable (the baseline)
+// against canary in one namespace
+func canaryCompare(params CanaryParams) (CompareParams, error) {
+	if params.Selector == "" {
+		return CompareParams{}, errors.New("selector is required: the label selector of the service's canary and stable pods, e.g. app=api")
+	}
+	canary := firstNonEmpty(params.Canary, DefaultCanarySelector)
+	stable := firstNonEmpty(params.Stable, DefaultStableSelector)
+	if canary == stable {
+		return CompareParams{}, errors.New("canary and stable selectors must differ")
+	}
+	return CompareParams{
+		CaptureParams: params.CaptureParams,
+		Clusters: [2]ClusterTarget{
+			{KubeContext: params.KubeContext, Selector: stable, Label: "stable"},
+			{KubeContext: params.KubeContext, Selector: canary, Label: "canary"},
+		},
+	}, nil
+}
+
+// canaryVerdict compares the merged CPU profiles of both groups per pod
+func canaryVerdict(stable, canary CaptureResult) (*CanaryVerdict, error) {
+	var perPod [2]float64
+	for i, capture := range []CaptureResult{stable, canary} {
+		var fleet *FleetProfile
+		for j := range capture.Fleet {
+			if capture.Fleet[j].Type == "cpu" {
+				fleet = &capture.Fleet[j]
+			}
+		}
+		if fleet == nil || fleet.Pods == 0 {
+			return nil, errors.New("cpu profile missing on one side")
+		}
+		seconds, err := cpuSeconds(fleet.Path)
+		if err != nil {
+			return nil, err
+		}
+		perPod[i] = seconds / float64(fleet.Pods)
+	}
+	verdict := &CanaryVerdict{StableCPUSecondsPerPod: perPod[0], CanaryCPUSecondsPerPod: perPod[1]}
+	if perPod[0] > 0 {
+		verdict.ChangePct = (perPod[1] - perPod[0]) / perPod[0] * 100
+	}
+	verdict.Worse = verdict.ChangePct >= canaryWorsePct
+	switch {
+	case verdict.Worse:
+		verdict.Summary = fmt.Sprintf("canary uses %.0f%% more CPU per pod than stable; see diffs for where", verdict.ChangePct)
+	case verdict.ChangePct <= -canaryWorsePct:
+		verdict.Summary = fmt.Sprintf("canary uses %.0f%% less CPU per pod than stable", -verdict.ChangePct)
+	default:
+		verdict.Summary = fmt.Sprintf("canary CPU per pod is within %.0f%% of stable (%+.1f%%)", canaryWorsePct, verdict.ChangePct)
+	}
+	return verdict, nil
+}
+
+// cpuSeconds totals a CPU profile's samples
+func cpuSeconds(path string) (float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	prof, err := profile.Parse(f)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for i, st := range prof.SampleType {
+		if st.Type != "cpu" {
+			continue
+		}
+		var total int64
+		for _, sample := range prof.Sample {
+			total += sample.Value[i]
+		}
+		if st.Unit == "nanoseconds" {
+			return float64(total) / 1e9, nil
+		}
+		return float64(total), nil
+	}
+	return 0, fmt.Errorf("%s has no cpu samples", path)
+}
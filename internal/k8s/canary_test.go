@@ -0,0 +1,73 @@
+package k8s
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanaryCommands(t *testing.T) {
+	commands, err := CanaryCommands(CanaryParams{
+		CaptureParams: CaptureParams{Namespace: "prod", Selector: "app=api", OutDir: "out", Types: []string{"cpu"}, SkipCgroup: true},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"kubectl get pods -n prod -l app=api,track!=canary -o json",
+		"kubectl port-forward -n prod <pod> <local-port>:<port>",
+		"curl -sf -o out/stable/<pod>/api_prod_cpu.pprof 'http://127.0.0.1:<local-port>/debug/pprof/profile?seconds=30'",
+		"go tool pprof -proto -output out/stable/fleet/api_prod_cpu.pprof out/stable/*/api_prod_cpu.pprof",
+		"kubectl get pods -n prod -l app=api,track=canary -o json",
+		"kubectl port-forward -n prod <pod> <local-port>:<port>",
+		"curl -sf -o out/canary/<pod>/api_prod_cpu.pprof 'http://127.0.0.1:<local-port>/debug/pprof/profile?seconds=30'",
+		"go tool pprof -proto -output out/canary/fleet/api_prod_cpu.pprof out/canary/*/api_prod_cpu.pprof",
+		"go tool pprof -top -diff_base out/stable/fleet/api_prod_cpu.pprof out/canary/fleet/api_prod_cpu.pprof",
+	}, commands)
+
+	_, err = CanaryCommands(CanaryParams{CaptureParams: CaptureParams{Workload: "deployment/api", OutDir: "out"}})
+	require.ErrorContains(t, err, "selector is required")
+	_, err = CanaryCommands(CanaryParams{CaptureParams: CaptureParams{Selector: "app=api", OutDir: "out"}, Canary: "track=canary", Stable: "track=canary"})
+	require.ErrorContains(t, err, "must differ")
+}
+
+func TestCanaryVerdict(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, nanos int64) string {
+		path := filepath.Join(dir, name)
+		fn := &profile.Function{ID: 1, Name: "main.work"}
+		loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+		prof := &profile.Profile{
+			SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+			PeriodType: &profile.ValueType{Type: "cpu", Unit: "nanoseconds"},
+			Period:     1,
+			Sample:     []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{1, nanos}}},
+			Location:   []*profile.Location{loc},
+			Function:   []*profile.Function{fn},
+		}
+		file, err := os.Create(path)
+		require.NoError(t, err)
+		require.NoError(t, prof.Write(file))
+		require.NoError(t, file.Close())
+		return path
+	}
+	// Four stable pods used 8s in all; the single canary pod used 2.5s.
+	stable := CaptureResult{Fleet: []FleetProfile{{Type: "cpu", Path: write("stable.pprof", 8e9), Pods: 4}}}
+	canary := CaptureResult{Fleet: []FleetProfile{{Type: "cpu", Path: write("canary.pprof", 2.5e9), Pods: 1}}}
+	verdict, err := canaryVerdict(stable, canary)
+	require.NoError(t, err)
+	require.Equal(t, 2.0, verdict.StableCPUSecondsPerPod)
+	require.Equal(t, 2.5, verdict.CanaryCPUSecondsPerPod)
+	require.Equal(t, 25.0, verdict.ChangePct)
+	require.True(t, verdict.Worse)
+	require.Equal(t, "canary uses 25% more CPU per pod than stable; see diffs for where", verdict.Summary)
+
+	verdict, err = canaryVerdict(stable, CaptureResult{Fleet: []FleetProfile{{Type: "cpu", Path: write("even.pprof", 2.1e9), Pods: 1}}})
+	require.NoError(t, err)
+	require.False(t, verdict.Worse)
+	require.Equal(t, "canary CPU per pod is within 10% of stable (+5.0%)", verdict.Summary)
+
+	_, err = canaryVerdict(stable, CaptureResult{})
+	require.ErrorContains(t, err, "cpu profile missing")
+}
@@ -0,0 +1,570 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/datadog"
+)
+
+const (
+	defaultPort     = 6060
+	defaultSeconds  = 30
+	defaultMaxPods  = 5
+	defaultParallel = 4
+)
+
+// Endpoint is one net/http/pprof profile fetched from each pod. Filenames
+// match the Datadog bundle so downstream tools see the same layout.
+type Endpoint struct {
+	Type     string
+	Path     string
+	Filename string
+}
+
+var endpoints = []Endpoint{
+	{Type: "cpu", Path: "/debug/pprof/profile", Filename: "cpu.pprof"},
+	{Type: "heap", Path: "/debug/pprof/heap", Filename: "heap.pprof"},
+	{Type: "goroutines", Path: "/debug/pprof/goroutine", Filename: "goroutines.pprof"},
+	{Type: "mutex", Path: "/debug/pprof/mutex", Filename: "mutex.pprof"},
+	{Type: "block", Path: "/debug/pprof/block", Filename: "block.pprof"},
+	{Type: "allocs", Path: "/debug/pprof/allocs", Filename: "allocs.pprof"},
+	{Type: "threadcreate", Path: "/debug/pprof/threadcreate", Filename: "threadcreate.pprof"},
+}
+
+// DefaultTypes lists the profile types captured when none are requested
+func DefaultTypes() []string {
+	types := make([]string, 0, len(endpoints))
+	for _, ep := range endpoints {
+		types = append(types, ep.Type)
+	}
+	return types
+}
+
+type CaptureParams struct {
+	KubeContext string // kubectl context; "" uses the current one
+	Namespace   string
+	Selector    string // label selector, e.g. app=foo
+	Workload    string // kind/name, e.g. deployment/foo; used when Selector is empty
+	Port        int    // pprof port inside the pod; 0 discovers it per pod (see DiscoverPort)
+	OutDir      string // each pod's bundle goes to OutDir/<pod>
+	Service     string // bundle file prefix; defaults to the selector's app label
+	Seconds     int    // CPU profile duration (default 30)
+	Types       []string
+	MaxPods     int  // cap on matching pods (default 5)
+	All         bool // capture every matching pod, ignoring MaxPods
+	// Strategy orders matching pods before the MaxPods cap: first, cpu,
+	// memory, oldest, or random (see Strategies).
+	Strategy string
+	Node     string      // only pods scheduled on this node
+	Usage    UsageSource // cpu/memory figures; nil uses metrics-server
+	Parallel int         // pods captured at once (default 4)
+	// PodTimeout bounds each pod's port-forward and downloads so one stuck
+	// pod cannot hold up the fleet (default: Seconds plus one minute).
+	PodTimeout time.Duration
+	// Merge combines each profile type across pods into a fleet profile
+	// under OutDir/fleet, with each pod's contribution.
+	Merge bool
+	// Rates turns on mutex and block profiling for the capture through the
+	// pod's rate endpoint and restores the previous rates afterwards.
+	Rates Rates
+	// SkipCgroup leaves out the CPU throttling and memory stats read from
+	// each pod's cgroup with kubectl exec (see CgroupStats).
+	SkipCgroup bool
+	// RepoPort is the pprof port the service's repository declares in its
+	// Dockerfile, manifests, or Helm values, used for pods whose spec
+	// declares none before falling back to 6060; RepoPortSource says where.
+	RepoPort       int
+	RepoPortSource string
+}
+
+// PodBundle is one pod's profiles in the Datadog bundle shape.
+type PodBundle struct {
+	Pod        string       `json:"pod"`
+	Port       int          `json:"port"`
+	PortSource string       `json:"port_source"`
+	Cgroup     *CgroupStats `json:"cgroup,omitempty"`
+	datadog.DownloadResult
+}
+
+type PodFailure struct {
+	Pod   string `json:"pod"`
+	Error string `json:"error"`
+}
+
+// Pod capture outcomes reported in PodStatus.Status.
+const (
+	PodCaptured = "ok"      // every requested profile was fetched
+	PodPartial  = "partial" // some profiles failed; see Warnings
+	PodFailed   = "failed"  // nothing was fetched; see Error
+	PodSkipped  = "skipped" // the capture was cancelled before the pod's turn
+)
+
+// PodStatus is one pod's outcome, in pod order, whether or not it succeeded.
+type PodStatus struct {
+	Pod        string       `json:"pod"`
+	Status     string       `json:"status"`
+	Profiles   int          `json:"profiles"`
+	Port       int          `json:"port,omitempty"`
+	PortSource string       `json:"port_source,omitempty"` // explicit, or where DiscoverPort found it
+	DurationMS int64        `json:"duration_ms"`
+	Cgroup     *CgroupStats `json:"cgroup,omitempty"`
+	Error      string       `json:"error,omitempty"`
+	Warnings   []string     `json:"warnings,omitempty"`
+}
+
+type CaptureResult struct {
+	KubeContext string         `json:"kube_context,omitempty"`
+	Namespace   string         `json:"namespace"`
+	Workload    string         `json:"workload,omitempty"`
+	Selector    string         `json:"selector"`
+	Port        int            `json:"port,omitempty"` // 0 when discovered per pod
+	Selection   Selection      `json:"selection"`
+	Pods        []PodStatus    `json:"pods"`
+	Bundles     []PodBundle    `json:"bundles"`
+	Fleet       []FleetProfile `json:"fleet,omitempty"`
+	Failed      []PodFailure   `json:"failed,omitempty"`
+	Warnings    []string       `json:"warnings,omitempty"`
+}
+
+// Capture port-forwards to each running pod matching the selector and pulls
+// its profiles, at most Parallel pods at a time. Every pod's outcome is
+// reported in Pods and failures are also listed in Failed; an error is
+// returned only when no pod could be captured.
+func Capture(ctx context.Context, params CaptureParams) (CaptureResult, error) {
+	params, selected, err := normalizeCapture(params)
+	if err != nil {
+		return CaptureResult{}, err
+	}
+	if params.Selector == "" {
+		params.Selector, err = ResolveWorkloadSelector(ctx, params.KubeContext, params.Namespace, params.Workload)
+		if err != nil {
+			return CaptureResult{KubeContext: params.KubeContext, Namespace: params.Namespace, Workload: params.Workload}, err
+		}
+	}
+	result := CaptureResult{KubeContext: params.KubeContext, Namespace: params.Namespace, Workload: params.Workload, Selector: params.Selector, Port: params.Port}
+
+	pods, err := ListPods(ctx, params.KubeContext, params.Namespace, params.Selector)
+	if err != nil {
+		return result, err
+	}
+	running, selection, err := SelectPods(ctx, params, pods)
+	result.Selection = selection
+	if err != nil {
+		return result, err
+	}
+	if len(running) < selection.Matched {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("%d pods match; capturing %d by %s (raise max_pods or set all for more)", selection.Matched, len(running), params.Strategy))
+	}
+
+	result.Pods, result.Bundles, result.Failed = captureFleet(ctx, running, params.Parallel, params.PodTimeout, func(ctx context.Context, pod PodInfo) (PodBundle, error) {
+		return capturePod(ctx, params, selected, pod)
+	})
+	result.Warnings = append(result.Warnings, throttleWarnings(result.Pods)...)
+	if len(result.Bundles) == 0 {
+		if len(result.Failed) == 0 {
+			return result, ctx.Err()
+		}
+		return result, fmt.Errorf("all %d pod captures failed; first error: %s", len(result.Failed), result.Failed[0].Error)
+	}
+	if params.Merge {
+		fleet, warnings := mergeFleet(ctx, params, selected, result.Bundles)
+		result.Fleet = fleet
+		result.Warnings = append(result.Warnings, warnings...)
+	}
+	return result, nil
+}
+
+func normalizeCapture(params CaptureParams) (CaptureParams, []Endpoint, error) {
+	if params.Namespace == "" {
+		params.Namespace = "default"
+	}
+	if params.Selector == "" && params.Workload == "" {
+		return params, nil, errors.New("selector or workload is required")
+	}
+	if params.OutDir == "" {
+		return params, nil, errors.New("out_dir is required")
+	}
+	if params.Seconds <= 0 {
+		params.Seconds = defaultSeconds
+	}
+	if params.MaxPods <= 0 {
+		params.MaxPods = defaultMaxPods
+	}
+	if params.Parallel <= 0 {
+		params.Parallel = defaultParallel
+	}
+	strategy, err := normalizeStrategy(params.Strategy)
+	if err != nil {
+		return params, nil, err
+	}
+	params.Strategy = strategy
+	if params.PodTimeout <= 0 {
+		params.PodTimeout = time.Duration(params.Seconds)*time.Second + time.Minute
+	}
+	if params.Service == "" && params.Selector == "" {
+		params.Service = WorkloadName(params.Workload)
+	}
+	if params.Service == "" {
+		params.Service = ServiceFromSelector(params.Selector, params.Namespace)
+	}
+	selected, err := selectEndpoints(params.Types)
+	if err != nil {
+		return params, nil, err
+	}
+	return params, selected, nil
+}
+
+// ServiceFromSelector names bundles after the selector's app label, falling
+// back to the namespace.
+func ServiceFromSelector(selector, fallback string) string {
+	for _, term := range strings.Split(selector, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(term), "=")
+		if !ok {
+			continue
+		}
+		// "app==foo" is the same selector as "app=foo".
+		value = strings.TrimPrefix(value, "=")
+		switch strings.TrimSpace(key) {
+		case "app", "app.kubernetes.io/name", "k8s-app":
+			return strings.TrimSpace(value)
+		}
+	}
+	return fallback
+}
+
+func selectEndpoints(types []string) ([]Endpoint, error) {
+	if len(types) == 0 {
+		return endpoints, nil
+	}
+	var selected []Endpoint
+	for _, name := range types {
+		found := false
+		for _, ep := range endpoints {
+			if ep.Type == name || (name == "goroutine" && ep.Type == "goroutines") {
+				selected = append(selected, ep)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown profile type %q (want %s)", name, strings.Join(DefaultTypes(), ", "))
+		}
+	}
+	return selected, nil
+}
+
+// captureFleet runs capture for each pod with at most parallel in flight,
+// each under its own timeout. A failing pod never stops the others; once ctx
+// is cancelled, pods still waiting for a slot are reported as skipped.
+func captureFleet(ctx context.Context, pods []PodInfo, parallel int, timeout time.Duration, capture func(context.Context, PodInfo) (PodBundle, error)) ([]PodStatus, []PodBundle, []PodFailure) {
+	statuses := make([]PodStatus, len(pods))
+	bundles := make([]*PodBundle, len(pods))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, pod := range pods {
+		wg.Add(1)
+		go func(idx int, pod PodInfo) {
+			defer wg.Done()
+			statuses[idx] = PodStatus{Pod: pod.Name, Status: PodSkipped}
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				statuses[idx].Error = ctx.Err().Error()
+				return
+			}
+			defer func() { <-sem }()
+			if ctx.Err() != nil {
+				statuses[idx].Error = ctx.Err().Error()
+				return
+			}
+
+			podCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			start := time.Now()
+			bundle, err := capture(podCtx, pod)
+			status := &statuses[idx]
+			status.DurationMS = time.Since(start).Milliseconds()
+			status.Profiles = len(bundle.Files)
+			status.Port, status.PortSource = bundle.Port, bundle.PortSource
+			status.Cgroup = bundle.Cgroup
+			status.Warnings = bundle.Warnings
+			switch {
+			case err != nil && errors.Is(podCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil:
+				status.Status, status.Error = PodFailed, fmt.Sprintf("timed out after %s: %v", timeout, err)
+			case err != nil:
+				status.Status, status.Error = PodFailed, err.Error()
+			case len(bundle.Warnings) > 0:
+				status.Status = PodPartial
+				bundles[idx] = &bundle
+			default:
+				status.Status = PodCaptured
+				bundles[idx] = &bundle
+			}
+		}(i, pod)
+	}
+	wg.Wait()
+
+	var captured []PodBundle
+	var failed []PodFailure
+	for i, status := range statuses {
+		if bundles[i] != nil {
+			captured = append(captured, *bundles[i])
+		}
+		if status.Status == PodFailed {
+			failed = append(failed, PodFailure{Pod: status.Pod, Error: status.Error})
+		}
+	}
+	return statuses, captured, failed
+}
+
+func capturePod(ctx context.Context, params CaptureParams, selected []Endpoint, pod PodInfo) (PodBundle, error) {
+	bundle := PodBundle{
+		Pod:        pod.Name,
+		Port:       params.Port,
+		PortSource: "explicit",
+		DownloadResult: datadog.DownloadResult{
+			Service:   params.Service,
+			Env:       params.Namespace,
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Files:     []datadog.ProfileFile{},
+		},
+	}
+	if bundle.Port <= 0 {
+		bundle.Port, bundle.PortSource = DiscoverPort(pod)
+		if bundle.PortSource == "default" && params.RepoPort > 0 {
+			bundle.Port, bundle.PortSource = params.RepoPort, "repo "+params.RepoPortSource
+		}
+	}
+	pf, fallback, err := startPodForward(ctx, &pod, bundle.Port)
+	if err != nil {
+		return bundle, fmt.Errorf("port %d (%s): %w", bundle.Port, bundle.PortSource, err)
+	}
+	defer pf.Stop()
+	if fallback != "" {
+		bundle.Warnings = append(bundle.Warnings, fallback)
+	}
+
+	outDir := filepath.Join(params.OutDir, pod.Name)
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return bundle, err
+	}
+	cgroup := startCgroup(ctx, params, pod, bundle.Port)
+	var restore func() error
+	if params.Rates.Enabled() {
+		// Without the rate endpoint the profiles still come back, at the
+		// service's own rates.
+		var err error
+		if restore, err = ApplyRates(ctx, pf.HTTPClient(), pf.URL(""), nil, params.Rates); err != nil {
+			bundle.Warnings = append(bundle.Warnings, err.Error())
+		} else if err := awaitRates(ctx, selected, params.Seconds); err != nil {
+			bundle.Warnings = append(bundle.Warnings, restoreRates(restore)...)
+			return bundle, err
+		}
+	}
+	for _, ep := range selected {
+		dest := filepath.Join(outDir, fmt.Sprintf("%s_%s_%s", params.Service, params.Namespace, ep.Filename))
+		bytes, err := fetchProfile(ctx, pf.HTTPClient(), pf.URL(endpointURL(ep, params.Seconds)), dest)
+		if err != nil {
+			bundle.Warnings = append(bundle.Warnings, fmt.Sprintf("%s profile: %v", ep.Type, err))
+			continue
+		}
+		bundle.Files = append(bundle.Files, datadog.ProfileFile{Type: ep.Type, Path: dest, Bytes: bytes})
+	}
+	bundle.Cgroup = cgroup.finish(ctx)
+	bundle.Warnings = append(bundle.Warnings, restoreRates(restore)...)
+	if len(bundle.Files) == 0 {
+		return bundle, fmt.Errorf("no profiles from %s on port %d (%s): %s", pod.Name, bundle.Port, bundle.PortSource, strings.Join(bundle.Warnings, "; "))
+	}
+	return bundle, nil
+}
+
+// startPodForward starts a port-forward to the pod, falling back to
+// fetching through kubectl exec in clusters that forbid port-forward. The
+// fallback is reported as a warning naming the method used.
+func startPodForward(ctx context.Context, pod *PodInfo, port int) (*PortForward, string, error) {
+	pf, err := StartPortForward(ctx, pod, port)
+	if err == nil || Mode() == ModeInCluster || ctx.Err() != nil {
+		return pf, "", err
+	}
+	pf, execErr := StartExecForward(ctx, pod, port, portContainer(*pod, port))
+	if execErr != nil {
+		return nil, "", fmt.Errorf("%w; kubectl exec fallback: %v", err, execErr)
+	}
+	return pf, fmt.Sprintf("port-forward failed (%v); fetched through %s instead", err, pf.Method()), nil
+}
+
+// restoreRates puts back rates changed for a capture, reporting a failure
+// as a warning
+func restoreRates(restore func() error) []string {
+	if restore == nil {
+		return nil
+	}
+	if err := restore(); err != nil {
+		return []string{err.Error()}
+	}
+	return nil
+}
+
+// awaitRates gives newly enabled mutex and block profiling the capture
+// window to collect samples. The CPU profile is that window when it is
+// captured; otherwise this waits it out.
+func awaitRates(ctx context.Context, selected []Endpoint, seconds int) error {
+	if hasCPU(selected) {
+		return nil
+	}
+	timer := time.NewTimer(time.Duration(seconds) * time.Second)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func hasCPU(selected []Endpoint) bool {
+	for _, ep := range selected {
+		if ep.Type == "cpu" {
+			return true
+		}
+	}
+	return false
+}
+
+func endpointURL(ep Endpoint, seconds int) string {
+	if ep.Type == "cpu" {
+		return fmt.Sprintf("%s?seconds=%d", ep.Path, seconds)
+	}
+	return ep.Path
+}
+
+func fetchProfile(ctx context.Context, client *http.Client, url, dest string) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return 0, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	out, err := os.Create(dest)
+	if err != nil {
+		return 0, err
+	}
+	written, err := io.Copy(out, resp.Body)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dest)
+		return 0, err
+	}
+	return written, nil
+}
+
+// CaptureCommands returns the equivalent kubectl and curl commands, with
+// <pod> and <local-port> standing in for values known only at run time. In
+// in-cluster mode they are curl calls to the API server instead.
+func CaptureCommands(params CaptureParams) ([]string, error) {
+	params, selected, err := normalizeCapture(params)
+	if err != nil {
+		return nil, err
+	}
+	if Mode() == ModeInCluster {
+		if params.KubeContext != "" {
+			return nil, fmt.Errorf("kube context %q cannot be used in in-cluster mode", params.KubeContext)
+		}
+	}
+	return captureCommands(params, selected)
+}
+
+func captureCommands(params CaptureParams, selected []Endpoint) ([]string, error) {
+	if Mode() == ModeInCluster {
+		return inClusterCaptureCommands(params, selected)
+	}
+	var commands []string
+	selector := params.Selector
+	if selector == "" {
+		commands = append(commands, "kubectl "+strings.Join(workloadSelectorArgs(params.KubeContext, params.Namespace, params.Workload), " "))
+		selector = "<selector>"
+	}
+	commands = append(commands, "kubectl "+strings.Join(getPodsArgs(params.KubeContext, params.Namespace, selector), " "))
+	if (params.Strategy == StrategyCPU || params.Strategy == StrategyMemory) && params.Usage == nil {
+		commands = append(commands, "kubectl "+strings.Join(topPodsArgs(params.KubeContext, params.Namespace, selector), " "))
+	}
+	commands = append(commands,
+		"kubectl "+strings.Join(portForwardArgs(params.KubeContext, params.Namespace, "<pod>", "<local-port>", portLabel(params.Port)), " "),
+	)
+	if !params.SkipCgroup {
+		commands = append(commands, cgroupCommand(params.KubeContext, params.Namespace, "<pod>"))
+	}
+	if params.Rates.Enabled() {
+		commands = append(commands, fmt.Sprintf("curl -sf -X PUT 'http://127.0.0.1:<local-port>%s'", params.Rates.SetURL()))
+	}
+	for _, ep := range selected {
+		dest := filepath.Join(params.OutDir, "<pod>", fmt.Sprintf("%s_%s_%s", params.Service, params.Namespace, ep.Filename))
+		commands = append(commands, fmt.Sprintf("curl -sf -o %s 'http://127.0.0.1:<local-port>%s'", dest, endpointURL(ep, params.Seconds)))
+	}
+	if !params.SkipCgroup {
+		commands = append(commands, cgroupCommand(params.KubeContext, params.Namespace, "<pod>"))
+	}
+	if params.Rates.Enabled() {
+		commands = append(commands, fmt.Sprintf("curl -sf -X PUT 'http://127.0.0.1:<local-port>%s'", params.Rates.RestoreURL()))
+	}
+	return append(commands, mergeCommands(params, selected)...), nil
+}
+
+func inClusterCaptureCommands(params CaptureParams, selected []Endpoint) ([]string, error) {
+	var commands []string
+	selector := params.Selector
+	if selector == "" {
+		path, err := workloadPath(params.Namespace, params.Workload)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, apiCommand(path, nil))
+		selector = "<selector>"
+	}
+	commands = append(commands, apiCommand(podsPath(params.Namespace), selectorQuery(selector)))
+	if (params.Strategy == StrategyCPU || params.Strategy == StrategyMemory) && params.Usage == nil {
+		commands = append(commands, apiCommand(metricsPath(params.Namespace), selectorQuery(selector)))
+	}
+	proxy := podProxyPath(params.Namespace, "<pod>", portLabel(params.Port))
+	if params.Rates.Enabled() {
+		commands = append(commands, apiCommand(proxy+params.Rates.SetURL(), nil, "-X", "PUT"))
+	}
+	for _, ep := range selected {
+		dest := filepath.Join(params.OutDir, "<pod>", fmt.Sprintf("%s_%s_%s", params.Service, params.Namespace, ep.Filename))
+		commands = append(commands, apiCommand(proxy+endpointURL(ep, params.Seconds), nil, "-o", dest))
+	}
+	if params.Rates.Enabled() {
+		commands = append(commands, apiCommand(proxy+params.Rates.RestoreURL(), nil, "-X", "PUT"))
+	}
+	return append(commands, mergeCommands(params, selected)...), nil
+}
+
+func mergeCommands(params CaptureParams, selected []Endpoint) []string {
+	if !params.Merge {
+		return nil
+	}
+	var commands []string
+	for _, ep := range selected {
+		name := fmt.Sprintf("%s_%s_%s", params.Service, params.Namespace, ep.Filename)
+		commands = append(commands, fmt.Sprintf("go tool pprof -proto -output %s %s", filepath.Join(params.OutDir, "fleet", name), filepath.Join(params.OutDir, "*", name)))
+	}
+	return commands
+}
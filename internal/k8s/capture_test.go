@@ -0,0 +1,201 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/require"
+
+	"github.com/arreyder/pprof-mcp/internal/datadog"
+)
+
+func TestServiceFromSelector(t *testing.T) {
+	require.Equal(t, "foo", ServiceFromSelector("app=foo", "prod"))
+	require.Equal(t, "api", ServiceFromSelector("tier=web, app.kubernetes.io/name==api", "prod"))
+	require.Equal(t, "prod", ServiceFromSelector("tier=web", "prod"))
+	require.Equal(t, "prod", ServiceFromSelector("app!=foo", "prod"))
+}
+
+func TestSelectEndpoints(t *testing.T) {
+	selected, err := selectEndpoints([]string{"cpu", "goroutine"})
+	require.NoError(t, err)
+	require.Len(t, selected, 2)
+	require.Equal(t, "goroutines", selected[1].Type)
+
+	_, err = selectEndpoints([]string{"trace"})
+	require.Error(t, err)
+}
+
+func TestCaptureCommands(t *testing.T) {
+	commands, err := CaptureCommands(CaptureParams{Namespace: "prod", Selector: "app=foo", Port: 6060, OutDir: "out", Seconds: 10, Types: []string{"cpu"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"kubectl get pods -n prod -l app=foo -o json",
+		"kubectl port-forward -n prod <pod> <local-port>:6060",
+		cgroupCommand("", "prod", "<pod>"),
+		"curl -sf -o out/<pod>/foo_prod_cpu.pprof 'http://127.0.0.1:<local-port>/debug/pprof/profile?seconds=10'",
+		cgroupCommand("", "prod", "<pod>"),
+	}, commands)
+	require.True(t, strings.HasPrefix(commands[2], "kubectl exec -n prod <pod> -- sh -c 'cd /sys/fs/cgroup && "))
+}
+
+func TestParseTarget(t *testing.T) {
+	workload, selector, err := ParseTarget("deploy/api")
+	require.NoError(t, err)
+	require.Equal(t, "deployment/api", workload)
+	require.Empty(t, selector)
+
+	workload, selector, err = ParseTarget("app.kubernetes.io/name=api")
+	require.NoError(t, err)
+	require.Empty(t, workload)
+	require.Equal(t, "app.kubernetes.io/name=api", selector)
+
+	workload, _, err = ParseTarget("cj/nightly")
+	require.NoError(t, err)
+	require.Equal(t, "cronjob/nightly", workload)
+	_, _, err = ParseTarget("pod/api-1")
+	require.ErrorContains(t, err, "unsupported workload")
+	_, _, err = ParseTarget("api")
+	require.Error(t, err)
+
+	require.Equal(t, "app=api,tier=web", selectorFromLabels(map[string]string{"tier": "web", "app": "api"}))
+}
+
+func TestCaptureCommandsWorkload(t *testing.T) {
+	commands, err := CaptureCommands(CaptureParams{Namespace: "prod", Workload: "statefulset/db", OutDir: "out", Types: []string{"heap"}, SkipCgroup: true})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"kubectl get statefulset/db -n prod -o json",
+		"kubectl get pods -n prod -l <selector> -o json",
+		"kubectl port-forward -n prod <pod> <local-port>:<port>",
+		"curl -sf -o out/<pod>/db_prod_heap.pprof 'http://127.0.0.1:<local-port>/debug/pprof/heap'",
+	}, commands)
+}
+
+func TestCaptureCommandsKubeContext(t *testing.T) {
+	commands, err := CaptureCommands(CaptureParams{KubeContext: "staging", Namespace: "prod", Workload: "deployment/api", OutDir: "out", Types: []string{"heap"}, Strategy: StrategyMemory, SkipCgroup: true})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"kubectl --context staging get deployment/api -n prod -o json",
+		"kubectl --context staging get pods -n prod -l <selector> -o json",
+		"kubectl --context staging top pods -n prod -l <selector> --no-headers",
+		"kubectl --context staging port-forward -n prod <pod> <local-port>:<port>",
+		"curl -sf -o out/<pod>/api_prod_heap.pprof 'http://127.0.0.1:<local-port>/debug/pprof/heap'",
+	}, commands)
+}
+
+func TestFetchProfile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/debug/pprof/heap" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("profile"))
+	}))
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "heap.pprof")
+	written, err := fetchProfile(context.Background(), server.Client(), server.URL+"/debug/pprof/heap", dest)
+	require.NoError(t, err)
+	require.EqualValues(t, 7, written)
+	data, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	require.Equal(t, "profile", string(data))
+
+	_, err = fetchProfile(context.Background(), server.Client(), server.URL+"/debug/pprof/mutex", filepath.Join(t.TempDir(), "mutex.pprof"))
+	require.ErrorContains(t, err, "status 404")
+}
+
+func TestMergeFleet(t *testing.T) {
+	dir := t.TempDir()
+	write := func(pod string, value int64) string {
+		path := filepath.Join(dir, pod, "api_prod_cpu.pprof")
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		fn := &profile.Function{ID: 1, Name: "main.work"}
+		loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+		prof := &profile.Profile{
+			SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+			PeriodType: &profile.ValueType{Type: "cpu", Unit: "nanoseconds"},
+			Period:     1,
+			Sample:     []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{value}}},
+			Location:   []*profile.Location{loc},
+			Function:   []*profile.Function{fn},
+		}
+		file, err := os.Create(path)
+		require.NoError(t, err)
+		require.NoError(t, prof.Write(file))
+		require.NoError(t, file.Close())
+		return path
+	}
+	bundles := []PodBundle{
+		{Pod: "api-1", DownloadResult: datadog.DownloadResult{Files: []datadog.ProfileFile{{Type: "cpu", Path: write("api-1", 300)}}}},
+		{Pod: "api-2", DownloadResult: datadog.DownloadResult{Files: []datadog.ProfileFile{{Type: "cpu", Path: write("api-2", 100)}}}},
+	}
+	params := CaptureParams{Namespace: "prod", Service: "api", OutDir: dir}
+	selected, err := selectEndpoints([]string{"cpu", "heap"})
+	require.NoError(t, err)
+
+	fleet, warnings := mergeFleet(context.Background(), params, selected, bundles)
+	require.Empty(t, warnings)
+	require.Len(t, fleet, 1)
+	require.Equal(t, filepath.Join(dir, "fleet", "api_prod_cpu.pprof"), fleet[0].Path)
+	require.Equal(t, 2, fleet[0].Pods)
+	require.Equal(t, "api-1", fleet[0].Contributions[0].Pod)
+	require.Equal(t, 75.0, fleet[0].Contributions[0].Pct)
+	require.FileExists(t, fleet[0].Path)
+}
+
+func TestCaptureFleet(t *testing.T) {
+	pods := []PodInfo{{Name: "api-1"}, {Name: "api-2"}, {Name: "api-3"}, {Name: "api-4"}, {Name: "api-5"}}
+	var inFlight, maxInFlight atomic.Int32
+	capture := func(ctx context.Context, pod PodInfo) (PodBundle, error) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			peak := maxInFlight.Load()
+			if n <= peak || maxInFlight.CompareAndSwap(peak, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		bundle := PodBundle{Pod: pod.Name, DownloadResult: datadog.DownloadResult{Files: []datadog.ProfileFile{{Type: "cpu"}}}}
+		switch pod.Name {
+		case "api-2":
+			return PodBundle{}, errors.New("connection refused")
+		case "api-3":
+			<-ctx.Done()
+			return PodBundle{}, ctx.Err()
+		case "api-4":
+			bundle.Warnings = []string{"heap profile: status 404"}
+		}
+		return bundle, nil
+	}
+
+	statuses, bundles, failed := captureFleet(context.Background(), pods, 2, 50*time.Millisecond, capture)
+	require.LessOrEqual(t, maxInFlight.Load(), int32(2))
+	require.Len(t, statuses, 5)
+	var got []string
+	for _, status := range statuses {
+		got = append(got, status.Pod+"="+status.Status)
+	}
+	require.Equal(t, []string{"api-1=ok", "api-2=failed", "api-3=failed", "api-4=partial", "api-5=ok"}, got)
+	require.Contains(t, statuses[2].Error, "timed out")
+	require.Len(t, bundles, 3)
+	require.Equal(t, []PodFailure{{Pod: "api-2", Error: "connection refused"}, {Pod: "api-3", Error: statuses[2].Error}}, failed)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	statuses, bundles, failed = captureFleet(ctx, pods, 2, time.Second, capture)
+	require.Empty(t, bundles)
+	require.Empty(t, failed)
+	require.Equal(t, PodSkipped, statuses[0].Status)
+}
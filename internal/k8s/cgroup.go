@@ -0,0 +1,245 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// throttledWarnPct is the share of CFS periods throttled during a capture
+// above which the capture warns that CPU numbers are distorted
+const throttledWarnPct = 5.0
+
+// cgroupFiles are the cgroup files read under /sys/fs/cgroup: cgroup v2
+// first, then their v1 equivalents
+var cgroupFiles = []string{
+	"cpu.stat", "cpu.max", "memory.current", "memory.peak", "memory.max",
+	"cpu/cpu.stat", "cpu,cpuacct/cpu.stat", "cpu/cpu.cfs_quota_us", "cpu/cpu.cfs_period_us",
+	"memory/memory.usage_in_bytes", "memory/memory.max_usage_in_bytes", "memory/memory.limit_in_bytes",
+}
+
+// cgroupScript prints each readable cgroup file after a "==> <file>" header
+var cgroupScript = `cd /sys/fs/cgroup && for f in ` + strings.Join(cgroupFiles, " ") + `; do [ -r "$f" ] && echo "==> $f" && cat "$f"; done; true`
+
+// CgroupStats is a container's CPU throttling over the capture and its
+// memory use, read from its cgroup with kubectl exec. A "CPU regression"
+// in a throttled container is the quota, not the code.
+type CgroupStats struct {
+	Container string `json:"container"`
+	Version   int    `json:"version"` // cgroup version, 1 or 2
+	// WindowSeconds separates the two reads of the CPU counters: before the
+	// first profile and after the last.
+	WindowSeconds    float64 `json:"window_seconds"`
+	Periods          int64   `json:"periods"`           // CFS periods elapsed in the window
+	ThrottledPeriods int64   `json:"throttled_periods"` // periods in which the quota ran out
+	ThrottledPct     float64 `json:"throttled_pct"`
+	ThrottledSeconds float64 `json:"throttled_seconds"`
+	UsageSeconds     float64 `json:"usage_seconds,omitempty"` // CPU used in the window (cgroup v2)
+	CPULimitCores    float64 `json:"cpu_limit_cores,omitempty"`
+	MemoryBytes      int64   `json:"memory_bytes"`                // memory.current after the capture
+	MemoryPeakBytes  int64   `json:"memory_peak_bytes,omitempty"` // since the container started, when the kernel reports it
+	MemoryLimitBytes int64   `json:"memory_limit_bytes,omitempty"`
+	Error            string  `json:"error,omitempty"` // why the stats could not be read
+}
+
+// Throttled reports whether the container was throttled in enough periods
+// of the capture to distort its CPU profile.
+func (s *CgroupStats) Throttled() bool {
+	return s != nil && s.Error == "" && s.ThrottledPct >= throttledWarnPct
+}
+
+// cgroupReader reads a pod's cgroup stats at the start and end of a
+// capture
+type cgroupReader struct {
+	pod       PodInfo
+	container string
+	start     time.Time
+	before    map[string]string
+	err       error
+}
+
+// startCgroup takes the first read of a pod's cgroup. It returns nil when
+// cgroup stats are off or cannot be read in this mode.
+func startCgroup(ctx context.Context, params CaptureParams, pod PodInfo, port int) *cgroupReader {
+	if params.SkipCgroup || Mode() == ModeInCluster {
+		return nil
+	}
+	reader := &cgroupReader{pod: pod, container: portContainer(pod, port), start: time.Now()}
+	reader.before, reader.err = readCgroup(ctx, pod, reader.container)
+	return reader
+}
+
+// finish takes the second read and computes the stats over the window
+func (r *cgroupReader) finish(ctx context.Context) *CgroupStats {
+	if r == nil {
+		return nil
+	}
+	stats := &CgroupStats{Container: r.container}
+	if r.err != nil {
+		stats.Error = r.err.Error()
+		return stats
+	}
+	after, err := readCgroup(ctx, r.pod, r.container)
+	if err != nil {
+		stats.Error = err.Error()
+		return stats
+	}
+	fillCgroupStats(stats, r.before, after, time.Since(r.start))
+	return stats
+}
+
+func readCgroup(ctx context.Context, pod PodInfo, container string) (map[string]string, error) {
+	output, err := kubectl(ctx, cgroupExecArgs(pod.Context, pod.Namespace, pod.Name, container)...)
+	if err != nil {
+		// A distroless image has no sh or cat to read the files with.
+		return nil, fmt.Errorf("reading cgroup stats: %v", strings.TrimSpace(err.Error()))
+	}
+	files := parseCgroupFiles(string(output))
+	if len(files) == 0 {
+		return nil, errors.New("no cgroup cpu or memory files readable in the container")
+	}
+	return files, nil
+}
+
+func cgroupExecArgs(kubeContext, namespace, pod, container string) []string {
+	return podExecArgs(kubeContext, namespace, pod, container, "sh", "-c", cgroupScript)
+}
+
+// cgroupCommand is the kubectl exec reading a pod's cgroup, for dry runs
+func cgroupCommand(kubeContext, namespace, pod string) string {
+	args := cgroupExecArgs(kubeContext, namespace, pod, "")
+	return "kubectl " + strings.Join(args[:len(args)-1], " ") + " '" + cgroupScript + "'"
+}
+
+// portContainer is the container exposing the pprof port, or "" for the
+// pod's default container
+func portContainer(pod PodInfo, port int) string {
+	for _, container := range pod.Containers {
+		for _, p := range container.Ports {
+			if p.ContainerPort == port {
+				return container.Name
+			}
+		}
+	}
+	return ""
+}
+
+// parseCgroupFiles splits cgroupScript output into file contents
+func parseCgroupFiles(output string) map[string]string {
+	files := map[string]string{}
+	name := ""
+	var body []string
+	flush := func() {
+		if name != "" {
+			files[name] = strings.TrimSpace(strings.Join(body, "\n"))
+		}
+	}
+	for _, line := range strings.Split(output, "\n") {
+		if file, ok := strings.CutPrefix(line, "==> "); ok {
+			flush()
+			name, body = strings.TrimSpace(file), nil
+			continue
+		}
+		body = append(body, line)
+	}
+	flush()
+	return files
+}
+
+// fillCgroupStats computes the window deltas of the CPU counters and the
+// memory figures from two reads, preferring cgroup v2 files
+func fillCgroupStats(stats *CgroupStats, before, after map[string]string, window time.Duration) {
+	stats.WindowSeconds = window.Seconds()
+	if cpu, ok := after["cpu.stat"]; ok {
+		stats.Version = 2
+		prev, cur := statFields(before["cpu.stat"]), statFields(cpu)
+		stats.Periods = cur["nr_periods"] - prev["nr_periods"]
+		stats.ThrottledPeriods = cur["nr_throttled"] - prev["nr_throttled"]
+		stats.ThrottledSeconds = float64(cur["throttled_usec"]-prev["throttled_usec"]) / 1e6
+		stats.UsageSeconds = float64(cur["usage_usec"]-prev["usage_usec"]) / 1e6
+		if quota, period, ok := strings.Cut(after["cpu.max"], " "); ok {
+			stats.CPULimitCores = cpuCores(quota, period)
+		}
+		stats.MemoryBytes = statValue(after["memory.current"])
+		stats.MemoryPeakBytes = statValue(after["memory.peak"])
+		stats.MemoryLimitBytes = statValue(after["memory.max"])
+	} else {
+		stats.Version = 1
+		name := "cpu/cpu.stat"
+		if _, ok := after[name]; !ok {
+			name = "cpu,cpuacct/cpu.stat"
+		}
+		prev, cur := statFields(before[name]), statFields(after[name])
+		stats.Periods = cur["nr_periods"] - prev["nr_periods"]
+		stats.ThrottledPeriods = cur["nr_throttled"] - prev["nr_throttled"]
+		stats.ThrottledSeconds = float64(cur["throttled_time"]-prev["throttled_time"]) / 1e9
+		stats.CPULimitCores = cpuCores(after["cpu/cpu.cfs_quota_us"], after["cpu/cpu.cfs_period_us"])
+		stats.MemoryBytes = statValue(after["memory/memory.usage_in_bytes"])
+		stats.MemoryPeakBytes = statValue(after["memory/memory.max_usage_in_bytes"])
+		// v1 reports no limit as a huge page-aligned number
+		if limit := statValue(after["memory/memory.limit_in_bytes"]); limit < 1<<62 {
+			stats.MemoryLimitBytes = limit
+		}
+	}
+	if stats.Periods > 0 {
+		stats.ThrottledPct = float64(stats.ThrottledPeriods) / float64(stats.Periods) * 100
+	}
+}
+
+// statFields parses "key value" lines such as cpu.stat
+func statFields(content string) map[string]int64 {
+	fields := map[string]int64{}
+	for _, line := range strings.Split(content, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil {
+			fields[key] = n
+		}
+	}
+	return fields
+}
+
+// statValue parses a single-number file; "max" and unreadable values are 0
+func statValue(content string) int64 {
+	n, err := strconv.ParseInt(strings.TrimSpace(content), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// cpuCores turns a CFS quota and period into cores; an unlimited quota
+// ("max" or -1) is 0
+func cpuCores(quota, period string) float64 {
+	q, p := statValue(quota), statValue(period)
+	if q <= 0 || p <= 0 {
+		return 0
+	}
+	return float64(q) / float64(p)
+}
+
+// throttleWarning explains a throttled pod's CPU profile
+func throttleWarning(pod string, stats *CgroupStats) string {
+	limit := "CPU limit"
+	if stats.CPULimitCores > 0 {
+		limit = fmt.Sprintf("%g-core CPU limit", stats.CPULimitCores)
+	}
+	return fmt.Sprintf("pod %s was CPU throttled in %.0f%% of periods (%.1fs) during the capture: a CPU regression here may be the %s rather than the code", pod, stats.ThrottledPct, stats.ThrottledSeconds, limit)
+}
+
+// throttleWarnings flags the captured pods whose CPU profiles were shaped by
+// throttling
+func throttleWarnings(pods []PodStatus) []string {
+	var warnings []string
+	for _, pod := range pods {
+		if pod.Cgroup.Throttled() {
+			warnings = append(warnings, throttleWarning(pod.Pod, pod.Cgroup))
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,80 @@
+package k8s
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCgroupFiles(t *testing.T) {
+	files := parseCgroupFiles("==> cpu.stat\nusage_usec 100\nnr_periods 5\n==> cpu.max\nmax 100000\n==> memory.current\n1024\n")
+	require.Equal(t, map[string]string{
+		"cpu.stat":       "usage_usec 100\nnr_periods 5",
+		"cpu.max":        "max 100000",
+		"memory.current": "1024",
+	}, files)
+	require.Empty(t, parseCgroupFiles(""))
+}
+
+func TestFillCgroupStatsV2(t *testing.T) {
+	before := map[string]string{"cpu.stat": "usage_usec 1000000\nnr_periods 100\nnr_throttled 10\nthrottled_usec 500000"}
+	after := map[string]string{
+		"cpu.stat":       "usage_usec 31000000\nuser_usec 1\nnr_periods 400\nnr_throttled 130\nthrottled_usec 6500000",
+		"cpu.max":        "50000 100000",
+		"memory.current": "2048",
+		"memory.peak":    "4096",
+		"memory.max":     "max",
+	}
+	stats := &CgroupStats{Container: "app"}
+	fillCgroupStats(stats, before, after, 30*time.Second)
+	require.Equal(t, 2, stats.Version)
+	require.Equal(t, 30.0, stats.WindowSeconds)
+	require.Equal(t, int64(300), stats.Periods)
+	require.Equal(t, int64(120), stats.ThrottledPeriods)
+	require.InDelta(t, 40.0, stats.ThrottledPct, 0.001)
+	require.InDelta(t, 6.0, stats.ThrottledSeconds, 0.001)
+	require.InDelta(t, 30.0, stats.UsageSeconds, 0.001)
+	require.Equal(t, 0.5, stats.CPULimitCores)
+	require.Equal(t, int64(2048), stats.MemoryBytes)
+	require.Equal(t, int64(4096), stats.MemoryPeakBytes)
+	require.Zero(t, stats.MemoryLimitBytes)
+	require.True(t, stats.Throttled())
+
+	warnings := throttleWarnings([]PodStatus{{Pod: "api-1", Cgroup: stats}, {Pod: "api-2"}})
+	require.Len(t, warnings, 1)
+	require.Contains(t, warnings[0], "pod api-1 was CPU throttled in 40% of periods (6.0s)")
+	require.Contains(t, warnings[0], "0.5-core CPU limit")
+}
+
+func TestFillCgroupStatsV1(t *testing.T) {
+	before := map[string]string{"cpu,cpuacct/cpu.stat": "nr_periods 10\nnr_throttled 0\nthrottled_time 0"}
+	after := map[string]string{
+		"cpu,cpuacct/cpu.stat":             "nr_periods 110\nnr_throttled 2\nthrottled_time 20000000",
+		"cpu/cpu.cfs_quota_us":             "-1",
+		"cpu/cpu.cfs_period_us":            "100000",
+		"memory/memory.usage_in_bytes":     "1000",
+		"memory/memory.max_usage_in_bytes": "3000",
+		"memory/memory.limit_in_bytes":     "9223372036854771712",
+	}
+	stats := &CgroupStats{}
+	fillCgroupStats(stats, before, after, time.Second)
+	require.Equal(t, 1, stats.Version)
+	require.Equal(t, int64(100), stats.Periods)
+	require.Equal(t, int64(2), stats.ThrottledPeriods)
+	require.InDelta(t, 0.02, stats.ThrottledSeconds, 0.0001)
+	require.Zero(t, stats.CPULimitCores)
+	require.Equal(t, int64(1000), stats.MemoryBytes)
+	require.Equal(t, int64(3000), stats.MemoryPeakBytes)
+	require.Zero(t, stats.MemoryLimitBytes)
+	require.False(t, stats.Throttled())
+}
+
+func TestPortContainer(t *testing.T) {
+	pod := PodInfo{Containers: []Container{
+		{Name: "proxy", Ports: []ContainerPort{{ContainerPort: 15001}}},
+		{Name: "app", Ports: []ContainerPort{{ContainerPort: 6060}}},
+	}}
+	require.Equal(t, "app", portContainer(pod, 6060))
+	require.Empty(t, portContainer(pod, 9999))
+}
@@ -0,0 +1,434 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/arreyder/pprof-mcp/internal/pprof"
+)
+
+// compareDiffTypes are the merged profile types diffed across clusters;
+// their top values are times, which diff_top ranks by
+var compareDiffTypes = []string{"cpu", "mutex", "block"}
+
+// compareDeltas is how many of the largest increases and decreases each
+// diff keeps
+const compareDeltas = 10
+
+// runtimeEnv are the Go runtime settings compared across clusters
+var runtimeEnv = []string{"GOMAXPROCS", "GOMEMLIMIT", "GOGC", "GODEBUG"}
+
+// ClusterTarget is one side of a cross-cluster comparison
+type ClusterTarget struct {
+	KubeContext string `json:"kube_context,omitempty"`
+	Namespace   string `json:"namespace,omitempty"` // default: CompareParams.Namespace
+	// Selector narrows CompareParams.Selector to this side's pods, e.g.
+	// track=canary
+	Selector string `json:"selector,omitempty"`
+	// Label names the side in results and its OutDir subdirectory; default:
+	// the context, namespace, or selector that tells the sides apart
+	Label string `json:"label,omitempty"`
+}
+
+// CompareParams captures the same service from two clusters, or two
+// namespaces of one, and diffs the merged profiles. CaptureParams apply to
+// both sides except KubeContext and OutDir: each side is captured into
+// OutDir/<label> from its own context.
+type CompareParams struct {
+	CaptureParams
+	Clusters [2]ClusterTarget
+}
+
+// ClusterProfiles is one side's capture and the configuration its pods ran
+// with
+type ClusterProfiles struct {
+	Label       string        `json:"label"`
+	KubeContext string        `json:"kube_context,omitempty"`
+	Namespace   string        `json:"namespace"`
+	Config      ClusterConfig `json:"config"`
+	Capture     CaptureResult `json:"capture"`
+}
+
+// ClusterConfig is what in a side's pod specs can explain a profile
+// difference, read from the container serving pprof on the captured pods
+type ClusterConfig struct {
+	Replicas      int               `json:"replicas"` // running pods matching the target
+	Container     string            `json:"container"`
+	Images        []string          `json:"images"`
+	CPURequest    string            `json:"cpu_request,omitempty"`
+	CPULimit      string            `json:"cpu_limit,omitempty"`
+	MemoryRequest string            `json:"memory_request,omitempty"`
+	MemoryLimit   string            `json:"memory_limit,omitempty"`
+	Env           map[string]string `json:"env,omitempty"` // GOMAXPROCS, GOMEMLIMIT, GOGC, GODEBUG as set in the spec
+	// ThrottledPct averages the captured pods' cgroup throttling
+	ThrottledPct float64 `json:"throttled_pct,omitempty"`
+}
+
+// ConfigDifference is a setting that differs between the two sides, with
+// the profile effect to expect from it
+type ConfigDifference struct {
+	Setting string    `json:"setting"`
+	Values  [2]string `json:"values"` // in Clusters order; "" is unset
+	Effect  string    `json:"effect"`
+}
+
+// ClusterDiff is diff_top of one merged profile type, second side minus
+// first, cut to the functions that grew and shrank the most
+type ClusterDiff struct {
+	Type   string           `json:"type"`
+	Deltas []map[string]any `json:"deltas"`
+}
+
+// Attribution ties a function that moved between the clusters to the
+// configuration differences that can account for it
+type Attribution struct {
+	Type         string   `json:"type"`
+	Function     string   `json:"function"`
+	DeltaSeconds float64  `json:"delta_seconds"`
+	Settings     []string `json:"settings"`
+	Reason       string   `json:"reason"`
+}
+
+// CompareResult is a cross-cluster comparison of one service
+type CompareResult struct {
+	Service           string             `json:"service"`
+	Clusters          []ClusterProfiles  `json:"clusters"`
+	ConfigDifferences []ConfigDifference `json:"config_differences"`
+	Diffs             []ClusterDiff      `json:"diffs"`
+	Attributions      []Attribution      `json:"attributions,omitempty"`
+	Warnings          []string           `json:"warnings,omitempty"`
+}
+
+// runtimeCause groups runtime functions whose cost follows configuration
+// rather than code
+type runtimeCause struct {
+	pattern  *regexp.Regexp
+	settings []string
+	reason   string
+}
+
+var runtimeCauses = []runtimeCause{
+	{
+		pattern:  regexp.MustCompile(`^runtime\.(gcBgMarkWorker|gcDrain|scanobject|greyobject|markroot|gcAssistAlloc|mallocgc|bgsweep|bgscavenge|sweepone|(\(\*mheap\)|\(\*mspan\)|\(\*mcentral\))\.)`),
+		settings: []string{"memory_limit", "GOMEMLIMIT", "GOGC", "GOMAXPROCS", "cpu_limit"},
+		reason:   "garbage collection runs more often under a tighter memory limit, GOMEMLIMIT, or GOGC, and its background workers scale with GOMAXPROCS",
+	},
+	{
+		pattern:  regexp.MustCompile(`^runtime\.(schedule|findRunnable|findrunnable|stealWork|runqgrab|park_m|mcall|futex|futexsleep|notesleep|usleep|procyield|osyield|netpoll|checkTimers|wakep|startm|stopm)$`),
+		settings: []string{"cpu_limit", "GOMAXPROCS", "replicas"},
+		reason:   "scheduler spinning and parking scale with GOMAXPROCS, which follows the CPU limit on Go 1.25+ or with automaxprocs, and with per-pod load",
+	},
+}
+
+// settingEffects explain what each compared setting does to a profile
+var settingEffects = map[string]string{
+	"image":          "different builds: function-level differences may be code, not configuration",
+	"replicas":       "load per pod differs; merged profiles sum over the captured pods, so compare per-pod cost",
+	"cpu_request":    "CPU shares under node contention",
+	"cpu_limit":      "CFS quota and, on Go 1.25+ or with automaxprocs, GOMAXPROCS: parallelism, scheduler, and GC worker time change with it",
+	"memory_request": "scheduling only; no direct profile effect",
+	"memory_limit":   "GC pressure when GOMEMLIMIT is derived from it, and OOM headroom",
+	"GOMAXPROCS":     "threads running Go code at once: scheduler and GC worker time scale with it",
+	"GOMEMLIMIT":     "soft memory limit: the GC runs more often near it",
+	"GOGC":           "GC frequency: lower values collect more often and cost more CPU",
+	"GODEBUG":        "runtime behavior flags",
+	"throttled_pct":  "CPU throttling stretches wall-clock latency and shows up as scheduler time, not as code cost",
+}
+
+// CompareClusters captures params' target from both clusters at once,
+// merges each side's profiles, and diffs the second side against the first.
+// Differences in the pods' images, resources, and Go runtime settings are
+// listed, and runtime functions among the largest changes are attributed to
+// the settings that drive them.
+func CompareClusters(ctx context.Context, params CompareParams) (CompareResult, error) {
+	sides, err := compareSides(params)
+	if err != nil {
+		return CompareResult{}, err
+	}
+	result := CompareResult{Clusters: make([]ClusterProfiles, 2), ConfigDifferences: []ConfigDifference{}, Diffs: []ClusterDiff{}}
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i, side := range sides {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result.Clusters[i], errs[i] = captureSide(ctx, side)
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return result, fmt.Errorf("%s: %w", result.Clusters[i].Label, err)
+		}
+	}
+	first, second := result.Clusters[0], result.Clusters[1]
+	for _, side := range result.Clusters {
+		result.Service = firstNonEmpty(result.Service, firstBundleService(side.Capture))
+		for _, warning := range side.Capture.Warnings {
+			result.Warnings = append(result.Warnings, side.Label+": "+warning)
+		}
+	}
+	if a, b := len(first.Capture.Bundles), len(second.Capture.Bundles); a != b {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("%d pods captured on %s and %d on %s: merged profiles sum over pods, so totals differ by pod count as well as per-pod cost", a, first.Label, b, second.Label))
+	}
+	result.ConfigDifferences = configDifferences(first.Config, second.Config)
+
+	for _, profileType := range compareDiffTypes {
+		before, after := fleetPath(first.Capture, profileType), fleetPath(second.Capture, profileType)
+		if before == "" || after == "" {
+			continue
+		}
+		diff, err := pprof.RunDiffTop(ctx, pprof.DiffTopParams{Before: before, After: after, NodeCount: 30})
+		if err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s diff: %v", profileType, err))
+			continue
+		}
+		deltas := pprof.LargestDeltas(diff.Deltas, compareDeltas)
+		result.Diffs = append(result.Diffs, ClusterDiff{Type: profileType, Deltas: deltas})
+		result.Attributions = append(result.Attributions, attributeDeltas(profileType, deltas, result.ConfigDifferences)...)
+	}
+	return result, nil
+}
+
+// compareSides validates params and returns the capture of each side
+func compareSides(params CompareParams) ([2]CaptureParams, error) {
+	var sides [2]CaptureParams
+	if params.OutDir == "" {
+		return sides, errors.New("out_dir is required")
+	}
+	base := params.CaptureParams
+	base.Namespace = firstNonEmpty(base.Namespace, "default")
+	base.Merge = true
+	for i, cluster := range params.Clusters {
+		side := base
+		side.KubeContext = cluster.KubeContext
+		side.Namespace = firstNonEmpty(cluster.Namespace, base.Namespace)
+		if cluster.Selector != "" {
+			// A workload's own selector may already exclude the other
+			// side's pods, so side selectors narrow a label selector only.
+			if base.Selector == "" {
+				return sides, errors.New("per-side selectors need a base selector such as app=foo, not a workload")
+			}
+			side.Selector = base.Selector + "," + cluster.Selector
+		}
+		sides[i] = side
+	}
+	if sides[0].KubeContext == sides[1].KubeContext && sides[0].Namespace == sides[1].Namespace && sides[0].Selector == sides[1].Selector {
+		return sides, errors.New("the two sides need different kube contexts, namespaces, or selectors")
+	}
+	labels := compareLabels(params.Clusters, sides)
+	if labels[0] == labels[1] {
+		return sides, fmt.Errorf("both sides are labeled %q", labels[0])
+	}
+	for i := range sides {
+		sides[i].OutDir = filepath.Join(params.OutDir, labels[i])
+	}
+	return sides, nil
+}
+
+// compareLabels names each side after what differs between them: the kube
+// context, else the namespace, else the side's selector
+func compareLabels(clusters [2]ClusterTarget, sides [2]CaptureParams) [2]string {
+	var labels [2]string
+	for i, side := range sides {
+		switch {
+		case clusters[i].Label != "":
+			labels[i] = clusters[i].Label
+		case sides[0].KubeContext != sides[1].KubeContext:
+			labels[i] = firstNonEmpty(side.KubeContext, "current")
+		case sides[0].Namespace != sides[1].Namespace:
+			labels[i] = side.Namespace
+		default:
+			labels[i] = firstNonEmpty(clusters[i].Selector, "all")
+		}
+		labels[i] = strings.NewReplacer("!=", "_not_", "/", "_", ":", "_", "=", "_", ",", "+").Replace(labels[i])
+	}
+	return labels
+}
+
+// captureSide captures one side and reads its pods' configuration
+func captureSide(ctx context.Context, params CaptureParams) (ClusterProfiles, error) {
+	side := ClusterProfiles{Label: filepath.Base(params.OutDir), KubeContext: params.KubeContext, Namespace: params.Namespace}
+	capture, err := Capture(ctx, params)
+	side.Capture = capture
+	if err != nil {
+		return side, err
+	}
+	pods, err := ListPods(ctx, params.KubeContext, params.Namespace, capture.Selector)
+	if err != nil {
+		capture.Warnings = append(capture.Warnings, fmt.Sprintf("pod specs not read: %v", err))
+		side.Capture = capture
+		return side, nil
+	}
+	side.Config = clusterConfig(pods, capture)
+	return side, nil
+}
+
+// clusterConfig summarizes the captured pods' pprof container
+func clusterConfig(pods []PodInfo, capture CaptureResult) ClusterConfig {
+	config := ClusterConfig{Images: []string{}, Replicas: capture.Selection.Matched}
+	captured := map[string]int{}
+	for _, bundle := range capture.Bundles {
+		captured[bundle.Pod] = bundle.Port
+	}
+	images := map[string]bool{}
+	for _, pod := range pods {
+		port, ok := captured[pod.Name]
+		if !ok || len(pod.Containers) == 0 {
+			continue
+		}
+		container := pod.Containers[0]
+		if name := portContainer(pod, port); name != "" {
+			for _, c := range pod.Containers {
+				if c.Name == name {
+					container = c
+				}
+			}
+		}
+		if !images[container.Image] {
+			images[container.Image] = true
+			config.Images = append(config.Images, container.Image)
+		}
+		if config.Container != "" {
+			continue
+		}
+		// Pods of one workload share a spec; the first describes the rest.
+		config.Container = container.Name
+		config.CPURequest, config.CPULimit = container.Resources.Requests["cpu"], container.Resources.Limits["cpu"]
+		config.MemoryRequest, config.MemoryLimit = container.Resources.Requests["memory"], container.Resources.Limits["memory"]
+		for _, env := range container.Env {
+			for _, name := range runtimeEnv {
+				if env.Name == name {
+					if config.Env == nil {
+						config.Env = map[string]string{}
+					}
+					config.Env[name] = env.Value
+				}
+			}
+		}
+	}
+	sort.Strings(config.Images)
+	var throttled float64
+	var measured int
+	for _, status := range capture.Pods {
+		if status.Cgroup != nil && status.Cgroup.Error == "" {
+			throttled += status.Cgroup.ThrottledPct
+			measured++
+		}
+	}
+	if measured > 0 {
+		config.ThrottledPct = throttled / float64(measured)
+	}
+	return config
+}
+
+// configDifferences lists the settings that differ between two sides
+func configDifferences(a, b ClusterConfig) []ConfigDifference {
+	differences := []ConfigDifference{}
+	add := func(setting, first, second string) {
+		if first != second {
+			differences = append(differences, ConfigDifference{Setting: setting, Values: [2]string{first, second}, Effect: settingEffects[setting]})
+		}
+	}
+	add("image", strings.Join(a.Images, ","), strings.Join(b.Images, ","))
+	add("replicas", fmt.Sprint(a.Replicas), fmt.Sprint(b.Replicas))
+	add("cpu_request", a.CPURequest, b.CPURequest)
+	add("cpu_limit", a.CPULimit, b.CPULimit)
+	add("memory_request", a.MemoryRequest, b.MemoryRequest)
+	add("memory_limit", a.MemoryLimit, b.MemoryLimit)
+	for _, name := range runtimeEnv {
+		add(name, a.Env[name], b.Env[name])
+	}
+	// Throttling is compared coarsely: a few percent is noise.
+	if (a.ThrottledPct >= throttledWarnPct) != (b.ThrottledPct >= throttledWarnPct) {
+		add("throttled_pct", fmt.Sprintf("%.0f", a.ThrottledPct), fmt.Sprintf("%.0f", b.ThrottledPct))
+	}
+	return differences
+}
+
+// attributeDeltas ties runtime functions among deltas to the differing
+// settings that drive their cost
+func attributeDeltas(profileType string, deltas []map[string]any, differences []ConfigDifference) []Attribution {
+	differing := map[string]bool{}
+	for _, difference := range differences {
+		differing[difference.Setting] = true
+	}
+	var attributions []Attribution
+	for _, delta := range deltas {
+		name, _ := delta["name"].(string)
+		seconds, _ := delta["delta_seconds"].(float64)
+		for _, cause := range runtimeCauses {
+			if !cause.pattern.MatchString(name) {
+				continue
+			}
+			var settings []string
+			for _, setting := range cause.settings {
+				if differing[setting] {
+					settings = append(settings, setting)
+				}
+			}
+			if len(settings) > 0 {
+				attributions = append(attributions, Attribution{Type: profileType, Function: name, DeltaSeconds: seconds, Settings: settings, Reason: cause.reason})
+			}
+			break
+		}
+	}
+	return attributions
+}
+
+// fleetPath is the merged profile of a type, or "" when none was captured
+func fleetPath(capture CaptureResult, profileType string) string {
+	for _, fleet := range capture.Fleet {
+		if fleet.Type == profileType {
+			return fleet.Path
+		}
+	}
+	return ""
+}
+
+func firstBundleService(capture CaptureResult) string {
+	if len(capture.Bundles) == 0 {
+		return ""
+	}
+	return capture.Bundles[0].Service
+}
+
+// CompareCommands returns each side's capture commands, first side first
+func CompareCommands(params CompareParams) ([]string, error) {
+	sides, err := compareSides(params)
+	if err != nil {
+		return nil, err
+	}
+	var commands []string
+	var fleets [2]map[string]string
+	for i, side := range sides {
+		side, selected, err := normalizeCapture(side)
+		if err != nil {
+			return nil, err
+		}
+		if Mode() == ModeInCluster && side.KubeContext != "" {
+			return nil, fmt.Errorf("kube context %q cannot be used in in-cluster mode", side.KubeContext)
+		}
+		sideCommands, err := captureCommands(side, selected)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, sideCommands...)
+		fleets[i] = map[string]string{}
+		for _, ep := range selected {
+			fleets[i][ep.Type] = filepath.Join(side.OutDir, "fleet", fmt.Sprintf("%s_%s_%s", side.Service, side.Namespace, ep.Filename))
+		}
+	}
+	for _, profileType := range compareDiffTypes {
+		if before, ok := fleets[0][profileType]; ok {
+			commands = append(commands, fmt.Sprintf("go tool pprof -top -diff_base %s %s", before, fleets[1][profileType]))
+		}
+	}
+	return commands, nil
+}
@@ -0,0 +1,125 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareSides(t *testing.T) {
+	sides, err := compareSides(CompareParams{
+		CaptureParams: CaptureParams{Namespace: "prod", Workload: "deployment/api", OutDir: "out"},
+		Clusters:      [2]ClusterTarget{{KubeContext: "us-east"}, {KubeContext: "eu/west"}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "us-east", sides[0].KubeContext)
+	require.Equal(t, "out/us-east", sides[0].OutDir)
+	require.Equal(t, "out/eu_west", sides[1].OutDir)
+	require.Equal(t, "prod", sides[1].Namespace)
+	require.True(t, sides[1].Merge)
+
+	sides, err = compareSides(CompareParams{
+		CaptureParams: CaptureParams{Workload: "deployment/api", OutDir: "out"},
+		Clusters:      [2]ClusterTarget{{Namespace: "blue"}, {Namespace: "green"}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "out/blue", sides[0].OutDir)
+	require.Equal(t, "out/green", sides[1].OutDir)
+
+	_, err = compareSides(CompareParams{
+		CaptureParams: CaptureParams{Namespace: "prod", Workload: "deployment/api", OutDir: "out"},
+		Clusters:      [2]ClusterTarget{{KubeContext: "a"}, {KubeContext: "a", Namespace: "prod"}},
+	})
+	require.ErrorContains(t, err, "different kube contexts, namespaces, or selectors")
+
+	sides, err = compareSides(CompareParams{
+		CaptureParams: CaptureParams{Namespace: "prod", Selector: "app=api", OutDir: "out"},
+		Clusters:      [2]ClusterTarget{{Selector: "track!=canary"}, {Selector: "track=canary"}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "app=api,track!=canary", sides[0].Selector)
+	require.Equal(t, "out/track_not_canary", sides[0].OutDir)
+	require.Equal(t, "out/track_canary", sides[1].OutDir)
+
+	_, err = compareSides(CompareParams{
+		CaptureParams: CaptureParams{Workload: "deployment/api", OutDir: "out"},
+		Clusters:      [2]ClusterTarget{{Selector: "track=stable"}, {Selector: "track=canary"}},
+	})
+	require.ErrorContains(t, err, "need a base selector")
+}
+
+func TestCompareCommands(t *testing.T) {
+	commands, err := CompareCommands(CompareParams{
+		CaptureParams: CaptureParams{Namespace: "prod", Selector: "app=api", OutDir: "out", Types: []string{"cpu"}, SkipCgroup: true},
+		Clusters:      [2]ClusterTarget{{KubeContext: "a"}, {KubeContext: "b"}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"kubectl --context a get pods -n prod -l app=api -o json",
+		"kubectl --context a port-forward -n prod <pod> <local-port>:<port>",
+		"curl -sf -o out/a/<pod>/api_prod_cpu.pprof 'http://127.0.0.1:<local-port>/debug/pprof/profile?seconds=30'",
+		"go tool pprof -proto -output out/a/fleet/api_prod_cpu.pprof out/a/*/api_prod_cpu.pprof",
+		"kubectl --context b get pods -n prod -l app=api -o json",
+		"kubectl --context b port-forward -n prod <pod> <local-port>:<port>",
+		"curl -sf -o out/b/<pod>/api_prod_cpu.pprof 'http://127.0.0.1:<local-port>/debug/pprof/profile?seconds=30'",
+		"go tool pprof -proto -output out/b/fleet/api_prod_cpu.pprof out/b/*/api_prod_cpu.pprof",
+		"go tool pprof -top -diff_base out/a/fleet/api_prod_cpu.pprof out/b/fleet/api_prod_cpu.pprof",
+	}, commands)
+}
+
+func TestClusterConfig(t *testing.T) {
+	pods := []PodInfo{
+		{Name: "api-1", Containers: []Container{
+			{Name: "proxy", Image: "envoy:1", Ports: []ContainerPort{{ContainerPort: 15001}}},
+			{Name: "app", Image: "api:v2", Ports: []ContainerPort{{ContainerPort: 6060}},
+				Env:       []EnvVar{{Name: "GOMAXPROCS", Value: "4"}, {Name: "LOG_LEVEL", Value: "info"}},
+				Resources: Resources{Requests: map[string]string{"cpu": "1", "memory": "1Gi"}, Limits: map[string]string{"cpu": "4", "memory": "2Gi"}}},
+		}},
+		{Name: "api-2", Containers: []Container{{Name: "app", Image: "api:v1", Ports: []ContainerPort{{ContainerPort: 6060}}}}},
+		{Name: "api-3", Containers: []Container{{Name: "app", Image: "api:v3"}}},
+	}
+	capture := CaptureResult{
+		Selection: Selection{Matched: 3},
+		Bundles:   []PodBundle{{Pod: "api-1", Port: 6060}, {Pod: "api-2", Port: 6060}},
+		Pods:      []PodStatus{{Pod: "api-1", Cgroup: &CgroupStats{ThrottledPct: 10}}, {Pod: "api-2", Cgroup: &CgroupStats{ThrottledPct: 20}}},
+	}
+	require.Equal(t, ClusterConfig{
+		Replicas:      3,
+		Container:     "app",
+		Images:        []string{"api:v1", "api:v2"},
+		CPURequest:    "1",
+		CPULimit:      "4",
+		MemoryRequest: "1Gi",
+		MemoryLimit:   "2Gi",
+		Env:           map[string]string{"GOMAXPROCS": "4"},
+		ThrottledPct:  15,
+	}, clusterConfig(pods, capture))
+}
+
+func TestConfigDifferencesAndAttribution(t *testing.T) {
+	a := ClusterConfig{Replicas: 3, Images: []string{"api:v1"}, CPULimit: "2", MemoryLimit: "1Gi", Env: map[string]string{"GOGC": "100"}}
+	b := ClusterConfig{Replicas: 3, Images: []string{"api:v1"}, CPULimit: "2", MemoryLimit: "512Mi", ThrottledPct: 12}
+	differences := configDifferences(a, b)
+	var settings []string
+	for _, difference := range differences {
+		settings = append(settings, difference.Setting)
+		require.NotEmpty(t, difference.Effect)
+	}
+	require.Equal(t, []string{"memory_limit", "GOGC", "throttled_pct"}, settings)
+	require.Equal(t, [2]string{"100", ""}, differences[1].Values)
+
+	deltas := []map[string]any{
+		{"name": "runtime.gcBgMarkWorker", "delta_seconds": 3.5},
+		{"name": "main.handle", "delta_seconds": 1.0},
+		{"name": "runtime.(*mheap).alloc", "delta_seconds": 0.5},
+		{"name": "runtime.findRunnable", "delta_seconds": -0.4},
+	}
+	attributions := attributeDeltas("cpu", deltas, differences)
+	require.Len(t, attributions, 2)
+	require.Equal(t, "runtime.gcBgMarkWorker", attributions[0].Function)
+	require.Equal(t, []string{"memory_limit", "GOGC"}, attributions[0].Settings)
+	require.Equal(t, 3.5, attributions[0].DeltaSeconds)
+	require.Equal(t, "runtime.(*mheap).alloc", attributions[1].Function)
+
+	require.Empty(t, configDifferences(a, a))
+}
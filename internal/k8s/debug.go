@@ -0,0 +1,332 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/arreyder/pprof-mcp/internal/datadog"
+)
+
+// DefaultAgentCommand samples the target process with perf and converts the
+// result with perf_to_profile (github.com/google/perf_data_converter).
+// {pid}, {seconds}, and {output} are substituted before it runs.
+const DefaultAgentCommand = "perf record -F 99 -g -p {pid} -o /tmp/perf.data -- sleep {seconds} && perf_to_profile -i /tmp/perf.data -o {output} -f"
+
+const (
+	debugOutput      = "/tmp/pprof-mcp-cpu.pprof"
+	debugReadyWait   = 2 * time.Minute // image pull and start
+	debugCopyAllowed = 10 * time.Minute
+)
+
+// DebugParams configures a CPU capture through an injected ephemeral
+// container, for pods that do not serve net/http/pprof. This is a privileged
+// operation: the container runs with the "general" debug profile, which adds
+// SYS_PTRACE, and shares the target container's process namespace. Callers
+// must get explicit confirmation before running it.
+type DebugParams struct {
+	KubeContext string
+	Namespace   string
+	Pod         string // pod to inject into; otherwise the first running pod of Selector/Workload
+	Selector    string
+	Workload    string
+	Container   string // container to profile (default: the pod's first)
+	Image       string // agent image (default: PPROF_MCP_DEBUG_IMAGE)
+	Command     string // agent command template (default: DefaultAgentCommand)
+	PID         string // process to sample, as seen from the target container (default: 1)
+	Seconds     int    // sampling duration (default 30)
+	OutDir      string // the profile goes to OutDir/<pod>
+	Service     string // file prefix (default: workload name, app label, or pod)
+}
+
+// DebugResult is the outcome of a debug-container capture.
+type DebugResult struct {
+	KubeContext    string              `json:"kube_context,omitempty"`
+	Namespace      string              `json:"namespace"`
+	Pod            string              `json:"pod"`
+	Container      string              `json:"container"`
+	DebugContainer string              `json:"debug_container"`
+	Image          string              `json:"image"`
+	Service        string              `json:"service"`
+	File           datadog.ProfileFile `json:"file"`
+	Warnings       []string            `json:"warnings,omitempty"`
+}
+
+// DebugPrivileges describes what a debug-container capture does to the pod,
+// for confirmation prompts and tool descriptions.
+func DebugPrivileges() []string {
+	return []string{
+		"adds an ephemeral container to the pod; it cannot be removed and stays in the pod spec (terminated) until the pod is replaced",
+		"the container gets SYS_PTRACE (kubectl debug --profile general) and shares the target container's process namespace",
+		"the agent image runs inside the pod with access to the target process's memory",
+		"namespaces enforcing the baseline or restricted Pod Security Standard reject it",
+	}
+}
+
+func normalizeDebug(params DebugParams) (DebugParams, error) {
+	if params.Namespace == "" {
+		params.Namespace = "default"
+	}
+	if params.Pod == "" && params.Selector == "" && params.Workload == "" {
+		return params, errors.New("pod, selector, or workload is required")
+	}
+	if params.OutDir == "" {
+		return params, errors.New("out_dir is required")
+	}
+	if params.Image == "" {
+		params.Image = strings.TrimSpace(os.Getenv("PPROF_MCP_DEBUG_IMAGE"))
+	}
+	if params.Image == "" {
+		return params, errors.New("an agent image is required (image or PPROF_MCP_DEBUG_IMAGE); the default command needs perf and perf_to_profile in it")
+	}
+	if params.Command == "" {
+		params.Command = DefaultAgentCommand
+	}
+	if !strings.Contains(params.Command, "{output}") {
+		return params, errors.New("the agent command must write its profile to {output}")
+	}
+	if params.PID == "" {
+		params.PID = "1"
+	}
+	if params.Seconds <= 0 {
+		params.Seconds = defaultSeconds
+	}
+	if params.Service == "" {
+		switch {
+		case params.Workload != "":
+			params.Service = WorkloadName(params.Workload)
+		case params.Selector != "":
+			params.Service = ServiceFromSelector(params.Selector, params.Namespace)
+		default:
+			params.Service = params.Pod
+		}
+	}
+	return params, nil
+}
+
+// agentCommand fills in the command template.
+func agentCommand(params DebugParams) string {
+	return strings.NewReplacer(
+		"{pid}", params.PID,
+		"{seconds}", strconv.Itoa(params.Seconds),
+		"{output}", debugOutput,
+	).Replace(params.Command)
+}
+
+func debugArgs(params DebugParams, pod, container, name string) []string {
+	// The container outlives the capture only long enough to copy the
+	// profile out, then exits on its own.
+	linger := params.Seconds + int(debugCopyAllowed/time.Second)
+	return append(ContextArgs(params.KubeContext), "debug", "-n", params.Namespace, pod,
+		"--image", params.Image, "--target", container, "--profile", "general",
+		"--container", name, "--quiet", "--", "sleep", strconv.Itoa(linger))
+}
+
+func debugExecArgs(params DebugParams, pod, name string, command ...string) []string {
+	return append(append(ContextArgs(params.KubeContext), "exec", "-n", params.Namespace, pod, "-c", name, "--"), command...)
+}
+
+// CaptureWithDebugContainer injects an ephemeral agent container next to
+// the target container, runs the agent against the target process, and
+// copies the CPU profile it writes to OutDir/<pod>. It needs kubectl with
+// permission to patch pods/ephemeralcontainers and create pods/exec.
+func CaptureWithDebugContainer(ctx context.Context, params DebugParams) (DebugResult, error) {
+	params, err := normalizeDebug(params)
+	if err != nil {
+		return DebugResult{}, err
+	}
+	if Mode() == ModeInCluster {
+		return DebugResult{}, errors.New("debug-container capture runs kubectl debug and exec, which in-cluster mode does not support")
+	}
+	result := DebugResult{KubeContext: params.KubeContext, Namespace: params.Namespace, Image: params.Image, Service: params.Service}
+
+	pod, err := debugTarget(ctx, params)
+	if err != nil {
+		return result, err
+	}
+	result.Pod = pod.Name
+	result.Container = params.Container
+	if result.Container == "" {
+		if len(pod.Containers) == 0 {
+			return result, fmt.Errorf("pod %s lists no containers; pass container", pod.Name)
+		}
+		result.Container = pod.Containers[0].Name
+	}
+	result.DebugContainer = fmt.Sprintf("pprof-mcp-%05x", rand.IntN(1<<20))
+
+	if _, err := kubectl(ctx, debugArgs(params, pod.Name, result.Container, result.DebugContainer)...); err != nil {
+		return result, err
+	}
+	if err := waitForDebugContainer(ctx, params, pod.Name, result.DebugContainer); err != nil {
+		return result, err
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, time.Duration(params.Seconds)*time.Second+2*time.Minute)
+	defer cancel()
+	if _, err := kubectl(runCtx, debugExecArgs(params, pod.Name, result.DebugContainer, "sh", "-c", agentCommand(params))...); err != nil {
+		return result, fmt.Errorf("agent failed: %w", err)
+	}
+	data, err := kubectl(ctx, debugExecArgs(params, pod.Name, result.DebugContainer, "cat", debugOutput)...)
+	if err != nil {
+		return result, fmt.Errorf("copying the profile: %w", err)
+	}
+	if _, err := profile.ParseData(data); err != nil {
+		return result, fmt.Errorf("agent output is not a pprof profile: %w", err)
+	}
+
+	outDir := filepath.Join(params.OutDir, pod.Name)
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return result, err
+	}
+	dest := filepath.Join(outDir, fmt.Sprintf("%s_%s_cpu.pprof", params.Service, params.Namespace))
+	if err := os.WriteFile(dest, data, 0o644); err != nil {
+		return result, err
+	}
+	result.File = datadog.ProfileFile{Type: "cpu", Path: dest, Bytes: int64(len(data))}
+	result.Warnings = append(result.Warnings, fmt.Sprintf("ephemeral container %s stays in %s's spec until the pod is replaced", result.DebugContainer, pod.Name))
+	return result, nil
+}
+
+// debugTarget finds the named pod, or the first running pod of the selector
+// or workload.
+func debugTarget(ctx context.Context, params DebugParams) (PodInfo, error) {
+	selector := params.Selector
+	if params.Pod == "" && selector == "" {
+		var err error
+		selector, err = ResolveWorkloadSelector(ctx, params.KubeContext, params.Namespace, params.Workload)
+		if err != nil {
+			return PodInfo{}, err
+		}
+	}
+	pods, err := ListPods(ctx, params.KubeContext, params.Namespace, selector)
+	if err != nil {
+		return PodInfo{}, err
+	}
+	for _, pod := range pods {
+		if params.Pod != "" && pod.Name != params.Pod {
+			continue
+		}
+		if pod.Status != "Running" {
+			return PodInfo{}, fmt.Errorf("pod %s is %s, not Running", pod.Name, pod.Status)
+		}
+		return pod, nil
+	}
+	if params.Pod != "" {
+		return PodInfo{}, fmt.Errorf("pod %s not found in namespace %s", params.Pod, params.Namespace)
+	}
+	return PodInfo{}, fmt.Errorf("no running pods in namespace %s match %q", params.Namespace, selector)
+}
+
+// waitForDebugContainer polls the pod until the ephemeral container runs.
+func waitForDebugContainer(ctx context.Context, params DebugParams, pod, name string) error {
+	deadline := time.Now().Add(debugReadyWait)
+	for {
+		output, err := kubectl(ctx, append(ContextArgs(params.KubeContext), "get", "pod", "-n", params.Namespace, pod, "-o", "json")...)
+		if err != nil {
+			return err
+		}
+		running, reason, err := debugContainerState(output, name)
+		if err != nil {
+			return err
+		}
+		if running {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("ephemeral container %s did not start within %s (%s)", name, debugReadyWait, firstNonEmpty(reason, "no status"))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// debugContainerState reads an ephemeral container's state from pod JSON.
+// A terminated container is an error; a waiting one reports its reason.
+func debugContainerState(podJSON []byte, name string) (bool, string, error) {
+	var pod struct {
+		Status struct {
+			EphemeralContainerStatuses []struct {
+				Name  string `json:"name"`
+				State struct {
+					Running *struct{} `json:"running"`
+					Waiting *struct {
+						Reason  string `json:"reason"`
+						Message string `json:"message"`
+					} `json:"waiting"`
+					Terminated *struct {
+						Reason   string `json:"reason"`
+						ExitCode int    `json:"exitCode"`
+					} `json:"terminated"`
+				} `json:"state"`
+			} `json:"ephemeralContainerStatuses"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal(podJSON, &pod); err != nil {
+		return false, "", fmt.Errorf("failed to parse pod: %w", err)
+	}
+	for _, status := range pod.Status.EphemeralContainerStatuses {
+		if status.Name != name {
+			continue
+		}
+		switch {
+		case status.State.Running != nil:
+			return true, "", nil
+		case status.State.Terminated != nil:
+			return false, "", fmt.Errorf("ephemeral container %s exited (%s, code %d)", name, status.State.Terminated.Reason, status.State.Terminated.ExitCode)
+		case status.State.Waiting != nil:
+			return false, strings.TrimSpace(status.State.Waiting.Reason + " " + status.State.Waiting.Message), nil
+		}
+	}
+	return false, "", nil
+}
+
+// DebugCommands returns the kubectl commands a debug-container capture
+// runs, with <pod>, <container>, and <debug-container> standing in for
+// values known only at run time.
+func DebugCommands(params DebugParams) ([]string, error) {
+	params, err := normalizeDebug(params)
+	if err != nil {
+		return nil, err
+	}
+	var commands []string
+	pod := params.Pod
+	if pod == "" {
+		selector := params.Selector
+		if selector == "" {
+			commands = append(commands, "kubectl "+strings.Join(workloadSelectorArgs(params.KubeContext, params.Namespace, params.Workload), " "))
+			selector = "<selector>"
+		}
+		commands = append(commands, "kubectl "+strings.Join(getPodsArgs(params.KubeContext, params.Namespace, selector), " "))
+		pod = "<pod>"
+	}
+	container := firstNonEmpty(params.Container, "<container>")
+	name := "<debug-container>"
+	dest := filepath.Join(params.OutDir, pod, fmt.Sprintf("%s_%s_cpu.pprof", params.Service, params.Namespace))
+	commands = append(commands,
+		"kubectl "+strings.Join(debugArgs(params, pod, container, name), " "),
+		"kubectl "+strings.Join(debugExecArgs(params, pod, name, "sh", "-c", "'"+agentCommand(params)+"'"), " "),
+		"kubectl "+strings.Join(debugExecArgs(params, pod, name, "cat", debugOutput), " ")+" > "+dest,
+	)
+	return commands, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,62 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebugCommands(t *testing.T) {
+	commands, err := DebugCommands(DebugParams{Namespace: "prod", Workload: "deployment/api", Image: "agent:1", OutDir: "out", Seconds: 20})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"kubectl get deployment/api -n prod -o json",
+		"kubectl get pods -n prod -l <selector> -o json",
+		"kubectl debug -n prod <pod> --image agent:1 --target <container> --profile general --container <debug-container> --quiet -- sleep 620",
+		"kubectl exec -n prod <pod> -c <debug-container> -- sh -c 'perf record -F 99 -g -p 1 -o /tmp/perf.data -- sleep 20 && perf_to_profile -i /tmp/perf.data -o /tmp/pprof-mcp-cpu.pprof -f'",
+		"kubectl exec -n prod <pod> -c <debug-container> -- cat /tmp/pprof-mcp-cpu.pprof > out/<pod>/api_prod_cpu.pprof",
+	}, commands)
+
+	commands, err = DebugCommands(DebugParams{KubeContext: "staging", Pod: "api-1", Container: "app", Image: "agent:1", Command: "agent --pid {pid} --out {output}", PID: "7", OutDir: "out"})
+	require.NoError(t, err)
+	require.Equal(t, "kubectl --context staging debug -n default api-1 --image agent:1 --target app --profile general --container <debug-container> --quiet -- sleep 630", commands[0])
+	require.Equal(t, "kubectl --context staging exec -n default api-1 -c <debug-container> -- sh -c 'agent --pid 7 --out /tmp/pprof-mcp-cpu.pprof'", commands[1])
+}
+
+func TestNormalizeDebug(t *testing.T) {
+	t.Setenv("PPROF_MCP_DEBUG_IMAGE", "")
+	_, err := normalizeDebug(DebugParams{Pod: "api-1", OutDir: "out"})
+	require.ErrorContains(t, err, "agent image is required")
+
+	t.Setenv("PPROF_MCP_DEBUG_IMAGE", "agent:2")
+	params, err := normalizeDebug(DebugParams{Pod: "api-1", OutDir: "out"})
+	require.NoError(t, err)
+	require.Equal(t, "agent:2", params.Image)
+	require.Equal(t, "api-1", params.Service)
+
+	_, err = normalizeDebug(DebugParams{Pod: "api-1", OutDir: "out", Command: "agent --pid {pid}"})
+	require.ErrorContains(t, err, "{output}")
+}
+
+func TestDebugContainerState(t *testing.T) {
+	pod := []byte(`{"status":{"ephemeralContainerStatuses":[
+		{"name":"pprof-mcp-1","state":{"waiting":{"reason":"ImagePullBackOff","message":"not found"}}},
+		{"name":"pprof-mcp-2","state":{"running":{"startedAt":"2026-01-01T00:00:00Z"}}},
+		{"name":"pprof-mcp-3","state":{"terminated":{"reason":"Error","exitCode":1}}}]}}`)
+
+	running, reason, err := debugContainerState(pod, "pprof-mcp-1")
+	require.NoError(t, err)
+	require.False(t, running)
+	require.Equal(t, "ImagePullBackOff not found", reason)
+
+	running, _, err = debugContainerState(pod, "pprof-mcp-2")
+	require.NoError(t, err)
+	require.True(t, running)
+
+	_, _, err = debugContainerState(pod, "pprof-mcp-3")
+	require.ErrorContains(t, err, "exited (Error, code 1)")
+
+	running, _, err = debugContainerState(pod, "pprof-mcp-4")
+	require.NoError(t, err)
+	require.False(t, running)
+}
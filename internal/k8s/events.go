@@ -0,0 +1,225 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// recentRestart is how long after a container restart its profiles are
+// flagged as covering a fresh process
+const recentRestart = time.Hour
+
+// maxPodEvents caps the events kept per pod, newest first
+const maxPodEvents = 20
+
+// PodHealth is a pod's container restarts and recent events when it was
+// captured. A heap or goroutine profile from a container that was just
+// OOMKilled or restarted covers only the new process.
+type PodHealth struct {
+	Pod        string             `json:"pod"`
+	ReadAt     time.Time          `json:"read_at"`
+	Containers []ContainerRestart `json:"containers"`
+	Events     []PodEvent         `json:"events,omitempty"`
+}
+
+// ContainerRestart is one container's restart count and why it last exited
+type ContainerRestart struct {
+	Name         string    `json:"name"`
+	Ready        bool      `json:"ready"`
+	RestartCount int       `json:"restart_count"`
+	StartedAt    time.Time `json:"started_at,omitzero"`   // current run
+	LastReason   string    `json:"last_reason,omitempty"` // OOMKilled, Error, Completed, ...
+	LastExitCode int       `json:"last_exit_code,omitempty"`
+	LastFinished time.Time `json:"last_finished,omitzero"`
+	Waiting      string    `json:"waiting,omitempty"` // CrashLoopBackOff, ...
+}
+
+// PodEvent is a Kubernetes event about the pod, such as Unhealthy (a failed
+// probe), BackOff, Killing, or OOMKilling
+type PodEvent struct {
+	Type     string    `json:"type"` // Normal or Warning
+	Reason   string    `json:"reason"`
+	Message  string    `json:"message"`
+	Count    int       `json:"count"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// ReadPodHealth reads the pod's container statuses and its events.
+func ReadPodHealth(ctx context.Context, pod *PodInfo) (*PodHealth, error) {
+	api, err := clusterAPI(pod.Context)
+	if err != nil {
+		return nil, err
+	}
+	var podJSON, eventsJSON []byte
+	if api != nil {
+		podJSON, err = api.get(ctx, podsPath(pod.Namespace)+"/"+url.PathEscape(pod.Name), nil)
+	} else {
+		podJSON, err = kubectl(ctx, append(ContextArgs(pod.Context), "get", "pod", "-n", pod.Namespace, pod.Name, "-o", "json")...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if api != nil {
+		eventsJSON, err = api.get(ctx, eventsPath(pod.Namespace), url.Values{"fieldSelector": {eventSelector(pod.Name)}})
+	} else {
+		eventsJSON, err = kubectl(ctx, podEventsArgs(pod.Context, pod.Namespace, pod.Name)...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	health, err := parsePodHealth(podJSON, eventsJSON)
+	if err != nil {
+		return nil, err
+	}
+	health.Pod = pod.Name
+	health.ReadAt = time.Now().UTC()
+	return health, nil
+}
+
+// PodHealthCommands are the kubectl commands ReadPodHealth runs, for dry
+// runs; in in-cluster mode, the API server requests
+func PodHealthCommands(kubeContext, namespace, pod string) []string {
+	if Mode() == ModeInCluster {
+		return []string{
+			apiCommand(podsPath(namespace)+"/"+pod, nil),
+			apiCommand(eventsPath(namespace), url.Values{"fieldSelector": {eventSelector(pod)}}),
+		}
+	}
+	return []string{
+		"kubectl " + strings.Join(append(ContextArgs(kubeContext), "get", "pod", "-n", namespace, pod, "-o", "json"), " "),
+		"kubectl " + strings.Join(podEventsArgs(kubeContext, namespace, pod), " "),
+	}
+}
+
+func podEventsArgs(kubeContext, namespace, pod string) []string {
+	return append(ContextArgs(kubeContext), "get", "events", "-n", namespace, "--field-selector", eventSelector(pod), "-o", "json")
+}
+
+func eventSelector(pod string) string {
+	return "involvedObject.kind=Pod,involvedObject.name=" + pod
+}
+
+func eventsPath(namespace string) string {
+	return "/api/v1/namespaces/" + url.PathEscape(namespace) + "/events"
+}
+
+func parsePodHealth(podJSON, eventsJSON []byte) (*PodHealth, error) {
+	var pod struct {
+		Status struct {
+			ContainerStatuses []struct {
+				Name         string `json:"name"`
+				Ready        bool   `json:"ready"`
+				RestartCount int    `json:"restartCount"`
+				State        struct {
+					Running *struct {
+						StartedAt time.Time `json:"startedAt"`
+					} `json:"running"`
+					Waiting *struct {
+						Reason string `json:"reason"`
+					} `json:"waiting"`
+				} `json:"state"`
+				LastState struct {
+					Terminated *struct {
+						Reason     string    `json:"reason"`
+						ExitCode   int       `json:"exitCode"`
+						FinishedAt time.Time `json:"finishedAt"`
+					} `json:"terminated"`
+				} `json:"lastState"`
+			} `json:"containerStatuses"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal(podJSON, &pod); err != nil {
+		return nil, fmt.Errorf("failed to parse pod: %w", err)
+	}
+	var events struct {
+		Items []struct {
+			Type           string    `json:"type"`
+			Reason         string    `json:"reason"`
+			Message        string    `json:"message"`
+			Count          int       `json:"count"`
+			FirstTimestamp time.Time `json:"firstTimestamp"`
+			LastTimestamp  time.Time `json:"lastTimestamp"`
+			EventTime      time.Time `json:"eventTime"`
+			Series         *struct {
+				Count            int       `json:"count"`
+				LastObservedTime time.Time `json:"lastObservedTime"`
+			} `json:"series"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(eventsJSON, &events); err != nil {
+		return nil, fmt.Errorf("failed to parse events: %w", err)
+	}
+
+	health := &PodHealth{Containers: []ContainerRestart{}}
+	for _, status := range pod.Status.ContainerStatuses {
+		container := ContainerRestart{Name: status.Name, Ready: status.Ready, RestartCount: status.RestartCount}
+		if status.State.Running != nil {
+			container.StartedAt = status.State.Running.StartedAt
+		}
+		if status.State.Waiting != nil {
+			container.Waiting = status.State.Waiting.Reason
+		}
+		if last := status.LastState.Terminated; last != nil {
+			container.LastReason, container.LastExitCode, container.LastFinished = last.Reason, last.ExitCode, last.FinishedAt
+		}
+		health.Containers = append(health.Containers, container)
+	}
+	for _, item := range events.Items {
+		// Events recorded through events.k8s.io/v1 carry eventTime and a
+		// series instead of the core timestamps and count.
+		event := PodEvent{Type: item.Type, Reason: item.Reason, Message: item.Message, Count: max(item.Count, 1), LastSeen: item.LastTimestamp}
+		if item.Series != nil {
+			event.Count, event.LastSeen = item.Series.Count, item.Series.LastObservedTime
+		}
+		for _, fallback := range []time.Time{item.EventTime, item.FirstTimestamp} {
+			if event.LastSeen.IsZero() {
+				event.LastSeen = fallback
+			}
+		}
+		health.Events = append(health.Events, event)
+	}
+	sort.SliceStable(health.Events, func(i, j int) bool { return health.Events[i].LastSeen.After(health.Events[j].LastSeen) })
+	if len(health.Events) > maxPodEvents {
+		health.Events = health.Events[:maxPodEvents]
+	}
+	return health, nil
+}
+
+// Warnings flags what changes how the pod's profiles read: a container
+// that restarted within the last hour, one that was OOMKilled, and probe
+// failures.
+func (h *PodHealth) Warnings() []string {
+	if h == nil {
+		return nil
+	}
+	var warnings []string
+	for _, c := range h.Containers {
+		if c.LastReason == "OOMKilled" {
+			warnings = append(warnings, fmt.Sprintf("container %s was OOMKilled at %s (%d restarts): the heap profile covers the process started since, not the one that ran out of memory", c.Name, c.LastFinished.Format(time.RFC3339), c.RestartCount))
+		} else if c.RestartCount > 0 && !c.StartedAt.IsZero() && h.ReadAt.Sub(c.StartedAt) < recentRestart {
+			reason := c.LastReason
+			if reason == "" {
+				reason = "unknown reason"
+			}
+			warnings = append(warnings, fmt.Sprintf("container %s restarted %s before the capture (%s, %d restarts): heap, goroutines, and allocs cover only the new process", c.Name, h.ReadAt.Sub(c.StartedAt).Round(time.Second), reason, c.RestartCount))
+		}
+		if c.Waiting != "" {
+			warnings = append(warnings, fmt.Sprintf("container %s is waiting in %s", c.Name, c.Waiting))
+		}
+	}
+	probes := 0
+	for _, e := range h.Events {
+		if e.Reason == "Unhealthy" {
+			probes += e.Count
+		}
+	}
+	if probes > 0 {
+		warnings = append(warnings, fmt.Sprintf("pod %s failed %d health probes recently; see pod_health.events", h.Pod, probes))
+	}
+	return warnings
+}
@@ -0,0 +1,62 @@
+package k8s
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePodHealth(t *testing.T) {
+	podJSON := []byte(`{"status": {"containerStatuses": [
+		{"name": "app", "ready": true, "restartCount": 3,
+		 "state": {"running": {"startedAt": "2026-03-01T11:40:00Z"}},
+		 "lastState": {"terminated": {"reason": "OOMKilled", "exitCode": 137, "finishedAt": "2026-03-01T11:39:58Z"}}},
+		{"name": "proxy", "ready": false, "restartCount": 1,
+		 "state": {"waiting": {"reason": "CrashLoopBackOff"}},
+		 "lastState": {"terminated": {"reason": "Error", "exitCode": 1}}}
+	]}}`)
+	eventsJSON := []byte(`{"items": [
+		{"type": "Warning", "reason": "Unhealthy", "message": "Readiness probe failed", "count": 4, "lastTimestamp": "2026-03-01T11:30:00Z"},
+		{"type": "Normal", "reason": "Pulled", "message": "Container image pulled", "eventTime": "2026-03-01T11:39:59.123456Z", "lastTimestamp": null},
+		{"type": "Warning", "reason": "BackOff", "message": "Back-off restarting", "series": {"count": 7, "lastObservedTime": "2026-03-01T11:45:00Z"}}
+	]}`)
+	health, err := parsePodHealth(podJSON, eventsJSON)
+	require.NoError(t, err)
+	require.Equal(t, []ContainerRestart{
+		{Name: "app", Ready: true, RestartCount: 3, StartedAt: time.Date(2026, 3, 1, 11, 40, 0, 0, time.UTC), LastReason: "OOMKilled", LastExitCode: 137, LastFinished: time.Date(2026, 3, 1, 11, 39, 58, 0, time.UTC)},
+		{Name: "proxy", RestartCount: 1, LastReason: "Error", LastExitCode: 1, Waiting: "CrashLoopBackOff"},
+	}, health.Containers)
+	require.Len(t, health.Events, 3)
+	require.Equal(t, "BackOff", health.Events[0].Reason)
+	require.Equal(t, 7, health.Events[0].Count)
+	require.Equal(t, "Pulled", health.Events[1].Reason)
+	require.Equal(t, 1, health.Events[1].Count)
+	require.Equal(t, "Unhealthy", health.Events[2].Reason)
+
+	health.Pod, health.ReadAt = "api-1", time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	warnings := health.Warnings()
+	require.Len(t, warnings, 3)
+	require.Contains(t, warnings[0], "container app was OOMKilled at 2026-03-01T11:39:58Z (3 restarts)")
+	require.Equal(t, "container proxy is waiting in CrashLoopBackOff", warnings[1])
+	require.Equal(t, "pod api-1 failed 4 health probes recently; see pod_health.events", warnings[2])
+
+	_, err = parsePodHealth([]byte("not json"), eventsJSON)
+	require.Error(t, err)
+}
+
+func TestPodHealthRecentRestart(t *testing.T) {
+	started := time.Date(2026, 3, 1, 11, 50, 0, 0, time.UTC)
+	health := &PodHealth{
+		Pod:    "api-1",
+		ReadAt: started.Add(10 * time.Minute),
+		Containers: []ContainerRestart{
+			{Name: "app", RestartCount: 2, StartedAt: started, LastReason: "Error"},
+			{Name: "sidecar", RestartCount: 1, StartedAt: started.Add(-2 * time.Hour), LastReason: "Error"},
+		},
+	}
+	require.Equal(t, []string{
+		"container app restarted 10m0s before the capture (Error, 2 restarts): heap, goroutines, and allocs cover only the new process",
+	}, health.Warnings())
+	require.Nil(t, (*PodHealth)(nil).Warnings())
+}
@@ -0,0 +1,106 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+)
+
+// execProbeScript prints the path of the first HTTP client the container has
+const execProbeScript = "command -v curl || command -v wget"
+
+// execTransport answers HTTP requests by running curl or wget inside the
+// pod's container with kubectl exec, for clusters that forbid port-forward.
+// A request that fails inside the container comes back as an error rather
+// than a status code.
+type execTransport struct {
+	pod       PodInfo
+	container string
+	tool      string // curl or wget
+}
+
+// StartExecForward reaches the pod's remote port from inside its own
+// container, fetching each URL with whichever of curl and wget the image has.
+// Nothing runs between requests, so Stop is a no-op. It needs pods/exec and
+// works in kubectl mode only.
+func StartExecForward(ctx context.Context, pod *PodInfo, remotePort int, container string) (*PortForward, error) {
+	output, err := kubectl(ctx, podExecArgs(pod.Context, pod.Namespace, pod.Name, container, "sh", "-c", execProbeScript)...)
+	if err != nil {
+		return nil, err
+	}
+	tool := path.Base(strings.TrimSpace(string(output)))
+	if tool != "curl" && tool != "wget" {
+		return nil, fmt.Errorf("container has neither curl nor wget")
+	}
+	return &PortForward{
+		remotePort: remotePort,
+		base:       "http://127.0.0.1:" + strconv.Itoa(remotePort),
+		client:     &http.Client{Transport: &execTransport{pod: *pod, container: container, tool: tool}},
+		method:     "kubectl exec " + tool,
+	}, nil
+}
+
+func (t *execTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	command, err := t.command(req)
+	if err != nil {
+		return nil, err
+	}
+	ctx := req.Context()
+	// A CPU profile or trace is recorded for ?seconds= before curl returns.
+	if seconds, err := strconv.Atoi(req.URL.Query().Get("seconds")); err == nil && seconds > 0 {
+		ctx = cmdrun.ExpectDuration(ctx, time.Duration(seconds)*time.Second)
+	}
+	output, err := kubectl(ctx, podExecArgs(t.pod.Context, t.pod.Namespace, t.pod.Name, t.container, command...)...)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{},
+		Body:          io.NopCloser(bytes.NewReader(output)),
+		ContentLength: int64(len(output)),
+		Request:       req,
+	}, nil
+}
+
+// command is the curl or wget invocation for req, writing the body to stdout
+func (t *execTransport) command(req *http.Request) ([]string, error) {
+	url := req.URL.String()
+	if t.tool == "wget" {
+		// BusyBox wget only sends GET and cannot set most headers.
+		if req.Method != http.MethodGet {
+			return nil, fmt.Errorf("%s through kubectl exec needs curl in the container, which only has wget", req.Method)
+		}
+		return []string{"wget", "-q", "-O", "-", url}, nil
+	}
+	command := []string{"curl", "-sS", "-f"}
+	if req.Method != http.MethodGet {
+		command = append(command, "-X", req.Method)
+	}
+	for name, values := range req.Header {
+		for _, value := range values {
+			command = append(command, "-H", name+": "+value)
+		}
+	}
+	return append(command, url), nil
+}
+
+func podExecArgs(kubeContext, namespace, pod, container string, command ...string) []string {
+	args := append(ContextArgs(kubeContext), "exec", "-n", namespace, pod)
+	if container != "" {
+		args = append(args, "-c", container)
+	}
+	return append(append(args, "--"), command...)
+}
@@ -0,0 +1,80 @@
+package k8s
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+)
+
+// fakeKubectl puts a kubectl on PATH that answers the exec probe with tool
+// and echoes every other command line
+func fakeKubectl(t *testing.T, tool string) {
+	t.Helper()
+	dir := t.TempDir()
+	script := "#!/bin/sh\ncase \"$*\" in\n*'command -v curl'*) echo /usr/bin/" + tool + " ;;\n*) echo \"$@\" ;;\nesac\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "kubectl"), []byte(script), 0o755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestStartExecForward(t *testing.T) {
+	fakeKubectl(t, "curl")
+	pod := &PodInfo{Name: "api-1", Namespace: "prod", Context: "staging"}
+	pf, err := StartExecForward(context.Background(), pod, 6060, "app")
+	require.NoError(t, err)
+	defer pf.Stop()
+	require.Equal(t, "kubectl exec curl", pf.Method())
+
+	dest := filepath.Join(t.TempDir(), "heap.pprof")
+	_, err = fetchProfile(context.Background(), pf.HTTPClient(), pf.URL("/debug/pprof/heap"), dest)
+	require.NoError(t, err)
+	data, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	require.Equal(t, "--context staging exec -n prod api-1 -c app -- curl -sS -f http://127.0.0.1:6060/debug/pprof/heap\n", string(data))
+}
+
+func TestExecTransportWget(t *testing.T) {
+	fakeKubectl(t, "wget")
+	pf, err := StartExecForward(context.Background(), &PodInfo{Name: "api-1", Namespace: "prod"}, 6060, "")
+	require.NoError(t, err)
+	require.Equal(t, "kubectl exec wget", pf.Method())
+
+	resp, err := pf.HTTPClient().Get(pf.URL("/debug/pprof/goroutine"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, int64(len("exec -n prod api-1 -- wget -q -O - http://127.0.0.1:6060/debug/pprof/goroutine\n")), resp.ContentLength)
+
+	_, err = ApplyRates(context.Background(), pf.HTTPClient(), pf.URL(""), nil, Rates{Mutex: 5})
+	require.ErrorContains(t, err, "needs curl")
+}
+
+func TestStartExecForwardNoClient(t *testing.T) {
+	fakeKubectl(t, "")
+	_, err := StartExecForward(context.Background(), &PodInfo{Name: "api-1", Namespace: "prod"}, 6060, "")
+	require.ErrorContains(t, err, "neither curl nor wget")
+}
+
+func TestExecTransportAllowsForRecordingTime(t *testing.T) {
+	dir := t.TempDir()
+	// The exec probe answers at once; the fetch takes as long as a 1s CPU
+	// profile would.
+	script := "#!/bin/sh\ncase \"$*\" in\n*'command -v curl'*) echo /usr/bin/curl ;;\n*) sleep 1.5; echo profile ;;\nesac\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "kubectl"), []byte(script), 0o755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	cmdrun.SetTimeouts(map[string]int{cmdrun.Kubectl: 1})
+	t.Cleanup(func() { cmdrun.SetTimeouts(nil) })
+
+	pf, err := StartExecForward(context.Background(), &PodInfo{Name: "api-1", Namespace: "prod"}, 6060, "")
+	require.NoError(t, err)
+	resp, err := pf.HTTPClient().Get(pf.URL("/debug/pprof/profile?seconds=1"))
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	_, err = pf.HTTPClient().Get(pf.URL("/debug/pprof/heap"))
+	var timeout *cmdrun.TimeoutError
+	require.ErrorAs(t, err, &timeout)
+}
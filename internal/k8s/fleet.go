@@ -0,0 +1,71 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/arreyder/pprof-mcp/internal/pprof"
+)
+
+// FleetProfile is one profile type merged across every captured pod.
+type FleetProfile struct {
+	Type          string            `json:"type"`
+	Path          string            `json:"path"`
+	Pods          int               `json:"pods"`
+	Contributions []PodContribution `json:"contributions"`
+}
+
+// PodContribution is one pod's share of a fleet profile.
+type PodContribution struct {
+	Pod     string  `json:"pod"`
+	Samples int     `json:"samples"`
+	Total   int64   `json:"total"`
+	Pct     float64 `json:"pct"`
+}
+
+// mergeFleet merges each profile type across bundles into
+// OutDir/fleet/<service>_<namespace>_<type>.pprof. A type captured from a
+// single pod is reported with that pod's file rather than copied.
+func mergeFleet(ctx context.Context, params CaptureParams, selected []Endpoint, bundles []PodBundle) ([]FleetProfile, []string) {
+	var fleet []FleetProfile
+	var warnings []string
+	for _, ep := range selected {
+		var paths []string
+		podByPath := map[string]string{}
+		for _, bundle := range bundles {
+			for _, file := range bundle.Files {
+				if file.Type == ep.Type {
+					paths = append(paths, file.Path)
+					podByPath[file.Path] = bundle.Pod
+				}
+			}
+		}
+		if len(paths) == 0 {
+			continue
+		}
+
+		merged := paths[0]
+		if len(paths) > 1 {
+			merged = filepath.Join(params.OutDir, "fleet", fmt.Sprintf("%s_%s_%s", params.Service, params.Namespace, ep.Filename))
+			if err := os.MkdirAll(filepath.Dir(merged), 0o755); err != nil {
+				warnings = append(warnings, fmt.Sprintf("%s merge: %v", ep.Type, err))
+				continue
+			}
+			if _, err := pprof.RunMerge(ctx, pprof.MergeParams{Profiles: paths, OutputPath: merged}); err != nil {
+				warnings = append(warnings, fmt.Sprintf("%s merge: %v", ep.Type, err))
+				continue
+			}
+		}
+
+		contributions, contributionWarnings := pprof.MergeContributions(paths, "")
+		warnings = append(warnings, contributionWarnings...)
+		profile := FleetProfile{Type: ep.Type, Path: merged, Pods: len(paths), Contributions: []PodContribution{}}
+		for _, c := range contributions {
+			profile.Contributions = append(profile.Contributions, PodContribution{Pod: podByPath[c.Profile], Samples: c.Samples, Total: c.Total, Pct: c.Pct})
+		}
+		fleet = append(fleet, profile)
+	}
+	return fleet, warnings
+}
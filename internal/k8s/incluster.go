@@ -0,0 +1,244 @@
+package k8s
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Cluster access modes, chosen with PPROF_MCP_KUBE_MODE.
+const (
+	ModeAuto      = "auto"       // in-cluster inside a pod without kubectl, else kubectl
+	ModeKubectl   = "kubectl"    // shell out to kubectl with the user's kubeconfig
+	ModeInCluster = "in-cluster" // call the API server with the pod's service account
+)
+
+// serviceAccountDir is where Kubernetes mounts the pod's service account.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// Mode reports how cluster calls are made. PPROF_MCP_KUBE_MODE selects
+// kubectl or in-cluster explicitly; otherwise the in-cluster API is used only
+// when running in a pod with a service account token and no kubectl binary.
+func Mode() string {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("PPROF_MCP_KUBE_MODE"))) {
+	case ModeKubectl:
+		return ModeKubectl
+	case ModeInCluster, "incluster":
+		return ModeInCluster
+	}
+	if os.Getenv("KUBERNETES_SERVICE_HOST") == "" {
+		return ModeKubectl
+	}
+	if _, err := os.Stat(filepath.Join(serviceAccountDir, "token")); err != nil {
+		return ModeKubectl
+	}
+	if _, err := exec.LookPath("kubectl"); err == nil {
+		return ModeKubectl
+	}
+	return ModeInCluster
+}
+
+// apiClient calls the Kubernetes API server as the pod's service account.
+// It is an http.RoundTripper so pprof requests through the pod proxy carry
+// the same credentials.
+type apiClient struct {
+	host      string // scheme://host:port of the API server
+	tokenFile string // re-read per request; projected tokens rotate
+	transport http.RoundTripper
+}
+
+// inClusterAPI loads the service account once per process. Tests replace it.
+var inClusterAPI = sync.OnceValues(func() (*apiClient, error) {
+	return newInClusterAPI(serviceAccountDir)
+})
+
+func newInClusterAPI(dir string) (*apiClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("in-cluster mode needs KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT; is the server running in a pod?")
+	}
+	ca, err := os.ReadFile(filepath.Join(dir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("reading service account CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates in %s", filepath.Join(dir, "ca.crt"))
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return &apiClient{
+		host:      "https://" + net.JoinHostPort(host, port),
+		tokenFile: filepath.Join(dir, "token"),
+		transport: transport,
+	}, nil
+}
+
+// clusterAPI returns the in-cluster client, or nil when calls go through
+// kubectl. A kube context cannot be honored in-cluster: the service account
+// only reaches the cluster it runs in.
+func clusterAPI(kubeContext string) (*apiClient, error) {
+	if Mode() != ModeInCluster {
+		return nil, nil
+	}
+	if kubeContext != "" {
+		return nil, fmt.Errorf("kube context %q cannot be used in in-cluster mode", kubeContext)
+	}
+	return inClusterAPI()
+}
+
+// RoundTrip adds the service account token to requests for the API server.
+func (c *apiClient) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := os.ReadFile(c.tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading service account token: %w", err)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	return c.transport.RoundTrip(req)
+}
+
+func (c *apiClient) get(ctx context.Context, path string, query url.Values) ([]byte, error) {
+	target := c.host + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := (&http.Client{Transport: c}).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("GET %s failed: %w", path, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("GET %s failed: %w", path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, apiError(path, resp.StatusCode, body)
+	}
+	return body, nil
+}
+
+// apiError surfaces the message from a Kubernetes Status response, pointing
+// at RBAC when the service account was refused.
+func apiError(path string, status int, body []byte) error {
+	message := strings.TrimSpace(string(body))
+	var parsed struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &parsed) == nil && parsed.Message != "" {
+		message = parsed.Message
+	}
+	err := fmt.Errorf("GET %s failed: status %d: %s", path, status, message)
+	if status == http.StatusForbidden {
+		return fmt.Errorf("%w (grant the service account the role in docs/IN_CLUSTER.md)", err)
+	}
+	return err
+}
+
+func selectorQuery(selector string) url.Values {
+	if selector == "" {
+		return nil
+	}
+	return url.Values{"labelSelector": {selector}}
+}
+
+func podsPath(namespace string) string {
+	return "/api/v1/namespaces/" + url.PathEscape(namespace) + "/pods"
+}
+
+func metricsPath(namespace string) string {
+	return "/apis/metrics.k8s.io/v1beta1/namespaces/" + url.PathEscape(namespace) + "/pods"
+}
+
+// workloadPath maps kind/name onto its apps/v1 or batch/v1 resource.
+func workloadPath(namespace, workload string) (string, error) {
+	kind, name, _ := strings.Cut(workload, "/")
+	resource, ok := workloadKinds[strings.ToLower(kind)]
+	if !ok || name == "" {
+		return "", fmt.Errorf("unsupported workload %q", workload)
+	}
+	group := "/apis/apps/v1"
+	if resource == "job" || resource == "cronjob" {
+		group = "/apis/batch/v1"
+	}
+	return group + "/namespaces/" + url.PathEscape(namespace) + "/" + resource + "s/" + url.PathEscape(name), nil
+}
+
+func jobsPath(namespace string) string {
+	return "/apis/batch/v1/namespaces/" + url.PathEscape(namespace) + "/jobs"
+}
+
+// podProxyPath reaches a pod's port through the API server, which needs only
+// the pods/proxy permission rather than a streamed port-forward.
+func podProxyPath(namespace, pod, port string) string {
+	return podsPath(namespace) + "/" + pod + ":" + port + "/proxy"
+}
+
+// podUsage reads metrics-server's PodMetrics, summed over containers.
+func (c *apiClient) podUsage(ctx context.Context, namespace, selector, metric string) (map[string]float64, error) {
+	body, err := c.get(ctx, metricsPath(namespace), selectorQuery(selector))
+	if err != nil {
+		return nil, err
+	}
+	var list struct {
+		Items []struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+			Containers []struct {
+				Usage map[string]string `json:"usage"`
+			} `json:"containers"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse pod metrics: %w", err)
+	}
+	resource := "cpu"
+	if metric == StrategyMemory {
+		resource = "memory"
+	}
+	usage := map[string]float64{}
+	for _, item := range list.Items {
+		var total float64
+		for _, container := range item.Containers {
+			raw := container.Usage[resource]
+			if raw == "" {
+				continue
+			}
+			value, err := parseQuantity(raw, metric)
+			if err != nil {
+				return nil, fmt.Errorf("parsing %s usage of %s: %w", resource, item.Metadata.Name, err)
+			}
+			total += value
+		}
+		usage[item.Metadata.Name] = total
+	}
+	return usage, nil
+}
+
+// apiCommand renders the curl equivalent of an in-cluster API request.
+func apiCommand(path string, query url.Values, extra ...string) string {
+	target := "https://$KUBERNETES_SERVICE_HOST:$KUBERNETES_SERVICE_PORT" + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	args := []string{"curl", "-sf", "--cacert", filepath.Join(serviceAccountDir, "ca.crt"),
+		"-H", fmt.Sprintf(`"Authorization: Bearer $(cat %s)"`, filepath.Join(serviceAccountDir, "token"))}
+	args = append(args, extra...)
+	return strings.Join(append(args, `"`+target+`"`), " ")
+}
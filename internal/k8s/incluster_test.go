@@ -0,0 +1,114 @@
+package k8s
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAPIServer serves the API calls a capture makes and requires the
+// service account token on each of them.
+func fakeAPIServer(t *testing.T) *apiClient {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sa-token" {
+			http.Error(w, `{"kind":"Status","message":"Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/apis/apps/v1/namespaces/prod/deployments/api":
+			w.Write([]byte(`{"spec":{"selector":{"matchLabels":{"app":"api"}}}}`))
+		case "/api/v1/namespaces/prod/pods":
+			if r.URL.Query().Get("labelSelector") != "app=api" {
+				http.Error(w, "unexpected selector", http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"items":[
+				{"metadata":{"name":"api-1","namespace":"prod"},"status":{"phase":"Running","podIP":"10.0.0.1"}},
+				{"metadata":{"name":"api-2","namespace":"prod","annotations":{"pprof.port":"6060"}},"status":{"phase":"Running","podIP":"10.0.0.2"}}]}`))
+		case "/apis/metrics.k8s.io/v1beta1/namespaces/prod/pods":
+			w.Write([]byte(`{"items":[
+				{"metadata":{"name":"api-1"},"containers":[{"usage":{"cpu":"100m","memory":"64Mi"}},{"usage":{"cpu":"50m","memory":"16Mi"}}]},
+				{"metadata":{"name":"api-2"},"containers":[{"usage":{"cpu":"400m","memory":"32Mi"}}]}]}`))
+		case "/api/v1/namespaces/prod/pods/api-2:6060/proxy/debug/pprof/heap":
+			w.Write([]byte("heap"))
+		case "/api/v1/namespaces/denied/pods":
+			http.Error(w, `{"kind":"Status","message":"pods is forbidden"}`, http.StatusForbidden)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("sa-token\n"), 0o600))
+	return &apiClient{host: server.URL, tokenFile: tokenFile, transport: http.DefaultTransport}
+}
+
+func useInCluster(t *testing.T, api *apiClient) {
+	t.Helper()
+	t.Setenv("PPROF_MCP_KUBE_MODE", ModeInCluster)
+	previous := inClusterAPI
+	inClusterAPI = func() (*apiClient, error) { return api, nil }
+	t.Cleanup(func() { inClusterAPI = previous })
+}
+
+func TestMode(t *testing.T) {
+	t.Setenv("PPROF_MCP_KUBE_MODE", "incluster")
+	require.Equal(t, ModeInCluster, Mode())
+	t.Setenv("PPROF_MCP_KUBE_MODE", "kubectl")
+	require.Equal(t, ModeKubectl, Mode())
+	t.Setenv("PPROF_MCP_KUBE_MODE", "")
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	require.Equal(t, ModeKubectl, Mode())
+}
+
+func TestInClusterCapture(t *testing.T) {
+	useInCluster(t, fakeAPIServer(t))
+
+	result, err := Capture(context.Background(), CaptureParams{
+		Namespace: "prod",
+		Workload:  "deployment/api",
+		OutDir:    t.TempDir(),
+		Types:     []string{"heap"},
+		Strategy:  StrategyCPU,
+		MaxPods:   1,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "app=api", result.Selector)
+	require.Equal(t, []string{"api-2"}, result.Selection.Selected)
+	require.Equal(t, map[string]float64{"api-1": 150, "api-2": 400}, result.Selection.Usage)
+	require.Len(t, result.Bundles, 1)
+	require.Equal(t, "annotation pprof.port", result.Pods[0].PortSource)
+	data, err := os.ReadFile(result.Bundles[0].Files[0].Path)
+	require.NoError(t, err)
+	require.Equal(t, "heap", string(data))
+}
+
+func TestInClusterErrors(t *testing.T) {
+	useInCluster(t, fakeAPIServer(t))
+
+	_, err := ListPods(context.Background(), "", "denied", "")
+	require.ErrorContains(t, err, "pods is forbidden")
+	require.ErrorContains(t, err, "docs/IN_CLUSTER.md")
+
+	_, err = ListPods(context.Background(), "staging", "prod", "app=api")
+	require.ErrorContains(t, err, "cannot be used in in-cluster mode")
+}
+
+func TestInClusterCaptureCommands(t *testing.T) {
+	useInCluster(t, fakeAPIServer(t))
+
+	commands, err := CaptureCommands(CaptureParams{Namespace: "prod", Selector: "app=api", OutDir: "out", Types: []string{"heap"}})
+	require.NoError(t, err)
+	auth := `curl -sf --cacert /var/run/secrets/kubernetes.io/serviceaccount/ca.crt -H "Authorization: Bearer $(cat /var/run/secrets/kubernetes.io/serviceaccount/token)"`
+	require.Equal(t, []string{
+		auth + ` "https://$KUBERNETES_SERVICE_HOST:$KUBERNETES_SERVICE_PORT/api/v1/namespaces/prod/pods?labelSelector=app%3Dapi"`,
+		auth + ` -o out/<pod>/api_prod_heap.pprof "https://$KUBERNETES_SERVICE_HOST:$KUBERNETES_SERVICE_PORT/api/v1/namespaces/prod/pods/<pod>:<port>/proxy/debug/pprof/heap"`,
+	}, commands)
+}
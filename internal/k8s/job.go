@@ -0,0 +1,356 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const defaultJobWait = 10 * time.Minute
+
+// jobPollInterval is how often CaptureJob lists pods while waiting for one
+// to start running.
+var jobPollInterval = 2 * time.Second
+
+// Phases reported in JobCaptureResult.Finished.
+const (
+	PhaseSucceeded = "Succeeded"
+	PhaseFailed    = "Failed"
+	PhaseGone      = "Gone" // deleted before its phase could be read
+)
+
+// JobParams captures one pod of a Job, or of the next run of a CronJob.
+// Workload is job/<name> or cronjob/<name>; MaxPods, All, Strategy, Node,
+// and Merge do not apply.
+type JobParams struct {
+	CaptureParams
+	// Wait bounds how long to wait for a pod to reach Running (default 10m).
+	Wait time.Duration
+	// At starts the capture this fraction (0-1) of ExpectedRuntime after the
+	// pod started; 0 captures as soon as it is Running.
+	At float64
+	// ExpectedRuntime is how long one run takes. For a CronJob it defaults
+	// to the duration of its last successful Job. It also caps the CPU
+	// profile so the profile ends before the pod does.
+	ExpectedRuntime time.Duration
+}
+
+// JobCaptureResult is the outcome of CaptureJob.
+type JobCaptureResult struct {
+	KubeContext     string     `json:"kube_context,omitempty"`
+	Namespace       string     `json:"namespace"`
+	Workload        string     `json:"workload"`
+	Selector        string     `json:"selector"`
+	Job             string     `json:"job,omitempty"` // the pod's job-name label
+	Pod             PodStatus  `json:"pod"`
+	Bundle          *PodBundle `json:"bundle,omitempty"`
+	PodStarted      time.Time  `json:"pod_started"`
+	CaptureStarted  time.Time  `json:"capture_started"`
+	ExpectedRuntime float64    `json:"expected_runtime_seconds,omitempty"`
+	Seconds         int        `json:"seconds"` // CPU profile duration actually used
+	// Finished is the pod's phase when it exited before every profile was
+	// fetched: Succeeded, Failed, or Gone.
+	Finished string   `json:"finished,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// CaptureJob waits for a Running pod of a Job or CronJob, optionally until a
+// point in its expected runtime, and captures it once. Point-in-time
+// profiles are fetched before the CPU profile so a pod that exits mid-way
+// still leaves some behind; the pod finishing is reported in Finished, and
+// an error is returned only when nothing was fetched.
+func CaptureJob(ctx context.Context, params JobParams) (JobCaptureResult, error) {
+	params, selected, err := normalizeJob(params)
+	if err != nil {
+		return JobCaptureResult{}, err
+	}
+	kind, name, _ := strings.Cut(params.Workload, "/")
+	result := JobCaptureResult{KubeContext: params.KubeContext, Namespace: params.Namespace, Workload: params.Workload}
+	match := func(PodInfo) bool { return true }
+	if kind == "job" {
+		params.Selector = "job-name=" + name
+	} else {
+		if params.Selector, err = ResolveWorkloadSelector(ctx, params.KubeContext, params.Namespace, params.Workload); err != nil {
+			return result, err
+		}
+		// The template labels are shared with any other workload using them;
+		// the Jobs a CronJob creates are named <cronjob>-<schedule time>.
+		match = func(pod PodInfo) bool { return strings.HasPrefix(pod.Labels["job-name"], name+"-") }
+	}
+	result.Selector = params.Selector
+
+	if params.At > 0 && params.ExpectedRuntime <= 0 {
+		if kind == "job" {
+			return result, fmt.Errorf("at needs expected_runtime for %s", params.Workload)
+		}
+		if params.ExpectedRuntime, err = lastJobRuntime(ctx, params.KubeContext, params.Namespace, name); err != nil {
+			return result, err
+		}
+	}
+	result.ExpectedRuntime = params.ExpectedRuntime.Seconds()
+
+	pod, err := waitForJobPod(ctx, params, match)
+	if err != nil {
+		return result, err
+	}
+	result.Job = pod.Labels["job-name"]
+	result.PodStarted = pod.StartTime
+	if result.PodStarted.IsZero() {
+		result.PodStarted = time.Now().UTC()
+	}
+	if params.At > 0 {
+		start := result.PodStarted.Add(time.Duration(params.At * float64(params.ExpectedRuntime)))
+		if err := sleepUntil(ctx, start); err != nil {
+			return result, err
+		}
+	}
+	if params.ExpectedRuntime > 0 && hasCPU(selected) {
+		left := time.Until(result.PodStarted.Add(params.ExpectedRuntime))
+		if left < time.Duration(params.Seconds)*time.Second {
+			seconds := max(1, int(left.Seconds()))
+			result.Warnings = append(result.Warnings, fmt.Sprintf("CPU profile shortened from %ds to %ds to end before the expected completion", params.Seconds, seconds))
+			params.Seconds = seconds
+		}
+	}
+	result.Seconds = params.Seconds
+	result.CaptureStarted = time.Now().UTC()
+
+	statuses, bundles, _ := captureFleet(ctx, []PodInfo{pod}, 1, params.PodTimeout, func(ctx context.Context, pod PodInfo) (PodBundle, error) {
+		return capturePod(ctx, params.CaptureParams, selected, pod)
+	})
+	result.Pod = statuses[0]
+	result.Warnings = append(result.Warnings, throttleWarnings(statuses)...)
+	if len(bundles) > 0 {
+		result.Bundle = &bundles[0]
+	}
+	if result.Pod.Status == PodCaptured {
+		return result, nil
+	}
+	// A failed fetch usually means the run ended under the capture.
+	if phase := podPhase(context.WithoutCancel(ctx), params.CaptureParams, pod.Name); phase != "" {
+		result.Finished = phase
+		result.Warnings = append(result.Warnings, fmt.Sprintf("pod %s finished (%s) during the capture; profiles not fetched by then are missing", pod.Name, phase))
+	}
+	if result.Bundle != nil {
+		return result, nil
+	}
+	if result.Finished != "" {
+		return result, fmt.Errorf("pod %s finished (%s) before any profile was fetched; capture earlier (lower at) or shorten seconds", pod.Name, result.Finished)
+	}
+	return result, errors.New(result.Pod.Error)
+}
+
+func normalizeJob(params JobParams) (JobParams, []Endpoint, error) {
+	kind, _, _ := strings.Cut(params.Workload, "/")
+	if kind != "job" && kind != "cronjob" {
+		return params, nil, fmt.Errorf("job capture needs a job/<name> or cronjob/<name> target, got %q", firstNonEmpty(params.Workload, params.Selector))
+	}
+	if params.At < 0 || params.At >= 1 {
+		return params, nil, fmt.Errorf("at must be a fraction of the expected runtime between 0 and 1, got %g", params.At)
+	}
+	if params.Wait <= 0 {
+		params.Wait = defaultJobWait
+	}
+	params.Selector, params.Strategy, params.Merge = "", "", false
+	captureParams, selected, err := normalizeCapture(params.CaptureParams)
+	if err != nil {
+		return params, nil, err
+	}
+	params.CaptureParams = captureParams
+	return params, jobOrder(selected), nil
+}
+
+// jobOrder fetches the point-in-time profiles first, so they survive the
+// pod exiting during the CPU profile, and the cumulative mutex and block
+// profiles last, so they cover the CPU window.
+func jobOrder(selected []Endpoint) []Endpoint {
+	rank := func(ep Endpoint) int {
+		switch ep.Type {
+		case "cpu":
+			return 1
+		case "mutex", "block":
+			return 2
+		}
+		return 0
+	}
+	ordered := append([]Endpoint(nil), selected...)
+	sort.SliceStable(ordered, func(i, j int) bool { return rank(ordered[i]) < rank(ordered[j]) })
+	return ordered
+}
+
+// waitForJobPod polls for a Running pod until params.Wait runs out. Pods
+// that already finished are remembered for the timeout error.
+func waitForJobPod(ctx context.Context, params JobParams, match func(PodInfo) bool) (PodInfo, error) {
+	deadline := time.Now().Add(params.Wait)
+	var seen []string
+	for {
+		pods, err := ListPods(ctx, params.KubeContext, params.Namespace, params.Selector)
+		if err != nil {
+			return PodInfo{}, err
+		}
+		seen = seen[:0]
+		for _, pod := range pods {
+			if !match(pod) {
+				continue
+			}
+			if pod.Status == "Running" {
+				return pod, nil
+			}
+			seen = append(seen, pod.Name+" "+pod.Status)
+		}
+		if !time.Now().Before(deadline) {
+			message := fmt.Sprintf("no pod of %s reached Running within %s", params.Workload, params.Wait)
+			if len(seen) > 0 {
+				message += " (seen: " + strings.Join(seen, ", ") + ")"
+			}
+			return PodInfo{}, errors.New(message)
+		}
+		if err := sleepUntil(ctx, time.Now().Add(jobPollInterval)); err != nil {
+			return PodInfo{}, err
+		}
+	}
+}
+
+// podPhase reports Succeeded, Failed, or Gone for a pod that is no longer
+// running, and "" while it still runs or cannot be listed.
+func podPhase(ctx context.Context, params CaptureParams, name string) string {
+	pods, err := ListPods(ctx, params.KubeContext, params.Namespace, params.Selector)
+	if err != nil {
+		return ""
+	}
+	for _, pod := range pods {
+		if pod.Name != name {
+			continue
+		}
+		if pod.Status == PhaseSucceeded || pod.Status == PhaseFailed {
+			return pod.Status
+		}
+		return ""
+	}
+	return PhaseGone
+}
+
+type jobList struct {
+	Items []struct {
+		Metadata struct {
+			Name            string `json:"name"`
+			OwnerReferences []struct {
+				Kind string `json:"kind"`
+				Name string `json:"name"`
+			} `json:"ownerReferences"`
+		} `json:"metadata"`
+		Status struct {
+			Succeeded      int        `json:"succeeded"`
+			StartTime      *time.Time `json:"startTime"`
+			CompletionTime *time.Time `json:"completionTime"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+// lastJobRuntime is how long the most recent successful Job of a CronJob
+// ran, from its start to its completion.
+func lastJobRuntime(ctx context.Context, kubeContext, namespace, cronJob string) (time.Duration, error) {
+	api, err := clusterAPI(kubeContext)
+	if err != nil {
+		return 0, err
+	}
+	var output []byte
+	if api != nil {
+		output, err = api.get(ctx, jobsPath(namespace), nil)
+	} else {
+		output, err = kubectl(ctx, getJobsArgs(kubeContext, namespace)...)
+	}
+	if err != nil {
+		return 0, err
+	}
+	var list jobList
+	if err := json.Unmarshal(output, &list); err != nil {
+		return 0, fmt.Errorf("failed to parse job list: %w", err)
+	}
+	var latest time.Time
+	var runtime time.Duration
+	for _, job := range list.Items {
+		owned := false
+		for _, owner := range job.Metadata.OwnerReferences {
+			owned = owned || owner.Kind == "CronJob" && owner.Name == cronJob
+		}
+		status := job.Status
+		if !owned || status.Succeeded == 0 || status.StartTime == nil || status.CompletionTime == nil {
+			continue
+		}
+		if status.CompletionTime.After(latest) {
+			latest = *status.CompletionTime
+			runtime = status.CompletionTime.Sub(*status.StartTime)
+		}
+	}
+	if latest.IsZero() {
+		return 0, fmt.Errorf("at needs expected_runtime: cronjob/%s has no completed job to estimate it from", cronJob)
+	}
+	return runtime, nil
+}
+
+func getJobsArgs(kubeContext, namespace string) []string {
+	return append(ContextArgs(kubeContext), "get", "jobs", "-n", namespace, "-o", "json")
+}
+
+func sleepUntil(ctx context.Context, at time.Time) error {
+	wait := time.Until(at)
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// JobCaptureCommands returns the commands CaptureJob runs. The pod list is
+// polled until a pod is Running; <pod> and <local-port> stand in for values
+// known only then.
+func JobCaptureCommands(params JobParams) ([]string, error) {
+	params, selected, err := normalizeJob(params)
+	if err != nil {
+		return nil, err
+	}
+	kind, name, _ := strings.Cut(params.Workload, "/")
+	if kind == "job" {
+		params.Selector = "job-name=" + name
+	}
+	if Mode() == ModeInCluster && params.KubeContext != "" {
+		return nil, fmt.Errorf("kube context %q cannot be used in in-cluster mode", params.KubeContext)
+	}
+	commands, err := captureCommands(params.CaptureParams, selected)
+	if err != nil {
+		return nil, err
+	}
+	// commands starts with the cronjob lookup, if any, then the pod list.
+	podsAt := 0
+	if kind == "cronjob" {
+		podsAt = 1
+	}
+	var before, after []string
+	if params.At > 0 {
+		offset := fmt.Sprintf("%g%% of the last run", params.At*100)
+		if params.ExpectedRuntime > 0 {
+			offset = time.Duration(params.At * float64(params.ExpectedRuntime)).String()
+		} else if Mode() == ModeInCluster {
+			before = append(before, apiCommand(jobsPath(params.Namespace), nil))
+		} else {
+			before = append(before, "kubectl "+strings.Join(getJobsArgs(params.KubeContext, params.Namespace), " "))
+		}
+		after = append(after, fmt.Sprintf("sleep <until %s after the pod started>", offset))
+	}
+	out := append([]string{}, commands[:podsAt]...)
+	out = append(out, before...)
+	out = append(out, commands[podsAt])
+	out = append(out, after...)
+	return append(out, commands[podsAt+1:]...), nil
+}
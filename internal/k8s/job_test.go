@@ -0,0 +1,105 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCaptureJobPodFinishes(t *testing.T) {
+	previous := jobPollInterval
+	jobPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { jobPollInterval = previous })
+
+	started := time.Now().UTC().Format(time.RFC3339Nano)
+	var listed atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/apis/batch/v1/namespaces/batch/cronjobs/nightly":
+			w.Write([]byte(`{"spec":{"jobTemplate":{"spec":{"template":{"metadata":{"labels":{"app":"report"}}}}}}}`))
+		case "/apis/batch/v1/namespaces/batch/jobs":
+			w.Write([]byte(`{"items":[
+				{"metadata":{"name":"nightly-90","ownerReferences":[{"kind":"CronJob","name":"nightly"}]},"status":{"succeeded":1,"startTime":"2026-01-01T00:00:00Z","completionTime":"2026-01-01T00:00:02Z"}},
+				{"metadata":{"name":"nightly-80","ownerReferences":[{"kind":"CronJob","name":"nightly"}]},"status":{"succeeded":1,"startTime":"2025-12-31T00:00:00Z","completionTime":"2025-12-31T01:00:00Z"}}]}`))
+		case "/api/v1/namespaces/batch/pods":
+			require.Equal(t, "app=report", r.URL.Query().Get("labelSelector"))
+			phase := []string{"Pending", "Running", "Succeeded"}[min(int(listed.Add(1))-1, 2)]
+			fmt.Fprintf(w, `{"items":[
+				{"metadata":{"name":"adhoc-1","namespace":"batch","labels":{"app":"report","job-name":"adhoc"}},"status":{"phase":"Running"}},
+				{"metadata":{"name":"nightly-100-x","namespace":"batch","labels":{"app":"report","job-name":"nightly-100"}},"status":{"phase":%q,"startTime":%q}}]}`, phase, started)
+		case "/api/v1/namespaces/batch/pods/nightly-100-x:6060/proxy/debug/pprof/heap":
+			w.Write([]byte("heap"))
+		case "/api/v1/namespaces/batch/pods/nightly-100-x:6060/proxy/debug/pprof/profile":
+			require.Equal(t, "1", r.URL.Query().Get("seconds"))
+			http.Error(w, "pod not running", http.StatusBadGateway)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("sa-token\n"), 0o600))
+	useInCluster(t, &apiClient{host: server.URL, tokenFile: tokenFile, transport: http.DefaultTransport})
+
+	out := t.TempDir()
+	result, err := CaptureJob(context.Background(), JobParams{
+		CaptureParams: CaptureParams{Namespace: "batch", Workload: "cronjob/nightly", OutDir: out, Types: []string{"cpu", "heap"}},
+		At:            0.25,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "nightly-100", result.Job)
+	require.Equal(t, "app=report", result.Selector)
+	require.Equal(t, 2.0, result.ExpectedRuntime)
+	require.Equal(t, 1, result.Seconds)
+	require.Equal(t, PodPartial, result.Pod.Status)
+	require.Equal(t, PhaseSucceeded, result.Finished)
+	require.Len(t, result.Bundle.Files, 1)
+	require.Equal(t, "heap", result.Bundle.Files[0].Type)
+	require.Equal(t, filepath.Join(out, "nightly-100-x", "nightly_batch_heap.pprof"), result.Bundle.Files[0].Path)
+	require.Len(t, result.Warnings, 2)
+	require.False(t, result.CaptureStarted.Before(result.PodStarted.Add(500*time.Millisecond)))
+}
+
+func TestCaptureJobValidation(t *testing.T) {
+	_, err := CaptureJob(context.Background(), JobParams{CaptureParams: CaptureParams{Workload: "deployment/api", OutDir: "out"}})
+	require.ErrorContains(t, err, "job/<name> or cronjob/<name>")
+	_, err = CaptureJob(context.Background(), JobParams{CaptureParams: CaptureParams{Workload: "job/migrate", OutDir: "out"}, At: 1.5})
+	require.ErrorContains(t, err, "between 0 and 1")
+	_, err = CaptureJob(context.Background(), JobParams{CaptureParams: CaptureParams{Workload: "job/migrate", OutDir: "out"}, At: 0.5})
+	require.ErrorContains(t, err, "at needs expected_runtime")
+}
+
+func TestJobCaptureCommands(t *testing.T) {
+	commands, err := JobCaptureCommands(JobParams{
+		CaptureParams:   CaptureParams{Namespace: "batch", Workload: "job/migrate", OutDir: "out", Types: []string{"cpu", "heap"}, SkipCgroup: true},
+		At:              0.5,
+		ExpectedRuntime: 10 * time.Minute,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"kubectl get pods -n batch -l job-name=migrate -o json",
+		"sleep <until 5m0s after the pod started>",
+		"kubectl port-forward -n batch <pod> <local-port>:<port>",
+		"curl -sf -o out/<pod>/migrate_batch_heap.pprof 'http://127.0.0.1:<local-port>/debug/pprof/heap'",
+		"curl -sf -o out/<pod>/migrate_batch_cpu.pprof 'http://127.0.0.1:<local-port>/debug/pprof/profile?seconds=30'",
+	}, commands)
+
+	commands, err = JobCaptureCommands(JobParams{CaptureParams: CaptureParams{Namespace: "batch", Workload: "cronjob/nightly", OutDir: "out", Types: []string{"heap"}, SkipCgroup: true}, At: 0.5})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"kubectl get cronjob/nightly -n batch -o json",
+		"kubectl get jobs -n batch -o json",
+		"kubectl get pods -n batch -l <selector> -o json",
+		"sleep <until 50% of the last run after the pod started>",
+		"kubectl port-forward -n batch <pod> <local-port>:<port>",
+		"curl -sf -o out/<pod>/nightly_batch_heap.pprof 'http://127.0.0.1:<local-port>/debug/pprof/heap'",
+	}, commands)
+}
@@ -0,0 +1,330 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+)
+
+// PodInfo contains information about a discovered pod
+type PodInfo struct {
+	Name        string
+	Namespace   string
+	IP          string
+	Status      string
+	Labels      map[string]string
+	Annotations map[string]string
+	Node        string
+	StartTime   time.Time
+	Context     string // kube context the pod was listed from; "" is the current one
+	Containers  []Container
+}
+
+// Container is the part of a pod's container spec used to find its pprof
+// port and to compare its configuration across clusters
+type Container struct {
+	Name      string          `json:"name"`
+	Image     string          `json:"image"`
+	Ports     []ContainerPort `json:"ports"`
+	Args      []string        `json:"-"` // command followed by args
+	Env       []EnvVar        `json:"env"`
+	Resources Resources       `json:"resources"`
+}
+
+// Resources are a container's requests and limits as quantities ("500m",
+// "1Gi")
+type Resources struct {
+	Requests map[string]string `json:"requests"`
+	Limits   map[string]string `json:"limits"`
+}
+
+type ContainerPort struct {
+	Name          string `json:"name"`
+	ContainerPort int    `json:"containerPort"`
+}
+
+// EnvVar is a literal environment variable; valueFrom references are skipped
+type EnvVar struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// PortForward manages a kubectl port-forward session, or in in-cluster mode
+// the API server's proxy to the pod
+type PortForward struct {
+	cmd        *exec.Cmd
+	localPort  int
+	remotePort int
+	cancel     context.CancelFunc
+	base       string       // plain-HTTP URL reaching the remote port
+	client     *http.Client // client for requests to base
+	method     string       // how requests reach the pod, for warnings
+	stderr     *syncBuffer  // kubectl port-forward's stderr
+}
+
+type podList struct {
+	Items []struct {
+		Metadata struct {
+			Name        string            `json:"name"`
+			Namespace   string            `json:"namespace"`
+			Labels      map[string]string `json:"labels"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+		Spec struct {
+			NodeName   string `json:"nodeName"`
+			Containers []struct {
+				Container
+				Command []string `json:"command"`
+				Args    []string `json:"args"`
+			} `json:"containers"`
+		} `json:"spec"`
+		Status struct {
+			Phase     string    `json:"phase"`
+			PodIP     string    `json:"podIP"`
+			StartTime time.Time `json:"startTime"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+// ListPods returns the pods in namespace matching the label selector, using
+// kubeContext or, when empty, the current context.
+func ListPods(ctx context.Context, kubeContext, namespace, selector string) ([]PodInfo, error) {
+	api, err := clusterAPI(kubeContext)
+	if err != nil {
+		return nil, err
+	}
+	var output []byte
+	if api != nil {
+		output, err = api.get(ctx, podsPath(namespace), selectorQuery(selector))
+	} else {
+		output, err = kubectl(ctx, getPodsArgs(kubeContext, namespace, selector)...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var result podList
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse pod list: %w", err)
+	}
+	pods := make([]PodInfo, 0, len(result.Items))
+	for _, item := range result.Items {
+		containers := make([]Container, 0, len(item.Spec.Containers))
+		for _, c := range item.Spec.Containers {
+			container := c.Container
+			container.Args = append(append([]string{}, c.Command...), c.Args...)
+			containers = append(containers, container)
+		}
+		pods = append(pods, PodInfo{
+			Name:        item.Metadata.Name,
+			Namespace:   item.Metadata.Namespace,
+			IP:          item.Status.PodIP,
+			Status:      item.Status.Phase,
+			Labels:      item.Metadata.Labels,
+			Annotations: item.Metadata.Annotations,
+			Node:        item.Spec.NodeName,
+			StartTime:   item.Status.StartTime,
+			Context:     kubeContext,
+			Containers:  containers,
+		})
+	}
+	return pods, nil
+}
+
+func getPodsArgs(kubeContext, namespace, selector string) []string {
+	args := append(ContextArgs(kubeContext), "get", "pods", "-n", namespace)
+	if selector != "" {
+		args = append(args, "-l", selector)
+	}
+	return append(args, "-o", "json")
+}
+
+func portForwardArgs(kubeContext, namespace, pod, localPort, remotePort string) []string {
+	return append(ContextArgs(kubeContext), "port-forward", "-n", namespace, pod, localPort+":"+remotePort)
+}
+
+// ContextArgs returns the kubectl flag selecting kubeContext, or nothing for
+// the current context.
+func ContextArgs(kubeContext string) []string {
+	if kubeContext == "" {
+		return nil
+	}
+	return []string{"--context", kubeContext}
+}
+
+func kubectl(ctx context.Context, args ...string) ([]byte, error) {
+	output, err := cmdrun.Output(ctx, cmdrun.Kubectl, "kubectl", args...)
+	if err != nil {
+		// Name the subcommand, not a leading --context flag.
+		verb := args[0]
+		if verb == "--context" && len(args) > 2 {
+			verb = args[2]
+		}
+		var timeout *cmdrun.TimeoutError
+		var exitErr *exec.ExitError
+		if !errors.As(err, &timeout) && errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("kubectl %s failed: %s", verb, string(exitErr.Stderr))
+		}
+		return nil, fmt.Errorf("kubectl %s failed: %w", verb, err)
+	}
+	return output, nil
+}
+
+// StartPortForward starts a kubectl port-forward to the pod's remote port. In
+// in-cluster mode nothing is started; requests go through the API server's
+// pod proxy instead.
+func StartPortForward(ctx context.Context, pod *PodInfo, remotePort int) (*PortForward, error) {
+	api, err := clusterAPI(pod.Context)
+	if err != nil {
+		return nil, err
+	}
+	if api != nil {
+		return &PortForward{
+			remotePort: remotePort,
+			base:       api.host + podProxyPath(pod.Namespace, pod.Name, strconv.Itoa(remotePort)),
+			client:     &http.Client{Transport: api},
+			method:     "pod proxy",
+		}, nil
+	}
+
+	// Find an available local port
+	localPort, err := findAvailablePort()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find available port: %w", err)
+	}
+
+	// Create a cancellable context for the port-forward command
+	fwdCtx, cancel := context.WithCancel(ctx)
+
+	cmd := exec.CommandContext(fwdCtx, "kubectl", portForwardArgs(pod.Context, pod.Namespace, pod.Name, strconv.Itoa(localPort), strconv.Itoa(remotePort))...)
+	stderr := &syncBuffer{}
+	cmd.Stderr = stderr
+
+	// Start the port-forward in the background
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to start port-forward: %w", err)
+	}
+
+	pf := &PortForward{
+		cmd:        cmd,
+		localPort:  localPort,
+		remotePort: remotePort,
+		cancel:     cancel,
+		base:       fmt.Sprintf("http://127.0.0.1:%d", localPort),
+		client:     http.DefaultClient,
+		method:     "port-forward",
+		stderr:     stderr,
+	}
+
+	// Wait for port-forward to be ready
+	if err := pf.waitForReady(ctx); err != nil {
+		pf.Stop()
+		return nil, err
+	}
+
+	return pf, nil
+}
+
+// LocalPort returns the local port being forwarded (0 through the pod proxy)
+func (pf *PortForward) LocalPort() int {
+	return pf.localPort
+}
+
+// URL returns the plain-HTTP URL of path on the pod's remote port
+func (pf *PortForward) URL(path string) string {
+	return pf.base + path
+}
+
+// HTTPClient returns the client to use for URL
+func (pf *PortForward) HTTPClient() *http.Client {
+	return pf.client
+}
+
+// Method names how requests reach the pod: port-forward, pod proxy, or
+// kubectl exec with curl or wget
+func (pf *PortForward) Method() string {
+	return pf.method
+}
+
+// Stop terminates the port-forward
+func (pf *PortForward) Stop() {
+	if pf.cancel != nil {
+		pf.cancel()
+	}
+	if pf.cmd != nil && pf.cmd.Process != nil {
+		_ = pf.cmd.Process.Kill()
+		_ = pf.cmd.Wait()
+	}
+}
+
+// waitForReady waits for the port-forward to be ready by attempting to connect
+func (pf *PortForward) waitForReady(ctx context.Context) error {
+	timeout := time.After(10 * time.Second)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	addr := fmt.Sprintf("127.0.0.1:%d", pf.localPort)
+
+	for {
+		select {
+		case <-timeout:
+			// A forbidden port-forward exits at once with the reason.
+			if reason := strings.TrimSpace(pf.stderr.String()); reason != "" {
+				return fmt.Errorf("timeout waiting for port-forward to be ready: %s", reason)
+			}
+			return fmt.Errorf("timeout waiting for port-forward to be ready")
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			conn, err := net.DialTimeout("tcp", addr, 100*time.Millisecond)
+			if err == nil {
+				_ = conn.Close()
+				// Give it a bit more time to stabilize
+				time.Sleep(200 * time.Millisecond)
+				return nil
+			}
+		}
+	}
+}
+
+// findAvailablePort finds an available local port
+func findAvailablePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	return addr.Port, nil
+}
+
+// syncBuffer is a bytes.Buffer safe to write from a running command while
+// it is read
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
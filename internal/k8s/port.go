@@ -0,0 +1,135 @@
+package k8s
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// PortAnnotations are read, in order, for a pod's pprof port.
+var PortAnnotations = []string{"pprof.port", "pprof/port", "profiling/port"}
+
+// PortNames are container port names that usually serve net/http/pprof,
+// most specific first.
+var PortNames = []string{"pprof", "profiling", "debug", "admin"}
+
+// DiscoverPort works out where pod serves net/http/pprof when no port was
+// given: the port its spec declares (see PodPort), and otherwise 6060. The
+// source names which one was used so a wrong guess can be traced.
+func DiscoverPort(pod PodInfo) (int, string) {
+	if port, source, ok := PodPort(pod); ok {
+		return port, source
+	}
+	return defaultPort, "default"
+}
+
+// PodPort finds the pprof port a pod spec declares: a pprof port
+// annotation, a container port named pprof, profiling, debug, or admin, a
+// pprof/debug/admin address in container args or env, or a declared 6060.
+func PodPort(pod PodInfo) (int, string, bool) {
+	for _, key := range PortAnnotations {
+		if port, ok := ParsePort(pod.Annotations[key]); ok {
+			return port, "annotation " + key, true
+		}
+	}
+	for _, name := range PortNames {
+		for _, container := range pod.Containers {
+			for _, port := range container.Ports {
+				if strings.EqualFold(port.Name, name) && port.ContainerPort > 0 {
+					return port.ContainerPort, fmt.Sprintf("container port %s/%s", container.Name, port.Name), true
+				}
+			}
+		}
+	}
+	for _, container := range pod.Containers {
+		if port, flag, ok := PortFromArgs(container.Args); ok {
+			return port, fmt.Sprintf("%s arg %s", container.Name, flag), true
+		}
+	}
+	for _, container := range pod.Containers {
+		for _, env := range container.Env {
+			if !PortSetting(env.Name) {
+				continue
+			}
+			if port, ok := ParsePort(env.Value); ok {
+				return port, fmt.Sprintf("%s env %s", container.Name, env.Name), true
+			}
+		}
+	}
+	for _, container := range pod.Containers {
+		for _, port := range container.Ports {
+			if port.ContainerPort == defaultPort {
+				return defaultPort, fmt.Sprintf("container port %s/%d", container.Name, defaultPort), true
+			}
+		}
+	}
+	return 0, "", false
+}
+
+// PortFromArgs finds flags such as --pprof-addr=:6060, -debug.port 8081, or
+// --admin-listen localhost:9000.
+func PortFromArgs(args []string) (int, string, bool) {
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "-") {
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if !PortSetting(name) {
+			continue
+		}
+		if !hasValue && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			value = args[i+1]
+		}
+		if port, ok := ParsePort(value); ok {
+			return port, name, true
+		}
+	}
+	return 0, "", false
+}
+
+// PortSetting reports whether a flag or environment variable name looks like
+// a pprof, debug, or admin listen address or port.
+func PortSetting(name string) bool {
+	name = strings.ToLower(name)
+	return containsAny(name, "pprof", "profil", "debug", "admin") && containsAny(name, "addr", "port", "listen", "bind")
+}
+
+func containsAny(s string, subs ...string) bool {
+	for _, sub := range subs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParsePort accepts 6060, :6060, localhost:6060, or http://0.0.0.0:6060/debug.
+func ParsePort(value string) (int, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if strings.Contains(value, "://") {
+		parsed, err := url.Parse(value)
+		if err != nil {
+			return 0, false
+		}
+		value = parsed.Host
+	}
+	if i := strings.LastIndex(value, ":"); i >= 0 {
+		value = value[i+1:]
+	}
+	port, err := strconv.Atoi(value)
+	if err != nil || port <= 0 || port > 65535 {
+		return 0, false
+	}
+	return port, true
+}
+
+func portLabel(port int) string {
+	if port <= 0 {
+		return "<port>"
+	}
+	return strconv.Itoa(port)
+}
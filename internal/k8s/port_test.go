@@ -0,0 +1,78 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscoverPort(t *testing.T) {
+	tests := []struct {
+		name   string
+		pod    PodInfo
+		port   int
+		source string
+	}{
+		{
+			name:   "annotation wins",
+			pod:    PodInfo{Annotations: map[string]string{"pprof.port": "7070"}, Containers: []Container{{Name: "app", Ports: []ContainerPort{{Name: "pprof", ContainerPort: 6060}}}}},
+			port:   7070,
+			source: "annotation pprof.port",
+		},
+		{
+			name:   "named port",
+			pod:    PodInfo{Containers: []Container{{Name: "app", Ports: []ContainerPort{{Name: "http", ContainerPort: 8080}, {Name: "admin", ContainerPort: 9001}}}}},
+			port:   9001,
+			source: "container port app/admin",
+		},
+		{
+			name:   "flag with separate value",
+			pod:    PodInfo{Containers: []Container{{Name: "app", Args: []string{"/server", "--listen", ":8080", "--debug-addr", "localhost:8081"}}}},
+			port:   8081,
+			source: "app arg debug-addr",
+		},
+		{
+			name:   "flag with url",
+			pod:    PodInfo{Containers: []Container{{Name: "app", Args: []string{"--pprof.listen=http://0.0.0.0:6061/"}}}},
+			port:   6061,
+			source: "app arg pprof.listen",
+		},
+		{
+			name:   "env",
+			pod:    PodInfo{Containers: []Container{{Name: "app", Env: []EnvVar{{Name: "PORT", Value: "8080"}, {Name: "PPROF_ADDR", Value: ":6062"}}}}},
+			port:   6062,
+			source: "app env PPROF_ADDR",
+		},
+		{
+			name:   "declared default",
+			pod:    PodInfo{Containers: []Container{{Name: "app", Ports: []ContainerPort{{ContainerPort: 6060}}}}},
+			port:   6060,
+			source: "container port app/6060",
+		},
+		{
+			name:   "fallback",
+			pod:    PodInfo{Annotations: map[string]string{"pprof.port": "none"}},
+			port:   6060,
+			source: "default",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port, source := DiscoverPort(tt.pod)
+			require.Equal(t, tt.port, port)
+			require.Equal(t, tt.source, source)
+		})
+	}
+}
+
+func TestParsePort(t *testing.T) {
+	for value, want := range map[string]int{"6060": 6060, ":6060": 6060, "[::1]:6060": 6060, "https://host:8443/debug": 8443} {
+		port, ok := ParsePort(value)
+		require.True(t, ok, value)
+		require.Equal(t, want, port, value)
+	}
+	for _, value := range []string{"", "host", "70000", "http://host/"} {
+		_, ok := ParsePort(value)
+		require.False(t, ok, value)
+	}
+}
@@ -0,0 +1,124 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultRatePath is where ApplyRates expects the service's rate endpoint
+const DefaultRatePath = "/debug/pprof/rates"
+
+// rateRestoreTimeout bounds putting the previous rates back, which runs
+// even after the capture is cancelled
+const rateRestoreTimeout = 10 * time.Second
+
+// Rates are the mutex and block profiling rates set for a capture. Mutex is
+// the runtime.SetMutexProfileFraction fraction, Block the
+// runtime.SetBlockProfileRate rate in nanoseconds; 0 leaves a rate as it is.
+type Rates struct {
+	Mutex int `json:"mutex"`
+	Block int `json:"block"`
+	// Path is the rate endpoint on the pprof port (default DefaultRatePath)
+	Path string `json:"-"`
+}
+
+// Enabled reports whether any rate is set
+func (r Rates) Enabled() bool {
+	return r.Mutex > 0 || r.Block > 0
+}
+
+func (r Rates) path() string {
+	if r.Path != "" {
+		return r.Path
+	}
+	return DefaultRatePath
+}
+
+// query encodes the rates to set
+func (r Rates) query() url.Values {
+	values := url.Values{}
+	if r.Mutex > 0 {
+		values.Set("mutex", strconv.Itoa(r.Mutex))
+	}
+	if r.Block > 0 {
+		values.Set("block", strconv.Itoa(r.Block))
+	}
+	return values
+}
+
+// SetURL is the request that sets the rates, relative to the pprof port
+func (r Rates) SetURL() string {
+	return r.path() + "?" + r.query().Encode()
+}
+
+// RestoreURL is the request that puts previous rates back, with
+// placeholders standing in for the values the endpoint reports
+func (r Rates) RestoreURL() string {
+	var terms []string
+	if r.Mutex > 0 {
+		terms = append(terms, "mutex=<previous>")
+	}
+	if r.Block > 0 {
+		terms = append(terms, "block=<previous>")
+	}
+	return r.path() + "?" + strings.Join(terms, "&")
+}
+
+// ApplyRates sets the rates with PUT <path>?mutex=N&block=N against baseURL.
+// The endpoint applies them and answers with the rates it replaced as JSON
+// ({"mutex": N, "block": N}); an empty body means both were off. The
+// returned restore function puts the replaced rates back.
+func ApplyRates(ctx context.Context, client *http.Client, baseURL string, header http.Header, rates Rates) (func() error, error) {
+	previous, err := putRates(ctx, client, baseURL+rates.SetURL(), header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set profiling rates: %w", err)
+	}
+	restore := url.Values{}
+	if rates.Mutex > 0 {
+		restore.Set("mutex", strconv.Itoa(previous.Mutex))
+	}
+	if rates.Block > 0 {
+		restore.Set("block", strconv.Itoa(previous.Block))
+	}
+	return func() error {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rateRestoreTimeout)
+		defer cancel()
+		if _, err := putRates(ctx, client, baseURL+rates.path()+"?"+restore.Encode(), header); err != nil {
+			return fmt.Errorf("failed to restore profiling rates: %w", err)
+		}
+		return nil
+	}, nil
+}
+
+func putRates(ctx context.Context, client *http.Client, url string, header http.Header) (Rates, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, nil)
+	if err != nil {
+		return Rates{}, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Rates{}, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode != http.StatusOK {
+		return Rates{}, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var previous Rates
+	if len(strings.TrimSpace(string(body))) > 0 {
+		if err := json.Unmarshal(body, &previous); err != nil {
+			return Rates{}, fmt.Errorf("unexpected response %q: %w", strings.TrimSpace(string(body)), err)
+		}
+	}
+	return previous, nil
+}
@@ -0,0 +1,52 @@
+package k8s
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyRates(t *testing.T) {
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPut, r.Method)
+		require.Equal(t, "secret", r.Header.Get("Ductone-Token"))
+		requests = append(requests, r.URL.String())
+		if len(requests) == 1 {
+			_, _ = w.Write([]byte(`{"mutex": 5, "block": 0}`))
+		}
+	}))
+	defer srv.Close()
+
+	header := http.Header{"Ductone-Token": []string{"secret"}}
+	restore, err := ApplyRates(context.Background(), srv.Client(), srv.URL, header, Rates{Mutex: 100, Block: 1000})
+	require.NoError(t, err)
+	require.NoError(t, restore())
+	require.Equal(t, []string{"/debug/pprof/rates?block=1000&mutex=100", "/debug/pprof/rates?block=0&mutex=5"}, requests)
+}
+
+func TestApplyRatesUnsupported(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	_, err := ApplyRates(context.Background(), srv.Client(), srv.URL, nil, Rates{Mutex: 10, Path: "/admin/rates"})
+	require.ErrorContains(t, err, "status 404")
+}
+
+func TestCaptureCommandsWithRates(t *testing.T) {
+	commands, err := CaptureCommands(CaptureParams{Namespace: "prod", Selector: "app=foo", Port: 6060, OutDir: "out", Seconds: 10, Types: []string{"mutex"}, Rates: Rates{Mutex: 10}})
+	require.NoError(t, err)
+	var rateCommands []string
+	for _, command := range commands {
+		if strings.Contains(command, "/debug/pprof/rates") {
+			rateCommands = append(rateCommands, command)
+		}
+	}
+	require.Len(t, rateCommands, 2)
+	require.Contains(t, rateCommands[0], "mutex=10")
+	require.Contains(t, rateCommands[1], "mutex=<previous>")
+}
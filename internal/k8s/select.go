@@ -0,0 +1,230 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/arreyder/pprof-mcp/internal/datadog"
+)
+
+// Pod selection strategies for CaptureParams.Strategy.
+const (
+	StrategyFirst  = "first"  // pods in kubectl order (default)
+	StrategyCPU    = "cpu"    // highest CPU usage first
+	StrategyMemory = "memory" // highest memory (RSS) first
+	StrategyOldest = "oldest" // longest-running first
+	StrategyRandom = "random" // a random sample
+)
+
+// Strategies lists the accepted Strategy values.
+func Strategies() []string {
+	return []string{StrategyFirst, StrategyCPU, StrategyMemory, StrategyOldest, StrategyRandom}
+}
+
+// UsageSource reports a resource metric ("cpu" in millicores or "memory" in
+// bytes) for pods in a namespace, keyed by pod name. Pods it does not know
+// about are ranked last.
+type UsageSource func(ctx context.Context, namespace, selector, metric string) (map[string]float64, error)
+
+// Selection records how the captured pods were chosen.
+type Selection struct {
+	Strategy string             `json:"strategy"`
+	Node     string             `json:"node,omitempty"`
+	Matched  int                `json:"matched"`
+	Selected []string           `json:"selected"`
+	Usage    map[string]float64 `json:"usage,omitempty"` // the metric the strategy ranked by
+}
+
+func normalizeStrategy(strategy string) (string, error) {
+	strategy = strings.ToLower(strings.TrimSpace(strategy))
+	switch strategy {
+	case "":
+		return StrategyFirst, nil
+	case "rss", "mem":
+		return StrategyMemory, nil
+	case StrategyFirst, StrategyCPU, StrategyMemory, StrategyOldest, StrategyRandom:
+		return strategy, nil
+	}
+	return "", fmt.Errorf("unknown pod selection strategy %q (want %s)", strategy, strings.Join(Strategies(), ", "))
+}
+
+// SelectPods keeps the running pods (on params.Node, if set), orders them by
+// params.Strategy, and caps them at MaxPods unless All is set.
+func SelectPods(ctx context.Context, params CaptureParams, pods []PodInfo) ([]PodInfo, Selection, error) {
+	selection := Selection{Strategy: params.Strategy, Node: params.Node}
+	var candidates []PodInfo
+	for _, pod := range pods {
+		if pod.Status != "Running" {
+			continue
+		}
+		if params.Node != "" && pod.Node != params.Node {
+			continue
+		}
+		candidates = append(candidates, pod)
+	}
+	selection.Matched = len(candidates)
+	if len(candidates) == 0 {
+		where := ""
+		if params.Node != "" {
+			where = " on node " + params.Node
+		}
+		return nil, selection, fmt.Errorf("no running pods%s in namespace %s match %q", where, params.Namespace, params.Selector)
+	}
+
+	switch params.Strategy {
+	case StrategyCPU, StrategyMemory:
+		source := params.Usage
+		if source == nil {
+			source = MetricsServerUsage(params.KubeContext)
+		}
+		usage, err := source(ctx, params.Namespace, params.Selector, params.Strategy)
+		if err != nil {
+			return nil, selection, fmt.Errorf("%s strategy: %w", params.Strategy, err)
+		}
+		selection.Usage = map[string]float64{}
+		for _, pod := range candidates {
+			if value, ok := usage[pod.Name]; ok {
+				selection.Usage[pod.Name] = value
+			}
+		}
+		if len(selection.Usage) == 0 {
+			return nil, selection, fmt.Errorf("%s strategy: no usage reported for the %d matching pods", params.Strategy, len(candidates))
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			vi, iok := selection.Usage[candidates[i].Name]
+			vj, jok := selection.Usage[candidates[j].Name]
+			if iok != jok {
+				return iok
+			}
+			return vi > vj
+		})
+	case StrategyOldest:
+		sort.SliceStable(candidates, func(i, j int) bool {
+			ti, tj := candidates[i].StartTime, candidates[j].StartTime
+			if ti.IsZero() != tj.IsZero() {
+				return !ti.IsZero()
+			}
+			return ti.Before(tj)
+		})
+	case StrategyRandom:
+		rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+	}
+
+	if !params.All && len(candidates) > params.MaxPods {
+		candidates = candidates[:params.MaxPods]
+	}
+	for _, pod := range candidates {
+		selection.Selected = append(selection.Selected, pod.Name)
+	}
+	return candidates, selection, nil
+}
+
+// MetricsServerUsage reads pod usage from metrics-server via `kubectl top`,
+// or from the metrics API directly in in-cluster mode.
+func MetricsServerUsage(kubeContext string) UsageSource {
+	return func(ctx context.Context, namespace, selector, metric string) (map[string]float64, error) {
+		api, err := clusterAPI(kubeContext)
+		if err != nil {
+			return nil, err
+		}
+		if api != nil {
+			usage, err := api.podUsage(ctx, namespace, selector, metric)
+			if err != nil {
+				return nil, fmt.Errorf("%w (is metrics-server installed?)", err)
+			}
+			return usage, nil
+		}
+		output, err := kubectl(ctx, topPodsArgs(kubeContext, namespace, selector)...)
+		if err != nil {
+			return nil, fmt.Errorf("%w (is metrics-server installed?)", err)
+		}
+		return parseTopPods(string(output), metric)
+	}
+}
+
+func topPodsArgs(kubeContext, namespace, selector string) []string {
+	args := append(ContextArgs(kubeContext), "top", "pods", "-n", namespace)
+	if selector != "" {
+		args = append(args, "-l", selector)
+	}
+	return append(args, "--no-headers")
+}
+
+// parseTopPods reads `kubectl top pods --no-headers` lines such as
+// "api-7d9f 250m 512Mi".
+func parseTopPods(output, metric string) (map[string]float64, error) {
+	usage := map[string]float64{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		raw := fields[1]
+		if metric == StrategyMemory {
+			raw = fields[2]
+		}
+		value, err := parseQuantity(raw, metric)
+		if err != nil {
+			return nil, fmt.Errorf("parsing kubectl top output %q: %w", line, err)
+		}
+		usage[fields[0]] = value
+	}
+	return usage, nil
+}
+
+// parseQuantity converts CPU (250m, 2) to millicores and memory (512Mi, 1G)
+// to bytes.
+func parseQuantity(value, metric string) (float64, error) {
+	units := []struct {
+		suffix string
+		scale  float64
+	}{
+		{"Ki", 1 << 10}, {"Mi", 1 << 20}, {"Gi", 1 << 30}, {"Ti", 1 << 40},
+		{"k", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12},
+		{"m", 1}, {"n", 1e-6}, {"u", 1e-3},
+	}
+	for _, unit := range units {
+		if number, ok := strings.CutSuffix(value, unit.suffix); ok {
+			parsed, err := strconv.ParseFloat(number, 64)
+			if err != nil {
+				return 0, err
+			}
+			return parsed * unit.scale, nil
+		}
+	}
+	// A bare number is whole CPU cores or plain bytes.
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if metric == StrategyCPU {
+		parsed *= 1000
+	}
+	return parsed, nil
+}
+
+// DatadogUsage reads pod usage from the Datadog agent's Kubernetes metrics,
+// averaged over the last ten minutes, for clusters without metrics-server.
+func DatadogUsage(env, site string) UsageSource {
+	return func(ctx context.Context, namespace, _ string, metric string) (map[string]float64, error) {
+		query := datadog.PodUsageParams{Namespace: namespace, Env: env, Site: site, Metric: "kubernetes.memory.rss"}
+		if metric == StrategyCPU {
+			query.Metric = "kubernetes.cpu.usage.total"
+		}
+		usage, err := datadog.QueryPodUsage(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		if metric == StrategyCPU {
+			// Reported in nanocores.
+			for pod, value := range usage {
+				usage[pod] = value / 1e6
+			}
+		}
+		return usage, nil
+	}
+}
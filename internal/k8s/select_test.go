@@ -0,0 +1,77 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectPods(t *testing.T) {
+	now := time.Now()
+	pods := []PodInfo{
+		{Name: "api-1", Status: "Running", Node: "node-a", StartTime: now.Add(-time.Hour)},
+		{Name: "api-2", Status: "Running", Node: "node-b", StartTime: now.Add(-3 * time.Hour)},
+		{Name: "api-3", Status: "Pending", Node: "node-b"},
+		{Name: "api-4", Status: "Running", Node: "node-b", StartTime: now.Add(-2 * time.Hour)},
+	}
+	usage := func(_ context.Context, _, _, metric string) (map[string]float64, error) {
+		if metric == StrategyCPU {
+			return map[string]float64{"api-1": 120, "api-4": 900}, nil
+		}
+		return map[string]float64{"api-1": 3 << 20, "api-2": 1 << 30, "api-4": 5 << 20}, nil
+	}
+	names := func(pods []PodInfo) []string {
+		var out []string
+		for _, pod := range pods {
+			out = append(out, pod.Name)
+		}
+		return out
+	}
+
+	for _, tc := range []struct {
+		params CaptureParams
+		want   []string
+	}{
+		{CaptureParams{Strategy: StrategyFirst, MaxPods: 2}, []string{"api-1", "api-2"}},
+		{CaptureParams{Strategy: StrategyFirst, MaxPods: 1, All: true}, []string{"api-1", "api-2", "api-4"}},
+		{CaptureParams{Strategy: StrategyCPU, MaxPods: 5}, []string{"api-4", "api-1", "api-2"}},
+		{CaptureParams{Strategy: StrategyMemory, MaxPods: 1}, []string{"api-2"}},
+		{CaptureParams{Strategy: StrategyOldest, MaxPods: 2}, []string{"api-2", "api-4"}},
+		{CaptureParams{Strategy: StrategyFirst, MaxPods: 5, Node: "node-b"}, []string{"api-2", "api-4"}},
+	} {
+		tc.params.Usage = usage
+		selected, selection, err := SelectPods(context.Background(), tc.params, pods)
+		require.NoError(t, err)
+		require.Equal(t, tc.want, names(selected), "%+v", tc.params)
+		require.Equal(t, tc.want, selection.Selected)
+	}
+
+	selected, _, err := SelectPods(context.Background(), CaptureParams{Strategy: StrategyRandom, MaxPods: 2}, pods)
+	require.NoError(t, err)
+	require.Len(t, selected, 2)
+
+	_, _, err = SelectPods(context.Background(), CaptureParams{Strategy: StrategyFirst, MaxPods: 5, Node: "node-c"}, pods)
+	require.ErrorContains(t, err, "on node node-c")
+
+	_, err = normalizeStrategy("busiest")
+	require.ErrorContains(t, err, "unknown pod selection strategy")
+	strategy, err := normalizeStrategy("RSS")
+	require.NoError(t, err)
+	require.Equal(t, StrategyMemory, strategy)
+}
+
+func TestParseTopPods(t *testing.T) {
+	output := "api-1   250m   512Mi\napi-2   2      1Gi\n\n"
+	cpu, err := parseTopPods(output, StrategyCPU)
+	require.NoError(t, err)
+	require.Equal(t, map[string]float64{"api-1": 250, "api-2": 2000}, cpu)
+
+	memory, err := parseTopPods(output, StrategyMemory)
+	require.NoError(t, err)
+	require.Equal(t, map[string]float64{"api-1": 512 << 20, "api-2": 1 << 30}, memory)
+
+	_, err = parseTopPods("api-1 lots 1Mi", StrategyCPU)
+	require.Error(t, err)
+}
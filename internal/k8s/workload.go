@@ -0,0 +1,117 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// workloadKinds maps accepted kind spellings to kubectl resource names.
+var workloadKinds = map[string]string{
+	"deployment":  "deployment",
+	"deployments": "deployment",
+	"deploy":      "deployment",
+	"statefulset": "statefulset",
+	"sts":         "statefulset",
+	"daemonset":   "daemonset",
+	"ds":          "daemonset",
+	"replicaset":  "replicaset",
+	"rs":          "replicaset",
+	"job":         "job",
+	"jobs":        "job",
+	"cronjob":     "cronjob",
+	"cronjobs":    "cronjob",
+	"cj":          "cronjob",
+}
+
+// ParseTarget splits a capture target into a workload (kind/name, e.g.
+// deployment/api) or a label selector (app=api).
+func ParseTarget(target string) (workload, selector string, err error) {
+	target = strings.TrimSpace(target)
+	if kind, name, ok := strings.Cut(target, "/"); ok && !strings.ContainsAny(target, "=!") {
+		resource, known := workloadKinds[strings.ToLower(kind)]
+		if !known || name == "" {
+			return "", "", fmt.Errorf("unsupported workload %q (want deployment/, statefulset/, daemonset/, replicaset/, job/, or cronjob/<name>)", target)
+		}
+		return resource + "/" + name, "", nil
+	}
+	if target == "" || !strings.ContainsAny(target, "=!") && !strings.Contains(target, " in ") {
+		return "", "", fmt.Errorf("target %q must be kind/name (e.g. deployment/api) or a label selector (e.g. app=api)", target)
+	}
+	return "", target, nil
+}
+
+// WorkloadName returns the name part of kind/name.
+func WorkloadName(workload string) string {
+	_, name, _ := strings.Cut(workload, "/")
+	return name
+}
+
+// ResolveWorkloadSelector reads a workload's spec.selector.matchLabels. A
+// CronJob has no selector of its own; its job template's pod labels are
+// used instead.
+func ResolveWorkloadSelector(ctx context.Context, kubeContext, namespace, workload string) (string, error) {
+	api, err := clusterAPI(kubeContext)
+	if err != nil {
+		return "", err
+	}
+	var output []byte
+	if api != nil {
+		path, pathErr := workloadPath(namespace, workload)
+		if pathErr != nil {
+			return "", pathErr
+		}
+		output, err = api.get(ctx, path, nil)
+	} else {
+		output, err = kubectl(ctx, workloadSelectorArgs(kubeContext, namespace, workload)...)
+	}
+	if err != nil {
+		return "", err
+	}
+	var object struct {
+		Spec struct {
+			Selector struct {
+				MatchLabels map[string]string `json:"matchLabels"`
+			} `json:"selector"`
+			JobTemplate struct {
+				Spec struct {
+					Template struct {
+						Metadata struct {
+							Labels map[string]string `json:"labels"`
+						} `json:"metadata"`
+					} `json:"template"`
+				} `json:"spec"`
+			} `json:"jobTemplate"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(output, &object); err != nil {
+		return "", fmt.Errorf("failed to parse %s: %w", workload, err)
+	}
+	if strings.HasPrefix(workload, "cronjob/") {
+		selector := selectorFromLabels(object.Spec.JobTemplate.Spec.Template.Metadata.Labels)
+		if selector == "" {
+			return "", fmt.Errorf("%s has no pod template labels to select by", workload)
+		}
+		return selector, nil
+	}
+	selector := selectorFromLabels(object.Spec.Selector.MatchLabels)
+	if selector == "" {
+		return "", fmt.Errorf("%s has no matchLabels selector", workload)
+	}
+	return selector, nil
+}
+
+func workloadSelectorArgs(kubeContext, namespace, workload string) []string {
+	return append(ContextArgs(kubeContext), "get", workload, "-n", namespace, "-o", "json")
+}
+
+func selectorFromLabels(labels map[string]string) string {
+	terms := make([]string, 0, len(labels))
+	for key, value := range labels {
+		terms = append(terms, key+"="+value)
+	}
+	sort.Strings(terms)
+	return strings.Join(terms, ",")
+}
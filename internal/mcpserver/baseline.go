@@ -0,0 +1,23 @@
+package mcpserver
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/arreyder/pprof-mcp/internal/baseline"
+)
+
+func defaultBaselinePath() (string, error) {
+	baseDir := strings.TrimSpace(os.Getenv("PPROF_MCP_BASEDIR"))
+	if baseDir != "" {
+		baseDir = filepath.Clean(baseDir)
+		path := filepath.Join(baseDir, baseline.DefaultFile)
+		return sanitizePath(baseDir, path)
+	}
+	wd, err := os.Getwd()
+	if err != nil || wd == "" {
+		return baseline.DefaultFile, nil
+	}
+	return filepath.Join(wd, baseline.DefaultFile), nil
+}
@@ -0,0 +1,131 @@
+package mcpserver
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/arreyder/pprof-mcp/internal/binaries"
+	"github.com/arreyder/pprof-mcp/internal/config"
+	"github.com/arreyder/pprof-mcp/internal/d2"
+)
+
+// binaryParams applies the config file's binaries settings to a target.
+func binaryParams(cfg *config.Config, target binaries.Target, repoRoot string) binaries.Params {
+	return binaries.Params{
+		Target:      target,
+		RepoRoot:    repoRoot,
+		Strategies:  cfg.Binaries.Strategies,
+		CacheDir:    cfg.Binaries.CacheDir,
+		ArtifactURL: cfg.Binaries.ArtifactURL,
+		Image:       cfg.Binaries.Image,
+	}
+}
+
+// symbolizationBinary returns the binary argument or, for a profile whose
+// locations lack symbols, the binary binaries.Resolve finds with the config
+// file's settings. The resolution is returned when one was attempted.
+func symbolizationBinary(ctx context.Context, args map[string]any) (string, *binaries.Result) {
+	if binary := getString(args, "binary"); binary != "" {
+		return binary, nil
+	}
+	target, err := binaries.ProfileTarget(getString(args, "profile"))
+	if err != nil || target.Symbolized || target.File == "" {
+		return "", nil
+	}
+	result, err := binaries.Resolve(ctx, binaryParams(currentConfig(), target, getString(args, "repo_root")))
+	if err != nil {
+		return "", nil
+	}
+	return result.Binary, &result
+}
+
+func pprofResolveBinaryTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	target, err := binaries.ProfileTarget(getString(args, "profile"))
+	if err != nil {
+		return nil, err
+	}
+	if name := getString(args, "binary_name"); name != "" {
+		target.Binary = name
+	}
+	if buildID := getString(args, "build_id"); buildID != "" {
+		target.BuildID = buildID
+	}
+	target.Revision = getString(args, "revision")
+	target.Service = getString(args, "service")
+
+	params := binaryParams(currentConfig(), target, getString(args, "repo_root"))
+	if strategies := parseStringList(args, "strategies"); len(strategies) > 0 {
+		params.Strategies = strategies
+	}
+	if artifactURL := getString(args, "artifact_url"); artifactURL != "" {
+		params.ArtifactURL = artifactURL
+	}
+	if image := getString(args, "image"); image != "" {
+		params.Image = image
+	}
+	command := "profctl pprof resolve_binary --profile " + getString(args, "profile")
+
+	if getBool(args, "dry_run") {
+		commands, notes, err := binaries.Plan(params)
+		if err != nil {
+			return nil, err
+		}
+		return marshalJSON(dryRunPayload(d2.DryRunResult{Service: target.Service, Command: command, Commands: commands, Notes: notes}))
+	}
+
+	result, err := binaries.Resolve(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	payload := map[string]any{
+		"command": command,
+		"result":  result,
+	}
+	summary := fmt.Sprintf("No binary found for %s after %d attempts.", result.Target.Binary, len(result.Attempts))
+	if result.Binary != "" {
+		summary = fmt.Sprintf("Resolved %s via %s (verified: %t): %s", result.Target.Binary, result.Strategy, result.Verified, result.Binary)
+	}
+	return marshalJSONWithSummary(summary, payload)
+}
+
+func pprofBuildInfoTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	params := binaries.BuildInfoParams{
+		Params:  binaryParams(currentConfig(), binaries.Target{Revision: getString(args, "revision"), Service: getString(args, "service")}, getString(args, "repo_root")),
+		Binary:  getString(args, "binary"),
+		Profile: getString(args, "profile"),
+	}
+	if strategies := parseStringList(args, "strategies"); len(strategies) > 0 {
+		params.Strategies = strategies
+	}
+	command := "profctl pprof buildinfo"
+	if params.Binary != "" {
+		command += " --binary " + params.Binary
+	}
+	if params.Profile != "" {
+		command += " --profile " + params.Profile
+	}
+
+	result, err := binaries.InspectBuild(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	payload := map[string]any{
+		"command": command,
+		"result":  result,
+	}
+	summary := fmt.Sprintf("%s built with %s", result.BuildInfo.Path, result.BuildInfo.GoVersion)
+	if result.BuildInfo.Revision != "" {
+		summary += " at " + result.BuildInfo.Revision
+	}
+	switch {
+	case result.Head != nil && result.Head.Match:
+		summary += "; the checkout matches."
+	case result.Head != nil && len(result.Head.ProfiledFiles) > 0:
+		summary += fmt.Sprintf("; %d sampled files differ in the checkout.", len(result.Head.ProfiledFiles))
+	case result.Head != nil:
+		summary += "; the checkout is at another commit."
+	default:
+		summary += "."
+	}
+	return marshalJSONWithSummary(summary, payload)
+}
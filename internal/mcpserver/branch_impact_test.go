@@ -0,0 +1,163 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/d2"
+)
+
+func TestBranchImpactPlansPersist(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PPROF_MCP_PLAN_DIR", dir)
+
+	// Records written by an earlier server process.
+	created := time.Now().UTC().Add(-time.Hour)
+	finished := created.Add(10 * time.Minute)
+	for _, plan := range []d2.ExecutionPlan{
+		{
+			ID:         "0a1b2c3d4e5f6071",
+			Params:     d2.BranchImpactParams{Service: "api", Services: []string{"worker"}, BeforeRef: "main", AfterRef: "feature"},
+			CreatedAt:  created,
+			ExpiresAt:  created.Add(d2.PlanTTL),
+			Status:     d2.PlanSucceeded,
+			StartedAt:  &created,
+			FinishedAt: &finished,
+			Result:     &d2.BranchImpactResult{Service: "api", BeforeRef: "main", AfterRef: "feature", UpdateMethod: "live_update"},
+		},
+		{
+			ID:        "ffee000000000001",
+			Params:    d2.BranchImpactParams{Service: "api", BeforeRef: "main", AfterRef: "other"},
+			CreatedAt: created.Add(-2 * d2.PlanTTL),
+			ExpiresAt: created.Add(-d2.PlanTTL),
+			Status:    d2.PlanPending,
+		},
+	} {
+		data, err := json.Marshal(plan)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, plan.ID+".json"), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out, err := d2BranchImpactListTool(context.Background(), map[string]any{})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	runs := out.(ToolOutput).Structured.(map[string]any)["runs"].([]map[string]any)
+	if len(runs) != 2 || runs[0]["id"] != "0a1b2c3d4e5f6071" || runs[0]["status"] != d2.PlanSucceeded {
+		t.Fatalf("unexpected runs: %v", runs)
+	}
+	if runs[1]["status"] != d2.PlanExpired {
+		t.Fatalf("stale pending plan should read as expired, got %v", runs[1]["status"])
+	}
+
+	out, err = d2BranchImpactListTool(context.Background(), map[string]any{"status": "expired"})
+	if err != nil {
+		t.Fatalf("list expired: %v", err)
+	}
+	if runs := out.(ToolOutput).Structured.(map[string]any)["runs"].([]map[string]any); len(runs) != 1 || runs[0]["id"] != "ffee000000000001" {
+		t.Fatalf("unexpected expired runs: %v", runs)
+	}
+
+	out, err = d2BranchImpactShowTool(context.Background(), map[string]any{"plan_id": "0a1b"})
+	if err != nil {
+		t.Fatalf("show: %v", err)
+	}
+	plan := out.(ToolOutput).Structured.(map[string]any)["plan"].(d2.ExecutionPlan)
+	if plan.Result == nil || plan.Result.UpdateMethod != "live_update" || plan.Params.Services[0] != "worker" {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+
+	if _, err := d2.ExecutePlan(context.Background(), "ffee"); err == nil {
+		t.Fatal("executing an expired plan should fail")
+	}
+	if _, err := d2.ExecutePlan(context.Background(), "0a1b2c3d4e5f6071"); err == nil {
+		t.Fatal("a plan should only run once")
+	}
+}
+
+func TestBranchImpactAbortRecoversExitedRun(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	if _, err := d2BranchImpactAbortTool(context.Background(), map[string]any{}); err == nil || !strings.Contains(err.Error(), "no branch impact run") {
+		t.Fatalf("expected no run in progress, got %v", err)
+	}
+
+	repo := t.TempDir()
+	t.Chdir(repo)
+	git := func(args ...string) string {
+		t.Helper()
+		out, err := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-q", "-b", "main")
+	if err := os.WriteFile("main.go", []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	git("add", "main.go")
+	git("commit", "-q", "-m", "init")
+	git("branch", "feature")
+	// A server stashed local edits, checked out feature, and died.
+	if err := os.WriteFile("main.go", []byte("package main // edited\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	git("stash", "push", "-q", "-m", "pprof_branch_impact auto-stash 20260101-000000")
+	git("checkout", "-q", "feature")
+
+	exited := exec.Command("true")
+	if err := exited.Run(); err != nil {
+		t.Skipf("cannot start a process: %v", err)
+	}
+	dir := t.TempDir()
+	t.Setenv("PPROF_MCP_PLAN_DIR", dir)
+	started := time.Now().UTC()
+	data, err := json.Marshal(d2.ExecutionPlan{
+		ID:             "abcd000000000001",
+		Params:         d2.BranchImpactParams{Service: "api", BeforeRef: "feature"},
+		CurrentBranch:  "main",
+		HasUncommitted: true,
+		CreatedAt:      started,
+		ExpiresAt:      started.Add(d2.PlanTTL),
+		Status:         d2.PlanRunning,
+		StartedAt:      &started,
+		PID:            exited.Process.Pid,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "abcd000000000001.json"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := d2BranchImpactAbortTool(context.Background(), map[string]any{"plan_id": "abcd"})
+	if err != nil {
+		t.Fatalf("abort: %v", err)
+	}
+	result := out.(ToolOutput).Structured.(d2.AbortResult)
+	if !result.Recovered || result.Restore == nil || !result.Restore.BranchRestored || !result.Restore.StashPopped {
+		t.Fatalf("unexpected abort result: %+v", result)
+	}
+	if branch := git("branch", "--show-current"); branch != "main" {
+		t.Fatalf("expected main checked out, got %s", branch)
+	}
+	if data, _ := os.ReadFile("main.go"); !strings.Contains(string(data), "edited") {
+		t.Fatalf("stashed edit not restored: %q", data)
+	}
+	plan, err := d2.GetPlan("abcd")
+	if err != nil || plan.Status != d2.PlanAborted {
+		t.Fatalf("plan should be recorded as aborted: %+v, %v", plan, err)
+	}
+}
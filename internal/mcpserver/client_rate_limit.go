@@ -0,0 +1,221 @@
+package mcpserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/arreyder/pprof-mcp/internal/d2"
+)
+
+// Expensive tool classes limited per client in HTTP mode, so one runaway agent
+// can't exhaust the shared Datadog quota or tie up the dev cluster.
+const (
+	rateClassDatadog = "datadog"
+	rateClassD2      = "d2"
+)
+
+const (
+	defaultClientDatadogPerMinute = 30
+	defaultClientD2PerMinute      = 4
+)
+
+var rateLimitedTools = map[string]string{
+	"profiles.download_latest_bundle": rateClassDatadog,
+	"pprof.discover":                  rateClassDatadog,
+	"datadog.profiles.list":           rateClassDatadog,
+	"datadog.profiles.pick":           rateClassDatadog,
+	"datadog.profiles.aggregate":      rateClassDatadog,
+	"datadog.services.search":         rateClassDatadog,
+	"datadog.metrics.discover":        rateClassDatadog,
+	"datadog.profiles.compare_range":  rateClassDatadog,
+	"datadog.profiles.near_event":     rateClassDatadog,
+	"datadog.function_history":        rateClassDatadog,
+	"datadog.metrics_at_timestamp":    rateClassDatadog,
+	"d2.profiles.download":            rateClassD2,
+	"k8s.profiles.capture":            rateClassD2,
+	"k8s.profiles.capture_job":        rateClassD2,
+	"k8s.profiles.compare_clusters":   rateClassD2,
+	"k8s.profiles.compare_canary":     rateClassD2,
+	"k8s.profiles.debug_capture":      rateClassD2,
+	"pprof.branch_impact":             rateClassD2,
+	"pprof.resolve_binary":            rateClassD2,
+	"pprof.branch_impact.execute":     rateClassD2,
+	"d2.schedule.start":               rateClassD2,
+}
+
+// rateLimitClass returns the limited class for a tool, or "" if unlimited.
+// profiles.download picks its backend at call time, so it follows that choice.
+func rateLimitClass(canonicalName string) string {
+	if canonicalName == "profiles.download" {
+		if d2.IsD2Environment() {
+			return rateClassD2
+		}
+		return rateClassDatadog
+	}
+	return rateLimitedTools[canonicalName]
+}
+
+// RateLimitError is returned when a client exceeds its budget for a tool class.
+type RateLimitError struct {
+	Class      string
+	Client     string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit exceeded for %s tools; retry after %ds", e.Class, retryAfterSeconds(e.RetryAfter))
+}
+
+func retryAfterSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+type clientRateLimiter struct {
+	mu      sync.Mutex
+	limits  map[string]float64 // tokens per second, keyed by class
+	burst   map[string]float64
+	buckets map[string]*rateBucket
+}
+
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newClientRateLimiter takes per-minute budgets by class. The burst equals one
+// minute of budget. A budget <= 0 disables limiting for that class.
+func newClientRateLimiter(perMinute map[string]int) *clientRateLimiter {
+	l := &clientRateLimiter{
+		limits:  map[string]float64{},
+		burst:   map[string]float64{},
+		buckets: map[string]*rateBucket{},
+	}
+	for class, budget := range perMinute {
+		if budget <= 0 {
+			continue
+		}
+		l.limits[class] = float64(budget) / 60
+		l.burst[class] = float64(budget)
+	}
+	return l
+}
+
+// Allow consumes a token for client/class and returns how long to wait when
+// the budget is exhausted (0 means allowed).
+func (l *clientRateLimiter) Allow(client, class string, now time.Time) time.Duration {
+	rate, ok := l.limits[class]
+	if !ok || class == "" {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := class + "|" + client
+	bucket := l.buckets[key]
+	if bucket == nil {
+		bucket = &rateBucket{tokens: l.burst[class], last: now}
+		l.buckets[key] = bucket
+	}
+	elapsed := now.Sub(bucket.last).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	bucket.tokens = math.Min(l.burst[class], bucket.tokens+elapsed*rate)
+	bucket.last = now
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return 0
+	}
+	return time.Duration((1 - bucket.tokens) / rate * float64(time.Second))
+}
+
+var (
+	clientLimiterOnce sync.Once
+	clientLimiterVal  *clientRateLimiter
+)
+
+// clientLimiter reads PPROF_MCP_CLIENT_DATADOG_PER_MIN and
+// PPROF_MCP_CLIENT_D2_PER_MIN (0 disables the class limit).
+func clientLimiter() *clientRateLimiter {
+	clientLimiterOnce.Do(func() {
+		clientLimiterVal = newClientRateLimiter(map[string]int{
+			rateClassDatadog: readPerMinuteEnv("PPROF_MCP_CLIENT_DATADOG_PER_MIN", defaultClientDatadogPerMinute),
+			rateClassD2:      readPerMinuteEnv("PPROF_MCP_CLIENT_D2_PER_MIN", defaultClientD2PerMinute),
+		})
+	})
+	return clientLimiterVal
+}
+
+func readPerMinuteEnv(key string, fallback int) int {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(raw)
+	if err != nil || parsed < 0 {
+		return fallback
+	}
+	return parsed
+}
+
+// clientKey identifies the caller of an HTTP request: a hash of the bearer
+// token when present, otherwise the MCP session ID. It returns "" for stdio,
+// where there is a single client and no limit applies.
+func clientKey(req *mcp.CallToolRequest) string {
+	if req == nil || req.Extra == nil || req.Extra.Header == nil {
+		return ""
+	}
+	if auth := strings.TrimSpace(req.Extra.Header.Get("Authorization")); auth != "" {
+		sum := sha256.Sum256([]byte(auth))
+		return "token:" + hex.EncodeToString(sum[:8])
+	}
+	if req.Session != nil && req.Session.ID() != "" {
+		return "session:" + req.Session.ID()
+	}
+	return "anonymous"
+}
+
+// checkClientRateLimit returns a non-nil error when the caller is over budget.
+func checkClientRateLimit(req *mcp.CallToolRequest, canonicalName string) *RateLimitError {
+	client := clientKey(req)
+	if client == "" {
+		return nil
+	}
+	class := rateLimitClass(canonicalName)
+	if class == "" {
+		return nil
+	}
+	if wait := clientLimiter().Allow(client, class, time.Now()); wait > 0 {
+		return &RateLimitError{Class: class, Client: client, RetryAfter: wait}
+	}
+	return nil
+}
+
+func rateLimitResult(toolName string, err *RateLimitError) *mcp.CallToolResult {
+	seconds := retryAfterSeconds(err.RetryAfter)
+	msg := fmt.Sprintf("%s: %s", toolName, err.Error())
+	hint := "This server limits expensive Datadog/d2 calls per client. Wait and retry, or reuse existing profile handles."
+	return &mcp.CallToolResult{
+		IsError: true,
+		Content: []mcp.Content{&mcp.TextContent{Text: msg + "\nHint: " + hint}},
+		StructuredContent: map[string]any{
+			"error": map[string]any{
+				"message": msg,
+				"code":    "RATE_LIMITED",
+				"details": map[string]any{
+					"class":               err.Class,
+					"retry_after_seconds": seconds,
+					"hint":                hint,
+				},
+			},
+		},
+	}
+}
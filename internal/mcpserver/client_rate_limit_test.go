@@ -0,0 +1,94 @@
+package mcpserver
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestClientRateLimiterPerClient(t *testing.T) {
+	limiter := newClientRateLimiter(map[string]int{rateClassD2: 2})
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if wait := limiter.Allow("a", rateClassD2, now); wait != 0 {
+			t.Fatalf("call %d should be allowed, got wait %s", i, wait)
+		}
+	}
+	wait := limiter.Allow("a", rateClassD2, now)
+	if wait <= 0 || wait > 30*time.Second {
+		t.Fatalf("expected ~30s retry after, got %s", wait)
+	}
+	if wait := limiter.Allow("b", rateClassD2, now); wait != 0 {
+		t.Fatalf("other clients should have their own budget, got wait %s", wait)
+	}
+	if wait := limiter.Allow("a", rateClassD2, now.Add(30*time.Second)); wait != 0 {
+		t.Fatalf("budget should refill over time, got wait %s", wait)
+	}
+	if wait := limiter.Allow("a", rateClassDatadog, now); wait != 0 {
+		t.Fatalf("unconfigured class should be unlimited, got wait %s", wait)
+	}
+}
+
+func TestRateLimitClass(t *testing.T) {
+	if got := rateLimitClass("datadog.profiles.list"); got != rateClassDatadog {
+		t.Fatalf("expected datadog class, got %q", got)
+	}
+	if got := rateLimitClass("pprof.branch_impact"); got != rateClassD2 {
+		t.Fatalf("expected d2 class, got %q", got)
+	}
+	if got := rateLimitClass("pprof.top"); got != "" {
+		t.Fatalf("expected local tool to be unlimited, got %q", got)
+	}
+	for name := range rateLimitedTools {
+		findTool(t, name)
+	}
+}
+
+func TestRateLimitOnlyAppliesOverHTTP(t *testing.T) {
+	if clientKey(&mcp.CallToolRequest{}) != "" {
+		t.Fatalf("stdio requests should not have a client key")
+	}
+	header := httptest.NewRequest("POST", "/mcp", nil).Header
+	header.Set("Authorization", "Bearer secret")
+	key := clientKey(&mcp.CallToolRequest{Extra: &mcp.RequestExtra{Header: header}})
+	if key == "" || key == "token:Bearer secret" {
+		t.Fatalf("expected hashed token key, got %q", key)
+	}
+}
+
+func TestRateLimitResultFormatting(t *testing.T) {
+	res := rateLimitResult("pprof.branch_impact", &RateLimitError{Class: rateClassD2, RetryAfter: 1500 * time.Millisecond})
+	payload := res.StructuredContent.(map[string]any)["error"].(map[string]any)
+	if payload["code"] != "RATE_LIMITED" {
+		t.Fatalf("expected RATE_LIMITED, got %v", payload["code"])
+	}
+	if payload["details"].(map[string]any)["retry_after_seconds"] != 2 {
+		t.Fatalf("expected retry_after_seconds rounded up to 2, got %v", payload["details"])
+	}
+}
+
+func TestHTTPTransportServesTools(t *testing.T) {
+	server, err := newServer(toolNameModeDefault)
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	httpServer := httptest.NewServer(newHTTPMux(server))
+	defer httpServer.Close()
+
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "test"}, nil)
+	session, err := client.Connect(context.Background(), &mcp.StreamableClientTransport{Endpoint: httpServer.URL + mcpHTTPPath}, nil)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer session.Close()
+	listed, err := session.ListTools(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("list tools: %v", err)
+	}
+	if len(listed.Tools) == 0 {
+		t.Fatalf("expected tools over HTTP")
+	}
+}
@@ -0,0 +1,141 @@
+package mcpserver
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/arreyder/pprof-mcp/internal/completion"
+)
+
+// maxCompletionValues is the MCP limit on values returned per completion.
+const maxCompletionValues = 100
+
+// completeArgument answers completion/complete requests. The protocol only
+// carries prompt/resource references, so completion is keyed on the argument
+// name; when the reference name matches a tool, that tool's enums take priority.
+func completeArgument(ctx context.Context, req *mcp.CompleteRequest) (*mcp.CompleteResult, error) {
+	params := req.Params
+	toolName := ""
+	if params.Ref != nil {
+		toolName = params.Ref.Name
+	}
+	var contextArgs map[string]string
+	if params.Context != nil {
+		contextArgs = params.Context.Arguments
+	}
+
+	candidates := completionCandidates(toolName, params.Argument.Name, contextArgs)
+	return buildCompleteResult(candidates, params.Argument.Value), nil
+}
+
+func completionCandidates(toolName, argName string, contextArgs map[string]string) []string {
+	switch argName {
+	case "service":
+		return completeServices(contextArgs)
+	case "env":
+		return completeEnvs()
+	case "sample_index":
+		return completeSampleIndex(contextArgs)
+	case "profile", "before", "after", "heap_profile", "goroutine_profile":
+		return completeHandles()
+	}
+	return enumValuesForArg(toolName, argName)
+}
+
+func completeServices(contextArgs map[string]string) []string {
+	values := completion.Services(contextArgs["env"], contextArgs["repo_root"])
+	for _, meta := range profileRegistry.All() {
+		values = append(values, meta.Service)
+	}
+	return values
+}
+
+func completeEnvs() []string {
+	values := completion.Envs()
+	for _, meta := range profileRegistry.All() {
+		values = append(values, meta.Env)
+	}
+	return values
+}
+
+func completeSampleIndex(contextArgs map[string]string) []string {
+	profilePath := firstNonEmpty(contextArgs["profile"], contextArgs["before"], contextArgs["heap_profile"])
+	if profilePath == "" {
+		return nil
+	}
+	baseDir := strings.TrimSpace(os.Getenv("PPROF_MCP_BASEDIR"))
+	var err error
+	if isHandle(profilePath) {
+		profilePath, err = resolveHandlePath(baseDir, profilePath)
+	} else {
+		profilePath, err = sanitizePath(baseDir, profilePath)
+	}
+	if err != nil {
+		return nil
+	}
+	prof, err := loadProfile(profilePath)
+	if err != nil {
+		return nil
+	}
+	values := make([]string, 0, len(prof.SampleType))
+	for _, st := range prof.SampleType {
+		values = append(values, st.Type)
+	}
+	return values
+}
+
+func completeHandles() []string {
+	values := []string{}
+	for _, meta := range profileRegistry.All() {
+		values = append(values, meta.ID)
+	}
+	return values
+}
+
+// enumValuesForArg returns the enum values declared for argName in the input
+// schema of toolName, or across all tools when toolName is unknown.
+func enumValuesForArg(toolName, argName string) []string {
+	values := []string{}
+	for _, def := range ToolSchemas() {
+		if toolName != "" && def.Tool.Name != canonicalToolName(toolName) && toolNameForMode(def.Tool.Name, toolNameModeCodex) != toolName {
+			continue
+		}
+		schema, ok := def.Tool.InputSchema.(map[string]any)
+		if !ok {
+			continue
+		}
+		props, ok := schema["properties"].(map[string]any)
+		if !ok {
+			continue
+		}
+		propSchema, ok := props[argName].(map[string]any)
+		if !ok {
+			continue
+		}
+		if enum, ok := propSchema["enum"].([]string); ok {
+			values = append(values, enum...)
+		}
+	}
+	if len(values) == 0 && toolName != "" {
+		return enumValuesForArg("", argName)
+	}
+	return values
+}
+
+func buildCompleteResult(candidates []string, prefix string) *mcp.CompleteResult {
+	matches := completion.Filter(candidates, prefix)
+	result := &mcp.CompleteResult{
+		Completion: mcp.CompletionResultDetails{
+			Values: matches,
+			Total:  len(matches),
+		},
+	}
+	if len(matches) > maxCompletionValues {
+		result.Completion.Values = matches[:maxCompletionValues]
+		result.Completion.HasMore = true
+	}
+	return result
+}
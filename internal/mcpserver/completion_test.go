@@ -0,0 +1,67 @@
+package mcpserver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestCompleteEnumArgument(t *testing.T) {
+	session := connectTestSession(t)
+	res, err := session.Complete(context.Background(), &mcp.CompleteParams{
+		Ref:      &mcp.CompleteReference{Type: "ref/prompt", Name: "datadog.profiles.pick"},
+		Argument: mcp.CompleteParamsArgument{Name: "strategy", Value: "m"},
+	})
+	if err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	want := []string{"manual_index", "most_samples"}
+	if !reflect.DeepEqual(res.Completion.Values, want) {
+		t.Fatalf("expected %v, got %v", want, res.Completion.Values)
+	}
+}
+
+func TestCompleteSampleIndexFromProfile(t *testing.T) {
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "alloc_objects", Unit: "count"},
+			{Type: "alloc_space", Unit: "bytes"},
+			{Type: "inuse_space", Unit: "bytes"},
+		},
+	}
+	path := filepath.Join(t.TempDir(), "heap.pprof")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create profile: %v", err)
+	}
+	if err := prof.Write(file); err != nil {
+		t.Fatalf("write profile: %v", err)
+	}
+	file.Close()
+
+	values := completionCandidates("pprof.top", "sample_index", map[string]string{"profile": path})
+	res := buildCompleteResult(values, "alloc")
+	want := []string{"alloc_objects", "alloc_space"}
+	if !reflect.DeepEqual(res.Completion.Values, want) {
+		t.Fatalf("expected %v, got %v", want, res.Completion.Values)
+	}
+}
+
+func TestBuildCompleteResultCapsValues(t *testing.T) {
+	values := make([]string, 0, maxCompletionValues+10)
+	for i := 0; i < maxCompletionValues+10; i++ {
+		values = append(values, filepath.Join("svc", string(rune('a'+i%26)), string(rune('a'+i/26))))
+	}
+	res := buildCompleteResult(values, "")
+	if len(res.Completion.Values) != maxCompletionValues || !res.Completion.HasMore {
+		t.Fatalf("expected capped values with hasMore, got %d hasMore=%v", len(res.Completion.Values), res.Completion.HasMore)
+	}
+	if res.Completion.Total != maxCompletionValues+10 {
+		t.Fatalf("expected total %d, got %d", maxCompletionValues+10, res.Completion.Total)
+	}
+}
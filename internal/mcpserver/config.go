@@ -0,0 +1,119 @@
+package mcpserver
+
+import (
+	"maps"
+	"os"
+	"sync/atomic"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+	"github.com/arreyder/pprof-mcp/internal/config"
+	"github.com/arreyder/pprof-mcp/internal/d2"
+	"github.com/arreyder/pprof-mcp/internal/pprof"
+)
+
+var activeConfig atomic.Pointer[config.Config]
+
+// currentConfig returns the loaded config file, or an empty config.
+func currentConfig() *config.Config {
+	if cfg := activeConfig.Load(); cfg != nil {
+		return cfg
+	}
+	return &config.Config{}
+}
+
+// loadServerConfig reads ~/.config/pprof-mcp/config.yaml (or
+// PPROF_MCP_CONFIG). A missing file is fine; an invalid one is an error.
+func loadServerConfig() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	activateConfig(cfg)
+	return nil
+}
+
+// activateConfig makes cfg the server's configuration. Branch-impact plans
+// are persisted under the workspace (PPROF_MCP_WORKSPACE or the file's), and
+// external commands get the file's per-kind timeouts.
+func activateConfig(cfg *config.Config) {
+	cfg.ApplyEnv()
+	activeConfig.Store(cfg)
+	d2.SetPlanWorkspace(firstNonEmpty(os.Getenv("PPROF_MCP_WORKSPACE"), cfg.Workspace))
+	cmdrun.SetTimeouts(cfg.Timeouts.Commands)
+}
+
+// applyConfigDefaults fills arguments the caller omitted from the config file
+// and expands an env argument that names an environment preset. Only
+// arguments in the tool's input schema are set, and explicit values win.
+func applyConfigDefaults(cfg *config.Config, tool *mcp.Tool, args map[string]any) map[string]any {
+	schema, _ := tool.InputSchema.(map[string]any)
+	props, _ := schema["properties"].(map[string]any)
+	if cfg == nil || len(props) == 0 {
+		return args
+	}
+	out := maps.Clone(args)
+	if out == nil {
+		out = map[string]any{}
+	}
+	setDefault := func(key string, value any) {
+		if _, ok := props[key]; !ok {
+			return
+		}
+		if _, ok := out[key]; ok {
+			return
+		}
+		out[key] = value
+	}
+
+	if preset, ok := cfg.Preset(getString(out, "env")); ok {
+		if preset.Env != "" {
+			out["env"] = preset.Env
+		}
+		if preset.Service != "" {
+			setDefault("service", preset.Service)
+		}
+		if preset.DDSite != "" && getString(out, "site") == "" && getString(out, "dd_site") == "" {
+			if _, ok := props["site"]; ok {
+				setDefault("site", preset.DDSite)
+			} else {
+				setDefault("dd_site", preset.DDSite)
+			}
+		}
+		if preset.Hours > 0 {
+			setDefault("hours", float64(preset.Hours))
+		}
+		if preset.Host != "" {
+			setDefault("host", preset.Host)
+		}
+	}
+	if cfg.TrimPath != "" {
+		setDefault("trim_path", cfg.TrimPath)
+	}
+	if len(cfg.RepoPrefixes) > 0 {
+		prefixes := make([]any, 0, len(cfg.RepoPrefixes))
+		for _, prefix := range cfg.RepoPrefixes {
+			prefixes = append(prefixes, prefix)
+		}
+		setDefault("repo_prefix", prefixes)
+	}
+	return out
+}
+
+// patternRules converts the config file's pattern library entries.
+func patternRules(patterns []config.Pattern) []pprof.PatternRule {
+	rules := make([]pprof.PatternRule, 0, len(patterns))
+	for _, p := range patterns {
+		rules = append(rules, pprof.PatternRule{
+			Regex:       p.Regex,
+			Category:    p.Category,
+			Severity:    p.Severity,
+			Explanation: p.Explanation,
+			Remediation: p.Remediation,
+			Package:     p.Package,
+			FileGlob:    p.Files,
+		})
+	}
+	return rules
+}
@@ -0,0 +1,75 @@
+package mcpserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/config"
+)
+
+func TestApplyConfigDefaultsExpandsPreset(t *testing.T) {
+	cfg, err := config.Parse([]byte(`
+environments:
+  prod-eu:
+    env: prod
+    dd_site: datadoghq.eu
+    hours: 24
+    host: '*euw1*'
+`))
+	if err != nil {
+		t.Fatalf("parse config: %v", err)
+	}
+	tool := findTool(t, "datadog.profiles.list").Tool
+
+	args := map[string]any{"service": "api", "env": "prod-eu", "hours": float64(6)}
+	got := applyConfigDefaults(cfg, tool, args)
+	if got["env"] != "prod" || got["site"] != "datadoghq.eu" || got["host"] != "*euw1*" {
+		t.Fatalf("preset not expanded: %v", got)
+	}
+	if got["hours"] != float64(6) {
+		t.Fatalf("explicit hours should win, got %v", got["hours"])
+	}
+	if args["env"] != "prod-eu" {
+		t.Fatalf("caller args should not be modified: %v", args)
+	}
+	if err := ValidateArgsWithName(tool, "datadog.profiles.list", got); err != nil {
+		t.Fatalf("expanded args should validate: %v", err)
+	}
+
+	plain := applyConfigDefaults(cfg, tool, map[string]any{"service": "api", "env": "staging"})
+	if plain["env"] != "staging" || plain["site"] != nil {
+		t.Fatalf("non-preset env should pass through: %v", plain)
+	}
+}
+
+func TestApplyConfigDefaultsFillsSourceArgs(t *testing.T) {
+	cfg := &config.Config{TrimPath: "/src", RepoPrefixes: []string{"github.com/acme/app"}}
+	tool := findTool(t, "pprof.storylines").Tool
+
+	got := applyConfigDefaults(cfg, tool, map[string]any{"profile": "cpu.pprof"})
+	if got["trim_path"] != "/src" {
+		t.Fatalf("expected trim_path default, got %v", got["trim_path"])
+	}
+	if prefixes := parseStringList(got, "repo_prefix"); len(prefixes) != 1 || prefixes[0] != "github.com/acme/app" {
+		t.Fatalf("expected repo_prefix default, got %v", got["repo_prefix"])
+	}
+
+	top := applyConfigDefaults(cfg, findTool(t, "pprof.top").Tool, map[string]any{"profile": "cpu.pprof"})
+	if _, ok := top["trim_path"]; ok {
+		t.Fatalf("defaults must only set arguments in the tool schema: %v", top)
+	}
+}
+
+func TestToolTimeoutsFromConfig(t *testing.T) {
+	cfg := parseToolTimeouts("", "pprof.top=60").withConfig(config.Timeouts{Default: 120, Tools: map[string]int{"pprof.top": 5, "pprof.discover": 900}})
+
+	if got := timeoutForTool(cfg, "pprof.top", nil); got != time.Minute {
+		t.Fatalf("environment timeout should win, got %v", got)
+	}
+	if got := timeoutForTool(cfg, "pprof.discover", nil); got != 900*time.Second {
+		t.Fatalf("expected config per-tool timeout, got %v", got)
+	}
+	if got := timeoutForTool(cfg, "pprof.peek", nil); got != 120*time.Second {
+		t.Fatalf("expected config default timeout, got %v", got)
+	}
+}
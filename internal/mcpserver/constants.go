@@ -0,0 +1,11 @@
+package mcpserver
+
+const (
+	serverName    = "pprof-mcp"
+	serverVersion = "0.1.0"
+)
+
+const (
+	defaultTracesLines = 200
+	maxTracesLines     = 500
+)
@@ -0,0 +1,30 @@
+package mcpserver
+
+import (
+	"github.com/arreyder/pprof-mcp/internal/d2"
+)
+
+func dryRunProp() map[string]any {
+	return prop("boolean", "Return the git/tilt/kubectl commands that would run without executing them (default: false)")
+}
+
+// dryRunPayload renders a d2 dry run. "command" mirrors the field normal runs
+// report; "commands" is the full ordered list.
+func dryRunPayload(result d2.DryRunResult) map[string]any {
+	payload := map[string]any{
+		"dry_run":  true,
+		"command":  result.Command,
+		"commands": result.Commands,
+		"service":  result.Service,
+	}
+	if result.BeforeRef != "" {
+		payload["before_ref"] = result.BeforeRef
+		payload["after_ref"] = result.AfterRef
+		payload["current_branch"] = result.CurrentBranch
+		payload["has_uncommitted"] = result.HasUncommitted
+	}
+	if len(result.Notes) > 0 {
+		payload["notes"] = result.Notes
+	}
+	return payload
+}
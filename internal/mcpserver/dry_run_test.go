@@ -0,0 +1,557 @@
+package mcpserver
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestD2DownloadDryRun(t *testing.T) {
+	session := connectTestSession(t)
+	outDir := t.TempDir()
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "d2.profiles.download",
+		Arguments: map[string]any{"service": "be-ratelimit", "out_dir": outDir, "seconds": 10, "dry_run": true},
+	})
+	if err != nil {
+		t.Fatalf("call tool: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("unexpected tool error: %+v", res.Content)
+	}
+	structured, ok := res.StructuredContent.(map[string]any)
+	if !ok || structured["dry_run"] != true {
+		t.Fatalf("expected dry run payload, got %v", res.StructuredContent)
+	}
+	if !strings.HasPrefix(structured["command"].(string), "kubectl port-forward -n default <pod> <local-port>:4421") {
+		t.Fatalf("unexpected command: %v", structured["command"])
+	}
+	commands, _ := structured["commands"].([]any)
+	joined := ""
+	for _, command := range commands {
+		joined += command.(string) + "\n"
+	}
+	for _, want := range []string{"kubectl get pods -n default -l app=be-ratelimit -o json", "'https://127.0.0.1:<local-port>/debug/pprof/profile?seconds=10'", "allocs.pprof"} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("dry run commands missing %q:\n%s", want, joined)
+		}
+	}
+}
+
+func TestD2DownloadTypesAndRatesDryRun(t *testing.T) {
+	session := connectTestSession(t)
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "d2.profiles.download",
+		Arguments: map[string]any{"service": "be-ratelimit", "out_dir": "out", "types": []any{"mutex", "threadcreate"}, "mutex_rate": 10, "dry_run": true},
+	})
+	if err != nil {
+		t.Fatalf("call tool: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("unexpected tool error: %+v", res.Content)
+	}
+	commands, _ := res.StructuredContent.(map[string]any)["commands"].([]any)
+	joined := ""
+	for _, command := range commands {
+		joined += command.(string) + "\n"
+	}
+	for _, want := range []string{"/debug/pprof/rates?mutex=10'", "/debug/pprof/rates?mutex=<previous>'", "threadcreate.pprof"} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("dry run commands missing %q:\n%s", want, joined)
+		}
+	}
+	if strings.Contains(joined, "allocs.pprof") || strings.Contains(joined, "profile?seconds") {
+		t.Fatalf("unselected profile types captured:\n%s", joined)
+	}
+
+	res, err = session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "d2.profiles.download",
+		Arguments: map[string]any{"service": "be-ratelimit", "out_dir": "out", "types": []any{"trace"}, "dry_run": true},
+	})
+	if err != nil {
+		t.Fatalf("call tool: %v", err)
+	}
+	if !res.IsError {
+		t.Fatalf("expected an unknown profile type to fail")
+	}
+}
+
+func TestD2DownloadTargetDryRun(t *testing.T) {
+	session := connectTestSession(t)
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "d2.profiles.download",
+		Arguments: map[string]any{"target": "deployment/ledger", "namespace": "payments", "out_dir": "out", "seconds": 10, "dry_run": true},
+	})
+	if err != nil {
+		t.Fatalf("call tool: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("unexpected tool error: %+v", res.Content)
+	}
+	structured := res.StructuredContent.(map[string]any)
+	if structured["command"] != "kubectl port-forward -n payments <pod> <local-port>:<port>" {
+		t.Fatalf("unexpected command: %v", structured["command"])
+	}
+	commands, _ := structured["commands"].([]any)
+	if len(commands) < 3 || commands[0] != "kubectl get deployment/ledger -n payments -o json" || commands[1] != "kubectl get pods -n payments -l <selector> -o json" {
+		t.Fatalf("unexpected commands: %v", commands)
+	}
+	joined := ""
+	for _, command := range commands {
+		joined += command.(string) + "\n"
+	}
+	if !strings.Contains(joined, "out/<pod>/ledger_payments_allocs.pprof") || strings.Contains(joined, "Ductone-Token") {
+		t.Fatalf("unexpected capture commands:\n%s", joined)
+	}
+}
+
+func TestD2DownloadKubeContextDryRun(t *testing.T) {
+	session := connectTestSession(t)
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "d2.profiles.download",
+		Arguments: map[string]any{"service": "be-ratelimit", "namespace": "apps", "kube_context": "kind-dev", "out_dir": "out", "dry_run": true},
+	})
+	if err != nil {
+		t.Fatalf("call tool: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("unexpected tool error: %+v", res.Content)
+	}
+	structured := res.StructuredContent.(map[string]any)
+	if structured["command"] != "kubectl --context kind-dev port-forward -n apps <pod> <local-port>:4421" {
+		t.Fatalf("unexpected command: %v", structured["command"])
+	}
+	commands, _ := structured["commands"].([]any)
+	if len(commands) == 0 || commands[0] != "kubectl --context kind-dev get pods -n apps -l app=be-ratelimit -o json" {
+		t.Fatalf("unexpected commands: %v", commands)
+	}
+}
+
+func TestBranchImpactDryRun(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	out, err := d2BranchImpactTool(context.Background(), map[string]any{
+		"service":    "ratelimit",
+		"out_dir":    t.TempDir(),
+		"before_ref": "main",
+		"after_ref":  "feature",
+		"dry_run":    true,
+	})
+	if err != nil {
+		t.Skipf("git state unavailable: %v", err)
+	}
+	payload := out.(ToolOutput).Structured.(map[string]any)
+	if payload["command"] != "git checkout main" {
+		t.Fatalf("unexpected command: %v", payload["command"])
+	}
+	commands := payload["commands"].([]string)
+	joined := strings.Join(commands, "\n")
+	for _, want := range []string{"git checkout feature", "tilt get kubernetesdiscovery ratelimit -o json"} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("dry run commands missing %q:\n%s", want, joined)
+		}
+	}
+	if last := commands[len(commands)-1]; !strings.HasPrefix(last, "git checkout ") && last != "git stash pop" {
+		t.Fatalf("dry run should end by restoring git state, got %q", last)
+	}
+}
+
+func TestBranchImpactDryRunServices(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	outDir := t.TempDir()
+	out, err := d2BranchImpactTool(context.Background(), map[string]any{
+		"service":    "api",
+		"services":   []any{"worker", "api"},
+		"out_dir":    outDir,
+		"before_ref": "main",
+		"after_ref":  "feature",
+		"dry_run":    true,
+	})
+	if err != nil {
+		t.Skipf("git state unavailable: %v", err)
+	}
+	payload := out.(ToolOutput).Structured.(map[string]any)
+	joined := strings.Join(payload["commands"].([]string), "\n")
+	for _, want := range []string{
+		"tilt get kubernetesdiscovery api -o json",
+		"tilt get kubernetesdiscovery worker -o json",
+		"mkdir -p " + outDir + "/before/api",
+		"mkdir -p " + outDir + "/after/worker",
+	} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("dry run commands missing %q:\n%s", want, joined)
+		}
+	}
+	if strings.Count(joined, "tilt get kubernetesdiscovery api -o json") != 2 {
+		t.Fatalf("api should be polled once per ref:\n%s", joined)
+	}
+}
+
+func TestBranchImpactDryRunLoad(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	outDir := t.TempDir()
+	out, err := d2BranchImpactTool(context.Background(), map[string]any{
+		"service":      "api",
+		"out_dir":      outDir,
+		"before_ref":   "main",
+		"after_ref":    "feature",
+		"seconds":      20,
+		"load_command": "hey -z {seconds}s http://localhost:8080/?side={side}",
+		"dry_run":      true,
+	})
+	if err != nil {
+		t.Skipf("git state unavailable: %v", err)
+	}
+	commands := out.(ToolOutput).Structured.(map[string]any)["commands"].([]string)
+	var loads []int
+	for i, command := range commands {
+		if strings.HasPrefix(command, "sh -c ") {
+			loads = append(loads, i)
+		}
+	}
+	if len(loads) != 2 || commands[loads[0]] != "sh -c 'hey -z 23s http://localhost:8080/?side=before' &" || commands[loads[1]] != "sh -c 'hey -z 23s http://localhost:8080/?side=after' &" {
+		t.Fatalf("unexpected load commands:\n%s", strings.Join(commands, "\n"))
+	}
+	if !strings.Contains(commands[loads[0]+1], "curl") && !strings.Contains(commands[loads[0]+1], "kubectl") {
+		t.Fatalf("load should start right before the capture:\n%s", strings.Join(commands, "\n"))
+	}
+
+	_, err = d2BranchImpactTool(context.Background(), map[string]any{
+		"service":      "api",
+		"out_dir":      outDir,
+		"load_command": "hey",
+		"k6_script":    "load.js",
+		"dry_run":      true,
+	})
+	if err == nil || !strings.Contains(err.Error(), "only one of") {
+		t.Fatalf("expected conflicting load sources to fail, got %v", err)
+	}
+}
+
+func TestBranchImpactDryRunRepeated(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	outDir := t.TempDir()
+	out, err := d2BranchImpactTool(context.Background(), map[string]any{
+		"service":    "api",
+		"out_dir":    outDir,
+		"before_ref": "main",
+		"after_ref":  "feature",
+		"runs":       3,
+		"dry_run":    true,
+	})
+	if err != nil {
+		t.Skipf("git state unavailable: %v", err)
+	}
+	joined := strings.Join(out.(ToolOutput).Structured.(map[string]any)["commands"].([]string), "\n")
+	for _, side := range []string{"before", "after"} {
+		for _, run := range []string{"run-1", "run-2", "run-3"} {
+			if want := "mkdir -p " + filepath.Join(outDir, side, run); !strings.Contains(joined, want) {
+				t.Fatalf("dry run commands missing %q:\n%s", want, joined)
+			}
+		}
+	}
+	if strings.Contains(joined, "run-4") {
+		t.Fatalf("only three runs per ref expected:\n%s", joined)
+	}
+
+	if _, err := d2BranchImpactTool(context.Background(), map[string]any{"service": "api", "out_dir": outDir, "runs": 11, "dry_run": true}); err == nil || !strings.Contains(err.Error(), "runs must be at most") {
+		t.Fatalf("expected too many runs to fail, got %v", err)
+	}
+}
+
+func TestBranchImpactDryRunDevEnv(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	outDir := t.TempDir()
+	for devEnv, want := range map[string][]string{
+		"compose": {
+			"docker compose ps -q api",
+			"docker inspect <container>",
+			"docker compose port api 7070",
+			"curl -s -o " + outDir + "/before/api_<timestamp>_cpu.pprof 'http://<host-port>/debug/pprof/profile?seconds=30'",
+		},
+		"skaffold": {
+			"kubectl get pods -n dev -l app.kubernetes.io/managed-by=skaffold -o json",
+			"kubectl get pods -n dev -l app=api -o json",
+		},
+	} {
+		out, err := d2BranchImpactTool(context.Background(), map[string]any{
+			"service":    "api",
+			"out_dir":    outDir,
+			"namespace":  "dev",
+			"before_ref": "main",
+			"after_ref":  "feature",
+			"dev_env":    devEnv,
+			"pprof_port": 7070,
+			"dry_run":    true,
+		})
+		if err != nil {
+			t.Skipf("git state unavailable: %v", err)
+		}
+		joined := strings.Join(out.(ToolOutput).Structured.(map[string]any)["commands"].([]string), "\n")
+		for _, command := range want {
+			if !strings.Contains(joined, command) {
+				t.Fatalf("%s dry run missing %q:\n%s", devEnv, command, joined)
+			}
+		}
+		if strings.Contains(joined, "tilt ") {
+			t.Fatalf("%s dry run should not query tilt:\n%s", devEnv, joined)
+		}
+	}
+
+	if _, err := d2BranchImpactTool(context.Background(), map[string]any{"service": "api", "out_dir": outDir, "dev_env": "nomad", "dry_run": true}); err == nil || !strings.Contains(err.Error(), "unsupported dev_env") {
+		t.Fatalf("expected an unknown dev_env to fail, got %v", err)
+	}
+}
+
+func TestBranchImpactDryRunRollout(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	outDir := t.TempDir()
+	out, err := d2BranchImpactTool(context.Background(), map[string]any{
+		"service":        "api",
+		"out_dir":        outDir,
+		"namespace":      "prod",
+		"before_ref":     "main",
+		"after_ref":      "feature",
+		"dev_env":        "rollout",
+		"deploy_command": "make deploy REF={ref}",
+		"gitops_app":     "argocd/api",
+		"dry_run":        true,
+	})
+	if err != nil {
+		t.Skipf("git state unavailable: %v", err)
+	}
+	commands := out.(ToolOutput).Structured.(map[string]any)["commands"].([]string)
+	joined := strings.Join(commands, "\n")
+	for _, command := range []string{
+		"git checkout main\nsh -c 'make deploy REF=main'\nkubectl get deployment/api -n prod -o json",
+		"kubectl get replicasets -n prod -l <selector> -o json\nkubectl get applications.argoproj.io api -n argocd -o json",
+		"git checkout feature\nsh -c 'make deploy REF=feature'",
+		"pod-template-hash=<hash>",
+	} {
+		if !strings.Contains(joined, command) {
+			t.Fatalf("rollout dry run missing %q:\n%s", command, joined)
+		}
+	}
+
+	for _, args := range []map[string]any{
+		{"gitops_app": "argocd/api"},
+		{"dev_env": "rollout", "gitops_app": "spinnaker/api"},
+	} {
+		args["service"], args["out_dir"], args["dry_run"] = "api", outDir, true
+		if _, err := d2BranchImpactTool(context.Background(), args); err == nil || !strings.Contains(err.Error(), "gitops_app") {
+			t.Fatalf("expected %v to be rejected, got %v", args, err)
+		}
+	}
+}
+
+func TestK8sCaptureJobDryRun(t *testing.T) {
+	session := connectTestSession(t)
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "k8s.profiles.capture_job",
+		Arguments: map[string]any{"target": "job/migrate", "namespace": "batch", "out_dir": "out", "types": []any{"mutex", "cpu", "heap"}, "at": 0.5, "expected_runtime_seconds": 600, "dry_run": true},
+	})
+	if err != nil {
+		t.Fatalf("call tool: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("unexpected tool error: %+v", res.Content)
+	}
+	structured := res.StructuredContent.(map[string]any)
+	if structured["command"] != "kubectl get pods -n batch -l job-name=migrate" || structured["service"] != "migrate" {
+		t.Fatalf("unexpected dry run payload: %v", structured)
+	}
+	commands, _ := structured["commands"].([]any)
+	var fetched []string
+	for _, command := range commands {
+		for _, name := range []string{"heap", "cpu", "mutex"} {
+			if strings.Contains(command.(string), "migrate_batch_"+name+".pprof") {
+				fetched = append(fetched, name)
+			}
+		}
+	}
+	if strings.Join(fetched, ",") != "heap,cpu,mutex" || commands[1] != "sleep <until 5m0s after the pod started>" {
+		t.Fatalf("unexpected commands: %v", commands)
+	}
+
+	res, err = session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "k8s.profiles.capture_job",
+		Arguments: map[string]any{"target": "deployment/api", "out_dir": "out", "dry_run": true},
+	})
+	if err != nil {
+		t.Fatalf("call tool: %v", err)
+	}
+	if !res.IsError {
+		t.Fatalf("expected a non-batch target to fail")
+	}
+}
+
+func TestK8sCaptureDryRun(t *testing.T) {
+	session := connectTestSession(t)
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "k8s.profiles.capture",
+		Arguments: map[string]any{"target": "app=ledger", "namespace": "payments", "out_dir": "out", "types": []any{"cpu", "heap"}, "all": true, "strategy": "cpu", "dry_run": true},
+	})
+	if err != nil {
+		t.Fatalf("call tool: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("unexpected tool error: %+v", res.Content)
+	}
+	structured := res.StructuredContent.(map[string]any)
+	if structured["command"] != "kubectl get pods -n payments -l app=ledger" || structured["service"] != "ledger" {
+		t.Fatalf("unexpected dry run payload: %v", structured)
+	}
+	commands, _ := structured["commands"].([]any)
+	joined := ""
+	for _, command := range commands {
+		joined += command.(string) + "\n"
+	}
+	for _, want := range []string{"kubectl top pods -n payments -l app=ledger --no-headers", "out/<pod>/ledger_payments_heap.pprof", "go tool pprof -proto -output out/fleet/ledger_payments_cpu.pprof out/*/ledger_payments_cpu.pprof"} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("dry run commands missing %q:\n%s", want, joined)
+		}
+	}
+}
+
+func TestK8sDebugCaptureRequiresConfirm(t *testing.T) {
+	session := connectTestSession(t)
+	args := map[string]any{"pod": "ledger-0", "namespace": "payments", "out_dir": "out", "image": "agent:1"}
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "k8s.profiles.debug_capture", Arguments: args})
+	if err != nil {
+		t.Fatalf("call tool: %v", err)
+	}
+	if !res.IsError {
+		t.Fatalf("expected an error without confirm, got %+v", res.StructuredContent)
+	}
+	if text, ok := res.Content[0].(*mcp.TextContent); !ok || !strings.Contains(text.Text, "confirm=true") || !strings.Contains(text.Text, "SYS_PTRACE") {
+		t.Fatalf("error should explain the privileges and confirm flag: %+v", res.Content)
+	}
+
+	args["dry_run"] = true
+	res, err = session.CallTool(context.Background(), &mcp.CallToolParams{Name: "k8s.profiles.debug_capture", Arguments: args})
+	if err != nil {
+		t.Fatalf("call tool: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("unexpected tool error: %+v", res.Content)
+	}
+	structured := res.StructuredContent.(map[string]any)
+	if structured["command"] != "kubectl debug -n payments ledger-0 --image agent:1 --target <container> --profile general --container <debug-container> --quiet -- sleep 630" {
+		t.Fatalf("unexpected dry run command: %v", structured["command"])
+	}
+	if notes, _ := structured["notes"].([]any); len(notes) == 0 || !strings.HasPrefix(notes[0].(string), "PRIVILEGED") {
+		t.Fatalf("dry run should flag the capture as privileged: %v", structured["notes"])
+	}
+}
+
+func TestK8sCompareClustersDryRun(t *testing.T) {
+	session := connectTestSession(t)
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "k8s.profiles.compare_clusters",
+		Arguments: map[string]any{"target": "deployment/ledger", "kube_contexts": []any{"us-east", "eu-west"}, "namespace": "payments", "out_dir": "out", "types": []any{"cpu"}, "dry_run": true},
+	})
+	if err != nil {
+		t.Fatalf("call tool: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("unexpected tool error: %+v", res.Content)
+	}
+	structured := res.StructuredContent.(map[string]any)
+	if structured["command"] != "kubectl --context us-east get deployment/ledger -n payments -o json" || structured["service"] != "ledger" {
+		t.Fatalf("unexpected dry run payload: %v", structured)
+	}
+	commands, _ := structured["commands"].([]any)
+	if last := commands[len(commands)-1]; last != "go tool pprof -top -diff_base out/us-east/fleet/ledger_payments_cpu.pprof out/eu-west/fleet/ledger_payments_cpu.pprof" {
+		t.Fatalf("unexpected diff command %v in %v", last, commands)
+	}
+
+	res, err = session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "k8s.profiles.compare_clusters",
+		Arguments: map[string]any{"target": "deployment/ledger", "kube_contexts": []any{"us-east"}, "out_dir": "out", "dry_run": true},
+	})
+	if err != nil {
+		t.Fatalf("call tool: %v", err)
+	}
+	if !res.IsError {
+		t.Fatalf("expected a single kube context to fail")
+	}
+}
+
+func TestK8sCompareCanaryDryRun(t *testing.T) {
+	session := connectTestSession(t)
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "k8s.profiles.compare_canary",
+		Arguments: map[string]any{"selector": "app=ledger", "canary_selector": "rollout=canary", "namespace": "payments", "out_dir": "out", "types": []any{"cpu"}, "dry_run": true},
+	})
+	if err != nil {
+		t.Fatalf("call tool: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("unexpected tool error: %+v", res.Content)
+	}
+	structured := res.StructuredContent.(map[string]any)
+	if structured["command"] != "kubectl get pods -n payments -l app=ledger,track!=canary -o json" || structured["service"] != "ledger" {
+		t.Fatalf("unexpected dry run payload: %v", structured)
+	}
+	commands, _ := structured["commands"].([]any)
+	if last := commands[len(commands)-1]; last != "go tool pprof -top -diff_base out/stable/fleet/ledger_payments_cpu.pprof out/canary/fleet/ledger_payments_cpu.pprof" {
+		t.Fatalf("unexpected diff command %v in %v", last, commands)
+	}
+}
+
+func TestPprofResolveBinaryDryRun(t *testing.T) {
+	mapping := &profile.Mapping{ID: 1, File: "/app/be-ledger"}
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}},
+		Mapping:    []*profile.Mapping{mapping},
+		Location:   []*profile.Location{{ID: 1, Mapping: mapping, Address: 0x1000}},
+		Period:     1,
+	}
+	prof.Sample = []*profile.Sample{{Location: prof.Location, Value: []int64{1}}}
+	path := filepath.Join(t.TempDir(), "cpu.pprof")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create profile: %v", err)
+	}
+	if err := prof.Write(file); err != nil {
+		t.Fatalf("write profile: %v", err)
+	}
+	file.Close()
+
+	session := connectTestSession(t)
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "pprof.resolve_binary",
+		Arguments: map[string]any{"profile": path, "revision": "0a1b2c3", "strategies": []any{"cache", "image"}, "image": "registry.example.com/{binary}:{revision}", "dry_run": true},
+	})
+	if err != nil {
+		t.Fatalf("call tool: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("unexpected tool error: %+v", res.Content)
+	}
+	structured := res.StructuredContent.(map[string]any)
+	commands, _ := structured["commands"].([]any)
+	if len(commands) != 3 || commands[0] != "docker create registry.example.com/be-ledger:0a1b2c3" || commands[1] != "docker cp <container>:/app/be-ledger <cache>/be-ledger" {
+		t.Fatalf("unexpected dry run commands: %v", commands)
+	}
+	if notes, _ := structured["notes"].([]any); len(notes) != 1 || !strings.HasPrefix(notes[0].(string), "cache: look in ") {
+		t.Fatalf("unexpected notes: %v", structured["notes"])
+	}
+}
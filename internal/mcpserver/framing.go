@@ -0,0 +1,241 @@
+package mcpserver
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Stdio framings. MCP stdio is newline-delimited JSON, but some clients speak
+// LSP-style "Content-Length:" framing.
+const (
+	framingAuto          = "auto"
+	framingNewline       = "newline"
+	framingContentLength = "content-length"
+)
+
+const contentLengthHeader = "Content-Length"
+
+// maxContentLength bounds a framed message, so a bogus header cannot make the
+// server allocate an arbitrary amount of memory.
+const maxContentLength = 64 << 20
+
+func parseFraming(value string) (string, error) {
+	switch framing := strings.ToLower(strings.TrimSpace(value)); framing {
+	case "", framingAuto:
+		return framingAuto, nil
+	case framingNewline, "ndjson":
+		return framingNewline, nil
+	case framingContentLength, "lsp":
+		return framingContentLength, nil
+	default:
+		return "", fmt.Errorf("unknown stdio framing %q (want auto, newline, or content-length)", value)
+	}
+}
+
+// stdioTransport serves MCP over r/w using framing. In auto mode the first
+// bytes from the client decide: a Content-Length header selects LSP framing,
+// anything else newline-delimited JSON. Replies use the client's framing.
+type stdioTransport struct {
+	framing string
+	reader  io.ReadCloser
+	writer  io.WriteCloser
+}
+
+func newStdioTransport(framing string, r io.ReadCloser, w io.WriteCloser) *stdioTransport {
+	return &stdioTransport{framing: framing, reader: r, writer: w}
+}
+
+// Connect implements mcp.Transport.
+func (t *stdioTransport) Connect(ctx context.Context) (mcp.Connection, error) {
+	buffered := bufio.NewReader(t.reader)
+	framing := t.framing
+	if framing == framingAuto {
+		detected, err := detectFraming(buffered)
+		if err != nil {
+			return nil, err
+		}
+		framing = detected
+	}
+	reader := readCloser{Reader: buffered, Closer: t.reader}
+	if framing == framingContentLength {
+		return (&contentLengthTransport{reader: reader, writer: t.writer}).Connect(ctx)
+	}
+	return (&mcp.IOTransport{Reader: reader, Writer: t.writer}).Connect(ctx)
+}
+
+// detectFraming inspects the first message without consuming it.
+func detectFraming(r *bufio.Reader) (string, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if b == ' ' || b == '\t' || b == '\r' || b == '\n' {
+			continue
+		}
+		if err := r.UnreadByte(); err != nil {
+			return "", err
+		}
+		if b == '{' || b == '[' {
+			return framingNewline, nil
+		}
+		break
+	}
+	head, err := r.Peek(len(contentLengthHeader))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	if strings.EqualFold(string(head), contentLengthHeader) {
+		return framingContentLength, nil
+	}
+	return framingNewline, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// nopCloser keeps the process's stdin/stdout open when a connection closes.
+type nopCloser struct {
+	io.ReadWriter
+}
+
+func (nopCloser) Close() error { return nil }
+
+// contentLengthTransport speaks LSP-style framing: each message is preceded
+// by "Content-Length: N" and a blank line.
+type contentLengthTransport struct {
+	reader io.ReadCloser
+	writer io.WriteCloser
+}
+
+// Connect implements mcp.Transport.
+func (t *contentLengthTransport) Connect(context.Context) (mcp.Connection, error) {
+	conn := &contentLengthConn{
+		reader:   textproto.NewReader(bufio.NewReader(t.reader)),
+		closers:  []io.Closer{t.reader, t.writer},
+		writer:   t.writer,
+		incoming: make(chan framedMessage),
+		closed:   make(chan struct{}),
+	}
+	go conn.readLoop()
+	return conn, nil
+}
+
+type framedMessage struct {
+	msg jsonrpc.Message
+	err error
+}
+
+type contentLengthConn struct {
+	reader  *textproto.Reader
+	closers []io.Closer
+
+	writeMu sync.Mutex
+	writer  io.Writer
+
+	incoming  chan framedMessage
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// readLoop reads messages in the background so Close can unblock Read even
+// when the underlying reader (such as os.Stdin) cannot be interrupted.
+func (c *contentLengthConn) readLoop() {
+	for {
+		msg, err := c.readMessage()
+		select {
+		case c.incoming <- framedMessage{msg: msg, err: err}:
+		case <-c.closed:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (c *contentLengthConn) readMessage() (jsonrpc.Message, error) {
+	header, err := c.reader.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	raw := header.Get(contentLengthHeader)
+	if raw == "" {
+		return nil, fmt.Errorf("missing %s header", contentLengthHeader)
+	}
+	length, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid %s %q", contentLengthHeader, raw)
+	}
+	if length > maxContentLength {
+		return nil, fmt.Errorf("%s %d exceeds the %d byte limit", contentLengthHeader, length, maxContentLength)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.reader.R, body); err != nil {
+		return nil, err
+	}
+	return jsonrpc.DecodeMessage(body)
+}
+
+// Read implements mcp.Connection.
+func (c *contentLengthConn) Read(ctx context.Context) (jsonrpc.Message, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.closed:
+		return nil, io.EOF
+	case in := <-c.incoming:
+		return in.msg, in.err
+	}
+}
+
+// Write implements mcp.Connection.
+func (c *contentLengthConn) Write(ctx context.Context, msg jsonrpc.Message) error {
+	data, err := jsonrpc.EncodeMessage(msg)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	select {
+	case <-c.closed:
+		return io.ErrClosedPipe
+	default:
+	}
+	if _, err := fmt.Fprintf(c.writer, "%s: %d\r\n\r\n", contentLengthHeader, len(data)); err != nil {
+		return err
+	}
+	_, err = c.writer.Write(data)
+	return err
+}
+
+// Close implements mcp.Connection.
+func (c *contentLengthConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		for _, closer := range c.closers {
+			if cerr := closer.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+	})
+	return err
+}
+
+// SessionID implements mcp.Connection.
+func (c *contentLengthConn) SessionID() string {
+	return ""
+}
@@ -0,0 +1,134 @@
+package mcpserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestDetectFraming(t *testing.T) {
+	cases := map[string]string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize"}` + "\n": framingNewline,
+		"\r\n  [{\"jsonrpc\":\"2.0\"}]\n":                       framingNewline,
+		"Content-Length: 42\r\n\r\n{}":                          framingContentLength,
+		"content-length: 42\r\n\r\n{}":                          framingContentLength,
+	}
+	for input, want := range cases {
+		r := bufio.NewReader(strings.NewReader(input))
+		got, err := detectFraming(r)
+		if err != nil {
+			t.Fatalf("detect %q: %v", input, err)
+		}
+		if got != want {
+			t.Fatalf("detect %q: got %s want %s", input, got, want)
+		}
+		rest, _ := io.ReadAll(r)
+		if !strings.Contains(input, string(rest)) || len(rest) == 0 {
+			t.Fatalf("detection must not consume the message, left %q", rest)
+		}
+	}
+
+	if _, err := parseFraming("xml"); err == nil {
+		t.Fatalf("expected unknown framing error")
+	}
+}
+
+// lockedBuffer records what the server writes to the client.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func connectFramedSession(t *testing.T, clientTransport func(r io.ReadCloser, w io.WriteCloser) mcp.Transport) (*mcp.ClientSession, *lockedBuffer) {
+	t.Helper()
+	ctx := context.Background()
+	server, err := newServer(toolNameModeDefault)
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	toServerR, toServerW := io.Pipe()
+	toClientR, toClientW := io.Pipe()
+	// Auto-detection blocks until the client's first message arrives.
+	type connected struct {
+		session *mcp.ServerSession
+		err     error
+	}
+	serverDone := make(chan connected, 1)
+	go func() {
+		session, err := server.Connect(ctx, newStdioTransport(framingAuto, toServerR, toClientW), nil)
+		serverDone <- connected{session, err}
+	}()
+	written := &lockedBuffer{}
+	observed := readCloser{Reader: io.TeeReader(toClientR, written), Closer: toClientR}
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "test"}, nil)
+	session, err := client.Connect(ctx, clientTransport(observed, toServerW), nil)
+	if err != nil {
+		t.Fatalf("client connect: %v", err)
+	}
+	result := <-serverDone
+	if result.err != nil {
+		t.Fatalf("server connect: %v", result.err)
+	}
+	t.Cleanup(func() {
+		session.Close()
+		result.session.Close()
+	})
+	return session, written
+}
+
+func TestStdioContentLengthFraming(t *testing.T) {
+	session, written := connectFramedSession(t, func(r io.ReadCloser, w io.WriteCloser) mcp.Transport {
+		return &contentLengthTransport{reader: r, writer: w}
+	})
+	listed, err := session.ListTools(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("list tools: %v", err)
+	}
+	if len(listed.Tools) == 0 {
+		t.Fatalf("expected tools over content-length framing")
+	}
+	if !strings.HasPrefix(written.String(), "Content-Length: ") {
+		t.Fatalf("server should reply with Content-Length framing, got %q", written.String()[:min(40, len(written.String()))])
+	}
+}
+
+func TestStdioNewlineFramingAutoDetected(t *testing.T) {
+	session, written := connectFramedSession(t, func(r io.ReadCloser, w io.WriteCloser) mcp.Transport {
+		return &mcp.IOTransport{Reader: r, Writer: w}
+	})
+	if _, err := session.ListTools(context.Background(), nil); err != nil {
+		t.Fatalf("list tools: %v", err)
+	}
+	if !strings.HasPrefix(written.String(), "{") {
+		t.Fatalf("server should reply with newline-delimited JSON")
+	}
+}
+
+func TestContentLengthRejectsOversizedMessage(t *testing.T) {
+	conn := &contentLengthConn{
+		reader: textproto.NewReader(bufio.NewReader(strings.NewReader("Content-Length: 9999999999\r\n\r\n{}"))),
+	}
+	_, err := conn.readMessage()
+	if err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Fatalf("expected an oversized Content-Length error, got %v", err)
+	}
+}
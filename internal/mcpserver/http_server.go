@@ -0,0 +1,79 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const mcpHTTPPath = "/mcp"
+
+// newHTTPMux serves the MCP streamable HTTP transport at /mcp, liveness at
+// /healthz, readiness at /readyz, Prometheus metrics at /metrics, and the
+// server's own profiles at /debug/pprof/ when PPROF_MCP_HTTP_PPROF=on.
+func newHTTPMux(s *mcp.Server) *http.ServeMux {
+	mux := http.NewServeMux()
+	handler := mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return s }, nil)
+	mux.Handle(mcpHTTPPath, handler)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		writeHealth(w, http.StatusOK, map[string]any{"status": "ok"})
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		if err := readinessCheck(); err != nil {
+			writeHealth(w, http.StatusServiceUnavailable, map[string]any{"status": "unavailable", "error": err.Error()})
+			return
+		}
+		writeHealth(w, http.StatusOK, map[string]any{"status": "ready"})
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		toolMetrics.WritePrometheus(w, s)
+	})
+	if debugPprofEnabled() {
+		handleDebugPprof(mux)
+	}
+	return mux
+}
+
+// readinessCheck verifies the Go toolchain is available, since most pprof
+// tools shell out to `go tool pprof`.
+func readinessCheck() error {
+	if _, err := exec.LookPath("go"); err != nil {
+		return fmt.Errorf("go toolchain not found in PATH: %w", err)
+	}
+	return nil
+}
+
+func writeHealth(w http.ResponseWriter, status int, body map[string]any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// serveHTTP runs the MCP server over streamable HTTP until ctx is done.
+func serveHTTP(ctx context.Context, s *mcp.Server, addr string) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           newHTTPMux(s),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Starting pprof MCP server over HTTP on %s%s", addr, mcpHTTPPath)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package mcpserver
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/arreyder/pprof-mcp/internal/datadog"
+)
+
+// toolDurationBuckets are histogram upper bounds in seconds.
+var toolDurationBuckets = []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 300, 1800}
+
+// serverMetrics holds process-wide counters exposed at /metrics in the
+// Prometheus text format.
+type serverMetrics struct {
+	mu        sync.Mutex
+	calls     map[toolStatus]uint64
+	durations map[string]*durationHistogram
+	inFlight  map[string]int
+}
+
+type toolStatus struct {
+	tool   string
+	status string
+}
+
+type durationHistogram struct {
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+var toolMetrics = newServerMetrics()
+
+func newServerMetrics() *serverMetrics {
+	return &serverMetrics{
+		calls:     map[toolStatus]uint64{},
+		durations: map[string]*durationHistogram{},
+		inFlight:  map[string]int{},
+	}
+}
+
+// Start marks a tool call as in flight and returns a func that records its
+// outcome and latency.
+func (m *serverMetrics) Start(tool string) func(res *mcp.CallToolResult) {
+	start := time.Now()
+	m.mu.Lock()
+	m.inFlight[tool]++
+	m.mu.Unlock()
+	return func(res *mcp.CallToolResult) {
+		m.observe(tool, resultStatus(res), time.Since(start))
+	}
+}
+
+func (m *serverMetrics) observe(tool, status string, elapsed time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight[tool]--
+	m.calls[toolStatus{tool: tool, status: status}]++
+	hist := m.durations[tool]
+	if hist == nil {
+		hist = &durationHistogram{buckets: make([]uint64, len(toolDurationBuckets))}
+		m.durations[tool] = hist
+	}
+	seconds := elapsed.Seconds()
+	for i, bound := range toolDurationBuckets {
+		if seconds <= bound {
+			hist.buckets[i]++
+		}
+	}
+	hist.sum += seconds
+	hist.count++
+}
+
+// resultStatus maps a tool result to a metrics label: "ok" or the lowercased
+// structured error code (invalid_argument, timeout, rate_limited, ...).
+func resultStatus(res *mcp.CallToolResult) string {
+	if res == nil || !res.IsError {
+		return "ok"
+	}
+	if structured, ok := res.StructuredContent.(map[string]any); ok {
+		if payload, ok := structured["error"].(map[string]any); ok {
+			if code, ok := payload["code"].(string); ok && code != "" {
+				return strings.ToLower(code)
+			}
+		}
+	}
+	return "error"
+}
+
+// WritePrometheus writes all metrics in the Prometheus text exposition format.
+func (m *serverMetrics) WritePrometheus(w io.Writer, s *mcp.Server) {
+	m.mu.Lock()
+	calls := make([]toolStatus, 0, len(m.calls))
+	for key := range m.calls {
+		calls = append(calls, key)
+	}
+	sort.Slice(calls, func(i, j int) bool {
+		if calls[i].tool != calls[j].tool {
+			return calls[i].tool < calls[j].tool
+		}
+		return calls[i].status < calls[j].status
+	})
+
+	fmt.Fprintln(w, "# HELP pprof_mcp_tool_calls_total Tool calls by tool and result status.")
+	fmt.Fprintln(w, "# TYPE pprof_mcp_tool_calls_total counter")
+	for _, key := range calls {
+		fmt.Fprintf(w, "pprof_mcp_tool_calls_total{tool=%q,status=%q} %d\n", key.tool, key.status, m.calls[key])
+	}
+
+	fmt.Fprintln(w, "# HELP pprof_mcp_tool_duration_seconds Tool call latency.")
+	fmt.Fprintln(w, "# TYPE pprof_mcp_tool_duration_seconds histogram")
+	for _, tool := range slices.Sorted(maps.Keys(m.durations)) {
+		hist := m.durations[tool]
+		for i, bound := range toolDurationBuckets {
+			fmt.Fprintf(w, "pprof_mcp_tool_duration_seconds_bucket{tool=%q,le=%q} %d\n", tool, formatBound(bound), hist.buckets[i])
+		}
+		fmt.Fprintf(w, "pprof_mcp_tool_duration_seconds_bucket{tool=%q,le=\"+Inf\"} %d\n", tool, hist.count)
+		fmt.Fprintf(w, "pprof_mcp_tool_duration_seconds_sum{tool=%q} %g\n", tool, hist.sum)
+		fmt.Fprintf(w, "pprof_mcp_tool_duration_seconds_count{tool=%q} %d\n", tool, hist.count)
+	}
+
+	fmt.Fprintln(w, "# HELP pprof_mcp_tool_in_flight Tool calls currently executing or queued.")
+	fmt.Fprintln(w, "# TYPE pprof_mcp_tool_in_flight gauge")
+	for _, tool := range slices.Sorted(maps.Keys(m.inFlight)) {
+		fmt.Fprintf(w, "pprof_mcp_tool_in_flight{tool=%q} %d\n", tool, m.inFlight[tool])
+	}
+	m.mu.Unlock()
+
+	active, queued := heavyToolPool().Stats()
+	fmt.Fprintln(w, "# HELP pprof_mcp_worker_pool_active Heavy tool calls holding a worker slot.")
+	fmt.Fprintln(w, "# TYPE pprof_mcp_worker_pool_active gauge")
+	fmt.Fprintf(w, "pprof_mcp_worker_pool_active %d\n", active)
+	fmt.Fprintln(w, "# HELP pprof_mcp_worker_pool_queued Heavy tool calls waiting for a worker slot.")
+	fmt.Fprintln(w, "# TYPE pprof_mcp_worker_pool_queued gauge")
+	fmt.Fprintf(w, "pprof_mcp_worker_pool_queued %d\n", queued)
+
+	apiCalls := datadog.APICallCounts()
+	fmt.Fprintln(w, "# HELP pprof_mcp_datadog_api_calls_total Datadog API HTTP requests by outcome.")
+	fmt.Fprintln(w, "# TYPE pprof_mcp_datadog_api_calls_total counter")
+	for _, outcome := range slices.Sorted(maps.Keys(apiCalls)) {
+		fmt.Fprintf(w, "pprof_mcp_datadog_api_calls_total{outcome=%q} %d\n", outcome, apiCalls[outcome])
+	}
+
+	breakers := datadog.BreakerStates()
+	fmt.Fprintln(w, "# HELP pprof_mcp_datadog_breaker_open Whether the circuit breaker for a Datadog host is open (1) or closed (0).")
+	fmt.Fprintln(w, "# TYPE pprof_mcp_datadog_breaker_open gauge")
+	for _, host := range slices.Sorted(maps.Keys(breakers)) {
+		open := 0
+		if breakers[host] {
+			open = 1
+		}
+		fmt.Fprintf(w, "pprof_mcp_datadog_breaker_open{host=%q} %d\n", host, open)
+	}
+
+	fmt.Fprintln(w, "# HELP pprof_mcp_active_sessions Connected MCP sessions.")
+	fmt.Fprintln(w, "# TYPE pprof_mcp_active_sessions gauge")
+	fmt.Fprintf(w, "pprof_mcp_active_sessions %d\n", activeSessions(s))
+}
+
+func activeSessions(s *mcp.Server) int {
+	if s == nil {
+		return 0
+	}
+	count := 0
+	for range s.Sessions() {
+		count++
+	}
+	return count
+}
+
+func formatBound(bound float64) string {
+	return fmt.Sprintf("%g", bound)
+}
@@ -0,0 +1,101 @@
+package mcpserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestServerMetricsRecordsCalls(t *testing.T) {
+	m := newServerMetrics()
+	m.Start("pprof.top")(TextResult("ok"))
+	done := m.Start("pprof.top")
+	done(ErrorResult(errors.New("boom"), ""))
+	m.Start("pprof.meta")
+
+	var buf bytes.Buffer
+	m.WritePrometheus(&buf, nil)
+	out := buf.String()
+	for _, want := range []string{
+		`pprof_mcp_tool_calls_total{tool="pprof.top",status="ok"} 1`,
+		`pprof_mcp_tool_calls_total{tool="pprof.top",status="internal"} 1`,
+		`pprof_mcp_tool_duration_seconds_count{tool="pprof.top"} 2`,
+		`pprof_mcp_tool_duration_seconds_bucket{tool="pprof.top",le="+Inf"} 2`,
+		`pprof_mcp_tool_in_flight{tool="pprof.meta"} 1`,
+		`pprof_mcp_tool_in_flight{tool="pprof.top"} 0`,
+		"pprof_mcp_active_sessions 0",
+		"# TYPE pprof_mcp_datadog_api_calls_total counter",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("metrics output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestResultStatus(t *testing.T) {
+	if got := resultStatus(TextResult("ok")); got != "ok" {
+		t.Fatalf("expected ok, got %q", got)
+	}
+	limited := rateLimitResult("pprof.discover", &RateLimitError{Class: rateClassDatadog, RetryAfter: time.Second})
+	if got := resultStatus(limited); got != "rate_limited" {
+		t.Fatalf("expected rate_limited, got %q", got)
+	}
+	if got := resultStatus(&mcp.CallToolResult{IsError: true}); got != "error" {
+		t.Fatalf("expected error, got %q", got)
+	}
+}
+
+func TestHTTPHealthAndMetricsEndpoints(t *testing.T) {
+	server, err := newServer(toolNameModeDefault)
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	httpServer := httptest.NewServer(newHTTPMux(server))
+	defer httpServer.Close()
+
+	resp, err := http.Get(httpServer.URL + "/healthz")
+	if err != nil {
+		t.Fatalf("healthz: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("healthz status = %d", resp.StatusCode)
+	}
+
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "test"}, nil)
+	session, err := client.Connect(context.Background(), &mcp.StreamableClientTransport{Endpoint: httpServer.URL + mcpHTTPPath}, nil)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer session.Close()
+	if _, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "pprof.meta",
+		Arguments: map[string]any{"profile": "/nonexistent/cpu.pprof"},
+	}); err != nil {
+		t.Fatalf("call tool: %v", err)
+	}
+
+	resp, err = http.Get(httpServer.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("metrics: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	out := string(body)
+	for _, want := range []string{
+		`pprof_mcp_tool_calls_total{tool="pprof.meta",status=`,
+		"pprof_mcp_active_sessions 1",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("metrics output missing %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,1871 @@
+package mcpserver
+
+import "github.com/arreyder/pprof-mcp/internal/k8s"
+
+func profileCandidateSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"profile_id":     prop("string", "Datadog profile ID"),
+		"event_id":       prop("string", "Datadog event ID"),
+		"timestamp":      prop("string", "Profile timestamp (RFC3339)"),
+		"version":        prop("string", "Build version/tag from profile metadata"),
+		"numeric_fields": numericFieldsSchema(),
+	}, "profile_id", "event_id", "timestamp")
+}
+
+func numericFieldsSchema() map[string]any {
+	return map[string]any{
+		"type":                 "object",
+		"description":          "Numeric fields returned by Datadog for the profile",
+		"additionalProperties": map[string]any{"type": "number"},
+	}
+}
+
+func profileFileSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"type":   prop("string", "Profile type (cpu, heap, allocs, goroutines, mutex, block, threadcreate)"),
+		"handle": prop("string", "Handle ID for the downloaded profile (use in pprof.* tools)"),
+		"bytes":  prop("integer", "File size in bytes"),
+	}, "type", "handle", "bytes")
+}
+
+func truncationMetaSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"total_lines":      prop("integer", "Total number of lines before truncation"),
+		"total_bytes":      prop("integer", "Total number of bytes before truncation"),
+		"truncated":        prop("boolean", "Whether the output was truncated"),
+		"truncated_reason": prop("string", "Comma-separated truncation reasons: max_lines, max_bytes (the call's limits), capture_limit (the server's stdout/stderr capture cap)"),
+		"strategy":         prop("string", "Truncation strategy (head, tail, head_tail)"),
+	}, "total_lines", "total_bytes", "truncated")
+}
+
+func datadogProfilesListOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "CLI command equivalent"),
+		"result": NewObjectSchema(map[string]any{
+			"service":    prop("string", "Service name"),
+			"env":        prop("string", "Environment"),
+			"host":       prop("string", "Host filter used"),
+			"dd_site":    prop("string", "Datadog site"),
+			"from_ts":    prop("string", "Resolved start time"),
+			"to_ts":      prop("string", "Resolved end time"),
+			"limit":      prop("integer", "Result limit"),
+			"candidates": arrayPropSchema(profileCandidateSchema(), "Profile candidates"),
+			"warnings":   arrayPropSchema(prop("string", "Warning"), "Warnings"),
+		}, "service", "env", "dd_site", "from_ts", "to_ts", "limit", "candidates"),
+	}, "command", "result")
+}
+
+func datadogProfilesPickOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "CLI command equivalent"),
+		"result": NewObjectSchema(map[string]any{
+			"candidate": profileCandidateSchema(),
+			"reason":    prop("string", "Selection reason"),
+			"warnings":  arrayPropSchema(prop("string", "Warning"), "Warnings"),
+		}, "candidate", "reason"),
+	}, "command", "result")
+}
+
+// dryRunOutputSchema describes the payload returned when dry_run is set.
+func dryRunOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"dry_run":         prop("boolean", "Always true: nothing was executed"),
+		"command":         prop("string", "Primary command that would be executed"),
+		"commands":        arrayPropSchema(prop("string", "Command"), "Commands that would be executed, in order"),
+		"service":         prop("string", "Service name"),
+		"mode":            prop("string", "Download mode (d2)"),
+		"plan_id":         prop("string", "Plan ID (execute only)"),
+		"before_ref":      prop("string", "Baseline git ref"),
+		"after_ref":       prop("string", "Comparison git ref"),
+		"current_branch":  prop("string", "Branch restored afterwards"),
+		"has_uncommitted": prop("boolean", "Whether uncommitted changes would be stashed"),
+		"notes":           arrayPropSchema(prop("string", "Note"), "Runtime behavior not captured by the command list"),
+	}, "dry_run", "command", "commands", "service")
+}
+
+// withDryRunOutput allows either the tool's normal output or a dry-run listing.
+func withDryRunOutput(schema map[string]any) map[string]any {
+	return map[string]any{
+		"type":  "object",
+		"anyOf": []any{schema, dryRunOutputSchema()},
+	}
+}
+
+func profilesDownloadAutoOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "Command executed"),
+		"mode":    prop("string", "Download mode used (d2 or datadog)"),
+		"result": map[string]any{
+			"type":                 "object",
+			"description":          "Download result (schema varies by mode)",
+			"additionalProperties": true,
+		},
+	}, "command", "mode", "result")
+}
+
+func downloadLatestBundleOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "CLI command equivalent"),
+		"result": NewObjectSchema(map[string]any{
+			"service":      prop("string", "Service name"),
+			"env":          prop("string", "Environment"),
+			"dd_site":      prop("string", "Datadog site"),
+			"from_ts":      prop("string", "Resolved start time"),
+			"to_ts":        prop("string", "Resolved end time"),
+			"profile_id":   prop("string", "Profile ID"),
+			"event_id":     prop("string", "Event ID"),
+			"timestamp":    prop("string", "Profile timestamp"),
+			"files":        arrayPropSchema(profileFileSchema(), "Downloaded profiles"),
+			"metrics_path": prop("string", "Path to metrics file"),
+			"warnings":     arrayPropSchema(prop("string", "Warning"), "Warnings"),
+		}, "service", "env", "dd_site", "from_ts", "to_ts", "profile_id", "event_id", "files"),
+	}, "command", "result")
+}
+
+func d2DownloadOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "kubectl commands executed"),
+		"result": NewObjectSchema(map[string]any{
+			"service":    prop("string", "Service name"),
+			"namespace":  prop("string", "Kubernetes namespace"),
+			"pod_name":   prop("string", "Pod name"),
+			"pod_ip":     prop("string", "Pod IP address"),
+			"files":      arrayPropSchema(profileFileSchema(), "Downloaded profiles"),
+			"pod_health": podHealthSchema(),
+			"warnings":   arrayPropSchema(prop("string", "Warning"), "Warnings, including recent restarts, OOM kills, and probe failures"),
+		}, "service", "namespace", "pod_name", "files"),
+	}, "command", "result")
+}
+
+// podHealthSchema describes k8s.PodHealth
+func podHealthSchema() map[string]any {
+	containerSchema := NewObjectSchema(map[string]any{
+		"name":           prop("string", "Container name"),
+		"ready":          prop("boolean", "Whether the container is ready"),
+		"restart_count":  prop("integer", "Restarts since the pod was created"),
+		"started_at":     prop("string", "When the current run started (RFC3339)"),
+		"last_reason":    prop("string", "Why the previous run ended (OOMKilled, Error, ...)"),
+		"last_exit_code": prop("integer", "Exit code of the previous run"),
+		"last_finished":  prop("string", "When the previous run ended (RFC3339)"),
+		"waiting":        prop("string", "Why the container is waiting (CrashLoopBackOff, ...)"),
+	}, "name", "ready", "restart_count")
+	eventSchema := NewObjectSchema(map[string]any{
+		"type":      prop("string", "Normal or Warning"),
+		"reason":    prop("string", "Event reason (Unhealthy, BackOff, Killing, ...)"),
+		"message":   prop("string", "Event message"),
+		"count":     prop("integer", "Times the event was seen"),
+		"last_seen": prop("string", "When it was last seen (RFC3339)"),
+	}, "type", "reason", "message", "count", "last_seen")
+	return NewObjectSchema(map[string]any{
+		"pod":        prop("string", "Pod name"),
+		"read_at":    prop("string", "When the pod was read, after the profiles (RFC3339)"),
+		"containers": arrayPropSchema(containerSchema, "Container restarts"),
+		"events":     arrayPropSchema(eventSchema, "Recent pod events, newest first"),
+	}, "pod", "read_at", "containers")
+}
+
+func k8sCaptureOutputSchema() map[string]any {
+	podSchema := NewObjectSchema(map[string]any{
+		"pod":         prop("string", "Pod name"),
+		"status":      enumProp("string", "Capture outcome", []string{"ok", "partial", "failed", "skipped"}),
+		"duration_ms": prop("integer", "Time spent on the pod"),
+		"port":        prop("integer", "pprof port the pod was captured on"),
+		"port_source": prop("string", "explicit, or where the port was discovered (annotation, container port, arg, env, repo, default)"),
+		"files":       arrayPropSchema(profileFileSchema(), "Downloaded profiles"),
+		"cgroup":      cgroupStatsSchema(),
+		"error":       prop("string", "Why the pod failed or was skipped"),
+		"warnings":    arrayPropSchema(prop("string", "Warning"), "Profile types that failed on this pod"),
+	}, "pod", "status", "duration_ms", "files")
+	contributionSchema := NewObjectSchema(map[string]any{
+		"pod":     prop("string", "Pod name"),
+		"samples": prop("integer", "Samples contributed"),
+		"total":   prop("integer", "Sample value contributed"),
+		"pct":     prop("number", "Share of the fleet total (percent)"),
+	}, "pod", "samples", "total", "pct")
+	fleetSchema := NewObjectSchema(map[string]any{
+		"type":          prop("string", "Profile type"),
+		"handle":        prop("string", "Handle ID for the merged profile"),
+		"pods":          prop("integer", "Pods merged"),
+		"contributions": arrayPropSchema(contributionSchema, "Per-pod share of the merged profile"),
+	}, "type", "handle", "pods", "contributions")
+	failedSchema := NewObjectSchema(map[string]any{
+		"pod":   prop("string", "Pod name"),
+		"error": prop("string", "Why the capture failed"),
+	}, "pod", "error")
+
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "kubectl command used to list pods"),
+		"result": NewObjectSchema(map[string]any{
+			"service":   prop("string", "Service name"),
+			"namespace": prop("string", "Kubernetes namespace"),
+			"workload":  prop("string", "Workload the selector was resolved from"),
+			"selector":  prop("string", "Label selector"),
+			"selection": NewObjectSchema(map[string]any{
+				"strategy": prop("string", "Pod selection strategy"),
+				"node":     prop("string", "Node filter"),
+				"matched":  prop("integer", "Running pods that matched"),
+				"selected": arrayPropSchema(prop("string", "Pod name"), "Pods chosen, in strategy order"),
+				"usage":    NewObjectSchemaWithAdditional(map[string]any{}, prop("number", "CPU millicores or memory bytes")),
+			}, "strategy", "matched", "selected"),
+			"pods":     arrayPropSchema(podSchema, "Every selected pod with its outcome, in pod order"),
+			"fleet":    arrayPropSchema(fleetSchema, "Profiles merged across pods"),
+			"failed":   arrayPropSchema(failedSchema, "Pods that failed to respond"),
+			"warnings": arrayPropSchema(prop("string", "Warning"), "Warnings"),
+		}, "service", "namespace", "selector", "pods", "fleet"),
+		"incident_id": prop("string", "Active incident the output directory belongs to"),
+	}, "command", "result")
+}
+
+// cgroupStatsSchema describes k8s.CgroupStats
+func cgroupStatsSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"container":          prop("string", "Container whose cgroup was read"),
+		"version":            prop("integer", "cgroup version (1 or 2)"),
+		"window_seconds":     prop("number", "Time between the reads before and after the profiles"),
+		"periods":            prop("integer", "CFS periods elapsed in the window"),
+		"throttled_periods":  prop("integer", "Periods in which the CPU quota ran out"),
+		"throttled_pct":      prop("number", "Share of periods throttled (percent)"),
+		"throttled_seconds":  prop("number", "Time spent throttled in the window"),
+		"usage_seconds":      prop("number", "CPU used in the window (cgroup v2)"),
+		"cpu_limit_cores":    prop("number", "CPU limit from the CFS quota (absent when unlimited)"),
+		"memory_bytes":       prop("integer", "Memory in use after the capture"),
+		"memory_peak_bytes":  prop("integer", "Peak memory since the container started"),
+		"memory_limit_bytes": prop("integer", "Memory limit (absent when unlimited)"),
+		"error":              prop("string", "Why the stats could not be read"),
+	}, "container")
+}
+
+func k8sCompareClustersOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"result":      NewObjectSchema(compareResultProperties(), "service", "clusters", "config_differences", "diffs"),
+		"incident_id": prop("string", "Active incident the output directory belongs to"),
+	}, "result")
+}
+
+func k8sCompareCanaryOutputSchema() map[string]any {
+	properties := compareResultProperties()
+	properties["verdict"] = NewObjectSchema(map[string]any{
+		"stable_cpu_seconds_per_pod": prop("number", "CPU seconds per captured stable pod"),
+		"canary_cpu_seconds_per_pod": prop("number", "CPU seconds per captured canary pod"),
+		"change_pct":                 prop("number", "Canary change in CPU per pod (percent)"),
+		"worse":                      prop("boolean", "Canary uses 10% or more CPU per pod than stable"),
+		"summary":                    prop("string", "One-line verdict"),
+	}, "stable_cpu_seconds_per_pod", "canary_cpu_seconds_per_pod", "change_pct", "worse", "summary")
+	return NewObjectSchema(map[string]any{
+		"result":      NewObjectSchema(properties, "service", "clusters", "config_differences", "diffs"),
+		"incident_id": prop("string", "Active incident the output directory belongs to"),
+	}, "result")
+}
+
+// compareResultProperties describe a two-sided comparison's result
+func compareResultProperties() map[string]any {
+	configSchema := NewObjectSchema(map[string]any{
+		"replicas":       prop("integer", "Running pods matching the target"),
+		"container":      prop("string", "Container serving pprof"),
+		"images":         arrayPropSchema(prop("string", "Image"), "Images of the captured pods"),
+		"cpu_request":    prop("string", "CPU request"),
+		"cpu_limit":      prop("string", "CPU limit"),
+		"memory_request": prop("string", "Memory request"),
+		"memory_limit":   prop("string", "Memory limit"),
+		"env":            NewObjectSchemaWithAdditional(map[string]any{}, prop("string", "Value")),
+		"throttled_pct":  prop("number", "Mean CPU throttling of the captured pods (percent)"),
+	}, "replicas", "container", "images")
+	clusterSchema := NewObjectSchema(map[string]any{
+		"label":        prop("string", "Side name and output subdirectory"),
+		"kube_context": prop("string", "kubectl context"),
+		"namespace":    prop("string", "Kubernetes namespace"),
+		"selector":     prop("string", "Label selector"),
+		"pods":         arrayPropSchema(prop("string", "Pod name"), "Pods captured"),
+		"config":       configSchema,
+		"fleet": arrayPropSchema(NewObjectSchema(map[string]any{
+			"type":   prop("string", "Profile type"),
+			"handle": prop("string", "Handle ID for the merged profile"),
+			"pods":   prop("integer", "Pods merged"),
+		}, "type", "handle", "pods"), "Merged profiles"),
+		"failed": arrayPropSchema(NewObjectSchema(map[string]any{
+			"pod":   prop("string", "Pod name"),
+			"error": prop("string", "Why the capture failed"),
+		}, "pod", "error"), "Pods that failed to respond"),
+	}, "label", "namespace", "pods", "config", "fleet")
+	differenceSchema := NewObjectSchema(map[string]any{
+		"setting": prop("string", "image, replicas, cpu_request, cpu_limit, memory_request, memory_limit, GOMAXPROCS, GOMEMLIMIT, GOGC, GODEBUG, or throttled_pct"),
+		"values":  arrayPropSchema(prop("string", "Value"), "Values in side order; empty when unset"),
+		"effect":  prop("string", "What the setting does to a profile"),
+	}, "setting", "values", "effect")
+	diffSchema := NewObjectSchema(map[string]any{
+		"type":   prop("string", "Profile type"),
+		"deltas": arrayPropSchema(NewObjectSchemaWithAdditional(map[string]any{}, true), "Largest increases then decreases, second side minus first"),
+	}, "type", "deltas")
+	attributionSchema := NewObjectSchema(map[string]any{
+		"type":          prop("string", "Profile type"),
+		"function":      prop("string", "Runtime function that moved"),
+		"delta_seconds": prop("number", "Change, second side minus first"),
+		"settings":      arrayPropSchema(prop("string", "Setting"), "Differing settings that drive it"),
+		"reason":        prop("string", "How the settings affect the function"),
+	}, "type", "function", "delta_seconds", "settings", "reason")
+	return map[string]any{
+		"service":            prop("string", "Service name"),
+		"clusters":           arrayPropSchema(clusterSchema, "The two sides, baseline first"),
+		"config_differences": arrayPropSchema(differenceSchema, "Settings that differ between the sides"),
+		"diffs":              arrayPropSchema(diffSchema, "diff_top of the merged cpu, mutex, and block profiles"),
+		"attributions":       arrayPropSchema(attributionSchema, "Runtime changes tied to configuration differences"),
+		"warnings":           arrayPropSchema(prop("string", "Warning"), "Warnings, prefixed with the side"),
+	}
+}
+
+func k8sCaptureJobOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "kubectl command polled for the job's pods"),
+		"result": NewObjectSchema(map[string]any{
+			"service":                  prop("string", "Service name"),
+			"namespace":                prop("string", "Kubernetes namespace"),
+			"workload":                 prop("string", "Job or CronJob captured"),
+			"selector":                 prop("string", "Label selector"),
+			"job":                      prop("string", "Job the captured pod belongs to"),
+			"pod":                      prop("string", "Captured pod"),
+			"status":                   enumProp("string", "Capture outcome", []string{"ok", "partial", "failed", "skipped"}),
+			"port":                     prop("integer", "pprof port the pod was captured on"),
+			"port_source":              prop("string", "explicit, or where the port was discovered (annotation, container port, arg, env, repo, default)"),
+			"pod_started":              prop("string", "When the pod started (RFC3339)"),
+			"capture_started":          prop("string", "When the capture started (RFC3339)"),
+			"expected_runtime_seconds": prop("number", "Expected runtime the capture was timed against"),
+			"seconds":                  prop("integer", "CPU profile duration used"),
+			"finished":                 enumProp("string", "Pod phase when it exited before every profile was fetched", []string{"Succeeded", "Failed", "Gone"}),
+			"files":                    arrayPropSchema(profileFileSchema(), "Downloaded profiles"),
+			"cgroup":                   cgroupStatsSchema(),
+			"warnings":                 arrayPropSchema(prop("string", "Warning"), "Warnings"),
+		}, "service", "namespace", "workload", "selector", "pod", "status", "files"),
+		"incident_id": prop("string", "Active incident the output directory belongs to"),
+	}, "command", "result")
+}
+
+func k8sDebugCaptureOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command":    prop("string", "kubectl debug command that injected the container"),
+		"privileged": prop("boolean", "Always true: the capture modified the pod"),
+		"result": NewObjectSchema(map[string]any{
+			"service":         prop("string", "Service name"),
+			"namespace":       prop("string", "Kubernetes namespace"),
+			"pod":             prop("string", "Profiled pod"),
+			"container":       prop("string", "Profiled container"),
+			"debug_container": prop("string", "Ephemeral container left in the pod spec"),
+			"image":           prop("string", "Agent image"),
+			"files":           arrayPropSchema(profileFileSchema(), "Captured CPU profile"),
+			"warnings":        arrayPropSchema(prop("string", "Warning"), "Warnings"),
+		}, "service", "namespace", "pod", "container", "debug_container", "image", "files"),
+		"incident_id": prop("string", "Active incident the output directory belongs to"),
+	}, "command", "privileged", "result")
+}
+
+func d2BranchImpactOutputSchema() map[string]any {
+	downloadResultSchema := NewObjectSchema(map[string]any{
+		"service":   prop("string", "Service name"),
+		"namespace": prop("string", "Kubernetes namespace"),
+		"pod_name":  prop("string", "Pod name"),
+		"pod_ip":    prop("string", "Pod IP address"),
+		"files":     arrayPropSchema(profileFileSchema(), "Downloaded profiles"),
+		"warnings":  arrayPropSchema(prop("string", "Warning"), "Warnings"),
+	}, "service", "namespace", "pod_name", "files")
+	serviceSchema := NewObjectSchema(map[string]any{
+		"service":         prop("string", "Service name"),
+		"before_profiles": downloadResultSchema,
+		"after_profiles":  downloadResultSchema,
+		"update_method":   prop("string", "Update method detected for this service"),
+	}, "service", "before_profiles", "after_profiles", "update_method")
+	serviceCPUSchema := NewObjectSchema(map[string]any{
+		"service":            prop("string", "Service name"),
+		"before_seconds":     prop("number", "CPU seconds on before_ref"),
+		"after_seconds":      prop("number", "CPU seconds on after_ref"),
+		"delta_seconds":      prop("number", "Change in CPU seconds"),
+		"delta_pct":          prop("number", "Change in CPU seconds (percent)"),
+		"before_share_pct":   prop("number", "Share of combined CPU on before_ref (percent)"),
+		"after_share_pct":    prop("number", "Share of combined CPU on after_ref (percent)"),
+		"share_shift_points": prop("number", "Change in share of combined CPU (percentage points)"),
+	}, "service", "before_seconds", "after_seconds", "delta_seconds", "before_share_pct", "after_share_pct", "share_shift_points")
+	combinedSchema := NewObjectSchema(map[string]any{
+		"services":       arrayPropSchema(serviceCPUSchema, "CPU per service"),
+		"before_seconds": prop("number", "Combined CPU seconds on before_ref"),
+		"after_seconds":  prop("number", "Combined CPU seconds on after_ref"),
+		"delta_seconds":  prop("number", "Change in combined CPU seconds"),
+		"delta_pct":      prop("number", "Change in combined CPU seconds (percent)"),
+	}, "services", "before_seconds", "after_seconds", "delta_seconds")
+
+	return NewObjectSchema(map[string]any{
+		"service":         prop("string", "Service name"),
+		"before_ref":      prop("string", "Git ref used for baseline"),
+		"after_ref":       prop("string", "Git ref used for comparison"),
+		"before_profiles": downloadResultSchema,
+		"after_profiles":  downloadResultSchema,
+		"update_method":   prop("string", "Update method detected: live_update, pod_restart, pod_recreate, container_restart, container_recreate, or rollout"),
+		"git_stashed":     prop("boolean", "Whether uncommitted changes were stashed"),
+		"restore":         restoreReportSchema(),
+		"stats":           arrayPropSchema(repeatedStatsSchema(), "Per-service statistics across runs, when runs > 1"),
+		"before_load":     loadSummarySchema(),
+		"after_load":      loadSummarySchema(),
+		"services":        arrayPropSchema(serviceSchema, "Every compared service, when services was given"),
+		"combined":        combinedSchema,
+		"analysis":        arrayPropSchema(branchAnalysisSchema(), "Diffs and hotspots per service, unless analyze=false"),
+		"report":          prop("string", "Markdown comparison report"),
+		"report_path":     prop("string", "Where the report was written"),
+		"warnings":        arrayPropSchema(prop("string", "Warning"), "Warnings"),
+	}, "service", "before_ref", "after_ref", "before_profiles", "after_profiles", "update_method", "git_stashed")
+}
+
+func branchAnalysisSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"service": prop("string", "Service name"),
+		"diffs": arrayPropSchema(NewObjectSchema(map[string]any{
+			"type":   prop("string", "Profile type: cpu, mutex, or block"),
+			"deltas": arrayPropSchema(diffTopDeltaSchema(), "The functions that grew most, then those that shrank most, by delta_seconds"),
+		}, "type", "deltas"), "pprof.diff_top per profile type"),
+		"before_hotspots": hotspotSummarySchema(),
+		"after_hotspots":  hotspotSummarySchema(),
+	}, "service")
+}
+
+func d2BranchImpactPlanOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"id":              prop("string", "Unique plan ID for execution"),
+		"steps":           arrayPropSchema(prop("string", "Step"), "Execution steps"),
+		"estimated_time":  prop("string", "Estimated duration"),
+		"current_branch":  prop("string", "Current git branch"),
+		"has_uncommitted": prop("boolean", "Whether there are uncommitted changes"),
+		"service":         prop("string", "Service to profile"),
+		"services":        arrayPropSchema(prop("string", "Service name"), "Dependent services profiled alongside service"),
+		"before_ref":      prop("string", "Baseline git ref"),
+		"after_ref":       prop("string", "Comparison git ref"),
+		"expires_at":      prop("string", "When the plan can no longer be executed (RFC 3339)"),
+		"plan_dir":        prop("string", "Directory the plan is persisted in (empty when plans are kept in memory only)"),
+		"runs":            prop("integer", "CPU captures per ref, when more than one"),
+	}, "id", "steps", "estimated_time", "current_branch", "has_uncommitted", "service", "before_ref", "after_ref")
+}
+
+func repeatedStatsSchema() map[string]any {
+	deltaSchema := NewObjectSchema(map[string]any{
+		"function":      prop("string", "Function (flat CPU), or total"),
+		"before_mean":   prop("number", "Mean CPU seconds per run on before_ref"),
+		"before_stddev": prop("number", "Standard deviation on before_ref"),
+		"after_mean":    prop("number", "Mean CPU seconds per run on after_ref"),
+		"after_stddev":  prop("number", "Standard deviation on after_ref"),
+		"delta":         prop("number", "Change in mean CPU seconds"),
+		"delta_pct":     prop("number", "Change in mean CPU seconds (percent)"),
+		"ci_low":        prop("number", "Lower bound of the 95% confidence interval for delta"),
+		"ci_high":       prop("number", "Upper bound of the 95% confidence interval for delta"),
+		"significant":   prop("boolean", "Whether the interval excludes zero"),
+	}, "function", "before_mean", "after_mean", "delta", "ci_low", "ci_high", "significant")
+	return NewObjectSchema(map[string]any{
+		"service":     prop("string", "Service name"),
+		"runs":        prop("integer", "Readable captures per ref"),
+		"total":       deltaSchema,
+		"functions":   arrayPropSchema(deltaSchema, "Functions with the largest changes, significant ones first"),
+		"significant": prop("integer", "Number of functions with a significant change"),
+	}, "service", "runs", "total", "functions", "significant")
+}
+
+func loadSummarySchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"tool":            enumProp("string", "Load generator", []string{"command", "k6", "vegeta"}),
+		"command":         prop("string", "Command that generated the load"),
+		"seconds":         prop("integer", "Load duration in seconds"),
+		"requests":        prop("number", "Requests sent (k6 and vegeta)"),
+		"rate_per_sec":    prop("number", "Requests per second"),
+		"success_ratio":   prop("number", "Fraction of requests that succeeded"),
+		"latency_mean_ms": prop("number", "Mean latency (ms)"),
+		"latency_p50_ms":  prop("number", "Median latency (ms)"),
+		"latency_p95_ms":  prop("number", "95th percentile latency (ms)"),
+		"latency_p99_ms":  prop("number", "99th percentile latency (ms)"),
+		"output":          prop("string", "Tail of the load tool's output"),
+		"error":           prop("string", "Why the load failed or its summary could not be read"),
+	}, "tool", "command", "seconds")
+}
+
+func restoreReportSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"branch":          prop("string", "Branch checked out before the run"),
+		"branch_restored": prop("boolean", "Whether the branch was checked out again"),
+		"stash_popped":    prop("boolean", "Whether auto-stashed changes were restored"),
+		"errors":          arrayPropSchema(prop("string", "Error"), "Restore steps that failed"),
+	}, "branch", "branch_restored", "stash_popped")
+}
+
+func d2BranchImpactAbortOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"plan_id":   prop("string", "Aborted plan (empty for a one-phase pprof.branch_impact run)"),
+		"service":   prop("string", "Service being profiled"),
+		"phase":     prop("string", "What the run was doing when aborted"),
+		"recovered": prop("boolean", "Whether the run belonged to a server that had exited"),
+		"restore":   restoreReportSchema(),
+	}, "service", "phase", "recovered")
+}
+
+func d2BranchImpactListOutputSchema() map[string]any {
+	runSchema := NewObjectSchema(map[string]any{
+		"id":          prop("string", "Plan ID"),
+		"status":      enumProp("string", "Plan status", []string{"pending", "running", "succeeded", "failed", "aborted", "expired"}),
+		"service":     prop("string", "Service profiled"),
+		"services":    arrayPropSchema(prop("string", "Service name"), "Dependent services profiled alongside service"),
+		"before_ref":  prop("string", "Baseline git ref"),
+		"after_ref":   prop("string", "Comparison git ref"),
+		"created_at":  prop("string", "When the plan was created (RFC 3339)"),
+		"expires_at":  prop("string", "When a pending plan expires (RFC 3339)"),
+		"started_at":  prop("string", "When execution started (RFC 3339)"),
+		"finished_at": prop("string", "When execution finished (RFC 3339)"),
+		"error":       prop("string", "Why the run failed"),
+	}, "id", "status", "service", "before_ref", "after_ref", "created_at", "expires_at")
+	return NewObjectSchema(map[string]any{
+		"plan_dir": prop("string", "Directory plans are persisted in (empty when plans are kept in memory only)"),
+		"runs":     arrayPropSchema(runSchema, "Plans, newest first"),
+	}, "plan_dir", "runs")
+}
+
+func d2BranchImpactShowOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"plan_dir": prop("string", "Directory plans are persisted in (empty when plans are kept in memory only)"),
+		"plan": NewObjectSchema(map[string]any{
+			"id":              prop("string", "Plan ID"),
+			"params":          NewObjectSchemaWithAdditional(map[string]any{}, true),
+			"steps":           arrayPropSchema(prop("string", "Step"), "Execution steps"),
+			"estimated_time":  prop("string", "Estimated duration"),
+			"current_branch":  prop("string", "Branch checked out when the plan was created"),
+			"has_uncommitted": prop("boolean", "Whether there were uncommitted changes"),
+			"created_at":      prop("string", "When the plan was created (RFC 3339)"),
+			"expires_at":      prop("string", "When a pending plan expires (RFC 3339)"),
+			"status":          enumProp("string", "Plan status", []string{"pending", "running", "succeeded", "failed", "aborted", "expired"}),
+			"started_at":      prop("string", "When execution started (RFC 3339)"),
+			"finished_at":     prop("string", "When execution finished (RFC 3339)"),
+			"result":          NewObjectSchemaWithAdditional(map[string]any{}, true),
+			"error":           prop("string", "Why the run failed"),
+		}, "id", "params", "steps", "created_at", "status"),
+	}, "plan_dir", "plan")
+}
+
+func d2ScheduleOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"id":               prop("string", "Schedule ID"),
+		"status":           enumProp("string", "Schedule status", []string{"running", "finished", "stopped", "failed", "interrupted"}),
+		"services":         arrayPropSchema(prop("string", "Service name"), "Services captured"),
+		"dev_env":          prop("string", "Dev environment the services run in"),
+		"interval_seconds": prop("integer", "Seconds between captures"),
+		"seconds":          prop("integer", "CPU profile duration per capture"),
+		"count":            prop("integer", "Rounds the schedule stops after (0 = until duration)"),
+		"duration_seconds": prop("integer", "Seconds the schedule stops after (0 = until count)"),
+		"out_dir":          prop("string", "Directory captures are written under"),
+		"started_at":       prop("string", "When the schedule started (RFC 3339)"),
+		"next_at":          prop("string", "When the next round starts (RFC 3339)"),
+		"finished_at":      prop("string", "When the schedule ended (RFC 3339)"),
+		"rounds":           prop("integer", "Rounds captured so far"),
+		"captures":         prop("integer", "Service captures made so far"),
+		"failed_captures":  prop("integer", "Service captures that failed"),
+		"growing":          arrayPropSchema(prop("string", "service: metric"), "Metrics growing across captures, like a leak"),
+		"error":            prop("string", "Why the schedule failed"),
+	}, "id", "status", "services", "interval_seconds", "out_dir", "started_at", "rounds", "captures")
+}
+
+func d2ScheduleListOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"schedule_dir": prop("string", "Directory schedules are recorded in"),
+		"schedules":    arrayPropSchema(d2ScheduleOutputSchema(), "Schedules, newest first"),
+	}, "schedule_dir", "schedules")
+}
+
+func d2ScheduleShowOutputSchema() map[string]any {
+	metricSchema := NewObjectSchema(map[string]any{
+		"metric":       enumProp("string", "Total tracked", []string{"heap_inuse_bytes", "goroutines", "cpu_seconds"}),
+		"first":        prop("number", "Value at the first capture"),
+		"last":         prop("number", "Value at the last capture"),
+		"min":          prop("number", "Smallest value"),
+		"max":          prop("number", "Largest value"),
+		"change_pct":   prop("number", "Change from first to last (percent)"),
+		"per_hour":     prop("number", "Least-squares slope per hour"),
+		"rising_ratio": prop("number", "Share of intervals in which the value grew"),
+		"growing":      prop("boolean", "Whether the value grows steadily, like a leak"),
+	}, "metric", "first", "last", "change_pct", "per_hour", "rising_ratio", "growing")
+	trendSchema := NewObjectSchema(map[string]any{
+		"service":  prop("string", "Service name"),
+		"captures": prop("integer", "Successful captures"),
+		"from":     prop("string", "First capture (RFC 3339)"),
+		"to":       prop("string", "Last capture (RFC 3339)"),
+		"metrics":  arrayPropSchema(metricSchema, "Tracked totals"),
+		"growing":  arrayPropSchema(prop("string", "Metric"), "Metrics that look like a leak"),
+	}, "service", "captures", "from", "to", "metrics")
+	captureSchema := NewObjectSchema(map[string]any{
+		"service":          prop("string", "Service name"),
+		"round":            prop("integer", "Round number, from 1"),
+		"at":               prop("string", "When the round started (RFC 3339)"),
+		"dir":              prop("string", "Directory the profiles were written to"),
+		"files":            arrayPropSchema(NewObjectSchemaWithAdditional(map[string]any{}, true), "Profiles with type, path, and bytes"),
+		"heap_inuse_bytes": prop("number", "Heap in use"),
+		"goroutines":       prop("number", "Goroutine count"),
+		"cpu_seconds":      prop("number", "CPU seconds in the CPU profile"),
+		"warnings":         arrayPropSchema(prop("string", "Warning"), "Profiles that failed or could not be read"),
+		"error":            prop("string", "Why the capture failed"),
+	}, "service", "round", "at", "dir")
+	return NewObjectSchema(map[string]any{
+		"schedule":       d2ScheduleOutputSchema(),
+		"trends":         arrayPropSchema(trendSchema, "Per-service trends across successful captures"),
+		"captures":       arrayPropSchema(captureSchema, "Latest captures, oldest first"),
+		"captures_total": prop("integer", "Captures recorded, including those left out"),
+	}, "schedule", "trends", "captures", "captures_total")
+}
+
+func pprofTopOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command":     prop("string", "pprof command"),
+		"raw":         prop("string", "Raw pprof output"),
+		"raw_meta":    truncationMetaSchema(),
+		"stderr":      prop("string", "Command stderr (if any)"),
+		"stderr_meta": truncationMetaSchema(),
+		"rows":        arrayPropSchema(pprofTopRowSchema(), "Top rows"),
+		"summary":     pprofTopSummarySchema(),
+		"hints":       arrayPropSchema(prop("string", "Hint"), "Contextual hints based on profile type"),
+		"baseline":    baselineComparisonSchema(),
+	}, "command", "raw", "rows", "summary")
+}
+
+func baselineComparisonSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"key":              prop("string", "Baseline key"),
+		"profile_kind":     prop("string", "Detected profile kind"),
+		"sample_index":     prop("string", "Sample index used for baseline"),
+		"baseline_samples": prop("integer", "Number of profiles in baseline"),
+		"deviations": arrayPropSchema(NewObjectSchema(map[string]any{
+			"function": prop("string", "Function name"),
+			"metric":   prop("string", "Metric compared"),
+			"current":  prop("number", "Current value"),
+			"baseline": prop("number", "Baseline average"),
+			"delta":    prop("number", "Difference from baseline"),
+			"severity": prop("string", "Severity"),
+		}, "function", "metric", "current", "baseline", "delta", "severity"), "Baseline deviations"),
+		"warnings": arrayPropSchema(prop("string", "Warning"), "Warnings"),
+	}, "key", "profile_kind", "baseline_samples", "deviations")
+}
+
+func pprofTopRowSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"flat":         prop("string", "Flat value"),
+		"flat_pct":     prop("string", "Flat percent"),
+		"sum_pct":      prop("string", "Cumulative sum percent"),
+		"cum":          prop("string", "Cumulative value"),
+		"cum_pct":      prop("string", "Cumulative percent"),
+		"name":         prop("string", "Function name"),
+		"flat_seconds": prop("number", "Flat time in seconds"),
+		"cum_seconds":  prop("number", "Cumulative time in seconds"),
+		"flat_bytes":   prop("number", "Flat size in bytes"),
+		"cum_bytes":    prop("number", "Cumulative size in bytes"),
+		"flat_count":   prop("number", "Flat count, for values without a unit (samples, objects, goroutines)"),
+		"cum_count":    prop("number", "Cumulative count, for values without a unit"),
+	}, "flat", "flat_pct", "sum_pct", "cum", "cum_pct", "name")
+}
+
+func pprofTopSummarySchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"header_lines": arrayPropSchema(prop("string", "Header line"), "Header lines"),
+		"table_header": prop("string", "Table header"),
+	}, "header_lines", "table_header")
+}
+
+func pprofGoroutineAnalysisOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "pprof command"),
+		"result": NewObjectSchema(map[string]any{
+			"total_goroutines": prop("integer", "Total goroutine count"),
+			"by_state": map[string]any{
+				"type":                 "object",
+				"description":          "Goroutine counts by state",
+				"additionalProperties": map[string]any{"type": "integer"},
+			},
+			"top_wait_reasons": arrayPropSchema(NewObjectSchema(map[string]any{
+				"reason":       prop("string", "Wait reason"),
+				"count":        prop("integer", "Goroutine count"),
+				"sample_stack": prop("string", "Sample stack signature"),
+			}, "reason", "count"), "Top wait reasons"),
+			"potential_leaks": arrayPropSchema(NewObjectSchema(map[string]any{
+				"stack_signature": prop("string", "Stack signature"),
+				"count":           prop("integer", "Goroutine count"),
+				"severity":        prop("string", "Severity"),
+				"state":           prop("string", "Goroutine state"),
+				"wait_reason":     prop("string", "Wait reason"),
+			}, "stack_signature", "count", "severity"), "Potential leaks"),
+			"warnings": arrayPropSchema(prop("string", "Warning"), "Warnings"),
+		}, "total_goroutines", "by_state"),
+	}, "command", "result")
+}
+
+func pprofDiscoverOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "pprof command"),
+		"result": NewObjectSchemaWithAdditional(map[string]any{
+			"service":   prop("string", "Service name"),
+			"env":       prop("string", "Environment"),
+			"timestamp": prop("string", "Profile timestamp"),
+			"profiles": arrayPropSchema(NewObjectSchema(map[string]any{
+				"type":   prop("string", "Profile type"),
+				"handle": prop("string", "Profile handle"),
+				"bytes":  prop("integer", "File size in bytes"),
+			}, "type", "handle"), "Downloaded profile handles"),
+			"recommendations": arrayPropSchema(NewObjectSchema(map[string]any{
+				"priority":   prop("string", "Recommendation priority"),
+				"area":       prop("string", "Area of concern"),
+				"suggestion": prop("string", "Suggested action"),
+			}, "priority", "area", "suggestion"), "Prioritized recommendations"),
+			"warnings": arrayPropSchema(prop("string", "Warning"), "Warnings"),
+		}, true, "service", "env"),
+	}, "command", "result")
+}
+
+func pprofGenerateReportOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "pprof command"),
+		"result": NewObjectSchema(map[string]any{
+			"markdown":      prop("string", "Markdown report"),
+			"markdown_meta": truncationMetaSchema(),
+			"raw_meta":      truncationMetaSchema(),
+			"teams": arrayPropSchema(NewObjectSchema(map[string]any{
+				"team":          prop("string", "Team name, CODEOWNERS owner, or Unowned"),
+				"markdown":      prop("string", "The team's section as a standalone report"),
+				"markdown_meta": truncationMetaSchema(),
+				"hotspots":      prop("integer", "Hotspots in the team's code"),
+			}, "team", "markdown", "hotspots"), "Per-team reports, with group_by=team"),
+		}, "markdown"),
+	}, "command", "result")
+}
+
+func functionHistoryOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "CLI command equivalent"),
+		"result": NewObjectSchema(map[string]any{
+			"service":  prop("string", "Service name"),
+			"env":      prop("string", "Environment"),
+			"function": prop("string", "Function pattern"),
+			"from_ts":  prop("string", "Resolved start time"),
+			"to_ts":    prop("string", "Resolved end time"),
+			"entries":  arrayPropSchema(functionHistoryEntrySchema(), "Function history entries"),
+			"summary":  functionHistorySummarySchema(),
+			"warnings": arrayPropSchema(prop("string", "Warning"), "Warnings"),
+		}, "service", "env", "function", "from_ts", "to_ts", "entries", "summary"),
+		"table":      prop("string", "Formatted table"),
+		"table_meta": truncationMetaSchema(),
+		"raw_meta":   truncationMetaSchema(),
+	}, "command", "result", "table")
+}
+
+func functionHistoryEntrySchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"timestamp":    prop("string", "Profile timestamp (RFC3339)"),
+		"profile_id":   prop("string", "Profile ID"),
+		"event_id":     prop("string", "Event ID"),
+		"flat_percent": prop("number", "Flat percent"),
+		"cum_percent":  prop("number", "Cumulative percent"),
+		"flat_value":   prop("string", "Flat value"),
+		"cum_value":    prop("string", "Cumulative value"),
+		"found":        prop("boolean", "Whether the function was found"),
+		"stderr":       prop("string", "pprof stderr while searching this profile (if any)"),
+		"stderr_meta":  truncationMetaSchema(),
+	}, "timestamp", "profile_id", "event_id", "flat_percent", "cum_percent", "flat_value", "cum_value", "found")
+}
+
+func functionHistorySummarySchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"total_profiles":    prop("integer", "Total profiles searched"),
+		"found_in_profiles": prop("integer", "Profiles where function was found"),
+		"max_flat_percent":  prop("number", "Max flat percent"),
+		"min_flat_percent":  prop("number", "Min flat percent"),
+		"avg_flat_percent":  prop("number", "Average flat percent"),
+	}, "total_profiles", "found_in_profiles", "max_flat_percent", "min_flat_percent", "avg_flat_percent")
+}
+
+func compareRangeOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command":        prop("string", "CLI command equivalent"),
+		"result":         compareRangeResultSchema(),
+		"formatted":      prop("string", "Formatted comparison output"),
+		"formatted_meta": truncationMetaSchema(),
+		"raw_meta":       truncationMetaSchema(),
+		"stderr":         prop("string", "pprof diff stderr (if any)"),
+		"stderr_meta":    truncationMetaSchema(),
+	}, "command", "result", "formatted")
+}
+
+func compareRangeResultSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"service":        prop("string", "Service name"),
+		"env":            prop("string", "Environment"),
+		"before_profile": profileSummarySchema(),
+		"after_profile":  profileSummarySchema(),
+		"diff":           prop("string", "Raw diff output"),
+		"top_changes":    arrayPropSchema(functionDiffSchema(), "Top changes"),
+		"warnings":       arrayPropSchema(prop("string", "Warning"), "Warnings"),
+	}, "service", "env", "before_profile", "after_profile", "diff", "top_changes")
+}
+
+func profileSummarySchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"timestamp":  prop("string", "Profile timestamp (RFC3339)"),
+		"profile_id": prop("string", "Profile ID"),
+		"file_path":  prop("string", "Profile file path"),
+	}, "timestamp", "profile_id", "file_path")
+}
+
+func functionDiffSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"function":    prop("string", "Function name"),
+		"before_flat": prop("string", "Before flat value"),
+		"after_flat":  prop("string", "After flat value"),
+		"change":      prop("string", "Change summary"),
+		"severity":    prop("string", "Severity"),
+	}, "function", "before_flat", "after_flat", "change", "severity")
+}
+
+func pprofContentionAnalysisOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "pprof command"),
+		"result": NewObjectSchema(map[string]any{
+			"profile_type":      prop("string", "Profile type (mutex or block)"),
+			"total_contentions": prop("integer", "Total contention count"),
+			"total_delay":       prop("string", "Total delay across contentions"),
+			"by_lock_site": arrayPropSchema(NewObjectSchema(map[string]any{
+				"lock_site":       prop("string", "Lock function"),
+				"source_location": prop("string", "Source location for lock site"),
+				"contentions":     prop("integer", "Contention count"),
+				"total_delay":     prop("string", "Total delay"),
+				"avg_delay":       prop("string", "Average delay"),
+				"top_waiters": arrayPropSchema(NewObjectSchema(map[string]any{
+					"function": prop("string", "Waiting function"),
+					"delay":    prop("string", "Total delay"),
+				}, "function", "delay"), "Top waiting functions"),
+			}, "lock_site", "contentions", "total_delay", "avg_delay", "top_waiters"), "Contention by lock site"),
+			"patterns": arrayPropSchema(NewObjectSchema(map[string]any{
+				"type":        prop("string", "Pattern type"),
+				"severity":    prop("string", "Severity"),
+				"description": prop("string", "Description"),
+			}, "type", "severity", "description"), "Detected patterns"),
+			"recommendations": arrayPropSchema(prop("string", "Recommendation"), "Recommendations"),
+			"warnings":        arrayPropSchema(prop("string", "Warning"), "Warnings"),
+		}, "profile_type", "total_contentions", "total_delay", "by_lock_site", "patterns", "recommendations"),
+	}, "command", "result")
+}
+
+func pprofCrossCorrelateOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "pprof command"),
+		"result": NewObjectSchema(map[string]any{
+			"correlations": arrayPropSchema(NewObjectSchema(map[string]any{
+				"function":       prop("string", "Function name"),
+				"combined_score": prop("number", "Combined score"),
+				"cpu": NewObjectSchema(map[string]any{
+					"flat_pct": prop("number", "CPU flat percent"),
+					"rank":     prop("integer", "Rank in CPU top list"),
+				}, "flat_pct", "rank"),
+				"heap": NewObjectSchema(map[string]any{
+					"alloc_pct": prop("number", "Allocation percent"),
+					"rank":      prop("integer", "Rank in heap top list"),
+				}, "alloc_pct", "rank"),
+				"mutex": NewObjectSchema(map[string]any{
+					"delay_pct": prop("number", "Contention delay percent"),
+					"rank":      prop("integer", "Rank in mutex top list"),
+				}, "delay_pct", "rank"),
+				"insight": prop("string", "Insight summary"),
+			}, "function", "combined_score", "insight"), "Cross-profile correlations"),
+			"cpu_only_hotspots": arrayPropSchema(NewObjectSchema(map[string]any{
+				"function": prop("string", "Function name"),
+				"flat_pct": prop("number", "CPU flat percent"),
+			}, "function", "flat_pct"), "CPU-only hotspots"),
+			"heap_only_hotspots": arrayPropSchema(NewObjectSchema(map[string]any{
+				"function":  prop("string", "Function name"),
+				"alloc_pct": prop("number", "Heap allocation percent"),
+			}, "function", "alloc_pct"), "Heap-only hotspots"),
+			"mutex_only_hotspots": arrayPropSchema(NewObjectSchema(map[string]any{
+				"function":  prop("string", "Function name"),
+				"delay_pct": prop("number", "Mutex delay percent"),
+			}, "function", "delay_pct"), "Mutex-only hotspots"),
+			"warnings": arrayPropSchema(prop("string", "Warning"), "Warnings"),
+		}, "correlations", "cpu_only_hotspots", "heap_only_hotspots", "mutex_only_hotspots"),
+	}, "command", "result")
+}
+
+func pprofHotspotSummaryOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "pprof command"),
+		"result":  hotspotSummarySchema(),
+	}, "command", "result")
+}
+
+func hotspotSummarySchema() map[string]any {
+	owners := arrayPropSchema(prop("string", "Owner"), "CODEOWNERS of the function's file, else of the repo code it was mostly called from (with repo_root)")
+	return NewObjectSchema(map[string]any{
+		"cpu_top5": arrayPropSchema(NewObjectSchema(map[string]any{
+			"function": prop("string", "Function name"),
+			"flat_pct": prop("number", "CPU flat percent"),
+			"owners":   owners,
+		}, "function", "flat_pct"), "Top CPU hotspots"),
+		"heap_top5": arrayPropSchema(NewObjectSchema(map[string]any{
+			"function":  prop("string", "Function name"),
+			"alloc_pct": prop("number", "Heap allocation percent"),
+			"owners":    owners,
+		}, "function", "alloc_pct"), "Top heap hotspots"),
+		"mutex_top5": arrayPropSchema(NewObjectSchema(map[string]any{
+			"function":  prop("string", "Function name"),
+			"delay_pct": prop("number", "Mutex delay percent"),
+			"owners":    owners,
+		}, "function", "delay_pct"), "Top mutex hotspots"),
+		"goroutine_count": prop("integer", "Total goroutines"),
+		"cpu_by_owner": arrayPropSchema(NewObjectSchema(map[string]any{
+			"owner":     prop("string", "Owners of a CODEOWNERS rule, space separated, or (unowned)"),
+			"pct":       prop("number", "Percent of CPU"),
+			"functions": arrayPropSchema(prop("string", "Function"), "The owner's hottest functions by flat CPU"),
+		}, "owner", "pct", "functions"), "CPU split by owner: each sample goes to the owners of its innermost repo frame (with repo_root)"),
+		"codeowners": prop("string", "CODEOWNERS file the owners came from"),
+		"warnings":   arrayPropSchema(prop("string", "Warning"), "Warnings"),
+	}, "cpu_top5", "heap_top5")
+}
+
+func pprofRegressionCheckOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "pprof command"),
+		"result": NewObjectSchema(map[string]any{
+			"passed": prop("boolean", "Overall pass/fail"),
+			"checks": arrayPropSchema(NewObjectSchema(map[string]any{
+				"function":  prop("string", "Function pattern"),
+				"metric":    prop("string", "Metric checked"),
+				"threshold": prop("number", "Threshold value"),
+				"actual":    prop("number", "Actual value"),
+				"passed":    prop("boolean", "Whether check passed"),
+				"message":   prop("string", "Failure message"),
+			}, "function", "metric", "threshold", "actual", "passed"), "Check results"),
+		}, "passed", "checks"),
+	}, "command", "result")
+}
+
+func pprofTraceSourceOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "pprof command"),
+		"result": NewObjectSchema(map[string]any{
+			"call_chain": arrayPropSchema(NewObjectSchema(map[string]any{
+				"function":       prop("string", "Function name"),
+				"file":           prop("string", "Source file path"),
+				"line":           prop("integer", "Line number"),
+				"flat_pct":       prop("number", "Flat percent"),
+				"cum_pct":        prop("number", "Cumulative percent"),
+				"source_snippet": prop("string", "Annotated source snippet"),
+				"source_html":    prop("string", "Snippet as a highlighted HTML fragment (snippet_format=html)"),
+				"is_vendor":      prop("boolean", "Whether frame is vendor code"),
+				"vendor_package": prop("string", "Vendor module path"),
+				"vendor_version": prop("string", "Vendor module version"),
+				"source_error":   prop("string", "Source resolution error"),
+				"permalink":      prop("string", "Link to the frame's line on the code host, for repo and github.com module frames"),
+			}, "function", "file", "line", "flat_pct", "cum_pct", "source_snippet", "is_vendor"), "Call chain frames"),
+			"total_functions_traced": prop("integer", "Total functions traced"),
+			"app_functions":          prop("integer", "Functions in app code"),
+			"vendor_functions":       prop("integer", "Functions in vendor code"),
+			"trim_path_inference":    trimPathInferenceSchema(),
+			"module_sources":         moduleSourcesSchema(),
+			"permalinks":             permalinkBaseSchema(),
+			"warnings":               arrayPropSchema(prop("string", "Warning"), "Warnings"),
+		}, "call_chain", "total_functions_traced", "app_functions", "vendor_functions"),
+	}, "command", "result")
+}
+
+func pprofCoverageHotspotsOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "pprof command"),
+		"result": NewObjectSchema(map[string]any{
+			"coverage":          prop("string", "Coverprofile read"),
+			"command":           prop("string", "go test run that wrote the coverprofile"),
+			"mode":              prop("string", "Coverprofile mode (set, count, or atomic)"),
+			"untested_flat_pct": prop("number", "Flat percent spent in untested hot functions"),
+			"low_flat_pct":      prop("number", "Flat percent spent in low coverage hot functions"),
+			"hotspots": arrayPropSchema(NewObjectSchema(map[string]any{
+				"function":     prop("string", "Function name"),
+				"file":         prop("string", "File relative to repo_root"),
+				"start_line":   prop("integer", "First line of the function"),
+				"end_line":     prop("integer", "Last line of the function"),
+				"flat_pct":     prop("number", "Flat percent"),
+				"cum_pct":      prop("number", "Cumulative percent"),
+				"statements":   prop("integer", "Statements in the function's coverage blocks"),
+				"covered":      prop("integer", "Statements tests ran"),
+				"coverage_pct": prop("number", "Statement coverage percent"),
+				"status":       enumProp("string", "Coverage status", []string{"untested", "low", "covered"}),
+				"no_data":      prop("boolean", "Whether the coverprofile has no blocks in the function (package untested or not run)"),
+				"risk":         prop("number", "cum_pct times the uncovered fraction"),
+			}, "function", "file", "start_line", "end_line", "flat_pct", "cum_pct", "statements", "covered", "coverage_pct", "status", "risk"), "Hot repo functions, most risky first"),
+			"trim_path_inference": trimPathInferenceSchema(),
+			"warnings":            arrayPropSchema(prop("string", "Warning"), "Warnings"),
+		}, "coverage", "mode", "untested_flat_pct", "low_flat_pct", "hotspots"),
+	}, "command", "result")
+}
+
+func pprofVendorAnalyzeOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "pprof command"),
+		"result": NewObjectSchema(map[string]any{
+			"vendor_hotspots": arrayPropSchema(NewObjectSchema(map[string]any{
+				"package":        prop("string", "Package name"),
+				"version":        prop("string", "Current version"),
+				"total_flat_pct": prop("number", "Total flat percent"),
+				"total_cum_pct":  prop("number", "Total cumulative percent"),
+				"hot_functions": arrayPropSchema(NewObjectSchema(map[string]any{
+					"name":     prop("string", "Function name"),
+					"flat_pct": prop("number", "Flat percent"),
+				}, "name", "flat_pct"), "Hot functions"),
+				"repo_url":       prop("string", "Repository URL"),
+				"latest_version": prop("string", "Latest version"),
+				"known_issues": arrayPropSchema(NewObjectSchema(map[string]any{
+					"pattern":        prop("string", "Pattern"),
+					"category":       prop("string", "Category, for pattern library entries"),
+					"severity":       prop("string", "Severity"),
+					"issue":          prop("string", "Issue description"),
+					"recommendation": prop("string", "Recommendation"),
+				}, "pattern", "severity", "issue", "recommendation"), "Known issues"),
+				"update": NewObjectSchema(map[string]any{
+					"status":         enumProp("string", "How go.mod's version compares to the latest release", []string{"current", "behind", "ahead", "unknown"}),
+					"version_time":   prop("string", "Release time of go.mod's version"),
+					"latest_version": prop("string", "Latest release in the module proxy"),
+					"latest_time":    prop("string", "Release time of the latest version"),
+					"newer_versions": prop("integer", "Releases after go.mod's version, up to latest"),
+					"days_behind":    prop("integer", "Days between go.mod's version and latest"),
+					"advisories": arrayPropSchema(NewObjectSchema(map[string]any{
+						"id":              prop("string", "Advisory ID"),
+						"title":           prop("string", "Advisory title"),
+						"url":             prop("string", "Advisory URL"),
+						"aliases":         arrayPropSchema(prop("string", "Alias"), "Aliases such as CVE IDs"),
+						"cvss3_score":     prop("number", "CVSS v3 score"),
+						"fixed_in_latest": prop("boolean", "Whether the latest release is no longer affected"),
+					}, "id", "fixed_in_latest"), "deps.dev advisories affecting go.mod's version"),
+				}, "status", "newer_versions"),
+			}, "package", "total_flat_pct", "total_cum_pct", "hot_functions"), "Vendor hotspots"),
+			"total_vendor_pct": prop("number", "Total vendor percentage"),
+			"total_app_pct":    prop("number", "Total app percentage"),
+			"repo_prefixes":    arrayPropSchema(prop("string", "Prefix"), "Prefixes identifying app code (repo_prefix, else go.mod/go.work modules)"),
+			"warnings":         arrayPropSchema(prop("string", "Warning"), "Warnings"),
+		}, "vendor_hotspots", "total_vendor_pct", "total_app_pct"),
+	}, "command", "result")
+}
+
+func pprofExplainOverheadOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "pprof command"),
+		"result": NewObjectSchema(map[string]any{
+			"category": prop("string", "Overhead category"),
+			"explanation": NewObjectSchema(map[string]any{
+				"summary":       prop("string", "Summary"),
+				"detailed":      prop("string", "Detailed explanation"),
+				"why_slow":      arrayPropSchema(prop("string", "Why slow"), "Why slow"),
+				"common_causes": arrayPropSchema(prop("string", "Common cause"), "Common causes"),
+			}, "summary", "detailed", "why_slow", "common_causes"),
+			"in_your_profile": NewObjectSchema(map[string]any{
+				"total_pct": prop("number", "Total percent in profile"),
+				"top_contributors": arrayPropSchema(NewObjectSchema(map[string]any{
+					"function": prop("string", "Function name"),
+					"pct":      prop("number", "Percent"),
+				}, "function", "pct"), "Top contributors"),
+			}, "total_pct", "top_contributors"),
+			"optimization_strategies": arrayPropSchema(NewObjectSchema(map[string]any{
+				"strategy":        prop("string", "Strategy"),
+				"expected_impact": prop("string", "Expected impact"),
+				"effort":          prop("string", "Effort"),
+				"description":     prop("string", "Description"),
+				"applicable":      prop("boolean", "Applicable"),
+				"reason":          prop("string", "Applicability reason"),
+			}, "strategy", "expected_impact", "effort", "description", "applicable"), "Optimization strategies"),
+			"warnings": arrayPropSchema(prop("string", "Warning"), "Warnings"),
+		}, "category", "explanation", "optimization_strategies"),
+	}, "command", "result")
+}
+
+func pprofSuggestFixOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "pprof command"),
+		"result": NewObjectSchema(map[string]any{
+			"issue": prop("string", "Issue identifier"),
+			"analysis": NewObjectSchema(map[string]any{
+				"overhead_pct": prop("number", "Overhead percent"),
+				"top_functions": arrayPropSchema(NewObjectSchema(map[string]any{
+					"function": prop("string", "Function name"),
+					"pct":      prop("number", "Percent"),
+				}, "function", "pct"), "Top functions"),
+			}, "overhead_pct", "top_functions"),
+			"applicable_fixes": arrayPropSchema(NewObjectSchema(map[string]any{
+				"fix_id":          prop("string", "Fix identifier"),
+				"description":     prop("string", "Description"),
+				"expected_impact": NewObjectSchemaWithAdditional(map[string]any{}, true),
+				"files_to_modify": arrayPropSchema(NewObjectSchema(map[string]any{
+					"path":          prop("string", "File path"),
+					"is_vendor":     prop("boolean", "Is vendor file"),
+					"upstream_repo": prop("string", "Upstream repo"),
+					"changes": arrayPropSchema(NewObjectSchema(map[string]any{
+						"line":   prop("integer", "Line number"),
+						"before": prop("string", "Before"),
+						"after":  prop("string", "After"),
+					}, "line", "before", "after"), "Line changes"),
+				}, "path", "is_vendor", "changes"), "Files to modify"),
+				"diff":               prop("string", "Unified diff"),
+				"pr_description":     prop("string", "PR description"),
+				"considerations":     arrayPropSchema(prop("string", "Consideration"), "Considerations"),
+				"is_vendored":        prop("boolean", "Is vendored"),
+				"upstream_pr_needed": prop("boolean", "Upstream PR needed"),
+				"pull_request": NewObjectSchema(map[string]any{
+					"url":    prop("string", "Pull request URL"),
+					"number": prop("integer", "Pull request number"),
+					"branch": prop("string", "Branch the fix was pushed to"),
+					"base":   prop("string", "Branch the pull request targets"),
+					"commit": prop("string", "Commit with the fix"),
+					"draft":  prop("boolean", "Whether the pull request is a draft"),
+				}, "url", "number", "branch", "base", "commit"),
+				"applied": NewObjectSchema(map[string]any{
+					"files":    arrayPropSchema(prop("string", "File"), "Files written"),
+					"backups":  arrayPropSchema(prop("string", "File"), "Original files, saved with .orig added"),
+					"packages": arrayPropSchema(prop("string", "Package"), "Packages built and tested"),
+					"build":    fixCheckSchema("go build of the touched packages"),
+					"test":     fixCheckSchema("go test of the touched packages (absent when the build failed)"),
+				}, "files", "backups", "packages", "build"),
+			}, "fix_id", "description", "expected_impact", "files_to_modify", "diff", "pr_description", "considerations", "is_vendored", "upstream_pr_needed"), "Applicable fixes"),
+			"next_steps": arrayPropSchema(prop("string", "Next step"), "Next steps"),
+			"warnings":   arrayPropSchema(prop("string", "Warning"), "Warnings"),
+		}, "issue", "analysis", "applicable_fixes", "next_steps"),
+	}, "command", "result")
+}
+
+func fixCheckSchema(desc string) map[string]any {
+	schema := NewObjectSchema(map[string]any{
+		"command": prop("string", "go command run"),
+		"passed":  prop("boolean", "Whether it succeeded"),
+		"output":  prop("string", "Tail of the output when it failed"),
+	}, "command", "passed")
+	schema["description"] = desc
+	return schema
+}
+
+func datadogProfilesAggregateOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "CLI command equivalent"),
+		"result": NewObjectSchema(map[string]any{
+			"handle":          prop("string", "Handle for merged profile"),
+			"profile_type":    prop("string", "Profile type"),
+			"profiles_merged": prop("integer", "Number of profiles merged"),
+			"time_range": NewObjectSchema(map[string]any{
+				"from": prop("string", "Start time"),
+				"to":   prop("string", "End time"),
+			}, "from", "to"),
+			"total_duration": prop("string", "Total duration of merged profile"),
+			"hint":           prop("string", "Usage hint"),
+			"warnings":       arrayPropSchema(prop("string", "Warning"), "Warnings"),
+		}, "handle", "profiles_merged", "time_range"),
+	}, "command", "result")
+}
+
+func pprofTemporalAnalysisOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "Command executed"),
+		"result": NewObjectSchema(map[string]any{
+			"inferred_settings": NewObjectSchema(map[string]any{
+				"max_concurrent_activity_task_pollers": prop("integer", "Inferred activity poller count"),
+				"max_concurrent_workflow_task_pollers": prop("integer", "Inferred workflow poller count"),
+				"active_activities":                    prop("integer", "Currently executing activities"),
+				"cached_workflows":                     prop("integer", "Cached workflow states"),
+				"active_local_activities":              prop("integer", "Currently executing local activities"),
+				"active_sessions":                      prop("integer", "Active sessions"),
+				"notes":                                arrayPropSchema(prop("string", "Note"), "Inference notes"),
+			}, "max_concurrent_activity_task_pollers", "max_concurrent_workflow_task_pollers"),
+			"counts": NewObjectSchema(map[string]any{
+				"activity_pollers_do_poll":   prop("integer", "Activity pollers in doPoll"),
+				"activity_pollers_in_grpc":   prop("integer", "Activity pollers in gRPC call"),
+				"workflow_pollers_do_poll":   prop("integer", "Workflow pollers in doPoll"),
+				"workflow_pollers_in_grpc":   prop("integer", "Workflow pollers in gRPC call"),
+				"local_activity_pollers":     prop("integer", "Local activity pollers"),
+				"activities_executing":       prop("integer", "Activities executing"),
+				"workflows_cached":           prop("integer", "Workflows cached"),
+				"local_activities_executing": prop("integer", "Local activities executing"),
+				"sessions_active":            prop("integer", "Sessions active"),
+				"heartbeat_goroutines":       prop("integer", "Heartbeat goroutines"),
+				"grpc_streams":               prop("integer", "gRPC streams"),
+				"task_dispatchers":           prop("integer", "Task dispatchers"),
+				"eager_dispatchers":          prop("integer", "Eager dispatchers"),
+			}),
+			"workflow_breakdown": arrayPropSchema(NewObjectSchema(map[string]any{
+				"name":         prop("string", "Workflow name"),
+				"count":        prop("integer", "Count"),
+				"state":        prop("string", "State (selector, awaiting_future, executing)"),
+				"sample_stack": prop("string", "Sample stack"),
+			}, "name", "count", "state"), "Workflow type breakdown"),
+			"activity_breakdown": arrayPropSchema(NewObjectSchema(map[string]any{
+				"name":         prop("string", "Activity name"),
+				"count":        prop("integer", "Count"),
+				"sample_stack": prop("string", "Sample stack"),
+			}, "name", "count"), "Activity type breakdown"),
+			"task_queues":      arrayPropSchema(prop("string", "Task queue"), "Detected task queues"),
+			"total_goroutines": prop("integer", "Total goroutines"),
+			"warnings":         arrayPropSchema(prop("string", "Warning"), "Warnings"),
+		}, "inferred_settings", "counts", "total_goroutines"),
+	}, "command", "result")
+}
+
+func pprofGoroutineCategorizeOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "Command executed"),
+		"result": NewObjectSchema(map[string]any{
+			"total_goroutines": prop("integer", "Total goroutines"),
+			"categories": arrayPropSchema(NewObjectSchema(map[string]any{
+				"name":         prop("string", "Category name"),
+				"pattern":      prop("string", "Regex pattern"),
+				"count":        prop("integer", "Goroutine count"),
+				"percent":      prop("number", "Percentage of total"),
+				"sample_stack": prop("string", "Sample stack"),
+			}, "name", "count", "percent"), "Categories with counts"),
+			"uncategorized": prop("integer", "Uncategorized goroutines"),
+			"top_uncategorized": arrayPropSchema(NewObjectSchema(map[string]any{
+				"signature": prop("string", "Stack signature"),
+				"count":     prop("integer", "Count"),
+			}, "signature", "count"), "Top uncategorized stacks"),
+			"presets_used": arrayPropSchema(prop("string", "Preset name"), "Presets used"),
+			"warnings":     arrayPropSchema(prop("string", "Warning"), "Warnings"),
+		}, "total_goroutines", "categories", "uncategorized"),
+	}, "command", "result")
+}
+
+func datadogMetricsAtTimestampOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "Command executed"),
+		"result": NewObjectSchema(map[string]any{
+			"service":     prop("string", "Service name"),
+			"env":         prop("string", "Environment"),
+			"dd_site":     prop("string", "Datadog site"),
+			"center_time": prop("string", "Center timestamp"),
+			"from_time":   prop("string", "Window start time"),
+			"to_time":     prop("string", "Window end time"),
+			"pod_name":    prop("string", "Pod name filter"),
+			"metrics": arrayPropSchema(NewObjectSchema(map[string]any{
+				"name": prop("string", "Metric name"),
+				"tags": map[string]any{
+					"type":                 "object",
+					"description":          "Metric tags",
+					"additionalProperties": prop("string", "Tag value"),
+				},
+				"points": arrayPropSchema(NewObjectSchema(map[string]any{
+					"timestamp": prop("string", "Point timestamp"),
+					"value":     prop("number", "Value"),
+				}, "timestamp", "value"), "Data points"),
+				"unit":       prop("string", "Unit"),
+				"avg_value":  prop("number", "Average value"),
+				"max_value":  prop("number", "Maximum value"),
+				"min_value":  prop("number", "Minimum value"),
+				"last_value": prop("number", "Last value"),
+			}, "name", "points"), "Metric series"),
+			"summary": NewObjectSchema(map[string]any{
+				"go_goroutines":         prop("number", "Go goroutine count"),
+				"go_heap_inuse_bytes":   prop("number", "Go heap in-use bytes"),
+				"go_alloc_bytes":        prop("number", "Go alloc bytes"),
+				"go_gc_pause_ns":        prop("number", "Go GC pause time (ns)"),
+				"container_rss_mb":      prop("number", "Container RSS (MB)"),
+				"container_cpu_percent": prop("number", "Container CPU (%)"),
+			}),
+			"warnings": arrayPropSchema(prop("string", "Warning"), "Warnings"),
+		}, "service", "center_time", "from_time", "to_time", "metrics", "summary"),
+	}, "command", "result")
+}
+
+func datadogServicesSearchOutputSchema() map[string]any {
+	matchSchema := NewObjectSchema(map[string]any{
+		"service":      prop("string", "Service name"),
+		"environments": arrayPropSchema(prop("string", "Environment"), "Available environments"),
+		"score":        prop("number", "Match score (0-1, higher is better)"),
+		"match_type":   prop("string", "Match type (exact, normalized, prefix, contains, similar)"),
+	}, "service", "score", "match_type")
+
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "Command description"),
+		"result": NewObjectSchema(map[string]any{
+			"query":     prop("string", "Original search query"),
+			"env":       prop("string", "Environment filter used"),
+			"matches":   arrayPropSchema(matchSchema, "Matching services ranked by score"),
+			"cached":    prop("boolean", "Whether results came from cache"),
+			"total":     prop("integer", "Total number of services available"),
+			"cached_at": prop("string", "When the cache was populated (if cached)"),
+		}, "query", "matches"),
+	}, "command", "result")
+}
+
+func pprofTextOutputSchema() map[string]any {
+	return NewObjectSchema(pprofTextOutputProps(), "command", "raw", "raw_meta", "total_lines", "truncated")
+}
+
+func pprofTextOutputProps() map[string]any {
+	return map[string]any{
+		"command":           prop("string", "pprof command"),
+		"raw":               prop("string", "Raw pprof output"),
+		"raw_meta":          truncationMetaSchema(),
+		"total_lines":       prop("integer", "Total number of lines before truncation"),
+		"truncated":         prop("boolean", "Whether the output was truncated"),
+		"stderr":            prop("string", "Command stderr (if any)"),
+		"stderr_meta":       truncationMetaSchema(),
+		"binary_resolution": binaryResolutionSchema("Binary resolved for an unsymbolized profile (peek and list without binary)"),
+	}
+}
+
+func binaryResolutionSchema(description string) map[string]any {
+	schema := NewObjectSchema(map[string]any{
+		"target": NewObjectSchema(map[string]any{
+			"build_id":   prop("string", "Main mapping build ID"),
+			"file":       prop("string", "Main mapping path"),
+			"binary":     prop("string", "Binary name"),
+			"revision":   prop("string", "VCS revision"),
+			"service":    prop("string", "Service name"),
+			"symbolized": prop("boolean", "Whether the profile already has symbols"),
+		}, "symbolized"),
+		"binary":   prop("string", "Resolved binary path"),
+		"strategy": enumProp("string", "Strategy that found it", []string{"cache", "repo", "artifact", "image", "build"}),
+		"verified": prop("boolean", "Whether a build ID or revision matched"),
+		"ids": NewObjectSchema(map[string]any{
+			"go_build_id":  prop("string", "Go build ID"),
+			"gnu_build_id": prop("string", "GNU build ID"),
+			"revision":     prop("string", "vcs.revision"),
+			"modified":     prop("boolean", "Built from a modified tree"),
+		}),
+		"attempts": arrayPropSchema(NewObjectSchema(map[string]any{
+			"strategy": prop("string", "Strategy"),
+			"status":   enumProp("string", "Outcome", []string{"found", "mismatch", "missing", "skipped", "failed"}),
+			"source":   prop("string", "Path, URL, image, or package tried"),
+			"detail":   prop("string", "Why"),
+		}, "strategy", "status"), "What each strategy found"),
+		"warnings": arrayPropSchema(prop("string", "Warning"), "Warnings"),
+	}, "target", "verified", "attempts")
+	schema["description"] = description
+	return schema
+}
+
+func pprofResolveBinaryOutputSchema() map[string]any {
+	return withDryRunOutput(NewObjectSchema(map[string]any{
+		"command": prop("string", "CLI command equivalent"),
+		"result":  binaryResolutionSchema("Binary resolution"),
+	}, "command", "result"))
+}
+
+func pprofBuildInfoOutputSchema() map[string]any {
+	module := NewObjectSchema(map[string]any{
+		"path":    prop("string", "Module path"),
+		"version": prop("string", "Module version"),
+		"sum":     prop("string", "go.sum hash"),
+		"replace": NewObjectSchema(map[string]any{
+			"path":    prop("string", "Replacement path"),
+			"version": prop("string", "Replacement version"),
+			"sum":     prop("string", "go.sum hash"),
+		}, "path"),
+	}, "path")
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "CLI command equivalent"),
+		"result": NewObjectSchema(map[string]any{
+			"source": NewObjectSchema(map[string]any{
+				"binary":     prop("string", "Binary the build info was read from"),
+				"from":       prop("string", "binary (given), mapping (the profile's main mapping path), or the resolve_binary strategy that found it"),
+				"resolution": binaryResolutionSchema("Binary resolution, when the binary was resolved from the profile"),
+			}, "binary", "from"),
+			"build_info": NewObjectSchema(map[string]any{
+				"binary":        prop("string", "Binary path"),
+				"go_version":    prop("string", "Go toolchain version"),
+				"path":          prop("string", "Main package import path"),
+				"main":          module,
+				"revision":      prop("string", "vcs.revision"),
+				"revision_time": prop("string", "vcs.time"),
+				"modified":      prop("boolean", "Built from a modified tree"),
+				"vcs":           prop("string", "Version control system"),
+				"settings":      NewObjectSchemaWithAdditional(map[string]any{}, true),
+				"deps":          arrayPropSchema(module, "Dependency modules"),
+				"ids": NewObjectSchema(map[string]any{
+					"go_build_id":  prop("string", "Go build ID"),
+					"gnu_build_id": prop("string", "GNU build ID"),
+					"revision":     prop("string", "vcs.revision"),
+					"modified":     prop("boolean", "Built from a modified tree"),
+				}),
+			}, "binary", "go_version", "path", "main", "settings", "deps"),
+			"head": NewObjectSchema(map[string]any{
+				"repo_root":      prop("string", "Repository root"),
+				"head":           prop("string", "HEAD commit"),
+				"revision":       prop("string", "Profiled revision"),
+				"match":          prop("boolean", "HEAD is the profiled revision and the tree is clean"),
+				"dirty":          prop("boolean", "Uncommitted changes in the checkout"),
+				"known":          prop("boolean", "Whether the revision is in the local clone"),
+				"ahead":          prop("integer", "Commits on HEAD not in the revision"),
+				"behind":         prop("integer", "Commits in the revision not on HEAD"),
+				"changed_files":  arrayPropSchema(prop("string", "File"), "Go files that differ between the revision and the checkout (first 50)"),
+				"profiled_files": arrayPropSchema(prop("string", "File"), "Changed files the profile has functions in: their source lines no longer match"),
+				"warning":        prop("string", "Why source may be matched against the wrong commit"),
+			}, "repo_root", "revision", "match", "known"),
+			"warnings": arrayPropSchema(prop("string", "Warning"), "Warnings"),
+		}, "source", "build_info"),
+	}, "command", "result")
+}
+
+func permalinkBaseSchema() map[string]any {
+	schema := NewObjectSchema(map[string]any{
+		"repository": prop("string", "Web URL of repo_root's origin remote"),
+		"revision":   prop("string", "Commit the permalinks point at"),
+		"from_head":  prop("boolean", "No revision was given: links point at the checkout's HEAD, which may not be the profiled commit"),
+	}, "repository", "revision")
+	schema["description"] = "Where frame permalinks point"
+	return schema
+}
+
+func moduleSourcesSchema() map[string]any {
+	return arrayPropSchema(NewObjectSchema(map[string]any{
+		"module":  prop("string", "Module path"),
+		"version": prop("string", "Module version the profile was built with"),
+		"dir":     prop("string", "Module source directory"),
+		"status":  enumProp("string", "Where the source came from", []string{"cached", "downloaded", "missing", "failed"}),
+		"error":   prop("string", "go mod download error"),
+	}, "module", "version", "status"), "Modules of third-party frames, resolved in the module cache (GOMODCACHE)")
+}
+
+func trimPathInferenceSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"trim_path": prop("string", "Inferred trim_path, prefixes separated by ':' (empty when nothing matched)"),
+		"prefixes": arrayPropSchema(NewObjectSchema(map[string]any{
+			"prefix":  prop("string", "Build-time prefix"),
+			"files":   prop("integer", "Profile files under the prefix found in repo_root"),
+			"example": prop("string", "A profile path under the prefix"),
+			"local":   prop("string", "Where the example resolves under repo_root"),
+		}, "prefix", "files", "example", "local"), "Inferred prefixes, most files first"),
+		"matched_files":   prop("integer", "Profile source files found under repo_root"),
+		"unmatched_files": prop("integer", "Profile app source files not found under repo_root"),
+	}, "trim_path", "prefixes", "matched_files", "unmatched_files")
+}
+
+func pprofListOutputSchema() map[string]any {
+	props := pprofTextOutputProps()
+	props["trim_path_inference"] = trimPathInferenceSchema()
+	props["html"] = prop("string", "Listing as a highlighted HTML fragment, lines shaded by flat% (snippet_format=html)")
+	props["module_sources"] = moduleSourcesSchema()
+	props["warnings"] = arrayPropSchema(prop("string", "Warning"), "Warnings")
+	return NewObjectSchema(props, "command", "raw", "raw_meta", "total_lines", "truncated")
+}
+
+func pprofTagsOutputSchema() map[string]any {
+	props := pprofTextOutputProps()
+	props["tags"] = arrayPropSchema(prop("string", "Tag key"), "Available tag keys when no filter applied")
+	return NewObjectSchema(props, "command", "raw", "raw_meta", "total_lines", "truncated")
+}
+
+func pprofDiffTopOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"commands": map[string]any{
+			"type":                 "object",
+			"description":          "pprof commands keyed by side (before, after)",
+			"additionalProperties": map[string]any{"type": "string"},
+		},
+		"before":      arrayPropSchema(pprofTopRowSchema(), "Top rows for the before profile"),
+		"after":       arrayPropSchema(pprofTopRowSchema(), "Top rows for the after profile"),
+		"deltas":      arrayPropSchema(diffTopDeltaSchema(), "Per-function deltas sorted by delta_seconds"),
+		"raw":         prop("string", "Tab-separated delta table"),
+		"raw_meta":    truncationMetaSchema(),
+		"total_lines": prop("integer", "Total number of lines before truncation"),
+		"truncated":   prop("boolean", "Whether the output was truncated"),
+	}, "commands", "before", "after", "deltas")
+}
+
+func diffTopDeltaSchema() map[string]any {
+	return NewObjectSchemaWithAdditional(map[string]any{
+		"name":          prop("string", "Function name"),
+		"before_flat":   prop("string", "Flat value before"),
+		"after_flat":    prop("string", "Flat value after"),
+		"before_cum":    prop("string", "Cumulative value before"),
+		"after_cum":     prop("string", "Cumulative value after"),
+		"delta_seconds": prop("number", "Change in seconds (after - before); 0 for profiles without time values"),
+		"delta_bytes":   prop("number", "Change in bytes (after - before), for space profiles"),
+		"delta_count":   prop("number", "Change in count (after - before), for profiles of unitless values"),
+	}, true, "name", "delta_seconds")
+}
+
+func pprofMetaOutputSchema() map[string]any {
+	sampleTypeSchema := NewObjectSchema(map[string]any{
+		"type": prop("string", "Sample type"),
+		"unit": prop("string", "Sample unit"),
+	}, "type", "unit")
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "CLI command equivalent"),
+		"result": NewObjectSchema(map[string]any{
+			"profile_path":          prop("string", "Profile path"),
+			"detected_profile_kind": prop("string", "Detected profile kind (cpu, heap, mutex, block, goroutine, unknown)"),
+			"sample_types":          arrayPropSchema(sampleTypeSchema, "Sample types"),
+			"default_sample_index":  prop("integer", "Default sample index"),
+			"totals": arrayPropSchema(NewObjectSchema(map[string]any{
+				"type":  prop("string", "Sample type"),
+				"unit":  prop("string", "Sample unit"),
+				"total": prop("integer", "Sum across all samples"),
+			}, "type", "unit", "total"), "Totals per sample type"),
+			"period_type":    sampleTypeSchema,
+			"period":         prop("integer", "Sampling period"),
+			"time_nanos":     prop("integer", "Profile start time (ns since epoch)"),
+			"duration_nanos": prop("integer", "Profile duration in nanoseconds"),
+			"label_keys":     arrayPropSchema(prop("string", "Label key"), "Sample label keys"),
+			"go_version":     map[string]any{"type": []string{"string", "null"}, "description": "Go version from profile comments"},
+			"build_id":       map[string]any{"type": []string{"string", "null"}, "description": "Build ID from the first mapping"},
+		}, "profile_path", "detected_profile_kind", "sample_types", "default_sample_index", "totals"),
+	}, "command", "result")
+}
+
+func pprofValidateOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "CLI command equivalent"),
+		"result": NewObjectSchema(map[string]any{
+			"profile_path":          prop("string", "Profile path"),
+			"valid":                 prop("boolean", "Whether the profile parsed and has no error-severity problems"),
+			"bytes":                 prop("integer", "File size in bytes"),
+			"gzipped":               prop("boolean", "Whether the file is gzip-compressed"),
+			"detected_profile_kind": prop("string", "Detected profile kind (cpu, heap, mutex, block, goroutine, unknown)"),
+			"sample_count":          prop("integer", "Number of samples"),
+			"totals": arrayPropSchema(NewObjectSchema(map[string]any{
+				"type":  prop("string", "Sample type"),
+				"unit":  prop("string", "Sample unit"),
+				"total": prop("integer", "Sum across all samples"),
+			}, "type", "unit", "total"), "Totals per sample type"),
+			"duration_seconds": prop("number", "Profile duration in seconds (0 when not recorded)"),
+			"mappings":         prop("integer", "Number of mappings"),
+			"mapping_coverage": prop("number", "Fraction of sampled locations that belong to a mapping"),
+			"symbolized_ratio": prop("number", "Fraction of sampled locations that resolve to a named function"),
+			"problems": arrayPropSchema(NewObjectSchema(map[string]any{
+				"severity": enumProp("string", "error (profile unusable) or warning (answers will be weak)", []string{"error", "warning"}),
+				"code":     prop("string", "Problem code (empty_file, truncated, unparsable, no_sample_types, zero_samples, zero_values, unsymbolized, no_mappings, short_duration, downsampled)"),
+				"message":  prop("string", "What is wrong"),
+			}, "severity", "code", "message"), "Problems found"),
+		}, "profile_path", "valid", "bytes", "gzipped", "sample_count", "totals", "duration_seconds", "mappings", "mapping_coverage", "symbolized_ratio", "problems"),
+	}, "command", "result")
+}
+
+func pprofSymbolizationOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "CLI command equivalent"),
+		"result": NewObjectSchema(map[string]any{
+			"profile_path":   prop("string", "Profile path"),
+			"sample_type":    prop("string", "Sample type frames are weighted by"),
+			"total_value":    prop("integer", "Total sample value"),
+			"named_fraction": prop("number", "Share of sample value whose whole stack resolves to named functions"),
+			"mappings": arrayPropSchema(NewObjectSchema(map[string]any{
+				"file":              prop("string", "Mapping file, or (no mapping)"),
+				"build_id":          prop("string", "Build ID"),
+				"main":              prop("boolean", "Whether this is the profiled binary's mapping"),
+				"pseudo":            prop("boolean", "Whether the mapping has no file a binary could symbolize ([vdso], [kernel.kallsyms], ...)"),
+				"has_functions":     prop("boolean", "Whether the profile marks the mapping as symbolized"),
+				"locations":         prop("integer", "Sampled locations in the mapping"),
+				"raw_locations":     prop("integer", "Sampled locations without a function name"),
+				"sample_value":      prop("integer", "Value of samples with a frame in the mapping"),
+				"raw_value":         prop("integer", "Value of samples with a raw-address frame in the mapping"),
+				"named_fraction":    prop("number", "Share of sample_value with no raw-address frame in the mapping"),
+				"top_raw_addresses": arrayPropSchema(prop("string", "Address"), "Raw addresses carrying the most sample value"),
+			}, "file", "has_functions", "locations", "raw_locations", "sample_value", "raw_value", "named_fraction"), "Mappings, most raw sample value first"),
+			"needs_symbols":  arrayPropSchema(prop("string", "Mapping file"), "Mappings with raw-address frames, most raw sample value first"),
+			"recommendation": prop("string", "Which binary, if any, to provide"),
+		}, "profile_path", "sample_type", "total_value", "named_fraction", "mappings", "needs_symbols", "recommendation"),
+	}, "command", "result")
+}
+
+func pprofStorylinesOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "pprof command"),
+		"result": NewObjectSchemaWithAdditional(map[string]any{
+			"command":             prop("string", "pprof command"),
+			"markdown":            prop("string", "Markdown rendering (format=markdown)"),
+			"repo_prefixes":       arrayPropSchema(prop("string", "Prefix"), "Prefixes identifying app code (repo_prefix, else go.mod/go.work modules at repo_root)"),
+			"trim_path_inference": trimPathInferenceSchema(),
+			"codeowners":          prop("string", "CODEOWNERS file under repo_root that storylines[].owners came from"),
+			"permalinks":          permalinkBaseSchema(),
+			"warnings":            arrayPropSchema(prop("string", "Warning"), "Warnings"),
+		}, true, "command"),
+	}, "command", "result")
+}
+
+func pprofMemorySanityOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "pprof command"),
+		"result": NewObjectSchemaWithAdditional(map[string]any{
+			"summary":         prop("string", "Summary"),
+			"heap_inuse_mb":   prop("number", "Heap in-use (MB)"),
+			"heap_alloc_mb":   prop("number", "Heap allocated (MB)"),
+			"goroutine_count": prop("integer", "Goroutine count"),
+			"warnings":        arrayPropSchema(prop("string", "Warning"), "Warnings"),
+			"suspicions": arrayPropSchema(NewObjectSchema(map[string]any{
+				"category":    prop("string", "Suspicion category"),
+				"description": prop("string", "Description"),
+				"severity":    prop("string", "Severity (low, medium, high)"),
+				"confidence":  prop("string", "Confidence (confirmed, likely, suspected, possible)"),
+				"evidence":    prop("string", "Evidence"),
+			}, "category", "description", "severity", "confidence"), "Suspected RSS contributors"),
+			"recommendations": arrayPropSchema(prop("string", "Recommendation"), "Recommendations"),
+		}, true, "summary", "warnings", "suspicions", "recommendations"),
+		"stderr":      prop("string", "Command stderr (if any)"),
+		"stderr_meta": truncationMetaSchema(),
+	}, "command", "result")
+}
+
+func repoServicesDiscoverOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "CLI command equivalent"),
+		"services": arrayPropSchema(NewObjectSchema(map[string]any{
+			"binary":  prop("string", "Binary name"),
+			"service": prop("string", "Service name"),
+			"path":    prop("string", "Path to the service main package; empty when none was found"),
+			"package": prop("string", "Import path of the main package"),
+			"sources": arrayPropSchema(enumProp("string", "Source", []string{"cmd", "main", "bazel", "makefile", "procfile", "dockerfile"}), "How the service was found"),
+			"builds": arrayPropSchema(NewObjectSchema(map[string]any{
+				"source":  prop("string", "go, bazel, makefile, or dockerfile"),
+				"command": prop("string", "Build command, run from the repo root"),
+				"output":  prop("string", "Built binary path (inside the image for dockerfile)"),
+			}, "source", "command"), "Ways to build the service"),
+			"binaries": arrayPropSchema(prop("string", "Path relative to the repo root"), "Likely binary locations, existing files first"),
+			"datadog": NewObjectSchema(map[string]any{
+				"service":    prop("string", "Datadog service name"),
+				"envs":       arrayPropSchema(prop("string", "Environment"), "Environments the service reports from"),
+				"source":     enumProp("string", "Where the mapping came from", []string{"config", "fuzzy"}),
+				"match_type": prop("string", "Fuzzy match kind"),
+				"score":      prop("number", "Fuzzy match score (0-1)"),
+			}, "service", "source"),
+			"datadog_candidates": arrayPropSchema(NewObjectSchema(map[string]any{
+				"service":      prop("string", "Datadog service name"),
+				"environments": arrayPropSchema(prop("string", "Environment"), "Environments"),
+				"score":        prop("number", "Match score (0-1)"),
+				"match_type":   prop("string", "Match type"),
+			}, "service", "score", "match_type"), "Possible Datadog services when no match was clear"),
+			"pprof": NewObjectSchema(map[string]any{
+				"enabled":                prop("boolean", "Whether the code serves pprof handlers"),
+				"mux":                    enumProp("string", "Mux the handlers are on", []string{"default", "custom"}),
+				"paths":                  arrayPropSchema(prop("string", "Handler path"), "pprof handler paths"),
+				"addrs":                  arrayPropSchema(prop("string", "Listen address"), "Addresses serving the pprof mux, and pprof/debug flag defaults"),
+				"ports":                  arrayPropSchema(prop("integer", "Port"), "Ports parsed from addrs"),
+				"rate_endpoint":          prop("boolean", "Whether /debug/pprof/rates is served, so captures can set mutex_rate and block_rate"),
+				"mutex_profile_fraction": prop("string", "runtime.SetMutexProfileFraction argument, as written"),
+				"block_profile_rate":     prop("string", "runtime.SetBlockProfileRate argument, as written"),
+				"datadog_profiler":       prop("boolean", "Whether the Datadog profiler is imported"),
+				"evidence":               arrayPropSchema(prop("string", "file:line: finding"), "Where each finding is in the code"),
+				"notes":                  arrayPropSchema(prop("string", "Note"), "Which capture paths will not work"),
+			}, "enabled"),
+			"pprof_ports": arrayPropSchema(NewObjectSchema(map[string]any{
+				"port":   prop("integer", "Declared pprof port"),
+				"source": enumProp("string", "Where it is declared", []string{"k8s", "helm", "dockerfile"}),
+				"file":   prop("string", "Declaring file, relative to the repo root"),
+				"detail": prop("string", "What declares it: workload and container port, annotation, arg, or env; values key; Dockerfile instruction"),
+			}, "port", "source", "file", "detail"), "pprof ports the k8s manifests, Helm values, and Dockerfiles declare, in that order; k8s captures with repo_root fall back to the first"),
+		}, "binary", "service", "path", "sources"), "Discovered services"),
+		"warnings": arrayPropSchema(prop("string", "Warning"), "Warnings"),
+	}, "command", "services")
+}
+
+func datadogMetricsDiscoverOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "CLI command equivalent"),
+		"result": NewObjectSchemaWithAdditional(map[string]any{
+			"service":  prop("string", "Service name"),
+			"env":      prop("string", "Environment"),
+			"dd_site":  prop("string", "Datadog site"),
+			"query":    prop("string", "Metric search query"),
+			"warnings": arrayPropSchema(prop("string", "Warning"), "Warnings"),
+		}, true, "service", "dd_site"),
+		"table":      prop("string", "Formatted metrics table"),
+		"table_meta": truncationMetaSchema(),
+		"raw_meta":   truncationMetaSchema(),
+	}, "command", "result", "table")
+}
+
+func datadogProfilesNearEventOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "CLI command equivalent"),
+		"result": NewObjectSchemaWithAdditional(map[string]any{
+			"service":      prop("string", "Service name"),
+			"env":          prop("string", "Environment"),
+			"event_time":   prop("string", "Event time"),
+			"window":       prop("string", "Search window"),
+			"gap_duration": prop("string", "Duration between the closest profiles"),
+			"warnings":     arrayPropSchema(prop("string", "Warning"), "Warnings"),
+		}, true, "service", "env", "event_time"),
+		"formatted":      prop("string", "Formatted summary"),
+		"formatted_meta": truncationMetaSchema(),
+		"raw_meta":       truncationMetaSchema(),
+	}, "command", "result", "formatted")
+}
+
+func pprofRenderOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command":     prop("string", "pprof command"),
+		"output_path": prop("string", "Path of the rendered file"),
+		"format":      prop("string", "Output format (dot, svg, png, html)"),
+		"message":     prop("string", "Status message"),
+		"warnings":    arrayPropSchema(prop("string", "Warning"), "Fallbacks taken, e.g. DOT or HTML output because graphviz is not installed"),
+		"stderr":      prop("string", "Command stderr (if any)"),
+		"stderr_meta": truncationMetaSchema(),
+	}, "command", "output_path", "message")
+}
+
+func pprofMergeOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command":     prop("string", "pprof command"),
+		"output_path": prop("string", "Path of the merged profile"),
+		"input_count": prop("integer", "Number of profiles merged"),
+		"message":     prop("string", "Status message"),
+		"stderr":      prop("string", "Command stderr (if any)"),
+		"stderr_meta": truncationMetaSchema(),
+	}, "command", "output_path", "input_count", "message")
+}
+
+func pprofAllocPathsOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "pprof command"),
+		"result": NewObjectSchemaWithAdditional(map[string]any{
+			"profile_kind":    prop("string", "Profile kind"),
+			"total_alloc":     prop("integer", "Total allocated bytes"),
+			"total_alloc_str": prop("string", "Total allocated (human readable)"),
+			"duration_secs":   prop("number", "Profile duration in seconds"),
+			"paths": arrayPropSchema(NewObjectSchemaWithAdditional(map[string]any{
+				"alloc_site":      prop("string", "Allocation site"),
+				"alloc_bytes":     prop("integer", "Allocated bytes"),
+				"alloc_bytes_str": prop("string", "Allocated (human readable)"),
+				"alloc_pct":       prop("number", "Percent of total allocations"),
+				"alloc_rate":      prop("string", "Allocation rate (e.g. 45MB/min)"),
+				"first_app_frame": prop("string", "First application frame"),
+				"source_location": prop("string", "file:line of the first application frame"),
+			}, true, "alloc_site", "alloc_bytes", "alloc_pct"), "Allocation paths"),
+			"warnings": arrayPropSchema(prop("string", "Warning"), "Warnings"),
+		}, true, "total_alloc", "paths"),
+		"warnings": arrayPropSchema(prop("string", "Warning"), "Warnings"),
+	}, "command", "result")
+}
+
+func pprofOverheadReportOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "pprof command"),
+		"result": NewObjectSchemaWithAdditional(map[string]any{
+			"profile_kind":       prop("string", "Profile kind"),
+			"total_value":        prop("integer", "Total sample value"),
+			"total_value_str":    prop("string", "Total sample value (human readable)"),
+			"unit":               prop("string", "Sample unit"),
+			"total_overhead_pct": prop("number", "Total observability overhead percent"),
+			"warnings":           arrayPropSchema(prop("string", "Warning"), "Warnings"),
+		}, true, "total_value", "total_overhead_pct"),
+		"hints": arrayPropSchema(prop("string", "Hint"), "Hints for high-overhead categories"),
+	}, "command", "result")
+}
+
+func pprofDetectRepoOutputSchema() map[string]any {
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "pprof command"),
+		"result": NewObjectSchema(map[string]any{
+			"module_paths":    arrayPropSchema(prop("string", "Module path"), "Detected Go module paths"),
+			"detected_root":   prop("string", "Auto-detected local repo root"),
+			"detection_notes": arrayPropSchema(prop("string", "Note"), "Detection notes"),
+			"confidence":      prop("string", "Confidence (high, medium, low, none)"),
+		}, "module_paths", "detected_root", "detection_notes", "confidence"),
+	}, "command", "result")
+}
+
+func serverInfoOutputSchema() map[string]any {
+	dataSource := NewObjectSchema(map[string]any{
+		"available": prop("boolean", "Whether the data source is usable"),
+		"site":      prop("string", "Datadog site"),
+		"notes":     prop("string", "How to enable the data source"),
+	}, "available")
+	return NewObjectSchema(map[string]any{
+		"command": prop("string", "Tool name"),
+		"server": NewObjectSchema(map[string]any{
+			"name":       prop("string", "Server name"),
+			"version":    prop("string", "Server version"),
+			"go_version": prop("string", "Go runtime the server was built with"),
+			"platform":   prop("string", "GOOS/GOARCH"),
+		}, "name", "version", "go_version", "platform"),
+		"data_sources": NewObjectSchema(map[string]any{
+			"datadog": dataSource,
+			"d2":      dataSource,
+			"kubernetes": NewObjectSchema(map[string]any{
+				"available": prop("boolean", "Whether pods can be reached"),
+				"mode":      enumProp("string", "How cluster calls are made", []string{k8s.ModeKubectl, k8s.ModeInCluster}),
+				"notes":     prop("string", "How to enable or what to expect from the mode"),
+			}, "available", "mode"),
+			"pyroscope": dataSource,
+		}, "datadog", "d2", "kubernetes", "pyroscope"),
+		"dependencies": arrayPropSchema(NewObjectSchema(map[string]any{
+			"name":      prop("string", "Dependency name"),
+			"binary":    prop("string", "Executable looked up on PATH"),
+			"purpose":   prop("string", "Tools that need it"),
+			"available": prop("boolean", "Whether the executable was found"),
+			"path":      prop("string", "Resolved executable path"),
+			"version":   prop("string", "First line of version output"),
+			"error":     prop("string", "Why the dependency is unavailable or its probe failed"),
+		}, "name", "binary", "purpose", "available"), "External tools the server shells out to"),
+		"pprof": NewObjectSchema(map[string]any{
+			"command":           prop("string", "How pprof is run (go tool pprof, or PPROF_MCP_PPROF_BIN)"),
+			"standalone":        prop("boolean", "Whether pprof is a standalone binary rather than the Go toolchain's"),
+			"version":           prop("string", "Go toolchain version of go tool pprof"),
+			"unsupported_flags": arrayPropSchema(prop("string", "Flag"), "Flags this pprof lacks; they are dropped or replaced by their older name"),
+			"error":             prop("string", "Why pprof could not be probed"),
+		}, "command", "standalone"),
+		"paths": NewObjectSchema(map[string]any{
+			"config_file":           prop("string", "Config file location"),
+			"config_loaded":         prop("boolean", "Whether the config file was found and loaded"),
+			"policy_file":           prop("string", "Policy file (PPROF_MCP_POLICY_FILE)"),
+			"basedir":               prop("string", "PPROF_MCP_BASEDIR"),
+			"allowed_roots":         arrayPropSchema(prop("string", "Root"), "Allowed path roots"),
+			"workspace":             prop("string", "Workspace that outputs are redirected into"),
+			"incident_profiles_dir": prop("string", "Profiles directory of the open incident"),
+		}, "config_file", "config_loaded", "policy_file", "basedir", "allowed_roots", "workspace", "incident_profiles_dir"),
+		"policy": NewObjectSchema(map[string]any{
+			"configured":         prop("boolean", "Whether a policy file is active"),
+			"disabled_tools":     arrayPropSchema(prop("string", "Tool glob"), "Disabled tool globs"),
+			"datadog_services":   arrayPropSchema(prop("string", "Service glob"), "Allowed Datadog services (empty allows all)"),
+			"datadog_envs":       arrayPropSchema(prop("string", "Env glob"), "Allowed Datadog envs (empty allows all)"),
+			"max_download_bytes": integerProp("Download cap in bytes (0 = none)", intPtr(0), nil),
+			"redact_patterns":    integerProp("Number of custom redaction patterns", intPtr(0), nil),
+		}, "configured", "disabled_tools", "datadog_services", "datadog_envs", "max_download_bytes", "redact_patterns"),
+		"profile_cache": NewObjectSchema(map[string]any{
+			"entries":   integerProp("Profiles held", intPtr(0), nil),
+			"bytes":     integerProp("Estimated memory held, in bytes", intPtr(0), nil),
+			"max_bytes": integerProp("Cache bound (PPROF_MCP_PROFILE_CACHE_MB; 0 = disabled)", intPtr(0), nil),
+			"hits":      integerProp("Parses and top tables served from the cache", intPtr(0), nil),
+			"misses":    integerProp("Lookups that had to parse or run pprof", intPtr(0), nil),
+		}, "entries", "bytes", "max_bytes", "hits", "misses"),
+	}, "command", "server", "data_sources", "dependencies", "paths", "policy", "profile_cache")
+}
+
+func serverTempFilesOutputSchema() map[string]any {
+	entry := NewObjectSchema(map[string]any{
+		"path":        prop("string", "Temp file or directory"),
+		"pid":         prop("integer", "Process that created it"),
+		"own":         prop("boolean", "Whether this server process created it"),
+		"exists":      prop("boolean", "Whether it is still on disk"),
+		"bytes":       prop("integer", "Size on disk"),
+		"leaked":      prop("boolean", "Whether its process exited or it is older than max_age"),
+		"created":     prop("string", "Creation time (RFC 3339)"),
+		"age_seconds": prop("integer", "Age in seconds"),
+	}, "path", "pid", "own", "exists", "bytes", "leaked")
+	leftover := NewObjectSchema(map[string]any{
+		"path":  prop("string", "Temp file or directory"),
+		"bytes": prop("integer", "Size on disk"),
+	}, "path", "bytes")
+	return NewObjectSchema(map[string]any{
+		"command":        prop("string", "Tool name"),
+		"registry":       prop("string", "Directory of the temp registry; empty when it is kept in memory"),
+		"sweep_interval": prop("string", "How often the server removes leaked temps"),
+		"max_age":        prop("string", "Age after which a temp counts as leaked"),
+		"entries":        arrayPropSchema(entry, "Registered temps, oldest first"),
+		"leaked":         prop("integer", "Number of leaked temps"),
+		"leaked_bytes":   prop("integer", "Bytes held by leaked temps"),
+		"unregistered":   arrayPropSchema(leftover, "Temp-named files and dirs in the temp directory that are not registered"),
+	}, "command", "registry", "entries", "leaked", "leaked_bytes", "unregistered")
+}
+
+func serverSelfProfileOutputSchema() map[string]any {
+	runtimeStats := NewObjectSchema(map[string]any{
+		"goroutines":       prop("integer", "Goroutines running"),
+		"heap_alloc_bytes": prop("integer", "Bytes of allocated heap objects"),
+		"heap_sys_bytes":   prop("integer", "Heap bytes obtained from the OS"),
+		"num_gc":           prop("integer", "Completed GC cycles"),
+		"gc_pause_seconds": prop("number", "Total GC pause time"),
+	}, "goroutines", "heap_alloc_bytes", "heap_sys_bytes", "num_gc", "gc_pause_seconds")
+	return NewObjectSchema(map[string]any{
+		"command":     prop("string", "Tool name"),
+		"type":        prop("string", "Profile type captured"),
+		"pid":         prop("integer", "Server process ID"),
+		"seconds":     prop("integer", "Recording window (cpu, mutex, and block)"),
+		"path":        prop("string", "Profile file"),
+		"handle":      prop("string", "Profile handle for other pprof.* tools"),
+		"bytes":       prop("integer", "Profile size"),
+		"pprof":       prop("string", "pprof command used for the analysis"),
+		"rows":        arrayPropSchema(pprofTopRowSchema(), "Top functions"),
+		"top_summary": pprofTopSummarySchema(),
+		"hints":       arrayPropSchema(prop("string", "Hint"), "Contextual hints based on profile type"),
+		"runtime":     runtimeStats,
+	}, "command", "type", "pid", "path", "handle", "bytes", "rows", "runtime")
+}
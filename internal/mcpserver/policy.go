@@ -0,0 +1,261 @@
+package mcpserver
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"gopkg.in/yaml.v3"
+
+	"github.com/arreyder/pprof-mcp/internal/d2"
+	"github.com/arreyder/pprof-mcp/internal/datadog"
+)
+
+// toolPolicy restricts which tools may run and what they may target. It is
+// loaded from the YAML file named by PPROF_MCP_POLICY_FILE:
+//
+//	disabled_tools: ["d2.*", "pprof.branch_impact*"]
+//	denied_args:
+//	  pprof.suggest_fix:
+//	    output_format: [diff, pr_description]
+//	    open_pr: ["true"]
+//	datadog:
+//	  services: ["checkout", "payments-*"]
+//	  envs: ["staging"]
+//	max_download_bytes: 104857600
+//	redact:
+//	  - name: email
+//	    pattern: '[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}'
+type toolPolicy struct {
+	// DisabledTools are canonical tool name globs (path.Match syntax).
+	DisabledTools []string `yaml:"disabled_tools"`
+	// DeniedArgs maps tool name globs to argument values that are refused.
+	// Boolean arguments match "true" and "false".
+	DeniedArgs map[string]map[string][]string `yaml:"denied_args"`
+	Datadog    struct {
+		// Services and Envs are allowlists of globs; empty allows everything.
+		Services []string `yaml:"services"`
+		Envs     []string `yaml:"envs"`
+	} `yaml:"datadog"`
+	// MaxDownloadBytes caps each Datadog bundle and d2 profile (0 = no cap).
+	MaxDownloadBytes int64 `yaml:"max_download_bytes"`
+	// Redact adds regexes scrubbed from tool output on top of the built-in
+	// secret rules.
+	Redact []redactPatternSpec `yaml:"redact"`
+
+	redactor *redactor
+}
+
+// PolicyError describes why a call was refused.
+type PolicyError struct {
+	Tool     string
+	Rule     string
+	Argument string
+	Value    string
+	Message  string
+}
+
+func (e *PolicyError) Error() string {
+	return e.Message
+}
+
+var activePolicy atomic.Pointer[toolPolicy]
+
+// currentPolicy returns the active policy, or nil when none is configured.
+func currentPolicy() *toolPolicy {
+	return activePolicy.Load()
+}
+
+// setPolicy installs p (nil clears it) and applies its download caps and
+// redaction rules.
+func setPolicy(p *toolPolicy) {
+	activePolicy.Store(p)
+	var limit int64
+	r, _ := newRedactor(nil)
+	if p != nil {
+		limit = p.MaxDownloadBytes
+		if p.redactor != nil {
+			r = p.redactor
+		}
+	}
+	activeRedactor.Store(r)
+	datadog.SetMaxDownloadBytes(limit)
+	d2.SetMaxDownloadBytes(limit)
+}
+
+// loadPolicyFromEnv installs the policy named by PPROF_MCP_POLICY_FILE. An
+// unreadable or invalid policy is an error so the server never starts with a
+// policy silently ignored.
+func loadPolicyFromEnv() error {
+	p, err := policyFromEnv()
+	if err != nil || p == nil {
+		return err
+	}
+	setPolicy(p)
+	return nil
+}
+
+// policyFromEnv reads the policy named by PPROF_MCP_POLICY_FILE, returning nil
+// when the variable is unset.
+func policyFromEnv() (*toolPolicy, error) {
+	file := policyFilePath()
+	if file == "" {
+		return nil, nil
+	}
+	return loadPolicyFile(file)
+}
+
+func policyFilePath() string {
+	return strings.TrimSpace(os.Getenv("PPROF_MCP_POLICY_FILE"))
+}
+
+func loadPolicyFile(file string) (*toolPolicy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read policy file: %w", err)
+	}
+	return parsePolicy(data)
+}
+
+func parsePolicy(data []byte) (*toolPolicy, error) {
+	var p toolPolicy
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parse policy file: %w", err)
+	}
+	patterns := append([]string{}, p.DisabledTools...)
+	patterns = append(patterns, p.Datadog.Services...)
+	patterns = append(patterns, p.Datadog.Envs...)
+	for tool := range p.DeniedArgs {
+		patterns = append(patterns, tool)
+	}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q in policy file: %w", pattern, err)
+		}
+	}
+	if p.MaxDownloadBytes < 0 {
+		return nil, fmt.Errorf("max_download_bytes must be >= 0")
+	}
+	r, err := newRedactor(p.Redact)
+	if err != nil {
+		return nil, err
+	}
+	p.redactor = r
+	return &p, nil
+}
+
+func matchesAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ToolDisabled reports whether the policy disables a tool entirely.
+func (p *toolPolicy) ToolDisabled(canonicalName string) bool {
+	return p != nil && matchesAny(p.DisabledTools, canonicalName)
+}
+
+// Check returns a non-nil error when the call is not allowed.
+func (p *toolPolicy) Check(canonicalName string, args map[string]any) *PolicyError {
+	if p == nil {
+		return nil
+	}
+	if p.ToolDisabled(canonicalName) {
+		return &PolicyError{
+			Tool:    canonicalName,
+			Rule:    "disabled_tools",
+			Message: fmt.Sprintf("%s is disabled by server policy", canonicalName),
+		}
+	}
+
+	toolPatterns := make([]string, 0, len(p.DeniedArgs))
+	for pattern := range p.DeniedArgs {
+		toolPatterns = append(toolPatterns, pattern)
+	}
+	sort.Strings(toolPatterns)
+	for _, pattern := range toolPatterns {
+		if ok, _ := path.Match(pattern, canonicalName); !ok {
+			continue
+		}
+		argNames := make([]string, 0, len(p.DeniedArgs[pattern]))
+		for arg := range p.DeniedArgs[pattern] {
+			argNames = append(argNames, arg)
+		}
+		sort.Strings(argNames)
+		for _, arg := range argNames {
+			value := strings.TrimSpace(getString(args, arg))
+			if flag, ok := args[arg].(bool); ok {
+				value = strconv.FormatBool(flag)
+			}
+			if value == "" {
+				continue
+			}
+			if matchesAny(p.DeniedArgs[pattern][arg], value) {
+				return &PolicyError{
+					Tool:     canonicalName,
+					Rule:     "denied_args",
+					Argument: arg,
+					Value:    value,
+					Message:  fmt.Sprintf("%s=%s is not allowed for %s by server policy", arg, value, canonicalName),
+				}
+			}
+		}
+	}
+
+	if rateLimitClass(canonicalName) != rateClassDatadog {
+		return nil
+	}
+	checks := []struct {
+		arg     string
+		allowed []string
+	}{
+		{"service", p.Datadog.Services},
+		{"env", p.Datadog.Envs},
+	}
+	for _, check := range checks {
+		value := strings.TrimSpace(getString(args, check.arg))
+		if value == "" || len(check.allowed) == 0 || matchesAny(check.allowed, value) {
+			continue
+		}
+		return &PolicyError{
+			Tool:     canonicalName,
+			Rule:     "datadog." + check.arg + "s",
+			Argument: check.arg,
+			Value:    value,
+			Message:  fmt.Sprintf("Datadog %s %q is not in the server policy allowlist", check.arg, value),
+		}
+	}
+	return nil
+}
+
+func policyDeniedResult(toolName string, err *PolicyError) *mcp.CallToolResult {
+	msg := fmt.Sprintf("%s: %s", toolName, err.Error())
+	hint := "This server's policy file (PPROF_MCP_POLICY_FILE) forbids this call; ask the operator or choose an allowed target."
+	details := map[string]any{
+		"rule": err.Rule,
+		"hint": hint,
+	}
+	if err.Argument != "" {
+		details["argument"] = err.Argument
+		details["value"] = err.Value
+	}
+	return &mcp.CallToolResult{
+		IsError: true,
+		Content: []mcp.Content{&mcp.TextContent{Text: msg + "\nHint: " + hint}},
+		StructuredContent: map[string]any{
+			"error": map[string]any{
+				"message": msg,
+				"code":    "POLICY_DENIED",
+				"details": details,
+			},
+		},
+	}
+}
@@ -0,0 +1,99 @@
+package mcpserver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const testPolicyYAML = `
+disabled_tools: ["d2.*", "pprof.branch_impact*"]
+denied_args:
+  pprof.suggest_fix:
+    output_format: [diff, pr_description]
+    open_pr: ["true"]
+datadog:
+  services: ["checkout", "payments-*"]
+  envs: ["staging"]
+max_download_bytes: 1048576
+`
+
+func TestPolicyCheck(t *testing.T) {
+	p, err := parsePolicy([]byte(testPolicyYAML))
+	if err != nil {
+		t.Fatalf("parse policy: %v", err)
+	}
+
+	cases := []struct {
+		tool string
+		args map[string]any
+		rule string
+	}{
+		{"d2.profiles.download", map[string]any{"service": "x"}, "disabled_tools"},
+		{"pprof.branch_impact.execute", map[string]any{"plan_id": "abc"}, "disabled_tools"},
+		{"pprof.branch_impact.plan", nil, "disabled_tools"},
+		{"pprof.suggest_fix", map[string]any{"output_format": "diff"}, "denied_args"},
+		{"pprof.suggest_fix", map[string]any{"output_format": "structured"}, ""},
+		{"pprof.suggest_fix", map[string]any{"open_pr": true}, "denied_args"},
+		{"pprof.suggest_fix", map[string]any{"open_pr": false}, ""},
+		{"datadog.profiles.list", map[string]any{"service": "checkout", "env": "staging"}, ""},
+		{"datadog.profiles.list", map[string]any{"service": "payments-api", "env": "staging"}, ""},
+		{"datadog.profiles.list", map[string]any{"service": "billing", "env": "staging"}, "datadog.services"},
+		{"profiles.download_latest_bundle", map[string]any{"service": "checkout", "env": "prod"}, "datadog.envs"},
+		{"pprof.top", map[string]any{"profile": "cpu.pprof"}, ""},
+	}
+	for _, tc := range cases {
+		denial := p.Check(tc.tool, tc.args)
+		got := ""
+		if denial != nil {
+			got = denial.Rule
+		}
+		if got != tc.rule {
+			t.Fatalf("%s %v: expected rule %q, got %q", tc.tool, tc.args, tc.rule, got)
+		}
+	}
+
+	var nilPolicy *toolPolicy
+	if nilPolicy.Check("d2.profiles.download", nil) != nil {
+		t.Fatalf("nil policy should allow everything")
+	}
+}
+
+func TestParsePolicyRejectsInvalidPatterns(t *testing.T) {
+	if _, err := parsePolicy([]byte(`disabled_tools: ["pprof.["]`)); err == nil {
+		t.Fatalf("expected invalid pattern error")
+	}
+	if _, err := parsePolicy([]byte(`max_download_bytes: -1`)); err == nil {
+		t.Fatalf("expected negative cap error")
+	}
+}
+
+func TestPolicyDeniedCallReturnsStructuredError(t *testing.T) {
+	p, err := parsePolicy([]byte(testPolicyYAML))
+	if err != nil {
+		t.Fatalf("parse policy: %v", err)
+	}
+	setPolicy(p)
+	defer setPolicy(nil)
+
+	session := connectTestSession(t)
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "datadog.profiles.list",
+		Arguments: map[string]any{"service": "billing", "env": "staging"},
+	})
+	if err != nil {
+		t.Fatalf("call tool: %v", err)
+	}
+	if !res.IsError {
+		t.Fatalf("expected policy denial")
+	}
+	structured := res.StructuredContent.(map[string]any)
+	payload := structured["error"].(map[string]any)
+	if payload["code"] != "POLICY_DENIED" {
+		t.Fatalf("expected POLICY_DENIED, got %v", payload["code"])
+	}
+	if payload["details"].(map[string]any)["rule"] != "datadog.services" {
+		t.Fatalf("unexpected details: %v", payload["details"])
+	}
+}
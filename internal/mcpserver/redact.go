@@ -0,0 +1,180 @@
+package mcpserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// redactPatternSpec is a user-defined redaction rule from the policy file.
+type redactPatternSpec struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern"`
+}
+
+type redactRule struct {
+	name string
+	re   *regexp.Regexp
+	// keep is the number of leading capture groups preserved (e.g. the header
+	// name and separator), so only the secret itself is replaced.
+	keep int
+}
+
+// redactor scrubs secrets and configured PII from tool output before it is
+// returned to the client.
+type redactor struct {
+	rules []redactRule
+}
+
+var builtinRedactRules = []redactRule{
+	{name: "auth_header", re: regexp.MustCompile(`(?i)(\b(?:authorization|ductone-token|dd-api-key|dd-application-key)["']?\s*[:=]\s*["']?)(?:(?:bearer|basic|token)\s+)?[^\s"',]+`), keep: 1},
+	{name: "bearer_token", re: regexp.MustCompile(`(?i)(\bbearer\s+)[A-Za-z0-9\-._~+/]+=*`), keep: 1},
+	{name: "datadog_key", re: regexp.MustCompile(`(?i)(\b(?:dd_api_key|dd_app_key|dd_application_key|api_key|app_key|application_key)["']?\s*[:=]\s*["']?)[A-Za-z0-9]{16,}`), keep: 1},
+}
+
+// secretFieldNames are structured-output keys whose values are always secret,
+// since the key and value are separate strings once decoded.
+var secretFieldNames = map[string]bool{
+	"dd_api_key":         true,
+	"dd_app_key":         true,
+	"dd_application_key": true,
+	"api_key":            true,
+	"app_key":            true,
+	"application_key":    true,
+}
+
+// newRedactor combines the built-in rules, the literal values of the Datadog
+// key environment variables, and any policy-defined patterns.
+func newRedactor(extra []redactPatternSpec) (*redactor, error) {
+	r := &redactor{}
+	for _, key := range []string{"DD_API_KEY", "DD_APP_KEY", "DD_APPLICATION_KEY"} {
+		if value := strings.TrimSpace(os.Getenv(key)); len(value) >= 8 {
+			r.rules = append(r.rules, redactRule{name: "datadog_key", re: regexp.MustCompile(regexp.QuoteMeta(value))})
+		}
+	}
+	r.rules = append(r.rules, builtinRedactRules...)
+	for _, spec := range extra {
+		re, err := regexp.Compile(spec.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %w", spec.Name, err)
+		}
+		name := strings.TrimSpace(spec.Name)
+		if name == "" {
+			name = "custom"
+		}
+		r.rules = append(r.rules, redactRule{name: name, re: re})
+	}
+	return r, nil
+}
+
+// String replaces every match with [REDACTED:<rule>].
+func (r *redactor) String(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	for _, rule := range r.rules {
+		if !rule.re.MatchString(s) {
+			continue
+		}
+		replacement := "[REDACTED:" + rule.name + "]"
+		if rule.keep > 0 {
+			var prefix strings.Builder
+			for i := 1; i <= rule.keep; i++ {
+				fmt.Fprintf(&prefix, "${%d}", i)
+			}
+			s = rule.re.ReplaceAllString(s, prefix.String()+replacement)
+		} else {
+			s = rule.re.ReplaceAllLiteralString(s, replacement)
+		}
+	}
+	return s
+}
+
+func (r *redactor) matches(data []byte) bool {
+	for _, rule := range r.rules {
+		if rule.re.Match(data) {
+			return true
+		}
+	}
+	return false
+}
+
+// Value redacts every string in a structured payload. Payloads without a match
+// are returned unchanged; otherwise the result is a JSON-decoded copy.
+func (r *redactor) Value(v any) any {
+	if r == nil || v == nil {
+		return v
+	}
+	data, err := json.Marshal(v)
+	if err != nil || !r.matches(data) {
+		return v
+	}
+	var decoded any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&decoded); err != nil {
+		return v
+	}
+	return r.walk(decoded)
+}
+
+func (r *redactor) walk(v any) any {
+	switch typed := v.(type) {
+	case string:
+		return r.String(typed)
+	case map[string]any:
+		for key, value := range typed {
+			if str, ok := value.(string); ok && str != "" && secretFieldNames[strings.ToLower(key)] {
+				typed[key] = "[REDACTED:datadog_key]"
+				continue
+			}
+			typed[key] = r.walk(value)
+		}
+		return typed
+	case []any:
+		for i, value := range typed {
+			typed[i] = r.walk(value)
+		}
+		return typed
+	default:
+		return v
+	}
+}
+
+// Result redacts the text content, structured content, and structured output
+// of a tool call.
+func (r *redactor) Result(res *mcp.CallToolResult, out any) (*mcp.CallToolResult, any) {
+	if r == nil {
+		return res, out
+	}
+	if res != nil {
+		for _, content := range res.Content {
+			if text, ok := content.(*mcp.TextContent); ok {
+				text.Text = r.String(text.Text)
+			}
+		}
+		if res.StructuredContent != nil {
+			res.StructuredContent = r.Value(res.StructuredContent)
+		}
+	}
+	return res, r.Value(out)
+}
+
+var activeRedactor atomic.Pointer[redactor]
+
+// currentRedactor returns the redactor for the active policy, building the
+// default one on first use.
+func currentRedactor() *redactor {
+	if r := activeRedactor.Load(); r != nil {
+		return r
+	}
+	r, _ := newRedactor(nil)
+	activeRedactor.CompareAndSwap(nil, r)
+	return activeRedactor.Load()
+}
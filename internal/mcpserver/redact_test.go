@@ -0,0 +1,92 @@
+package mcpserver
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestRedactorBuiltinRules(t *testing.T) {
+	t.Setenv("DD_API_KEY", "0123456789abcdef0123456789abcdef")
+	r, err := newRedactor(nil)
+	if err != nil {
+		t.Fatalf("new redactor: %v", err)
+	}
+
+	cases := map[string]string{
+		"curl -H 'Authorization: Bearer abc.def-ghi' https://x":     "curl -H 'Authorization: [REDACTED:auth_header]' https://x",
+		"token was Bearer abc123==":                                 "token was Bearer [REDACTED:bearer_token]",
+		"Ductone-Token: s3cr3t":                                     "Ductone-Token: [REDACTED:auth_header]",
+		"using key 0123456789abcdef0123456789abcdef for site":       "using key [REDACTED:datadog_key] for site",
+		`{"dd_app_key":"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}`: `{"dd_app_key":"[REDACTED:datadog_key]"}`,
+		"flat  flat%   sum%  runtime.mallocgc":                      "flat  flat%   sum%  runtime.mallocgc",
+	}
+	for input, want := range cases {
+		if got := r.String(input); got != want {
+			t.Fatalf("redact %q:\n got %q\nwant %q", input, got, want)
+		}
+	}
+}
+
+func TestRedactorCustomPatternsFromPolicy(t *testing.T) {
+	p, err := parsePolicy([]byte(`
+redact:
+  - name: email
+    pattern: '[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}'
+  - name: tenant
+    pattern: 'tenant_id:[0-9a-f-]{8,}'
+`))
+	if err != nil {
+		t.Fatalf("parse policy: %v", err)
+	}
+	got := p.redactor.String("label tenant_id:3f2a9c10-aaaa owner=ops@example.com")
+	want := "label [REDACTED:tenant] owner=[REDACTED:email]"
+	if got != want {
+		t.Fatalf("got %q want %q", got, want)
+	}
+
+	if _, err := parsePolicy([]byte("redact:\n  - name: bad\n    pattern: '('\n")); err == nil {
+		t.Fatalf("expected invalid redact pattern error")
+	}
+}
+
+func TestRedactorResultScrubsTextAndStructured(t *testing.T) {
+	r, err := newRedactor([]redactPatternSpec{{Name: "email", Pattern: `[a-z]+@example\.com`}})
+	if err != nil {
+		t.Fatalf("new redactor: %v", err)
+	}
+	type payload struct {
+		Raw      string   `json:"raw"`
+		Warnings []string `json:"warnings"`
+		Count    int      `json:"count"`
+	}
+	res := TextResult("owner bob@example.com")
+	out := payload{Raw: "clean", Warnings: []string{"contact bob@example.com"}, Count: 3}
+
+	res, redacted := r.Result(res, out)
+	if text := res.Content[0].(*mcp.TextContent).Text; strings.Contains(text, "bob@") {
+		t.Fatalf("text not redacted: %q", text)
+	}
+	m, ok := redacted.(map[string]any)
+	if !ok {
+		t.Fatalf("expected redacted map, got %T", redacted)
+	}
+	if m["warnings"].([]any)[0] != "contact [REDACTED:email]" || m["raw"] != "clean" {
+		t.Fatalf("unexpected redacted payload: %v", m)
+	}
+
+	keyed := r.Value(map[string]any{"api_key": "0123456789abcdef0123", "service": "api"}).(map[string]any)
+	if keyed["api_key"] != "[REDACTED:datadog_key]" || keyed["service"] != "api" {
+		t.Fatalf("expected secret field to be redacted: %v", keyed)
+	}
+
+	clean := payload{Raw: "nothing to see"}
+	isPayload := func(v any) bool {
+		_, ok := v.(payload)
+		return ok
+	}
+	if _, same := r.Result(TextResult("ok"), clean); !isPayload(same) {
+		t.Fatalf("payload without matches should be returned unchanged")
+	}
+}
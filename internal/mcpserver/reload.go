@@ -0,0 +1,187 @@
+package mcpserver
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/arreyder/pprof-mcp/internal/config"
+)
+
+const defaultReloadInterval = 2 * time.Second
+
+// toolSet tracks which tool definitions are registered on a server so policy
+// reloads can add or remove them. The SDK sends notifications/tools/list_changed
+// to connected sessions whenever the set changes.
+type toolSet struct {
+	mu     sync.Mutex
+	server *mcp.Server
+	order  []string
+	tools  map[string]*registeredTool
+}
+
+type registeredTool struct {
+	name string
+	// policyNames are matched against disabled_tools; an alias is disabled
+	// when either its old or new name is.
+	policyNames []string
+	add         func()
+	active      bool
+}
+
+func newToolSet(s *mcp.Server) *toolSet {
+	return &toolSet{server: s, tools: map[string]*registeredTool{}}
+}
+
+// add records a tool without registering it; sync decides whether it is
+// exposed.
+func (ts *toolSet) add(key, name string, policyNames []string, register func()) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.order = append(ts.order, key)
+	ts.tools[key] = &registeredTool{name: name, policyNames: policyNames, add: register}
+}
+
+// sync registers tools the policy allows and removes the ones it disables,
+// returning the canonical names that changed.
+func (ts *toolSet) sync(p *toolPolicy) (enabled, disabled []string) {
+	if ts == nil {
+		return nil, nil
+	}
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	var remove []string
+	for _, canonicalName := range ts.order {
+		entry := ts.tools[canonicalName]
+		off := false
+		for _, name := range entry.policyNames {
+			off = off || p.ToolDisabled(name)
+		}
+		switch {
+		case off && entry.active:
+			entry.active = false
+			remove = append(remove, entry.name)
+			disabled = append(disabled, canonicalName)
+		case !off && !entry.active:
+			entry.add()
+			entry.active = true
+			enabled = append(enabled, canonicalName)
+		}
+	}
+	if len(remove) > 0 {
+		ts.server.RemoveTools(remove...)
+	}
+	return enabled, disabled
+}
+
+// reloadConfiguration re-reads the config file and PPROF_MCP_POLICY_FILE and
+// applies them to tools. On error the previous configuration stays active.
+func reloadConfiguration(tools *toolSet) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	p, err := policyFromEnv()
+	if err != nil {
+		return err
+	}
+	activateConfig(cfg)
+	setPolicy(p)
+	enabled, disabled := tools.sync(p)
+	if len(enabled) > 0 || len(disabled) > 0 {
+		log.Printf("Configuration reloaded: enabled %v, disabled %v", enabled, disabled)
+	} else {
+		log.Printf("Configuration reloaded")
+	}
+	return nil
+}
+
+// reloadInterval reads PPROF_MCP_RELOAD_INTERVAL (seconds between checks of
+// the config and policy files; 0 disables polling, SIGHUP still reloads).
+func reloadInterval() time.Duration {
+	raw := strings.TrimSpace(os.Getenv("PPROF_MCP_RELOAD_INTERVAL"))
+	if raw == "" {
+		return defaultReloadInterval
+	}
+	seconds, err := strconv.Atoi(raw)
+	if err != nil || seconds < 0 {
+		return defaultReloadInterval
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// fileStamp identifies a version of a watched file.
+type fileStamp struct {
+	exists  bool
+	size    int64
+	modTime int64
+}
+
+func statFile(path string) fileStamp {
+	if path == "" {
+		return fileStamp{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{exists: true, size: info.Size(), modTime: info.ModTime().UnixNano()}
+}
+
+func watchedFiles() []string {
+	return []string{config.Path(), policyFilePath()}
+}
+
+// watchConfiguration reloads when a watched file changes or on SIGHUP, until
+// ctx is done.
+func watchConfiguration(ctx context.Context, tools *toolSet) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if interval := reloadInterval(); interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	files := watchedFiles()
+	stamps := make([]fileStamp, len(files))
+	for i, file := range files {
+		stamps[i] = statFile(file)
+	}
+	reload := func() {
+		if err := reloadConfiguration(tools); err != nil {
+			log.Printf("Configuration reload failed, keeping previous settings: %v", err)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			reload()
+		case <-tick:
+			changed := false
+			for i, file := range files {
+				if stamp := statFile(file); stamp != stamps[i] {
+					stamps[i] = stamp
+					changed = true
+				}
+			}
+			if changed {
+				reload()
+			}
+		}
+	}
+}
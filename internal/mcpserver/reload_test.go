@@ -0,0 +1,100 @@
+package mcpserver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestReloadConfigurationUpdatesToolList(t *testing.T) {
+	dir := t.TempDir()
+	policyFile := filepath.Join(dir, "policy.yaml")
+	if err := os.WriteFile(policyFile, []byte("disabled_tools: []\n"), 0o644); err != nil {
+		t.Fatalf("write policy: %v", err)
+	}
+	t.Setenv("PPROF_MCP_POLICY_FILE", policyFile)
+	t.Setenv("PPROF_MCP_CONFIG", filepath.Join(dir, "config.yaml"))
+	t.Cleanup(func() {
+		setPolicy(nil)
+		activeConfig.Store(nil)
+	})
+
+	ctx := context.Background()
+	server, tools, err := buildServer(toolNameModeDefault)
+	if err != nil {
+		t.Fatalf("build server: %v", err)
+	}
+	clientTransport, serverTransport := mcp.NewInMemoryTransports()
+	serverSession, err := server.Connect(ctx, serverTransport, nil)
+	if err != nil {
+		t.Fatalf("server connect: %v", err)
+	}
+	changed := make(chan struct{}, 4)
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "test"}, &mcp.ClientOptions{
+		ToolListChangedHandler: func(context.Context, *mcp.ToolListChangedRequest) {
+			changed <- struct{}{}
+		},
+	})
+	session, err := client.Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("client connect: %v", err)
+	}
+	t.Cleanup(func() {
+		session.Close()
+		serverSession.Close()
+	})
+
+	if err := os.WriteFile(policyFile, []byte(`disabled_tools: ["d2.*"]`), 0o644); err != nil {
+		t.Fatalf("write policy: %v", err)
+	}
+	if err := reloadConfiguration(tools); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected notifications/tools/list_changed")
+	}
+	listed, err := session.ListTools(ctx, nil)
+	if err != nil {
+		t.Fatalf("list tools: %v", err)
+	}
+	for _, tool := range listed.Tools {
+		if strings.HasPrefix(tool.Name, "d2.") {
+			t.Fatalf("disabled tool %s still listed", tool.Name)
+		}
+	}
+	if len(listed.Tools) == 0 || len(listed.Tools) >= len(ToolSchemas())+len(toolAliases) {
+		t.Fatalf("unexpected tool count %d", len(listed.Tools))
+	}
+
+	if err := os.WriteFile(policyFile, []byte("disabled_tools: [\n"), 0o644); err != nil {
+		t.Fatalf("write policy: %v", err)
+	}
+	if err := reloadConfiguration(tools); err == nil {
+		t.Fatalf("expected invalid policy to fail reload")
+	}
+	if !currentPolicy().ToolDisabled("d2.profiles.download") {
+		t.Fatalf("previous policy should stay active after a failed reload")
+	}
+
+	if err := os.Remove(policyFile); err != nil {
+		t.Fatalf("remove policy: %v", err)
+	}
+	t.Setenv("PPROF_MCP_POLICY_FILE", "")
+	if err := reloadConfiguration(tools); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	listed, err = session.ListTools(ctx, nil)
+	if err != nil {
+		t.Fatalf("list tools: %v", err)
+	}
+	if want := len(ToolSchemas()) + len(toolAliases); len(listed.Tools) != want {
+		t.Fatalf("expected all %d tools after clearing policy, got %d", want, len(listed.Tools))
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package mcpserver
 
 import (
 	"context"
@@ -6,8 +6,13 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/arreyder/pprof-mcp/internal/datadog"
+	"github.com/arreyder/pprof-mcp/internal/pprof"
+	"github.com/arreyder/pprof-mcp/internal/textutil"
 )
 
 type ToolOutput struct {
@@ -58,6 +63,18 @@ func buildErrorPayload(err error, hint string) map[string]any {
 	} else if _, ok := err.(*ValidationError); ok {
 		code = "INVALID_ARGUMENT"
 	}
+	var commandErr *pprof.CommandError
+	var parseErr *pprof.ParseError
+	var degradedErr *datadog.DegradedError
+	switch {
+	case code != "INTERNAL":
+	case errors.As(err, &commandErr):
+		code = "PPROF_FAILED"
+	case errors.As(err, &parseErr):
+		code = "PARSE_FAILED"
+	case errors.As(err, &degradedErr):
+		code = "DATADOG_DEGRADED"
+	}
 
 	message := strings.TrimSpace(err.Error())
 	details := map[string]any{}
@@ -77,6 +94,18 @@ func buildErrorPayload(err error, hint string) map[string]any {
 	} else if hint != "" {
 		details["hint"] = hint
 	}
+	if commandErr != nil {
+		details["command"] = commandErr.Command
+		addStderr(details, commandErr.Stderr, commandErr.StderrMeta, textutil.TruncateOptions{})
+	} else if parseErr != nil {
+		details["command"] = parseErr.Command
+	} else if degradedErr != nil {
+		details["host"] = degradedErr.Host
+		details["retry_after_seconds"] = int(degradedErr.RetryAfter.Round(time.Second) / time.Second)
+		if _, ok := details["hint"]; !ok {
+			details["hint"] = "Datadog is failing requests; retry after retry_after_seconds instead of retrying now."
+		}
+	}
 
 	payload := map[string]any{
 		"message": message,
@@ -0,0 +1,92 @@
+package mcpserver
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/arreyder/pprof-mcp/internal/pprof"
+)
+
+// sampleIndexProfileArgs are the profile arguments a sample_index applies to.
+var sampleIndexProfileArgs = []string{"profile", "before", "after"}
+
+// ownSampleIndexDefault marks tools that pick their own sample index when
+// none is given (allocation-oriented tools prefer alloc_space); for these the
+// argument is only validated.
+var ownSampleIndexDefault = map[string]bool{
+	"pprof.storylines":        true,
+	"pprof.coverage_hotspots": true,
+	"pprof.overhead_report":   true,
+}
+
+// resolveSampleIndexArg validates sample_index against the sample types of
+// the call's profiles and, when it is absent, fills in the default for the
+// profile's kind so tools analyze cpu, inuse_space, or delay rather than
+// whichever type happens to be last. Profiles that cannot be read are left
+// for the tool to report.
+func resolveSampleIndexArg(tool *mcp.Tool, canonicalName string, args map[string]any) (*pprof.SampleIndexChoice, error) {
+	if !hasInputProperty(tool, "sample_index") {
+		return nil, nil
+	}
+	requested := getString(args, "sample_index")
+	var chosen *pprof.SampleIndexChoice
+	for _, key := range sampleIndexProfileArgs {
+		path, ok := args[key].(string)
+		if !ok || path == "" {
+			continue
+		}
+		choice, err := pprof.ResolveSampleIndex(path, requested)
+		var indexErr *pprof.SampleIndexError
+		if errors.As(err, &indexErr) {
+			return nil, &ValidationError{
+				Field:    "sample_index",
+				Message:  fmt.Sprintf("sample_index %q is not a sample type of %s (%s profile)", requested, key, indexErr.Kind),
+				Expected: "one of " + strings.Join(indexErr.Available, ", "),
+				Received: requested,
+				Hint:     "Pass one of the profile's sample types, or omit sample_index to use the default for its kind.",
+			}
+		}
+		if err != nil || chosen != nil {
+			continue
+		}
+		chosen = &choice
+	}
+	if chosen == nil || chosen.SampleIndex == "" {
+		return nil, nil
+	}
+	if requested == "" {
+		if ownSampleIndexDefault[canonicalName] || args["profile"] == nil {
+			return nil, nil
+		}
+		args["sample_index"] = chosen.SampleIndex
+	}
+	return chosen, nil
+}
+
+func hasInputProperty(tool *mcp.Tool, name string) bool {
+	schema, ok := tool.InputSchema.(map[string]any)
+	if !ok {
+		return false
+	}
+	props, ok := schema["properties"].(map[string]any)
+	if !ok {
+		return false
+	}
+	_, ok = props[name]
+	return ok
+}
+
+// annotateSampleIndex reports the sample index a call ran with, and whether
+// it was requested or chosen for the profile's kind, in _meta.sample_index.
+func annotateSampleIndex(res *mcp.CallToolResult, choice *pprof.SampleIndexChoice) {
+	if res == nil || res.IsError || choice == nil {
+		return
+	}
+	if res.Meta == nil {
+		res.Meta = mcp.Meta{}
+	}
+	res.Meta["sample_index"] = choice
+}
@@ -0,0 +1,200 @@
+package mcpserver
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/arreyder/pprof-mcp/internal/config"
+)
+
+// writePathArgKeys are path arguments a tool writes to. Outside the allowed
+// roots they are rewritten into the workspace (when one is configured) instead
+// of being rejected, so "save to /tmp/flame.svg" still works.
+var writePathArgKeys = map[string]bool{
+	"output_path":   true,
+	"out_dir":       true,
+	"baseline_path": true,
+}
+
+// sandboxConfig confines every path argument (profiles, binaries, repo roots,
+// and outputs) to a set of allowed roots. Unlike PPROF_MCP_BASEDIR it allows
+// several disjoint roots, e.g. a profile workspace plus repo checkouts.
+type sandboxConfig struct {
+	roots     []string
+	workspace string
+}
+
+// pathRewrite records an output path moved into the workspace.
+type pathRewrite struct {
+	Arg  string `json:"arg"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+var (
+	sandboxOnce sync.Once
+	sandboxVal  sandboxConfig
+)
+
+// sandbox reads PPROF_MCP_ALLOWED_ROOTS (a list separated like PATH) and
+// PPROF_MCP_WORKSPACE. The workspace is always an allowed root. With neither
+// set, paths are not restricted beyond PPROF_MCP_BASEDIR. The config file
+// workspace is used only when roots are set, so configuring it for profctl
+// does not by itself confine the server.
+func sandbox() sandboxConfig {
+	sandboxOnce.Do(func() {
+		roots := os.Getenv("PPROF_MCP_ALLOWED_ROOTS")
+		workspace := os.Getenv("PPROF_MCP_WORKSPACE")
+		if strings.TrimSpace(workspace) == "" && strings.TrimSpace(roots) != "" {
+			workspace = currentConfig().Workspace
+		}
+		sandboxVal = newSandboxConfig(roots, workspace)
+	})
+	return sandboxVal
+}
+
+func newSandboxConfig(rootsRaw, workspace string) sandboxConfig {
+	cfg := sandboxConfig{}
+	seen := map[string]bool{}
+	addRoot := func(root string) string {
+		root = strings.TrimSpace(root)
+		if root == "" {
+			return ""
+		}
+		abs, err := filepath.Abs(config.ExpandHome(root))
+		if err != nil {
+			return ""
+		}
+		if real, err := resolvePathReal(abs); err == nil {
+			abs = real
+		}
+		if !seen[abs] {
+			seen[abs] = true
+			cfg.roots = append(cfg.roots, abs)
+		}
+		return abs
+	}
+	cfg.workspace = addRoot(workspace)
+	for _, root := range filepath.SplitList(rootsRaw) {
+		addRoot(root)
+	}
+	return cfg
+}
+
+func (c sandboxConfig) enabled() bool {
+	return len(c.roots) > 0
+}
+
+// contains reports whether path (after resolving symlinks) is inside a root.
+func (c sandboxConfig) contains(path string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	real, err := resolvePathReal(abs)
+	if err != nil {
+		return false
+	}
+	for _, root := range c.roots {
+		rel, err := filepath.Rel(root, real)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// sandboxArgs checks path arguments already cleaned by sanitizeArgs. Read
+// paths outside the roots are rejected; write paths are moved into the
+// workspace when one is configured and rejected otherwise.
+func sandboxArgs(cfg sandboxConfig, args map[string]any) (map[string]any, []pathRewrite, error) {
+	if !cfg.enabled() || len(args) == 0 {
+		return args, nil, nil
+	}
+	var rewrites []pathRewrite
+	keys := make([]string, 0, len(args))
+	for key := range args {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		switch {
+		case pathArgKeys[key]:
+			str, ok := args[key].(string)
+			if !ok || str == "" || cfg.contains(str) {
+				continue
+			}
+			if writePathArgKeys[key] && cfg.workspace != "" {
+				rewritten := filepath.Join(cfg.workspace, filepath.Base(str))
+				rewrites = append(rewrites, pathRewrite{Arg: key, From: str, To: rewritten})
+				args[key] = rewritten
+				continue
+			}
+			return nil, nil, cfg.outsideError(key, str)
+		case pathSliceArgKeys[key]:
+			paths, ok := args[key].([]string)
+			if !ok {
+				continue
+			}
+			for _, path := range paths {
+				if path != "" && !cfg.contains(path) {
+					return nil, nil, cfg.outsideError(key, path)
+				}
+			}
+		case key == "artifact_url":
+			str, _ := args[key].(string)
+			if dir, ok := artifactFileDir(str); ok && !cfg.contains(dir) {
+				return nil, nil, cfg.outsideError(key, str)
+			}
+		}
+	}
+	return args, rewrites, nil
+}
+
+// artifactFileDir returns the local path a file:// artifact_url template
+// reads under: the cleaned path up to the directory holding the first
+// placeholder. ok is false for other schemes.
+func artifactFileDir(value string) (dir string, ok bool) {
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Scheme != "file" {
+		return "", false
+	}
+	path := filepath.Clean(filepath.FromSlash(parsed.Path))
+	if i := strings.Index(path, "{"); i >= 0 {
+		path = filepath.Dir(path[:i] + "x")
+	}
+	return path, true
+}
+
+func (c sandboxConfig) outsideError(key, path string) *ValidationError {
+	hint := "Use a path under one of the allowed roots, or pass a profile handle."
+	if writePathArgKeys[key] {
+		hint = "Write outputs under an allowed root, or set PPROF_MCP_WORKSPACE so outputs are redirected there."
+	}
+	return &ValidationError{
+		Field:    key,
+		Message:  fmt.Sprintf("path %q is outside the allowed roots", path),
+		Expected: fmt.Sprintf("path within %s", strings.Join(c.roots, ", ")),
+		Received: redactValue(key, path),
+		Hint:     hint,
+	}
+}
+
+// annotatePathRewrites records redirected outputs in the result _meta.
+func annotatePathRewrites(res *mcp.CallToolResult, rewrites []pathRewrite) {
+	if res == nil || len(rewrites) == 0 {
+		return
+	}
+	if res.Meta == nil {
+		res.Meta = mcp.Meta{}
+	}
+	res.Meta["path_rewrites"] = rewrites
+}
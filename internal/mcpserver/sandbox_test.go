@@ -0,0 +1,112 @@
+package mcpserver
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSandboxArgsRejectsReadsOutsideRoots(t *testing.T) {
+	root := t.TempDir()
+	repo := t.TempDir()
+	outside := t.TempDir()
+	cfg := newSandboxConfig(root+string(os.PathListSeparator)+repo, "")
+
+	inside := filepath.Join(root, "cpu.pprof")
+	if _, _, err := sandboxArgs(cfg, map[string]any{"profile": inside, "repo_root": repo}); err != nil {
+		t.Fatalf("expected paths inside roots to pass: %v", err)
+	}
+
+	_, _, err := sandboxArgs(cfg, map[string]any{"profile": filepath.Join(outside, "cpu.pprof")})
+	if err == nil || !strings.Contains(err.Error(), "outside the allowed roots") {
+		t.Fatalf("expected rejection, got %v", err)
+	}
+	if _, _, err := sandboxArgs(cfg, map[string]any{"profiles": []string{inside, "/etc/passwd"}}); err == nil {
+		t.Fatalf("expected rejection for path list entry outside roots")
+	}
+}
+
+func TestSandboxArgsRejectsCoverageOutsideRoots(t *testing.T) {
+	root := t.TempDir()
+	cfg := newSandboxConfig(root, "")
+
+	if _, _, err := sandboxArgs(cfg, map[string]any{"coverage": filepath.Join(root, "cover.out")}); err != nil {
+		t.Fatalf("expected a coverprofile inside roots to pass: %v", err)
+	}
+	_, _, err := sandboxArgs(cfg, map[string]any{"profile": filepath.Join(root, "cpu.pprof"), "coverage": "/etc/passwd"})
+	if err == nil || !strings.Contains(err.Error(), "outside the allowed roots") {
+		t.Fatalf("expected coverage outside roots to be rejected, got %v", err)
+	}
+}
+
+func TestSandboxArgsConfinesLoadFilesAndArtifactURLs(t *testing.T) {
+	root := t.TempDir()
+	cfg := newSandboxConfig(root, "")
+
+	inside := map[string]any{
+		"k6_script":      filepath.Join(root, "load.js"),
+		"vegeta_targets": filepath.Join(root, "targets.txt"),
+		"artifact_url":   "file://" + filepath.ToSlash(root) + "/bin/{service}/{build_id}",
+	}
+	if _, _, err := sandboxArgs(cfg, inside); err != nil {
+		t.Fatalf("expected load files and artifacts inside roots to pass: %v", err)
+	}
+	for _, args := range []map[string]any{
+		{"k6_script": "/etc/load.js"},
+		{"vegeta_targets": "/etc/targets.txt"},
+		{"artifact_url": "file:///etc/{binary}"},
+		{"artifact_url": "file://" + filepath.ToSlash(root) + "/../{binary}"},
+	} {
+		if _, _, err := sandboxArgs(cfg, args); err == nil || !strings.Contains(err.Error(), "outside the allowed roots") {
+			t.Fatalf("expected %v to be rejected, got %v", args, err)
+		}
+	}
+	if _, _, err := sandboxArgs(cfg, map[string]any{"artifact_url": "https://artifacts.example.com/{binary}"}); err != nil {
+		t.Fatalf("http artifact URLs are not paths: %v", err)
+	}
+}
+
+func TestSandboxArgsRejectsSymlinkEscape(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	link := filepath.Join(root, "link")
+	if err := os.Symlink(outside, link); err != nil {
+		t.Skipf("symlink not supported: %v", err)
+	}
+	cfg := newSandboxConfig(root, "")
+	if _, _, err := sandboxArgs(cfg, map[string]any{"binary": filepath.Join(link, "app")}); err == nil {
+		t.Fatalf("expected symlink escape to be rejected")
+	}
+}
+
+func TestSandboxArgsRewritesOutputsIntoWorkspace(t *testing.T) {
+	workspace := t.TempDir()
+	cfg := newSandboxConfig("", workspace)
+
+	args, rewrites, err := sandboxArgs(cfg, map[string]any{"output_path": "/tmp/elsewhere/flame.svg"})
+	if err != nil {
+		t.Fatalf("sandbox args: %v", err)
+	}
+	want := filepath.Join(cfg.workspace, "flame.svg")
+	if args["output_path"] != want {
+		t.Fatalf("expected output_path %q, got %v", want, args["output_path"])
+	}
+	if len(rewrites) != 1 || rewrites[0].From != "/tmp/elsewhere/flame.svg" || rewrites[0].To != want {
+		t.Fatalf("unexpected rewrites: %+v", rewrites)
+	}
+
+	noWorkspace := newSandboxConfig(workspace, "")
+	if _, _, err := sandboxArgs(noWorkspace, map[string]any{"output_path": "/tmp/elsewhere/flame.svg"}); err == nil {
+		t.Fatalf("expected output outside roots to be rejected without a workspace")
+	}
+}
+
+func TestSandboxDisabledWithoutRoots(t *testing.T) {
+	cfg := newSandboxConfig("", "")
+	args := map[string]any{"profile": "/anywhere/cpu.pprof"}
+	got, rewrites, err := sandboxArgs(cfg, args)
+	if err != nil || len(rewrites) != 0 || got["profile"] != "/anywhere/cpu.pprof" {
+		t.Fatalf("expected passthrough, got %v %v %v", got, rewrites, err)
+	}
+}
@@ -1,10 +1,15 @@
-package main
+package mcpserver
 
 import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
+
+	"github.com/arreyder/pprof-mcp/internal/pprof"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
 var pathArgKeys = map[string]bool{
@@ -18,6 +23,10 @@ var pathArgKeys = map[string]bool{
 	"before":            true,
 	"after":             true,
 	"baseline_path":     true,
+	"cpu_profile":       true,
+	"coverage":          true,
+	"k6_script":         true,
+	"vegeta_targets":    true,
 }
 
 var pathSliceArgKeys = map[string]bool{
@@ -35,7 +44,8 @@ func sanitizeArgs(args map[string]any) (map[string]any, error) {
 	}
 
 	cleaned := make(map[string]any, len(args))
-	for key, value := range args {
+	for _, key := range sortedKeys(args) {
+		value := args[key]
 		switch {
 		case pathArgKeys[key]:
 			str, ok := value.(string)
@@ -97,6 +107,19 @@ func sanitizeArgs(args map[string]any) (map[string]any, error) {
 				out = append(out, path)
 			}
 			cleaned[key] = out
+		case key == "artifact_url":
+			str, _ := value.(string)
+			if dir, ok := artifactFileDir(str); ok && baseDir != "" {
+				if _, err := sanitizePath(baseDir, dir); err != nil {
+					return nil, &ValidationError{
+						Field:    key,
+						Message:  err.Error(),
+						Expected: fmt.Sprintf("file URL within base dir %q", baseDir),
+						Received: redactValue(key, str),
+					}
+				}
+			}
+			cleaned[key] = value
 		default:
 			cleaned[key] = value
 		}
@@ -183,10 +206,54 @@ func resolvePathReal(path string) (string, error) {
 		if !os.IsNotExist(statErr) {
 			return "", statErr
 		}
-		if current == string(filepath.Separator) {
+		// The root is its own parent: / here, or a volume such as C:\ on
+		// Windows.
+		parent := filepath.Dir(current)
+		if parent == current {
 			return "", fmt.Errorf("path %q has no existing parent", path)
 		}
 		missing = append(missing, filepath.Base(current))
-		current = filepath.Dir(current)
+		current = parent
+	}
+}
+
+// annotateProfileLimits records in the result _meta which of the call's
+// profiles were over the size or sample limit and read downsampled.
+func annotateProfileLimits(res *mcp.CallToolResult, args map[string]any) {
+	if res == nil {
+		return
+	}
+	var paths []string
+	for key, value := range args {
+		switch {
+		case pathArgKeys[key]:
+			if path, ok := value.(string); ok {
+				paths = append(paths, path)
+			}
+		case pathSliceArgKeys[key]:
+			items, ok := sliceValue(value)
+			if !ok {
+				// pprof.cross_correlate and hotspot_summary take profiles by kind.
+				if byKind, isMap := value.(map[string]any); isMap {
+					for _, item := range byKind {
+						items = append(items, item)
+					}
+				}
+			}
+			for _, item := range items {
+				if path, ok := item.(string); ok {
+					paths = append(paths, path)
+				}
+			}
+		}
+	}
+	warnings := pprof.ProfileLimitWarnings(paths...)
+	if len(warnings) == 0 {
+		return
+	}
+	sort.Strings(warnings)
+	if res.Meta == nil {
+		res.Meta = mcp.Meta{}
 	}
+	res.Meta["downsampled"] = slices.Compact(warnings)
 }
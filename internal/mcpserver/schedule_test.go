@@ -0,0 +1,157 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/arreyder/pprof-mcp/internal/d2"
+)
+
+func TestScheduleTrendsFromStoredRecord(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PPROF_MCP_SCHEDULE_DIR", dir)
+
+	exited := exec.Command("true")
+	if err := exited.Run(); err != nil {
+		t.Skipf("cannot start a process: %v", err)
+	}
+	// A schedule left running by a server that has since exited: api's heap
+	// climbs every round, worker stays flat.
+	started := time.Now().UTC().Add(-time.Hour)
+	schedule := d2.Schedule{
+		ID:        "5c4ed01e00000001",
+		Params:    d2.ScheduleParams{Services: []string{"api", "worker"}, DevEnv: d2.DevEnvTilt, Interval: 10 * time.Minute, Seconds: 30, Duration: 24 * time.Hour, OutDir: dir},
+		Status:    d2.ScheduleRunning,
+		PID:       exited.Process.Pid,
+		StartedAt: started,
+		Rounds:    5,
+	}
+	for round := 1; round <= 5; round++ {
+		at := started.Add(time.Duration(round-1) * 10 * time.Minute)
+		schedule.Captures = append(schedule.Captures,
+			d2.ScheduleCapture{Service: "api", Round: round, At: at, HeapInuse: float64(100<<20 + round*(10<<20)), Goroutines: 200, CPUSeconds: 3},
+			d2.ScheduleCapture{Service: "worker", Round: round, At: at, HeapInuse: 50 << 20, Goroutines: 40, CPUSeconds: 1},
+		)
+	}
+	schedule.Captures = append(schedule.Captures, d2.ScheduleCapture{Service: "worker", Round: 6, At: started.Add(time.Hour), Error: "pod not found"})
+	data, err := json.Marshal(schedule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, schedule.ID+".json"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := d2ScheduleListTool(context.Background(), map[string]any{})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	schedules := out.(ToolOutput).Structured.(map[string]any)["schedules"].([]map[string]any)
+	if len(schedules) != 1 || schedules[0]["status"] != d2.ScheduleInterrupted || schedules[0]["failed_captures"] != 1 {
+		t.Fatalf("unexpected schedules: %v", schedules)
+	}
+	if growing := schedules[0]["growing"].([]string); len(growing) != 1 || growing[0] != "api: heap_inuse_bytes" {
+		t.Fatalf("expected only api heap growing, got %v", growing)
+	}
+
+	out, err = d2ScheduleShowTool(context.Background(), map[string]any{"schedule_id": "5c4e", "captures": 2})
+	if err != nil {
+		t.Fatalf("show: %v", err)
+	}
+	shown := out.(ToolOutput).Structured.(map[string]any)
+	trends := shown["trends"].([]d2.ScheduleTrend)
+	if len(trends) != 2 || trends[0].Service != "api" || trends[1].Captures != 5 {
+		t.Fatalf("unexpected trends: %+v", trends)
+	}
+	heap := trends[0].Metrics[0]
+	if heap.Metric != "heap_inuse_bytes" || !heap.Growing || heap.Rising != 1 || heap.PerHour <= 0 {
+		t.Fatalf("unexpected heap trend: %+v", heap)
+	}
+	if captures := shown["captures"].([]d2.ScheduleCapture); len(captures) != 2 || shown["captures_total"] != 11 {
+		t.Fatalf("expected the latest 2 of 11 captures, got %d of %v", len(captures), shown["captures_total"])
+	}
+
+	out, err = d2ScheduleStopTool(context.Background(), map[string]any{"schedule_id": schedule.ID})
+	if err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if stopped := out.(ToolOutput).Structured.(map[string]any); stopped["status"] != d2.ScheduleStopped {
+		t.Fatalf("expected stopped, got %v", stopped["status"])
+	}
+	if _, err := d2ScheduleStopTool(context.Background(), map[string]any{"schedule_id": schedule.ID}); err == nil || !strings.Contains(err.Error(), "not running") {
+		t.Fatalf("stopping twice should fail, got %v", err)
+	}
+}
+
+func TestScheduleStartAndStop(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PPROF_MCP_SCHEDULE_DIR", dir)
+
+	if _, err := d2ScheduleStartTool(context.Background(), map[string]any{"services": []any{"api"}, "interval": 35}); err == nil || !strings.Contains(err.Error(), "no room") {
+		t.Fatalf("expected an interval shorter than the CPU profile to fail, got %v", err)
+	}
+
+	// Captures fail without a dev environment; the schedule keeps running
+	// until stopped.
+	out, err := d2ScheduleStartTool(context.Background(), map[string]any{"services": "api", "dev_env": "compose", "interval": 60, "seconds": 5})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	started := out.(ToolOutput).Structured.(map[string]any)
+	if started["status"] != d2.ScheduleRunning || started["dev_env"] != d2.DevEnvCompose || started["duration_seconds"] != 86400 {
+		t.Fatalf("unexpected schedule: %v", started)
+	}
+	id := started["id"].(string)
+	if _, err := os.Stat(filepath.Join(dir, id+".json")); err != nil {
+		t.Fatalf("schedule not persisted: %v", err)
+	}
+
+	out, err = d2ScheduleStopTool(context.Background(), map[string]any{"schedule_id": id})
+	if err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if stopped := out.(ToolOutput).Structured.(map[string]any); stopped["status"] != d2.ScheduleStopped {
+		t.Fatalf("expected stopped, got %v", stopped)
+	}
+	schedule, err := d2.GetSchedule(id)
+	if err != nil || schedule.Status != d2.ScheduleStopped || schedule.FinishedAt == nil {
+		t.Fatalf("stop not recorded: %+v, %v", schedule, err)
+	}
+}
+
+func TestScheduleDryRun(t *testing.T) {
+	session := connectTestSession(t)
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "d2.schedule.start",
+		Arguments: map[string]any{"services": []any{"api", "worker"}, "dev_env": "skaffold", "interval": 120, "count": 6, "out_dir": "soak", "dry_run": true},
+	})
+	if err != nil {
+		t.Fatalf("call tool: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("unexpected tool error: %+v", res.Content)
+	}
+	structured := res.StructuredContent.(map[string]any)
+	commands, _ := structured["commands"].([]any)
+	joined := ""
+	for _, command := range commands {
+		joined += command.(string) + "\n"
+	}
+	for _, want := range []string{"-l app=api", "-l app=worker", filepath.Join("soak", "worker", "<timestamp>")} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("dry run commands missing %q:\n%s", want, joined)
+		}
+	}
+	notes, _ := structured["notes"].([]any)
+	if len(notes) == 0 || !strings.Contains(notes[0].(string), "every 2m0s, 6 times (Skaffold)") {
+		t.Fatalf("unexpected notes: %v", notes)
+	}
+}
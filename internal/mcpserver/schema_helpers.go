@@ -1,4 +1,4 @@
-package main
+package mcpserver
 
 func NewObjectSchema(props map[string]any, required ...string) map[string]any {
 	schema := map[string]any{
@@ -93,6 +93,10 @@ func floatPtr(v float64) *float64 {
 	return &v
 }
 
+func boolPtr(v bool) *bool {
+	return &v
+}
+
 func ProfilePath() map[string]any {
 	return prop("string", "Path to the pprof profile file (required). Accepts handle IDs like handle:abc123 from profiles.download_latest_bundle.")
 }
@@ -0,0 +1,194 @@
+package mcpserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	httppprof "net/http/pprof"
+	"os"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/pprof"
+	"github.com/arreyder/pprof-mcp/internal/profiles"
+	"github.com/arreyder/pprof-mcp/internal/tempfiles"
+)
+
+const (
+	defaultSelfProfileSeconds = 10
+	maxSelfProfileSeconds     = 120
+	defaultSelfProfileRows    = 20
+)
+
+// selfProfileTypes are the profiles server.self_profile captures. cpu, mutex,
+// and block are recorded over a window; the rest are snapshots.
+var selfProfileTypes = []string{"cpu", "heap", "allocs", "goroutine", "mutex", "block"}
+
+// selfProfileMu allows one capture at a time: the runtime has one CPU
+// profiler, and the mutex and block rates are process-wide.
+var selfProfileMu sync.Mutex
+
+// debugPprofEnabled reports whether HTTP mode serves /debug/pprof/. It is
+// off unless PPROF_MCP_HTTP_PPROF is on, 1, or true: the endpoints let any
+// client read the command line and profile the process.
+func debugPprofEnabled() bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("PPROF_MCP_HTTP_PPROF"))) {
+	case "on", "1", "true":
+		return true
+	}
+	return false
+}
+
+// handleDebugPprof serves the net/http/pprof endpoints on mux, so the server
+// can be profiled with `go tool pprof http://<addr>/debug/pprof/profile`.
+func handleDebugPprof(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", httppprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", httppprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", httppprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", httppprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", httppprof.Trace)
+}
+
+func serverSelfProfileTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	kind := strings.ToLower(firstNonEmpty(getString(args, "type"), "cpu"))
+	if !slices.Contains(selfProfileTypes, kind) {
+		return nil, fmt.Errorf("unsupported type %q (expected one of %s)", kind, strings.Join(selfProfileTypes, ", "))
+	}
+	seconds := getInt(args, "seconds", defaultSelfProfileSeconds)
+	if seconds <= 0 || seconds > maxSelfProfileSeconds {
+		return nil, fmt.Errorf("seconds must be between 1 and %d", maxSelfProfileSeconds)
+	}
+	windowed := kind == "cpu" || kind == "mutex" || kind == "block"
+
+	if !selfProfileMu.TryLock() {
+		return nil, fmt.Errorf("another server.self_profile capture is running; retry when it finishes")
+	}
+	defer selfProfileMu.Unlock()
+
+	tmp, file, err := tempfiles.CreateTemp(firstNonEmpty(getString(args, "out_dir"), sandbox().workspace), "pprof-mcp-self-"+kind+"-*.pprof")
+	if err != nil {
+		return nil, fmt.Errorf("creating the profile file: %w", err)
+	}
+	defer tmp.Remove()
+
+	captureErr := captureSelfProfile(ctx, file, kind, time.Duration(seconds)*time.Second)
+	if closeErr := file.Close(); captureErr == nil {
+		captureErr = closeErr
+	}
+	if captureErr != nil {
+		return nil, captureErr
+	}
+	info, err := os.Stat(tmp.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	sampleIndex := getString(args, "sample_index")
+	top, err := pprof.RunTop(ctx, pprof.TopParams{
+		Profile:     tmp.Path,
+		NodeCount:   getInt(args, "nodecount", defaultSelfProfileRows),
+		SampleIndex: sampleIndex,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("analyzing the %s profile: %w", kind, err)
+	}
+	pprof.AddTopHints(&top, tmp.Path, sampleIndex)
+
+	handle, err := profileRegistry.Register(profiles.Metadata{
+		Service:   "pprof-mcp",
+		Type:      kind,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Path:      tmp.Path,
+		Bytes:     info.Size(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to register profile handle: %w", err)
+	}
+	tmp.Keep()
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	payload := map[string]any{
+		"command":     "server.self_profile",
+		"type":        kind,
+		"pid":         os.Getpid(),
+		"path":        tmp.Path,
+		"handle":      handle,
+		"bytes":       info.Size(),
+		"pprof":       top.Command,
+		"rows":        top.Rows,
+		"top_summary": top.Summary,
+		"runtime": map[string]any{
+			"goroutines":       runtime.NumGoroutine(),
+			"heap_alloc_bytes": mem.HeapAlloc,
+			"heap_sys_bytes":   mem.HeapSys,
+			"num_gc":           mem.NumGC,
+			"gc_pause_seconds": time.Duration(mem.PauseTotalNs).Seconds(),
+		},
+	}
+	if windowed {
+		payload["seconds"] = seconds
+	}
+	if len(top.Hints) > 0 {
+		payload["hints"] = top.Hints
+	}
+	summary := fmt.Sprintf("Captured the server's %s profile (%d bytes) as %s", kind, info.Size(), handle)
+	if len(top.Rows) > 0 {
+		summary += fmt.Sprintf("; top: %s (%s flat)", top.Rows[0].Name, top.Rows[0].FlatPct)
+	}
+	return marshalJSONWithSummary(summary, payload)
+}
+
+// captureSelfProfile writes this process's profile of kind to file. Windowed
+// profiles record for d; a call cancelled before then fails.
+func captureSelfProfile(ctx context.Context, file *os.File, kind string, d time.Duration) error {
+	switch kind {
+	case "cpu":
+		if err := runtimepprof.StartCPUProfile(file); err != nil {
+			return fmt.Errorf("starting the CPU profile (is /debug/pprof/profile running?): %w", err)
+		}
+		err := waitSelfProfile(ctx, d)
+		runtimepprof.StopCPUProfile()
+		return err
+	case "mutex":
+		// Sampling is off by default; record every contention in the window.
+		previous := runtime.SetMutexProfileFraction(1)
+		err := waitSelfProfile(ctx, d)
+		runtime.SetMutexProfileFraction(previous)
+		if err != nil {
+			return err
+		}
+	case "block":
+		// The rate cannot be read back, and the server never sets it, so it
+		// is turned off again after the window.
+		runtime.SetBlockProfileRate(1)
+		err := waitSelfProfile(ctx, d)
+		runtime.SetBlockProfileRate(0)
+		if err != nil {
+			return err
+		}
+	case "heap", "allocs":
+		// The heap profile reflects the last GC; run one so it is current.
+		runtime.GC()
+	}
+	profile := runtimepprof.Lookup(kind)
+	if profile == nil {
+		return fmt.Errorf("no %s profile in this runtime", kind)
+	}
+	return profile.WriteTo(file, 0)
+}
+
+func waitSelfProfile(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
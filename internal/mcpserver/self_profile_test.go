@@ -0,0 +1,90 @@
+package mcpserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestServerSelfProfileCapturesAndAnalyzes(t *testing.T) {
+	t.Setenv("PPROF_MCP_TEMP_REGISTRY", t.TempDir())
+	outDir := t.TempDir()
+
+	session := connectTestSession(t)
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "server.self_profile",
+		Arguments: map[string]any{"type": "goroutine", "out_dir": outDir, "nodecount": 5},
+	})
+	if err != nil {
+		t.Fatalf("call tool: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("unexpected error: %v", res.Content)
+	}
+	payload := res.StructuredContent.(map[string]any)
+	path, _ := payload["path"].(string)
+	if filepath.Dir(path) != outDir || !strings.HasPrefix(filepath.Base(path), "pprof-mcp-self-goroutine-") {
+		t.Fatalf("unexpected path %q", path)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("profile not kept: %v", err)
+	}
+	if handle, _ := payload["handle"].(string); !isHandle(handle) {
+		t.Fatalf("expected a profile handle, got %v", payload["handle"])
+	}
+	if rows, _ := payload["rows"].([]any); len(rows) == 0 {
+		t.Fatalf("expected top rows, got %v", payload)
+	}
+	if _, ok := payload["seconds"]; ok {
+		t.Fatalf("snapshot profiles have no window: %v", payload)
+	}
+	stats := payload["runtime"].(map[string]any)
+	if stats["goroutines"].(float64) < 1 {
+		t.Fatalf("unexpected runtime stats: %v", stats)
+	}
+}
+
+func TestServerSelfProfileRejectsBadArgs(t *testing.T) {
+	for _, args := range []map[string]any{
+		{"type": "threadcreate"},
+		{"type": "cpu", "seconds": 0},
+	} {
+		if _, err := serverSelfProfileTool(context.Background(), args); err == nil {
+			t.Fatalf("expected an error for %v", args)
+		}
+	}
+}
+
+func TestHTTPDebugPprofEndpoints(t *testing.T) {
+	server, err := newServer(toolNameModeDefault)
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	for _, tc := range []struct {
+		env  string
+		want int
+	}{
+		{"", http.StatusNotFound},
+		{"off", http.StatusNotFound},
+		{"on", http.StatusOK},
+		{"TRUE", http.StatusOK},
+	} {
+		t.Setenv("PPROF_MCP_HTTP_PPROF", tc.env)
+		httpServer := httptest.NewServer(newHTTPMux(server))
+		resp, err := http.Get(httpServer.URL + "/debug/pprof/goroutine?debug=1")
+		if err != nil {
+			t.Fatalf("debug/pprof: %v", err)
+		}
+		resp.Body.Close()
+		httpServer.Close()
+		if resp.StatusCode != tc.want {
+			t.Fatalf("PPROF_MCP_HTTP_PPROF=%q: status = %d, want %d", tc.env, resp.StatusCode, tc.want)
+		}
+	}
+}
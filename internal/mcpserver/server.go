@@ -0,0 +1,3277 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/arreyder/pprof-mcp/internal/baseline"
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+	"github.com/arreyder/pprof-mcp/internal/completion"
+	"github.com/arreyder/pprof-mcp/internal/d2"
+	"github.com/arreyder/pprof-mcp/internal/datadog"
+	"github.com/arreyder/pprof-mcp/internal/incident"
+	"github.com/arreyder/pprof-mcp/internal/k8s"
+	"github.com/arreyder/pprof-mcp/internal/pprof"
+	"github.com/arreyder/pprof-mcp/internal/profiles"
+	"github.com/arreyder/pprof-mcp/internal/services"
+	"github.com/arreyder/pprof-mcp/internal/tempfiles"
+)
+
+// Options configure Run. Zero values fall back to the PPROF_MCP_*
+// environment variables.
+type Options struct {
+	// NameMode is the tool name mode: "default" or "codex".
+	NameMode string
+	// HTTPAddr serves streamable HTTP on this address instead of stdio.
+	HTTPAddr string
+	// Framing is the stdio framing: auto, newline, or content-length.
+	Framing string
+}
+
+// Run loads the config and policy files and serves MCP until ctx is done or
+// the client disconnects. Both pprof-mcp-server and profctl serve use it.
+func Run(ctx context.Context, opts Options) error {
+	framing, err := parseFraming(firstNonEmpty(opts.Framing, os.Getenv("PPROF_MCP_STDIO_FRAMING")))
+	if err != nil {
+		return fmt.Errorf("invalid framing: %w", err)
+	}
+
+	nameMode := toolNameModeFromEnv()
+	if strings.TrimSpace(opts.NameMode) != "" {
+		nameMode = toolNameModeFromString(strings.ToLower(strings.TrimSpace(opts.NameMode)))
+	}
+	if err := loadServerConfig(); err != nil {
+		return fmt.Errorf("config error: %w", err)
+	}
+	if err := loadPolicyFromEnv(); err != nil {
+		return fmt.Errorf("policy error: %w", err)
+	}
+	if err := profileRegistry.Persist(profiles.StorePath()); err != nil {
+		log.Printf("profile handles will not be shared with profctl: %v", err)
+	}
+	s, tools, err := buildServer(nameMode)
+	if err != nil {
+		return fmt.Errorf("tool registry error: %w", err)
+	}
+	go watchConfiguration(ctx, tools)
+	go logPprofTool(ctx)
+	go sweepTempFiles(ctx)
+	// Runs after a signal cancels ctx, and with it the calls in flight.
+	defer tempfiles.Cleanup()
+
+	if addr := strings.TrimSpace(firstNonEmpty(opts.HTTPAddr, os.Getenv("PPROF_MCP_HTTP_ADDR"))); addr != "" {
+		if err := serveHTTP(ctx, s, addr); err != nil {
+			return fmt.Errorf("serving MCP over HTTP: %w", err)
+		}
+		return nil
+	}
+
+	log.Printf("Starting pprof MCP server over stdio (framing: %s)", framing)
+	transport := newStdioTransport(framing, nopCloser{os.Stdin}, nopCloser{os.Stdout})
+	if err := s.Run(ctx, transport); err != nil {
+		return fmt.Errorf("serving MCP: %w", err)
+	}
+	return nil
+}
+
+func newServer(nameMode toolNameMode) (*mcp.Server, error) {
+	s, _, err := buildServer(nameMode)
+	return s, err
+}
+
+// buildServer creates the server and returns the tool set that configuration
+// reloads use to enable or disable tools.
+func buildServer(nameMode toolNameMode) (*mcp.Server, *toolSet, error) {
+	s := mcp.NewServer(&mcp.Implementation{
+		Name:    serverName,
+		Title:   "pprof MCP",
+		Version: serverVersion,
+	}, &mcp.ServerOptions{
+		Instructions:      "Profiling tools for Datadog profile download and deterministic pprof analysis.",
+		CompletionHandler: completeArgument,
+	})
+	tools, err := registerTools(s, nameMode)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, tools, nil
+}
+
+// registerTools adds every tool definition not disabled by the active policy
+// to the server, plus the deprecated aliases of renamed tools. Output schemas
+// are passed through to mcp.AddTool so they are advertised in tools/list and
+// the structured payload of each result is validated and sent as
+// structuredContent.
+func registerTools(s *mcp.Server, nameMode toolNameMode) (*toolSet, error) {
+	registry := NewToolRegistry()
+	if err := registry.AddAll(ToolSchemas()); err != nil {
+		return nil, err
+	}
+	for _, alias := range toolAliases {
+		if err := registry.AddAlias(alias); err != nil {
+			return nil, err
+		}
+	}
+	tools := newToolSet(s)
+	for _, def := range registry.List() {
+		tool := *def.Tool
+		canonicalName := def.Tool.Name
+		tool.Name = toolNameForMode(canonicalName, nameMode)
+		if nameMode == toolNameModeCodex {
+			tool.Description = fmt.Sprintf("Codex tool name: %s\n\n%s", tool.Name, tool.Description)
+		}
+		handler := toolCallHandler(def, &tool, canonicalName)
+		tools.add(canonicalName, tool.Name, []string{canonicalName}, func() { mcp.AddTool(s, &tool, handler) })
+	}
+	for _, alias := range registry.Aliases() {
+		def, _ := registry.Get(alias.New)
+		tool := aliasTool(*def.Tool, alias, nameMode)
+		base := toolCallHandler(def, &tool, alias.New)
+		handler := func(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+			res, out, err := base(ctx, req, args)
+			annotateDeprecation(res, alias, nameMode)
+			return res, out, err
+		}
+		tools.add(alias.Old, tool.Name, []string{alias.Old, alias.New}, func() { mcp.AddTool(s, &tool, handler) })
+	}
+	tools.sync(currentPolicy())
+	return tools, nil
+}
+
+// toolCallHandler wraps a tool handler with metrics, config defaults, policy,
+// rate limiting, the worker pool, validation, and redaction. canonicalName is
+// the current name of the tool, even when tool is a deprecated alias.
+func toolCallHandler(def ToolDefinition, tool *mcp.Tool, canonicalName string) mcp.ToolHandlerFor[map[string]any, any] {
+	return func(ctx context.Context, req *mcp.CallToolRequest, args map[string]any) (*mcp.CallToolResult, any, error) {
+		done := toolMetrics.Start(canonicalName)
+		args = applyConfigDefaults(currentConfig(), tool, args)
+		if denial := currentPolicy().Check(canonicalName, args); denial != nil {
+			res := policyDeniedResult(tool.Name, denial)
+			done(res)
+			return res, nil, nil
+		}
+		if limitErr := checkClientRateLimit(req, canonicalName); limitErr != nil {
+			res := rateLimitResult(tool.Name, limitErr)
+			done(res)
+			return res, nil, nil
+		}
+		release, stats, err := acquireToolSlot(ctx, req, canonicalName)
+		if err != nil {
+			res := ErrorResult(err, "Canceled while waiting for a worker slot; raise PPROF_MCP_MAX_CONCURRENT_TOOLS or retry.")
+			done(res)
+			return res, nil, nil
+		}
+		defer release()
+		res, out, err := invokeTool(ctx, tool, canonicalName, def.Handler, args)
+		res, out = currentRedactor().Result(res, out)
+		annotateQueueStats(res, stats)
+		done(res)
+		return res, out, err
+	}
+}
+
+func invokeTool(ctx context.Context, tool *mcp.Tool, canonicalName string, handler ToolHandler, args map[string]any) (*mcp.CallToolResult, any, error) {
+	if err := ValidateArgsWithName(tool, canonicalName, args); err != nil {
+		return ErrorResult(err, ""), nil, nil
+	}
+
+	cleanedArgs, err := sanitizeArgs(args)
+	if err != nil {
+		return ErrorResult(err, "Provide paths within PPROF_MCP_BASEDIR if it is set."), nil, nil
+	}
+	cleanedArgs, rewrites, err := sandboxArgs(sandbox(), cleanedArgs)
+	if err != nil {
+		return ErrorResult(err, ""), nil, nil
+	}
+	sampleIndex, err := resolveSampleIndexArg(tool, canonicalName, cleanedArgs)
+	if err != nil {
+		return ErrorResult(err, ""), nil, nil
+	}
+
+	ctx, commands := cmdrun.WithLog(ctx)
+	res, out, err := runTool(ctx, tool, canonicalName, handler, cleanedArgs)
+	annotatePathRewrites(res, rewrites)
+	annotateSampleIndex(res, sampleIndex)
+	annotateProfileLimits(res, cleanedArgs)
+	annotateCommands(res, commands)
+	return res, out, err
+}
+
+// runTool executes the handler under its timeout and converts its return
+// value into a tool result.
+func runTool(ctx context.Context, tool *mcp.Tool, canonicalName string, handler ToolHandler, cleanedArgs map[string]any) (*mcp.CallToolResult, any, error) {
+	timeout := timeoutForTool(toolTimeouts(), canonicalName, cleanedArgs)
+	result, err := runWithTimeout(ctx, timeout, handler, cleanedArgs)
+	if err != nil {
+		if isToolTimeout(ctx, err) {
+			return timeoutResult(tool.Name, timeout, err), nil, nil
+		}
+		if errors.Is(err, pprof.ErrNoMatches) {
+			return noMatchesResult(tool.Name, cleanedArgs, err), nil, nil
+		}
+		return ErrorResult(err, ""), nil, nil
+	}
+
+	switch v := result.(type) {
+	case ToolOutput:
+		res := TextResult(v.Text)
+		if v.Structured != nil {
+			return res, v.Structured, nil
+		}
+		return res, nil, nil
+	case *ToolOutput:
+		res := TextResult(v.Text)
+		if v.Structured != nil {
+			return res, v.Structured, nil
+		}
+		return res, nil, nil
+	case string:
+		return TextResult(v), nil, nil
+	case []mcp.Content:
+		return &mcp.CallToolResult{Content: v}, nil, nil
+	case mcp.Content:
+		return &mcp.CallToolResult{Content: []mcp.Content{v}}, nil, nil
+	default:
+		return formatUnexpectedResult(v), nil, nil
+	}
+}
+
+func noMatchesResult(toolName string, args map[string]any, err error) *mcp.CallToolResult {
+	hint := "Try a broader regex (e.g., (?i)GetLimits), or use pprof.top with focus to find the exact function name."
+	pattern := firstNonEmpty(
+		getString(args, "regex"),
+		getString(args, "function"),
+		getString(args, "focus"),
+		getString(args, "tag_focus"),
+		getString(args, "tag_show"),
+	)
+	msg := "No matching symbols found."
+	if err != nil && strings.TrimSpace(err.Error()) != "" {
+		msg = strings.TrimSpace(err.Error())
+	}
+
+	payload := map[string]any{
+		"matched": false,
+		"reason":  "no_matches",
+		"tool":    toolName,
+		"hint":    hint,
+	}
+	if pattern != "" {
+		payload["pattern"] = pattern
+	}
+
+	return &mcp.CallToolResult{
+		Content:           []mcp.Content{&mcp.TextContent{Text: msg + "\nHint: " + hint}},
+		StructuredContent: payload,
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func profilesDownloadAutoTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	// Detect environment
+	isD2 := d2.IsD2Environment()
+
+	if isD2 {
+		// D2 mode - use local kubectl download
+		service := getString(args, "service")
+		outDir, incidentID := incident.ResolveOutDir(getString(args, "out_dir"))
+		if outDir == "" {
+			return nil, fmt.Errorf("out_dir is required (no incident context active)")
+		}
+		_ = incidentID // Used in result payload below
+		seconds := getInt(args, "seconds", 30)
+
+		if getBool(args, "dry_run") {
+			plan, err := d2.DownloadCommands(d2.DownloadParams{Service: service, Namespace: getString(args, "namespace"), KubeContext: getString(args, "kube_context"), OutDir: outDir, Seconds: seconds})
+			if err != nil {
+				return nil, err
+			}
+			payload := dryRunPayload(plan)
+			payload["mode"] = "d2"
+			return marshalJSON(payload)
+		}
+
+		result, err := d2.DownloadProfiles(ctx, d2.DownloadParams{
+			Service:     service,
+			Namespace:   getString(args, "namespace"),
+			KubeContext: getString(args, "kube_context"),
+			OutDir:      outDir,
+			Seconds:     seconds,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("d2 download failed: %w", err)
+		}
+
+		// Register profile handles
+		timestamp := time.Now().UTC().Format(time.RFC3339)
+		handles := []map[string]any{}
+		for _, file := range result.Files {
+			handle, err := profileRegistry.Register(profiles.Metadata{
+				Service:   result.Service,
+				Env:       "d2",
+				Type:      file.Type,
+				Timestamp: timestamp,
+				Path:      file.Path,
+				Bytes:     file.Bytes,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to register profile handle: %w", err)
+			}
+			handles = append(handles, map[string]any{
+				"type":   file.Type,
+				"handle": handle,
+				"bytes":  file.Bytes,
+			})
+		}
+
+		resultPayload := map[string]any{
+			"service":   result.Service,
+			"namespace": result.Namespace,
+			"pod_name":  result.PodName,
+			"pod_ip":    result.PodIP,
+			"files":     handles,
+		}
+		if result.PodHealth != nil {
+			resultPayload["pod_health"] = result.PodHealth
+		}
+		if len(result.Warnings) > 0 {
+			resultPayload["warnings"] = result.Warnings
+		}
+
+		payload := map[string]any{
+			"command": fmt.Sprintf("kubectl port-forward -n %s %s 1337:1337 (d2 mode)", result.Namespace, result.PodName),
+			"mode":    "d2",
+			"result":  resultPayload,
+		}
+		if incidentID != "" {
+			payload["incident_id"] = incidentID
+		}
+		return marshalJSON(payload)
+	}
+
+	// Datadog mode - use Datadog API
+	service := getString(args, "service")
+	env := getString(args, "env")
+	if env == "" {
+		return nil, fmt.Errorf("env parameter required for Datadog mode (not in d2 environment)")
+	}
+	outDir, incidentID := incident.ResolveOutDir(getString(args, "out_dir"))
+	if outDir == "" {
+		return nil, fmt.Errorf("out_dir is required (no incident context active)")
+	}
+	hours := getInt(args, "hours", 72)
+	site := getString(args, "dd_site")
+	if site == "" {
+		site = getString(args, "site")
+	}
+	profileID := getString(args, "profile_id")
+	eventID := getString(args, "event_id")
+	host := getString(args, "host")
+
+	result, err := datadog.DownloadLatestBundle(ctx, datadog.DownloadParams{
+		Service:   service,
+		Env:       env,
+		OutDir:    outDir,
+		Site:      site,
+		Hours:     hours,
+		ProfileID: profileID,
+		EventID:   eventID,
+		Host:      host,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("datadog download failed: %w", err)
+	}
+
+	bundle, err := registerBundleHandles(result)
+	if err != nil {
+		return nil, err
+	}
+
+	resultPayload := map[string]any{
+		"service":    result.Service,
+		"env":        result.Env,
+		"dd_site":    result.DDSite,
+		"from_ts":    result.FromTS,
+		"to_ts":      result.ToTS,
+		"profile_id": result.ProfileID,
+		"event_id":   result.EventID,
+		"timestamp":  result.Timestamp,
+		"files":      bundle.Handles,
+	}
+	if result.MetricsPath != "" {
+		resultPayload["metrics_path"] = result.MetricsPath
+	}
+	if len(result.Warnings) > 0 {
+		resultPayload["warnings"] = result.Warnings
+	}
+
+	payload := map[string]any{
+		"command": fmt.Sprintf("%s (datadog mode)", buildDownloadCommand(service, env, outDir, hours, site, profileID, eventID, host)),
+		"mode":    "datadog",
+		"result":  resultPayload,
+	}
+	if incidentID != "" {
+		payload["incident_id"] = incidentID
+	}
+	return marshalJSON(payload)
+}
+
+func downloadTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	service := getString(args, "service")
+	env := getString(args, "env")
+	outDir, incidentID := incident.ResolveOutDir(getString(args, "out_dir"))
+	if outDir == "" {
+		return nil, fmt.Errorf("out_dir is required (no incident context active)")
+	}
+	hours := getInt(args, "hours", 72)
+	site := getString(args, "dd_site")
+	if site == "" {
+		site = getString(args, "site")
+	}
+	host := getString(args, "host")
+	profileID := getString(args, "profile_id")
+	eventID := getString(args, "event_id")
+
+	result, err := datadog.DownloadLatestBundle(ctx, datadog.DownloadParams{
+		Service:   service,
+		Env:       env,
+		OutDir:    outDir,
+		Site:      site,
+		Hours:     hours,
+		Host:      host,
+		ProfileID: profileID,
+		EventID:   eventID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	bundle, err := registerBundleHandles(result)
+	if err != nil {
+		return nil, err
+	}
+
+	resultPayload := map[string]any{
+		"service":    result.Service,
+		"env":        result.Env,
+		"dd_site":    result.DDSite,
+		"from_ts":    result.FromTS,
+		"to_ts":      result.ToTS,
+		"profile_id": result.ProfileID,
+		"event_id":   result.EventID,
+		"timestamp":  result.Timestamp,
+		"files":      bundle.Handles,
+	}
+	if result.MetricsPath != "" {
+		resultPayload["metrics_path"] = result.MetricsPath
+	}
+	if len(result.Warnings) > 0 {
+		resultPayload["warnings"] = result.Warnings
+	}
+
+	payload := map[string]any{
+		"command": buildDownloadCommand(service, env, outDir, hours, site, profileID, eventID, host),
+		"result":  resultPayload,
+	}
+	if incidentID != "" {
+		payload["incident_id"] = incidentID
+	}
+	return marshalJSON(payload)
+}
+
+func d2DownloadTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	service := getString(args, "service")
+	outDir, incidentID := incident.ResolveOutDir(getString(args, "out_dir"))
+	if outDir == "" {
+		return nil, fmt.Errorf("out_dir is required (no incident context active)")
+	}
+	params := d2.DownloadParams{
+		Service:     service,
+		Namespace:   getString(args, "namespace"),
+		KubeContext: getString(args, "kube_context"),
+		OutDir:      outDir,
+		Seconds:     getInt(args, "seconds", 30),
+		Target:      getString(args, "target"),
+		Port:        getInt(args, "port", 0),
+		Types:       parseStringList(args, "types"),
+		Rates: k8s.Rates{
+			Mutex: getInt(args, "mutex_rate", 0),
+			Block: getInt(args, "block_rate", 0),
+			Path:  getString(args, "rate_path"),
+		},
+	}
+	if params.Service == "" && params.Target == "" {
+		return nil, fmt.Errorf("service or target is required")
+	}
+
+	if getBool(args, "dry_run") {
+		plan, err := d2.DownloadCommands(params)
+		if err != nil {
+			return nil, err
+		}
+		return marshalJSON(dryRunPayload(plan))
+	}
+
+	result, err := d2.DownloadProfiles(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	// Register profile handles similar to datadog download
+	timestamp := time.Now().UTC().Format(time.RFC3339)
+	handles := []map[string]any{}
+	for _, file := range result.Files {
+		handle, err := profileRegistry.Register(profiles.Metadata{
+			Service:   result.Service,
+			Env:       "d2",
+			Type:      file.Type,
+			Timestamp: timestamp,
+			Path:      file.Path,
+			Bytes:     file.Bytes,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to register profile handle: %w", err)
+		}
+		handles = append(handles, map[string]any{
+			"type":   file.Type,
+			"handle": handle,
+			"bytes":  file.Bytes,
+		})
+	}
+
+	resultPayload := map[string]any{
+		"service":   result.Service,
+		"namespace": result.Namespace,
+		"pod_name":  result.PodName,
+		"pod_ip":    result.PodIP,
+		"files":     handles,
+	}
+	if result.PodHealth != nil {
+		resultPayload["pod_health"] = result.PodHealth
+	}
+	if len(result.Warnings) > 0 {
+		resultPayload["warnings"] = result.Warnings
+	}
+
+	remotePort := 4421
+	if params.Target != "" {
+		remotePort = result.Port
+	}
+	payload := map[string]any{
+		"command": d2.PortForwardCommand(params.KubeContext, result.Namespace, result.PodName, remotePort),
+		"result":  resultPayload,
+	}
+	if incidentID != "" {
+		payload["incident_id"] = incidentID
+	}
+	return marshalJSON(payload)
+}
+
+func k8sCaptureTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	outDir, incidentID := incident.ResolveOutDir(getString(args, "out_dir"))
+	if outDir == "" {
+		return nil, fmt.Errorf("out_dir is required (no incident context active)")
+	}
+	workload, selector, err := k8s.ParseTarget(getString(args, "target"))
+	if err != nil {
+		return nil, err
+	}
+	params := k8s.CaptureParams{
+		KubeContext: getString(args, "kube_context"),
+		Namespace:   getString(args, "namespace"),
+		Selector:    selector,
+		Workload:    workload,
+		Port:        getInt(args, "port", 0),
+		OutDir:      outDir,
+		Service:     getString(args, "service"),
+		Seconds:     getInt(args, "seconds", 30),
+		Types:       parseStringList(args, "types"),
+		MaxPods:     getInt(args, "max_pods", 0),
+		All:         getBool(args, "all"),
+		Parallel:    getInt(args, "parallel", 0),
+		Merge:       true,
+		PodTimeout:  time.Duration(getInt(args, "pod_timeout_seconds", 0)) * time.Second,
+		Strategy:    getString(args, "strategy"),
+		Node:        getString(args, "node"),
+	}
+	services.ApplyDeclaredPort(&params, getString(args, "repo_root"))
+	if value, ok := args["merge"].(bool); ok {
+		params.Merge = value
+	}
+	if _, ok := args["cgroup"]; ok {
+		params.SkipCgroup = !getBool(args, "cgroup")
+	}
+	switch getString(args, "usage_source") {
+	case "", "metrics-server":
+	case "datadog":
+		params.Usage = k8s.DatadogUsage(getString(args, "env"), firstNonEmpty(getString(args, "site"), getString(args, "dd_site")))
+	default:
+		return nil, fmt.Errorf("usage_source must be metrics-server or datadog")
+	}
+
+	if getBool(args, "dry_run") {
+		commands, err := k8s.CaptureCommands(params)
+		if err != nil {
+			return nil, err
+		}
+		service := params.Service
+		if service == "" && workload != "" {
+			service = k8s.WorkloadName(workload)
+		}
+		if service == "" {
+			service = k8s.ServiceFromSelector(selector, firstNonEmpty(params.Namespace, "default"))
+		}
+		command := "kubectl " + strings.Join(append(k8s.ContextArgs(params.KubeContext), "get", "pods", "-n", firstNonEmpty(params.Namespace, "default"), "-l", firstNonEmpty(selector, "<selector>")), " ")
+		return marshalJSON(dryRunPayload(d2.DryRunResult{Service: service, Command: command, Commands: commands}))
+	}
+
+	result, err := k8s.Capture(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := time.Now().UTC().Format(time.RFC3339)
+	service := ""
+	bundleHandles := map[string][]map[string]any{}
+	for _, bundle := range result.Bundles {
+		service = bundle.Service
+		handles := []map[string]any{}
+		for _, file := range bundle.Files {
+			handle, err := profileRegistry.Register(profiles.Metadata{
+				Service:   bundle.Service,
+				Env:       result.Namespace,
+				Type:      file.Type,
+				Timestamp: timestamp,
+				Path:      file.Path,
+				Bytes:     file.Bytes,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to register profile handle: %w", err)
+			}
+			handles = append(handles, map[string]any{"type": file.Type, "handle": handle, "bytes": file.Bytes})
+		}
+		bundleHandles[bundle.Pod] = handles
+	}
+	pods := []map[string]any{}
+	for _, status := range result.Pods {
+		pod := map[string]any{"pod": status.Pod, "status": status.Status, "duration_ms": status.DurationMS, "files": []map[string]any{}}
+		if status.Port > 0 {
+			pod["port"] = status.Port
+			pod["port_source"] = status.PortSource
+		}
+		if handles, ok := bundleHandles[status.Pod]; ok {
+			pod["files"] = handles
+		}
+		if status.Cgroup != nil {
+			pod["cgroup"] = status.Cgroup
+		}
+		if status.Error != "" {
+			pod["error"] = status.Error
+		}
+		if len(status.Warnings) > 0 {
+			pod["warnings"] = status.Warnings
+		}
+		pods = append(pods, pod)
+	}
+	fleet := []map[string]any{}
+	for _, merged := range result.Fleet {
+		handle, err := profileRegistry.Register(profiles.Metadata{
+			Service:   service,
+			Env:       result.Namespace,
+			Type:      merged.Type,
+			Timestamp: timestamp,
+			Path:      merged.Path,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to register fleet handle: %w", err)
+		}
+		fleet = append(fleet, map[string]any{
+			"type":          merged.Type,
+			"handle":        handle,
+			"pods":          merged.Pods,
+			"contributions": merged.Contributions,
+		})
+	}
+
+	resultPayload := map[string]any{
+		"service":   service,
+		"namespace": result.Namespace,
+		"selector":  result.Selector,
+		"selection": result.Selection,
+		"pods":      pods,
+		"fleet":     fleet,
+	}
+	if result.Workload != "" {
+		resultPayload["workload"] = result.Workload
+	}
+	if len(result.Failed) > 0 {
+		resultPayload["failed"] = result.Failed
+	}
+	if len(result.Warnings) > 0 {
+		resultPayload["warnings"] = result.Warnings
+	}
+	payload := map[string]any{
+		"command": "kubectl " + strings.Join(append(k8s.ContextArgs(result.KubeContext), "get", "pods", "-n", result.Namespace, "-l", result.Selector), " "),
+		"result":  resultPayload,
+	}
+	if incidentID != "" {
+		payload["incident_id"] = incidentID
+	}
+	return marshalJSON(payload)
+}
+
+func k8sCaptureJobTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	outDir, incidentID := incident.ResolveOutDir(getString(args, "out_dir"))
+	if outDir == "" {
+		return nil, fmt.Errorf("out_dir is required (no incident context active)")
+	}
+	workload, selector, err := k8s.ParseTarget(getString(args, "target"))
+	if err != nil {
+		return nil, err
+	}
+	params := k8s.JobParams{
+		CaptureParams: k8s.CaptureParams{
+			KubeContext: getString(args, "kube_context"),
+			Namespace:   getString(args, "namespace"),
+			Selector:    selector,
+			Workload:    workload,
+			Port:        getInt(args, "port", 0),
+			OutDir:      outDir,
+			Service:     getString(args, "service"),
+			Seconds:     getInt(args, "seconds", 30),
+			Types:       parseStringList(args, "types"),
+		},
+		Wait:            time.Duration(getInt(args, "wait_seconds", 0)) * time.Second,
+		At:              getFloat(args, "at", 0),
+		ExpectedRuntime: time.Duration(getInt(args, "expected_runtime_seconds", 0)) * time.Second,
+	}
+	services.ApplyDeclaredPort(&params.CaptureParams, getString(args, "repo_root"))
+	if _, ok := args["cgroup"]; ok {
+		params.SkipCgroup = !getBool(args, "cgroup")
+	}
+	namespace := firstNonEmpty(params.Namespace, "default")
+
+	if getBool(args, "dry_run") {
+		commands, err := k8s.JobCaptureCommands(params)
+		if err != nil {
+			return nil, err
+		}
+		service := firstNonEmpty(params.Service, k8s.WorkloadName(workload))
+		podSelector := "<selector>"
+		if strings.HasPrefix(workload, "job/") {
+			podSelector = "job-name=" + k8s.WorkloadName(workload)
+		}
+		command := "kubectl " + strings.Join(append(k8s.ContextArgs(params.KubeContext), "get", "pods", "-n", namespace, "-l", podSelector), " ")
+		notes := []string{"The pod list is polled until a pod is Running; nothing is captured if none starts within wait_seconds."}
+		return marshalJSON(dryRunPayload(d2.DryRunResult{Service: service, Command: command, Commands: commands, Notes: notes}))
+	}
+
+	result, err := k8s.CaptureJob(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	files := []map[string]any{}
+	service := firstNonEmpty(params.Service, k8s.WorkloadName(workload))
+	if result.Bundle != nil {
+		service = result.Bundle.Service
+		for _, file := range result.Bundle.Files {
+			handle, err := profileRegistry.Register(profiles.Metadata{
+				Service:   result.Bundle.Service,
+				Env:       result.Namespace,
+				Type:      file.Type,
+				Timestamp: result.Bundle.Timestamp,
+				Path:      file.Path,
+				Bytes:     file.Bytes,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to register profile handle: %w", err)
+			}
+			files = append(files, map[string]any{"type": file.Type, "handle": handle, "bytes": file.Bytes})
+		}
+	}
+	resultPayload := map[string]any{
+		"service":         service,
+		"namespace":       result.Namespace,
+		"workload":        result.Workload,
+		"selector":        result.Selector,
+		"job":             result.Job,
+		"pod":             result.Pod.Pod,
+		"status":          result.Pod.Status,
+		"pod_started":     result.PodStarted.Format(time.RFC3339),
+		"capture_started": result.CaptureStarted.Format(time.RFC3339),
+		"seconds":         result.Seconds,
+		"files":           files,
+	}
+	if result.Pod.Port > 0 {
+		resultPayload["port"] = result.Pod.Port
+		resultPayload["port_source"] = result.Pod.PortSource
+	}
+	if result.ExpectedRuntime > 0 {
+		resultPayload["expected_runtime_seconds"] = result.ExpectedRuntime
+	}
+	if result.Pod.Cgroup != nil {
+		resultPayload["cgroup"] = result.Pod.Cgroup
+	}
+	if result.Finished != "" {
+		resultPayload["finished"] = result.Finished
+	}
+	if warnings := append(append([]string{}, result.Pod.Warnings...), result.Warnings...); len(warnings) > 0 {
+		resultPayload["warnings"] = warnings
+	}
+	payload := map[string]any{
+		"command": "kubectl " + strings.Join(append(k8s.ContextArgs(result.KubeContext), "get", "pods", "-n", result.Namespace, "-l", result.Selector), " "),
+		"result":  resultPayload,
+	}
+	if incidentID != "" {
+		payload["incident_id"] = incidentID
+	}
+	return marshalJSON(payload)
+}
+
+func k8sCompareClustersTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	outDir, incidentID := incident.ResolveOutDir(getString(args, "out_dir"))
+	if outDir == "" {
+		return nil, fmt.Errorf("out_dir is required (no incident context active)")
+	}
+	workload, selector, err := k8s.ParseTarget(getString(args, "target"))
+	if err != nil {
+		return nil, err
+	}
+	params := k8s.CompareParams{
+		CaptureParams: k8s.CaptureParams{
+			Namespace: getString(args, "namespace"),
+			Selector:  selector,
+			Workload:  workload,
+			Port:      getInt(args, "port", 0),
+			OutDir:    outDir,
+			Service:   getString(args, "service"),
+			Seconds:   getInt(args, "seconds", 30),
+			Types:     parseStringList(args, "types"),
+			MaxPods:   getInt(args, "max_pods", 0),
+			Strategy:  getString(args, "strategy"),
+		},
+	}
+	if _, ok := args["cgroup"]; ok {
+		params.SkipCgroup = !getBool(args, "cgroup")
+	}
+	contexts, namespaces := parseStringList(args, "kube_contexts"), parseStringList(args, "namespaces")
+	if len(contexts) != 0 && len(contexts) != 2 || len(namespaces) != 0 && len(namespaces) != 2 {
+		return nil, fmt.Errorf("kube_contexts and namespaces take exactly two values, one per side")
+	}
+	for i := range params.Clusters {
+		if len(contexts) == 2 {
+			params.Clusters[i].KubeContext = contexts[i]
+		}
+		if len(namespaces) == 2 {
+			params.Clusters[i].Namespace = namespaces[i]
+		}
+	}
+
+	if getBool(args, "dry_run") {
+		commands, err := k8s.CompareCommands(params)
+		if err != nil {
+			return nil, err
+		}
+		service := firstNonEmpty(params.Service, k8s.WorkloadName(workload), k8s.ServiceFromSelector(selector, firstNonEmpty(params.Namespace, "default")))
+		notes := []string{"Both sides are captured at the same time; the kubectl commands of each side run concurrently."}
+		return marshalJSON(dryRunPayload(d2.DryRunResult{Service: service, Command: commands[0], Commands: commands, Notes: notes}))
+	}
+
+	result, err := k8s.CompareClusters(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	resultPayload, err := compareResultPayload(result)
+	if err != nil {
+		return nil, err
+	}
+	payload := map[string]any{"result": resultPayload}
+	if incidentID != "" {
+		payload["incident_id"] = incidentID
+	}
+	return marshalJSON(payload)
+}
+
+func k8sCompareCanaryTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	outDir, incidentID := incident.ResolveOutDir(getString(args, "out_dir"))
+	if outDir == "" {
+		return nil, fmt.Errorf("out_dir is required (no incident context active)")
+	}
+	params := k8s.CanaryParams{
+		CaptureParams: k8s.CaptureParams{
+			KubeContext: getString(args, "kube_context"),
+			Namespace:   getString(args, "namespace"),
+			Selector:    getString(args, "selector"),
+			Port:        getInt(args, "port", 0),
+			OutDir:      outDir,
+			Service:     getString(args, "service"),
+			Seconds:     getInt(args, "seconds", 30),
+			Types:       parseStringList(args, "types"),
+			MaxPods:     getInt(args, "max_pods", 0),
+			Strategy:    getString(args, "strategy"),
+		},
+		Canary: getString(args, "canary_selector"),
+		Stable: getString(args, "stable_selector"),
+	}
+	if _, ok := args["cgroup"]; ok {
+		params.SkipCgroup = !getBool(args, "cgroup")
+	}
+
+	if getBool(args, "dry_run") {
+		commands, err := k8s.CanaryCommands(params)
+		if err != nil {
+			return nil, err
+		}
+		service := firstNonEmpty(params.Service, k8s.ServiceFromSelector(params.Selector, firstNonEmpty(params.Namespace, "default")))
+		notes := []string{"Stable and canary pods are captured at the same time; the kubectl commands of each group run concurrently."}
+		return marshalJSON(dryRunPayload(d2.DryRunResult{Service: service, Command: commands[0], Commands: commands, Notes: notes}))
+	}
+
+	result, err := k8s.CompareCanary(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	resultPayload, err := compareResultPayload(result.CompareResult)
+	if err != nil {
+		return nil, err
+	}
+	if result.Verdict != nil {
+		resultPayload["verdict"] = result.Verdict
+	}
+	payload := map[string]any{"result": resultPayload}
+	if incidentID != "" {
+		payload["incident_id"] = incidentID
+	}
+	return marshalJSON(payload)
+}
+
+// compareResultPayload registers each side's merged profiles and lays out
+// a two-sided comparison
+func compareResultPayload(result k8s.CompareResult) (map[string]any, error) {
+	timestamp := time.Now().UTC().Format(time.RFC3339)
+	clusters := []map[string]any{}
+	for _, side := range result.Clusters {
+		fleet := []map[string]any{}
+		for _, merged := range side.Capture.Fleet {
+			handle, err := profileRegistry.Register(profiles.Metadata{
+				Service:   result.Service,
+				Env:       side.Label,
+				Type:      merged.Type,
+				Timestamp: timestamp,
+				Path:      merged.Path,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to register fleet handle: %w", err)
+			}
+			fleet = append(fleet, map[string]any{"type": merged.Type, "handle": handle, "pods": merged.Pods})
+		}
+		pods := []string{}
+		for _, bundle := range side.Capture.Bundles {
+			pods = append(pods, bundle.Pod)
+		}
+		cluster := map[string]any{
+			"label":     side.Label,
+			"namespace": side.Namespace,
+			"selector":  side.Capture.Selector,
+			"pods":      pods,
+			"config":    side.Config,
+			"fleet":     fleet,
+		}
+		if side.KubeContext != "" {
+			cluster["kube_context"] = side.KubeContext
+		}
+		if len(side.Capture.Failed) > 0 {
+			cluster["failed"] = side.Capture.Failed
+		}
+		clusters = append(clusters, cluster)
+	}
+	resultPayload := map[string]any{
+		"service":            result.Service,
+		"clusters":           clusters,
+		"config_differences": result.ConfigDifferences,
+		"diffs":              result.Diffs,
+	}
+	if len(result.Attributions) > 0 {
+		resultPayload["attributions"] = result.Attributions
+	}
+	if len(result.Warnings) > 0 {
+		resultPayload["warnings"] = result.Warnings
+	}
+	return resultPayload, nil
+}
+
+func k8sDebugCaptureTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	outDir, incidentID := incident.ResolveOutDir(getString(args, "out_dir"))
+	if outDir == "" {
+		return nil, fmt.Errorf("out_dir is required (no incident context active)")
+	}
+	params := k8s.DebugParams{
+		KubeContext: getString(args, "kube_context"),
+		Namespace:   getString(args, "namespace"),
+		Pod:         getString(args, "pod"),
+		Container:   getString(args, "container"),
+		Image:       getString(args, "image"),
+		Command:     getString(args, "agent_command"),
+		PID:         getString(args, "pid"),
+		Seconds:     getInt(args, "seconds", 30),
+		OutDir:      outDir,
+		Service:     getString(args, "service"),
+	}
+	if target := getString(args, "target"); target != "" {
+		if params.Pod != "" {
+			return nil, fmt.Errorf("pass pod or target, not both")
+		}
+		workload, selector, err := k8s.ParseTarget(target)
+		if err != nil {
+			return nil, err
+		}
+		params.Workload, params.Selector = workload, selector
+	}
+
+	commands, err := k8s.DebugCommands(params)
+	if err != nil {
+		return nil, err
+	}
+	if getBool(args, "dry_run") {
+		return marshalJSON(dryRunPayload(d2.DryRunResult{
+			Service:  firstNonEmpty(params.Service, params.Pod, k8s.WorkloadName(params.Workload), params.Selector),
+			Command:  commands[len(commands)-3], // the kubectl debug step
+			Commands: commands,
+			Notes:    append([]string{"PRIVILEGED: requires confirm=true after user approval."}, k8s.DebugPrivileges()...),
+		}))
+	}
+	if !getBool(args, "confirm") {
+		return nil, fmt.Errorf("k8s.profiles.debug_capture is privileged: it %s. Ask the user to approve, then retry with confirm=true (dry_run=true shows the commands)", strings.Join(k8s.DebugPrivileges(), "; "))
+	}
+
+	result, err := k8s.CaptureWithDebugContainer(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	handle, err := profileRegistry.Register(profiles.Metadata{
+		Service:   result.Service,
+		Env:       result.Namespace,
+		Type:      result.File.Type,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Path:      result.File.Path,
+		Bytes:     result.File.Bytes,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to register profile handle: %w", err)
+	}
+	resultPayload := map[string]any{
+		"service":         result.Service,
+		"namespace":       result.Namespace,
+		"pod":             result.Pod,
+		"container":       result.Container,
+		"debug_container": result.DebugContainer,
+		"image":           result.Image,
+		"files":           []map[string]any{{"type": result.File.Type, "handle": handle, "bytes": result.File.Bytes}},
+	}
+	if len(result.Warnings) > 0 {
+		resultPayload["warnings"] = result.Warnings
+	}
+	payload := map[string]any{
+		"command":    "kubectl " + strings.Join(append(k8s.ContextArgs(result.KubeContext), "debug", "-n", result.Namespace, result.Pod, "--image", result.Image, "--target", result.Container, "--profile", "general", "--container", result.DebugContainer), " "),
+		"privileged": true,
+		"result":     resultPayload,
+	}
+	if incidentID != "" {
+		payload["incident_id"] = incidentID
+	}
+	return marshalJSON(payload)
+}
+
+func d2BranchImpactTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	params := branchImpactParams(args)
+
+	if getBool(args, "dry_run") {
+		plan, err := d2.BranchImpactCommands(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		return marshalJSON(dryRunPayload(plan))
+	}
+
+	result, err := d2.CompareBranches(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := branchImpactPayload(result)
+	if err != nil {
+		return nil, err
+	}
+	return marshalJSON(payload)
+}
+
+// branchImpactParams reads the arguments shared by pprof.branch_impact and
+// pprof.branch_impact.plan.
+func branchImpactParams(args map[string]any) d2.BranchImpactParams {
+	analyze := true
+	if _, ok := args["analyze"]; ok {
+		analyze = getBool(args, "analyze")
+	}
+	return d2.BranchImpactParams{
+		Service:        getString(args, "service"),
+		Services:       parseStringList(args, "services"),
+		Namespace:      getString(args, "namespace"),
+		KubeContext:    getString(args, "kube_context"),
+		DevEnv:         getString(args, "dev_env"),
+		DeployCommand:  getString(args, "deploy_command"),
+		GitOpsApp:      getString(args, "gitops_app"),
+		PprofPort:      getInt(args, "pprof_port", 0),
+		BeforeRef:      getString(args, "before_ref"),
+		AfterRef:       getString(args, "after_ref"),
+		OutDir:         getString(args, "out_dir"),
+		Seconds:        getInt(args, "seconds", 30),
+		Runs:           getInt(args, "runs", 1),
+		RebuildTimeout: time.Duration(getInt(args, "rebuild_timeout", 300)) * time.Second,
+		WarmupDelay:    time.Duration(getInt(args, "warmup_delay", 15)) * time.Second,
+		SkipAnalysis:   !analyze,
+		Load: d2.LoadParams{
+			Command:       getString(args, "load_command"),
+			K6Script:      getString(args, "k6_script"),
+			VegetaTargets: getString(args, "vegeta_targets"),
+			Rate:          getInt(args, "load_rate", 0),
+		},
+	}
+}
+
+// branchImpactPayload registers the before and after profiles of every
+// compared service and builds the tool response.
+func branchImpactPayload(result d2.BranchImpactResult) (map[string]any, error) {
+	beforePayload, err := registerD2Profiles(result.BeforeProfiles)
+	if err != nil {
+		return nil, err
+	}
+	afterPayload, err := registerD2Profiles(result.AfterProfiles)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := map[string]any{
+		"service":         result.Service,
+		"before_ref":      result.BeforeRef,
+		"after_ref":       result.AfterRef,
+		"before_profiles": beforePayload,
+		"after_profiles":  afterPayload,
+		"update_method":   result.UpdateMethod,
+		"git_stashed":     result.GitStashed,
+	}
+	if len(result.Services) > 0 {
+		services := make([]map[string]any, 0, len(result.Services))
+		for _, impact := range result.Services {
+			before, after := beforePayload, afterPayload
+			if impact.Service != result.Service {
+				if before, err = registerD2Profiles(impact.BeforeProfiles); err != nil {
+					return nil, err
+				}
+				if after, err = registerD2Profiles(impact.AfterProfiles); err != nil {
+					return nil, err
+				}
+			}
+			services = append(services, map[string]any{
+				"service":         impact.Service,
+				"before_profiles": before,
+				"after_profiles":  after,
+				"update_method":   impact.UpdateMethod,
+			})
+		}
+		payload["services"] = services
+	}
+	if result.Combined != nil {
+		payload["combined"] = result.Combined
+	}
+	if result.Restore != nil {
+		payload["restore"] = result.Restore
+	}
+	if len(result.Stats) > 0 {
+		payload["stats"] = result.Stats
+	}
+	if len(result.Analysis) > 0 {
+		payload["analysis"] = result.Analysis
+	}
+	if result.Report != "" {
+		payload["report"] = result.Report
+	}
+	if result.ReportPath != "" {
+		payload["report_path"] = result.ReportPath
+	}
+	if result.BeforeLoad != nil {
+		payload["before_load"] = result.BeforeLoad
+	}
+	if result.AfterLoad != nil {
+		payload["after_load"] = result.AfterLoad
+	}
+	if len(result.Warnings) > 0 {
+		payload["warnings"] = result.Warnings
+	}
+	return payload, nil
+}
+
+// registerD2Profiles registers downloaded profiles and returns the download
+// with handles in place of paths.
+func registerD2Profiles(downloadResult d2.DownloadResult) (map[string]any, error) {
+	timestamp := time.Now().UTC().Format(time.RFC3339)
+	handles := []map[string]any{}
+	for _, file := range downloadResult.Files {
+		handle, err := profileRegistry.Register(profiles.Metadata{
+			Service:   downloadResult.Service,
+			Env:       "d2",
+			Type:      file.Type,
+			Timestamp: timestamp,
+			Path:      file.Path,
+			Bytes:     file.Bytes,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to register profile handle: %w", err)
+		}
+		handles = append(handles, map[string]any{
+			"type":   file.Type,
+			"handle": handle,
+			"bytes":  file.Bytes,
+		})
+	}
+
+	resultPayload := map[string]any{
+		"service":   downloadResult.Service,
+		"namespace": downloadResult.Namespace,
+		"pod_name":  downloadResult.PodName,
+		"pod_ip":    downloadResult.PodIP,
+		"files":     handles,
+	}
+	if len(downloadResult.Warnings) > 0 {
+		resultPayload["warnings"] = downloadResult.Warnings
+	}
+	return resultPayload, nil
+}
+
+func d2BranchImpactPlanTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	plan, err := d2.CreateExecutionPlan(ctx, branchImpactParams(args))
+	if err != nil {
+		return nil, err
+	}
+
+	// Determine after_ref for display
+	afterRefDisplay := plan.Params.AfterRef
+	if afterRefDisplay == "" {
+		afterRefDisplay = plan.CurrentBranch
+	}
+
+	payload := map[string]any{
+		"id":              plan.ID,
+		"steps":           plan.Steps,
+		"estimated_time":  plan.EstimatedTime,
+		"current_branch":  plan.CurrentBranch,
+		"has_uncommitted": plan.HasUncommitted,
+		"service":         plan.Params.Service,
+		"before_ref":      plan.Params.BeforeRef,
+		"after_ref":       afterRefDisplay,
+		"expires_at":      plan.ExpiresAt,
+		"plan_dir":        d2.PlanDir(),
+	}
+	if len(plan.Params.Services) > 0 {
+		payload["services"] = plan.Params.Services
+	}
+	if plan.Params.Runs > 1 {
+		payload["runs"] = plan.Params.Runs
+	}
+
+	return marshalJSON(payload)
+}
+
+func d2BranchImpactExecuteTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	planID := getString(args, "plan_id")
+
+	if getBool(args, "dry_run") {
+		plan, err := d2.PlanCommands(ctx, planID)
+		if err != nil {
+			return nil, err
+		}
+		payload := dryRunPayload(plan)
+		payload["plan_id"] = planID
+		return marshalJSON(payload)
+	}
+
+	result, err := d2.ExecutePlan(ctx, planID)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := branchImpactPayload(result)
+	if err != nil {
+		return nil, err
+	}
+	return marshalJSON(payload)
+}
+
+func d2BranchImpactAbortTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	result, err := d2.AbortRun(ctx, getString(args, "plan_id"))
+	if err != nil {
+		return nil, err
+	}
+	return marshalJSON(result)
+}
+
+func d2BranchImpactListTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	status := getString(args, "status")
+	limit := getInt(args, "limit", 20)
+
+	plans, err := d2.ListPlans()
+	if err != nil {
+		return nil, err
+	}
+	runs := []map[string]any{}
+	for _, plan := range plans {
+		current := plan.CurrentStatus()
+		if status != "" && current != status {
+			continue
+		}
+		run := map[string]any{
+			"id":         plan.ID,
+			"status":     current,
+			"service":    plan.Params.Service,
+			"before_ref": plan.Params.BeforeRef,
+			"after_ref":  firstNonEmpty(plan.Params.AfterRef, plan.CurrentBranch),
+			"created_at": plan.CreatedAt,
+			"expires_at": plan.ExpiresAt,
+		}
+		if len(plan.Params.Services) > 0 {
+			run["services"] = plan.Params.Services
+		}
+		if plan.StartedAt != nil {
+			run["started_at"] = *plan.StartedAt
+		}
+		if plan.FinishedAt != nil {
+			run["finished_at"] = *plan.FinishedAt
+		}
+		if plan.Error != "" {
+			run["error"] = plan.Error
+		}
+		runs = append(runs, run)
+		if limit > 0 && len(runs) == limit {
+			break
+		}
+	}
+
+	return marshalJSON(map[string]any{
+		"plan_dir": d2.PlanDir(),
+		"runs":     runs,
+	})
+}
+
+func d2BranchImpactShowTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	plan, err := d2.GetPlan(getString(args, "plan_id"))
+	if err != nil {
+		return nil, err
+	}
+	shown := *plan
+	shown.Status = plan.CurrentStatus()
+	return marshalJSON(map[string]any{
+		"plan_dir": d2.PlanDir(),
+		"plan":     shown,
+	})
+}
+
+func d2ScheduleStartTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	params := d2.ScheduleParams{
+		Services:    parseStringList(args, "services"),
+		Namespace:   getString(args, "namespace"),
+		KubeContext: getString(args, "kube_context"),
+		DevEnv:      getString(args, "dev_env"),
+		PprofPort:   getInt(args, "pprof_port", 0),
+		Interval:    time.Duration(getInt(args, "interval", 300)) * time.Second,
+		Seconds:     getInt(args, "seconds", 30),
+		Count:       getInt(args, "count", 0),
+		Duration:    time.Duration(getInt(args, "duration", 0)) * time.Second,
+		OutDir:      getString(args, "out_dir"),
+	}
+	if getBool(args, "dry_run") {
+		plan, err := d2.ScheduleCommands(params)
+		if err != nil {
+			return nil, err
+		}
+		return marshalJSON(dryRunPayload(plan))
+	}
+	schedule, err := d2.StartSchedule(params)
+	if err != nil {
+		return nil, err
+	}
+	return marshalJSON(scheduleSummary(*schedule))
+}
+
+func d2ScheduleStopTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	schedule, err := d2.StopSchedule(ctx, getString(args, "schedule_id"))
+	if err != nil {
+		return nil, err
+	}
+	return marshalJSON(scheduleSummary(*schedule))
+}
+
+func d2ScheduleListTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	status := getString(args, "status")
+	limit := getInt(args, "limit", 20)
+
+	schedules, err := d2.ListSchedules()
+	if err != nil {
+		return nil, err
+	}
+	summaries := []map[string]any{}
+	for _, schedule := range schedules {
+		if status != "" && schedule.CurrentStatus() != status {
+			continue
+		}
+		summaries = append(summaries, scheduleSummary(schedule))
+		if limit > 0 && len(summaries) == limit {
+			break
+		}
+	}
+	return marshalJSON(map[string]any{
+		"schedule_dir": d2.ScheduleDir(),
+		"schedules":    summaries,
+	})
+}
+
+func d2ScheduleShowTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	schedule, err := d2.GetSchedule(getString(args, "schedule_id"))
+	if err != nil {
+		return nil, err
+	}
+	captures := schedule.Captures
+	if limit := getInt(args, "captures", 20); limit > 0 && len(captures) > limit {
+		captures = captures[len(captures)-limit:]
+	}
+	return marshalJSON(map[string]any{
+		"schedule":       scheduleSummary(*schedule),
+		"trends":         schedule.Trends(),
+		"captures":       captures,
+		"captures_total": len(schedule.Captures),
+	})
+}
+
+// scheduleSummary describes a schedule without its captures
+func scheduleSummary(schedule d2.Schedule) map[string]any {
+	failed := 0
+	for _, capture := range schedule.Captures {
+		if capture.Error != "" {
+			failed++
+		}
+	}
+	summary := map[string]any{
+		"id":               schedule.ID,
+		"status":           schedule.CurrentStatus(),
+		"services":         schedule.Params.Services,
+		"dev_env":          schedule.Params.DevEnv,
+		"interval_seconds": int(schedule.Params.Interval / time.Second),
+		"seconds":          schedule.Params.Seconds,
+		"count":            schedule.Params.Count,
+		"duration_seconds": int(schedule.Params.Duration / time.Second),
+		"out_dir":          schedule.Params.OutDir,
+		"started_at":       schedule.StartedAt,
+		"rounds":           schedule.Rounds,
+		"captures":         len(schedule.Captures),
+		"failed_captures":  failed,
+	}
+	if schedule.NextAt != nil && schedule.CurrentStatus() == d2.ScheduleRunning {
+		summary["next_at"] = *schedule.NextAt
+	}
+	if schedule.FinishedAt != nil {
+		summary["finished_at"] = *schedule.FinishedAt
+	}
+	var growing []string
+	for _, trend := range schedule.Trends() {
+		for _, metric := range trend.Growing {
+			growing = append(growing, trend.Service+": "+metric)
+		}
+	}
+	if len(growing) > 0 {
+		summary["growing"] = growing
+	}
+	if schedule.Error != "" {
+		summary["error"] = schedule.Error
+	}
+	return summary
+}
+
+func pprofTopTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	profilePath := getString(args, "profile")
+	sampleIndex := getString(args, "sample_index")
+
+	result, err := pprof.RunTop(ctx, pprof.TopParams{
+		Profile:     profilePath,
+		Binary:      getString(args, "binary"),
+		Cum:         getBool(args, "cum"),
+		NodeCount:   getInt(args, "nodecount", 0),
+		Focus:       getString(args, "focus"),
+		Ignore:      getString(args, "ignore"),
+		SampleIndex: sampleIndex,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Add contextual hints based on profile type
+	pprof.AddTopHints(&result, profilePath, sampleIndex)
+
+	limits := textLimits(args)
+	raw, rawMeta := applyTextLimits(result.Raw, &result.RawMeta, limits)
+
+	payload := map[string]any{
+		"command":  result.Command,
+		"raw":      raw,
+		"raw_meta": rawMeta,
+		"rows":     result.Rows,
+		"summary":  result.Summary,
+	}
+	addStderr(payload, result.Stderr, result.StderrMeta, limits)
+	if len(result.Hints) > 0 {
+		payload["hints"] = result.Hints
+	}
+	if getBool(args, "compare_baseline") {
+		baselinePath := getString(args, "baseline_path")
+		if baselinePath == "" {
+			var err error
+			baselinePath, err = defaultBaselinePath()
+			if err != nil {
+				return nil, err
+			}
+		}
+		meta, err := pprof.RunMeta(profilePath)
+		if err != nil {
+			return nil, err
+		}
+		sampleKey := sampleIndex
+		if sampleKey == "" {
+			sampleKey = "default"
+		}
+		baselineKey := baseline.Key(
+			getString(args, "service"),
+			getString(args, "env"),
+			getString(args, "baseline_key"),
+			meta.DetectedKind,
+			sampleKey,
+		)
+		comparison, err := baseline.CompareAndUpdate(baselinePath, baselineKey, meta.DetectedKind, sampleKey, result.Rows)
+		if err != nil {
+			return nil, err
+		}
+		payload["baseline"] = comparison
+	}
+	return marshalJSON(payload)
+}
+
+func pprofPeekTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	binary, resolution := symbolizationBinary(ctx, args)
+	result, err := pprof.RunPeek(ctx, pprof.PeekParams{
+		Profile:     getString(args, "profile"),
+		Binary:      binary,
+		Regex:       getString(args, "regex"),
+		SampleIndex: getString(args, "sample_index"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	limits := textLimits(args)
+	raw, rawMeta := applyTextLimits(result.Raw, &result.RawMeta, limits)
+
+	payload := map[string]any{
+		"command":     result.Command,
+		"raw":         raw,
+		"raw_meta":    rawMeta,
+		"total_lines": rawMeta.TotalLines,
+		"truncated":   rawMeta.Truncated,
+	}
+	addStderr(payload, result.Stderr, result.StderrMeta, limits)
+	if resolution != nil {
+		payload["binary_resolution"] = resolution
+	}
+	return marshalJSON(payload)
+}
+
+func pprofListTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	binary, resolution := symbolizationBinary(ctx, args)
+	result, err := pprof.RunList(ctx, pprof.ListParams{
+		Profile:         getString(args, "profile"),
+		Binary:          binary,
+		Function:        getString(args, "function"),
+		RepoRoot:        getString(args, "repo_root"),
+		TrimPath:        getString(args, "trim_path"),
+		SourcePaths:     parseStringList(args, "source_paths"),
+		DownloadModules: getBool(args, "download_modules"),
+		SnippetFormat:   getString(args, "snippet_format"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	limits := textLimits(args)
+	raw, rawMeta := applyTextLimits(result.Raw, &result.RawMeta, limits)
+
+	payload := map[string]any{
+		"command":     result.Command,
+		"raw":         raw,
+		"raw_meta":    rawMeta,
+		"total_lines": rawMeta.TotalLines,
+		"truncated":   rawMeta.Truncated,
+	}
+	addStderr(payload, result.Stderr, result.StderrMeta, limits)
+	if resolution != nil {
+		payload["binary_resolution"] = resolution
+	}
+	if result.TrimPathInference != nil {
+		payload["trim_path_inference"] = result.TrimPathInference
+	}
+	if result.HTML != "" {
+		payload["html"] = result.HTML
+	}
+	if len(result.ModuleSources) > 0 {
+		payload["module_sources"] = result.ModuleSources
+	}
+	if len(result.Warnings) > 0 {
+		payload["warnings"] = result.Warnings
+	}
+	return marshalJSON(payload)
+}
+
+func pprofTracesTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	lines := getInt(args, "lines", 0)
+	if lines == 0 {
+		lines = getInt(args, "max_lines", defaultTracesLines)
+	}
+	if lines > maxTracesLines {
+		lines = maxTracesLines
+	}
+
+	limits := textLimits(args)
+	result, err := pprof.RunTracesHead(ctx, pprof.TracesParams{
+		Profile:  getString(args, "profile"),
+		Binary:   getString(args, "binary"),
+		Lines:    lines,
+		Strategy: string(limits.Strategy),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// lines already cut the output; max_bytes applies on top.
+	limits.MaxLines = 0
+	raw, rawMeta := applyTextLimits(result.Raw, &result.RawMeta, limits)
+	totalLines := rawMeta.TotalLines
+	if totalLines == 0 {
+		totalLines = result.TotalLines
+	}
+
+	payload := map[string]any{
+		"command":     result.Command,
+		"raw":         raw,
+		"raw_meta":    rawMeta,
+		"total_lines": totalLines,
+		"truncated":   rawMeta.Truncated,
+	}
+	addStderr(payload, result.Stderr, result.StderrMeta, limits)
+	return marshalJSON(payload)
+}
+
+func pprofDiffTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	result, err := pprof.RunDiffTop(ctx, pprof.DiffTopParams{
+		Before:      getString(args, "before"),
+		After:       getString(args, "after"),
+		Binary:      getString(args, "binary"),
+		Cum:         getBool(args, "cum"),
+		NodeCount:   getInt(args, "nodecount", 0),
+		Focus:       getString(args, "focus"),
+		Ignore:      getString(args, "ignore"),
+		SampleIndex: getString(args, "sample_index"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payload := map[string]any{
+		"commands": result.Commands,
+		"before":   result.Before,
+		"after":    result.After,
+		"deltas":   result.Deltas,
+	}
+	if limits := textLimits(args); limits.MaxLines > 0 || limits.MaxBytes > 0 {
+		raw, rawMeta := applyTextLimits(formatDiffTop(result.Deltas), nil, limits)
+		payload["raw"] = raw
+		payload["raw_meta"] = rawMeta
+		payload["total_lines"] = rawMeta.TotalLines
+		payload["truncated"] = rawMeta.Truncated
+	}
+	return marshalJSON(payload)
+}
+
+func formatDiffTop(deltas []map[string]any) string {
+	var b strings.Builder
+	b.WriteString("name\tbefore_flat\tafter_flat\tbefore_cum\tafter_cum\tdelta_seconds\n")
+	for _, delta := range deltas {
+		name := formatDeltaField(delta["name"])
+		beforeFlat := formatDeltaField(delta["before_flat"])
+		afterFlat := formatDeltaField(delta["after_flat"])
+		beforeCum := formatDeltaField(delta["before_cum"])
+		afterCum := formatDeltaField(delta["after_cum"])
+		deltaSeconds := formatDeltaSeconds(delta["delta_seconds"])
+		b.WriteString(name)
+		b.WriteString("\t")
+		b.WriteString(beforeFlat)
+		b.WriteString("\t")
+		b.WriteString(afterFlat)
+		b.WriteString("\t")
+		b.WriteString(beforeCum)
+		b.WriteString("\t")
+		b.WriteString(afterCum)
+		b.WriteString("\t")
+		b.WriteString(deltaSeconds)
+		b.WriteString("\n")
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func formatDeltaField(value any) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+func formatDeltaSeconds(value any) string {
+	if value == nil {
+		return ""
+	}
+	switch typed := value.(type) {
+	case float64:
+		return fmt.Sprintf("%.6f", typed)
+	case float32:
+		return fmt.Sprintf("%.6f", typed)
+	case int:
+		return fmt.Sprintf("%d", typed)
+	case int64:
+		return fmt.Sprintf("%d", typed)
+	default:
+		return fmt.Sprintf("%v", value)
+	}
+}
+
+func pprofRegressionCheckTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	checks, err := parseRegressionChecks(args)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := pprof.RunRegressionCheck(ctx, pprof.RegressionCheckParams{
+		Profile:     getString(args, "profile"),
+		SampleIndex: getString(args, "sample_index"),
+		Checks:      checks,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payload := map[string]any{
+		"command": "pprof regression_check",
+		"result":  result,
+	}
+	summary := "All regression checks passed."
+	if !result.Passed {
+		summary = "One or more regression checks failed."
+	}
+	return marshalJSONWithSummary(summary, payload)
+}
+
+func pprofMetaTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	profilePath := getString(args, "profile")
+	meta, err := pprof.RunMeta(profilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := map[string]any{
+		"command": pprof.FormatMetaCommand(profilePath),
+		"result":  meta,
+	}
+	return marshalJSON(payload)
+}
+
+func pprofValidateTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	profilePath := getString(args, "profile")
+	result, err := pprof.RunValidate(profilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := map[string]any{
+		"command": pprof.FormatValidateCommand(profilePath),
+		"result":  result,
+	}
+	summary := fmt.Sprintf("%s is a valid profile with %d samples.", profilePath, result.SampleCount)
+	if !result.Valid {
+		summary = fmt.Sprintf("%s is not usable: %s", profilePath, result.Problems[0].Message)
+	}
+	return marshalJSONWithSummary(summary, payload)
+}
+
+func pprofSymbolizationTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	profilePath := getString(args, "profile")
+	sampleIndex := getString(args, "sample_index")
+	result, err := pprof.RunSymbolization(profilePath, sampleIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := map[string]any{
+		"command": pprof.FormatSymbolizationCommand(profilePath, sampleIndex),
+		"result":  result,
+	}
+	summary := fmt.Sprintf("%.1f%% of %s resolves to named functions. %s", result.NamedFraction*100, result.SampleType, result.Recommendation)
+	return marshalJSONWithSummary(summary, payload)
+}
+
+func pprofStorylinesTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	prefixes := parseStringList(args, "repo_prefix")
+	result, err := pprof.RunStorylines(ctx, pprof.StorylinesParams{
+		Profile:       getString(args, "profile"),
+		N:             getInt(args, "n", 4),
+		Focus:         getString(args, "focus"),
+		Ignore:        getString(args, "ignore"),
+		RepoPrefixes:  prefixes,
+		RepoRoot:      getString(args, "repo_root"),
+		TrimPath:      getString(args, "trim_path"),
+		SampleIndex:   getString(args, "sample_index"),
+		Format:        getString(args, "format"),
+		MaxLines:      getInt(args, "max_lines", 0),
+		MaxBytes:      getInt(args, "max_bytes", 0),
+		Strategy:      getString(args, "truncate_strategy"),
+		SnippetFormat: getString(args, "snippet_format"),
+		Revision:      getString(args, "revision"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payload := map[string]any{
+		"command": result.Command,
+		"result":  result,
+	}
+	return marshalJSON(payload)
+}
+
+func pprofMemorySanityTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	result, err := pprof.RunMemorySanity(ctx, pprof.MemorySanityParams{
+		HeapProfile:      getString(args, "heap_profile"),
+		GoroutineProfile: getString(args, "goroutine_profile"),
+		CPUProfile:       getString(args, "cpu_profile"),
+		RepoRoot:         getString(args, "repo_root"),
+		Binary:           getString(args, "binary"),
+		ContainerRSSMB:   getInt(args, "container_rss_mb", 0),
+		Patterns:         patternRules(currentConfig().Patterns.Code),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payload := map[string]any{
+		"command": "pprof memory_sanity",
+		"result":  result,
+	}
+	addStderr(payload, result.Stderr, result.StderrMeta, textLimits(args))
+	return marshalJSON(payload)
+}
+
+func pprofGoroutineAnalysisTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	result, err := pprof.RunGoroutineAnalysis(pprof.GoroutineAnalysisParams{
+		Profile: getString(args, "profile"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payload := map[string]any{
+		"command": "pprof goroutine_analysis",
+		"result":  result,
+	}
+	summary := fmt.Sprintf("Found %d goroutines across %d states.", result.TotalGoroutines, len(result.ByState))
+	return marshalJSONWithSummary(summary, payload)
+}
+
+func pprofContentionAnalysisTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	result, err := pprof.RunContentionAnalysis(pprof.ContentionAnalysisParams{
+		Profile: getString(args, "profile"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payload := map[string]any{
+		"command": "pprof contention_analysis",
+		"result":  result,
+	}
+	summary := fmt.Sprintf("Contention summary: %d contentions, %s total delay.", result.TotalContentions, result.TotalDelay)
+	return marshalJSONWithSummary(summary, payload)
+}
+
+func pprofDiscoverTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	service := getString(args, "service")
+	env := getString(args, "env")
+	outDir := getString(args, "out_dir")
+	keep := func() {}
+	if outDir == "" {
+		tmp, err := tempfiles.MkdirTemp("", "pprof-discover-*")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temp dir: %w", err)
+		}
+		// Removed unless the profiles in it are returned.
+		defer tmp.Remove()
+		keep = tmp.Keep
+		outDir = tmp.Path
+	}
+
+	// Check if we're in d2 environment
+	isD2 := d2.IsD2Environment()
+
+	var downloadErr error
+	var files []struct {
+		Type  string
+		Path  string
+		Bytes int64
+	}
+	var timestamp string
+	var warnings []string
+
+	if isD2 {
+		// Use d2 backend
+		seconds := getInt(args, "seconds", 30)
+		result, err := d2.DownloadProfiles(ctx, d2.DownloadParams{
+			Service: service,
+			OutDir:  outDir,
+			Seconds: seconds,
+		})
+		downloadErr = err
+		if err == nil {
+			for _, f := range result.Files {
+				files = append(files, struct {
+					Type  string
+					Path  string
+					Bytes int64
+				}{Type: f.Type, Path: f.Path, Bytes: f.Bytes})
+			}
+			timestamp = time.Now().UTC().Format(time.RFC3339)
+			warnings = result.Warnings
+			env = "d2" // Override env to d2
+		}
+	} else {
+		// Use Datadog backend
+		hours := getInt(args, "hours", 72)
+		site := getString(args, "dd_site")
+		if site == "" {
+			site = getString(args, "site")
+		}
+		profileID := getString(args, "profile_id")
+		eventID := getString(args, "event_id")
+
+		result, err := datadog.DownloadLatestBundle(ctx, datadog.DownloadParams{
+			Service:   service,
+			Env:       env,
+			OutDir:    outDir,
+			Hours:     hours,
+			Site:      site,
+			ProfileID: profileID,
+			EventID:   eventID,
+		})
+		downloadErr = err
+		if err == nil {
+			for _, f := range result.Files {
+				files = append(files, struct {
+					Type  string
+					Path  string
+					Bytes int64
+				}{Type: f.Type, Path: f.Path, Bytes: f.Bytes})
+			}
+			timestamp = result.Timestamp
+			warnings = result.Warnings
+		}
+	}
+
+	if downloadErr != nil {
+		return nil, downloadErr
+	}
+
+	// Register handles for all profiles
+	handles := []map[string]any{}
+	for _, file := range files {
+		handle, err := profileRegistry.Register(profiles.Metadata{
+			Service:   service,
+			Env:       env,
+			Type:      file.Type,
+			Timestamp: timestamp,
+			Path:      file.Path,
+			Bytes:     file.Bytes,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to register profile handle: %w", err)
+		}
+		handles = append(handles, map[string]any{
+			"type":   file.Type,
+			"handle": handle,
+			"path":   file.Path,
+			"bytes":  file.Bytes,
+		})
+	}
+
+	// Build profile inputs from registered handles
+	profileInputs := make([]pprof.DiscoveryProfileInput, 0, len(files))
+	for i, file := range files {
+		profileInputs = append(profileInputs, pprof.DiscoveryProfileInput{
+			Type:   file.Type,
+			Path:   file.Path,
+			Handle: handles[i]["handle"].(string),
+			Bytes:  file.Bytes,
+		})
+	}
+
+	report, err := pprof.RunDiscovery(ctx, pprof.DiscoveryParams{
+		Service:        service,
+		Env:            env,
+		Timestamp:      timestamp,
+		Profiles:       profileInputs,
+		RepoPrefixes:   parseStringList(args, "repo_prefix"),
+		ContainerRSSMB: getInt(args, "container_rss_mb", 0),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(warnings) > 0 {
+		report.Warnings = append(report.Warnings, warnings...)
+	}
+	keep()
+
+	payload := map[string]any{
+		"command": "pprof discover",
+		"result":  report,
+	}
+	summary := fmt.Sprintf("Discovery complete for %s/%s with %d recommendations.", service, env, len(report.Recommendations))
+	return marshalJSONWithSummary(summary, payload)
+}
+
+func pprofCrossCorrelateTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	bundlePaths, warnings, err := resolveBundlePaths(args["bundle"])
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := pprof.RunCrossCorrelate(ctx, pprof.CrossCorrelateParams{
+		Profiles:  bundlePaths,
+		NodeCount: getInt(args, "nodecount", 0),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(warnings) > 0 {
+		result.Warnings = append(result.Warnings, warnings...)
+	}
+
+	payload := map[string]any{
+		"command": "pprof cross_correlate",
+		"result":  result,
+	}
+	summary := fmt.Sprintf("Found %d correlated hotspots.", len(result.Correlations))
+	return marshalJSONWithSummary(summary, payload)
+}
+
+func pprofHotspotSummaryTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	bundlePaths, warnings, err := resolveBundlePaths(args["bundle"])
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := pprof.RunHotspotSummary(ctx, pprof.HotspotSummaryParams{
+		Profiles:  bundlePaths,
+		NodeCount: getInt(args, "nodecount", 0),
+		RepoRoot:  getString(args, "repo_root"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(warnings) > 0 {
+		result.Warnings = append(result.Warnings, warnings...)
+	}
+
+	payload := map[string]any{
+		"command": "pprof hotspot_summary",
+		"result":  result,
+	}
+	summary := "Hotspot summary generated."
+	if result.GoroutineCount != nil {
+		summary = fmt.Sprintf("Hotspot summary generated with %d goroutines.", *result.GoroutineCount)
+	}
+	return marshalJSONWithSummary(summary, payload)
+}
+
+func pprofTraceSourceTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	showVendor := true
+	if _, ok := args["show_vendor"]; ok {
+		showVendor = getBool(args, "show_vendor")
+	}
+	result, err := pprof.RunTraceSource(ctx, pprof.TraceSourceParams{
+		Profile:         getString(args, "profile"),
+		Function:        getString(args, "function"),
+		RepoRoot:        getString(args, "repo_root"),
+		MaxDepth:        getInt(args, "max_depth", 0),
+		ShowVendor:      showVendor,
+		ContextLines:    getInt(args, "context_lines", 0),
+		TrimPath:        getString(args, "trim_path"),
+		DownloadModules: getBool(args, "download_modules"),
+		SnippetFormat:   getString(args, "snippet_format"),
+		Revision:        getString(args, "revision"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payload := map[string]any{
+		"command": "pprof trace_source",
+		"result":  result,
+	}
+	summary := fmt.Sprintf("Traced %d functions.", result.TotalFunctionsTraced)
+	return marshalJSONWithSummary(summary, payload)
+}
+
+func pprofCoverageHotspotsTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	result, err := pprof.RunCoverage(ctx, pprof.CoverageParams{
+		Profile:     getString(args, "profile"),
+		RepoRoot:    getString(args, "repo_root"),
+		Coverage:    getString(args, "coverage"),
+		Packages:    parseStringList(args, "packages"),
+		TrimPath:    getString(args, "trim_path"),
+		SampleIndex: getString(args, "sample_index"),
+		Limit:       getInt(args, "limit", 0),
+		MinPct:      getFloat(args, "min_pct", 0),
+		LowCoverage: getFloat(args, "low_coverage", 0),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payload := map[string]any{
+		"command": "pprof coverage_hotspots",
+		"result":  result,
+	}
+	untested := 0
+	for _, hotspot := range result.Hotspots {
+		if hotspot.Status == pprof.CoverageUntested {
+			untested++
+		}
+	}
+	summary := fmt.Sprintf("%d of %d hot functions untested (%.1f%% flat).", untested, len(result.Hotspots), result.UntestedFlatPct)
+	return marshalJSONWithSummary(summary, payload)
+}
+
+func pprofVendorAnalyzeTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	result, err := pprof.RunVendorAnalyze(ctx, pprof.VendorAnalyzeParams{
+		Profile:      getString(args, "profile"),
+		RepoRoot:     getString(args, "repo_root"),
+		RepoPrefixes: parseStringList(args, "repo_prefix"),
+		MinPct:       getFloat(args, "min_pct", 0),
+		CheckUpdates: getBool(args, "check_updates"),
+		Patterns:     patternRules(currentConfig().Patterns.Vendor),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payload := map[string]any{
+		"command": "pprof vendor_analyze",
+		"result":  result,
+	}
+	summary := fmt.Sprintf("Found %d vendor hotspots.", len(result.VendorHotspots))
+	return marshalJSONWithSummary(summary, payload)
+}
+
+func pprofExplainOverheadTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	result, err := pprof.RunExplainOverhead(ctx, pprof.ExplainOverheadParams{
+		Profile:     getString(args, "profile"),
+		Category:    getString(args, "category"),
+		Function:    getString(args, "function"),
+		DetailLevel: getString(args, "detail_level"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payload := map[string]any{
+		"command": "pprof explain_overhead",
+		"result":  result,
+	}
+	summary := fmt.Sprintf("Explanation generated for %s.", result.Category)
+	return marshalJSONWithSummary(summary, payload)
+}
+
+func pprofSuggestFixTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	result, err := pprof.RunSuggestFix(ctx, pprof.SuggestFixParams{
+		Profile:        getString(args, "profile"),
+		Issue:          getString(args, "issue"),
+		RepoRoot:       getString(args, "repo_root"),
+		TargetFunction: getString(args, "target_function"),
+		Mode:           getString(args, "mode"),
+		FixPR: pprof.FixPR{
+			OpenPR:        getBool(args, "open_pr"),
+			FixID:         getString(args, "fix_id"),
+			BaseBranch:    getString(args, "base_branch"),
+			Draft:         getBool(args, "draft"),
+			EvidenceLinks: parseStringList(args, "evidence_links"),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payload := map[string]any{
+		"command": "pprof suggest_fix",
+		"result":  result,
+	}
+	outputFormat := strings.ToLower(strings.TrimSpace(getString(args, "output_format")))
+	if outputFormat == "diff" {
+		diff := ""
+		if len(result.ApplicableFixes) > 0 {
+			diff = result.ApplicableFixes[0].Diff
+		}
+		return ToolOutput{Text: diff, Structured: payload}, nil
+	}
+	if outputFormat == "pr_description" {
+		desc := ""
+		if len(result.ApplicableFixes) > 0 {
+			desc = result.ApplicableFixes[0].PRDescription
+		}
+		return ToolOutput{Text: desc, Structured: payload}, nil
+	}
+
+	summary := fmt.Sprintf("Generated %d fix suggestions.", len(result.ApplicableFixes))
+	for _, fix := range result.ApplicableFixes {
+		if fix.PullRequest != nil {
+			summary += fmt.Sprintf(" Opened %s.", fix.PullRequest.URL)
+		}
+		if applied := fix.Applied; applied != nil {
+			tests := "not run"
+			if applied.Test != nil {
+				tests = passFail(applied.Test.Passed)
+			}
+			summary += fmt.Sprintf(" Applied %s: build %s, tests %s.", fix.FixID, passFail(applied.Build.Passed), tests)
+		}
+	}
+	return marshalJSONWithSummary(summary, payload)
+}
+
+func passFail(passed bool) string {
+	if passed {
+		return "passed"
+	}
+	return "failed"
+}
+
+func datadogProfilesListTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	result, err := datadog.ListProfiles(ctx, datadog.ListProfilesParams{
+		Service: getString(args, "service"),
+		Env:     getString(args, "env"),
+		From:    getString(args, "from"),
+		To:      getString(args, "to"),
+		Hours:   getInt(args, "hours", 72),
+		Limit:   getInt(args, "limit", 50),
+		Site:    getString(args, "site"),
+		Host:    getString(args, "host"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payload := map[string]any{
+		"command": fmt.Sprintf("profctl datadog profiles list --service %s --env %s", result.Service, result.Env),
+		"result":  result,
+	}
+
+	// Add hint when no profiles found to help with service name discovery
+	if len(result.Candidates) == 0 {
+		payload["hint"] = "No profiles found. Use datadog.services.search to find the correct service name."
+		payload["searched_service"] = result.Service
+		payload["searched_env"] = result.Env
+	}
+
+	summary := fmt.Sprintf("Found %d profiles for %s/%s from %s to %s.", len(result.Candidates), result.Service, result.Env, result.FromTS, result.ToTS)
+	return marshalJSONWithSummary(summary, payload)
+}
+
+func datadogProfilesPickTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	result, err := datadog.PickProfile(ctx, datadog.PickProfilesParams{
+		Service:  getString(args, "service"),
+		Env:      getString(args, "env"),
+		From:     getString(args, "from"),
+		To:       getString(args, "to"),
+		Hours:    getInt(args, "hours", 72),
+		Limit:    getInt(args, "limit", 50),
+		Site:     getString(args, "site"),
+		Host:     getString(args, "host"),
+		Strategy: datadog.PickStrategy(getString(args, "strategy")),
+		TargetTS: getString(args, "target_ts"),
+		Index:    getInt(args, "index", -1),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payload := map[string]any{
+		"command": fmt.Sprintf("profctl datadog profiles pick --service %s --env %s", getString(args, "service"), getString(args, "env")),
+		"result":  result,
+	}
+	return marshalJSON(payload)
+}
+
+func datadogProfilesAggregateTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	result, err := datadog.AggregateProfiles(ctx, datadog.AggregateProfilesParams{
+		Service:     getString(args, "service"),
+		Env:         getString(args, "env"),
+		Window:      getString(args, "window"),
+		Limit:       getInt(args, "limit", 10),
+		Site:        getString(args, "site"),
+		OutDir:      getString(args, "out_dir"),
+		ProfileType: getString(args, "profile_type"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	outputPath := ""
+	if len(result.ProfilePaths) == 1 {
+		outputPath = result.ProfilePaths[0]
+	} else {
+		mergePath, err := buildAggregateOutputPath(result.ProfileType, result.ProfilePaths[0])
+		if err != nil {
+			return nil, err
+		}
+		mergeResult, err := pprof.RunMerge(ctx, pprof.MergeParams{
+			Profiles:   result.ProfilePaths,
+			OutputPath: mergePath,
+		})
+		if err != nil {
+			return nil, err
+		}
+		outputPath = mergeResult.OutputPath
+	}
+
+	meta, err := pprof.RunMeta(outputPath)
+	if err != nil {
+		return nil, err
+	}
+	totalDuration := formatDurationNanos(meta.DurationNanos)
+
+	handle, err := profileRegistry.Register(profiles.Metadata{
+		Service:   result.Service,
+		Env:       result.Env,
+		Type:      result.ProfileType,
+		Timestamp: result.TimeRange.To,
+		Path:      outputPath,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payload := map[string]any{
+		"command": fmt.Sprintf("profctl datadog profiles aggregate --service %s --env %s --window %s", result.Service, result.Env, getString(args, "window")),
+		"result": map[string]any{
+			"handle":          handle,
+			"profile_type":    result.ProfileType,
+			"profiles_merged": len(result.ProfilePaths),
+			"time_range": map[string]any{
+				"from": result.TimeRange.From,
+				"to":   result.TimeRange.To,
+			},
+			"total_duration": totalDuration,
+			"hint":           fmt.Sprintf("Use pprof.top(profile=%q) to analyze aggregated data.", handle),
+			"warnings":       result.Warnings,
+		},
+	}
+	summary := fmt.Sprintf("Aggregated %d profiles into %s.", len(result.ProfilePaths), handle)
+	return marshalJSONWithSummary(summary, payload)
+}
+
+func repoServicesTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	repoRoot := getString(args, "repo_root")
+	if repoRoot == "" {
+		repoRoot = "."
+	}
+	items, err := services.Discover(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	env := getString(args, "env")
+	var known []datadog.ServiceInfo
+	var warnings []string
+	if getBool(args, "refresh_datadog") {
+		result, err := datadog.ListServicesWithProfiling(ctx, datadog.ListServicesParams{
+			Env:     env,
+			Site:    getString(args, "site"),
+			Minutes: 15,
+		})
+		if err != nil {
+			return nil, err
+		}
+		known = result.Services
+		datadog.CacheServices(known)
+		if err := datadog.WriteServicesCacheFile(datadog.ServicesCacheFilePath(), known); err != nil {
+			log.Printf("services cache: %v", err)
+		}
+	} else {
+		known = completion.DatadogServices(env)
+	}
+	if len(known) == 0 {
+		warnings = append(warnings, "no Datadog services cached; only config mappings were applied (pass refresh_datadog: true or run datadog.services.search first)")
+	}
+	services.MapDatadog(items, currentConfig(), known)
+
+	payload := map[string]any{
+		"command":  fmt.Sprintf("profctl repo services discover --repo_root %s", repoRoot),
+		"services": items,
+	}
+	if len(warnings) > 0 {
+		payload["warnings"] = warnings
+	}
+	return marshalJSON(payload)
+}
+
+func datadogServicesSearchTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	query := getString(args, "query")
+	env := getString(args, "env")
+	refresh := getBool(args, "refresh")
+	site := getString(args, "site")
+
+	var services []datadog.ServiceInfo
+	var cached bool
+	var cachedAt string
+
+	// Check cache first (unless refresh requested)
+	if !refresh {
+		if cachedServices, ok := datadog.GetCachedServices(env); ok {
+			services = cachedServices
+			cached = true
+			cachedAt = datadog.GetServicesCacheFetchedAt().Format(time.RFC3339)
+		}
+	}
+
+	// Fetch from Datadog if not cached
+	if len(services) == 0 {
+		result, err := datadog.ListServicesWithProfiling(ctx, datadog.ListServicesParams{
+			Env:     env,
+			Site:    site,
+			Minutes: 15, // Only look at recent profiles for speed
+		})
+		if err != nil {
+			return nil, err
+		}
+		services = result.Services
+		datadog.CacheServices(services)
+		if err := datadog.WriteServicesCacheFile(datadog.ServicesCacheFilePath(), services); err != nil {
+			log.Printf("services cache: %v", err)
+		}
+		cached = false
+		cachedAt = ""
+	}
+
+	// Filter by env prefix if specified and we got from cache (already filtered on fetch)
+	if env != "" && cached {
+		services = datadog.FilterServicesByEnvPrefix(services, env)
+	}
+
+	// Fuzzy match
+	matches := datadog.FuzzySearchServices(query, services)
+
+	// Limit to top 10 matches for readability
+	if len(matches) > 10 {
+		matches = matches[:10]
+	}
+
+	payload := map[string]any{
+		"command": fmt.Sprintf("datadog services search --query %q", query),
+		"result": map[string]any{
+			"query":     query,
+			"env":       env,
+			"matches":   matches,
+			"cached":    cached,
+			"total":     len(services),
+			"cached_at": cachedAt,
+		},
+	}
+
+	var summary string
+	if len(matches) == 0 {
+		summary = fmt.Sprintf("No services found matching %q. Found %d total services.", query, len(services))
+	} else {
+		summary = fmt.Sprintf("Found %d matching services for %q. Best match: %s (score: %.2f).", len(matches), query, matches[0].Service, matches[0].Score)
+	}
+
+	return marshalJSONWithSummary(summary, payload)
+}
+
+func datadogMetricsDiscoverTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	result, err := datadog.DiscoverMetrics(ctx, datadog.MetricsDiscoverParams{
+		Service: getString(args, "service"),
+		Env:     getString(args, "env"),
+		Site:    getString(args, "site"),
+		Query:   getString(args, "query"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	limits := textLimits(args)
+	table, tableMeta := applyTextLimits(datadog.FormatMetricsTable(result.Metrics), nil, limits)
+
+	payload := map[string]any{
+		"command":    fmt.Sprintf("profctl datadog metrics discover --service %s", getString(args, "service")),
+		"result":     result,
+		"table":      table,
+		"table_meta": tableMeta,
+		"raw_meta":   tableMeta,
+	}
+	return marshalJSON(payload)
+}
+
+func datadogProfilesCompareRangeTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	result, err := datadog.CompareRange(ctx, datadog.CompareRangeParams{
+		Service:     getString(args, "service"),
+		Env:         getString(args, "env"),
+		Site:        getString(args, "site"),
+		BeforeFrom:  getString(args, "before_from"),
+		BeforeTo:    getString(args, "before_to"),
+		AfterFrom:   getString(args, "after_from"),
+		AfterTo:     getString(args, "after_to"),
+		OutDir:      getString(args, "out_dir"),
+		ProfileType: getString(args, "profile_type"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	limits := textLimits(args)
+	formatted, formattedMeta := applyTextLimits(datadog.FormatCompareResult(result), nil, limits)
+
+	payload := map[string]any{
+		"command":        "profctl datadog profiles compare_range",
+		"result":         result,
+		"formatted":      formatted,
+		"formatted_meta": formattedMeta,
+		"raw_meta":       formattedMeta,
+	}
+	addStderr(payload, result.DiffStderr, result.DiffStderrMeta, limits)
+	return marshalJSON(payload)
+}
+
+func datadogProfilesNearEventTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	result, err := datadog.FindProfilesNearEvent(ctx, datadog.NearEventParams{
+		Service:   getString(args, "service"),
+		Env:       getString(args, "env"),
+		Site:      getString(args, "site"),
+		EventTime: getString(args, "event_time"),
+		Window:    getString(args, "window"),
+		Limit:     getInt(args, "limit", 10),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	limits := textLimits(args)
+	formatted, formattedMeta := applyTextLimits(datadog.FormatNearEventResult(result), nil, limits)
+
+	payload := map[string]any{
+		"command":        "profctl datadog profiles near_event",
+		"result":         result,
+		"formatted":      formatted,
+		"formatted_meta": formattedMeta,
+		"raw_meta":       formattedMeta,
+	}
+	return marshalJSON(payload)
+}
+
+func pprofTagsTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	result, err := pprof.RunTags(ctx, pprof.TagsParams{
+		Profile:     getString(args, "profile"),
+		Binary:      getString(args, "binary"),
+		TagFocus:    getString(args, "tag_focus"),
+		TagIgnore:   getString(args, "tag_ignore"),
+		TagShow:     getString(args, "tag_show"),
+		Cum:         getBool(args, "cum"),
+		NodeCount:   getInt(args, "nodecount", 0),
+		SampleIndex: getString(args, "sample_index"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	limits := textLimits(args)
+	raw, rawMeta := applyTextLimits(result.Raw, &result.RawMeta, limits)
+
+	payload := map[string]any{
+		"command":     result.Command,
+		"raw":         raw,
+		"raw_meta":    rawMeta,
+		"total_lines": rawMeta.TotalLines,
+		"truncated":   rawMeta.Truncated,
+	}
+	addStderr(payload, result.Stderr, result.StderrMeta, limits)
+	if len(result.Tags) > 0 {
+		payload["tags"] = result.Tags
+	}
+	return marshalJSON(payload)
+}
+
+func pprofFlamegraphTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	result, err := pprof.RunFlamegraph(ctx, pprof.FlamegraphParams{
+		Profile:     getString(args, "profile"),
+		Binary:      getString(args, "binary"),
+		OutputPath:  getString(args, "output_path"),
+		Focus:       getString(args, "focus"),
+		Ignore:      getString(args, "ignore"),
+		TagFocus:    getString(args, "tag_focus"),
+		TagIgnore:   getString(args, "tag_ignore"),
+		SampleIndex: getString(args, "sample_index"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payload := map[string]any{
+		"command":     result.Command,
+		"output_path": result.OutputPath,
+		"format":      result.Format,
+		"message":     result.Message,
+	}
+	if len(result.Warnings) > 0 {
+		payload["warnings"] = result.Warnings
+	}
+	addStderr(payload, result.Stderr, result.StderrMeta, textLimits(args))
+	return marshalJSON(payload)
+}
+
+func pprofCallgraphTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	result, err := pprof.RunCallgraph(ctx, pprof.CallgraphParams{
+		Profile:     getString(args, "profile"),
+		Binary:      getString(args, "binary"),
+		OutputPath:  getString(args, "output_path"),
+		Format:      getString(args, "format"),
+		Focus:       getString(args, "focus"),
+		Ignore:      getString(args, "ignore"),
+		NodeCount:   getInt(args, "nodecount", 0),
+		EdgeFrac:    getFloat(args, "edge_frac", 0),
+		NodeFrac:    getFloat(args, "node_frac", 0),
+		SampleIndex: getString(args, "sample_index"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payload := map[string]any{
+		"command":     result.Command,
+		"output_path": result.OutputPath,
+		"format":      result.Format,
+		"message":     result.Message,
+	}
+	if len(result.Warnings) > 0 {
+		payload["warnings"] = result.Warnings
+	}
+	addStderr(payload, result.Stderr, result.StderrMeta, textLimits(args))
+	return marshalJSON(payload)
+}
+
+func pprofFocusPathsTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	result, err := pprof.RunFocusPaths(ctx, pprof.FocusPathsParams{
+		Profile:     getString(args, "profile"),
+		Binary:      getString(args, "binary"),
+		Function:    getString(args, "function"),
+		Cum:         getBool(args, "cum"),
+		NodeCount:   getInt(args, "nodecount", 0),
+		SampleIndex: getString(args, "sample_index"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	limits := textLimits(args)
+	raw, rawMeta := applyTextLimits(result.Raw, &result.RawMeta, limits)
+
+	payload := map[string]any{
+		"command":     result.Command,
+		"raw":         raw,
+		"raw_meta":    rawMeta,
+		"total_lines": rawMeta.TotalLines,
+		"truncated":   rawMeta.Truncated,
+	}
+	addStderr(payload, result.Stderr, result.StderrMeta, limits)
+	return marshalJSON(payload)
+}
+
+func pprofMergeTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	result, err := pprof.RunMerge(ctx, pprof.MergeParams{
+		Profiles:   parseStringList(args, "profiles"),
+		Binary:     getString(args, "binary"),
+		OutputPath: getString(args, "output_path"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payload := map[string]any{
+		"command":     result.Command,
+		"output_path": result.OutputPath,
+		"input_count": result.InputCount,
+		"message":     result.Message,
+	}
+	addStderr(payload, result.Stderr, result.StderrMeta, textLimits(args))
+	return marshalJSON(payload)
+}
+
+func functionHistoryTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	result, err := datadog.SearchFunctionHistory(ctx, datadog.FunctionHistoryParams{
+		Service:  getString(args, "service"),
+		Env:      getString(args, "env"),
+		Function: getString(args, "function"),
+		From:     getString(args, "from"),
+		To:       getString(args, "to"),
+		Hours:    getInt(args, "hours", 72),
+		Limit:    getInt(args, "limit", 10),
+		Site:     getString(args, "site"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	limits := textLimits(args)
+	table, tableMeta := applyTextLimits(datadog.FormatFunctionHistoryTable(result), nil, limits)
+
+	payload := map[string]any{
+		"command": fmt.Sprintf("profctl function-history --service %s --env %s --function %s",
+			result.Service, result.Env, result.Function),
+		"result":     result,
+		"table":      table,
+		"table_meta": tableMeta,
+		"raw_meta":   tableMeta,
+	}
+	summary := fmt.Sprintf("Function %s found in %d/%d profiles.", result.Function, result.Summary.FoundInProfiles, result.Summary.TotalProfiles)
+	return marshalJSONWithSummary(summary, payload)
+}
+
+func pprofAllocPathsTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	result, err := pprof.RunAllocPaths(pprof.AllocPathsParams{
+		Profile:       getString(args, "profile"),
+		MinPercent:    getFloat(args, "min_percent", 1.0),
+		MaxPaths:      getInt(args, "max_paths", 20),
+		RepoPrefixes:  parseStringList(args, "repo_prefix"),
+		GroupBySource: getBool(args, "group_by_source"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payload := map[string]any{
+		"command": "pprof alloc_paths",
+		"result":  result,
+	}
+	if len(result.Warnings) > 0 {
+		payload["warnings"] = result.Warnings
+	}
+	summary := fmt.Sprintf("Analyzed %s total allocations, found %d allocation paths above threshold.",
+		result.TotalAllocStr, len(result.Paths))
+	return marshalJSONWithSummary(summary, payload)
+}
+
+func pprofOverheadReportTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	profilePath := getString(args, "profile")
+
+	prof, err := loadProfile(profilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load profile: %w", err)
+	}
+
+	// Find sample index
+	sampleIndex := 0
+	if si := getString(args, "sample_index"); si != "" {
+		for i, st := range prof.SampleType {
+			if st.Type == si {
+				sampleIndex = i
+				break
+			}
+		}
+	}
+
+	result := pprof.DetectOverhead(prof, sampleIndex)
+
+	payload := map[string]any{
+		"command": "pprof overhead_report",
+		"result":  result,
+	}
+
+	// Generate hints for high-overhead categories
+	hints := pprof.GenerateOverheadHints(result)
+	if len(hints) > 0 {
+		payload["hints"] = hints
+	}
+
+	summary := fmt.Sprintf("Total observability overhead: %.1f%% (%d categories detected)",
+		result.TotalOverhead, len(result.Detections))
+	return marshalJSONWithSummary(summary, payload)
+}
+
+func pprofGenerateReportTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	inputs, err := parseReportInputs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := pprof.GenerateReport(pprof.ReportParams{
+		Title:    getString(args, "title"),
+		Inputs:   inputs,
+		GroupBy:  getString(args, "group_by"),
+		RepoRoot: getString(args, "repo_root"),
+		Teams:    currentConfig().Teams,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	limits := textLimits(args)
+	markdown, markdownMeta := applyTextLimits(result.Markdown, nil, limits)
+
+	payloadResult := map[string]any{
+		"markdown":      markdown,
+		"markdown_meta": markdownMeta,
+		"raw_meta":      markdownMeta,
+	}
+	summary := fmt.Sprintf("Generated report with %d sections.", result.SectionCount)
+	if result.Teams != nil {
+		teams := make([]map[string]any, 0, len(result.Teams))
+		for _, team := range result.Teams {
+			teamMarkdown, teamMeta := applyTextLimits(team.Markdown, nil, limits)
+			teams = append(teams, map[string]any{
+				"team":          team.Team,
+				"markdown":      teamMarkdown,
+				"markdown_meta": teamMeta,
+				"hotspots":      team.Hotspots,
+			})
+		}
+		payloadResult["teams"] = teams
+		summary = fmt.Sprintf("Generated report with %d sections for %d teams.", result.SectionCount, len(result.Teams))
+	}
+	payload := map[string]any{
+		"command": "pprof generate_report",
+		"result":  payloadResult,
+	}
+	return marshalJSONWithSummary(summary, payload)
+}
+
+func pprofDetectRepoTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	profilePath := getString(args, "profile")
+
+	prof, err := loadProfile(profilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load profile: %w", err)
+	}
+
+	result := pprof.DetectRepoFromProfile(prof)
+
+	payload := map[string]any{
+		"command": "pprof detect_repo",
+		"result":  result,
+	}
+
+	var summary string
+	if result.DetectedRoot != "" {
+		summary = fmt.Sprintf("Detected local repo at %s (confidence: %s)", result.DetectedRoot, result.Confidence)
+	} else {
+		summary = fmt.Sprintf("Found %d module paths but no local repo match", len(result.ModulePaths))
+	}
+	return marshalJSONWithSummary(summary, payload)
+}
+
+func loadProfile(path string) (*profile.Profile, error) {
+	return pprof.LoadProfile(path)
+}
+
+func getString(args map[string]any, key string) string {
+	if val, ok := args[key]; ok {
+		switch typed := val.(type) {
+		case string:
+			return typed
+		case fmt.Stringer:
+			return typed.String()
+		}
+	}
+	return ""
+}
+
+func getInt(args map[string]any, key string, fallback int) int {
+	if val, ok := args[key]; ok {
+		switch typed := val.(type) {
+		case int:
+			return typed
+		case int64:
+			return int(typed)
+		case float64:
+			return int(typed)
+		case json.Number:
+			parsed, err := typed.Int64()
+			if err == nil {
+				return int(parsed)
+			}
+		case string:
+			parsed, err := strconv.Atoi(typed)
+			if err == nil {
+				return parsed
+			}
+		}
+	}
+	return fallback
+}
+
+func getBool(args map[string]any, key string) bool {
+	if val, ok := args[key]; ok {
+		switch typed := val.(type) {
+		case bool:
+			return typed
+		case string:
+			parsed, err := strconv.ParseBool(typed)
+			if err == nil {
+				return parsed
+			}
+		}
+	}
+	return false
+}
+
+func getFloat(args map[string]any, key string, fallback float64) float64 {
+	if val, ok := args[key]; ok {
+		switch typed := val.(type) {
+		case float64:
+			return typed
+		case float32:
+			return float64(typed)
+		case int:
+			return float64(typed)
+		case int64:
+			return float64(typed)
+		case json.Number:
+			parsed, err := typed.Float64()
+			if err == nil {
+				return parsed
+			}
+		case string:
+			parsed, err := strconv.ParseFloat(typed, 64)
+			if err == nil {
+				return parsed
+			}
+		}
+	}
+	return fallback
+}
+
+func parseStringList(args map[string]any, key string) []string {
+	raw, ok := args[key]
+	if !ok {
+		return nil
+	}
+	switch typed := raw.(type) {
+	case []any:
+		values := make([]string, 0, len(typed))
+		for _, item := range typed {
+			if str, ok := item.(string); ok {
+				values = append(values, str)
+			}
+		}
+		return values
+	case []string:
+		return typed
+	case string:
+		return []string{typed}
+	default:
+		return nil
+	}
+}
+
+func parseRegressionChecks(args map[string]any) ([]pprof.RegressionCheckSpec, error) {
+	raw, ok := args["checks"]
+	if !ok {
+		return nil, fmt.Errorf("checks are required")
+	}
+	items, ok := raw.([]any)
+	if !ok {
+		return nil, fmt.Errorf("checks must be an array")
+	}
+	checks := make([]pprof.RegressionCheckSpec, 0, len(items))
+	for _, item := range items {
+		obj, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("check entries must be objects")
+		}
+		function, _ := obj["function"].(string)
+		metric, _ := obj["metric"].(string)
+		max, ok := floatFromAny(obj["max"])
+		if !ok {
+			return nil, fmt.Errorf("check max must be a number")
+		}
+		checks = append(checks, pprof.RegressionCheckSpec{
+			Function: function,
+			Metric:   metric,
+			Max:      max,
+		})
+	}
+	return checks, nil
+}
+
+func floatFromAny(value any) (float64, bool) {
+	switch typed := value.(type) {
+	case float64:
+		return typed, true
+	case float32:
+		return float64(typed), true
+	case int:
+		return float64(typed), true
+	case int64:
+		return float64(typed), true
+	case json.Number:
+		parsed, err := typed.Float64()
+		if err == nil {
+			return parsed, true
+		}
+	case string:
+		parsed, err := strconv.ParseFloat(typed, 64)
+		if err == nil {
+			return parsed, true
+		}
+	}
+	return 0, false
+}
+
+func formatDurationNanos(nanos int64) string {
+	if nanos <= 0 {
+		return ""
+	}
+	seconds := float64(nanos) / 1e9
+	return fmt.Sprintf("%.1fs", seconds)
+}
+
+func buildAggregateOutputPath(profileType, samplePath string) (string, error) {
+	if samplePath == "" {
+		return "", fmt.Errorf("sample path required to build output path")
+	}
+	dir := filepath.Dir(samplePath)
+	if dir == "" {
+		dir = "."
+	}
+	name := fmt.Sprintf("merged_%s_%d.pprof", profileType, time.Now().Unix())
+	return filepath.Join(dir, name), nil
+}
+
+func parseReportInputs(args map[string]any) ([]pprof.ReportInput, error) {
+	raw, ok := args["inputs"]
+	if !ok {
+		return nil, fmt.Errorf("inputs are required")
+	}
+	items, ok := raw.([]any)
+	if !ok {
+		return nil, fmt.Errorf("inputs must be an array")
+	}
+	inputs := make([]pprof.ReportInput, 0, len(items))
+	for idx, item := range items {
+		entry, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("inputs[%d] must be an object", idx)
+		}
+		kind := getString(entry, "kind")
+		if kind == "" {
+			return nil, fmt.Errorf("inputs[%d] missing kind", idx)
+		}
+		dataRaw, ok := entry["data"]
+		if !ok {
+			return nil, fmt.Errorf("inputs[%d] missing data", idx)
+		}
+		data, ok := dataRaw.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("inputs[%d].data must be an object", idx)
+		}
+		inputs = append(inputs, pprof.ReportInput{
+			Kind:  kind,
+			Data:  data,
+			Title: getString(entry, "title"),
+		})
+	}
+	return inputs, nil
+}
+
+// Temporal SDK analysis tool
+func pprofTemporalAnalysisTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	result, err := pprof.RunTemporalAnalysis(pprof.TemporalAnalysisParams{
+		Profile: getString(args, "profile"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payload := map[string]any{
+		"command": "pprof temporal_analysis",
+		"result":  result,
+	}
+
+	// Build summary
+	summary := fmt.Sprintf("Temporal SDK Analysis: %d goroutines, %d activity pollers, %d workflow pollers, %d cached workflows, %d active activities",
+		result.TotalGoroutines,
+		result.InferredSettings.MaxConcurrentActivityTaskPollers,
+		result.InferredSettings.MaxConcurrentWorkflowTaskPollers,
+		result.InferredSettings.CachedWorkflows,
+		result.InferredSettings.ActiveActivities)
+
+	return marshalJSONWithSummary(summary, payload)
+}
+
+// Goroutine categorization tool
+func pprofGoroutineCategorizeTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	// Parse categories
+	categories := make(map[string]string)
+	if categoriesArg, ok := args["categories"].(map[string]any); ok {
+		for name, pattern := range categoriesArg {
+			if patternStr, ok := pattern.(string); ok {
+				categories[name] = patternStr
+			}
+		}
+	}
+
+	// Parse presets
+	var presets []string
+	if presetsArg := args["presets"]; presetsArg != nil {
+		switch v := presetsArg.(type) {
+		case []interface{}:
+			for _, p := range v {
+				if ps, ok := p.(string); ok {
+					presets = append(presets, ps)
+				}
+			}
+		case []string:
+			presets = v
+		case string:
+			presets = []string{v}
+		}
+	}
+
+	result, err := pprof.RunGoroutineCategorize(pprof.GoroutineCategorizeParams{
+		Profile:    getString(args, "profile"),
+		Categories: categories,
+		Presets:    presets,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payload := map[string]any{
+		"command": "pprof goroutine_categorize",
+		"result":  result,
+	}
+
+	summary := fmt.Sprintf("Categorized %d goroutines into %d categories (%d uncategorized)",
+		result.TotalGoroutines, len(result.Categories), result.Uncategorized)
+
+	return marshalJSONWithSummary(summary, payload)
+}
+
+// Datadog metrics at timestamp tool
+func datadogMetricsAtTimestampTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	// Parse metrics list
+	var metrics []string
+	if metricsArg := args["metrics"]; metricsArg != nil {
+		switch v := metricsArg.(type) {
+		case []interface{}:
+			for _, m := range v {
+				if ms, ok := m.(string); ok {
+					metrics = append(metrics, ms)
+				}
+			}
+		case []string:
+			metrics = v
+		}
+	}
+
+	result, err := datadog.QueryMetricsAtTimestamp(ctx, datadog.MetricsAtTimestampParams{
+		Service:   getString(args, "service"),
+		Env:       getString(args, "env"),
+		Site:      firstNonEmpty(getString(args, "site"), getString(args, "dd_site")),
+		Timestamp: getString(args, "timestamp"),
+		Window:    getString(args, "window"),
+		Metrics:   metrics,
+		PodName:   getString(args, "pod_name"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payload := map[string]any{
+		"command": fmt.Sprintf("datadog metrics query service:%s env:%s at %s", result.Service, result.Env, result.CenterTime.Format(time.RFC3339)),
+		"result":  result,
+	}
+
+	summary := fmt.Sprintf("Fetched %d metrics for %s/%s around %s",
+		len(result.Metrics), result.Service, result.Env, result.CenterTime.Format(time.RFC3339))
+
+	return marshalJSONWithSummary(summary, payload)
+}
+
+func buildDownloadCommand(service, env, outDir string, hours int, site, profileID, eventID, host string) string {
+	base := fmt.Sprintf("profctl download --service %s --env %s --out %s --hours %d", service, env, outDir, hours)
+	if profileID != "" {
+		base += " --profile_id " + profileID
+	}
+	if eventID != "" {
+		base += " --event_id " + eventID
+	}
+	if site != "" {
+		base += " --dd_site " + site
+	}
+	if host != "" {
+		base += " --host " + host
+	}
+	return base
+}
+
+func marshalJSON(payload any) (ToolOutput, error) {
+	return marshalJSONWithSummary("", payload)
+}
+
+func marshalJSONWithSummary(summary string, payload any) (ToolOutput, error) {
+	data, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return ToolOutput{}, err
+	}
+	if len(data) == 0 {
+		return ToolOutput{}, errors.New("empty JSON response")
+	}
+	text := string(data)
+	if summary != "" {
+		text = summary + "\n\n" + text
+	}
+	return ToolOutput{Text: text, Structured: payload}, nil
+}
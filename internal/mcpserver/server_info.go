@@ -0,0 +1,198 @@
+package mcpserver
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/config"
+	"github.com/arreyder/pprof-mcp/internal/d2"
+	"github.com/arreyder/pprof-mcp/internal/incident"
+	"github.com/arreyder/pprof-mcp/internal/k8s"
+	"github.com/arreyder/pprof-mcp/internal/pprof"
+)
+
+// dependencyProbeTimeout bounds each external "--version" probe.
+const dependencyProbeTimeout = 5 * time.Second
+
+// dependencyProbe describes how to detect an external tool.
+type dependencyProbe struct {
+	name    string
+	binary  string
+	args    []string
+	purpose string
+}
+
+var dependencyProbes = []dependencyProbe{
+	{name: "go tool pprof", binary: "go", args: []string{"version"}, purpose: "all pprof.* analysis tools"},
+	{name: "graphviz", binary: "dot", args: []string{"-V"}, purpose: "pprof.callgraph svg/png and SVG flame graphs (DOT and HTML fallbacks without it)"},
+	{name: "kubectl", binary: "kubectl", args: []string{"version", "--client"}, purpose: "d2 profile capture"},
+	{name: "tilt", binary: "tilt", args: []string{"version"}, purpose: "pprof.branch_impact rebuilds (dev_env=tilt)"},
+	{name: "docker", binary: "docker", args: []string{"compose", "version"}, purpose: "pprof.branch_impact rebuilds (dev_env=compose)"},
+	{name: "skaffold", binary: "skaffold", args: []string{"version"}, purpose: "pprof.branch_impact rebuilds (dev_env=skaffold)"},
+	{name: "git", binary: "git", args: []string{"--version"}, purpose: "pprof.branch_impact and source resolution"},
+}
+
+// probeDependency reports whether a tool is on PATH and its first line of
+// version output.
+func probeDependency(ctx context.Context, probe dependencyProbe) map[string]any {
+	info := map[string]any{
+		"name":      probe.name,
+		"binary":    probe.binary,
+		"purpose":   probe.purpose,
+		"available": false,
+	}
+	path, err := exec.LookPath(probe.binary)
+	if err != nil {
+		info["error"] = fmt.Sprintf("%s not found on PATH", probe.binary)
+		return info
+	}
+	info["available"] = true
+	info["path"] = path
+
+	ctx, cancel := context.WithTimeout(ctx, dependencyProbeTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, path, probe.args...).CombinedOutput()
+	if err != nil {
+		info["error"] = fmt.Sprintf("%s %s failed: %v", probe.binary, strings.Join(probe.args, " "), err)
+	}
+	if line, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\n"); line != "" {
+		info["version"] = strings.TrimSpace(line)
+	}
+	return info
+}
+
+func dataSourcesInfo() map[string]any {
+	hasKeys := os.Getenv("DD_API_KEY") != "" && os.Getenv("DD_APP_KEY") != ""
+	datadogInfo := map[string]any{
+		"available": hasKeys,
+		"site":      firstNonEmpty(os.Getenv("DD_SITE"), "us3.datadoghq.com"),
+	}
+	if !hasKeys {
+		datadogInfo["notes"] = "Set DD_API_KEY and DD_APP_KEY to enable datadog.* and profiles.download_latest_bundle."
+	}
+	d2Info := map[string]any{
+		"available": d2.IsD2Environment(),
+	}
+	if !d2.IsD2Environment() {
+		d2Info["notes"] = "Set d2=true to capture profiles from a local d2 cluster."
+	}
+	kubernetesInfo := map[string]any{
+		"mode": k8s.Mode(),
+	}
+	if k8s.Mode() == k8s.ModeInCluster {
+		kubernetesInfo["available"] = true
+		kubernetesInfo["notes"] = "Using the pod's service account; kube_context is not supported and pprof is fetched through the API server's pod proxy."
+	} else {
+		_, err := exec.LookPath("kubectl")
+		kubernetesInfo["available"] = err == nil
+		if err != nil {
+			kubernetesInfo["notes"] = "Install kubectl, or run the server in a pod (PPROF_MCP_KUBE_MODE=in-cluster) to use k8s.profiles.capture."
+		}
+	}
+	return map[string]any{
+		"datadog":    datadogInfo,
+		"d2":         d2Info,
+		"kubernetes": kubernetesInfo,
+		"pyroscope": map[string]any{
+			"available": false,
+			"notes":     "Pyroscope is not supported by this server.",
+		},
+	}
+}
+
+func pathsInfo() map[string]any {
+	cfg := sandbox()
+	roots := cfg.roots
+	if roots == nil {
+		roots = []string{}
+	}
+	return map[string]any{
+		"config_file":           firstNonEmpty(currentConfig().File(), config.Path()),
+		"config_loaded":         currentConfig().File() != "",
+		"policy_file":           policyFilePath(),
+		"basedir":               strings.TrimSpace(os.Getenv("PPROF_MCP_BASEDIR")),
+		"allowed_roots":         roots,
+		"workspace":             cfg.workspace,
+		"incident_profiles_dir": incident.ProfilesDir(),
+	}
+}
+
+func policyInfo(p *toolPolicy) map[string]any {
+	info := map[string]any{
+		"configured":         p != nil,
+		"disabled_tools":     []string{},
+		"datadog_services":   []string{},
+		"datadog_envs":       []string{},
+		"max_download_bytes": 0,
+		"redact_patterns":    0,
+	}
+	if p == nil {
+		return info
+	}
+	if p.DisabledTools != nil {
+		info["disabled_tools"] = p.DisabledTools
+	}
+	if p.Datadog.Services != nil {
+		info["datadog_services"] = p.Datadog.Services
+	}
+	if p.Datadog.Envs != nil {
+		info["datadog_envs"] = p.Datadog.Envs
+	}
+	info["max_download_bytes"] = p.MaxDownloadBytes
+	info["redact_patterns"] = len(p.Redact)
+	return info
+}
+
+func serverInfoTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	dependencies := make([]map[string]any, 0, len(dependencyProbes))
+	missing := []string{}
+	for _, probe := range dependencyProbes {
+		info := probeDependency(ctx, probe)
+		if info["available"] != true {
+			missing = append(missing, probe.name)
+		}
+		dependencies = append(dependencies, info)
+	}
+
+	payload := map[string]any{
+		"command": "server.info",
+		"server": map[string]any{
+			"name":       serverName,
+			"version":    serverVersion,
+			"go_version": runtime.Version(),
+			"platform":   runtime.GOOS + "/" + runtime.GOARCH,
+		},
+		"data_sources":  dataSourcesInfo(),
+		"dependencies":  dependencies,
+		"pprof":         pprof.DetectTool(ctx),
+		"paths":         pathsInfo(),
+		"policy":        policyInfo(currentPolicy()),
+		"profile_cache": pprof.ProfileCache(),
+	}
+
+	summary := fmt.Sprintf("%s %s", serverName, serverVersion)
+	if len(missing) > 0 {
+		summary += fmt.Sprintf("; missing: %s", strings.Join(missing, ", "))
+	}
+	return marshalJSONWithSummary(summary, payload)
+}
+
+// logPprofTool probes pprof at startup so the first tool call does not pay
+// for it, and logs what was found.
+func logPprofTool(ctx context.Context) {
+	info := pprof.DetectTool(ctx)
+	switch {
+	case info.Error != "":
+		log.Printf("pprof probe failed: %s", info.Error)
+	case len(info.Unsupported) > 0:
+		log.Printf("Using %s %s; it lacks %s, which will be dropped or replaced", info.Command, info.Version, strings.Join(info.Unsupported, ", "))
+	default:
+		log.Printf("Using %s %s", info.Command, info.Version)
+	}
+}
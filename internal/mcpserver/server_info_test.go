@@ -0,0 +1,47 @@
+package mcpserver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestServerInfoReportsCapabilities(t *testing.T) {
+	t.Setenv("DD_API_KEY", "")
+	t.Setenv("PATH", t.TempDir())
+	p, err := parsePolicy([]byte(`disabled_tools: ["d2.*"]` + "\nmax_download_bytes: 1024\n"))
+	if err != nil {
+		t.Fatalf("parse policy: %v", err)
+	}
+	setPolicy(p)
+	defer setPolicy(nil)
+
+	session := connectTestSession(t)
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "server.info", Arguments: map[string]any{}})
+	if err != nil {
+		t.Fatalf("call tool: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("unexpected error: %v", res.Content)
+	}
+	payload := res.StructuredContent.(map[string]any)
+
+	if payload["server"].(map[string]any)["version"] != serverVersion {
+		t.Fatalf("unexpected server info: %v", payload["server"])
+	}
+	sources := payload["data_sources"].(map[string]any)
+	if sources["datadog"].(map[string]any)["available"] != false {
+		t.Fatalf("datadog should be unavailable without keys: %v", sources["datadog"])
+	}
+	for _, dep := range payload["dependencies"].([]any) {
+		entry := dep.(map[string]any)
+		if entry["available"] != false || entry["error"] == nil {
+			t.Fatalf("expected %v to be reported missing with an empty PATH", entry["name"])
+		}
+	}
+	policy := payload["policy"].(map[string]any)
+	if policy["configured"] != true || policy["max_download_bytes"] != float64(1024) {
+		t.Fatalf("unexpected policy summary: %v", policy)
+	}
+}
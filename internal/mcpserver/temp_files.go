@@ -0,0 +1,83 @@
+package mcpserver
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/tempfiles"
+)
+
+// tempSweepInterval is how often the server removes temp files and dirs left
+// by processes that exited (including earlier runs of itself).
+const tempSweepInterval = 10 * time.Minute
+
+// sweepTempFiles sweeps leaked temps at startup and then periodically until
+// ctx is done.
+func sweepTempFiles(ctx context.Context) {
+	ticker := time.NewTicker(tempSweepInterval)
+	defer ticker.Stop()
+	for {
+		removed, err := tempfiles.Sweep()
+		if err != nil {
+			log.Printf("temp sweep failed: %v", err)
+		} else if len(removed) > 0 {
+			log.Printf("Removed %d leaked temp files and dirs", len(removed))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func serverTempFilesTool(ctx context.Context, args map[string]any) (interface{}, error) {
+	registered, err := tempfiles.List()
+	if err != nil {
+		return nil, fmt.Errorf("reading the temp registry: %w", err)
+	}
+	entries := make([]map[string]any, 0, len(registered))
+	leaked, leakedBytes := 0, int64(0)
+	for _, entry := range registered {
+		_, statErr := os.Stat(entry.Path)
+		size := tempfiles.Size(entry.Path)
+		info := map[string]any{
+			"path":   entry.Path,
+			"pid":    entry.PID,
+			"own":    entry.PID == os.Getpid(),
+			"exists": statErr == nil,
+			"bytes":  size,
+			"leaked": entry.Leaked(),
+		}
+		if !entry.Created.IsZero() {
+			info["created"] = entry.Created.Format(time.RFC3339)
+			info["age_seconds"] = int64(time.Since(entry.Created).Seconds())
+		}
+		if entry.Leaked() {
+			leaked++
+			leakedBytes += size
+		}
+		entries = append(entries, info)
+	}
+	unregistered := []map[string]any{}
+	for _, path := range tempfiles.Unregistered(registered) {
+		unregistered = append(unregistered, map[string]any{"path": path, "bytes": tempfiles.Size(path)})
+	}
+
+	payload := map[string]any{
+		"command":        "server.temp_files",
+		"registry":       tempfiles.RegistryDir(),
+		"sweep_interval": tempSweepInterval.String(),
+		"max_age":        tempfiles.MaxAge.String(),
+		"entries":        entries,
+		"leaked":         leaked,
+		"leaked_bytes":   leakedBytes,
+		"unregistered":   unregistered,
+	}
+	summary := fmt.Sprintf("%d temp files/dirs registered, %d leaked (%d bytes); %d unregistered leftovers in %s",
+		len(entries), leaked, leakedBytes, len(unregistered), os.TempDir())
+	return marshalJSONWithSummary(summary, payload)
+}
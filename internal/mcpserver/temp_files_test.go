@@ -0,0 +1,46 @@
+package mcpserver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/arreyder/pprof-mcp/internal/tempfiles"
+)
+
+func TestServerTempFilesListsRegisteredTemps(t *testing.T) {
+	t.Setenv("PPROF_MCP_TEMP_REGISTRY", t.TempDir())
+	tmp, err := tempfiles.MkdirTemp(t.TempDir(), "pprof-compare-*")
+	if err != nil {
+		t.Fatalf("mkdir temp: %v", err)
+	}
+	defer tmp.Remove()
+	if err := os.WriteFile(filepath.Join(tmp.Path, "cpu.pprof"), []byte("12345"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	session := connectTestSession(t)
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "server.temp_files", Arguments: map[string]any{}})
+	if err != nil {
+		t.Fatalf("call tool: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("unexpected error: %v", res.Content)
+	}
+	payload := res.StructuredContent.(map[string]any)
+	entries := payload["entries"].([]any)
+	if len(entries) != 1 {
+		t.Fatalf("expected one registered temp, got %v", entries)
+	}
+	entry := entries[0].(map[string]any)
+	if entry["path"] != tmp.Path || entry["own"] != true || entry["leaked"] != false || entry["bytes"] != float64(5) {
+		t.Fatalf("unexpected entry: %v", entry)
+	}
+	if payload["leaked"] != float64(0) || payload["max_age"] != tempfiles.MaxAge.String() || payload["sweep_interval"] != (10*time.Minute).String() {
+		t.Fatalf("unexpected payload: %v", payload)
+	}
+}
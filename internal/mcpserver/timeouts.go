@@ -0,0 +1,225 @@
+package mcpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+	"github.com/arreyder/pprof-mcp/internal/config"
+	"github.com/arreyder/pprof-mcp/internal/pprof"
+	"github.com/arreyder/pprof-mcp/internal/textutil"
+)
+
+const (
+	defaultToolTimeout = 5 * time.Minute
+	maxTimeoutSeconds  = 3600
+	partialOutputGrace = 250 * time.Millisecond
+	// partialOutputMaxLines bounds the partial stdout echoed in timeout errors.
+	partialOutputMaxLines = 200
+)
+
+// defaultToolTimeouts overrides defaultToolTimeout for tools that rebuild
+// services or download many profiles.
+var defaultToolTimeouts = map[string]time.Duration{
+	"pprof.branch_impact":            30 * time.Minute,
+	"pprof.branch_impact.execute":    30 * time.Minute,
+	"pprof.coverage_hotspots":        15 * time.Minute,
+	"pprof.discover":                 10 * time.Minute,
+	"pprof.resolve_binary":           15 * time.Minute,
+	"pprof.suggest_fix":              15 * time.Minute,
+	"datadog.profiles.aggregate":     10 * time.Minute,
+	"datadog.profiles.compare_range": 10 * time.Minute,
+	"datadog.function_history":       10 * time.Minute,
+	"k8s.profiles.capture":           10 * time.Minute,
+	"k8s.profiles.capture_job":       40 * time.Minute,
+	"k8s.profiles.compare_clusters":  10 * time.Minute,
+	"k8s.profiles.compare_canary":    10 * time.Minute,
+	"k8s.profiles.debug_capture":     10 * time.Minute,
+}
+
+var (
+	toolTimeoutsOnce sync.Once
+	toolTimeoutsVal  toolTimeoutConfig
+)
+
+type toolTimeoutConfig struct {
+	fallback time.Duration
+	perTool  map[string]time.Duration
+}
+
+// toolTimeouts reads PPROF_MCP_TOOL_TIMEOUT (seconds, applies to every tool)
+// and PPROF_MCP_TOOL_TIMEOUTS ("pprof.top=60,pprof.discover=900"), falling
+// back to the timeouts section of the current (possibly reloaded) config file.
+func toolTimeouts() toolTimeoutConfig {
+	toolTimeoutsOnce.Do(func() {
+		toolTimeoutsVal = parseToolTimeouts(os.Getenv("PPROF_MCP_TOOL_TIMEOUT"), os.Getenv("PPROF_MCP_TOOL_TIMEOUTS"))
+	})
+	return toolTimeoutsVal.withConfig(currentConfig().Timeouts)
+}
+
+// withConfig returns a copy with timeouts not set through the environment
+// filled from the config file.
+func (c toolTimeoutConfig) withConfig(timeouts config.Timeouts) toolTimeoutConfig {
+	merged := toolTimeoutConfig{fallback: c.fallback, perTool: make(map[string]time.Duration, len(c.perTool)+len(timeouts.Tools))}
+	for name, timeout := range c.perTool {
+		merged.perTool[name] = timeout
+	}
+	if merged.fallback == 0 && timeouts.Default > 0 {
+		merged.fallback = time.Duration(timeouts.Default) * time.Second
+	}
+	for name, seconds := range timeouts.Tools {
+		if _, ok := merged.perTool[name]; !ok && seconds > 0 {
+			merged.perTool[name] = time.Duration(seconds) * time.Second
+		}
+	}
+	return merged
+}
+
+func parseToolTimeouts(fallbackRaw, perToolRaw string) toolTimeoutConfig {
+	cfg := toolTimeoutConfig{fallback: 0, perTool: map[string]time.Duration{}}
+	if seconds, err := strconv.Atoi(strings.TrimSpace(fallbackRaw)); err == nil && seconds > 0 {
+		cfg.fallback = time.Duration(seconds) * time.Second
+	}
+	for _, entry := range strings.Split(perToolRaw, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+		seconds, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || seconds <= 0 {
+			continue
+		}
+		cfg.perTool[strings.TrimSpace(name)] = time.Duration(seconds) * time.Second
+	}
+	return cfg
+}
+
+// timeoutForTool resolves the execution timeout: the timeout_seconds argument
+// wins, then per-tool config, then the global config, then built-in defaults.
+func timeoutForTool(cfg toolTimeoutConfig, canonicalName string, args map[string]any) time.Duration {
+	if seconds := getInt(args, "timeout_seconds", 0); seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if timeout, ok := cfg.perTool[canonicalName]; ok {
+		return timeout
+	}
+	if cfg.fallback > 0 {
+		return cfg.fallback
+	}
+	if timeout, ok := defaultToolTimeouts[canonicalName]; ok {
+		return timeout
+	}
+	return defaultToolTimeout
+}
+
+type handlerOutcome struct {
+	value any
+	err   error
+}
+
+// runWithTimeout runs handler under a deadline. Handlers that ignore ctx keep
+// running in the background, but the MCP call returns when the deadline fires.
+func runWithTimeout(ctx context.Context, timeout time.Duration, handler ToolHandler, args map[string]any) (any, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan handlerOutcome, 1)
+	go func() {
+		value, err := handler(ctx, args)
+		done <- handlerOutcome{value: value, err: err}
+	}()
+
+	select {
+	case outcome := <-done:
+		return outcome.value, outcome.err
+	case <-ctx.Done():
+		// Give ctx-aware handlers a moment to return their own error, which may
+		// carry partial command output.
+		select {
+		case outcome := <-done:
+			return outcome.value, outcome.err
+		case <-time.After(partialOutputGrace):
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// isToolTimeout reports whether err came from the tool deadline rather than
+// the client canceling the request.
+func isToolTimeout(parent context.Context, err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) && parent.Err() == nil
+}
+
+func timeoutResult(toolName string, timeout time.Duration, err error) *mcp.CallToolResult {
+	seconds := int(timeout / time.Second)
+	msg := fmt.Sprintf("%s timed out after %ds", toolName, seconds)
+	details := map[string]any{
+		"tool":            toolName,
+		"timeout_seconds": seconds,
+		"hint":            "Pass a larger timeout_seconds, narrow the query (focus, nodecount, hours), or raise PPROF_MCP_TOOL_TIMEOUTS.",
+	}
+	text := msg + "\nHint: " + details["hint"].(string)
+
+	var partial *pprof.PartialOutputError
+	if errors.As(err, &partial) && strings.TrimSpace(partial.Stdout) != "" {
+		raw, rawMeta := applyTextLimits(partial.Stdout, &partial.StdoutMeta, textutil.TruncateOptions{MaxLines: partialOutputMaxLines})
+		details["partial_output"] = raw
+		details["partial_output_meta"] = rawMeta
+		details["command"] = partial.Command
+		text += "\n\nPartial output before timeout:\n" + raw
+	}
+
+	return &mcp.CallToolResult{
+		IsError: true,
+		Content: []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: map[string]any{
+			"error": map[string]any{
+				"message": msg,
+				"code":    "TIMEOUT",
+				"details": details,
+			},
+		},
+	}
+}
+
+// annotateCommands records in the result _meta the external commands the
+// call ran and how long they took, so slow kubectl or pprof steps show up
+// without changing the structured output schema.
+func annotateCommands(res *mcp.CallToolResult, log *cmdrun.Log) {
+	records := log.Records()
+	if res == nil || len(records) == 0 {
+		return
+	}
+	if res.Meta == nil {
+		res.Meta = mcp.Meta{}
+	}
+	res.Meta["commands"] = records
+}
+
+func timeoutSecondsProp() map[string]any {
+	return integerProp(fmt.Sprintf("Execution timeout in seconds for this call (overrides the server default, max %d)", maxTimeoutSeconds), intPtr(1), intPtr(maxTimeoutSeconds))
+}
+
+// addCommonArgs adds arguments every tool accepts to each input schema.
+func addCommonArgs(defs []ToolDefinition) []ToolDefinition {
+	for _, def := range defs {
+		schema, ok := def.Tool.InputSchema.(map[string]any)
+		if !ok {
+			continue
+		}
+		props, ok := schema["properties"].(map[string]any)
+		if !ok {
+			continue
+		}
+		props["timeout_seconds"] = timeoutSecondsProp()
+	}
+	return defs
+}
@@ -0,0 +1,92 @@
+package mcpserver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/pprof"
+)
+
+func TestTimeoutForToolPrecedence(t *testing.T) {
+	cfg := parseToolTimeouts("120", "pprof.top=30, bogus, pprof.peek=abc")
+	if got := timeoutForTool(cfg, "pprof.top", map[string]any{}); got != 30*time.Second {
+		t.Fatalf("expected per-tool timeout, got %s", got)
+	}
+	if got := timeoutForTool(cfg, "pprof.peek", map[string]any{}); got != 120*time.Second {
+		t.Fatalf("expected global timeout, got %s", got)
+	}
+	if got := timeoutForTool(cfg, "pprof.top", map[string]any{"timeout_seconds": 5}); got != 5*time.Second {
+		t.Fatalf("expected argument timeout, got %s", got)
+	}
+
+	empty := parseToolTimeouts("", "")
+	if got := timeoutForTool(empty, "pprof.branch_impact", nil); got != 30*time.Minute {
+		t.Fatalf("expected built-in branch impact timeout, got %s", got)
+	}
+	if got := timeoutForTool(empty, "pprof.meta", nil); got != defaultToolTimeout {
+		t.Fatalf("expected default timeout, got %s", got)
+	}
+}
+
+func TestRunWithTimeoutReturnsStructuredError(t *testing.T) {
+	blocking := func(ctx context.Context, args map[string]any) (any, error) {
+		select {}
+	}
+	ctx := context.Background()
+	_, err := runWithTimeout(ctx, 20*time.Millisecond, blocking, nil)
+	if !isToolTimeout(ctx, err) {
+		t.Fatalf("expected tool timeout, got %v", err)
+	}
+
+	res := timeoutResult("pprof.top", 20*time.Millisecond, err)
+	if !res.IsError {
+		t.Fatalf("expected error result")
+	}
+	payload := res.StructuredContent.(map[string]any)["error"].(map[string]any)
+	if payload["code"] != "TIMEOUT" {
+		t.Fatalf("expected TIMEOUT code, got %v", payload["code"])
+	}
+}
+
+func TestTimeoutResultIncludesPartialOutput(t *testing.T) {
+	partial := &pprof.PartialOutputError{
+		Err:     context.DeadlineExceeded,
+		Command: "go tool pprof -top cpu.pprof",
+		Stdout:  "flat flat% sum% cum cum%\n10ms 50% 50% 10ms 50% main.foo\n",
+	}
+	handler := func(ctx context.Context, args map[string]any) (any, error) {
+		<-ctx.Done()
+		return nil, fmt.Errorf("pprof top failed: %w", partial)
+	}
+	ctx := context.Background()
+	_, err := runWithTimeout(ctx, 20*time.Millisecond, handler, nil)
+	if !isToolTimeout(ctx, err) {
+		t.Fatalf("expected tool timeout, got %v", err)
+	}
+	res := timeoutResult("pprof.top", time.Second, err)
+	details := res.StructuredContent.(map[string]any)["error"].(map[string]any)["details"].(map[string]any)
+	if details["partial_output"] == "" || details["command"] != partial.Command {
+		t.Fatalf("expected partial output in details, got %v", details)
+	}
+}
+
+func TestClientCancelIsNotToolTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	if isToolTimeout(ctx, context.DeadlineExceeded) {
+		t.Fatalf("expected parent deadline to be reported as cancellation")
+	}
+}
+
+func TestTimeoutSecondsArgumentValidated(t *testing.T) {
+	def := findTool(t, "pprof.top")
+	if err := ValidateArgs(def.Tool, map[string]any{"profile": "cpu.pprof", "timeout_seconds": 30}); err != nil {
+		t.Fatalf("expected timeout_seconds to be accepted: %v", err)
+	}
+	if err := ValidateArgs(def.Tool, map[string]any{"profile": "cpu.pprof", "timeout_seconds": 0}); err == nil {
+		t.Fatalf("expected timeout_seconds=0 to be rejected")
+	}
+}
@@ -0,0 +1,69 @@
+package mcpserver
+
+import (
+	"fmt"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// toolAlias keeps a renamed tool callable under its previous name so agent
+// prompt libraries keep working across releases. Calls to the old name run
+// the new tool and carry a deprecation warning.
+type toolAlias struct {
+	Old string
+	New string
+	// Removal is the release in which the old name stops working.
+	Removal string
+}
+
+var toolAliases = []toolAlias{
+	{Old: "pprof.traces_head", New: "pprof.traces", Removal: "0.3.0"},
+}
+
+// canonicalToolName maps a deprecated name (in either naming mode) to the
+// current canonical name. Unknown names are returned unchanged.
+func canonicalToolName(name string) string {
+	for _, alias := range toolAliases {
+		if name == alias.Old || name == toolNameForMode(alias.Old, toolNameModeCodex) {
+			return alias.New
+		}
+	}
+	return name
+}
+
+func (a toolAlias) warning(nameMode toolNameMode) string {
+	return fmt.Sprintf("%s is deprecated and will be removed in %s; use %s instead.",
+		toolNameForMode(a.Old, nameMode), a.Removal, toolNameForMode(a.New, nameMode))
+}
+
+// aliasTool returns the tool advertised under the deprecated name.
+func aliasTool(tool mcp.Tool, alias toolAlias, nameMode toolNameMode) mcp.Tool {
+	tool.Name = toolNameForMode(alias.Old, nameMode)
+	tool.Description = fmt.Sprintf("Deprecated: %s\n\n%s", alias.warning(nameMode), tool.Description)
+	return tool
+}
+
+// annotateDeprecation prefixes the text result with the deprecation warning
+// and records it in the result _meta.
+func annotateDeprecation(res *mcp.CallToolResult, alias toolAlias, nameMode toolNameMode) {
+	if res == nil {
+		return
+	}
+	warning := alias.warning(nameMode)
+	if res.Meta == nil {
+		res.Meta = mcp.Meta{}
+	}
+	res.Meta["deprecation"] = map[string]any{
+		"deprecated_name": toolNameForMode(alias.Old, nameMode),
+		"replacement":     toolNameForMode(alias.New, nameMode),
+		"removal":         alias.Removal,
+		"message":         warning,
+	}
+	for _, content := range res.Content {
+		if text, ok := content.(*mcp.TextContent); ok {
+			text.Text = "Warning: " + warning + "\n\n" + text.Text
+			return
+		}
+	}
+	res.Content = append([]mcp.Content{&mcp.TextContent{Text: "Warning: " + warning}}, res.Content...)
+}
@@ -0,0 +1,62 @@
+package mcpserver
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestToolRegistryAliasValidation(t *testing.T) {
+	registry := NewToolRegistry()
+	if err := registry.AddAll(ToolSchemas()); err != nil {
+		t.Fatalf("add tools: %v", err)
+	}
+	if err := registry.AddAlias(toolAlias{Old: "pprof.old", New: "pprof.missing"}); err == nil {
+		t.Fatalf("expected alias to unknown tool to fail")
+	}
+	if err := registry.AddAlias(toolAlias{Old: "pprof.top", New: "pprof.peek"}); err == nil {
+		t.Fatalf("expected alias colliding with a tool name to fail")
+	}
+	if err := registry.AddAlias(toolAlias{Old: "pprof.traces_head", New: "pprof.traces", Removal: "0.3.0"}); err != nil {
+		t.Fatalf("add alias: %v", err)
+	}
+	if err := registry.AddAlias(toolAlias{Old: "pprof.traces_head", New: "pprof.traces"}); err == nil {
+		t.Fatalf("expected duplicate alias to fail")
+	}
+	if got := canonicalToolName("pprof_traces_head"); got != "pprof.traces" {
+		t.Fatalf("expected codex alias to resolve, got %q", got)
+	}
+}
+
+func TestDeprecatedAliasCallsNewTool(t *testing.T) {
+	session := connectTestSession(t)
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "pprof.traces_head",
+		Arguments: map[string]any{"profile": filepath.Join(t.TempDir(), "missing.pprof")},
+	})
+	if err != nil {
+		t.Fatalf("call alias: %v", err)
+	}
+	text := res.Content[0].(*mcp.TextContent).Text
+	if !strings.HasPrefix(text, "Warning: pprof.traces_head is deprecated") || !strings.Contains(text, "use pprof.traces instead") {
+		t.Fatalf("expected deprecation warning, got %q", text)
+	}
+	deprecation, ok := res.Meta["deprecation"].(map[string]any)
+	if !ok || deprecation["replacement"] != "pprof.traces" {
+		t.Fatalf("expected _meta.deprecation, got %v", res.Meta)
+	}
+
+	res, err = session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "pprof.traces",
+		Arguments: map[string]any{"profile": filepath.Join(t.TempDir(), "missing.pprof")},
+	})
+	if err != nil {
+		t.Fatalf("call tool: %v", err)
+	}
+	if _, ok := res.Meta["deprecation"]; ok {
+		t.Fatalf("new name should not carry a deprecation warning")
+	}
+}
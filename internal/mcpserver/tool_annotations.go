@@ -0,0 +1,60 @@
+package mcpserver
+
+import "github.com/modelcontextprotocol/go-sdk/mcp"
+
+// Tool annotations are hints for clients deciding which calls need user
+// confirmation. They describe side effects, not permissions.
+
+// readOnlyLocal is for analysis tools that only read local profiles/sources.
+func readOnlyLocal() *mcp.ToolAnnotations {
+	return &mcp.ToolAnnotations{
+		ReadOnlyHint:  true,
+		OpenWorldHint: boolPtr(false),
+	}
+}
+
+// readOnlyRemote is for tools that query Datadog without writing anything locally.
+func readOnlyRemote() *mcp.ToolAnnotations {
+	return &mcp.ToolAnnotations{
+		ReadOnlyHint:  true,
+		OpenWorldHint: boolPtr(true),
+	}
+}
+
+// localWrite is for tools that write an output file (or baseline store) derived
+// from local inputs. Re-running with the same arguments rewrites the same file.
+func localWrite(idempotent bool) *mcp.ToolAnnotations {
+	return &mcp.ToolAnnotations{
+		DestructiveHint: boolPtr(false),
+		IdempotentHint:  idempotent,
+		OpenWorldHint:   boolPtr(false),
+	}
+}
+
+// remoteDownload is for tools that fetch profiles from Datadog or a cluster
+// and write them to disk, or that build or test with go, which may fetch
+// modules and runs the repo's code. Each call creates new files.
+func remoteDownload() *mcp.ToolAnnotations {
+	return &mcp.ToolAnnotations{
+		DestructiveHint: boolPtr(false),
+		OpenWorldHint:   boolPtr(true),
+	}
+}
+
+// remoteWrite is for tools that can publish outside the server or edit a
+// repo, such as suggest_fix opening a pull request or applying a fix.
+func remoteWrite() *mcp.ToolAnnotations {
+	return &mcp.ToolAnnotations{
+		DestructiveHint: boolPtr(false),
+		OpenWorldHint:   boolPtr(true),
+	}
+}
+
+// destructive is for tools that mutate the developer environment (git
+// stash/checkout, dev-cluster rebuilds).
+func destructive() *mcp.ToolAnnotations {
+	return &mcp.ToolAnnotations{
+		DestructiveHint: boolPtr(true),
+		OpenWorldHint:   boolPtr(true),
+	}
+}
@@ -0,0 +1,94 @@
+package mcpserver
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ToolRegistry stores tools by name to guarantee deterministic listing and unique names.
+type ToolRegistry struct {
+	tools   map[string]ToolDefinition
+	aliases map[string]toolAlias
+}
+
+func NewToolRegistry() *ToolRegistry {
+	return &ToolRegistry{tools: make(map[string]ToolDefinition), aliases: make(map[string]toolAlias)}
+}
+
+func (r *ToolRegistry) Add(def ToolDefinition) error {
+	if def.Tool == nil {
+		return fmt.Errorf("tool definition missing tool")
+	}
+	name := def.Tool.Name
+	if name == "" {
+		return fmt.Errorf("tool name cannot be empty")
+	}
+	if _, exists := r.tools[name]; exists {
+		return fmt.Errorf("duplicate tool name %q", name)
+	}
+	if _, exists := r.aliases[name]; exists {
+		return fmt.Errorf("tool name %q is already a deprecated alias", name)
+	}
+	r.tools[name] = def
+	return nil
+}
+
+// AddAlias registers a deprecated name for an existing tool.
+func (r *ToolRegistry) AddAlias(alias toolAlias) error {
+	if alias.Old == "" || alias.New == "" {
+		return fmt.Errorf("tool alias names cannot be empty")
+	}
+	if _, exists := r.tools[alias.New]; !exists {
+		return fmt.Errorf("alias %q targets unknown tool %q", alias.Old, alias.New)
+	}
+	if _, exists := r.tools[alias.Old]; exists {
+		return fmt.Errorf("alias %q collides with a tool name", alias.Old)
+	}
+	if _, exists := r.aliases[alias.Old]; exists {
+		return fmt.Errorf("duplicate tool alias %q", alias.Old)
+	}
+	r.aliases[alias.Old] = alias
+	return nil
+}
+
+// Get returns the tool registered under name.
+func (r *ToolRegistry) Get(name string) (ToolDefinition, bool) {
+	def, ok := r.tools[name]
+	return def, ok
+}
+
+// Aliases returns the deprecated aliases sorted by old name.
+func (r *ToolRegistry) Aliases() []toolAlias {
+	keys := make([]string, 0, len(r.aliases))
+	for name := range r.aliases {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+	ordered := make([]toolAlias, 0, len(keys))
+	for _, name := range keys {
+		ordered = append(ordered, r.aliases[name])
+	}
+	return ordered
+}
+
+func (r *ToolRegistry) AddAll(defs []ToolDefinition) error {
+	for _, def := range defs {
+		if err := r.Add(def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ToolRegistry) List() []ToolDefinition {
+	keys := make([]string, 0, len(r.tools))
+	for name := range r.tools {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+	ordered := make([]ToolDefinition, 0, len(keys))
+	for _, name := range keys {
+		ordered = append(ordered, r.tools[name])
+	}
+	return ordered
+}
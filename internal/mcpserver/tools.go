@@ -0,0 +1,1871 @@
+package mcpserver
+
+import (
+	"context"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// ToolHandler runs a tool with JSON-like arguments.
+type ToolHandler func(context.Context, map[string]any) (any, error)
+
+// ToolDefinition combines a tool's schema with its handler.
+type ToolDefinition struct {
+	Tool    *mcp.Tool
+	Handler ToolHandler
+}
+
+// ToolSchemas returns all tool definitions.
+func ToolSchemas() []ToolDefinition {
+	tools := []ToolDefinition{
+		{
+			Tool: &mcp.Tool{
+				Name: "profiles.download",
+				Description: `Smart profile downloader that auto-detects environment.
+
+**When to use**: Default tool for downloading profiles. Automatically detects if you're in:
+- **d2 local development**: Uses kubectl + port-forward to local services
+- **Production/Staging**: Uses Datadog API to download profiles
+
+**Environment Detection**:
+- Checks d2 environment variable (d2=true or D2=true)
+- Routes to appropriate backend automatically
+
+**Parameters**:
+- **d2 mode**: service, out_dir, seconds (optional)
+- **Datadog mode**: service, env, out_dir, hours (optional)
+
+**Returns**: Profile handles for use with all pprof.* analysis tools.
+
+**Tip**: Use this tool unless you need explicit control over the download method.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"service":      prop("string", "The service name (required)"),
+					"out_dir":      prop("string", "Output directory for downloaded profiles (required)"),
+					"env":          prop("string", "Environment (prod/staging) - only for Datadog mode"),
+					"hours":        integerProp("Hours to look back - only for Datadog mode (default: 72)", intPtr(0), nil),
+					"seconds":      integerProp("CPU profile duration in seconds - only for d2 mode (default: 30)", intPtr(1), intPtr(300)),
+					"dd_site":      prop("string", "Datadog site - only for Datadog mode"),
+					"site":         prop("string", "Datadog site (alias) - only for Datadog mode"),
+					"host":         prop("string", "Host filter (e.g., '*prod-usw2a*') - only for Datadog mode"),
+					"profile_id":   prop("string", "Specific profile ID - only for Datadog mode (use with event_id)"),
+					"event_id":     prop("string", "Specific event ID - only for Datadog mode (required if profile_id is set)"),
+					"dry_run":      prop("boolean", "Return the kubectl commands that would run without executing them - only for d2 mode (default: false)"),
+					"namespace":    prop("string", "Kubernetes namespace - only for d2 mode (default: default)"),
+					"kube_context": prop("string", "kubectl context - only for d2 mode (default: current context)"),
+				}, "service", "out_dir"),
+				Annotations:  remoteDownload(),
+				OutputSchema: withDryRunOutput(profilesDownloadAutoOutputSchema()),
+			},
+			Handler: profilesDownloadAutoTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "profiles.download_latest_bundle",
+				Description: `Download profiling bundle from Datadog for a service.
+
+**When to use**: Start here to get profiles for analysis. Downloads CPU, heap, mutex, and goroutine profiles.
+
+**Workflow**:
+1. Use datadog.profiles.list to see available profiles
+2. Use datadog.profiles.pick to select a specific profile (by time, strategy, etc.)
+3. Use this tool with the profile_id and event_id to download
+
+**Returns**: Handle IDs for downloaded .pprof files for use with other pprof.* tools.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"service":    prop("string", "The service name to download profiles for (required)"),
+					"env":        prop("string", "The environment (e.g., prod, staging) (required)"),
+					"out_dir":    prop("string", "Output directory for downloaded profiles (required)"),
+					"hours":      integerProp("Number of hours to look back for profiles (default: 72)", intPtr(0), nil),
+					"dd_site":    prop("string", "Datadog site (e.g., datadoghq.com, datadoghq.eu) (alias: site)"),
+					"site":       prop("string", "Datadog site (preferred; alias: dd_site)"),
+					"host":       prop("string", "Host filter (e.g., '*prod-usw2a*' for AZ filtering, supports wildcards)"),
+					"profile_id": prop("string", "Specific profile ID to download (use with event_id)"),
+					"event_id":   prop("string", "Specific event ID to download (required if profile_id is set)"),
+				}, "service", "env", "out_dir"),
+				Annotations:  remoteDownload(),
+				OutputSchema: downloadLatestBundleOutputSchema(),
+			},
+			Handler: downloadTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "d2.profiles.download",
+				Description: `Download profiling bundle from a d2 local development service.
+
+**When to use**: For profiling services running in your local d2 development environment.
+
+**How it works**:
+1. Discovers the service pod using kubectl
+2. Sets up port-forward to the debug server (port 1337)
+3. Retrieves auth token from the pod
+4. Downloads CPU, heap, allocs, goroutine, mutex, block, and threadcreate profiles (or only types)
+5. Saves profiles in the same format as Datadog downloads
+
+**Mutex and block rates**: Go services sample no mutex or block events unless the program enables them. mutex_rate and block_rate turn them on for the capture through a rate endpoint on the pprof port (rate_path, default /debug/pprof/rates): PUT <rate_path>?mutex=N&block=N sets them and answers with the replaced rates as JSON, which are put back after the download. The CPU profile is the sampling window; without one, the capture waits seconds before fetching. A service without the endpoint is captured at its own rates, with a warning.
+
+**Requirements**:
+- kubectl access to the local cluster
+- Service must be running in d2 (deployed by Tilt)
+- Debug server must be enabled on the service
+
+**Outside d2**: Set target to a workload (deployment/api, statefulset/db) or label selector (app=api) to skip Tilt discovery and the debug token. The first running pod is port-forwarded on port (default 6060) and net/http/pprof is read over plain HTTP, so this works on any cluster kubectl can reach.
+
+**Pod health**: After the profiles, the pod's container restart counts, last exit reasons, and recent events are read into result.pod_health. A container OOMKilled or restarted within the hour, or failing probes, gets a warning: its heap, goroutine, and allocs profiles cover only the new process, so read them as a recycled pod rather than a steady one.
+
+**Returns**: Handle IDs for downloaded .pprof files for use with all pprof.* analysis tools, and the pod's restarts and events.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"service":      prop("string", "The service name to download profiles from (e.g., be-innkeeper, pub-api); required unless target is set, where it only names the files"),
+					"target":       prop("string", "Plain-kubectl capture: workload (deployment/<name>, statefulset/<name>, daemonset/<name>) or label selector (app=<name>)"),
+					"namespace":    prop("string", "Kubernetes namespace (default: default)"),
+					"kube_context": prop("string", "kubectl context for every kubectl call (default: current context)"),
+					"port":         integerProp("pprof port inside the pod for target (default: discovered from the pprof.port annotation, named container ports, or pprof/debug/admin args and env, else 6060)", intPtr(1), intPtr(65535)),
+					"out_dir":      prop("string", "Output directory for downloaded profiles (required)"),
+					"seconds":      integerProp("Duration in seconds for CPU profile (default: 30)", intPtr(1), intPtr(300)),
+					"types":        arrayPropSchema(prop("string", "Profile type"), "Profile types to download: cpu, heap, allocs, goroutines, mutex, block, threadcreate (default: all)"),
+					"mutex_rate":   integerProp("runtime.SetMutexProfileFraction value set for the capture, e.g. 5 (default: leave as is)", intPtr(0), nil),
+					"block_rate":   integerProp("runtime.SetBlockProfileRate value in nanoseconds set for the capture, e.g. 10000 (default: leave as is)", intPtr(0), nil),
+					"rate_path":    prop("string", "Rate endpoint on the pprof port (default: /debug/pprof/rates)"),
+					"dry_run":      dryRunProp(),
+				}, "out_dir"),
+				Annotations:  remoteDownload(),
+				OutputSchema: withDryRunOutput(d2DownloadOutputSchema()),
+			},
+			Handler: d2DownloadTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "k8s.profiles.capture",
+				Description: `Capture profiles from every pod of a workload and merge them per profile type.
+
+**When to use**: A single pod is not representative (uneven load, one hot replica) and you want the service-wide picture from any cluster kubectl can reach.
+
+**How it works**:
+1. Resolves target (deployment/<name> or app=<name>) to running pods
+2. Port-forwards to each pod concurrently (parallel, default 4) and reads net/http/pprof on port (default: discovered per pod)
+3. Merges each profile type across pods into out_dir/fleet and registers it as a fleet handle
+4. Reports each pod's share of every fleet profile
+
+**Pod selection**: strategy orders the running pods (optionally only those on node) before the max_pods cap (default 5; all=true lifts it):
+- **first**: kubectl order (default)
+- **cpu** / **memory**: highest usage first, from metrics-server (kubectl top) or, with usage_source=datadog, the Datadog agent's kubernetes.* metrics
+- **oldest**: longest-running first
+- **random**: a random sample of max_pods
+
+"Profile the worst replica" is strategy=cpu, max_pods=1.
+
+**Partial failures**: At most parallel port-forwards run at once, and each pod gets pod_timeout_seconds (default: seconds + 60). A pod that refuses, hangs, or serves only some profile types never aborts the others: pods lists every pod's status (ok, partial, failed, skipped), failed repeats the failures, and the capture only errors when no pod succeeds. Where port-forward is forbidden, a pod is fetched through kubectl exec with curl or wget inside its container instead, with a warning naming the method.
+
+**CPU throttling**: Each pod's cgroup is read with kubectl exec before the first profile and after the last (cgroup=false skips it). pods[].cgroup reports the CFS periods throttled in that window, the CPU limit, and memory current/peak/limit. A pod throttled in 5% or more of periods gets a warning: a "CPU regression" there may be the limit, not the code, and calls for a higher limit rather than an optimization. Images without sh (distroless) report cgroup.error instead; in-cluster mode has no exec and skips the read.
+
+**Returns**: Per-pod status, handles, and cgroup stats, fleet handles with per-pod contributions, and failed pods.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"target":              prop("string", "Workload (deployment/<name>, statefulset/<name>, daemonset/<name>, job/<name>, cronjob/<name>) or label selector (app=<name>) (required); to wait for a batch run, use k8s.profiles.capture_job"),
+					"namespace":           prop("string", "Kubernetes namespace (default: default)"),
+					"kube_context":        prop("string", "kubectl context for every kubectl call (default: current context)"),
+					"out_dir":             prop("string", "Output directory; each pod's bundle goes to out_dir/<pod> (required)"),
+					"service":             prop("string", "Bundle file prefix (default: workload name or the selector's app label)"),
+					"port":                integerProp("pprof port inside the pods (default: discovered per pod from the pprof.port annotation, named container ports, or pprof/debug/admin args and env, else the port repo_root declares, else 6060)", intPtr(1), intPtr(65535)),
+					"repo_root":           prop("string", "Service repository whose k8s manifests, Helm values, and Dockerfiles declare its pprof port (see repo.services.discover), used for pods whose spec declares none"),
+					"seconds":             integerProp("Duration in seconds for CPU profile (default: 30)", intPtr(1), intPtr(300)),
+					"types":               arrayPropSchema(prop("string", "Profile type"), "Profile types to capture: cpu, heap, goroutines, mutex, block, allocs, threadcreate (default: all)"),
+					"max_pods":            integerProp("Capture at most this many matching pods (default: 5)", intPtr(1), nil),
+					"all":                 prop("boolean", "Capture every matching pod, ignoring max_pods (default: false)"),
+					"strategy":            enumProp("string", "Pod selection order before the max_pods cap (default: first)", []string{"first", "cpu", "memory", "oldest", "random"}),
+					"node":                prop("string", "Only capture pods scheduled on this node"),
+					"usage_source":        enumProp("string", "Where cpu/memory strategies read usage (default: metrics-server)", []string{"metrics-server", "datadog"}),
+					"env":                 prop("string", "Datadog env tag - only for usage_source=datadog"),
+					"site":                prop("string", "Datadog site - only for usage_source=datadog"),
+					"parallel":            integerProp("Pods captured at once (default: 4)", intPtr(1), intPtr(32)),
+					"merge":               prop("boolean", "Merge each profile type across pods into a fleet handle (default: true)"),
+					"cgroup":              prop("boolean", "Read each pod's cgroup CPU throttling and memory stats with kubectl exec (default: true)"),
+					"pod_timeout_seconds": integerProp("Give up on a pod after this many seconds (default: seconds + 60)", intPtr(1), intPtr(1800)),
+					"dry_run":             dryRunProp(),
+				}, "target", "out_dir"),
+				Annotations:  remoteDownload(),
+				OutputSchema: withDryRunOutput(k8sCaptureOutputSchema()),
+			},
+			Handler: k8sCaptureTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "k8s.profiles.capture_job",
+				Description: `Capture profiles from a Job or CronJob pod while it runs.
+
+**When to use**: The code to profile runs as a batch workload (migrations, reports, nightly syncs) whose pods exist only for the length of a run, so k8s.profiles.capture usually finds nothing running.
+
+**How it works**:
+1. Polls target's pods until one is Running (up to wait_seconds, default 600). A job/<name> is matched by its job-name label; a cronjob/<name> by its job template labels and the Jobs it created, so a run already in progress counts and otherwise the next scheduled one is awaited
+2. With at, waits until that fraction of expected_runtime_seconds after the pod started (at=0.8 profiles the tail of the run). For a CronJob the expected runtime defaults to its last successful Job's
+3. Port-forwards and fetches heap, goroutines, allocs, and threadcreate first, then the CPU profile (cut short to end before the expected completion), then mutex and block
+
+**Pod exits**: A run that ends during the capture is expected. Profiles fetched before the pod finished are kept and registered; result.finished reports Succeeded, Failed, or Gone. The call only errors when nothing was fetched.
+
+**CPU throttling**: As with k8s.profiles.capture, the pod's cgroup is read before and after the profiles (cgroup=false skips it) and result.cgroup reports throttling and memory.
+
+**Returns**: The captured pod, its job, timing, cgroup stats, and profile handles.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"target":                   prop("string", "job/<name> or cronjob/<name> (required)"),
+					"namespace":                prop("string", "Kubernetes namespace (default: default)"),
+					"kube_context":             prop("string", "kubectl context for every kubectl call (default: current context)"),
+					"out_dir":                  prop("string", "Output directory; the bundle goes to out_dir/<pod> (required)"),
+					"service":                  prop("string", "Bundle file prefix (default: job or cronjob name)"),
+					"port":                     integerProp("pprof port inside the pod (default: discovered from the pprof.port annotation, named container ports, or pprof/debug/admin args and env, else the port repo_root declares, else 6060)", intPtr(1), intPtr(65535)),
+					"repo_root":                prop("string", "Service repository whose k8s manifests, Helm values, and Dockerfiles declare its pprof port (see repo.services.discover), used for a pod whose spec declares none"),
+					"seconds":                  integerProp("Duration in seconds for CPU profile (default: 30)", intPtr(1), intPtr(300)),
+					"types":                    arrayPropSchema(prop("string", "Profile type"), "Profile types to capture: cpu, heap, goroutines, mutex, block, allocs, threadcreate (default: all)"),
+					"wait_seconds":             integerProp("How long to wait for a pod to reach Running (default: 600)", intPtr(1), intPtr(1800)),
+					"at":                       numberProp("Start the capture at this fraction of the expected runtime after the pod started, 0 to 1 (default: 0, as soon as it is Running)", floatPtr(0), floatPtr(1)),
+					"expected_runtime_seconds": integerProp("How long one run takes (default for a CronJob: its last successful Job's duration); needed by at for a Job", intPtr(1), nil),
+					"cgroup":                   prop("boolean", "Read the pod's cgroup CPU throttling and memory stats with kubectl exec (default: true)"),
+					"dry_run":                  dryRunProp(),
+				}, "target", "out_dir"),
+				Annotations:  remoteDownload(),
+				OutputSchema: withDryRunOutput(k8sCaptureJobOutputSchema()),
+			},
+			Handler: k8sCaptureJobTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "k8s.profiles.compare_clusters",
+				Description: `Capture the same service from two clusters (or two namespaces) and diff the profiles, surfacing the pod configuration that can explain the difference.
+
+**When to use**: A service is slower or costlier in one region, cluster, or environment than another and the question is whether the code or the deployment differs.
+
+**How it works**:
+1. Captures target from both kube_contexts at once, as k8s.profiles.capture would (each side into out_dir/<context>, or out_dir/<namespace> when only namespaces differ), and merges each profile type across the captured pods
+2. Reads the captured pods' specs: image, CPU and memory requests and limits, and GOMAXPROCS, GOMEMLIMIT, GOGC, and GODEBUG from the serving container's env, plus cgroup throttling
+3. Runs diff_top on the merged cpu, mutex, and block profiles, second side minus first
+4. Attributes GC and scheduler functions among the largest changes to the differing settings (a tighter memory limit or GOGC drives gcBgMarkWorker and mallocgc; a different CPU limit or GOMAXPROCS drives findRunnable and stealWork)
+
+**Reading it**: config_differences lists every setting that differs with its expected effect. A different image means function-level changes may be code. Merged profiles sum over pods, so capture the same number of pods on both sides (max_pods) or compare per-pod cost; a pod count mismatch is warned about.
+
+**Returns**: Per-side config and merged profile handles, config differences, per-type deltas, and attributions.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"target":        prop("string", "Workload (deployment/<name>, statefulset/<name>, daemonset/<name>) or label selector (app=<name>) present on both sides (required)"),
+					"kube_contexts": arrayPropSchema(prop("string", "kubectl context"), "The two kubectl contexts to compare, first as the baseline (\"\" for the current context); omit to compare namespaces in the current context"),
+					"namespace":     prop("string", "Kubernetes namespace on both sides (default: default)"),
+					"namespaces":    arrayPropSchema(prop("string", "Namespace"), "Per-side namespaces, in kube_contexts order, when they differ"),
+					"out_dir":       prop("string", "Output directory; each side goes to out_dir/<label> (required)"),
+					"service":       prop("string", "Bundle file prefix (default: workload name or app label)"),
+					"port":          integerProp("pprof port inside the pods (default: discovered per pod, else 6060)", intPtr(1), intPtr(65535)),
+					"seconds":       integerProp("Duration in seconds for CPU profile (default: 30)", intPtr(1), intPtr(300)),
+					"types":         arrayPropSchema(prop("string", "Profile type"), "Profile types to capture: cpu, heap, goroutines, mutex, block, allocs, threadcreate (default: all)"),
+					"max_pods":      integerProp("Pods captured per side (default: 5)", intPtr(1), nil),
+					"strategy":      enumProp("string", "Which pods fill max_pods on each side (default: first)", []string{"first", "cpu", "memory", "oldest", "random"}),
+					"cgroup":        prop("boolean", "Read each pod's cgroup CPU throttling and memory stats with kubectl exec (default: true)"),
+					"dry_run":       dryRunProp(),
+				}, "target", "out_dir"),
+				Annotations:  remoteDownload(),
+				OutputSchema: withDryRunOutput(k8sCompareClustersOutputSchema()),
+			},
+			Handler: k8sCompareClustersTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "k8s.profiles.compare_canary",
+				Description: `Capture a service's canary and stable pods at the same time and diff them: "is the canary worse" in one call.
+
+**When to use**: A canary is rolling out next to stable pods of the same service, told apart by a pod label.
+
+**How it works**:
+1. Narrows selector (the service's pods, e.g. app=api) with stable_selector (default: track!=canary, which includes pods without a track label) and canary_selector (default: track=canary)
+2. Captures both groups concurrently, as k8s.profiles.compare_clusters does, into out_dir/stable and out_dir/canary, and merges each group's profiles
+3. Runs diff_top on the merged cpu, mutex, and block profiles, canary minus stable, and lists pod settings that differ (image, resources, Go runtime env)
+4. Compares CPU seconds per captured pod and calls the canary worse at a 10% or larger increase
+
+**Reading it**: The verdict is per pod, so it holds up when the canary has fewer pods; the diffs are of merged totals and scale with pod count. A canary that receives a different share of traffic than stable pods also differs in CPU per pod; check request rates before blaming the code.
+
+**Returns**: The same fields as k8s.profiles.compare_clusters (sides labeled stable and canary), plus the verdict.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"selector":        prop("string", "Label selector of the service's pods, canary and stable alike, e.g. app=api (required)"),
+					"canary_selector": prop("string", "Labels narrowing selector to canary pods (default: track=canary)"),
+					"stable_selector": prop("string", "Labels narrowing selector to stable pods (default: track!=canary)"),
+					"kube_context":    prop("string", "kubectl context (default: the current context)"),
+					"namespace":       prop("string", "Kubernetes namespace (default: default)"),
+					"out_dir":         prop("string", "Output directory; the groups go to out_dir/stable and out_dir/canary (required)"),
+					"service":         prop("string", "Bundle file prefix (default: app label)"),
+					"port":            integerProp("pprof port inside the pods (default: discovered per pod, else 6060)", intPtr(1), intPtr(65535)),
+					"seconds":         integerProp("Duration in seconds for CPU profile (default: 30)", intPtr(1), intPtr(300)),
+					"types":           arrayPropSchema(prop("string", "Profile type"), "Profile types to capture: cpu, heap, goroutines, mutex, block, allocs, threadcreate (default: all)"),
+					"max_pods":        integerProp("Pods captured per group (default: 5)", intPtr(1), nil),
+					"strategy":        enumProp("string", "Which pods fill max_pods in each group (default: first)", []string{"first", "cpu", "memory", "oldest", "random"}),
+					"cgroup":          prop("boolean", "Read each pod's cgroup CPU throttling and memory stats with kubectl exec (default: true)"),
+					"dry_run":         dryRunProp(),
+				}, "selector", "out_dir"),
+				Annotations:  remoteDownload(),
+				OutputSchema: withDryRunOutput(k8sCompareCanaryOutputSchema()),
+			},
+			Handler: k8sCompareCanaryTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "k8s.profiles.debug_capture",
+				Description: `PRIVILEGED: CPU-profile a pod that does not serve net/http/pprof by injecting an ephemeral debug container.
+
+**When to use**: Only when k8s.profiles.capture cannot work because the service exposes no pprof endpoint, and the user has explicitly approved modifying the pod.
+
+**What it does to the pod**:
+- Adds an ephemeral container (kubectl debug --profile general, which grants SYS_PTRACE) sharing the target container's process namespace. Ephemeral containers cannot be removed; it stays in the pod spec until the pod is replaced.
+- Runs the agent image inside the pod with access to the target process's memory.
+- Namespaces enforcing the baseline or restricted Pod Security Standard reject it.
+
+**Confirmation**: Describe the above to the user and get their approval first, then call with confirm=true. Without confirm the call fails; dry_run=true shows the kubectl commands without touching the pod.
+
+**How it works**:
+1. Picks pod, or the first running pod of target
+2. kubectl debug injects image (default: PPROF_MCP_DEBUG_IMAGE) targeting container
+3. kubectl exec runs agent_command against pid (default: perf record + perf_to_profile against PID 1, the target's main process)
+4. Copies the resulting CPU profile to out_dir/<pod> and registers a handle
+
+**Returns**: The CPU profile handle and the name of the ephemeral container left in the pod.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"pod":           prop("string", "Pod to profile (or use target)"),
+					"target":        prop("string", "Workload (deployment/<name>) or label selector (app=<name>); its first running pod is profiled"),
+					"namespace":     prop("string", "Kubernetes namespace (default: default)"),
+					"kube_context":  prop("string", "kubectl context for every kubectl call (default: current context)"),
+					"container":     prop("string", "Container to profile (default: the pod's first)"),
+					"image":         prop("string", "Agent image (default: PPROF_MCP_DEBUG_IMAGE)"),
+					"agent_command": prop("string", "Agent command with {pid}, {seconds}, {output} placeholders (default: perf record + perf_to_profile)"),
+					"pid":           prop("string", "Process to sample, as seen from the target container (default: 1)"),
+					"seconds":       integerProp("Sampling duration in seconds (default: 30)", intPtr(1), intPtr(300)),
+					"out_dir":       prop("string", "Output directory; the profile goes to out_dir/<pod> (required)"),
+					"service":       prop("string", "File prefix (default: workload name, app label, or pod)"),
+					"confirm":       prop("boolean", "Set to true only after the user approved injecting a privileged ephemeral container (required unless dry_run)"),
+					"dry_run":       dryRunProp(),
+				}, "out_dir"),
+				Annotations:  destructive(),
+				OutputSchema: withDryRunOutput(k8sDebugCaptureOutputSchema()),
+			},
+			Handler: k8sDebugCaptureTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.branch_impact",
+				Description: `Compare profiles between git branches to measure performance impact of code changes.
+
+**When to use**: Measure the performance impact of a code change by comparing profiles before and after.
+
+**How it works**:
+1. Captures baseline profile from before_ref (default: main)
+2. Handles uncommitted changes (auto-stash/restore)
+3. Switches to after_ref (default: current branch)
+4. Waits for the dev environment to rebuild (detects live updates, restarts, or recreated pods/containers)
+5. Captures post-change profile
+6. Returns handles for both profiles for comparison
+7. Restores original branch and uncommitted changes
+
+**Rebuild Detection**:
+- dev_env=tilt (default) monitors the Tilt API and detects live updates (file sync) or pod restarts
+- dev_env=compose watches the service's docker compose container (e.g. under docker compose watch) for a recreate or restart; profiles are fetched from the host port published for pprof_port (default 6060)
+- dev_env=skaffold watches the pods skaffold dev deploys for a rollout or restart; profiles are fetched from the pod over plain HTTP
+- dev_env=rollout watches deployment/<service> in a real cluster: the new code is live once a ReplicaSet with a new pod-template-hash has fully rolled out (and, with gitops_app, the Argo CD Application or Flux Kustomization is synced and healthy). Pass deploy_command to ship each ref (e.g. push an image and bump the manifest) when CI or GitOps does not; profiles come from a pod of the new ReplicaSet
+- Reports which update method was used
+- Configurable timeout and warmup delays
+
+**Git Handling**:
+- Automatically stashes uncommitted changes before switching branches
+- Restores stashed changes after profiling
+- Returns to original branch on completion
+
+**Multiple services**: Pass services to profile dependent services (e.g. api + worker) on each ref as well. They are profiled concurrently, each gets its own before/after handles, and a combined report shows total CPU per service and how its share of the total moved, since a change often shifts cost between services.
+
+**Repetition**: A single pair of CPU profiles is noisy. Pass runs=N (e.g. 5) to capture each ref N times: handles then point at the CPU profile merged across runs (mean per run), and stats lists each service's total and per-function flat CPU with mean, stddev, and a 95% confidence interval for the change, marking changes whose interval excludes zero as significant.
+
+**Load**: Pass load_command, k6_script, or vegeta_targets to drive traffic while each ref is profiled, so both profiles reflect comparable load. The load starts a few seconds before the CPU profile and covers it; the tool's summary (requests, rate, latency percentiles) is returned per ref, with a warning when request counts differ by more than 10%.
+
+**Analysis**: Once the original branch is restored, the comparison is analyzed without further tool calls: pprof.diff_top on the cpu, mutex, and block profiles (the largest increases and decreases per type), pprof.hotspot_summary on each ref, and a markdown report of both, returned as report and written to out_dir/report.md. Pass analyze=false to skip it.
+
+**Dry run**: Pass dry_run=true to get the exact git, dev environment, and kubectl/docker commands without switching branches or touching the cluster.
+
+**Returns**: Profile handles for before/after, update method, the analysis and report, and any warnings.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"service":         prop("string", "The service name to profile (e.g., ratelimit, innkeeper) (required)"),
+					"services":        arrayPropSchema(prop("string", "Service name"), "Dependent services profiled alongside service on each ref (e.g. a worker the change also touches); adds per-service results and a combined CPU report"),
+					"out_dir":         prop("string", "Output directory for downloaded profiles (required)"),
+					"before_ref":      prop("string", "Git ref for baseline (default: main)"),
+					"after_ref":       prop("string", "Git ref for comparison (default: current branch)"),
+					"seconds":         integerProp("Duration in seconds for CPU profile (default: 30)", intPtr(1), intPtr(300)),
+					"runs":            integerProp("CPU captures per ref (default: 1); with 2 or more, profiles are merged per ref and per-function deltas come with 95% confidence intervals", intPtr(1), intPtr(10)),
+					"rebuild_timeout": integerProp("Timeout in seconds for rebuild detection (default: 300)", intPtr(10), intPtr(1800)),
+					"warmup_delay":    integerProp("Warmup delay in seconds after rebuild (default: 15)", intPtr(0), intPtr(120)),
+					"namespace":       prop("string", "Kubernetes namespace of the service's pods (default: default)"),
+					"kube_context":    prop("string", "kubectl context for pod discovery and port-forwards (default: current context); Tilt is queried through its own API server"),
+					"dev_env":         enumProp("string", "Dev environment that rebuilds the service after each checkout (default: tilt, or PPROF_MCP_DEV_ENV)", []string{"tilt", "compose", "skaffold", "rollout"}),
+					"pprof_port":      integerProp("pprof port of the service for compose (container port, default 6060) and skaffold (default: discovered)", intPtr(1), intPtr(65535)),
+					"deploy_command":  prop("string", "Shell command run after each checkout to ship the ref, for environments that do not rebuild on their own; {ref} is substituted. A failure stops the run"),
+					"gitops_app":      prop("string", "With dev_env=rollout, also wait for this Argo CD Application (argocd/[namespace/]name) or Flux Kustomization (flux/[namespace/]name) to sync and turn healthy"),
+					"load_command":    prop("string", "Shell command generating traffic during each capture; {seconds}, {ref}, and {side} are substituted (also PPROF_MCP_LOAD_SECONDS, _REF, _SIDE in its environment)"),
+					"k6_script":       prop("string", "k6 script run during each capture instead of load_command; its VUs and scenarios apply, duration is set to cover the capture"),
+					"vegeta_targets":  prop("string", "vegeta targets file attacked during each capture instead of load_command"),
+					"load_rate":       integerProp("vegeta requests per second (default: 50)", intPtr(1), intPtr(100000)),
+					"analyze":         prop("boolean", "Diff the cpu, mutex, and block profiles, summarize hotspots on both refs, and write out_dir/report.md once the captures finish (default: true)"),
+					"dry_run":         dryRunProp(),
+				}, "service", "out_dir"),
+				Annotations:  destructive(),
+				OutputSchema: withDryRunOutput(d2BranchImpactOutputSchema()),
+			},
+			Handler: d2BranchImpactTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.branch_impact.plan",
+				Description: `Create an execution plan for branch impact profiling without executing it.
+
+**When to use**: Generate a plan to review before running a long-running profile comparison.
+
+**Workflow**:
+1. Call this tool with your parameters
+2. Review the execution plan (steps, estimated time)
+3. Call pprof.branch_impact.execute with the plan ID to run it
+
+**Returns**: Execution plan with unique ID, steps, and estimated duration.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"service":         prop("string", "The service name to profile (e.g., ratelimit, innkeeper) (required)"),
+					"services":        arrayPropSchema(prop("string", "Service name"), "Dependent services profiled alongside service on each ref (e.g. a worker the change also touches); adds per-service results and a combined CPU report"),
+					"out_dir":         prop("string", "Output directory for downloaded profiles (required)"),
+					"before_ref":      prop("string", "Git ref for baseline (default: main)"),
+					"after_ref":       prop("string", "Git ref for comparison (default: current branch)"),
+					"seconds":         integerProp("Duration in seconds for CPU profile (default: 30)", intPtr(1), intPtr(300)),
+					"runs":            integerProp("CPU captures per ref (default: 1); with 2 or more, profiles are merged per ref and per-function deltas come with 95% confidence intervals", intPtr(1), intPtr(10)),
+					"rebuild_timeout": integerProp("Timeout in seconds for rebuild detection (default: 300)", intPtr(10), intPtr(1800)),
+					"warmup_delay":    integerProp("Warmup delay in seconds after rebuild (default: 15)", intPtr(0), intPtr(120)),
+					"namespace":       prop("string", "Kubernetes namespace of the service's pods (default: default)"),
+					"kube_context":    prop("string", "kubectl context for pod discovery and port-forwards (default: current context); Tilt is queried through its own API server"),
+					"dev_env":         enumProp("string", "Dev environment that rebuilds the service after each checkout (default: tilt, or PPROF_MCP_DEV_ENV)", []string{"tilt", "compose", "skaffold", "rollout"}),
+					"pprof_port":      integerProp("pprof port of the service for compose (container port, default 6060) and skaffold (default: discovered)", intPtr(1), intPtr(65535)),
+					"deploy_command":  prop("string", "Shell command run after each checkout to ship the ref, for environments that do not rebuild on their own; {ref} is substituted. A failure stops the run"),
+					"gitops_app":      prop("string", "With dev_env=rollout, also wait for this Argo CD Application (argocd/[namespace/]name) or Flux Kustomization (flux/[namespace/]name) to sync and turn healthy"),
+					"load_command":    prop("string", "Shell command generating traffic during each capture; {seconds}, {ref}, and {side} are substituted (also PPROF_MCP_LOAD_SECONDS, _REF, _SIDE in its environment)"),
+					"k6_script":       prop("string", "k6 script run during each capture instead of load_command; its VUs and scenarios apply, duration is set to cover the capture"),
+					"vegeta_targets":  prop("string", "vegeta targets file attacked during each capture instead of load_command"),
+					"load_rate":       integerProp("vegeta requests per second (default: 50)", intPtr(1), intPtr(100000)),
+					"analyze":         prop("boolean", "Diff the cpu, mutex, and block profiles, summarize hotspots on both refs, and write out_dir/report.md once the captures finish (default: true)"),
+				}, "service", "out_dir"),
+				Annotations:  readOnlyLocal(),
+				OutputSchema: d2BranchImpactPlanOutputSchema(),
+			},
+			Handler: d2BranchImpactPlanTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.branch_impact.execute",
+				Description: `Execute a previously created branch impact profiling plan.
+
+**When to use**: After reviewing a plan created with pprof.branch_impact.plan.
+
+**Important**: This will take several minutes to complete. You can walk away after approval.
+
+A plan runs once and must be executed within 24 hours of creation. Its status and result are recorded with the plan, so they survive a server restart and can be reviewed later with pprof.branch_impact.show.
+
+**Returns**: Profile handles for before/after, update method, and any warnings.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"plan_id": prop("string", "Plan ID from pprof.branch_impact.plan (required)"),
+					"dry_run": dryRunProp(),
+				}, "plan_id"),
+				Annotations:  destructive(),
+				OutputSchema: withDryRunOutput(d2BranchImpactOutputSchema()),
+			},
+			Handler: d2BranchImpactExecuteTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "d2.branch_impact.abort",
+				Description: `Abort a running branch impact comparison and put the repository back the way it was.
+
+**When to use**: A pprof.branch_impact or pprof.branch_impact.execute call is taking too long or was started by mistake, or a server died mid-run and left the repo on the wrong branch.
+
+**What it does**:
+1. Cancels the run in progress (optionally only if it is plan_id)
+2. Waits for it to check out the original branch and pop the auto-stash
+3. Reports what the run was doing and what was restored
+
+With the plan_id of a plan still marked running by a server that has since exited, it restores that plan's original branch and pops its auto-stash if it is the newest stash entry.
+
+**Returns**: Plan ID, service, the phase the run was in, and the restored branch and stash state with any errors.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"plan_id": prop("string", "Only abort this plan (ID or unique prefix); required to recover a run left by an exited server"),
+				}),
+				Annotations:  destructive(),
+				OutputSchema: d2BranchImpactAbortOutputSchema(),
+			},
+			Handler: d2BranchImpactAbortTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.branch_impact.list",
+				Description: `List branch impact plans and past runs, newest first.
+
+**When to use**: Find a plan created earlier (including before a server restart), or look back at previous branch comparisons.
+
+Plans are stored under the workspace (or PPROF_MCP_PLAN_DIR) and kept for 30 days. A pending plan expires 24 hours after creation.
+
+**Returns**: Plan ID, status (pending, running, succeeded, failed, aborted, expired), service, refs, and timestamps for each plan.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"status": enumProp("string", "Only plans with this status", []string{"pending", "running", "succeeded", "failed", "aborted", "expired"}),
+					"limit":  integerProp("Maximum plans to return (default: 20, 0 for all)", intPtr(0), nil),
+				}),
+				Annotations:  readOnlyLocal(),
+				OutputSchema: d2BranchImpactListOutputSchema(),
+			},
+			Handler: d2BranchImpactListTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.branch_impact.show",
+				Description: `Show a branch impact plan with its steps, parameters, and, once executed, its run: timing, error, and the before/after profile paths.
+
+**When to use**: Review a past comparison found with pprof.branch_impact.list. Pass the profile paths to pprof.diff_top to compare them again.
+
+**Returns**: The stored plan.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"plan_id": prop("string", "Plan ID, or a unique prefix of one (required)"),
+				}, "plan_id"),
+				Annotations:  readOnlyLocal(),
+				OutputSchema: d2BranchImpactShowOutputSchema(),
+			},
+			Handler: d2BranchImpactShowTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "d2.schedule.start",
+				Description: `Capture profiles from local services on an interval, for trend and leak analysis of a long-running soak test without Datadog.
+
+**When to use**: A service runs under sustained load in the dev environment and you want to see whether heap, goroutines, or CPU drift over time.
+
+**How it works**:
+1. Every interval, captures cpu, heap, goroutine, mutex, block, and allocs profiles from each service at once (through tilt, compose, or skaffold, as pprof.branch_impact does)
+2. Writes each capture to out_dir/<service>/<timestamp>
+3. Records heap in use, goroutine count, and CPU seconds of every capture
+4. Stops after count rounds or duration (default: 24 hours), or when stopped with d2.schedule.stop
+
+The call returns immediately; the schedule runs in the background of this server. Use d2.schedule.show for captures and trends.
+
+**Returns**: Schedule ID, status, and where captures are written.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"services":     arrayOrStringPropMin(prop("string", "Service name"), "Services to capture (required)", 1),
+					"interval":     integerProp("Seconds between captures (default: 300; at least 30 and seconds + 10)", intPtr(30), intPtr(86400)),
+					"seconds":      integerProp("CPU profile duration in seconds (default: 30)", intPtr(1), intPtr(300)),
+					"count":        integerProp("Stop after this many rounds (default: until duration)", intPtr(0), nil),
+					"duration":     integerProp("Stop after this many seconds (default: 86400 when count is unset; at most 7 days)", intPtr(0), intPtr(604800)),
+					"namespace":    prop("string", "Kubernetes namespace (default: default)"),
+					"kube_context": prop("string", "kubectl context for every kubectl call (default: current context)"),
+					"dev_env":      enumProp("string", "Dev environment the services run in (default: tilt, or PPROF_MCP_DEV_ENV)", []string{"tilt", "compose", "skaffold", "rollout"}),
+					"pprof_port":   integerProp("pprof port of the services for compose (container port, default 6060) and skaffold (default: discovered)", intPtr(1), intPtr(65535)),
+					"out_dir":      prop("string", "Directory captures are written under (default: <schedule dir>/<id>)"),
+					"dry_run":      dryRunProp(),
+				}, "services"),
+				Annotations:  remoteDownload(),
+				OutputSchema: withDryRunOutput(d2ScheduleOutputSchema()),
+			},
+			Handler: d2ScheduleStartTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "d2.schedule.stop",
+				Description: `Stop a periodic capture started with d2.schedule.start.
+
+**When to use**: The soak test is over, or a schedule was started by mistake. Captures already made are kept.
+
+A schedule left running by a server that has since exited is marked stopped.
+
+**Returns**: The stopped schedule with its capture counts.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"schedule_id": prop("string", "Schedule ID, or a unique prefix of one (required)"),
+				}, "schedule_id"),
+				Annotations:  localWrite(true),
+				OutputSchema: d2ScheduleOutputSchema(),
+			},
+			Handler: d2ScheduleStopTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "d2.schedule.list",
+				Description: `List periodic captures, newest first.
+
+**When to use**: Find a schedule started earlier, including by profctl d2 schedule or before a server restart.
+
+Schedules are recorded under the workspace (or PPROF_MCP_SCHEDULE_DIR). A schedule still marked running whose process has exited is reported as interrupted.
+
+**Returns**: Schedule ID, status (running, finished, stopped, failed, interrupted), services, capture counts, and metrics growing across captures.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"status": enumProp("string", "Only schedules with this status", []string{"running", "finished", "stopped", "failed", "interrupted"}),
+					"limit":  integerProp("Maximum schedules to return (default: 20, 0 for all)", intPtr(0), nil),
+				}),
+				Annotations:  readOnlyLocal(),
+				OutputSchema: d2ScheduleListOutputSchema(),
+			},
+			Handler: d2ScheduleListTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "d2.schedule.show",
+				Description: `Show a periodic capture with per-service trends and its latest captures.
+
+**When to use**: Check whether a soak test is leaking. For each service, heap in use, goroutines, and CPU seconds are summarized from first to last capture with a least-squares slope per hour; heap or goroutines that grow in most intervals and by at least 10% overall are flagged as growing. Diff the first and last heap profiles with pprof.diff_top to find what grew.
+
+**Returns**: The schedule, trends per service, and the latest captures with their profile paths.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"schedule_id": prop("string", "Schedule ID, or a unique prefix of one (required)"),
+					"captures":    integerProp("Latest captures to include (default: 20, 0 for all)", intPtr(0), nil),
+				}, "schedule_id"),
+				Annotations:  readOnlyLocal(),
+				OutputSchema: d2ScheduleShowOutputSchema(),
+			},
+			Handler: d2ScheduleShowTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.top",
+				Description: `Show top functions by CPU/memory usage from a pprof profile.
+
+**When to use**: First tool to run after downloading profiles. Identifies which functions consume the most resources.
+
+**Key options**:
+- cum=true: Sort by cumulative time (time spent in function + all functions it calls)
+- cum=false (default): Sort by flat time (time spent only in the function itself)
+- sample_index: Use 'alloc_space' for heap profiles, 'delay' for mutex/block profiles
+- focus: Filter to functions matching regex (e.g., "mypackage")
+
+**Returns**: Structured data with function names, flat/cumulative values, and percentages.
+
+**Optional**: Use max_lines or max_bytes to cap raw output text.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"profile":           ProfilePath(),
+					"binary":            BinaryPathOptional(),
+					"cum":               prop("boolean", "Sort by cumulative value instead of flat (default: false)"),
+					"nodecount":         integerProp("Maximum number of nodes to show (default: 10)", intPtr(0), nil),
+					"focus":             prop("string", "Regex to focus on specific functions"),
+					"ignore":            prop("string", "Regex to ignore specific functions"),
+					"sample_index":      prop("string", "Sample index to use (e.g., cpu, alloc_space, inuse_space)"),
+					"compare_baseline":  prop("boolean", "Compare against stored baseline metrics and update baseline (default: false)"),
+					"baseline_key":      prop("string", "Optional baseline key to scope historical comparisons"),
+					"baseline_path":     prop("string", "Optional path to baseline store file (default: .pprof-mcp-baselines.json)"),
+					"service":           prop("string", "Service name (optional; used for baseline key)"),
+					"env":               prop("string", "Environment (optional; used for baseline key)"),
+					"max_lines":         integerProp("Maximum number of raw output lines to return", intPtr(0), nil),
+					"max_bytes":         integerProp("Maximum number of raw output bytes to return", intPtr(0), nil),
+					"truncate_strategy": enumProp("string", "Truncation strategy (head, tail, head_tail)", []string{"head", "tail", "head_tail"}),
+				}, "profile"),
+				Annotations:  localWrite(false),
+				OutputSchema: pprofTopOutputSchema(),
+			},
+			Handler: pprofTopTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.peek",
+				Description: `Show callers and callees of functions matching a pattern.
+
+**When to use**: After identifying a hot function with pprof.top, use this to understand:
+- Who calls this function (callers)
+- What functions it calls (callees)
+
+**Example**: If pprof.top shows "json.Unmarshal" is hot, use peek to see which of YOUR functions call it.
+
+**Important for heap profiles**: Use sample_index="alloc_space" for allocation analysis, otherwise peek defaults to inuse_space which may not show all functions.
+
+**Symbols**: Without binary, an unsymbolized profile's binary is found as pprof.resolve_binary does, with the config file's binaries settings, and reported as binary_resolution.
+
+**Source paths**: Without trim_path, the build-time prefix of the profile's file paths is inferred by matching them to files under repo_root, and reported as trim_path_inference.
+
+**Dependencies**: Third-party functions are annotated from the module cache (GOMODCACHE) at the version the profile was built with, so repos that don't vendor work too. download_modules fetches missing versions with go mod download; module_sources reports where each came from.
+
+**Optional**: Use max_lines or max_bytes to cap the output size.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"profile":           ProfilePath(),
+					"binary":            BinaryPathOptional(),
+					"regex":             prop("string", "Regex pattern to match function names (required)"),
+					"sample_index":      prop("string", "Sample index to use (e.g., cpu, alloc_space, inuse_space). Required for heap profiles to find allocation hot spots."),
+					"max_lines":         integerProp("Maximum number of output lines to return", intPtr(0), nil),
+					"max_bytes":         integerProp("Maximum number of output bytes to return", intPtr(0), nil),
+					"truncate_strategy": enumProp("string", "Truncation strategy (head, tail, head_tail)", []string{"head", "tail", "head_tail"}),
+				}, "profile", "regex"),
+				Annotations:  readOnlyLocal(),
+				OutputSchema: pprofTextOutputSchema(),
+			},
+			Handler: pprofPeekTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.list",
+				Description: `Show annotated source code with line-level profiling data.
+
+**When to use**: After identifying a hot function, use this to see exactly which LINES are expensive.
+
+**Requirements**: Source code must be available. Use repo_root to specify where sources are located.
+
+**Example output**: Shows each line with CPU time, helping pinpoint the exact bottleneck.
+
+**Symbols**: Without binary, an unsymbolized profile's binary is found as pprof.resolve_binary does, with the config file's binaries settings, and reported as binary_resolution.
+
+**Optional**: Use max_lines or max_bytes to cap the output size.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"profile":           ProfilePath(),
+					"binary":            BinaryPathOptional(),
+					"function":          prop("string", "Function name or regex to list source for (required)"),
+					"repo_root":         prop("string", "Repository root path for source file resolution"),
+					"trim_path":         prop("string", "Path prefixes to trim from source file paths, separated by ':' (default: inferred by matching the profile's paths to files under repo_root)"),
+					"source_paths":      arrayOrStringPropSchema(prop("string", "Source path"), "Additional source paths for vendored or external dependencies (string or list)"),
+					"download_modules":  prop("boolean", "Run go mod download for module versions missing from the module cache (default: false)"),
+					"snippet_format":    enumProp("string", "Snippet format: text (default) or html, which adds html: the listing highlighted with hot lines shaded by flat%", []string{"text", "html"}),
+					"max_lines":         integerProp("Maximum number of output lines to return", intPtr(0), nil),
+					"max_bytes":         integerProp("Maximum number of output bytes to return", intPtr(0), nil),
+					"truncate_strategy": enumProp("string", "Truncation strategy (head, tail, head_tail)", []string{"head", "tail", "head_tail"}),
+				}, "profile", "function"),
+				Annotations:  readOnlyRemote(),
+				OutputSchema: pprofListOutputSchema(),
+			},
+			Handler: pprofListTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.traces",
+				Description: `Show stack traces from a profile.
+
+**When to use**: To see the actual call stacks that were sampled. Useful for understanding the full execution context.
+
+**Note**: Output can be large; use 'lines' (or alias 'max_lines') to limit.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"profile":           ProfilePath(),
+					"binary":            BinaryPathOptional(),
+					"lines":             integerProp("Maximum number of lines to return (default: 200)", intPtr(0), intPtr(maxTracesLines)),
+					"max_lines":         integerProp("Alias for lines", intPtr(0), intPtr(maxTracesLines)),
+					"max_bytes":         integerProp("Maximum number of output bytes to return", intPtr(0), nil),
+					"truncate_strategy": enumProp("string", "Truncation strategy (head, tail, head_tail)", []string{"head", "tail", "head_tail"}),
+				}, "profile"),
+				Annotations:  readOnlyLocal(),
+				OutputSchema: pprofTextOutputSchema(),
+			},
+			Handler: pprofTracesTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.diff_top",
+				Description: `Compare two profiles to identify performance changes.
+
+**When to use**:
+- Before/after optimization comparisons
+- Identifying regressions between releases
+- Comparing different time periods
+
+**Workflow**:
+1. Download baseline profile (e.g., before fix) with profiles.download_latest_bundle
+2. Download comparison profile (e.g., after fix)
+3. Use this tool with 'before' and 'after' paths
+
+**Returns**: Delta showing which functions improved/regressed and by how much.
+
+**Optional**: Use max_lines or max_bytes to include a truncated text summary.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"before":            prop("string", "Path or handle for the baseline pprof profile (required)"),
+					"after":             prop("string", "Path or handle for the comparison pprof profile (required)"),
+					"binary":            BinaryPathOptional(),
+					"cum":               prop("boolean", "Sort by cumulative value instead of flat (default: false)"),
+					"nodecount":         integerProp("Maximum number of nodes to show", intPtr(0), nil),
+					"focus":             prop("string", "Regex to focus on specific functions"),
+					"ignore":            prop("string", "Regex to ignore specific functions"),
+					"sample_index":      prop("string", "Sample index to use (e.g., cpu, alloc_space, inuse_space)"),
+					"max_lines":         integerProp("Maximum number of summary lines to return", intPtr(0), nil),
+					"max_bytes":         integerProp("Maximum number of summary bytes to return", intPtr(0), nil),
+					"truncate_strategy": enumProp("string", "Truncation strategy (head, tail, head_tail)", []string{"head", "tail", "head_tail"}),
+				}, "before", "after"),
+				Annotations:  readOnlyLocal(),
+				OutputSchema: pprofDiffTopOutputSchema(),
+			},
+			Handler: pprofDiffTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.regression_check",
+				Description: `Check whether specific functions exceed regression thresholds.
+
+**When to use**: CI or automated checks for performance regressions in a profile.
+
+**Returns**: Pass/fail and per-check details.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"profile":      ProfilePath(),
+					"sample_index": prop("string", "Sample index to use (e.g., cpu, alloc_space, delay)"),
+					"checks": arrayPropMin(NewObjectSchema(map[string]any{
+						"function": prop("string", "Function regex to check (required)"),
+						"metric":   enumProp("string", "Metric to compare (flat_pct or cum_pct)", []string{"flat_pct", "cum_pct"}),
+						"max":      numberProp("Maximum allowed percent (required)", floatPtr(0), nil),
+					}, "function", "metric", "max"), "Regression checks", 1),
+				}, "profile", "checks"),
+				Annotations:  readOnlyLocal(),
+				OutputSchema: pprofRegressionCheckOutputSchema(),
+			},
+			Handler: pprofRegressionCheckTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name:        "pprof.meta",
+				Description: "Extract metadata from a pprof profile including sample types, duration, drop frames, and comments. Useful for understanding what data is available in a profile.",
+				InputSchema: NewObjectSchema(map[string]any{
+					"profile": ProfilePath(),
+				}, "profile"),
+				Annotations:  readOnlyLocal(),
+				OutputSchema: pprofMetaOutputSchema(),
+			},
+			Handler: pprofMetaTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name:        "pprof.validate",
+				Description: "Check that a file is a parsable pprof profile worth analyzing before spending calls on it: reports sample counts and totals per type, duration, mapping coverage, and symbolization ratio, and flags empty, truncated, zero-sample, and unsymbolized profiles in problems. valid is false when any problem has severity error.",
+				InputSchema: NewObjectSchema(map[string]any{
+					"profile": ProfilePath(),
+				}, "profile"),
+				Annotations:  readOnlyLocal(),
+				OutputSchema: pprofValidateOutputSchema(),
+			},
+			Handler: pprofValidateTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name:        "pprof.symbolization",
+				Description: "Measure symbolization before asking for a binary: for each mapping, how much sample value lands on named functions versus raw addresses, the hottest raw addresses, and which mappings need symbols. recommendation names the binary to pass (or pprof.resolve_binary to run) only when the main mapping has gaps, and says when raw frames are in shared libraries or [vdso] that no binary will fix.",
+				InputSchema: NewObjectSchema(map[string]any{
+					"profile":      ProfilePath(),
+					"sample_index": prop("string", "Sample type to weight frames by (default: the profile kind's default)"),
+				}, "profile"),
+				Annotations:  readOnlyLocal(),
+				OutputSchema: pprofSymbolizationOutputSchema(),
+			},
+			Handler: pprofSymbolizationTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.storylines",
+				Description: `Find the top N hot code paths ("storylines") in your repository.
+
+**When to use**: To get a high-level view of where time is spent in YOUR code (not library code).
+
+**Key options**:
+- repo_prefix: Identifies your code (e.g., "github.com/myorg/myrepo"). Defaults to repo_prefixes from the config file, else the module paths in repo_root's go.mod and go.work use directives.
+- n: Number of storylines to return (default: 4)
+
+**Auto-detection**: For heap profiles, automatically uses alloc_space to show allocation hot spots instead of just in-use memory.
+
+**Returns**: The most expensive execution paths with source-level detail, filtered to your repository code.
+
+**Markdown**: Set format="markdown" for a paste-ready section per storyline (call chain, percentages, annotated source snippet).
+
+**Ownership**: When repo_root has a CODEOWNERS file, each storyline lists the owners of its first app frame.
+
+**Permalinks**: When repo_root's origin is on GitHub, GitLab, or Bitbucket, call_chain_permalinks link each frame's line at revision (default: HEAD, flagged from_head), so results can be shared; github.com module frames link to the module's repository at its version.
+
+**Optional**: Use max_lines/max_bytes/truncate_strategy to control raw evidence output.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"profile":           ProfilePath(),
+					"n":                 integerProp("Number of storylines to return (default: 4)", intPtr(0), nil),
+					"focus":             prop("string", "Regex to focus on specific functions"),
+					"ignore":            prop("string", "Regex to ignore specific functions"),
+					"repo_prefix":       arrayOrStringPropSchema(prop("string", "Repository prefix"), "Repository path prefixes to identify your code (e.g., github.com/myorg/myrepo) (string or list)"),
+					"repo_root":         prop("string", "Local repository root path for source file resolution"),
+					"trim_path":         prop("string", "Path prefixes to trim from source file paths, separated by ':' (default: inferred by matching the profile's paths to files under repo_root)"),
+					"sample_index":      prop("string", "Sample index to use (auto-detected for heap profiles: uses alloc_space)"),
+					"format":            enumProp("string", "Output format: json (default) or markdown, which adds result.markdown with call chains and source snippets", []string{"json", "markdown"}),
+					"snippet_format":    enumProp("string", "Snippet format: text (default) or html, which adds html to list evidence: the listing highlighted with hot lines shaded by flat%", []string{"text", "html"}),
+					"revision":          prop("string", "Profiled commit that call chain permalinks point at (default: repo_root's HEAD)"),
+					"max_lines":         integerProp("Maximum number of evidence output lines to return", intPtr(0), nil),
+					"max_bytes":         integerProp("Maximum number of evidence output bytes to return", intPtr(0), nil),
+					"truncate_strategy": enumProp("string", "Truncation strategy (head, tail, head_tail)", []string{"head", "tail", "head_tail"}),
+				}, "profile"),
+				Annotations:  readOnlyLocal(),
+				OutputSchema: pprofStorylinesOutputSchema(),
+			},
+			Handler: pprofStorylinesTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.memory_sanity",
+				Description: `Analyze a heap profile for patterns that cause RSS growth beyond Go heap.
+
+**When to use**: When container RSS is high but Go heap profile shows low memory usage.
+
+**Detects**:
+- SQLite temp_store=MEMORY patterns (RSS grows outside Go heap)
+- High goroutine counts (stack memory not in heap)
+- CGO allocations (memory outside Go control)
+- Compression buffer issues (zstd, zlib)
+- RSS/heap mismatch when container_rss_mb is provided
+
+**Confidence levels**: Each finding includes a confidence level:
+- confirmed: Direct evidence (e.g., libc.Alloc in CPU profile)
+- likely: Strong indirect evidence (e.g., SQLite + libc patterns + high churn)
+- suspected: Moderate evidence, needs confirmation
+- possible: Weak signal, worth investigating
+
+**Best results**: Provide heap, CPU profiles AND repo_root for maximum insight. CPU profile confirms off-heap allocation, repo scanning finds the problematic code.
+
+**Repo scan**: repo_root is searched in-process, honoring .gitignore and skipping binary files and files over 2 MiB. Besides the built-in patterns it looks for every patterns.code entry in the config file, reporting its severity and remediation with each finding.
+
+**Example use case**: Container OOM but heap profile shows only 124MB. This tool identifies likely causes like temp_store=MEMORY and shows you where in the code to fix it.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"heap_profile":      prop("string", "Path or handle to heap profile file (required)"),
+					"goroutine_profile": prop("string", "Optional path or handle to goroutine profile for stack analysis"),
+					"cpu_profile":       prop("string", "Optional path or handle to CPU profile for cross-referencing (improves confidence)"),
+					"repo_root":         prop("string", "Optional repository root to scan for problematic code patterns (e.g., temp_store=MEMORY)"),
+					"binary":            BinaryPathOptional(),
+					"container_rss_mb":  integerProp("Container RSS in MB for mismatch detection", intPtr(0), nil),
+				}, "heap_profile"),
+				Annotations:  readOnlyLocal(),
+				OutputSchema: pprofMemorySanityOutputSchema(),
+			},
+			Handler: pprofMemorySanityTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.goroutine_analysis",
+				Description: `Analyze goroutine profiles to detect leaks, blocking patterns, and anomalous wait states.
+
+**When to use**: After downloading goroutine profiles to check for goroutine leaks or excessive blocking.
+
+**Returns**: Total goroutine count, state distribution, top wait reasons, and potential leak signatures.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"profile": ProfilePath(),
+				}, "profile"),
+				Annotations:  readOnlyLocal(),
+				OutputSchema: pprofGoroutineAnalysisOutputSchema(),
+			},
+			Handler: pprofGoroutineAnalysisTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.contention_analysis",
+				Description: `Analyze mutex/block profiles to identify lock contention patterns.
+
+**When to use**: After downloading mutex or block profiles to understand contention hotspots.
+
+**Returns**: Total contention metrics, top lock sites, waiting functions, patterns, and recommendations.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"profile": ProfilePath(),
+				}, "profile"),
+				Annotations:  readOnlyLocal(),
+				OutputSchema: pprofContentionAnalysisOutputSchema(),
+			},
+			Handler: pprofContentionAnalysisTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.discover",
+				Description: `Run a comprehensive discovery analysis for a service and return a structured report.
+
+**When to use**: End-to-end profiling discovery. Downloads CPU, heap, mutex, block, and goroutine profiles and runs the analysis suite.
+
+**Returns**: Structured report with CPU utilization, overhead categories, allocation rates, contention, goroutine analysis, and recommendations.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"service":          prop("string", "The service name to analyze (required)"),
+					"env":              prop("string", "The environment (e.g., prod, staging) (required)"),
+					"out_dir":          prop("string", "Output directory for downloaded profiles (optional; temp dir if omitted)"),
+					"hours":            integerProp("Number of hours to look back for profiles (default: 72)", intPtr(0), nil),
+					"dd_site":          prop("string", "Datadog site (e.g., datadoghq.com, datadoghq.eu) (alias: site)"),
+					"site":             prop("string", "Datadog site (preferred; alias: dd_site)"),
+					"profile_id":       prop("string", "Specific profile ID to download (use with event_id)"),
+					"event_id":         prop("string", "Specific event ID to download (required if profile_id is set)"),
+					"repo_prefix":      arrayOrStringPropSchema(prop("string", "Repository prefix"), "Repository path prefixes to identify your code (string or list)"),
+					"container_rss_mb": integerProp("Container RSS in MB for heap mismatch detection", intPtr(0), nil),
+				}, "service", "env"),
+				Annotations:  remoteDownload(),
+				OutputSchema: pprofDiscoverOutputSchema(),
+			},
+			Handler: pprofDiscoverTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.cross_correlate",
+				Description: `Cross-correlate hotspots across CPU, heap, and mutex profiles from the same bundle.
+
+**When to use**: To identify functions that are hot in multiple profile types.
+
+**Input**: Provide a bundle handle (any profile handle from profiles.download_latest_bundle) or the bundle file list.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"bundle":    bundleInputSchema(),
+					"nodecount": integerProp("Top N rows to consider per profile (default: 20)", intPtr(0), nil),
+				}, "bundle"),
+				Annotations:  readOnlyLocal(),
+				OutputSchema: pprofCrossCorrelateOutputSchema(),
+			},
+			Handler: pprofCrossCorrelateTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.hotspot_summary",
+				Description: `Summarize top hotspots across CPU, heap, and mutex profiles in one call.
+
+**When to use**: Quick overview of top 3-5 functions across each profile type.
+
+**Input**: Provide a bundle handle (any profile handle from profiles.download_latest_bundle) or the bundle file list.
+
+**Ownership**: With a repo_root that has a CODEOWNERS file, each hotspot lists its owners and cpu_by_owner splits CPU across owning teams, so findings can be routed.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"bundle":    bundleInputSchema(),
+					"nodecount": integerProp("Top N rows per profile (default: 5)", intPtr(0), nil),
+					"repo_root": prop("string", "Repository root whose CODEOWNERS (.github/, root, docs/, or .gitlab/) attributes hotspots to owners"),
+				}, "bundle"),
+				Annotations:  readOnlyLocal(),
+				OutputSchema: pprofHotspotSummaryOutputSchema(),
+			},
+			Handler: pprofHotspotSummaryTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.trace_source",
+				Description: `Trace a hot function through the call chain with annotated source code.
+
+**When to use**: After identifying a hot function, to inspect the exact source lines in app code or vendored deps.
+
+**Permalinks**: When repo_root's origin is on GitHub, GitLab, or Bitbucket, each frame gets a permalink to its line at revision (default: HEAD, flagged from_head); github.com module frames link to the module's repository at its version.
+
+**Returns**: Call chain with source snippets, flat/cum percentages, and vendor metadata.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"profile":          ProfilePath(),
+					"function":         prop("string", "Function name or regex to trace (required)"),
+					"repo_root":        prop("string", "Repository root for source resolution"),
+					"max_depth":        integerProp("Maximum call stack depth to trace (default: 10)", intPtr(0), nil),
+					"show_vendor":      prop("boolean", "Include vendored dependencies (default: true)"),
+					"context_lines":    integerProp("Lines of context around hot lines (default: 5)", intPtr(0), nil),
+					"trim_path":        prop("string", "Path prefixes to trim from source file paths, separated by ':' (default: inferred by matching the profile's paths to files under repo_root)"),
+					"download_modules": prop("boolean", "Run go mod download for module versions missing from the module cache (default: false)"),
+					"snippet_format":   enumProp("string", "Snippet format: text (default) or html, which adds source_html to each frame: the snippet highlighted with hot lines shaded by flat%", []string{"text", "html"}),
+					"revision":         prop("string", "Profiled commit that frame permalinks point at (default: repo_root's HEAD)"),
+				}, "profile", "function"),
+				Annotations:  readOnlyRemote(),
+				OutputSchema: pprofTraceSourceOutputSchema(),
+			},
+			Handler: pprofTraceSourceTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.coverage_hotspots",
+				Description: `Rank hot functions by missing test coverage: hot and untested code is the riskiest place to optimize.
+
+**When to use**: Before optimizing a hotspot, to see whether tests would catch a behavior change, and which hot code needs tests first.
+
+**Coverage**: Reads coverage (a go test -coverprofile file), else runs go test -covermode=set -coverprofile over packages (default: ./...) in repo_root. Failing tests only warn: coverage still comes from the packages that ran.
+
+**Ranking**: Each hot repo function (cum% of at least min_pct) gets its statement coverage, a status (untested, low below low_coverage%, or covered), and risk = cum% × uncovered fraction; functions come most risky first. no_data marks functions with no coverage blocks at all, whose package has no tests or was not run.
+
+**Returns**: The ranked hotspots and the flat% spent in untested and low coverage code.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"profile":      ProfilePath(),
+					"repo_root":    prop("string", "Repository root the profiled code and tests live in (default: current directory)"),
+					"coverage":     prop("string", "Coverprofile to read instead of running go test"),
+					"packages":     arrayOrStringPropSchema(prop("string", "Package pattern"), "Packages go test covers (default: ./...) (string or list)"),
+					"trim_path":    prop("string", "Path prefixes to trim from source file paths, separated by ':' (default: inferred by matching the profile's paths to files under repo_root)"),
+					"sample_index": prop("string", "Sample type to rank by (default: the profile's primary type)"),
+					"limit":        integerProp("Hot functions to report (default: 20)", intPtr(0), nil),
+					"min_pct":      numberProp("Minimum cum percentage for a function to count as hot (default: 1.0)", floatPtr(0), nil),
+					"low_coverage": numberProp("Statement coverage percentage below which a function is low coverage (default: 50)", floatPtr(0), floatPtr(100)),
+				}, "profile"),
+				Annotations:  remoteDownload(),
+				OutputSchema: pprofCoverageHotspotsOutputSchema(),
+			},
+			Handler: pprofCoverageHotspotsTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.vendor_analyze",
+				Description: `Analyze vendored or external dependencies in hot paths.
+
+**When to use**: Identify expensive external packages, versions, and known issues.
+
+**App vs vendor**: Frames under repo_prefix are your code; the rest is vendor. repo_prefix defaults to repo_prefixes from the config file, else the module paths in repo_root's go.mod and go.work use directives.
+
+**Updates**: check_updates looks the 10 hottest modules up in the Go module proxy (GOPROXY's first proxy) and deps.dev, and diffs go.mod's version against the latest release: release dates, releases behind, and security advisories, each marked fixed_in_latest when upgrading clears it. Modules matching GOPRIVATE or GONOPROXY are never sent out.
+
+**Known issues**: Built-in notes for common packages, plus the config file's patterns.vendor entries, matched against each hotspot's hot function names.
+
+**Returns**: Aggregated vendor hotspots with version info and known performance notes.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"profile":       ProfilePath(),
+					"repo_root":     prop("string", "Repository root for go.mod and vendor resolution"),
+					"repo_prefix":   arrayOrStringPropSchema(prop("string", "Repository prefix"), "Module path prefixes of your code (default: go.mod and go.work modules at repo_root) (string or list)"),
+					"min_pct":       numberProp("Minimum percentage to include (default: 1.0)", floatPtr(0), nil),
+					"check_updates": prop("boolean", "Look hot modules up in the module proxy and deps.dev for latest versions, release dates, and advisories (default: false)"),
+				}, "profile"),
+				Annotations:  readOnlyRemote(),
+				OutputSchema: pprofVendorAnalyzeOutputSchema(),
+			},
+			Handler: pprofVendorAnalyzeTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.explain_overhead",
+				Description: `Explain why an overhead category or function is expensive and suggest optimizations.
+
+**When to use**: After overhead_report or when a specific function appears hot.
+
+**Returns**: Detailed explanation with causes and optimization strategies.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"profile":      ProfilePathOptional(),
+					"category":     prop("string", "Overhead category from overhead_report"),
+					"function":     prop("string", "Specific function to explain"),
+					"detail_level": prop("string", "brief, standard, or detailed (default: standard)"),
+				}),
+				Annotations:  readOnlyLocal(),
+				OutputSchema: pprofExplainOverheadOutputSchema(),
+			},
+			Handler: pprofExplainOverheadTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.suggest_fix",
+				Description: `Suggest concrete fixes based on profile analysis and issue type.
+
+**Deprecated**: This tool is being phased out; prefer pprof.vendor_analyze + manual fixes.
+
+**When to use**: Generate actionable patches and PR descriptions for known performance issues.
+
+**Pull requests**: With open_pr, the fix (fix_id, when several apply) is committed onto base_branch (default: origin's default branch) in a scratch index, leaving the checkout alone, pushed to a new pprof-mcp/ branch, and opened as a GitHub pull request with the generated description, profile evidence (evidence_links), and expected impact. The fix must be for repo code, not vendored, and every file it changes must match the base branch. Needs GITHUB_TOKEN or GH_TOKEN; GITHUB_API_URL points at GitHub Enterprise. A failure is a warning, and the suggestions are still returned.
+
+**Apply**: mode=apply writes the fix (fix_id, when several apply) into repo_root's working tree, keeping each original as a .orig backup, then runs go build and, if it compiles, go test over the touched packages. The result's applied section reports both; failing checks leave the change in place, and an existing .orig refuses the apply.
+
+**Returns**: Suggested fixes, diffs, next steps, and any pull request opened or change applied.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"profile":         ProfilePath(),
+					"issue":           prop("string", "Issue identifier (required)"),
+					"repo_root":       prop("string", "Repository root for patch generation"),
+					"target_function": prop("string", "Optional function to target"),
+					"output_format":   prop("string", "structured, diff, or pr_description (default: structured)"),
+					"open_pr":         prop("boolean", "Push the fix to a new branch and open a GitHub pull request for it (default: false)"),
+					"mode":            enumProp("string", "suggest (default) returns the fix; apply also writes it into the working tree and builds and tests the touched packages", []string{"suggest", "apply"}),
+					"fix_id":          prop("string", "Fix to apply or open a pull request for, when several apply"),
+					"base_branch":     prop("string", "Branch the pull request targets (default: origin's default branch, else main)"),
+					"draft":           prop("boolean", "Open the pull request as a draft (default: false)"),
+					"evidence_links":  arrayOrStringPropSchema(prop("string", "URL"), "Profile links cited as evidence in the pull request, e.g. the Datadog profile (string or list)"),
+				}, "profile", "issue"),
+				Annotations:  remoteWrite(),
+				OutputSchema: pprofSuggestFixOutputSchema(),
+			},
+			Handler: pprofSuggestFixTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "datadog.profiles.list",
+				Description: `List available profiles from Datadog for a service.
+
+**When to use**: To see what profiles are available before downloading. Shows timestamps and IDs.
+
+**Time parameters**:
+- hours: Look back N hours from now (default: 72)
+- from/to: Specific time range. Supports:
+  - Relative: "-3h", "-24h", "-30m"
+  - Absolute: "2025-01-15T10:00:00Z" (RFC3339)
+
+**Returns**: List of profile candidates with timestamps, profile_id, and event_id.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"service": prop("string", "The service name to list profiles for (required)"),
+					"env":     prop("string", "The environment (e.g., prod, staging) (required)"),
+					"from":    prop("string", "Start time (RFC3339 or relative like '-1h', '-24h')"),
+					"to":      prop("string", "End time (RFC3339 or relative)"),
+					"hours":   integerProp("Number of hours to look back (default: 72, ignored if from/to set)", intPtr(0), nil),
+					"limit":   integerProp("Maximum number of profiles to return (default: 50)", intPtr(0), nil),
+					"site":    prop("string", "Datadog site (e.g., datadoghq.com)"),
+					"host":    prop("string", "Host filter (e.g., '*prod-usw2a*' for AZ filtering, supports wildcards)"),
+				}, "service", "env"),
+				Annotations:  readOnlyRemote(),
+				OutputSchema: datadogProfilesListOutputSchema(),
+			},
+			Handler: datadogProfilesListTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "datadog.profiles.pick",
+				Description: `Select a specific profile using a selection strategy.
+
+**Strategies**:
+- latest (default): Most recent profile
+- oldest: Oldest profile in range (useful for before/after comparisons)
+- closest_to_ts: Profile closest to target_ts (requires target_ts parameter)
+- manual_index: Specific index from list (requires index parameter, 0-based)
+- most_samples: Profile with the highest sample count (falls back to latest if unavailable)
+- anomaly: Profile with highest statistical deviation (z-score > 2σ on CPU/memory/goroutine metrics)
+
+**Workflow for before/after comparison**:
+1. Pick oldest profile: strategy="oldest" for the baseline
+2. Pick latest profile: strategy="latest" for current state
+3. Download both with profiles.download_latest_bundle
+4. Compare with pprof.diff_top
+
+**Workflow for finding problematic profiles**:
+1. Pick anomalous profile: strategy="anomaly" to find outliers
+2. Download with profiles.download_latest_bundle using the profile_id
+3. Analyze with pprof.top or pprof.storylines`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"service":   prop("string", "The service name (required)"),
+					"env":       prop("string", "The environment (required)"),
+					"from":      prop("string", "Start time (RFC3339 or relative like '-3h')"),
+					"to":        prop("string", "End time (RFC3339 or relative)"),
+					"hours":     integerProp("Number of hours to look back (default: 72)", intPtr(0), nil),
+					"limit":     integerProp("Maximum profiles to consider (default: 50)", intPtr(0), nil),
+					"site":      prop("string", "Datadog site"),
+					"host":      prop("string", "Host filter (e.g., '*prod-usw2a*' for AZ filtering, supports wildcards)"),
+					"strategy":  enumProp("string", "Selection strategy: latest (default), oldest, closest_to_ts (needs target_ts), manual_index (needs index), most_samples, anomaly (finds outliers)", []string{"latest", "oldest", "closest_to_ts", "manual_index", "most_samples", "anomaly"}),
+					"target_ts": prop("string", "Target timestamp for 'closest_to_ts' strategy (RFC3339)"),
+					"index":     integerProp("Index for 'manual_index' strategy (0-based from list results)", intPtr(0), nil),
+				}, "service", "env"),
+				Annotations:  readOnlyRemote(),
+				OutputSchema: datadogProfilesPickOutputSchema(),
+			},
+			Handler: datadogProfilesPickTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "datadog.profiles.aggregate",
+				Description: `Aggregate multiple profiles over a time window into a merged profile.
+
+**When to use**: Merge multiple profiles for a more stable signal.
+
+**Returns**: Handle to the merged profile.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"service":      prop("string", "The service name (required)"),
+					"env":          prop("string", "The environment (required)"),
+					"window":       prop("string", "Time window to aggregate (e.g., '1h', '30m') (required)"),
+					"limit":        integerProp("Maximum profiles to merge (default: 10)", intPtr(0), nil),
+					"site":         prop("string", "Datadog site"),
+					"out_dir":      prop("string", "Output directory for downloaded profiles"),
+					"profile_type": enumProp("string", "Profile type to aggregate (default: cpu)", []string{"cpu", "heap", "mutex", "block", "goroutines"}),
+				}, "service", "env", "window"),
+				Annotations:  remoteDownload(),
+				OutputSchema: datadogProfilesAggregateOutputSchema(),
+			},
+			Handler: datadogProfilesAggregateTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "repo.services.discover",
+				Description: `Discover the services in a repository and how each is built. Useful for finding service names to use with Datadog profiling and the binary to symbolize a profile with.
+
+**Sources**: cmd/be-* directories, main packages anywhere in the tree (vendor, testdata, and hidden directories skipped; //go:build ignore generators excluded), Bazel go_binary rules, Makefile recipes running go build, Procfile processes, and Dockerfile ENTRYPOINT/CMD. Findings are merged per main package, else by binary name.
+
+**Datadog names**: Each service is mapped to its Datadog service and envs, from the config file's services section first, else by fuzzy-matching its service and binary names against the cached Datadog services (as datadog.services.search does). Only exact, prefix, and separator-insensitive matches count; a weak or tied match leaves datadog unset and lists datadog_candidates. Map those in the config file.
+
+**pprof endpoints**: Each main package and the repo packages it imports are scanned for net/http/pprof (blank imports register on http.DefaultServeMux), pprof handlers on custom muxes (including chi's middleware.Profiler and gin-contrib/pprof), the servers and pprof/debug address flags serving them, runtime.SetMutexProfileFraction and SetBlockProfileRate calls, and a /debug/pprof/rates endpoint. Notes say up-front which capture paths will not work: without an endpoint, k8s and d2 captures fail; without rates set or the rate endpoint, mutex and block profiles are empty. Addresses computed at runtime are not found.
+
+**Declared ports**: pprof_ports lists the pprof ports the deployment files declare, read the way k8s captures read a pod: workload manifests (pprof.port annotations, container ports named pprof, profiling, debug, or admin, pprof/debug/admin args and env, a declared 6060), Helm chart values (keys such as pprof.port or debugAddr, named ports), and Dockerfiles (pprof/debug/admin ENV, ARG, and entrypoint flags, and EXPOSEd ports that are 6060 or named elsewhere). Manifests are matched to services by container command, image, and name, and workload name; charts by chart name. k8s.profiles.capture and capture_job with repo_root use the first for pods whose spec declares no port.
+
+**Returns**: Per service the binary, service name (be-foo-bar is foo_bar), main package path and import path (from the nearest go.mod), the sources it was found by, build commands with their outputs, suggested local binary locations (existing files first), the Datadog mapping, the pprof endpoint with file:line evidence, and the declared pprof ports.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"repo_root":       prop("string", "Root directory of the repository to scan (default: current directory)"),
+					"env":             prop("string", "Only map to Datadog services seen in envs with this prefix (optional)"),
+					"refresh_datadog": prop("boolean", "Fetch the Datadog services with profiling instead of using the cache (default: false)"),
+					"site":            prop("string", "Datadog site for refresh_datadog (default: from DD_SITE env)"),
+				}),
+				Annotations:  readOnlyRemote(),
+				OutputSchema: repoServicesDiscoverOutputSchema(),
+			},
+			Handler: repoServicesTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "datadog.services.search",
+				Description: `Search for Datadog services with profiling enabled using fuzzy matching.
+
+**When to use**: Use this tool FIRST when the user mentions a service by natural language name.
+Returns a list of matching services ranked by similarity.
+
+The LLM should use this to:
+1. Find the correct service name before calling other profile tools
+2. Suggest corrections when profile tools return "no profiles found"
+
+**Matching types**:
+- exact: Exact or case-insensitive match (score: 1.0-0.95)
+- normalized: Matches after removing -/_ (temporal_worker == temporal-worker) (score: 0.85)
+- prefix: Service name starts with query (score: 0.9)
+- contains: Query found within service name (score: 0.7)
+- similar: Fuzzy match allowing typos (score: 0.6 max)
+
+**Examples**:
+- Query "temporal worker" -> suggests "temporal_worker"
+- Query "rate limit" -> suggests "ratelimit", "be-ratelimit"
+- Query "innkeeper prod" -> suggests service "innkeeper" in env "prod-usw2"`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"query":   prop("string", "Natural language service name (e.g., 'temporal worker', 'rate limiter')"),
+					"env":     prop("string", "Environment filter prefix (optional, e.g., 'prod' matches 'prod-usw2')"),
+					"refresh": prop("boolean", "Force refresh of cached service list (default: false)"),
+					"site":    prop("string", "Datadog site (default: from DD_SITE env)"),
+				}, "query"),
+				Annotations:  readOnlyRemote(),
+				OutputSchema: datadogServicesSearchOutputSchema(),
+			},
+			Handler: datadogServicesSearchTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "datadog.metrics.discover",
+				Description: `Discover available Datadog metrics that match a service filter.
+
+**Use cases**:
+- Find Go runtime metrics (go.memstats, go.goroutines, go.gc) for correlation with profiles
+- Find container/k8s metrics (container.memory, kubernetes.cpu) for RSS investigation
+- Find service-specific metrics for application-level correlation
+
+**Priority order**: Go runtime metrics are shown first, followed by container metrics, then others.
+
+**Example workflow**:
+1. Discover metrics for your service
+2. Use metric names with Datadog dashboards/queries to correlate with profile timestamps`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"service":           prop("string", "The service name to search for related metrics (required)"),
+					"env":               prop("string", "The environment (optional, for context)"),
+					"site":              prop("string", "Datadog site (default: from DD_SITE env or us3.datadoghq.com)"),
+					"query":             prop("string", "Additional metric name pattern to search for"),
+					"max_lines":         integerProp("Maximum number of table lines to return", intPtr(0), nil),
+					"max_bytes":         integerProp("Maximum number of table bytes to return", intPtr(0), nil),
+					"truncate_strategy": enumProp("string", "Truncation strategy (head, tail, head_tail)", []string{"head", "tail", "head_tail"}),
+				}, "service"),
+				Annotations:  readOnlyRemote(),
+				OutputSchema: datadogMetricsDiscoverOutputSchema(),
+			},
+			Handler: datadogMetricsDiscoverTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "datadog.profiles.compare_range",
+				Description: `Compare profiles from two time ranges to identify performance changes.
+
+**When to use**:
+- After a deployment to see what changed
+- To compare "before incident" vs "during incident" profiles
+- To identify performance regressions between releases
+
+**How it works**:
+1. Downloads oldest profile from "before" range (baseline)
+2. Downloads latest profile from "after" range (current state)
+3. Runs pprof diff to show what changed
+4. Returns top function changes with increase/decrease indicators
+
+**Example**: Compare profiles before and after a deploy:
+- before_from="-48h", before_to="-24h" (yesterday's baseline)
+- after_from="-4h", after_to="now" (recent profiles)`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"service":           prop("string", "The service name (required)"),
+					"env":               prop("string", "The environment (required)"),
+					"site":              prop("string", "Datadog site"),
+					"before_from":       prop("string", "Start of 'before' range (RFC3339 or relative like '-48h') (required)"),
+					"before_to":         prop("string", "End of 'before' range (RFC3339 or relative, default: now)"),
+					"after_from":        prop("string", "Start of 'after' range (RFC3339 or relative like '-4h') (required)"),
+					"after_to":          prop("string", "End of 'after' range (RFC3339 or relative, default: now)"),
+					"out_dir":           prop("string", "Directory to store downloaded profiles (default: temp dir)"),
+					"profile_type":      enumProp("string", "Profile type to compare: cpu, heap, goroutines, mutex, block (default: cpu)", []string{"cpu", "heap", "goroutines", "mutex", "block"}),
+					"max_lines":         integerProp("Maximum number of formatted lines to return", intPtr(0), nil),
+					"max_bytes":         integerProp("Maximum number of formatted bytes to return", intPtr(0), nil),
+					"truncate_strategy": enumProp("string", "Truncation strategy (head, tail, head_tail)", []string{"head", "tail", "head_tail"}),
+				}, "service", "env", "before_from", "after_from"),
+				Annotations:  remoteDownload(),
+				OutputSchema: compareRangeOutputSchema(),
+			},
+			Handler: datadogProfilesCompareRangeTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "datadog.profiles.near_event",
+				Description: `Find profiles around a specific event time (restart, OOM, incident, etc.).
+
+**When to use**:
+- Investigating an OOM kill - find the last profile before the kill
+- Analyzing a restart - compare profiles before vs after
+- Debugging an incident - find profiles at a specific timestamp
+
+**Returns**:
+- Profiles BEFORE the event (sorted by timestamp, most recent first)
+- Profiles AFTER the event (sorted by timestamp, oldest first)
+- The closest profile on each side
+- Gap duration (helps identify if service was down)
+
+**Example**: Find profiles around an OOM at 2025-01-15T10:30:00Z:
+- event_time="2025-01-15T10:30:00Z"
+- window="1h" (search 1 hour before and after)`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"service":           prop("string", "The service name (required)"),
+					"env":               prop("string", "The environment (required)"),
+					"site":              prop("string", "Datadog site"),
+					"event_time":        prop("string", "Timestamp of the event (RFC3339 format, required)"),
+					"window":            prop("string", "Time window to search around event (e.g., '30m', '1h', '2h') (default: 1h)"),
+					"limit":             integerProp("Max profiles to return per side (default: 10)", intPtr(0), nil),
+					"max_lines":         integerProp("Maximum number of formatted lines to return", intPtr(0), nil),
+					"max_bytes":         integerProp("Maximum number of formatted bytes to return", intPtr(0), nil),
+					"truncate_strategy": enumProp("string", "Truncation strategy (head, tail, head_tail)", []string{"head", "tail", "head_tail"}),
+				}, "service", "env", "event_time"),
+				Annotations:  readOnlyRemote(),
+				OutputSchema: datadogProfilesNearEventOutputSchema(),
+			},
+			Handler: datadogProfilesNearEventTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.tags",
+				Description: `Filter or group profile data by tags/labels.
+
+**When to use**: Profiles often include labels like tenant_id, connector_id, etc. Use this to:
+- See what tags are available (tag_show parameter)
+- Filter to specific tag values (tag_focus/tag_ignore)
+
+**Example**: Filter CPU profile to a specific tenant: tag_focus="tenant_id:abc123"
+
+**Optional**: Use max_lines or max_bytes to cap the output size.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"profile":           ProfilePath(),
+					"binary":            BinaryPathOptional(),
+					"tag_focus":         prop("string", "Regex to focus on samples with matching tag values (e.g., 'tenant_id:abc')"),
+					"tag_ignore":        prop("string", "Regex to ignore samples with matching tag values"),
+					"tag_show":          prop("string", "Show values for a specific tag key (e.g., 'tenant_id' to list all tenants)"),
+					"cum":               prop("boolean", "Sort by cumulative value instead of flat (default: false)"),
+					"nodecount":         integerProp("Maximum number of nodes to show", intPtr(0), nil),
+					"sample_index":      prop("string", "Sample index to use (e.g., cpu, alloc_space)"),
+					"max_lines":         integerProp("Maximum number of output lines to return", intPtr(0), nil),
+					"max_bytes":         integerProp("Maximum number of output bytes to return", intPtr(0), nil),
+					"truncate_strategy": enumProp("string", "Truncation strategy (head, tail, head_tail)", []string{"head", "tail", "head_tail"}),
+				}, "profile"),
+				Annotations:  readOnlyLocal(),
+				OutputSchema: pprofTagsOutputSchema(),
+			},
+			Handler: pprofTagsTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.flamegraph",
+				Description: `Generate a flamegraph SVG visualization from a profile.
+
+**When to use**: For visual exploration of where time is spent. Flamegraphs show the full call stack with width proportional to time spent.
+
+**Output**: SVG file that can be opened in a browser for interactive exploration. Without graphviz installed, writes a self-contained HTML flame graph instead (output_path with an .html extension) and says so in warnings.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"profile":      ProfilePath(),
+					"output_path":  prop("string", "Path to write the SVG file (required)"),
+					"binary":       BinaryPathOptional(),
+					"focus":        prop("string", "Regex to focus on specific functions"),
+					"ignore":       prop("string", "Regex to ignore specific functions"),
+					"tag_focus":    prop("string", "Regex to focus on samples with matching tag values"),
+					"tag_ignore":   prop("string", "Regex to ignore samples with matching tag values"),
+					"sample_index": prop("string", "Sample index to use (e.g., cpu, alloc_space)"),
+				}, "profile", "output_path"),
+				Annotations:  localWrite(true),
+				OutputSchema: pprofRenderOutputSchema(),
+			},
+			Handler: pprofFlamegraphTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.callgraph",
+				Description: `Generate a call graph visualization showing function relationships.
+
+**When to use**: To visualize how functions call each other and where time flows.
+
+**Formats**:
+- dot: GraphViz DOT format (can be rendered with graphviz)
+- svg: Direct SVG visualization
+- png: PNG image
+
+svg and png need graphviz; without it the graph is written as DOT (output_path with a .dot extension) and warnings say how to render it.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"profile":      ProfilePath(),
+					"output_path":  prop("string", "Path to write the output file (required)"),
+					"binary":       BinaryPathOptional(),
+					"format":       enumProp("string", "Output format: dot, svg, or png (default: dot)", []string{"dot", "svg", "png"}),
+					"focus":        prop("string", "Regex to focus on specific functions"),
+					"ignore":       prop("string", "Regex to ignore specific functions"),
+					"nodecount":    integerProp("Maximum number of nodes to show", intPtr(0), nil),
+					"edge_frac":    numberProp("Hide edges below this fraction (0.0-1.0)", floatPtr(0), floatPtr(1)),
+					"node_frac":    numberProp("Hide nodes below this fraction (0.0-1.0)", floatPtr(0), floatPtr(1)),
+					"sample_index": prop("string", "Sample index to use (e.g., cpu, alloc_space)"),
+				}, "profile", "output_path"),
+				Annotations:  localWrite(true),
+				OutputSchema: pprofRenderOutputSchema(),
+			},
+			Handler: pprofCallgraphTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.focus_paths",
+				Description: `Show all call paths that lead to a specific function.
+
+**When to use**: When you know a function is hot (from pprof.top) and want to understand ALL the different ways it gets called.
+
+**Difference from peek**: peek shows immediate callers/callees; focus_paths shows complete call stacks.
+
+**Optional**: Use max_lines or max_bytes to cap the output size.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"profile":           ProfilePath(),
+					"function":          prop("string", "Target function name or regex to find paths to (required)"),
+					"binary":            BinaryPathOptional(),
+					"cum":               prop("boolean", "Sort by cumulative value instead of flat (default: false)"),
+					"nodecount":         integerProp("Maximum number of paths to show", intPtr(0), nil),
+					"sample_index":      prop("string", "Sample index to use (e.g., cpu, alloc_space)"),
+					"max_lines":         integerProp("Maximum number of output lines to return", intPtr(0), nil),
+					"max_bytes":         integerProp("Maximum number of output bytes to return", intPtr(0), nil),
+					"truncate_strategy": enumProp("string", "Truncation strategy (head, tail, head_tail)", []string{"head", "tail", "head_tail"}),
+				}, "profile", "function"),
+				Annotations:  readOnlyLocal(),
+				OutputSchema: pprofTextOutputSchema(),
+			},
+			Handler: pprofFocusPathsTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.merge",
+				Description: `Merge multiple profiles into a single aggregated profile.
+
+**When to use**:
+- Combine profiles from different instances/pods
+- Aggregate profiles over a longer time period
+- Create a representative profile from multiple samples
+
+**Output**: A new .pprof file that can be analyzed with other pprof.* tools.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"profiles":    arrayOrStringPropMin(prop("string", "Profile path or handle"), "List of profile paths/handles to merge (required, minimum 2)", 2),
+					"output_path": prop("string", "Path to write the merged profile (required)"),
+					"binary":      BinaryPathOptional(),
+				}, "profiles", "output_path"),
+				Annotations:  localWrite(true),
+				OutputSchema: pprofMergeOutputSchema(),
+			},
+			Handler: pprofMergeTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "datadog.function_history",
+				Description: `Search for a function across multiple profiles over time.
+
+**When to use**: To track how a function's CPU usage changes over time. Useful for:
+- Verifying a performance fix reduced CPU usage
+- Finding when a regression was introduced
+- Monitoring function performance over deployments
+
+**Workflow**:
+1. Specify the function pattern (e.g., "getFinishedSync")
+2. Set time range with from/to or hours
+3. Tool downloads profiles and searches each one
+4. Returns a table showing function's CPU% at each timestamp
+
+**Example**: Track "myFunction" over the last 24 hours:
+  function="myFunction", hours=24, limit=10`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"service":           prop("string", "The service name (required)"),
+					"env":               prop("string", "The environment (required)"),
+					"function":          prop("string", "Function name or pattern to search for (required)"),
+					"from":              prop("string", "Start time (RFC3339 or relative like '-24h')"),
+					"to":                prop("string", "End time (RFC3339 or relative)"),
+					"hours":             integerProp("Number of hours to look back (default: 72)", intPtr(0), nil),
+					"limit":             integerProp("Maximum number of profiles to check (default: 10)", intPtr(0), nil),
+					"site":              prop("string", "Datadog site"),
+					"max_lines":         integerProp("Maximum number of table lines to return", intPtr(0), nil),
+					"max_bytes":         integerProp("Maximum number of table bytes to return", intPtr(0), nil),
+					"truncate_strategy": enumProp("string", "Truncation strategy (head, tail, head_tail)", []string{"head", "tail", "head_tail"}),
+				}, "service", "env", "function"),
+				Annotations:  remoteDownload(),
+				OutputSchema: functionHistoryOutputSchema(),
+			},
+			Handler: functionHistoryTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.alloc_paths",
+				Description: `Analyze allocation paths in a heap profile with intelligent filtering.
+
+**When to use**: When pprof.top shows high allocations but you need to understand:
+- Where allocations originate in YOUR code (not runtime)
+- Allocation rates (MB/min) not just totals
+- Grouped by source location for cleaner output
+
+**Key options**:
+- min_percent: Filter out paths below this threshold (default: 1%)
+- max_paths: Limit number of paths returned (default: 20)
+- repo_prefix: Focus on your code (auto-detected if not specified)
+
+**Returns**: Allocation paths sorted by size, with caller chains and rates.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"profile":         ProfilePath(),
+					"min_percent":     numberProp("Minimum allocation percentage to include (default: 1.0)", floatPtr(0), floatPtr(100)),
+					"max_paths":       integerProp("Maximum paths to return (default: 20)", intPtr(1), nil),
+					"repo_prefix":     arrayOrStringPropSchema(prop("string", "Repository prefix"), "Filter to paths containing these prefixes (auto-detected if not specified)"),
+					"group_by_source": prop("boolean", "Group by first app frame instead of allocation site (default: false)"),
+				}, "profile"),
+				Annotations:  readOnlyLocal(),
+				OutputSchema: pprofAllocPathsOutputSchema(),
+			},
+			Handler: pprofAllocPathsTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.overhead_report",
+				Description: `Detect observability and infrastructure overhead in a profile.
+
+**When to use**: To understand how much of your CPU/memory is spent on:
+- OpenTelemetry tracing
+- Logging (zap, logrus)
+- Prometheus metrics
+- gRPC/protobuf overhead
+- JSON serialization
+- Runtime/GC
+
+**Returns**:
+- Breakdown by category with percentages
+- Top functions per category
+- Severity ratings (low/medium/high)
+- Actionable suggestions for high-overhead categories
+
+**Example insight**: "OpenTelemetry Tracing: 13% - Consider reducing trace sampling rate"`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"profile":      ProfilePath(),
+					"sample_index": prop("string", "Sample index to analyze (auto-detected based on profile type)"),
+				}, "profile"),
+				Annotations:  readOnlyLocal(),
+				OutputSchema: pprofOverheadReportOutputSchema(),
+			},
+			Handler: pprofOverheadReportTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.generate_report",
+				Description: `Generate a markdown report from one or more analysis results.
+
+**When to use**: After running pprof.discover or individual tools, to create a formatted report with tables and recommendations.
+
+**Input format**: Provide each tool's structured output as the "data" field. You can pass either the tool's full JSON output or just its "result" object.
+
+**Per-team reports**: group_by=team gives each owning team a section with only its hotspots and the recommendations attached to them, also returned separately under "teams" for pasting into each team's channel. A hotspot's team is the config file's teams entry covering its package, else the owners the input already carries (hotspot_summary, storylines), else CODEOWNERS under repo_root; the rest land in an Unowned section.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"title": prop("string", "Optional report title"),
+					"inputs": arrayPropSchema(NewObjectSchema(map[string]any{
+						"kind":  prop("string", "Input kind (discover, top, alloc_paths, memory_sanity, overhead_report, goroutine_analysis, diff_top, hotspot_summary, storylines, trace_source)"),
+						"title": prop("string", "Section heading for diff_top, hotspot_summary, storylines, and trace_source inputs"),
+						"data": map[string]any{
+							"type":                 "object",
+							"description":          "Structured tool output for the given kind",
+							"additionalProperties": true,
+						},
+					}, "kind", "data"), "Analysis inputs (required)"),
+					"group_by":          enumProp("string", "Group findings into one section per owning team", []string{"none", "team"}),
+					"repo_root":         prop("string", "Repository root whose CODEOWNERS assigns teams when grouping by team"),
+					"max_lines":         integerProp("Maximum number of markdown lines to return", intPtr(0), nil),
+					"max_bytes":         integerProp("Maximum number of markdown bytes to return", intPtr(0), nil),
+					"truncate_strategy": enumProp("string", "Truncation strategy (head, tail, head_tail)", []string{"head", "tail", "head_tail"}),
+				}, "inputs"),
+				Annotations:  readOnlyLocal(),
+				OutputSchema: pprofGenerateReportOutputSchema(),
+			},
+			Handler: pprofGenerateReportTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.resolve_binary",
+				Description: `Find the binary a profile was recorded from, for symbolization and for pprof.list/peek source and assembly.
+
+**Target**: The profile's main mapping (binary path and build ID), plus revision (the deployed commit) and service when known. Go binaries usually carry no GNU build ID, so revision is what verifies them through their embedded vcs.revision.
+
+**Strategies**, in order (default: cache, repo, artifact, image; build is opt-in):
+- cache: binaries resolved before, kept by build ID and revision
+- repo: binaries already built in repo_root, where repo.services.discover expects them
+- artifact: download artifact_url, a template over {service}, {binary}, {revision}, {build_id} (http, https, or file)
+- image: docker create the image template and copy the mapping's path out
+- build: go build the service's main package at revision in a temporary git worktree
+
+A binary whose build ID or revision differs is rejected. Fetched and built binaries are cached. Defaults come from the config file's binaries section. pprof.peek and pprof.list use the same resolution automatically for unsymbolized profiles.
+
+**Returns**: The binary path, the strategy that found it, whether it was verified, its IDs, and every attempt. dry_run lists the commands without running them.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"profile":      ProfilePath(),
+					"repo_root":    prop("string", "Repository root for the repo and build strategies"),
+					"revision":     prop("string", "VCS revision the profiled binary was built at (full or short)"),
+					"service":      prop("string", "Service name, for templates and matching repo services"),
+					"binary_name":  prop("string", "Binary name (default: base name of the profile's main mapping)"),
+					"build_id":     prop("string", "Build ID to match (default: the main mapping's)"),
+					"strategies":   arrayOrStringPropSchema(enumProp("string", "Strategy", []string{"cache", "repo", "artifact", "image", "build"}), "Strategies to try, in order (default: config binaries.strategies, else cache, repo, artifact, image)"),
+					"artifact_url": prop("string", "Artifact URL template (default: config binaries.artifact_url)"),
+					"image":        prop("string", "Container image template (default: config binaries.image)"),
+					"dry_run":      dryRunProp(),
+				}, "profile"),
+				Annotations:  remoteDownload(),
+				OutputSchema: pprofResolveBinaryOutputSchema(),
+			},
+			Handler: pprofResolveBinaryTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.buildinfo",
+				Description: `Read the Go build info of a binary or of the binary a profile was recorded from: Go version, main module, VCS revision and time, build settings (-tags, -ldflags, CGO_ENABLED, GOARCH, ...), dependencies, and build IDs.
+
+**Binary**: binary directly, else the profile's main mapping at its recorded path when it exists and matches, else as pprof.resolve_binary finds it (config binaries settings, or strategies).
+
+**HEAD check**: With repo_root, the checkout is compared with the revision the binary was built at (or revision, when the binary records none): HEAD, dirty state, commits ahead and behind, and the changed Go files. With a profile, changed files the profile has functions in are listed as profiled_files and warned about: list, peek, and trace_source would match their lines against the wrong commit.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"binary":     prop("string", "Binary to read (default: the profile's binary)"),
+					"profile":    ProfilePath(),
+					"repo_root":  prop("string", "Repository whose HEAD is checked against the build's revision"),
+					"revision":   prop("string", "Revision the binary was built at, when it records none; else checked against the one it records"),
+					"service":    prop("string", "Service name, for resolving the profile's binary"),
+					"strategies": arrayOrStringPropSchema(enumProp("string", "Strategy", []string{"cache", "repo", "artifact", "image", "build"}), "Strategies for resolving the profile's binary (default: config binaries.strategies, else cache, repo, artifact, image)"),
+				}),
+				Annotations:  remoteDownload(),
+				OutputSchema: pprofBuildInfoOutputSchema(),
+			},
+			Handler: pprofBuildInfoTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.detect_repo",
+				Description: `Auto-detect repository information from a profile.
+
+**When to use**: To find the local repo root for source annotation without manual configuration.
+
+**How it works**:
+1. Extracts Go module paths from function names in the profile
+2. Searches common locations for matching local repos
+3. Validates by checking for go.mod or project structure
+
+**Returns**: Detected module paths, local repo root (if found), and confidence level.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"profile": ProfilePath(),
+				}, "profile"),
+				Annotations:  readOnlyLocal(),
+				OutputSchema: pprofDetectRepoOutputSchema(),
+			},
+			Handler: pprofDetectRepoTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.temporal_analysis",
+				Description: `Analyze Temporal SDK worker configuration from goroutine profiles.
+
+**When to use**: To understand Temporal worker settings and activity/workflow execution state.
+
+**Infers**:
+- MaxConcurrentActivityTaskPollers (from active activity pollers)
+- MaxConcurrentWorkflowTaskPollers (from active workflow pollers)
+- Active activities and cached workflows
+- Local activity and session counts
+- Heartbeat goroutines
+
+**Workflow breakdown**: Groups workflows by type and state (selector, awaiting_future, executing).
+
+**Activity breakdown**: Groups activities by type.
+
+**Returns**: Inferred settings, raw counts, workflow/activity breakdowns.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"profile": ProfilePath(),
+				}, "profile"),
+				Annotations:  readOnlyLocal(),
+				OutputSchema: pprofTemporalAnalysisOutputSchema(),
+			},
+			Handler: pprofTemporalAnalysisTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "pprof.goroutine_categorize",
+				Description: `Categorize goroutines by configurable patterns or presets.
+
+**When to use**: To understand goroutine distribution by framework/subsystem.
+
+**Presets available**:
+- temporal: Temporal SDK pollers, executors, dispatchers
+- grpc: gRPC server handlers, client streams, http2
+- http: HTTP server/client connections
+- database: SQL, Postgres, MongoDB, Redis connections
+- runtime: GC, sysmon, netpoll, timers
+- sync: Mutexes, channels, selects
+- observability: Datadog, OpenTelemetry, Prometheus
+
+**Custom categories**: Provide regex patterns to match goroutine stacks.
+
+**Returns**: Counts per category with percentages, uncategorized stacks.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"profile": ProfilePath(),
+					"presets": arrayProp("string", "Preset category groups to include (temporal, grpc, http, database, runtime, sync, observability). If empty, uses all presets."),
+					"categories": map[string]any{
+						"type":                 "object",
+						"description":          "Custom categories as name -> regex pattern",
+						"additionalProperties": prop("string", "Regex pattern to match goroutine stacks"),
+					},
+				}, "profile"),
+				Annotations:  readOnlyLocal(),
+				OutputSchema: pprofGoroutineCategorizeOutputSchema(),
+			},
+			Handler: pprofGoroutineCategorizeTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "datadog.metrics_at_timestamp",
+				Description: `Query Datadog metrics around a specific timestamp.
+
+**When to use**: Correlate profile data with operational metrics at the same time.
+
+**Default metrics** (for Go services):
+- go.goroutines, go.memstats.heap_*, go.gc.*
+- container.memory.rss, container.cpu.usage
+- kubernetes.memory.rss, kubernetes.cpu.usage
+
+**Parameters**:
+- timestamp: RFC3339 format or Unix timestamp
+- window: Duration around timestamp (default: 5m)
+- metrics: Specific metrics to query (optional)
+- pod_name: Filter to specific pod (optional)
+
+**Returns**: Metric time series with min/max/avg/last values, summary of key Go metrics.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"service":   prop("string", "The service name (required)"),
+					"env":       prop("string", "The environment (e.g., prod, staging)"),
+					"timestamp": prop("string", "Timestamp to query around (RFC3339 or Unix)"),
+					"window":    prop("string", "Time window around timestamp (e.g., '5m', '15m') (default: 5m)"),
+					"metrics":   arrayProp("string", "Specific metrics to query (optional, defaults to Go runtime metrics)"),
+					"pod_name":  prop("string", "Filter to specific pod (optional)"),
+					"site":      prop("string", "Datadog site (default: from DD_SITE env)"),
+					"dd_site":   prop("string", "Datadog site (alias for site)"),
+				}, "service"),
+				Annotations:  readOnlyRemote(),
+				OutputSchema: datadogMetricsAtTimestampOutputSchema(),
+			},
+			Handler: datadogMetricsAtTimestampTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "server.info",
+				Description: `Report what this server can actually do.
+
+**When to use**: At the start of a session, before planning, to learn which data sources and external tools are usable.
+
+**Returns**: Server version, enabled data sources (datadog, d2, kubernetes access mode, pyroscope), availability and versions of external dependencies (go tool pprof, graphviz, kubectl, tilt, docker, skaffold, git), the detected pprof (version and any flags it lacks, which are dropped or replaced), configured paths (config file, workspace, allowed roots), and a policy summary.`,
+				InputSchema:  NewObjectSchema(map[string]any{}),
+				Annotations:  readOnlyLocal(),
+				OutputSchema: serverInfoOutputSchema(),
+			},
+			Handler: serverInfoTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "server.temp_files",
+				Description: `List the temp files and directories the server and profctl created for downloads, extraction, and merges, and which of them leaked.
+
+**When to use**: When the temp directory fills up, or after a crash or an interrupted call.
+
+**Returns**: Each registered temp with its owning process, age, and size, and whether it leaked (its process exited, or it is older than a day); the leaked total; and unregistered leftovers in the temp directory (from before the registry, or outputs already returned, such as compare and aggregate downloads). The server removes leaked temps at startup and every 10 minutes; ` + "`profctl clean --older_than <age>`" + ` also removes the leftovers.`,
+				InputSchema:  NewObjectSchema(map[string]any{}),
+				Annotations:  readOnlyLocal(),
+				OutputSchema: serverTempFilesOutputSchema(),
+			},
+			Handler: serverTempFilesTool,
+		},
+		{
+			Tool: &mcp.Tool{
+				Name: "server.self_profile",
+				Description: `Profile this pprof-mcp server process and analyze the result with its own pprof tooling.
+
+**When to use**: When the server itself is slow or large, such as during big merges, aggregates, or many concurrent calls.
+
+**Returns**: The captured profile's path and handle (usable with every pprof.* tool), the top functions, hints, and runtime stats (goroutines, heap, GC). cpu, mutex, and block record for ` + "`seconds`" + ` (mutex and block sampling is enabled only for that window); heap, allocs, and goroutine are snapshots. In HTTP mode with PPROF_MCP_HTTP_PPROF=on the same profiles are served at ` + "`/debug/pprof/`" + `.`,
+				InputSchema: NewObjectSchema(map[string]any{
+					"type":         enumProp("string", "Profile to capture (default: cpu)", selfProfileTypes),
+					"seconds":      integerProp("Recording window in seconds for cpu, mutex, and block (default: 10)", intPtr(1), intPtr(maxSelfProfileSeconds)),
+					"out_dir":      prop("string", "Directory for the profile (default: the workspace, else the temp directory)"),
+					"nodecount":    prop("integer", "Top rows to return (default: 20)"),
+					"sample_index": prop("string", "Sample index for the analysis (e.g. alloc_space for heap)"),
+				}),
+				Annotations:  localWrite(false),
+				OutputSchema: serverSelfProfileOutputSchema(),
+			},
+			Handler: serverSelfProfileTool,
+		},
+	}
+	return addCommonArgs(tools)
+}
@@ -1,6 +1,6 @@
 //go:build integration
 
-package main
+package mcpserver
 
 import (
 	"context"
@@ -25,21 +25,21 @@ func TestIntegrationAllTools(t *testing.T) {
 	service := envOrDefault("PPROF_MCP_TEST_SERVICE", "temporal_sync")
 	env := envOrDefault("PPROF_MCP_TEST_ENV", "sandbox-usw2")
 
-	_ = runTool(t, ctx, "datadog.profiles.list", map[string]any{
+	_ = runIntegrationTool(t, ctx, "datadog.profiles.list", map[string]any{
 		"service": service,
 		"env":     env,
 		"hours":   24,
 		"limit":   10,
 	})
 
-	latestPick := runTool(t, ctx, "datadog.profiles.pick", map[string]any{
+	latestPick := runIntegrationTool(t, ctx, "datadog.profiles.pick", map[string]any{
 		"service":  service,
 		"env":      env,
 		"hours":    24,
 		"limit":    10,
 		"strategy": "latest",
 	})
-	oldestPick := runTool(t, ctx, "datadog.profiles.pick", map[string]any{
+	oldestPick := runIntegrationTool(t, ctx, "datadog.profiles.pick", map[string]any{
 		"service":  service,
 		"env":      env,
 		"hours":    24,
@@ -53,14 +53,14 @@ func TestIntegrationAllTools(t *testing.T) {
 	latestDir := filepath.Join(t.TempDir(), "latest")
 	oldestDir := filepath.Join(t.TempDir(), "oldest")
 
-	latestDownload := runTool(t, ctx, "profiles.download_latest_bundle", map[string]any{
+	latestDownload := runIntegrationTool(t, ctx, "profiles.download_latest_bundle", map[string]any{
 		"service":    service,
 		"env":        env,
 		"out_dir":    latestDir,
 		"profile_id": latestProfileID,
 		"event_id":   latestEventID,
 	})
-	oldestDownload := runTool(t, ctx, "profiles.download_latest_bundle", map[string]any{
+	oldestDownload := runIntegrationTool(t, ctx, "profiles.download_latest_bundle", map[string]any{
 		"service":    service,
 		"env":        env,
 		"out_dir":    oldestDir,
@@ -77,36 +77,36 @@ func TestIntegrationAllTools(t *testing.T) {
 	goroutineHandle := requireHandle(t, latestHandles, "goroutines")
 	blockHandle := latestHandles["block"]
 
-	topPayload := runTool(t, ctx, "pprof.top", map[string]any{
+	topPayload := runIntegrationTool(t, ctx, "pprof.top", map[string]any{
 		"profile":   cpuHandle,
 		"nodecount": 5,
 	})
 	topFunction := extractTopFunction(t, topPayload)
 	functionRegex := regexp.QuoteMeta(topFunction)
 
-	_ = runTool(t, ctx, "pprof.meta", map[string]any{
+	_ = runIntegrationTool(t, ctx, "pprof.meta", map[string]any{
 		"profile": cpuHandle,
 	})
-	_ = runTool(t, ctx, "pprof.peek", map[string]any{
+	_ = runIntegrationTool(t, ctx, "pprof.peek", map[string]any{
 		"profile":   cpuHandle,
 		"regex":     functionRegex,
 		"max_lines": 120,
 	})
-	_ = runTool(t, ctx, "pprof.list", map[string]any{
+	_ = runIntegrationTool(t, ctx, "pprof.list", map[string]any{
 		"profile":   cpuHandle,
 		"function":  topFunction,
 		"max_lines": 120,
 	})
-	_ = runTool(t, ctx, "pprof.traces_head", map[string]any{
+	_ = runIntegrationTool(t, ctx, "pprof.traces", map[string]any{
 		"profile":   goroutineHandle,
 		"max_lines": 120,
 	})
-	_ = runTool(t, ctx, "pprof.diff_top", map[string]any{
+	_ = runIntegrationTool(t, ctx, "pprof.diff_top", map[string]any{
 		"before":    requireHandle(t, oldestHandles, "cpu"),
 		"after":     cpuHandle,
 		"nodecount": 5,
 	})
-	_ = runTool(t, ctx, "pprof.regression_check", map[string]any{
+	_ = runIntegrationTool(t, ctx, "pprof.regression_check", map[string]any{
 		"profile":      cpuHandle,
 		"sample_index": "cpu",
 		"checks": []any{
@@ -117,54 +117,54 @@ func TestIntegrationAllTools(t *testing.T) {
 			},
 		},
 	})
-	_ = runTool(t, ctx, "pprof.storylines", map[string]any{
+	_ = runIntegrationTool(t, ctx, "pprof.storylines", map[string]any{
 		"profile": cpuHandle,
 		"n":       2,
 	})
-	_ = runTool(t, ctx, "pprof.memory_sanity", map[string]any{
+	_ = runIntegrationTool(t, ctx, "pprof.memory_sanity", map[string]any{
 		"heap_profile":      heapHandle,
 		"goroutine_profile": goroutineHandle,
 	})
-	_ = runTool(t, ctx, "pprof.goroutine_analysis", map[string]any{
+	_ = runIntegrationTool(t, ctx, "pprof.goroutine_analysis", map[string]any{
 		"profile": goroutineHandle,
 	})
-	_ = runTool(t, ctx, "pprof.contention_analysis", map[string]any{
+	_ = runIntegrationTool(t, ctx, "pprof.contention_analysis", map[string]any{
 		"profile": mutexHandle,
 	})
-	_ = runTool(t, ctx, "pprof.discover", map[string]any{
+	_ = runIntegrationTool(t, ctx, "pprof.discover", map[string]any{
 		"service": service,
 		"env":     env,
 		"hours":   24,
 	})
-	_ = runTool(t, ctx, "pprof.cross_correlate", map[string]any{
+	_ = runIntegrationTool(t, ctx, "pprof.cross_correlate", map[string]any{
 		"bundle":    cpuHandle,
 		"nodecount": 5,
 	})
-	_ = runTool(t, ctx, "pprof.hotspot_summary", map[string]any{
+	_ = runIntegrationTool(t, ctx, "pprof.hotspot_summary", map[string]any{
 		"bundle":    cpuHandle,
 		"nodecount": 3,
 	})
-	_ = runTool(t, ctx, "pprof.trace_source", map[string]any{
+	_ = runIntegrationTool(t, ctx, "pprof.trace_source", map[string]any{
 		"profile":   cpuHandle,
 		"function":  topFunction,
 		"repo_root": repoRoot(t),
 		"max_depth": 5,
 	})
-	_ = runTool(t, ctx, "pprof.vendor_analyze", map[string]any{
+	_ = runIntegrationTool(t, ctx, "pprof.vendor_analyze", map[string]any{
 		"profile":   cpuHandle,
 		"repo_root": repoRoot(t),
 		"min_pct":   1.0,
 	})
-	_ = runTool(t, ctx, "pprof.explain_overhead", map[string]any{
+	_ = runIntegrationTool(t, ctx, "pprof.explain_overhead", map[string]any{
 		"profile":  cpuHandle,
 		"category": "Runtime/GC",
 	})
-	_ = runTool(t, ctx, "pprof.suggest_fix", map[string]any{
+	_ = runIntegrationTool(t, ctx, "pprof.suggest_fix", map[string]any{
 		"profile":   cpuHandle,
 		"issue":     "protojson_overhead",
 		"repo_root": repoRoot(t),
 	})
-	_ = runTool(t, ctx, "datadog.profiles.aggregate", map[string]any{
+	_ = runIntegrationTool(t, ctx, "datadog.profiles.aggregate", map[string]any{
 		"service":      service,
 		"env":          env,
 		"window":       "1h",
@@ -172,14 +172,14 @@ func TestIntegrationAllTools(t *testing.T) {
 		"profile_type": "cpu",
 		"out_dir":      filepath.Join(t.TempDir(), "aggregate"),
 	})
-	_ = runTool(t, ctx, "repo.services.discover", map[string]any{
+	_ = runIntegrationTool(t, ctx, "repo.services.discover", map[string]any{
 		"repo_root": repoRoot(t),
 	})
-	_ = runTool(t, ctx, "datadog.metrics.discover", map[string]any{
+	_ = runIntegrationTool(t, ctx, "datadog.metrics.discover", map[string]any{
 		"service": service,
 		"env":     env,
 	})
-	_ = runTool(t, ctx, "datadog.profiles.compare_range", map[string]any{
+	_ = runIntegrationTool(t, ctx, "datadog.profiles.compare_range", map[string]any{
 		"service":     service,
 		"env":         env,
 		"before_from": "-48h",
@@ -187,62 +187,62 @@ func TestIntegrationAllTools(t *testing.T) {
 		"after_from":  "-4h",
 		"after_to":    "now",
 	})
-	_ = runTool(t, ctx, "datadog.profiles.near_event", map[string]any{
+	_ = runIntegrationTool(t, ctx, "datadog.profiles.near_event", map[string]any{
 		"service":    service,
 		"env":        env,
 		"event_time": time.Now().Add(-6 * time.Hour).Format(time.RFC3339),
 		"window":     "1h",
 		"limit":      5,
 	})
-	_ = runTool(t, ctx, "pprof.tags", map[string]any{
+	_ = runIntegrationTool(t, ctx, "pprof.tags", map[string]any{
 		"profile":   cpuHandle,
 		"max_lines": 100,
 	})
 
 	flamegraphPath := filepath.Join(t.TempDir(), "flamegraph.svg")
-	_ = runTool(t, ctx, "pprof.flamegraph", map[string]any{
+	_ = runIntegrationTool(t, ctx, "pprof.flamegraph", map[string]any{
 		"profile":     cpuHandle,
 		"output_path": flamegraphPath,
 	})
 	assertFileExists(t, flamegraphPath)
 
 	callgraphPath := filepath.Join(t.TempDir(), "callgraph.dot")
-	_ = runTool(t, ctx, "pprof.callgraph", map[string]any{
+	_ = runIntegrationTool(t, ctx, "pprof.callgraph", map[string]any{
 		"profile":     cpuHandle,
 		"output_path": callgraphPath,
 		"format":      "dot",
 	})
 	assertFileExists(t, callgraphPath)
 
-	_ = runTool(t, ctx, "pprof.focus_paths", map[string]any{
+	_ = runIntegrationTool(t, ctx, "pprof.focus_paths", map[string]any{
 		"profile":   cpuHandle,
 		"function":  topFunction,
 		"max_lines": 120,
 	})
 
 	mergePath := filepath.Join(t.TempDir(), "merged_cpu.pprof")
-	_ = runTool(t, ctx, "pprof.merge", map[string]any{
+	_ = runIntegrationTool(t, ctx, "pprof.merge", map[string]any{
 		"profiles":    []string{requireHandle(t, oldestHandles, "cpu"), cpuHandle},
 		"output_path": mergePath,
 	})
 	assertFileExists(t, mergePath)
 
-	_ = runTool(t, ctx, "datadog.function_history", map[string]any{
+	_ = runIntegrationTool(t, ctx, "datadog.function_history", map[string]any{
 		"service":  service,
 		"env":      env,
 		"function": topFunction,
 		"hours":    6,
 		"limit":    3,
 	})
-	_ = runTool(t, ctx, "pprof.alloc_paths", map[string]any{
+	_ = runIntegrationTool(t, ctx, "pprof.alloc_paths", map[string]any{
 		"profile":     heapHandle,
 		"min_percent": 1.0,
 		"max_paths":   5,
 	})
-	overheadPayload := runTool(t, ctx, "pprof.overhead_report", map[string]any{
+	overheadPayload := runIntegrationTool(t, ctx, "pprof.overhead_report", map[string]any{
 		"profile": cpuHandle,
 	})
-	_ = runTool(t, ctx, "pprof.generate_report", map[string]any{
+	_ = runIntegrationTool(t, ctx, "pprof.generate_report", map[string]any{
 		"inputs": []any{
 			map[string]any{
 				"kind": "overhead_report",
@@ -250,18 +250,18 @@ func TestIntegrationAllTools(t *testing.T) {
 			},
 		},
 	})
-	_ = runTool(t, ctx, "pprof.detect_repo", map[string]any{
+	_ = runIntegrationTool(t, ctx, "pprof.detect_repo", map[string]any{
 		"profile": cpuHandle,
 	})
 
 	if blockHandle != "" {
-		_ = runTool(t, ctx, "pprof.contention_analysis", map[string]any{
+		_ = runIntegrationTool(t, ctx, "pprof.contention_analysis", map[string]any{
 			"profile": blockHandle,
 		})
 	}
 }
 
-func runTool(t *testing.T, ctx context.Context, name string, args map[string]any) map[string]any {
+func runIntegrationTool(t *testing.T, ctx context.Context, name string, args map[string]any) map[string]any {
 	t.Helper()
 	def := findTool(t, name)
 	res, structured, err := invokeTool(ctx, def.Tool, def.Tool.Name, def.Handler, args)
@@ -1,12 +1,16 @@
-package main
+package mcpserver
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"testing"
 
+	"github.com/google/pprof/profile"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 
 	"github.com/arreyder/pprof-mcp/internal/pprof"
@@ -79,7 +83,7 @@ func TestValidateArgsMissingRequired(t *testing.T) {
 }
 
 func TestValidateArgsTypeMismatch(t *testing.T) {
-	def := findTool(t, "pprof.traces_head")
+	def := findTool(t, "pprof.traces")
 	args := map[string]any{
 		"profile": "profile.pprof",
 		"lines":   "nope",
@@ -303,7 +307,7 @@ func TestValidateArgsIntegerMinimum(t *testing.T) {
 }
 
 func TestValidateArgsIntegerMaximum(t *testing.T) {
-	def := findTool(t, "pprof.traces_head")
+	def := findTool(t, "pprof.traces")
 	args := map[string]any{
 		"profile": "profile.pprof",
 		"lines":   maxTracesLines + 1,
@@ -380,6 +384,56 @@ func TestNoMatchesResult(t *testing.T) {
 	}
 }
 
+func TestResolveSampleIndexArg(t *testing.T) {
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "alloc_objects", Unit: "count"},
+			{Type: "alloc_space", Unit: "bytes"},
+			{Type: "inuse_objects", Unit: "count"},
+			{Type: "inuse_space", Unit: "bytes"},
+		},
+		Sample: []*profile.Sample{{Value: []int64{1, 2, 3, 4}}},
+	}
+	path := filepath.Join(t.TempDir(), "heap.pprof")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create profile: %v", err)
+	}
+	if err := prof.Write(file); err != nil {
+		t.Fatalf("write profile: %v", err)
+	}
+	file.Close()
+
+	top := findTool(t, "pprof.top").Tool
+	args := map[string]any{"profile": path}
+	choice, err := resolveSampleIndexArg(top, "pprof.top", args)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if args["sample_index"] != "inuse_space" || choice == nil || choice.Source != "kind_default" {
+		t.Fatalf("expected inuse_space kind default, got %v (%+v)", args["sample_index"], choice)
+	}
+
+	// Tools with their own default keep it; the argument stays unset.
+	args = map[string]any{"profile": path}
+	if _, err := resolveSampleIndexArg(findTool(t, "pprof.storylines").Tool, "pprof.storylines", args); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := args["sample_index"]; ok {
+		t.Fatalf("storylines sample_index should stay unset, got %v", args["sample_index"])
+	}
+
+	args = map[string]any{"profile": path, "sample_index": "delay"}
+	_, err = resolveSampleIndexArg(top, "pprof.top", args)
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	if verr.Expected != "one of alloc_objects, alloc_space, inuse_objects, inuse_space" {
+		t.Fatalf("unexpected options: %s", verr.Expected)
+	}
+}
+
 func findTool(t *testing.T, name string) ToolDefinition {
 	t.Helper()
 	for _, def := range ToolSchemas() {
@@ -390,3 +444,119 @@ func findTool(t *testing.T, name string) ToolDefinition {
 	t.Fatalf("tool %q not found", name)
 	return ToolDefinition{}
 }
+
+func TestToolsAdvertiseOutputSchemas(t *testing.T) {
+	for _, def := range ToolSchemas() {
+		schemaMap, ok := def.Tool.OutputSchema.(map[string]any)
+		if !ok {
+			t.Fatalf("tool %q missing output schema", def.Tool.Name)
+		}
+		if schemaMap["type"] != "object" {
+			t.Fatalf("tool %q output schema type not object", def.Tool.Name)
+		}
+	}
+
+	session := connectTestSession(t)
+	listed, err := session.ListTools(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("list tools: %v", err)
+	}
+	if want := len(ToolSchemas()) + len(toolAliases); len(listed.Tools) != want {
+		t.Fatalf("expected %d tools, got %d", want, len(listed.Tools))
+	}
+	for _, tool := range listed.Tools {
+		if tool.OutputSchema == nil {
+			t.Fatalf("tool %q listed without outputSchema", tool.Name)
+		}
+	}
+}
+
+func TestToolAnnotations(t *testing.T) {
+	for _, def := range ToolSchemas() {
+		if def.Tool.Annotations == nil {
+			t.Fatalf("tool %q missing annotations", def.Tool.Name)
+		}
+	}
+
+	for _, name := range []string{"pprof.peek", "pprof.meta", "pprof.storylines"} {
+		if !findTool(t, name).Tool.Annotations.ReadOnlyHint {
+			t.Fatalf("tool %q should be read-only", name)
+		}
+	}
+	for _, name := range []string{"pprof.branch_impact", "pprof.branch_impact.execute"} {
+		annotations := findTool(t, name).Tool.Annotations
+		if annotations.ReadOnlyHint || annotations.DestructiveHint == nil || !*annotations.DestructiveHint {
+			t.Fatalf("tool %q should be destructive", name)
+		}
+	}
+	download := findTool(t, "profiles.download_latest_bundle").Tool.Annotations
+	if download.ReadOnlyHint || download.OpenWorldHint == nil || !*download.OpenWorldHint {
+		t.Fatalf("download tool should be open-world and not read-only")
+	}
+	for _, name := range []string{"pprof.list", "pprof.trace_source"} {
+		if hint := findTool(t, name).Tool.Annotations.OpenWorldHint; hint == nil || !*hint {
+			t.Fatalf("tool %q can download modules and should be open-world", name)
+		}
+	}
+}
+
+func TestToolCallReturnsStructuredContent(t *testing.T) {
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}},
+		Sample:     []*profile.Sample{{Value: []int64{3}}},
+		Period:     1,
+	}
+	path := filepath.Join(t.TempDir(), "cpu.pprof")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create profile: %v", err)
+	}
+	if err := prof.Write(file); err != nil {
+		t.Fatalf("write profile: %v", err)
+	}
+	file.Close()
+
+	session := connectTestSession(t)
+	res, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "pprof.meta",
+		Arguments: map[string]any{"profile": path},
+	})
+	if err != nil {
+		t.Fatalf("call tool: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("unexpected tool error: %+v", res.Content)
+	}
+	structured, ok := res.StructuredContent.(map[string]any)
+	if !ok {
+		t.Fatalf("expected structured content object, got %T", res.StructuredContent)
+	}
+	result, ok := structured["result"].(map[string]any)
+	if !ok || result["detected_profile_kind"] != "cpu" {
+		t.Fatalf("unexpected structured result: %v", structured)
+	}
+}
+
+func connectTestSession(t *testing.T) *mcp.ClientSession {
+	t.Helper()
+	ctx := context.Background()
+	server, err := newServer(toolNameModeDefault)
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	clientTransport, serverTransport := mcp.NewInMemoryTransports()
+	serverSession, err := server.Connect(ctx, serverTransport, nil)
+	if err != nil {
+		t.Fatalf("server connect: %v", err)
+	}
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "test"}, nil)
+	session, err := client.Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("client connect: %v", err)
+	}
+	t.Cleanup(func() {
+		session.Close()
+		serverSession.Close()
+	})
+	return session
+}
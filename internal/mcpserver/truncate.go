@@ -0,0 +1,29 @@
+package mcpserver
+
+import (
+	"strings"
+
+	"github.com/arreyder/pprof-mcp/internal/textutil"
+)
+
+// textLimits reads a call's max_lines, max_bytes, and truncate_strategy
+// arguments, which apply alike to every raw, stderr, and markdown field the
+// tool returns.
+func textLimits(args map[string]any) textutil.TruncateOptions {
+	return textutil.TruncateOptions{
+		MaxLines: getInt(args, "max_lines", 0),
+		MaxBytes: getInt(args, "max_bytes", 0),
+		Strategy: textutil.ParseStrategy(getString(args, "truncate_strategy")),
+	}
+}
+
+func applyTextLimits(raw string, baseMeta *textutil.TruncateMeta, limits textutil.TruncateOptions) (string, textutil.TruncateMeta) {
+	return textutil.ApplyLimits(raw, baseMeta, limits)
+}
+
+func addStderr(payload map[string]any, stderr string, meta textutil.TruncateMeta, limits textutil.TruncateOptions) {
+	if strings.TrimSpace(stderr) == "" && !meta.Truncated {
+		return
+	}
+	payload["stderr"], payload["stderr_meta"] = applyTextLimits(stderr, &meta, limits)
+}
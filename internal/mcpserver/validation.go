@@ -1,4 +1,4 @@
-package main
+package mcpserver
 
 import (
 	"encoding/json"
@@ -63,7 +63,7 @@ func validateObject(value map[string]any, schema map[string]any, path string) er
 	}
 
 	if additionalPropertiesDisallowed(schema) {
-		for key := range value {
+		for _, key := range sortedKeys(value) {
 			if _, ok := props[key]; !ok {
 				field := joinPath(path, key)
 				return &ValidationError{
@@ -77,7 +77,8 @@ func validateObject(value map[string]any, schema map[string]any, path string) er
 		}
 	}
 
-	for key, val := range value {
+	for _, key := range sortedKeys(value) {
+		val := value[key]
 		propSchemaRaw, ok := props[key]
 		if !ok {
 			continue
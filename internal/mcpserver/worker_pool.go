@@ -0,0 +1,225 @@
+package mcpserver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// heavyTools spawn pprof subprocesses, parse large profiles, or download from
+// Datadog/Kubernetes. They share a bounded worker pool so an eager agent can't
+// fork dozens of `go tool pprof` processes at once. Everything else runs inline.
+var heavyTools = map[string]bool{
+	"profiles.download":               true,
+	"profiles.download_latest_bundle": true,
+	"d2.profiles.download":            true,
+	"k8s.profiles.capture":            true,
+	"k8s.profiles.capture_job":        true,
+	"k8s.profiles.compare_clusters":   true,
+	"k8s.profiles.compare_canary":     true,
+	"k8s.profiles.debug_capture":      true,
+	"pprof.branch_impact":             true,
+	"pprof.branch_impact.execute":     true,
+	"pprof.resolve_binary":            true,
+	"pprof.top":                       true,
+	"pprof.peek":                      true,
+	"pprof.list":                      true,
+	"pprof.traces":                    true,
+	"pprof.diff_top":                  true,
+	"pprof.regression_check":          true,
+	"pprof.storylines":                true,
+	"pprof.memory_sanity":             true,
+	"pprof.goroutine_analysis":        true,
+	"pprof.contention_analysis":       true,
+	"pprof.discover":                  true,
+	"pprof.cross_correlate":           true,
+	"pprof.hotspot_summary":           true,
+	"pprof.trace_source":              true,
+	"pprof.coverage_hotspots":         true,
+	"pprof.vendor_analyze":            true,
+	"pprof.explain_overhead":          true,
+	"pprof.suggest_fix":               true,
+	"datadog.profiles.aggregate":      true,
+	"datadog.profiles.compare_range":  true,
+	"pprof.tags":                      true,
+	"pprof.flamegraph":                true,
+	"pprof.callgraph":                 true,
+	"pprof.focus_paths":               true,
+	"pprof.merge":                     true,
+	"datadog.function_history":        true,
+	"pprof.alloc_paths":               true,
+	"pprof.overhead_report":           true,
+	"pprof.generate_report":           true,
+	"pprof.temporal_analysis":         true,
+	"pprof.goroutine_categorize":      true,
+	"d2.schedule.start":               true,
+	"pprof.buildinfo":                 true,
+	"pprof.validate":                  true,
+	"pprof.symbolization":             true,
+	"server.self_profile":             true,
+}
+
+var (
+	toolPoolOnce sync.Once
+	toolPoolVal  *workerPool
+)
+
+// heavyToolPool returns the shared pool sized by PPROF_MCP_MAX_CONCURRENT_TOOLS
+// (default: number of CPUs, minimum 2; 0 disables the limit).
+func heavyToolPool() *workerPool {
+	toolPoolOnce.Do(func() {
+		toolPoolVal = newWorkerPool(readConcurrencyEnv("PPROF_MCP_MAX_CONCURRENT_TOOLS", max(runtime.NumCPU(), 2)))
+	})
+	return toolPoolVal
+}
+
+func readConcurrencyEnv(key string, fallback int) int {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(raw)
+	if err != nil || parsed < 0 {
+		return fallback
+	}
+	return parsed
+}
+
+// workerPool is a FIFO semaphore. Waiters are told their queue position when
+// they enqueue and again each time the queue advances.
+type workerPool struct {
+	mu     sync.Mutex
+	limit  int
+	active int
+	queue  []*poolWaiter
+}
+
+type poolWaiter struct {
+	ready  chan struct{}
+	notify func(position int)
+}
+
+// queueStats describes how long a call waited for a worker slot.
+type queueStats struct {
+	Position int
+	Waited   time.Duration
+}
+
+func newWorkerPool(limit int) *workerPool {
+	return &workerPool{limit: limit}
+}
+
+// Acquire blocks until a slot is free or ctx is done. notify (optional) is
+// called with the 1-based queue position whenever it changes. The returned
+// release func must be called exactly once on success.
+func (p *workerPool) Acquire(ctx context.Context, notify func(position int)) (func(), queueStats, error) {
+	p.mu.Lock()
+	if p.limit <= 0 || (p.active < p.limit && len(p.queue) == 0) {
+		p.active++
+		p.mu.Unlock()
+		return p.release, queueStats{}, nil
+	}
+	waiter := &poolWaiter{ready: make(chan struct{}), notify: notify}
+	p.queue = append(p.queue, waiter)
+	position := len(p.queue)
+	p.mu.Unlock()
+
+	start := time.Now()
+	if notify != nil {
+		notify(position)
+	}
+
+	select {
+	case <-waiter.ready:
+		return p.release, queueStats{Position: position, Waited: time.Since(start)}, nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		removed := p.removeLocked(waiter)
+		p.mu.Unlock()
+		if !removed {
+			// The slot was handed over concurrently with cancellation.
+			p.release()
+		}
+		return nil, queueStats{Position: position, Waited: time.Since(start)}, ctx.Err()
+	}
+}
+
+// Stats returns the number of running and queued calls.
+func (p *workerPool) Stats() (active, queued int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.active, len(p.queue)
+}
+
+func (p *workerPool) release() {
+	p.mu.Lock()
+	if len(p.queue) == 0 {
+		p.active--
+		p.mu.Unlock()
+		return
+	}
+	// Hand the slot directly to the next waiter; active stays the same.
+	next := p.queue[0]
+	p.queue = p.queue[1:]
+	remaining := append([]*poolWaiter(nil), p.queue...)
+	p.mu.Unlock()
+
+	close(next.ready)
+	for i, waiter := range remaining {
+		if waiter.notify != nil {
+			waiter.notify(i + 1)
+		}
+	}
+}
+
+func (p *workerPool) removeLocked(target *poolWaiter) bool {
+	for i, waiter := range p.queue {
+		if waiter == target {
+			p.queue = append(p.queue[:i], p.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// acquireToolSlot takes a worker slot for heavy tools, reporting queue
+// position through progress notifications when the client sent a token.
+func acquireToolSlot(ctx context.Context, req *mcp.CallToolRequest, canonicalName string) (func(), queueStats, error) {
+	if !heavyTools[canonicalName] {
+		return func() {}, queueStats{}, nil
+	}
+	var notify func(int)
+	if req != nil && req.Session != nil && req.Params != nil {
+		if token := req.Params.GetProgressToken(); token != nil {
+			notify = func(position int) {
+				_ = req.Session.NotifyProgress(ctx, &mcp.ProgressNotificationParams{
+					ProgressToken: token,
+					Message:       fmt.Sprintf("%s queued: position %d", canonicalName, position),
+				})
+			}
+		}
+	}
+	return heavyToolPool().Acquire(ctx, notify)
+}
+
+// annotateQueueStats records queue wait in the result _meta so callers can see
+// it without changing the structured output schema.
+func annotateQueueStats(res *mcp.CallToolResult, stats queueStats) {
+	if res == nil || stats.Position == 0 {
+		return
+	}
+	if res.Meta == nil {
+		res.Meta = mcp.Meta{}
+	}
+	res.Meta["queue"] = map[string]any{
+		"position": stats.Position,
+		"wait_ms":  stats.Waited.Milliseconds(),
+	}
+}
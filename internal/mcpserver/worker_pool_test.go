@@ -0,0 +1,94 @@
+package mcpserver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolQueuesBeyondLimit(t *testing.T) {
+	pool := newWorkerPool(1)
+	release, stats, err := pool.Acquire(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.Position != 0 {
+		t.Fatalf("expected no queueing, got position %d", stats.Position)
+	}
+
+	positions := make(chan int, 4)
+	acquired := make(chan queueStats, 1)
+	go func() {
+		second, secondStats, err := pool.Acquire(context.Background(), func(position int) {
+			positions <- position
+		})
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			return
+		}
+		acquired <- secondStats
+		second()
+	}()
+
+	select {
+	case position := <-positions:
+		if position != 1 {
+			t.Fatalf("expected queue position 1, got %d", position)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected queue notification")
+	}
+	if active, queued := pool.Stats(); active != 1 || queued != 1 {
+		t.Fatalf("expected 1 active and 1 queued, got %d/%d", active, queued)
+	}
+
+	release()
+	select {
+	case secondStats := <-acquired:
+		if secondStats.Position != 1 {
+			t.Fatalf("expected recorded position 1, got %d", secondStats.Position)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("queued call never acquired a slot")
+	}
+}
+
+func TestWorkerPoolCancelWhileQueued(t *testing.T) {
+	pool := newWorkerPool(1)
+	release, _, err := pool.Acquire(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, _, err := pool.Acquire(ctx, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if _, queued := pool.Stats(); queued != 0 {
+		t.Fatalf("expected canceled waiter to leave the queue, got %d queued", queued)
+	}
+}
+
+func TestWorkerPoolUnlimited(t *testing.T) {
+	pool := newWorkerPool(0)
+	for i := 0; i < 5; i++ {
+		if _, stats, err := pool.Acquire(context.Background(), nil); err != nil || stats.Position != 0 {
+			t.Fatalf("expected immediate acquire, got position %d err %v", stats.Position, err)
+		}
+	}
+}
+
+func TestHeavyToolsAreRegistered(t *testing.T) {
+	known := map[string]bool{}
+	for _, def := range ToolSchemas() {
+		known[def.Tool.Name] = true
+	}
+	for name := range heavyTools {
+		if !known[name] {
+			t.Fatalf("heavy tool %q is not registered", name)
+		}
+	}
+}
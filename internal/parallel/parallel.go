@@ -0,0 +1,115 @@
+// Package parallel runs the per-profile work of multi-profile analyses on a
+// process-wide, bounded set of workers.
+package parallel
+
+import (
+	"context"
+	"errors"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	slotsOnce sync.Once
+	slots     chan struct{}
+)
+
+// helperSlots returns the shared semaphore sized by
+// PPROF_MCP_ANALYSIS_WORKERS (default GOMAXPROCS). Every concurrent Map
+// draws its helper goroutines from it, so parallel tool calls together stay
+// within the bound.
+func helperSlots() chan struct{} {
+	slotsOnce.Do(func() {
+		n := runtime.GOMAXPROCS(0)
+		if raw := strings.TrimSpace(os.Getenv("PPROF_MCP_ANALYSIS_WORKERS")); raw != "" {
+			if parsed, err := strconv.Atoi(raw); err == nil && parsed >= 1 {
+				n = parsed
+			}
+		}
+		// The goroutine calling Map always works too, so it needs no slot.
+		slots = make(chan struct{}, n-1)
+	})
+	return slots
+}
+
+// Workers is the shared bound on how many items run at once.
+func Workers() int {
+	return cap(helperSlots()) + 1
+}
+
+// Map calls fn for items 0..n-1 and returns the results in item order,
+// whatever order they finish in. At most limit items of this call run at
+// once (0 means no limit of its own), and fewer when other calls hold the
+// shared workers: the calling goroutine always takes part, and helpers are
+// only started for free slots, so a Map inside a Map cannot deadlock.
+//
+// Every item runs even when others fail. The error joins the items' errors
+// in item order; items not started because ctx was done are reported once,
+// as ctx.Err().
+func Map[R any](ctx context.Context, n, limit int, fn func(ctx context.Context, i int) (R, error)) ([]R, error) {
+	results := make([]R, n)
+	errs := make([]error, n)
+	if n == 0 {
+		return results, nil
+	}
+	helpers := n - 1
+	if limit > 0 && limit-1 < helpers {
+		helpers = limit - 1
+	}
+
+	var (
+		mu       sync.Mutex
+		next     int
+		canceled bool
+	)
+	claim := func() (int, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if next >= n {
+			return 0, false
+		}
+		if ctx.Err() != nil {
+			canceled = true
+			return 0, false
+		}
+		i := next
+		next++
+		return i, true
+	}
+	work := func() {
+		for {
+			i, ok := claim()
+			if !ok {
+				return
+			}
+			results[i], errs[i] = fn(ctx, i)
+		}
+	}
+
+	var wg sync.WaitGroup
+	shared := helperSlots()
+spawn:
+	for h := 0; h < helpers; h++ {
+		select {
+		case shared <- struct{}{}:
+		default:
+			break spawn // every shared worker is busy; go on with those started
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-shared }()
+			work()
+		}()
+	}
+	work()
+	wg.Wait()
+
+	if canceled {
+		errs = append(errs, ctx.Err())
+	}
+	return results, errors.Join(errs...)
+}
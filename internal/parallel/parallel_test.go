@@ -0,0 +1,73 @@
+package parallel
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapKeepsOrderAndJoinsErrors(t *testing.T) {
+	results, err := Map(context.Background(), 20, 0, func(_ context.Context, i int) (string, error) {
+		// Later items finish first.
+		time.Sleep(time.Duration(20-i) * time.Millisecond)
+		if i%7 == 3 {
+			return "", fmt.Errorf("profile %d unreadable", i)
+		}
+		return fmt.Sprint(i), nil
+	})
+	require.EqualError(t, err, "profile 3 unreadable\nprofile 10 unreadable\nprofile 17 unreadable")
+	require.Len(t, results, 20)
+	require.Equal(t, "0", results[0])
+	require.Equal(t, "", results[3])
+	require.Equal(t, "19", results[19])
+
+	results, err = Map(context.Background(), 0, 0, func(context.Context, int) (string, error) { return "x", nil })
+	require.NoError(t, err)
+	require.Empty(t, results)
+}
+
+func TestMapLimit(t *testing.T) {
+	var running, peak atomic.Int32
+	_, err := Map(context.Background(), 12, 2, func(context.Context, int) (struct{}, error) {
+		now := running.Add(1)
+		for {
+			old := peak.Load()
+			if now <= old || peak.CompareAndSwap(old, now) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		running.Add(-1)
+		return struct{}{}, nil
+	})
+	require.NoError(t, err)
+	require.LessOrEqual(t, peak.Load(), int32(2))
+}
+
+func TestMapNested(t *testing.T) {
+	// Inner maps run on whatever workers are left, so nesting finishes even
+	// when the outer map holds every shared slot.
+	results, err := Map(context.Background(), Workers()+2, 0, func(ctx context.Context, i int) (int, error) {
+		inner, err := Map(ctx, 4, 0, func(_ context.Context, j int) (int, error) { return j, nil })
+		return i + len(inner), err
+	})
+	require.NoError(t, err)
+	require.Equal(t, 4, results[0])
+}
+
+func TestMapCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls atomic.Int32
+	_, err := Map(ctx, 50, 1, func(context.Context, int) (int, error) {
+		if calls.Add(1) == 2 {
+			cancel()
+		}
+		return 0, nil
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, int32(2), calls.Load())
+}
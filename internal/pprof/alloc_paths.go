@@ -2,11 +2,8 @@ package pprof
 
 import (
 	"fmt"
-	"os"
 	"sort"
 	"strings"
-
-	"github.com/google/pprof/profile"
 )
 
 // AllocPathsParams configures the allocation paths analysis.
@@ -51,13 +48,7 @@ func RunAllocPaths(params AllocPathsParams) (AllocPathsResult, error) {
 		return result, fmt.Errorf("profile path required")
 	}
 
-	file, err := os.Open(params.Profile)
-	if err != nil {
-		return result, err
-	}
-	defer file.Close()
-
-	prof, err := profile.Parse(file)
+	prof, err := parseProfile(params.Profile)
 	if err != nil {
 		return result, err
 	}
@@ -251,7 +242,10 @@ func RunAllocPaths(params AllocPathsParams) (AllocPathsResult, error) {
 
 	// Sort by allocation size
 	sort.Slice(result.Paths, func(i, j int) bool {
-		return result.Paths[i].AllocBytes > result.Paths[j].AllocBytes
+		if result.Paths[i].AllocBytes != result.Paths[j].AllocBytes {
+			return result.Paths[i].AllocBytes > result.Paths[j].AllocBytes
+		}
+		return result.Paths[i].AllocSite < result.Paths[j].AllocSite
 	})
 
 	// Limit results
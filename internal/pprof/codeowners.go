@@ -0,0 +1,349 @@
+package pprof
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// unownedKey collects the samples no CODEOWNERS rule covers.
+const unownedKey = "(unowned)"
+
+// codeOwnersLocations are where GitHub and GitLab look for CODEOWNERS, in
+// the order they look.
+var codeOwnersLocations = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS", ".gitlab/CODEOWNERS"}
+
+// CodeOwners is a parsed CODEOWNERS file.
+type CodeOwners struct {
+	Path  string
+	rules []codeOwnersRule
+}
+
+type codeOwnersRule struct {
+	pattern *regexp.Regexp
+	owners  []string
+	section int
+}
+
+// OwnerShare is the share of a profile attributed to one set of owners.
+type OwnerShare struct {
+	// Owner is the owners of a CODEOWNERS rule, space separated, or
+	// "(unowned)" for samples with no repo frame any rule covers.
+	Owner string  `json:"owner"`
+	Pct   float64 `json:"pct"`
+	// Functions are the owner's hottest functions by flat value.
+	Functions []string `json:"functions"`
+}
+
+// LoadCodeOwners reads the CODEOWNERS file at repoRoot. It returns nil and
+// no error when the repo has none.
+func LoadCodeOwners(repoRoot string) (*CodeOwners, error) {
+	for _, location := range codeOwnersLocations {
+		p := filepath.Join(repoRoot, filepath.FromSlash(location))
+		file, err := os.Open(p)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		owners := &CodeOwners{Path: p}
+		if err := owners.parse(file); err != nil {
+			return nil, err
+		}
+		return owners, nil
+	}
+	return nil, nil
+}
+
+// parse reads CODEOWNERS rules. GitLab sections ("[Name] @default") are
+// kept apart: a path takes the last matching rule of every section.
+func (c *CodeOwners) parse(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	section := 0
+	var defaults []string
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if header := strings.TrimPrefix(line, "^"); strings.HasPrefix(header, "[") {
+			if end := strings.Index(header, "]"); end > 0 {
+				section++
+				defaults = stripComment(strings.Fields(header[end+1:]))
+				// "[Name][2]" requires approvals; the count is not an owner.
+				if len(defaults) > 0 && strings.HasPrefix(defaults[0], "[") {
+					defaults = defaults[1:]
+				}
+				continue
+			}
+		}
+		fields := strings.Fields(strings.ReplaceAll(line, `\ `, "\x00"))
+		pattern := strings.ReplaceAll(strings.TrimPrefix(fields[0], `\`), "\x00", " ")
+		owners := stripComment(fields[1:])
+		if len(owners) == 0 {
+			owners = defaults
+		}
+		c.rules = append(c.rules, codeOwnersRule{pattern: compileOwnerPattern(pattern), owners: owners, section: section})
+	}
+	return scanner.Err()
+}
+
+func stripComment(fields []string) []string {
+	for i, field := range fields {
+		if strings.HasPrefix(field, "#") {
+			return fields[:i]
+		}
+	}
+	return fields
+}
+
+// compileOwnerPattern turns a gitignore-style CODEOWNERS pattern into a
+// regexp over slash-separated repo-relative paths. A pattern matches the
+// path itself and everything under it, except that a trailing "/*" only
+// matches the directory's direct children.
+func compileOwnerPattern(pattern string) *regexp.Regexp {
+	anchored := strings.HasPrefix(pattern, "/") || strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	pattern = strings.Trim(pattern, "/")
+	shallow := strings.HasSuffix(pattern, "/*")
+
+	var b strings.Builder
+	if anchored {
+		b.WriteString("^")
+	} else {
+		b.WriteString("^(?:.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	if shallow {
+		b.WriteString("$")
+	} else {
+		b.WriteString("(?:/.*)?$")
+	}
+	return regexp.MustCompile(b.String())
+}
+
+// Owners returns the owners of a repo-relative path: the last matching
+// rule's, combined across GitLab sections. A matching rule with no owners
+// leaves the path unowned.
+func (c *CodeOwners) Owners(rel string) []string {
+	if c == nil {
+		return nil
+	}
+	rel = strings.TrimPrefix(filepath.ToSlash(rel), "./")
+	last := map[int]codeOwnersRule{}
+	for _, rule := range c.rules {
+		if rule.pattern.MatchString(rel) {
+			last[rule.section] = rule
+		}
+	}
+	sections := make([]int, 0, len(last))
+	for section := range last {
+		sections = append(sections, section)
+	}
+	sort.Ints(sections)
+	var owners []string
+	seen := map[string]bool{}
+	for _, section := range sections {
+		for _, owner := range last[section].owners {
+			if !seen[owner] {
+				seen[owner] = true
+				owners = append(owners, owner)
+			}
+		}
+	}
+	return owners
+}
+
+// ownership attributes a profile's functions and samples to CODEOWNERS.
+type ownership struct {
+	owners   *CodeOwners
+	repoRoot string
+	trims    []string
+	byFile   map[string][]string
+}
+
+// newOwnership loads CODEOWNERS at repoRoot, mapping profile source paths
+// onto the repo with the trims prefixes. It returns nil when the repo has
+// no CODEOWNERS.
+func newOwnership(repoRoot string, trims []string) (*ownership, error) {
+	if repoRoot == "" {
+		return nil, nil
+	}
+	owners, err := LoadCodeOwners(repoRoot)
+	if err != nil || owners == nil {
+		return nil, err
+	}
+	o := &ownership{owners: owners, repoRoot: repoRoot, trims: trims, byFile: map[string][]string{}}
+	if abs, err := filepath.Abs(repoRoot); err == nil {
+		o.repoRoot = abs
+	}
+	return o, nil
+}
+
+// fileOwners returns the owners of a profile source path, or nil when the
+// path is not a file under repo_root.
+func (o *ownership) fileOwners(filename string) []string {
+	if filename == "" {
+		return nil
+	}
+	if owners, ok := o.byFile[filename]; ok {
+		return owners
+	}
+	var owners []string
+	if rel, ok := repoRelative(o.repoRoot, o.trims, filename); ok {
+		owners = o.owners.Owners(rel)
+	}
+	o.byFile[filename] = owners
+	return owners
+}
+
+// sampleOwners attributes a sample to the owners of its innermost frame in
+// an owned repo file, so time in the runtime or a dependency goes to the
+// team whose code called it.
+func (o *ownership) sampleOwners(sample *profile.Sample) []string {
+	for _, loc := range sample.Location {
+		if loc == nil {
+			continue
+		}
+		for _, line := range loc.Line {
+			if line.Function == nil {
+				continue
+			}
+			if owners := o.fileOwners(line.Function.Filename); len(owners) > 0 {
+				return owners
+			}
+		}
+	}
+	return nil
+}
+
+// attribution is a profile's value split by owner.
+type attribution struct {
+	total    int64
+	byOwner  map[string]int64
+	flat     map[string]map[string]int64 // owner → leaf function → flat value
+	function map[string]map[string]int64 // leaf function → owner → flat value
+}
+
+// attribute splits the value at valueIndex of every sample by owner.
+func (o *ownership) attribute(prof *profile.Profile, valueIndex int) attribution {
+	a := attribution{
+		byOwner:  map[string]int64{},
+		flat:     map[string]map[string]int64{},
+		function: map[string]map[string]int64{},
+	}
+	for _, sample := range prof.Sample {
+		if valueIndex >= len(sample.Value) || sample.Value[valueIndex] == 0 {
+			continue
+		}
+		value := sample.Value[valueIndex]
+		key := strings.Join(o.sampleOwners(sample), " ")
+		if key == "" {
+			key = unownedKey
+		}
+		a.total += value
+		a.byOwner[key] += value
+		leaf := sampleLeaf(sample)
+		if leaf == "" {
+			continue
+		}
+		if a.flat[key] == nil {
+			a.flat[key] = map[string]int64{}
+		}
+		a.flat[key][leaf] += value
+		if a.function[leaf] == nil {
+			a.function[leaf] = map[string]int64{}
+		}
+		a.function[leaf][key] += value
+	}
+	return a
+}
+
+func sampleLeaf(sample *profile.Sample) string {
+	if len(sample.Location) == 0 || sample.Location[0] == nil || len(sample.Location[0].Line) == 0 {
+		return ""
+	}
+	if fn := sample.Location[0].Line[0].Function; fn != nil {
+		return fn.Name
+	}
+	return ""
+}
+
+// functionOwners returns the owners of a function's own file, or else the
+// owners its samples were mostly attributed to.
+func (o *ownership) functionOwners(prof *profile.Profile, a attribution, name string) []string {
+	for _, fn := range prof.Function {
+		if fn != nil && fn.Name == name {
+			if owners := o.fileOwners(fn.Filename); len(owners) > 0 {
+				return owners
+			}
+			break
+		}
+	}
+	best, bestValue := "", int64(0)
+	for key, value := range a.function[name] {
+		if key != unownedKey && (value > bestValue || value == bestValue && key < best) {
+			best, bestValue = key, value
+		}
+	}
+	if best == "" {
+		return nil
+	}
+	return strings.Split(best, " ")
+}
+
+// ownerShares is the attribution as percentages, largest first, each with
+// its three hottest functions.
+func (a attribution) ownerShares() []OwnerShare {
+	shares := []OwnerShare{}
+	if a.total == 0 {
+		return shares
+	}
+	for key, value := range a.byOwner {
+		functions := make([]string, 0, len(a.flat[key]))
+		for name := range a.flat[key] {
+			functions = append(functions, name)
+		}
+		sort.Slice(functions, func(i, j int) bool {
+			fi, fj := a.flat[key][functions[i]], a.flat[key][functions[j]]
+			if fi != fj {
+				return fi > fj
+			}
+			return functions[i] < functions[j]
+		})
+		shares = append(shares, OwnerShare{
+			Owner:     key,
+			Pct:       roundPct(float64(value) / float64(a.total) * 100),
+			Functions: functions[:min(3, len(functions))],
+		})
+	}
+	sort.Slice(shares, func(i, j int) bool {
+		if shares[i].Pct != shares[j].Pct {
+			return shares[i].Pct > shares[j].Pct
+		}
+		return shares[i].Owner < shares[j].Owner
+	})
+	return shares
+}
@@ -0,0 +1,118 @@
+package pprof
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodeOwners(t *testing.T) {
+	owners := &CodeOwners{}
+	require.NoError(t, owners.parse(strings.NewReader(`# catch-all
+*                 @org/platform
+/pkg/api/         @org/api @alice
+docs/*            @org/docs
+*.pb.go           @org/proto   # generated
+/pkg/api/legacy/
+
+[Security][2] @org/security
+/internal/auth/
+`)))
+
+	cases := map[string][]string{
+		"main.go":                       {"@org/platform"},
+		"pkg/api/handler.go":            {"@org/api", "@alice"},
+		"pkg/api/v1/api.pb.go":          {"@org/proto"},
+		"pkg/api/legacy/old.go":         nil, // a rule with no owners unowns the path
+		"docs/guide.md":                 {"@org/docs"},
+		"docs/img/chart.png":            {"@org/platform"}, // docs/* is not recursive
+		"internal/auth/token.go":        {"@org/platform", "@org/security"},
+		"vendor/github.com/x/y/y.pb.go": {"@org/proto"},
+	}
+	for path, want := range cases {
+		require.Equal(t, want, owners.Owners(path), path)
+	}
+}
+
+func TestHotspotOwners(t *testing.T) {
+	repoRoot := t.TempDir()
+	files := map[string]string{
+		"go.mod":               "module myapp\n",
+		".github/CODEOWNERS":   "*.go @org/core\n/pkg/api/ @org/api\n",
+		"main.go":              "package main\n",
+		"pkg/api/handler.go":   "package api\n",
+		"internal/store/db.go": "package store\n",
+	}
+	for file, content := range files {
+		path := filepath.Join(repoRoot, filepath.FromSlash(file))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+
+	fn := func(id uint64, name, file string) *profile.Function {
+		return &profile.Function{ID: id, Name: name, Filename: file}
+	}
+	functions := []*profile.Function{
+		fn(1, "main.main", "/build/src/main.go"),
+		fn(2, "myapp/pkg/api.Handle", "/build/src/pkg/api/handler.go"),
+		fn(3, "myapp/internal/store.Query", "/build/src/internal/store/db.go"),
+		fn(4, "runtime.mallocgc", "/usr/local/go/src/runtime/malloc.go"),
+	}
+	var locations []*profile.Location
+	for _, f := range functions {
+		locations = append(locations, &profile.Location{ID: f.ID, Line: []profile.Line{{Function: f}}})
+	}
+	stack := func(value int64, ids ...int) *profile.Sample {
+		sample := &profile.Sample{Value: []int64{value}}
+		for _, id := range ids {
+			sample.Location = append(sample.Location, locations[id-1])
+		}
+		return sample
+	}
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		Function:   functions,
+		Location:   locations,
+		Sample: []*profile.Sample{
+			stack(50, 4, 2, 1), // runtime time under the API handler
+			stack(30, 2, 1),
+			stack(15, 3, 1),
+			stack(5, 4),
+		},
+	}
+	path := filepath.Join(t.TempDir(), "cpu.pprof")
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, prof.Write(file))
+	require.NoError(t, file.Close())
+
+	result := HotspotSummaryResult{}
+	owned := result.owned(path, "", repoRoot)
+	require.NotNil(t, owned)
+	require.Equal(t, filepath.Join(repoRoot, ".github", "CODEOWNERS"), result.CodeOwners)
+	require.Equal(t, []string{"@org/api"}, owned.functionOwners("runtime.mallocgc"))
+	require.Equal(t, []string{"@org/core"}, owned.functionOwners("myapp/internal/store.Query"))
+	require.Equal(t, []OwnerShare{
+		{Owner: "@org/api", Pct: 80, Functions: []string{"runtime.mallocgc", "myapp/pkg/api.Handle"}},
+		{Owner: "@org/core", Pct: 15, Functions: []string{"myapp/internal/store.Query"}},
+		{Owner: unownedKey, Pct: 5, Functions: []string{"runtime.mallocgc"}},
+	}, owned.attribution.ownerShares())
+
+	report := &strings.Builder{}
+	renderHotspotSummaryReport(report, "", HotspotSummaryResult{
+		CPUTop5:    []CPUHotspot{{Function: "runtime.mallocgc", FlatPct: 55, Owners: []string{"@org/api"}}, {Function: "main.main", FlatPct: 1}},
+		CPUByOwner: owned.attribution.ownerShares(),
+		CodeOwners: result.CodeOwners,
+	})
+	require.Contains(t, report.String(), "| cpu | runtime.mallocgc | 55.0% | @org/api |\n| cpu | main.main | 1.0% | - |")
+	require.Contains(t, report.String(), "| @org/api | 80.0% | runtime.mallocgc, myapp/pkg/api.Handle |")
+
+	// Without CODEOWNERS nothing is attributed, and the summary says why.
+	result = HotspotSummaryResult{}
+	require.Nil(t, result.owned(path, "", t.TempDir()))
+	require.Len(t, result.Warnings, 1)
+}
@@ -3,31 +3,61 @@ package pprof
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"os"
-	"os/exec"
 	"strconv"
 	"strings"
 	"sync"
 
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
 	"github.com/arreyder/pprof-mcp/internal/textutil"
 )
 
-type commandOutput struct {
+// CommandOutput is a command's stdout and stderr, captured separately and
+// each capped as its meta describes.
+type CommandOutput struct {
+	Command    string
 	Stdout     string
 	Stderr     string
 	StdoutMeta textutil.TruncateMeta
 	StderrMeta textutil.TruncateMeta
 }
 
-func runCommand(ctx context.Context, name string, args ...string) (commandOutput, error) {
-	cmd := exec.CommandContext(ctx, name, args...)
+// runCommand runs name under the cmdrun timeout for kind. go tool pprof
+// commands run on the detected pprof with their flags adapted to it. When the
+// tool's context or that timeout kills it, the error is a *PartialOutputError.
+func runCommand(ctx context.Context, kind, name string, args ...string) (CommandOutput, error) {
+	var notes []string
+	if kind == cmdrun.Pprof && name == "go" && len(args) >= 2 && args[0] == "tool" && args[1] == "pprof" {
+		name, args, notes = pprofInvocation(args[2:])
+	}
+	cmd, done := cmdrun.Command(ctx, kind, name, args...)
 	// Stream stdout/stderr into capped buffers to avoid unbounded memory usage.
 	stdoutBuf := newCappedBuffer(maxStdoutBytes())
 	stderrBuf := newCappedBuffer(maxStderrBytes())
+	for _, note := range notes {
+		fmt.Fprintln(stderrBuf, note)
+	}
 	cmd.Stdout = stdoutBuf
 	cmd.Stderr = stderrBuf
-	err := cmd.Run()
-	return commandOutput{
+	err := done(cmd.Run())
+	command := cmdrun.Join(append([]string{name}, args...)...)
+	var timeout *cmdrun.TimeoutError
+	if err != nil && (ctx.Err() != nil || errors.As(err, &timeout)) {
+		cause := ctx.Err()
+		if cause == nil {
+			cause = timeout
+		}
+		err = &PartialOutputError{
+			Err:        cause,
+			Command:    command,
+			Stdout:     stdoutBuf.String(),
+			StdoutMeta: stdoutBuf.Meta(),
+		}
+	}
+	return CommandOutput{
+		Command:    command,
 		Stdout:     stdoutBuf.String(),
 		Stderr:     stderrBuf.String(),
 		StdoutMeta: stdoutBuf.Meta(),
@@ -35,22 +65,33 @@ func runCommand(ctx context.Context, name string, args ...string) (commandOutput
 	}, err
 }
 
-func shellJoin(parts []string) string {
-	quoted := make([]string, 0, len(parts))
-	for _, part := range parts {
-		quoted = append(quoted, shellQuote(part))
+// RunTool runs go tool pprof with args (the flags and inputs after "go tool
+// pprof"). A failed run is ErrNoMatches or a *CommandError naming op; stderr
+// is returned separately either way so warnings never reach the parsed
+// output.
+func RunTool(ctx context.Context, op string, args ...string) (CommandOutput, error) {
+	output, err := runCommand(ctx, cmdrun.Pprof, "go", append([]string{"tool", "pprof"}, args...)...)
+	if err != nil {
+		return output, commandFailed(op, output, err)
 	}
-	return strings.Join(quoted, " ")
+	return output, nil
 }
 
-func shellQuote(s string) string {
-	if s == "" {
-		return "''"
-	}
-	if strings.ContainsAny(s, " \t\n\"'\\$&;|<>[]{}()") {
-		return "'" + strings.ReplaceAll(s, "'", "'\\''") + "'"
-	}
-	return s
+// PartialOutputError is returned when a command is killed because its context
+// ended. Stdout holds whatever was captured before the kill.
+type PartialOutputError struct {
+	Err        error
+	Command    string
+	Stdout     string
+	StdoutMeta textutil.TruncateMeta
+}
+
+func (e *PartialOutputError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Command, e.Err)
+}
+
+func (e *PartialOutputError) Unwrap() error {
+	return e.Err
 }
 
 const (
@@ -153,7 +194,7 @@ func (c *cappedBuffer) Meta() textutil.TruncateMeta {
 		Strategy:   string(textutil.StrategyHead),
 	}
 	if meta.Truncated {
-		meta.TruncatedReason = "max_bytes"
+		meta.TruncatedReason = textutil.ReasonCaptureLimit
 	}
 	return meta
 }
@@ -0,0 +1,59 @@
+package pprof
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+)
+
+func TestRunCommandPartialOutputOnTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	_, err := runCommand(ctx, cmdrun.Shell, "sh", "-c", "echo partial; sleep 5")
+	require.Error(t, err)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	var partial *PartialOutputError
+	require.True(t, errors.As(err, &partial))
+	require.Equal(t, "partial\n", partial.Stdout)
+	require.Equal(t, "sh -c 'echo partial; sleep 5'", partial.Command)
+}
+
+func TestRunCommandSeparatesStreams(t *testing.T) {
+	output, err := runCommand(context.Background(), cmdrun.Shell, "sh", "-c", "echo out; echo warning >&2")
+	require.NoError(t, err)
+	require.Equal(t, "out\n", output.Stdout)
+	require.Equal(t, "warning\n", output.Stderr)
+	require.Equal(t, 1, output.StderrMeta.TotalLines)
+}
+
+func TestRunTopErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.pprof")
+	require.NoError(t, os.WriteFile(path, []byte("not a profile"), 0o644))
+
+	_, err := RunTop(context.Background(), TopParams{Profile: path})
+	var commandErr *CommandError
+	require.ErrorAs(t, err, &commandErr)
+	require.Equal(t, "top", commandErr.Op)
+	require.Contains(t, commandErr.Stderr, "unrecognized profile format")
+	require.Contains(t, commandErr.Command, "go tool pprof")
+	require.True(t, strings.HasPrefix(err.Error(), "pprof top failed: "), err.Error())
+
+	path = filepath.Join(t.TempDir(), "cpu.pprof")
+	writeTestProfile(t, path, 50, 50)
+	// A focus matching nothing is a warning on stderr, not part of the table.
+	top, err := RunTop(context.Background(), TopParams{Profile: path, Focus: "nomatch"})
+	require.NoError(t, err)
+	require.Contains(t, top.Stderr, "matched no samples")
+	require.NotContains(t, top.Raw, "matched no samples")
+	require.Empty(t, top.Rows)
+}
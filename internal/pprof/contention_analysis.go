@@ -2,7 +2,6 @@ package pprof
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -73,13 +72,7 @@ func RunContentionAnalysis(params ContentionAnalysisParams) (ContentionAnalysisR
 		return result, fmt.Errorf("profile is required")
 	}
 
-	file, err := os.Open(params.Profile)
-	if err != nil {
-		return result, err
-	}
-	defer file.Close()
-
-	prof, err := profile.Parse(file)
+	prof, err := parseProfile(params.Profile)
 	if err != nil {
 		return result, err
 	}
@@ -288,7 +281,14 @@ func buildLockSites(lockMap map[string]*lockStats, delayUnit string) []LockConte
 		ordered = append(ordered, stats)
 	}
 	sort.Slice(ordered, func(i, j int) bool {
-		return ordered[i].totalDelay > ordered[j].totalDelay
+		a, b := ordered[i], ordered[j]
+		if a.totalDelay != b.totalDelay {
+			return a.totalDelay > b.totalDelay
+		}
+		if a.lockSite != b.lockSite {
+			return a.lockSite < b.lockSite
+		}
+		return a.sourceLocation < b.sourceLocation
 	})
 
 	items := make([]LockContentionSite, 0, len(ordered))
@@ -319,7 +319,10 @@ func buildTopWaiters(waiters map[string]int64, delayUnit string, limit int) []Co
 		list = append(list, waiterStat{function: name, delay: delay})
 	}
 	sort.Slice(list, func(i, j int) bool {
-		return list[i].delay > list[j].delay
+		if list[i].delay != list[j].delay {
+			return list[i].delay > list[j].delay
+		}
+		return list[i].function < list[j].function
 	})
 	if limit > 0 && len(list) > limit {
 		list = list[:limit]
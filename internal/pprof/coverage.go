@@ -0,0 +1,440 @@
+package pprof
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+	"github.com/arreyder/pprof-mcp/internal/tempfiles"
+)
+
+const (
+	defaultCoverageLimit  = 20
+	defaultCoverageMinPct = 1.0
+	defaultLowCoverage    = 50.0
+)
+
+// Coverage statuses reported in CoverageHotspot.Status.
+const (
+	CoverageUntested = "untested" // no statement ran under test
+	CoverageLow      = "low"      // below the low_coverage threshold
+	CoverageCovered  = "covered"
+)
+
+// coverBlock matches a coverprofile line: file:line.col,line.col stmts count
+var coverBlock = regexp.MustCompile(`^(.+):(\d+)\.(\d+),(\d+)\.(\d+) (\d+) (\d+)$`)
+
+// closureName matches the names Go gives function literals: pkg.F.func1,
+// pkg.F.func1.2, pkg.init.func3
+var closureName = regexp.MustCompile(`\.func\d+(\.\d+)*$`)
+
+type CoverageParams struct {
+	Profile  string
+	RepoRoot string
+	// Coverage is a coverprofile to read; without one, go test runs with
+	// -coverprofile over Packages in RepoRoot.
+	Coverage string
+	Packages []string // default ./...
+	// TrimPath lists build-time prefixes to strip before looking under
+	// RepoRoot; default: inferred from the profile's paths and RepoRoot.
+	TrimPath    string
+	SampleIndex string
+	Limit       int     // hot functions reported (default 20)
+	MinPct      float64 // cum% a function needs to count as hot (default 1)
+	// LowCoverage is the statement coverage percentage below which a hot
+	// function is low coverage (default 50).
+	LowCoverage float64
+}
+
+type CoverageResult struct {
+	Coverage string `json:"coverage"`          // the coverprofile read
+	Command  string `json:"command,omitempty"` // the go test run that wrote it
+	Mode     string `json:"mode"`
+	// UntestedFlatPct and LowFlatPct are the shares of the profile spent in
+	// the untested and low coverage hot functions themselves.
+	UntestedFlatPct   float64            `json:"untested_flat_pct"`
+	LowFlatPct        float64            `json:"low_flat_pct"`
+	Hotspots          []CoverageHotspot  `json:"hotspots"`
+	TrimPathInference *TrimPathInference `json:"trim_path_inference,omitempty"`
+	Warnings          []string           `json:"warnings,omitempty"`
+}
+
+// CoverageHotspot is a hot repo function and how much of it tests run.
+type CoverageHotspot struct {
+	Function    string  `json:"function"`
+	File        string  `json:"file"` // relative to RepoRoot
+	StartLine   int     `json:"start_line"`
+	EndLine     int     `json:"end_line"`
+	FlatPct     float64 `json:"flat_pct"`
+	CumPct      float64 `json:"cum_pct"`
+	Statements  int     `json:"statements"`
+	Covered     int     `json:"covered"`
+	CoveragePct float64 `json:"coverage_pct"`
+	Status      string  `json:"status"`
+	// NoData is set when the coverprofile has no blocks in the function:
+	// its package has no tests or was left out of the run.
+	NoData bool `json:"no_data,omitempty"`
+	// Risk is cum% times the uncovered fraction: the hot code a change
+	// could break with no test noticing.
+	Risk float64 `json:"risk"`
+}
+
+// coverageBlock is one basic block of a coverprofile
+type coverageBlock struct {
+	start, end sourcePos
+	statements int
+	count      int
+}
+
+// sourcePos is a line and column in a source file.
+type sourcePos struct {
+	line, col int
+}
+
+func (p sourcePos) before(q sourcePos) bool {
+	return p.line < q.line || p.line == q.line && p.col <= q.col
+}
+
+// RunCoverage ranks the profile's hot repo functions by how little of them
+// tests cover: hot and untested code is the riskiest place to optimize.
+func RunCoverage(ctx context.Context, params CoverageParams) (CoverageResult, error) {
+	result := CoverageResult{Hotspots: []CoverageHotspot{}}
+	if params.Profile == "" {
+		return result, fmt.Errorf("profile is required")
+	}
+	repoRoot := params.RepoRoot
+	if repoRoot == "" {
+		repoRoot = "."
+	}
+	if abs, err := filepath.Abs(repoRoot); err == nil {
+		repoRoot = abs
+	}
+	limit := params.Limit
+	if limit <= 0 {
+		limit = defaultCoverageLimit
+	}
+	minPct := params.MinPct
+	if minPct <= 0 {
+		minPct = defaultCoverageMinPct
+	}
+	lowCoverage := params.LowCoverage
+	if lowCoverage <= 0 {
+		lowCoverage = defaultLowCoverage
+	}
+
+	prof, err := parseProfile(params.Profile)
+	if err != nil {
+		return result, err
+	}
+	sampleIndex := params.SampleIndex
+	if sampleIndex == "" {
+		sampleIndex = detectBestSampleIndex(prof)
+	}
+	trims := filepath.SplitList(params.TrimPath)
+	if params.TrimPath == "" {
+		inference := InferTrimPath(prof, repoRoot)
+		result.TrimPathInference = &inference
+		trims = filepath.SplitList(inference.TrimPath)
+	}
+
+	result.Coverage = params.Coverage
+	if result.Coverage == "" {
+		path, command, warning, err := runCoverageTests(ctx, repoRoot, params.Packages)
+		result.Command = command
+		if err != nil {
+			return result, err
+		}
+		if warning != "" {
+			result.Warnings = append(result.Warnings, warning)
+		}
+		result.Coverage = path
+	}
+	file, err := os.Open(result.Coverage)
+	if err != nil {
+		return result, err
+	}
+	defer file.Close()
+	mode, blocks, err := parseCoverProfile(file, repoModules(repoRoot))
+	if err != nil {
+		return result, fmt.Errorf("read coverprofile %s: %w", result.Coverage, err)
+	}
+	result.Mode = mode
+
+	stats, total := computeFunctionStats(prof, findSampleIndex(prof, sampleIndex))
+	extents := newFunctionExtents(repoRoot)
+	var hotspots []CoverageHotspot
+	for _, fn := range profileFunctions(prof) {
+		stat := stats[fn.Name]
+		cumPct := percentOf(stat.cum, total)
+		if cumPct < minPct {
+			continue
+		}
+		rel, ok := repoRelative(repoRoot, trims, fn.Filename)
+		if !ok {
+			continue
+		}
+		start, end, ok := extents.find(rel, fn, sampledLine(prof, fn))
+		if !ok {
+			continue
+		}
+		hotspot := CoverageHotspot{
+			Function:  fn.Name,
+			File:      rel,
+			StartLine: start.line,
+			EndLine:   end.line,
+			FlatPct:   percentOf(stat.flat, total),
+			CumPct:    cumPct,
+		}
+		for _, block := range blocks[rel] {
+			if start.before(block.start) && block.end.before(end) {
+				hotspot.Statements += block.statements
+				if block.count > 0 {
+					hotspot.Covered += block.statements
+				}
+			}
+		}
+		hotspot.NoData = hotspot.Statements == 0
+		if hotspot.Statements > 0 {
+			hotspot.CoveragePct = roundPct(float64(hotspot.Covered) / float64(hotspot.Statements) * 100)
+		}
+		switch {
+		case hotspot.Covered == 0:
+			hotspot.Status = CoverageUntested
+			result.UntestedFlatPct += hotspot.FlatPct
+		case hotspot.CoveragePct < lowCoverage:
+			hotspot.Status = CoverageLow
+			result.LowFlatPct += hotspot.FlatPct
+		default:
+			hotspot.Status = CoverageCovered
+		}
+		hotspot.Risk = roundPct(hotspot.CumPct * (100 - hotspot.CoveragePct) / 100)
+		hotspots = append(hotspots, hotspot)
+	}
+	result.UntestedFlatPct = roundPct(result.UntestedFlatPct)
+	result.LowFlatPct = roundPct(result.LowFlatPct)
+	if len(hotspots) == 0 {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("no function under repo_root has %.1f%% cum or more; check repo_root and trim_path", minPct))
+	}
+
+	sort.SliceStable(hotspots, func(i, j int) bool {
+		if hotspots[i].Risk != hotspots[j].Risk {
+			return hotspots[i].Risk > hotspots[j].Risk
+		}
+		if hotspots[i].CumPct != hotspots[j].CumPct {
+			return hotspots[i].CumPct > hotspots[j].CumPct
+		}
+		return hotspots[i].Function < hotspots[j].Function
+	})
+	if len(hotspots) > limit {
+		hotspots = hotspots[:limit]
+	}
+	result.Hotspots = append(result.Hotspots, hotspots...)
+	return result, nil
+}
+
+// runCoverageTests runs go test with a coverprofile in repoRoot. Failing
+// tests still leave coverage for the packages that ran, so they only warn.
+func runCoverageTests(ctx context.Context, repoRoot string, packages []string) (string, string, string, error) {
+	if len(packages) == 0 {
+		packages = []string{"./..."}
+	}
+	tmp, file, err := tempfiles.CreateTemp("", "pprof-mcp-cover-*.out")
+	if err != nil {
+		return "", "", "", err
+	}
+	file.Close()
+	// Removed unless the coverage is returned.
+	defer tmp.Remove()
+	path := tmp.Path
+	args := append([]string{"-C", repoRoot, "test", "-covermode=set", "-coverprofile=" + path}, packages...)
+	command := cmdrun.Join(append([]string{"go"}, args...)...)
+	out, err := runCommand(ctx, cmdrun.Go, "go", args...)
+	if err == nil {
+		tmp.Keep()
+		return path, command, "", nil
+	}
+	if info, statErr := os.Stat(path); statErr == nil && info.Size() > 0 && ctx.Err() == nil {
+		tmp.Keep()
+		return path, command, fmt.Sprintf("go test failed (%v); coverage is from the packages that ran: %s", err, lastLine(out.Stdout+out.Stderr)), nil
+	}
+	return "", command, "", fmt.Errorf("go test: %w: %s", err, lastLine(out.Stderr))
+}
+
+func lastLine(output string) string {
+	output = strings.TrimSpace(output)
+	return output[strings.LastIndex(output, "\n")+1:]
+}
+
+// parseCoverProfile reads a coverprofile into blocks by repo-relative file.
+// Its files are import paths, mapped onto the repo through its modules;
+// blocks repeated by several test binaries count as covered if any ran.
+func parseCoverProfile(r io.Reader, modules []repoModule) (string, map[string][]coverageBlock, error) {
+	scanner := bufio.NewScanner(r)
+	mode := ""
+	type key struct {
+		file       string
+		start, end sourcePos
+	}
+	merged := map[key]*coverageBlock{}
+	var order []key
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if rest, ok := strings.CutPrefix(line, "mode: "); ok {
+			mode = rest
+			continue
+		}
+		m := coverBlock.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		rel, ok := coverageFile(m[1], modules)
+		if !ok {
+			continue
+		}
+		var n [6]int
+		for i := range n {
+			n[i], _ = strconv.Atoi(m[i+2])
+		}
+		start, end := sourcePos{n[0], n[1]}, sourcePos{n[2], n[3]}
+		statements, count := n[4], n[5]
+		k := key{rel, start, end}
+		if block, ok := merged[k]; ok {
+			block.count = max(block.count, count)
+			continue
+		}
+		merged[k] = &coverageBlock{start: start, end: end, statements: statements, count: count}
+		order = append(order, k)
+	}
+	if err := scanner.Err(); err != nil {
+		return "", nil, err
+	}
+	if mode == "" {
+		return "", nil, fmt.Errorf("not a coverprofile: no mode line")
+	}
+	blocks := map[string][]coverageBlock{}
+	for _, k := range order {
+		blocks[k.file] = append(blocks[k.file], *merged[k])
+	}
+	return mode, blocks, nil
+}
+
+// coverageFile maps a coverprofile file, an import path, to a path
+// relative to the repo root through the longest matching module.
+func coverageFile(name string, modules []repoModule) (string, bool) {
+	best := -1
+	for i, module := range modules {
+		if strings.HasPrefix(name, module.path+"/") && (best < 0 || len(module.path) > len(modules[best].path)) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return "", false
+	}
+	rel := strings.TrimPrefix(name, modules[best].path+"/")
+	if modules[best].dir != "" {
+		rel = modules[best].dir + "/" + rel
+	}
+	return rel, true
+}
+
+// profileFunctions lists the profile's named functions with a source file,
+// one per name.
+func profileFunctions(prof *profile.Profile) []*profile.Function {
+	seen := map[string]bool{}
+	var functions []*profile.Function
+	for _, fn := range prof.Function {
+		if fn == nil || fn.Name == "" || fn.Filename == "" || seen[fn.Name] {
+			continue
+		}
+		seen[fn.Name] = true
+		functions = append(functions, fn)
+	}
+	return functions
+}
+
+// sampledLine is the lowest line of fn in the profile, to place functions
+// in profiles that carry no start lines.
+func sampledLine(prof *profile.Profile, fn *profile.Function) int {
+	line := 0
+	for _, loc := range prof.Location {
+		for _, l := range loc.Line {
+			if l.Function != nil && l.Function.Name == fn.Name && l.Line > 0 && (line == 0 || int(l.Line) < line) {
+				line = int(l.Line)
+			}
+		}
+	}
+	return line
+}
+
+// functionExtents finds where function declarations and literals span,
+// parsing each repo file once.
+type functionExtents struct {
+	repoRoot string
+	files    map[string]*functionFile
+}
+
+type functionFile struct {
+	fset *token.FileSet
+	file *ast.File
+}
+
+func newFunctionExtents(repoRoot string) *functionExtents {
+	return &functionExtents{repoRoot: repoRoot, files: map[string]*functionFile{}}
+}
+
+// find returns the extent of fn in the repo file rel: the declaration, or
+// for a closure the literal, that starts at its start line, else the
+// innermost one around line.
+func (e *functionExtents) find(rel string, fn *profile.Function, line int) (sourcePos, sourcePos, bool) {
+	parsed, ok := e.files[rel]
+	if !ok {
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, filepath.Join(e.repoRoot, filepath.FromSlash(rel)), nil, parser.SkipObjectResolution)
+		if err == nil {
+			parsed = &functionFile{fset: fset, file: file}
+		}
+		e.files[rel] = parsed
+	}
+	if parsed == nil {
+		return sourcePos{}, sourcePos{}, false
+	}
+	closure := closureName.MatchString(fn.Name)
+	startLine := int(fn.StartLine)
+	if startLine == 0 {
+		startLine = line
+	}
+	var start, end, inner, innerEnd sourcePos
+	ast.Inspect(parsed.file, func(node ast.Node) bool {
+		switch node.(type) {
+		case *ast.FuncDecl, *ast.FuncLit:
+		default:
+			return true
+		}
+		_, isLit := node.(*ast.FuncLit)
+		from, to := parsed.fset.Position(node.Pos()), parsed.fset.Position(node.End())
+		if from.Line == int(fn.StartLine) && isLit == closure && start.line == 0 {
+			start, end = sourcePos{from.Line, from.Column}, sourcePos{to.Line, to.Column}
+		}
+		if from.Line <= startLine && startLine <= to.Line {
+			inner, innerEnd = sourcePos{from.Line, from.Column}, sourcePos{to.Line, to.Column}
+		}
+		return true
+	})
+	if start.line == 0 {
+		start, end = inner, innerEnd
+	}
+	return start, end, start.line > 0
+}
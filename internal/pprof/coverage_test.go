@@ -0,0 +1,139 @@
+package pprof
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunCoverage(t *testing.T) {
+	repoRoot := t.TempDir()
+	files := map[string]string{
+		"go.mod":  "module myapp\n\ngo 1.21\n",
+		"main.go": "package main\n\nfunc main() {\n\tprintln()\n}\n",
+		"pkg/api/handler.go": `package api
+
+func Handle(n int) int {
+	if n > 0 {
+		return n
+	}
+	f := func() int {
+		return -n
+	}
+	return f()
+}
+`,
+		"pkg/api/handler_test.go": "package api\n\nimport \"testing\"\n\nfunc TestHandle(t *testing.T) {\n\tHandle(1)\n}\n",
+		"internal/store/db.go":    "package store\n\nfunc Query() int {\n\treturn 1\n}\n",
+	}
+	for file, content := range files {
+		path := filepath.Join(repoRoot, filepath.FromSlash(file))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+
+	fn := func(id uint64, name, file string, start int64) *profile.Function {
+		return &profile.Function{ID: id, Name: name, Filename: file, StartLine: start}
+	}
+	functions := []*profile.Function{
+		fn(1, "main.main", "/build/src/main.go", 3),
+		fn(2, "myapp/pkg/api.Handle", "/build/src/pkg/api/handler.go", 3),
+		fn(3, "myapp/pkg/api.Handle.func1", "/build/src/pkg/api/handler.go", 7),
+		fn(4, "myapp/internal/store.Query", "/build/src/internal/store/db.go", 3),
+		fn(5, "runtime.mallocgc", "/usr/local/go/src/runtime/malloc.go", 900),
+	}
+	var locations []*profile.Location
+	for _, f := range functions {
+		locations = append(locations, &profile.Location{ID: f.ID, Line: []profile.Line{{Function: f, Line: f.StartLine + 1}}})
+	}
+	stack := func(value int64, ids ...int) *profile.Sample {
+		sample := &profile.Sample{Value: []int64{value}}
+		for _, id := range ids {
+			sample.Location = append(sample.Location, locations[id-1])
+		}
+		return sample
+	}
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		Function:   functions,
+		Location:   locations,
+		Sample: []*profile.Sample{
+			stack(40, 3, 2, 1),
+			stack(30, 4, 1),
+			stack(20, 2, 1),
+			stack(10, 1),
+		},
+	}
+	profilePath := filepath.Join(t.TempDir(), "cpu.pprof")
+	file, err := os.Create(profilePath)
+	require.NoError(t, err)
+	require.NoError(t, prof.Write(file))
+	require.NoError(t, file.Close())
+
+	coverPath := filepath.Join(t.TempDir(), "cover.out")
+	require.NoError(t, os.WriteFile(coverPath, []byte(`mode: set
+myapp/main.go:4.2,4.11 1 1
+myapp/main.go:4.2,4.11 1 0
+myapp/pkg/api/handler.go:4.2,4.11 1 1
+myapp/pkg/api/handler.go:5.3,6.1 1 1
+myapp/pkg/api/handler.go:7.2,7.18 1 0
+myapp/pkg/api/handler.go:8.3,9.1 1 0
+myapp/pkg/api/handler.go:10.2,10.12 1 0
+example.com/other/x.go:1.1,2.2 5 0
+`), 0o644))
+
+	result, err := RunCoverage(context.Background(), CoverageParams{
+		Profile:  profilePath,
+		RepoRoot: repoRoot,
+		Coverage: coverPath,
+		TrimPath: "/build/src",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "set", result.Mode)
+	require.Empty(t, result.Command)
+	require.Equal(t, []CoverageHotspot{
+		{Function: "myapp/pkg/api.Handle.func1", File: "pkg/api/handler.go", StartLine: 7, EndLine: 9, FlatPct: 40, CumPct: 40, Statements: 1, Status: CoverageUntested, Risk: 40},
+		{Function: "myapp/pkg/api.Handle", File: "pkg/api/handler.go", StartLine: 3, EndLine: 11, FlatPct: 20, CumPct: 60, Statements: 5, Covered: 2, CoveragePct: 40, Status: CoverageLow, Risk: 36},
+		{Function: "myapp/internal/store.Query", File: "internal/store/db.go", StartLine: 3, EndLine: 5, FlatPct: 30, CumPct: 30, Status: CoverageUntested, NoData: true, Risk: 30},
+		// A block repeated by another test binary is covered if either ran it.
+		{Function: "main.main", File: "main.go", StartLine: 3, EndLine: 5, FlatPct: 10, CumPct: 100, Statements: 1, Covered: 1, CoveragePct: 100, Status: CoverageCovered},
+	}, result.Hotspots)
+	require.Equal(t, 70.0, result.UntestedFlatPct)
+	require.Equal(t, 20.0, result.LowFlatPct)
+
+	// Without a coverprofile, go test writes one.
+	result, err = RunCoverage(context.Background(), CoverageParams{
+		Profile:  profilePath,
+		RepoRoot: repoRoot,
+		Packages: []string{"./pkg/..."},
+		TrimPath: "/build/src",
+		Limit:    3,
+	})
+	require.NoError(t, err)
+	defer os.Remove(result.Coverage)
+	require.True(t, strings.Contains(result.Command, "-coverprofile="), result.Command)
+	require.Len(t, result.Hotspots, 3)
+	require.Equal(t, "main.main", result.Hotspots[0].Function)
+	require.True(t, result.Hotspots[0].NoData)
+	require.Equal(t, "myapp/pkg/api.Handle", result.Hotspots[2].Function)
+	require.Equal(t, 40.0, result.Hotspots[2].CoveragePct)
+}
+
+func TestCoverageFile(t *testing.T) {
+	modules := []repoModule{{path: "example.com/app"}, {path: "example.com/app/tools", dir: "tools"}}
+	cases := map[string]string{
+		"example.com/app/main.go":          "main.go",
+		"example.com/app/tools/gen/gen.go": "tools/gen/gen.go",
+		"example.com/application/x.go":     "",
+	}
+	for name, want := range cases {
+		rel, ok := coverageFile(name, modules)
+		require.Equal(t, want != "", ok, name)
+		require.Equal(t, want, rel, name)
+	}
+}
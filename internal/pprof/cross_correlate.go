@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"sort"
+
+	"github.com/arreyder/pprof-mcp/internal/parallel"
 )
 
 const (
@@ -49,18 +51,21 @@ type CorrelationMutex struct {
 }
 
 type CPUHotspot struct {
-	Function string  `json:"function"`
-	FlatPct  float64 `json:"flat_pct"`
+	Function string   `json:"function"`
+	FlatPct  float64  `json:"flat_pct"`
+	Owners   []string `json:"owners,omitempty"` // CODEOWNERS of the function, with repo_root
 }
 
 type HeapHotspot struct {
-	Function string  `json:"function"`
-	AllocPct float64 `json:"alloc_pct"`
+	Function string   `json:"function"`
+	AllocPct float64  `json:"alloc_pct"`
+	Owners   []string `json:"owners,omitempty"` // CODEOWNERS of the function, with repo_root
 }
 
 type MutexHotspot struct {
-	Function string  `json:"function"`
-	DelayPct float64 `json:"delay_pct"`
+	Function string   `json:"function"`
+	DelayPct float64  `json:"delay_pct"`
+	Owners   []string `json:"owners,omitempty"` // CODEOWNERS of the function, with repo_root
 }
 
 type topMetric struct {
@@ -86,31 +91,22 @@ func RunCrossCorrelate(ctx context.Context, params CrossCorrelateParams) (CrossC
 		nodeCount = defaultCorrelationNodeCount
 	}
 
-	cpuTop, cpuWarn := runTopMetrics(ctx, params.Profiles["cpu"], nodeCount, "")
-	if cpuWarn != "" {
-		result.Warnings = append(result.Warnings, cpuWarn)
-	}
-	heapPath := params.Profiles["heap"]
-	heapSampleIndex, heapWarn := pickHeapSampleIndex(heapPath)
-	if heapWarn != "" {
-		result.Warnings = append(result.Warnings, heapWarn)
-	}
-	heapTop, heapTopWarn := runTopMetrics(ctx, heapPath, nodeCount, heapSampleIndex)
-	if heapTopWarn != "" {
-		result.Warnings = append(result.Warnings, heapTopWarn)
-	}
 	mutexPath := params.Profiles["mutex"]
 	if mutexPath == "" {
 		mutexPath = params.Profiles["block"]
 	}
-	mutexSampleIndex, mutexWarn := pickMutexSampleIndex(mutexPath)
-	if mutexWarn != "" {
-		result.Warnings = append(result.Warnings, mutexWarn)
+	tops, err := correlationTops(ctx, nodeCount, []correlationInput{
+		{path: params.Profiles["cpu"]},
+		{path: params.Profiles["heap"], sampleIndex: pickHeapSampleIndex},
+		{path: mutexPath, sampleIndex: pickMutexSampleIndex},
+	})
+	if err != nil {
+		return result, err
 	}
-	mutexTop, mutexTopWarn := runTopMetrics(ctx, mutexPath, nodeCount, mutexSampleIndex)
-	if mutexTopWarn != "" {
-		result.Warnings = append(result.Warnings, mutexTopWarn)
+	for _, top := range tops {
+		result.Warnings = append(result.Warnings, top.warnings...)
 	}
+	cpuTop, heapTop, mutexTop := tops[0].metrics, tops[1].metrics, tops[2].metrics
 
 	metrics := map[string]*CorrelationEntry{}
 	maxRankCPU := maxRank(cpuTop)
@@ -153,7 +149,11 @@ func RunCrossCorrelate(ctx context.Context, params CrossCorrelateParams) (CrossC
 	}
 
 	sort.Slice(result.Correlations, func(i, j int) bool {
-		return result.Correlations[i].CombinedScore > result.Correlations[j].CombinedScore
+		a, b := result.Correlations[i], result.Correlations[j]
+		if a.CombinedScore != b.CombinedScore {
+			return a.CombinedScore > b.CombinedScore
+		}
+		return a.Function < b.Function
 	})
 
 	result.CPUOnlyHotspots = buildCPUOnly(cpuTop, metrics)
@@ -163,6 +163,39 @@ func RunCrossCorrelate(ctx context.Context, params CrossCorrelateParams) (CrossC
 	return result, nil
 }
 
+// correlationInput is one profile to rank, and how to choose its sample
+// index when the default will not do.
+type correlationInput struct {
+	path        string
+	sampleIndex func(path string) (index, warning string)
+}
+
+type correlationTop struct {
+	metrics  []topMetric
+	warnings []string
+}
+
+// correlationTops ranks the inputs' functions concurrently, returning them,
+// with any warnings, in input order.
+func correlationTops(ctx context.Context, nodeCount int, inputs []correlationInput) ([]correlationTop, error) {
+	return parallel.Map(ctx, len(inputs), 0, func(ctx context.Context, i int) (correlationTop, error) {
+		var top correlationTop
+		index := ""
+		if pick := inputs[i].sampleIndex; pick != nil {
+			var warn string
+			if index, warn = pick(inputs[i].path); warn != "" {
+				top.warnings = append(top.warnings, warn)
+			}
+		}
+		metrics, warn := runTopMetrics(ctx, inputs[i].path, nodeCount, index)
+		if warn != "" {
+			top.warnings = append(top.warnings, warn)
+		}
+		top.metrics = metrics
+		return top, nil
+	})
+}
+
 func runTopMetrics(ctx context.Context, profilePath string, nodeCount int, sampleIndex string) ([]topMetric, string) {
 	if profilePath == "" {
 		return nil, "profile missing for correlation"
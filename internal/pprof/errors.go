@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+
+	"github.com/arreyder/pprof-mcp/internal/textutil"
 )
 
 // ErrNoMatches indicates a regex/pattern matched no symbols in a profile.
@@ -18,3 +20,57 @@ func wrapNoMatches(err error, stderr string) error {
 	}
 	return fmt.Errorf("%w: %s", ErrNoMatches, strings.TrimSpace(stderr))
 }
+
+// CommandError is a pprof run that did not succeed: go tool pprof could not
+// start, exited non-zero, or was killed. Stderr is what it printed, capped
+// as StderrMeta describes.
+type CommandError struct {
+	Op         string // pprof operation, e.g. "top"
+	Command    string
+	Stderr     string
+	StderrMeta textutil.TruncateMeta
+	Err        error
+}
+
+func (e *CommandError) Error() string {
+	msg := fmt.Sprintf("pprof %s failed: %v", e.Op, e.Err)
+	if stderr := strings.TrimSpace(e.Stderr); stderr != "" {
+		msg += "\n" + stderr
+	}
+	return msg
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// ParseError is pprof output that could not be read: the command succeeded
+// but printed something other than the report the parser expects.
+type ParseError struct {
+	Op      string
+	Command string
+	Err     error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("parse pprof %s output: %v", e.Op, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// commandFailed is the error for a failed pprof run: ErrNoMatches when a
+// focus or regex matched nothing, else a *CommandError.
+func commandFailed(op string, output CommandOutput, err error) error {
+	if noMatches := wrapNoMatches(err, output.Stderr); noMatches != nil {
+		return noMatches
+	}
+	return &CommandError{
+		Op:         op,
+		Command:    output.Command,
+		Stderr:     output.Stderr,
+		StderrMeta: output.StderrMeta,
+		Err:        err,
+	}
+}
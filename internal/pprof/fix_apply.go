@@ -0,0 +1,182 @@
+package pprof
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+	"github.com/arreyder/pprof-mcp/internal/textutil"
+)
+
+// suggest_fix modes: return the fix, or also write it into the working tree
+// and verify it.
+const (
+	FixModeSuggest = "suggest"
+	FixModeApply   = "apply"
+)
+
+// fixCheckMaxLines bounds the go build and go test output a check keeps.
+const fixCheckMaxLines = 60
+
+// FixApplication is a fix written into the working tree and how the touched
+// packages fared.
+type FixApplication struct {
+	Files []string `json:"files"`
+	// Backups are the original files, each beside its file with .orig added.
+	Backups  []string `json:"backups"`
+	Packages []string `json:"packages"`
+	Build    FixCheck `json:"build"`
+	// Test is nil when the build failed and tests were not run.
+	Test *FixCheck `json:"test,omitempty"`
+}
+
+// FixCheck is the outcome of a go command run over the touched packages.
+type FixCheck struct {
+	Command string `json:"command"`
+	Passed  bool   `json:"passed"`
+	// Output is the tail of the command's output when it failed.
+	Output string `json:"output,omitempty"`
+}
+
+// writeFixFile writes a modified file; tests replace it.
+var writeFixFile = os.WriteFile
+
+// selectFix returns the fix fixID names, or the only applicable one. The
+// reason says why none was picked.
+func selectFix(fixes []FixSuggestion, fixID string) (*FixSuggestion, string) {
+	var fix *FixSuggestion
+	for i := range fixes {
+		if fixID == "" || fixes[i].FixID == fixID {
+			if fix != nil {
+				return nil, "several fixes apply; pass fix_id to pick one"
+			}
+			fix = &fixes[i]
+		}
+	}
+	if fix == nil && fixID != "" {
+		return nil, fmt.Sprintf("fix %s does not apply", fixID)
+	}
+	return fix, ""
+}
+
+// applyFixes applies the selected fix. Failing to is a warning, like
+// failing to open a pull request.
+func applyFixes(ctx context.Context, params SuggestFixParams, result *SuggestFixResult) {
+	fix, reason := selectFix(result.ApplicableFixes, params.FixID)
+	if fix == nil {
+		if reason != "" {
+			result.Warnings = append(result.Warnings, "not applied: "+reason)
+		}
+		return
+	}
+	applied, err := applyFix(ctx, params.RepoRoot, *fix)
+	if err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("%s not applied: %v", fix.FixID, err))
+		return
+	}
+	fix.Applied = applied
+}
+
+// applyFix writes fix into the working tree, keeping each original as a
+// .orig backup, then builds the packages it touches and, if they compile,
+// runs their tests. Failing checks leave the fix in place for inspection.
+func applyFix(ctx context.Context, repoRoot string, fix FixSuggestion) (*FixApplication, error) {
+	if repoRoot == "" {
+		return nil, fmt.Errorf("repo_root is required")
+	}
+	if len(fix.FilesToModify) == 0 {
+		return nil, fmt.Errorf("the fix has no changes for this repo")
+	}
+	applied := &FixApplication{Files: []string{}, Backups: []string{}, Packages: []string{}}
+	// Back every file up before writing any, so a failure leaves the tree
+	// as it was.
+	backup := func(path string) error {
+		if _, err := os.Stat(path + ".orig"); err == nil {
+			return fmt.Errorf("%s.orig exists: restore or remove the backup of an earlier apply first", path)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		original, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path+".orig", original, info.Mode().Perm())
+	}
+	for _, file := range fix.FilesToModify {
+		if err := backup(file.Path); err != nil {
+			for _, written := range applied.Backups {
+				os.Remove(written)
+			}
+			return nil, err
+		}
+		applied.Backups = append(applied.Backups, file.Path+".orig")
+	}
+	// A failed write may have truncated its file, so every file goes back,
+	// not only those written.
+	rollback := func() {
+		for _, file := range fix.FilesToModify {
+			os.Rename(file.Path+".orig", file.Path)
+		}
+	}
+	packages := map[string]bool{}
+	for _, file := range fix.FilesToModify {
+		info, err := os.Stat(file.Path)
+		if err != nil {
+			rollback()
+			return nil, err
+		}
+		if err := writeFixFile(file.Path, []byte(file.modified), info.Mode().Perm()); err != nil {
+			rollback()
+			return nil, err
+		}
+		applied.Files = append(applied.Files, file.Path)
+		if rel, err := filepath.Rel(repoRoot, filepath.Dir(file.Path)); err == nil && !strings.HasPrefix(rel, "..") {
+			pkg := "./" + filepath.ToSlash(rel)
+			if rel == "." {
+				pkg = "."
+			}
+			packages[pkg] = true
+		}
+	}
+	for pkg := range packages {
+		applied.Packages = append(applied.Packages, pkg)
+	}
+	sort.Strings(applied.Packages)
+	if len(applied.Packages) == 0 {
+		return applied, nil
+	}
+
+	applied.Build = runFixCheck(ctx, repoRoot, "build", applied.Packages)
+	if applied.Build.Passed {
+		test := runFixCheck(ctx, repoRoot, "test", applied.Packages)
+		applied.Test = &test
+	}
+	return applied, nil
+}
+
+// runFixCheck runs go build or go test over packages. Builds are written to
+// os.DevNull so a main package leaves no executable in the repo.
+func runFixCheck(ctx context.Context, repoRoot, command string, packages []string) FixCheck {
+	args := []string{"-C", repoRoot, command}
+	if command == "build" {
+		args = append(args, "-o", os.DevNull)
+	}
+	args = append(args, packages...)
+	check := FixCheck{Command: cmdrun.Join(append([]string{"go"}, args...)...)}
+	out, err := runCommand(ctx, cmdrun.Go, "go", args...)
+	check.Passed = err == nil
+	if err != nil {
+		output := strings.TrimSpace(out.Stdout + "\n" + out.Stderr)
+		if output == "" {
+			output = err.Error()
+		}
+		check.Output = textutil.TruncateText(output, textutil.TruncateOptions{MaxLines: fixCheckMaxLines, Strategy: textutil.StrategyTail}).Text
+	}
+	return check
+}
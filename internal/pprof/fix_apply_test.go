@@ -0,0 +1,111 @@
+package pprof
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyFix(t *testing.T) {
+	repoRoot := t.TempDir()
+	files := map[string]string{
+		"go.mod":              "module myapp\n\ngo 1.21\n",
+		"codec/codec.go":      "package codec\n\nfunc Size() int { return 1 }\n",
+		"codec/codec_test.go": "package codec\n\nimport \"testing\"\n\nfunc TestSize(t *testing.T) {\n\tif Size() != 1 {\n\t\tt.Fatal(Size())\n\t}\n}\n",
+	}
+	for file, content := range files {
+		path := filepath.Join(repoRoot, filepath.FromSlash(file))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	codec := filepath.Join(repoRoot, "codec", "codec.go")
+	apply := func(modified string) *FixApplication {
+		t.Helper()
+		applied, err := applyFix(context.Background(), repoRoot, FixSuggestion{
+			FixID:         "size",
+			FilesToModify: []FixFileChange{{Path: codec, modified: modified}},
+		})
+		require.NoError(t, err)
+		return applied
+	}
+	restore := func() {
+		t.Helper()
+		require.NoError(t, os.Rename(codec+".orig", codec))
+	}
+
+	applied := apply("package codec\n\nfunc Size() int { return 2 - 1 }\n")
+	require.Equal(t, []string{codec + ".orig"}, applied.Backups)
+	require.Equal(t, []string{"./codec"}, applied.Packages)
+	require.True(t, applied.Build.Passed, applied.Build.Output)
+	require.True(t, applied.Test.Passed, applied.Test.Output)
+	backup, err := os.ReadFile(codec + ".orig")
+	require.NoError(t, err)
+	require.Equal(t, files["codec/codec.go"], string(backup))
+
+	// A backup left by an earlier apply is never overwritten.
+	_, err = applyFix(context.Background(), repoRoot, FixSuggestion{FilesToModify: []FixFileChange{{Path: codec}}})
+	require.ErrorContains(t, err, "codec.go.orig exists")
+	restore()
+
+	applied = apply("package codec\n\nfunc Size() int { return 2 }\n")
+	require.True(t, applied.Build.Passed)
+	require.False(t, applied.Test.Passed)
+	require.Contains(t, applied.Test.Output, "TestSize")
+	restore()
+
+	// Tests are not run against code that does not compile.
+	applied = apply("package codec\n\nfunc Size() int { return \"1\" }\n")
+	require.False(t, applied.Build.Passed)
+	require.Contains(t, applied.Build.Output, "codec.go:3")
+	require.Nil(t, applied.Test)
+}
+
+func TestApplyFixRollsBackFailedWrite(t *testing.T) {
+	repoRoot := t.TempDir()
+	first := filepath.Join(repoRoot, "a.go")
+	second := filepath.Join(repoRoot, "b.go")
+	require.NoError(t, os.WriteFile(first, []byte("package a // first\n"), 0o644))
+	require.NoError(t, os.WriteFile(second, []byte("package a // second\n"), 0o644))
+
+	original := writeFixFile
+	t.Cleanup(func() { writeFixFile = original })
+	writeFixFile = func(path string, data []byte, perm os.FileMode) error {
+		if path == second {
+			// Fail after truncating, as a full disk would.
+			require.NoError(t, os.WriteFile(path, nil, perm))
+			return errors.New("disk full")
+		}
+		return original(path, data, perm)
+	}
+
+	_, err := applyFix(context.Background(), repoRoot, FixSuggestion{FilesToModify: []FixFileChange{
+		{Path: first, modified: "package a // fixed\n"},
+		{Path: second, modified: "package a // fixed\n"},
+	}})
+	require.ErrorContains(t, err, "disk full")
+	for path, want := range map[string]string{first: "package a // first\n", second: "package a // second\n"} {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, want, string(data))
+		require.NoFileExists(t, path+".orig")
+	}
+}
+
+func TestApplyFixBuildLeavesNoExecutable(t *testing.T) {
+	repoRoot := t.TempDir()
+	mainFile := filepath.Join(repoRoot, "main.go")
+	require.NoError(t, os.WriteFile(filepath.Join(repoRoot, "go.mod"), []byte("module myapp\n\ngo 1.21\n"), 0o644))
+	require.NoError(t, os.WriteFile(mainFile, []byte("package main\n\nfunc main() {}\n"), 0o644))
+
+	applied, err := applyFix(context.Background(), repoRoot, FixSuggestion{FilesToModify: []FixFileChange{
+		{Path: mainFile, modified: "package main\n\nfunc main() { println() }\n"},
+	}})
+	require.NoError(t, err)
+	require.True(t, applied.Build.Passed, applied.Build.Output)
+	require.NoFileExists(t, filepath.Join(repoRoot, "myapp"))
+	require.NoFileExists(t, filepath.Join(repoRoot, "myapp.exe"))
+}
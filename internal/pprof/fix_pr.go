@@ -0,0 +1,299 @@
+package pprof
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+	"github.com/arreyder/pprof-mcp/internal/tempfiles"
+)
+
+const (
+	defaultGitHubAPI  = "https://api.github.com"
+	fixBranchPrefix   = "pprof-mcp/"
+	gitHubHTTPTimeout = 30 * time.Second
+)
+
+// FixPR opens a pull request for a suggested fix: its diff is committed on a
+// new branch off the base branch, pushed to origin, and proposed through the
+// GitHub API with the generated description.
+type FixPR struct {
+	OpenPR bool
+	// FixID picks the fix to open when more than one applies.
+	FixID string
+	// BaseBranch defaults to origin's default branch, else main.
+	BaseBranch string
+	Draft      bool
+	// EvidenceLinks are cited in the description, e.g. the Datadog
+	// profile the issue was found in.
+	EvidenceLinks []string
+	// GitHubAPI defaults to GITHUB_API_URL, else api.github.com, or the
+	// /api/v3 of a GitHub Enterprise origin.
+	GitHubAPI string
+	// GitHubToken defaults to GITHUB_TOKEN, else GH_TOKEN.
+	GitHubToken string
+}
+
+// FixPullRequest is the pull request opened for a fix.
+type FixPullRequest struct {
+	URL    string `json:"url"`
+	Number int    `json:"number"`
+	Branch string `json:"branch"`
+	Base   string `json:"base"`
+	Commit string `json:"commit"`
+	Draft  bool   `json:"draft,omitempty"`
+}
+
+// openPullRequest opens a pull request for the fix params.FixID names, or
+// the only applicable one. Failing to is a warning: the suggestions stand.
+func openPullRequest(ctx context.Context, params SuggestFixParams, result *SuggestFixResult) {
+	fix, reason := selectFix(result.ApplicableFixes, params.FixID)
+	if fix == nil {
+		if reason != "" {
+			result.Warnings = append(result.Warnings, "no pull request: "+reason)
+		}
+		return
+	}
+	pr, err := openFixPR(ctx, params, *fix, result.Analysis)
+	if err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("no pull request for %s: %v", fix.FixID, err))
+		return
+	}
+	fix.PullRequest = pr
+}
+
+// openFixPR commits fix onto the base branch without touching the checkout:
+// a scratch index is read from the base, the fixed files are written into
+// it, and the commit is pushed to a new branch. The fix is only valid if
+// every file it changes is unchanged between the checkout and the base.
+func openFixPR(ctx context.Context, params SuggestFixParams, fix FixSuggestion, analysis SuggestFixAnalysis) (*FixPullRequest, error) {
+	switch {
+	case params.RepoRoot == "":
+		return nil, fmt.Errorf("repo_root is required")
+	case fix.IsVendored:
+		return nil, fmt.Errorf("the fix changes vendored code, which needs an upstream pull request")
+	case len(fix.FilesToModify) == 0:
+		return nil, fmt.Errorf("the fix has no diff for this repo")
+	}
+	token := params.GitHubToken
+	for _, key := range []string{"GITHUB_TOKEN", "GH_TOKEN"} {
+		if token == "" {
+			token = os.Getenv(key)
+		}
+	}
+	if token == "" {
+		return nil, fmt.Errorf("set GITHUB_TOKEN or GH_TOKEN")
+	}
+
+	repo := &fixRepo{dir: params.RepoRoot}
+	remote, err := repo.git(ctx, "config", "--get", "remote.origin.url")
+	if err != nil {
+		return nil, fmt.Errorf("no origin remote: %w", err)
+	}
+	web, host, ok := remoteWebURL(remote)
+	if !ok || host != hostGitHub {
+		return nil, fmt.Errorf("origin %s is not a GitHub repository", remote)
+	}
+	webURL, _ := url.Parse(web)
+	api := params.GitHubAPI
+	switch {
+	case api != "":
+	case os.Getenv("GITHUB_API_URL") != "":
+		api = os.Getenv("GITHUB_API_URL")
+	case webURL.Host == "github.com":
+		api = defaultGitHubAPI
+	default:
+		api = "https://" + webURL.Host + "/api/v3"
+	}
+
+	base := params.BaseBranch
+	if base == "" {
+		base = "main"
+		if head, err := repo.git(ctx, "symbolic-ref", "--short", "refs/remotes/origin/HEAD"); err == nil {
+			base = strings.TrimPrefix(head, "origin/")
+		}
+	}
+	if _, err := repo.git(ctx, "fetch", "--quiet", "origin", base); err != nil {
+		return nil, err
+	}
+	baseCommit, err := repo.git(ctx, "rev-parse", "FETCH_HEAD^{commit}")
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := repo.git(ctx, "rev-parse", "--show-prefix")
+	if err != nil {
+		return nil, err
+	}
+
+	index, file, err := tempfiles.CreateTemp("", "pprof-mcp-index-*")
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+	defer index.Remove()
+	repo.env = []string{"GIT_INDEX_FILE=" + index.Path}
+	if _, err := repo.git(ctx, "read-tree", baseCommit); err != nil {
+		return nil, err
+	}
+	for _, file := range fix.FilesToModify {
+		rel, err := filepath.Rel(params.RepoRoot, file.Path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return nil, fmt.Errorf("%s is outside repo_root", file.Path)
+		}
+		rel = prefix + filepath.ToSlash(rel)
+		abs, err := filepath.Abs(file.Path)
+		if err != nil {
+			return nil, err
+		}
+		checkout, err := repo.git(ctx, "hash-object", abs)
+		if err != nil {
+			return nil, err
+		}
+		// "100644 <blob> 0\t<path>" for the base's version of the file
+		stage, err := repo.git(ctx, "ls-files", "--stage", "--", rel)
+		if err != nil {
+			return nil, err
+		}
+		entry := strings.Fields(stage)
+		if len(entry) < 2 || entry[1] != checkout {
+			return nil, fmt.Errorf("%s differs between the checkout and origin/%s: update the checkout and suggest the fix again", rel, base)
+		}
+		repo.stdin = file.modified
+		blob, err := repo.git(ctx, "hash-object", "-w", "--stdin", "--path="+rel)
+		repo.stdin = ""
+		if err != nil {
+			return nil, err
+		}
+		if _, err := repo.git(ctx, "update-index", "--cacheinfo", entry[0]+","+blob+","+rel); err != nil {
+			return nil, err
+		}
+	}
+	tree, err := repo.git(ctx, "write-tree")
+	if err != nil {
+		return nil, err
+	}
+	title := fix.Description
+	body := fixPRBody(params, fix, analysis)
+	commit, err := repo.git(ctx, "commit-tree", tree, "-p", baseCommit, "-m", title, "-m", fmt.Sprintf("Suggested by pprof-mcp suggest_fix (%s) for the %s issue.", fix.FixID, params.Issue))
+	if err != nil {
+		return nil, err
+	}
+	repo.env = nil
+	branch := fixBranchPrefix + fix.FixID + "-" + time.Now().UTC().Format("20060102-150405")
+	if _, err := repo.git(ctx, "push", "--quiet", "origin", commit+":refs/heads/"+branch); err != nil {
+		return nil, err
+	}
+
+	pr := &FixPullRequest{Branch: branch, Base: base, Commit: commit, Draft: params.Draft}
+	request := map[string]any{"title": title, "head": branch, "base": base, "body": body, "draft": params.Draft}
+	var created struct {
+		HTMLURL string `json:"html_url"`
+		Number  int    `json:"number"`
+	}
+	if err := postGitHub(ctx, strings.TrimRight(api, "/")+"/repos"+webURL.Path+"/pulls", token, request, &created); err != nil {
+		return nil, fmt.Errorf("pushed %s, but opening the pull request failed: %w", branch, err)
+	}
+	pr.URL, pr.Number = created.HTMLURL, created.Number
+	return pr, nil
+}
+
+// fixPRBody is the fix's generated description followed by the evidence
+// behind it and, unless the description covers it, the expected impact.
+func fixPRBody(params SuggestFixParams, fix FixSuggestion, analysis SuggestFixAnalysis) string {
+	var b strings.Builder
+	if fix.PRDescription != "" {
+		b.WriteString(fix.PRDescription + "\n\n")
+	} else {
+		fmt.Fprintf(&b, "## Summary\n%s\n\n", fix.Description)
+	}
+	b.WriteString("## Profile evidence\n")
+	fmt.Fprintf(&b, "- Profile `%s`: %s at %.2f%% across its top functions\n", filepath.Base(params.Profile), params.Issue, analysis.OverheadPct)
+	for _, link := range params.EvidenceLinks {
+		fmt.Fprintf(&b, "- %s\n", link)
+	}
+	if len(fix.ExpectedImpact) > 0 && !strings.Contains(strings.ToLower(fix.PRDescription), "expected impact") {
+		keys := make([]string, 0, len(fix.ExpectedImpact))
+		for key := range fix.ExpectedImpact {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		b.WriteString("\n## Expected impact\n")
+		for _, key := range keys {
+			fmt.Fprintf(&b, "- %s: %s\n", strings.ReplaceAll(key, "_", " "), fix.ExpectedImpact[key])
+		}
+	}
+	if len(fix.Considerations) > 0 {
+		b.WriteString("\n## Considerations\n")
+		for _, consideration := range fix.Considerations {
+			fmt.Fprintf(&b, "- %s\n", consideration)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// fixRepo runs git in a repo, with extra environment and stdin.
+type fixRepo struct {
+	dir   string
+	env   []string
+	stdin string
+}
+
+func (r *fixRepo) git(ctx context.Context, args ...string) (string, error) {
+	cmd, done := cmdrun.Command(ctx, cmdrun.Git, "git", append([]string{"-C", r.dir}, args...)...)
+	cmd.Env = append(os.Environ(), r.env...)
+	cmd.Stdin = strings.NewReader(r.stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := done(cmd.Run()); err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// postGitHub posts a JSON request to the GitHub REST API and decodes the
+// response into out.
+func postGitHub(ctx context.Context, endpoint, token string, request, out any) error {
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, gitHubHTTPTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("%s: %s", resp.Status, apiErr.Message)
+		}
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return json.Unmarshal(body, out)
+}
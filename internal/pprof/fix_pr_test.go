@@ -0,0 +1,103 @@
+package pprof
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenFixPR(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	origin := filepath.Join(t.TempDir(), "origin.git")
+	dir := t.TempDir()
+	git := func(args ...string) string {
+		args = append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+		out, err := exec.Command("git", args...).CombinedOutput()
+		require.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-q", "--bare", "-b", "main", origin)
+	git("init", "-q", "-b", "main")
+	git("config", "user.name", "test")
+	git("config", "user.email", "test@example.com")
+	// Fetches and pushes to the GitHub remote land in the local bare repo.
+	git("config", "url."+origin+".insteadOf", "https://github.com/acme/app.git")
+	git("remote", "add", "origin", "https://github.com/acme/app.git")
+	codec := filepath.Join(dir, "codec", "codec.go")
+	require.NoError(t, os.MkdirAll(filepath.Dir(codec), 0o755))
+	original := "package codec\n\nfunc Marshal() { protojson.Marshal(nil) }\n"
+	require.NoError(t, os.WriteFile(codec, []byte(original), 0o644))
+	git("add", "-A")
+	git("commit", "-q", "-m", "init")
+	git("push", "-q", "origin", "main")
+
+	var request map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/repos/acme/app/pulls", r.URL.Path)
+		require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"html_url": "https://github.com/acme/app/pull/7", "number": 7}`))
+	}))
+	defer server.Close()
+
+	fixed := strings.ReplaceAll(original, "protojson.", "proto.")
+	fix := FixSuggestion{
+		FixID:          "protojson_to_binary",
+		Description:    "Replace protojson with binary proto encoding",
+		ExpectedImpact: map[string]string{"cpu_reduction": "40-60%"},
+		FilesToModify:  []FixFileChange{{Path: codec, modified: fixed}},
+		PRDescription:  "## Summary\nSwitch to binary proto.",
+	}
+	params := SuggestFixParams{
+		Profile:  "/tmp/cpu.pprof",
+		Issue:    "protojson_overhead",
+		RepoRoot: dir,
+		FixPR: FixPR{
+			OpenPR:        true,
+			EvidenceLinks: []string{"https://app.datadoghq.com/profiling/abc"},
+			GitHubAPI:     server.URL,
+			GitHubToken:   "secret",
+		},
+	}
+	pr, err := openFixPR(context.Background(), params, fix, SuggestFixAnalysis{OverheadPct: 23.5})
+	require.NoError(t, err)
+	require.Equal(t, "https://github.com/acme/app/pull/7", pr.URL)
+	require.Equal(t, 7, pr.Number)
+	require.Equal(t, "main", pr.Base)
+	require.True(t, strings.HasPrefix(pr.Branch, "pprof-mcp/protojson_to_binary-"), pr.Branch)
+
+	require.Equal(t, pr.Branch, request["head"])
+	require.Equal(t, "main", request["base"])
+	require.Equal(t, fix.Description, request["title"])
+	body := request["body"].(string)
+	require.Contains(t, body, "## Summary\nSwitch to binary proto.")
+	require.Contains(t, body, "- Profile `cpu.pprof`: protojson_overhead at 23.50%")
+	require.Contains(t, body, "- https://app.datadoghq.com/profiling/abc")
+	require.Contains(t, body, "- cpu reduction: 40-60%")
+
+	// The branch carries the fix; the checkout is untouched.
+	require.Equal(t, strings.TrimSpace(fixed), git("--git-dir", origin, "show", pr.Branch+":codec/codec.go"))
+	require.Equal(t, "init", git("--git-dir", origin, "log", "-1", "--format=%s", pr.Branch+"^"))
+	require.Empty(t, git("status", "--porcelain"))
+
+	// A fix suggested against a checkout that has drifted from the base is
+	// not valid there.
+	require.NoError(t, os.WriteFile(codec, []byte(original+"// local edit\n"), 0o644))
+	_, err = openFixPR(context.Background(), params, fix, SuggestFixAnalysis{})
+	require.ErrorContains(t, err, "codec/codec.go differs between the checkout and origin/main")
+
+	fix.IsVendored = true
+	_, err = openFixPR(context.Background(), params, fix, SuggestFixAnalysis{})
+	require.ErrorContains(t, err, "upstream pull request")
+}
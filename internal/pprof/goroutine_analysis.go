@@ -2,7 +2,6 @@ package pprof
 
 import (
 	"fmt"
-	"os"
 	"sort"
 	"strings"
 
@@ -64,13 +63,7 @@ func RunGoroutineAnalysis(params GoroutineAnalysisParams) (GoroutineAnalysisResu
 		return result, fmt.Errorf("profile is required")
 	}
 
-	file, err := os.Open(params.Profile)
-	if err != nil {
-		return result, err
-	}
-	defer file.Close()
-
-	prof, err := profile.Parse(file)
+	prof, err := parseProfile(params.Profile)
 	if err != nil {
 		return result, err
 	}
@@ -261,7 +254,10 @@ func topWaitReasons(reasons map[string]*waitInfo, limit int) []GoroutineWaitReas
 		})
 	}
 	sort.Slice(items, func(i, j int) bool {
-		return items[i].Count > items[j].Count
+		if items[i].Count != items[j].Count {
+			return items[i].Count > items[j].Count
+		}
+		return items[i].Reason < items[j].Reason
 	})
 	if limit > 0 && len(items) > limit {
 		items = items[:limit]
@@ -290,7 +286,10 @@ func topLeakCandidates(leaks map[string]*leakInfo, threshold, limit int) []Gorou
 		})
 	}
 	sort.Slice(candidates, func(i, j int) bool {
-		return candidates[i].Count > candidates[j].Count
+		if candidates[i].Count != candidates[j].Count {
+			return candidates[i].Count > candidates[j].Count
+		}
+		return candidates[i].StackSignature < candidates[j].StackSignature
 	})
 	if limit > 0 && len(candidates) > limit {
 		candidates = candidates[:limit]
@@ -2,12 +2,11 @@ package pprof
 
 import (
 	"fmt"
-	"os"
+	"maps"
 	"regexp"
+	"slices"
 	"sort"
 	"strings"
-
-	"github.com/google/pprof/profile"
 )
 
 // GoroutineCategorizeParams configures goroutine categorization.
@@ -110,13 +109,7 @@ func RunGoroutineCategorize(params GoroutineCategorizeParams) (GoroutineCategori
 		return result, fmt.Errorf("profile is required")
 	}
 
-	file, err := os.Open(params.Profile)
-	if err != nil {
-		return result, err
-	}
-	defer file.Close()
-
-	prof, err := profile.Parse(file)
+	prof, err := parseProfile(params.Profile)
 	if err != nil {
 		return result, err
 	}
@@ -132,7 +125,8 @@ func RunGoroutineCategorize(params GoroutineCategorizeParams) (GoroutineCategori
 	for _, presetName := range params.Presets {
 		if preset, ok := categoryPresets[presetName]; ok {
 			result.PresetsUsed = append(result.PresetsUsed, presetName)
-			for name, pattern := range preset {
+			for _, name := range slices.Sorted(maps.Keys(preset)) {
+				pattern := preset[name]
 				re, err := regexp.Compile(pattern)
 				if err != nil {
 					result.Warnings = append(result.Warnings, fmt.Sprintf("invalid pattern for %s: %v", name, err))
@@ -149,7 +143,8 @@ func RunGoroutineCategorize(params GoroutineCategorizeParams) (GoroutineCategori
 	}
 
 	// Add custom categories (override presets if same name)
-	for name, pattern := range params.Categories {
+	for _, name := range slices.Sorted(maps.Keys(params.Categories)) {
+		pattern := params.Categories[name]
 		re, err := regexp.Compile(pattern)
 		if err != nil {
 			result.Warnings = append(result.Warnings, fmt.Sprintf("invalid pattern for %s: %v", name, err))
@@ -164,9 +159,11 @@ func RunGoroutineCategorize(params GoroutineCategorizeParams) (GoroutineCategori
 	// If no categories specified, use a sensible default
 	if len(categories) == 0 {
 		// Use all presets
-		for presetName, preset := range categoryPresets {
+		for _, presetName := range ListCategoryPresets() {
 			result.PresetsUsed = append(result.PresetsUsed, presetName)
-			for name, pattern := range preset {
+			preset := categoryPresets[presetName]
+			for _, name := range slices.Sorted(maps.Keys(preset)) {
+				pattern := preset[name]
 				re, err := regexp.Compile(pattern)
 				if err != nil {
 					continue
@@ -177,9 +174,12 @@ func RunGoroutineCategorize(params GoroutineCategorizeParams) (GoroutineCategori
 				}
 			}
 		}
-		sort.Strings(result.PresetsUsed)
 	}
 
+	// Match categories in name order so a stack that fits several always
+	// lands in the same one.
+	categoryNames := slices.Sorted(maps.Keys(categories))
+
 	sampleIndex := findSampleTypeIndex(prof, []string{"goroutine", "goroutines"})
 	uncategorizedStacks := make(map[string]int)
 
@@ -194,7 +194,8 @@ func RunGoroutineCategorize(params GoroutineCategorizeParams) (GoroutineCategori
 		stackStr := strings.Join(stack, " | ")
 
 		matched := false
-		for _, matcher := range categories {
+		for _, name := range categoryNames {
+			matcher := categories[name]
 			if matcher.re.MatchString(stackStr) {
 				matcher.count += count
 				if matcher.sampleStack == "" {
@@ -215,7 +216,8 @@ func RunGoroutineCategorize(params GoroutineCategorizeParams) (GoroutineCategori
 	}
 
 	// Build category results
-	for name, matcher := range categories {
+	for _, name := range categoryNames {
+		matcher := categories[name]
 		if matcher.count > 0 {
 			result.Categories = append(result.Categories, GoroutineCategory{
 				Name:        name,
@@ -226,7 +228,7 @@ func RunGoroutineCategorize(params GoroutineCategorizeParams) (GoroutineCategori
 			})
 		}
 	}
-	sort.Slice(result.Categories, func(i, j int) bool {
+	sort.SliceStable(result.Categories, func(i, j int) bool {
 		return result.Categories[i].Count > result.Categories[j].Count
 	})
 
@@ -238,7 +240,11 @@ func RunGoroutineCategorize(params GoroutineCategorizeParams) (GoroutineCategori
 		})
 	}
 	sort.Slice(result.TopUncategorized, func(i, j int) bool {
-		return result.TopUncategorized[i].Count > result.TopUncategorized[j].Count
+		a, b := result.TopUncategorized[i], result.TopUncategorized[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Signature < b.Signature
 	})
 	if len(result.TopUncategorized) > 10 {
 		result.TopUncategorized = result.TopUncategorized[:10]
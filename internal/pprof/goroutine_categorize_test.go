@@ -0,0 +1,35 @@
+package pprof
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoroutineCategorizeIsDeterministic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "goroutine.pprof")
+	writeTestProfile(t, path, 50, 50)
+
+	// Both categories match main.hot; the first by name always wins.
+	for i := 0; i < 20; i++ {
+		result, err := RunGoroutineCategorize(GoroutineCategorizeParams{
+			Profile:    path,
+			Categories: map[string]string{"b_hot": `main\.hot`, "a_main": `main\.`},
+		})
+		require.NoError(t, err)
+		require.Len(t, result.Categories, 1)
+		require.Equal(t, "a_main", result.Categories[0].Name)
+		require.Equal(t, 100, result.Categories[0].Count)
+	}
+
+	result, err := RunGoroutineCategorize(GoroutineCategorizeParams{
+		Profile:    path,
+		Categories: map[string]string{"none": `nomatch`},
+	})
+	require.NoError(t, err)
+	require.Len(t, result.TopUncategorized, 2)
+	// Equal counts fall back to signature order.
+	require.Equal(t, "main.cold", result.TopUncategorized[0].Signature)
+	require.Equal(t, "main.hot", result.TopUncategorized[1].Signature)
+}
@@ -0,0 +1,199 @@
+package pprof
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+	"github.com/arreyder/pprof-mcp/internal/tempfiles"
+)
+
+// graphvizLookPath finds graphviz's dot; tests replace it.
+var graphvizLookPath = exec.LookPath
+
+// GraphvizAvailable reports whether graphviz's dot is on PATH. pprof shells
+// out to it for every image format (svg, png) but not for DOT text.
+func GraphvizAvailable() bool {
+	_, err := graphvizLookPath("dot")
+	return err == nil
+}
+
+func graphvizMissingWarning(wanted, wrote, path string) string {
+	return fmt.Sprintf("graphviz (dot) not found on PATH; wrote %s to %s instead of %s. Install graphviz for %s output.", wrote, path, wanted, wanted)
+}
+
+// withExt replaces path's extension with ext (".html", ".dot").
+func withExt(path, ext string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ext
+}
+
+const (
+	// flameMinFraction drops frames narrower than this share of the total so
+	// the HTML stays small; they would be too thin to see anyway.
+	flameMinFraction = 0.001
+	flameRowPixels   = 18
+)
+
+// runHTMLFlamegraph is RunFlamegraph without graphviz: pprof applies the
+// filters and symbolization and writes the result as a profile, which is
+// drawn as a self-contained HTML flame graph next to the requested path.
+func runHTMLFlamegraph(ctx context.Context, params FlamegraphParams) (FlamegraphResult, error) {
+	tmp, file, err := tempfiles.CreateTemp("", "pprof-flame-*.pb.gz")
+	if err != nil {
+		return FlamegraphResult{}, err
+	}
+	file.Close()
+	defer tmp.Remove()
+
+	pprofArgs := []string{"tool", "pprof", "-proto", "-output", tmp.Path}
+	pprofArgs = append(pprofArgs, flamegraphFilterArgs(params)...)
+	pprofArgs = append(pprofArgs, buildProfileArgs(params.Binary, params.Profile)...)
+	output, err := runCommand(ctx, cmdrun.Pprof, "go", pprofArgs...)
+	if err != nil {
+		return FlamegraphResult{}, commandFailed("flamegraph", output, err)
+	}
+
+	file, err = os.Open(tmp.Path)
+	if err != nil {
+		return FlamegraphResult{}, err
+	}
+	prof, err := profile.Parse(file)
+	file.Close()
+	if err != nil {
+		return FlamegraphResult{}, &ParseError{Op: "flamegraph", Command: output.Command, Err: err}
+	}
+	valueIndex, err := prof.SampleIndexByName(params.SampleIndex)
+	if err != nil {
+		return FlamegraphResult{}, err
+	}
+
+	outputPath := withExt(params.OutputPath, ".html")
+	page := renderFlameHTML(filepath.Base(params.Profile), prof.SampleType[valueIndex], buildFlameTree(prof, valueIndex))
+	if err := os.WriteFile(outputPath, []byte(page), 0o644); err != nil {
+		return FlamegraphResult{}, err
+	}
+	return FlamegraphResult{
+		Command:    cmdrun.Join(append([]string{"go"}, pprofArgs...)...),
+		OutputPath: outputPath,
+		Format:     "html",
+		Message:    fmt.Sprintf("Flamegraph HTML written to %s", outputPath),
+		Warnings:   []string{graphvizMissingWarning("SVG", "an HTML flame graph", outputPath)},
+		Stderr:     output.Stderr,
+		StderrMeta: output.StderrMeta,
+	}, nil
+}
+
+type flameNode struct {
+	name     string
+	value    int64
+	children map[string]*flameNode
+}
+
+func (n *flameNode) child(name string) *flameNode {
+	if n.children == nil {
+		n.children = map[string]*flameNode{}
+	}
+	c := n.children[name]
+	if c == nil {
+		c = &flameNode{name: name}
+		n.children[name] = c
+	}
+	return c
+}
+
+// buildFlameTree merges the sample stacks, root first, summing the value at
+// valueIndex. Inlined frames are expanded into frames of their own.
+func buildFlameTree(prof *profile.Profile, valueIndex int) *flameNode {
+	root := &flameNode{name: "root"}
+	for _, sample := range prof.Sample {
+		if valueIndex >= len(sample.Value) || sample.Value[valueIndex] <= 0 {
+			continue
+		}
+		value := sample.Value[valueIndex]
+		root.value += value
+		node := root
+		for i := len(sample.Location) - 1; i >= 0; i-- {
+			loc := sample.Location[i]
+			if len(loc.Line) == 0 {
+				node = node.child(fmt.Sprintf("0x%x", loc.Address))
+				node.value += value
+				continue
+			}
+			for j := len(loc.Line) - 1; j >= 0; j-- {
+				name := fmt.Sprintf("0x%x", loc.Address)
+				if fn := loc.Line[j].Function; fn != nil && fn.Name != "" {
+					name = fn.Name
+				}
+				node = node.child(name)
+				node.value += value
+			}
+		}
+	}
+	return root
+}
+
+func renderFlameHTML(title string, sampleType *profile.ValueType, root *flameNode) string {
+	var frames strings.Builder
+	depth := 0
+	if root.value > 0 {
+		depth = writeFlameFrames(&frames, root, root.value, sampleType.Unit, 0, 0)
+	}
+	heading := fmt.Sprintf("%s: %s", title, sampleType.Type)
+
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>")
+	b.WriteString(html.EscapeString(heading))
+	b.WriteString("</title>\n<style>\n")
+	b.WriteString("body{font:12px sans-serif;margin:8px}\n")
+	fmt.Fprintf(&b, "#flame{position:relative;height:%dpx}\n", (depth+1)*flameRowPixels)
+	fmt.Fprintf(&b, ".f{position:absolute;height:%dpx;line-height:%dpx;box-sizing:border-box;border:1px solid #fff;padding:0 2px;overflow:hidden;white-space:nowrap}\n", flameRowPixels, flameRowPixels-2)
+	b.WriteString(".f:hover{filter:brightness(85%)}\n")
+	b.WriteString("</style></head><body>\n<h3>")
+	b.WriteString(html.EscapeString(heading))
+	fmt.Fprintf(&b, "</h3>\n<p>Total %d %s. Frame width is its share of the total; hover a frame for its value.</p>\n<div id=\"flame\">\n",
+		root.value, html.EscapeString(sampleType.Unit))
+	b.WriteString(frames.String())
+	b.WriteString("</div>\n</body></html>\n")
+	return b.String()
+}
+
+// writeFlameFrames writes node and its descendants as positioned divs and
+// returns the deepest row written. Children are laid out alphabetically.
+func writeFlameFrames(b *strings.Builder, node *flameNode, total int64, unit string, row int, offset int64) int {
+	left := float64(offset) / float64(total) * 100
+	width := float64(node.value) / float64(total) * 100
+	label := html.EscapeString(node.name)
+	fmt.Fprintf(b, "<div class=\"f\" style=\"left:%.4f%%;width:%.4f%%;top:%dpx;background:hsl(%d,75%%,65%%)\" title=\"%s: %d %s (%.2f%%)\">%s</div>\n",
+		left, width, row*flameRowPixels, flameHue(node.name), label, node.value, html.EscapeString(unit), width, label)
+
+	names := make([]string, 0, len(node.children))
+	for name := range node.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	deepest := row
+	for _, name := range names {
+		c := node.children[name]
+		if float64(c.value)/float64(total) >= flameMinFraction {
+			deepest = max(deepest, writeFlameFrames(b, c, total, unit, row+1, offset))
+		}
+		offset += c.value
+	}
+	return deepest
+}
+
+// flameHue gives each function a stable warm color.
+func flameHue(name string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return int(h.Sum32() % 50)
+}
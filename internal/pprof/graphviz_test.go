@@ -0,0 +1,67 @@
+package pprof
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func withoutGraphviz(t *testing.T) {
+	t.Helper()
+	orig := graphvizLookPath
+	graphvizLookPath = func(string) (string, error) { return "", errors.New("not found") }
+	t.Cleanup(func() { graphvizLookPath = orig })
+}
+
+func TestRenderWithoutGraphviz(t *testing.T) {
+	withoutGraphviz(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cpu.pprof")
+	writeTestProfile(t, path, 70, 30)
+
+	flame, err := RunFlamegraph(context.Background(), FlamegraphParams{
+		Profile:    path,
+		OutputPath: filepath.Join(dir, "cpu.flame.svg"),
+		Focus:      "hot",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "html", flame.Format)
+	require.Equal(t, filepath.Join(dir, "cpu.flame.html"), flame.OutputPath)
+	require.Len(t, flame.Warnings, 1)
+	require.Contains(t, flame.Warnings[0], "graphviz")
+	page, err := os.ReadFile(flame.OutputPath)
+	require.NoError(t, err)
+	require.Contains(t, string(page), "main.hot: 70 count (100.00%)")
+	require.NotContains(t, string(page), "main.cold")
+
+	graph, err := RunCallgraph(context.Background(), CallgraphParams{
+		Profile:    path,
+		OutputPath: filepath.Join(dir, "cpu.callgraph.svg"),
+		Format:     "svg",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "dot", graph.Format)
+	require.Equal(t, filepath.Join(dir, "cpu.callgraph.dot"), graph.OutputPath)
+	require.Len(t, graph.Warnings, 1)
+	require.Contains(t, graph.Warnings[0], "dot -Tsvg")
+	dot, err := os.ReadFile(graph.OutputPath)
+	require.NoError(t, err)
+	require.Contains(t, string(dot), "digraph")
+}
+
+func TestBuildFlameTree(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cpu.pprof")
+	writeTestProfile(t, path, 70, 30)
+	prof, err := LoadProfile(path)
+	require.NoError(t, err)
+
+	root := buildFlameTree(prof, 0)
+	require.EqualValues(t, 100, root.value)
+	require.Len(t, root.children, 2)
+	require.EqualValues(t, 70, root.children["main.hot"].value)
+}
@@ -2,24 +2,15 @@ package pprof
 
 import (
 	"fmt"
-	"os"
 	"sort"
 	"strings"
-
-	"github.com/google/pprof/profile"
 )
 
 // GenerateProfileHints generates contextual hints based on profile type and analysis.
 func GenerateProfileHints(profilePath string, usedSampleIndex string) []string {
 	hints := []string{}
 
-	file, err := os.Open(profilePath)
-	if err != nil {
-		return hints
-	}
-	defer file.Close()
-
-	prof, err := profile.Parse(file)
+	prof, err := parseProfile(profilePath)
 	if err != nil {
 		return hints
 	}
@@ -3,6 +3,10 @@ package pprof
 import (
 	"context"
 	"fmt"
+	"slices"
+
+	"github.com/arreyder/pprof-mcp/internal/parallel"
+	"github.com/google/pprof/profile"
 )
 
 const defaultHotspotCount = 5
@@ -10,6 +14,9 @@ const defaultHotspotCount = 5
 type HotspotSummaryParams struct {
 	Profiles  map[string]string
 	NodeCount int
+	// RepoRoot, when it has a CODEOWNERS file, attributes hotspots and CPU
+	// to their owners.
+	RepoRoot string
 }
 
 type HotspotSummaryResult struct {
@@ -17,7 +24,12 @@ type HotspotSummaryResult struct {
 	HeapTop5       []HeapHotspot  `json:"heap_top5,omitempty"`
 	MutexTop5      []MutexHotspot `json:"mutex_top5,omitempty"`
 	GoroutineCount *int           `json:"goroutine_count,omitempty"`
-	Warnings       []string       `json:"warnings,omitempty"`
+	// CPUByOwner splits CPU across CODEOWNERS, each sample going to the
+	// owners of its innermost frame in the repo.
+	CPUByOwner []OwnerShare `json:"cpu_by_owner,omitempty"`
+	// CodeOwners is the CODEOWNERS file the owners came from.
+	CodeOwners string   `json:"codeowners,omitempty"`
+	Warnings   []string `json:"warnings,omitempty"`
 }
 
 func RunHotspotSummary(ctx context.Context, params HotspotSummaryParams) (HotspotSummaryResult, error) {
@@ -36,59 +48,173 @@ func RunHotspotSummary(ctx context.Context, params HotspotSummaryParams) (Hotspo
 		nodeCount = defaultHotspotCount
 	}
 
-	if cpuPath := params.Profiles["cpu"]; cpuPath != "" {
-		cpuTop, warn := runTopMetrics(ctx, cpuPath, nodeCount, "")
-		if warn != "" {
-			result.Warnings = append(result.Warnings, warn)
-		}
-		result.CPUTop5 = topCPUHotspots(cpuTop)
-	} else {
-		result.Warnings = append(result.Warnings, "cpu profile missing from bundle")
+	// Each profile kind is summarized concurrently into its own part, and
+	// the parts are merged in a fixed order so warnings read the same on
+	// every run.
+	sections := []func(ctx context.Context, params HotspotSummaryParams, nodeCount int, part *HotspotSummaryResult){
+		summarizeCPU, summarizeHeap, summarizeMutex, summarizeGoroutines,
+	}
+	parts, err := parallel.Map(ctx, len(sections), 0, func(ctx context.Context, i int) (*HotspotSummaryResult, error) {
+		part := &HotspotSummaryResult{}
+		sections[i](ctx, params, nodeCount, part)
+		return part, nil
+	})
+	if err != nil {
+		return result, err
 	}
+	for _, part := range parts {
+		result.merge(part)
+	}
+	return result, nil
+}
 
-	if heapPath := params.Profiles["heap"]; heapPath != "" {
-		heapIndex, warn := pickHeapSampleIndex(heapPath)
-		if warn != "" {
-			result.Warnings = append(result.Warnings, warn)
+func summarizeCPU(ctx context.Context, params HotspotSummaryParams, nodeCount int, part *HotspotSummaryResult) {
+	cpuPath := params.Profiles["cpu"]
+	if cpuPath == "" {
+		part.Warnings = append(part.Warnings, "cpu profile missing from bundle")
+		return
+	}
+	cpuTop, warn := runTopMetrics(ctx, cpuPath, nodeCount, "")
+	if warn != "" {
+		part.Warnings = append(part.Warnings, warn)
+	}
+	part.CPUTop5 = topCPUHotspots(cpuTop)
+	if owned := part.owned(cpuPath, "", params.RepoRoot); owned != nil {
+		for i := range part.CPUTop5 {
+			part.CPUTop5[i].Owners = owned.functionOwners(part.CPUTop5[i].Function)
 		}
-		heapTop, warn := runTopMetrics(ctx, heapPath, nodeCount, heapIndex)
-		if warn != "" {
-			result.Warnings = append(result.Warnings, warn)
+		part.CPUByOwner = owned.attribution.ownerShares()
+	}
+}
+
+func summarizeHeap(ctx context.Context, params HotspotSummaryParams, nodeCount int, part *HotspotSummaryResult) {
+	heapPath := params.Profiles["heap"]
+	if heapPath == "" {
+		part.Warnings = append(part.Warnings, "heap profile missing from bundle")
+		return
+	}
+	heapIndex, warn := pickHeapSampleIndex(heapPath)
+	if warn != "" {
+		part.Warnings = append(part.Warnings, warn)
+	}
+	heapTop, warn := runTopMetrics(ctx, heapPath, nodeCount, heapIndex)
+	if warn != "" {
+		part.Warnings = append(part.Warnings, warn)
+	}
+	part.HeapTop5 = topHeapHotspots(heapTop)
+	if owned := part.owned(heapPath, heapIndex, params.RepoRoot); owned != nil {
+		for i := range part.HeapTop5 {
+			part.HeapTop5[i].Owners = owned.functionOwners(part.HeapTop5[i].Function)
 		}
-		result.HeapTop5 = topHeapHotspots(heapTop)
-	} else {
-		result.Warnings = append(result.Warnings, "heap profile missing from bundle")
 	}
+}
 
+func summarizeMutex(ctx context.Context, params HotspotSummaryParams, nodeCount int, part *HotspotSummaryResult) {
 	mutexPath := params.Profiles["mutex"]
 	if mutexPath == "" {
 		mutexPath = params.Profiles["block"]
 	}
-	if mutexPath != "" {
-		mutexIndex, warn := pickMutexSampleIndex(mutexPath)
-		if warn != "" {
-			result.Warnings = append(result.Warnings, warn)
-		}
-		mutexTop, warn := runTopMetrics(ctx, mutexPath, nodeCount, mutexIndex)
-		if warn != "" {
-			result.Warnings = append(result.Warnings, warn)
+	if mutexPath == "" {
+		part.Warnings = append(part.Warnings, "mutex/block profile missing from bundle")
+		return
+	}
+	mutexIndex, warn := pickMutexSampleIndex(mutexPath)
+	if warn != "" {
+		part.Warnings = append(part.Warnings, warn)
+	}
+	mutexTop, warn := runTopMetrics(ctx, mutexPath, nodeCount, mutexIndex)
+	if warn != "" {
+		part.Warnings = append(part.Warnings, warn)
+	}
+	part.MutexTop5 = topMutexHotspots(mutexTop)
+	if owned := part.owned(mutexPath, mutexIndex, params.RepoRoot); owned != nil {
+		for i := range part.MutexTop5 {
+			part.MutexTop5[i].Owners = owned.functionOwners(part.MutexTop5[i].Function)
 		}
-		result.MutexTop5 = topMutexHotspots(mutexTop)
-	} else {
-		result.Warnings = append(result.Warnings, "mutex/block profile missing from bundle")
-	}
-
-	if goroutinePath := params.Profiles["goroutines"]; goroutinePath != "" {
-		analysis, err := RunGoroutineAnalysis(GoroutineAnalysisParams{Profile: goroutinePath})
-		if err != nil {
-			result.Warnings = append(result.Warnings, fmt.Sprintf("goroutine analysis failed: %v", err))
-		} else {
-			count := analysis.TotalGoroutines
-			result.GoroutineCount = &count
+	}
+}
+
+func summarizeGoroutines(_ context.Context, params HotspotSummaryParams, _ int, part *HotspotSummaryResult) {
+	goroutinePath := params.Profiles["goroutines"]
+	if goroutinePath == "" {
+		return
+	}
+	analysis, err := RunGoroutineAnalysis(GoroutineAnalysisParams{Profile: goroutinePath})
+	if err != nil {
+		part.Warnings = append(part.Warnings, fmt.Sprintf("goroutine analysis failed: %v", err))
+		return
+	}
+	count := analysis.TotalGoroutines
+	part.GoroutineCount = &count
+}
+
+// merge adds a section's part to the result.
+func (result *HotspotSummaryResult) merge(part *HotspotSummaryResult) {
+	if part.CPUTop5 != nil {
+		result.CPUTop5 = part.CPUTop5
+	}
+	if part.HeapTop5 != nil {
+		result.HeapTop5 = part.HeapTop5
+	}
+	if part.MutexTop5 != nil {
+		result.MutexTop5 = part.MutexTop5
+	}
+	if part.GoroutineCount != nil {
+		result.GoroutineCount = part.GoroutineCount
+	}
+	if part.CPUByOwner != nil {
+		result.CPUByOwner = part.CPUByOwner
+	}
+	if part.CodeOwners != "" {
+		result.CodeOwners = part.CodeOwners
+	}
+	for _, warning := range part.Warnings {
+		if !slices.Contains(result.Warnings, warning) {
+			result.Warnings = append(result.Warnings, warning)
 		}
 	}
+}
 
-	return result, nil
+// ownedProfile is a profile attributed to CODEOWNERS.
+type ownedProfile struct {
+	*ownership
+	prof        *profile.Profile
+	attribution attribution
+}
+
+func (p *ownedProfile) functionOwners(name string) []string {
+	return p.ownership.functionOwners(p.prof, p.attribution, name)
+}
+
+// owned attributes the profile at path to the CODEOWNERS at repoRoot, or
+// returns nil, with a warning when repoRoot has no CODEOWNERS to use.
+func (result *HotspotSummaryResult) owned(path, sampleIndex, repoRoot string) *ownedProfile {
+	if repoRoot == "" {
+		return nil
+	}
+	prof, err := parseProfile(path)
+	if err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("owner attribution: %v", err))
+		return nil
+	}
+	var trims []string
+	for _, prefix := range InferTrimPath(prof, repoRoot).Prefixes {
+		trims = append(trims, prefix.Prefix)
+	}
+	owners, err := newOwnership(repoRoot, trims)
+	if err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("owner attribution: %v", err))
+		return nil
+	}
+	if owners == nil {
+		warning := fmt.Sprintf("no CODEOWNERS under %s; hotspots are not attributed", repoRoot)
+		if !slices.Contains(result.Warnings, warning) {
+			result.Warnings = append(result.Warnings, warning)
+		}
+		return nil
+	}
+	result.CodeOwners = owners.owners.Path
+	return &ownedProfile{ownership: owners, prof: prof, attribution: owners.attribute(prof, findSampleIndex(prof, sampleIndex))}
 }
 
 func topCPUHotspots(metrics []topMetric) []CPUHotspot {
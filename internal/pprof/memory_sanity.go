@@ -3,11 +3,16 @@ package pprof
 import (
 	"context"
 	"fmt"
-	"os/exec"
+	"path"
 	"regexp"
 	"sort"
-	"strconv"
 	"strings"
+	"sync"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/arreyder/pprof-mcp/internal/codescan"
+	"github.com/arreyder/pprof-mcp/internal/textutil"
 )
 
 type MemorySanityParams struct {
@@ -17,6 +22,9 @@ type MemorySanityParams struct {
 	Binary           string // Optional binary for symbol resolution
 	ContainerRSSMB   int    // Optional: container RSS in MB for comparison
 	RepoRoot         string // Optional: repository root for code scanning
+	// Patterns are extra code patterns the repo scan always looks for,
+	// from the config file's pattern library.
+	Patterns []PatternRule
 }
 
 type MemorySanityResult struct {
@@ -28,6 +36,9 @@ type MemorySanityResult struct {
 	Suspicions      []Suspicion    `json:"suspicions"`
 	CodeFindings    []CodeFinding  `json:"code_findings,omitempty"`
 	Recommendations []string       `json:"recommendations"`
+	// Stderr is what the pprof runs printed, kept out of the parsed output.
+	Stderr     string                `json:"-"`
+	StderrMeta textutil.TruncateMeta `json:"-"`
 }
 
 // CodeFinding represents a problematic pattern found in the codebase
@@ -38,6 +49,8 @@ type CodeFinding struct {
 	Pattern     string `json:"pattern"`
 	Snippet     string `json:"snippet,omitempty"`
 	Explanation string `json:"explanation"`
+	Severity    string `json:"severity,omitempty"`
+	Remediation string `json:"remediation,omitempty"`
 	IsVendor    bool   `json:"is_vendor"` // true if found in vendor/ directory
 }
 
@@ -61,39 +74,59 @@ func RunMemorySanity(ctx context.Context, params MemorySanityParams) (MemorySani
 		Recommendations: []string{},
 	}
 
+	// Every run's stderr is collected here rather than mixed into its output.
+	stderr := newCappedBuffer(maxStderrBytes())
+	runTop := func(profile, sampleIndex string) (CommandOutput, error) {
+		output, err := runPprofTop(ctx, profile, params.Binary, sampleIndex, 50)
+		_, _ = stderr.Write([]byte(output.Stderr))
+		return output, err
+	}
+
+	// Heap totals come from the decoded profile, not from pprof's text.
+	totals, err := heapTotals(params.HeapProfile)
+	if err != nil {
+		return result, err
+	}
+	result.HeapInUseMB = totals.inuseMB
+	result.HeapAllocMB = totals.allocMB
+	if !totals.hasAlloc {
+		result.Warnings = append(result.Warnings, "Heap profile has no alloc_space samples; allocation churn cannot be measured")
+	}
+
 	// Get heap stats (in-use memory)
-	heapTop, err := runPprofTop(ctx, params.HeapProfile, params.Binary, "inuse_space", 50)
+	heapOutput, err := runTop(params.HeapProfile, "inuse_space")
 	if err != nil {
 		return result, fmt.Errorf("failed to get heap top: %w", err)
 	}
+	heapTop := heapOutput.Stdout
 
 	// Get allocation stats (total allocations) - critical for detecting high-churn patterns
-	allocTop, err := runPprofTop(ctx, params.HeapProfile, params.Binary, "alloc_space", 50)
+	allocOutput, err := runTop(params.HeapProfile, "alloc_space")
+	allocTop := allocOutput.Stdout
 	if err != nil {
 		// Non-fatal - continue with just inuse analysis
-		result.Warnings = append(result.Warnings, "Could not analyze alloc_space")
+		result.Warnings = append(result.Warnings, fmt.Sprintf("Could not analyze alloc_space: %v", err))
 		allocTop = ""
 	}
 
 	// Get CPU profile data if provided - used to confirm off-heap allocations
 	cpuTop := ""
 	if params.CPUProfile != "" {
-		cpuTop, err = runPprofTop(ctx, params.CPUProfile, params.Binary, "", 50)
+		cpuOutput, err := runTop(params.CPUProfile, "")
+		cpuTop = cpuOutput.Stdout
 		if err != nil {
-			result.Warnings = append(result.Warnings, "Could not analyze CPU profile")
+			result.Warnings = append(result.Warnings, fmt.Sprintf("Could not analyze CPU profile: %v", err))
 			cpuTop = ""
 		}
 	}
 
-	// Parse heap metrics
-	result.HeapInUseMB, result.HeapAllocMB = parseHeapMetrics(heapTop)
-	if allocTop != "" {
-		_, result.HeapAllocMB = parseAllocMetrics(allocTop)
-	}
-
 	// Get goroutine count if profile provided
 	if params.GoroutineProfile != "" {
-		result.GoroutineCount = countGoroutines(ctx, params.GoroutineProfile, params.Binary)
+		count, err := countGoroutines(params.GoroutineProfile)
+		if err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("Could not count goroutines: %v", err))
+		}
+		result.GoroutineCount = count
 	}
 
 	// Analyze for suspicious patterns - check heap, alloc, and CPU outputs
@@ -105,8 +138,8 @@ func RunMemorySanity(ctx context.Context, params MemorySanityParams) (MemorySani
 	analyzeRSSMismatch(params.ContainerRSSMB, result.HeapInUseMB, &result)
 
 	// Scan codebase for problematic patterns if repo_root provided
-	if params.RepoRoot != "" && len(foundCategories) > 0 {
-		result.CodeFindings = scanCodebaseForPatterns(ctx, params.RepoRoot, foundCategories)
+	if params.RepoRoot != "" && (len(foundCategories) > 0 || len(params.Patterns) > 0) {
+		result.CodeFindings = scanCodebaseForPatterns(ctx, params.RepoRoot, foundCategories, params.Patterns)
 		if len(result.CodeFindings) > 0 {
 			// Upgrade confidence if we found code evidence
 			// Prioritize non-vendor findings for confidence upgrade
@@ -144,12 +177,13 @@ func RunMemorySanity(ctx context.Context, params MemorySanityParams) (MemorySani
 
 	// Generate summary
 	result.Summary = generateSummary(&result)
+	result.Stderr, result.StderrMeta = stderr.String(), stderr.Meta()
 
 	return result, nil
 }
 
-func runPprofTop(ctx context.Context, profile, binary, sampleIndex string, nodeCount int) (string, error) {
-	args := []string{"tool", "pprof", "-top"}
+func runPprofTop(ctx context.Context, profile, binary, sampleIndex string, nodeCount int) (CommandOutput, error) {
+	args := []string{"-top"}
 	if binary != "" {
 		args = append(args, "-symbolize=force")
 	}
@@ -160,86 +194,85 @@ func runPprofTop(ctx context.Context, profile, binary, sampleIndex string, nodeC
 	if binary != "" {
 		args = append(args, binary)
 	}
-	args = append(args, profile)
+	args = append(args, pprofInputPath(profile))
 
-	cmd := exec.CommandContext(ctx, "go", args...)
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		return "", fmt.Errorf("pprof failed: %w: %s", err, string(out))
-	}
-	return string(out), nil
+	return RunTool(ctx, "top", args...)
 }
 
-func parseHeapMetrics(topOutput string) (inuseMB, allocMB float64) {
-	// Look for lines like "Total: 124.5MB" or "Total samples = 26.67GB"
-	lines := strings.Split(topOutput, "\n")
-	for _, line := range lines {
-		lowerLine := strings.ToLower(line)
-		if strings.Contains(lowerLine, "total") {
-			inuseMB = parseMemoryValue(line)
-			break
-		}
-	}
-	return inuseMB, allocMB
+type heapTotalsMB struct {
+	inuseMB  float64
+	allocMB  float64
+	hasAlloc bool
 }
 
-func parseAllocMetrics(topOutput string) (inuseMB, allocMB float64) {
-	// Look for "Total samples = X" line in alloc_space output
-	lines := strings.Split(topOutput, "\n")
-	for _, line := range lines {
-		if strings.Contains(line, "Total samples") {
-			allocMB = parseMemoryValue(line)
-			break
+// heapTotals sums the inuse_space and alloc_space samples of the heap
+// profile at path, in MB.
+func heapTotals(path string) (heapTotalsMB, error) {
+	prof, err := parseProfile(path)
+	if err != nil {
+		return heapTotalsMB{}, err
+	}
+	inuse := findSampleIndexExact(prof, "inuse_space")
+	if inuse < 0 {
+		return heapTotalsMB{}, fmt.Errorf("%s has no inuse_space samples; is it a heap profile?", path)
+	}
+	var totals heapTotalsMB
+	if totals.inuseMB, err = sampleTotalMB(prof, inuse); err != nil {
+		return heapTotalsMB{}, err
+	}
+	if alloc := findSampleIndexExact(prof, "alloc_space"); alloc >= 0 {
+		if totals.allocMB, err = sampleTotalMB(prof, alloc); err != nil {
+			return heapTotalsMB{}, err
 		}
+		totals.hasAlloc = true
 	}
-	return inuseMB, allocMB
+	return totals, nil
 }
 
-func parseMemoryValue(s string) float64 {
-	// Match patterns like "124.5MB" or "1.2GB"
-	re := regexp.MustCompile(`(\d+\.?\d*)(MB|GB|KB|B)`)
-	matches := re.FindStringSubmatch(s)
-	if len(matches) < 3 {
-		return 0
-	}
-
-	val, _ := strconv.ParseFloat(matches[1], 64)
-	switch matches[2] {
-	case "GB":
-		return val * 1024
-	case "MB":
-		return val
-	case "KB":
-		return val / 1024
-	case "B":
-		return val / (1024 * 1024)
-	}
-	return val
+// bytesPerUnit converts the memory units profiles record to bytes.
+var bytesPerUnit = map[string]float64{
+	"bytes":     1,
+	"byte":      1,
+	"kilobytes": 1 << 10,
+	"megabytes": 1 << 20,
+	"gigabytes": 1 << 30,
 }
 
-func countGoroutines(ctx context.Context, profile, binary string) int {
-	args := []string{"tool", "pprof", "-top", "-nodecount=1"}
-	if binary != "" {
-		args = append(args, binary)
+func sampleTotalMB(prof *profile.Profile, idx int) (float64, error) {
+	sampleType := prof.SampleType[idx]
+	scale, ok := bytesPerUnit[strings.ToLower(sampleType.Unit)]
+	if !ok {
+		return 0, fmt.Errorf("%s samples are in %q, not a memory unit", sampleType.Type, sampleType.Unit)
 	}
-	args = append(args, profile)
-
-	cmd := exec.CommandContext(ctx, "go", args...)
-	out, _ := cmd.CombinedOutput()
+	var total int64
+	for _, sample := range prof.Sample {
+		total += sampleValueInt64(sample, idx)
+	}
+	return float64(total) * scale / (1 << 20), nil
+}
 
-	// Parse goroutine count from output
-	lines := strings.Split(string(out), "\n")
-	for _, line := range lines {
-		if strings.Contains(line, "goroutine") {
-			re := regexp.MustCompile(`(\d+)`)
-			matches := re.FindStringSubmatch(line)
-			if len(matches) > 1 {
-				count, _ := strconv.Atoi(matches[1])
-				return count
-			}
+// countGoroutines is the number of goroutines in the goroutine profile at
+// path: the sum of its sample values.
+func countGoroutines(path string) (int, error) {
+	prof, err := parseProfile(path)
+	if err != nil {
+		return 0, err
+	}
+	idx := findSampleIndexExact(prof, "goroutine")
+	if idx < 0 {
+		idx = findSampleIndexExact(prof, "goroutines")
+	}
+	if idx < 0 {
+		if len(prof.SampleType) != 1 {
+			return 0, fmt.Errorf("%s has no goroutine samples; is it a goroutine profile?", path)
 		}
+		idx = 0
+	}
+	var count int64
+	for _, sample := range prof.Sample {
+		count += sampleValueInt64(sample, idx)
 	}
-	return 0
+	return int(count), nil
 }
 
 // offHeapPattern defines a pattern that may indicate off-heap memory allocation
@@ -605,13 +638,31 @@ func generateSummary(result *MemorySanityResult) string {
 // codePattern defines a pattern to search for in the codebase
 type codePattern struct {
 	category    string
-	pattern     string   // grep pattern (regex)
+	pattern     string   // Go regexp over source lines
 	fileGlob    string   // file pattern to search (e.g., "*.go")
 	explanation string
+	severity    string
+	remediation string
 }
 
-// scanCodebaseForPatterns searches the repo for known problematic patterns
-func scanCodebaseForPatterns(ctx context.Context, repoRoot string, categories map[string]bool) []CodeFinding {
+// PatternRule is a known problematic pattern from the config file's
+// pattern library. As a code pattern, Regex matches lines of FileGlob
+// files, default *.go; as a vendor pattern it matches the names of hot
+// functions in Package, or in any dependency when Package is empty.
+type PatternRule struct {
+	Regex       string
+	Category    string
+	Severity    string
+	Explanation string
+	Remediation string
+	Package     string
+	FileGlob    string
+}
+
+// scanCodebaseForPatterns searches the repo for known problematic patterns:
+// the built-in ones for the categories the profiles showed, and every
+// configured rule.
+func scanCodebaseForPatterns(ctx context.Context, repoRoot string, categories map[string]bool, rules []PatternRule) []CodeFinding {
 	if repoRoot == "" {
 		return nil
 	}
@@ -672,72 +723,75 @@ func scanCodebaseForPatterns(ctx context.Context, repoRoot string, categories ma
 		}...)
 	}
 
+	for _, rule := range rules {
+		fileGlob := rule.FileGlob
+		if fileGlob == "" {
+			fileGlob = "*.go"
+		}
+		patterns = append(patterns, codePattern{
+			category:    rule.Category,
+			pattern:     rule.Regex,
+			fileGlob:    fileGlob,
+			explanation: rule.Explanation,
+			severity:    rule.Severity,
+			remediation: rule.Remediation,
+		})
+	}
+
+	// One pass over the repo checks every pattern against the files its
+	// glob selects.
+	type compiledPattern struct {
+		codePattern
+		re *regexp.Regexp
+	}
+	var compiled []compiledPattern
+	var globs []string
 	for _, p := range patterns {
-		matches := grepPattern(ctx, repoRoot, p.pattern, p.fileGlob)
-		for _, m := range matches {
-			findings = append(findings, CodeFinding{
-				Category:    p.category,
-				File:        m.file,
-				Line:        m.line,
-				Pattern:     p.pattern,
-				Snippet:     m.snippet,
-				Explanation: p.explanation,
-				IsVendor:    strings.HasPrefix(m.file, "vendor/") || strings.Contains(m.file, "/vendor/"),
-			})
+		re, err := regexp.Compile(p.pattern)
+		if err != nil {
+			continue
 		}
+		compiled = append(compiled, compiledPattern{codePattern: p, re: re})
+		globs = append(globs, p.fileGlob)
+	}
+	if len(compiled) == 0 {
+		return nil
 	}
+	var mu sync.Mutex
+	_ = codescan.Scan(ctx, repoRoot, codescan.Options{Include: globs}, func(file codescan.File) {
+		name := path.Base(file.Rel)
+		for _, p := range compiled {
+			if !codescan.Included([]string{p.fileGlob}, name) {
+				continue
+			}
+			for _, m := range file.Grep(p.re) {
+				mu.Lock()
+				findings = append(findings, CodeFinding{
+					Category:    p.category,
+					File:        m.File,
+					Line:        m.Line,
+					Pattern:     p.pattern,
+					Snippet:     m.Text,
+					Explanation: p.explanation,
+					Severity:    p.severity,
+					Remediation: p.remediation,
+					IsVendor:    strings.HasPrefix(m.File, "vendor/") || strings.Contains(m.File, "/vendor/"),
+				})
+				mu.Unlock()
+			}
+		}
+	})
 
 	// Sort findings: application code first, then vendor
 	sort.Slice(findings, func(i, j int) bool {
 		if findings[i].IsVendor != findings[j].IsVendor {
 			return !findings[i].IsVendor // non-vendor (false) comes first
 		}
-		return findings[i].File < findings[j].File
+		if findings[i].File != findings[j].File {
+			return findings[i].File < findings[j].File
+		}
+		return findings[i].Line < findings[j].Line
 	})
 
 	return findings
 }
-
-type grepMatch struct {
-	file    string
-	line    int
-	snippet string
-}
-
-// grepPattern searches for a pattern in the repo using grep
-func grepPattern(ctx context.Context, repoRoot, pattern, fileGlob string) []grepMatch {
-	// Use grep -r with extended regex
-	args := []string{"-r", "-n", "-E", "--include=" + fileGlob, pattern, repoRoot}
-	cmd := exec.CommandContext(ctx, "grep", args...)
-	out, err := cmd.Output()
-	if err != nil {
-		// grep returns exit 1 if no matches - that's okay
-		return nil
-	}
-
-	var matches []grepMatch
-	lines := strings.Split(string(out), "\n")
-	for _, line := range lines {
-		if line == "" {
-			continue
-		}
-		// Parse grep output: file:line:content
-		parts := strings.SplitN(line, ":", 3)
-		if len(parts) < 3 {
-			continue
-		}
-		lineNum, _ := strconv.Atoi(parts[1])
-		// Make file path relative to repo root
-		file := parts[0]
-		if strings.HasPrefix(file, repoRoot) {
-			file = strings.TrimPrefix(file, repoRoot)
-			file = strings.TrimPrefix(file, "/")
-		}
-		matches = append(matches, grepMatch{
-			file:    file,
-			line:    lineNum,
-			snippet: strings.TrimSpace(parts[2]),
-		})
-	}
-	return matches
-}
@@ -0,0 +1,97 @@
+package pprof
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanCodebaseForPatternRules(t *testing.T) {
+	repoRoot := t.TempDir()
+	files := map[string]string{
+		"cache/cache.go":          "package cache\n\nvar c, _ = bigcache.New(ctx, cfg)\n",
+		"vendor/x/zstd/zstd.go":   "package zstd\n\nvar w, _ = zstd.NewWriter(nil)\n",
+		"cache/cache_config.yaml": "bigcache.New(\n",
+		"compress/compress.go":    "package compress\n\nvar w, _ = zstd.NewWriter(nil)\n",
+	}
+	for file, content := range files {
+		path := filepath.Join(repoRoot, filepath.FromSlash(file))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	rules := []PatternRule{{
+		Regex:       `bigcache\.New\(`,
+		Category:    "Cache",
+		Severity:    "medium",
+		Explanation: "bigcache preallocates every shard",
+		Remediation: "size shards from the working set",
+	}}
+
+	// Configured rules run whatever the profiles showed; built-in ones only
+	// for their categories.
+	findings := scanCodebaseForPatterns(context.Background(), repoRoot, map[string]bool{}, rules)
+	require.Len(t, findings, 1)
+	require.Equal(t, CodeFinding{
+		Category:    "Cache",
+		File:        "cache/cache.go",
+		Line:        3,
+		Pattern:     `bigcache\.New\(`,
+		Snippet:     "var c, _ = bigcache.New(ctx, cfg)",
+		Explanation: "bigcache preallocates every shard",
+		Severity:    "medium",
+		Remediation: "size shards from the working set",
+	}, findings[0])
+
+	findings = scanCodebaseForPatterns(context.Background(), repoRoot, map[string]bool{"Compression": true}, rules)
+	var found []string
+	for _, f := range findings {
+		found = append(found, f.File)
+	}
+	require.Equal(t, []string{"cache/cache.go", "compress/compress.go", "vendor/x/zstd/zstd.go"}, found)
+}
+
+func TestCountGoroutines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "goroutine.pprof")
+	writeTestProfile(t, path, 50, 7)
+
+	count, err := countGoroutines(path)
+	require.NoError(t, err)
+	require.Equal(t, 57, count)
+}
+
+func TestHeapTotals(t *testing.T) {
+	fn := &profile.Function{ID: 1, Name: "main.alloc"}
+	loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "alloc_objects", Unit: "count"},
+			{Type: "alloc_space", Unit: "bytes"},
+			{Type: "inuse_objects", Unit: "count"},
+			{Type: "inuse_space", Unit: "bytes"},
+		},
+		Sample: []*profile.Sample{
+			{Location: []*profile.Location{loc}, Value: []int64{10, 3 << 20, 2, 1 << 20}},
+			{Location: []*profile.Location{loc}, Value: []int64{10, 5 << 19, 2, 1 << 19}},
+		},
+		Location: []*profile.Location{loc},
+		Function: []*profile.Function{fn},
+	}
+	path := filepath.Join(t.TempDir(), "heap.pprof")
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, prof.Write(file))
+	require.NoError(t, file.Close())
+
+	totals, err := heapTotals(path)
+	require.NoError(t, err)
+	require.Equal(t, heapTotalsMB{inuseMB: 1.5, allocMB: 5.5, hasAlloc: true}, totals)
+
+	cpu := filepath.Join(t.TempDir(), "cpu.pprof")
+	writeTestProfile(t, cpu, 1, 1)
+	_, err = heapTotals(cpu)
+	require.ErrorContains(t, err, "no inuse_space samples")
+}
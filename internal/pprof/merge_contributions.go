@@ -0,0 +1,87 @@
+package pprof
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/arreyder/pprof-mcp/internal/parallel"
+	"github.com/google/pprof/profile"
+)
+
+// MergeContribution is one input's share of a merged profile.
+type MergeContribution struct {
+	Profile string  `json:"profile"`
+	Samples int     `json:"samples"`
+	Type    string  `json:"type"`
+	Total   int64   `json:"total"`
+	Pct     float64 `json:"pct"`
+}
+
+// MergeContributions totals each input for one sample type so a single
+// outlier input is visible before it skews the merged profile. Inputs that
+// cannot be read are reported as warnings.
+func MergeContributions(inputs []string, sampleIndex string) ([]MergeContribution, []string) {
+	type read struct {
+		contribution MergeContribution
+		err          error
+	}
+	reads, _ := parallel.Map(context.Background(), len(inputs), 0, func(_ context.Context, i int) (read, error) {
+		contribution, err := profileContribution(inputs[i], sampleIndex)
+		return read{contribution, err}, nil
+	})
+
+	contributions := make([]MergeContribution, 0, len(inputs))
+	var warnings []string
+	var grand int64
+	for i, r := range reads {
+		if r.err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s: %v", inputs[i], r.err))
+			continue
+		}
+		contributions = append(contributions, r.contribution)
+		grand += r.contribution.Total
+	}
+	if grand > 0 {
+		for i := range contributions {
+			contributions[i].Pct = math.Round(float64(contributions[i].Total)*10000/float64(grand)) / 100
+		}
+	}
+	return contributions, warnings
+}
+
+func profileContribution(path, sampleIndex string) (MergeContribution, error) {
+	prof, err := parseProfile(path)
+	if err != nil {
+		return MergeContribution{}, err
+	}
+	idx := contributionIndex(prof, sampleIndex)
+	if idx < 0 {
+		return MergeContribution{}, fmt.Errorf("no sample type %q", sampleIndex)
+	}
+	contribution := MergeContribution{Profile: path, Samples: len(prof.Sample), Type: prof.SampleType[idx].Type}
+	for _, sample := range prof.Sample {
+		if idx < len(sample.Value) {
+			contribution.Total += sample.Value[idx]
+		}
+	}
+	return contribution, nil
+}
+
+// contributionIndex matches pprof's choice of sample type: the requested
+// one, the profile's default, or the last.
+func contributionIndex(prof *profile.Profile, sampleIndex string) int {
+	want := sampleIndex
+	if want == "" {
+		want = prof.DefaultSampleType
+	}
+	for i, st := range prof.SampleType {
+		if st.Type == want {
+			return i
+		}
+	}
+	if sampleIndex != "" {
+		return -1
+	}
+	return len(prof.SampleType) - 1
+}
@@ -0,0 +1,31 @@
+package pprof
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeContributionsKeepInputOrder(t *testing.T) {
+	dir := t.TempDir()
+	var inputs []string
+	for i := 1; i <= 8; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("p%d.pprof", i))
+		writeTestProfile(t, path, int64(i), 0)
+		inputs = append(inputs, path)
+	}
+	missing := filepath.Join(dir, "missing.pprof")
+	inputs = append(inputs[:3], append([]string{missing}, inputs[3:]...)...)
+
+	contributions, warnings := MergeContributions(inputs, "")
+	require.Len(t, contributions, 8)
+	for i, c := range contributions {
+		require.Equal(t, filepath.Join(dir, fmt.Sprintf("p%d.pprof", i+1)), c.Profile)
+		require.Equal(t, int64(i+1), c.Total)
+	}
+	require.InDelta(t, 100*8.0/36, contributions[7].Pct, 0.01)
+	require.Len(t, warnings, 1)
+	require.Contains(t, warnings[0], missing)
+}
@@ -2,7 +2,6 @@ package pprof
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -37,13 +36,7 @@ type MetaResult struct {
 }
 
 func RunMeta(profilePath string) (MetaResult, error) {
-	file, err := os.Open(profilePath)
-	if err != nil {
-		return MetaResult{}, err
-	}
-	defer file.Close()
-
-	prof, err := profile.Parse(file)
+	prof, err := parseProfile(profilePath)
 	if err != nil {
 		return MetaResult{}, err
 	}
@@ -0,0 +1,242 @@
+package pprof
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+)
+
+// Module source statuses.
+const (
+	ModuleCached     = "cached"
+	ModuleDownloaded = "downloaded"
+	ModuleMissing    = "missing" // not in the module cache and download_modules is off
+	ModuleFailed     = "failed"
+)
+
+// ModuleSource is where a module's source was found for annotation.
+type ModuleSource struct {
+	Module  string `json:"module"`
+	Version string `json:"version"`
+	Dir     string `json:"dir,omitempty"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+}
+
+var (
+	// modCacheFile matches a file under a module cache, e.g.
+	// /go/pkg/mod/github.com/!burnt!sushi/toml@v1.2.0/decode.go.
+	modCacheFile = regexp.MustCompile(`^(.*/pkg/mod/)((?:[^/@]+/)*[^/@]+)@(v[^/]+)/(.+)$`)
+	// trimmedModuleFile matches the module@version/file form -trimpath builds
+	// record, e.g. github.com/BurntSushi/toml@v1.2.0/decode.go.
+	trimmedModuleFile = regexp.MustCompile(`^([^/@]+\.[^/@]+(?:/[^/@]+)*)@(v[^/]+)/(.+)$`)
+)
+
+// GoModCache returns the module cache directory: GOMODCACHE, else the
+// first GOPATH entry's pkg/mod, else ~/go/pkg/mod.
+func GoModCache() string {
+	if dir := os.Getenv("GOMODCACHE"); dir != "" {
+		return dir
+	}
+	gopath := filepath.SplitList(os.Getenv("GOPATH"))
+	if len(gopath) > 0 && gopath[0] != "" {
+		return filepath.Join(gopath[0], "pkg", "mod")
+	}
+	if home, err := os.UserHomeDir(); err == nil && home != "" {
+		return filepath.Join(home, "go", "pkg", "mod")
+	}
+	return ""
+}
+
+// moduleFile splits a profile's source path of a module file into the
+// prefix of the builder's module cache ("" for -trimpath builds), the
+// module path, its version, and the file within the module.
+func moduleFile(path string) (cachePrefix, module, version, rel string, ok bool) {
+	path = filepath.ToSlash(path)
+	if m := modCacheFile.FindStringSubmatch(path); m != nil {
+		return m[1], unescapeModulePath(m[2]), m[3], m[4], true
+	}
+	if m := trimmedModuleFile.FindStringSubmatch(path); m != nil {
+		return "", unescapeModulePath(m[1]), m[2], m[3], true
+	}
+	return "", "", "", "", false
+}
+
+// unescapeModulePath reverses escapeModulePath's !-encoding of capitals.
+func unescapeModulePath(value string) string {
+	var b strings.Builder
+	bang := false
+	for _, r := range value {
+		switch {
+		case bang && 'a' <= r && r <= 'z':
+			b.WriteRune(r - ('a' - 'A'))
+			bang = false
+		case r == '!':
+			bang = true
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// moduleSources finds module source in the module cache, running go mod
+// download for missing versions when download is set. Lookups are
+// memoized per module@version.
+type moduleSources struct {
+	cache    string
+	download bool
+	found    map[string]ModuleSource
+}
+
+func newModuleSources(download bool) *moduleSources {
+	return &moduleSources{cache: GoModCache(), download: download, found: map[string]ModuleSource{}}
+}
+
+// dir returns module@version's directory, or "" when it is unavailable.
+func (s *moduleSources) dir(ctx context.Context, module, version string) string {
+	return s.lookup(ctx, module, version).Dir
+}
+
+func (s *moduleSources) lookup(ctx context.Context, module, version string) ModuleSource {
+	key := module + "@" + version
+	if source, ok := s.found[key]; ok {
+		return source
+	}
+	source := ModuleSource{Module: module, Version: version, Status: ModuleMissing}
+	if s.cache != "" {
+		dir := filepath.Join(s.cache, filepath.FromSlash(escapeModulePath(module))+"@"+escapeModulePath(version))
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			source.Dir, source.Status = dir, ModuleCached
+		}
+	}
+	if source.Dir == "" && s.download {
+		dir, err := goModDownload(ctx, module, version)
+		if err != nil {
+			source.Status, source.Error = ModuleFailed, err.Error()
+		} else {
+			source.Dir, source.Status = dir, ModuleDownloaded
+		}
+	}
+	s.found[key] = source
+	return source
+}
+
+// latestCached returns the newest cached version of module, for frames
+// whose version neither the source path nor go.mod records.
+func (s *moduleSources) latestCached(module string) string {
+	if s.cache == "" {
+		return ""
+	}
+	matches, _ := filepath.Glob(filepath.Join(s.cache, filepath.FromSlash(escapeModulePath(module))+"@*"))
+	best := ""
+	for _, match := range matches {
+		if info, err := os.Stat(match); err != nil || !info.IsDir() {
+			continue
+		}
+		if best == "" || compareSemver(versionOfDir(match), versionOfDir(best)) > 0 {
+			best = match
+		}
+	}
+	return best
+}
+
+func versionOfDir(dir string) string {
+	base := filepath.Base(dir)
+	return unescapeModulePath(base[strings.LastIndex(base, "@")+1:])
+}
+
+// sources lists every lookup made, sorted by module.
+func (s *moduleSources) sources() []ModuleSource {
+	sources := make([]ModuleSource, 0, len(s.found))
+	for _, source := range s.found {
+		sources = append(sources, source)
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		if sources[i].Module != sources[j].Module {
+			return sources[i].Module < sources[j].Module
+		}
+		return sources[i].Version < sources[j].Version
+	})
+	return sources
+}
+
+// goModDownload fetches module@version into the module cache. It runs
+// outside the repo so a vendor directory or go.mod does not interfere.
+func goModDownload(ctx context.Context, module, version string) (string, error) {
+	cmd, done := cmdrun.Command(ctx, cmdrun.Go, "go", "mod", "download", "-json", module+"@"+version)
+	cmd.Dir = os.TempDir()
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GO111MODULE=on")
+	output, runErr := cmd.Output()
+	runErr = done(runErr)
+	var payload struct {
+		Dir   string
+		Error string
+	}
+	if err := json.Unmarshal(output, &payload); err != nil {
+		if runErr != nil {
+			return "", fmt.Errorf("go mod download %s@%s: %w", module, version, runErr)
+		}
+		return "", err
+	}
+	if payload.Error != "" {
+		return "", fmt.Errorf("go mod download %s@%s: %s", module, version, payload.Error)
+	}
+	if payload.Dir == "" {
+		return "", fmt.Errorf("go mod download %s@%s returned no directory", module, version)
+	}
+	return payload.Dir, nil
+}
+
+// listModuleSources prepares pprof -list for module frames of functions
+// matching function: the builders' module cache prefixes to trim so their
+// files resolve under the local module cache, and the modules involved.
+func listModuleSources(ctx context.Context, prof *profile.Profile, function string, download bool) (trims []string, cache string, sources []ModuleSource) {
+	modules := newModuleSources(download)
+	re, err := regexp.Compile(function)
+	if err != nil || prof == nil {
+		return nil, modules.cache, nil
+	}
+
+	seenTrim := map[string]bool{}
+	for _, fn := range prof.Function {
+		if fn == nil || !re.MatchString(fn.Name) || fileExists(fn.Filename) {
+			continue
+		}
+		prefix, module, version, _, ok := moduleFile(fn.Filename)
+		if !ok {
+			continue
+		}
+		modules.lookup(ctx, module, version)
+		if prefix != "" && !seenTrim[prefix] {
+			seenTrim[prefix] = true
+			trims = append(trims, prefix)
+		}
+	}
+	sort.Strings(trims)
+	return trims, modules.cache, modules.sources()
+}
+
+// missingModulesWarning explains modules whose source was not found, or
+// returns "".
+func missingModulesWarning(sources []ModuleSource) string {
+	missing := 0
+	for _, source := range sources {
+		if source.Status == ModuleMissing {
+			missing++
+		}
+	}
+	if missing == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d module(s) not in the module cache (%s); set download_modules to fetch them with go mod download", missing, GoModCache())
+}
@@ -0,0 +1,91 @@
+package pprof
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModuleFile(t *testing.T) {
+	prefix, module, version, rel, ok := moduleFile("/go/pkg/mod/github.com/!burnt!sushi/toml@v1.2.0/internal/tz.go")
+	require.True(t, ok)
+	require.Equal(t, []string{"/go/pkg/mod/", "github.com/BurntSushi/toml", "v1.2.0", "internal/tz.go"}, []string{prefix, module, version, rel})
+
+	prefix, module, version, rel, ok = moduleFile("golang.org/x/net@v0.30.0/http2/frame.go")
+	require.True(t, ok)
+	require.Equal(t, []string{"", "golang.org/x/net", "v0.30.0", "http2/frame.go"}, []string{prefix, module, version, rel})
+
+	_, _, _, _, ok = moduleFile("/xsrc/pkg/api/handler.go")
+	require.False(t, ok)
+}
+
+func TestResolveSourceFileModuleCache(t *testing.T) {
+	cache := t.TempDir()
+	t.Setenv("GOMODCACHE", cache)
+	for _, version := range []string{"v1.2.0", "v1.3.0"} {
+		dir := filepath.Join(cache, "github.com", "!burnt!sushi", "toml@"+version)
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "decode.go"), []byte("package toml\n"), 0o644))
+	}
+	repoRoot := t.TempDir()
+	modInfo := ModInfo{Versions: map[string]string{"github.com/BurntSushi/toml": "v1.3.0"}}
+	modules := newModuleSources(false)
+	ctx := context.Background()
+
+	// The version in the frame's path is what was built, whatever go.mod says.
+	frame := traceFrame{function: "github.com/BurntSushi/toml.Decode", file: "/go/pkg/mod/github.com/!burnt!sushi/toml@v1.2.0/decode.go", line: 1}
+	resolved, isVendor, module, version, err := resolveSourceFile(ctx, frame, repoRoot, nil, true, modInfo, modules)
+	require.NoError(t, err)
+	require.True(t, isVendor)
+	require.Equal(t, filepath.Join(cache, "github.com", "!burnt!sushi", "toml@v1.2.0", "decode.go"), resolved)
+	require.Equal(t, []string{"github.com/BurntSushi/toml", "v1.2.0"}, []string{module, version})
+
+	// A path without a version falls back to go.mod's.
+	frame.file = "/build/toml/decode.go"
+	resolved, _, _, version, err = resolveSourceFile(ctx, frame, repoRoot, nil, true, modInfo, modules)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(cache, "github.com", "!burnt!sushi", "toml@v1.3.0", "decode.go"), resolved)
+	require.Equal(t, "v1.3.0", version)
+
+	// A version that is not cached is reported, not fetched.
+	frame.file = "/go/pkg/mod/golang.org/x/net@v0.30.0/http2/frame.go"
+	frame.function = "golang.org/x/net/http2.(*Framer).ReadFrame"
+	_, _, _, _, err = resolveSourceFile(ctx, frame, repoRoot, nil, true, modInfo, modules)
+	require.Error(t, err)
+	require.Equal(t, []ModuleSource{
+		{Module: "github.com/BurntSushi/toml", Version: "v1.2.0", Dir: filepath.Join(cache, "github.com", "!burnt!sushi", "toml@v1.2.0"), Status: ModuleCached},
+		{Module: "github.com/BurntSushi/toml", Version: "v1.3.0", Dir: filepath.Join(cache, "github.com", "!burnt!sushi", "toml@v1.3.0"), Status: ModuleCached},
+		{Module: "golang.org/x/net", Version: "v0.30.0", Status: ModuleMissing},
+	}, modules.sources())
+	require.Contains(t, missingModulesWarning(modules.sources()), "1 module(s) not in the module cache")
+}
+
+func TestListModuleSources(t *testing.T) {
+	cache := t.TempDir()
+	t.Setenv("GOMODCACHE", cache)
+	require.NoError(t, os.MkdirAll(filepath.Join(cache, "github.com", "!burnt!sushi", "toml@v1.2.0"), 0o755))
+
+	decode := &profile.Function{ID: 1, Name: "github.com/BurntSushi/toml.Decode", Filename: "/go/pkg/mod/github.com/!burnt!sushi/toml@v1.2.0/decode.go"}
+	handler := &profile.Function{ID: 2, Name: "example.com/app/api.Handle", Filename: "/xsrc/api/handler.go"}
+	read := &profile.Function{ID: 3, Name: "golang.org/x/net/http2.(*Framer).ReadFrame", Filename: "/root/go/pkg/mod/golang.org/x/net@v0.30.0/http2/frame.go"}
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		Function:   []*profile.Function{decode, handler, read},
+		Location: []*profile.Location{
+			{ID: 1, Line: []profile.Line{{Function: decode, Line: 10}}},
+			{ID: 2, Line: []profile.Line{{Function: handler, Line: 20}}},
+			{ID: 3, Line: []profile.Line{{Function: read, Line: 30}}},
+		},
+	}
+	prof.Sample = []*profile.Sample{{Location: prof.Location, Value: []int64{1}}}
+	trims, modCache, sources := listModuleSources(context.Background(), prof, "toml|api", false)
+	require.Equal(t, []string{"/go/pkg/mod/"}, trims)
+	require.Equal(t, cache, modCache)
+	require.Equal(t, []ModuleSource{
+		{Module: "github.com/BurntSushi/toml", Version: "v1.2.0", Dir: filepath.Join(cache, "github.com", "!burnt!sushi", "toml@v1.2.0"), Status: ModuleCached},
+	}, sources)
+}
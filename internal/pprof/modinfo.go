@@ -73,6 +73,81 @@ func ParseGoMod(repoRoot string) (ModInfo, error) {
 	return info, nil
 }
 
+// RepoModulePaths lists the module paths of the Go code at repoRoot: its
+// go.mod module and, with a go.work, the module of each use directive.
+// These identify app-owned frames when no repo prefixes are given.
+func RepoModulePaths(repoRoot string) []string {
+	var paths []string
+	for _, module := range repoModules(repoRoot) {
+		paths = append(paths, module.path)
+	}
+	return paths
+}
+
+// repoModule is a Go module at a repo root
+type repoModule struct {
+	path string
+	dir  string // relative to the repo root, slash-separated; "" for the root
+}
+
+// repoModules lists the modules RepoModulePaths names, with their
+// directories
+func repoModules(repoRoot string) []repoModule {
+	seen := map[string]bool{}
+	var modules []repoModule
+	add := func(dir string) {
+		info, err := ParseGoMod(filepath.Join(repoRoot, dir))
+		if err != nil || info.ModulePath == "" || seen[info.ModulePath] {
+			return
+		}
+		seen[info.ModulePath] = true
+		if dir = filepath.ToSlash(filepath.Clean(dir)); dir == "." {
+			dir = ""
+		}
+		modules = append(modules, repoModule{path: info.ModulePath, dir: dir})
+	}
+	add(".")
+	for _, dir := range workspaceUses(repoRoot) {
+		add(dir)
+	}
+	return modules
+}
+
+// workspaceUses reads the use directives of repoRoot's go.work, in both the
+// single-line and block forms
+func workspaceUses(repoRoot string) []string {
+	content, err := os.ReadFile(filepath.Join(repoRoot, "go.work"))
+	if err != nil {
+		return nil
+	}
+	var dirs []string
+	inUse := false
+	for _, raw := range strings.Split(string(content), "\n") {
+		line := strings.TrimSpace(strings.Split(raw, "//")[0])
+		switch {
+		case line == "":
+		case inUse && strings.HasPrefix(line, ")"):
+			inUse = false
+		case inUse:
+			dirs = append(dirs, trimQuotes(line))
+		case strings.HasPrefix(line, "use ("), line == "use(":
+			inUse = true
+		case strings.HasPrefix(line, "use "):
+			dirs = append(dirs, trimQuotes(strings.TrimSpace(strings.TrimPrefix(line, "use "))))
+		}
+	}
+	return dirs
+}
+
+// resolveRepoPrefixes returns explicit prefixes when set, else the module
+// paths at repoRoot
+func resolveRepoPrefixes(explicit []string, repoRoot string) []string {
+	if len(explicit) > 0 || repoRoot == "" {
+		return explicit
+	}
+	return RepoModulePaths(repoRoot)
+}
+
 func moduleVersionForPackage(info ModInfo, packagePath string) (string, string) {
 	if packagePath == "" {
 		return "", ""
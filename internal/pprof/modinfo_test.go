@@ -0,0 +1,28 @@
+package pprof
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepoModulePaths(t *testing.T) {
+	root := t.TempDir()
+	write := func(path, content string) {
+		path = filepath.Join(root, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	write("go.mod", "module github.com/acme/platform\n\ngo 1.25\n")
+	write("go.work", "go 1.25\n\nuse (\n\t.\n\t./services/billing // billing team\n\t\"./tools\"\n)\n\nuse ./missing\n")
+	write("services/billing/go.mod", "module github.com/acme/billing\n")
+	write("tools/go.mod", "module \"github.com/acme/platform/tools\"\n")
+
+	require.Equal(t, []string{"github.com/acme/platform", "github.com/acme/billing", "github.com/acme/platform/tools"}, RepoModulePaths(root))
+	require.Empty(t, RepoModulePaths(t.TempDir()))
+
+	require.Equal(t, []string{"example.com/x"}, resolveRepoPrefixes([]string{"example.com/x"}, root))
+	require.Empty(t, resolveRepoPrefixes(nil, ""))
+}
@@ -307,7 +307,10 @@ func getTopFuncs(funcs map[string]int64, n int) []string {
 		sorted = append(sorted, funcVal{name, value})
 	}
 	sort.Slice(sorted, func(i, j int) bool {
-		return sorted[i].value > sorted[j].value
+		if sorted[i].value != sorted[j].value {
+			return sorted[i].value > sorted[j].value
+		}
+		return sorted[i].name < sorted[j].name
 	})
 
 	var result []string
@@ -0,0 +1,209 @@
+package pprof
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+)
+
+// Code hosts permalinks are rendered for.
+const (
+	hostGitHub    = "github"
+	hostGitLab    = "gitlab"
+	hostBitbucket = "bitbucket"
+)
+
+var (
+	scpRemote     = regexp.MustCompile(`^(?:[\w.-]+@)?([\w.-]+):(.+)$`)
+	pseudoVersion = regexp.MustCompile(`[-.]\d{14}-([0-9a-f]{12})(?:\+incompatible)?$`)
+)
+
+// PermalinkBase is where permalinks point.
+type PermalinkBase struct {
+	Repository string `json:"repository"` // web URL of the repo_root's origin
+	Revision   string `json:"revision"`
+	// FromHead is set when no revision was given: links point at the
+	// checkout's HEAD, which need not be the profiled commit, nor pushed.
+	FromHead bool `json:"from_head,omitempty"`
+}
+
+// permalinks renders links to the lines of profiled source on the repo's
+// code host, at the profiled commit, so results can be shared without the
+// checkout.
+type permalinks struct {
+	PermalinkBase
+	host string
+	// subdir is repo_root within the git repository, "" or ending in "/".
+	subdir   string
+	repoRoot string
+	trims    []string
+}
+
+// newPermalinks reads the origin remote of the repository at repoRoot.
+// Links point at revision, else at HEAD.
+func newPermalinks(ctx context.Context, repoRoot, revision string, trims []string) (*permalinks, error) {
+	git := func(args ...string) (string, error) {
+		out, err := runCommand(ctx, cmdrun.Git, "git", append([]string{"-C", repoRoot}, args...)...)
+		if err != nil {
+			return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(out.Stderr))
+		}
+		return strings.TrimSpace(out.Stdout), nil
+	}
+	remote, err := git("remote", "get-url", "origin")
+	if err != nil {
+		return nil, err
+	}
+	web, host, ok := remoteWebURL(remote)
+	if !ok {
+		return nil, fmt.Errorf("cannot map remote %s to a GitHub, GitLab, or Bitbucket URL", remote)
+	}
+	p := &permalinks{PermalinkBase: PermalinkBase{Repository: web, Revision: revision}, host: host, repoRoot: repoRoot, trims: trims}
+	if revision == "" {
+		if p.Revision, err = git("rev-parse", "HEAD"); err != nil {
+			return nil, err
+		}
+		p.FromHead = true
+	}
+	if p.subdir, err = git("rev-parse", "--show-prefix"); err != nil {
+		return nil, err
+	}
+	if abs, err := filepath.Abs(repoRoot); err == nil {
+		p.repoRoot = abs
+	}
+	return p, nil
+}
+
+// permalinksFor sets up permalinks for a tool's repo_root, if any. Failing
+// to is only worth a warning when a revision asked for them.
+func permalinksFor(ctx context.Context, repoRoot, revision string, trims []string) (*permalinks, string) {
+	if repoRoot == "" {
+		if revision != "" {
+			return nil, "no permalinks: revision needs repo_root, whose origin remote they link to"
+		}
+		return nil, ""
+	}
+	p, err := newPermalinks(ctx, repoRoot, revision, trims)
+	if err != nil {
+		if revision != "" {
+			return nil, fmt.Sprintf("no permalinks: %v", err)
+		}
+		return nil, ""
+	}
+	return p, ""
+}
+
+func (p *permalinks) base() *PermalinkBase {
+	if p == nil {
+		return nil
+	}
+	return &p.PermalinkBase
+}
+
+// remoteWebURL maps a git remote (https, ssh, or scp-like) to the web URL
+// of the repository and its host kind. Hosts that are not recognizably
+// GitLab or Bitbucket are taken to be GitHub (or GitHub Enterprise).
+func remoteWebURL(remote string) (string, string, bool) {
+	remote = strings.TrimSpace(remote)
+	var hostname, repoPath string
+	if strings.Contains(remote, "://") {
+		u, err := url.Parse(remote)
+		if err != nil || u.Scheme != "https" && u.Scheme != "http" && u.Scheme != "ssh" && u.Scheme != "git" {
+			return "", "", false
+		}
+		hostname, repoPath = u.Hostname(), u.Path
+	} else if m := scpRemote.FindStringSubmatch(remote); m != nil && !strings.Contains(m[1], "/") {
+		hostname, repoPath = m[1], m[2]
+	} else {
+		return "", "", false
+	}
+	repoPath = strings.TrimSuffix(strings.Trim(repoPath, "/"), ".git")
+	if hostname == "" || !strings.Contains(repoPath, "/") {
+		return "", "", false
+	}
+	host := hostGitHub
+	switch {
+	case strings.Contains(hostname, "gitlab"):
+		host = hostGitLab
+	case strings.Contains(hostname, "bitbucket"):
+		host = hostBitbucket
+	}
+	return "https://" + hostname + "/" + repoPath, host, true
+}
+
+// blobURL links to line of file at ref, in host's URL scheme.
+func blobURL(web, host, ref, file string, line int) string {
+	var link, anchor string
+	switch host {
+	case hostGitLab:
+		link, anchor = web+"/-/blob/"+ref+"/"+file, "#L"
+	case hostBitbucket:
+		link, anchor = web+"/src/"+ref+"/"+file, "#lines-"
+	default:
+		link, anchor = web+"/blob/"+ref+"/"+file, "#L"
+	}
+	if line > 0 {
+		link += fmt.Sprintf("%s%d", anchor, line)
+	}
+	return link
+}
+
+// link returns the permalink of a profile source path and line: into the
+// repo at the profiled revision, or, for a module hosted on github.com, into
+// the module's repository at its version. It returns "" for other frames,
+// such as the standard library's.
+func (p *permalinks) link(filename string, line int) string {
+	if p == nil || filename == "" {
+		return ""
+	}
+	if rel, ok := repoRelative(p.repoRoot, p.trims, filename); ok {
+		return blobURL(p.Repository, p.host, p.Revision, p.subdir+rel, line)
+	}
+	if _, module, version, rel, ok := moduleFile(filename); ok {
+		return moduleBlobURL(module, version, rel, line)
+	}
+	return ""
+}
+
+// moduleBlobURL links into a github.com module's repository: a pseudo-version
+// names its commit, a release its tag, prefixed by the module's directory
+// for modules below the repository root.
+func moduleBlobURL(module, version, rel string, line int) string {
+	parts := strings.Split(module, "/")
+	if parts[0] != "github.com" || len(parts) < 3 {
+		return ""
+	}
+	dir := strings.Join(parts[3:], "/")
+	// A /vN suffix is usually the major version of a module at the
+	// repository root, not a directory.
+	if len(parts) > 3 && isMajorVersionSuffix(parts[len(parts)-1]) {
+		dir = strings.Join(parts[3:len(parts)-1], "/")
+	}
+	ref := strings.TrimSuffix(version, "+incompatible")
+	if m := pseudoVersion.FindStringSubmatch(version); m != nil {
+		ref = m[1]
+	} else if dir != "" {
+		ref = dir + "/" + ref
+	}
+	file := rel
+	if dir != "" {
+		file = dir + "/" + rel
+	}
+	return blobURL("https://"+strings.Join(parts[:3], "/"), hostGitHub, ref, file, line)
+}
+
+func isMajorVersionSuffix(elem string) bool {
+	if len(elem) < 2 || elem[0] != 'v' {
+		return false
+	}
+	for _, r := range elem[1:] {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return elem != "v0" && elem != "v1"
+}
@@ -0,0 +1,79 @@
+package pprof
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteWebURL(t *testing.T) {
+	cases := map[string][2]string{
+		"git@github.com:acme/api.git":               {"https://github.com/acme/api", hostGitHub},
+		"https://github.com/acme/api":               {"https://github.com/acme/api", hostGitHub},
+		"ssh://git@github.example.com/acme/api.git": {"https://github.example.com/acme/api", hostGitHub},
+		"https://gitlab.com/group/sub/api.git":      {"https://gitlab.com/group/sub/api", hostGitLab},
+		"git@bitbucket.org:acme/api.git":            {"https://bitbucket.org/acme/api", hostBitbucket},
+	}
+	for remote, want := range cases {
+		web, host, ok := remoteWebURL(remote)
+		require.True(t, ok, remote)
+		require.Equal(t, want, [2]string{web, host}, remote)
+	}
+	for _, remote := range []string{"/srv/git/api.git", "file:///srv/git/api.git", "git@github.com:api"} {
+		_, _, ok := remoteWebURL(remote)
+		require.False(t, ok, remote)
+	}
+
+	require.Equal(t, "https://gitlab.com/g/api/-/blob/abc/main.go#L3", blobURL("https://gitlab.com/g/api", hostGitLab, "abc", "main.go", 3))
+	require.Equal(t, "https://bitbucket.org/a/api/src/abc/main.go#lines-3", blobURL("https://bitbucket.org/a/api", hostBitbucket, "abc", "main.go", 3))
+	require.Equal(t, "https://github.com/a/api/blob/abc/main.go", blobURL("https://github.com/a/api", hostGitHub, "abc", "main.go", 0))
+}
+
+func TestModuleBlobURL(t *testing.T) {
+	require.Equal(t, "https://github.com/acme/lib/blob/v1.2.3/codec.go#L10",
+		moduleBlobURL("github.com/acme/lib", "v1.2.3", "codec.go", 10))
+	require.Equal(t, "https://github.com/acme/lib/blob/v2.0.1/codec.go#L10",
+		moduleBlobURL("github.com/acme/lib/v2", "v2.0.1", "codec.go", 10))
+	// A nested module's tags are prefixed with its directory.
+	require.Equal(t, "https://github.com/acme/mono/blob/sdk/v0.4.0/sdk/client.go#L7",
+		moduleBlobURL("github.com/acme/mono/sdk", "v0.4.0", "client.go", 7))
+	// A pseudo-version names a commit.
+	require.Equal(t, "https://github.com/acme/lib/blob/0123456789ab/codec.go#L10",
+		moduleBlobURL("github.com/acme/lib", "v0.0.0-20240102030405-0123456789ab", "codec.go", 10))
+	require.Empty(t, moduleBlobURL("golang.org/x/sync", "v0.7.0", "errgroup/errgroup.go", 1))
+}
+
+func TestPermalinks(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	git("init", "-q")
+	git("remote", "add", "origin", "git@github.com:acme/api.git")
+	repoRoot := filepath.Join(dir, "svc")
+	require.NoError(t, os.MkdirAll(repoRoot, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(repoRoot, "main.go"), []byte("package main\n"), 0o644))
+
+	links, warning := permalinksFor(context.Background(), repoRoot, "deadbeef", []string{"/build/src"})
+	require.Empty(t, warning)
+	require.Equal(t, &PermalinkBase{Repository: "https://github.com/acme/api", Revision: "deadbeef"}, links.base())
+	require.Equal(t, "https://github.com/acme/api/blob/deadbeef/svc/main.go#L12", links.link("/build/src/main.go", 12))
+	require.Equal(t, "https://github.com/acme/lib/blob/v1.0.0/x.go#L2", links.link("/go/pkg/mod/github.com/acme/lib@v1.0.0/x.go", 2))
+	require.Empty(t, links.link("/usr/local/go/src/runtime/proc.go", 1))
+
+	// HEAD of a repo with no commits cannot be resolved: that only matters
+	// when a revision was asked for.
+	links, warning = permalinksFor(context.Background(), repoRoot, "", nil)
+	require.Nil(t, links)
+	require.Empty(t, warning)
+	_, warning = permalinksFor(context.Background(), t.TempDir(), "deadbeef", nil)
+	require.Contains(t, warning, "no permalinks")
+}
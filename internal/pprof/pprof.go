@@ -2,9 +2,13 @@ package pprof
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"path/filepath"
+	"slices"
 	"strings"
 
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
 	"github.com/arreyder/pprof-mcp/internal/pprofparse"
 	"github.com/arreyder/pprof-mcp/internal/textutil"
 )
@@ -50,8 +54,17 @@ type ListParams struct {
 	Binary      string
 	Function    string
 	RepoRoot    string
-	TrimPath    string
+	TrimPath    string   // default: inferred from the profile's paths and RepoRoot
 	SourcePaths []string // Additional source paths for vendored dependencies
+	// DownloadModules runs go mod download for listed module functions
+	// whose version is not in the module cache.
+	DownloadModules bool
+	// SnippetFormat "html" adds the listing as highlighted HTML.
+	SnippetFormat string
+
+	// trimInference is an inference already made for TrimPath, so callers
+	// listing many functions of one profile infer once.
+	trimInference *TrimPathInference
 }
 
 type ListResult struct {
@@ -60,12 +73,21 @@ type ListResult struct {
 	RawMeta    textutil.TruncateMeta `json:"raw_meta,omitempty"`
 	Stderr     string                `json:"stderr,omitempty"`
 	StderrMeta textutil.TruncateMeta `json:"stderr_meta,omitempty"`
+	// TrimPathInference is set when trim_path was inferred rather than given.
+	TrimPathInference *TrimPathInference `json:"trim_path_inference,omitempty"`
+	HTML              string             `json:"html,omitempty"` // with SnippetFormat "html"
+	// ModuleSources are the modules of listed functions, resolved in the
+	// module cache.
+	ModuleSources []ModuleSource `json:"module_sources,omitempty"`
+	Warnings      []string       `json:"warnings,omitempty"`
 }
 
 type TracesParams struct {
 	Profile string
 	Binary  string
 	Lines   int
+	// Strategy picks which lines to keep past Lines (head, tail, head_tail).
+	Strategy string
 }
 
 type TracesResult struct {
@@ -117,26 +139,41 @@ func RunTop(ctx context.Context, params TopParams) (TopResult, error) {
 	if params.SampleIndex != "" {
 		pprofArgs = append(pprofArgs, "-sample_index", params.SampleIndex)
 	}
+	// The same table of the same profile bytes is served from the cache.
+	cacheKey := strings.Join(pprofArgs[2:], "\x00") + "\x00binary=" + params.Binary
+	hash, hashErr := profileFileHash(params.Profile)
 	pprofArgs = append(pprofArgs, buildProfileArgs(params.Binary, params.Profile)...)
+	command := cmdrun.Join(append([]string{"go"}, pprofArgs...)...)
+	if hashErr == nil {
+		if top, ok := profiles().top(hash, cacheKey); ok {
+			top.Command = command
+			return top, nil
+		}
+	}
 
-	output, err := runCommand(ctx, "go", pprofArgs...)
+	output, err := runCommand(ctx, cmdrun.Pprof, "go", pprofArgs...)
 	if err != nil {
-		if noMatches := wrapNoMatches(err, output.Stderr); noMatches != nil {
-			return TopResult{}, noMatches
-		}
-		return TopResult{}, fmt.Errorf("pprof top failed: %w\n%s", err, output.Stderr)
+		return TopResult{}, commandFailed("top", output, err)
 	}
 
 	report := pprofparse.ParseTop(output.Stdout)
-	return TopResult{
-		Command:    shellJoin(append([]string{"go"}, pprofArgs...)),
+	if report.Summary.TableHeader == "" {
+		return TopResult{}, &ParseError{Op: "top", Command: command, Err: errors.New("no flat/cum table in the output")}
+	}
+	top := TopResult{
+		Command:    command,
 		Raw:        output.Stdout,
 		RawMeta:    output.StdoutMeta,
 		Stderr:     output.Stderr,
 		StderrMeta: output.StderrMeta,
 		Rows:       report.Rows,
 		Summary:    report.Summary,
-	}, nil
+	}
+	if hashErr == nil {
+		profiles().storeTop(hash, cacheKey, top)
+		top.Rows = slices.Clone(top.Rows)
+	}
+	return top, nil
 }
 
 func RunPeek(ctx context.Context, params PeekParams) (PeekResult, error) {
@@ -150,16 +187,13 @@ func RunPeek(ctx context.Context, params PeekParams) (PeekResult, error) {
 	}
 	pprofArgs = append(pprofArgs, buildProfileArgs(params.Binary, params.Profile)...)
 
-	output, err := runCommand(ctx, "go", pprofArgs...)
+	output, err := runCommand(ctx, cmdrun.Pprof, "go", pprofArgs...)
 	if err != nil {
-		if noMatches := wrapNoMatches(err, output.Stderr); noMatches != nil {
-			return PeekResult{}, noMatches
-		}
-		return PeekResult{}, fmt.Errorf("pprof peek failed: %w\n%s", err, output.Stderr)
+		return PeekResult{}, commandFailed("peek", output, err)
 	}
 
 	return PeekResult{
-		Command:    shellJoin(append([]string{"go"}, pprofArgs...)),
+		Command:    cmdrun.Join(append([]string{"go"}, pprofArgs...)...),
 		Raw:        output.Stdout,
 		RawMeta:    output.StdoutMeta,
 		Stderr:     output.Stderr,
@@ -171,44 +205,69 @@ func RunList(ctx context.Context, params ListParams) (ListResult, error) {
 	if params.Profile == "" || params.Function == "" {
 		return ListResult{}, fmt.Errorf("pprof list requires profile and function")
 	}
-	trimPath := params.TrimPath
-	if trimPath == "" {
-		trimPath = "/xsrc"
-	}
 	repoRoot := params.RepoRoot
 	if repoRoot == "" {
 		repoRoot = "."
 	}
+	prof, _ := parseProfile(params.Profile) // go tool pprof reports a bad profile
+	trimPath, inference := params.TrimPath, params.trimInference
+	if trimPath == "" && inference == nil && prof != nil {
+		inferred := InferTrimPath(prof, repoRoot)
+		inference = &inferred
+	}
+	if trimPath == "" && inference != nil {
+		trimPath = inference.TrimPath
+	}
 
-	pprofArgs := []string{"tool", "pprof", "-list", params.Function, "-trim_path", trimPath}
-
-	// Add primary source path
-	pprofArgs = append(pprofArgs, "-source_path", repoRoot)
-
-	// Add additional source paths for vendored/external dependencies
+	// Module frames carry the builder's module cache path; trimming it lets
+	// them resolve under the local module cache. pprof keeps only the last
+	// -trim_path and -source_path, so each is one path list.
+	moduleTrims, modCache, moduleSources := listModuleSources(ctx, prof, params.Function, params.DownloadModules)
+	var trimPaths []string
+	if trimPath != "" {
+		trimPaths = append(trimPaths, trimPath)
+	}
+	trimPaths = append(trimPaths, moduleTrims...)
+	sourcePaths := []string{repoRoot}
 	for _, sp := range params.SourcePaths {
 		if sp != "" {
-			pprofArgs = append(pprofArgs, "-source_path", sp)
+			sourcePaths = append(sourcePaths, sp)
 		}
 	}
+	if modCache != "" {
+		sourcePaths = append(sourcePaths, modCache)
+	}
+	pprofArgs := []string{"tool", "pprof", "-list", params.Function}
+	if len(trimPaths) > 0 {
+		pprofArgs = append(pprofArgs, "-trim_path", strings.Join(trimPaths, string(filepath.ListSeparator)))
+	}
+	pprofArgs = append(pprofArgs, "-source_path", strings.Join(sourcePaths, string(filepath.ListSeparator)))
 
 	pprofArgs = append(pprofArgs, buildProfileArgs(params.Binary, params.Profile)...)
 
-	output, err := runCommand(ctx, "go", pprofArgs...)
+	output, err := runCommand(ctx, cmdrun.Pprof, "go", pprofArgs...)
 	if err != nil {
-		if noMatches := wrapNoMatches(err, output.Stderr); noMatches != nil {
-			return ListResult{}, noMatches
-		}
-		return ListResult{}, fmt.Errorf("pprof list failed: %w\n%s", err, output.Stderr)
+		return ListResult{}, commandFailed("list", output, err)
 	}
 
-	return ListResult{
-		Command:    shellJoin(append([]string{"go"}, pprofArgs...)),
-		Raw:        output.Stdout,
-		RawMeta:    output.StdoutMeta,
-		Stderr:     output.Stderr,
-		StderrMeta: output.StderrMeta,
-	}, nil
+	result := ListResult{
+		Command:       cmdrun.Join(append([]string{"go"}, pprofArgs...)...),
+		Raw:           output.Stdout,
+		RawMeta:       output.StdoutMeta,
+		Stderr:        output.Stderr,
+		StderrMeta:    output.StderrMeta,
+		ModuleSources: moduleSources,
+	}
+	if params.TrimPath == "" {
+		result.TrimPathInference = inference
+	}
+	if params.SnippetFormat == SnippetFormatHTML {
+		result.HTML = ListHTML(output.Stdout)
+	}
+	if warning := missingModulesWarning(moduleSources); warning != "" {
+		result.Warnings = append(result.Warnings, warning)
+	}
+	return result, nil
 }
 
 func RunTracesHead(ctx context.Context, params TracesParams) (TracesResult, error) {
@@ -223,24 +282,22 @@ func RunTracesHead(ctx context.Context, params TracesParams) (TracesResult, erro
 	pprofArgs := []string{"tool", "pprof", "-traces"}
 	pprofArgs = append(pprofArgs, buildProfileArgs(params.Binary, params.Profile)...)
 
-	output, err := runCommand(ctx, "go", pprofArgs...)
+	output, err := runCommand(ctx, cmdrun.Pprof, "go", pprofArgs...)
 	if err != nil {
-		return TracesResult{}, fmt.Errorf("pprof traces failed: %w\n%s", err, output.Stderr)
+		return TracesResult{}, commandFailed("traces", output, err)
 	}
 
-	allLines := strings.Split(strings.TrimSuffix(output.Stdout, "\n"), "\n")
-	truncated := false
-	if len(allLines) > lines {
-		allLines = allLines[:lines]
-		truncated = true
-	}
+	raw, meta := textutil.ApplyLimits(output.Stdout, &output.StdoutMeta, textutil.TruncateOptions{
+		MaxLines: lines,
+		Strategy: textutil.ParseStrategy(params.Strategy),
+	})
 
 	return TracesResult{
-		Command:    shellJoin(append([]string{"go"}, pprofArgs...)),
-		Raw:        strings.Join(allLines, "\n"),
-		TotalLines: output.StdoutMeta.TotalLines,
-		Truncated:  truncated,
-		RawMeta:    output.StdoutMeta,
+		Command:    cmdrun.Join(append([]string{"go"}, pprofArgs...)...),
+		Raw:        raw,
+		TotalLines: meta.TotalLines,
+		Truncated:  meta.Truncated,
+		RawMeta:    meta,
 		Stderr:     output.Stderr,
 		StderrMeta: output.StderrMeta,
 	}, nil
@@ -288,7 +345,25 @@ func RunDiffTop(ctx context.Context, params DiffTopParams) (DiffTopResult, error
 	}, nil
 }
 
+// LargestDeltas keeps the n largest increases and n largest decreases of
+// deltas sorted by DiffTop, descending, dropping unchanged functions
+func LargestDeltas(deltas []map[string]any, n int) []map[string]any {
+	var grew, shrank []map[string]any
+	for _, delta := range deltas {
+		if value, _ := pprofparse.DeltaValue(delta); value > 0 && len(grew) < n {
+			grew = append(grew, delta)
+		}
+	}
+	for i := len(deltas) - 1; i >= 0 && len(shrank) < n; i-- {
+		if value, _ := pprofparse.DeltaValue(deltas[i]); value < 0 {
+			shrank = append([]map[string]any{deltas[i]}, shrank...)
+		}
+	}
+	return append(grew, shrank...)
+}
+
 func buildProfileArgs(binary, profile string) []string {
+	profile = pprofInputPath(profile)
 	if binary != "" {
 		return []string{binary, profile}
 	}
@@ -302,6 +377,7 @@ type TagsParams struct {
 	TagFocus    string // Regex to focus on samples with matching tags
 	TagIgnore   string // Regex to ignore samples with matching tags
 	TagShow     string // Specific tag key to show values for
+	AllTags     bool   // Show values for every tag key
 	Cum         bool
 	NodeCount   int
 	SampleIndex string
@@ -325,7 +401,7 @@ func RunTags(ctx context.Context, params TagsParams) (TagsResult, error) {
 	// Otherwise, run top with tag filters to show filtered results
 	pprofArgs := []string{"tool", "pprof"}
 
-	if params.TagShow != "" {
+	if params.TagShow != "" || params.AllTags {
 		// Use -tags to show tag information
 		pprofArgs = append(pprofArgs, "-tags")
 	} else {
@@ -350,16 +426,13 @@ func RunTags(ctx context.Context, params TagsParams) (TagsResult, error) {
 
 	pprofArgs = append(pprofArgs, buildProfileArgs(params.Binary, params.Profile)...)
 
-	output, err := runCommand(ctx, "go", pprofArgs...)
+	output, err := runCommand(ctx, cmdrun.Pprof, "go", pprofArgs...)
 	if err != nil {
-		if noMatches := wrapNoMatches(err, output.Stderr); noMatches != nil {
-			return TagsResult{}, noMatches
-		}
-		return TagsResult{}, fmt.Errorf("pprof tags failed: %w\n%s", err, output.Stderr)
+		return TagsResult{}, commandFailed("tags", output, err)
 	}
 
 	result := TagsResult{
-		Command:    shellJoin(append([]string{"go"}, pprofArgs...)),
+		Command:    cmdrun.Join(append([]string{"go"}, pprofArgs...)...),
 		Raw:        output.Stdout,
 		RawMeta:    output.StdoutMeta,
 		Stderr:     output.Stderr,
@@ -367,7 +440,7 @@ func RunTags(ctx context.Context, params TagsParams) (TagsResult, error) {
 	}
 
 	// Parse tag keys if showing tags
-	if params.TagShow != "" || (params.TagFocus == "" && params.TagIgnore == "") {
+	if params.TagShow != "" || params.AllTags || (params.TagFocus == "" && params.TagIgnore == "") {
 		result.Tags = parseTagKeys(output.Stdout)
 	}
 
@@ -405,7 +478,12 @@ type FlamegraphParams struct {
 type FlamegraphResult struct {
 	Command    string `json:"command"`
 	OutputPath string `json:"output_path"`
-	Message    string `json:"message"`
+	// Format is "svg", or "html" when graphviz is missing.
+	Format     string                `json:"format"`
+	Message    string                `json:"message"`
+	Warnings   []string              `json:"warnings,omitempty"`
+	Stderr     string                `json:"stderr,omitempty"`
+	StderrMeta textutil.TruncateMeta `json:"stderr_meta,omitempty"`
 }
 
 func RunFlamegraph(ctx context.Context, params FlamegraphParams) (FlamegraphResult, error) {
@@ -416,41 +494,50 @@ func RunFlamegraph(ctx context.Context, params FlamegraphParams) (FlamegraphResu
 		return FlamegraphResult{}, fmt.Errorf("pprof flamegraph requires output_path")
 	}
 
-	pprofArgs := []string{"tool", "pprof", "-svg", "-output", params.OutputPath}
-
-	if params.Focus != "" {
-		pprofArgs = append(pprofArgs, "-focus", params.Focus)
-	}
-	if params.Ignore != "" {
-		pprofArgs = append(pprofArgs, "-ignore", params.Ignore)
-	}
-	if params.TagFocus != "" {
-		pprofArgs = append(pprofArgs, "-tagfocus", params.TagFocus)
-	}
-	if params.TagIgnore != "" {
-		pprofArgs = append(pprofArgs, "-tagignore", params.TagIgnore)
+	if !GraphvizAvailable() {
+		return runHTMLFlamegraph(ctx, params)
 	}
+
+	pprofArgs := []string{"tool", "pprof", "-svg", "-output", params.OutputPath}
+	pprofArgs = append(pprofArgs, flamegraphFilterArgs(params)...)
 	if params.SampleIndex != "" {
 		pprofArgs = append(pprofArgs, "-sample_index", params.SampleIndex)
 	}
 
 	pprofArgs = append(pprofArgs, buildProfileArgs(params.Binary, params.Profile)...)
 
-	output, err := runCommand(ctx, "go", pprofArgs...)
+	output, err := runCommand(ctx, cmdrun.Pprof, "go", pprofArgs...)
 	if err != nil {
-		if noMatches := wrapNoMatches(err, output.Stderr); noMatches != nil {
-			return FlamegraphResult{}, noMatches
-		}
-		return FlamegraphResult{}, fmt.Errorf("pprof flamegraph failed: %w\n%s", err, output.Stderr)
+		return FlamegraphResult{}, commandFailed("flamegraph", output, err)
 	}
 
 	return FlamegraphResult{
-		Command:    shellJoin(append([]string{"go"}, pprofArgs...)),
+		Command:    cmdrun.Join(append([]string{"go"}, pprofArgs...)...),
 		OutputPath: params.OutputPath,
+		Format:     "svg",
 		Message:    fmt.Sprintf("Flamegraph SVG written to %s", params.OutputPath),
+		Stderr:     output.Stderr,
+		StderrMeta: output.StderrMeta,
 	}, nil
 }
 
+func flamegraphFilterArgs(params FlamegraphParams) []string {
+	var args []string
+	if params.Focus != "" {
+		args = append(args, "-focus", params.Focus)
+	}
+	if params.Ignore != "" {
+		args = append(args, "-ignore", params.Ignore)
+	}
+	if params.TagFocus != "" {
+		args = append(args, "-tagfocus", params.TagFocus)
+	}
+	if params.TagIgnore != "" {
+		args = append(args, "-tagignore", params.TagIgnore)
+	}
+	return args
+}
+
 // CallgraphParams for pprof.callgraph tool
 type CallgraphParams struct {
 	Profile     string
@@ -466,10 +553,13 @@ type CallgraphParams struct {
 }
 
 type CallgraphResult struct {
-	Command    string `json:"command"`
-	OutputPath string `json:"output_path"`
-	Format     string `json:"format"`
-	Message    string `json:"message"`
+	Command    string                `json:"command"`
+	OutputPath string                `json:"output_path"`
+	Format     string                `json:"format"`
+	Message    string                `json:"message"`
+	Warnings   []string              `json:"warnings,omitempty"`
+	Stderr     string                `json:"stderr,omitempty"`
+	StderrMeta textutil.TruncateMeta `json:"stderr_meta,omitempty"`
 }
 
 func RunCallgraph(ctx context.Context, params CallgraphParams) (CallgraphResult, error) {
@@ -484,8 +574,17 @@ func RunCallgraph(ctx context.Context, params CallgraphParams) (CallgraphResult,
 	if format == "" {
 		format = "dot"
 	}
+	outputPath := params.OutputPath
+	var warnings []string
+	if format != "dot" && !GraphvizAvailable() {
+		// DOT text needs no graphviz and renders to the same picture later.
+		outputPath = withExt(outputPath, ".dot")
+		warnings = append(warnings, graphvizMissingWarning(format, "DOT text", outputPath)+
+			fmt.Sprintf(" Render it with: dot -T%s %s -o %s", format, cmdrun.Quote(outputPath), cmdrun.Quote(params.OutputPath)))
+		format = "dot"
+	}
 
-	pprofArgs := []string{"tool", "pprof", "-" + format, "-output", params.OutputPath}
+	pprofArgs := []string{"tool", "pprof", "-" + format, "-output", outputPath}
 
 	if params.Focus != "" {
 		pprofArgs = append(pprofArgs, "-focus", params.Focus)
@@ -508,19 +607,19 @@ func RunCallgraph(ctx context.Context, params CallgraphParams) (CallgraphResult,
 
 	pprofArgs = append(pprofArgs, buildProfileArgs(params.Binary, params.Profile)...)
 
-	output, err := runCommand(ctx, "go", pprofArgs...)
+	output, err := runCommand(ctx, cmdrun.Pprof, "go", pprofArgs...)
 	if err != nil {
-		if noMatches := wrapNoMatches(err, output.Stderr); noMatches != nil {
-			return CallgraphResult{}, noMatches
-		}
-		return CallgraphResult{}, fmt.Errorf("pprof callgraph failed: %w\n%s", err, output.Stderr)
+		return CallgraphResult{}, commandFailed("callgraph", output, err)
 	}
 
 	return CallgraphResult{
-		Command:    shellJoin(append([]string{"go"}, pprofArgs...)),
-		OutputPath: params.OutputPath,
+		Command:    cmdrun.Join(append([]string{"go"}, pprofArgs...)...),
+		OutputPath: outputPath,
 		Format:     format,
-		Message:    fmt.Sprintf("Callgraph %s written to %s", format, params.OutputPath),
+		Message:    fmt.Sprintf("Callgraph %s written to %s", format, outputPath),
+		Warnings:   warnings,
+		Stderr:     output.Stderr,
+		StderrMeta: output.StderrMeta,
 	}, nil
 }
 
@@ -566,16 +665,13 @@ func RunFocusPaths(ctx context.Context, params FocusPathsParams) (FocusPathsResu
 
 	pprofArgs = append(pprofArgs, buildProfileArgs(params.Binary, params.Profile)...)
 
-	output, err := runCommand(ctx, "go", pprofArgs...)
+	output, err := runCommand(ctx, cmdrun.Pprof, "go", pprofArgs...)
 	if err != nil {
-		if noMatches := wrapNoMatches(err, output.Stderr); noMatches != nil {
-			return FocusPathsResult{}, noMatches
-		}
-		return FocusPathsResult{}, fmt.Errorf("pprof focus_paths failed: %w\n%s", err, output.Stderr)
+		return FocusPathsResult{}, commandFailed("focus_paths", output, err)
 	}
 
 	return FocusPathsResult{
-		Command:    shellJoin(append([]string{"go"}, pprofArgs...)),
+		Command:    cmdrun.Join(append([]string{"go"}, pprofArgs...)...),
 		Raw:        output.Stdout,
 		RawMeta:    output.StdoutMeta,
 		Stderr:     output.Stderr,
@@ -591,10 +687,12 @@ type MergeParams struct {
 }
 
 type MergeResult struct {
-	Command    string `json:"command"`
-	OutputPath string `json:"output_path"`
-	InputCount int    `json:"input_count"`
-	Message    string `json:"message"`
+	Command    string                `json:"command"`
+	OutputPath string                `json:"output_path"`
+	InputCount int                   `json:"input_count"`
+	Message    string                `json:"message"`
+	Stderr     string                `json:"stderr,omitempty"`
+	StderrMeta textutil.TruncateMeta `json:"stderr_meta,omitempty"`
 }
 
 func RunMerge(ctx context.Context, params MergeParams) (MergeResult, error) {
@@ -613,17 +711,21 @@ func RunMerge(ctx context.Context, params MergeParams) (MergeResult, error) {
 	}
 
 	// Add all profile paths
-	pprofArgs = append(pprofArgs, params.Profiles...)
+	for _, input := range params.Profiles {
+		pprofArgs = append(pprofArgs, pprofInputPath(input))
+	}
 
-	output, err := runCommand(ctx, "go", pprofArgs...)
+	output, err := runCommand(ctx, cmdrun.Pprof, "go", pprofArgs...)
 	if err != nil {
-		return MergeResult{}, fmt.Errorf("pprof merge failed: %w\n%s", err, output.Stderr)
+		return MergeResult{}, commandFailed("merge", output, err)
 	}
 
 	return MergeResult{
-		Command:    shellJoin(append([]string{"go"}, pprofArgs...)),
+		Command:    cmdrun.Join(append([]string{"go"}, pprofArgs...)...),
 		OutputPath: params.OutputPath,
 		InputCount: len(params.Profiles),
 		Message:    fmt.Sprintf("Merged %d profiles into %s", len(params.Profiles), params.OutputPath),
+		Stderr:     output.Stderr,
+		StderrMeta: output.StderrMeta,
 	}, nil
 }
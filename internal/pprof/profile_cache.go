@@ -0,0 +1,268 @@
+package pprof
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/pprof/profile"
+)
+
+// defaultProfileCacheMB bounds the parsed-profile cache unless
+// PPROF_MCP_PROFILE_CACHE_MB says otherwise; 0 turns the cache off.
+const defaultProfileCacheMB = 512
+
+// ProfileCacheStats describe the parsed-profile cache.
+type ProfileCacheStats struct {
+	Entries  int   `json:"entries"`
+	Bytes    int64 `json:"bytes"`
+	MaxBytes int64 `json:"max_bytes"`
+	Hits     int64 `json:"hits"`
+	Misses   int64 `json:"misses"`
+}
+
+// profileCache keeps parsed profiles, and the top tables computed from
+// them, keyed by the SHA-256 of the profile file, so an agent querying one
+// profile many times parses it once however its path or handle is spelled.
+// Entries are evicted least recently used first once their estimated
+// in-memory size passes maxBytes. Cached profiles are shared: callers must
+// not modify them.
+type profileCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	bytes    int64
+	lru      *list.List // of *profileEntry, most recently used first
+	entries  map[string]*list.Element
+	hits     int64
+	misses   int64
+}
+
+type profileEntry struct {
+	hash  string
+	prof  *profile.Profile
+	tops  map[string]TopResult
+	bytes int64
+}
+
+var (
+	profilesOnce sync.Once
+	profilesVal  *profileCache
+)
+
+// profiles returns the process-wide cache, sized from the environment on
+// first use.
+func profiles() *profileCache {
+	profilesOnce.Do(func() {
+		mb := int64(defaultProfileCacheMB)
+		if raw := strings.TrimSpace(os.Getenv("PPROF_MCP_PROFILE_CACHE_MB")); raw != "" {
+			if parsed, err := strconv.ParseInt(raw, 10, 64); err == nil && parsed >= 0 {
+				mb = parsed
+			}
+		}
+		profilesVal = newProfileCache(mb << 20)
+	})
+	return profilesVal
+}
+
+func newProfileCache(maxBytes int64) *profileCache {
+	return &profileCache{maxBytes: maxBytes, lru: list.New(), entries: map[string]*list.Element{}}
+}
+
+// ProfileCache reports the parsed-profile cache's size and hit rate.
+func ProfileCache() ProfileCacheStats {
+	return profiles().stats()
+}
+
+// LoadProfile parses the profile at path, or returns the copy parsed
+// earlier from identical bytes. The profile is shared and must not be
+// modified.
+func LoadProfile(path string) (*profile.Profile, error) {
+	return parseProfile(path)
+}
+
+func parseProfile(path string) (*profile.Profile, error) {
+	prof, _, err := loadLimitedProfile(path)
+	return prof, err
+}
+
+// loadLimitedProfile parses the profile at path within the profile limits,
+// through the cache, and returns it with its content hash.
+func loadLimitedProfile(path string) (*profile.Profile, string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, "", err
+	}
+	limits := currentProfileLimits()
+	cache := profiles()
+
+	if limits.maxBytes > 0 && info.Size() > limits.maxBytes {
+		hash, err := streamFileHash(path)
+		if err != nil {
+			return nil, "", err
+		}
+		prof := cache.profile(hash)
+		if prof == nil {
+			if prof, err = streamProfile(path, limits); err != nil {
+				return nil, "", err
+			}
+			cache.storeProfile(hash, prof)
+		}
+		recordLimitNote(path, prof)
+		return prof, hash, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	hash := contentHash(data)
+	prof := cache.profile(hash)
+	if prof == nil {
+		if prof, err = profile.ParseData(data); err != nil {
+			return nil, "", err
+		}
+		prof = downsampleParsed(path, prof, limits)
+		cache.storeProfile(hash, prof)
+	}
+	recordLimitNote(path, prof)
+	return prof, hash, nil
+}
+
+// profileFileHash is the cache key of the profile at path.
+func profileFileHash(path string) (string, error) {
+	return streamFileHash(path)
+}
+
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *profileCache) stats() ProfileCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ProfileCacheStats{Entries: c.lru.Len(), Bytes: c.bytes, MaxBytes: c.maxBytes, Hits: c.hits, Misses: c.misses}
+}
+
+// entry returns the entry for hash, marking it used, or nil.
+func (c *profileCache) entry(hash string) *profileEntry {
+	elem, ok := c.entries[hash]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*profileEntry)
+}
+
+func (c *profileCache) profile(hash string) *profile.Profile {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e := c.entry(hash); e != nil && e.prof != nil {
+		c.hits++
+		return e.prof
+	}
+	c.misses++
+	return nil
+}
+
+func (c *profileCache) storeProfile(hash string, prof *profile.Profile) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.entryForStore(hash)
+	if e == nil || e.prof != nil {
+		return
+	}
+	e.prof = prof
+	c.grow(e, profileBytes(prof))
+}
+
+// top returns the top table cached for hash under key, the pprof arguments
+// other than the profile.
+func (c *profileCache) top(hash, key string) (TopResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e := c.entry(hash); e != nil {
+		if top, ok := e.tops[key]; ok {
+			c.hits++
+			top.Rows = slices.Clone(top.Rows)
+			return top, true
+		}
+	}
+	c.misses++
+	return TopResult{}, false
+}
+
+func (c *profileCache) storeTop(hash, key string, top TopResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.entryForStore(hash)
+	if e == nil {
+		return
+	}
+	if _, ok := e.tops[key]; ok {
+		return
+	}
+	if e.tops == nil {
+		e.tops = map[string]TopResult{}
+	}
+	e.tops[key] = top
+	c.grow(e, topBytes(top))
+}
+
+// entryForStore returns the entry for hash, adding an empty one if needed,
+// or nil when the cache is off.
+func (c *profileCache) entryForStore(hash string) *profileEntry {
+	if c.maxBytes <= 0 {
+		return nil
+	}
+	if e := c.entry(hash); e != nil {
+		return e
+	}
+	e := &profileEntry{hash: hash}
+	c.entries[hash] = c.lru.PushFront(e)
+	return e
+}
+
+// grow charges n bytes to e and evicts from the cold end until the cache
+// fits. An entry too big to fit on its own is not kept.
+func (c *profileCache) grow(e *profileEntry, n int64) {
+	e.bytes += n
+	c.bytes += n
+	for c.bytes > c.maxBytes && c.lru.Len() > 0 {
+		victim := c.lru.Back().Value.(*profileEntry)
+		c.lru.Remove(c.entries[victim.hash])
+		delete(c.entries, victim.hash)
+		c.bytes -= victim.bytes
+	}
+}
+
+// profileBytes estimates the memory a parsed profile holds.
+func profileBytes(p *profile.Profile) int64 {
+	n := int64(256)
+	for _, s := range p.Sample {
+		n += 72 + 8*int64(len(s.Value)+len(s.Location)) + 64*int64(len(s.Label)+len(s.NumLabel))
+	}
+	for _, l := range p.Location {
+		n += 96 + 56*int64(len(l.Line))
+	}
+	for _, f := range p.Function {
+		n += 80 + int64(len(f.Name)+len(f.SystemName)+len(f.Filename))
+	}
+	for _, m := range p.Mapping {
+		n += 160 + int64(len(m.File)+len(m.BuildID))
+	}
+	return n
+}
+
+func topBytes(top TopResult) int64 {
+	n := int64(len(top.Raw) + len(top.Stderr) + len(top.Command))
+	for _, row := range top.Rows {
+		n += 160 + int64(len(row.Name))
+	}
+	return n
+}
@@ -0,0 +1,82 @@
+package pprof
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/arreyder/pprof-mcp/internal/pprofparse"
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProfileSharesIdenticalBytes(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.pprof")
+	writeTestProfile(t, first, 20, 80)
+	data, err := os.ReadFile(first)
+	require.NoError(t, err)
+	copied := filepath.Join(dir, "copy.pprof")
+	require.NoError(t, os.WriteFile(copied, data, 0o644))
+	other := filepath.Join(dir, "other.pprof")
+	writeTestProfile(t, other, 50, 50)
+
+	a, err := parseProfile(first)
+	require.NoError(t, err)
+	b, err := LoadProfile(copied)
+	require.NoError(t, err)
+	require.Same(t, a, b)
+
+	c, err := parseProfile(other)
+	require.NoError(t, err)
+	require.NotSame(t, a, c)
+
+	_, err = parseProfile(filepath.Join(dir, "missing.pprof"))
+	require.Error(t, err)
+}
+
+func TestProfileCacheEviction(t *testing.T) {
+	small := &profile.Profile{}
+	size := profileBytes(small)
+	cache := newProfileCache(2 * size)
+
+	cache.storeProfile("a", small)
+	cache.storeProfile("b", small)
+	require.Same(t, small, cache.profile("a")) // a is now the most recent
+	cache.storeProfile("c", small)             // evicts b
+
+	require.Nil(t, cache.profile("b"))
+	require.NotNil(t, cache.profile("a"))
+	require.NotNil(t, cache.profile("c"))
+	stats := cache.stats()
+	require.Equal(t, ProfileCacheStats{Entries: 2, Bytes: 2 * size, MaxBytes: 2 * size, Hits: 3, Misses: 1}, stats)
+
+	// Top tables count against the same bound and are returned as copies.
+	top := TopResult{Rows: []pprofparse.TopRow{{Name: "main.hot"}}}
+	cache.storeTop("a", "-sample_index=cpu", top)
+	got, ok := cache.top("a", "-sample_index=cpu")
+	require.True(t, ok)
+	require.Equal(t, top.Rows, got.Rows)
+	got.Rows[0].Name = "changed"
+	again, _ := cache.top("a", "-sample_index=cpu")
+	require.Equal(t, "main.hot", again.Rows[0].Name)
+	require.Nil(t, cache.profile("c"))
+
+	// An entry bigger than the whole cache is not kept.
+	huge := &profile.Profile{}
+	for i := 0; i < 100; i++ {
+		huge.Sample = append(huge.Sample, &profile.Sample{})
+	}
+	cache.storeProfile("huge", huge)
+	require.Nil(t, cache.profile("huge"))
+}
+
+func TestProfileCacheDisabled(t *testing.T) {
+	cache := newProfileCache(0)
+	cache.storeProfile("a", &profile.Profile{})
+	cache.storeTop("a", "", TopResult{})
+	require.Nil(t, cache.profile("a"))
+	_, ok := cache.top("a", "")
+	require.False(t, ok)
+	require.Equal(t, 0, cache.stats().Entries)
+}
@@ -0,0 +1,466 @@
+package pprof
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/arreyder/pprof-mcp/internal/tempfiles"
+)
+
+// Profiles past these limits are downsampled while they are read rather
+// than loaded whole, so one huge merged profile cannot exhaust the server's
+// memory. PPROF_MCP_MAX_PROFILE_MB and PPROF_MCP_MAX_PROFILE_SAMPLES
+// override them; 0 lifts a limit.
+const (
+	defaultMaxProfileMB      = 256
+	defaultMaxProfileSamples = 1_000_000
+)
+
+// limitCommentPrefix marks the comment a downsampled profile carries, so the
+// warning travels with the profile through the cache.
+const limitCommentPrefix = "pprof-mcp downsampled: "
+
+// profileLimits bound what a parsed profile may hold.
+type profileLimits struct {
+	// maxBytes is the largest profile file read whole; a bigger one is
+	// streamed, keeping at most this much decompressed data.
+	maxBytes   int64
+	maxSamples int
+}
+
+var (
+	limitsOnce sync.Once
+	limitsVal  profileLimits
+
+	limitedWriteMu sync.Mutex
+
+	limitedDirMu sync.Mutex
+	limitedDir   *tempfiles.Temp
+
+	limitNotesMu sync.Mutex
+	limitNotes   = map[string]string{} // profile path -> downsampling warning
+)
+
+func currentProfileLimits() profileLimits {
+	limitsOnce.Do(func() {
+		limitsVal = profileLimits{
+			maxBytes:   int64(readLimitEnv("PPROF_MCP_MAX_PROFILE_MB", defaultMaxProfileMB)) << 20,
+			maxSamples: readLimitEnv("PPROF_MCP_MAX_PROFILE_SAMPLES", defaultMaxProfileSamples),
+		}
+	})
+	return limitsVal
+}
+
+func readLimitEnv(key string, fallback int) int {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(raw)
+	if err != nil || parsed < 0 {
+		return fallback
+	}
+	return parsed
+}
+
+// ProfileLimitWarnings returns the downsampling warnings of the profiles at
+// paths that were over the size or sample limit when last read.
+func ProfileLimitWarnings(paths ...string) []string {
+	limitNotesMu.Lock()
+	defer limitNotesMu.Unlock()
+	var warnings []string
+	for _, path := range paths {
+		if note, ok := limitNotes[path]; ok {
+			warnings = append(warnings, note)
+		}
+	}
+	return warnings
+}
+
+// recordLimitNote remembers, for ProfileLimitWarnings, whether the profile
+// read from path was downsampled.
+func recordLimitNote(path string, prof *profile.Profile) {
+	limitNotesMu.Lock()
+	defer limitNotesMu.Unlock()
+	for _, comment := range prof.Comments {
+		if note, ok := strings.CutPrefix(comment, limitCommentPrefix); ok {
+			limitNotes[path] = note
+			return
+		}
+	}
+	delete(limitNotes, path)
+}
+
+// downsampleNote explains what downsampling did to the profile at path.
+func downsampleNote(path string, samples, stride int, why string) string {
+	return fmt.Sprintf("%s has %d samples (%s); kept every %s sample with values scaled by %d, so totals are estimates and rare stacks may be missing",
+		filepath.Base(path), samples, why, ordinal(stride), stride)
+}
+
+func ordinal(n int) string {
+	suffix := "th"
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+	case n%10 == 1:
+		suffix = "st"
+	case n%10 == 2:
+		suffix = "nd"
+	case n%10 == 3:
+		suffix = "rd"
+	}
+	return strconv.Itoa(n) + suffix
+}
+
+// downsampleParsed thins an already parsed profile to the sample limit.
+func downsampleParsed(path string, prof *profile.Profile, limits profileLimits) *profile.Profile {
+	if limits.maxSamples <= 0 || len(prof.Sample) <= limits.maxSamples {
+		return prof
+	}
+	total := len(prof.Sample)
+	stride := (total + limits.maxSamples - 1) / limits.maxSamples
+	kept := make([]*profile.Sample, 0, total/stride+1)
+	for i := 0; i < total; i += stride {
+		sample := prof.Sample[i]
+		for j := range sample.Value {
+			sample.Value[j] *= int64(stride)
+		}
+		kept = append(kept, sample)
+	}
+	prof.Sample = kept
+	prof = prof.Compact()
+	why := fmt.Sprintf("over PPROF_MCP_MAX_PROFILE_SAMPLES=%d", limits.maxSamples)
+	prof.Comments = append(prof.Comments, limitCommentPrefix+downsampleNote(path, total, stride, why))
+	return prof
+}
+
+// streamProfile reads a profile file too big to load whole. A first pass
+// over the decompressed protobuf counts its samples; a second keeps every
+// stride-th sample, its values scaled by stride, and copies everything else,
+// so only the kept data is ever in memory.
+func streamProfile(path string, limits profileLimits) (*profile.Profile, error) {
+	var samples int
+	var sampleBytes, otherBytes int64
+	err := scanProfileFields(path, false, func(f protoField) error {
+		if f.number() == profileSampleField {
+			samples++
+			sampleBytes += f.size
+		} else {
+			otherBytes += f.size
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if limits.maxBytes > 0 && otherBytes >= limits.maxBytes {
+		return nil, fmt.Errorf("profile %s holds %d MB besides its samples, over PPROF_MCP_MAX_PROFILE_MB=%d; it cannot be downsampled", path, otherBytes>>20, limits.maxBytes>>20)
+	}
+
+	stride := 1
+	if limits.maxSamples > 0 && samples > limits.maxSamples {
+		stride = (samples + limits.maxSamples - 1) / limits.maxSamples
+	}
+	if budget := limits.maxBytes - otherBytes; limits.maxBytes > 0 && sampleBytes > budget {
+		stride = max(stride, int((sampleBytes+budget-1)/budget))
+	}
+
+	var kept []byte
+	index := 0
+	err = scanProfileFields(path, true, func(f protoField) error {
+		payload := f.payload
+		if f.number() == profileSampleField {
+			keep := index%stride == 0
+			index++
+			if !keep {
+				return nil
+			}
+			if stride > 1 {
+				var err error
+				if payload, err = scaleSampleValues(payload, int64(stride)); err != nil {
+					return fmt.Errorf("profile %s: %w", path, err)
+				}
+			}
+		}
+		kept = appendField(kept, f.key, payload)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	prof, err := profile.ParseData(kept)
+	if err != nil {
+		return nil, err
+	}
+	if stride > 1 {
+		prof = prof.Compact()
+		why := fmt.Sprintf("file over PPROF_MCP_MAX_PROFILE_MB=%d", limits.maxBytes>>20)
+		prof.Comments = append(prof.Comments, limitCommentPrefix+downsampleNote(path, samples, stride, why))
+	}
+	return prof, nil
+}
+
+// Protobuf field numbers and wire types of the profile.proto fields that
+// streaming touches.
+const (
+	profileSampleField = 2
+	sampleValueField   = 2
+
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// protoField is one encoded protobuf field.
+type protoField struct {
+	key     uint64 // field number << 3 | wire type
+	size    int64  // payload length as encoded
+	payload []byte // the varint bytes, fixed bytes, or message; nil when not read
+}
+
+func (f protoField) number() int { return int(f.key >> 3) }
+
+// appendField encodes a field with the given payload onto dst.
+func appendField(dst []byte, key uint64, payload []byte) []byte {
+	dst = binary.AppendUvarint(dst, key)
+	if key&7 == wireBytes {
+		dst = binary.AppendUvarint(dst, uint64(len(payload)))
+	}
+	return append(dst, payload...)
+}
+
+// scanProfileFields calls visit for each top-level field of the profile at
+// path, gzipped or not. With read false, message payloads are skipped rather
+// than read, for a pass that only measures.
+func scanProfileFields(path string, read bool, visit func(protoField) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r := bufio.NewReaderSize(file, 1<<20)
+	if magic, _ := r.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("profile %s: %w", path, err)
+		}
+		defer gz.Close()
+		r = bufio.NewReaderSize(gz, 1<<20)
+	}
+
+	for {
+		key, err := binary.ReadUvarint(r)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("profile %s: %w", path, err)
+		}
+		f := protoField{key: key}
+		switch key & 7 {
+		case wireVarint:
+			v, err := binary.ReadUvarint(r)
+			if err != nil {
+				return fmt.Errorf("profile %s: %w", path, err)
+			}
+			f.payload = binary.AppendUvarint(nil, v)
+			f.size = int64(len(f.payload))
+		case wireFixed64, wireFixed32, wireBytes:
+			switch key & 7 {
+			case wireFixed64:
+				f.size = 8
+			case wireFixed32:
+				f.size = 4
+			default:
+				n, err := binary.ReadUvarint(r)
+				if err != nil {
+					return fmt.Errorf("profile %s: %w", path, err)
+				}
+				f.size = int64(n)
+			}
+			if read {
+				f.payload = make([]byte, f.size)
+				_, err = io.ReadFull(r, f.payload)
+			} else {
+				_, err = r.Discard(int(f.size))
+			}
+			if err != nil {
+				return fmt.Errorf("profile %s: %w", path, err)
+			}
+		default:
+			return fmt.Errorf("profile %s: unsupported protobuf wire type %d", path, key&7)
+		}
+		if err := visit(f); err != nil {
+			return err
+		}
+	}
+}
+
+// scaleSampleValues re-encodes a Sample message with each value multiplied
+// by factor, leaving its locations and labels as they were.
+func scaleSampleValues(msg []byte, factor int64) ([]byte, error) {
+	out := make([]byte, 0, len(msg)+8)
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return nil, errors.New("malformed sample")
+		}
+		start := msg
+		msg = msg[n:]
+		field, wire := int(key>>3), int(key&7)
+		switch {
+		case field == sampleValueField && wire == wireVarint:
+			v, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return nil, errors.New("malformed sample value")
+			}
+			msg = msg[n:]
+			out = binary.AppendUvarint(out, key)
+			out = binary.AppendUvarint(out, uint64(int64(v)*factor))
+		case field == sampleValueField && wire == wireBytes:
+			length, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < length {
+				return nil, errors.New("malformed sample values")
+			}
+			packed := msg[n : n+int(length)]
+			msg = msg[n+int(length):]
+			var values []byte
+			for len(packed) > 0 {
+				v, n := binary.Uvarint(packed)
+				if n <= 0 {
+					return nil, errors.New("malformed sample values")
+				}
+				packed = packed[n:]
+				values = binary.AppendUvarint(values, uint64(int64(v)*factor))
+			}
+			out = binary.AppendUvarint(out, key)
+			out = binary.AppendUvarint(out, uint64(len(values)))
+			out = append(out, values...)
+		default:
+			size, err := skipField(msg, wire)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, start[:n+size]...)
+			msg = msg[size:]
+		}
+	}
+	return out, nil
+}
+
+// skipField returns the encoded length of a field's payload.
+func skipField(msg []byte, wire int) (int, error) {
+	switch wire {
+	case wireVarint:
+		_, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return 0, errors.New("malformed varint")
+		}
+		return n, nil
+	case wireFixed64:
+		if len(msg) < 8 {
+			return 0, errors.New("truncated fixed64")
+		}
+		return 8, nil
+	case wireFixed32:
+		if len(msg) < 4 {
+			return 0, errors.New("truncated fixed32")
+		}
+		return 4, nil
+	case wireBytes:
+		length, n := binary.Uvarint(msg)
+		if n <= 0 || uint64(len(msg)-n) < length {
+			return 0, errors.New("truncated field")
+		}
+		return n + int(length), nil
+	default:
+		return 0, fmt.Errorf("unsupported protobuf wire type %d", wire)
+	}
+}
+
+// limitedProfileDir returns this process's directory of downsampled copies.
+// It is registered, so shutdown and the temp sweep remove it; one the sweep
+// took after MaxAge is created again.
+func limitedProfileDir() (string, error) {
+	limitedDirMu.Lock()
+	defer limitedDirMu.Unlock()
+	if limitedDir != nil {
+		if _, err := os.Stat(limitedDir.Path); err == nil {
+			return limitedDir.Path, nil
+		}
+		limitedDir.Remove()
+	}
+	dir, err := tempfiles.MkdirTemp("", "pprof-mcp-limited-")
+	if err != nil {
+		return "", err
+	}
+	limitedDir = dir
+	return dir.Path, nil
+}
+
+// pprofInputPath returns the file `go tool pprof` should read for the
+// profile at path: path itself, or for a file over the size limit a
+// downsampled copy, so the subprocess stays as bounded as the server.
+func pprofInputPath(path string) string {
+	limits := currentProfileLimits()
+	info, err := os.Stat(path)
+	if err != nil || limits.maxBytes <= 0 || info.Size() <= limits.maxBytes {
+		return path
+	}
+	prof, hash, err := loadLimitedProfile(path)
+	if err != nil {
+		return path
+	}
+	dir, err := limitedProfileDir()
+	if err != nil {
+		return path
+	}
+	limited := filepath.Join(dir, hash+".pb.gz")
+	if _, err := os.Stat(limited); err == nil {
+		return limited
+	}
+	scratch, tmp, err := tempfiles.CreateTemp(dir, hash+".*.tmp")
+	if err != nil {
+		return path
+	}
+	defer scratch.Remove()
+	// Encoding scratches state inside the shared profile.
+	limitedWriteMu.Lock()
+	err = prof.Write(tmp)
+	limitedWriteMu.Unlock()
+	if err != nil {
+		tmp.Close()
+		return path
+	}
+	if err := tmp.Close(); err != nil || os.Rename(tmp.Name(), limited) != nil {
+		return path
+	}
+	return limited
+}
+
+// streamFileHash hashes the file at path without reading it into memory.
+func streamFileHash(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
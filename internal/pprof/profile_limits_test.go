@@ -0,0 +1,154 @@
+package pprof
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/require"
+
+	"github.com/arreyder/pprof-mcp/internal/tempfiles"
+)
+
+// writeManySamples writes a profile of n single-frame samples, sample i in
+// function fn<i%4>, each worth 10, gzipped unless plain is set.
+func writeManySamples(t *testing.T, path string, n int, plain bool) {
+	t.Helper()
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		Comments:   []string{"merged"},
+	}
+	for i := 0; i < 4; i++ {
+		fn := &profile.Function{ID: uint64(i + 1), Name: "main.fn" + string(rune('a'+i))}
+		prof.Function = append(prof.Function, fn)
+		prof.Location = append(prof.Location, &profile.Location{ID: uint64(i + 1), Line: []profile.Line{{Function: fn, Line: int64(i)}}})
+	}
+	for i := 0; i < n; i++ {
+		prof.Sample = append(prof.Sample, &profile.Sample{
+			Location: []*profile.Location{prof.Location[i%4]},
+			Value:    []int64{10, 1000},
+			Label:    map[string][]string{"tenant": {"t1"}},
+		})
+	}
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	if plain {
+		require.NoError(t, prof.WriteUncompressed(file))
+	} else {
+		require.NoError(t, prof.Write(file))
+	}
+	require.NoError(t, file.Close())
+}
+
+func sampleTotals(prof *profile.Profile) (int64, int64) {
+	var count, cpu int64
+	for _, s := range prof.Sample {
+		count += s.Value[0]
+		cpu += s.Value[1]
+	}
+	return count, cpu
+}
+
+func TestStreamProfileDownsamples(t *testing.T) {
+	dir := t.TempDir()
+	for _, plain := range []bool{false, true} {
+		path := filepath.Join(dir, "merged.pprof")
+		writeManySamples(t, path, 12, plain)
+
+		prof, err := streamProfile(path, profileLimits{maxBytes: 1 << 20, maxSamples: 5})
+		require.NoError(t, err)
+		// 12 samples over a limit of 5 keep every 3rd, scaled by 3.
+		require.Len(t, prof.Sample, 4)
+		count, cpu := sampleTotals(prof)
+		require.Equal(t, int64(120), count)
+		require.Equal(t, int64(12000), cpu)
+		require.Equal(t, []string{"t1"}, prof.Sample[0].Label["tenant"])
+		require.Equal(t, "main.fna", prof.Sample[0].Location[0].Line[0].Function.Name)
+		require.Equal(t, "merged", prof.Comments[0])
+		require.Len(t, prof.Comments, 2)
+		require.Contains(t, prof.Comments[1], "merged.pprof has 12 samples")
+		require.Contains(t, prof.Comments[1], "kept every 3rd sample")
+
+		// Under both limits the profile comes through whole.
+		prof, err = streamProfile(path, profileLimits{maxBytes: 1 << 20, maxSamples: 100})
+		require.NoError(t, err)
+		require.Len(t, prof.Sample, 12)
+		require.Equal(t, []string{"merged"}, prof.Comments)
+	}
+}
+
+func TestStreamProfileByteBudget(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "big.pprof")
+	writeManySamples(t, path, 400, false)
+
+	var sampleBytes, otherBytes int64
+	require.NoError(t, scanProfileFields(path, false, func(f protoField) error {
+		if f.number() == profileSampleField {
+			sampleBytes += f.size
+		} else {
+			otherBytes += f.size
+		}
+		return nil
+	}))
+	// Room for roughly a quarter of the samples.
+	prof, err := streamProfile(path, profileLimits{maxBytes: otherBytes + sampleBytes/4})
+	require.NoError(t, err)
+	require.LessOrEqual(t, len(prof.Sample), 100)
+	count, _ := sampleTotals(prof)
+	require.InDelta(t, 4000, count, 40)
+
+	_, err = streamProfile(path, profileLimits{maxBytes: otherBytes / 2})
+	require.ErrorContains(t, err, "cannot be downsampled")
+}
+
+func TestDownsampleParsed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "heap.pprof")
+	writeManySamples(t, path, 10, false)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	prof, err := profile.ParseData(data)
+	require.NoError(t, err)
+
+	same := downsampleParsed(path, prof, profileLimits{maxSamples: 10})
+	require.Len(t, same.Sample, 10)
+
+	thinned := downsampleParsed(path, prof, profileLimits{maxSamples: 4})
+	require.Len(t, thinned.Sample, 4)
+	count, _ := sampleTotals(thinned)
+	require.Equal(t, int64(120), count)
+
+	recordLimitNote(path, thinned)
+	warnings := ProfileLimitWarnings(path, filepath.Join(t.TempDir(), "other.pprof"))
+	require.Len(t, warnings, 1)
+	require.True(t, strings.HasPrefix(warnings[0], "heap.pprof has 10 samples (over PPROF_MCP_MAX_PROFILE_SAMPLES=4)"), warnings[0])
+	recordLimitNote(path, same)
+	require.Empty(t, ProfileLimitWarnings(path))
+}
+
+func TestLimitedProfileDirIsRegistered(t *testing.T) {
+	t.Setenv("PPROF_MCP_TEMP_REGISTRY", t.TempDir())
+	t.Cleanup(func() { tempfiles.Cleanup() })
+
+	dir, err := limitedProfileDir()
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(filepath.Base(dir), "pprof-mcp-limited-"), dir)
+	again, err := limitedProfileDir()
+	require.NoError(t, err)
+	require.Equal(t, dir, again)
+
+	// A directory the sweep removed is created again.
+	require.NoError(t, os.RemoveAll(dir))
+	recreated, err := limitedProfileDir()
+	require.NoError(t, err)
+	require.NotEqual(t, dir, recreated)
+	entries, err := tempfiles.List()
+	require.NoError(t, err)
+	var paths []string
+	for _, entry := range entries {
+		paths = append(paths, entry.Path)
+	}
+	require.Contains(t, paths, recreated)
+	require.NotContains(t, paths, dir)
+}
@@ -13,9 +13,9 @@ type RegressionCheckParams struct {
 }
 
 type RegressionCheckSpec struct {
-	Function string  `json:"function"`
-	Metric   string  `json:"metric"`
-	Max      float64 `json:"max"`
+	Function string  `json:"function" yaml:"function"`
+	Metric   string  `json:"metric" yaml:"metric"`
+	Max      float64 `json:"max" yaml:"max"`
 }
 
 type RegressionCheckSummary struct {
@@ -48,12 +48,9 @@ func RunRegressionCheck(ctx context.Context, params RegressionCheckParams) (Regr
 		if check.Function == "" {
 			return result, fmt.Errorf("check function is required")
 		}
-		metric := check.Metric
-		if metric == "" {
-			metric = "flat_pct"
-		}
-		if metric != "flat_pct" && metric != "cum_pct" {
-			return result, fmt.Errorf("unsupported metric %q (use flat_pct or cum_pct)", metric)
+		metric, err := regressionMetric(check.Metric)
+		if err != nil {
+			return result, err
 		}
 
 		actual, err := evaluateCheck(ctx, params.Profile, params.SampleIndex, check.Function, metric)
@@ -79,6 +76,100 @@ func RunRegressionCheck(ctx context.Context, params RegressionCheckParams) (Regr
 	return result, nil
 }
 
+// RegressionDeltaSpec bounds how much a function may grow between two
+// profiles, in percentage points of the metric.
+type RegressionDeltaSpec struct {
+	Function    string  `json:"function" yaml:"function"`
+	Metric      string  `json:"metric" yaml:"metric"`
+	MaxIncrease float64 `json:"max_increase" yaml:"max_increase"`
+}
+
+type RegressionDeltaParams struct {
+	Before      string
+	After       string
+	SampleIndex string
+	Checks      []RegressionDeltaSpec
+}
+
+type RegressionDeltaSummary struct {
+	Passed bool                    `json:"passed"`
+	Checks []RegressionDeltaResult `json:"checks"`
+}
+
+type RegressionDeltaResult struct {
+	Function  string  `json:"function"`
+	Metric    string  `json:"metric"`
+	Threshold float64 `json:"threshold"`
+	Before    float64 `json:"before"`
+	After     float64 `json:"after"`
+	Delta     float64 `json:"delta"`
+	Passed    bool    `json:"passed"`
+	Message   string  `json:"message,omitempty"`
+}
+
+// RunRegressionDelta compares each check's metric between the before and
+// after profiles and fails checks that grew by more than MaxIncrease.
+func RunRegressionDelta(ctx context.Context, params RegressionDeltaParams) (RegressionDeltaSummary, error) {
+	result := RegressionDeltaSummary{
+		Passed: true,
+		Checks: []RegressionDeltaResult{},
+	}
+	if params.Before == "" || params.After == "" {
+		return result, fmt.Errorf("before and after profiles are required")
+	}
+	if len(params.Checks) == 0 {
+		return result, fmt.Errorf("checks are required")
+	}
+
+	for _, check := range params.Checks {
+		if check.Function == "" {
+			return result, fmt.Errorf("check function is required")
+		}
+		metric, err := regressionMetric(check.Metric)
+		if err != nil {
+			return result, err
+		}
+
+		before, err := evaluateCheck(ctx, params.Before, params.SampleIndex, check.Function, metric)
+		if err != nil {
+			return result, fmt.Errorf("before: %w", err)
+		}
+		after, err := evaluateCheck(ctx, params.After, params.SampleIndex, check.Function, metric)
+		if err != nil {
+			return result, fmt.Errorf("after: %w", err)
+		}
+
+		delta := after - before
+		passed := delta <= check.MaxIncrease
+		entry := RegressionDeltaResult{
+			Function:  check.Function,
+			Metric:    metric,
+			Threshold: check.MaxIncrease,
+			Before:    before,
+			After:     after,
+			Delta:     delta,
+			Passed:    passed,
+		}
+		if !passed {
+			entry.Message = fmt.Sprintf("%s %s grew %.2f%% -> %.2f%% (+%.2f), more than the allowed +%.2f", check.Function, metric, before, after, delta, check.MaxIncrease)
+			result.Passed = false
+		}
+		result.Checks = append(result.Checks, entry)
+	}
+
+	return result, nil
+}
+
+func regressionMetric(metric string) (string, error) {
+	if metric == "" {
+		metric = "flat_pct"
+	}
+	if metric != "flat_pct" && metric != "cum_pct" {
+		return "", fmt.Errorf("unsupported metric %q (use flat_pct or cum_pct)", metric)
+	}
+	return metric, nil
+}
+
 func evaluateCheck(ctx context.Context, profilePath, sampleIndex, pattern, metric string) (float64, error) {
 	topResult, err := RunTop(ctx, TopParams{
 		Profile:     profilePath,
@@ -0,0 +1,74 @@
+package pprof
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestProfile(t *testing.T, path string, hot, cold int64) {
+	t.Helper()
+	hotFn := &profile.Function{ID: 1, Name: "main.hot", SystemName: "main.hot"}
+	coldFn := &profile.Function{ID: 2, Name: "main.cold", SystemName: "main.cold"}
+	hotLoc := &profile.Location{ID: 1, Address: 0x1000, Line: []profile.Line{{Function: hotFn, Line: 10}}}
+	coldLoc := &profile.Location{ID: 2, Address: 0x2000, Line: []profile.Line{{Function: coldFn, Line: 20}}}
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}},
+		Sample: []*profile.Sample{
+			{Location: []*profile.Location{hotLoc}, Value: []int64{hot}},
+			{Location: []*profile.Location{coldLoc}, Value: []int64{cold}},
+		},
+		Location: []*profile.Location{hotLoc, coldLoc},
+		Function: []*profile.Function{hotFn, coldFn},
+	}
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, prof.Write(file))
+	require.NoError(t, file.Close())
+}
+
+func TestRunRegressionDelta(t *testing.T) {
+	dir := t.TempDir()
+	before := filepath.Join(dir, "before.pprof")
+	after := filepath.Join(dir, "after.pprof")
+	writeTestProfile(t, before, 20, 80)
+	writeTestProfile(t, after, 50, 50)
+
+	result, err := RunRegressionDelta(context.Background(), RegressionDeltaParams{
+		Before: before,
+		After:  after,
+		Checks: []RegressionDeltaSpec{
+			{Function: "main.hot", MaxIncrease: 10},
+			{Function: "main.cold", MaxIncrease: 0},
+		},
+	})
+	require.NoError(t, err)
+	require.False(t, result.Passed)
+	require.Len(t, result.Checks, 2)
+
+	hot := result.Checks[0]
+	require.Equal(t, "flat_pct", hot.Metric)
+	require.InDelta(t, 20, hot.Before, 0.01)
+	require.InDelta(t, 50, hot.After, 0.01)
+	require.InDelta(t, 30, hot.Delta, 0.01)
+	require.False(t, hot.Passed)
+	require.NotEmpty(t, hot.Message)
+
+	require.True(t, result.Checks[1].Passed)
+}
+
+func TestRunRegressionDeltaValidation(t *testing.T) {
+	_, err := RunRegressionDelta(context.Background(), RegressionDeltaParams{After: "after.pprof", Checks: []RegressionDeltaSpec{{Function: "x"}}})
+	require.Error(t, err)
+
+	_, err = RunRegressionDelta(context.Background(), RegressionDeltaParams{
+		Before: "before.pprof",
+		After:  "after.pprof",
+		Checks: []RegressionDeltaSpec{{Function: "x", Metric: "bogus"}},
+	})
+	require.ErrorContains(t, err, "unsupported metric")
+}
@@ -50,7 +50,10 @@ func DetectRepoFromProfile(prof *profile.Profile) RepoDetectionResult {
 		sorted = append(sorted, modCount{path, count})
 	}
 	sort.Slice(sorted, func(i, j int) bool {
-		return sorted[i].count > sorted[j].count
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+		return sorted[i].path < sorted[j].path
 	})
 
 	// Take top module paths (likely the application's code)
@@ -3,6 +3,7 @@ package pprof
 import (
 	"encoding/json"
 	"fmt"
+	"path/filepath"
 	"sort"
 	"strings"
 
@@ -10,18 +11,30 @@ import (
 )
 
 type ReportInput struct {
-	Kind string         `json:"kind"`
-	Data map[string]any `json:"data"`
+	Kind  string         `json:"kind"`
+	Data  map[string]any `json:"data"`
+	Title string         `json:"title,omitempty"` // section heading for diff_top, hotspot_summary, storylines, and trace_source
 }
 
 type ReportParams struct {
 	Title  string        `json:"title,omitempty"`
 	Inputs []ReportInput `json:"inputs"`
+	// GroupBy "team" gives each owning team its own section; see
+	// generateTeamReport.
+	GroupBy string `json:"group_by,omitempty"`
+	// RepoRoot is where CODEOWNERS is read from when grouping by team.
+	RepoRoot string `json:"repo_root,omitempty"`
+	// Teams maps team names to the import paths they own, ahead of
+	// CODEOWNERS.
+	Teams map[string][]string `json:"teams,omitempty"`
 }
 
 type ReportResult struct {
 	Markdown     string `json:"markdown"`
 	SectionCount int    `json:"section_count"`
+	// Teams are the team sections as standalone reports, when grouped by
+	// team.
+	Teams []TeamReport `json:"teams,omitempty"`
 }
 
 func GenerateReport(params ReportParams) (ReportResult, error) {
@@ -33,6 +46,13 @@ func GenerateReport(params ReportParams) (ReportResult, error) {
 	if strings.TrimSpace(title) == "" {
 		title = "Profiling Report"
 	}
+	switch strings.ToLower(strings.TrimSpace(params.GroupBy)) {
+	case "", "none":
+	case ReportGroupByTeam:
+		return generateTeamReport(params, title)
+	default:
+		return ReportResult{}, fmt.Errorf("unknown group_by %q (want team)", params.GroupBy)
+	}
 
 	var b strings.Builder
 	b.WriteString("# ")
@@ -41,48 +61,11 @@ func GenerateReport(params ReportParams) (ReportResult, error) {
 
 	sections := 0
 	for _, input := range params.Inputs {
-		kind := strings.ToLower(strings.TrimSpace(input.Kind))
-		data := unwrapReportData(input.Data)
-		switch kind {
-		case "discover", "pprof.discover":
-			var report DiscoveryReport
-			if err := decodeReportData(data, &report); err != nil {
-				return ReportResult{}, err
-			}
-			sections += renderDiscoveryReport(&b, report)
-		case "top", "pprof.top":
-			var top TopResult
-			if err := decodeReportData(data, &top); err != nil {
-				return ReportResult{}, err
-			}
-			sections += renderTopReport(&b, top)
-		case "alloc_paths", "pprof.alloc_paths":
-			var alloc AllocPathsResult
-			if err := decodeReportData(data, &alloc); err != nil {
-				return ReportResult{}, err
-			}
-			sections += renderAllocPathsReport(&b, alloc)
-		case "memory_sanity", "pprof.memory_sanity":
-			var sanity MemorySanityResult
-			if err := decodeReportData(data, &sanity); err != nil {
-				return ReportResult{}, err
-			}
-			sections += renderMemorySanityReport(&b, sanity)
-		case "overhead_report", "pprof.overhead_report":
-			var overhead OverheadReport
-			if err := decodeReportData(data, &overhead); err != nil {
-				return ReportResult{}, err
-			}
-			sections += renderOverheadReport(&b, overhead)
-		case "goroutine_analysis", "pprof.goroutine_analysis":
-			var goroutine GoroutineAnalysisResult
-			if err := decodeReportData(data, &goroutine); err != nil {
-				return ReportResult{}, err
-			}
-			sections += renderGoroutineReport(&b, goroutine)
-		default:
-			sections += renderGenericReport(&b, input.Kind, data)
+		n, err := renderReportInput(&b, input)
+		if err != nil {
+			return ReportResult{}, err
 		}
+		sections += n
 	}
 
 	return ReportResult{
@@ -91,6 +74,77 @@ func GenerateReport(params ReportParams) (ReportResult, error) {
 	}, nil
 }
 
+// renderReportInput writes the sections for one input and returns how many
+// it wrote.
+func renderReportInput(b *strings.Builder, input ReportInput) (int, error) {
+	kind := strings.ToLower(strings.TrimSpace(input.Kind))
+	data := unwrapReportData(input.Data)
+	switch kind {
+	case "discover", "pprof.discover":
+		var report DiscoveryReport
+		if err := decodeReportData(data, &report); err != nil {
+			return 0, err
+		}
+		return renderDiscoveryReport(b, report), nil
+	case "top", "pprof.top":
+		var top TopResult
+		if err := decodeReportData(data, &top); err != nil {
+			return 0, err
+		}
+		return renderTopReport(b, top), nil
+	case "alloc_paths", "pprof.alloc_paths":
+		var alloc AllocPathsResult
+		if err := decodeReportData(data, &alloc); err != nil {
+			return 0, err
+		}
+		return renderAllocPathsReport(b, alloc), nil
+	case "memory_sanity", "pprof.memory_sanity":
+		var sanity MemorySanityResult
+		if err := decodeReportData(data, &sanity); err != nil {
+			return 0, err
+		}
+		return renderMemorySanityReport(b, sanity), nil
+	case "overhead_report", "pprof.overhead_report":
+		var overhead OverheadReport
+		if err := decodeReportData(data, &overhead); err != nil {
+			return 0, err
+		}
+		return renderOverheadReport(b, overhead), nil
+	case "goroutine_analysis", "pprof.goroutine_analysis":
+		var goroutine GoroutineAnalysisResult
+		if err := decodeReportData(data, &goroutine); err != nil {
+			return 0, err
+		}
+		return renderGoroutineReport(b, goroutine), nil
+	case "diff_top", "pprof.diff_top":
+		var diff DiffTopResult
+		if err := decodeReportData(data, &diff); err != nil {
+			return 0, err
+		}
+		return renderDiffTopReport(b, input.Title, diff), nil
+	case "hotspot_summary", "pprof.hotspot_summary":
+		var hotspots HotspotSummaryResult
+		if err := decodeReportData(data, &hotspots); err != nil {
+			return 0, err
+		}
+		return renderHotspotSummaryReport(b, input.Title, hotspots), nil
+	case "storylines", "pprof.storylines":
+		var storylines StorylinesResult
+		if err := decodeReportData(data, &storylines); err != nil {
+			return 0, err
+		}
+		return renderStorylinesReport(b, input.Title, storylines), nil
+	case "trace_source", "pprof.trace_source":
+		var trace TraceSourceResult
+		if err := decodeReportData(data, &trace); err != nil {
+			return 0, err
+		}
+		return renderTraceSourceReport(b, input.Title, trace), nil
+	default:
+		return renderGenericReport(b, input.Kind, data), nil
+	}
+}
+
 func unwrapReportData(data map[string]any) map[string]any {
 	if data == nil {
 		return map[string]any{}
@@ -320,6 +374,135 @@ func renderGoroutineReport(b *strings.Builder, goroutine GoroutineAnalysisResult
 	return 1
 }
 
+// renderDiffTopReport lists the functions whose time, size, or count grew
+// and shrank the most, five each
+func renderDiffTopReport(b *strings.Builder, title string, diff DiffTopResult) int {
+	var grew, shrank []map[string]any
+	for _, delta := range diff.Deltas {
+		value, _ := pprofparse.DeltaValue(delta)
+		if value > 0 && len(grew) < 5 {
+			grew = append(grew, delta)
+		}
+	}
+	for i := len(diff.Deltas) - 1; i >= 0 && len(shrank) < 5; i-- {
+		if value, _ := pprofparse.DeltaValue(diff.Deltas[i]); value < 0 {
+			shrank = append(shrank, diff.Deltas[i])
+		}
+	}
+	if len(grew) == 0 && len(shrank) == 0 {
+		return 0
+	}
+	if strings.TrimSpace(title) == "" {
+		title = "Top Function Changes"
+	}
+	b.WriteString("## " + title + "\n")
+	b.WriteString("| Function | Before | After | Delta |\n| --- | --- | --- | --- |\n")
+	for _, delta := range append(grew, shrank...) {
+		before, _ := delta["before_flat"].(string)
+		after, _ := delta["after_flat"].(string)
+		b.WriteString(fmt.Sprintf("| %s | %s | %s | %s |\n", delta["name"], dashIfEmpty(before), dashIfEmpty(after), formatDelta(delta)))
+	}
+	b.WriteString("\n\n")
+	return 1
+}
+
+// formatDelta formats a DiffTop delta with its sign and unit.
+func formatDelta(delta map[string]any) string {
+	value, unit := pprofparse.DeltaValue(delta)
+	switch unit {
+	case pprofparse.UnitBytes:
+		return fmt.Sprintf("%+.2fMB", value/(1<<20))
+	case pprofparse.UnitCount:
+		return fmt.Sprintf("%+.0f", value)
+	default:
+		return fmt.Sprintf("%+.2fs", value)
+	}
+}
+
+func renderHotspotSummaryReport(b *strings.Builder, title string, hotspots HotspotSummaryResult) int {
+	if len(hotspots.CPUTop5) == 0 && len(hotspots.HeapTop5) == 0 && len(hotspots.MutexTop5) == 0 && hotspots.GoroutineCount == nil {
+		return 0
+	}
+	if strings.TrimSpace(title) == "" {
+		title = "Hotspots"
+	}
+	b.WriteString("## " + title + "\n")
+	if hotspots.GoroutineCount != nil {
+		b.WriteString(fmt.Sprintf("- Goroutines: %d\n\n", *hotspots.GoroutineCount))
+	}
+	if len(hotspots.CPUTop5)+len(hotspots.HeapTop5)+len(hotspots.MutexTop5) > 0 {
+		// The owners column only appears once CODEOWNERS attributed something.
+		owned := hotspots.CodeOwners != ""
+		row := func(kind, function string, pct float64, owners []string) {
+			b.WriteString(fmt.Sprintf("| %s | %s | %.1f%% |", kind, function, pct))
+			if owned {
+				b.WriteString(" " + dashIfEmpty(strings.Join(owners, ", ")) + " |")
+			}
+			b.WriteString("\n")
+		}
+		if owned {
+			b.WriteString("| Kind | Function | Share | Owners |\n| --- | --- | --- | --- |\n")
+		} else {
+			b.WriteString("| Kind | Function | Share |\n| --- | --- | --- |\n")
+		}
+		for _, h := range hotspots.CPUTop5 {
+			row("cpu", h.Function, h.FlatPct, h.Owners)
+		}
+		for _, h := range hotspots.HeapTop5 {
+			row("heap", h.Function, h.AllocPct, h.Owners)
+		}
+		for _, h := range hotspots.MutexTop5 {
+			row("mutex", h.Function, h.DelayPct, h.Owners)
+		}
+	}
+	if len(hotspots.CPUByOwner) > 0 {
+		b.WriteString("\n**CPU by owner**\n\n| Owner | CPU | Hottest functions |\n| --- | --- | --- |\n")
+		for _, share := range hotspots.CPUByOwner {
+			b.WriteString(fmt.Sprintf("| %s | %.1f%% | %s |\n", share.Owner, share.Pct, strings.Join(share.Functions, ", ")))
+		}
+	}
+	b.WriteString("\n\n")
+	return 1
+}
+
+func renderStorylinesReport(b *strings.Builder, title string, storylines StorylinesResult) int {
+	if strings.TrimSpace(title) == "" {
+		title = "Storylines"
+	}
+	b.WriteString("## " + title + "\n")
+	writeStorylinesMarkdown(b, storylines, "###")
+	b.WriteString("\n\n")
+	return 1
+}
+
+func renderTraceSourceReport(b *strings.Builder, title string, trace TraceSourceResult) int {
+	if len(trace.CallChain) == 0 {
+		return 0
+	}
+	if strings.TrimSpace(title) == "" {
+		title = "Source trace"
+	}
+	b.WriteString("## " + title + "\n")
+	b.WriteString("| # | Function | Location | Flat | Cum |\n| --- | --- | --- | --- | --- |\n")
+	for i, frame := range trace.CallChain {
+		location := fmt.Sprintf("%s:%d", filepath.Base(frame.File), frame.Line)
+		if frame.Permalink != "" {
+			location = fmt.Sprintf("[%s](%s)", location, frame.Permalink)
+		}
+		b.WriteString(fmt.Sprintf("| %d | %s | %s | %.1f%% | %.1f%% |\n", i+1, frame.Function, location, frame.FlatPct, frame.CumPct))
+	}
+	b.WriteString("\n\n")
+	return 1
+}
+
+// dashIfEmpty shows a function missing from one side as a dash
+func dashIfEmpty(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
 func renderGenericReport(b *strings.Builder, kind string, data map[string]any) int {
 	b.WriteString("## ")
 	if strings.TrimSpace(kind) == "" {
@@ -360,7 +543,10 @@ func sortedStateCounts(states map[string]int) []stateCount {
 		items = append(items, stateCount{State: state, Count: count})
 	}
 	sort.Slice(items, func(i, j int) bool {
-		return items[i].Count > items[j].Count
+		if items[i].Count != items[j].Count {
+			return items[i].Count > items[j].Count
+		}
+		return items[i].State < items[j].State
 	})
 	return items
 }
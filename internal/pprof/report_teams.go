@@ -0,0 +1,390 @@
+package pprof
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/arreyder/pprof-mcp/internal/pprofparse"
+)
+
+// ReportGroupByTeam groups a report's findings by the team that owns the
+// code they point at.
+const ReportGroupByTeam = "team"
+
+// unownedTeam heads the section for findings no team owns.
+const unownedTeam = "Unowned"
+
+// TeamReport is one team's section of a report, titled so it can be pasted
+// on its own.
+type TeamReport struct {
+	Team     string `json:"team"`
+	Markdown string `json:"markdown"`
+	Hotspots int    `json:"hotspots"`
+}
+
+// teamFinding is a hotspot a report input points at: a function, where it
+// lives when known, and what to do about it.
+type teamFinding struct {
+	kind           string
+	function       string
+	share          string
+	location       string
+	recommendation string
+	// owners were attributed by the tool that produced the input.
+	owners []string
+}
+
+var sourceLineSuffix = regexp.MustCompile(`:\d+$`)
+
+// generateTeamReport renders one section per team holding only the
+// hotspots in its code and the recommendations attached to them. Inputs
+// that don't point at functions (memory_sanity, goroutine_analysis, and
+// unknown kinds) and service-wide recommendations follow the team
+// sections, as in an ungrouped report.
+func generateTeamReport(params ReportParams, title string) (ReportResult, error) {
+	var findings []teamFinding
+	var serviceWide []string
+	var rest strings.Builder
+	restSections := 0
+	for _, input := range params.Inputs {
+		kind := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(input.Kind), "pprof."))
+		data := unwrapReportData(input.Data)
+		switch kind {
+		case "discover":
+			var report DiscoveryReport
+			if err := decodeReportData(data, &report); err != nil {
+				return ReportResult{}, err
+			}
+			if report.CPU != nil {
+				findings = append(findings, topRowFindings("cpu", report.CPU.TopFunctions)...)
+				findings = append(findings, overheadFindings(report.CPU.Overhead)...)
+			}
+			if report.Heap != nil {
+				findings = append(findings, allocPathFindings(report.Heap.TopPaths)...)
+				serviceWide = append(serviceWide, report.Heap.MemorySanity.Recommendations...)
+			}
+			if report.Mutex != nil {
+				findings = append(findings, topRowFindings("mutex", report.Mutex.TopContentions)...)
+			}
+			for _, rec := range report.Recommendations {
+				serviceWide = append(serviceWide, fmt.Sprintf("[%s] %s: %s", strings.ToUpper(rec.Priority), rec.Area, rec.Suggestion))
+			}
+		case "top":
+			var top TopResult
+			if err := decodeReportData(data, &top); err != nil {
+				return ReportResult{}, err
+			}
+			findings = append(findings, topRowFindings("top", top.Rows)...)
+		case "alloc_paths":
+			var alloc AllocPathsResult
+			if err := decodeReportData(data, &alloc); err != nil {
+				return ReportResult{}, err
+			}
+			findings = append(findings, allocPathFindings(alloc.Paths)...)
+		case "overhead_report":
+			var overhead OverheadReport
+			if err := decodeReportData(data, &overhead); err != nil {
+				return ReportResult{}, err
+			}
+			findings = append(findings, overheadFindings(overhead)...)
+		case "diff_top":
+			var diff DiffTopResult
+			if err := decodeReportData(data, &diff); err != nil {
+				return ReportResult{}, err
+			}
+			// Only growth is a finding; shrinking functions need no action.
+			for _, delta := range diff.Deltas {
+				value, _ := pprofparse.DeltaValue(delta)
+				name, _ := delta["name"].(string)
+				if value > 0 && name != "" {
+					findings = append(findings, teamFinding{kind: "regression", function: name, share: formatDelta(delta)})
+				}
+			}
+		case "hotspot_summary":
+			var hotspots HotspotSummaryResult
+			if err := decodeReportData(data, &hotspots); err != nil {
+				return ReportResult{}, err
+			}
+			for _, h := range hotspots.CPUTop5 {
+				findings = append(findings, teamFinding{kind: "cpu", function: h.Function, share: fmt.Sprintf("%.1f%%", h.FlatPct), owners: h.Owners})
+			}
+			for _, h := range hotspots.HeapTop5 {
+				findings = append(findings, teamFinding{kind: "heap", function: h.Function, share: fmt.Sprintf("%.1f%%", h.AllocPct), owners: h.Owners})
+			}
+			for _, h := range hotspots.MutexTop5 {
+				findings = append(findings, teamFinding{kind: "mutex", function: h.Function, share: fmt.Sprintf("%.1f%%", h.DelayPct), owners: h.Owners})
+			}
+		case "storylines":
+			var storylines StorylinesResult
+			if err := decodeReportData(data, &storylines); err != nil {
+				return ReportResult{}, err
+			}
+			for _, story := range storylines.Storylines {
+				function := story.FirstApp
+				if function == "" {
+					function = story.LeafHotspot
+				}
+				findings = append(findings, teamFinding{kind: "storyline", function: function, share: story.CumPct, owners: story.Owners})
+			}
+		case "trace_source":
+			var trace TraceSourceResult
+			if err := decodeReportData(data, &trace); err != nil {
+				return ReportResult{}, err
+			}
+			for _, frame := range trace.CallChain {
+				if frame.IsVendor {
+					continue
+				}
+				findings = append(findings, teamFinding{
+					kind:     "trace",
+					function: frame.Function,
+					share:    fmt.Sprintf("%.1f%%", frame.CumPct),
+					location: fmt.Sprintf("%s:%d", frame.File, frame.Line),
+				})
+			}
+		default:
+			n, err := renderReportInput(&rest, input)
+			if err != nil {
+				return ReportResult{}, err
+			}
+			restSections += n
+		}
+	}
+
+	resolver := newTeamResolver(params.RepoRoot, params.Teams)
+	byTeam := map[string][]teamFinding{}
+	seen := map[string]bool{}
+	for _, finding := range findings {
+		if finding.function == "" {
+			continue
+		}
+		teams := resolver.teams(finding)
+		if len(teams) == 0 {
+			teams = []string{unownedTeam}
+		}
+		for _, team := range teams {
+			// The same hotspot often arrives from several inputs; the first
+			// one wins.
+			key := team + "\x00" + finding.kind + "\x00" + finding.function
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			byTeam[team] = append(byTeam[team], finding)
+		}
+	}
+	teams := make([]string, 0, len(byTeam))
+	for team := range byTeam {
+		if team != unownedTeam {
+			teams = append(teams, team)
+		}
+	}
+	sort.Strings(teams)
+	if len(byTeam[unownedTeam]) > 0 {
+		teams = append(teams, unownedTeam)
+	}
+
+	var b strings.Builder
+	b.WriteString("# " + title + "\n\n")
+	result := ReportResult{Teams: []TeamReport{}}
+	for _, team := range teams {
+		body := renderTeamFindings(byTeam[team])
+		b.WriteString("## " + team + "\n" + body + "\n\n")
+		result.Teams = append(result.Teams, TeamReport{
+			Team:     team,
+			Markdown: "# " + title + ": " + team + "\n\n" + body,
+			Hotspots: len(byTeam[team]),
+		})
+		result.SectionCount++
+	}
+	if len(serviceWide) > 0 {
+		b.WriteString("## Service-wide recommendations\n")
+		for _, rec := range serviceWide {
+			b.WriteString("- " + rec + "\n")
+		}
+		b.WriteString("\n")
+		result.SectionCount++
+	}
+	b.WriteString(rest.String())
+	result.SectionCount += restSections
+	result.Markdown = strings.TrimSpace(b.String())
+	return result, nil
+}
+
+// renderTeamFindings is a team's hotspot table followed by the
+// recommendations attached to its hotspots.
+func renderTeamFindings(findings []teamFinding) string {
+	var b strings.Builder
+	b.WriteString("| Kind | Function | Share | Location |\n| --- | --- | --- | --- |\n")
+	var recommendations []string
+	seen := map[string]bool{}
+	for _, f := range findings {
+		b.WriteString(fmt.Sprintf("| %s | %s | %s | %s |\n", f.kind, f.function, dashIfEmpty(f.share), dashIfEmpty(f.location)))
+		if f.recommendation != "" && !seen[f.recommendation] {
+			seen[f.recommendation] = true
+			recommendations = append(recommendations, f.recommendation)
+		}
+	}
+	if len(recommendations) > 0 {
+		b.WriteString("\n**Recommendations**\n")
+		for _, rec := range recommendations {
+			b.WriteString("- " + rec + "\n")
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func topRowFindings(kind string, rows []pprofparse.TopRow) []teamFinding {
+	var findings []teamFinding
+	for _, row := range limitTopRows(rows, 10) {
+		findings = append(findings, teamFinding{kind: kind, function: row.Name, share: row.FlatPct})
+	}
+	return findings
+}
+
+func allocPathFindings(paths []AllocPath) []teamFinding {
+	var findings []teamFinding
+	for _, path := range limitAllocPaths(paths, 10) {
+		// The first app frame is the code the owning team can change.
+		function := path.FirstAppFrame
+		if function == "" {
+			function = path.AllocSite
+		}
+		findings = append(findings, teamFinding{kind: "heap", function: function, share: fmt.Sprintf("%.1f%%", path.AllocPct), location: path.SourceLocation})
+	}
+	return findings
+}
+
+// overheadFindings attaches each detection's suggestion to the functions
+// that account for it.
+func overheadFindings(overhead OverheadReport) []teamFinding {
+	var findings []teamFinding
+	for _, det := range overhead.Detections {
+		rec := ""
+		if det.Suggestion != "" {
+			rec = fmt.Sprintf("%s (%.1f%%): %s", det.Category, det.Percentage, det.Suggestion)
+		}
+		for _, function := range det.TopFuncs {
+			findings = append(findings, teamFinding{kind: det.Category, function: function, share: fmt.Sprintf("%.1f%%", det.Percentage), recommendation: rec})
+		}
+	}
+	return findings
+}
+
+// teamResolver finds the teams owning a finding: the configured team whose
+// import path covers the function's package most closely, else the owners
+// the input already carried, else the CODEOWNERS of its source file or
+// package directory under the repo root.
+type teamResolver struct {
+	packages  map[string][]string
+	owners    *CodeOwners
+	repoRoot  string
+	modules   []repoModule
+	byPackage map[string][]string
+}
+
+func newTeamResolver(repoRoot string, teams map[string][]string) *teamResolver {
+	r := &teamResolver{packages: teams, byPackage: map[string][]string{}}
+	if repoRoot == "" {
+		return r
+	}
+	if abs, err := filepath.Abs(repoRoot); err == nil {
+		repoRoot = abs
+	}
+	if owners, err := LoadCodeOwners(repoRoot); err == nil && owners != nil {
+		r.owners = owners
+		r.repoRoot = repoRoot
+		r.modules = repoModules(repoRoot)
+	}
+	return r
+}
+
+func (r *teamResolver) teams(f teamFinding) []string {
+	pkg := functionPackagePath(f.function)
+	if team := r.configuredTeam(pkg); team != "" {
+		return []string{team}
+	}
+	if len(f.owners) > 0 {
+		return f.owners
+	}
+	if r.owners == nil {
+		return nil
+	}
+	if f.location != "" {
+		file := sourceLineSuffix.ReplaceAllString(f.location, "")
+		if rel, ok := repoRelative(r.repoRoot, nil, file); ok {
+			if owners := r.owners.Owners(rel); len(owners) > 0 {
+				return owners
+			}
+		}
+	}
+	return r.packageOwners(pkg)
+}
+
+// configuredTeam returns the team whose longest import path covers pkg.
+func (r *teamResolver) configuredTeam(pkg string) string {
+	if pkg == "" {
+		return ""
+	}
+	best, bestLen := "", -1
+	for team, paths := range r.packages {
+		for _, path := range paths {
+			path = strings.TrimSuffix(strings.TrimSuffix(strings.TrimSpace(path), "/..."), "/")
+			if path == "" || (pkg != path && !strings.HasPrefix(pkg, path+"/")) {
+				continue
+			}
+			if len(path) > bestLen || (len(path) == bestLen && team < best) {
+				best, bestLen = team, len(path)
+			}
+		}
+	}
+	return best
+}
+
+// packageOwners returns the CODEOWNERS of a repo package: those of its
+// first Go file, so patterns on file names apply, else of its directory.
+func (r *teamResolver) packageOwners(pkg string) []string {
+	if owners, ok := r.byPackage[pkg]; ok {
+		return owners
+	}
+	var owners []string
+	if dir, ok := packageDir(pkg, r.modules); ok {
+		rel := dir
+		if entries, err := os.ReadDir(filepath.Join(r.repoRoot, filepath.FromSlash(dir))); err == nil {
+			for _, entry := range entries {
+				if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".go") {
+					rel = strings.TrimPrefix(dir+"/"+entry.Name(), "/")
+					break
+				}
+			}
+		}
+		if rel != "" {
+			owners = r.owners.Owners(rel)
+		}
+	}
+	r.byPackage[pkg] = owners
+	return owners
+}
+
+// packageDir maps an import path onto its repo-relative directory through
+// the longest module path covering it; "" is the repo root.
+func packageDir(pkg string, modules []repoModule) (string, bool) {
+	best := -1
+	for i, module := range modules {
+		if (pkg == module.path || strings.HasPrefix(pkg, module.path+"/")) && (best < 0 || len(module.path) > len(modules[best].path)) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return "", false
+	}
+	rel := strings.TrimPrefix(strings.TrimPrefix(pkg, modules[best].path), "/")
+	if modules[best].dir != "" {
+		rel = strings.TrimSuffix(modules[best].dir+"/"+rel, "/")
+	}
+	return rel, true
+}
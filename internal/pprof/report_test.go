@@ -0,0 +1,113 @@
+package pprof
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateReportDiffTopAndHotspots(t *testing.T) {
+	goroutines := 42
+	report, err := GenerateReport(ReportParams{
+		Title: "Branch impact",
+		Inputs: []ReportInput{
+			{
+				Kind:  "diff_top",
+				Title: "api cpu changes",
+				Data: map[string]any{"deltas": []any{
+					map[string]any{"name": "main.slower", "before_flat": "1s", "after_flat": "3s", "delta_seconds": 2.0},
+					map[string]any{"name": "main.same", "before_flat": "1s", "after_flat": "1s", "delta_seconds": 0.0},
+					map[string]any{"name": "main.removed", "before_flat": "500ms", "delta_seconds": -0.5},
+				}},
+			},
+			{
+				Kind: "hotspot_summary",
+				Data: map[string]any{
+					"cpu_top5":        []any{map[string]any{"function": "main.slower", "flat_pct": 60.0}},
+					"goroutine_count": goroutines,
+				},
+			},
+			// Nothing changed: no section
+			{Kind: "diff_top", Data: map[string]any{"deltas": []any{}}},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, report.SectionCount)
+	require.Contains(t, report.Markdown, "## api cpu changes\n")
+	require.Contains(t, report.Markdown, "| main.slower | 1s | 3s | +2.00s |")
+	require.Contains(t, report.Markdown, "| main.removed | 500ms | - | -0.50s |")
+	require.NotContains(t, report.Markdown, "main.same")
+	require.Contains(t, report.Markdown, "## Hotspots\n- Goroutines: 42")
+	require.Contains(t, report.Markdown, "| cpu | main.slower | 60.0% |")
+}
+
+func TestGenerateReportByTeam(t *testing.T) {
+	repoRoot := t.TempDir()
+	files := map[string]string{
+		"go.mod":                  "module github.com/acme/app\n",
+		"CODEOWNERS":              "/ledger/ @acme/ledger\n",
+		"ledger/ledger.go":        "package ledger\n",
+		"payments/payments.go":    "package payments\n",
+		"payments/fees/fees.go":   "package fees\n",
+		"internal/cache/cache.go": "package cache\n",
+	}
+	for file, content := range files {
+		path := filepath.Join(repoRoot, filepath.FromSlash(file))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	report, err := GenerateReport(ReportParams{
+		Title:    "Weekly",
+		GroupBy:  "team",
+		RepoRoot: repoRoot,
+		Teams: map[string][]string{
+			"payments": {"github.com/acme/app/payments"},
+			"fees":     {"github.com/acme/app/payments/fees/..."},
+		},
+		Inputs: []ReportInput{
+			{Kind: "top", Data: map[string]any{"rows": []any{
+				map[string]any{"name": "github.com/acme/app/ledger.(*Book).Post", "flat_pct": "30.00%"},
+				map[string]any{"name": "github.com/acme/app/payments.Charge", "flat_pct": "20.00%"},
+				map[string]any{"name": "github.com/acme/app/payments/fees.Compute", "flat_pct": "10.00%"},
+				map[string]any{"name": "github.com/acme/app/internal/cache.Get", "flat_pct": "5.00%"},
+			}}},
+			{Kind: "pprof.overhead_report", Data: map[string]any{"detections": []any{
+				map[string]any{"category": "json", "percentage": 12.0, "top_functions": []any{"github.com/acme/app/payments.Charge"}, "suggestion": "Cache the encoder"},
+			}}},
+			// main.run is attributed by hotspot_summary itself.
+			{Kind: "hotspot_summary", Data: map[string]any{"cpu_top5": []any{
+				map[string]any{"function": "github.com/acme/app/payments.Charge", "flat_pct": 20.0},
+				map[string]any{"function": "main.run", "flat_pct": 4.0, "owners": []any{"@acme/platform"}},
+			}}},
+			{Kind: "memory_sanity", Data: map[string]any{"summary": "RSS is stable"}},
+		},
+	})
+	require.NoError(t, err)
+
+	teams := map[string]TeamReport{}
+	var order []string
+	for _, team := range report.Teams {
+		teams[team.Team] = team
+		order = append(order, team.Team)
+	}
+	require.Equal(t, []string{"@acme/ledger", "@acme/platform", "fees", "payments", "Unowned"}, order)
+	require.Equal(t, 3, teams["payments"].Hotspots)
+	require.True(t, strings.HasPrefix(teams["payments"].Markdown, "# Weekly: payments\n\n"))
+	require.Contains(t, teams["payments"].Markdown, "| json | github.com/acme/app/payments.Charge | 12.0% | - |")
+	require.Contains(t, teams["payments"].Markdown, "**Recommendations**\n- json (12.0%): Cache the encoder")
+	require.NotContains(t, teams["payments"].Markdown, "fees.Compute")
+	require.Contains(t, teams["fees"].Markdown, "fees.Compute")
+	require.Contains(t, teams["@acme/ledger"].Markdown, "ledger.(*Book).Post")
+	require.Contains(t, teams["@acme/platform"].Markdown, "main.run")
+	require.Contains(t, teams["Unowned"].Markdown, "cache.Get")
+
+	require.Equal(t, 6, report.SectionCount)
+	require.Contains(t, report.Markdown, "## payments\n| Kind |")
+	require.Contains(t, report.Markdown, "## Memory Sanity\n- Summary: RSS is stable")
+
+	_, err = GenerateReport(ReportParams{GroupBy: "service", Inputs: []ReportInput{{Kind: "top"}}})
+	require.ErrorContains(t, err, "unknown group_by")
+}
@@ -0,0 +1,77 @@
+package pprof
+
+import (
+	"fmt"
+	"strings"
+)
+
+// kindSampleIndexes lists, per detected profile kind, the sample types to
+// analyze by when the caller names none, in order of preference.
+var kindSampleIndexes = map[string][]string{
+	"cpu":       {"cpu", "samples"},
+	"heap":      {"inuse_space"},
+	"mutex":     {"delay", "contentions"},
+	"block":     {"delay", "contentions"},
+	"goroutine": {"goroutine", "goroutines"},
+}
+
+// SampleIndexChoice is the sample index a tool call runs with.
+type SampleIndexChoice struct {
+	SampleIndex string   `json:"sample_index"`
+	Kind        string   `json:"kind"`
+	Source      string   `json:"source"` // "requested" or "kind_default"
+	Available   []string `json:"available"`
+}
+
+// SampleIndexError is returned for a sample index the profile does not have.
+type SampleIndexError struct {
+	Profile   string
+	Requested string
+	Kind      string
+	Available []string
+}
+
+func (e *SampleIndexError) Error() string {
+	return fmt.Sprintf("sample_index %q is not a sample type of %s (a %s profile); available: %s",
+		e.Requested, e.Profile, e.Kind, strings.Join(e.Available, ", "))
+}
+
+// ResolveSampleIndex checks requested against the sample types of the profile
+// at profilePath, accepting what pprof accepts: a type name, a legacy
+// inuse_-prefixed name, or a position. When requested is empty it picks the
+// default for the profile's kind; an empty SampleIndex in the result means
+// the kind has none and pprof's own default applies.
+func ResolveSampleIndex(profilePath, requested string) (SampleIndexChoice, error) {
+	prof, err := parseProfile(profilePath)
+	if err != nil {
+		return SampleIndexChoice{}, err
+	}
+	choice := SampleIndexChoice{Kind: detectKind(profilePath, prof)}
+	for _, st := range prof.SampleType {
+		choice.Available = append(choice.Available, st.Type)
+	}
+
+	requested = strings.TrimPrefix(strings.TrimSpace(requested), "sample_index=")
+	if requested == "" {
+		for _, name := range kindSampleIndexes[choice.Kind] {
+			if findSampleIndexExact(prof, name) >= 0 {
+				choice.SampleIndex = name
+				choice.Source = "kind_default"
+				break
+			}
+		}
+		return choice, nil
+	}
+
+	choice.SampleIndex = requested
+	choice.Source = "requested"
+	if _, err := prof.SampleIndexByName(requested); err == nil {
+		return choice, nil
+	}
+	return SampleIndexChoice{}, &SampleIndexError{
+		Profile:   profilePath,
+		Requested: requested,
+		Kind:      choice.Kind,
+		Available: choice.Available,
+	}
+}
@@ -0,0 +1,69 @@
+package pprof
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/require"
+)
+
+func writeSampleTypesProfile(t *testing.T, path string, types ...string) {
+	t.Helper()
+	fn := &profile.Function{ID: 1, Name: "main.f"}
+	loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+	prof := &profile.Profile{
+		Sample:   []*profile.Sample{{Location: []*profile.Location{loc}, Value: make([]int64, len(types))}},
+		Location: []*profile.Location{loc},
+		Function: []*profile.Function{fn},
+	}
+	for _, typ := range types {
+		prof.SampleType = append(prof.SampleType, &profile.ValueType{Type: typ, Unit: "count"})
+	}
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, prof.Write(file))
+	require.NoError(t, file.Close())
+}
+
+func TestResolveSampleIndex(t *testing.T) {
+	dir := t.TempDir()
+	heap := filepath.Join(dir, "heap.pprof")
+	writeSampleTypesProfile(t, heap, "alloc_objects", "alloc_space", "inuse_objects", "inuse_space")
+	mutex := filepath.Join(dir, "mutex.pprof")
+	writeSampleTypesProfile(t, mutex, "contentions", "delay")
+
+	choice, err := ResolveSampleIndex(heap, "")
+	require.NoError(t, err)
+	require.Equal(t, "inuse_space", choice.SampleIndex)
+	require.Equal(t, "heap", choice.Kind)
+	require.Equal(t, "kind_default", choice.Source)
+
+	choice, err = ResolveSampleIndex(mutex, "")
+	require.NoError(t, err)
+	require.Equal(t, "delay", choice.SampleIndex)
+
+	for _, requested := range []string{"alloc_space", "sample_index=alloc_space", "3"} {
+		choice, err = ResolveSampleIndex(heap, requested)
+		require.NoError(t, err, requested)
+		require.Equal(t, "requested", choice.Source)
+	}
+
+	for _, requested := range []string{"cpu", "4"} {
+		_, err = ResolveSampleIndex(heap, requested)
+		var indexErr *SampleIndexError
+		require.True(t, errors.As(err, &indexErr), requested)
+		require.Equal(t, []string{"alloc_objects", "alloc_space", "inuse_objects", "inuse_space"}, indexErr.Available)
+		require.Equal(t, "heap", indexErr.Kind)
+	}
+
+	// A kind with no preferred type present leaves pprof's default.
+	other := filepath.Join(dir, "custom.pprof")
+	writeSampleTypesProfile(t, other, "widgets")
+	choice, err = ResolveSampleIndex(other, "")
+	require.NoError(t, err)
+	require.Empty(t, choice.SampleIndex)
+	require.Equal(t, []string{"widgets"}, choice.Available)
+}
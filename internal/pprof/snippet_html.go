@@ -0,0 +1,192 @@
+package pprof
+
+import (
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"html"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/arreyder/pprof-mcp/internal/pprofparse"
+)
+
+// Snippet formats.
+const (
+	SnippetFormatText = "text"
+	SnippetFormatHTML = "html"
+)
+
+// Token colors, as inline styles so fragments need no stylesheet.
+const (
+	htmlKeywordStyle = "color:#0033b3;font-weight:bold"
+	htmlStringStyle  = "color:#067d17"
+	htmlCommentStyle = "color:#8c8c8c;font-style:italic"
+	htmlNumberStyle  = "color:#1750eb"
+	htmlBuiltinStyle = "color:#871094"
+)
+
+const htmlTableStyle = "border-collapse:collapse;font-family:ui-monospace,SFMono-Regular,Menlo,monospace;font-size:12px"
+
+var goBuiltins = map[string]bool{
+	"append": true, "cap": true, "clear": true, "close": true, "complex": true, "copy": true, "delete": true,
+	"imag": true, "len": true, "make": true, "max": true, "min": true, "new": true, "panic": true, "print": true,
+	"println": true, "real": true, "recover": true, "nil": true, "true": true, "false": true, "iota": true,
+}
+
+var (
+	listSourceLine  = regexp.MustCompile(`^\s*(\S+)\s+(\S+)\s+(\d+):(.*)$`)
+	listTotalLine   = regexp.MustCompile(`^Total:\s+(\S+)`)
+	snippetLineForm = regexp.MustCompile(`^(>>>)?(\d+): ?(.*)$`)
+)
+
+// HighlightGo returns one line of Go source as HTML with its tokens colored.
+// Text the scanner cannot place, such as the inside of a raw string that
+// began on an earlier line, is escaped as is.
+func HighlightGo(line string) string {
+	src := []byte(line)
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+	var s scanner.Scanner
+	s.Init(file, src, func(token.Position, string) {}, scanner.ScanComments)
+
+	var b strings.Builder
+	last := 0
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.SEMICOLON && lit == "\n" {
+			continue // inserted by the scanner, not in the source
+		}
+		start := file.Offset(pos)
+		text := lit
+		if text == "" {
+			text = tok.String()
+		}
+		end := min(start+len(text), len(src))
+		if start < last || start > len(src) {
+			continue
+		}
+		b.WriteString(html.EscapeString(line[last:start]))
+		style := ""
+		switch {
+		case tok.IsKeyword():
+			style = htmlKeywordStyle
+		case tok == token.STRING || tok == token.CHAR:
+			style = htmlStringStyle
+		case tok == token.COMMENT:
+			style = htmlCommentStyle
+		case tok == token.INT || tok == token.FLOAT || tok == token.IMAG:
+			style = htmlNumberStyle
+		case tok == token.IDENT && goBuiltins[lit]:
+			style = htmlBuiltinStyle
+		}
+		if style != "" {
+			fmt.Fprintf(&b, `<span style="%s">%s</span>`, style, html.EscapeString(line[start:end]))
+		} else {
+			b.WriteString(html.EscapeString(line[start:end]))
+		}
+		last = end
+	}
+	b.WriteString(html.EscapeString(line[last:]))
+	return b.String()
+}
+
+// heatStyle shades a line by its share of the profile's total: the hotter,
+// the more opaque.
+func heatStyle(pct float64) string {
+	if pct <= 0 {
+		return ""
+	}
+	alpha := min(0.7, 0.12+pct/25)
+	return fmt.Sprintf("background:rgba(255,87,34,%.2f)", alpha)
+}
+
+// ListHTML renders pprof -list output as an HTML fragment: one table per
+// ROUTINE with highlighted source, each line shaded by its flat share of
+// the profile's total.
+func ListHTML(raw string) string {
+	total := 0.0
+	var b strings.Builder
+	open := false
+	closeTable := func() {
+		if open {
+			b.WriteString("</table>\n")
+			open = false
+		}
+	}
+	for _, line := range strings.Split(raw, "\n") {
+		if m := listTotalLine.FindStringSubmatch(line); m != nil {
+			total, _ = parseListQuantity(m[1])
+			continue
+		}
+		if strings.HasPrefix(line, "ROUTINE ") {
+			closeTable()
+			title := strings.TrimSpace(strings.TrimLeft(strings.TrimPrefix(line, "ROUTINE "), "= "))
+			fmt.Fprintf(&b, "<table class=\"pprof-source\" style=\"%s\">\n<caption style=\"text-align:left;font-weight:bold\">%s</caption>\n", htmlTableStyle, html.EscapeString(title))
+			b.WriteString("<tr><th style=\"text-align:right;padding:0 6px\">flat</th><th style=\"text-align:right;padding:0 6px\">cum</th><th></th><th></th></tr>\n")
+			open = true
+			continue
+		}
+		m := listSourceLine.FindStringSubmatch(line)
+		if m == nil || !open {
+			continue
+		}
+		pct := 0.0
+		if flat, ok := parseListQuantity(m[1]); ok && total > 0 {
+			pct = flat / total * 100
+		}
+		writeSourceRow(&b, m[1], m[2], m[3], m[4], pct)
+	}
+	closeTable()
+	return b.String()
+}
+
+// SnippetHTML renders a trace_source snippet, whose hot line is marked
+// ">>>", as an HTML fragment with the hot line shaded by flatPct.
+func SnippetHTML(snippet string, flatPct float64) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<table class=\"pprof-source\" style=\"%s\">\n", htmlTableStyle)
+	for _, line := range strings.Split(snippet, "\n") {
+		m := snippetLineForm.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		pct, flat := 0.0, ""
+		if m[1] != "" {
+			pct, flat = math.Max(flatPct, 0.01), strconv.FormatFloat(flatPct, 'f', -1, 64)+"%"
+		}
+		writeSourceRow(&b, flat, "", m[2], m[3], pct)
+	}
+	b.WriteString("</table>\n")
+	return b.String()
+}
+
+func writeSourceRow(b *strings.Builder, flat, cum, lineNo, src string, pct float64) {
+	if flat == "." {
+		flat = ""
+	}
+	if cum == "." {
+		cum = ""
+	}
+	style := heatStyle(pct)
+	if style != "" {
+		fmt.Fprintf(b, "<tr style=\"%s\" title=\"flat %.2f%%\">", style, pct)
+	} else {
+		b.WriteString("<tr>")
+	}
+	fmt.Fprintf(b, "<td style=\"text-align:right;padding:0 6px\">%s</td><td style=\"text-align:right;padding:0 6px\">%s</td>", html.EscapeString(flat), html.EscapeString(cum))
+	fmt.Fprintf(b, "<td style=\"text-align:right;padding:0 6px;color:#999\">%s</td>", lineNo)
+	fmt.Fprintf(b, "<td style=\"white-space:pre\">%s</td></tr>\n", HighlightGo(src))
+}
+
+// parseListQuantity reads a pprof value such as 10ms, 1.50s, 12.5MB, or
+// 300 in its canonical unit (seconds, bytes, or a count).
+func parseListQuantity(value string) (float64, bool) {
+	quantity, ok := pprofparse.ParseQuantity(value)
+	return quantity.Value, ok
+}
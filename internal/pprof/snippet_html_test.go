@@ -0,0 +1,37 @@
+package pprof
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHighlightGo(t *testing.T) {
+	require.Equal(t,
+		`<span style="color:#0033b3;font-weight:bold">for</span> i := <span style="color:#1750eb">0</span>; i &lt; <span style="color:#871094">len</span>(s); i++ { <span style="color:#8c8c8c;font-style:italic">// &#34;hot&#34;</span>`,
+		HighlightGo(`for i := 0; i < len(s); i++ { // "hot"`))
+	require.Equal(t, `	x := <span style="color:#067d17">&#34;a&lt;b&#34;</span>`, HighlightGo("\tx := \"a<b\""))
+	// A line inside a raw string that started earlier is escaped, not dropped.
+	require.Contains(t, HighlightGo("still <raw> text`"), "&lt;raw&gt;")
+}
+
+func TestListHTML(t *testing.T) {
+	list := `Total: 1s
+ROUTINE ======================== main.spin in /src/main.go
+     100ms      890ms (flat, cum) 89.00% of Total
+         .          .     10:func spin(d time.Duration) {
+     100ms      890ms     14:	for time.Now().Before(end) {
+`
+	out := ListHTML(list)
+	require.Equal(t, 1, strings.Count(out, "<table"))
+	require.Contains(t, out, `<caption style="text-align:left;font-weight:bold">main.spin in /src/main.go</caption>`)
+	// 100ms of 1s is 10% flat: shaded, and labeled in the row title.
+	require.Contains(t, out, `<tr style="background:rgba(255,87,34,0.52)" title="flat 10.00%">`)
+	require.Contains(t, out, `<td style="text-align:right;padding:0 6px;color:#999">10</td>`)
+	require.Equal(t, 1, strings.Count(out, "background:"))
+
+	snippet := SnippetHTML("13: \tend := 0\n>>>14: \tfor {\n15: \t}", 2.5)
+	require.Equal(t, 3, strings.Count(snippet, "<tr"))
+	require.Contains(t, snippet, `title="flat 2.50%"><td style="text-align:right;padding:0 6px">2.5%</td>`)
+}
@@ -3,7 +3,8 @@ package pprof
 import (
 	"context"
 	"fmt"
-	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/google/pprof/profile"
@@ -19,34 +20,58 @@ type StorylinesParams struct {
 	Ignore       string
 	RepoPrefixes []string
 	RepoRoot     string
-	TrimPath     string
+	TrimPath     string // default: inferred from the profile's paths and RepoRoot
 	SampleIndex  string // Optional: if empty, auto-detects based on profile type
+	Format       string // "markdown" also lists the leaf and renders Markdown
 	MaxLines     int
 	MaxBytes     int
 	Strategy     string
+	// SnippetFormat "html" adds list evidence as highlighted HTML.
+	SnippetFormat string
+	// Revision is the profiled commit permalinks point at; default: HEAD
+	// of RepoRoot.
+	Revision string
+
+	trimInference *TrimPathInference // inferred once for every list
 }
 
 type StorylinesResult struct {
 	Command    string      `json:"command"`
 	Storylines []Storyline `json:"storylines"`
-	Warnings   []string    `json:"warnings,omitempty"`
+	Markdown   string      `json:"markdown,omitempty"`
+	// RepoPrefixes identified app-owned frames: the repo_prefix arguments,
+	// else the go.mod and go.work modules at RepoRoot, else built-in defaults
+	RepoPrefixes []string `json:"repo_prefixes,omitempty"`
+	// TrimPathInference is set when trim_path was inferred rather than given.
+	TrimPathInference *TrimPathInference `json:"trim_path_inference,omitempty"`
+	// CodeOwners is the CODEOWNERS file under RepoRoot storylines are
+	// attributed with.
+	CodeOwners string         `json:"codeowners,omitempty"`
+	Permalinks *PermalinkBase `json:"permalinks,omitempty"`
+	Warnings   []string       `json:"warnings,omitempty"`
 }
 
 type Storyline struct {
-	LeafHotspot string            `json:"leaf_hotspot"`
-	Cum         string            `json:"cum"`
-	CumPct      string            `json:"cum_pct"`
-	CallChain   []string          `json:"call_chain"`
-	FirstApp    string            `json:"first_app_frame"`
-	Evidence    StorylineEvidence `json:"evidence"`
-	Warnings    []string          `json:"warnings,omitempty"`
+	LeafHotspot string   `json:"leaf_hotspot"`
+	Cum         string   `json:"cum"`
+	CumPct      string   `json:"cum_pct"`
+	CallChain   []string `json:"call_chain"`
+	// CallChainPermalinks link each CallChain frame's line on the code
+	// host, "" for frames outside the repo and github.com modules.
+	CallChainPermalinks []string `json:"call_chain_permalinks,omitempty"`
+	FirstApp            string   `json:"first_app_frame"`
+	// Owners are the CODEOWNERS of the first app frame, else of the leaf.
+	Owners   []string          `json:"owners,omitempty"`
+	Evidence StorylineEvidence `json:"evidence"`
+	Warnings []string          `json:"warnings,omitempty"`
 }
 
 type StorylineEvidence struct {
-	TopRow   map[string]any `json:"top_row"`
-	PeekLeaf EvidenceOutput `json:"peek_leaf"`
-	PeekApp  EvidenceOutput `json:"peek_first_app"`
-	ListApp  EvidenceOutput `json:"list_first_app"`
+	TopRow   map[string]any  `json:"top_row"`
+	PeekLeaf EvidenceOutput  `json:"peek_leaf"`
+	PeekApp  EvidenceOutput  `json:"peek_first_app"`
+	ListApp  EvidenceOutput  `json:"list_first_app"`
+	ListLeaf *EvidenceOutput `json:"list_leaf,omitempty"`
 }
 
 type EvidenceOutput struct {
@@ -54,6 +79,7 @@ type EvidenceOutput struct {
 	Raw       string                `json:"raw"`
 	Truncated bool                  `json:"truncated"`
 	RawMeta   textutil.TruncateMeta `json:"raw_meta,omitempty"`
+	HTML      string                `json:"html,omitempty"` // list evidence, with snippet_format html
 }
 
 func RunStorylines(ctx context.Context, params StorylinesParams) (StorylinesResult, error) {
@@ -71,7 +97,7 @@ func RunStorylines(ctx context.Context, params StorylinesParams) (StorylinesResu
 		count = 6
 	}
 
-	repoPrefixes := params.RepoPrefixes
+	repoPrefixes := resolveRepoPrefixes(params.RepoPrefixes, params.RepoRoot)
 	if len(repoPrefixes) == 0 {
 		repoPrefixes = []string{"gitlab.com/ductone/c1", "github.com/conductorone"}
 	}
@@ -103,19 +129,75 @@ func RunStorylines(ctx context.Context, params StorylinesParams) (StorylinesResu
 	// Find the value index matching our sample_index for call chain analysis
 	defaultIndex := findSampleIndex(prof, sampleIndex)
 
+	if params.TrimPath == "" {
+		repoRoot := params.RepoRoot
+		if repoRoot == "" {
+			repoRoot = "."
+		}
+		inference := InferTrimPath(prof, repoRoot)
+		params.trimInference = &inference
+	}
+
+	var warnings []string
+	owners, err := newOwnership(params.RepoRoot, storylineTrims(params))
+	if err != nil {
+		warnings = append(warnings, fmt.Sprintf("owner attribution: %v", err))
+	}
+	var owned attribution
+	if owners != nil {
+		owned = owners.attribute(prof, defaultIndex)
+	}
+	links, warning := permalinksFor(ctx, params.RepoRoot, params.Revision, storylineTrims(params))
+	if warning != "" {
+		warnings = append(warnings, warning)
+	}
+
 	storylines := []Storyline{}
 	for _, row := range topReport.Rows {
 		if len(storylines) >= count {
 			break
 		}
-		storyline := buildStoryline(ctx, row, prof, defaultIndex, repoPrefixes, params, sampleIndex)
+		storyline := buildStoryline(ctx, row, prof, defaultIndex, repoPrefixes, params, sampleIndex, links)
+		if owners != nil {
+			if storyline.FirstApp != "" {
+				storyline.Owners = owners.functionOwners(prof, owned, storyline.FirstApp)
+			}
+			if len(storyline.Owners) == 0 {
+				storyline.Owners = owners.functionOwners(prof, owned, storyline.LeafHotspot)
+			}
+		}
 		storylines = append(storylines, storyline)
 	}
 
-	return StorylinesResult{
-		Command:    topReport.Command,
-		Storylines: storylines,
-	}, nil
+	result := StorylinesResult{
+		Command:      topReport.Command,
+		Storylines:   storylines,
+		RepoPrefixes: repoPrefixes,
+
+		TrimPathInference: params.trimInference,
+		Permalinks:        links.base(),
+		Warnings:          warnings,
+	}
+	if owners != nil {
+		result.CodeOwners = owners.owners.Path
+	}
+	if params.Format == "markdown" {
+		result.Markdown = FormatStorylinesMarkdown(result)
+	}
+	return result, nil
+}
+
+// storylineTrims are the prefixes that map the profile's paths onto
+// RepoRoot: trim_path as given, else as inferred.
+func storylineTrims(params StorylinesParams) []string {
+	if params.trimInference == nil {
+		return filepath.SplitList(params.TrimPath)
+	}
+	var trims []string
+	for _, prefix := range params.trimInference.Prefixes {
+		trims = append(trims, prefix.Prefix)
+	}
+	return trims
 }
 
 // detectBestSampleIndex returns the best sample index for analysis based on profile type.
@@ -160,11 +242,11 @@ func findSampleIndex(prof *profile.Profile, sampleType string) int {
 	return 0
 }
 
-func buildStoryline(ctx context.Context, row pprofparse.TopRow, prof *profile.Profile, valueIndex int, prefixes []string, params StorylinesParams, sampleIndex string) Storyline {
+func buildStoryline(ctx context.Context, row pprofparse.TopRow, prof *profile.Profile, valueIndex int, prefixes []string, params StorylinesParams, sampleIndex string, links *permalinks) Storyline {
 	warnings := []string{}
 	leaf := row.Name
 
-	chain, firstApp := findCallChain(prof, leaf, valueIndex, prefixes)
+	chain, lines, firstApp := findCallChain(prof, leaf, valueIndex, prefixes)
 	if len(chain) == 0 {
 		warnings = append(warnings, "no call chain inferred; leaf not found in samples")
 	}
@@ -181,13 +263,26 @@ func buildStoryline(ctx context.Context, row pprofparse.TopRow, prof *profile.Pr
 			listApp = runEvidenceList(ctx, params.Profile, firstApp, params)
 		}
 	}
+	var listLeaf *EvidenceOutput
+	if params.Format == "markdown" && params.RepoRoot != "" && leaf != firstApp {
+		evidence := runEvidenceList(ctx, params.Profile, leaf, params)
+		listLeaf = &evidence
+	}
+
+	var chainLinks []string
+	if links != nil {
+		for _, line := range lines {
+			chainLinks = append(chainLinks, links.link(line.Function.Filename, int(line.Line)))
+		}
+	}
 
 	return Storyline{
-		LeafHotspot: leaf,
-		Cum:         row.Cum,
-		CumPct:      row.CumPct,
-		CallChain:   chain,
-		FirstApp:    firstApp,
+		LeafHotspot:         leaf,
+		Cum:                 row.Cum,
+		CumPct:              row.CumPct,
+		CallChain:           chain,
+		CallChainPermalinks: chainLinks,
+		FirstApp:            firstApp,
 		Evidence: StorylineEvidence{
 			TopRow: map[string]any{
 				"flat":     row.Flat,
@@ -200,26 +295,22 @@ func buildStoryline(ctx context.Context, row pprofparse.TopRow, prof *profile.Pr
 			PeekLeaf: peekLeaf,
 			PeekApp:  peekApp,
 			ListApp:  listApp,
+			ListLeaf: listLeaf,
 		},
 		Warnings: warnings,
 	}
 }
 
-func parseProfile(path string) (*profile.Profile, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-	return profile.Parse(file)
-}
-
-func findCallChain(prof *profile.Profile, leaf string, valueIndex int, prefixes []string) ([]string, string) {
+// findCallChain returns the heaviest stack through leaf, root first and cut
+// to its last 12 frames, the source line of each frame, and the first app
+// frame.
+func findCallChain(prof *profile.Profile, leaf string, valueIndex int, prefixes []string) ([]string, []profile.Line, string) {
 	var bestChain []string
+	var bestLines []profile.Line
 	var bestFirstApp string
 	var bestValue int64
 	for _, sample := range prof.Sample {
-		stack := sampleStack(sample)
+		stack, lines := sampleStack(sample)
 		if !stackContains(stack, leaf) {
 			continue
 		}
@@ -230,31 +321,36 @@ func findCallChain(prof *profile.Profile, leaf string, valueIndex int, prefixes
 		if value > bestValue {
 			bestValue = value
 			bestChain = stack
+			bestLines = lines
 			bestFirstApp = firstAppFrame(stack, prefixes)
 		}
 	}
 
 	if len(bestChain) == 0 {
-		return nil, ""
+		return nil, nil, ""
 	}
 
 	reverse(bestChain)
+	slices.Reverse(bestLines)
 	if len(bestChain) > 12 {
 		bestChain = bestChain[len(bestChain)-12:]
+		bestLines = bestLines[len(bestLines)-12:]
 	}
-	return bestChain, bestFirstApp
+	return bestChain, bestLines, bestFirstApp
 }
 
-func sampleStack(sample *profile.Sample) []string {
+func sampleStack(sample *profile.Sample) ([]string, []profile.Line) {
 	frames := []string{}
+	lines := []profile.Line{}
 	for _, loc := range sample.Location {
 		name := functionName(loc)
 		if name == "" {
 			continue
 		}
 		frames = append(frames, name)
+		lines = append(lines, loc.Line[0])
 	}
-	return frames
+	return frames, lines
 }
 
 func functionName(loc *profile.Location) string {
@@ -302,12 +398,18 @@ func runEvidenceList(ctx context.Context, profilePath, symbol string, params Sto
 		Function: symbol,
 		RepoRoot: params.RepoRoot,
 		TrimPath: params.TrimPath,
+
+		trimInference: params.trimInference,
 	})
 	if err != nil {
 		return EvidenceOutput{}
 	}
 	trimmed, meta := applyEvidenceTruncation(result.Raw, result.RawMeta, params)
-	return EvidenceOutput{Command: result.Command, Raw: trimmed, RawMeta: meta, Truncated: meta.Truncated}
+	evidence := EvidenceOutput{Command: result.Command, Raw: trimmed, RawMeta: meta, Truncated: meta.Truncated}
+	if params.SnippetFormat == SnippetFormatHTML {
+		evidence.HTML = ListHTML(trimmed)
+	}
+	return evidence
 }
 
 func applyEvidenceTruncation(raw string, base textutil.TruncateMeta, params StorylinesParams) (string, textutil.TruncateMeta) {
@@ -315,64 +417,11 @@ func applyEvidenceTruncation(raw string, base textutil.TruncateMeta, params Stor
 	if maxBytes <= 0 {
 		maxBytes = 4000
 	}
-	result := textutil.TruncateText(raw, textutil.TruncateOptions{
+	return textutil.ApplyLimits(raw, &base, textutil.TruncateOptions{
 		MaxLines: params.MaxLines,
 		MaxBytes: maxBytes,
-		Strategy: parseStrategy(params.Strategy),
+		Strategy: textutil.ParseStrategy(params.Strategy),
 	})
-	meta := mergeTruncateMeta(base, result.Meta)
-	return result.Text, meta
-}
-
-func mergeTruncateMeta(base, extra textutil.TruncateMeta) textutil.TruncateMeta {
-	merged := base
-	if merged.TotalBytes == 0 {
-		merged.TotalBytes = extra.TotalBytes
-	}
-	if merged.TotalLines == 0 {
-		merged.TotalLines = extra.TotalLines
-	}
-	merged.Truncated = base.Truncated || extra.Truncated
-	merged.TruncatedReason = mergeReasons(base.TruncatedReason, extra.TruncatedReason)
-	if extra.Strategy != "" {
-		merged.Strategy = extra.Strategy
-	} else if merged.Strategy == "" {
-		merged.Strategy = base.Strategy
-	}
-	if !merged.Truncated {
-		merged.TruncatedReason = ""
-	}
-	return merged
-}
-
-func mergeReasons(reasons ...string) string {
-	seen := map[string]struct{}{}
-	ordered := make([]string, 0, len(reasons))
-	for _, reason := range reasons {
-		for _, item := range strings.Split(reason, ",") {
-			item = strings.TrimSpace(item)
-			if item == "" {
-				continue
-			}
-			if _, ok := seen[item]; ok {
-				continue
-			}
-			seen[item] = struct{}{}
-			ordered = append(ordered, item)
-		}
-	}
-	return strings.Join(ordered, ",")
-}
-
-func parseStrategy(raw string) textutil.TruncateStrategy {
-	switch strings.ToLower(strings.TrimSpace(raw)) {
-	case string(textutil.StrategyTail):
-		return textutil.StrategyTail
-	case string(textutil.StrategyHeadTail):
-		return textutil.StrategyHeadTail
-	default:
-		return textutil.StrategyHead
-	}
 }
 
 func reverse(items []string) {
@@ -0,0 +1,148 @@
+package pprof
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	snippetContext  = 2
+	snippetMaxLines = 40
+)
+
+// FormatStorylinesMarkdown renders each storyline as a section with its call
+// chain and an annotated source snippet, for pasting into incident docs.
+func FormatStorylinesMarkdown(result StorylinesResult) string {
+	var b strings.Builder
+	b.WriteString("# Storylines\n\n")
+	writeStorylinesMarkdown(&b, result, "##")
+	return b.String()
+}
+
+// writeStorylinesMarkdown writes the storylines under headings of the given
+// level, so a report can nest them in its own section.
+func writeStorylinesMarkdown(b *strings.Builder, result StorylinesResult, heading string) {
+	if result.Command != "" {
+		fmt.Fprintf(b, "Source: `%s`\n", result.Command)
+	}
+	if links := result.Permalinks; links != nil {
+		fmt.Fprintf(b, "Links: %s at `%.12s`", links.Repository, links.Revision)
+		if links.FromHead {
+			b.WriteString(" (the checkout's HEAD, which may not be the profiled commit)")
+		}
+		b.WriteString("\n")
+	}
+	if len(result.Storylines) == 0 {
+		b.WriteString("\nNo storylines found.\n")
+	}
+	for i, storyline := range result.Storylines {
+		fmt.Fprintf(b, "\n%s %d. `%s`\n\n", heading, i+1, storyline.LeafHotspot)
+		fmt.Fprintf(b, "- **Cumulative**: %s (%s)\n", storyline.Cum, storyline.CumPct)
+		if flat, ok := storyline.Evidence.TopRow["flat"].(string); ok && flat != "" {
+			fmt.Fprintf(b, "- **Flat**: %s (%v)\n", flat, storyline.Evidence.TopRow["flat_pct"])
+		}
+		if storyline.FirstApp != "" {
+			fmt.Fprintf(b, "- **First app frame**: `%s`\n", storyline.FirstApp)
+		}
+		if len(storyline.Owners) > 0 {
+			fmt.Fprintf(b, "- **Owners**: %s\n", strings.Join(storyline.Owners, ", "))
+		}
+
+		if len(storyline.CallChain) > 0 {
+			b.WriteString("\n**Call chain** (root → leaf):\n\n")
+			for j, frame := range storyline.CallChain {
+				marker := ""
+				if frame == storyline.FirstApp {
+					marker = " ← app"
+				}
+				if j < len(storyline.CallChainPermalinks) && storyline.CallChainPermalinks[j] != "" {
+					fmt.Fprintf(b, "%d. [`%s`](%s)%s\n", j+1, frame, storyline.CallChainPermalinks[j], marker)
+				} else {
+					fmt.Fprintf(b, "%d. `%s`%s\n", j+1, frame, marker)
+				}
+			}
+		}
+
+		snippet, symbol := storylineSnippet(storyline)
+		if snippet != "" {
+			fmt.Fprintf(b, "\n**Source** (`%s`):\n\n```\n%s\n```\n", symbol, snippet)
+		}
+		for _, warning := range storyline.Warnings {
+			fmt.Fprintf(b, "\n> %s\n", warning)
+		}
+	}
+	for _, warning := range result.Warnings {
+		fmt.Fprintf(b, "\n> %s\n", warning)
+	}
+}
+
+// storylineSnippet prefers the leaf's own source and falls back to the
+// first app frame when the leaf is outside the repo.
+func storylineSnippet(storyline Storyline) (string, string) {
+	if leaf := storyline.Evidence.ListLeaf; leaf != nil {
+		if snippet := annotatedSnippet(leaf.Raw); snippet != "" {
+			return snippet, storyline.LeafHotspot
+		}
+	}
+	if snippet := annotatedSnippet(storyline.Evidence.ListApp.Raw); snippet != "" {
+		return snippet, storyline.FirstApp
+	}
+	return "", ""
+}
+
+var listLinePattern = regexp.MustCompile(`^\s*(\S+)\s+(\S+)\s+\d+:`)
+
+// annotatedSnippet keeps the lines of the first ROUTINE in pprof list output
+// that carry samples, plus a little context around them.
+func annotatedSnippet(raw string) string {
+	var lines []string
+	inRoutine := false
+	for _, line := range strings.Split(raw, "\n") {
+		if strings.HasPrefix(line, "ROUTINE ") {
+			if inRoutine {
+				break
+			}
+			inRoutine = true
+			continue
+		}
+		if inRoutine && listLinePattern.MatchString(line) {
+			lines = append(lines, line)
+		}
+	}
+
+	keep := make([]bool, len(lines))
+	hot := false
+	for i, line := range lines {
+		match := listLinePattern.FindStringSubmatch(line)
+		if match[1] == "." && match[2] == "." {
+			continue
+		}
+		hot = true
+		for j := max(0, i-snippetContext); j <= min(len(lines)-1, i+snippetContext); j++ {
+			keep[j] = true
+		}
+	}
+	if !hot {
+		return ""
+	}
+
+	var out []string
+	gap := false
+	for i, line := range lines {
+		if !keep[i] {
+			gap = len(out) > 0
+			continue
+		}
+		if gap {
+			out = append(out, "         .          .   ...")
+			gap = false
+		}
+		out = append(out, line)
+		if len(out) >= snippetMaxLines {
+			out = append(out, "         .          .   ...")
+			break
+		}
+	}
+	return strings.Join(out, "\n")
+}
@@ -89,3 +89,41 @@ func TestFindSampleIndex(t *testing.T) {
 	}
 }
 
+
+func TestFormatStorylinesMarkdown(t *testing.T) {
+	list := `Total: 890ms
+ROUTINE ======================== main.spin in /src/main.go
+      10ms      890ms (flat, cum)   100% of Total
+         .          .     10:func spin(d time.Duration) {
+         .          .     11:	end := time.Now().Add(d)
+         .          .     12:	x := 0
+         .          .     13:	y := 0
+      10ms      890ms     14:	for time.Now().Before(end) {
+         .          .     15:		x++
+         .          .     16:	}
+         .          .     17:}
+         .          .     18:
+`
+	result := StorylinesResult{
+		Command: "go tool pprof -top -cum cpu.pprof",
+		Storylines: []Storyline{{
+			LeafHotspot: "time.Now",
+			Cum:         "890ms",
+			CumPct:      "100%",
+			CallChain:   []string{"main.main", "main.spin", "time.Now"},
+			FirstApp:    "main.spin",
+			Evidence: StorylineEvidence{
+				TopRow:  map[string]any{"flat": "260ms", "flat_pct": "29.21%"},
+				ListApp: EvidenceOutput{Raw: list},
+			},
+		}},
+	}
+
+	markdown := FormatStorylinesMarkdown(result)
+	require.Contains(t, markdown, "## 1. `time.Now`")
+	require.Contains(t, markdown, "890ms (100%)")
+	require.Contains(t, markdown, "2. `main.spin` ← app")
+	require.Contains(t, markdown, "**Source** (`main.spin`)")
+	require.Contains(t, markdown, "14:\tfor time.Now().Before(end) {")
+	require.NotContains(t, markdown, "10:func spin")
+}
@@ -3,15 +3,19 @@ package pprof
 import (
 	"context"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/pmezard/go-difflib/difflib"
 	"gopkg.in/yaml.v3"
 
+	"github.com/arreyder/pprof-mcp/internal/codescan"
 	"github.com/arreyder/pprof-mcp/internal/pprofdata"
 	"github.com/arreyder/pprof-mcp/internal/pprofparse"
 )
@@ -26,6 +30,11 @@ type SuggestFixParams struct {
 	Issue          string
 	RepoRoot       string
 	TargetFunction string
+	// Mode is FixModeSuggest (default) or FixModeApply, which writes the
+	// fix FixID names into the working tree and builds and tests it.
+	Mode string
+	// FixPR opens a pull request for a fix when OpenPR is set.
+	FixPR
 }
 
 type SuggestFixResult struct {
@@ -56,6 +65,8 @@ type FixSuggestion struct {
 	Considerations   []string          `json:"considerations"`
 	IsVendored       bool              `json:"is_vendored"`
 	UpstreamPRNeeded bool              `json:"upstream_pr_needed"`
+	PullRequest      *FixPullRequest   `json:"pull_request,omitempty"`
+	Applied          *FixApplication   `json:"applied,omitempty"`
 }
 
 type FixFileChange struct {
@@ -63,6 +74,8 @@ type FixFileChange struct {
 	IsVendor     bool            `json:"is_vendor"`
 	UpstreamRepo string          `json:"upstream_repo,omitempty"`
 	Changes      []FixLineChange `json:"changes"`
+
+	modified string // the file's content with the fix applied
 }
 
 type FixLineChange struct {
@@ -103,6 +116,11 @@ func RunSuggestFix(ctx context.Context, params SuggestFixParams) (SuggestFixResu
 	if strings.TrimSpace(params.Issue) == "" {
 		return result, fmt.Errorf("issue is required")
 	}
+	switch params.Mode {
+	case "", FixModeSuggest, FixModeApply:
+	default:
+		return result, fmt.Errorf("unknown mode %q (want suggest or apply)", params.Mode)
+	}
 
 	templates, err := loadFixTemplates()
 	if err != nil {
@@ -120,7 +138,8 @@ func RunSuggestFix(ctx context.Context, params SuggestFixParams) (SuggestFixResu
 	result.Issue = params.Issue
 	result.Analysis = buildSuggestAnalysis(top.Rows)
 
-	for id, tmpl := range templates.Fixes {
+	for _, id := range slices.Sorted(maps.Keys(templates.Fixes)) {
+		tmpl := templates.Fixes[id]
 		if tmpl.IssueID != params.Issue {
 			continue
 		}
@@ -138,7 +157,7 @@ func RunSuggestFix(ctx context.Context, params SuggestFixParams) (SuggestFixResu
 		}
 
 		if params.RepoRoot != "" {
-			files, diff, vendor, upstream := generateFixDiff(params.RepoRoot, tmpl)
+			files, diff, vendor, upstream := generateFixDiff(ctx, params.RepoRoot, tmpl)
 			fix.FilesToModify = files
 			fix.Diff = diff
 			fix.IsVendored = vendor
@@ -160,6 +179,14 @@ func RunSuggestFix(ctx context.Context, params SuggestFixParams) (SuggestFixResu
 		result.Warnings = append(result.Warnings, "no applicable fixes detected for the supplied issue")
 	}
 
+	// The pull request goes first: it requires the checkout to match the
+	// base branch, which applying the fix changes.
+	if params.OpenPR {
+		openPullRequest(ctx, params, &result)
+	}
+	if params.Mode == FixModeApply {
+		applyFixes(ctx, params, &result)
+	}
 	result.NextSteps = buildNextSteps(result.ApplicableFixes)
 	return result, nil
 }
@@ -224,41 +251,27 @@ func fixApplicable(tmpl fixTemplate, rows []pprofparse.TopRow) bool {
 	return false
 }
 
-func generateFixDiff(repoRoot string, tmpl fixTemplate) ([]FixFileChange, string, bool, string) {
+func generateFixDiff(ctx context.Context, repoRoot string, tmpl fixTemplate) ([]FixFileChange, string, bool, string) {
 	files := []FixFileChange{}
 	if tmpl.IssueID != "protojson_overhead" {
 		return files, "", false, ""
 	}
 
 	changedFiles := map[string]string{}
-	err := filepath.WalkDir(repoRoot, func(path string, d os.DirEntry, err error) error {
-		if err != nil || d == nil {
-			return nil
-		}
-		if d.IsDir() {
-			if strings.HasPrefix(d.Name(), ".git") {
-				return filepath.SkipDir
-			}
-			return nil
-		}
-		if !strings.HasSuffix(d.Name(), ".go") {
-			return nil
-		}
-		content, err := os.ReadFile(path)
-		if err != nil {
-			return nil
-		}
-		original := string(content)
+	var mu sync.Mutex
+	err := codescan.Scan(ctx, repoRoot, codescan.Options{Include: []string{"*.go"}}, func(file codescan.File) {
+		original := string(file.Content)
 		if !strings.Contains(original, "protojson.") && !strings.Contains(original, "encoding/protojson") {
-			return nil
+			return
 		}
 		modified := strings.ReplaceAll(original, "google.golang.org/protobuf/encoding/protojson", "google.golang.org/protobuf/proto")
 		modified = strings.ReplaceAll(modified, "protojson.", "proto.")
 		if modified == original {
-			return nil
+			return
 		}
-		changedFiles[path] = modified
-		return nil
+		mu.Lock()
+		changedFiles[file.Path] = modified
+		mu.Unlock()
 	})
 	if err != nil {
 		return files, "", false, ""
@@ -285,6 +298,7 @@ func generateFixDiff(repoRoot string, tmpl fixTemplate) ([]FixFileChange, string
 			Path:     path,
 			IsVendor: isVendor,
 			Changes:  lineChanges(string(original), modified),
+			modified: modified,
 		})
 	}
 
@@ -360,6 +374,20 @@ func buildNextSteps(fixes []FixSuggestion) []string {
 	}
 	steps := []string{}
 	for _, fix := range fixes {
+		if applied := fix.Applied; applied != nil {
+			switch {
+			case !applied.Build.Passed:
+				steps = append(steps, "Fix the build errors in the applied change, or restore the .orig backups")
+			case applied.Test != nil && !applied.Test.Passed:
+				steps = append(steps, "Fix the failing tests of the applied change, or restore the .orig backups")
+			default:
+				steps = append(steps, "Review the applied change, remove the .orig backups, and profile again")
+			}
+		}
+		if fix.PullRequest != nil {
+			steps = append(steps, fmt.Sprintf("Review pull request %s and compare a profile of the branch", fix.PullRequest.URL))
+			continue
+		}
 		if fix.UpstreamPRNeeded {
 			steps = append(steps, "Open PR in upstream dependency for vendor change")
 		}
@@ -0,0 +1,279 @@
+package pprof
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// SymbolizationResult measures how much of a profile resolves to function
+// names, per mapping, so a missing binary is asked for only where samples
+// actually land on raw addresses.
+type SymbolizationResult struct {
+	ProfilePath string `json:"profile_path"`
+	SampleType  string `json:"sample_type"`
+	TotalValue  int64  `json:"total_value"`
+	// NamedFraction is the share of the sample value whose whole stack
+	// resolves to named functions.
+	NamedFraction float64                `json:"named_fraction"`
+	Mappings      []MappingSymbolization `json:"mappings"`
+	// NeedsSymbols lists the files of mappings with raw-address frames in
+	// their samples, most sample value first.
+	NeedsSymbols   []string `json:"needs_symbols"`
+	Recommendation string   `json:"recommendation"`
+}
+
+// MappingSymbolization is the symbolization of one mapping's sampled frames.
+type MappingSymbolization struct {
+	File    string `json:"file"`
+	BuildID string `json:"build_id,omitempty"`
+	// Main is the mapping of the profiled binary.
+	Main bool `json:"main,omitempty"`
+	// Pseudo mappings ([vdso], [kernel.kallsyms], ...) have no file a binary
+	// could symbolize.
+	Pseudo bool `json:"pseudo,omitempty"`
+	// HasFunctions is the profile's own claim that the mapping is
+	// symbolized.
+	HasFunctions bool `json:"has_functions"`
+	Locations    int  `json:"locations"`
+	RawLocations int  `json:"raw_locations"`
+	// SampleValue sums the samples with a frame in the mapping; RawValue
+	// those with a raw-address frame there.
+	SampleValue   int64    `json:"sample_value"`
+	RawValue      int64    `json:"raw_value"`
+	NamedFraction float64  `json:"named_fraction"`
+	TopRawAddrs   []string `json:"top_raw_addresses,omitempty"`
+}
+
+// noMappingFile names locations that belong to no mapping.
+const noMappingFile = "(no mapping)"
+
+const maxRawAddresses = 5
+
+// RunSymbolization reports, per mapping, how much of the profile's sample
+// value lands on named functions versus raw addresses.
+func RunSymbolization(profilePath, sampleIndex string) (SymbolizationResult, error) {
+	if profilePath == "" {
+		return SymbolizationResult{}, fmt.Errorf("profile is required")
+	}
+	prof, err := parseProfile(profilePath)
+	if err != nil {
+		return SymbolizationResult{}, err
+	}
+	valueIndex, err := prof.SampleIndexByName(sampleIndex)
+	if err != nil {
+		return SymbolizationResult{}, err
+	}
+	result := measureSymbolization(prof, valueIndex)
+	result.ProfilePath = profilePath
+	return result, nil
+}
+
+type mappingTally struct {
+	MappingSymbolization
+	seen    map[uint64]bool
+	rawByID map[uint64]int64
+	addrs   map[uint64]uint64
+}
+
+func measureSymbolization(prof *profile.Profile, valueIndex int) SymbolizationResult {
+	result := SymbolizationResult{
+		SampleType:   prof.SampleType[valueIndex].Type,
+		Mappings:     []MappingSymbolization{},
+		NeedsSymbols: []string{},
+	}
+	mainID := uint64(0)
+	for _, mapping := range prof.Mapping {
+		if mapping != nil && mapping.File != "" && !strings.HasPrefix(mapping.File, "[") {
+			mainID = mapping.ID
+			break
+		}
+	}
+
+	tallies := map[uint64]*mappingTally{}
+	tally := func(mapping *profile.Mapping) *mappingTally {
+		id := uint64(0)
+		if mapping != nil {
+			id = mapping.ID
+		}
+		if t := tallies[id]; t != nil {
+			return t
+		}
+		t := &mappingTally{seen: map[uint64]bool{}, rawByID: map[uint64]int64{}, addrs: map[uint64]uint64{}}
+		t.File = noMappingFile
+		if mapping != nil {
+			if mapping.File != "" {
+				t.File = mapping.File
+			}
+			t.BuildID = mapping.BuildID
+			t.HasFunctions = mapping.HasFunctions
+			t.Main = mapping.ID == mainID
+			t.Pseudo = mapping.File == "" || strings.HasPrefix(mapping.File, "[")
+		}
+		tallies[id] = t
+		return t
+	}
+
+	var namedValue int64
+	for _, sample := range prof.Sample {
+		if valueIndex >= len(sample.Value) {
+			continue
+		}
+		value := sample.Value[valueIndex]
+		if value < 0 {
+			value = -value
+		}
+		result.TotalValue += value
+		inSample := map[*mappingTally]bool{}
+		rawInSample := map[*mappingTally]bool{}
+		for _, loc := range sample.Location {
+			if loc == nil {
+				continue
+			}
+			t := tally(loc.Mapping)
+			raw := !locationNamed(loc)
+			if !t.seen[loc.ID] {
+				t.seen[loc.ID] = true
+				t.Locations++
+				if raw {
+					t.RawLocations++
+					t.addrs[loc.ID] = loc.Address
+				}
+			}
+			inSample[t] = true
+			if raw {
+				rawInSample[t] = true
+				t.rawByID[loc.ID] += value
+			}
+		}
+		for t := range inSample {
+			t.SampleValue += value
+		}
+		for t := range rawInSample {
+			t.RawValue += value
+		}
+		if len(rawInSample) == 0 {
+			namedValue += value
+		}
+	}
+
+	for _, t := range tallies {
+		if t.SampleValue > 0 {
+			t.NamedFraction = float64(t.SampleValue-t.RawValue) / float64(t.SampleValue)
+		}
+		t.TopRawAddrs = topRawAddresses(t)
+		result.Mappings = append(result.Mappings, t.MappingSymbolization)
+	}
+	sort.Slice(result.Mappings, func(i, j int) bool {
+		a, b := result.Mappings[i], result.Mappings[j]
+		if a.RawValue != b.RawValue {
+			return a.RawValue > b.RawValue
+		}
+		if a.SampleValue != b.SampleValue {
+			return a.SampleValue > b.SampleValue
+		}
+		return a.File < b.File
+	})
+	for _, mapping := range result.Mappings {
+		if mapping.RawValue > 0 {
+			result.NeedsSymbols = append(result.NeedsSymbols, mapping.File)
+		}
+	}
+	if result.TotalValue > 0 {
+		result.NamedFraction = float64(namedValue) / float64(result.TotalValue)
+	}
+	result.Recommendation = symbolizationRecommendation(result)
+	return result
+}
+
+func locationNamed(loc *profile.Location) bool {
+	for _, line := range loc.Line {
+		if line.Function != nil && line.Function.Name != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func topRawAddresses(t *mappingTally) []string {
+	ids := make([]uint64, 0, len(t.rawByID))
+	for id := range t.rawByID {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if t.rawByID[ids[i]] != t.rawByID[ids[j]] {
+			return t.rawByID[ids[i]] > t.rawByID[ids[j]]
+		}
+		return t.addrs[ids[i]] < t.addrs[ids[j]]
+	})
+	var addrs []string
+	for _, id := range ids {
+		if len(addrs) == maxRawAddresses {
+			break
+		}
+		addrs = append(addrs, fmt.Sprintf("0x%x", t.addrs[id]))
+	}
+	return addrs
+}
+
+// symbolizationRecommendation says which binary, if any, would fill the
+// measured gaps.
+func symbolizationRecommendation(result SymbolizationResult) string {
+	var main *MappingSymbolization
+	var libraries, pseudo []string
+	for i := range result.Mappings {
+		mapping := &result.Mappings[i]
+		if mapping.RawValue == 0 {
+			continue
+		}
+		switch {
+		case mapping.Main || mapping.File == noMappingFile:
+			if main == nil {
+				main = mapping
+			}
+		case mapping.Pseudo:
+			pseudo = append(pseudo, mapping.File)
+		default:
+			libraries = append(libraries, mapping.File)
+		}
+	}
+	pct := func(mapping *MappingSymbolization) float64 {
+		if result.TotalValue == 0 {
+			return 0
+		}
+		return float64(mapping.RawValue) / float64(result.TotalValue) * 100
+	}
+
+	var parts []string
+	switch {
+	case main != nil && main.File == noMappingFile:
+		parts = append(parts, fmt.Sprintf("%.1f%% of %s has raw addresses outside any mapping; the profile lacks the mapping data pprof needs to symbolize them, so re-collect it with symbols", pct(main), result.SampleType))
+	case main != nil:
+		what := main.File
+		if main.BuildID != "" {
+			what += " (build ID " + main.BuildID + ")"
+		}
+		parts = append(parts, fmt.Sprintf("Pass binary for %s, or run pprof.resolve_binary: %.1f%% of %s has raw addresses in it", what, pct(main), result.SampleType))
+	}
+	if len(libraries) > 0 {
+		parts = append(parts, fmt.Sprintf("shared libraries %s need their own debug symbols; the main binary will not name them", strings.Join(libraries, ", ")))
+	}
+	if len(pseudo) > 0 {
+		parts = append(parts, fmt.Sprintf("%s cannot be symbolized from a file", strings.Join(pseudo, ", ")))
+	}
+	if len(parts) == 0 {
+		return "Every sampled frame resolves to a function name; no binary is needed."
+	}
+	text := strings.Join(parts, "; ") + "."
+	return strings.ToUpper(text[:1]) + text[1:]
+}
+
+func FormatSymbolizationCommand(profilePath, sampleIndex string) string {
+	command := fmt.Sprintf("profctl pprof symbolization --profile %s", profilePath)
+	if sampleIndex != "" {
+		command += " --sample_index " + sampleIndex
+	}
+	return command
+}
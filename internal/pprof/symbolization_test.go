@@ -0,0 +1,65 @@
+package pprof
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunSymbolization(t *testing.T) {
+	server := &profile.Mapping{ID: 1, Start: 0x1000, Limit: 0x9000, File: "/app/server", BuildID: "abc"}
+	libc := &profile.Mapping{ID: 2, Start: 0x10000, Limit: 0x20000, File: "/lib/libc.so.6"}
+	vdso := &profile.Mapping{ID: 3, Start: 0x30000, Limit: 0x31000, File: "[vdso]"}
+	fn := &profile.Function{ID: 1, Name: "main.work"}
+	named := &profile.Location{ID: 1, Address: 0x1100, Mapping: server, Line: []profile.Line{{Function: fn}}}
+	rawServer := &profile.Location{ID: 2, Address: 0x2200, Mapping: server}
+	rawLibc := &profile.Location{ID: 3, Address: 0x10100, Mapping: libc}
+	rawVdso := &profile.Location{ID: 4, Address: 0x30100, Mapping: vdso}
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		Sample: []*profile.Sample{
+			{Location: []*profile.Location{named}, Value: []int64{6, 60}},
+			{Location: []*profile.Location{rawServer, named}, Value: []int64{3, 30}},
+			{Location: []*profile.Location{rawLibc, named}, Value: []int64{1, 10}},
+		},
+		Mapping:  []*profile.Mapping{server, libc, vdso},
+		Location: []*profile.Location{named, rawServer, rawLibc, rawVdso},
+		Function: []*profile.Function{fn},
+	}
+	path := filepath.Join(t.TempDir(), "cpu.pprof")
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, prof.Write(file))
+	require.NoError(t, file.Close())
+
+	result, err := RunSymbolization(path, "")
+	require.NoError(t, err)
+	require.Equal(t, "cpu", result.SampleType)
+	require.EqualValues(t, 100, result.TotalValue)
+	require.InDelta(t, 0.6, result.NamedFraction, 1e-9)
+	require.Equal(t, []string{"/app/server", "/lib/libc.so.6"}, result.NeedsSymbols)
+	require.Len(t, result.Mappings, 2, "the unsampled [vdso] mapping is not reported")
+
+	main := result.Mappings[0]
+	require.True(t, main.Main)
+	require.Equal(t, 2, main.Locations)
+	require.Equal(t, 1, main.RawLocations)
+	require.EqualValues(t, 100, main.SampleValue)
+	require.EqualValues(t, 30, main.RawValue)
+	require.InDelta(t, 0.7, main.NamedFraction, 1e-9)
+	require.Equal(t, []string{"0x2200"}, main.TopRawAddrs)
+	require.Contains(t, result.Recommendation, "Pass binary for /app/server (build ID abc)")
+	require.Contains(t, result.Recommendation, "shared libraries /lib/libc.so.6")
+
+	// With only library gaps there is no binary to ask for.
+	prof.Sample = prof.Sample[2:]
+	only := measureSymbolization(prof, 1)
+	require.NotContains(t, only.Recommendation, "Pass binary")
+	require.Contains(t, only.Recommendation, "Shared libraries /lib/libc.so.6")
+
+	prof.Sample = []*profile.Sample{{Location: []*profile.Location{named}, Value: []int64{1, 1}}}
+	require.Contains(t, measureSymbolization(prof, 1).Recommendation, "no binary is needed")
+}
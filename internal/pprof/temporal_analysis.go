@@ -2,12 +2,9 @@ package pprof
 
 import (
 	"fmt"
-	"os"
 	"regexp"
 	"sort"
 	"strings"
-
-	"github.com/google/pprof/profile"
 )
 
 // TemporalAnalysisParams configures Temporal SDK worker analysis.
@@ -150,13 +147,7 @@ func RunTemporalAnalysis(params TemporalAnalysisParams) (TemporalAnalysisResult,
 		return result, fmt.Errorf("profile is required")
 	}
 
-	file, err := os.Open(params.Profile)
-	if err != nil {
-		return result, err
-	}
-	defer file.Close()
-
-	prof, err := profile.Parse(file)
+	prof, err := parseProfile(params.Profile)
 	if err != nil {
 		return result, err
 	}
@@ -265,7 +256,14 @@ func RunTemporalAnalysis(params TemporalAnalysisParams) (TemporalAnalysisResult,
 		})
 	}
 	sort.Slice(result.WorkflowBreakdown, func(i, j int) bool {
-		return result.WorkflowBreakdown[i].Count > result.WorkflowBreakdown[j].Count
+		a, b := result.WorkflowBreakdown[i], result.WorkflowBreakdown[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.State < b.State
 	})
 
 	// Build activity breakdown
@@ -277,7 +275,11 @@ func RunTemporalAnalysis(params TemporalAnalysisParams) (TemporalAnalysisResult,
 		})
 	}
 	sort.Slice(result.ActivityBreakdown, func(i, j int) bool {
-		return result.ActivityBreakdown[i].Count > result.ActivityBreakdown[j].Count
+		a, b := result.ActivityBreakdown[i], result.ActivityBreakdown[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Name < b.Name
 	})
 
 	return result, nil
@@ -0,0 +1,202 @@
+package pprof
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/arreyder/pprof-mcp/internal/cmdrun"
+)
+
+// ToolInfo describes the pprof the server runs: go tool pprof from the Go
+// toolchain on PATH, or a standalone pprof binary named by PPROF_MCP_PPROF_BIN.
+type ToolInfo struct {
+	Command    string `json:"command"`
+	Standalone bool   `json:"standalone"`
+	// Version is the Go toolchain version (e.g. go1.22.3); standalone pprof
+	// does not report one.
+	Version string `json:"version,omitempty"`
+	// Unsupported lists flags the server may pass that this pprof does not
+	// know. They are dropped from commands (with a note on stderr) or, for
+	// renamed flags, replaced by the older name.
+	Unsupported []string `json:"unsupported_flags,omitempty"`
+	Error       string   `json:"error,omitempty"`
+
+	// flags is nil when pprof's flags could not be listed; commands then
+	// run unchanged.
+	flags map[string]bool
+}
+
+// optionalFlags are flags the server passes whose absence from an older or
+// standalone pprof only coarsens the output, so they are dropped rather than
+// failing the command. The value says whether the flag takes an argument.
+var optionalFlags = map[string]bool{
+	"trim_path":    true,
+	"source_path":  true,
+	"show_from":    true,
+	"tagfocus":     true,
+	"tagignore":    true,
+	"tagshow":      true,
+	"nodefraction": true,
+	"edgefraction": true,
+	"noinlines":    false,
+}
+
+// renamedFlags maps a flag to the older name pprof versions without it
+// accept for the same option.
+var renamedFlags = map[string]string{
+	"diff_base": "base",
+}
+
+var helpFlagPattern = regexp.MustCompile(`(?m)^\s+-([a-z_]+)`)
+
+var (
+	toolInfoMu sync.Mutex
+	toolInfos  = map[string]ToolInfo{}
+)
+
+// pprofCommand returns the program and leading arguments that run pprof.
+func pprofCommand() (string, []string) {
+	if bin := strings.TrimSpace(os.Getenv("PPROF_MCP_PPROF_BIN")); bin != "" {
+		return bin, nil
+	}
+	return "go", []string{"tool", "pprof"}
+}
+
+// DetectTool reports the pprof in use, probing it on first use: its Go
+// version and, from its -h output, the flags it supports. The result is
+// cached per pprof command.
+func DetectTool(ctx context.Context) ToolInfo {
+	name, prefix := pprofCommand()
+	key := cmdrun.Join(append([]string{name}, prefix...)...)
+	toolInfoMu.Lock()
+	info, ok := toolInfos[key]
+	toolInfoMu.Unlock()
+	if ok {
+		return info
+	}
+	info = detectTool(ctx, key, name, prefix)
+	toolInfoMu.Lock()
+	toolInfos[key] = info
+	toolInfoMu.Unlock()
+	return info
+}
+
+func detectTool(ctx context.Context, key, name string, prefix []string) ToolInfo {
+	info := ToolInfo{Command: key, Standalone: name != "go"}
+	help, err := probeOutput(ctx, name, append(slices.Clone(prefix), "-h")...)
+	// pprof -h exits non-zero in some versions; only missing output is fatal.
+	if help == "" {
+		if err == nil {
+			err = fmt.Errorf("no output")
+		}
+		info.Error = fmt.Sprintf("%s -h: %v", key, err)
+		return info
+	}
+	info.flags = parseHelpFlags(help)
+	if len(info.flags) == 0 {
+		info.flags = nil
+		info.Error = fmt.Sprintf("%s -h: no flags found in the usage text", key)
+	}
+	if !info.Standalone {
+		// "go version go1.22.3 linux/amd64"
+		out, err := probeOutput(ctx, "go", "version")
+		if fields := strings.Fields(out); err == nil && len(fields) >= 3 {
+			info.Version = fields[2]
+		}
+	}
+	if info.flags != nil {
+		for flag := range optionalFlags {
+			if !info.flags[flag] {
+				info.Unsupported = append(info.Unsupported, "-"+flag)
+			}
+		}
+		for flag := range renamedFlags {
+			if !info.flags[flag] {
+				info.Unsupported = append(info.Unsupported, "-"+flag)
+			}
+		}
+		sort.Strings(info.Unsupported)
+	}
+	return info
+}
+
+func probeOutput(ctx context.Context, name string, args ...string) (string, error) {
+	cmd, done := cmdrun.Command(ctx, cmdrun.Pprof, name, args...)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := done(cmd.Run())
+	return strings.TrimSpace(out.String()), err
+}
+
+func parseHelpFlags(help string) map[string]bool {
+	flags := map[string]bool{}
+	for _, match := range helpFlagPattern.FindAllStringSubmatch(help, -1) {
+		flags[match[1]] = true
+	}
+	return flags
+}
+
+// adaptArgs rewrites pprof arguments for this pprof: renamed flags take their
+// older name and unsupported optional flags are dropped. It returns the flags
+// dropped.
+func (info ToolInfo) adaptArgs(args []string) ([]string, []string) {
+	if info.flags == nil {
+		return args, nil
+	}
+	adapted := make([]string, 0, len(args))
+	var dropped []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || info.flags[name] {
+			adapted = append(adapted, arg)
+			continue
+		}
+		if older, ok := renamedFlags[name]; ok && info.flags[older] {
+			if hasValue {
+				adapted = append(adapted, "-"+older+"="+value)
+			} else {
+				adapted = append(adapted, "-"+older)
+			}
+			continue
+		}
+		if takesValue, ok := optionalFlags[name]; ok {
+			dropped = append(dropped, "-"+name)
+			if takesValue && !hasValue {
+				i++
+			}
+			continue
+		}
+		adapted = append(adapted, arg)
+	}
+	return adapted, dropped
+}
+
+// pprofInvocation turns the arguments after "go tool pprof" into the command
+// that runs them on the detected pprof, with a note for each flag dropped.
+func pprofInvocation(args []string) (string, []string, []string) {
+	name, prefix := pprofCommand()
+	info := DetectTool(context.Background())
+	adapted, dropped := info.adaptArgs(args)
+	var notes []string
+	if len(dropped) > 0 {
+		notes = append(notes, fmt.Sprintf("pprof-mcp: %s does not support %s; ran without it",
+			strings.TrimSpace(info.Command+" "+info.Version), strings.Join(dropped, ", ")))
+	}
+	return name, append(slices.Clone(prefix), adapted...), notes
+}
+
+// ToolCommand returns the full command that runs pprof with args, for
+// callers that exec pprof themselves (e.g. the interactive -http viewer).
+func ToolCommand(args ...string) []string {
+	name, args, _ := pprofInvocation(args)
+	return append([]string{name}, args...)
+}
@@ -0,0 +1,53 @@
+package pprof
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const oldPprofHelp = `usage: pprof <format> [options] [binary] <source> ...
+  Output formats (select only one):
+    -top             Outputs top entries in text form
+    -svg             Outputs a graph in SVG format
+  Options:
+    -focus           Restricts to samples going through a node matching regexp
+    -sample_index    Index of sample value to report
+    -nodecount       Max number of nodes to show
+  Source options:
+    -base source     Source of base profile for profile subtraction
+    -symbolize=      Controls source of symbol information
+`
+
+func TestAdaptArgs(t *testing.T) {
+	info := ToolInfo{flags: parseHelpFlags(oldPprofHelp)}
+	require.True(t, info.flags["symbolize"])
+	require.True(t, info.flags["base"])
+	require.False(t, info.flags["trim_path"])
+
+	adapted, dropped := info.adaptArgs([]string{
+		"-top", "-nodecount=20", "-trim_path", "/src", "-tagfocus=tenant=a",
+		"-diff_base", "before.pprof", "-diff_base=old.pprof", "after.pprof",
+	})
+	require.Equal(t, []string{"-top", "-nodecount=20", "-base", "before.pprof", "-base=old.pprof", "after.pprof"}, adapted)
+	require.Equal(t, []string{"-trim_path", "-tagfocus"}, dropped)
+
+	// Without a flag list, arguments pass through unchanged.
+	args := []string{"-top", "-trim_path", "/src", "cpu.pprof"}
+	adapted, dropped = ToolInfo{}.adaptArgs(args)
+	require.Equal(t, args, adapted)
+	require.Empty(t, dropped)
+}
+
+func TestDetectTool(t *testing.T) {
+	info := DetectTool(context.Background())
+	require.Empty(t, info.Error)
+	require.Equal(t, "go tool pprof", info.Command)
+	require.False(t, info.Standalone)
+	require.True(t, strings.HasPrefix(info.Version, "go"), info.Version)
+	require.True(t, info.flags["sample_index"])
+	require.Empty(t, info.Unsupported)
+	require.Equal(t, []string{"go", "tool", "pprof", "-http", ":0", "cpu.pprof"}, ToolCommand("-http", ":0", "cpu.pprof"))
+}
@@ -2,11 +2,11 @@ package pprof
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
-	"sort"
 	"strings"
 
 	"github.com/google/pprof/profile"
@@ -24,6 +24,17 @@ type TraceSourceParams struct {
 	MaxDepth     int
 	ShowVendor   bool
 	ContextLines int
+	// TrimPath lists build-time prefixes to strip before looking under
+	// RepoRoot; default: inferred from the profile's paths and RepoRoot.
+	TrimPath string
+	// SnippetFormat "html" adds each snippet as highlighted HTML.
+	SnippetFormat string
+	// DownloadModules runs go mod download for module frames whose version
+	// is not in the module cache.
+	DownloadModules bool
+	// Revision is the profiled commit permalinks point at; default: HEAD
+	// of RepoRoot.
+	Revision string
 }
 
 type TraceSourceResult struct {
@@ -31,6 +42,9 @@ type TraceSourceResult struct {
 	TotalFunctionsTraced int                `json:"total_functions_traced"`
 	AppFunctions         int                `json:"app_functions"`
 	VendorFunctions      int                `json:"vendor_functions"`
+	TrimPathInference    *TrimPathInference `json:"trim_path_inference,omitempty"`
+	ModuleSources        []ModuleSource     `json:"module_sources,omitempty"`
+	Permalinks           *PermalinkBase     `json:"permalinks,omitempty"`
 	Warnings             []string           `json:"warnings,omitempty"`
 }
 
@@ -41,10 +55,12 @@ type TraceSourceFrame struct {
 	FlatPct       float64 `json:"flat_pct"`
 	CumPct        float64 `json:"cum_pct"`
 	SourceSnippet string  `json:"source_snippet"`
+	SourceHTML    string  `json:"source_html,omitempty"`
 	IsVendor      bool    `json:"is_vendor"`
 	VendorPackage string  `json:"vendor_package,omitempty"`
 	VendorVersion string  `json:"vendor_version,omitempty"`
 	SourceError   string  `json:"source_error,omitempty"`
+	Permalink     string  `json:"permalink,omitempty"`
 }
 
 type functionStat struct {
@@ -58,7 +74,7 @@ type traceFrame struct {
 	line     int
 }
 
-func RunTraceSource(params TraceSourceParams) (TraceSourceResult, error) {
+func RunTraceSource(ctx context.Context, params TraceSourceParams) (TraceSourceResult, error) {
 	result := TraceSourceResult{
 		CallChain: []TraceSourceFrame{},
 		Warnings:  []string{},
@@ -83,13 +99,7 @@ func RunTraceSource(params TraceSourceParams) (TraceSourceResult, error) {
 		repoRoot = "."
 	}
 
-	profileFile, err := os.Open(params.Profile)
-	if err != nil {
-		return result, err
-	}
-	defer profileFile.Close()
-
-	prof, err := profile.Parse(profileFile)
+	prof, err := parseProfile(params.Profile)
 	if err != nil {
 		return result, err
 	}
@@ -99,7 +109,7 @@ func RunTraceSource(params TraceSourceParams) (TraceSourceResult, error) {
 		return result, fmt.Errorf("invalid function regex: %w", err)
 	}
 
-	statMap, totalValue := computeFunctionStats(prof)
+	statMap, totalValue := computeFunctionStats(prof, 0)
 	frames, matchIndex, err := pickSampleTrace(prof, reFunc)
 	if err != nil {
 		return result, err
@@ -126,11 +136,23 @@ func RunTraceSource(params TraceSourceParams) (TraceSourceResult, error) {
 		result.Warnings = append(result.Warnings, "go.mod not found or unreadable; version info omitted")
 	}
 
+	trimPrefixes := filepath.SplitList(params.TrimPath)
+	if params.TrimPath == "" {
+		inference := InferTrimPath(prof, repoRoot)
+		result.TrimPathInference = &inference
+		trimPrefixes = filepath.SplitList(inference.TrimPath)
+	}
+	modules := newModuleSources(params.DownloadModules)
+	links, warning := permalinksFor(ctx, strings.TrimSpace(params.RepoRoot), params.Revision, trimPrefixes)
+	if warning != "" {
+		result.Warnings = append(result.Warnings, warning)
+	}
+	result.Permalinks = links.base()
 	for _, frame := range frames {
 		stat := statMap[frame.function]
 		flatPct := percentOf(stat.flat, totalValue)
 		cumPct := percentOf(stat.cum, totalValue)
-		resolved, isVendor, vendorPackage, vendorVersion, sourceErr := resolveSourceFile(frame, repoRoot, params.ShowVendor, modInfo)
+		resolved, isVendor, vendorPackage, vendorVersion, sourceErr := resolveSourceFile(ctx, frame, repoRoot, trimPrefixes, params.ShowVendor, modInfo, modules)
 		if sourceErr != nil && resolved == "" {
 			result.Warnings = append(result.Warnings, sourceErr.Error())
 		}
@@ -153,6 +175,10 @@ func RunTraceSource(params TraceSourceParams) (TraceSourceResult, error) {
 			}
 		}
 
+		sourceHTML := ""
+		if params.SnippetFormat == SnippetFormatHTML && snippetErr == nil {
+			sourceHTML = SnippetHTML(snippet, flatPct)
+		}
 		result.CallChain = append(result.CallChain, TraceSourceFrame{
 			Function:      frame.function,
 			File:          resolved,
@@ -160,24 +186,31 @@ func RunTraceSource(params TraceSourceParams) (TraceSourceResult, error) {
 			FlatPct:       flatPct,
 			CumPct:        cumPct,
 			SourceSnippet: snippet,
+			SourceHTML:    sourceHTML,
 			IsVendor:      isVendor,
 			VendorPackage: vendorPackage,
 			VendorVersion: vendorVersion,
 			SourceError:   sourceErrText,
+			Permalink:     links.link(frame.file, frame.line),
 		})
 	}
 
 	result.TotalFunctionsTraced = len(result.CallChain)
+	result.ModuleSources = modules.sources()
+	if warning := missingModulesWarning(result.ModuleSources); warning != "" {
+		result.Warnings = append(result.Warnings, warning)
+	}
 	return result, nil
 }
 
-func computeFunctionStats(prof *profile.Profile) (map[string]functionStat, int64) {
+// computeFunctionStats sums the flat and cum values at sampleIndex of every
+// function.
+func computeFunctionStats(prof *profile.Profile, sampleIndex int) (map[string]functionStat, int64) {
 	stats := map[string]functionStat{}
 	var total int64
 	if prof == nil || len(prof.Sample) == 0 {
 		return stats, total
 	}
-	sampleIndex := 0
 	for _, sample := range prof.Sample {
 		value := sampleValueAt(sample, sampleIndex)
 		total += value
@@ -328,7 +361,9 @@ func roundPct(value float64) float64 {
 	return float64(int(value*factor+0.5)) / factor
 }
 
-func resolveSourceFile(frame traceFrame, repoRoot string, showVendor bool, modInfo ModInfo) (string, bool, string, string, error) {
+// resolveSourceFile finds frame's source in the repo, once a trim prefix is
+// stripped, its vendor directory, or the module cache.
+func resolveSourceFile(ctx context.Context, frame traceFrame, repoRoot string, trimPrefixes []string, showVendor bool, modInfo ModInfo, modules *moduleSources) (string, bool, string, string, error) {
 	if frame.file == "" {
 		return "", false, "", "", fmt.Errorf("no source file for %s", frame.function)
 	}
@@ -342,9 +377,11 @@ func resolveSourceFile(frame traceFrame, repoRoot string, showVendor bool, modIn
 		}
 	}
 
-	trimmed := strings.TrimPrefix(frameFile, "/xsrc/")
-	if trimmed != frameFile {
-		candidates = append(candidates, filepath.Join(repoRoot, trimmed))
+	for _, prefix := range trimPrefixes {
+		prefix = strings.TrimSuffix(prefix, "/") + "/"
+		if trimmed := strings.TrimPrefix(filepath.ToSlash(frameFile), prefix); trimmed != filepath.ToSlash(frameFile) {
+			candidates = append(candidates, filepath.Join(repoRoot, filepath.FromSlash(trimmed)))
+		}
 	}
 	candidates = append(candidates, filepath.Join(repoRoot, frameFile))
 
@@ -359,6 +396,15 @@ func resolveSourceFile(frame traceFrame, repoRoot string, showVendor bool, modIn
 		}
 	}
 
+	// The frame's own module@version is what was built; prefer it to go.mod.
+	if _, module, version, rel, ok := moduleFile(frameFile); ok {
+		if dir := modules.dir(ctx, module, version); dir != "" {
+			if candidate := filepath.Join(dir, filepath.FromSlash(rel)); fileExists(candidate) {
+				return candidate, true, module, version, nil
+			}
+		}
+	}
+
 	packagePath := functionPackagePath(frame.function)
 	modulePath, moduleVersion := moduleVersionForPackage(modInfo, packagePath)
 	if showVendor && packagePath != "" {
@@ -372,9 +418,16 @@ func resolveSourceFile(frame traceFrame, repoRoot string, showVendor bool, modIn
 	}
 
 	if modulePath != "" {
-		modCandidate := findModuleCacheFile(modulePath, packagePath, filepath.Base(frameFile))
-		if modCandidate != "" {
-			return modCandidate, true, modulePath, moduleVersion, nil
+		moduleDir := ""
+		if moduleVersion != "" {
+			moduleDir = modules.dir(ctx, modulePath, moduleVersion)
+		}
+		if moduleDir == "" {
+			moduleDir = modules.latestCached(modulePath)
+		}
+		subPath := strings.TrimPrefix(strings.TrimPrefix(packagePath, modulePath), "/")
+		if candidate := filepath.Join(moduleDir, subPath, filepath.Base(frameFile)); moduleDir != "" && fileExists(candidate) {
+			return candidate, true, modulePath, moduleVersion, nil
 		}
 	}
 
@@ -454,35 +507,3 @@ func functionPackagePath(function string) string {
 	}
 	return strings.Join(append(parts[:len(parts)-1], pkgSegment), "/")
 }
-
-func findModuleCacheFile(modulePath, packagePath, baseFile string) string {
-	if modulePath == "" || baseFile == "" {
-		return ""
-	}
-	gopath := os.Getenv("GOPATH")
-	if gopath == "" {
-		home, _ := os.UserHomeDir()
-		if home != "" {
-			gopath = filepath.Join(home, "go")
-		}
-	}
-	if gopath == "" {
-		return ""
-	}
-
-	glob := filepath.Join(gopath, "pkg", "mod", modulePath+"@*")
-	matches, _ := filepath.Glob(glob)
-	if len(matches) == 0 {
-		return ""
-	}
-	sort.Strings(matches)
-	moduleDir := matches[len(matches)-1]
-
-	subPath := strings.TrimPrefix(packagePath, modulePath)
-	subPath = strings.TrimPrefix(subPath, "/")
-	candidate := filepath.Join(moduleDir, subPath, baseFile)
-	if fileExists(candidate) {
-		return candidate
-	}
-	return ""
-}
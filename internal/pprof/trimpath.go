@@ -0,0 +1,176 @@
+package pprof
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// maxTrimPathWalk bounds how many repo entries trim_path inference visits.
+const maxTrimPathWalk = 200000
+
+// TrimPathInference is the trim_path inferred by matching a profile's
+// source paths against the files under repo_root.
+type TrimPathInference struct {
+	// TrimPath is the -trim_path list: the prefixes, most files first.
+	// Empty when no profile path matched a repo file.
+	TrimPath string       `json:"trim_path"`
+	Prefixes []TrimPrefix `json:"prefixes"`
+	Matched  int          `json:"matched_files"`
+	// Unmatched counts the profile's app files not found under repo_root.
+	Unmatched int `json:"unmatched_files"`
+}
+
+// TrimPrefix is a build-time directory that maps onto repo_root.
+type TrimPrefix struct {
+	Prefix  string `json:"prefix"`
+	Files   int    `json:"files"`
+	Example string `json:"example"` // a profile path under Prefix
+	Local   string `json:"local"`   // where Example resolves under repo_root
+}
+
+// InferTrimPath finds the build-time prefixes of prof's source paths that,
+// once trimmed, leave paths of files under repoRoot. Each path is matched
+// to the repo file sharing the longest path suffix with it; standard
+// library (unless under one of repoRoot's modules) and module cache files
+// are not considered.
+func InferTrimPath(prof *profile.Profile, repoRoot string) TrimPathInference {
+	inference := TrimPathInference{Prefixes: []TrimPrefix{}}
+	modules := RepoModulePaths(repoRoot)
+	files := map[string]bool{}
+	for _, fn := range prof.Function {
+		if fn == nil || fn.Filename == "" || (isStdFunction(fn.Name) && !hasAnyPrefix(fn.Name, modules)) {
+			continue
+		}
+		if _, _, _, _, ok := moduleFile(fn.Filename); ok {
+			continue
+		}
+		files[filepath.ToSlash(fn.Filename)] = true
+	}
+	if len(files) == 0 {
+		return inference
+	}
+
+	// Index repo files by base name, keeping only names the profile uses.
+	bases := map[string]bool{}
+	for file := range files {
+		bases[path.Base(file)] = true
+	}
+	local := map[string][]string{}
+	visited := 0
+	_ = filepath.WalkDir(repoRoot, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		visited++
+		if visited > maxTrimPathWalk {
+			return filepath.SkipAll
+		}
+		if d.IsDir() {
+			if p != repoRoot && (d.Name() == ".git" || d.Name() == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !bases[d.Name()] {
+			return nil
+		}
+		if rel, err := filepath.Rel(repoRoot, p); err == nil {
+			local[d.Name()] = append(local[d.Name()], filepath.ToSlash(rel))
+		}
+		return nil
+	})
+
+	byPrefix := map[string]*TrimPrefix{}
+	sorted := make([]string, 0, len(files))
+	for file := range files {
+		sorted = append(sorted, file)
+	}
+	sort.Strings(sorted)
+	for _, file := range sorted {
+		best := ""
+		for _, rel := range local[path.Base(file)] {
+			if (file == rel || strings.HasSuffix(file, "/"+rel)) && len(rel) > len(best) {
+				best = rel
+			}
+		}
+		if best == "" {
+			inference.Unmatched++
+			continue
+		}
+		inference.Matched++
+		prefix := strings.TrimSuffix(file, best)
+		if prefix == "" {
+			continue // already relative to repo_root
+		}
+		entry, ok := byPrefix[prefix]
+		if !ok {
+			entry = &TrimPrefix{Prefix: prefix, Example: file, Local: best}
+			byPrefix[prefix] = entry
+		}
+		entry.Files++
+	}
+
+	for _, entry := range byPrefix {
+		inference.Prefixes = append(inference.Prefixes, *entry)
+	}
+	sort.Slice(inference.Prefixes, func(i, j int) bool {
+		if inference.Prefixes[i].Files != inference.Prefixes[j].Files {
+			return inference.Prefixes[i].Files > inference.Prefixes[j].Files
+		}
+		return inference.Prefixes[i].Prefix < inference.Prefixes[j].Prefix
+	})
+	prefixes := make([]string, 0, len(inference.Prefixes))
+	for _, entry := range inference.Prefixes {
+		prefixes = append(prefixes, entry.Prefix)
+	}
+	inference.TrimPath = strings.Join(prefixes, string(filepath.ListSeparator))
+	return inference
+}
+
+// repoRelative maps a profile source path onto a file under repoRoot, an
+// absolute path: by stripping one of the trims prefixes, as a path already
+// under repoRoot, or as a relative path. ok is false when no such file exists.
+func repoRelative(repoRoot string, trims []string, filename string) (string, bool) {
+	if filename == "" {
+		return "", false
+	}
+	rel := ""
+	file := filepath.ToSlash(filename)
+	for _, prefix := range trims {
+		if trimmed, ok := strings.CutPrefix(file, prefix); ok && prefix != "" {
+			rel = strings.TrimPrefix(trimmed, "/")
+			break
+		}
+	}
+	if rel == "" {
+		if r, err := filepath.Rel(repoRoot, filename); err == nil && !strings.HasPrefix(r, "..") && filepath.IsAbs(filename) {
+			rel = filepath.ToSlash(r)
+		} else if !filepath.IsAbs(filename) && !strings.HasPrefix(file, "..") {
+			rel = path.Clean(file)
+		}
+	}
+	if rel == "" {
+		return "", false
+	}
+	if _, err := os.Stat(filepath.Join(repoRoot, filepath.FromSlash(rel))); err != nil {
+		return "", false
+	}
+	return rel, true
+}
+
+// isStdFunction reports whether a function belongs to the standard library:
+// its import path's first element has no dot. Package main is app code.
+func isStdFunction(name string) bool {
+	pkg := functionPackagePath(name)
+	if pkg == "" || pkg == "main" {
+		return false
+	}
+	first, _, _ := strings.Cut(pkg, "/")
+	return !strings.Contains(first, ".")
+}
@@ -0,0 +1,44 @@
+package pprof
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInferTrimPath(t *testing.T) {
+	repoRoot := t.TempDir()
+	for _, file := range []string{"go.mod", "main.go", "pkg/api/handler.go", "pkg/api/routes.go", "internal/store/main.go", "tools/gen/handler.go"} {
+		path := filepath.Join(repoRoot, filepath.FromSlash(file))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte("module myapp\n"), 0o644))
+	}
+
+	functions := []*profile.Function{
+		{ID: 1, Name: "main.main", Filename: "/build/src/main.go"},
+		{ID: 2, Name: "myapp/pkg/api.Handle", Filename: "/build/src/pkg/api/handler.go"},
+		{ID: 3, Name: "myapp/pkg/api.Routes", Filename: "/build/src/pkg/api/routes.go"},
+		{ID: 4, Name: "myapp/internal/store.Open", Filename: "/home/ci/work/internal/store/main.go"},
+		{ID: 5, Name: "myapp/pkg/gone.Run", Filename: "/build/src/pkg/gone/run.go"},
+		{ID: 6, Name: "runtime.mallocgc", Filename: "/usr/local/go/src/runtime/malloc.go"},
+		{ID: 7, Name: "github.com/BurntSushi/toml.Decode", Filename: "/go/pkg/mod/github.com/!burnt!sushi/toml@v1.2.0/decode.go"},
+	}
+	inference := InferTrimPath(&profile.Profile{Function: functions}, repoRoot)
+	require.Equal(t, TrimPathInference{
+		TrimPath: "/build/src/:/home/ci/work/",
+		Prefixes: []TrimPrefix{
+			{Prefix: "/build/src/", Files: 3, Example: "/build/src/main.go", Local: "main.go"},
+			{Prefix: "/home/ci/work/", Files: 1, Example: "/home/ci/work/internal/store/main.go", Local: "internal/store/main.go"},
+		},
+		Matched:   4,
+		Unmatched: 1,
+	}, inference)
+
+	// Nothing to match against leaves trim_path to pprof's own heuristics.
+	inference = InferTrimPath(&profile.Profile{Function: functions}, t.TempDir())
+	require.Empty(t, inference.TrimPath)
+	require.Equal(t, 0, inference.Matched)
+}
@@ -0,0 +1,197 @@
+package pprof
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+type ValidateResult struct {
+	ProfilePath  string `json:"profile_path"`
+	Valid        bool   `json:"valid"`
+	Bytes        int64  `json:"bytes"`
+	Gzipped      bool   `json:"gzipped"`
+	DetectedKind string `json:"detected_profile_kind,omitempty"`
+	// SampleCount is the number of samples; Totals sums their values per
+	// sample type.
+	SampleCount     int           `json:"sample_count"`
+	Totals          []SampleTotal `json:"totals"`
+	DurationSeconds float64       `json:"duration_seconds"`
+	Mappings        int           `json:"mappings"`
+	// MappingCoverage is the fraction of sampled locations that belong to a
+	// mapping; SymbolizedRatio the fraction that resolve to a named function.
+	MappingCoverage float64           `json:"mapping_coverage"`
+	SymbolizedRatio float64           `json:"symbolized_ratio"`
+	Problems        []ValidateProblem `json:"problems"`
+}
+
+// ValidateProblem is one reason a profile is unusable (severity "error") or
+// will give weak answers ("warning").
+type ValidateProblem struct {
+	Severity string `json:"severity"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+}
+
+const (
+	// minSymbolizedRatio is the share of sampled locations that must resolve
+	// to function names before the profile counts as symbolized.
+	minSymbolizedRatio = 0.9
+	// minCPUDuration is the shortest CPU profile worth analyzing.
+	minCPUDuration = time.Second
+)
+
+// RunValidate checks that profilePath is a parsable pprof profile with
+// samples worth analyzing. Problems with the profile itself are reported in
+// the result; only a file that cannot be read is an error.
+func RunValidate(profilePath string) (ValidateResult, error) {
+	if profilePath == "" {
+		return ValidateResult{}, fmt.Errorf("profile is required")
+	}
+	info, err := os.Stat(profilePath)
+	if err != nil {
+		return ValidateResult{}, err
+	}
+	result := ValidateResult{
+		ProfilePath: profilePath,
+		Bytes:       info.Size(),
+		Totals:      []SampleTotal{},
+		Problems:    []ValidateProblem{},
+	}
+	result.Gzipped, err = isGzipFile(profilePath)
+	if err != nil {
+		return ValidateResult{}, err
+	}
+
+	prof, err := parseProfile(profilePath)
+	if err != nil {
+		result.addProblem("error", parseProblemCode(err, result.Bytes), err.Error())
+		return result, nil
+	}
+
+	meta, err := RunMeta(profilePath)
+	if err != nil {
+		return ValidateResult{}, err
+	}
+	result.DetectedKind = meta.DetectedKind
+	result.Totals = meta.Totals
+	result.SampleCount = len(prof.Sample)
+	result.DurationSeconds = time.Duration(prof.DurationNanos).Seconds()
+	result.Mappings = len(prof.Mapping)
+	result.MappingCoverage, result.SymbolizedRatio = locationCoverage(prof)
+
+	switch {
+	case len(prof.SampleType) == 0:
+		result.addProblem("error", "no_sample_types", "profile declares no sample types")
+	case len(prof.Sample) == 0:
+		result.addProblem("error", "zero_samples", "profile has no samples")
+	case allTotalsZero(meta.Totals):
+		result.addProblem("error", "zero_values", "every sample value is zero")
+	}
+	if len(prof.Sample) > 0 {
+		if result.SymbolizedRatio < minSymbolizedRatio {
+			message := fmt.Sprintf("only %.0f%% of sampled locations resolve to function names", result.SymbolizedRatio*100)
+			if gaps := symbolizationGaps(prof); len(gaps) > 0 {
+				message += fmt.Sprintf("; raw addresses are in %s (pprof.symbolization says which binary to pass)", strings.Join(gaps, ", "))
+			}
+			result.addProblem("warning", "unsymbolized", message)
+		}
+		if len(prof.Mapping) == 0 {
+			result.addProblem("warning", "no_mappings", "profile has no mappings, so it cannot be symbolized against a binary")
+		}
+	}
+	if meta.DetectedKind == "cpu" && prof.DurationNanos > 0 && time.Duration(prof.DurationNanos) < minCPUDuration {
+		result.addProblem("warning", "short_duration", fmt.Sprintf("CPU profile covers only %s", time.Duration(prof.DurationNanos)))
+	}
+	for _, warning := range ProfileLimitWarnings(profilePath) {
+		result.addProblem("warning", "downsampled", warning)
+	}
+
+	result.Valid = true
+	for _, problem := range result.Problems {
+		if problem.Severity == "error" {
+			result.Valid = false
+		}
+	}
+	return result, nil
+}
+
+func (r *ValidateResult) addProblem(severity, code, message string) {
+	r.Problems = append(r.Problems, ValidateProblem{Severity: severity, Code: code, Message: message})
+}
+
+// parseProblemCode names why a profile did not parse. A gzip stream that
+// ends early is a truncated download or copy.
+func parseProblemCode(err error, size int64) string {
+	switch {
+	case size == 0:
+		return "empty_file"
+	case strings.Contains(err.Error(), "unexpected EOF"):
+		return "truncated"
+	default:
+		return "unparsable"
+	}
+}
+
+func isGzipFile(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	header := make([]byte, 2)
+	n, _ := file.Read(header)
+	return n == 2 && header[0] == 0x1f && header[1] == 0x8b, nil
+}
+
+// locationCoverage returns the fraction of the locations referenced by
+// samples that have a mapping, and the fraction with a named function.
+func locationCoverage(prof *profile.Profile) (mapped, symbolized float64) {
+	seen := map[uint64]bool{}
+	var total, withMapping, withName int
+	for _, sample := range prof.Sample {
+		for _, loc := range sample.Location {
+			if loc == nil || seen[loc.ID] {
+				continue
+			}
+			seen[loc.ID] = true
+			total++
+			if loc.Mapping != nil {
+				withMapping++
+			}
+			if locationNamed(loc) {
+				withName++
+			}
+		}
+	}
+	if total == 0 {
+		return 0, 0
+	}
+	return float64(withMapping) / float64(total), float64(withName) / float64(total)
+}
+
+// symbolizationGaps lists the mappings whose sampled frames include raw
+// addresses, weighted by the default sample type.
+func symbolizationGaps(prof *profile.Profile) []string {
+	valueIndex, err := prof.SampleIndexByName("")
+	if err != nil || valueIndex < 0 {
+		return nil
+	}
+	return measureSymbolization(prof, valueIndex).NeedsSymbols
+}
+
+func allTotalsZero(totals []SampleTotal) bool {
+	for _, total := range totals {
+		if total.Total != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func FormatValidateCommand(profilePath string) string {
+	return fmt.Sprintf("profctl pprof validate --profile %s", profilePath)
+}
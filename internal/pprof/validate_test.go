@@ -0,0 +1,83 @@
+package pprof
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/require"
+)
+
+func problemCodes(result ValidateResult) []string {
+	codes := []string{}
+	for _, problem := range result.Problems {
+		codes = append(codes, problem.Code)
+	}
+	return codes
+}
+
+func TestRunValidate(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.pprof")
+	writeTestProfile(t, good, 30, 70)
+
+	result, err := RunValidate(good)
+	require.NoError(t, err)
+	require.True(t, result.Valid)
+	require.True(t, result.Gzipped)
+	require.Equal(t, 2, result.SampleCount)
+	require.Equal(t, []SampleTotal{{Type: "samples", Unit: "count", Total: 100}}, result.Totals)
+	require.Equal(t, 1.0, result.SymbolizedRatio)
+	require.Equal(t, 0.0, result.MappingCoverage)
+	require.Equal(t, []string{"no_mappings"}, problemCodes(result))
+
+	data, err := os.ReadFile(good)
+	require.NoError(t, err)
+	for name, content := range map[string][]byte{
+		"truncated": data[:len(data)/2],
+		"empty":     {},
+		"garbage":   []byte("not a profile"),
+	} {
+		path := filepath.Join(dir, name+".pprof")
+		require.NoError(t, os.WriteFile(path, content, 0o644))
+		result, err := RunValidate(path)
+		require.NoError(t, err)
+		require.False(t, result.Valid, name)
+		require.Len(t, result.Problems, 1, name)
+		require.Equal(t, "error", result.Problems[0].Severity)
+		require.Equal(t, map[string]string{"truncated": "truncated", "empty": "empty_file", "garbage": "unparsable"}[name], result.Problems[0].Code)
+	}
+
+	// A profile with no samples, and one whose addresses never resolved.
+	fn := &profile.Function{ID: 1, Name: "main.f"}
+	mapping := &profile.Mapping{ID: 1, Start: 0x1000, Limit: 0x9000, File: "/app/server"}
+	named := &profile.Location{ID: 1, Address: 0x1000, Mapping: mapping, Line: []profile.Line{{Function: fn}}}
+	raw := &profile.Location{ID: 2, Address: 0x2000, Mapping: mapping}
+	for name, samples := range map[string][]*profile.Sample{
+		"zero_samples": nil,
+		"unsymbolized": {{Location: []*profile.Location{raw, named}, Value: []int64{5}}},
+	} {
+		prof := &profile.Profile{
+			SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}},
+			Sample:     samples,
+			Mapping:    []*profile.Mapping{mapping},
+			Location:   []*profile.Location{named, raw},
+			Function:   []*profile.Function{fn},
+		}
+		path := filepath.Join(dir, name+".pprof")
+		file, err := os.Create(path)
+		require.NoError(t, err)
+		require.NoError(t, prof.Write(file))
+		require.NoError(t, file.Close())
+
+		result, err := RunValidate(path)
+		require.NoError(t, err)
+		require.Equal(t, []string{name}, problemCodes(result))
+		require.Equal(t, name == "unsymbolized", result.Valid)
+		if name == "unsymbolized" {
+			require.Equal(t, 0.5, result.SymbolizedRatio)
+			require.Equal(t, 1.0, result.MappingCoverage)
+		}
+	}
+}
@@ -2,7 +2,6 @@ package pprof
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"regexp"
 	"sort"
@@ -21,14 +20,24 @@ const (
 type VendorAnalyzeParams struct {
 	Profile      string
 	RepoRoot     string
+	RepoPrefixes []string // app-owned code; default: the go.mod and go.work modules at RepoRoot
 	MinPct       float64
+	// CheckUpdates looks the hottest dependencies up in the module proxy and
+	// deps.dev. ModuleProxy defaults to GOPROXY's first proxy and DepsDevURL
+	// to the public API.
 	CheckUpdates bool
+	ModuleProxy  string
+	DepsDevURL   string
+	// Patterns are known issues from the config file's pattern library,
+	// matched after the built-in ones.
+	Patterns []PatternRule
 }
 
 type VendorAnalyzeResult struct {
 	VendorHotspots []VendorHotspot `json:"vendor_hotspots"`
 	TotalVendorPct float64         `json:"total_vendor_pct"`
 	TotalAppPct    float64         `json:"total_app_pct"`
+	RepoPrefixes   []string        `json:"repo_prefixes,omitempty"`
 	Warnings       []string        `json:"warnings,omitempty"`
 }
 
@@ -41,6 +50,7 @@ type VendorHotspot struct {
 	RepoURL      string           `json:"repo_url,omitempty"`
 	Latest       string           `json:"latest_version,omitempty"`
 	KnownIssues  []KnownIssue     `json:"known_issues,omitempty"`
+	Update       *VendorUpdate    `json:"update,omitempty"`
 }
 
 type VendorFunction struct {
@@ -50,6 +60,7 @@ type VendorFunction struct {
 
 type KnownIssue struct {
 	Pattern        string `json:"pattern"`
+	Category       string `json:"category,omitempty"`
 	Severity       string `json:"severity"`
 	Issue          string `json:"issue"`
 	Recommendation string `json:"recommendation"`
@@ -79,7 +90,6 @@ type vendorHotspotBuilder struct {
 	functions   []VendorFunction
 	knownIssues []KnownIssue
 	repoURL     string
-	latest      string
 }
 
 func RunVendorAnalyze(ctx context.Context, params VendorAnalyzeParams) (VendorAnalyzeResult, error) {
@@ -113,6 +123,11 @@ func RunVendorAnalyze(ctx context.Context, params VendorAnalyzeParams) (VendorAn
 		result.Warnings = append(result.Warnings, "go.mod not found or unreadable; version info omitted")
 	}
 
+	result.RepoPrefixes = resolveRepoPrefixes(params.RepoPrefixes, repoRoot)
+	if len(result.RepoPrefixes) == 0 {
+		result.Warnings = append(result.Warnings, "no repo_prefix given or module found at repo_root; all hot code is counted as vendor")
+	}
+
 	issuesDB, err := loadPerfIssueDB()
 	if err != nil {
 		result.Warnings = append(result.Warnings, "known_perf_issues.yaml unavailable; known issues omitted")
@@ -130,7 +145,7 @@ func RunVendorAnalyze(ctx context.Context, params VendorAnalyzeParams) (VendorAn
 		if funcName == "" {
 			continue
 		}
-		isApp := modInfo.ModulePath != "" && strings.HasPrefix(funcName, modInfo.ModulePath)
+		isApp := hasAnyPrefix(funcName, result.RepoPrefixes)
 		if isApp {
 			result.TotalAppPct += flat
 			continue
@@ -172,13 +187,7 @@ func RunVendorAnalyze(ctx context.Context, params VendorAnalyzeParams) (VendorAn
 			builder.functions = builder.functions[:maxVendorFunctions]
 		}
 		builder.knownIssues = matchKnownIssues(issuesDB, builder.pkg, builder.functions)
-		if params.CheckUpdates && builder.pkg != "" {
-			if latest, err := lookupLatestVersion(ctx, builder.pkg); err == nil {
-				builder.latest = latest
-			} else {
-				result.Warnings = append(result.Warnings, fmt.Sprintf("update check failed for %s: %v", builder.pkg, err))
-			}
-		}
+		builder.knownIssues = append(builder.knownIssues, matchPatternRules(params.Patterns, builder.pkg, builder.functions)...)
 
 		result.VendorHotspots = append(result.VendorHotspots, VendorHotspot{
 			Package:      builder.pkg,
@@ -187,17 +196,55 @@ func RunVendorAnalyze(ctx context.Context, params VendorAnalyzeParams) (VendorAn
 			TotalCumPct:  roundPct(builder.totalCum),
 			HotFunctions: builder.functions,
 			RepoURL:      builder.repoURL,
-			Latest:       builder.latest,
 			KnownIssues:  builder.knownIssues,
 		})
 	}
 
 	sort.Slice(result.VendorHotspots, func(i, j int) bool {
-		return result.VendorHotspots[i].TotalFlatPct > result.VendorHotspots[j].TotalFlatPct
+		a, b := result.VendorHotspots[i], result.VendorHotspots[j]
+		if a.TotalFlatPct != b.TotalFlatPct {
+			return a.TotalFlatPct > b.TotalFlatPct
+		}
+		return a.Package < b.Package
 	})
+	if params.CheckUpdates {
+		checkVendorUpdates(ctx, newModuleIndex(params.ModuleProxy, params.DepsDevURL), &result)
+	}
 	return result, nil
 }
 
+// checkVendorUpdates fills in the update of the hottest module hotspots.
+// Modules matching GOPRIVATE or GONOPROXY are not sent out.
+func checkVendorUpdates(ctx context.Context, index *moduleIndex, result *VendorAnalyzeResult) {
+	checked := 0
+	for i := range result.VendorHotspots {
+		hotspot := &result.VendorHotspots[i]
+		// Standard library and runtime frames have no module to look up.
+		if !strings.Contains(strings.SplitN(hotspot.Package, "/", 2)[0], ".") {
+			continue
+		}
+		if index.isPrivate(hotspot.Package) {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("update check skipped for private module %s", hotspot.Package))
+			continue
+		}
+		if checked == maxVendorUpdateChecks {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("update checks limited to the %d hottest modules", maxVendorUpdateChecks))
+			return
+		}
+		checked++
+		update, warning, err := index.update(ctx, hotspot.Package, hotspot.Version)
+		if err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("update check failed for %s: %v", hotspot.Package, err))
+			continue
+		}
+		if warning != "" {
+			result.Warnings = append(result.Warnings, warning)
+		}
+		hotspot.Update = update
+		hotspot.Latest = update.Latest
+	}
+}
+
 func loadPerfIssueDB() (perfIssueDB, error) {
 	var db perfIssueDB
 	content := pprofdata.KnownPerfIssuesYAML()
@@ -236,6 +283,35 @@ func matchKnownIssues(db perfIssueDB, packageKey string, functions []VendorFunct
 	return issues
 }
 
+// matchPatternRules returns the configured rules for packageKey that match
+// one of its hot functions. A rule's package may be the hotspot's module or
+// a package inside it.
+func matchPatternRules(rules []PatternRule, packageKey string, functions []VendorFunction) []KnownIssue {
+	var issues []KnownIssue
+	for _, rule := range rules {
+		if rule.Package != "" && rule.Package != packageKey && !strings.HasPrefix(rule.Package, packageKey+"/") && !strings.HasPrefix(packageKey, rule.Package+"/") {
+			continue
+		}
+		re, err := regexp.Compile(rule.Regex)
+		if err != nil {
+			continue
+		}
+		for _, fn := range functions {
+			if (rule.Package == "" || strings.HasPrefix(fn.Name, rule.Package)) && re.MatchString(fn.Name) {
+				issues = append(issues, KnownIssue{
+					Pattern:        rule.Regex,
+					Category:       rule.Category,
+					Severity:       rule.Severity,
+					Issue:          rule.Explanation,
+					Recommendation: rule.Remediation,
+				})
+				break
+			}
+		}
+	}
+	return issues
+}
+
 func repoURLForPackage(pkg string) string {
 	switch {
 	case strings.HasPrefix(pkg, "github.com/"):
@@ -252,21 +328,11 @@ func repoURLForPackage(pkg string) string {
 	return ""
 }
 
-func lookupLatestVersion(ctx context.Context, modulePath string) (string, error) {
-	output, err := runCommand(ctx, "go", "list", "-m", "-u", "-json", modulePath)
-	if err != nil {
-		return "", fmt.Errorf("go list failed: %w (%s)", err, strings.TrimSpace(output.Stderr))
-	}
-	var payload struct {
-		Latest *struct {
-			Version string `json:"Version"`
-		} `json:"Latest"`
-	}
-	if err := json.Unmarshal([]byte(output.Stdout), &payload); err != nil {
-		return "", err
-	}
-	if payload.Latest == nil {
-		return "", nil
+func hasAnyPrefix(value string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if prefix != "" && strings.HasPrefix(value, prefix) {
+			return true
+		}
 	}
-	return payload.Latest.Version, nil
+	return false
 }
@@ -0,0 +1,32 @@
+package pprof
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchPatternRules(t *testing.T) {
+	rules := []PatternRule{
+		{Package: "github.com/acme/rpc/client", Regex: `\(\*Client\)\.Dial`, Category: "Connections", Severity: "high", Explanation: "dials per call", Remediation: "reuse the client"},
+		{Package: "github.com/acme/other", Regex: "Dial", Explanation: "other package"},
+		{Regex: `reflect\.`, Explanation: "reflection in a dependency"},
+	}
+	functions := []VendorFunction{
+		{Name: "github.com/acme/rpc/client.(*Client).Dial", FlatPct: 4},
+		{Name: "github.com/acme/rpc/codec.Encode", FlatPct: 2},
+	}
+	issues := matchPatternRules(rules, "github.com/acme/rpc", functions)
+	require.Equal(t, []KnownIssue{{
+		Pattern:        `\(\*Client\)\.Dial`,
+		Category:       "Connections",
+		Severity:       "high",
+		Issue:          "dials per call",
+		Recommendation: "reuse the client",
+	}}, issues)
+
+	// A package-less rule applies to any dependency.
+	issues = matchPatternRules(rules, "encoding/json", []VendorFunction{{Name: "encoding/json.(*decodeState).object"}, {Name: "reflect.Value.Field"}})
+	require.Len(t, issues, 1)
+	require.Equal(t, "reflection in a dependency", issues[0].Issue)
+}
@@ -0,0 +1,358 @@
+package pprof
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultModuleProxy      = "https://proxy.golang.org"
+	defaultDepsDevURL       = "https://api.deps.dev"
+	maxVendorUpdateChecks   = 10
+	vendorUpdateHTTPTimeout = 10 * time.Second
+)
+
+// Update statuses: how go.mod's version compares to the latest release.
+const (
+	UpdateCurrent = "current"
+	UpdateBehind  = "behind"
+	UpdateAhead   = "ahead"   // a pseudo-version or prerelease past the latest release
+	UpdateUnknown = "unknown" // go.mod has no version for the module
+)
+
+// VendorUpdate compares a hot dependency's go.mod version with what the
+// module proxy and deps.dev know about it.
+type VendorUpdate struct {
+	Status        string     `json:"status"`
+	VersionTime   string     `json:"version_time,omitempty"` // release date of go.mod's version
+	Latest        string     `json:"latest_version,omitempty"`
+	LatestTime    string     `json:"latest_time,omitempty"`
+	NewerVersions int        `json:"newer_versions"` // releases after go.mod's version, up to latest
+	DaysBehind    int        `json:"days_behind,omitempty"`
+	Advisories    []Advisory `json:"advisories,omitempty"`
+}
+
+// Advisory is a security advisory deps.dev lists for go.mod's version.
+type Advisory struct {
+	ID            string   `json:"id"`
+	Title         string   `json:"title,omitempty"`
+	URL           string   `json:"url,omitempty"`
+	Aliases       []string `json:"aliases,omitempty"`
+	CVSS3Score    float64  `json:"cvss3_score,omitempty"`
+	FixedInLatest bool     `json:"fixed_in_latest"`
+}
+
+// moduleIndex looks modules up in a Go module proxy and deps.dev.
+type moduleIndex struct {
+	proxy   string // empty when GOPROXY allows no proxy
+	depsDev string
+	private []string // GOPRIVATE/GONOPROXY patterns, never sent out
+	client  *http.Client
+}
+
+// newModuleIndex uses proxy and depsDev when given, else the first proxy
+// in GOPROXY and the public deps.dev API.
+func newModuleIndex(proxy, depsDev string) *moduleIndex {
+	index := &moduleIndex{
+		proxy:   strings.TrimRight(proxy, "/"),
+		depsDev: strings.TrimRight(depsDev, "/"),
+		client:  &http.Client{Timeout: vendorUpdateHTTPTimeout},
+	}
+	if index.proxy == "" {
+		index.proxy = goProxyFromEnv(os.Getenv("GOPROXY"))
+	}
+	if index.depsDev == "" {
+		index.depsDev = defaultDepsDevURL
+	}
+	for _, key := range []string{"GOPRIVATE", "GONOPROXY"} {
+		for _, pattern := range strings.Split(os.Getenv(key), ",") {
+			if pattern = strings.TrimSpace(pattern); pattern != "" {
+				index.private = append(index.private, pattern)
+			}
+		}
+	}
+	return index
+}
+
+// goProxyFromEnv returns the first HTTP proxy in a GOPROXY list, or "" when
+// the list has none (off, direct).
+func goProxyFromEnv(value string) string {
+	if strings.TrimSpace(value) == "" {
+		return defaultModuleProxy
+	}
+	for _, entry := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '|' }) {
+		entry = strings.TrimSpace(entry)
+		if strings.HasPrefix(entry, "https://") || strings.HasPrefix(entry, "http://") {
+			return strings.TrimRight(entry, "/")
+		}
+	}
+	return ""
+}
+
+// isPrivate reports whether module matches a GOPRIVATE/GONOPROXY pattern,
+// which like the go command match a leading run of path elements.
+func (m *moduleIndex) isPrivate(module string) bool {
+	for _, pattern := range m.private {
+		n := strings.Count(pattern, "/") + 1
+		prefix := module
+		if parts := strings.SplitN(module, "/", n+1); len(parts) > n {
+			prefix = strings.Join(parts[:n], "/")
+		}
+		if ok, _ := path.Match(pattern, prefix); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// update looks module up and diffs version against the latest release.
+// Advisory lookups are best-effort: their failure is returned as a warning.
+func (m *moduleIndex) update(ctx context.Context, module, version string) (*VendorUpdate, string, error) {
+	if m.proxy == "" {
+		return nil, "", fmt.Errorf("GOPROXY names no proxy")
+	}
+	escaped := escapeModulePath(module)
+	var latest struct {
+		Version string
+		Time    string
+	}
+	if err := m.getJSON(ctx, m.proxy+"/"+escaped+"/@latest", &latest); err != nil {
+		return nil, "", err
+	}
+	update := &VendorUpdate{
+		Status:     UpdateUnknown,
+		Latest:     latest.Version,
+		LatestTime: latest.Time,
+	}
+	if version == "" {
+		return update, "", nil
+	}
+
+	switch cmp := compareSemver(version, latest.Version); {
+	case cmp < 0:
+		update.Status = UpdateBehind
+	case cmp > 0:
+		update.Status = UpdateAhead
+	default:
+		update.Status = UpdateCurrent
+	}
+	var info struct{ Time string }
+	if err := m.getJSON(ctx, m.proxy+"/"+escaped+"/@v/"+escapeModulePath(version)+".info", &info); err == nil {
+		update.VersionTime = info.Time
+	}
+	if update.Status == UpdateBehind {
+		if list, err := m.get(ctx, m.proxy+"/"+escaped+"/@v/list"); err == nil {
+			for _, release := range strings.Fields(string(list)) {
+				if !isPrerelease(release) && compareSemver(release, version) > 0 && compareSemver(release, latest.Version) <= 0 {
+					update.NewerVersions++
+				}
+			}
+		}
+		current, errCurrent := time.Parse(time.RFC3339, update.VersionTime)
+		newest, errLatest := time.Parse(time.RFC3339, update.LatestTime)
+		if errCurrent == nil && errLatest == nil && newest.After(current) {
+			update.DaysBehind = int(newest.Sub(current).Hours() / 24)
+		}
+	}
+
+	advisories, err := m.advisories(ctx, module, version, latest.Version)
+	if err != nil {
+		return update, fmt.Sprintf("advisory lookup failed for %s@%s: %v", module, version, err), nil
+	}
+	update.Advisories = advisories
+	return update, "", nil
+}
+
+// advisories lists deps.dev's advisories for module@version, marking those
+// that no longer affect latest.
+func (m *moduleIndex) advisories(ctx context.Context, module, version, latest string) ([]Advisory, error) {
+	ids, err := m.advisoryIDs(ctx, module, version)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	stillAffected := map[string]bool{}
+	if latest != "" && latest != version {
+		latestIDs, err := m.advisoryIDs(ctx, module, latest)
+		if err != nil {
+			latestIDs = ids // unknown: claim no fixes
+		}
+		for _, id := range latestIDs {
+			stillAffected[id] = true
+		}
+	} else {
+		for _, id := range ids {
+			stillAffected[id] = true
+		}
+	}
+
+	advisories := make([]Advisory, 0, len(ids))
+	for _, id := range ids {
+		advisory := Advisory{ID: id, FixedInLatest: !stillAffected[id]}
+		var detail struct {
+			URL        string   `json:"url"`
+			Title      string   `json:"title"`
+			Aliases    []string `json:"aliases"`
+			CVSS3Score float64  `json:"cvss3Score"`
+		}
+		if err := m.getJSON(ctx, m.depsDev+"/v3/advisories/"+url.PathEscape(id), &detail); err == nil {
+			advisory.URL = detail.URL
+			advisory.Title = detail.Title
+			advisory.Aliases = detail.Aliases
+			advisory.CVSS3Score = detail.CVSS3Score
+		}
+		advisories = append(advisories, advisory)
+	}
+	return advisories, nil
+}
+
+func (m *moduleIndex) advisoryIDs(ctx context.Context, module, version string) ([]string, error) {
+	var payload struct {
+		AdvisoryKeys []struct {
+			ID string `json:"id"`
+		} `json:"advisoryKeys"`
+	}
+	target := m.depsDev + "/v3/systems/go/packages/" + url.PathEscape(module) + "/versions/" + url.PathEscape(version)
+	if err := m.getJSON(ctx, target, &payload); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(payload.AdvisoryKeys))
+	for _, key := range payload.AdvisoryKeys {
+		ids = append(ids, key.ID)
+	}
+	return ids, nil
+}
+
+func (m *moduleIndex) getJSON(ctx context.Context, target string, out any) error {
+	body, err := m.get(ctx, target)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, out)
+}
+
+func (m *moduleIndex) get(ctx context.Context, target string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", target, resp.Status)
+	}
+	return body, nil
+}
+
+// escapeModulePath applies the module proxy's case encoding: each upper-case
+// letter becomes '!' and its lower-case form.
+func escapeModulePath(value string) string {
+	var b strings.Builder
+	for _, r := range value {
+		if 'A' <= r && r <= 'Z' {
+			b.WriteByte('!')
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func isPrerelease(version string) bool {
+	_, _, _, pre := parseSemver(version)
+	return pre != ""
+}
+
+// compareSemver orders two Go module versions. Build metadata such as
+// +incompatible is ignored, and unparsable versions sort first.
+func compareSemver(a, b string) int {
+	aMajor, aMinor, aPatch, aPre := parseSemver(a)
+	bMajor, bMinor, bPatch, bPre := parseSemver(b)
+	for _, pair := range [][2]int{{aMajor, bMajor}, {aMinor, bMinor}, {aPatch, bPatch}} {
+		if pair[0] != pair[1] {
+			if pair[0] < pair[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	}
+	aIDs, bIDs := strings.Split(aPre, "."), strings.Split(bPre, ".")
+	for i := 0; i < len(aIDs) && i < len(bIDs); i++ {
+		if cmp := comparePrereleaseID(aIDs[i], bIDs[i]); cmp != 0 {
+			return cmp
+		}
+	}
+	switch {
+	case len(aIDs) < len(bIDs):
+		return -1
+	case len(aIDs) > len(bIDs):
+		return 1
+	}
+	return 0
+}
+
+// parseSemver splits vMAJOR.MINOR.PATCH[-PRE][+BUILD]; major is -1 when
+// the version does not parse.
+func parseSemver(version string) (major, minor, patch int, pre string) {
+	version, _, _ = strings.Cut(version, "+")
+	if !strings.HasPrefix(version, "v") {
+		return -1, 0, 0, ""
+	}
+	core, pre, _ := strings.Cut(version[1:], "-")
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return -1, 0, 0, ""
+	}
+	nums := make([]int, 3)
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return -1, 0, 0, ""
+		}
+		nums[i] = n
+	}
+	return nums[0], nums[1], nums[2], pre
+}
+
+func comparePrereleaseID(a, b string) int {
+	aNum, aErr := strconv.Atoi(a)
+	bNum, bErr := strconv.Atoi(b)
+	switch {
+	case aErr == nil && bErr == nil:
+		if aNum != bNum {
+			if aNum < bNum {
+				return -1
+			}
+			return 1
+		}
+		return 0
+	case aErr == nil:
+		return -1 // numeric identifiers sort before alphanumeric ones
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
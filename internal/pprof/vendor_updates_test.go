@@ -0,0 +1,75 @@
+package pprof
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckVendorUpdates(t *testing.T) {
+	responses := map[string]string{
+		"/proxy/github.com/!burnt!sushi/toml/@latest":                                 `{"Version":"v1.4.0","Time":"2024-06-01T00:00:00Z"}`,
+		"/proxy/github.com/!burnt!sushi/toml/@v/v1.2.0.info":                          `{"Version":"v1.2.0","Time":"2022-06-01T00:00:00Z"}`,
+		"/proxy/github.com/!burnt!sushi/toml/@v/list":                                 "v1.1.0\nv1.2.0\nv1.3.0\nv1.3.1-rc.1\nv1.3.1\nv1.4.0\n",
+		"/deps/v3/systems/go/packages/github.com%2FBurntSushi%2Ftoml/versions/v1.2.0": `{"advisoryKeys":[{"id":"GHSA-aaaa"},{"id":"GHSA-bbbb"}]}`,
+		"/deps/v3/systems/go/packages/github.com%2FBurntSushi%2Ftoml/versions/v1.4.0": `{"advisoryKeys":[{"id":"GHSA-bbbb"}]}`,
+		"/deps/v3/advisories/GHSA-aaaa":                                               `{"title":"Stack exhaustion in Decode","url":"https://osv.dev/GHSA-aaaa","aliases":["CVE-2023-0001"],"cvss3Score":7.5}`,
+		"/proxy/golang.org/x/net/@latest":                                             `{"Version":"v0.30.0","Time":"2024-10-01T00:00:00Z"}`,
+		"/deps/v3/systems/go/packages/golang.org%2Fx%2Fnet/versions/v0.30.0":          `{}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses[r.URL.EscapedPath()]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	t.Setenv("GOPRIVATE", "github.com/acme/*")
+	t.Setenv("GONOPROXY", "")
+	result := VendorAnalyzeResult{VendorHotspots: []VendorHotspot{
+		{Package: "github.com/BurntSushi/toml", Version: "v1.2.0"},
+		{Package: "runtime"},
+		{Package: "github.com/acme/internal-lib", Version: "v0.1.0"},
+		{Package: "golang.org/x/net", Version: "v0.30.0"},
+		{Package: "github.com/gone/away", Version: "v1.0.0"},
+	}}
+	checkVendorUpdates(context.Background(), newModuleIndex(server.URL+"/proxy", server.URL+"/deps"), &result)
+
+	require.Equal(t, &VendorUpdate{
+		Status:        UpdateBehind,
+		VersionTime:   "2022-06-01T00:00:00Z",
+		Latest:        "v1.4.0",
+		LatestTime:    "2024-06-01T00:00:00Z",
+		NewerVersions: 3,
+		DaysBehind:    731,
+		Advisories: []Advisory{
+			{ID: "GHSA-aaaa", Title: "Stack exhaustion in Decode", URL: "https://osv.dev/GHSA-aaaa", Aliases: []string{"CVE-2023-0001"}, CVSS3Score: 7.5, FixedInLatest: true},
+			{ID: "GHSA-bbbb"},
+		},
+	}, result.VendorHotspots[0].Update)
+	require.Equal(t, "v1.4.0", result.VendorHotspots[0].Latest)
+	require.Nil(t, result.VendorHotspots[1].Update)
+	require.Nil(t, result.VendorHotspots[2].Update)
+	require.Equal(t, &VendorUpdate{Status: UpdateCurrent, Latest: "v0.30.0", LatestTime: "2024-10-01T00:00:00Z"}, result.VendorHotspots[3].Update)
+	require.Nil(t, result.VendorHotspots[4].Update)
+	require.Len(t, result.Warnings, 2)
+	require.Equal(t, "update check skipped for private module github.com/acme/internal-lib", result.Warnings[0])
+	require.Contains(t, result.Warnings[1], "update check failed for github.com/gone/away")
+}
+
+func TestCompareSemver(t *testing.T) {
+	require.Equal(t, -1, compareSemver("v1.2.0", "v1.10.0"))
+	require.Equal(t, 1, compareSemver("v1.3.0", "v1.3.0-rc.1"))
+	require.Equal(t, -1, compareSemver("v1.3.0-rc.2", "v1.3.0-rc.10"))
+	require.Equal(t, 1, compareSemver("v0.0.0-20240601000000-abcdef123456", "v0.0.0-20230101000000-abcdef123456"))
+	require.Equal(t, 0, compareSemver("v2.0.0+incompatible", "v2.0.0"))
+	require.Equal(t, -1, compareSemver("latest", "v0.1.0"))
+	require.Equal(t, "", goProxyFromEnv("off"))
+	require.Equal(t, "https://goproxy.example.com", goProxyFromEnv("https://goproxy.example.com/,direct"))
+}
@@ -0,0 +1,131 @@
+package pprofparse
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Canonical units of a Quantity.
+const (
+	UnitSeconds = "seconds"
+	UnitBytes   = "bytes"
+	UnitCount   = "" // a plain number: samples, objects, contentions
+)
+
+// Quantity is a value pprof printed, such as 1.50s, 250ms, 12.5MB, or 300,
+// normalized to seconds, bytes, or a count.
+type Quantity struct {
+	Value float64
+	Unit  string
+}
+
+// timeUnits are pprof's duration units (and their common spellings) in
+// seconds. They are matched case-sensitively so ms is never megaseconds.
+var timeUnits = map[string]float64{
+	"ns":   1e-9,
+	"us":   1e-6,
+	"µs":   1e-6, // micro sign
+	"μs":   1e-6, // Greek mu
+	"ms":   1e-3,
+	"s":    1,
+	"sec":  1,
+	"secs": 1,
+	"min":  60,
+	"mins": 60,
+	"hr":   3600,
+	"hrs":  3600,
+	"day":  86400,
+	"days": 86400,
+}
+
+// byteUnits are size units in bytes, keyed lower case. pprof's kB, MB, ...
+// are powers of 1024, so the KiB spellings mean the same.
+var byteUnits = map[string]float64{
+	"b":   1,
+	"kb":  1 << 10,
+	"kib": 1 << 10,
+	"mb":  1 << 20,
+	"mib": 1 << 20,
+	"gb":  1 << 30,
+	"gib": 1 << 30,
+	"tb":  1 << 40,
+	"tib": 1 << 40,
+	"pb":  1 << 50,
+	"pib": 1 << 50,
+}
+
+// ParseQuantity parses a pprof value into its canonical unit. It accepts
+// thousands separators (1,234.5ms, 1.234,5ms, 1 234ms, 1'234ms), a decimal
+// comma (1,5s), and a space before the unit.
+func ParseQuantity(value string) (Quantity, bool) {
+	value = strings.TrimSpace(value)
+	end := strings.LastIndexAny(value, "0123456789") + 1
+	if end == 0 {
+		return Quantity{}, false
+	}
+	number, ok := parseNumber(value[:end])
+	if !ok {
+		return Quantity{}, false
+	}
+	unit := strings.TrimSpace(value[end:])
+	if unit == "" {
+		return Quantity{Value: number, Unit: UnitCount}, true
+	}
+	if mult, ok := timeUnits[unit]; ok {
+		return Quantity{Value: number * mult, Unit: UnitSeconds}, true
+	}
+	if mult, ok := byteUnits[strings.ToLower(unit)]; ok {
+		return Quantity{Value: number * mult, Unit: UnitBytes}, true
+	}
+	return Quantity{}, false
+}
+
+// ParsePercent parses "12.3%" or "12.3", with the separators ParseQuantity
+// accepts, to 12.3.
+func ParsePercent(value string) (float64, bool) {
+	value = strings.TrimSuffix(strings.TrimSpace(value), "%")
+	return parseNumber(value)
+}
+
+var groupedThousands = regexp.MustCompile(`^[-+]?\d{1,3}(,\d{3})+$`)
+
+func parseNumber(value string) (float64, bool) {
+	parsed, err := strconv.ParseFloat(normalizeNumber(value), 64)
+	return parsed, err == nil
+}
+
+// normalizeNumber rewrites a number written with grouping separators or a
+// decimal comma into the form strconv.ParseFloat reads.
+func normalizeNumber(value string) string {
+	value = strings.Map(func(r rune) rune {
+		// Grouping: spaces (also no-break and narrow no-break), apostrophes,
+		// and underscores.
+		switch r {
+		case ' ', '\u00a0', '\u202f', '\'', '_':
+			return -1
+		}
+		return r
+	}, value)
+	dot := strings.LastIndex(value, ".")
+	comma := strings.LastIndex(value, ",")
+	switch {
+	case comma < 0 && strings.Count(value, ".") > 1:
+		// 1.234.567
+		return strings.ReplaceAll(value, ".", "")
+	case comma < 0:
+		return value
+	case dot > comma:
+		// 1,234.5
+		return strings.ReplaceAll(value, ",", "")
+	case dot >= 0:
+		// 1.234,5
+		return strings.Replace(strings.ReplaceAll(value, ".", ""), ",", ".", 1)
+	case groupedThousands.MatchString(value):
+		// 1,234 is read as a thousand, not a decimal.
+		return strings.ReplaceAll(value, ",", "")
+	default:
+		// 1,5
+		return strings.Replace(value, ",", ".", 1)
+	}
+}
@@ -0,0 +1,63 @@
+package pprofparse
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseQuantity(t *testing.T) {
+	cases := []struct {
+		in    string
+		value float64
+		unit  string
+	}{
+		{"250ms", 0.25, UnitSeconds},
+		{"1.50s", 1.5, UnitSeconds},
+		{"-0.30s", -0.3, UnitSeconds},
+		{"800ns", 800e-9, UnitSeconds},
+		{"12us", 12e-6, UnitSeconds},
+		{"12µs", 12e-6, UnitSeconds},
+		{"12μs", 12e-6, UnitSeconds},
+		{"2mins", 120, UnitSeconds},
+		{"1.5hrs", 5400, UnitSeconds},
+		{"1,234.5ms", 1.2345, UnitSeconds},
+		{"1.234,5ms", 1.2345, UnitSeconds},
+		{"1,5s", 1.5, UnitSeconds},
+		{"12 ms", 0.012, UnitSeconds},
+		{"512B", 512, UnitBytes},
+		{"512kB", 512 << 10, UnitBytes},
+		{"512KB", 512 << 10, UnitBytes},
+		{"12.5MB", 12.5 * (1 << 20), UnitBytes},
+		{"3GiB", 3 << 30, UnitBytes},
+		{"2TB", 2 << 40, UnitBytes},
+		{"1 024 MB", 1 << 30, UnitBytes},
+		{"1'024MB", 1 << 30, UnitBytes},
+		{"300", 300, UnitCount},
+		{"1,200", 1200, UnitCount},
+		{"1.234.567", 1234567, UnitCount},
+		{"0", 0, UnitCount},
+	}
+	for _, tc := range cases {
+		quantity, ok := ParseQuantity(tc.in)
+		require.True(t, ok, tc.in)
+		require.InDelta(t, tc.value, quantity.Value, 1e-9*max(1, tc.value), tc.in)
+		require.Equal(t, tc.unit, quantity.Unit, tc.in)
+	}
+
+	for _, in := range []string{"", ".", "ms", "12furlongs", "1.2.3,4,5s"} {
+		_, ok := ParseQuantity(in)
+		require.False(t, ok, in)
+	}
+}
+
+func TestParsePercent(t *testing.T) {
+	value, ok := ParsePercent("12.34%")
+	require.True(t, ok)
+	require.InDelta(t, 12.34, value, 1e-9)
+	value, ok = ParsePercent("12,34%")
+	require.True(t, ok)
+	require.InDelta(t, 12.34, value, 1e-9)
+	_, ok = ParsePercent("n/a")
+	require.False(t, ok)
+}
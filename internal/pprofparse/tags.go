@@ -0,0 +1,41 @@
+package pprofparse
+
+import (
+	"regexp"
+	"strings"
+)
+
+// TagValue is one value of a profile label and the weight of the samples
+// carrying it, as printed by `go tool pprof -tags`.
+type TagValue struct {
+	Tag    string `json:"tag"`
+	Value  string `json:"value"`
+	Weight string `json:"weight"`
+	Pct    string `json:"pct"`
+}
+
+var (
+	tagHeaderPattern = regexp.MustCompile(`^(\S+): Total `)
+	tagValuePattern  = regexp.MustCompile(`^(\S+) \(\s*([0-9.]+%)\): (.*)$`)
+)
+
+func ParseTags(output string) []TagValue {
+	values := []TagValue{}
+	tag := ""
+	for _, line := range strings.Split(output, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if match := tagHeaderPattern.FindStringSubmatch(trimmed); match != nil {
+			tag = match[1]
+			continue
+		}
+		match := tagValuePattern.FindStringSubmatch(trimmed)
+		if match == nil || tag == "" {
+			continue
+		}
+		values = append(values, TagValue{Tag: tag, Value: match[3], Weight: match[1], Pct: match[2]})
+	}
+	return values
+}
@@ -0,0 +1,22 @@
+package pprofparse
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTags(t *testing.T) {
+	output := ` route: Total 890ms of 890ms (  100%)
+        600ms (67.42%): /a
+        290ms (32.58%): /b
+
+ tenant_id: Total 600ms of 890ms (67.42%)
+            600ms (67.42%): abc:def`
+
+	values := ParseTags(output)
+	require.Len(t, values, 3)
+	require.Equal(t, TagValue{Tag: "route", Value: "/a", Weight: "600ms", Pct: "67.42%"}, values[0])
+	require.Equal(t, "tenant_id", values[2].Tag)
+	require.Equal(t, "abc:def", values[2].Value)
+}
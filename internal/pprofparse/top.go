@@ -3,7 +3,6 @@ package pprofparse
 import (
 	"regexp"
 	"sort"
-	"strconv"
 	"strings"
 )
 
@@ -13,14 +12,20 @@ type TopSummary struct {
 }
 
 type TopRow struct {
-	Flat        string   `json:"flat"`
-	FlatPct     string   `json:"flat_pct"`
-	SumPct      string   `json:"sum_pct"`
-	Cum         string   `json:"cum"`
-	CumPct      string   `json:"cum_pct"`
-	Name        string   `json:"name"`
+	Flat    string `json:"flat"`
+	FlatPct string `json:"flat_pct"`
+	SumPct  string `json:"sum_pct"`
+	Cum     string `json:"cum"`
+	CumPct  string `json:"cum_pct"`
+	Name    string `json:"name"`
+	// Each value lands in the field of its unit: time, size, or a plain
+	// count (samples, objects, goroutines).
 	FlatSeconds *float64 `json:"flat_seconds,omitempty"`
 	CumSeconds  *float64 `json:"cum_seconds,omitempty"`
+	FlatBytes   *float64 `json:"flat_bytes,omitempty"`
+	CumBytes    *float64 `json:"cum_bytes,omitempty"`
+	FlatCount   *float64 `json:"flat_count,omitempty"`
+	CumCount    *float64 `json:"cum_count,omitempty"`
 }
 
 type TopReport struct {
@@ -32,7 +37,10 @@ var tableHeaderPattern = regexp.MustCompile(`(?i)^\s*flat\s+flat%\s+sum%\s+cum\s
 
 func ParseTop(output string) TopReport {
 	lines := strings.Split(output, "\n")
-	report := TopReport{}
+	report := TopReport{
+		Summary: TopSummary{HeaderLines: []string{}},
+		Rows:    []TopRow{},
+	}
 	inTable := false
 	for _, line := range lines {
 		trimmed := strings.TrimSpace(line)
@@ -62,12 +70,8 @@ func ParseTop(output string) TopReport {
 			CumPct:  fields[4],
 			Name:    name,
 		}
-		if seconds, ok := parseTimeToSeconds(fields[0]); ok {
-			row.FlatSeconds = &seconds
-		}
-		if seconds, ok := parseTimeToSeconds(fields[3]); ok {
-			row.CumSeconds = &seconds
-		}
+		row.FlatSeconds, row.FlatBytes, row.FlatCount = canonicalValue(fields[0])
+		row.CumSeconds, row.CumBytes, row.CumCount = canonicalValue(fields[3])
 		report.Rows = append(report.Rows, row)
 	}
 	return report
@@ -102,7 +106,7 @@ func DiffTop(before []TopRow, after []TopRow, useCum bool) []map[string]any {
 		beforeVal := pickValue(beforeRow, useCum)
 		afterVal := pickValue(afterRow, useCum)
 		delta := afterVal - beforeVal
-		deltas = append(deltas, map[string]any{
+		entry := map[string]any{
 			"name":                name,
 			"before_flat":         beforeRow.Flat,
 			"after_flat":          afterRow.Flat,
@@ -113,11 +117,31 @@ func DiffTop(before []TopRow, after []TopRow, useCum bool) []map[string]any {
 			"before_cum_seconds":  beforeRow.CumSeconds,
 			"after_cum_seconds":   afterRow.CumSeconds,
 			"delta_seconds":       delta,
-		})
+		}
+		beforeBytes, afterBytes := pickBytes(beforeRow, useCum), pickBytes(afterRow, useCum)
+		if beforeBytes != nil || afterBytes != nil {
+			entry["delta_bytes"] = valueOrZero(afterBytes) - valueOrZero(beforeBytes)
+		}
+		beforeCount, afterCount := pickCount(beforeRow, useCum), pickCount(afterRow, useCum)
+		if beforeCount != nil || afterCount != nil {
+			entry["delta_count"] = valueOrZero(afterCount) - valueOrZero(beforeCount)
+		}
+		deltas = append(deltas, entry)
 	}
 
 	sort.Slice(deltas, func(i, j int) bool {
-		return deltas[i]["delta_seconds"].(float64) > deltas[j]["delta_seconds"].(float64)
+		a, b := deltas[i]["delta_seconds"].(float64), deltas[j]["delta_seconds"].(float64)
+		if a != b {
+			return a > b
+		}
+		// Space and count profiles have no seconds; rank them by their unit.
+		for _, key := range []string{"delta_bytes", "delta_count"} {
+			a, b = deltaOf(deltas[i], key), deltaOf(deltas[j], key)
+			if a != b {
+				return a > b
+			}
+		}
+		return deltas[i]["name"].(string) < deltas[j]["name"].(string)
 	})
 
 	return deltas
@@ -136,33 +160,59 @@ func pickValue(row TopRow, useCum bool) float64 {
 	return 0
 }
 
-func parseTimeToSeconds(value string) (float64, bool) {
-	value = strings.TrimSpace(value)
-	if value == "0" {
-		return 0, true
+func pickBytes(row TopRow, useCum bool) *float64 {
+	if useCum {
+		return row.CumBytes
 	}
-	units := []struct {
-		suffix string
-		mult   float64
-	}{
-		{"ns", 1e-9},
-		{"us", 1e-6},
-		{"ms", 1e-3},
-		{"s", 1},
+	return row.FlatBytes
+}
+
+func pickCount(row TopRow, useCum bool) *float64 {
+	if useCum {
+		return row.CumCount
 	}
-	for _, unit := range units {
-		if strings.HasSuffix(value, unit.suffix) {
-			parsed, err := strconv.ParseFloat(strings.TrimSuffix(value, unit.suffix), 64)
-			if err != nil {
-				return 0, false
-			}
-			return parsed * unit.mult, true
+	return row.FlatCount
+}
+
+func deltaOf(delta map[string]any, key string) float64 {
+	value, _ := delta[key].(float64)
+	return value
+}
+
+// DeltaValue returns a DiffTop delta's change and its unit (UnitSeconds,
+// UnitBytes, or UnitCount), whichever the profile has.
+func DeltaValue(delta map[string]any) (float64, string) {
+	for _, unit := range []struct{ key, unit string }{
+		{"delta_seconds", UnitSeconds},
+		{"delta_bytes", UnitBytes},
+		{"delta_count", UnitCount},
+	} {
+		if value := deltaOf(delta, unit.key); value != 0 {
+			return value, unit.unit
 		}
 	}
-	parsed, err := strconv.ParseFloat(value, 64)
-	if err != nil {
-		return 0, false
+	return 0, UnitSeconds
+}
+
+func valueOrZero(value *float64) float64 {
+	if value == nil {
+		return 0
 	}
-	return parsed, true
+	return *value
 }
 
+// canonicalValue splits a top value into the row's seconds, bytes, or count
+// field.
+func canonicalValue(value string) (seconds, bytes, count *float64) {
+	quantity, ok := ParseQuantity(value)
+	switch {
+	case !ok:
+		return nil, nil, nil
+	case quantity.Unit == UnitSeconds:
+		return &quantity.Value, nil, nil
+	case quantity.Unit == UnitBytes:
+		return nil, &quantity.Value, nil
+	default:
+		return nil, nil, &quantity.Value
+	}
+}
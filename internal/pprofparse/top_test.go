@@ -19,10 +19,25 @@ func TestParseTop(t *testing.T) {
 	require.InDelta(t, 0.50, *report.Rows[0].FlatSeconds, 0.0001)
 }
 
-func TestParseTimeToSeconds(t *testing.T) {
-	value, ok := parseTimeToSeconds("250ms")
-	require.True(t, ok)
-	require.InDelta(t, 0.25, value, 0.0001)
+func TestParseTopCanonicalValues(t *testing.T) {
+	output := `Showing nodes accounting for 1,536.50MB, 98% of 1,563.10MB total
+      flat  flat%   sum%        cum   cum%
+ 1,024.50MB 65.54% 65.54%    1.50GB 98.26%  main.load
+     512kB  0.03% 65.57%     250ms  0.01%  main.mixed
+      1200 12.00% 77.57%      1,200 12.00%  main.count`
+
+	report := ParseTop(output)
+	require.Len(t, report.Rows, 3)
+	require.Nil(t, report.Rows[0].FlatSeconds)
+	require.InDelta(t, 1024.5*(1<<20), *report.Rows[0].FlatBytes, 1)
+	require.InDelta(t, 1.5*(1<<30), *report.Rows[0].CumBytes, 1)
+	require.InDelta(t, 512*1024, *report.Rows[1].FlatBytes, 0.0001)
+	require.InDelta(t, 0.25, *report.Rows[1].CumSeconds, 0.0001)
+	require.InDelta(t, 1200, *report.Rows[2].FlatCount, 0.0001)
+	require.InDelta(t, 1200, *report.Rows[2].CumCount, 0.0001)
+	require.Nil(t, report.Rows[2].FlatSeconds)
+	require.Nil(t, report.Rows[2].CumSeconds)
+	require.Nil(t, report.Rows[2].FlatBytes)
 }
 
 func TestDiffTop(t *testing.T) {
@@ -39,3 +54,56 @@ func ptr(val float64) *float64 {
 	return &val
 }
 
+func TestDiffTopOrdersTiesByName(t *testing.T) {
+	before := []TopRow{
+		{Name: "main.c", FlatSeconds: ptr(1)},
+		{Name: "main.a", FlatSeconds: ptr(1)},
+		{Name: "main.b", FlatSeconds: ptr(1)},
+	}
+	after := []TopRow{
+		{Name: "main.b", FlatSeconds: ptr(2)},
+		{Name: "main.c", FlatSeconds: ptr(2)},
+		{Name: "main.a", FlatSeconds: ptr(2)},
+		{Name: "main.d", FlatSeconds: ptr(0.5)},
+	}
+
+	for i := 0; i < 20; i++ {
+		deltas := DiffTop(before, after, false)
+		names := make([]string, 0, len(deltas))
+		for _, delta := range deltas {
+			names = append(names, delta["name"].(string))
+		}
+		require.Equal(t, []string{"main.a", "main.b", "main.c", "main.d"}, names)
+	}
+}
+
+func TestDiffTopRanksBytes(t *testing.T) {
+	before := []TopRow{{Name: "main.small", FlatBytes: ptr(1 << 20)}, {Name: "main.big", FlatBytes: ptr(1 << 20)}}
+	after := []TopRow{{Name: "main.small", FlatBytes: ptr(2 << 20)}, {Name: "main.big", FlatBytes: ptr(8 << 20)}}
+
+	deltas := DiffTop(before, after, false)
+	require.Equal(t, "main.big", deltas[0]["name"])
+	require.InDelta(t, 7<<20, deltas[0]["delta_bytes"].(float64), 0.0001)
+	require.InDelta(t, 1<<20, deltas[1]["delta_bytes"].(float64), 0.0001)
+}
+
+func TestDiffTopRanksCounts(t *testing.T) {
+	output := func(handler, worker string) string {
+		return "Showing nodes accounting for 120, 100% of 120 total\n" +
+			"      flat  flat%   sum%        cum   cum%\n" +
+			"       " + handler + " 50.00% 50.00%         " + handler + " 50.00%  main.handler\n" +
+			"        " + worker + " 50.00%   100%          " + worker + " 50.00%  main.worker\n"
+	}
+	before := ParseTop(output("60", "60")).Rows
+	after := ParseTop(output("70", "900")).Rows
+	require.Nil(t, after[0].FlatSeconds)
+	require.InDelta(t, 70, *after[0].FlatCount, 0.0001)
+
+	deltas := DiffTop(before, after, false)
+	require.Equal(t, "main.worker", deltas[0]["name"])
+	require.InDelta(t, 840, deltas[0]["delta_count"].(float64), 0.0001)
+	require.InDelta(t, 0, deltas[0]["delta_seconds"].(float64), 0.0001)
+	value, unit := DeltaValue(deltas[1])
+	require.InDelta(t, 10, value, 0.0001)
+	require.Equal(t, UnitCount, unit)
+}
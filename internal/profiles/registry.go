@@ -27,6 +27,8 @@ type Metadata struct {
 type Registry struct {
 	mu    sync.RWMutex
 	items map[string]Metadata
+	// path, when set, is the shared handle file; see Persist.
+	path string
 }
 
 func NewRegistry() *Registry {
@@ -46,7 +48,11 @@ func (r *Registry) Register(meta Metadata) (string, error) {
 
 	r.mu.Lock()
 	r.items[id] = meta
+	err = r.saveLocked()
 	r.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
 
 	return HandlePrefix + id, nil
 }
@@ -55,18 +61,27 @@ func (r *Registry) Resolve(handle string) (Metadata, bool) {
 	id := strings.TrimPrefix(handle, HandlePrefix)
 	r.mu.RLock()
 	meta, ok := r.items[id]
+	persisted := r.path != ""
 	r.mu.RUnlock()
+	if ok || !persisted {
+		return meta, ok
+	}
+
+	// Another process may have registered it since we last read the file.
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.mergeFileLocked(); err != nil {
+		return Metadata{}, false
+	}
+	meta, ok = r.items[id]
 	return meta, ok
 }
 
+// All returns every registered handle, oldest first.
 func (r *Registry) All() []Metadata {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	items := make([]Metadata, 0, len(r.items))
-	for _, meta := range r.items {
-		items = append(items, meta)
-	}
-	return items
+	return r.sortedLocked()
 }
 
 func IsHandle(value string) bool {
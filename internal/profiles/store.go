@@ -0,0 +1,142 @@
+package profiles
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// StorePath returns the shared handle file: PPROF_MCP_HANDLES when set, else
+// pprof-mcp/handles.json under the user cache directory. "off" disables it.
+func StorePath() string {
+	if file := strings.TrimSpace(os.Getenv("PPROF_MCP_HANDLES")); file != "" {
+		if file == "off" {
+			return ""
+		}
+		return file
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "pprof-mcp", "handles.json")
+}
+
+// OpenRegistry returns a registry backed by the handle file at path.
+func OpenRegistry(path string) (*Registry, error) {
+	r := NewRegistry()
+	if err := r.Persist(path); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Persist loads the handles in path and saves every later registration
+// there, so handles from the MCP server, profctl, and other sessions resolve
+// in each other. An empty path keeps the registry in memory.
+func (r *Registry) Persist(path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.path = path
+	if path == "" {
+		return nil
+	}
+	if err := r.saveLocked(); err != nil {
+		r.path = ""
+		return err
+	}
+	return nil
+}
+
+func (r *Registry) mergeFileLocked() error {
+	data, err := os.ReadFile(r.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var items []Metadata
+	if err := json.Unmarshal(data, &items); err != nil {
+		return err
+	}
+	for _, meta := range items {
+		if _, ok := r.items[meta.ID]; !ok && meta.ID != "" {
+			r.items[meta.ID] = meta
+		}
+	}
+	return nil
+}
+
+// Remove drops handles by ID, from the shared file as well when persisted.
+func (r *Registry) Remove(ids ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.path != "" {
+		if err := r.mergeFileLocked(); err != nil {
+			return err
+		}
+	}
+	for _, id := range ids {
+		delete(r.items, strings.TrimPrefix(id, HandlePrefix))
+	}
+	return r.writeLocked()
+}
+
+// saveLocked merges in entries written by other processes, then replaces
+// the file atomically.
+func (r *Registry) saveLocked() error {
+	if r.path == "" {
+		return nil
+	}
+	if err := r.mergeFileLocked(); err != nil {
+		return err
+	}
+	return r.writeLocked()
+}
+
+// sortedLocked returns the handles oldest first, by ID within a timestamp.
+func (r *Registry) sortedLocked() []Metadata {
+	items := make([]Metadata, 0, len(r.items))
+	for _, meta := range r.items {
+		items = append(items, meta)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].RegisteredAt != items[j].RegisteredAt {
+			return items[i].RegisteredAt < items[j].RegisteredAt
+		}
+		return items[i].ID < items[j].ID
+	})
+	return items
+}
+
+func (r *Registry) writeLocked() error {
+	if r.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(r.sortedLocked(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), ".handles-*.json")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), r.path)
+}
@@ -0,0 +1,59 @@
+package profiles
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPersistSharesHandles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "handles.json")
+
+	first, err := OpenRegistry(path)
+	require.NoError(t, err)
+	second, err := OpenRegistry(path)
+	require.NoError(t, err)
+
+	handle, err := first.Register(Metadata{Type: "cpu", Path: "/tmp/cpu.pprof"})
+	require.NoError(t, err)
+	other, err := second.Register(Metadata{Type: "heap", Path: "/tmp/heap.pprof"})
+	require.NoError(t, err)
+
+	meta, ok := second.Resolve(handle)
+	require.True(t, ok)
+	require.Equal(t, "/tmp/cpu.pprof", meta.Path)
+
+	reopened, err := OpenRegistry(path)
+	require.NoError(t, err)
+	require.Len(t, reopened.All(), 2)
+	_, ok = reopened.Resolve(other)
+	require.True(t, ok)
+}
+
+func TestResolveUnknownHandle(t *testing.T) {
+	r, err := OpenRegistry(filepath.Join(t.TempDir(), "handles.json"))
+	require.NoError(t, err)
+	_, ok := r.Resolve("handle:missing")
+	require.False(t, ok)
+}
+
+func TestRemoveHandles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "handles.json")
+	r, err := OpenRegistry(path)
+	require.NoError(t, err)
+	keep, err := r.Register(Metadata{Type: "cpu", Path: "/tmp/cpu.pprof"})
+	require.NoError(t, err)
+	drop, err := r.Register(Metadata{Type: "heap", Path: "/tmp/heap.pprof"})
+	require.NoError(t, err)
+
+	require.NoError(t, r.Remove(drop))
+
+	reopened, err := OpenRegistry(path)
+	require.NoError(t, err)
+	require.Len(t, reopened.All(), 1)
+	_, ok := reopened.Resolve(keep)
+	require.True(t, ok)
+	_, ok = reopened.Resolve(drop)
+	require.False(t, ok)
+}
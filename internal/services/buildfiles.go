@@ -0,0 +1,365 @@
+package services
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	bazelGoBinary = regexp.MustCompile(`(?s)\bgo_binary\s*\((.*?)\n\s*\)`)
+	bazelName     = regexp.MustCompile(`\bname\s*=\s*"([^"]+)"`)
+	bazelOut      = regexp.MustCompile(`\bout\s*=\s*"([^"]+)"`)
+	makeVariable  = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)\s*(?:\?=|::=|:=|\+=|=)\s*(.*)$`)
+	makeRule      = regexp.MustCompile(`^([^\s:=#%]+)(?:\s+[^\s:=#]+)*\s*::?(?:[^=]|$)`)
+	makeReference = regexp.MustCompile(`\$[({]([A-Za-z_][A-Za-z0-9_]*)[)}]`)
+	procfileLine  = regexp.MustCompile(`^([A-Za-z0-9_-]+):\s*(.+)$`)
+)
+
+// goBuildValueFlags are the go build flags that take the next argument
+var goBuildValueFlags = map[string]bool{
+	"-o": true, "-ldflags": true, "-gcflags": true, "-asmflags": true, "-tags": true, "-mod": true,
+	"-modfile": true, "-p": true, "-pkgdir": true, "-overlay": true, "-pgo": true, "-buildmode": true,
+	"-compiler": true, "-installsuffix": true, "-toolexec": true, "-coverpkg": true, "-covermode": true,
+}
+
+// goBuild is one go build command found in a recipe
+type goBuild struct {
+	output   string
+	packages []string
+}
+
+// addBazel records the go_binary rules of a BUILD file
+func (x *serviceIndex) addBazel(rel string) {
+	data, err := os.ReadFile(filepath.Join(x.repoRoot, rel))
+	if err != nil {
+		return
+	}
+	dir := filepath.Dir(rel)
+	pkg := strings.TrimPrefix(filepath.ToSlash(dir), ".")
+	for _, rule := range bazelGoBinary.FindAllStringSubmatch(string(data), -1) {
+		name := bazelName.FindStringSubmatch(rule[1])
+		if name == nil {
+			continue
+		}
+		binary, output := name[1], filepath.Join("bazel-bin", dir, name[1]+"_", name[1])
+		if out := bazelOut.FindStringSubmatch(rule[1]); out != nil {
+			binary, output = out[1], filepath.Join("bazel-bin", dir, out[1])
+		}
+		entry := x.lookup(binary, dir, true)
+		entry.Sources = appendSource(entry.Sources, SourceBazel)
+		entry.Builds = append(entry.Builds, Build{Source: SourceBazel, Command: "bazel build //" + pkg + ":" + name[1], Output: output})
+	}
+}
+
+// addMakefile records the go build commands in a Makefile's recipes, with
+// simple variables expanded
+func (x *serviceIndex) addMakefile(rel string) {
+	data, err := os.ReadFile(filepath.Join(x.repoRoot, rel))
+	if err != nil {
+		return
+	}
+	dir := filepath.Dir(rel)
+	makeCommand := "make "
+	if dir != "." {
+		makeCommand = "make -C " + dir + " "
+	}
+	vars := map[string]string{}
+	target := ""
+	for _, line := range logicalLines(string(data)) {
+		if strings.HasPrefix(line, "\t") {
+			if target == "" {
+				continue
+			}
+			recipe := strings.TrimLeft(strings.TrimSpace(expandMake(line, vars)), "@-+")
+			for _, build := range goBuilds(recipe) {
+				x.addGoBuildCommand(SourceMakefile, makeCommand+target, dir, build)
+			}
+			continue
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if m := makeVariable.FindStringSubmatch(line); m != nil {
+			vars[m[1]] = strings.TrimSpace(m[2])
+			continue
+		}
+		target = ""
+		if m := makeRule.FindStringSubmatch(line); m != nil && !strings.HasPrefix(m[1], ".") {
+			target = m[1]
+		}
+	}
+}
+
+// addGoBuildCommand records a go build run from dir by command
+func (x *serviceIndex) addGoBuildCommand(source, command, dir string, build goBuild) {
+	for _, pkg := range build.packages {
+		pkgDir := filepath.Join(dir, pkg)
+		binary := filepath.Base(pkgDir)
+		if pkgDir == "." {
+			binary = filepath.Base(absPath(x.repoRoot))
+		}
+		output := build.output
+		switch {
+		case output == "":
+			output = binary
+		case len(build.packages) > 1 || strings.HasSuffix(output, "/"):
+			output = filepath.Join(output, binary)
+		default:
+			binary = filepath.Base(output)
+		}
+		if !filepath.IsAbs(output) {
+			output = filepath.Join(dir, output)
+		}
+		entry := x.lookup(binary, pkgDir, true)
+		entry.Sources = appendSource(entry.Sources, source)
+		entry.Builds = append(entry.Builds, Build{Source: source, Command: command, Output: output})
+	}
+}
+
+// addProcfile attaches Procfile processes to the services they run, either
+// with go run or through a built binary
+func (x *serviceIndex) addProcfile(rel string) {
+	data, err := os.ReadFile(filepath.Join(x.repoRoot, rel))
+	if err != nil {
+		return
+	}
+	dir := filepath.Dir(rel)
+	for _, line := range strings.Split(string(data), "\n") {
+		m := procfileLine.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		args := commandArgs(splitFields(m[2]))
+		if len(args) == 0 {
+			continue
+		}
+		if len(args) > 2 && args[0] == "go" && args[1] == "run" {
+			for _, arg := range args[2:] {
+				if !strings.HasPrefix(arg, "-") {
+					pkgDir := filepath.Join(dir, arg)
+					entry := x.lookup(filepath.Base(pkgDir), pkgDir, false)
+					if entry != nil {
+						entry.Sources = appendSource(entry.Sources, SourceProcfile)
+					}
+					break
+				}
+			}
+			continue
+		}
+		entry := x.lookup(filepath.Base(args[0]), "", false)
+		if entry == nil {
+			continue
+		}
+		entry.Sources = appendSource(entry.Sources, SourceProcfile)
+		if strings.Contains(args[0], "/") && !filepath.IsAbs(args[0]) {
+			entry.Binaries = append(entry.Binaries, filepath.Join(dir, args[0]))
+		}
+	}
+}
+
+// addDockerfile attaches a Dockerfile to the service its entrypoint runs,
+// matched through a go build in the Dockerfile or by binary name
+func (x *serviceIndex) addDockerfile(rel string) {
+	data, err := os.ReadFile(filepath.Join(x.repoRoot, rel))
+	if err != nil {
+		return
+	}
+	var builds []goBuild
+	var entrypoint, cmd []string
+	ports := &dockerPorts{}
+	for _, line := range logicalLines(string(data)) {
+		keyword, rest, _ := strings.Cut(strings.TrimSpace(line), " ")
+		ports.add(rel, strings.ToUpper(keyword), strings.TrimSpace(rest))
+		switch strings.ToUpper(keyword) {
+		case "RUN":
+			builds = append(builds, goBuilds(rest)...)
+		case "ENTRYPOINT":
+			entrypoint = dockerArgs(rest)
+		case "CMD":
+			cmd = dockerArgs(rest)
+		}
+	}
+	args := commandArgs(entrypoint)
+	if len(args) == 0 {
+		args = commandArgs(cmd)
+	}
+	if len(args) == 0 {
+		return
+	}
+	executable := args[0]
+	binary, pkgDir := filepath.Base(executable), ""
+	for _, build := range builds {
+		if len(build.packages) == 1 && filepath.Base(build.output) == binary {
+			pkgDir = x.dockerPackage(filepath.Dir(rel), build.packages[0])
+		}
+	}
+	entry := x.lookup(binary, pkgDir, pkgDir != "")
+	if entry == nil {
+		return
+	}
+	entry.Sources = appendSource(entry.Sources, SourceDockerfile)
+	entry.Builds = append(entry.Builds, Build{Source: SourceDockerfile, Command: "docker build -f " + rel + " .", Output: executable})
+	ports.entrypoint(rel, append(slices.Clone(entrypoint), cmd...))
+	if x.docker[entry] == nil {
+		x.docker[entry] = &dockerPorts{}
+	}
+	x.docker[entry].exposed = append(x.docker[entry].exposed, ports.exposed...)
+	x.docker[entry].declared = append(x.docker[entry].declared, ports.declared...)
+}
+
+// dockerPackage resolves a go build package in a Dockerfile, whose build
+// context is usually the repo root and sometimes the Dockerfile's directory
+func (x *serviceIndex) dockerPackage(dockerDir, pkg string) string {
+	for _, dir := range []string{filepath.Join(dockerDir, pkg), filepath.Clean(pkg)} {
+		if _, ok := x.entries[dir]; ok {
+			return dir
+		}
+	}
+	return ""
+}
+
+// goBuilds finds the go build commands in a shell command line
+func goBuilds(line string) []goBuild {
+	fields := splitFields(line)
+	var builds []goBuild
+	for i := 0; i+1 < len(fields); i++ {
+		if fields[i] != "go" || strings.TrimSuffix(fields[i+1], ";") != "build" {
+			continue
+		}
+		var build goBuild
+		pattern := false
+		for j := i + 2; j < len(fields) && !strings.HasSuffix(fields[i+1], ";"); j++ {
+			field := strings.TrimSuffix(fields[j], ";")
+			if field == "&&" || field == "||" || field == "|" || field == "" {
+				break
+			}
+			if flag, value, ok := strings.Cut(field, "="); ok && strings.HasPrefix(flag, "-") {
+				if flag == "-o" {
+					build.output = value
+				}
+			} else if goBuildValueFlags[field] && j+1 < len(fields) {
+				if field == "-o" {
+					build.output = fields[j+1]
+				}
+				j++
+			} else if strings.Contains(field, "...") {
+				pattern = true
+			} else if !strings.HasPrefix(field, "-") {
+				build.packages = append(build.packages, field)
+			}
+			if strings.HasSuffix(fields[j], ";") {
+				break
+			}
+		}
+		// go build ./... checks that everything compiles; it builds no binary.
+		if pattern {
+			continue
+		}
+		if len(build.packages) == 0 {
+			build.packages = []string{"."}
+		}
+		builds = append(builds, build)
+	}
+	return builds
+}
+
+// commandArgs drops leading environment assignments, env, and exec from a
+// command
+func commandArgs(args []string) []string {
+	for len(args) > 0 {
+		name, _, assignment := strings.Cut(args[0], "=")
+		if args[0] != "env" && args[0] != "exec" && !(assignment && !strings.Contains(name, "/")) {
+			break
+		}
+		args = args[1:]
+	}
+	if len(args) > 0 && (filepath.Base(args[0]) == "sh" || filepath.Base(args[0]) == "bash") {
+		return nil
+	}
+	return args
+}
+
+// dockerArgs parses the exec (JSON array) or shell form of ENTRYPOINT and CMD
+func dockerArgs(value string) []string {
+	var args []string
+	if err := json.Unmarshal([]byte(value), &args); err == nil {
+		return args
+	}
+	return splitFields(value)
+}
+
+// logicalLines joins backslash-continued lines
+func logicalLines(data string) []string {
+	var lines []string
+	var current strings.Builder
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasSuffix(line, "\\") {
+			current.WriteString(strings.TrimSuffix(line, "\\") + " ")
+			continue
+		}
+		current.WriteString(line)
+		lines = append(lines, current.String())
+		current.Reset()
+	}
+	if current.Len() > 0 {
+		lines = append(lines, current.String())
+	}
+	return lines
+}
+
+// expandMake substitutes $(VAR) and ${VAR} references to known variables
+func expandMake(line string, vars map[string]string) string {
+	for range 5 {
+		expanded := makeReference.ReplaceAllStringFunc(line, func(ref string) string {
+			if value, ok := vars[makeReference.FindStringSubmatch(ref)[1]]; ok {
+				return value
+			}
+			return ref
+		})
+		if expanded == line {
+			break
+		}
+		line = expanded
+	}
+	return line
+}
+
+// splitFields splits a shell command line on whitespace, keeping quoted
+// strings together without their quotes
+func splitFields(line string) []string {
+	var fields []string
+	var current strings.Builder
+	var quote rune
+	inField := false
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inField = r, true
+		case r == ' ' || r == '\t':
+			if inField {
+				fields = append(fields, current.String())
+				current.Reset()
+				inField = false
+			}
+		default:
+			current.WriteRune(r)
+			inField = true
+		}
+	}
+	if inField {
+		fields = append(fields, current.String())
+	}
+	return fields
+}
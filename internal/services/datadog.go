@@ -0,0 +1,81 @@
+package services
+
+import (
+	"sort"
+
+	"github.com/arreyder/pprof-mcp/internal/config"
+	"github.com/arreyder/pprof-mcp/internal/datadog"
+)
+
+// minDatadogScore is the fuzzy score a Datadog service needs to be taken as
+// a repo service's name: exact, prefix, and separator-insensitive matches.
+// Weaker ones are only listed as candidates.
+const minDatadogScore = 0.8
+
+// maxDatadogCandidates caps the candidates listed for an unmapped service
+const maxDatadogCandidates = 3
+
+// DatadogMatch is the Datadog service a repo service reports as
+type DatadogMatch struct {
+	Service   string   `json:"service"`
+	Envs      []string `json:"envs,omitempty"`
+	Source    string   `json:"source"`               // config or fuzzy
+	MatchType string   `json:"match_type,omitempty"` // fuzzy match kind, as datadog.services.search reports it
+	Score     float64  `json:"score,omitempty"`
+}
+
+// MapDatadog fills each service's Datadog name: from the config's services
+// mappings first, else the best fuzzy match of its service or binary name
+// among known, the Datadog services with profiling. An ambiguous or weak
+// match leaves Datadog unset and lists DatadogCandidates instead.
+func MapDatadog(found []ServiceInfo, cfg *config.Config, known []datadog.ServiceInfo) {
+	envs := map[string][]string{}
+	for _, service := range known {
+		envs[service.Name] = service.Environments
+	}
+	for i := range found {
+		service := &found[i]
+		if mapping, ok := cfg.ServiceMapping(service.Binary, service.Service, service.Path); ok {
+			match := &DatadogMatch{Service: mapping.Datadog, Envs: mapping.Envs, Source: "config"}
+			if len(match.Envs) == 0 {
+				match.Envs = envs[mapping.Datadog]
+			}
+			service.Datadog = match
+			continue
+		}
+		candidates := datadogCandidates(service, known)
+		if len(candidates) == 0 {
+			continue
+		}
+		best := candidates[0]
+		if best.Score >= minDatadogScore && (len(candidates) == 1 || candidates[1].Score < best.Score) {
+			service.Datadog = &DatadogMatch{Service: best.Service, Envs: best.Environments, Source: "fuzzy", MatchType: best.MatchType, Score: best.Score}
+			continue
+		}
+		service.DatadogCandidates = candidates[:min(len(candidates), maxDatadogCandidates)]
+	}
+}
+
+// datadogCandidates fuzzy-matches a service's names against known, keeping
+// each Datadog service's best score
+func datadogCandidates(service *ServiceInfo, known []datadog.ServiceInfo) []datadog.FuzzyMatch {
+	best := map[string]datadog.FuzzyMatch{}
+	for _, query := range []string{service.Service, service.Binary} {
+		for _, match := range datadog.FuzzySearchServices(query, known) {
+			if existing, ok := best[match.Service]; !ok || match.Score > existing.Score {
+				best[match.Service] = match
+			}
+		}
+	}
+	candidates := make([]datadog.FuzzyMatch, 0, len(best))
+	for _, match := range best {
+		candidates = append(candidates, match)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		return candidates[i].Service < candidates[j].Service
+	})
+	return candidates
+}
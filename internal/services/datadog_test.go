@@ -0,0 +1,41 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/arreyder/pprof-mcp/internal/config"
+	"github.com/arreyder/pprof-mcp/internal/datadog"
+)
+
+func TestMapDatadog(t *testing.T) {
+	found := []ServiceInfo{
+		{Binary: "be-ledger", Service: "ledger"},
+		{Binary: "be-public-api", Service: "public_api"},
+		{Binary: "be-temporal-sync", Service: "temporal_sync"},
+		{Binary: "search", Service: "search"},
+		{Binary: "gen", Service: "gen"},
+	}
+	cfg := &config.Config{Services: map[string]config.ServiceMapping{"be-ledger": {Datadog: "ledger-api"}}}
+	known := []datadog.ServiceInfo{
+		{Name: "ledger-api", Environments: []string{"prod", "staging"}},
+		{Name: "public-api", Environments: []string{"prod"}},
+		{Name: "temporal-sync-worker"},
+		{Name: "search-indexer"},
+		{Name: "search-query"},
+	}
+	MapDatadog(found, cfg, known)
+
+	require.Equal(t, &DatadogMatch{Service: "ledger-api", Envs: []string{"prod", "staging"}, Source: "config"}, found[0].Datadog)
+	require.Equal(t, &DatadogMatch{Service: "public-api", Envs: []string{"prod"}, Source: "fuzzy", MatchType: "normalized", Score: 0.85}, found[1].Datadog)
+	require.Equal(t, "temporal-sync-worker", found[2].Datadog.Service)
+
+	// Two equally good prefix matches are left for the user to pick.
+	require.Nil(t, found[3].Datadog)
+	require.Len(t, found[3].DatadogCandidates, 2)
+	require.Equal(t, "search-indexer", found[3].DatadogCandidates[0].Service)
+
+	require.Nil(t, found[4].Datadog)
+	require.Empty(t, found[4].DatadogCandidates)
+}
@@ -1,19 +1,126 @@
 package services
 
 import (
+	"bufio"
+	"go/parser"
+	"go/token"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+
+	"github.com/arreyder/pprof-mcp/internal/datadog"
+)
+
+// Discovery sources reported in ServiceInfo.Sources.
+const (
+	SourceCmd        = "cmd"        // cmd/be-<name>
+	SourceMain       = "main"       // a main package anywhere in the repo
+	SourceBazel      = "bazel"      // a go_binary rule
+	SourceMakefile   = "makefile"   // a go build recipe
+	SourceProcfile   = "procfile"   // a Procfile process
+	SourceDockerfile = "dockerfile" // a Dockerfile ENTRYPOINT or CMD
 )
 
 type ServiceInfo struct {
 	Binary  string `json:"binary"`
 	Service string `json:"service"`
-	Path    string `json:"path"`
+	// Path is the main package directory relative to the repo root; empty
+	// when a build file names a binary no main package was found for
+	Path    string   `json:"path"`
+	Package string   `json:"package,omitempty"` // import path, from the enclosing go.mod
+	Sources []string `json:"sources"`
+	Builds  []Build  `json:"builds,omitempty"`
+	// Binaries are where a built binary is likely to be, relative to the
+	// repo root, existing files first
+	Binaries []string `json:"binaries,omitempty"`
+	// Datadog is the service's Datadog name, set by MapDatadog;
+	// DatadogCandidates are listed instead when no match was clear
+	Datadog           *DatadogMatch        `json:"datadog,omitempty"`
+	DatadogCandidates []datadog.FuzzyMatch `json:"datadog_candidates,omitempty"`
+	// Pprof is what the code shows about the service's pprof endpoint; nil
+	// without a main package
+	Pprof *PprofInfo `json:"pprof,omitempty"`
+	// PprofPorts are the pprof ports its k8s manifests, Helm values, and
+	// Dockerfiles declare, in that order; k8s captures fall back to the
+	// first for pods whose spec declares none
+	PprofPorts []DeclaredPort `json:"pprof_ports,omitempty"`
 }
 
+// Build is one way to build a service
+type Build struct {
+	Source  string `json:"source"`
+	Command string `json:"command"`
+	Output  string `json:"output,omitempty"` // inside the image for dockerfile builds
+}
+
+// skipDirs are never walked
+var skipDirs = map[string]bool{"vendor": true, "node_modules": true, "testdata": true}
+
+// Discover finds the services in a repository: cmd/be-* directories, main
+// packages anywhere under repoRoot, Bazel go_binary rules, Makefile go
+// build recipes, Procfile processes, and Dockerfile entrypoints. Entries
+// are merged by main package, else by binary name. Each main package is
+// scanned, with the repo packages it imports, for its pprof endpoint, and
+// the k8s manifests, Helm values, and Dockerfiles for the pprof ports they
+// declare.
 func Discover(repoRoot string) ([]ServiceInfo, error) {
+	cmdServices, err := DiscoverCmd(repoRoot)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	scan, err := scanRepo(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	index := newServiceIndex(repoRoot)
+	for _, service := range cmdServices {
+		entry := index.byPath(service.Path)
+		entry.Sources = appendSource(entry.Sources, SourceCmd)
+	}
+	for _, dir := range scan.mainDirs {
+		entry := index.byPath(dir)
+		entry.Sources = appendSource(entry.Sources, SourceMain)
+	}
+	for _, dir := range sortedKeys(index.entries) {
+		index.addGoBuild(index.entries[dir], scan.modules)
+	}
+	for _, path := range scan.bazelFiles {
+		index.addBazel(path)
+	}
+	for _, path := range scan.makefiles {
+		index.addMakefile(path)
+	}
+	for _, path := range scan.procfiles {
+		index.addProcfile(path)
+	}
+	for _, path := range scan.dockerfiles {
+		index.addDockerfile(path)
+	}
+	charts := chartDirs(repoRoot, scan.charts)
+	for _, path := range scan.yamlFiles {
+		switch chart, values, ok := chartOf(path, charts); {
+		case !ok:
+			index.addManifest(path)
+		case values:
+			index.addHelmValues(path, chart)
+		}
+	}
+	pprof := newPprofScanner(repoRoot, scan.modules)
+	for _, dir := range sortedKeys(index.entries) {
+		entry := index.entries[dir]
+		if entry.Path != "" {
+			entry.Pprof = pprof.detect(entry.Path)
+		}
+		index.finishPorts(entry)
+	}
+	return index.services(), nil
+}
+
+// DiscoverCmd lists the cmd/be-* directories only, without walking the
+// repository; shell completion uses it.
+func DiscoverCmd(repoRoot string) ([]ServiceInfo, error) {
 	cmdDir := filepath.Join(repoRoot, "cmd")
 	entries, err := os.ReadDir(cmdDir)
 	if err != nil {
@@ -29,12 +136,11 @@ func Discover(repoRoot string) ([]ServiceInfo, error) {
 		if !strings.HasPrefix(name, "be-") {
 			continue
 		}
-		service := strings.TrimPrefix(name, "be-")
-		service = strings.ReplaceAll(service, "-", "_")
 		services = append(services, ServiceInfo{
 			Binary:  name,
-			Service: service,
+			Service: serviceName(name),
 			Path:    filepath.Join("cmd", name),
+			Sources: []string{SourceCmd},
 		})
 	}
 
@@ -45,3 +151,258 @@ func Discover(repoRoot string) ([]ServiceInfo, error) {
 	return services, nil
 }
 
+// serviceName maps a binary to its service: be-public-api is public_api
+func serviceName(binary string) string {
+	return strings.ReplaceAll(strings.TrimPrefix(binary, "be-"), "-", "_")
+}
+
+// repoScan is what one walk of the repository found, as paths relative to
+// its root
+type repoScan struct {
+	mainDirs    []string
+	modules     map[string]string // go.mod directory -> module path
+	bazelFiles  []string
+	makefiles   []string
+	procfiles   []string
+	dockerfiles []string
+	charts      []string // Chart.yaml files
+	yamlFiles   []string // other YAML: manifests, and chart values and templates
+}
+
+func scanRepo(repoRoot string) (repoScan, error) {
+	scan := repoScan{modules: map[string]string{}}
+	mainDirs := map[string]bool{}
+	err := filepath.WalkDir(repoRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == repoRoot {
+				return err
+			}
+			return nil
+		}
+		rel, _ := filepath.Rel(repoRoot, path)
+		name := d.Name()
+		if d.IsDir() {
+			if rel != "." && (skipDirs[name] || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || strings.HasPrefix(name, "bazel-")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch {
+		case name == "go.mod":
+			if module := modulePath(path); module != "" {
+				scan.modules[filepath.Dir(rel)] = module
+			}
+		case name == "BUILD" || name == "BUILD.bazel":
+			scan.bazelFiles = append(scan.bazelFiles, rel)
+		case name == "Makefile" || name == "GNUmakefile" || name == "makefile":
+			scan.makefiles = append(scan.makefiles, rel)
+		case name == "Procfile":
+			scan.procfiles = append(scan.procfiles, rel)
+		case name == "Dockerfile" || strings.HasPrefix(name, "Dockerfile.") || strings.HasSuffix(name, ".Dockerfile"):
+			scan.dockerfiles = append(scan.dockerfiles, rel)
+		case name == "Chart.yaml":
+			scan.charts = append(scan.charts, rel)
+		case strings.HasSuffix(name, ".yaml") || strings.HasSuffix(name, ".yml"):
+			scan.yamlFiles = append(scan.yamlFiles, rel)
+		case strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go"):
+			dir := filepath.Dir(rel)
+			if !mainDirs[dir] && isMainFile(path) {
+				mainDirs[dir] = true
+				scan.mainDirs = append(scan.mainDirs, dir)
+			}
+		}
+		return nil
+	})
+	return scan, err
+}
+
+// isMainFile reports whether a Go file declares package main and is not
+// excluded from builds with //go:build ignore, as generators are
+func isMainFile(path string) bool {
+	file, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil || file.Name.Name != "main" {
+		return false
+	}
+	for _, group := range file.Comments {
+		for _, comment := range group.List {
+			if strings.HasPrefix(comment.Text, "//go:build") && strings.Contains(comment.Text, "ignore") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func modulePath(goMod string) string {
+	f, err := os.Open(goMod)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rest, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "module "); ok {
+			return strings.Trim(strings.TrimSpace(rest), `"`)
+		}
+	}
+	return ""
+}
+
+// serviceIndex merges what each source found into one entry per service
+type serviceIndex struct {
+	repoRoot string
+	entries  map[string]*ServiceInfo // by Path, or "binary:<name>" without one
+	docker   map[*ServiceInfo]*dockerPorts
+}
+
+func newServiceIndex(repoRoot string) *serviceIndex {
+	return &serviceIndex{repoRoot: repoRoot, entries: map[string]*ServiceInfo{}, docker: map[*ServiceInfo]*dockerPorts{}}
+}
+
+// byPath returns the entry of a main package directory, creating it
+func (x *serviceIndex) byPath(dir string) *ServiceInfo {
+	dir = filepath.Clean(dir)
+	if entry, ok := x.entries[dir]; ok {
+		return entry
+	}
+	binary := filepath.Base(dir)
+	if dir == "." {
+		binary = filepath.Base(absPath(x.repoRoot))
+	}
+	entry := &ServiceInfo{Binary: binary, Service: serviceName(binary), Path: dir}
+	x.entries[dir] = entry
+	return entry
+}
+
+// lookup finds the entry for a binary: the main package in dir when there
+// is one, else a main package of that name, else a new entry without a
+// package when create is set
+func (x *serviceIndex) lookup(binary, dir string, create bool) *ServiceInfo {
+	if dir != "" {
+		if entry, ok := x.entries[filepath.Clean(dir)]; ok {
+			return entry
+		}
+	}
+	// Of several main packages named alike, the shallowest wins.
+	var match *ServiceInfo
+	for _, key := range sortedKeys(x.entries) {
+		entry := x.entries[key]
+		if entry.Binary != binary {
+			continue
+		}
+		if match == nil || match.Path == "" || entry.Path != "" && len(entry.Path) < len(match.Path) {
+			match = entry
+		}
+	}
+	if match != nil || !create {
+		return match
+	}
+	entry := &ServiceInfo{Binary: binary, Service: serviceName(binary)}
+	x.entries["binary:"+binary] = entry
+	return entry
+}
+
+// addGoBuild records the plain go build of a main package and its import
+// path, relative to the nearest go.mod
+func (x *serviceIndex) addGoBuild(entry *ServiceInfo, modules map[string]string) {
+	moduleDir, module, ok := enclosingModule(entry.Path, modules)
+	if !ok {
+		return
+	}
+	rel, _ := filepath.Rel(moduleDir, entry.Path)
+	entry.Package = module
+	if rel != "." {
+		entry.Package = module + "/" + filepath.ToSlash(rel)
+	}
+	output := filepath.Join("bin", entry.Binary)
+	command := "go build -o " + output + " ./" + filepath.ToSlash(rel)
+	if moduleDir != "." {
+		command = "cd " + moduleDir + " && " + command
+		output = filepath.Join(moduleDir, output)
+	}
+	entry.Builds = append(entry.Builds, Build{Source: "go", Command: command, Output: output})
+}
+
+// enclosingModule finds the nearest go.mod at or above dir
+func enclosingModule(dir string, modules map[string]string) (string, string, bool) {
+	for {
+		if module, ok := modules[dir]; ok {
+			return dir, module, true
+		}
+		if dir == "." {
+			return "", "", false
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func (x *serviceIndex) services() []ServiceInfo {
+	services := make([]ServiceInfo, 0, len(x.entries))
+	for _, key := range sortedKeys(x.entries) {
+		entry := *x.entries[key]
+		entry.Binaries = x.binaries(entry)
+		services = append(services, entry)
+	}
+	sort.SliceStable(services, func(i, j int) bool {
+		if services[i].Binary != services[j].Binary {
+			return services[i].Binary < services[j].Binary
+		}
+		return services[i].Path < services[j].Path
+	})
+	return services
+}
+
+// binaries lists the local build outputs of entry, existing files first
+func (x *serviceIndex) binaries(entry ServiceInfo) []string {
+	seen := map[string]bool{}
+	var existing, missing []string
+	add := func(path string) {
+		if path == "" || seen[path] || filepath.IsAbs(path) || strings.Contains(path, "$") {
+			return
+		}
+		seen[path] = true
+		if info, err := os.Stat(filepath.Join(x.repoRoot, path)); err == nil && !info.IsDir() {
+			existing = append(existing, path)
+		} else {
+			missing = append(missing, path)
+		}
+	}
+	// Procfile paths and Makefile and Bazel outputs are what the repo
+	// actually runs and builds; the plain go build output is a suggestion.
+	for _, path := range entry.Binaries {
+		add(path)
+	}
+	for _, source := range []string{SourceMakefile, SourceBazel, "go"} {
+		for _, build := range entry.Builds {
+			if build.Source == source {
+				add(build.Output)
+			}
+		}
+	}
+	return append(existing, missing...)
+}
+
+func appendSource(sources []string, source string) []string {
+	for _, existing := range sources {
+		if existing == source {
+			return sources
+		}
+	}
+	return append(sources, source)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
@@ -23,3 +23,62 @@ func TestDiscover(t *testing.T) {
 	require.Equal(t, filepath.Join("cmd", "be-public-api"), services[0].Path)
 }
 
+func TestDiscoverMonorepo(t *testing.T) {
+	repoRoot := t.TempDir()
+	write := func(path, content string) {
+		path = filepath.Join(repoRoot, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	write("go.mod", "module example.com/mono\n\ngo 1.25\n")
+	write("cmd/be-ledger/main.go", "package main\n\nfunc main() {}\n")
+	write("services/search/main.go", "// Package main is the search server.\npackage main\n\nfunc main() {}\n")
+	write("services/search/BUILD.bazel", "go_binary(\n    name = \"search\",\n    embed = [\":search_lib\"],\n)\n")
+	write("tools/gen/gen.go", "//go:build ignore\n\npackage main\n")
+	write("internal/lib/lib.go", "package lib\n")
+	write("vendor/example.com/dep/cmd/dep/main.go", "package main\n")
+	write("workers/go.mod", "module example.com/workers\n")
+	write("workers/cmd/indexer/main.go", "package main\n")
+	write("Makefile", "BIN ?= bin\nGO := go\n\n.PHONY: build\nbuild: ledger\n\nledger:\n\t@$(GO) build -ldflags \"-s -w\" -o $(BIN)/be-ledger ./cmd/be-ledger\n\ncheck:\n\tgo build ./...\n")
+	write("Procfile", "web: PORT=8080 bin/be-ledger --serve\nworker: go run ./workers/cmd/indexer\nredis: redis-server\n")
+	write("services/search/Dockerfile", "FROM golang:1.25 AS build\nRUN CGO_ENABLED=0 go build \\\n    -o /out/search ./services/search\nFROM scratch\nCOPY --from=build /out/search /search\nENTRYPOINT [\"/search\", \"--port=8080\"]\n")
+	write("bin/be-ledger", "binary")
+
+	services, err := Discover(repoRoot)
+	require.NoError(t, err)
+	byBinary := map[string]ServiceInfo{}
+	for _, service := range services {
+		byBinary[service.Binary] = service
+	}
+	require.Len(t, services, 3, "%+v", services)
+
+	ledger := byBinary["be-ledger"]
+	require.Equal(t, "ledger", ledger.Service)
+	require.Equal(t, filepath.Join("cmd", "be-ledger"), ledger.Path)
+	require.Equal(t, "example.com/mono/cmd/be-ledger", ledger.Package)
+	require.Equal(t, []string{SourceCmd, SourceMain, SourceMakefile, SourceProcfile}, ledger.Sources)
+	require.Equal(t, []Build{
+		{Source: "go", Command: "go build -o bin/be-ledger ./cmd/be-ledger", Output: filepath.Join("bin", "be-ledger")},
+		{Source: SourceMakefile, Command: "make ledger", Output: filepath.Join("bin", "be-ledger")},
+	}, ledger.Builds)
+	require.Equal(t, []string{filepath.Join("bin", "be-ledger")}, ledger.Binaries)
+
+	search := byBinary["search"]
+	require.Equal(t, []string{SourceMain, SourceBazel, SourceDockerfile}, search.Sources)
+	require.Equal(t, Build{Source: SourceBazel, Command: "bazel build //services/search:search", Output: filepath.Join("bazel-bin", "services", "search", "search_", "search")}, search.Builds[1])
+	require.Equal(t, Build{Source: SourceDockerfile, Command: "docker build -f " + filepath.Join("services", "search", "Dockerfile") + " .", Output: "/search"}, search.Builds[2])
+	require.Equal(t, []string{filepath.Join("bazel-bin", "services", "search", "search_", "search"), filepath.Join("bin", "search")}, search.Binaries)
+
+	indexer := byBinary["indexer"]
+	require.Equal(t, "example.com/workers/cmd/indexer", indexer.Package)
+	require.Equal(t, []string{SourceMain, SourceProcfile}, indexer.Sources)
+	require.Equal(t, "cd workers && go build -o bin/indexer ./cmd/indexer", indexer.Builds[0].Command)
+}
+
+func TestGoBuilds(t *testing.T) {
+	require.Equal(t, []goBuild{
+		{output: "out/api", packages: []string{"./cmd/api"}},
+		{packages: []string{"."}},
+	}, goBuilds(`CGO_ENABLED=0 go build -trimpath -tags "netgo osusergo" -o=out/api ./cmd/api && go build; go build ./...`))
+	require.Equal(t, []string{"a", "b c", "d"}, splitFields(`a "b c" 'd'`))
+}
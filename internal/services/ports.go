@@ -0,0 +1,356 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/arreyder/pprof-mcp/internal/k8s"
+)
+
+// Port declaration sources reported in DeclaredPort.Source, besides
+// SourceDockerfile.
+const (
+	SourceManifest = "k8s"  // a workload manifest's pod template
+	SourceHelm     = "helm" // a chart's values file
+)
+
+// defaultPprofPort is the port net/http/pprof is customarily served on
+const defaultPprofPort = 6060
+
+// noPortNote is the PprofInfo note for a service whose code shows no port
+const noPortNote = "pprof listen port not found in code; check the container ports or flags"
+
+// DeclaredPort is a pprof port a service's deployment files declare
+type DeclaredPort struct {
+	Port   int    `json:"port"`
+	Source string `json:"source"` // dockerfile, k8s, or helm
+	File   string `json:"file"`   // relative to the repo root
+	Detail string `json:"detail"` // what declared it, e.g. container port app/pprof
+}
+
+// workloadKinds are the manifest kinds with a pod template
+var workloadKinds = map[string]bool{
+	"Deployment": true, "StatefulSet": true, "DaemonSet": true, "ReplicaSet": true,
+	"Job": true, "CronJob": true, "Pod": true,
+}
+
+// manifest is the part of a workload manifest that declares pprof ports
+type manifest struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+	Spec struct {
+		podSpec     `yaml:",inline"`
+		Template    podTemplate `yaml:"template"`
+		JobTemplate struct {
+			Spec struct {
+				Template podTemplate `yaml:"template"`
+			} `yaml:"spec"`
+		} `yaml:"jobTemplate"`
+	} `yaml:"spec"`
+}
+
+type podTemplate struct {
+	Metadata struct {
+		Annotations map[string]string `yaml:"annotations"`
+	} `yaml:"metadata"`
+	Spec podSpec `yaml:"spec"`
+}
+
+type podSpec struct {
+	Containers []manifestContainer `yaml:"containers"`
+}
+
+type manifestContainer struct {
+	Name    string   `yaml:"name"`
+	Image   string   `yaml:"image"`
+	Command []string `yaml:"command"`
+	Args    []string `yaml:"args"`
+	Ports   []struct {
+		Name          string `yaml:"name"`
+		ContainerPort int    `yaml:"containerPort"`
+	} `yaml:"ports"`
+	Env []struct {
+		Name  string `yaml:"name"`
+		Value string `yaml:"value"`
+	} `yaml:"env"`
+}
+
+// addManifest records the pprof ports the workloads in a YAML file declare,
+// read the way k8s captures read a running pod's spec, on the services
+// their containers run
+func (x *serviceIndex) addManifest(rel string) {
+	data, err := os.ReadFile(filepath.Join(x.repoRoot, rel))
+	if err != nil || !bytes.Contains(data, []byte("containers:")) {
+		return
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc manifest
+		// Past the last document, or a templated one that does not parse,
+		// nothing more can be read.
+		if err := decoder.Decode(&doc); err != nil {
+			return
+		}
+		if !workloadKinds[doc.Kind] {
+			continue
+		}
+		template := doc.Spec.Template
+		switch doc.Kind {
+		case "Pod":
+			template = podTemplate{Spec: doc.Spec.podSpec}
+		case "CronJob":
+			template = doc.Spec.JobTemplate.Spec.Template
+		}
+		pod := k8s.PodInfo{Annotations: template.Metadata.Annotations}
+		var names []string
+		for _, c := range template.Spec.Containers {
+			container := k8s.Container{Name: c.Name, Image: c.Image, Args: append(slices.Clone(c.Command), c.Args...)}
+			for _, port := range c.Ports {
+				container.Ports = append(container.Ports, k8s.ContainerPort{Name: port.Name, ContainerPort: port.ContainerPort})
+			}
+			for _, env := range c.Env {
+				container.Env = append(container.Env, k8s.EnvVar{Name: env.Name, Value: env.Value})
+			}
+			pod.Containers = append(pod.Containers, container)
+			if len(c.Command) > 0 {
+				names = append(names, filepath.Base(c.Command[0]))
+			}
+			names = append(names, imageName(c.Image), c.Name)
+		}
+		port, source, ok := k8s.PodPort(pod)
+		if !ok {
+			continue
+		}
+		entry := x.named(append(names, doc.Metadata.Name)...)
+		if entry == nil {
+			continue
+		}
+		detail := fmt.Sprintf("%s/%s %s", strings.ToLower(doc.Kind), doc.Metadata.Name, source)
+		entry.PprofPorts = appendPort(entry.PprofPorts, DeclaredPort{Port: port, Source: SourceManifest, File: rel, Detail: detail})
+	}
+}
+
+// addHelmValues records the pprof ports a chart's values file sets, under
+// keys such as pprof.port or debugAddr, in pprof.port pod annotations, or as
+// ports named pprof, profiling, debug, or admin, on the chart's service
+func (x *serviceIndex) addHelmValues(rel, chart string) {
+	data, err := os.ReadFile(filepath.Join(x.repoRoot, rel))
+	if err != nil {
+		return
+	}
+	var values any
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return
+	}
+	entry := x.named(chart, filepath.Base(filepath.Dir(rel)))
+	if entry == nil {
+		return
+	}
+	walkHelmValues(values, nil, func(key string, port int) {
+		entry.PprofPorts = appendPort(entry.PprofPorts, DeclaredPort{Port: port, Source: SourceHelm, File: rel, Detail: key})
+	})
+}
+
+func walkHelmValues(value any, path []string, found func(key string, port int)) {
+	switch value := value.(type) {
+	case map[string]any:
+		if name, ok := value["name"].(string); ok && slices.ContainsFunc(k8s.PortNames, func(n string) bool { return strings.EqualFold(n, name) }) {
+			for _, field := range []string{"containerPort", "port"} {
+				if port, ok := k8s.ParsePort(fmt.Sprint(value[field])); ok {
+					found(strings.Join(append(slices.Clone(path), name), "."), port)
+					return
+				}
+			}
+		}
+		for _, key := range sortedKeys(value) {
+			walkHelmValues(value[key], append(slices.Clone(path), key), found)
+		}
+	case []any:
+		for _, item := range value {
+			walkHelmValues(item, path, found)
+		}
+	case string, int:
+		key := strings.Join(path, ".")
+		if !k8s.PortSetting(key) {
+			return
+		}
+		if port, ok := k8s.ParsePort(fmt.Sprint(value)); ok {
+			found(key, port)
+		}
+	}
+}
+
+// dockerPorts is what a Dockerfile declares about ports: EXPOSEd ports,
+// which name no purpose, and pprof addresses in ENV, ARG, or the
+// entrypoint's flags
+type dockerPorts struct {
+	exposed  []DeclaredPort
+	declared []DeclaredPort
+}
+
+// add reads one Dockerfile instruction
+func (d *dockerPorts) add(rel, keyword, rest string) {
+	switch keyword {
+	case "EXPOSE":
+		for _, field := range splitFields(rest) {
+			port, _, _ := strings.Cut(field, "/")
+			if n, ok := k8s.ParsePort(port); ok {
+				d.exposed = append(d.exposed, DeclaredPort{Port: n, Source: SourceDockerfile, File: rel, Detail: "EXPOSE " + field})
+			}
+		}
+	case "ENV", "ARG":
+		fields := splitFields(rest)
+		if len(fields) > 1 && !strings.Contains(fields[0], "=") {
+			// The legacy "ENV KEY value" form
+			fields = []string{fields[0] + "=" + strings.Join(fields[1:], " ")}
+		}
+		for _, field := range fields {
+			name, value, _ := strings.Cut(field, "=")
+			if !k8s.PortSetting(name) {
+				continue
+			}
+			if port, ok := k8s.ParsePort(value); ok {
+				d.declared = append(d.declared, DeclaredPort{Port: port, Source: SourceDockerfile, File: rel, Detail: keyword + " " + name})
+			}
+		}
+	}
+}
+
+// entrypoint reads the pprof address flags of the command the image runs
+func (d *dockerPorts) entrypoint(rel string, args []string) {
+	if port, flag, ok := k8s.PortFromArgs(args); ok {
+		d.declared = append(d.declared, DeclaredPort{Port: port, Source: SourceDockerfile, File: rel, Detail: "arg " + flag})
+	}
+}
+
+// finishPorts adds a service's Dockerfile declarations after its manifest
+// and Helm ones, with the EXPOSEd ports that are pprof's: 6060, or a port
+// its code or other declarations name
+func (x *serviceIndex) finishPorts(entry *ServiceInfo) {
+	if docker := x.docker[entry]; docker != nil {
+		entry.PprofPorts = append(entry.PprofPorts, docker.declared...)
+		known := map[int]bool{defaultPprofPort: true}
+		if entry.Pprof != nil {
+			for _, port := range entry.Pprof.Ports {
+				known[port] = true
+			}
+		}
+		for _, port := range entry.PprofPorts {
+			known[port.Port] = true
+		}
+		for _, exposed := range docker.exposed {
+			if known[exposed.Port] {
+				entry.PprofPorts = appendPort(entry.PprofPorts, exposed)
+			}
+		}
+	}
+	if entry.Pprof != nil && len(entry.PprofPorts) > 0 {
+		entry.Pprof.Notes = slices.DeleteFunc(entry.Pprof.Notes, func(note string) bool { return note == noPortNote })
+	}
+}
+
+// named finds the entry of a service by any of names, as a binary or
+// service name
+func (x *serviceIndex) named(names ...string) *ServiceInfo {
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if entry := x.lookup(name, "", false); entry != nil {
+			return entry
+		}
+		for _, key := range sortedKeys(x.entries) {
+			if entry := x.entries[key]; entry.Service == serviceName(name) {
+				return entry
+			}
+		}
+	}
+	return nil
+}
+
+// imageName is the repository name of an image reference:
+// registry.example.com/team/be-api:1.2 is be-api
+func imageName(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+	name := image[strings.LastIndex(image, "/")+1:]
+	name, _, _ = strings.Cut(name, ":")
+	return name
+}
+
+func appendPort(ports []DeclaredPort, port DeclaredPort) []DeclaredPort {
+	if slices.Contains(ports, port) {
+		return ports
+	}
+	return append(ports, port)
+}
+
+// DeclaredPprofPort returns the pprof port the repository at repoRoot
+// declares for the service any of names is the binary or service name of,
+// for captures from pods whose spec declares none
+func DeclaredPprofPort(repoRoot string, names ...string) (DeclaredPort, bool) {
+	found, err := Discover(repoRoot)
+	if err != nil {
+		return DeclaredPort{}, false
+	}
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		for _, service := range found {
+			if (service.Binary == name || service.Service == serviceName(name)) && len(service.PprofPorts) > 0 {
+				return service.PprofPorts[0], true
+			}
+		}
+	}
+	return DeclaredPort{}, false
+}
+
+// chartDirs maps each Helm chart directory to its chart name
+func chartDirs(repoRoot string, charts []string) map[string]string {
+	dirs := map[string]string{}
+	for _, rel := range charts {
+		var chart struct {
+			Name string `yaml:"name"`
+		}
+		if data, err := os.ReadFile(filepath.Join(repoRoot, rel)); err == nil {
+			_ = yaml.Unmarshal(data, &chart)
+		}
+		dirs[filepath.Dir(rel)] = chart.Name
+	}
+	return dirs
+}
+
+// chartOf returns the chart a YAML file belongs to, and whether it is one of
+// the chart's values files rather than a template
+func chartOf(rel string, charts map[string]string) (string, bool, bool) {
+	for dir := filepath.Dir(rel); ; dir = filepath.Dir(dir) {
+		if name, ok := charts[dir]; ok {
+			base := filepath.Base(rel)
+			return name, filepath.Dir(rel) == dir && strings.HasPrefix(base, "values"), true
+		}
+		if dir == "." {
+			return "", false, false
+		}
+	}
+}
+
+// ApplyDeclaredPort sets the RepoPort of a k8s capture to the pprof port
+// repoRoot declares for the captured service, named by the bundle prefix,
+// the workload, or the selector's app label
+func ApplyDeclaredPort(params *k8s.CaptureParams, repoRoot string) {
+	if repoRoot == "" || params.Port > 0 {
+		return
+	}
+	names := []string{params.Service, k8s.WorkloadName(params.Workload), k8s.ServiceFromSelector(params.Selector, "")}
+	if port, ok := DeclaredPprofPort(repoRoot, names...); ok {
+		params.RepoPort, params.RepoPortSource = port.Port, port.File+" "+port.Detail
+	}
+}
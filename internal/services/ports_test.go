@@ -0,0 +1,109 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscoverPprofPorts(t *testing.T) {
+	repoRoot := t.TempDir()
+	write := func(path, content string) {
+		path = filepath.Join(repoRoot, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	write("go.mod", "module example.com/mono\n\ngo 1.25\n")
+	for _, dir := range []string{"cmd/be-ledger", "cmd/be-search", "cmd/be-billing"} {
+		write(dir+"/main.go", "package main\n\nimport _ \"net/http/pprof\"\n\nfunc main() {}\n")
+	}
+	write("deploy/ledger.yaml", `apiVersion: v1
+kind: Service
+metadata:
+  name: ledger
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: ledger
+spec:
+  template:
+    metadata:
+      annotations:
+        prometheus.io/port: "9090"
+    spec:
+      containers:
+        - name: app
+          image: registry.example.com/be-ledger:1.4.2
+          args: ["--listen=:8080", "--debug-addr", "localhost:8081"]
+          ports:
+            - containerPort: 8080
+`)
+	write("deploy/jobs.yaml", `apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: billing-close
+spec:
+  jobTemplate:
+    spec:
+      template:
+        metadata:
+          annotations:
+            pprof.port: 6070
+        spec:
+          containers:
+            - name: close
+              image: be-billing
+              command: ["/usr/bin/be-billing"]
+`)
+	write("charts/search/Chart.yaml", "apiVersion: v2\nname: be-search\nversion: 0.1.0\n")
+	write("charts/search/values.yaml", `image:
+  tag: latest
+service:
+  port: 8080
+pprof:
+  enabled: true
+  port: 6061
+extraPorts:
+  - name: admin
+    containerPort: 9001
+`)
+	write("charts/search/templates/deployment.yaml", "spec:\n  containers:\n    - name: {{ .Chart.Name }}\n")
+	write("cmd/be-search/Dockerfile", "FROM golang:1.25 AS build\nRUN go build -o /out/be-search ./cmd/be-search\nFROM scratch\nENV PPROF_ADDR=:6061 LOG_LEVEL=info\nEXPOSE 8080 6060/tcp\nCOPY --from=build /out/be-search /be-search\nENTRYPOINT [\"/be-search\"]\n")
+	write("cmd/be-billing/Dockerfile", "FROM scratch\nEXPOSE 8080\nCOPY be-billing /be-billing\nENTRYPOINT [\"/be-billing\"]\n")
+
+	services, err := Discover(repoRoot)
+	require.NoError(t, err)
+	byBinary := map[string]ServiceInfo{}
+	for _, service := range services {
+		byBinary[service.Binary] = service
+	}
+
+	ledger := filepath.Join("deploy", "ledger.yaml")
+	require.Equal(t, []DeclaredPort{
+		{Port: 8081, Source: SourceManifest, File: ledger, Detail: "deployment/ledger app arg debug-addr"},
+	}, byBinary["be-ledger"].PprofPorts)
+	require.NotContains(t, byBinary["be-ledger"].Pprof.Notes, noPortNote)
+
+	// EXPOSE 8080 names no purpose, so it is left out.
+	require.Equal(t, []DeclaredPort{
+		{Port: 6070, Source: SourceManifest, File: filepath.Join("deploy", "jobs.yaml"), Detail: "cronjob/billing-close annotation pprof.port"},
+	}, byBinary["be-billing"].PprofPorts)
+
+	values := filepath.Join("charts", "search", "values.yaml")
+	dockerfile := filepath.Join("cmd", "be-search", "Dockerfile")
+	require.Equal(t, []DeclaredPort{
+		{Port: 9001, Source: SourceHelm, File: values, Detail: "extraPorts.admin"},
+		{Port: 6061, Source: SourceHelm, File: values, Detail: "pprof.port"},
+		{Port: 6061, Source: SourceDockerfile, File: dockerfile, Detail: "ENV PPROF_ADDR"},
+		{Port: 6060, Source: SourceDockerfile, File: dockerfile, Detail: "EXPOSE 6060/tcp"},
+	}, byBinary["be-search"].PprofPorts)
+
+	port, ok := DeclaredPprofPort(repoRoot, "", "search")
+	require.True(t, ok)
+	require.Equal(t, 9001, port.Port)
+	_, ok = DeclaredPprofPort(repoRoot, "unknown")
+	require.False(t, ok)
+}
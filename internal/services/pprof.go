@@ -0,0 +1,446 @@
+package services
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Pprof mux kinds reported in PprofInfo.Mux.
+const (
+	MuxDefault = "default" // http.DefaultServeMux, which net/http/pprof registers on
+	MuxCustom  = "custom"  // handlers registered on a router the service builds
+)
+
+// maxPprofPackages bounds the repo packages scanned per service
+const maxPprofPackages = 500
+
+// defaultPprofPath is where net/http/pprof registers its handlers
+const defaultPprofPath = "/debug/pprof/"
+
+// ratesPathSuffix is the capture rate endpoint's path, as k8s captures
+// with mutex_rate and block_rate expect it
+const ratesPathSuffix = "/debug/pprof/rates"
+
+// PprofInfo is what a service's code shows about its pprof endpoint. It is
+// found statically in the main package and the repo packages it imports, so
+// addresses built at runtime are missed.
+type PprofInfo struct {
+	Enabled bool     `json:"enabled"`
+	Mux     string   `json:"mux,omitempty"`
+	Paths   []string `json:"paths,omitempty"`
+	// Addrs are listen addresses serving the pprof mux, and defaults of
+	// pprof and debug address flags
+	Addrs []string `json:"addrs,omitempty"`
+	Ports []int    `json:"ports,omitempty"`
+	// RateEndpoint is set when the service serves /debug/pprof/rates, which
+	// captures use to turn on mutex and block sampling
+	RateEndpoint bool `json:"rate_endpoint,omitempty"`
+	// MutexProfileFraction and BlockProfileRate are the arguments the code
+	// passes to the runtime, as written
+	MutexProfileFraction string   `json:"mutex_profile_fraction,omitempty"`
+	BlockProfileRate     string   `json:"block_profile_rate,omitempty"`
+	DatadogProfiler      bool     `json:"datadog_profiler,omitempty"`
+	Evidence             []string `json:"evidence,omitempty"` // file:line: finding
+	Notes                []string `json:"notes,omitempty"`
+}
+
+// pprofFindings is what one package's files show
+type pprofFindings struct {
+	imports   []string // import paths
+	imported  bool     // net/http/pprof, which registers on the default mux
+	handlers  []pprofHandler
+	listens   []pprofListen
+	flagAddrs []string
+	mutex     string
+	block     string
+	datadog   bool
+	evidence  []string
+}
+
+// pprofHandler is a pprof handler registration
+type pprofHandler struct {
+	mux  string // the receiver, as written; http for the default mux
+	path string
+}
+
+// pprofListen is a server started in code
+type pprofListen struct {
+	addr    string // empty when not a literal
+	handler string // as written; empty for the default mux
+}
+
+// pprofScanner parses packages once for all services
+type pprofScanner struct {
+	repoRoot string
+	modules  map[string]string // go.mod directory -> module path
+	packages map[string]*pprofFindings
+}
+
+func newPprofScanner(repoRoot string, modules map[string]string) *pprofScanner {
+	return &pprofScanner{repoRoot: repoRoot, modules: modules, packages: map[string]*pprofFindings{}}
+}
+
+// detect scans a main package and the repo packages it imports
+func (s *pprofScanner) detect(dir string) *PprofInfo {
+	var all []*pprofFindings
+	seen := map[string]bool{dir: true}
+	queue := []string{dir}
+	for len(queue) > 0 && len(seen) <= maxPprofPackages {
+		pkg := s.scan(queue[0])
+		queue = queue[1:]
+		all = append(all, pkg)
+		for _, path := range pkg.imports {
+			if imported, ok := s.packageDir(path); ok && !seen[imported] {
+				seen[imported] = true
+				queue = append(queue, imported)
+			}
+		}
+	}
+	return mergePprof(all)
+}
+
+// packageDir maps an import path to a directory of a module in the repo
+func (s *pprofScanner) packageDir(path string) (string, bool) {
+	best, bestModule := "", ""
+	for dir, module := range s.modules {
+		if (path == module || strings.HasPrefix(path, module+"/")) && len(module) > len(bestModule) {
+			best, bestModule = dir, module
+		}
+	}
+	if bestModule == "" {
+		return "", false
+	}
+	return filepath.Join(best, filepath.FromSlash(strings.TrimPrefix(strings.TrimPrefix(path, bestModule), "/"))), true
+}
+
+func (s *pprofScanner) scan(dir string) *pprofFindings {
+	if pkg, ok := s.packages[dir]; ok {
+		return pkg
+	}
+	pkg := &pprofFindings{}
+	s.packages[dir] = pkg
+	entries, err := os.ReadDir(filepath.Join(s.repoRoot, dir))
+	if err != nil {
+		return pkg
+	}
+	fset := token.NewFileSet()
+	imports := map[string]bool{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, filepath.Join(s.repoRoot, dir, name), nil, parser.SkipObjectResolution)
+		if err != nil {
+			continue
+		}
+		scanPprofFile(pkg, fset, filepath.Join(dir, name), file)
+		for _, spec := range file.Imports {
+			path, _ := strconv.Unquote(spec.Path.Value)
+			imports[path] = true
+		}
+	}
+	pkg.imports = sortedKeys(imports)
+	return pkg
+}
+
+// scanPprofFile records the pprof imports, handler registrations, servers,
+// address flags, and profiling rates in a file
+func scanPprofFile(pkg *pprofFindings, fset *token.FileSet, rel string, file *ast.File) {
+	at := func(node ast.Node, format string, args ...any) {
+		pkg.evidence = append(pkg.evidence, fmt.Sprintf("%s:%d: %s", filepath.ToSlash(rel), fset.Position(node.Pos()).Line, fmt.Sprintf(format, args...)))
+	}
+	names := map[string]string{} // local name -> import path
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		name := path[strings.LastIndex(path, "/")+1:]
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		names[name] = path
+		switch {
+		case path == "net/http/pprof":
+			pkg.imported = true
+			at(spec, "imports net/http/pprof")
+		case strings.Contains(path, "dd-trace-go") && strings.HasSuffix(path, "/profiler"):
+			pkg.datadog = true
+			at(spec, "imports the Datadog profiler")
+		}
+	}
+	imports := func(expr ast.Expr, match func(path string) bool) bool {
+		sel, ok := expr.(*ast.SelectorExpr)
+		if !ok {
+			return false
+		}
+		ident, ok := sel.X.(*ast.Ident)
+		return ok && match(names[ident.Name])
+	}
+	isPprof := func(path string) bool { return path == "net/http/pprof" }
+	isHTTP := func(path string) bool { return path == "net/http" }
+	isChi := func(path string) bool {
+		return strings.HasPrefix(path, "github.com/go-chi/chi") && strings.HasSuffix(path, "/middleware")
+	}
+	isGin := func(path string) bool { return path == "github.com/gin-contrib/pprof" }
+
+	ast.Inspect(file, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.CallExpr:
+			sel, ok := node.Fun.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			method := sel.Sel.Name
+			switch {
+			case (method == "HandleFunc" || method == "Handle") && len(node.Args) >= 2 && refersTo(node.Args[1:], func(expr ast.Expr) bool { return imports(expr, isPprof) }):
+				handler := pprofHandler{mux: types.ExprString(sel.X), path: stringLiteral(node.Args[0])}
+				pkg.handlers = append(pkg.handlers, handler)
+				at(node, "%s.%s(%q) with a pprof handler", handler.mux, method, handler.path)
+			case (method == "HandleFunc" || method == "Handle") && len(node.Args) >= 2 && strings.HasSuffix(stringLiteral(node.Args[0]), ratesPathSuffix):
+				pkg.handlers = append(pkg.handlers, pprofHandler{mux: types.ExprString(sel.X), path: stringLiteral(node.Args[0])})
+				at(node, "serves the capture rate endpoint")
+			case method == "Mount" && len(node.Args) == 2 && refersTo(node.Args[1:], func(expr ast.Expr) bool {
+				return imports(expr, isChi) && expr.(*ast.SelectorExpr).Sel.Name == "Profiler"
+			}):
+				handler := pprofHandler{mux: types.ExprString(sel.X), path: strings.TrimSuffix(stringLiteral(node.Args[0]), "/") + "/pprof/"}
+				pkg.handlers = append(pkg.handlers, handler)
+				at(node, "mounts chi's middleware.Profiler at %q", stringLiteral(node.Args[0]))
+			case method == "Register" && imports(node.Fun, isGin) && len(node.Args) >= 1:
+				path := defaultPprofPath
+				if len(node.Args) > 1 {
+					path = strings.TrimSuffix(stringLiteral(node.Args[1]), "/") + "/"
+				}
+				pkg.handlers = append(pkg.handlers, pprofHandler{mux: types.ExprString(node.Args[0]), path: path})
+				at(node, "registers gin-contrib/pprof")
+			case (method == "ListenAndServe" || method == "ListenAndServeTLS") && imports(node.Fun, isHTTP) && len(node.Args) >= 2:
+				listen := pprofListen{addr: stringLiteral(node.Args[0]), handler: handlerName(node.Args[len(node.Args)-1])}
+				pkg.listens = append(pkg.listens, listen)
+				at(node, "http.%s(%s, %s)", method, types.ExprString(node.Args[0]), types.ExprString(node.Args[len(node.Args)-1]))
+			case method == "SetMutexProfileFraction" && len(node.Args) == 1 && identIs(sel.X, names, "runtime"):
+				pkg.mutex = types.ExprString(node.Args[0])
+				at(node, "runtime.SetMutexProfileFraction(%s)", pkg.mutex)
+			case method == "SetBlockProfileRate" && len(node.Args) == 1 && identIs(sel.X, names, "runtime"):
+				pkg.block = types.ExprString(node.Args[0])
+				at(node, "runtime.SetBlockProfileRate(%s)", pkg.block)
+			case identIs(sel.X, names, "flag"):
+				if addr, ok := flagAddr(method, node.Args); ok {
+					pkg.flagAddrs = append(pkg.flagAddrs, addr)
+					at(node, "flag %s defaults to %s", flagName(method, node.Args), addr)
+				}
+			}
+		case *ast.CompositeLit:
+			if !imports(node.Type, isHTTP) || node.Type.(*ast.SelectorExpr).Sel.Name != "Server" {
+				return true
+			}
+			listen := pprofListen{}
+			found := false
+			for _, elt := range node.Elts {
+				kv, ok := elt.(*ast.KeyValueExpr)
+				if !ok {
+					continue
+				}
+				switch types.ExprString(kv.Key) {
+				case "Addr":
+					listen.addr, found = stringLiteral(kv.Value), true
+				case "Handler":
+					listen.handler = handlerName(kv.Value)
+				}
+			}
+			if found {
+				pkg.listens = append(pkg.listens, listen)
+				at(node, "http.Server{Addr: %q}", listen.addr)
+			}
+		}
+		return true
+	})
+}
+
+// mergePprof combines the findings of a service's packages
+func mergePprof(packages []*pprofFindings) *PprofInfo {
+	info := &PprofInfo{}
+	muxes := map[string]bool{}
+	paths := map[string]bool{}
+	imported := false
+	for _, pkg := range packages {
+		imported = imported || pkg.imported
+		info.DatadogProfiler = info.DatadogProfiler || pkg.datadog
+		info.Evidence = append(info.Evidence, pkg.evidence...)
+		if pkg.mutex != "" {
+			info.MutexProfileFraction = pkg.mutex
+		}
+		if pkg.block != "" {
+			info.BlockProfileRate = pkg.block
+		}
+		for _, handler := range pkg.handlers {
+			if strings.HasSuffix(handler.path, ratesPathSuffix) {
+				info.RateEndpoint = true
+				continue
+			}
+			muxes[handler.mux] = true
+			if handler.path != "" {
+				paths[handler.path] = true
+			}
+		}
+	}
+	// net/http/pprof registers on http.DefaultServeMux whenever it is
+	// imported; handlers registered on the package-level http functions are
+	// on it too.
+	defaultMux := imported && (len(muxes) == 0 || muxes["http"])
+	info.Enabled = imported || len(muxes) > 0
+	switch {
+	case len(muxes) > 0 && !(len(muxes) == 1 && muxes["http"]):
+		info.Mux = MuxCustom
+	case info.Enabled:
+		info.Mux = MuxDefault
+	}
+	if defaultMux && len(paths) == 0 {
+		paths[defaultPprofPath] = true
+	}
+	info.Paths = sortedKeys(paths)
+
+	addrs := map[string]bool{}
+	servesDefault := false
+	for _, pkg := range packages {
+		for _, listen := range pkg.listens {
+			serves := muxes[listen.handler] || listen.handler == "" && defaultMux
+			if !serves {
+				continue
+			}
+			servesDefault = servesDefault || listen.handler == ""
+			if listen.addr != "" {
+				addrs[listen.addr] = true
+			}
+		}
+		for _, addr := range pkg.flagAddrs {
+			addrs[addr] = true
+		}
+	}
+	if !info.Enabled {
+		addrs = map[string]bool{}
+	}
+	info.Addrs = sortedKeys(addrs)
+	ports := map[int]bool{}
+	for _, addr := range info.Addrs {
+		if port, ok := addrPort(addr); ok {
+			ports[port] = true
+		}
+	}
+	for port := range ports {
+		info.Ports = append(info.Ports, port)
+	}
+	sort.Ints(info.Ports)
+
+	switch {
+	case !info.Enabled:
+		info.Notes = append(info.Notes, "no pprof endpoint found: k8s and d2 captures will fail; use Datadog profiles or k8s.profiles.debug_capture")
+	case info.Mux == MuxDefault && !servesDefault:
+		info.Notes = append(info.Notes, "pprof handlers are on http.DefaultServeMux but no server with a nil handler was found; the endpoint may not be served")
+	}
+	if info.Enabled && len(info.Ports) == 0 {
+		info.Notes = append(info.Notes, noPortNote)
+	}
+	if info.Enabled && (info.MutexProfileFraction == "" || info.BlockProfileRate == "") {
+		if info.RateEndpoint {
+			info.Notes = append(info.Notes, "mutex or block sampling is off by default; captures can turn it on with mutex_rate and block_rate")
+		} else {
+			info.Notes = append(info.Notes, "mutex or block sampling is never enabled and there is no /debug/pprof/rates endpoint: those profiles will be empty")
+		}
+	}
+	return info
+}
+
+// refersTo reports whether any of exprs mentions a selector matching match
+func refersTo(exprs []ast.Expr, match func(ast.Expr) bool) bool {
+	found := false
+	for _, expr := range exprs {
+		ast.Inspect(expr, func(node ast.Node) bool {
+			if sel, ok := node.(*ast.SelectorExpr); ok && match(sel) {
+				found = true
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+// identIs reports whether expr names the package imported as path
+func identIs(expr ast.Expr, names map[string]string, path string) bool {
+	ident, ok := expr.(*ast.Ident)
+	return ok && names[ident.Name] == path
+}
+
+// handlerName is a server's handler as written, empty for nil (the
+// default mux); http.DefaultServeMux counts as the default mux too
+func handlerName(expr ast.Expr) string {
+	name := types.ExprString(expr)
+	if name == "nil" || strings.HasSuffix(name, ".DefaultServeMux") {
+		return ""
+	}
+	return name
+}
+
+// flagAddr reads the default of a flag whose name mentions pprof or debug:
+// an address for String flags, a port for Int flags
+func flagAddr(method string, args []ast.Expr) (string, bool) {
+	name := strings.ToLower(flagName(method, args))
+	if !strings.Contains(name, "pprof") && !strings.Contains(name, "debug") {
+		return "", false
+	}
+	value := 1
+	if strings.HasSuffix(method, "Var") {
+		value = 2
+	}
+	if len(args) <= value {
+		return "", false
+	}
+	switch method {
+	case "String", "StringVar":
+		addr := stringLiteral(args[value])
+		return addr, addr != ""
+	case "Int", "IntVar":
+		if lit, ok := args[value].(*ast.BasicLit); ok && lit.Kind == token.INT {
+			return ":" + lit.Value, true
+		}
+	}
+	return "", false
+}
+
+func flagName(method string, args []ast.Expr) string {
+	index := 0
+	if strings.HasSuffix(method, "Var") {
+		index = 1
+	}
+	if len(args) <= index {
+		return ""
+	}
+	return stringLiteral(args[index])
+}
+
+func stringLiteral(expr ast.Expr) string {
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return ""
+	}
+	value, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return ""
+	}
+	return value
+}
+
+func addrPort(addr string) (int, bool) {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(port)
+	return n, err == nil && n > 0
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscoverPprof(t *testing.T) {
+	repoRoot := t.TempDir()
+	write := func(path, content string) {
+		path = filepath.Join(repoRoot, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	write("go.mod", "module example.com/mono\n\ngo 1.25\n")
+	// Blank import, default mux served from a flag-configured address.
+	write("cmd/be-ledger/main.go", `package main
+
+import (
+	"flag"
+	"net/http"
+	_ "net/http/pprof"
+	"runtime"
+
+	"example.com/mono/internal/debug"
+)
+
+var pprofAddr = flag.String("pprof-addr", ":6060", "pprof listen address")
+
+func main() {
+	runtime.SetMutexProfileFraction(5)
+	debug.Rates()
+	go http.ListenAndServe(*pprofAddr, nil)
+}
+`)
+	write("internal/debug/rates.go", `package debug
+
+import (
+	"net/http"
+	"runtime"
+)
+
+func Rates() {
+	runtime.SetBlockProfileRate(1000)
+	http.HandleFunc("/debug/pprof/rates", func(http.ResponseWriter, *http.Request) {})
+}
+`)
+	// Handlers on a custom mux, registered in an imported package.
+	write("cmd/be-search/main.go", `package main
+
+import "example.com/mono/internal/server"
+
+func main() { server.Run() }
+`)
+	write("internal/server/server.go", `package server
+
+import (
+	"net/http"
+	pp "net/http/pprof"
+)
+
+func Run() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/internal/pprof/", pp.Index)
+	mux.Handle("/internal/pprof/heap", pp.Handler("heap"))
+	api := http.NewServeMux()
+	go http.ListenAndServe(":8080", api)
+	srv := &http.Server{Addr: "127.0.0.1:9090", Handler: mux}
+	srv.ListenAndServe()
+}
+`)
+	// No pprof at all.
+	write("cmd/be-worker/main.go", `package main
+
+import _ "gopkg.in/DataDog/dd-trace-go.v1/profiler"
+
+func main() {}
+`)
+
+	services, err := Discover(repoRoot)
+	require.NoError(t, err)
+	byBinary := map[string]ServiceInfo{}
+	for _, service := range services {
+		byBinary[service.Binary] = service
+	}
+
+	ledger := byBinary["be-ledger"].Pprof
+	require.True(t, ledger.Enabled)
+	require.Equal(t, MuxDefault, ledger.Mux)
+	require.Equal(t, []string{"/debug/pprof/"}, ledger.Paths)
+	require.Equal(t, []string{":6060"}, ledger.Addrs)
+	require.Equal(t, []int{6060}, ledger.Ports)
+	require.True(t, ledger.RateEndpoint)
+	require.Equal(t, "5", ledger.MutexProfileFraction)
+	require.Equal(t, "1000", ledger.BlockProfileRate)
+	require.Contains(t, ledger.Evidence, "cmd/be-ledger/main.go:6: imports net/http/pprof")
+	require.Empty(t, ledger.Notes)
+
+	search := byBinary["be-search"].Pprof
+	require.True(t, search.Enabled)
+	require.Equal(t, MuxCustom, search.Mux)
+	require.Equal(t, []string{"/internal/pprof/", "/internal/pprof/heap"}, search.Paths)
+	require.Equal(t, []string{"127.0.0.1:9090"}, search.Addrs)
+	require.Equal(t, []int{9090}, search.Ports)
+	require.Len(t, search.Notes, 1)
+	require.Contains(t, search.Notes[0], "profiles will be empty")
+
+	worker := byBinary["be-worker"].Pprof
+	require.False(t, worker.Enabled)
+	require.True(t, worker.DatadogProfiler)
+	require.Contains(t, worker.Notes[0], "no pprof endpoint found")
+}
@@ -0,0 +1,17 @@
+package tempfiles
+
+import "os"
+
+// processAlive reports whether pid is a running process; on Windows
+// FindProcess opens the process and fails when there is none.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+	return true
+}
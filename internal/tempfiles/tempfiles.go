@@ -0,0 +1,297 @@
+// Package tempfiles creates the scratch files and directories behind
+// downloads, extraction, and merges, and records each in an on-disk registry
+// until it is removed or handed to the caller as output. Entries whose
+// process has exited are swept, so a call cut short by a signal or crash does
+// not leak them.
+package tempfiles
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefixes are the name prefixes of the temp files and directories created
+// through this package in os.TempDir.
+var Prefixes = []string{
+	"gofast-profiles-",
+	"pprof-aggregate-",
+	"pprof-compare-",
+	"pprof-discover-",
+	"pprof-function-history-",
+	"pprof-flame-",
+	"pprof-mcp-cover-",
+	"pprof-mcp-index-",
+	"pprof-mcp-limited-",
+	"pprof-mcp-self-",
+}
+
+// MaxAge is how long an entry may live even while its process does; no call
+// runs this long, and a recycled process ID must not protect an entry
+// forever.
+const MaxAge = 24 * time.Hour
+
+// Entry is one registered temp resource.
+type Entry struct {
+	Path    string    `json:"path"`
+	PID     int       `json:"pid"`
+	Created time.Time `json:"created"`
+
+	marker string
+}
+
+// Temp is a temp file or directory registered until Remove or Keep.
+type Temp struct {
+	Path string
+
+	marker string
+	once   sync.Once
+}
+
+var (
+	mu     sync.Mutex
+	active = map[*Temp]bool{}
+)
+
+// RegistryDir is where entries are recorded: PPROF_MCP_TEMP_REGISTRY when
+// set, else pprof-mcp/temp under the user cache directory. "off" (or no
+// cache directory) keeps the registry in memory, which still cleans up on
+// shutdown but not after a crash.
+func RegistryDir() string {
+	if dir := strings.TrimSpace(os.Getenv("PPROF_MCP_TEMP_REGISTRY")); dir != "" {
+		if dir == "off" {
+			return ""
+		}
+		return dir
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "pprof-mcp", "temp")
+}
+
+// MkdirTemp is os.MkdirTemp with the directory registered.
+func MkdirTemp(dir, pattern string) (*Temp, error) {
+	path, err := os.MkdirTemp(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	return register(path), nil
+}
+
+// CreateTemp is os.CreateTemp with the file registered.
+func CreateTemp(dir, pattern string) (*Temp, *os.File, error) {
+	file, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, nil, err
+	}
+	return register(file.Name()), file, nil
+}
+
+func register(path string) *Temp {
+	t := &Temp{Path: path}
+	if abs, err := filepath.Abs(path); err == nil {
+		t.Path = abs
+	}
+	// A registry that cannot be written only loses crash safety.
+	t.marker, _ = writeMarker(Entry{Path: t.Path, PID: os.Getpid(), Created: time.Now().UTC()})
+	mu.Lock()
+	active[t] = true
+	mu.Unlock()
+	return t
+}
+
+func writeMarker(entry Entry) (string, error) {
+	dir := RegistryDir()
+	if dir == "" {
+		return "", nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.CreateTemp(dir, fmt.Sprintf("%d-*.json", entry.PID))
+	if err != nil {
+		return "", err
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// Remove deletes the resource and its registry entry. After Keep it does
+// nothing, so callers can defer Remove and Keep on success.
+func (t *Temp) Remove() {
+	t.finish(true)
+}
+
+// Keep drops the registry entry and leaves the resource for the caller.
+func (t *Temp) Keep() {
+	t.finish(false)
+}
+
+func (t *Temp) finish(remove bool) {
+	t.once.Do(func() {
+		if remove {
+			os.RemoveAll(t.Path)
+		}
+		if t.marker != "" {
+			os.Remove(t.marker)
+		}
+		mu.Lock()
+		delete(active, t)
+		mu.Unlock()
+	})
+}
+
+// Cleanup removes every resource this process still holds. The server runs
+// it on shutdown, after signals have cancelled the calls in flight.
+func Cleanup() int {
+	mu.Lock()
+	temps := make([]*Temp, 0, len(active))
+	for t := range active {
+		temps = append(temps, t)
+	}
+	mu.Unlock()
+	for _, t := range temps {
+		t.Remove()
+	}
+	return len(temps)
+}
+
+// List returns the registered entries of every process, oldest first.
+func List() ([]Entry, error) {
+	dir := RegistryDir()
+	if dir == "" {
+		return listActive(), nil
+	}
+	files, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []Entry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := []Entry{}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		marker := filepath.Join(dir, file.Name())
+		data, err := os.ReadFile(marker)
+		if err != nil {
+			continue
+		}
+		var entry Entry
+		if json.Unmarshal(data, &entry) != nil || entry.Path == "" {
+			// Half-written by a process that died mid-write.
+			if info, err := file.Info(); err == nil && time.Since(info.ModTime()) > time.Minute {
+				os.Remove(marker)
+			}
+			continue
+		}
+		entry.marker = marker
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Created.Before(entries[j].Created) })
+	return entries, nil
+}
+
+func listActive() []Entry {
+	mu.Lock()
+	defer mu.Unlock()
+	entries := []Entry{}
+	for t := range active {
+		entries = append(entries, Entry{Path: t.Path, PID: os.Getpid()})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries
+}
+
+// Leaked reports whether the entry outlived the call that created it: its
+// process has exited, or it is older than MaxAge.
+func (e Entry) Leaked() bool {
+	if !e.Created.IsZero() && time.Since(e.Created) > MaxAge {
+		return true
+	}
+	return e.PID != os.Getpid() && !processAlive(e.PID)
+}
+
+// Sweep removes leaked entries and their resources, returning the paths
+// removed.
+func Sweep() ([]string, error) {
+	entries, err := List()
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for _, entry := range entries {
+		if entry.marker == "" || !entry.Leaked() {
+			continue
+		}
+		if err := os.RemoveAll(entry.Path); err != nil {
+			continue
+		}
+		os.Remove(entry.marker)
+		removed = append(removed, entry.Path)
+	}
+	return removed, nil
+}
+
+// Unregistered lists the files and directories in os.TempDir named like the
+// temps of this package but missing from entries: leftovers from before the
+// registry, or outputs already handed to a caller.
+func Unregistered(entries []Entry) []string {
+	registered := map[string]bool{}
+	for _, entry := range entries {
+		registered[entry.Path] = true
+	}
+	dir := os.TempDir()
+	files, _ := os.ReadDir(dir)
+	paths := []string{}
+	for _, file := range files {
+		path := filepath.Join(dir, file.Name())
+		if registered[path] {
+			continue
+		}
+		for _, prefix := range Prefixes {
+			if strings.HasPrefix(file.Name(), prefix) {
+				paths = append(paths, path)
+				break
+			}
+		}
+	}
+	return paths
+}
+
+// Size returns the bytes in the file or directory at path, 0 when it is gone.
+func Size(path string) int64 {
+	var size int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && !d.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,105 @@
+package tempfiles
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func setRegistry(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("PPROF_MCP_TEMP_REGISTRY", dir)
+	return dir
+}
+
+func TestRemoveAndKeep(t *testing.T) {
+	setRegistry(t)
+	scratch, err := MkdirTemp(t.TempDir(), "scratch-*")
+	require.NoError(t, err)
+	output, file, err := CreateTemp(t.TempDir(), "output-*")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	entries, err := List()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	for _, entry := range entries {
+		require.Equal(t, os.Getpid(), entry.PID)
+		require.False(t, entry.Leaked())
+	}
+
+	output.Keep()
+	output.Remove() // no-op after Keep
+	require.FileExists(t, output.Path)
+	scratch.Remove()
+	require.NoDirExists(t, scratch.Path)
+
+	entries, err = List()
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestSweepRemovesEntriesOfExitedProcesses(t *testing.T) {
+	setRegistry(t)
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	require.NoError(t, cmd.Run())
+	exited := cmd.Process.Pid
+
+	dead := filepath.Join(t.TempDir(), "dead")
+	require.NoError(t, os.Mkdir(dead, 0o755))
+	_, err := writeMarker(Entry{Path: dead, PID: exited, Created: time.Now()})
+	require.NoError(t, err)
+	stale := filepath.Join(t.TempDir(), "stale")
+	require.NoError(t, os.WriteFile(stale, []byte("x"), 0o644))
+	_, err = writeMarker(Entry{Path: stale, PID: os.Getpid(), Created: time.Now().Add(-2 * MaxAge)})
+	require.NoError(t, err)
+	live, err := MkdirTemp(t.TempDir(), "live-*")
+	require.NoError(t, err)
+	defer live.Remove()
+
+	removed, err := Sweep()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{dead, stale}, removed)
+	require.NoDirExists(t, dead)
+	require.NoFileExists(t, stale)
+	require.DirExists(t, live.Path)
+
+	entries, err := List()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, live.Path, entries[0].Path)
+}
+
+func TestCleanup(t *testing.T) {
+	setRegistry(t)
+	a, err := MkdirTemp(t.TempDir(), "a-*")
+	require.NoError(t, err)
+	b, file, err := CreateTemp(t.TempDir(), "b-*")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	require.Equal(t, 2, Cleanup())
+	require.NoDirExists(t, a.Path)
+	require.NoFileExists(t, b.Path)
+	entries, err := List()
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestMemoryRegistry(t *testing.T) {
+	t.Setenv("PPROF_MCP_TEMP_REGISTRY", "off")
+	tmp, err := MkdirTemp(t.TempDir(), "mem-*")
+	require.NoError(t, err)
+	entries, err := List()
+	require.NoError(t, err)
+	require.Equal(t, []Entry{{Path: tmp.Path, PID: os.Getpid()}}, entries)
+	tmp.Remove()
+	entries, err = List()
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
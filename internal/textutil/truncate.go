@@ -1,6 +1,9 @@
 package textutil
 
-import "strings"
+import (
+	"strings"
+	"unicode/utf8"
+)
 
 type TruncateStrategy string
 
@@ -10,6 +13,17 @@ const (
 	StrategyHeadTail TruncateStrategy = "head_tail"
 )
 
+// Reasons reported in TruncateMeta.TruncatedReason, comma-separated when
+// more than one limit cut the text.
+const (
+	ReasonMaxLines = "max_lines"
+	ReasonMaxBytes = "max_bytes"
+	// ReasonCaptureLimit means the command's output passed the capture cap
+	// (PPROF_MCP_MAX_STDOUT_BYTES/PPROF_MCP_MAX_STDERR_BYTES) before any
+	// caller limit applied.
+	ReasonCaptureLimit = "capture_limit"
+)
+
 type TruncateOptions struct {
 	MaxLines int
 	MaxBytes int
@@ -48,11 +62,11 @@ func TruncateText(raw string, opts TruncateOptions) TruncateResult {
 
 	if opts.MaxLines > 0 && result.Meta.TotalLines > opts.MaxLines {
 		trimmed = truncateByLines(trimmed, opts.MaxLines, strategy)
-		reasons = append(reasons, "max_lines")
+		reasons = append(reasons, ReasonMaxLines)
 	}
 	if opts.MaxBytes > 0 && len(trimmed) > opts.MaxBytes {
 		trimmed = truncateByBytes(trimmed, opts.MaxBytes, strategy)
-		reasons = append(reasons, "max_bytes")
+		reasons = append(reasons, ReasonMaxBytes)
 	}
 
 	if len(reasons) > 0 {
@@ -64,6 +78,64 @@ func TruncateText(raw string, opts TruncateOptions) TruncateResult {
 	return result
 }
 
+// ApplyLimits truncates raw like TruncateText. base, when set, describes
+// where raw came from, such as a capped command capture or an earlier cut:
+// its totals and reasons carry over, so the metadata always describes the
+// original text and every limit that shortened it.
+func ApplyLimits(raw string, base *TruncateMeta, opts TruncateOptions) (string, TruncateMeta) {
+	result := TruncateText(raw, opts)
+	if base == nil {
+		return result.Text, result.Meta
+	}
+	return result.Text, MergeMeta(*base, result.Meta)
+}
+
+// MergeMeta combines the metadata of text that was truncated twice: base
+// from the first cut, extra from the second.
+func MergeMeta(base, extra TruncateMeta) TruncateMeta {
+	merged := base
+	if merged.TotalBytes == 0 {
+		merged.TotalBytes = extra.TotalBytes
+	}
+	if merged.TotalLines == 0 {
+		merged.TotalLines = extra.TotalLines
+	}
+	merged.Truncated = base.Truncated || extra.Truncated
+	merged.TruncatedReason = mergeReasons(base.TruncatedReason, extra.TruncatedReason)
+	if extra.Strategy != "" {
+		merged.Strategy = extra.Strategy
+	}
+	if !merged.Truncated {
+		merged.TruncatedReason = ""
+	}
+	return merged
+}
+
+func mergeReasons(reasons ...string) string {
+	seen := map[string]struct{}{}
+	ordered := make([]string, 0, len(reasons))
+	for _, reason := range reasons {
+		for _, item := range strings.Split(reason, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			if _, ok := seen[item]; ok {
+				continue
+			}
+			seen[item] = struct{}{}
+			ordered = append(ordered, item)
+		}
+	}
+	return strings.Join(ordered, ",")
+}
+
+// ParseStrategy reads a truncate_strategy argument; anything but "tail" or
+// "head_tail" means head.
+func ParseStrategy(raw string) TruncateStrategy {
+	return normalizeStrategy(TruncateStrategy(strings.ToLower(strings.TrimSpace(raw))))
+}
+
 func CountLines(raw string) int {
 	if raw == "" {
 		return 0
@@ -120,20 +192,39 @@ func truncateByBytes(raw string, maxBytes int, strategy TruncateStrategy) string
 	}
 	switch strategy {
 	case StrategyTail:
-		return raw[len(raw)-maxBytes:]
+		return tailBytes(raw, maxBytes)
 	case StrategyHeadTail:
 		if maxBytes <= len(truncateMarker) {
-			return raw[:maxBytes]
+			return headBytes(raw, maxBytes)
 		}
 		headCount := (maxBytes - len(truncateMarker)) / 2
 		tailCount := maxBytes - len(truncateMarker) - headCount
 		if tailCount <= 0 {
-			return raw[:maxBytes]
+			return headBytes(raw, maxBytes)
 		}
-		return raw[:headCount] + truncateMarker + raw[len(raw)-tailCount:]
+		return headBytes(raw, headCount) + truncateMarker + tailBytes(raw, tailCount)
 	default:
-		return raw[:maxBytes]
+		return headBytes(raw, maxBytes)
+	}
+}
+
+// headBytes returns at most n leading bytes of raw, backing off so a
+// multi-byte character is not split.
+func headBytes(raw string, n int) string {
+	for n > 0 && n < len(raw) && !utf8.RuneStart(raw[n]) {
+		n--
+	}
+	return raw[:n]
+}
+
+// tailBytes returns at most n trailing bytes of raw without splitting a
+// multi-byte character.
+func tailBytes(raw string, n int) string {
+	start := len(raw) - n
+	for start < len(raw) && !utf8.RuneStart(raw[start]) {
+		start++
 	}
+	return raw[start:]
 }
 
 func splitLines(raw string) []string {
@@ -3,6 +3,7 @@ package textutil
 import (
 	"strings"
 	"testing"
+	"unicode/utf8"
 )
 
 func TestTruncateTextMaxBytesSingleLine(t *testing.T) {
@@ -58,3 +59,35 @@ func TestTruncateTextHeadTailStrategy(t *testing.T) {
 		t.Fatalf("expected truncated=true")
 	}
 }
+
+func TestApplyLimitsKeepsCaptureMeta(t *testing.T) {
+	// A capture already cut at 12 of 40 bytes, then cut again by the caller.
+	base := TruncateMeta{TotalLines: 8, TotalBytes: 40, Truncated: true, TruncatedReason: ReasonCaptureLimit, Strategy: string(StrategyHead)}
+	text, meta := ApplyLimits("one\ntwo\nthre", &base, TruncateOptions{MaxLines: 1, Strategy: ParseStrategy(" TAIL ")})
+	if text != "thre" {
+		t.Fatalf("expected last line, got %q", text)
+	}
+	if meta.TotalLines != 8 || meta.TotalBytes != 40 {
+		t.Fatalf("expected totals of the original output, got %+v", meta)
+	}
+	if meta.TruncatedReason != "capture_limit,max_lines" || meta.Strategy != string(StrategyTail) {
+		t.Fatalf("unexpected meta %+v", meta)
+	}
+
+	text, meta = ApplyLimits("short", nil, TruncateOptions{MaxBytes: 100})
+	if text != "short" || meta.Truncated || meta.TruncatedReason != "" {
+		t.Fatalf("expected untouched text, got %q %+v", text, meta)
+	}
+}
+
+func TestTruncateByBytesKeepsCharacters(t *testing.T) {
+	raw := "héllo wörld ✓"
+	for _, strategy := range []TruncateStrategy{StrategyHead, StrategyTail, StrategyHeadTail} {
+		for limit := 1; limit < len(raw); limit++ {
+			got := TruncateText(raw, TruncateOptions{MaxBytes: limit, Strategy: strategy}).Text
+			if !utf8.ValidString(got) || len(got) > limit {
+				t.Fatalf("%s/%d: got %q", strategy, limit, got)
+			}
+		}
+	}
+}